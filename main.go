@@ -15,11 +15,15 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -27,26 +31,51 @@ import (
 	"github.com/facebookgo/inject"
 	"github.com/robfig/cron"
 
+	"github.com/skygeario/skygear-server/pkg/server/anonymous"
 	"github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
+	"github.com/skygeario/skygear-server/pkg/server/captcha"
+	"github.com/skygeario/skygear-server/pkg/server/chat"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
+	"github.com/skygeario/skygear-server/pkg/server/geoip"
+	"github.com/skygeario/skygear-server/pkg/server/graceful"
 	"github.com/skygeario/skygear-server/pkg/server/handler"
+	"github.com/skygeario/skygear-server/pkg/server/idempotency"
+	"github.com/skygeario/skygear-server/pkg/server/idgen"
+	"github.com/skygeario/skygear-server/pkg/server/livelog"
+	"github.com/skygeario/skygear-server/pkg/server/loadgen"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/mail"
+	"github.com/skygeario/skygear-server/pkg/server/maintenance"
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/plugin"
 	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
 	_ "github.com/skygeario/skygear-server/pkg/server/plugin/exec"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
 	_ "github.com/skygeario/skygear-server/pkg/server/plugin/http"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/observer"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	_ "github.com/skygeario/skygear-server/pkg/server/plugin/zmq"
 	pp "github.com/skygeario/skygear-server/pkg/server/preprocessor"
 	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
+	"github.com/skygeario/skygear-server/pkg/server/responsecache"
+	"github.com/skygeario/skygear-server/pkg/server/retention"
 	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/schedule"
+	"github.com/skygeario/skygear-server/pkg/server/seed"
 	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	_ "github.com/skygeario/skygear-server/pkg/server/skydb/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skyversion"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
 	"github.com/skygeario/skygear-server/pkg/server/subscription"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
 var log = logging.LoggerEntry("")
@@ -68,6 +97,26 @@ func main() {
 
 	initLogger(config)
 
+	if err := idgen.Use(config.App.IDStrategy); err != nil {
+		log.Fatalf("Failed to set ID strategy: %v", err)
+	}
+
+	outboundConfig := initOutbound(config)
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		if len(os.Args) != 3 {
+			fmt.Println("Usage: skygear-server seed <dir>")
+			os.Exit(1)
+		}
+		seedDB(ensureDB(config), os.Args[2])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "loadgen" {
+		runLoadgen(config, os.Args[2:])
+		return
+	}
+
 	log.Infof("Starting Skygear Server(%s)...", skyversion.Version())
 	connOpener := ensureDB(config) // Fatal on DB failed
 
@@ -78,8 +127,35 @@ func main() {
 	// Init all the services
 	r := router.NewRouter()
 	r.ResponseTimeout = time.Duration(config.App.ResponseTimeout) * time.Second
+	fieldFilter := initResponseFilter(config)
+	if fieldFilter.Enabled() {
+		r.ResponseFilter = fieldFilter
+	}
+	if idempotencyCache := initIdempotencyCache(config); idempotencyCache.Enabled() {
+		r.IdempotencyStore = idempotencyCache
+	}
+	if responseCache := initResponseCache(config); responseCache.Enabled() {
+		r.ResponseCache = responseCache
+	}
+	if concurrencyLimiter := initConcurrencyLimiter(config); concurrencyLimiter.Enabled() {
+		r.Concurrency = concurrencyLimiter
+	}
+	if apiKeyRateLimiter := initRateLimiter(config.RateLimit.PerAPIKey, "API key"); apiKeyRateLimiter.Enabled() {
+		r.APIKeyRateLimiter = apiKeyRateLimiter
+	}
+	maintenanceSwitch := initMaintenanceSwitch(config)
+	r.Gatekeeper = maintenanceSwitch
+	liveLog := &livelog.Controller{}
+	r.BodyCapturer = liveLog
+	pubSubACL := initPubSubACL(config)
 	serveMux := http.NewServeMux()
-	pushSender := initPushSender(config, connOpener)
+	routeSender := initPushSender(config, connOpener, outboundConfig)
+	var pushSender push.Sender = &push.PayloadFitter{
+		Sender:     routeSender,
+		TrimFields: config.Push.TrimFields,
+	}
+	pushQueue := workqueue.NewQueue("push", queueConcurrency(config.WorkQueue.PushConcurrency))
+	hookQueue := workqueue.NewQueue("hook", queueConcurrency(config.WorkQueue.HookConcurrency))
 
 	tokenStore := authtoken.InitTokenStore(authtoken.Configuration{
 		Implementation: config.TokenStore.ImplName,
@@ -87,7 +163,10 @@ func main() {
 		Prefix:         config.TokenStore.Prefix,
 		Expiry:         config.TokenStore.Expiry,
 		Secret:         config.TokenStore.Secret,
+
+		PreviousSecrets: config.TokenStore.PreviousSecrets,
 	})
+	apps, tokenStore, assetPrefixes := initApps(config, tokenStore)
 
 	preprocessorRegistry := router.PreprocessorRegistry{}
 
@@ -100,16 +179,37 @@ func main() {
 		Mux:              serveMux,
 		Preprocessors:    preprocessorRegistry,
 		HookRegistry:     hook.NewRegistry(),
+		HookQueue:        hookQueue,
+		ObserverRegistry: observer.NewRegistry(handler.ParseQuery),
 		ProviderRegistry: provider.NewRegistry(),
 		Scheduler:        cronjob,
 		Config:           config,
 	}
 
-	var internalHub *pubsub.Hub
+	if lambda := config.PluginHandler.InspectorLambda; lambda != "" {
+		pluginContext.RequestInspectors = append(pluginContext.RequestInspectors, &plugin.LambdaRequestInspector{
+			Name:   lambda,
+			Runner: &pluginContext,
+		})
+		log.Infof("Requests to plugin handlers are inspected by lambda %s", lambda)
+	}
+
+	initAuthProvider(config, pluginContext.ProviderRegistry)
+
+	moderationPipeline := initModeration(config, pluginContext.HookRegistry)
+
+	var internalHub, publicHub *pubsub.Hub
+	var subscriptionService *subscription.Service
 	if !config.App.Slave {
 		internalHub = pubsub.NewHub()
-		initSubscription(config, connOpener, internalHub, pushSender)
+		publicHub = pubsub.NewHub()
+		subscriptionService = initSubscription(config, connOpener, internalHub, pushSender, pushQueue, pluginContext.ObserverRegistry, moderationPipeline)
 		initDevice(config, connOpener)
+		initStats(config, cronjob, connOpener)
+		initAnonymousPurge(config, cronjob, connOpener)
+		initChat(config, connOpener)
+		initScheduledMutation(config, cronjob, connOpener, pluginContext.HookRegistry)
+		initRetention(config, cronjob, connOpener, pluginContext.HookRegistry)
 	}
 
 	// Preprocessor
@@ -120,12 +220,14 @@ func main() {
 		ClientKey: config.App.APIKey,
 		MasterKey: config.App.MasterKey,
 		AppName:   config.App.Name,
+		Apps:      apps,
 	}
 	preprocessorRegistry["authenticator"] = &pp.UserAuthenticator{
 		ClientKey:  config.App.APIKey,
 		MasterKey:  config.App.MasterKey,
 		AppName:    config.App.Name,
 		TokenStore: tokenStore,
+		Apps:       apps,
 	}
 	preprocessorRegistry["dbconn"] = &pp.ConnPreprocessor{
 		AppName:       config.App.Name,
@@ -134,13 +236,27 @@ func main() {
 		DBImpl:        config.DB.ImplName,
 		Option:        config.DB.Option,
 		DevMode:       config.App.DevMode,
+		DDLOption:     config.DB.DDLOption,
+		Apps:          apps,
 	}
 	preprocessorRegistry["plugin_ready"] = &pp.EnsurePluginReadyPreprocessor{
 		PluginContext: &pluginContext,
 		ClientKey:     config.App.APIKey,
 		MasterKey:     config.App.MasterKey,
 	}
-	preprocessorRegistry["inject_user"] = &pp.InjectUserIfPresent{}
+	preprocessorRegistry["inject_user"] = &pp.InjectUserIfPresent{
+		AnonymousPolicy: &anonymous.Policy{
+			AllowedActions:  config.Anonymous.AllowedActions,
+			RecordTypes:     config.Anonymous.RecordTypes,
+			WritesPerMinute: config.Anonymous.WritesPerMinute,
+		},
+	}
+	preprocessorRegistry["captcha"] = &pp.RequireCaptcha{
+		Guard: initCaptchaGuard(config, &pluginContext),
+		GeoIP: &geoip.Resolver{
+			TrustProxy: config.GeoIP.TrustProxy,
+		},
+	}
 	preprocessorRegistry["require_user"] = &pp.RequireUserForWrite{}
 	preprocessorRegistry["inject_db"] = &pp.InjectDatabase{}
 	preprocessorRegistry["inject_public_db"] = &pp.InjectPublicDatabase{}
@@ -148,6 +264,8 @@ func main() {
 		DevMode: config.App.DevMode,
 	}
 
+	forgotPasswordSettings := initForgotPassword(config)
+
 	g := &inject.Graph{}
 	injectErr := g.Provide(
 		&inject.Object{
@@ -170,11 +288,30 @@ func main() {
 			Complete: true,
 			Name:     "AssetStore",
 		},
+		&inject.Object{
+			Value:    fieldFilter,
+			Complete: true,
+			Name:     "FieldFilter",
+		},
+		&inject.Object{
+			Value: &asset.HeaderPolicy{
+				CacheControl:       config.AssetHeaders.CacheControl,
+				ContentDisposition: config.AssetHeaders.ContentDisposition,
+				AllowOrigin:        config.AssetHeaders.AllowOrigin,
+			},
+			Complete: true,
+			Name:     "AssetHeaderPolicy",
+		},
 		&inject.Object{
 			Value:    pushSender,
 			Complete: true,
 			Name:     "PushSender",
 		},
+		&inject.Object{
+			Value:    pushQueue,
+			Complete: true,
+			Name:     "PushQueue",
+		},
 		&inject.Object{
 			Value:    pluginEvent.NewSender(&pluginContext),
 			Complete: true,
@@ -185,6 +322,75 @@ func main() {
 			Complete: true,
 			Name:     "AccessModel",
 		},
+		&inject.Object{
+			Value:    moderationPipeline,
+			Complete: true,
+			Name:     "ModerationPipeline",
+		},
+		&inject.Object{
+			Value:    initGeoIP(config),
+			Complete: true,
+			Name:     "GeoIPResolver",
+		},
+		&inject.Object{
+			Value: &quota.Enforcer{
+				Limits: quota.Limits{
+					RecordCount: config.Quota.PrivateRecordCount,
+					StorageSize: config.Quota.PrivateStorageSize,
+				},
+			},
+			Complete: true,
+			Name:     "QuotaEnforcer",
+		},
+		&inject.Object{
+			Value:    maintenanceSwitch,
+			Complete: true,
+			Name:     "MaintenanceSwitch",
+		},
+		&inject.Object{
+			Value:    liveLog,
+			Complete: true,
+			Name:     "LiveLogController",
+		},
+		&inject.Object{
+			Value:    pubSubACL,
+			Complete: true,
+			Name:     "PubSubACL",
+		},
+		&inject.Object{
+			Value:    initRecordIDPolicy(config),
+			Complete: true,
+			Name:     "RecordIDPolicy",
+		},
+		&inject.Object{
+			Value: &throttle.Limiter{
+				WritesPerMinute: config.Throttle.RecordWritesPerMinute,
+			},
+			Complete: true,
+			Name:     "RecordThrottle",
+		},
+		&inject.Object{
+			Value:    &stats.Recorder{Enabled: config.Stats.Enable},
+			Complete: true,
+			Name:     "RecordStats",
+		},
+		&inject.Object{
+			Value:    &chat.Notifier{Hub: publicHub},
+			Complete: true,
+			Name:     "ChatNotifier",
+		},
+		&inject.Object{
+			Value:    forgotPasswordSettings,
+			Complete: true,
+			Name:     "ForgotPasswordSettings",
+		},
+		&inject.Object{
+			Value: &handler.QuerySettings{
+				MaxIncludeDepth: config.Query.MaxIncludeDepth,
+			},
+			Complete: true,
+			Name:     "QuerySettings",
+		},
 	)
 	if injectErr != nil {
 		panic(fmt.Sprintf("Unable to set up handler: %v", injectErr))
@@ -201,17 +407,44 @@ func main() {
 	r.Map("auth:signup", injector.Inject(&handler.SignupHandler{}))
 	r.Map("auth:login", injector.Inject(&handler.LoginHandler{}))
 	r.Map("auth:logout", injector.Inject(&handler.LogoutHandler{}))
+	r.Map("auth:refresh", injector.Inject(&handler.RefreshHandler{
+		RefreshWindow: time.Duration(config.TokenStore.RefreshWindow) * time.Second,
+	}))
 	r.Map("auth:password", injector.Inject(&handler.PasswordHandler{}))
+	if forgotPasswordSettings.Mailer.Enabled() {
+		r.Map("auth:forgot_password", injector.Inject(&handler.ForgotPasswordHandler{}))
+		r.Map("auth:reset_password", injector.Inject(&handler.ResetPasswordHandler{}))
+	}
 
-	r.Map("asset:put", injector.Inject(&handler.AssetUploadHandler{}))
+	r.Map("asset:put", injector.Inject(&handler.AssetUploadHandler{
+		AssetPrefixes: assetPrefixes,
+	}))
+	r.Map("asset:status", injector.Inject(&handler.AssetStatusHandler{}))
 
 	r.Map("record:fetch", injector.Inject(&handler.RecordFetchHandler{}))
 	r.Map("record:query", injector.Inject(&handler.RecordQueryHandler{}))
+	r.Map("record:rank", injector.Inject(&handler.RecordRankHandler{}))
 	r.Map("record:save", injector.Inject(&handler.RecordSaveHandler{}))
 	r.Map("record:delete", injector.Inject(&handler.RecordDeleteHandler{}))
+	r.Map("record:sync", injector.Inject(&handler.RecordSyncHandler{}))
+	r.Map("record:archive_fetch", injector.Inject(&handler.RecordArchiveFetchHandler{}))
+	if config.ScheduledMutation.Enable {
+		r.Map("record:schedule", injector.Inject(&handler.RecordScheduleHandler{}))
+		r.Map("record:schedule:query", injector.Inject(&handler.RecordScheduleQueryHandler{}))
+		r.Map("record:schedule:cancel", injector.Inject(&handler.RecordScheduleCancelHandler{}))
+	}
+
+	r.Map("moderation:approve", injector.Inject(&handler.ModerationReviewHandler{
+		Verdict: moderation.Approved,
+	}))
+	r.Map("moderation:reject", injector.Inject(&handler.ModerationReviewHandler{
+		Verdict: moderation.Rejected,
+	}))
 
 	r.Map("device:register", injector.Inject(&handler.DeviceRegisterHandler{}))
 	r.Map("device:unregister", injector.Inject(&handler.DeviceUnregisterHandler{}))
+	r.Map("device:list", injector.Inject(&handler.DeviceListHandler{}))
+	r.Map("device:inventory", injector.Inject(&handler.DeviceInventoryHandler{}))
 
 	// subscription shares the same set of preprocessor as record read at the moment
 	r.Map("subscription:fetch_all", injector.Inject(&handler.SubscriptionFetchAllHandler{}))
@@ -226,27 +459,60 @@ func main() {
 
 	r.Map("me", injector.Inject(&handler.MeHandler{}))
 
+	r.Map("quota:status", injector.Inject(&handler.QuotaStatusHandler{}))
+	r.Map("maintenance:set", injector.Inject(&handler.MaintenanceSetHandler{}))
+	r.Map("maintenance:status", injector.Inject(&handler.MaintenanceStatusHandler{}))
+	r.Map("log:set", injector.Inject(&handler.LiveLogSetHandler{}))
+	r.Map("pubsub:set_rules", injector.Inject(&handler.PubSubSetRulesHandler{}))
+	r.Map("pubsub:get_rules", injector.Inject(&handler.PubSubRulesHandler{}))
+
+	r.Map("stats:fetch", injector.Inject(&handler.StatsFetchHandler{}))
+	r.Map("stats:storage", injector.Inject(&handler.StatsStorageHandler{}))
+
+	if config.Chat.Enable {
+		r.Map("chat:create_conversation", injector.Inject(&handler.ChatCreateConversationHandler{}))
+		r.Map("chat:get_conversations", injector.Inject(&handler.ChatGetConversationsHandler{}))
+		r.Map("chat:add_participants", injector.Inject(&handler.ChatAddParticipantsHandler{}))
+		r.Map("chat:remove_participants", injector.Inject(&handler.ChatRemoveParticipantsHandler{}))
+		r.Map("chat:send_message", injector.Inject(&handler.ChatSendMessageHandler{}))
+		r.Map("chat:get_messages", injector.Inject(&handler.ChatGetMessagesHandler{}))
+		r.Map("chat:mark_as_read", injector.Inject(&handler.ChatMarkAsReadHandler{}))
+		r.Map("chat:typing", injector.Inject(&handler.ChatTypingHandler{}))
+	}
+
 	r.Map("user:query", injector.Inject(&handler.UserQueryHandler{}))
 	r.Map("user:update", injector.Inject(&handler.UserUpdateHandler{}))
 	r.Map("user:link", injector.Inject(&handler.UserLinkHandler{}))
+	r.Map("user:revoke_tokens", injector.Inject(&handler.UserRevokeTokensHandler{}))
 
 	r.Map("role:default", injector.Inject(&handler.RoleDefaultHandler{}))
 	r.Map("role:admin", injector.Inject(&handler.RoleAdminHandler{}))
+	r.Map("role:assign", injector.Inject(&handler.RoleAssignHandler{}))
+	r.Map("role:revoke", injector.Inject(&handler.RoleRevokeHandler{}))
 
-	r.Map("push:user", injector.Inject(&handler.PushToUserHandler{}))
-	r.Map("push:device", injector.Inject(&handler.PushToDeviceHandler{}))
+	pushAccess := handler.PushAccess(config.Push.Access)
+	r.Map("push:user", injector.Inject(&handler.PushToUserHandler{Access: pushAccess}))
+	r.Map("push:device", injector.Inject(&handler.PushToDeviceHandler{Access: pushAccess}))
 
 	r.Map("schema:rename", injector.Inject(&handler.SchemaRenameHandler{}))
 	r.Map("schema:delete", injector.Inject(&handler.SchemaDeleteHandler{}))
 	r.Map("schema:create", injector.Inject(&handler.SchemaCreateHandler{}))
 	r.Map("schema:fetch", injector.Inject(&handler.SchemaFetchHandler{}))
 	r.Map("schema:access", injector.Inject(&handler.SchemaAccessHandler{}))
+	r.Map("schema:export", injector.Inject(&handler.SchemaExportHandler{}))
+	r.Map("schema:apply", injector.Inject(&handler.SchemaApplyHandler{}))
 
 	serveMux.Handle("/", r)
 
+	if config.Metrics.Enable {
+		initMetrics(config)
+		serveMux.Handle(config.Metrics.Path, metrics.DefaultRegistry)
+	}
+
 	// Following section is for Gateway
 	if !config.App.Slave {
-		pubSub := pubsub.NewWsPubsub(nil)
+		pubSub := pubsub.NewWsPubsub(publicHub)
+		pubSub.ACL = pubSubACL
 		pubSubGateway := router.NewGateway("", "/pubsub", serveMux)
 		pubSubGateway.GET(injector.InjectProcessors(&handler.PubSubHandler{
 			WebSocket: pubSub,
@@ -263,7 +529,9 @@ func main() {
 	fileGateway.ResponseTimeout = time.Duration(config.App.ResponseTimeout) * time.Second
 	fileGateway.GET(injector.Inject(&handler.GetFileHandler{}))
 
-	uploadFileHandler := injector.Inject(&handler.UploadFileHandler{})
+	uploadFileHandler := injector.Inject(&handler.UploadFileHandler{
+		AssetPrefixes: assetPrefixes,
+	})
 	fileGateway.PUT(uploadFileHandler)
 	fileGateway.POST(uploadFileHandler)
 
@@ -272,8 +540,10 @@ func main() {
 	var finalMux http.Handler
 	if corsHost != "" {
 		finalMux = &router.CORSMiddleware{
-			Origin: corsHost,
-			Next:   serveMux,
+			Origin:  corsHost,
+			Methods: config.App.CORSMethods,
+			Headers: config.App.CORSHeaders,
+			Next:    serveMux,
 		}
 	} else {
 		finalMux = serveMux
@@ -302,23 +572,461 @@ func main() {
 		finalMux = loggingMiddleware
 	}
 
+	if config.HTTP.Gzip {
+		finalMux = &router.GzipMiddleware{
+			MinSize: config.HTTP.GzipMinSize,
+			Next:    finalMux,
+		}
+	}
+
+	if ipRateLimiter := initRateLimiter(config.RateLimit.PerIP, "IP address"); ipRateLimiter.Enabled() {
+		finalMux = &router.RateLimitMiddleware{
+			Limiter:  ipRateLimiter,
+			ClientIP: (&geoip.Resolver{TrustProxy: config.GeoIP.TrustProxy}).ClientIP,
+			Next:     finalMux,
+		}
+	}
+
 	// Bootstrap finished, starting services
 	initPlugin(config, &pluginContext)
 
+	publicListener := &router.ListenerMiddleware{
+		MaxBodySize: config.HTTP.MaxBodySize,
+		Next:        finalMux,
+	}
+	if config.HTTP.InternalHost != "" {
+		publicListener.MasterKey = config.App.MasterKey
+	}
+
 	log.Printf("Listening on %v...", config.HTTP.Host)
-	err := http.ListenAndServe(config.HTTP.Host, finalMux)
-	if err != nil {
+	server := &graceful.Server{
+		Addr:    config.HTTP.Host,
+		Handler: publicListener,
+	}
+	served := make(chan error, 2)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+
+	var internalServer *graceful.Server
+	if config.HTTP.InternalHost != "" {
+		log.Printf("Listening on %v for requests with master key...", config.HTTP.InternalHost)
+		internalServer = &graceful.Server{
+			Addr: config.HTTP.InternalHost,
+			Handler: &router.ListenerMiddleware{
+				Internal:    true,
+				MasterKey:   config.App.MasterKey,
+				MaxBodySize: config.HTTP.InternalMaxBodySize,
+				Next:        finalMux,
+			},
+		}
+		go func() {
+			served <- internalServer.ListenAndServe()
+		}()
+	}
+
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			log.Infof("Received SIGHUP, reloading plugins...")
+			pluginContext.ReloadPlugins()
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-served:
 		log.Printf("Failed: %v", err)
+		return
+	case sig := <-sigChan:
+		log.Infof("Received %v, shutting down...", sig)
+	}
+
+	go func() {
+		<-sigChan
+		log.Warnln("Received signal again, exiting without shutting down")
+		os.Exit(1)
+	}()
+
+	shutdown(config, server, internalServer, cronjob, subscriptionService, hookQueue, pushQueue, routeSender)
+}
+
+// shutdown stops accepting requests and waits for those in progress,
+// then stops the background services and closes database connections.
+// internalServer is nil without an internal listener.
+func shutdown(
+	config skyconfig.Configuration,
+	server *graceful.Server,
+	internalServer *graceful.Server,
+	cronjob *cron.Cron,
+	subscriptionService *subscription.Service,
+	hookQueue *workqueue.Queue,
+	pushQueue *workqueue.Queue,
+	pushSender push.RouteSender,
+) {
+	timeout := time.Duration(config.HTTP.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Requests still in progress are interrupted: %v", err)
+	}
+	if internalServer != nil {
+		if err := internalServer.Shutdown(ctx); err != nil {
+			log.Warnf("Internal requests still in progress are interrupted: %v", err)
+		}
+	}
+
+	if cronjob != nil {
+		cronjob.Stop()
+	}
+	if subscriptionService != nil {
+		subscriptionService.Stop()
+	}
+	if err := hookQueue.Shutdown(ctx); err != nil {
+		log.Warnf("Asynchronous hooks not yet executed are discarded: %v", err)
+	}
+	if err := pushQueue.Shutdown(ctx); err != nil {
+		log.Warnf("Push notifications not yet queued to the gateways are discarded: %v", err)
+	}
+	if err := pushSender.Shutdown(ctx); err != nil {
+		log.Warnf("Push notifications not yet sent are discarded: %v", err)
+	}
+
+	if err := skydb.CloseDrivers(); err != nil {
+		log.Warnf("Failed to close database connections: %v", err)
+	}
+	log.Infof("Skygear Server is shut down.")
+}
+
+func initResponseFilter(config skyconfig.Configuration) *fieldfilter.Filter {
+	return &fieldfilter.Filter{
+		RecordFields: config.ResponseFilter.RecordFields,
+		UserFields:   config.ResponseFilter.UserFields,
+		ExemptRoles:  config.ResponseFilter.ExemptRoles,
+	}
+}
+
+func initIdempotencyCache(config skyconfig.Configuration) *idempotency.Cache {
+	return &idempotency.Cache{
+		Actions:   config.Idempotency.Actions,
+		Retention: time.Duration(config.Idempotency.Retention) * time.Second,
+	}
+}
+
+func initResponseCache(config skyconfig.Configuration) *responsecache.Cache {
+	return &responsecache.Cache{
+		Actions:             config.ResponseCache.Actions,
+		InvalidatingActions: config.ResponseCache.InvalidatingActions,
+		TTL:                 time.Duration(config.ResponseCache.TTL) * time.Second,
+		MaxEntries:          config.ResponseCache.MaxEntries,
+	}
+}
+
+func initConcurrencyLimiter(config skyconfig.Configuration) *throttle.ConcurrencyLimiter {
+	return &throttle.ConcurrencyLimiter{
+		MaxInFlight:  config.Concurrency.MaxInFlight,
+		QueueTimeout: time.Duration(config.Concurrency.QueueTimeout) * time.Millisecond,
+	}
+}
+
+func initRateLimiter(requestsPerMinute int, name string) *throttle.RateLimiter {
+	return &throttle.RateLimiter{
+		RequestsPerMinute: requestsPerMinute,
+		Name:              name,
+	}
+}
+
+// queueConcurrency returns the number of workers of each priority class
+// of a work queue from the configuration.
+func queueConcurrency(config map[string]int) map[workqueue.Priority]int {
+	concurrency := map[workqueue.Priority]int{}
+	for name, workers := range config {
+		concurrency[workqueue.Priority(name)] = workers
+	}
+	return concurrency
+}
+
+func initPubSubACL(config skyconfig.Configuration) *pubsub.ACL {
+	acl := &pubsub.ACL{
+		Subscribe:           pubsub.Access(config.PubSub.Subscribe),
+		Publish:             pubsub.Access(config.PubSub.Publish),
+		UserChannelPrefixes: []string{chat.UserChannelPrefix},
+	}
+
+	rules := []pubsub.Rule{}
+	for _, rule := range config.PubSub.Rules {
+		rules = append(rules, pubsub.Rule{
+			Pattern:   rule.Pattern,
+			Subscribe: pubsub.Access(rule.Subscribe),
+			Publish:   pubsub.Access(rule.Publish),
+		})
+	}
+	if err := acl.SetRules(rules); err != nil {
+		log.Fatalf("Invalid pubsub rules: %v", err)
+	}
+	return acl
+}
+
+func initRecordIDPolicy(config skyconfig.Configuration) *recordid.Policy {
+	format, err := recordid.ParseFormat(config.RecordID.Format)
+	if err != nil {
+		log.Fatalf("Invalid record id format: %v", err)
+	}
+
+	serverGenerated := map[string]bool{}
+	for _, recordType := range config.RecordID.ServerGenerated {
+		serverGenerated[recordType] = true
+	}
+	return &recordid.Policy{
+		Format:          format,
+		Prefixes:        config.RecordID.Prefixes,
+		ServerGenerated: serverGenerated,
+	}
+}
+
+func initMaintenanceSwitch(config skyconfig.Configuration) *maintenance.Switch {
+	readActions := config.Maintenance.ReadActions
+	if len(readActions) == 0 {
+		readActions = maintenance.DefaultReadActions
+	}
+
+	s := &maintenance.Switch{
+		MasterKey:   config.App.MasterKey,
+		ReadActions: readActions,
+	}
+	// the mode is checked by skyconfig.Configuration.Validate
+	mode, _ := maintenance.ParseMode(config.Maintenance.Mode)
+	s.Set(mode, config.Maintenance.Message)
+	return s
+}
+
+func initOutbound(config skyconfig.Configuration) outbound.Config {
+	outboundConfig := outbound.Config{
+		ProxyURL: config.Outbound.ProxyURL,
+		NoProxy:  config.Outbound.NoProxy,
+		CABundle: config.Outbound.CABundle,
+		Timeout:  time.Duration(config.Outbound.Timeout) * time.Second,
+	}
+	if !outboundConfig.Enabled() {
+		return outboundConfig
+	}
+
+	transport, err := outboundConfig.NewTransport()
+	if err != nil {
+		log.Fatalf("Failed to configure outbound connections: %v", err)
+	}
+
+	// The S3 client cannot be given an http.Client, so requests
+	// to external services are sent with a configured default transport.
+	http.DefaultTransport = transport
+	if outboundConfig.ProxyURL != "" {
+		log.Infof("Outbound requests are sent through proxy %s", outboundConfig.ProxyURL)
+	}
+	return outboundConfig
+}
+
+func initForgotPassword(config skyconfig.Configuration) *handler.ForgotPasswordSettings {
+	settings := &handler.ForgotPasswordSettings{
+		Mailer:     &mail.Mailer{},
+		CodeExpiry: time.Duration(config.ForgotPassword.CodeExpiry) * time.Second,
+	}
+	if config.SMTP.Host == "" {
+		return settings
+	}
+
+	body := handler.DefaultForgotPasswordEmailBody
+	if config.ForgotPassword.TemplatePath != "" {
+		data, err := ioutil.ReadFile(config.ForgotPassword.TemplatePath)
+		if err != nil {
+			log.Fatalf("Failed to read forgot password template: %v", err)
+		}
+		body = string(data)
+	}
+	template, err := mail.NewTemplate(config.ForgotPassword.Subject, body)
+	if err != nil {
+		log.Fatalf("Failed to parse forgot password template: %v", err)
+	}
+
+	settings.Mailer.Sender = &mail.SMTPSender{
+		Host:     config.SMTP.Host,
+		Port:     config.SMTP.Port,
+		Login:    config.SMTP.Login,
+		Password: config.SMTP.Password,
+		From:     config.SMTP.Sender,
+	}
+	settings.Template = template
+	log.Infof("Forgot password emails are sent through %s", config.SMTP.Host)
+	return settings
+}
+
+func initCaptchaGuard(config skyconfig.Configuration, pluginContext *plugin.Context) *captcha.Guard {
+	guard := &captcha.Guard{
+		Provider:            config.Captcha.Provider,
+		FreeAttemptsPerHour: config.Captcha.FreeAttemptsPerHour,
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	switch config.Captcha.Provider {
+	case "recaptcha":
+		guard.Verifier = &captcha.SiteVerifier{
+			URL:    captcha.RecaptchaURL,
+			Secret: config.Captcha.Secret,
+			Client: client,
+		}
+	case "hcaptcha":
+		guard.Verifier = &captcha.SiteVerifier{
+			URL:    captcha.HCaptchaURL,
+			Secret: config.Captcha.Secret,
+			Client: client,
+		}
+	case "plugin":
+		guard.Verifier = &captcha.LambdaVerifier{
+			Name:   config.Captcha.PluginLambda,
+			Runner: pluginContext,
+		}
+	default:
+		return guard
+	}
+
+	log.Infof("CAPTCHA (%s) required after %d signup attempts per hour", config.Captcha.Provider, config.Captcha.FreeAttemptsPerHour)
+	return guard
+}
+
+func initAuthProvider(config skyconfig.Configuration, registry *provider.Registry) {
+	if audiences := config.AuthProvider.AppleAudiences; len(audiences) > 0 {
+		registry.RegisterAuthProvider("apple", provider.NewAppleAuthProvider(audiences))
+		log.Infof("Sign in with Apple enabled for: %s", strings.Join(audiences, ", "))
+	}
+
+	if audiences := config.AuthProvider.GoogleAudiences; len(audiences) > 0 {
+		registry.RegisterAuthProvider("google", provider.NewGoogleAuthProvider(audiences))
+		log.Infof("Google Sign-In enabled for: %s", strings.Join(audiences, ", "))
+	}
+
+	if appID := config.AuthProvider.FacebookAppID; appID != "" {
+		registry.RegisterAuthProvider("facebook", provider.NewFacebookAuthProvider(appID, config.AuthProvider.FacebookAppSecret))
+		log.Infof("Facebook Login enabled for app %s", appID)
+	}
+}
+
+func initStats(config skyconfig.Configuration, cronjob *cron.Cron, connOpener func() (skydb.Conn, error)) {
+	if !config.Stats.Enable {
+		return
+	}
+
+	if err := stats.Schedule(cronjob, config.Stats.RollupSchedule, connOpener); err != nil {
+		log.Fatalf("Failed to schedule stats rollup: %v", err)
+	}
+}
+
+func initAnonymousPurge(config skyconfig.Configuration, cronjob *cron.Cron, connOpener func() (skydb.Conn, error)) {
+	if config.Anonymous.PurgeInactiveDays <= 0 {
+		return
+	}
+
+	inactivePeriod := time.Duration(config.Anonymous.PurgeInactiveDays) * 24 * time.Hour
+	if err := anonymous.Schedule(cronjob, config.Anonymous.PurgeSchedule, inactivePeriod, connOpener); err != nil {
+		log.Fatalf("Failed to schedule anonymous user purge: %v", err)
+	}
+}
+
+func initScheduledMutation(config skyconfig.Configuration, cronjob *cron.Cron, connOpener func() (skydb.Conn, error), registry *hook.Registry) {
+	if !config.ScheduledMutation.Enable {
+		return
+	}
+
+	if err := schedule.Schedule(cronjob, config.ScheduledMutation.RunSchedule, registry, connOpener); err != nil {
+		log.Fatalf("Failed to schedule scheduled mutations: %v", err)
+	}
+}
+
+func initMetrics(config skyconfig.Configuration) {
+	if config.Metrics.AppLabel {
+		metrics.DefaultRegistry.SetConstLabels(map[string]string{
+			"app": config.App.Name,
+		})
+	}
+	metrics.DefaultRegistry.SetMaxSeries(config.Metrics.MaxSeries)
+}
+
+func initRetention(config skyconfig.Configuration, cronjob *cron.Cron, connOpener func() (skydb.Conn, error), registry *hook.Registry) {
+	if !config.Retention.Enable {
+		return
+	}
+
+	rules := []retention.Rule{}
+	for _, ruleConfig := range config.Retention.Rules {
+		rule := retention.Rule{
+			RecordType: ruleConfig.RecordType,
+			MaxAge:     time.Duration(ruleConfig.Days) * 24 * time.Hour,
+			Action:     retention.Action(ruleConfig.Action),
+		}
+		if rule.Action == retention.Archive {
+			rule.ArchiveInDB = config.Retention.ArchiveInDB
+		}
+		if rawPredicate, ok := config.Retention.Predicates[ruleConfig.RecordType]; ok {
+			query, err := handler.ParseQuery(map[string]interface{}{
+				"record_type": ruleConfig.RecordType,
+				"predicate":   rawPredicate,
+			})
+			if err != nil {
+				log.Fatalf("Failed to parse retention predicate of %s: %v", ruleConfig.RecordType, err)
+			}
+			rule.Predicate = query.Predicate
+		}
+		if err := rule.Validate(); err != nil {
+			log.Fatalf("Invalid retention rule: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := retention.Schedule(cronjob, config.Retention.RunSchedule, rules, config.Retention.DryRun, registry, connOpener); err != nil {
+		log.Fatalf("Failed to schedule retention rules: %v", err)
+	}
+}
+
+func initChat(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) {
+	if !config.Chat.Enable {
+		return
+	}
+
+	conn, err := connOpener()
+	if err != nil {
+		log.Errorf("Failed to create chat record types: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// record types cannot be created if schema migration is not allowed,
+	// in which case they are expected to be created beforehand
+	if err := chat.EnsureSchema(context.Background(), conn.PublicDB()); err != nil {
+		log.Errorf("Failed to create chat record types: %v", err)
 	}
 }
 
 func ensureDB(config skyconfig.Configuration) func() (skydb.Conn, error) {
+	skydb.SetPoolOptions(skydb.PoolOptions{
+		MaxOpenConns:    config.DB.MaxOpenConns,
+		MaxIdleConns:    config.DB.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(config.DB.ConnMaxLifetime) * time.Second,
+	})
+
+	option := config.DB.Option
+	if config.App.DevMode && config.DB.DDLOption != "" {
+		option = config.DB.DDLOption
+	}
 	connOpener := func() (skydb.Conn, error) {
 		return skydb.Open(
+			context.Background(),
 			config.DB.ImplName,
 			config.App.Name,
 			config.App.AccessControl,
-			config.DB.Option,
+			option,
 			config.App.DevMode,
 		)
 	}
@@ -330,6 +1038,9 @@ func ensureDB(config skyconfig.Configuration) func() (skydb.Conn, error) {
 		conn, connError := connOpener()
 		if connError == nil {
 			conn.Close()
+			if config.DB.DDLOption != "" {
+				verifyDMLRole(config)
+			}
 			return connOpener
 		}
 
@@ -344,6 +1055,164 @@ func ensureDB(config skyconfig.Configuration) func() (skydb.Conn, error) {
 	}
 }
 
+// verifyDMLRole exits if the credentials of DATABASE_URL can change the
+// database schema, which should only be possible with DATABASE_DDL_URL.
+func verifyDMLRole(config skyconfig.Configuration) {
+	conn, err := skydb.Open(
+		context.Background(),
+		config.DB.ImplName,
+		config.App.Name,
+		config.App.AccessControl,
+		config.DB.Option,
+		false,
+	)
+	if err != nil {
+		log.Fatalf("Failed to open database with DATABASE_URL: %v", err)
+	}
+	defer conn.Close()
+
+	checker, ok := conn.(skydb.SchemaPrivilegeChecker)
+	if !ok {
+		log.Fatalf("Database %s cannot verify the privileges of DATABASE_URL", config.DB.ImplName)
+	}
+	canModify, err := checker.CanModifySchema(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to verify the privileges of DATABASE_URL: %v", err)
+	}
+	if canModify {
+		log.Fatalf("DATABASE_URL must not be allowed to change the database schema if DATABASE_DDL_URL is set")
+	}
+	log.Info("Verified that DATABASE_URL cannot change the database schema")
+}
+
+func seedDB(connOpener func() (skydb.Conn, error), dir string) {
+	fixtures, err := seed.LoadDir(dir)
+	if err != nil {
+		log.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	conn, err := connOpener()
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+
+	if err := fixtures.Apply(context.Background(), conn); err != nil {
+		log.Fatalf("Failed to seed database: %v", err)
+	}
+	log.Infof("Seeded database with fixtures in %s", dir)
+}
+
+func runLoadgen(config skyconfig.Configuration, args []string) {
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Println("Usage: skygear-server loadgen [options] <endpoint>")
+		flags.PrintDefaults()
+	}
+	apiKey := flags.String("api-key", config.App.APIKey, "API key of the target server")
+	masterKey := flags.String("master-key", config.App.MasterKey, "master key of the target server")
+	rate := flags.Float64("rate", 10, "records saved per second")
+	count := flags.Int("count", 0, "records to save, until interrupted if zero")
+	users := flags.Int("users", 10, "users to sign up and save records on behalf of")
+	recordTypes := flags.String("record-types", "", "comma-separated record types to save, all if empty")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed of the generated values")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	opts := loadgen.Options{
+		Rate:  *rate,
+		Count: *count,
+		Users: *users,
+		Seed:  *seed,
+	}
+	if *recordTypes != "" {
+		opts.RecordTypes = strings.Split(*recordTypes, ",")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	client := &loadgen.Client{
+		Endpoint:  flags.Arg(0),
+		APIKey:    *apiKey,
+		MasterKey: *masterKey,
+	}
+	result, err := loadgen.Run(ctx, client, opts)
+	if err != nil {
+		log.Fatalf("Failed to generate load: %v", err)
+	}
+	log.Infof("Signed up %d users and saved %d records with %d errors", result.Users, result.Records, result.Errors)
+}
+
+// initApps returns the apps served in addition to the app of config.App,
+// the token store keeping the tokens of each app in a separate store,
+// and the asset prefixes of the apps. The connection pools of the apps
+// with pool limits of their own are configured as well.
+func initApps(config skyconfig.Configuration, tokenStore authtoken.Store) (pp.AppRegistry, authtoken.Store, map[string]string) {
+	if len(config.Apps) == 0 {
+		return nil, tokenStore, nil
+	}
+
+	apps := pp.AppRegistry{}
+	appStore := &authtoken.AppStore{
+		Default: tokenStore,
+		Apps:    map[string]authtoken.Store{},
+	}
+	assetPrefixes := map[string]string{}
+	for _, appConfig := range config.Apps {
+		apps[appConfig.Name] = pp.App{
+			Name:      appConfig.Name,
+			ClientKey: appConfig.APIKey,
+			MasterKey: appConfig.MasterKey,
+			DBOption:  appConfig.DBOption,
+		}
+
+		if appConfig.DBMaxOpenConns != 0 || appConfig.DBMaxIdleConns != 0 {
+			poolOptions := skydb.PoolOptions{
+				MaxOpenConns:    config.DB.MaxOpenConns,
+				MaxIdleConns:    config.DB.MaxIdleConns,
+				ConnMaxLifetime: time.Duration(config.DB.ConnMaxLifetime) * time.Second,
+			}
+			if appConfig.DBMaxOpenConns != 0 {
+				poolOptions.MaxOpenConns = appConfig.DBMaxOpenConns
+			}
+			if appConfig.DBMaxIdleConns != 0 {
+				poolOptions.MaxIdleConns = appConfig.DBMaxIdleConns
+			}
+			skydb.SetAppPoolOptions(appConfig.Name, poolOptions)
+		}
+
+		tokenStoreConfig := authtoken.Configuration{
+			Implementation: config.TokenStore.ImplName,
+			Path:           config.TokenStore.Path,
+			Prefix:         config.TokenStore.Prefix,
+			Expiry:         config.TokenStore.Expiry,
+			Secret:         appConfig.TokenStoreSecret,
+		}
+		if appConfig.TokenStorePath != "" {
+			tokenStoreConfig.Path = appConfig.TokenStorePath
+		}
+		if appConfig.TokenStorePrefix != "" {
+			tokenStoreConfig.Prefix = appConfig.TokenStorePrefix
+		}
+		appStore.Apps[appConfig.Name] = authtoken.InitTokenStore(tokenStoreConfig)
+
+		if appConfig.AssetPrefix != "" {
+			assetPrefixes[appConfig.Name] = appConfig.AssetPrefix
+		}
+	}
+	return apps, appStore, assetPrefixes
+}
+
 func initAssetStore(config skyconfig.Configuration) asset.Store {
 	var store asset.Store
 	switch config.AssetStore.ImplName {
@@ -382,6 +1251,21 @@ func initAssetStore(config skyconfig.Configuration) asset.Store {
 			panic("Fail to initialize asset.CloudStore: " + err.Error())
 		}
 		store = cloudStore
+	case "gcs":
+		credentials, err := ioutil.ReadFile(config.AssetStore.GCSStore.CredentialsPath)
+		if err != nil {
+			panic("failed to read gcs credentials: " + err.Error())
+		}
+		gcsStore, err := asset.NewGCSStore(
+			config.AssetStore.GCSStore.Bucket,
+			credentials,
+			config.AssetStore.GCSStore.URLPrefix,
+			config.AssetStore.Public,
+		)
+		if err != nil {
+			panic("failed to initialize asset.GCSStore: " + err.Error())
+		}
+		store = gcsStore
 	}
 	return store
 }
@@ -395,32 +1279,32 @@ func initDevice(config skyconfig.Configuration, connOpener func() (skydb.Conn, e
 		log.Warnf("Failed to delete outdated devices: %v", err)
 	}
 
-	conn.DeleteEmptyDevicesByTime(time.Now().AddDate(0, 0, -1))
+	conn.DeleteEmptyDevicesByTime(context.Background(), time.Now().AddDate(0, 0, -1))
 }
 
-func initPushSender(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) push.Sender {
+func initPushSender(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), outboundConfig outbound.Config) push.RouteSender {
 	routeSender := push.NewRouteSender()
 	if config.APNS.Enable {
-		apns := initAPNSPusher(config, connOpener)
+		apns := initAPNSPusher(config, connOpener, outboundConfig)
 		routeSender.Route("aps", apns)
 		routeSender.Route("ios", apns)
 	}
 	if config.GCM.Enable {
-		gcm := initGCMPusher(config)
+		gcm := initGCMPusher(config, connOpener)
 		routeSender.Route("gcm", gcm)
 		routeSender.Route("android", gcm)
 	}
 	return routeSender
 }
 
-func initAPNSPusher(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) push.APNSPusher {
+func initAPNSPusher(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), outboundConfig outbound.Config) push.APNSPusher {
 	var pushSender push.APNSPusher
 
 	switch config.APNS.Type {
 	case "cert":
-		pushSender = initCertBasedAPNSPusher(config, connOpener)
+		pushSender = initCertBasedAPNSPusher(config, connOpener, outboundConfig)
 	case "token":
-		pushSender = initTokenBasedAPNSPusher(config, connOpener)
+		pushSender = initTokenBasedAPNSPusher(config, connOpener, outboundConfig)
 	default:
 		log.Fatalf("Unknown APNS Type: %s", config.APNS.Type)
 	}
@@ -432,6 +1316,7 @@ func initAPNSPusher(config skyconfig.Configuration, connOpener func() (skydb.Con
 func initCertBasedAPNSPusher(
 	config skyconfig.Configuration,
 	connOpener func() (skydb.Conn, error),
+	outboundConfig outbound.Config,
 ) push.APNSPusher {
 	cert := config.APNS.CertConfig.Cert
 	key := config.APNS.CertConfig.Key
@@ -456,6 +1341,7 @@ func initCertBasedAPNSPusher(
 		push.GatewayType(config.APNS.Env),
 		cert,
 		key,
+		outboundConfig,
 	)
 	if err != nil {
 		log.Fatalf("Failed to set up push sender: %v", err)
@@ -467,6 +1353,7 @@ func initCertBasedAPNSPusher(
 func initTokenBasedAPNSPusher(
 	config skyconfig.Configuration,
 	connOpener func() (skydb.Conn, error),
+	outboundConfig outbound.Config,
 ) push.APNSPusher {
 	key := config.APNS.TokenConfig.Key
 	keyPath := config.APNS.TokenConfig.KeyPath
@@ -485,6 +1372,7 @@ func initTokenBasedAPNSPusher(
 		config.APNS.TokenConfig.TeamID,
 		config.APNS.TokenConfig.KeyID,
 		key,
+		outboundConfig,
 	)
 	if err != nil {
 		log.Fatalf("Failed to set up push sender: %v", err)
@@ -493,22 +1381,83 @@ func initTokenBasedAPNSPusher(
 	return pushSender
 }
 
-func initGCMPusher(config skyconfig.Configuration) *push.GCMPusher {
-	return &push.GCMPusher{APIKey: config.GCM.APIKey}
+func initGCMPusher(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) *push.GCMPusher {
+	credentials, err := ioutil.ReadFile(config.GCM.CredentialsPath)
+	if err != nil {
+		log.Fatalf("Failed to read fcm credentials: %v", err)
+	}
+
+	pusher, err := push.NewGCMPusher(credentials, config.GCM.ProjectID, connOpener)
+	if err != nil {
+		log.Fatalf("Failed to set up gcm pusher: %v", err)
+	}
+	return pusher
 }
 
-func initSubscription(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), hub *pubsub.Hub, pushSender push.Sender) {
+func initSubscription(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), hub *pubsub.Hub, pushSender push.Sender, pushQueue *workqueue.Queue, observers *observer.Registry, moderationPipeline *moderation.Pipeline) *subscription.Service {
 	notifiers := []subscription.Notifier{subscription.NewHubNotifier(hub)}
 	if pushSender != nil {
-		notifiers = append(notifiers, subscription.NewPushNotifier(pushSender))
+		notifiers = append(notifiers, subscription.NewPushNotifier(pushSender, pushQueue))
 	}
 
 	subscriptionService := &subscription.Service{
 		ConnOpener: connOpener,
 		Notifier:   subscription.NewMultiNotifier(notifiers...),
+		Observers:  observers,
+		Moderation: moderationPipeline,
 	}
 	log.Infoln("Subscription Service listening...")
 	go subscriptionService.Run()
+	return subscriptionService
+}
+
+func initModeration(config skyconfig.Configuration, registry *hook.Registry) *moderation.Pipeline {
+	pipeline := &moderation.Pipeline{
+		StatusKey: config.Moderation.StatusKey,
+	}
+	if !config.Moderation.Enable {
+		return pipeline
+	}
+
+	pipeline.Fields = config.Moderation.Fields
+	pipeline.AssetContentTypes = config.Moderation.AssetContentTypes
+	if len(config.Moderation.Keywords) > 0 {
+		pipeline.Moderators = append(pipeline.Moderators, &moderation.KeywordModerator{
+			Keywords: config.Moderation.Keywords,
+			Verdict:  moderation.Verdict(config.Moderation.KeywordVerdict),
+		})
+	}
+	if config.Moderation.APIURL != "" {
+		pipeline.Moderators = append(pipeline.Moderators, &moderation.HTTPModerator{
+			URL: config.Moderation.APIURL,
+			Client: &http.Client{
+				Timeout: 10 * time.Second,
+			},
+		})
+	}
+
+	for _, recordType := range pipeline.RecordTypes() {
+		registry.Register(hook.BeforeSave, recordType, pipeline.BeforeSave)
+	}
+	log.Infof("Content moderation enabled for record types: %s", strings.Join(pipeline.RecordTypes(), ", "))
+	return pipeline
+}
+
+func initGeoIP(config skyconfig.Configuration) *geoip.Resolver {
+	resolver := &geoip.Resolver{
+		TrustProxy: config.GeoIP.TrustProxy,
+	}
+	if config.GeoIP.DBPath == "" {
+		return resolver
+	}
+
+	lookuper, err := geoip.NewMaxMindLookuper(config.GeoIP.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to open GeoIP database: %v", err)
+	}
+	resolver.Lookuper = lookuper
+	log.Infof("GeoIP lookup enabled with database: %s", config.GeoIP.DBPath)
+	return resolver
 }
 
 func initPlugin(config skyconfig.Configuration, ctx *plugin.Context) {
@@ -518,8 +1467,9 @@ func initPlugin(config skyconfig.Configuration, ctx *plugin.Context) {
 		ctx.Scheduler.Start()
 	}
 
-	for _, pluginConfig := range config.Plugin {
-		ctx.AddPluginConfiguration(pluginConfig.Transport, pluginConfig.Path, pluginConfig.Args)
+	for name, pluginConfig := range config.Plugin {
+		plug := ctx.AddPluginConfiguration(pluginConfig.Transport, pluginConfig.Path, pluginConfig.Args)
+		plug.SetName(name)
 	}
 
 	ctx.InitPlugins()
@@ -528,6 +1478,9 @@ func initPlugin(config skyconfig.Configuration, ctx *plugin.Context) {
 func initLogger(config skyconfig.Configuration) {
 	// Setup Logging
 	logging.SetOutput(os.Stderr)
+	if config.LOG.Format == "json" {
+		logging.SetFormatter(&logrus.JSONFormatter{})
+	}
 	if level, err := logrus.ParseLevel(config.LOG.Level); err == nil {
 		logging.SetLevel(level)
 	} else {
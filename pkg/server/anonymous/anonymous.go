@@ -0,0 +1,196 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package anonymous limits what anonymous users can do, and purges
+// anonymous users who have been inactive for a period.
+package anonymous
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+var log = logging.LoggerEntry("anonymous")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// writeActions are the actions counted towards Policy.WritesPerMinute.
+var writeActions = map[string]bool{
+	"record:save":   true,
+	"record:delete": true,
+}
+
+// Policy restricts the actions of anonymous users.
+//
+// A nil Policy or one without any restriction allows everything.
+type Policy struct {
+	// AllowedActions are the actions anonymous users can call. All
+	// actions are allowed if it is empty.
+	AllowedActions []string
+
+	// RecordTypes are the record types anonymous users can fetch, query,
+	// save and delete. All record types are allowed if it is empty.
+	RecordTypes []string
+
+	// WritesPerMinute is the maximum number of record:save and
+	// record:delete requests of each anonymous user per minute. Zero
+	// means unlimited.
+	WritesPerMinute int
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	writes      map[string]int
+}
+
+// Enabled returns true if any of the restrictions is set.
+func (p *Policy) Enabled() bool {
+	return p != nil && (len(p.AllowedActions) > 0 || len(p.RecordTypes) > 0 || p.WritesPerMinute > 0)
+}
+
+// Check returns an error if the anonymous user of ID userID is not
+// allowed to call action with data.
+func (p *Policy) Check(userID string, action string, data map[string]interface{}) skyerr.Error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	if len(p.AllowedActions) > 0 && !containsString(p.AllowedActions, action) {
+		return skyerr.NewErrorf(skyerr.PermissionDenied, "anonymous user is not allowed to call %s", action)
+	}
+
+	if len(p.RecordTypes) > 0 {
+		for _, recordType := range recordTypesOf(action, data) {
+			if !containsString(p.RecordTypes, recordType) {
+				return skyerr.NewErrorf(skyerr.PermissionDenied, "anonymous user is not allowed to access record type %s", recordType)
+			}
+		}
+	}
+
+	if p.WritesPerMinute > 0 && writeActions[action] && !p.allowWrite(userID) {
+		return skyerr.NewErrorWithInfo(
+			skyerr.TooManyRequests,
+			fmt.Sprintf("anonymous user can only write %d times per minute", p.WritesPerMinute),
+			map[string]interface{}{
+				"limit": p.WritesPerMinute,
+			},
+		)
+	}
+
+	return nil
+}
+
+// allowWrite counts a write of the user and returns whether it is
+// within the limit of the current minute.
+func (p *Policy) allowWrite(userID string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// All users share the same window, so that the counts of past
+	// windows are discarded at once instead of growing indefinitely.
+	window := timeNow().Truncate(time.Minute)
+	if !window.Equal(p.windowStart) || p.writes == nil {
+		p.windowStart = window
+		p.writes = map[string]int{}
+	}
+
+	if p.writes[userID] >= p.WritesPerMinute {
+		return false
+	}
+	p.writes[userID]++
+	return true
+}
+
+// recordTypesOf returns the record types accessed by a record action.
+func recordTypesOf(action string, data map[string]interface{}) []string {
+	var rawIDs []interface{}
+	switch action {
+	case "record:query", "record:rank":
+		if recordType, ok := data["record_type"].(string); ok {
+			return []string{recordType}
+		}
+		return nil
+	case "record:fetch", "record:delete":
+		rawIDs, _ = data["ids"].([]interface{})
+	case "record:save":
+		records, _ := data["records"].([]interface{})
+		for _, record := range records {
+			if record, ok := record.(map[string]interface{}); ok {
+				rawIDs = append(rawIDs, record["_id"])
+			}
+		}
+	default:
+		return nil
+	}
+
+	recordTypes := []string{}
+	for _, rawID := range rawIDs {
+		rawID, ok := rawID.(string)
+		if !ok {
+			continue
+		}
+		recordID := skydb.RecordID{}
+		if err := recordID.UnmarshalText([]byte(rawID)); err != nil {
+			continue
+		}
+		recordTypes = append(recordTypes, recordID.Type)
+	}
+	return recordTypes
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Purge deletes anonymous users inactive for longer than inactivePeriod,
+// together with their data.
+func Purge(ctx context.Context, conn skydb.Conn, inactivePeriod time.Duration) (int, error) {
+	purger, ok := conn.(skydb.AnonymousUserPurger)
+	if !ok {
+		return 0, nil
+	}
+	return purger.PurgeAnonymousUsers(ctx, timeNow().Add(-inactivePeriod))
+}
+
+// Schedule adds a job to c that purges inactive anonymous users on
+// schedule spec, with a connection opened by connOpener.
+func Schedule(c *cron.Cron, spec string, inactivePeriod time.Duration, connOpener func() (skydb.Conn, error)) error {
+	return c.AddFunc(spec, func() {
+		conn, err := connOpener()
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to open connection to purge anonymous users")
+			return
+		}
+		defer conn.Close()
+
+		count, err := Purge(context.Background(), conn, inactivePeriod)
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to purge anonymous users")
+			return
+		}
+		log.Infof("purged %d inactive anonymous users", count)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anonymous
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Policy", t, func() {
+		Convey("allows everything if nil or not restricted", func() {
+			var nilPolicy *Policy
+			So(nilPolicy.Enabled(), ShouldBeFalse)
+			So(nilPolicy.Check("user0", "record:save", nil), ShouldBeNil)
+			So((&Policy{}).Check("user0", "record:save", nil), ShouldBeNil)
+		})
+
+		Convey("restricts actions", func() {
+			policy := &Policy{AllowedActions: []string{"me", "record:query"}}
+			So(policy.Check("user0", "record:query", nil), ShouldBeNil)
+
+			err := policy.Check("user0", "record:save", nil)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.PermissionDenied)
+			So(err.Message(), ShouldEqual, "anonymous user is not allowed to call record:save")
+		})
+
+		Convey("restricts record types", func() {
+			policy := &Policy{RecordTypes: []string{"note"}}
+
+			So(policy.Check("user0", "record:query", map[string]interface{}{
+				"record_type": "note",
+			}), ShouldBeNil)
+			So(policy.Check("user0", "record:save", map[string]interface{}{
+				"records": []interface{}{
+					map[string]interface{}{"_id": "note/1"},
+				},
+			}), ShouldBeNil)
+
+			err := policy.Check("user0", "record:save", map[string]interface{}{
+				"records": []interface{}{
+					map[string]interface{}{"_id": "note/1"},
+					map[string]interface{}{"_id": "secret/1"},
+				},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, "anonymous user is not allowed to access record type secret")
+
+			So(policy.Check("user0", "record:delete", map[string]interface{}{
+				"ids": []interface{}{"secret/1"},
+			}), ShouldNotBeNil)
+			So(policy.Check("user0", "record:query", map[string]interface{}{
+				"record_type": "secret",
+			}), ShouldNotBeNil)
+		})
+
+		Convey("limits write rate of each user", func() {
+			now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+			timeNow = func() time.Time { return now }
+			defer func() {
+				timeNow = func() time.Time { return time.Now().UTC() }
+			}()
+
+			policy := &Policy{WritesPerMinute: 2}
+			So(policy.Check("user0", "record:save", nil), ShouldBeNil)
+			So(policy.Check("user0", "record:delete", nil), ShouldBeNil)
+			So(policy.Check("user0", "record:query", nil), ShouldBeNil)
+
+			err := policy.Check("user0", "record:save", nil)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.TooManyRequests)
+
+			So(policy.Check("user1", "record:save", nil), ShouldBeNil)
+
+			now = now.Add(time.Minute)
+			So(policy.Check("user0", "record:save", nil), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Checksum contains the hex-encoded checksums of asset content. An empty
+// checksum is not verified.
+type Checksum struct {
+	MD5    string
+	SHA256 string
+}
+
+// IsEmpty returns true if none of the checksums is specified.
+func (c Checksum) IsEmpty() bool {
+	return c.MD5 == "" && c.SHA256 == ""
+}
+
+// Verify returns a ChecksumMismatchError if any of the checksums
+// specified in c differs from actual.
+func (c Checksum) Verify(actual Checksum) error {
+	if c.MD5 != "" && c.MD5 != actual.MD5 {
+		return &ChecksumMismatchError{"md5", c.MD5, actual.MD5}
+	}
+	if c.SHA256 != "" && c.SHA256 != actual.SHA256 {
+		return &ChecksumMismatchError{"sha256", c.SHA256, actual.SHA256}
+	}
+	return nil
+}
+
+// ChecksumMismatchError is returned when the content of an asset does not
+// match the expected checksum.
+type ChecksumMismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// ParseChecksum parses MD5 and SHA256 checksums encoded in either hex or
+// base64, as used in the Content-MD5 header. An empty string is
+// accepted for a checksum that is not specified.
+func ParseChecksum(md5Value string, sha256Value string) (Checksum, error) {
+	var c Checksum
+	var err error
+	if c.MD5, err = parseDigest(md5Value, md5.Size); err != nil {
+		return Checksum{}, fmt.Errorf("invalid md5 checksum: %v", err)
+	}
+	if c.SHA256, err = parseDigest(sha256Value, sha256.Size); err != nil {
+		return Checksum{}, fmt.Errorf("invalid sha256 checksum: %v", err)
+	}
+	return c, nil
+}
+
+func parseDigest(value string, size int) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	digest, err := hex.DecodeString(value)
+	if err != nil || len(digest) != size {
+		digest, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("expect hex or base64 encoded digest, got %q", value)
+		}
+	}
+	if len(digest) != size {
+		return "", fmt.Errorf("expect digest of %d bytes, got %d", size, len(digest))
+	}
+	return hex.EncodeToString(digest), nil
+}
+
+// ComputeChecksum reads src to the end and returns the checksums of the
+// content read.
+func ComputeChecksum(src io.Reader) (Checksum, error) {
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), src); err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
+
+// VerifyStoredFile reads the named file from store and verifies its
+// content against expected, returning the checksums of the stored
+// content.
+func VerifyStoredFile(store Store, name string, expected Checksum) (Checksum, error) {
+	reader, err := store.GetFileReader(name)
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer reader.Close()
+
+	actual, err := ComputeChecksum(reader)
+	if err != nil {
+		return Checksum{}, err
+	}
+	return actual, expected.Verify(actual)
+}
@@ -0,0 +1,86 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChecksum(t *testing.T) {
+	Convey("ParseChecksum", t, func() {
+		Convey("parses hex digests", func() {
+			checksum, err := ParseChecksum(
+				"5d41402abc4b2a76b9719d911017c592",
+				"2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+			)
+			So(err, ShouldBeNil)
+			So(checksum, ShouldResemble, Checksum{
+				MD5:    "5d41402abc4b2a76b9719d911017c592",
+				SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			})
+		})
+
+		Convey("parses base64 digests", func() {
+			checksum, err := ParseChecksum("XUFAKrxLKna5cZ2REBfFkg==", "")
+			So(err, ShouldBeNil)
+			So(checksum, ShouldResemble, Checksum{
+				MD5: "5d41402abc4b2a76b9719d911017c592",
+			})
+			So(checksum.IsEmpty(), ShouldBeFalse)
+		})
+
+		Convey("accepts empty digests", func() {
+			checksum, err := ParseChecksum("", "")
+			So(err, ShouldBeNil)
+			So(checksum.IsEmpty(), ShouldBeTrue)
+		})
+
+		Convey("rejects malformed digests", func() {
+			_, err := ParseChecksum("not-a-digest", "")
+			So(err, ShouldNotBeNil)
+
+			_, err = ParseChecksum("", "5d41402abc4b2a76b9719d911017c592")
+			So(err.Error(), ShouldEqual, "invalid sha256 checksum: expect digest of 32 bytes, got 24")
+		})
+	})
+
+	Convey("ComputeChecksum", t, func() {
+		checksum, err := ComputeChecksum(strings.NewReader("hello"))
+		So(err, ShouldBeNil)
+		So(checksum, ShouldResemble, Checksum{
+			MD5:    "5d41402abc4b2a76b9719d911017c592",
+			SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		})
+
+		Convey("verifies matching checksum", func() {
+			So(Checksum{}.Verify(checksum), ShouldBeNil)
+			So(Checksum{MD5: checksum.MD5}.Verify(checksum), ShouldBeNil)
+			So(checksum.Verify(checksum), ShouldBeNil)
+		})
+
+		Convey("reports mismatching checksum", func() {
+			expected := Checksum{SHA256: "0726f9f88bc3dc7fcbd94eae4d619416a110c298b355b9ccaabcb49851995799"}
+			err := expected.Verify(checksum)
+			So(err, ShouldResemble, &ChecksumMismatchError{
+				Algorithm: "sha256",
+				Expected:  "0726f9f88bc3dc7fcbd94eae4d619416a110c298b355b9ccaabcb49851995799",
+				Actual:    "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			})
+		})
+	})
+}
@@ -0,0 +1,258 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gcsDefaultEndpoint        = "https://storage.googleapis.com"
+	gcsAssetURLExpiryInterval = 15 * time.Minute
+)
+
+// gcsStore implements Store by storing files on Google Cloud Storage.
+//
+// Every request to GCS is authorized by a V2 signed URL generated with
+// the service account key, so no OAuth token exchange is needed.
+type gcsStore struct {
+	bucket     string
+	accessID   string
+	privateKey *rsa.PrivateKey
+	endpoint   string
+	urlPrefix  string
+	public     bool
+	client     *http.Client
+}
+
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// NewGCSStore returns a new gcsStore. credentialsJSON is the content of a
+// service account key file downloaded from the Google Cloud console.
+func NewGCSStore(
+	bucket string,
+	credentialsJSON []byte,
+	urlPrefix string,
+	public bool,
+) (Store, error) {
+	if bucket == "" {
+		return nil, errors.New("gcs bucket is not set")
+	}
+
+	account := gcsServiceAccount{}
+	if err := json.Unmarshal(credentialsJSON, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse gcs credentials: %v", err)
+	}
+	if account.ClientEmail == "" {
+		return nil, errors.New("gcs credentials do not contain client_email")
+	}
+
+	privateKey, err := parseGCSPrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcsStore{
+		bucket:     bucket,
+		accessID:   account.ClientEmail,
+		privateKey: privateKey,
+		endpoint:   gcsDefaultEndpoint,
+		urlPrefix:  urlPrefix,
+		public:     public,
+		client:     http.DefaultClient,
+	}, nil
+}
+
+func parseGCSPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("gcs credentials do not contain a PEM private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gcs private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("gcs private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// GetFileReader returns a reader for files
+func (s *gcsStore) GetFileReader(name string) (io.ReadCloser, error) {
+	signedURL, err := s.signURL(http.MethodGet, name, "", s.expiry())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Get(signedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, gcsResponseError(resp)
+	}
+
+	return resp.Body, nil
+}
+
+// PutFileReader uploads a file to GCS with content from io.Reader
+func (s *gcsStore) PutFileReader(
+	name string,
+	src io.Reader,
+	length int64,
+	contentType string,
+) error {
+	signedURL, err := s.signURL(http.MethodPut, name, contentType, s.expiry())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, signedURL, src)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return gcsResponseError(resp)
+	}
+
+	log.
+		WithField("bucket", s.bucket).
+		WithField("name", name).
+		Debug("Uploaded asset to gcs")
+
+	return nil
+}
+
+// GeneratePostFileRequest return a PostFileRequest for uploading asset
+func (s *gcsStore) GeneratePostFileRequest(name string) (*PostFileRequest, error) {
+	return &PostFileRequest{
+		Action: "/files/" + name,
+	}, nil
+}
+
+// SignedURL return a signed GCS URL with expiry date
+func (s *gcsStore) SignedURL(name string) (string, error) {
+	if !s.IsSignatureRequired() {
+		if s.urlPrefix != "" {
+			return strings.Join([]string{s.urlPrefix, name}, "/"), nil
+		}
+		return s.objectURL(name), nil
+	}
+	return s.signURL(http.MethodGet, name, "", s.expiry())
+}
+
+// IsSignatureRequired indicates whether a signature is required
+func (s *gcsStore) IsSignatureRequired() bool {
+	return !s.public
+}
+
+// ParseSignature tries to parse the asset signature
+func (s *gcsStore) ParseSignature(
+	signed string,
+	name string,
+	expiredAt time.Time,
+) (bool, error) {
+
+	return false, errors.New(
+		"Asset signature parsing for gcs-based asset store is not available",
+	)
+}
+
+func (s *gcsStore) expiry() time.Time {
+	return time.Now().Add(gcsAssetURLExpiryInterval)
+}
+
+func (s *gcsStore) objectURL(name string) string {
+	return s.endpoint + s.resourcePath(name)
+}
+
+func (s *gcsStore) resourcePath(name string) string {
+	escaped := (&url.URL{Path: name}).EscapedPath()
+	return "/" + s.bucket + "/" + escaped
+}
+
+// signURL returns a V2 signed URL for accessing the named object.
+//
+// See https://cloud.google.com/storage/docs/access-control/signed-urls-v2
+func (s *gcsStore) signURL(
+	method string,
+	name string,
+	contentType string,
+	expiredAt time.Time,
+) (string, error) {
+	expires := strconv.FormatInt(expiredAt.Unix(), 10)
+	stringToSign := strings.Join([]string{
+		method,
+		"", // Content-MD5
+		contentType,
+		expires,
+		s.resourcePath(name),
+	}, "\n")
+
+	hashed := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("GoogleAccessId", s.accessID)
+	query.Set("Expires", expires)
+	query.Set("Signature", base64.StdEncoding.EncodeToString(signature))
+
+	return s.objectURL(name) + "?" + query.Encode(), nil
+}
+
+func gcsResponseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("gcs responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
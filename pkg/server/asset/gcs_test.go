@@ -0,0 +1,239 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeGCSObject struct {
+	contentType string
+	data        []byte
+}
+
+// fakeGCSServer mimics the GCS XML API for signed URL requests.
+type fakeGCSServer struct {
+	accessID  string
+	publicKey *rsa.PublicKey
+	mutex     sync.Mutex
+	objects   map[string]fakeGCSObject
+}
+
+func (f *fakeGCSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	expires := query.Get("Expires")
+	contentType := ""
+	if r.Method == http.MethodPut {
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	stringToSign := strings.Join([]string{
+		r.Method,
+		"",
+		contentType,
+		expires,
+		r.URL.EscapedPath(),
+	}, "\n")
+	hashed := sha256.Sum256([]byte(stringToSign))
+	signature, _ := base64.StdEncoding.DecodeString(query.Get("Signature"))
+
+	if query.Get("GoogleAccessId") != f.accessID ||
+		rsa.VerifyPKCS1v15(f.publicKey, crypto.SHA256, hashed[:], signature) != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("SignatureDoesNotMatch"))
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Unix(expiresAt, 0).Before(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("ExpiredToken"))
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = fakeGCSObject{contentType, data}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("NoSuchKey"))
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newGCSTestCredentials(accessID string) (*rsa.PrivateKey, []byte) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	credentials, _ := json.Marshal(gcsServiceAccount{
+		ClientEmail: accessID,
+		PrivateKey:  string(keyPEM),
+	})
+	return privateKey, credentials
+}
+
+func TestGCSStore(t *testing.T) {
+	accessID := "skygear@project.iam.gserviceaccount.com"
+	privateKey, credentials := newGCSTestCredentials(accessID)
+
+	fakeServer := &fakeGCSServer{
+		accessID:  accessID,
+		publicKey: &privateKey.PublicKey,
+		objects:   map[string]fakeGCSObject{},
+	}
+	testServer := httptest.NewServer(fakeServer)
+	defer testServer.Close()
+
+	newStore := func(public bool) *gcsStore {
+		store, err := NewGCSStore("skygear-assets", credentials, "", public)
+		if err != nil {
+			panic(err)
+		}
+		gcs := store.(*gcsStore)
+		gcs.endpoint = testServer.URL
+		return gcs
+	}
+
+	Convey("GCS Store", t, func() {
+		store := newStore(false)
+
+		Convey("puts and gets a file", func() {
+			err := store.PutFileReader(
+				"some asset.txt",
+				bytes.NewReader([]byte("hello")),
+				5,
+				"text/plain",
+			)
+			So(err, ShouldBeNil)
+			So(fakeServer.objects["/skygear-assets/some asset.txt"], ShouldResemble, fakeGCSObject{
+				contentType: "text/plain",
+				data:        []byte("hello"),
+			})
+
+			reader, err := store.GetFileReader("some asset.txt")
+			So(err, ShouldBeNil)
+			defer reader.Close()
+			data, _ := ioutil.ReadAll(reader)
+			So(string(data), ShouldEqual, "hello")
+		})
+
+		Convey("returns error for missing file", func() {
+			_, err := store.GetFileReader("missing.txt")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "404")
+		})
+
+		Convey("generates signed URL accepted by GCS", func() {
+			fakeServer.objects["/skygear-assets/signed.txt"] = fakeGCSObject{"text/plain", []byte("signed")}
+
+			signedURL, err := store.SignedURL("signed.txt")
+			So(err, ShouldBeNil)
+			So(signedURL, ShouldStartWith, testServer.URL+"/skygear-assets/signed.txt?")
+
+			parsed, _ := url.Parse(signedURL)
+			So(parsed.Query().Get("GoogleAccessId"), ShouldEqual, accessID)
+
+			resp, err := http.Get(signedURL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("rejects URL signed by another key", func() {
+			_, otherCredentials := newGCSTestCredentials(accessID)
+			other, err := NewGCSStore("skygear-assets", otherCredentials, "", false)
+			So(err, ShouldBeNil)
+			other.(*gcsStore).endpoint = testServer.URL
+
+			err = other.PutFileReader("forged.txt", bytes.NewReader([]byte("x")), 1, "text/plain")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "403")
+		})
+
+		Convey("rejects expired signed URL", func() {
+			signedURL, err := store.signURL(http.MethodGet, "signed.txt", "", time.Now().Add(-time.Minute))
+			So(err, ShouldBeNil)
+
+			resp, err := http.Get(signedURL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("returns unsigned URL for public store", func() {
+			publicStore := newStore(true)
+			signedURL, err := publicStore.SignedURL("public.png")
+			So(err, ShouldBeNil)
+			So(signedURL, ShouldEqual, testServer.URL+"/skygear-assets/public.png")
+
+			publicStore.urlPrefix = "https://cdn.example.com"
+			signedURL, err = publicStore.SignedURL("public.png")
+			So(err, ShouldBeNil)
+			So(signedURL, ShouldEqual, "https://cdn.example.com/public.png")
+		})
+	})
+
+	Convey("GCS Store creation", t, func() {
+		Convey("fails without bucket", func() {
+			_, err := NewGCSStore("", credentials, "", false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("fails with malformed credentials", func() {
+			_, err := NewGCSStore("bucket", []byte("{}"), "", false)
+			So(err, ShouldNotBeNil)
+
+			_, err = NewGCSStore("bucket", []byte(`{"client_email":"a@b","private_key":"nope"}`), "", false)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
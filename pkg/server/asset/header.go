@@ -0,0 +1,104 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// uuidPrefixRe matches the UUID prepended to the file name of an asset
+// when it is uploaded.
+var uuidPrefixRe = regexp.MustCompile(`\A[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}-`)
+
+// HeaderPolicy sets the caching, disposition and CORS headers of asset
+// files served to browsers according to their content type.
+//
+// Each map is keyed by a content type such as image/png, a wildcard such
+// as image/* or * for any content type, and the most specific key takes
+// precedence. A nil HeaderPolicy sets no headers.
+type HeaderPolicy struct {
+	// CacheControl are values of the Cache-Control header.
+	CacheControl map[string]string
+
+	// ContentDisposition are either inline or attachment. An attachment
+	// is downloaded with the file name the asset is uploaded with.
+	ContentDisposition map[string]string
+
+	// AllowOrigin are values of the Access-Control-Allow-Origin header,
+	// which override the origin allowed for the whole server.
+	AllowOrigin map[string]string
+}
+
+// SetHeaders sets headers for serving the asset with the name and
+// content type.
+func (p *HeaderPolicy) SetHeaders(header http.Header, name string, contentType string) {
+	if p == nil {
+		return
+	}
+
+	if cacheControl, ok := lookupContentType(p.CacheControl, contentType); ok {
+		header.Set("Cache-Control", cacheControl)
+	}
+
+	if disposition, ok := lookupContentType(p.ContentDisposition, contentType); ok {
+		params := map[string]string{}
+		if disposition == "attachment" {
+			params["filename"] = DownloadFilename(name)
+		}
+		value := mime.FormatMediaType(disposition, params)
+		if value == "" {
+			// the file name cannot be formatted, e.g. in older Go
+			// versions that do not encode non-ASCII file names
+			value = disposition
+		}
+		header.Set("Content-Disposition", value)
+	}
+
+	if origin, ok := lookupContentType(p.AllowOrigin, contentType); ok {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// DownloadFilename returns the file name an asset is uploaded with,
+// without the directory and the UUID prepended to make it unique.
+func DownloadFilename(name string) string {
+	return uuidPrefixRe.ReplaceAllString(path.Base(name), "")
+}
+
+func lookupContentType(m map[string]string, contentType string) (string, bool) {
+	if len(m) == 0 {
+		return "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	if value, ok := m[mediaType]; ok {
+		return value, true
+	}
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		if value, ok := m[mediaType[:i]+"/*"]; ok {
+			return value, true
+		}
+	}
+	value, ok := m["*"]
+	return value, ok
+}
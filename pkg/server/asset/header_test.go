@@ -0,0 +1,81 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeaderPolicy(t *testing.T) {
+	Convey("HeaderPolicy", t, func() {
+		policy := &HeaderPolicy{
+			CacheControl: map[string]string{
+				"image/*": "public, max-age=31536000",
+				"*":       "no-cache",
+			},
+			ContentDisposition: map[string]string{
+				"image/*":         "inline",
+				"application/pdf": "inline",
+				"*":               "attachment",
+			},
+			AllowOrigin: map[string]string{
+				"font/*": "*",
+			},
+		}
+
+		Convey("sets headers of most specific content type", func() {
+			header := http.Header{}
+			policy.SetHeaders(header, "4f0e1b3c-7a0c-4f3e-8f43-8d6c1a7b9e01-photo.png", "image/png")
+			So(header.Get("Cache-Control"), ShouldEqual, "public, max-age=31536000")
+			So(header.Get("Content-Disposition"), ShouldEqual, "inline")
+			So(header.Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+
+			header = http.Header{}
+			policy.SetHeaders(header, "4f0e1b3c-7a0c-4f3e-8f43-8d6c1a7b9e01-manual.pdf", "application/pdf; charset=binary")
+			So(header.Get("Cache-Control"), ShouldEqual, "no-cache")
+			So(header.Get("Content-Disposition"), ShouldEqual, "inline")
+		})
+
+		Convey("sets attachment with file name", func() {
+			header := http.Header{}
+			policy.SetHeaders(header, "docs/4f0e1b3c-7a0c-4f3e-8f43-8d6c1a7b9e01-report 2017.csv", "text/csv")
+			So(header.Get("Content-Disposition"), ShouldEqual, `attachment; filename="report 2017.csv"`)
+		})
+
+		Convey("sets allowed origin", func() {
+			header := http.Header{}
+			policy.SetHeaders(header, "font.woff", "font/woff")
+			So(header.Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+		})
+
+		Convey("sets nothing if nil", func() {
+			var nilPolicy *HeaderPolicy
+			header := http.Header{}
+			nilPolicy.SetHeaders(header, "photo.png", "image/png")
+			So(header, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestDownloadFilename(t *testing.T) {
+	Convey("DownloadFilename", t, func() {
+		So(DownloadFilename("4f0e1b3c-7a0c-4f3e-8f43-8d6c1a7b9e01-photo.png"), ShouldEqual, "photo.png")
+		So(DownloadFilename("dir/4f0e1b3c-7a0c-4f3e-8f43-8d6c1a7b9e01-photo.png"), ShouldEqual, "photo.png")
+		So(DownloadFilename("photo.png"), ShouldEqual, "photo.png")
+	})
+}
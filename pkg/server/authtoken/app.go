@@ -0,0 +1,88 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authtoken
+
+import (
+	"sort"
+)
+
+// AppStore is a Store that keeps the tokens of each app served by the
+// server in the Store of that app, so that the tokens of one app are
+// not accepted by another.
+type AppStore struct {
+	// Default keeps the tokens of the apps not in Apps.
+	Default Store
+	// Apps are the stores of apps by app name.
+	Apps map[string]Store
+}
+
+// Store returns the Store keeping the tokens of the named app.
+func (s *AppStore) Store(appName string) Store {
+	if store, ok := s.Apps[appName]; ok {
+		return store
+	}
+	return s.Default
+}
+
+// stores returns all stores, starting from Default followed by the
+// stores of apps ordered by app name.
+func (s *AppStore) stores() []Store {
+	names := make([]string, 0, len(s.Apps))
+	for name := range s.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stores := []Store{s.Default}
+	for _, name := range names {
+		stores = append(stores, s.Apps[name])
+	}
+	return stores
+}
+
+// NewToken creates a token in the store of appName.
+func (s *AppStore) NewToken(appName string, userInfoID string) (Token, error) {
+	return s.Store(appName).NewToken(appName, userInfoID)
+}
+
+// Get looks up the access token in the store of each app in turn. It
+// returns the NotFoundError of the last store if no store has the
+// access token.
+func (s *AppStore) Get(accessToken string, token *Token) error {
+	var err error
+	for _, store := range s.stores() {
+		err = store.Get(accessToken, token)
+		if _, ok := err.(*NotFoundError); !ok {
+			return err
+		}
+	}
+	return err
+}
+
+// Put puts the token in the store of its app.
+func (s *AppStore) Put(token *Token) error {
+	return s.Store(token.AppName).Put(token)
+}
+
+// Delete deletes the access token from the store having it.
+func (s *AppStore) Delete(accessToken string) error {
+	token := Token{}
+	for _, store := range s.stores() {
+		if err := store.Get(accessToken, &token); err == nil {
+			return store.Delete(accessToken)
+		}
+	}
+	return s.Default.Delete(accessToken)
+}
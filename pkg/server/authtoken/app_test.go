@@ -0,0 +1,72 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authtoken
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAppStore(t *testing.T) {
+	Convey("AppStore", t, func() {
+		defaultDir := tempDir()
+		defer os.RemoveAll(defaultDir)
+		shopDir := tempDir()
+		defer os.RemoveAll(shopDir)
+
+		defaultStore := &FileStore{defaultDir, 0}
+		shopStore := &FileStore{shopDir, 0}
+		store := &AppStore{
+			Default: defaultStore,
+			Apps:    map[string]Store{"shop": shopStore},
+		}
+
+		Convey("puts token in the store of its app", func() {
+			token, err := store.NewToken("shop", "userid")
+			So(err, ShouldBeNil)
+			So(store.Put(&token), ShouldBeNil)
+
+			So(shopStore.Get(token.AccessToken, &Token{}), ShouldBeNil)
+			So(defaultStore.Get(token.AccessToken, &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+
+			fetched := Token{}
+			So(store.Get(token.AccessToken, &fetched), ShouldBeNil)
+			So(fetched.AppName, ShouldEqual, "shop")
+			So(fetched.UserInfoID, ShouldEqual, "userid")
+		})
+
+		Convey("puts token of other apps in default store", func() {
+			token, err := store.NewToken("myapp", "userid")
+			So(err, ShouldBeNil)
+			So(store.Put(&token), ShouldBeNil)
+
+			So(defaultStore.Get(token.AccessToken, &Token{}), ShouldBeNil)
+		})
+
+		Convey("deletes token from the store having it", func() {
+			token, _ := store.NewToken("shop", "userid")
+			So(store.Put(&token), ShouldBeNil)
+
+			So(store.Delete(token.AccessToken), ShouldBeNil)
+			So(shopStore.Get(token.AccessToken, &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+		})
+
+		Convey("returns not found error for unknown token", func() {
+			So(store.Get("notexist", &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+		})
+	})
+}
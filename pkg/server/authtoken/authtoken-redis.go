@@ -29,7 +29,14 @@ func NewRedisStore(address string, prefix string, expiry int64) *RedisStore {
 		store.prefix = prefix + ":"
 	}
 
-	store.pool = &redis.Pool{
+	store.pool = newRedisPool(address)
+	store.expiry = expiry
+
+	return &store
+}
+
+func newRedisPool(address string) *redis.Pool {
+	return &redis.Pool{
 		MaxIdle: 50, // NOTE: May make it configurable
 		Dial: func() (redis.Conn, error) {
 			c, err := redis.DialURL(address)
@@ -43,10 +50,6 @@ func NewRedisStore(address string, prefix string, expiry int64) *RedisStore {
 			return err
 		},
 	}
-
-	store.expiry = expiry
-
-	return &store
 }
 
 // RedisToken stores a Token with UnixNano timestamp
@@ -166,6 +166,10 @@ type Configuration struct {
 	Prefix         string
 	Expiry         int64
 	Secret         string
+
+	// PreviousSecrets are accepted in addition to Secret by the jwt
+	// token store, so that the secret can be rotated.
+	PreviousSecrets []string
 }
 
 // InitTokenStore accept a implementation and path string. Return a Store.
@@ -179,7 +183,10 @@ func InitTokenStore(config Configuration) Store {
 	case "redis":
 		store = NewRedisStore(config.Path, config.Prefix, config.Expiry)
 	case "jwt":
-		store = NewJWTStore(config.Secret, config.Expiry)
+		jwtStore := NewJWTStore(config.Secret, config.Expiry)
+		jwtStore.PreviousSecrets = config.PreviousSecrets
+		jwtStore.Revocations = NewRevocationList(config.Path, config.Prefix)
+		store = jwtStore
 	}
 	return store
 }
@@ -23,8 +23,18 @@ import (
 )
 
 // JWTStore implements TokenStore by encoding user information into
-// the access token string. This store does not keep state.
+// the access token string. This store does not keep state, except for
+// the IDs of deleted tokens if Revocations is set.
 type JWTStore struct {
+	// Revocations keeps tokens deleted before they expire. Deleting
+	// a token has no effect if it is nil.
+	Revocations RevocationList
+
+	// PreviousSecrets are the secrets used before the secret is rotated.
+	// Tokens signed with them are still accepted until they expire, while
+	// new tokens are signed with the current secret.
+	PreviousSecrets []string
+
 	secret string
 	expiry int64
 }
@@ -66,29 +76,64 @@ func (r *JWTStore) NewToken(appName string, userInfoID string) (Token, error) {
 	return token, nil
 }
 
+func (r *JWTStore) parse(accessToken string) (jwt.StandardClaims, error) {
+	var (
+		claims   jwt.StandardClaims
+		jwtToken *jwt.Token
+		err      error
+	)
+
+	// The secrets are tried in turn only if the signature does not
+	// match, so that other errors such as expiry are not masked.
+	secrets := append([]string{r.secret}, r.PreviousSecrets...)
+	for _, secret := range secrets {
+		claims = jwt.StandardClaims{}
+		jwtToken, err = jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, &NotFoundError{accessToken, errors.New("unexpected algorithm in token")}
+			}
+			return []byte(secret), nil
+		})
+
+		validationErr, ok := err.(*jwt.ValidationError)
+		if !ok || validationErr.Errors&jwt.ValidationErrorSignatureInvalid == 0 {
+			break
+		}
+	}
+
+	if err != nil {
+		return claims, &NotFoundError{accessToken, err}
+	}
+
+	if !jwtToken.Valid {
+		return claims, &NotFoundError{accessToken, errors.New("invalid token")}
+	}
+	return claims, nil
+}
+
 // Get decodes and verifies the access token for user information. It returns
 // the access token containing information about the user.
 func (r *JWTStore) Get(accessToken string, token *Token) error {
-	claims := jwt.StandardClaims{}
-	jwtToken, err := jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, &NotFoundError{accessToken, errors.New("unexpected algorithm in token")}
-		}
-		return []byte(r.secret), nil
-	})
-
+	claims, err := r.parse(accessToken)
 	if err != nil {
-		return &NotFoundError{accessToken, err}
+		return err
 	}
 
-	if jwtToken.Valid {
-		r.setTokenFromClaims(claims, token)
-	} else {
-		return &NotFoundError{accessToken, errors.New("invalid token")}
+	if r.Revocations != nil && claims.Id != "" {
+		revoked, err := r.Revocations.IsRevoked(claims.Id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return &NotFoundError{accessToken, errors.New("token is revoked")}
+		}
 	}
 
+	r.setTokenFromClaims(claims, token)
+
 	// The token is considered valid by the JWTStore. (i.e. the token
-	// has a valid signature and the signature is verified with the secret.)
+	// has a valid signature and the signature is verified with the secret,
+	// and it is not deleted.)
 	//
 	// In skygear-server, the `InjectUserIfPresent` preprocessor is
 	// responsible for checking if the token is still valid. A token
@@ -117,7 +162,24 @@ func (r *JWTStore) Put(token *Token) error {
 	return nil
 }
 
-// Delete does nothing because the JWT token store does not store token.
+// Delete adds the access token to Revocations so that it is no longer
+// accepted by Get. It does nothing if Revocations is nil.
 func (r *JWTStore) Delete(accessToken string) error {
-	return nil
+	if r.Revocations == nil {
+		return nil
+	}
+
+	claims, err := r.parse(accessToken)
+	if err != nil {
+		return err
+	}
+	if claims.Id == "" {
+		return &NotFoundError{accessToken, errors.New("token has no id")}
+	}
+
+	var expiredAt time.Time
+	if claims.ExpiresAt > 0 {
+		expiredAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	return r.Revocations.Revoke(claims.Id, expiredAt)
 }
@@ -2,6 +2,9 @@ package authtoken
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -58,5 +61,87 @@ func TestJWTStore(t *testing.T) {
 			So(token.IssuedAt().Unix(), ShouldEqual, issuedAt.Unix())
 			So(token.ExpiredAt.Unix(), ShouldEqual, issuedAt.Add(time.Hour*1).Unix())
 		})
+
+		Convey("should not get a deleted token", func() {
+			dir, err := ioutil.TempDir("", "skygear.revocation.test")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			store.Revocations = NewFileRevocationList(dir)
+
+			token, err := store.NewToken("exampleapp", "userid1")
+			So(err, ShouldBeNil)
+			anotherToken, err := store.NewToken("exampleapp", "userid1")
+			So(err, ShouldBeNil)
+
+			So(store.Delete(token.AccessToken), ShouldBeNil)
+			So(store.Get(token.AccessToken, &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+			So(store.Get(anotherToken.AccessToken, &Token{}), ShouldBeNil)
+		})
+
+		Convey("should accept token signed with previous secret", func() {
+			oldStore := NewJWTStore("oldsecret", 0)
+			oldToken, err := oldStore.NewToken("exampleapp", "userid1")
+			So(err, ShouldBeNil)
+
+			So(store.Get(oldToken.AccessToken, &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+
+			store.PreviousSecrets = []string{"oldsecret"}
+			token := Token{}
+			So(store.Get(oldToken.AccessToken, &token), ShouldBeNil)
+			So(token.UserInfoID, ShouldEqual, "userid1")
+
+			newToken, err := store.NewToken("exampleapp", "userid1")
+			So(err, ShouldBeNil)
+			So(oldStore.Get(newToken.AccessToken, &Token{}), ShouldHaveSameTypeAs, &NotFoundError{})
+		})
+
+		Convey("should ignore delete without revocation list", func() {
+			token, err := store.NewToken("exampleapp", "userid1")
+			So(err, ShouldBeNil)
+
+			So(store.Delete(token.AccessToken), ShouldBeNil)
+			So(store.Get(token.AccessToken, &Token{}), ShouldBeNil)
+		})
+	})
+}
+
+func TestFileRevocationList(t *testing.T) {
+	Convey("FileRevocationList", t, func() {
+		dir, err := ioutil.TempDir("", "skygear.revocation.test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		list := NewFileRevocationList(dir)
+
+		Convey("revokes token", func() {
+			So(list.Revoke("tokenid", time.Now().Add(time.Hour)), ShouldBeNil)
+			revoked, err := list.IsRevoked("tokenid")
+			So(err, ShouldBeNil)
+			So(revoked, ShouldBeTrue)
+
+			revoked, err = list.IsRevoked("anothertokenid")
+			So(err, ShouldBeNil)
+			So(revoked, ShouldBeFalse)
+		})
+
+		Convey("revokes non-expiring token", func() {
+			So(list.Revoke("tokenid", time.Time{}), ShouldBeNil)
+			revoked, err := list.IsRevoked("tokenid")
+			So(err, ShouldBeNil)
+			So(revoked, ShouldBeTrue)
+		})
+
+		Convey("forgets expired token", func() {
+			So(list.Revoke("tokenid", time.Now().Add(-time.Hour)), ShouldBeNil)
+			revoked, err := list.IsRevoked("tokenid")
+			So(err, ShouldBeNil)
+			So(revoked, ShouldBeFalse)
+
+			_, err = os.Stat(filepath.Join(dir, "tokenid"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("rejects invalid token id", func() {
+			So(list.Revoke("../tokenid", time.Time{}), ShouldNotBeNil)
+		})
 	})
 }
@@ -0,0 +1,157 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authtoken
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RevocationList keeps the IDs of revoked tokens that are otherwise
+// still valid, so that stateless tokens can be revoked before they
+// expire.
+//
+// A revoked token ID is only kept until the token expires. A token that
+// never expires is kept in the list indefinitely.
+type RevocationList interface {
+	Revoke(tokenID string, expiredAt time.Time) error
+	IsRevoked(tokenID string) (bool, error)
+}
+
+// NewRevocationList creates a RevocationList backed by redis if address
+// is a redis url, or by files under the address directory otherwise.
+func NewRevocationList(address string, prefix string) RevocationList {
+	if strings.HasPrefix(address, "redis://") {
+		return NewRedisRevocationList(address, prefix)
+	}
+	return NewFileRevocationList(filepath.Join(address, "revoked"))
+}
+
+// FileRevocationList implements RevocationList by creating a file for
+// each revoked token ID under a directory. The file contains the
+// expiry of the token in unix time.
+type FileRevocationList struct {
+	address string
+}
+
+// NewFileRevocationList creates a file revocation list.
+//
+// It panics when it fails to create the directory.
+func NewFileRevocationList(address string) *FileRevocationList {
+	if err := os.MkdirAll(address, 0755); err != nil {
+		panic("FileRevocationList.init: " + err.Error())
+	}
+	return &FileRevocationList{address}
+}
+
+// Revoke adds the token ID to the list.
+func (f *FileRevocationList) Revoke(tokenID string, expiredAt time.Time) error {
+	if err := validateToken(tokenID); err != nil {
+		return err
+	}
+
+	var expiry int64
+	if !expiredAt.IsZero() {
+		expiry = expiredAt.Unix()
+	}
+	content := []byte(strconv.FormatInt(expiry, 10))
+	return ioutil.WriteFile(filepath.Join(f.address, tokenID), content, 0644)
+}
+
+// IsRevoked determines whether the token ID is in the list. An entry
+// whose token has expired is removed from the list.
+func (f *FileRevocationList) IsRevoked(tokenID string) (bool, error) {
+	if err := validateToken(tokenID); err != nil {
+		return false, err
+	}
+
+	path := filepath.Join(f.address, tokenID)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	expiry, err := strconv.ParseInt(string(content), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	if expiry > 0 && time.Unix(expiry, 0).Before(time.Now()) {
+		os.Remove(path)
+		return false, nil
+	}
+	return true, nil
+}
+
+// RedisRevocationList implements RevocationList by saving revoked token
+// IDs as keys in a redis server, which expire with the tokens.
+type RedisRevocationList struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisRevocationList creates a redis revocation list.
+//
+// For example if the token ID is `cf4bdc65-3fe6-4d40-b7fd-58f00b82c506`
+// and the prefix is `myApp`, the key in redis should be
+// `myApp:revoked:cf4bdc65-3fe6-4d40-b7fd-58f00b82c506`.
+func NewRedisRevocationList(address string, prefix string) *RedisRevocationList {
+	list := RedisRevocationList{
+		pool:   newRedisPool(address),
+		prefix: "revoked:",
+	}
+	if prefix != "" {
+		list.prefix = prefix + ":revoked:"
+	}
+	return &list
+}
+
+// Revoke adds the token ID to the list.
+func (r *RedisRevocationList) Revoke(tokenID string, expiredAt time.Time) error {
+	c := r.pool.Get()
+	if err := c.Err(); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var err error
+	if expiredAt.IsZero() {
+		_, err = c.Do("SET", r.prefix+tokenID, 1)
+	} else {
+		c.Send("MULTI")
+		c.Send("SET", r.prefix+tokenID, 1)
+		c.Send("EXPIREAT", r.prefix+tokenID, expiredAt.Unix())
+		_, err = c.Do("EXEC")
+	}
+	return err
+}
+
+// IsRevoked determines whether the token ID is in the list.
+func (r *RedisRevocationList) IsRevoked(tokenID string) (bool, error) {
+	c := r.pool.Get()
+	if err := c.Err(); err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	return redis.Bool(c.Do("EXISTS", r.prefix+tokenID))
+}
@@ -0,0 +1,213 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package captcha requires clients making many signup attempts to
+// solve a CAPTCHA, so that bots cannot create accounts in bulk.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Verification endpoints of the supported CAPTCHA services.
+const (
+	RecaptchaURL = "https://www.google.com/recaptcha/api/siteverify"
+	HCaptchaURL  = "https://hcaptcha.com/siteverify"
+)
+
+var log = logging.LoggerEntry("captcha")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// Verifier verifies a CAPTCHA token solved by a client.
+type Verifier interface {
+	// Verify returns true if token is valid. An error is returned if the
+	// token cannot be verified at all.
+	Verify(ctx context.Context, token string, remoteIP string) (bool, error)
+}
+
+// SiteVerifier verifies tokens with a siteverify endpoint, which is
+// implemented by both reCAPTCHA and hCaptcha.
+type SiteVerifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify implements Verifier.
+func (v *SiteVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	form := url.Values{}
+	form.Set("secret", v.Secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequest("POST", v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("captcha: unexpected status code %d", resp.StatusCode)
+	}
+
+	var verifyResp siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verifyResp); err != nil {
+		return false, err
+	}
+	if !verifyResp.Success {
+		log.WithField("error_codes", verifyResp.ErrorCodes).Debugln("captcha: token rejected")
+	}
+	return verifyResp.Success, nil
+}
+
+// LambdaRunner runs a lambda registered by a plugin.
+type LambdaRunner interface {
+	RunLambda(ctx context.Context, name string, in []byte) ([]byte, error)
+}
+
+// LambdaVerifier delegates verification to the plugin lambda of Name,
+// which is called with {"token": "...", "remote_ip": "..."} and returns
+// {"success": true} for a valid token.
+type LambdaVerifier struct {
+	Name   string
+	Runner LambdaRunner
+}
+
+// Verify implements Verifier.
+func (v *LambdaVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	in, err := json.Marshal(map[string]string{
+		"token":     token,
+		"remote_ip": remoteIP,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	out, err := v.Runner.RunLambda(ctx, v.Name, in)
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// Guard requires a CAPTCHA token once a client has made more than
+// FreeAttemptsPerHour attempts within the current hour.
+//
+// A nil Guard or one without a Verifier requires no CAPTCHA.
+type Guard struct {
+	Verifier Verifier
+
+	// Provider names the CAPTCHA service, which is reported to clients
+	// so that they know which CAPTCHA to present.
+	Provider string
+
+	// FreeAttemptsPerHour is the number of attempts a client can make
+	// each hour without a CAPTCHA. Zero requires a CAPTCHA on every
+	// attempt.
+	FreeAttemptsPerHour int
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	attempts    map[string]int
+}
+
+// Enabled returns true if a Verifier is configured.
+func (g *Guard) Enabled() bool {
+	return g != nil && g.Verifier != nil
+}
+
+// Check counts an attempt by the client of clientIP, and verifies token
+// if the client has used up its free attempts. It returns a
+// CaptchaRequired error if token is missing or invalid.
+func (g *Guard) Check(ctx context.Context, clientIP string, token string) skyerr.Error {
+	if !g.Enabled() || !g.countAttempt(clientIP) {
+		return nil
+	}
+
+	info := map[string]interface{}{
+		"provider": g.Provider,
+	}
+	if token == "" {
+		return skyerr.NewErrorWithInfo(skyerr.CaptchaRequired, "captcha token is required", info)
+	}
+
+	ok, err := g.Verifier.Verify(ctx, token, clientIP)
+	if err != nil {
+		log.WithField("err", err).Errorln("captcha: failed to verify token")
+		return skyerr.NewError(skyerr.UnexpectedError, "unable to verify captcha token")
+	}
+	if !ok {
+		return skyerr.NewErrorWithInfo(skyerr.CaptchaRequired, "captcha verification failed", info)
+	}
+	return nil
+}
+
+// countAttempt counts an attempt by the client of clientIP, and returns
+// true if the attempt requires a CAPTCHA.
+func (g *Guard) countAttempt(clientIP string) bool {
+	if g.FreeAttemptsPerHour <= 0 {
+		return true
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	windowStart := timeNow().Truncate(time.Hour)
+	if g.attempts == nil || !windowStart.Equal(g.windowStart) {
+		g.windowStart = windowStart
+		g.attempts = map[string]int{}
+	}
+
+	g.attempts[clientIP]++
+	return g.attempts[clientIP] > g.FreeAttemptsPerHour
+}
@@ -0,0 +1,178 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type tokenVerifier struct {
+	calls int
+}
+
+func (v *tokenVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	v.calls++
+	if token == "broken" {
+		return false, errors.New("service unavailable")
+	}
+	return token == "valid", nil
+}
+
+type lambdaRunner struct {
+	name string
+	in   string
+	out  string
+}
+
+func (r *lambdaRunner) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	r.name = name
+	r.in = string(in)
+	return []byte(r.out), nil
+}
+
+func TestSiteVerifier(t *testing.T) {
+	Convey("SiteVerifier", t, func() {
+		var form map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form = map[string]string{
+				"secret":   r.PostForm.Get("secret"),
+				"response": r.PostForm.Get("response"),
+				"remoteip": r.PostForm.Get("remoteip"),
+			}
+			if r.PostForm.Get("response") == "valid" {
+				w.Write([]byte(`{"success": true}`))
+			} else {
+				w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+			}
+		}))
+		defer server.Close()
+
+		verifier := &SiteVerifier{
+			URL:    server.URL,
+			Secret: "secret",
+		}
+
+		Convey("accepts valid token", func() {
+			ok, err := verifier.Verify(context.Background(), "valid", "10.0.0.1")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(form, ShouldResemble, map[string]string{
+				"secret":   "secret",
+				"response": "valid",
+				"remoteip": "10.0.0.1",
+			})
+		})
+
+		Convey("rejects invalid token", func() {
+			ok, err := verifier.Verify(context.Background(), "invalid", "")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestLambdaVerifier(t *testing.T) {
+	Convey("LambdaVerifier", t, func() {
+		runner := &lambdaRunner{out: `{"success": true}`}
+		verifier := &LambdaVerifier{
+			Name:   "captcha:verify",
+			Runner: runner,
+		}
+
+		ok, err := verifier.Verify(context.Background(), "token", "10.0.0.1")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(runner.name, ShouldEqual, "captcha:verify")
+		So(runner.in, ShouldEqual, `{"remote_ip":"10.0.0.1","token":"token"}`)
+
+		runner.out = `{"success": false}`
+		ok, err = verifier.Verify(context.Background(), "token", "10.0.0.1")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestGuard(t *testing.T) {
+	Convey("Guard", t, func() {
+		now := time.Date(2017, 3, 1, 10, 30, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		verifier := &tokenVerifier{}
+		guard := &Guard{
+			Verifier:            verifier,
+			Provider:            "recaptcha",
+			FreeAttemptsPerHour: 2,
+		}
+
+		Convey("is disabled without verifier", func() {
+			So((*Guard)(nil).Enabled(), ShouldBeFalse)
+			So((&Guard{}).Check(context.Background(), "10.0.0.1", ""), ShouldBeNil)
+		})
+
+		Convey("allows free attempts without token", func() {
+			So(guard.Check(context.Background(), "10.0.0.1", ""), ShouldBeNil)
+			So(guard.Check(context.Background(), "10.0.0.1", ""), ShouldBeNil)
+			So(guard.Check(context.Background(), "10.0.0.2", ""), ShouldBeNil)
+			So(verifier.calls, ShouldEqual, 0)
+		})
+
+		Convey("requires token after free attempts", func() {
+			guard.Check(context.Background(), "10.0.0.1", "")
+			guard.Check(context.Background(), "10.0.0.1", "")
+
+			err := guard.Check(context.Background(), "10.0.0.1", "")
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.CaptchaRequired)
+			So(err.Info(), ShouldResemble, map[string]interface{}{
+				"provider": "recaptcha",
+			})
+
+			err = guard.Check(context.Background(), "10.0.0.1", "invalid")
+			So(err.Code(), ShouldEqual, skyerr.CaptchaRequired)
+
+			err = guard.Check(context.Background(), "10.0.0.1", "broken")
+			So(err.Code(), ShouldEqual, skyerr.UnexpectedError)
+
+			So(guard.Check(context.Background(), "10.0.0.1", "valid"), ShouldBeNil)
+		})
+
+		Convey("resets attempts every hour", func() {
+			guard.Check(context.Background(), "10.0.0.1", "")
+			guard.Check(context.Background(), "10.0.0.1", "")
+
+			now = now.Add(30 * time.Minute)
+			So(guard.Check(context.Background(), "10.0.0.1", ""), ShouldBeNil)
+		})
+
+		Convey("requires token on every attempt without free attempts", func() {
+			guard.FreeAttemptsPerHour = 0
+			err := guard.Check(context.Background(), "10.0.0.1", "")
+			So(err.Code(), ShouldEqual, skyerr.CaptchaRequired)
+			So(guard.Check(context.Background(), "10.0.0.1", "valid"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,538 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chat provides conversations, participants, messages and unread
+// counts built on records, with new messages and typing indicators
+// delivered to participants over pubsub.
+//
+// Conversations, messages and the per-participant states are stored as
+// records of the types conversation, message and user_conversation in the
+// public database, so that they can also be queried with record:query.
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/idgen"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+var log = logging.LoggerEntry("chat")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// Record types of the chat module.
+const (
+	ConversationRecordType     = "conversation"
+	UserConversationRecordType = "user_conversation"
+	MessageRecordType          = "message"
+)
+
+// ErrNotParticipant is returned when a user not participating in a
+// conversation tries to access it.
+var ErrNotParticipant = errors.New("chat: user is not a participant of the conversation")
+
+var schemas = map[string]skydb.RecordSchema{
+	ConversationRecordType: {
+		"title":           skydb.FieldType{Type: skydb.TypeString},
+		"participant_ids": skydb.FieldType{Type: skydb.TypeJSON},
+		"admin_ids":       skydb.FieldType{Type: skydb.TypeJSON},
+		"last_message_at": skydb.FieldType{Type: skydb.TypeDateTime},
+	},
+	UserConversationRecordType: {
+		"conversation": skydb.FieldType{
+			Type:          skydb.TypeReference,
+			ReferenceType: ConversationRecordType,
+		},
+		"user_id":      skydb.FieldType{Type: skydb.TypeString},
+		"unread_count": skydb.FieldType{Type: skydb.TypeInteger},
+		"last_read_at": skydb.FieldType{Type: skydb.TypeDateTime},
+	},
+	MessageRecordType: {
+		"conversation": skydb.FieldType{
+			Type:          skydb.TypeReference,
+			ReferenceType: ConversationRecordType,
+		},
+		"body":     skydb.FieldType{Type: skydb.TypeString},
+		"metadata": skydb.FieldType{Type: skydb.TypeJSON},
+	},
+}
+
+// EnsureSchema creates the record types of the chat module in db if they
+// do not exist.
+func EnsureSchema(ctx context.Context, db skydb.Database) error {
+	for _, recordType := range []string{
+		ConversationRecordType,
+		UserConversationRecordType,
+		MessageRecordType,
+	} {
+		if _, err := db.Extend(ctx, recordType, schemas[recordType]); err != nil {
+			return fmt.Errorf("chat: failed to create record type %s: %v", recordType, err)
+		}
+	}
+	return nil
+}
+
+// ParticipantIDs returns the IDs of users participating in conversation.
+func ParticipantIDs(conversation *skydb.Record) []string {
+	return stringSlice(conversation.Get("participant_ids"))
+}
+
+// AdminIDs returns the IDs of users who can manage the participants of
+// conversation.
+func AdminIDs(conversation *skydb.Record) []string {
+	return stringSlice(conversation.Get("admin_ids"))
+}
+
+// IsParticipant returns true if userID participates in conversation.
+func IsParticipant(conversation *skydb.Record, userID string) bool {
+	return containsString(ParticipantIDs(conversation), userID)
+}
+
+// IsAdmin returns true if userID can manage the participants of
+// conversation.
+func IsAdmin(conversation *skydb.Record, userID string) bool {
+	return containsString(AdminIDs(conversation), userID)
+}
+
+// CreateConversation creates a conversation between creatorID and
+// participantIDs. The creator is the admin of the conversation.
+func CreateConversation(ctx context.Context, db skydb.Database, creatorID string, participantIDs []string, title string) (*skydb.Record, error) {
+	participantIDs = appendUnique([]string{creatorID}, participantIDs...)
+
+	now := timeNow()
+	conversation := skydb.Record{
+		ID:        skydb.NewRecordID(ConversationRecordType, idgen.New()),
+		OwnerID:   creatorID,
+		CreatedAt: now,
+		CreatorID: creatorID,
+		UpdatedAt: now,
+		UpdaterID: creatorID,
+		Data: skydb.Data{
+			"title":           title,
+			"participant_ids": interfaceSlice(participantIDs),
+			"admin_ids":       interfaceSlice([]string{creatorID}),
+		},
+	}
+	conversation.ACL = participantsACL(participantIDs)
+
+	if err := db.Save(ctx, &conversation); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range participantIDs {
+		if err := saveUserConversation(ctx, db, &conversation, userID, creatorID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &conversation, nil
+}
+
+// GetConversation fetches the conversation of conversationID that userID
+// participates in.
+func GetConversation(ctx context.Context, db skydb.Database, conversationID string, userID string) (*skydb.Record, error) {
+	conversation := skydb.Record{}
+	if err := db.Get(ctx, skydb.NewRecordID(ConversationRecordType, conversationID), &conversation); err != nil {
+		return nil, err
+	}
+	if !IsParticipant(&conversation, userID) {
+		return nil, ErrNotParticipant
+	}
+	return &conversation, nil
+}
+
+// AddParticipants adds userIDs to conversation on behalf of updaterID.
+func AddParticipants(ctx context.Context, db skydb.Database, conversation *skydb.Record, userIDs []string, updaterID string) error {
+	participantIDs := ParticipantIDs(conversation)
+	added := []string{}
+	for _, userID := range userIDs {
+		if !containsString(participantIDs, userID) {
+			added = append(added, userID)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	participantIDs = append(participantIDs, added...)
+	if err := saveParticipants(ctx, db, conversation, participantIDs, updaterID); err != nil {
+		return err
+	}
+
+	for _, userID := range added {
+		if err := saveUserConversation(ctx, db, conversation, userID, updaterID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveParticipants removes userIDs from conversation on behalf of
+// updaterID. Messages sent before remain readable by removed participants.
+func RemoveParticipants(ctx context.Context, db skydb.Database, conversation *skydb.Record, userIDs []string, updaterID string) error {
+	participantIDs := []string{}
+	for _, userID := range ParticipantIDs(conversation) {
+		if !containsString(userIDs, userID) {
+			participantIDs = append(participantIDs, userID)
+		}
+	}
+
+	adminIDs := []string{}
+	for _, userID := range AdminIDs(conversation) {
+		if !containsString(userIDs, userID) {
+			adminIDs = append(adminIDs, userID)
+		}
+	}
+	conversation.Set("admin_ids", interfaceSlice(adminIDs))
+
+	if err := saveParticipants(ctx, db, conversation, participantIDs, updaterID); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		err := db.Delete(ctx, userConversationID(conversation.ID.Key, userID))
+		if err != nil && err != skydb.ErrRecordNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendMessage saves a message sent by senderID to conversation and
+// increments the unread counts of the other participants.
+func SendMessage(ctx context.Context, db skydb.Database, conversation *skydb.Record, senderID string, body string, metadata map[string]interface{}) (*skydb.Record, error) {
+	now := timeNow()
+	participantIDs := ParticipantIDs(conversation)
+	message := skydb.Record{
+		ID:        skydb.NewRecordID(MessageRecordType, idgen.New()),
+		OwnerID:   senderID,
+		CreatedAt: now,
+		CreatorID: senderID,
+		UpdatedAt: now,
+		UpdaterID: senderID,
+		ACL:       participantsACL(participantIDs),
+		Data: skydb.Data{
+			"conversation": skydb.NewReference(ConversationRecordType, conversation.ID.Key),
+			"body":         body,
+		},
+	}
+	if metadata != nil {
+		message.Data["metadata"] = metadata
+	}
+
+	if err := db.Save(ctx, &message); err != nil {
+		return nil, err
+	}
+
+	conversation.Set("last_message_at", now)
+	conversation.UpdatedAt = now
+	conversation.UpdaterID = senderID
+	if err := db.Save(ctx, conversation); err != nil {
+		return nil, err
+	}
+
+	// A failure to count unread messages should not fail sending the
+	// message, so it is only logged.
+	for _, userID := range participantIDs {
+		if userID == senderID {
+			continue
+		}
+		if err := incrementUnreadCount(ctx, db, conversation.ID.Key, userID); err != nil {
+			log.WithFields(logrus.Fields{
+				"conversationID": conversation.ID.Key,
+				"userID":         userID,
+				"err":            err,
+			}).Errorln("failed to increment unread count")
+		}
+	}
+
+	return &message, nil
+}
+
+// MarkAsRead resets the unread count of userID in the conversation of
+// conversationID.
+func MarkAsRead(ctx context.Context, db skydb.Database, conversationID string, userID string) (*skydb.Record, error) {
+	userConversation := skydb.Record{}
+	if err := db.Get(ctx, userConversationID(conversationID, userID), &userConversation); err != nil {
+		if err == skydb.ErrRecordNotFound {
+			return nil, ErrNotParticipant
+		}
+		return nil, err
+	}
+
+	now := timeNow()
+	userConversation.Set("unread_count", int64(0))
+	userConversation.Set("last_read_at", now)
+	userConversation.UpdatedAt = now
+	userConversation.UpdaterID = userID
+	if err := db.Save(ctx, &userConversation); err != nil {
+		return nil, err
+	}
+	return &userConversation, nil
+}
+
+// UnreadCount returns the number of unread messages kept in
+// userConversation.
+func UnreadCount(userConversation *skydb.Record) int64 {
+	switch count := userConversation.Get("unread_count").(type) {
+	case int64:
+		return count
+	case int:
+		return int64(count)
+	case float64:
+		return int64(count)
+	}
+	return 0
+}
+
+// UserConversations returns the user_conversation records of userID,
+// most recently updated first.
+func UserConversations(ctx context.Context, db skydb.Database, userID string) ([]skydb.Record, error) {
+	return queryRecords(ctx, db, &skydb.Query{
+		Type: UserConversationRecordType,
+		Predicate: skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "user_id"},
+				skydb.Expression{Type: skydb.Literal, Value: userID},
+			},
+		},
+		Sorts: []skydb.Sort{
+			{KeyPath: "_updated_at", Order: skydb.Descending},
+		},
+		BypassAccessControl: true,
+	})
+}
+
+// Messages returns at most limit messages of the conversation of
+// conversationID sent before the specified time, newest first. Messages
+// are not filtered by time if before is zero.
+func Messages(ctx context.Context, db skydb.Database, conversationID string, before time.Time, limit uint64) ([]skydb.Record, error) {
+	predicate := skydb.Predicate{
+		Operator: skydb.Equal,
+		Children: []interface{}{
+			skydb.Expression{Type: skydb.KeyPath, Value: "conversation"},
+			skydb.Expression{
+				Type:  skydb.Literal,
+				Value: skydb.NewReference(ConversationRecordType, conversationID),
+			},
+		},
+	}
+	if !before.IsZero() {
+		predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{
+				predicate,
+				skydb.Predicate{
+					Operator: skydb.LessThan,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "_created_at"},
+						skydb.Expression{Type: skydb.Literal, Value: before},
+					},
+				},
+			},
+		}
+	}
+
+	return queryRecords(ctx, db, &skydb.Query{
+		Type:      MessageRecordType,
+		Predicate: predicate,
+		Sorts: []skydb.Sort{
+			{KeyPath: "_created_at", Order: skydb.Descending},
+		},
+		Limit:               &limit,
+		BypassAccessControl: true,
+	})
+}
+
+// Event is published to the pubsub channel of each participant.
+type Event struct {
+	Type           string              `json:"event"`
+	RecordType     string              `json:"record_type,omitempty"`
+	Record         *skyconv.JSONRecord `json:"record,omitempty"`
+	ConversationID string              `json:"conversation_id,omitempty"`
+	UserID         string              `json:"user_id,omitempty"`
+	TypingEvent    string              `json:"typing_event,omitempty"`
+}
+
+// Types of Event.
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventTyping = "typing"
+)
+
+// UserChannelPrefix is the prefix of the pubsub channels on which chat
+// events are published, followed by the ID of the user receiving them.
+// Only the user may subscribe on them, see pubsub.ACL.UserChannelPrefixes.
+const UserChannelPrefix = "_chat_"
+
+// UserChannel returns the pubsub channel on which chat events of userID are
+// published.
+func UserChannel(userID string) string {
+	return UserChannelPrefix + userID
+}
+
+// Notifier publishes chat events to participants over pubsub.
+//
+// A nil Notifier or one without Hub publishes nothing.
+type Notifier struct {
+	Hub *pubsub.Hub
+}
+
+// NewRecordEvent returns an Event of eventType about record.
+func NewRecordEvent(eventType string, record *skydb.Record) Event {
+	return Event{
+		Type:       eventType,
+		RecordType: record.ID.Type,
+		Record:     (*skyconv.JSONRecord)(record),
+	}
+}
+
+// Notify publishes event to the channels of userIDs.
+func (n *Notifier) Notify(userIDs []string, event Event) {
+	if n == nil || n.Hub == nil {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.WithField("err", err).Errorln("failed to encode chat event")
+		return
+	}
+
+	for _, userID := range userIDs {
+		n.Hub.Broadcast <- pubsub.Parcel{
+			Channel: UserChannel(userID),
+			Data:    data,
+		}
+	}
+}
+
+func userConversationID(conversationID string, userID string) skydb.RecordID {
+	return skydb.NewRecordID(UserConversationRecordType, conversationID+"-"+userID)
+}
+
+func saveUserConversation(ctx context.Context, db skydb.Database, conversation *skydb.Record, userID string, creatorID string) error {
+	now := timeNow()
+	userConversation := skydb.Record{
+		ID:        userConversationID(conversation.ID.Key, userID),
+		OwnerID:   userID,
+		CreatedAt: now,
+		CreatorID: creatorID,
+		UpdatedAt: now,
+		UpdaterID: creatorID,
+		ACL: skydb.NewRecordACL([]skydb.RecordACLEntry{
+			skydb.NewRecordACLEntryDirect(userID, skydb.ReadLevel),
+		}),
+		Data: skydb.Data{
+			"conversation": skydb.NewReference(ConversationRecordType, conversation.ID.Key),
+			"user_id":      userID,
+			"unread_count": int64(0),
+		},
+	}
+	return db.Save(ctx, &userConversation)
+}
+
+func saveParticipants(ctx context.Context, db skydb.Database, conversation *skydb.Record, participantIDs []string, updaterID string) error {
+	conversation.Set("participant_ids", interfaceSlice(participantIDs))
+	conversation.ACL = participantsACL(participantIDs)
+	conversation.UpdatedAt = timeNow()
+	conversation.UpdaterID = updaterID
+	return db.Save(ctx, conversation)
+}
+
+func incrementUnreadCount(ctx context.Context, db skydb.Database, conversationID string, userID string) error {
+	userConversation := skydb.Record{}
+	if err := db.Get(ctx, userConversationID(conversationID, userID), &userConversation); err != nil {
+		return err
+	}
+
+	userConversation.Set("unread_count", UnreadCount(&userConversation)+1)
+	userConversation.UpdatedAt = timeNow()
+	return db.Save(ctx, &userConversation)
+}
+
+func participantsACL(participantIDs []string) skydb.RecordACL {
+	entries := []skydb.RecordACLEntry{}
+	for _, userID := range participantIDs {
+		entries = append(entries, skydb.NewRecordACLEntryDirect(userID, skydb.ReadLevel))
+	}
+	return skydb.NewRecordACL(entries)
+}
+
+func queryRecords(ctx context.Context, db skydb.Database, query *skydb.Query) ([]skydb.Record, error) {
+	results, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	records := []skydb.Record{}
+	for results.Scan() {
+		records = append(records, results.Record())
+	}
+	return records, results.Err()
+}
+
+func stringSlice(i interface{}) []string {
+	strs := []string{}
+	switch values := i.(type) {
+	case []string:
+		strs = append(strs, values...)
+	case []interface{}:
+		for _, value := range values {
+			if str, ok := value.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+	}
+	return strs
+}
+
+func interfaceSlice(strs []string) []interface{} {
+	values := make([]interface{}, len(strs))
+	for i, str := range strs {
+		values[i] = str
+	}
+	return values
+}
+
+func containsString(strs []string, target string) bool {
+	for _, str := range strs {
+		if str == target {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(strs []string, values ...string) []string {
+	for _, value := range values {
+		if !containsString(strs, value) {
+			strs = append(strs, value)
+		}
+	}
+	return strs
+}
@@ -0,0 +1,193 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// queryDB returns all records of the queried type, ignoring the predicate.
+type queryDB struct {
+	lastQuery *skydb.Query
+	*skydbtest.MapDB
+}
+
+func (db *queryDB) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	db.lastQuery = query
+	records := []skydb.Record{}
+	for _, record := range db.RecordMap {
+		if record.ID.Type == query.Type {
+			records = append(records, record)
+		}
+	}
+	return skydb.NewRows(skydb.NewMemoryRows(records)), nil
+}
+
+func TestConversation(t *testing.T) {
+	Convey("Conversation", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		db := skydbtest.NewMapDB()
+
+		conversation, err := CreateConversation(context.Background(), db, "alice", []string{"bob", "alice"}, "Lunch")
+		So(err, ShouldBeNil)
+
+		Convey("is created with participants", func() {
+			So(ParticipantIDs(conversation), ShouldResemble, []string{"alice", "bob"})
+			So(AdminIDs(conversation), ShouldResemble, []string{"alice"})
+			So(conversation.Get("title"), ShouldEqual, "Lunch")
+			So(conversation.ACL, ShouldResemble, skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("alice", skydb.ReadLevel),
+				skydb.NewRecordACLEntryDirect("bob", skydb.ReadLevel),
+			})
+
+			userConversation := skydb.Record{}
+			So(db.Get(context.Background(), userConversationID(conversation.ID.Key, "bob"), &userConversation), ShouldBeNil)
+			So(userConversation.OwnerID, ShouldEqual, "bob")
+			So(UnreadCount(&userConversation), ShouldEqual, 0)
+		})
+
+		Convey("is fetched by participants only", func() {
+			fetched, err := GetConversation(context.Background(), db, conversation.ID.Key, "bob")
+			So(err, ShouldBeNil)
+			So(fetched.ID, ShouldResemble, conversation.ID)
+
+			_, err = GetConversation(context.Background(), db, conversation.ID.Key, "carol")
+			So(err, ShouldEqual, ErrNotParticipant)
+		})
+
+		Convey("adds and removes participants", func() {
+			So(AddParticipants(context.Background(), db, conversation, []string{"bob", "carol"}, "alice"), ShouldBeNil)
+			So(ParticipantIDs(conversation), ShouldResemble, []string{"alice", "bob", "carol"})
+			So(db.Get(context.Background(), userConversationID(conversation.ID.Key, "carol"), &skydb.Record{}), ShouldBeNil)
+
+			So(RemoveParticipants(context.Background(), db, conversation, []string{"alice"}, "alice"), ShouldBeNil)
+			So(ParticipantIDs(conversation), ShouldResemble, []string{"bob", "carol"})
+			So(AdminIDs(conversation), ShouldBeEmpty)
+			So(
+				db.Get(context.Background(), userConversationID(conversation.ID.Key, "alice"), &skydb.Record{}),
+				ShouldEqual,
+				skydb.ErrRecordNotFound,
+			)
+		})
+
+		Convey("counts unread messages", func() {
+			message, err := SendMessage(context.Background(), db, conversation, "alice", "Hello", map[string]interface{}{"mood": "happy"})
+			So(err, ShouldBeNil)
+			So(message.Get("body"), ShouldEqual, "Hello")
+			So(message.Get("conversation"), ShouldResemble, skydb.NewReference(ConversationRecordType, conversation.ID.Key))
+			So(conversation.Get("last_message_at"), ShouldResemble, time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC))
+
+			_, err = SendMessage(context.Background(), db, conversation, "alice", "Are you there?", nil)
+			So(err, ShouldBeNil)
+
+			bobConversation := skydb.Record{}
+			So(db.Get(context.Background(), userConversationID(conversation.ID.Key, "bob"), &bobConversation), ShouldBeNil)
+			So(UnreadCount(&bobConversation), ShouldEqual, 2)
+
+			aliceConversation := skydb.Record{}
+			So(db.Get(context.Background(), userConversationID(conversation.ID.Key, "alice"), &aliceConversation), ShouldBeNil)
+			So(UnreadCount(&aliceConversation), ShouldEqual, 0)
+
+			Convey("and resets on read", func() {
+				read, err := MarkAsRead(context.Background(), db, conversation.ID.Key, "bob")
+				So(err, ShouldBeNil)
+				So(UnreadCount(read), ShouldEqual, 0)
+				So(read.Get("last_read_at"), ShouldResemble, time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC))
+
+				_, err = MarkAsRead(context.Background(), db, conversation.ID.Key, "carol")
+				So(err, ShouldEqual, ErrNotParticipant)
+			})
+		})
+	})
+}
+
+func TestQueries(t *testing.T) {
+	Convey("Queries", t, func() {
+		db := &queryDB{MapDB: skydbtest.NewMapDB()}
+
+		Convey("user conversations by user", func() {
+			_, err := CreateConversation(context.Background(), db, "alice", []string{"bob"}, "")
+			So(err, ShouldBeNil)
+
+			records, err := UserConversations(context.Background(), db, "bob")
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 2)
+			So(db.lastQuery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "user_id"},
+					skydb.Expression{Type: skydb.Literal, Value: "bob"},
+				},
+			})
+		})
+
+		Convey("messages before a time", func() {
+			before := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+			_, err := Messages(context.Background(), db, "conversation-id", before, 20)
+			So(err, ShouldBeNil)
+			So(db.lastQuery.Type, ShouldEqual, MessageRecordType)
+			So(*db.lastQuery.Limit, ShouldEqual, 20)
+			So(db.lastQuery.Sorts, ShouldResemble, []skydb.Sort{
+				{KeyPath: "_created_at", Order: skydb.Descending},
+			})
+			So(db.lastQuery.Predicate.Operator, ShouldEqual, skydb.And)
+			So(db.lastQuery.Predicate.Children, ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestNotifier(t *testing.T) {
+	Convey("Notifier", t, func() {
+		Convey("publishes nothing without hub", func() {
+			var notifier *Notifier
+			notifier.Notify([]string{"alice"}, Event{Type: EventTyping})
+			(&Notifier{}).Notify([]string{"alice"}, Event{Type: EventTyping})
+		})
+
+		Convey("publishes to channels of users", func() {
+			hub := pubsub.NewHub()
+			notifier := &Notifier{Hub: hub}
+			go notifier.Notify([]string{"alice", "bob"}, Event{
+				Type:           EventTyping,
+				ConversationID: "conversation-id",
+				UserID:         "carol",
+				TypingEvent:    "begin",
+			})
+
+			parcel := <-hub.Broadcast
+			So(parcel.Channel, ShouldEqual, "_chat_alice")
+			So(parcel.Data, ShouldEqualJSON, `{
+				"event": "typing",
+				"conversation_id": "conversation-id",
+				"user_id": "carol",
+				"typing_event": "begin"
+			}`)
+			parcel = <-hub.Broadcast
+			So(parcel.Channel, ShouldEqual, "_chat_bob")
+		})
+	})
+}
@@ -0,0 +1,160 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// Actions of the server. An action is called with the payload fields
+// documented on its handler in package handler.
+const (
+	ActionStatusHealthz = "_status:healthz"
+
+	ActionAssetPut    = "asset:put"
+	ActionAssetStatus = "asset:status"
+
+	ActionAuthLogin    = "auth:login"
+	ActionAuthLogout   = "auth:logout"
+	ActionAuthPassword = "auth:password"
+	ActionAuthRefresh  = "auth:refresh"
+	ActionAuthSignup   = "auth:signup"
+
+	ActionChatAddParticipants    = "chat:add_participants"
+	ActionChatCreateConversation = "chat:create_conversation"
+	ActionChatGetConversations   = "chat:get_conversations"
+	ActionChatGetMessages        = "chat:get_messages"
+	ActionChatMarkAsRead         = "chat:mark_as_read"
+	ActionChatRemoveParticipants = "chat:remove_participants"
+	ActionChatSendMessage        = "chat:send_message"
+	ActionChatTyping             = "chat:typing"
+
+	ActionDeviceList       = "device:list"
+	ActionDeviceRegister   = "device:register"
+	ActionDeviceUnregister = "device:unregister"
+
+	ActionMaintenanceSet    = "maintenance:set"
+	ActionMaintenanceStatus = "maintenance:status"
+
+	ActionMe = "me"
+
+	ActionModerationApprove = "moderation:approve"
+	ActionModerationReject  = "moderation:reject"
+
+	ActionPushDevice = "push:device"
+	ActionPushUser   = "push:user"
+
+	ActionQuotaStatus = "quota:status"
+
+	ActionRecordDelete         = "record:delete"
+	ActionRecordFetch          = "record:fetch"
+	ActionRecordQuery          = "record:query"
+	ActionRecordRank           = "record:rank"
+	ActionRecordSave           = "record:save"
+	ActionRecordSchedule       = "record:schedule"
+	ActionRecordScheduleCancel = "record:schedule:cancel"
+	ActionRecordScheduleQuery  = "record:schedule:query"
+	ActionRecordSync           = "record:sync"
+
+	ActionRelationAdd    = "relation:add"
+	ActionRelationQuery  = "relation:query"
+	ActionRelationRemove = "relation:remove"
+
+	ActionRoleAdmin   = "role:admin"
+	ActionRoleAssign  = "role:assign"
+	ActionRoleDefault = "role:default"
+	ActionRoleRevoke  = "role:revoke"
+
+	ActionSchemaAccess = "schema:access"
+	ActionSchemaApply  = "schema:apply"
+	ActionSchemaCreate = "schema:create"
+	ActionSchemaDelete = "schema:delete"
+	ActionSchemaExport = "schema:export"
+	ActionSchemaFetch  = "schema:fetch"
+	ActionSchemaRename = "schema:rename"
+
+	ActionStatsFetch   = "stats:fetch"
+	ActionStatsStorage = "stats:storage"
+
+	ActionSubscriptionDelete   = "subscription:delete"
+	ActionSubscriptionFetch    = "subscription:fetch"
+	ActionSubscriptionFetchAll = "subscription:fetch_all"
+	ActionSubscriptionSave     = "subscription:save"
+
+	ActionUserLink         = "user:link"
+	ActionUserQuery        = "user:query"
+	ActionUserRevokeTokens = "user:revoke_tokens"
+	ActionUserUpdate       = "user:update"
+)
+
+// Actions lists all the actions of the server.
+var Actions = []string{
+	ActionStatusHealthz,
+	ActionAssetPut,
+	ActionAssetStatus,
+	ActionAuthLogin,
+	ActionAuthLogout,
+	ActionAuthPassword,
+	ActionAuthRefresh,
+	ActionAuthSignup,
+	ActionChatAddParticipants,
+	ActionChatCreateConversation,
+	ActionChatGetConversations,
+	ActionChatGetMessages,
+	ActionChatMarkAsRead,
+	ActionChatRemoveParticipants,
+	ActionChatSendMessage,
+	ActionChatTyping,
+	ActionDeviceList,
+	ActionDeviceRegister,
+	ActionDeviceUnregister,
+	ActionMaintenanceSet,
+	ActionMaintenanceStatus,
+	ActionMe,
+	ActionModerationApprove,
+	ActionModerationReject,
+	ActionPushDevice,
+	ActionPushUser,
+	ActionQuotaStatus,
+	ActionRecordDelete,
+	ActionRecordFetch,
+	ActionRecordQuery,
+	ActionRecordRank,
+	ActionRecordSave,
+	ActionRecordSchedule,
+	ActionRecordScheduleCancel,
+	ActionRecordScheduleQuery,
+	ActionRecordSync,
+	ActionRelationAdd,
+	ActionRelationQuery,
+	ActionRelationRemove,
+	ActionRoleAdmin,
+	ActionRoleAssign,
+	ActionRoleDefault,
+	ActionRoleRevoke,
+	ActionSchemaAccess,
+	ActionSchemaApply,
+	ActionSchemaCreate,
+	ActionSchemaDelete,
+	ActionSchemaExport,
+	ActionSchemaFetch,
+	ActionSchemaRename,
+	ActionStatsFetch,
+	ActionStatsStorage,
+	ActionSubscriptionDelete,
+	ActionSubscriptionFetch,
+	ActionSubscriptionFetchAll,
+	ActionSubscriptionSave,
+	ActionUserLink,
+	ActionUserQuery,
+	ActionUserRevokeTokens,
+	ActionUserUpdate,
+}
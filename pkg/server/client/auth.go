@@ -0,0 +1,93 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"time"
+)
+
+// AuthRequest is the payload of auth:signup and auth:login.
+type AuthRequest struct {
+	Username string                 `json:"username,omitempty"`
+	Email    string                 `json:"email,omitempty"`
+	Password string                 `json:"password,omitempty"`
+	Provider string                 `json:"provider,omitempty"`
+	AuthData map[string]interface{} `json:"auth_data,omitempty"`
+}
+
+// AuthResult is the result of auth:signup, auth:login and me.
+type AuthResult struct {
+	UserID      string     `json:"user_id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Roles       []string   `json:"roles"`
+	AccessToken string     `json:"access_token"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	LastSeenAt  *time.Time `json:"last_seen_at"`
+}
+
+// Signup signs up a user and uses the returned access token for
+// subsequent requests.
+func (c *Client) Signup(req AuthRequest) (*AuthResult, error) {
+	return c.authenticate(ActionAuthSignup, req)
+}
+
+// Login logs in a user and uses the returned access token for
+// subsequent requests.
+func (c *Client) Login(req AuthRequest) (*AuthResult, error) {
+	return c.authenticate(ActionAuthLogin, req)
+}
+
+func (c *Client) authenticate(action string, req AuthRequest) (*AuthResult, error) {
+	result := AuthResult{}
+	if err := c.CallResult(action, req, &result); err != nil {
+		return nil, err
+	}
+	c.AccessToken = result.AccessToken
+	return &result, nil
+}
+
+// Logout invalidates the access token of the client.
+func (c *Client) Logout() error {
+	if err := c.CallResult(ActionAuthLogout, nil, nil); err != nil {
+		return err
+	}
+	c.AccessToken = ""
+	return nil
+}
+
+// ChangePassword changes the password of the logged in user and uses
+// the returned access token for subsequent requests.
+func (c *Client) ChangePassword(oldPassword string, newPassword string) (*AuthResult, error) {
+	result := AuthResult{}
+	payload := map[string]interface{}{
+		"old_password": oldPassword,
+		"password":     newPassword,
+	}
+	if err := c.CallResult(ActionAuthPassword, payload, &result); err != nil {
+		return nil, err
+	}
+	c.AccessToken = result.AccessToken
+	return &result, nil
+}
+
+// Me returns the logged in user.
+func (c *Client) Me() (*AuthResult, error) {
+	result := AuthResult{}
+	if err := c.CallResult(ActionMe, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client calls the actions of a Skygear Server from Go.
+//
+// Client.Call sends any action with an arbitrary payload. Typed methods
+// are provided for the auth and record actions. Errors returned by the
+// server are decoded into skyerr.Error so that callers can check the
+// error code:
+//
+//	c := &client.Client{Endpoint: "http://localhost:3000", APIKey: "apikey"}
+//	_, err := c.Login(client.AuthRequest{Username: "john", Password: "secret"})
+//	if skyErr, ok := err.(skyerr.Error); ok && skyErr.Code() == skyerr.InvalidCredentials {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Client calls actions of a Skygear Server.
+type Client struct {
+	// Endpoint is the URL of the server, e.g. http://localhost:3000.
+	Endpoint string
+
+	// APIKey is sent with every request. Set it to the master key to
+	// make privileged requests.
+	APIKey string
+
+	// AccessToken is sent with every request if not empty. It is set
+	// by Signup and Login and cleared by Logout.
+	AccessToken string
+
+	HTTPClient *http.Client
+}
+
+// Response is the response of an action.
+type Response struct {
+	Result json.RawMessage `json:"result"`
+	Info   json.RawMessage `json:"info"`
+}
+
+type errorResponse struct {
+	Name    string                 `json:"name"`
+	Code    skyerr.ErrorCode       `json:"code"`
+	Message string                 `json:"message"`
+	Info    map[string]interface{} `json:"info"`
+}
+
+type response struct {
+	Response
+	Error *errorResponse `json:"error"`
+}
+
+// Call calls action with payload, which is marshaled into a JSON object.
+// Payload can be nil, a map or a struct. An error returned by the server
+// is returned as skyerr.Error.
+func (c *Client) Call(action string, payload interface{}) (*Response, error) {
+	body := map[string]interface{}{}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("%s: payload is not an object: %v", action, err)
+		}
+	}
+	body["action"] = action
+	body["api_key"] = c.APIKey
+	if c.AccessToken != "" {
+		body["access_token"] = c.AccessToken
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	url := strings.TrimSuffix(c.Endpoint, "/") + "/" + strings.Replace(action, ":", "/", -1)
+	httpResp, err := httpClient.Post(url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := response{}
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%s: failed to decode response with status %d: %v", action, httpResp.StatusCode, err)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error.skyerr()
+	}
+	return &resp.Response, nil
+}
+
+// CallResult calls action with payload and unmarshals the result into
+// result.
+func (c *Client) CallResult(action string, payload interface{}, result interface{}) error {
+	resp, err := c.Call(action, payload)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("%s: failed to decode result: %v", action, err)
+	}
+	return nil
+}
+
+func (e *errorResponse) skyerr() skyerr.Error {
+	code := e.Code
+	if code == 0 {
+		code = skyerr.UnexpectedError
+	}
+	return skyerr.NewErrorWithInfo(code, e.Message, e.Info)
+}
@@ -0,0 +1,198 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeServer struct {
+	paths    []string
+	requests []map[string]interface{}
+	response map[string]interface{}
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.paths = append(s.paths, r.URL.Path)
+	s.requests = append(s.requests, body)
+	json.NewEncoder(w).Encode(s.response)
+}
+
+func TestClient(t *testing.T) {
+	Convey("Client", t, func() {
+		server := &fakeServer{}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		c := &Client{
+			Endpoint: ts.URL + "/",
+			APIKey:   "apikey",
+		}
+
+		Convey("calls action with payload", func() {
+			server.response = map[string]interface{}{
+				"result": map[string]interface{}{"status": "OK"},
+			}
+			c.AccessToken = "token"
+
+			result := map[string]interface{}{}
+			err := c.CallResult(ActionRecordSchedule, map[string]interface{}{
+				"record_id": "note/1",
+			}, &result)
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, map[string]interface{}{"status": "OK"})
+			So(server.paths, ShouldResemble, []string{"/record/schedule"})
+			So(server.requests[0], ShouldResemble, map[string]interface{}{
+				"action":       "record:schedule",
+				"api_key":      "apikey",
+				"access_token": "token",
+				"record_id":    "note/1",
+			})
+		})
+
+		Convey("returns server error as skyerr.Error", func() {
+			server.response = map[string]interface{}{
+				"error": map[string]interface{}{
+					"name":    "InvalidCredentials",
+					"code":    105,
+					"message": "incorrect password",
+					"info":    map[string]interface{}{"arguments": "password"},
+				},
+			}
+
+			result, err := c.Login(AuthRequest{Username: "john", Password: "wrong"})
+			So(result, ShouldBeNil)
+			skyErr, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(skyErr.Code(), ShouldEqual, skyerr.InvalidCredentials)
+			So(skyErr.Message(), ShouldEqual, "incorrect password")
+			So(skyErr.Info(), ShouldResemble, map[string]interface{}{"arguments": "password"})
+			So(c.AccessToken, ShouldEqual, "")
+		})
+
+		Convey("rejects payload that is not an object", func() {
+			_, err := c.Call(ActionMe, []string{"me"})
+			So(err, ShouldNotBeNil)
+			So(server.requests, ShouldBeEmpty)
+		})
+
+		Convey("logs in and out", func() {
+			server.response = map[string]interface{}{
+				"result": map[string]interface{}{
+					"user_id":      "user1",
+					"username":     "john",
+					"roles":        []string{"admin"},
+					"access_token": "token",
+				},
+			}
+
+			result, err := c.Login(AuthRequest{Username: "john", Password: "secret"})
+			So(err, ShouldBeNil)
+			So(result.UserID, ShouldEqual, "user1")
+			So(result.Roles, ShouldResemble, []string{"admin"})
+			So(c.AccessToken, ShouldEqual, "token")
+			So(server.requests[0], ShouldResemble, map[string]interface{}{
+				"action":   "auth:login",
+				"api_key":  "apikey",
+				"username": "john",
+				"password": "secret",
+			})
+
+			server.response = map[string]interface{}{
+				"result": map[string]interface{}{"status": "OK"},
+			}
+			So(c.Logout(), ShouldBeNil)
+			So(server.requests[1]["access_token"], ShouldEqual, "token")
+			So(c.AccessToken, ShouldEqual, "")
+		})
+
+		Convey("saves records with per-record errors", func() {
+			server.response = map[string]interface{}{
+				"result": []interface{}{
+					map[string]interface{}{"_id": "note/1", "_type": "record", "title": "Hello"},
+					map[string]interface{}{
+						"_id":     "note/2",
+						"_type":   "error",
+						"name":    "PermissionDenied",
+						"code":    102,
+						"message": "no permission to modify",
+					},
+				},
+			}
+
+			results, err := c.SaveRecords(PublicDatabase, []Record{
+				{"_id": "note/1", "title": "Hello"},
+				{"_id": "note/2", "title": "World"},
+			}, false)
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Err, ShouldBeNil)
+			So(results[0].Record.ID(), ShouldEqual, "note/1")
+			So(results[0].Record["title"], ShouldEqual, "Hello")
+			So(results[1].Record.ID(), ShouldEqual, "note/2")
+			So(results[1].Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+			So(server.requests[0]["database_id"], ShouldEqual, "_public")
+			So(server.requests[0]["atomic"], ShouldEqual, false)
+		})
+
+		Convey("queries records with count", func() {
+			server.response = map[string]interface{}{
+				"result": []interface{}{
+					map[string]interface{}{"_id": "note/1", "_type": "record"},
+				},
+				"info": map[string]interface{}{"count": 5},
+			}
+
+			limit := uint64(1)
+			result, err := c.QueryRecords(QueryRequest{
+				DatabaseID: PublicDatabase,
+				RecordType: "note",
+				Predicate: []interface{}{
+					"eq",
+					map[string]interface{}{"$type": "keypath", "$val": "title"},
+					"Hello",
+				},
+				Count: true,
+				Limit: &limit,
+			})
+			So(err, ShouldBeNil)
+			So(result.Records, ShouldResemble, []Record{
+				{"_id": "note/1", "_type": "record"},
+			})
+			So(*result.Count, ShouldEqual, 5)
+			So(server.requests[0], ShouldResemble, map[string]interface{}{
+				"action":      "record:query",
+				"api_key":     "apikey",
+				"database_id": "_public",
+				"record_type": "note",
+				"predicate": []interface{}{
+					"eq",
+					map[string]interface{}{"$type": "keypath", "$val": "title"},
+					"Hello",
+				},
+				"count": true,
+				"limit": float64(1),
+			})
+		})
+	})
+}
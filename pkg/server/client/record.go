@@ -0,0 +1,158 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Database IDs accepted by the record actions.
+const (
+	PublicDatabase  = "_public"
+	PrivateDatabase = "_private"
+	UnionDatabase   = "_union"
+)
+
+// Record is a record in its serialized form, with reserved keys such
+// as _id and _access alongside the record data.
+type Record map[string]interface{}
+
+// ID returns the ID of the record in the form of "type/id".
+func (r Record) ID() string {
+	id, _ := r["_id"].(string)
+	return id
+}
+
+// RecordResult is an item of the result of the record actions. Err is
+// not nil if the action failed on the record.
+type RecordResult struct {
+	Record Record
+	Err    skyerr.Error
+}
+
+// UnmarshalJSON decodes either a record or an error item.
+func (r *RecordResult) UnmarshalJSON(data []byte) error {
+	item := map[string]interface{}{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	if item["_type"] != "error" {
+		r.Record = Record(item)
+		return nil
+	}
+
+	errResp := errorResponse{}
+	if err := json.Unmarshal(data, &errResp); err != nil {
+		return err
+	}
+	r.Err = errResp.skyerr()
+	if id, ok := item["_id"].(string); ok {
+		r.Record = Record{"_id": id}
+	}
+	return nil
+}
+
+// SaveRecords saves records in the database. If atomic is true, no
+// records are saved if any of them fails to save.
+func (c *Client) SaveRecords(databaseID string, records []Record, atomic bool) ([]RecordResult, error) {
+	payload := map[string]interface{}{
+		"database_id": databaseID,
+		"records":     records,
+		"atomic":      atomic,
+	}
+	results := []RecordResult{}
+	if err := c.CallResult(ActionRecordSave, payload, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// FetchRecords fetches records by IDs in the form of "type/id".
+func (c *Client) FetchRecords(databaseID string, ids []string) ([]RecordResult, error) {
+	payload := map[string]interface{}{
+		"database_id": databaseID,
+		"ids":         ids,
+	}
+	results := []RecordResult{}
+	if err := c.CallResult(ActionRecordFetch, payload, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteRecords deletes records by IDs in the form of "type/id". If
+// atomic is true, no records are deleted if any of them fails to delete.
+func (c *Client) DeleteRecords(databaseID string, ids []string, atomic bool) ([]RecordResult, error) {
+	payload := map[string]interface{}{
+		"database_id": databaseID,
+		"ids":         ids,
+		"atomic":      atomic,
+	}
+	results := []RecordResult{}
+	if err := c.CallResult(ActionRecordDelete, payload, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryRequest is the payload of record:query. Predicate and Sort are in
+// the same serialized form as documented on RecordQueryHandler.
+type QueryRequest struct {
+	DatabaseID  string                 `json:"database_id"`
+	RecordType  string                 `json:"record_type"`
+	Predicate   []interface{}          `json:"predicate,omitempty"`
+	Sort        []interface{}          `json:"sort,omitempty"`
+	Include     map[string]interface{} `json:"include,omitempty"`
+	DesiredKeys []string               `json:"desired_keys,omitempty"`
+	Count       bool                   `json:"count,omitempty"`
+	Offset      uint64                 `json:"offset,omitempty"`
+	Limit       *uint64                `json:"limit,omitempty"`
+}
+
+// QueryResult is the result of record:query. Count is only set if
+// requested.
+type QueryResult struct {
+	Records []Record
+	Count   *uint64
+}
+
+// QueryRecords queries records in the database.
+func (c *Client) QueryRecords(req QueryRequest) (*QueryResult, error) {
+	resp, err := c.Call(ActionRecordQuery, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := QueryResult{
+		Records: []Record{},
+	}
+	if len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, &result.Records); err != nil {
+			return nil, err
+		}
+	}
+	if len(resp.Info) > 0 {
+		info := struct {
+			Count *uint64 `json:"count"`
+		}{}
+		if err := json.Unmarshal(resp.Info, &info); err != nil {
+			return nil, err
+		}
+		result.Count = info.Count
+	}
+	return &result, nil
+}
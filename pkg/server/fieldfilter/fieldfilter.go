@@ -0,0 +1,168 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fieldfilter hides configured record and user fields from
+// responses to requests made with the client key.
+package fieldfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+)
+
+// AllRecordTypes is the record type whose fields are hidden from records
+// of all types.
+const AllRecordTypes = "*"
+
+// protectedUserFields are never hidden because clients cannot work
+// without them.
+var protectedUserFields = map[string]bool{
+	"_id":          true,
+	"user_id":      true,
+	"access_token": true,
+}
+
+// Filter hides fields from the result of a response before it is
+// written. It implements router.ResponseFilter.
+//
+// Fields are shown in full to requests made with the master key and to
+// users having any of the ExemptRoles.
+type Filter struct {
+	// RecordFields maps a record type to the fields hidden from records
+	// of that type. Fields of AllRecordTypes are hidden from all records.
+	RecordFields map[string][]string
+
+	// UserFields are hidden from user info, e.g. email. They are hidden
+	// by the handlers building user info through FilterUser.
+	UserFields []string
+
+	ExemptRoles []string
+}
+
+// Enabled returns true if any field is to be hidden.
+func (f *Filter) Enabled() bool {
+	return f != nil && (len(f.RecordFields) > 0 || len(f.UserFields) > 0)
+}
+
+func (f *Filter) isExempted(payload *router.Payload) bool {
+	if payload.HasMasterKey() {
+		return true
+	}
+	if payload.UserInfo == nil {
+		return false
+	}
+	for _, role := range payload.UserInfo.Roles {
+		for _, exemptRole := range f.ExemptRoles {
+			if role == exemptRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterResponse replaces the result of response with one having the
+// configured record fields removed.
+func (f *Filter) FilterResponse(payload *router.Payload, response *router.Response) error {
+	if f == nil || len(f.RecordFields) == 0 || response.Result == nil || f.isExempted(payload) {
+		return nil
+	}
+
+	result, err := toJSONValue(response.Result)
+	if err != nil {
+		return err
+	}
+
+	f.filterRecords(result)
+	response.Result = result
+	return nil
+}
+
+// FilterUser returns user with the configured user fields removed, for
+// a handler to return user info, such as an AuthResponse, to the
+// request of payload. user is returned as is if no field is hidden
+// from the request.
+func (f *Filter) FilterUser(payload *router.Payload, user interface{}) (interface{}, error) {
+	if f == nil || len(f.UserFields) == 0 || user == nil || f.isExempted(payload) {
+		return user, nil
+	}
+
+	result, err := toJSONValue(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if userMap, ok := result.(map[string]interface{}); ok {
+		f.filterUser(userMap)
+	}
+	return result, nil
+}
+
+// toJSONValue converts value to its JSON representation, so that
+// records and users are filtered the same way regardless of how
+// handlers serialize them.
+func toJSONValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// filterRecords removes hidden record fields from all records found in
+// value, including records nested in other records.
+func (f *Filter) filterRecords(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v["_type"] == "record" {
+			f.filterRecord(v)
+		}
+		for _, child := range v {
+			f.filterRecords(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			f.filterRecords(child)
+		}
+	}
+}
+
+func (f *Filter) filterRecord(record map[string]interface{}) {
+	for _, field := range f.RecordFields[AllRecordTypes] {
+		delete(record, field)
+	}
+
+	id, _ := record["_id"].(string)
+	recordType := strings.SplitN(id, "/", 2)[0]
+	for _, field := range f.RecordFields[recordType] {
+		delete(record, field)
+	}
+}
+
+func (f *Filter) filterUser(user map[string]interface{}) {
+	for _, field := range f.UserFields {
+		if !protectedUserFields[field] {
+			delete(user, field)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fieldfilter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func resultJSON(response *router.Response) []byte {
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestFilter(t *testing.T) {
+	Convey("Filter", t, func() {
+		filter := &Filter{
+			RecordFields: map[string][]string{
+				"user":         []string{"email"},
+				AllRecordTypes: []string{"secret"},
+			},
+			UserFields:  []string{"email", "user_id"},
+			ExemptRoles: []string{"admin"},
+		}
+
+		userRecord := skydb.Record{
+			ID: skydb.NewRecordID("user", "user0"),
+			Data: map[string]interface{}{
+				"email":  "user0@example.com",
+				"secret": "s3cr3t",
+				"name":   "User 0",
+			},
+		}
+		noteRecord := skydb.Record{
+			ID: skydb.NewRecordID("note", "note0"),
+			Data: map[string]interface{}{
+				"email":  "note@example.com",
+				"secret": "s3cr3t",
+			},
+			Transient: map[string]interface{}{
+				"author": userRecord,
+			},
+		}
+
+		Convey("is disabled without fields", func() {
+			var nilFilter *Filter
+			So(nilFilter.Enabled(), ShouldBeFalse)
+			So((&Filter{ExemptRoles: []string{"admin"}}).Enabled(), ShouldBeFalse)
+			So(filter.Enabled(), ShouldBeTrue)
+		})
+
+		Convey("hides record fields including transient records", func() {
+			payload := &router.Payload{
+				Data: map[string]interface{}{"action": "record:fetch"},
+			}
+			response := &router.Response{
+				Result: []interface{}{
+					(*skyconv.JSONRecord)(&userRecord),
+					(*skyconv.JSONRecord)(&noteRecord),
+				},
+			}
+
+			So(filter.FilterResponse(payload, response), ShouldBeNil)
+			So(resultJSON(response), ShouldEqualJSON, `[{
+				"_id": "user/user0",
+				"_type": "record",
+				"_access": null,
+				"name": "User 0"
+			}, {
+				"_id": "note/note0",
+				"_type": "record",
+				"_access": null,
+				"email": "note@example.com",
+				"_transient": {
+					"author": {
+						"_id": "user/user0",
+						"_type": "record",
+						"_access": null,
+						"name": "User 0"
+					}
+				}
+			}]`)
+		})
+
+		Convey("hides user fields", func() {
+			payload := &router.Payload{
+				Data: map[string]interface{}{"action": "auth:refresh"},
+			}
+			user, err := filter.FilterUser(payload, struct {
+				UserID      string `json:"user_id"`
+				Email       string `json:"email"`
+				Username    string `json:"username"`
+				AccessToken string `json:"access_token"`
+			}{"user0", "user0@example.com", "user0", "token"})
+
+			So(err, ShouldBeNil)
+			So(resultJSON(&router.Response{Result: user}), ShouldEqualJSON, `{
+				"user_id": "user0",
+				"username": "user0",
+				"access_token": "token"
+			}`)
+		})
+
+		Convey("does not hide user fields from responses", func() {
+			payload := &router.Payload{
+				Data: map[string]interface{}{"action": "quota:status"},
+			}
+			response := &router.Response{
+				Result: map[string]interface{}{
+					"email": "user0@example.com",
+				},
+			}
+
+			So(filter.FilterResponse(payload, response), ShouldBeNil)
+			So(resultJSON(response), ShouldEqualJSON, `{
+				"email": "user0@example.com"
+			}`)
+		})
+
+		Convey("shows all user fields to master key", func() {
+			payload := &router.Payload{
+				Data:      map[string]interface{}{"action": "me"},
+				AccessKey: router.MasterAccessKey,
+			}
+			userin := map[string]interface{}{
+				"email": "user0@example.com",
+			}
+
+			user, err := filter.FilterUser(payload, userin)
+			So(err, ShouldBeNil)
+			So(user, ShouldResemble, userin)
+		})
+
+		Convey("shows all fields to master key", func() {
+			payload := &router.Payload{
+				Data:      map[string]interface{}{"action": "record:fetch"},
+				AccessKey: router.MasterAccessKey,
+			}
+			record := (*skyconv.JSONRecord)(&userRecord)
+			response := &router.Response{
+				Result: record,
+			}
+
+			So(filter.FilterResponse(payload, response), ShouldBeNil)
+			So(response.Result, ShouldEqual, record)
+		})
+
+		Convey("shows all fields to exempted roles", func() {
+			payload := &router.Payload{
+				Data: map[string]interface{}{"action": "record:fetch"},
+				UserInfo: &skydb.UserInfo{
+					ID:    "user0",
+					Roles: []string{"admin"},
+				},
+			}
+			record := (*skyconv.JSONRecord)(&userRecord)
+			response := &router.Response{
+				Result: record,
+			}
+
+			So(filter.FilterResponse(payload, response), ShouldBeNil)
+			So(response.Result, ShouldEqual, record)
+		})
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geoip resolves the coarse location of clients from their IP
+// addresses.
+package geoip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("geoip")
+
+// Lookuper looks up the location of an IP address.
+type Lookuper interface {
+	Lookup(ip net.IP) (skydb.LoginLocation, error)
+}
+
+// Resolver resolves the location of the client of a request.
+//
+// A Resolver without Lookuper is disabled and resolves no location.
+type Resolver struct {
+	Lookuper Lookuper
+
+	// TrustProxy specifies whether to take the client IP from the
+	// X-Forwarded-For header, which should only be enabled when skygear
+	// server is behind a reverse proxy.
+	TrustProxy bool
+}
+
+// Enabled returns whether the Resolver resolves locations.
+func (r *Resolver) Enabled() bool {
+	return r != nil && r.Lookuper != nil
+}
+
+// ClientIP returns the IP address of the client of the request, or nil
+// if it cannot be determined.
+func (r *Resolver) ClientIP(req *http.Request) net.IP {
+	if req == nil {
+		return nil
+	}
+
+	if r != nil && r.TrustProxy {
+		// the left-most address is the original client
+		forwardedFor := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+		if ip := net.ParseIP(strings.TrimSpace(forwardedFor[0])); ip != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// Resolve returns the location of the client of the request. It returns
+// nil if the Resolver is disabled or the location cannot be resolved,
+// in which case the failure is logged.
+func (r *Resolver) Resolve(req *http.Request) *skydb.LoginLocation {
+	if !r.Enabled() {
+		return nil
+	}
+
+	ip := r.ClientIP(req)
+	if ip == nil {
+		log.Debug("geoip: unable to determine client IP")
+		return nil
+	}
+
+	location, err := r.Lookuper.Lookup(ip)
+	if err != nil {
+		log.WithField("ip", ip.String()).WithField("err", err).Warn("geoip: failed to look up location")
+		return nil
+	}
+	location.IP = ip.String()
+	return &location
+}
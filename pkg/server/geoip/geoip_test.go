@@ -0,0 +1,83 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mapLookuper map[string]skydb.LoginLocation
+
+func (l mapLookuper) Lookup(ip net.IP) (skydb.LoginLocation, error) {
+	location, ok := l[ip.String()]
+	if !ok {
+		return skydb.LoginLocation{}, errors.New("address not found")
+	}
+	return location, nil
+}
+
+func TestResolver(t *testing.T) {
+	Convey("Resolver", t, func() {
+		resolver := &Resolver{
+			Lookuper: mapLookuper{
+				"203.0.113.1": skydb.LoginLocation{
+					CountryCode: "HK",
+					Country:     "Hong Kong",
+				},
+			},
+		}
+		req, _ := http.NewRequest("POST", "/", nil)
+		req.RemoteAddr = "203.0.113.1:54321"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.1")
+
+		Convey("takes client IP from remote address", func() {
+			So(resolver.ClientIP(req).String(), ShouldEqual, "203.0.113.1")
+		})
+
+		Convey("takes client IP from X-Forwarded-For behind proxy", func() {
+			resolver.TrustProxy = true
+			So(resolver.ClientIP(req).String(), ShouldEqual, "198.51.100.1")
+
+			req.Header.Del("X-Forwarded-For")
+			So(resolver.ClientIP(req).String(), ShouldEqual, "203.0.113.1")
+		})
+
+		Convey("resolves location", func() {
+			So(resolver.Resolve(req), ShouldResemble, &skydb.LoginLocation{
+				IP:          "203.0.113.1",
+				CountryCode: "HK",
+				Country:     "Hong Kong",
+			})
+		})
+
+		Convey("resolves nil for unknown address", func() {
+			req.RemoteAddr = "192.0.2.1:54321"
+			So(resolver.Resolve(req), ShouldBeNil)
+		})
+
+		Convey("resolves nil when disabled", func() {
+			var disabled *Resolver
+			So(disabled.Enabled(), ShouldBeFalse)
+			So(disabled.Resolve(req), ShouldBeNil)
+			So((&Resolver{}).Resolve(req), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// MaxMindLookuper looks up locations from a MaxMind GeoIP2 or GeoLite2
+// City database.
+type MaxMindLookuper struct {
+	reader *geoip2.Reader
+}
+
+// NewMaxMindLookuper opens the MaxMind database at path.
+func NewMaxMindLookuper(path string) (*MaxMindLookuper, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindLookuper{reader}, nil
+}
+
+// Lookup implements Lookuper. Names are in English.
+func (l *MaxMindLookuper) Lookup(ip net.IP) (skydb.LoginLocation, error) {
+	city, err := l.reader.City(ip)
+	if err != nil {
+		return skydb.LoginLocation{}, err
+	}
+
+	location := skydb.LoginLocation{
+		CountryCode: city.Country.IsoCode,
+		Country:     city.Country.Names["en"],
+		City:        city.City.Names["en"],
+	}
+	if len(city.Subdivisions) > 0 {
+		location.Region = city.Subdivisions[0].Names["en"]
+	}
+	return location, nil
+}
+
+// Close closes the database.
+func (l *MaxMindLookuper) Close() error {
+	return l.reader.Close()
+}
@@ -0,0 +1,166 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graceful provides an HTTP server that can be shut down
+// without interrupting requests in progress.
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// pollInterval is how often Shutdown checks for connections in use.
+	pollInterval = 50 * time.Millisecond
+
+	// newConnGracePeriod is how long a new connection is given to send
+	// its first request during shutdown before it is closed as idle.
+	newConnGracePeriod = 5 * time.Second
+)
+
+type connState struct {
+	state http.ConnState
+	since time.Time
+}
+
+// Server serves HTTP on Addr until Shutdown is called.
+//
+// Connections hijacked by handlers, such as websocket connections of
+// pubsub, are not tracked and are left to the handlers to close.
+type Server struct {
+	Addr    string
+	Handler http.Handler
+
+	mutex        sync.Mutex
+	server       *http.Server
+	listener     net.Listener
+	conns        map[net.Conn]connState
+	shuttingDown bool
+}
+
+// ListenAndServe listens on Addr and serves requests with Handler. It
+// returns nil once Shutdown is called.
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener and serves requests with
+// Handler. It returns nil once Shutdown is called.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	s.listener = listener
+	s.conns = map[net.Conn]connState{}
+	s.server = &http.Server{
+		Handler:   s.Handler,
+		ConnState: s.trackConn,
+	}
+	server := s.server
+	s.mutex.Unlock()
+
+	err := server.Serve(listener)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.shuttingDown {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and closes idle connections,
+// then waits for requests in progress to finish. If ctx is done first,
+// the remaining connections are closed and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.shuttingDown = true
+	if s.server != nil {
+		s.server.SetKeepAlivesEnabled(false)
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mutex.Unlock()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn, state http.ConnState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, conn)
+	default:
+		s.conns[conn] = connState{state, time.Now()}
+	}
+
+	// Keep-alive connections becoming idle after shutdown would
+	// otherwise stay open until they time out.
+	if s.shuttingDown && state == http.StateIdle {
+		conn.Close()
+	}
+}
+
+// closeIdleConns closes connections not serving a request, including
+// new connections which have not sent one within the grace period, and
+// returns the number of connections still in use.
+func (s *Server) closeIdleConns() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	active := 0
+	for conn, c := range s.conns {
+		idle := c.state == http.StateIdle ||
+			(c.state == http.StateNew && time.Since(c.since) > newConnGracePeriod)
+		if idle {
+			conn.Close()
+			delete(s.conns, conn)
+			continue
+		}
+		active++
+	}
+	return active
+}
+
+func (s *Server) closeAllConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
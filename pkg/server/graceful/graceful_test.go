@@ -0,0 +1,102 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graceful
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServer(t *testing.T) {
+	Convey("Server", t, func() {
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+		server := &Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					started <- struct{}{}
+					<-release
+				}
+				w.Write([]byte("done"))
+			}),
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		url := "http://" + listener.Addr().String()
+
+		served := make(chan error, 1)
+		go func() {
+			served <- server.Serve(listener)
+		}()
+
+		Convey("waits for requests in progress", func() {
+			// an idle keep-alive connection should not block shutdown
+			resp, err := http.Get(url + "/fast")
+			So(err, ShouldBeNil)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			responded := make(chan string, 1)
+			go func() {
+				resp, err := http.Get(url + "/slow")
+				if err != nil {
+					responded <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := ioutil.ReadAll(resp.Body)
+				responded <- string(body)
+			}()
+			<-started
+
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- server.Shutdown(context.Background())
+			}()
+
+			select {
+			case <-shutdown:
+				So("shutdown without waiting", ShouldBeNil)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			_, err = net.Dial("tcp", listener.Addr().String())
+			So(err, ShouldNotBeNil)
+
+			close(release)
+			So(<-responded, ShouldEqual, "done")
+			So(<-shutdown, ShouldBeNil)
+			So(<-served, ShouldBeNil)
+		})
+
+		Convey("gives up when context is done", func() {
+			go http.Get(url + "/slow")
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			So(server.Shutdown(ctx), ShouldEqual, context.DeadlineExceeded)
+			So(<-served, ShouldBeNil)
+			close(release)
+		})
+	})
+}
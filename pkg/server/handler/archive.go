@@ -0,0 +1,140 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type archivedRecordResponseItem struct {
+	Record     *skyconv.JSONRecord `json:"record"`
+	ArchivedAt time.Time           `json:"archived_at"`
+}
+
+/*
+RecordArchiveFetchHandler fetches records of the public database moved to
+the archive table by retention rules. Archived records are not returned by
+record:fetch and record:query.
+
+The access control of an archived record is the one it has when it is
+archived.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:archive_fetch",
+    "access_token": "ACCESS_TOKEN",
+    "ids": ["log/1004", "log/1005"]
+}
+EOF
+
+{
+    "result": [
+        {
+            "record": {
+                "_id": "log/1004",
+                "_type": "record",
+                "_access": null,
+                "level": "debug"
+            },
+            "archived_at": "2017-03-01T10:00:00Z"
+        },
+        {
+            "_id": "log/1005",
+            "_type": "error",
+            "code": 110,
+            "name": "ResourceNotFound",
+            "message": "archived record not found"
+        }
+    ]
+}
+*/
+type RecordArchiveFetchHandler struct {
+	AssetStore    asset.Store      `inject:"AssetStore"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordArchiveFetchHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordArchiveFetchHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordArchiveFetchHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &recordFetchPayload{}
+	if err := p.Decode(payload.Data); err != nil {
+		response.Err = err
+		return
+	}
+
+	archive, ok := payload.DBConn.(skydb.RecordArchive)
+	if !ok {
+		response.Err = skyerr.NewError(skyerr.NotSupported, "archived records are not supported by the database")
+		return
+	}
+
+	results := make([]interface{}, p.ItemLen(), p.ItemLen())
+	for i, recordID := range p.RecordIDs {
+		archived := skydb.ArchivedRecord{}
+		if err := archive.GetArchivedRecord(ctx, recordID, &archived); err == skydb.ErrArchivedRecordNotFound {
+			results[i] = newSerializedError(
+				recordID.String(),
+				skyerr.NewError(skyerr.ResourceNotFound, "archived record not found"),
+			)
+		} else if err != nil {
+			log.WithFields(logrus.Fields{
+				"recordID": recordID,
+				"err":      err,
+			}).Errorln("Failed to fetch archived record")
+			results[i] = newSerializedError(
+				recordID.String(),
+				skyerr.NewResourceFetchFailureErr("record", recordID.String()),
+			)
+		} else if !payload.HasMasterKey() && !archived.Record.Accessible(payload.UserInfo, skydb.ReadLevel) {
+			results[i] = newSerializedError(
+				recordID.String(),
+				skyerr.NewError(skyerr.PermissionDenied, "no permission to read"),
+			)
+		} else {
+			injectSigner(&archived.Record, h.AssetStore)
+			results[i] = archivedRecordResponseItem{
+				Record:     (*skyconv.JSONRecord)(&archived.Record),
+				ArchivedAt: archived.ArchivedAt,
+			}
+		}
+	}
+
+	response.Result = results
+}
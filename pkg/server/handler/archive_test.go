@@ -0,0 +1,158 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// archiveConn is a RecordArchive keeping archived records in memory.
+type archiveConn struct {
+	archived map[string]skydb.ArchivedRecord
+	*skydbtest.MapConn
+}
+
+func (conn *archiveConn) ArchiveRecord(record *skydb.ArchivedRecord) error {
+	conn.archived[record.Record.ID.String()] = *record
+	return nil
+}
+
+func (conn *archiveConn) GetArchivedRecord(id skydb.RecordID, record *skydb.ArchivedRecord) error {
+	archived, ok := conn.archived[id.String()]
+	if !ok {
+		return skydb.ErrArchivedRecordNotFound
+	}
+	*record = archived
+	return nil
+}
+
+func TestRecordArchiveFetchHandler(t *testing.T) {
+	Convey("RecordArchiveFetchHandler", t, func() {
+		conn := &archiveConn{
+			archived: map[string]skydb.ArchivedRecord{},
+			MapConn:  skydbtest.NewMapConn(),
+		}
+		archivedAt := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		conn.ArchiveRecord(&skydb.ArchivedRecord{
+			Record: skydb.Record{
+				ID:      skydb.NewRecordID("log", "public"),
+				OwnerID: "owner",
+				ACL: skydb.NewRecordACL([]skydb.RecordACLEntry{
+					skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+				}),
+				Data: skydb.Data{"level": "debug"},
+			},
+			ArchivedAt: archivedAt,
+		})
+		conn.ArchiveRecord(&skydb.ArchivedRecord{
+			Record: skydb.Record{
+				ID:      skydb.NewRecordID("log", "private"),
+				OwnerID: "owner",
+				ACL: skydb.NewRecordACL([]skydb.RecordACLEntry{
+					skydb.NewRecordACLEntryDirect("owner", skydb.ReadLevel),
+				}),
+				Data: skydb.Data{"level": "error"},
+			},
+			ArchivedAt: archivedAt,
+		})
+
+		Convey("fetches archived records readable by user", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordArchiveFetchHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.UserInfo = &skydb.UserInfo{ID: "reader"}
+			})
+
+			resp := r.POST(`{"ids": ["log/public", "log/private", "log/missing"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"record": {
+						"_id": "log/public",
+						"_type": "record",
+						"_access": [{"level": "read", "public": true}],
+						"_ownerID": "owner",
+						"level": "debug"
+					},
+					"archived_at": "2017-03-01T10:00:00Z"
+				}, {
+					"_id": "log/private",
+					"_type": "error",
+					"code": 102,
+					"message": "no permission to read",
+					"name": "PermissionDenied"
+				}, {
+					"_id": "log/missing",
+					"_type": "error",
+					"code": 110,
+					"message": "archived record not found",
+					"name": "ResourceNotFound"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+		})
+
+		Convey("fetches any archived record with master key", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordArchiveFetchHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(`{"ids": ["log/private"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"record": {
+						"_id": "log/private",
+						"_type": "record",
+						"_access": [{"relation": "$direct", "level": "read", "user_id": "owner"}],
+						"_ownerID": "owner",
+						"level": "error"
+					},
+					"archived_at": "2017-03-01T10:00:00Z"
+				}]
+			}`)
+		})
+
+		Convey("rejects malformed ids", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordArchiveFetchHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+
+			resp := r.POST(`{"ids": ["log"]}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+
+		Convey("is not supported without archive", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordArchiveFetchHandler{}, func(p *router.Payload) {
+				p.DBConn = skydbtest.NewMapConn()
+			})
+
+			resp := r.POST(`{"ids": ["log/public"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"message": "archived records are not supported by the database",
+					"name": "NotSupported"
+				}
+			}`)
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 
@@ -26,14 +27,27 @@ import (
 )
 
 // AssetUploadHandler models the handler for asset upload request
+//
+// AssetPrefixes are the prefixes of the names of assets by app name, so
+// that apps sharing the asset store do not share assets.
 type AssetUploadHandler struct {
 	AssetStore    skyAsset.Store   `inject:"AssetStore"`
 	AccessKey     router.Processor `preprocessor:"accesskey"`
 	DBConn        router.Processor `preprocessor:"dbconn"`
 	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	AssetPrefixes map[string]string
 	preprocessors []router.Processor
 }
 
+// prefixAssetName prepends the asset prefix of the app to the name of
+// an asset uploaded to the app.
+func prefixAssetName(prefixes map[string]string, appName string, name string) string {
+	if prefix := prefixes[appName]; prefix != "" {
+		return filepath.Join(prefix, name)
+	}
+	return name
+}
+
 // AssetUploadResponse models the response of asset upload request
 type AssetUploadResponse struct {
 	PostRequest *skyAsset.PostFileRequest `json:"post-request"`
@@ -54,43 +68,42 @@ func (h *AssetUploadHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
+// PayloadSchema returns the schema of the asset upload request
+func (h *AssetUploadHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "filename", Type: router.StringField, Required: true},
+		{Name: "content-type", Type: router.StringField, Required: true},
+		{Name: "content-size", Type: router.NumberField, Required: true},
+		{Name: "content-md5", Type: router.StringField},
+		{Name: "content-sha256", Type: router.StringField},
+	}
+}
+
 // Handle is the handling method of the asset upload request
 func (h *AssetUploadHandler) Handle(
+	ctx context.Context,
 	payload *router.Payload,
 	response *router.Response,
 ) {
-	filename, ok := payload.Data["filename"].(string)
-	if !ok {
-		response.Err = skyerr.NewInvalidArgument(
-			"Missing filename or filename is invalid",
-			[]string{"filename"},
-		)
-		return
-	}
-
-	contentType, ok := payload.Data["content-type"].(string)
-	if !ok {
-		response.Err = skyerr.NewInvalidArgument(
-			"Missing content type or content type is invalid",
-			[]string{"content-type"},
-		)
-		return
-	}
+	filename := payload.Data["filename"].(string)
+	contentType := payload.Data["content-type"].(string)
+	contentSize := int64(payload.Data["content-size"].(float64))
 
-	contentSizeFloat, ok := payload.Data["content-size"].(float64)
-	if !ok {
+	md5Value, _ := payload.Data["content-md5"].(string)
+	sha256Value, _ := payload.Data["content-sha256"].(string)
+	checksum, err := skyAsset.ParseChecksum(md5Value, sha256Value)
+	if err != nil {
 		response.Err = skyerr.NewInvalidArgument(
-			"Missing content size or content size is invalid",
-			[]string{"content-size"},
+			err.Error(),
+			[]string{"content-md5", "content-sha256"},
 		)
 		return
 	}
-	contentSize := int64(contentSizeFloat)
 
 	// Add UUID to Filename
 	dir, file := filepath.Split(filename)
 	file = strings.Join([]string{uuidNew(), file}, "-")
-	filename = filepath.Join(dir, file)
+	filename = prefixAssetName(h.AssetPrefixes, payload.AppName, filepath.Join(dir, file))
 
 	// Generate POST File Request
 	assetStore := h.AssetStore
@@ -106,11 +119,14 @@ func (h *AssetUploadHandler) Handle(
 	// Save Asset to DB
 	conn := payload.DBConn
 	asset := skydb.Asset{
-		Name:        filename,
-		ContentType: contentType,
-		Size:        contentSize,
+		Name:         filename,
+		ContentType:  contentType,
+		Size:         contentSize,
+		MD5:          checksum.MD5,
+		SHA256:       checksum.SHA256,
+		UploadStatus: skydb.AssetUploadPending,
 	}
-	if err := conn.SaveAsset(&asset); err != nil {
+	if err := conn.SaveAsset(ctx, &asset); err != nil {
 		response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
 		return
 	}
@@ -130,3 +146,114 @@ func (h *AssetUploadHandler) Handle(
 		Asset:       &assetMap,
 	}
 }
+
+/*
+AssetStatusHandler reports the upload status of an asset created by
+asset:put. If the content of a pending asset is found in the asset store,
+for example uploaded directly to the cloud storage, the content is
+verified against the checksum provided to asset:put.
+
+The upload status is one of pending, completed and corrupted.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "asset:status",
+    "name": "c34e739e-ac82-44c0-b36b-28d226edb237-photo.jpg"
+}
+EOF
+
+{
+    "result": {
+        "name": "c34e739e-ac82-44c0-b36b-28d226edb237-photo.jpg",
+        "content_type": "image/jpeg",
+        "size": 102400,
+        "upload_status": "completed",
+        "md5": "7ac66c0f148de9519b8bd264312c4d64",
+        "sha256": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+    }
+}
+*/
+type AssetStatusHandler struct {
+	AssetStore    skyAsset.Store   `inject:"AssetStore"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+type assetStatusResponse struct {
+	Name         string                  `json:"name"`
+	ContentType  string                  `json:"content_type"`
+	Size         int64                   `json:"size"`
+	UploadStatus skydb.AssetUploadStatus `json:"upload_status"`
+	MD5          string                  `json:"md5,omitempty"`
+	SHA256       string                  `json:"sha256,omitempty"`
+}
+
+func (h *AssetStatusHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *AssetStatusHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *AssetStatusHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "name", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *AssetStatusHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	name := payload.Data["name"].(string)
+
+	conn := payload.DBConn
+	asset := skydb.Asset{}
+	if err := conn.GetAsset(ctx, name, &asset); err != nil {
+		response.Err = skyerr.NewError(skyerr.ResourceNotFound, "asset not found")
+		return
+	}
+
+	if asset.UploadStatus == skydb.AssetUploadPending {
+		h.verifyPendingAsset(ctx, conn, &asset)
+	}
+
+	response.Result = assetStatusResponse{
+		Name:         asset.Name,
+		ContentType:  asset.ContentType,
+		Size:         asset.Size,
+		UploadStatus: asset.UploadStatus,
+		MD5:          asset.MD5,
+		SHA256:       asset.SHA256,
+	}
+}
+
+// verifyPendingAsset updates the upload status of a pending asset if its
+// content is found in the asset store.
+func (h *AssetStatusHandler) verifyPendingAsset(ctx context.Context, conn skydb.Conn, asset *skydb.Asset) {
+	expected := skyAsset.Checksum{
+		MD5:    asset.MD5,
+		SHA256: asset.SHA256,
+	}
+	actual, err := skyAsset.VerifyStoredFile(h.AssetStore, asset.Name, expected)
+	if _, ok := err.(*skyAsset.ChecksumMismatchError); ok {
+		asset.UploadStatus = skydb.AssetUploadCorrupted
+	} else if err != nil {
+		// the content is not yet uploaded
+		log.WithField("err", err).Debugln("Pending asset is not found in asset store")
+		return
+	} else {
+		asset.UploadStatus = skydb.AssetUploadCompleted
+		asset.MD5 = actual.MD5
+		asset.SHA256 = actual.SHA256
+	}
+
+	if err := conn.SaveAsset(ctx, asset); err != nil {
+		log.WithField("err", err).Errorln("Failed to update upload status of asset")
+	}
+}
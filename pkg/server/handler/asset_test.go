@@ -15,8 +15,11 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"testing"
@@ -25,6 +28,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -70,7 +74,7 @@ type saveAssetDBConn struct {
 	savedAsset map[string]*skydb.Asset
 }
 
-func (db *saveAssetDBConn) SaveAsset(asset *skydb.Asset) error {
+func (db *saveAssetDBConn) SaveAsset(ctx context.Context, asset *skydb.Asset) error {
 	db.savedAsset[asset.Name] = asset
 	return nil
 }
@@ -141,6 +145,66 @@ func TestAssetUploadHandler(t *testing.T) {
 			So(savedAsset.Size, ShouldEqual, 2384571)
 		})
 
+		Convey("Saves checksum of pending asset", func() {
+			uuidNew = func() string {
+				return "7b0e2a7c-7135-4912-a6c9-7c1dbec0f5ef"
+			}
+
+			res := assetRouter.POST(`{
+        "filename": "file001",
+        "content-type": "text/plain",
+        "content-size": 5,
+        "content-md5": "XUFAKrxLKna5cZ2REBfFkg=="
+      }`)
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+
+			savedAsset :=
+				assetDBConn.savedAsset["7b0e2a7c-7135-4912-a6c9-7c1dbec0f5ef-file001"]
+
+			So(savedAsset, ShouldNotBeNil)
+			So(savedAsset.MD5, ShouldEqual, "5d41402abc4b2a76b9719d911017c592")
+			So(savedAsset.SHA256, ShouldEqual, "")
+			So(savedAsset.UploadStatus, ShouldEqual, skydb.AssetUploadPending)
+		})
+
+		Convey("Prefixes asset name of app", func() {
+			uuidNew = func() string {
+				return "7b0e2a7c-7135-4912-a6c9-7c1dbec0f5ef"
+			}
+
+			prefixedRouter := handlertest.NewSingleRouteRouter(
+				&AssetUploadHandler{
+					AssetStore:    generatePostFileRequestAssetStore{},
+					AssetPrefixes: map[string]string{"shop": "shop"},
+				},
+				func(p *router.Payload) {
+					p.DBConn = assetDBConn
+					p.AppName = "shop"
+				},
+			)
+
+			res := prefixedRouter.POST(`{
+        "filename": "file001",
+        "content-type": "text/plain",
+        "content-size": 5
+      }`)
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(assetDBConn.savedAsset["shop/7b0e2a7c-7135-4912-a6c9-7c1dbec0f5ef-file001"], ShouldNotBeNil)
+		})
+
+		Convey("Fail when checksum is malformed", func() {
+			res := assetRouter.POST(`{
+        "filename": "file001",
+        "content-type": "text/plain",
+        "content-size": 5,
+        "content-sha256": "XUFAKrxLKna5cZ2REBfFkg=="
+      }`)
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
 		Convey("Fail when no filename", func() {
 			res := assetRouter.POST(`{
         "content-type": "text/plain",
@@ -167,5 +231,143 @@ func TestAssetUploadHandler(t *testing.T) {
 
 			So(res.Code, ShouldEqual, http.StatusBadRequest)
 		})
+
+		Convey("Fail when content-size is not a number", func() {
+			res := assetRouter.POST(`{
+        "filename": "file001",
+        "content-type": "text/plain",
+        "content-size": "5"
+      }`)
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+        "error": {
+          "code": 108,
+          "name": "InvalidArgument",
+          "message": "field \"content-size\" must be of type number",
+          "info": {
+            "arguments": ["content-size"]
+          }
+        }
+      }`)
+		})
+	})
+}
+
+// an asset store that serves files from a map
+type fileMapAssetStore struct {
+	generatePostFileRequestAssetStore
+	files map[string]string
+}
+
+func (s fileMapAssetStore) GetFileReader(name string) (io.ReadCloser, error) {
+	content, ok := s.files[name]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+type assetStatusDBConn struct {
+	saveAssetDBConn
+}
+
+func (db *assetStatusDBConn) GetAsset(ctx context.Context, name string, asset *skydb.Asset) error {
+	savedAsset, ok := db.savedAsset[name]
+	if !ok {
+		return errors.New("asset not found")
+	}
+	*asset = *savedAsset
+	return nil
+}
+
+func TestAssetStatusHandler(t *testing.T) {
+	Convey("Asset Status Handler", t, func() {
+		conn := &assetStatusDBConn{}
+		conn.savedAsset = map[string]*skydb.Asset{
+			"completed.txt": &skydb.Asset{
+				Name:         "completed.txt",
+				ContentType:  "text/plain",
+				Size:         5,
+				MD5:          "5d41402abc4b2a76b9719d911017c592",
+				SHA256:       "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+				UploadStatus: skydb.AssetUploadCompleted,
+			},
+			"pending.txt": &skydb.Asset{
+				Name:         "pending.txt",
+				ContentType:  "text/plain",
+				Size:         5,
+				MD5:          "5d41402abc4b2a76b9719d911017c592",
+				UploadStatus: skydb.AssetUploadPending,
+			},
+		}
+		store := fileMapAssetStore{files: map[string]string{}}
+
+		r := handlertest.NewSingleRouteRouter(
+			&AssetStatusHandler{AssetStore: store},
+			func(p *router.Payload) {
+				p.DBConn = conn
+			},
+		)
+
+		Convey("reports completed asset", func() {
+			res := r.POST(`{"name": "completed.txt"}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "completed.txt",
+					"content_type": "text/plain",
+					"size": 5,
+					"upload_status": "completed",
+					"md5": "5d41402abc4b2a76b9719d911017c592",
+					"sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+				}
+			}`)
+		})
+
+		Convey("reports pending asset not yet uploaded", func() {
+			res := r.POST(`{"name": "pending.txt"}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "pending.txt",
+					"content_type": "text/plain",
+					"size": 5,
+					"upload_status": "pending",
+					"md5": "5d41402abc4b2a76b9719d911017c592"
+				}
+			}`)
+		})
+
+		Convey("verifies pending asset uploaded to store", func() {
+			store.files["pending.txt"] = "hello"
+
+			res := r.POST(`{"name": "pending.txt"}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "pending.txt",
+					"content_type": "text/plain",
+					"size": 5,
+					"upload_status": "completed",
+					"md5": "5d41402abc4b2a76b9719d911017c592",
+					"sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+				}
+			}`)
+			So(conn.savedAsset["pending.txt"].UploadStatus, ShouldEqual, skydb.AssetUploadCompleted)
+		})
+
+		Convey("reports corrupted pending asset", func() {
+			store.files["pending.txt"] = "hell"
+
+			res := r.POST(`{"name": "pending.txt"}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(conn.savedAsset["pending.txt"].UploadStatus, ShouldEqual, skydb.AssetUploadCorrupted)
+		})
+
+		Convey("errors with asset not found", func() {
+			res := r.POST(`{"name": "notexist.txt"}`)
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
 	})
 }
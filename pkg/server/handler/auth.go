@@ -16,11 +16,16 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
+	"github.com/skygeario/skygear-server/pkg/server/geoip"
+	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -80,6 +85,9 @@ func (payload *signupPayload) IsAnonymous() bool {
 // response.Result if the supplied username or email collides with an existing
 // username.
 //
+// If CAPTCHA is configured, clients making many signup attempts have to
+// supply a solved CAPTCHA in captcha_token.
+//
 //  curl -X POST -H "Content-Type: application/json" \
 //    -d @- http://localhost:3000/ <<EOF
 //  {
@@ -90,21 +98,25 @@ func (payload *signupPayload) IsAnonymous() bool {
 //  }
 //  EOF
 type SignupHandler struct {
-	TokenStore       authtoken.Store    `inject:"TokenStore"`
-	ProviderRegistry *provider.Registry `inject:"ProviderRegistry"`
-	HookRegistry     *hook.Registry     `inject:"HookRegistry"`
-	AssetStore       asset.Store        `inject:"AssetStore"`
-	AccessModel      skydb.AccessModel  `inject:"AccessModel"`
-	AccessKey        router.Processor   `preprocessor:"accesskey"`
-	DBConn           router.Processor   `preprocessor:"dbconn"`
-	InjectPublicDB   router.Processor   `preprocessor:"inject_public_db"`
-	PluginReady      router.Processor   `preprocessor:"plugin_ready"`
+	TokenStore       authtoken.Store     `inject:"TokenStore"`
+	FieldFilter      *fieldfilter.Filter `inject:"FieldFilter"`
+	ProviderRegistry *provider.Registry  `inject:"ProviderRegistry"`
+	HookRegistry     *hook.Registry      `inject:"HookRegistry"`
+	AssetStore       asset.Store         `inject:"AssetStore"`
+	AccessModel      skydb.AccessModel   `inject:"AccessModel"`
+	GeoIP            *geoip.Resolver     `inject:"GeoIPResolver"`
+	AccessKey        router.Processor    `preprocessor:"accesskey"`
+	Captcha          router.Processor    `preprocessor:"captcha"`
+	DBConn           router.Processor    `preprocessor:"dbconn"`
+	InjectPublicDB   router.Processor    `preprocessor:"inject_public_db"`
+	PluginReady      router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors    []router.Processor
 }
 
 func (h *SignupHandler) Setup() {
 	h.preprocessors = []router.Processor{
 		h.AccessKey,
+		h.Captcha,
 		h.DBConn,
 		h.InjectPublicDB,
 		h.PluginReady,
@@ -115,7 +127,7 @@ func (h *SignupHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SignupHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *SignupHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &signupPayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -136,7 +148,7 @@ func (h *SignupHandler) Handle(payload *router.Payload, response *router.Respons
 			response.Err = skyerr.NewInvalidArgument(err.Error(), []string{"provider"})
 			return
 		}
-		principalID, authData, err := authProvider.Login(payload.Context, p.AuthData)
+		principalID, authData, err := authProvider.Login(ctx, p.AuthData)
 		if err != nil {
 			response.Err = skyerr.NewError(skyerr.InvalidCredentials, "unable to login with the given credentials")
 			return
@@ -151,7 +163,7 @@ func (h *SignupHandler) Handle(payload *router.Payload, response *router.Respons
 
 	// Populate the default roles to user
 	if h.AccessModel == skydb.RoleBasedAccess {
-		defaultRoles, err := payload.DBConn.GetDefaultRoles()
+		defaultRoles, err := payload.DBConn.GetDefaultRoles(ctx)
 		if err != nil {
 			response.Err = skyerr.NewError(skyerr.InternalQueryInvalid, "unable to query default roles")
 			return
@@ -163,9 +175,10 @@ func (h *SignupHandler) Handle(payload *router.Payload, response *router.Respons
 	now := timeNowUTC()
 	info.LastLoginAt = &now
 	info.LastSeenAt = &now
+	info.LastLoginLocation = h.GeoIP.Resolve(payload.Req)
 
 	createContext := createUserWithRecordContext{
-		payload.DBConn, payload.Database, h.AssetStore, h.HookRegistry, payload.Context,
+		payload.DBConn, payload.Database, h.AssetStore, h.HookRegistry, ctx,
 	}
 	if response.Err = createContext.execute(&info); response.Err != nil {
 		return
@@ -181,7 +194,7 @@ func (h *SignupHandler) Handle(payload *router.Payload, response *router.Respons
 		panic(err)
 	}
 
-	response.Result = NewAuthResponse(info, token.AccessToken)
+	setUserResult(h.FieldFilter, payload, response, NewAuthResponse(info, token.AccessToken))
 }
 
 type loginPayload struct {
@@ -219,14 +232,17 @@ curl -X POST -H "Content-Type: application/json" \
 EOF
 */
 type LoginHandler struct {
-	TokenStore       authtoken.Store    `inject:"TokenStore"`
-	ProviderRegistry *provider.Registry `inject:"ProviderRegistry"`
-	HookRegistry     *hook.Registry     `inject:"HookRegistry"`
-	AssetStore       asset.Store        `inject:"AssetStore"`
-	AccessKey        router.Processor   `preprocessor:"accesskey"`
-	DBConn           router.Processor   `preprocessor:"dbconn"`
-	InjectPublicDB   router.Processor   `preprocessor:"inject_public_db"`
-	PluginReady      router.Processor   `preprocessor:"plugin_ready"`
+	TokenStore       authtoken.Store     `inject:"TokenStore"`
+	FieldFilter      *fieldfilter.Filter `inject:"FieldFilter"`
+	ProviderRegistry *provider.Registry  `inject:"ProviderRegistry"`
+	HookRegistry     *hook.Registry      `inject:"HookRegistry"`
+	AssetStore       asset.Store         `inject:"AssetStore"`
+	GeoIP            *geoip.Resolver     `inject:"GeoIPResolver"`
+	EventSender      pluginEvent.Sender  `inject:"PluginEventSender"`
+	AccessKey        router.Processor    `preprocessor:"accesskey"`
+	DBConn           router.Processor    `preprocessor:"dbconn"`
+	InjectPublicDB   router.Processor    `preprocessor:"inject_public_db"`
+	PluginReady      router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors    []router.Processor
 }
 
@@ -243,7 +259,7 @@ func (h *LoginHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *LoginHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *LoginHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &loginPayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -260,12 +276,12 @@ func (h *LoginHandler) Handle(payload *router.Payload, response *router.Response
 
 	if p.Provider != "" {
 		// Get AuthProvider and authenticates the user
-		principalID, authData, skyErr := h.authPrincipal(payload.Context, p)
+		principalID, authData, skyErr := h.authPrincipal(ctx, p)
 		if skyErr != nil {
 			response.Err = skyErr
 			return
 		}
-		if err := payload.DBConn.GetUserByPrincipalID(principalID, &info); err != nil {
+		if err := payload.DBConn.GetUserByPrincipalID(ctx, principalID, &info); err != nil {
 			// Create user if and only if no user found with the same principal
 			if err != skydb.ErrUserNotFound {
 				// TODO: more error handling here if necessary
@@ -275,20 +291,20 @@ func (h *LoginHandler) Handle(payload *router.Payload, response *router.Response
 
 			info = skydb.NewProvidedAuthUserInfo(principalID, authData)
 			createContext := createUserWithRecordContext{
-				payload.DBConn, payload.Database, h.AssetStore, h.HookRegistry, payload.Context,
+				payload.DBConn, payload.Database, h.AssetStore, h.HookRegistry, ctx,
 			}
 			if response.Err = createContext.execute(&info); response.Err != nil {
 				return
 			}
 		} else {
 			info.SetProvidedAuthData(principalID, authData)
-			if err := payload.DBConn.UpdateUser(&info); err != nil {
+			if err := payload.DBConn.UpdateUser(ctx, &info); err != nil {
 				response.Err = skyerr.MakeError(err)
 				return
 			}
 		}
 	} else {
-		if err := payload.DBConn.GetUserByUsernameEmail(p.Username, p.Email, &info); err != nil {
+		if err := payload.DBConn.GetUserByUsernameEmail(ctx, p.Username, p.Email, &info); err != nil {
 			if err == skydb.ErrUserNotFound {
 				response.Err = skyerr.NewError(skyerr.ResourceNotFound, "user not found")
 			} else {
@@ -319,11 +335,45 @@ func (h *LoginHandler) Handle(payload *router.Payload, response *router.Response
 	now := timeNow()
 	info.LastLoginAt = &now
 	info.LastSeenAt = &now
-	if err := payload.DBConn.UpdateUser(&info); err != nil {
+	previousLocation := info.LastLoginLocation
+	if location := h.GeoIP.Resolve(payload.Req); location != nil {
+		info.LastLoginLocation = location
+	}
+	if err := payload.DBConn.UpdateUser(ctx, &info); err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
-	response.Result = authResponse
+	if h.GeoIP.Enabled() && h.EventSender != nil {
+		sendLoginEvent(h.EventSender, info, previousLocation)
+	}
+	setUserResult(h.FieldFilter, payload, response, authResponse)
+}
+
+type loginEvent struct {
+	UserID           string               `json:"user_id"`
+	Location         *skydb.LoginLocation `json:"location"`
+	PreviousLocation *skydb.LoginLocation `json:"previous_location"`
+	NewLocation      bool                 `json:"new_location"`
+}
+
+// sendLoginEvent notifies plugins of a login with the location of the
+// client, so that plugins can alert the user on a login from a new
+// location. The first located login of a user is not a new location.
+func sendLoginEvent(sender pluginEvent.Sender, info skydb.UserInfo, previousLocation *skydb.LoginLocation) {
+	location := info.LastLoginLocation
+	event := loginEvent{
+		UserID:           info.ID,
+		Location:         location,
+		PreviousLocation: previousLocation,
+		NewLocation:      location != nil && previousLocation != nil && !location.SameArea(previousLocation),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.WithField("err", err).Error("Unable to encode login event")
+		return
+	}
+	sender.Send("login", data, true)
 }
 
 func (h *LoginHandler) authPrincipal(ctx context.Context, p *loginPayload) (string, map[string]interface{}, skyerr.Error) {
@@ -361,7 +411,7 @@ func (h *LogoutHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *LogoutHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *LogoutHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	store := h.TokenStore
 	accessToken := payload.AccessTokenString()
 
@@ -383,11 +433,120 @@ func (h *LogoutHandler) Handle(payload *router.Payload, response *router.Respons
 	}
 }
 
+/*
+RefreshHandler exchanges the access token of the request for a new one
+and invalidates the old token, so that a client can keep a session
+without logging in again when tokens expire.
+
+If RefreshWindow is set, only a token expiring within the window is
+exchanged. An earlier request is answered with the current token.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "auth:refresh",
+    "access_token": "ACCESS_TOKEN"
+}
+EOF
+
+{
+    "result": {
+        "user_id": "3df4b52b-bd58-4fa2-8aee-3d44fd7f974d",
+        "username": "user1",
+        "access_token": "NEW_ACCESS_TOKEN",
+        "expired_at": "2017-03-02T10:00:00Z"
+    }
+}
+*/
+type RefreshHandler struct {
+	TokenStore    authtoken.Store     `inject:"TokenStore"`
+	FieldFilter   *fieldfilter.Filter `inject:"FieldFilter"`
+	RefreshWindow time.Duration
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RefreshHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RefreshHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RefreshHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	info := payload.UserInfo
+	if info == nil {
+		response.Err = skyerr.NewError(skyerr.NotAuthenticated, "Authentication is needed to refresh access token")
+		return
+	}
+
+	store := h.TokenStore
+	accessToken := payload.AccessTokenString()
+
+	current := authtoken.Token{}
+	if err := store.Get(accessToken, &current); err != nil {
+		if _, notfound := err.(*authtoken.NotFoundError); notfound {
+			response.Err = skyerr.NewError(skyerr.AccessTokenNotAccepted, "token does not exist or it has expired")
+		} else {
+			response.Err = skyerr.MakeError(err)
+		}
+		return
+	}
+
+	if h.RefreshWindow > 0 && !current.ExpiredAt.IsZero() && timeNow().Add(h.RefreshWindow).Before(current.ExpiredAt) {
+		setUserResult(h.FieldFilter, payload, response, newRefreshResponse(*info, current))
+		return
+	}
+
+	token, err := store.NewToken(payload.AppName, info.ID)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if err := store.Put(&token); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	if err := store.Delete(accessToken); err != nil {
+		if _, notfound := err.(*authtoken.NotFoundError); !notfound {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+	}
+
+	setUserResult(h.FieldFilter, payload, response, newRefreshResponse(*info, token))
+}
+
+type refreshResponse struct {
+	AuthResponse
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+}
+
+func newRefreshResponse(info skydb.UserInfo, token authtoken.Token) refreshResponse {
+	resp := refreshResponse{
+		AuthResponse: NewAuthResponse(info, token.AccessToken),
+	}
+	if !token.ExpiredAt.IsZero() {
+		expiredAt := token.ExpiredAt.UTC()
+		resp.ExpiredAt = &expiredAt
+	}
+	return resp
+}
+
 // Define the playload that change password handler will process
 type passwordPayload struct {
 	OldPassword string `mapstructure:"old_password"`
 	NewPassword string `mapstructure:"password"`
-	Invalidate  bool   `mapstructure:"invalidate"`
 }
 
 func (payload *passwordPayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -398,6 +557,9 @@ func (payload *passwordPayload) Decode(data map[string]interface{}) skyerr.Error
 }
 
 func (payload *passwordPayload) Validate() skyerr.Error {
+	if payload.NewPassword == "" {
+		return skyerr.NewInvalidArgument("empty password", []string{"password"})
+	}
 	return nil
 }
 
@@ -410,6 +572,10 @@ func (payload *passwordPayload) Validate() skyerr.Error {
 //
 // If user is not logged in, an 404 not found will return.
 //
+// Changing the password invalidates all access tokens issued before the
+// change through UserInfo.TokenValidSince. A new access token is returned
+// so that the current session can continue.
+//
 //  Current implementation
 //  curl -X POST -H "Content-Type: application/json" \
 //    -d @- http://localhost:3000/ <<EOF
@@ -420,13 +586,7 @@ func (payload *passwordPayload) Validate() skyerr.Error {
 //  }
 //  EOF
 // Response
-// return existing access toektn if not invalidate
-//
-// TODO:
-// Input accept `user_id` and `invalidate`.
-// If `user_id` is supplied, will check authorization policy and see if existing
-// accept `invalidate` and invaldate all existing access token.
-// Return userInfoID with new AccessToken if the invalidate is true
+// return user ID and the new access token
 type PasswordHandler struct {
 	TokenStore    authtoken.Store  `inject:"TokenStore"`
 	Authenticator router.Processor `preprocessor:"authenticator"`
@@ -451,7 +611,7 @@ func (h *PasswordHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *PasswordHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *PasswordHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	log.Debugf("changing password")
 	p := &passwordPayload{}
 	skyErr := p.Decode(payload.Data)
@@ -461,7 +621,7 @@ func (h *PasswordHandler) Handle(payload *router.Payload, response *router.Respo
 	}
 
 	info := skydb.UserInfo{}
-	if err := payload.DBConn.GetUser(payload.UserInfoID, &info); err != nil {
+	if err := payload.DBConn.GetUser(ctx, payload.UserInfoID, &info); err != nil {
 		if err == skydb.ErrUserNotFound {
 			response.Err = skyerr.NewError(skyerr.ResourceNotFound, "user not found")
 		} else {
@@ -477,15 +637,11 @@ func (h *PasswordHandler) Handle(payload *router.Payload, response *router.Respo
 		return
 	}
 	info.SetPassword(p.NewPassword)
-	if err := payload.DBConn.UpdateUser(&info); err != nil {
+	if err := payload.DBConn.UpdateUser(ctx, &info); err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
 
-	if p.Invalidate {
-		log.Warningf("Invalidate is not yet implement")
-		// TODO: invalidate all existing token and generate a new one for response
-	}
 	// Generate new access-token. Because InjectUserIfPresent preprocessor
 	// will expire existing access-token.
 	store := h.TokenStore
@@ -520,8 +676,8 @@ func (ctx *createUserWithRecordContext) execute(info *skydb.UserInfo) skyerr.Err
 		return skyerr.NewError(skyerr.NotSupported, "database impl does not support transaction")
 	}
 
-	txErr := withTransaction(txDB, func() error {
-		if err := ctx.DBConn.CreateUser(info); err != nil {
+	txErr := withTransaction(ctx.Context, txDB, func() error {
+		if err := ctx.DBConn.CreateUser(ctx.Context, info); err != nil {
 			if err == skydb.ErrUserDuplicated {
 				return errUserDuplicated
 			}
@@ -15,16 +15,20 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
 	"github.com/skygeario/skygear-server/pkg/server/authtoken/authtokentest"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
+	"github.com/skygeario/skygear-server/pkg/server/geoip"
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -67,7 +71,7 @@ func TestSignupHandler(t *testing.T) {
 			handler := &SignupHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(txdb.DidBegin, ShouldBeTrue)
 			So(txdb.DidCommit, ShouldBeTrue)
@@ -84,7 +88,7 @@ func TestSignupHandler(t *testing.T) {
 			So(token.AccessToken, ShouldNotBeEmpty)
 
 			userinfo := &skydb.UserInfo{}
-			err := conn.GetUserByUsernameEmail("john.doe", "", userinfo)
+			err := conn.GetUserByUsernameEmail(context.Background(), "john.doe", "", userinfo)
 			So(err, ShouldBeNil)
 			So(userinfo.Roles, ShouldBeNil)
 
@@ -107,17 +111,17 @@ func TestSignupHandler(t *testing.T) {
 				TokenStore:  &tokenStore,
 				AccessModel: skydb.RoleBasedAccess,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			userinfo := &skydb.UserInfo{}
-			err := conn.GetUserByUsernameEmail("john.doe", "", userinfo)
+			err := conn.GetUserByUsernameEmail(context.Background(), "john.doe", "", userinfo)
 			So(err, ShouldBeNil)
 			So(userinfo.Roles, ShouldResemble, []string{"user"})
 		})
 
 		Convey("sign up duplicate username", func() {
 			userinfo := skydb.NewUserInfo("john.doe", "", "secret")
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -132,7 +136,7 @@ func TestSignupHandler(t *testing.T) {
 			handler := &SignupHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Err, ShouldImplement, (*skyerr.Error)(nil))
 			errorResponse := resp.Err.(skyerr.Error)
@@ -141,7 +145,7 @@ func TestSignupHandler(t *testing.T) {
 
 		Convey("sign up duplicate email", func() {
 			userinfo := skydb.NewUserInfo("", "john.doe@example.com", "secret")
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -156,7 +160,7 @@ func TestSignupHandler(t *testing.T) {
 			handler := &SignupHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Err, ShouldImplement, (*skyerr.Error)(nil))
 			errorResponse := resp.Err.(skyerr.Error)
@@ -165,6 +169,22 @@ func TestSignupHandler(t *testing.T) {
 	})
 }
 
+type staticLookuper skydb.LoginLocation
+
+func (l staticLookuper) Lookup(ip net.IP) (skydb.LoginLocation, error) {
+	return skydb.LoginLocation(l), nil
+}
+
+type recordingEventSender struct {
+	names []string
+	data  [][]byte
+}
+
+func (s *recordingEventSender) Send(name string, data []byte, async bool) {
+	s.names = append(s.names, name)
+	s.data = append(s.data, data)
+}
+
 func TestLoginHandler(t *testing.T) {
 	Convey("LoginHandler", t, func() {
 		conn := skydbtest.NewMapConn()
@@ -178,7 +198,7 @@ func TestLoginHandler(t *testing.T) {
 				"Programmer",
 				"Tester",
 			}
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -192,7 +212,7 @@ func TestLoginHandler(t *testing.T) {
 			handler := &LoginHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Result, ShouldHaveSameTypeAs, AuthResponse{})
 
@@ -208,9 +228,71 @@ func TestLoginHandler(t *testing.T) {
 			So(token.AccessToken, ShouldNotBeEmpty)
 		})
 
+		Convey("login user with location", func() {
+			previousLocation := &skydb.LoginLocation{
+				IP:          "198.51.100.1",
+				CountryCode: "TW",
+				Country:     "Taiwan",
+			}
+			userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
+			userinfo.LastLoginLocation = previousLocation
+			conn.CreateUser(context.Background(), &userinfo)
+
+			httpReq, _ := http.NewRequest("POST", "/", nil)
+			httpReq.RemoteAddr = "203.0.113.1:54321"
+			req := router.Payload{
+				Req: httpReq,
+				Data: map[string]interface{}{
+					"username": "john.doe",
+					"password": "secret",
+				},
+				DBConn:   conn,
+				Database: txdb,
+			}
+			resp := router.Response{}
+			sender := &recordingEventSender{}
+			handler := &LoginHandler{
+				TokenStore: &tokenStore,
+				GeoIP: &geoip.Resolver{
+					Lookuper: staticLookuper{
+						CountryCode: "HK",
+						Country:     "Hong Kong",
+					},
+				},
+				EventSender: sender,
+			}
+			handler.Handle(context.Background(), &req, &resp)
+			So(resp.Err, ShouldBeNil)
+
+			location := &skydb.LoginLocation{
+				IP:          "203.0.113.1",
+				CountryCode: "HK",
+				Country:     "Hong Kong",
+			}
+			savedUser := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), userinfo.ID, &savedUser), ShouldBeNil)
+			So(savedUser.LastLoginLocation, ShouldResemble, location)
+
+			So(sender.names, ShouldResemble, []string{"login"})
+			So(sender.data[0], ShouldEqualJSON, fmt.Sprintf(`{
+				"user_id": "%s",
+				"location": {
+					"ip": "203.0.113.1",
+					"country_code": "HK",
+					"country": "Hong Kong"
+				},
+				"previous_location": {
+					"ip": "198.51.100.1",
+					"country_code": "TW",
+					"country": "Taiwan"
+				},
+				"new_location": true
+			}`, userinfo.ID))
+		})
+
 		Convey("login user with username in different case should ok", func() {
 			userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -224,7 +306,7 @@ func TestLoginHandler(t *testing.T) {
 			handler := &LoginHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Result, ShouldHaveSameTypeAs, AuthResponse{})
 			authResp := resp.Result.(AuthResponse)
@@ -238,7 +320,7 @@ func TestLoginHandler(t *testing.T) {
 
 		Convey("login user with email in different case should ok", func() {
 			userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -252,7 +334,7 @@ func TestLoginHandler(t *testing.T) {
 			handler := &LoginHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Result, ShouldHaveSameTypeAs, AuthResponse{})
 			authResp := resp.Result.(AuthResponse)
@@ -265,7 +347,7 @@ func TestLoginHandler(t *testing.T) {
 		})
 		Convey("login user wrong password", func() {
 			userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
-			conn.CreateUser(&userinfo)
+			conn.CreateUser(context.Background(), &userinfo)
 
 			req := router.Payload{
 				Data: map[string]interface{}{
@@ -279,7 +361,7 @@ func TestLoginHandler(t *testing.T) {
 			handler := &LoginHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Err, ShouldImplement, (*skyerr.Error)(nil))
 			errorResponse := resp.Err.(skyerr.Error)
@@ -299,7 +381,7 @@ func TestLoginHandler(t *testing.T) {
 			handler := &LoginHandler{
 				TokenStore: &tokenStore,
 			}
-			handler.Handle(&req, &resp)
+			handler.Handle(context.Background(), &req, &resp)
 
 			So(resp.Err, ShouldImplement, (*skyerr.Error)(nil))
 			errorResponse := resp.Err.(skyerr.Error)
@@ -411,7 +493,7 @@ type singleUserConn struct {
 	skydb.Conn
 }
 
-func (conn *singleUserConn) UpdateUser(userinfo *skydb.UserInfo) error {
+func (conn *singleUserConn) UpdateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
 	if conn.userinfo != nil && conn.userinfo.ID == userinfo.ID {
 		conn.userinfo = userinfo
 		return nil
@@ -419,7 +501,7 @@ func (conn *singleUserConn) UpdateUser(userinfo *skydb.UserInfo) error {
 	return skydb.ErrUserNotFound
 }
 
-func (conn *singleUserConn) CreateUser(userinfo *skydb.UserInfo) error {
+func (conn *singleUserConn) CreateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
 	if conn.userinfo == nil {
 		conn.userinfo = userinfo
 		return nil
@@ -427,7 +509,7 @@ func (conn *singleUserConn) CreateUser(userinfo *skydb.UserInfo) error {
 	return skydb.ErrUserDuplicated
 }
 
-func (conn *singleUserConn) GetUser(id string, userinfo *skydb.UserInfo) error {
+func (conn *singleUserConn) GetUser(ctx context.Context, id string, userinfo *skydb.UserInfo) error {
 	if conn.userinfo != nil {
 		*userinfo = *conn.userinfo
 		return nil
@@ -435,7 +517,7 @@ func (conn *singleUserConn) GetUser(id string, userinfo *skydb.UserInfo) error {
 	return skydb.ErrUserNotFound
 }
 
-func (conn *singleUserConn) GetUserByPrincipalID(principalID string, userinfo *skydb.UserInfo) error {
+func (conn *singleUserConn) GetUserByPrincipalID(ctx context.Context, principalID string, userinfo *skydb.UserInfo) error {
 	if conn.userinfo != nil {
 		*userinfo = *conn.userinfo
 		return nil
@@ -443,7 +525,7 @@ func (conn *singleUserConn) GetUserByPrincipalID(principalID string, userinfo *s
 	return skydb.ErrUserNotFound
 }
 
-func (conn *singleUserConn) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
+func (conn *singleUserConn) GetRecordAccess(ctx context.Context, recordType string) (skydb.RecordACL, error) {
 	return skydb.NewRecordACL([]skydb.RecordACLEntry{}), nil
 }
 
@@ -677,12 +759,127 @@ func TestLogoutHandler(t *testing.T) {
 	})
 }
 
+// expiringTokenStore keeps tokens in a map, issuing tokens that expire
+// after expiry.
+type expiringTokenStore struct {
+	expiry time.Duration
+	tokens map[string]authtoken.Token
+}
+
+func (store *expiringTokenStore) NewToken(appName string, userInfoID string) (authtoken.Token, error) {
+	return authtoken.New(appName, userInfoID, time.Now().Add(store.expiry)), nil
+}
+
+func (store *expiringTokenStore) Get(accessToken string, token *authtoken.Token) error {
+	t, ok := store.tokens[accessToken]
+	if !ok {
+		return &authtoken.NotFoundError{AccessToken: accessToken, Err: errors.New("not found")}
+	}
+	*token = t
+	return nil
+}
+
+func (store *expiringTokenStore) Put(token *authtoken.Token) error {
+	store.tokens[token.AccessToken] = *token
+	return nil
+}
+
+func (store *expiringTokenStore) Delete(accessToken string) error {
+	delete(store.tokens, accessToken)
+	return nil
+}
+
+func TestRefreshHandler(t *testing.T) {
+	Convey("RefreshHandler", t, func() {
+		userinfo := skydb.UserInfo{
+			ID:       "tester-1",
+			Username: "tester1",
+		}
+		tokenStore := &expiringTokenStore{
+			expiry: time.Hour,
+			tokens: map[string]authtoken.Token{},
+		}
+		oldToken := authtoken.New("app", "tester-1", time.Now().Add(10*time.Minute))
+		tokenStore.Put(&oldToken)
+
+		handler := &RefreshHandler{
+			TokenStore: tokenStore,
+		}
+		r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+			p.UserInfo = &userinfo
+		})
+
+		refresh := func() map[string]interface{} {
+			resp := r.POST(fmt.Sprintf(`{"access_token": "%s"}`, oldToken.AccessToken))
+			So(resp.Code, ShouldEqual, http.StatusOK)
+
+			result := struct {
+				Result map[string]interface{} `json:"result"`
+			}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			return result.Result
+		}
+
+		Convey("exchanges token for a new one", func() {
+			result := refresh()
+			accessToken := result["access_token"].(string)
+			So(accessToken, ShouldNotEqual, oldToken.AccessToken)
+			So(result["user_id"], ShouldEqual, "tester-1")
+			So(result["expired_at"], ShouldNotBeEmpty)
+
+			So(tokenStore.tokens, ShouldContainKey, accessToken)
+			So(tokenStore.tokens, ShouldNotContainKey, oldToken.AccessToken)
+		})
+
+		Convey("exchanges token expiring within refresh window", func() {
+			handler.RefreshWindow = 15 * time.Minute
+			result := refresh()
+			So(result["access_token"], ShouldNotEqual, oldToken.AccessToken)
+		})
+
+		Convey("keeps token not expiring within refresh window", func() {
+			handler.RefreshWindow = 5 * time.Minute
+			result := refresh()
+			So(result["access_token"], ShouldEqual, oldToken.AccessToken)
+			So(tokenStore.tokens, ShouldHaveLength, 1)
+		})
+
+		Convey("hides filtered user fields", func() {
+			userinfo.Email = "tester1@example.com"
+			handler.FieldFilter = &fieldfilter.Filter{
+				UserFields: []string{"email"},
+			}
+			result := refresh()
+			So(result["user_id"], ShouldEqual, "tester-1")
+			So(result["username"], ShouldEqual, "tester1")
+			So(result, ShouldNotContainKey, "email")
+		})
+
+		Convey("rejects token not in store", func() {
+			resp := r.POST(`{"access_token": "unknown"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+	"error": {
+		"code": 104,
+		"name": "AccessTokenNotAccepted",
+		"message": "token does not exist or it has expired"
+	}
+}`)
+		})
+
+		Convey("requires user", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {})
+			resp := r.POST(fmt.Sprintf(`{"access_token": "%s"}`, oldToken.AccessToken))
+			So(resp.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
+
 func TestPasswordHandlerWithProvider(t *testing.T) {
 	Convey("PasswordHandler", t, func() {
 		conn := singleUserConn{}
 		userinfo := skydb.NewUserInfo("lord-of-skygear", "limouren@skygear.io", "chima")
 		userinfo.ID = "user-uuid"
-		conn.CreateUser(&userinfo)
+		conn.CreateUser(context.Background(), &userinfo)
 		tokenStore := authtokentest.SingleTokenStore{}
 		token := authtoken.New("_", userinfo.ID, time.Time{})
 		tokenStore.Put(&token)
@@ -709,7 +906,29 @@ func TestPasswordHandlerWithProvider(t *testing.T) {
 	}
 }`, tokenStore.Token.AccessToken))
 			So(resp.Code, ShouldEqual, 200)
+			So(conn.userinfo.IsSamePassword("faseng"), ShouldBeTrue)
 		})
 
+		Convey("reject incorrect old password", func() {
+			resp := r.POST(fmt.Sprintf(`{
+	"access_token": "%s",
+	"old_password": "wrong",
+	"password": "faseng"
+}`, token.AccessToken))
+
+			So(resp.Code, ShouldEqual, 401)
+			So(conn.userinfo.IsSamePassword("chima"), ShouldBeTrue)
+		})
+
+		Convey("reject empty password", func() {
+			resp := r.POST(fmt.Sprintf(`{
+	"access_token": "%s",
+	"old_password": "chima",
+	"password": ""
+}`, token.AccessToken))
+
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.userinfo.IsSamePassword("chima"), ShouldBeTrue)
+		})
 	})
 }
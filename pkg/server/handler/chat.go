@@ -0,0 +1,656 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/chat"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// chatDefaultMessageLimit is the number of messages fetched if the limit
+// is not specified.
+const chatDefaultMessageLimit = 50
+
+type chatConversationPayload struct {
+	ConversationID string   `mapstructure:"conversation_id"`
+	ParticipantIDs []string `mapstructure:"participant_ids"`
+	Title          string   `mapstructure:"title"`
+}
+
+func (payload *chatConversationPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return nil
+}
+
+// chatError converts an error of the chat module to skyerr.Error.
+func chatError(err error) skyerr.Error {
+	switch err {
+	case chat.ErrNotParticipant:
+		return skyerr.NewError(skyerr.PermissionDenied, "user is not a participant of the conversation")
+	case skydb.ErrRecordNotFound:
+		return skyerr.NewError(skyerr.ResourceNotFound, "conversation not found")
+	}
+	return skyerr.MakeError(err)
+}
+
+/*
+ChatCreateConversationHandler creates a conversation between the current
+user and the participants. The current user becomes the admin of the
+conversation.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:create_conversation",
+    "access_token": "ACCESS_TOKEN",
+    "participant_ids": ["bob"],
+    "title": "Lunch"
+}
+EOF
+*/
+type ChatCreateConversationHandler struct {
+	Notifier      *chat.Notifier   `inject:"ChatNotifier"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatCreateConversationHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatCreateConversationHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatCreateConversationHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "participant_ids", Type: router.ArrayField, Elem: router.StringField, Required: true},
+		{Name: "title", Type: router.StringField},
+	}
+}
+
+func (h *ChatCreateConversationHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatConversationPayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+
+	conversation, err := chat.CreateConversation(ctx,
+		rpayload.DBConn.PublicDB(),
+		rpayload.UserInfoID,
+		payload.ParticipantIDs,
+		payload.Title,
+	)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	h.Notifier.Notify(chat.ParticipantIDs(conversation), chat.NewRecordEvent(chat.EventCreate, conversation))
+	response.Result = (*skyconv.JSONRecord)(conversation)
+}
+
+type chatConversationResult struct {
+	Conversation *skyconv.JSONRecord `json:"conversation"`
+	UnreadCount  int64               `json:"unread_count"`
+	LastReadAt   *time.Time          `json:"last_read_at,omitempty"`
+}
+
+/*
+ChatGetConversationsHandler returns the conversations of the current user
+with unread counts, most recently updated first.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:get_conversations",
+    "access_token": "ACCESS_TOKEN"
+}
+EOF
+*/
+type ChatGetConversationsHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatGetConversationsHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatGetConversationsHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatGetConversationsHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	db := rpayload.DBConn.PublicDB()
+	userConversations, err := chat.UserConversations(ctx, db, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	results := []chatConversationResult{}
+	for i := range userConversations {
+		userConversation := &userConversations[i]
+		ref, ok := userConversation.Get("conversation").(skydb.Reference)
+		if !ok {
+			continue
+		}
+
+		conversation := skydb.Record{}
+		if err := db.Get(ctx, ref.ID, &conversation); err != nil {
+			if err == skydb.ErrRecordNotFound {
+				continue
+			}
+			response.Err = chatError(err)
+			return
+		}
+
+		result := chatConversationResult{
+			Conversation: (*skyconv.JSONRecord)(&conversation),
+			UnreadCount:  chat.UnreadCount(userConversation),
+		}
+		if lastReadAt, ok := userConversation.Get("last_read_at").(time.Time); ok {
+			result.LastReadAt = &lastReadAt
+		}
+		results = append(results, result)
+	}
+	response.Result = results
+}
+
+/*
+ChatAddParticipantsHandler adds participants to a conversation. Only
+admins of the conversation can add participants.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:add_participants",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID",
+    "participant_ids": ["carol"]
+}
+EOF
+*/
+type ChatAddParticipantsHandler struct {
+	Notifier      *chat.Notifier   `inject:"ChatNotifier"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatAddParticipantsHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatAddParticipantsHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatAddParticipantsHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+		{Name: "participant_ids", Type: router.ArrayField, Elem: router.StringField, Required: true},
+	}
+}
+
+func (h *ChatAddParticipantsHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatConversationPayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+
+	db := rpayload.DBConn.PublicDB()
+	conversation, err := chat.GetConversation(ctx, db, payload.ConversationID, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+	if !chat.IsAdmin(conversation, rpayload.UserInfoID) {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "only admins can add participants")
+		return
+	}
+
+	if err := chat.AddParticipants(ctx, db, conversation, payload.ParticipantIDs, rpayload.UserInfoID); err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	h.Notifier.Notify(chat.ParticipantIDs(conversation), chat.NewRecordEvent(chat.EventUpdate, conversation))
+	response.Result = (*skyconv.JSONRecord)(conversation)
+}
+
+/*
+ChatRemoveParticipantsHandler removes participants from a conversation.
+Admins of the conversation can remove any participants, while other
+participants can only remove themselves to leave the conversation.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:remove_participants",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID",
+    "participant_ids": ["carol"]
+}
+EOF
+*/
+type ChatRemoveParticipantsHandler struct {
+	Notifier      *chat.Notifier   `inject:"ChatNotifier"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatRemoveParticipantsHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatRemoveParticipantsHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatRemoveParticipantsHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+		{Name: "participant_ids", Type: router.ArrayField, Elem: router.StringField, Required: true},
+	}
+}
+
+func (h *ChatRemoveParticipantsHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatConversationPayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+
+	db := rpayload.DBConn.PublicDB()
+	conversation, err := chat.GetConversation(ctx, db, payload.ConversationID, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+	if !chat.IsAdmin(conversation, rpayload.UserInfoID) {
+		for _, userID := range payload.ParticipantIDs {
+			if userID != rpayload.UserInfoID {
+				response.Err = skyerr.NewError(skyerr.PermissionDenied, "only admins can remove other participants")
+				return
+			}
+		}
+	}
+
+	// removed participants are notified as well
+	notifiedIDs := chat.ParticipantIDs(conversation)
+	if err := chat.RemoveParticipants(ctx, db, conversation, payload.ParticipantIDs, rpayload.UserInfoID); err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	h.Notifier.Notify(notifiedIDs, chat.NewRecordEvent(chat.EventUpdate, conversation))
+	response.Result = (*skyconv.JSONRecord)(conversation)
+}
+
+type chatMessagePayload struct {
+	ConversationID string
+	Body           string
+	Metadata       map[string]interface{}
+	Limit          uint64
+	Before         time.Time
+}
+
+func (payload *chatMessagePayload) Decode(data map[string]interface{}) skyerr.Error {
+	payload.ConversationID, _ = data["conversation_id"].(string)
+	payload.Body, _ = data["body"].(string)
+	payload.Metadata, _ = data["metadata"].(map[string]interface{})
+
+	payload.Limit = chatDefaultMessageLimit
+	if limit, ok := data["limit"].(float64); ok {
+		if limit < 1 {
+			return skyerr.NewInvalidArgument("limit must be positive", []string{"limit"})
+		}
+		payload.Limit = uint64(limit)
+	}
+
+	if before, ok := data["before"].(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			return skyerr.NewInvalidArgument("before must be a datetime in RFC 3339", []string{"before"})
+		}
+		payload.Before = t
+	}
+	return nil
+}
+
+/*
+ChatSendMessageHandler sends a message to a conversation. The unread
+counts of other participants are incremented and the message is published
+to the pubsub channel of each participant.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:send_message",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID",
+    "body": "Hello",
+    "metadata": {"mood": "happy"}
+}
+EOF
+*/
+type ChatSendMessageHandler struct {
+	Notifier      *chat.Notifier   `inject:"ChatNotifier"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatSendMessageHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatSendMessageHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatSendMessageHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+		{Name: "body", Type: router.StringField},
+		{Name: "metadata", Type: router.MapField},
+	}
+}
+
+func (h *ChatSendMessageHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatMessagePayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+	if payload.Body == "" && payload.Metadata == nil {
+		response.Err = skyerr.NewInvalidArgument("message must have body or metadata", []string{"body", "metadata"})
+		return
+	}
+
+	db := rpayload.DBConn.PublicDB()
+	conversation, err := chat.GetConversation(ctx, db, payload.ConversationID, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	message, err := chat.SendMessage(ctx, db, conversation, rpayload.UserInfoID, payload.Body, payload.Metadata)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	h.Notifier.Notify(chat.ParticipantIDs(conversation), chat.NewRecordEvent(chat.EventCreate, message))
+	response.Result = (*skyconv.JSONRecord)(message)
+}
+
+/*
+ChatGetMessagesHandler returns messages of a conversation, newest first.
+Specify before to fetch messages sent before the oldest one fetched.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:get_messages",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID",
+    "limit": 50,
+    "before": "2017-03-01T00:00:00Z"
+}
+EOF
+*/
+type ChatGetMessagesHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatGetMessagesHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatGetMessagesHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatGetMessagesHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+		{Name: "limit", Type: router.NumberField},
+		{Name: "before", Type: router.StringField},
+	}
+}
+
+func (h *ChatGetMessagesHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatMessagePayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+
+	db := rpayload.DBConn.PublicDB()
+	if _, err := chat.GetConversation(ctx, db, payload.ConversationID, rpayload.UserInfoID); err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	messages, err := chat.Messages(ctx, db, payload.ConversationID, payload.Before, payload.Limit)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	results := make([]interface{}, len(messages))
+	for i := range messages {
+		results[i] = (*skyconv.JSONRecord)(&messages[i])
+	}
+	response.Result = results
+}
+
+/*
+ChatMarkAsReadHandler resets the unread count of the current user in a
+conversation.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:mark_as_read",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID"
+}
+EOF
+*/
+type ChatMarkAsReadHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatMarkAsReadHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatMarkAsReadHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatMarkAsReadHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *ChatMarkAsReadHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	payload := chatConversationPayload{}
+	if response.Err = payload.Decode(rpayload.Data); response.Err != nil {
+		return
+	}
+
+	userConversation, err := chat.MarkAsRead(ctx, rpayload.DBConn.PublicDB(), payload.ConversationID, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+	response.Result = (*skyconv.JSONRecord)(userConversation)
+}
+
+/*
+ChatTypingHandler publishes a typing indicator of the current user to the
+other participants of a conversation. Nothing is stored.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "chat:typing",
+    "access_token": "ACCESS_TOKEN",
+    "conversation_id": "CONVERSATION_ID",
+    "event": "begin"
+}
+EOF
+*/
+type ChatTypingHandler struct {
+	Notifier      *chat.Notifier   `inject:"ChatNotifier"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ChatTypingHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *ChatTypingHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ChatTypingHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "conversation_id", Type: router.StringField, Required: true},
+		{Name: "event", Type: router.StringField, Required: true, Enum: []string{"begin", "pause", "finished"}},
+	}
+}
+
+func (h *ChatTypingHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	conversationID, _ := rpayload.Data["conversation_id"].(string)
+	typingEvent, _ := rpayload.Data["event"].(string)
+
+	conversation, err := chat.GetConversation(ctx, rpayload.DBConn.PublicDB(), conversationID, rpayload.UserInfoID)
+	if err != nil {
+		response.Err = chatError(err)
+		return
+	}
+
+	recipientIDs := []string{}
+	for _, userID := range chat.ParticipantIDs(conversation) {
+		if userID != rpayload.UserInfoID {
+			recipientIDs = append(recipientIDs, userID)
+		}
+	}
+	h.Notifier.Notify(recipientIDs, chat.Event{
+		Type:           chat.EventTyping,
+		ConversationID: conversationID,
+		UserID:         rpayload.UserInfoID,
+		TypingEvent:    typingEvent,
+	})
+	response.Result = map[string]interface{}{
+		"conversation_id": conversationID,
+		"event":           typingEvent,
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/chat"
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type chatConn struct {
+	db *skydbtest.MapDB
+	*skydbtest.MapConn
+}
+
+func (conn *chatConn) PublicDB() skydb.Database {
+	return conn.db
+}
+
+func TestChatHandlers(t *testing.T) {
+	Convey("Chat handlers", t, func() {
+		conn := &chatConn{
+			db:      skydbtest.NewMapDB(),
+			MapConn: skydbtest.NewMapConn(),
+		}
+		hub := pubsub.NewHub()
+		notifier := &chat.Notifier{Hub: hub}
+
+		conversation, err := chat.CreateConversation(context.Background(), conn.db, "alice", []string{"bob"}, "Lunch")
+		So(err, ShouldBeNil)
+
+		routerAs := func(handler router.Handler, userID string) *handlertest.SingleRouteRouter {
+			return handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.UserInfoID = userID
+			})
+		}
+
+		Convey("creates conversation", func() {
+			go func() {
+				for range []int{0, 1} {
+					<-hub.Broadcast
+				}
+			}()
+
+			resp := routerAs(&ChatCreateConversationHandler{Notifier: notifier}, "bob").POST(`{
+				"participant_ids": ["carol"],
+				"title": "Dinner"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			userConversations := 0
+			for _, record := range conn.db.RecordMap {
+				if record.ID.Type == chat.UserConversationRecordType {
+					userConversations++
+				}
+			}
+			So(userConversations, ShouldEqual, 4)
+		})
+
+		Convey("rejects conversation without participants", func() {
+			resp := routerAs(&ChatCreateConversationHandler{}, "bob").POST(`{}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+
+		Convey("sends message to participants", func() {
+			parcels := make(chan pubsub.Parcel, 2)
+			go func() {
+				for range []int{0, 1} {
+					parcels <- <-hub.Broadcast
+				}
+			}()
+
+			resp := routerAs(&ChatSendMessageHandler{Notifier: notifier}, "alice").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `",
+				"body": "Hello"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+			So((<-parcels).Channel, ShouldEqual, "_chat_alice")
+			So((<-parcels).Channel, ShouldEqual, "_chat_bob")
+
+			resp = routerAs(&ChatMarkAsReadHandler{}, "bob").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+		})
+
+		Convey("rejects message from non-participant", func() {
+			resp := routerAs(&ChatSendMessageHandler{Notifier: notifier}, "carol").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `",
+				"body": "Hello"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "user is not a participant of the conversation",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+
+		Convey("rejects message to non-existent conversation", func() {
+			resp := routerAs(&ChatSendMessageHandler{Notifier: notifier}, "alice").POST(`{
+				"conversation_id": "not-exist",
+				"body": "Hello"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 110,
+					"message": "conversation not found",
+					"name": "ResourceNotFound"
+				}
+			}`)
+		})
+
+		Convey("allows only admins to add participants", func() {
+			resp := routerAs(&ChatAddParticipantsHandler{Notifier: notifier}, "bob").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `",
+				"participant_ids": ["carol"]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "only admins can add participants",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+
+		Convey("allows participants to leave", func() {
+			go func() {
+				for range []int{0, 1} {
+					<-hub.Broadcast
+				}
+			}()
+
+			resp := routerAs(&ChatRemoveParticipantsHandler{Notifier: notifier}, "bob").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `",
+				"participant_ids": ["bob"]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			saved := skydb.Record{}
+			So(conn.db.Get(context.Background(), conversation.ID, &saved), ShouldBeNil)
+			So(chat.ParticipantIDs(&saved), ShouldResemble, []string{"alice"})
+		})
+
+		Convey("publishes typing indicator to other participants", func() {
+			parcels := make(chan pubsub.Parcel, 1)
+			go func() {
+				parcels <- <-hub.Broadcast
+			}()
+
+			resp := routerAs(&ChatTypingHandler{Notifier: notifier}, "alice").POST(`{
+				"conversation_id": "` + conversation.ID.Key + `",
+				"event": "begin"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			parcel := <-parcels
+			So(parcel.Channel, ShouldEqual, "_chat_bob")
+			So(parcel.Data, ShouldEqualJSON, `{
+				"event": "typing",
+				"conversation_id": "`+conversation.ID.Key+`",
+				"user_id": "alice",
+				"typing_event": "begin"
+			}`)
+		})
+	})
+}
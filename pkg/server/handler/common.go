@@ -17,7 +17,10 @@ package handler
 import (
 	"time"
 
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
+	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
@@ -29,23 +32,36 @@ var (
 
 // AuthResponse is the unify way of returing a UserInfo to SDK
 type AuthResponse struct {
-	UserID      string     `json:"user_id,omitempty"`
-	Username    string     `json:"username,omitempty"`
-	Email       string     `json:"email,omitempty"`
-	Roles       []string   `json:"roles,omitempty"`
-	AccessToken string     `json:"access_token,omitempty"`
-	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
-	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	UserID            string               `json:"user_id,omitempty"`
+	Username          string               `json:"username,omitempty"`
+	Email             string               `json:"email,omitempty"`
+	Roles             []string             `json:"roles,omitempty"`
+	AccessToken       string               `json:"access_token,omitempty"`
+	LastLoginAt       *time.Time           `json:"last_login_at,omitempty"`
+	LastLoginLocation *skydb.LoginLocation `json:"last_login_location,omitempty"`
+	LastSeenAt        *time.Time           `json:"last_seen_at,omitempty"`
+}
+
+// setUserResult sets the result of response to user info, such as an
+// AuthResponse, with the user fields hidden by filter removed.
+func setUserResult(filter *fieldfilter.Filter, payload *router.Payload, response *router.Response, user interface{}) {
+	result, err := filter.FilterUser(payload, user)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	response.Result = result
 }
 
 func NewAuthResponse(info skydb.UserInfo, accessToken string) AuthResponse {
 	return AuthResponse{
-		UserID:      info.ID,
-		Username:    info.Username,
-		Email:       info.Email,
-		Roles:       info.Roles,
-		AccessToken: accessToken,
-		LastLoginAt: info.LastLoginAt,
-		LastSeenAt:  info.LastSeenAt,
+		UserID:            info.ID,
+		Username:          info.Username,
+		Email:             info.Email,
+		Roles:             info.Roles,
+		AccessToken:       accessToken,
+		LastLoginAt:       info.LastLoginAt,
+		LastLoginLocation: info.LastLoginLocation,
+		LastSeenAt:        info.LastSeenAt,
 	}
 }
@@ -15,7 +15,9 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/mitchellh/mapstructure"
@@ -50,6 +52,62 @@ func (payload *deviceRegisterPayload) Validate() skyerr.Error {
 	return nil
 }
 
+// mergeRotatedDevices finds the existing device to be updated when device
+// has no ID, then merges other devices of the user having the same token
+// into it. Devices of other users having the same token are deleted.
+func mergeRotatedDevices(ctx context.Context, conn skydb.Conn, merger skydb.DeviceMerger, userID string, payload *deviceRegisterPayload, device *skydb.Device) error {
+	sameTokenDevices := []skydb.Device{}
+	if payload.DeviceToken != "" {
+		var err error
+		sameTokenDevices, err = merger.QueryDevicesByToken(ctx, payload.DeviceToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	if device.ID == "" {
+		for _, d := range sameTokenDevices {
+			if d.UserInfoID == userID || d.UserInfoID == "" {
+				*device = d
+				break
+			}
+		}
+	}
+
+	if device.ID == "" && userID != "" {
+		userDevices, err := conn.QueryDevicesByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, d := range userDevices {
+			if d.Type != payload.Type || d.Topic != payload.Topic {
+				continue
+			}
+			if device.ID == "" || d.LastRegisteredAt.After(device.LastRegisteredAt) {
+				*device = d
+			}
+		}
+	}
+
+	if device.ID == "" { // new device
+		device.ID = uuid.New()
+	}
+
+	mergedIDs := []string{}
+	for _, d := range sameTokenDevices {
+		if d.ID == device.ID {
+			continue
+		}
+		if d.UserInfoID == userID || d.UserInfoID == "" {
+			mergedIDs = append(mergedIDs, d.ID)
+		} else if err := conn.DeleteDevice(ctx, d.ID); err != nil && err != skydb.ErrDeviceNotFound {
+			return err
+		}
+	}
+
+	return merger.MergeDevices(ctx, device.ID, mergedIDs)
+}
+
 type deviceUnregisterPayload struct {
 	ID string
 }
@@ -103,6 +161,13 @@ type DeviceReigsterResult struct {
 //	}
 //	EOF
 //
+// When the database supports merging devices, a device registered without
+// an id reuses the existing device having the same token, or else the
+// user's device having the same type and topic, so that a rotated token does
+// not create a duplicate device. Other devices of the user having the same
+// token are merged into the registered device with their subscriptions.
+// Clients with more than one device of the same type and topic should
+// always specify the device id.
 type DeviceRegisterHandler struct {
 	Authenticator router.Processor `preprocessor:"authenticator"`
 	DBConn        router.Processor `preprocessor:"dbconn"`
@@ -128,7 +193,7 @@ func (h *DeviceRegisterHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *DeviceRegisterHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *DeviceRegisterHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := deviceRegisterPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -140,10 +205,8 @@ func (h *DeviceRegisterHandler) Handle(rpayload *router.Payload, response *route
 
 	device := skydb.Device{}
 	deviceID := payload.ID
-	if deviceID == "" { // new device
-		device.ID = uuid.New()
-	} else { // update device
-		if err := conn.GetDevice(deviceID, &device); err != nil {
+	if deviceID != "" { // update device
+		if err := conn.GetDevice(ctx, deviceID, &device); err != nil {
 			if err == skydb.ErrDeviceNotFound {
 				response.Err = skyerr.NewError(skyerr.ResourceNotFound, "Device not found")
 				return
@@ -159,12 +222,28 @@ func (h *DeviceRegisterHandler) Handle(rpayload *router.Payload, response *route
 		}
 	}
 
-	// delete all devices with the same token
-	if err := conn.DeleteDevicesByToken(payload.DeviceToken, skydb.ZeroTime); err != nil {
-		if err != skydb.ErrDeviceNotFound {
-			response.Err = skyerr.NewResourceDeleteFailureErrWithStringID("device", "")
+	if merger, ok := conn.(skydb.DeviceMerger); ok {
+		if err := mergeRotatedDevices(ctx, conn, merger, rpayload.UserInfoID, &payload, &device); err != nil {
+			log.WithFields(logrus.Fields{
+				"deviceID": device.ID,
+				"err":      err,
+			}).Errorln("Failed to merge devices")
+
+			response.Err = skyerr.NewResourceSaveFailureErrWithStringID("device", device.ID)
 			return
 		}
+	} else {
+		if device.ID == "" { // new device
+			device.ID = uuid.New()
+		}
+
+		// delete all devices with the same token
+		if err := conn.DeleteDevicesByToken(ctx, payload.DeviceToken, skydb.ZeroTime); err != nil {
+			if err != skydb.ErrDeviceNotFound {
+				response.Err = skyerr.NewResourceDeleteFailureErrWithStringID("device", "")
+				return
+			}
+		}
 	}
 
 	device.Type = payload.Type
@@ -173,7 +252,7 @@ func (h *DeviceRegisterHandler) Handle(rpayload *router.Payload, response *route
 	device.UserInfoID = rpayload.UserInfoID
 	device.LastRegisteredAt = timeNow()
 
-	if err := conn.SaveDevice(&device); err != nil {
+	if err := conn.SaveDevice(ctx, &device); err != nil {
 		log.WithFields(logrus.Fields{
 			"deviceID": deviceID,
 			"device":   device,
@@ -225,7 +304,7 @@ func (h *DeviceUnregisterHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *DeviceUnregisterHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *DeviceUnregisterHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := deviceUnregisterPayload{}
 	if err := payload.Decode(rpayload.Data); err != nil {
 		response.Err = err
@@ -235,7 +314,7 @@ func (h *DeviceUnregisterHandler) Handle(rpayload *router.Payload, response *rou
 	conn := rpayload.DBConn
 
 	device := skydb.Device{}
-	if err := conn.GetDevice(payload.ID, &device); err != nil {
+	if err := conn.GetDevice(ctx, payload.ID, &device); err != nil {
 		if err == skydb.ErrDeviceNotFound {
 			response.Err = skyerr.NewError(skyerr.ResourceNotFound, "Device not found")
 			return
@@ -250,8 +329,13 @@ func (h *DeviceUnregisterHandler) Handle(rpayload *router.Payload, response *rou
 		return
 	}
 
+	if !rpayload.HasMasterKey() && device.UserInfoID != "" && device.UserInfoID != rpayload.UserInfoID {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "cannot unregister device of another user")
+		return
+	}
+
 	// delete all devices with the same token
-	if err := conn.DeleteDevicesByToken(device.Token, skydb.ZeroTime); err != nil {
+	if err := conn.DeleteDevicesByToken(ctx, device.Token, skydb.ZeroTime); err != nil {
 		if err != skydb.ErrDeviceNotFound {
 			response.Err = skyerr.NewResourceDeleteFailureErrWithStringID("device", "")
 			return
@@ -259,7 +343,7 @@ func (h *DeviceUnregisterHandler) Handle(rpayload *router.Payload, response *rou
 	}
 
 	device.UserInfoID = ""
-	if err := conn.SaveDevice(&device); err != nil {
+	if err := conn.SaveDevice(ctx, &device); err != nil {
 		log.WithFields(logrus.Fields{
 			"deviceID": payload.ID,
 			"device":   device,
@@ -272,3 +356,275 @@ func (h *DeviceUnregisterHandler) Handle(rpayload *router.Payload, response *rou
 
 	response.Result = DeviceReigsterResult{device.ID}
 }
+
+type deviceListItem struct {
+	ID               string    `json:"id"`
+	Type             string    `json:"type"`
+	Token            string    `json:"device_token,omitempty"`
+	Topic            string    `json:"topic,omitempty"`
+	LastRegisteredAt time.Time `json:"last_registered_at"`
+}
+
+// DeviceListHandler lists devices registered by the current user
+//
+// Example to list devices:
+//
+//	curl -X POST -H "Content-Type: application/json" \
+//	  -d @- http://localhost:3000/ <<EOF
+//	{
+//		"action": "device:list",
+//		"access_token": "some-access-token"
+//	}
+//	EOF
+//
+type DeviceListHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *DeviceListHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *DeviceListHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *DeviceListHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	devices, err := rpayload.DBConn.QueryDevicesByUser(ctx, rpayload.UserInfoID)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"userID": rpayload.UserInfoID,
+			"err":    err,
+		}).Errorln("Fail to query devices")
+
+		response.Err = skyerr.NewResourceFetchFailureErr("device", "")
+		return
+	}
+
+	results := make([]deviceListItem, len(devices))
+	for i, device := range devices {
+		results[i] = deviceListItem{
+			ID:               device.ID,
+			Type:             device.Type,
+			Token:            device.Token,
+			Topic:            device.Topic,
+			LastRegisteredAt: device.LastRegisteredAt,
+		}
+	}
+
+	response.Result = results
+}
+
+type deviceInventoryPayload struct {
+	UserID string `mapstructure:"user_id"`
+}
+
+func (payload *deviceInventoryPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *deviceInventoryPayload) Validate() skyerr.Error {
+	if payload.UserID == "" {
+		return skyerr.NewInvalidArgument("empty user_id", []string{"user_id"})
+	}
+	return nil
+}
+
+type deviceInventoryChannel struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type deviceInventorySubscription struct {
+	ID               string                  `json:"id"`
+	Type             string                  `json:"type"`
+	DatabaseID       string                  `json:"database_id"`
+	NotificationInfo *skydb.NotificationInfo `json:"notification_info,omitempty"`
+	Query            jsonQuery               `json:"query"`
+	LastNotifiedAt   *time.Time              `json:"last_notified_at,omitempty"`
+}
+
+type deviceInventoryItem struct {
+	ID               string                        `json:"id"`
+	Type             string                        `json:"type"`
+	Token            string                        `json:"device_token,omitempty"`
+	Topic            string                        `json:"topic,omitempty"`
+	LastRegisteredAt time.Time                     `json:"last_registered_at"`
+	LastNotifiedAt   *time.Time                    `json:"last_notified_at,omitempty"`
+	Channels         []deviceInventoryChannel      `json:"channels"`
+	Subscriptions    []deviceInventorySubscription `json:"subscriptions"`
+}
+
+type deviceInventoryResult struct {
+	UserID  string                `json:"user_id"`
+	Devices []deviceInventoryItem `json:"devices"`
+}
+
+/*
+DeviceInventoryHandler lists the devices registered by a user, with the
+subscriptions of each device in the public database and the private
+database of the user. It requires master key.
+
+The channels of a device are those the subscription service notifies
+the device through, i.e. the pubsub channel of the device, and push
+notification for an iOS device with a token. The last_notified_at of a
+device is the latest last_notified_at of its subscriptions.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "device:inventory",
+    "master_key": "MASTER_KEY",
+    "user_id": "USER_ID"
+}
+EOF
+
+{
+    "result": {
+        "user_id": "USER_ID",
+        "devices": [
+            {
+                "id": "DEVICE_ID",
+                "type": "ios",
+                "device_token": "DEVICE_TOKEN",
+                "last_registered_at": "2017-03-01T08:00:00Z",
+                "last_notified_at": "2017-03-02T09:30:00Z",
+                "channels": [
+                    {"type": "pubsub", "name": "_sub_DEVICE_ID"},
+                    {"type": "push", "name": "ios"}
+                ],
+                "subscriptions": [
+                    {
+                        "id": "SUBSCRIPTION_ID",
+                        "type": "query",
+                        "database_id": "_private",
+                        "query": {"record_type": "note", "predicate": [...]},
+                        "last_notified_at": "2017-03-02T09:30:00Z"
+                    }
+                ]
+            }
+        ]
+    }
+}
+*/
+type DeviceInventoryHandler struct {
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *DeviceInventoryHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *DeviceInventoryHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *DeviceInventoryHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "user_id", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *DeviceInventoryHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	if !rpayload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "listing device inventory requires master key")
+		return
+	}
+
+	payload := &deviceInventoryPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := rpayload.DBConn
+	devices, err := conn.QueryDevicesByUser(ctx, payload.UserID)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"userID": payload.UserID,
+			"err":    err,
+		}).Errorln("Fail to query devices")
+
+		response.Err = skyerr.NewResourceFetchFailureErr("device", "")
+		return
+	}
+
+	databases := []struct {
+		ID       string
+		Database skydb.Database
+	}{
+		{skydb.PublicDatabaseIdentifier, conn.PublicDB()},
+		{"_private", conn.PrivateDB(payload.UserID)},
+	}
+
+	items := make([]deviceInventoryItem, len(devices))
+	for i, device := range devices {
+		item := deviceInventoryItem{
+			ID:               device.ID,
+			Type:             device.Type,
+			Token:            device.Token,
+			Topic:            device.Topic,
+			LastRegisteredAt: device.LastRegisteredAt,
+			Channels:         deviceInventoryChannels(device),
+			Subscriptions:    []deviceInventorySubscription{},
+		}
+
+		for _, db := range databases {
+			for _, sub := range db.Database.GetSubscriptionsByDeviceID(ctx, device.ID) {
+				item.Subscriptions = append(item.Subscriptions, deviceInventorySubscription{
+					ID:               sub.ID,
+					Type:             sub.Type,
+					DatabaseID:       db.ID,
+					NotificationInfo: sub.NotificationInfo,
+					Query:            jsonQuery(sub.Query),
+					LastNotifiedAt:   sub.LastNotifiedAt,
+				})
+
+				if sub.LastNotifiedAt != nil &&
+					(item.LastNotifiedAt == nil || sub.LastNotifiedAt.After(*item.LastNotifiedAt)) {
+					item.LastNotifiedAt = sub.LastNotifiedAt
+				}
+			}
+		}
+
+		items[i] = item
+	}
+
+	response.Result = deviceInventoryResult{
+		UserID:  payload.UserID,
+		Devices: items,
+	}
+}
+
+// deviceInventoryChannels returns the channels the subscription service
+// notifies the device through.
+func deviceInventoryChannels(device skydb.Device) []deviceInventoryChannel {
+	channels := []deviceInventoryChannel{
+		{Type: "pubsub", Name: fmt.Sprintf("_sub_%s", device.ID)},
+	}
+	if device.Type == "ios" && device.Token != "" {
+		channels = append(channels, deviceInventoryChannel{Type: "push", Name: device.Type})
+	}
+	return channels
+}
@@ -15,12 +15,16 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/memory"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -31,10 +35,11 @@ type naiveConn struct {
 	mockSaveError            error
 	mockDeleteError          error
 	mockDeleteWithTokenError error
+	mergedDevices            map[string][]string
 	skydb.Conn
 }
 
-func (conn *naiveConn) GetDevice(id string, device *skydb.Device) error {
+func (conn *naiveConn) GetDevice(ctx context.Context, id string, device *skydb.Device) error {
 	if conn.mockGetError != nil {
 		return conn.mockGetError
 	}
@@ -48,7 +53,22 @@ func (conn *naiveConn) GetDevice(id string, device *skydb.Device) error {
 	return nil
 }
 
-func (conn *naiveConn) SaveDevice(device *skydb.Device) error {
+func (conn *naiveConn) QueryDevicesByUser(ctx context.Context, user string) ([]skydb.Device, error) {
+	if conn.mockGetError != nil {
+		return nil, conn.mockGetError
+	}
+
+	devices := []skydb.Device{}
+	for _, device := range conn.devices {
+		if device.UserInfoID == user {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, nil
+}
+
+func (conn *naiveConn) SaveDevice(ctx context.Context, device *skydb.Device) error {
 	if conn.mockSaveError != nil {
 		return conn.mockSaveError
 	}
@@ -61,7 +81,7 @@ func (conn *naiveConn) SaveDevice(device *skydb.Device) error {
 	return nil
 }
 
-func (conn *naiveConn) DeleteDevice(id string) error {
+func (conn *naiveConn) DeleteDevice(ctx context.Context, id string) error {
 	if conn.mockDeleteError != nil {
 		return conn.mockDeleteError
 	}
@@ -70,7 +90,7 @@ func (conn *naiveConn) DeleteDevice(id string) error {
 	return nil
 }
 
-func (conn *naiveConn) DeleteDevicesByToken(token string, t time.Time) error {
+func (conn *naiveConn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
 	if conn.mockDeleteWithTokenError != nil {
 		return conn.mockDeleteWithTokenError
 	}
@@ -88,6 +108,33 @@ func (conn *naiveConn) DeleteDevicesByToken(token string, t time.Time) error {
 	return nil
 }
 
+func (conn *naiveConn) QueryDevicesByToken(ctx context.Context, token string) ([]skydb.Device, error) {
+	devices := []skydb.Device{}
+	for _, device := range conn.devices {
+		if device.Token == token {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, nil
+}
+
+func (conn *naiveConn) MergeDevices(ctx context.Context, id string, mergedIDs []string) error {
+	if len(mergedIDs) == 0 {
+		return nil
+	}
+
+	if conn.mergedDevices == nil {
+		conn.mergedDevices = map[string][]string{}
+	}
+	conn.mergedDevices[id] = append(conn.mergedDevices[id], mergedIDs...)
+	for _, mergedID := range mergedIDs {
+		delete(conn.devices, mergedID)
+	}
+
+	return nil
+}
+
 func TestDeviceRegisterHandler(t *testing.T) {
 	Convey("DeviceRegisterHandler", t, func() {
 		timeNow = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) }
@@ -113,7 +160,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			resultID := result.ID
@@ -137,7 +184,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 				UserInfoID:       "olduserinfoid",
 				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(conn.SaveDevice(&olddevice), ShouldBeNil)
+			So(conn.SaveDevice(context.Background(), &olddevice), ShouldBeNil)
 
 			payload.Data = map[string]interface{}{
 				"id":           "deviceid",
@@ -147,7 +194,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			resultID := result.ID
@@ -171,7 +218,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 				UserInfoID:       "existing_user",
 				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(conn.SaveDevice(&existingDevice), ShouldBeNil)
+			So(conn.SaveDevice(context.Background(), &existingDevice), ShouldBeNil)
 
 			payload.Data = map[string]interface{}{
 				"type":         "ios",
@@ -180,7 +227,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			resultID := result.ID
@@ -196,13 +243,126 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			So(conn.devices["existing_id"], ShouldResemble, skydb.Device{})
 		})
 
+		Convey("reuses device of the user with the same token", func() {
+			existingDevice := skydb.Device{
+				ID:               "existing_id",
+				Type:             "ios",
+				Token:            "existing_token",
+				Topic:            "existing_topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}
+			So(conn.SaveDevice(context.Background(), &existingDevice), ShouldBeNil)
+
+			payload.Data = map[string]interface{}{
+				"type":         "ios",
+				"device_token": "existing_token",
+				"topic":        "existing_topic",
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			result := resp.Result.(DeviceReigsterResult)
+			So(result.ID, ShouldEqual, "existing_id")
+			So(conn.devices, ShouldHaveLength, 1)
+			So(conn.devices["existing_id"].LastRegisteredAt, ShouldResemble, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+		})
+
+		Convey("reuses device of the user with the same type and topic on token rotation", func() {
+			existingDevice := skydb.Device{
+				ID:               "existing_id",
+				Type:             "ios",
+				Token:            "old_token",
+				Topic:            "existing_topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}
+			So(conn.SaveDevice(context.Background(), &existingDevice), ShouldBeNil)
+			otherTopicDevice := skydb.Device{
+				ID:               "other_topic_id",
+				Type:             "ios",
+				Token:            "other_token",
+				Topic:            "other_topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}
+			So(conn.SaveDevice(context.Background(), &otherTopicDevice), ShouldBeNil)
+
+			payload.Data = map[string]interface{}{
+				"type":         "ios",
+				"device_token": "new_token",
+				"topic":        "existing_topic",
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			result := resp.Result.(DeviceReigsterResult)
+			So(result.ID, ShouldEqual, "existing_id")
+			So(conn.devices["existing_id"], ShouldResemble, skydb.Device{
+				ID:               "existing_id",
+				Type:             "ios",
+				Token:            "new_token",
+				Topic:            "existing_topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			})
+			So(conn.devices["other_topic_id"], ShouldResemble, otherTopicDevice)
+		})
+
+		Convey("merges devices of the user with the same token", func() {
+			So(conn.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "deviceid",
+				Type:             "ios",
+				Token:            "old_token",
+				Topic:            "topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), ShouldBeNil)
+			So(conn.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "duplicated_id",
+				Type:             "ios",
+				Token:            "new_token",
+				Topic:            "topic",
+				UserInfoID:       "userinfoid",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), ShouldBeNil)
+			So(conn.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "other_user_id",
+				Type:             "ios",
+				Token:            "new_token",
+				Topic:            "topic",
+				UserInfoID:       "other_user",
+				LastRegisteredAt: time.Date(2005, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), ShouldBeNil)
+
+			payload.Data = map[string]interface{}{
+				"id":           "deviceid",
+				"type":         "ios",
+				"device_token": "new_token",
+				"topic":        "topic",
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			result := resp.Result.(DeviceReigsterResult)
+			So(result.ID, ShouldEqual, "deviceid")
+			So(conn.mergedDevices, ShouldResemble, map[string][]string{
+				"deviceid": []string{"duplicated_id"},
+			})
+			So(conn.devices, ShouldHaveLength, 1)
+			So(conn.devices["deviceid"].Token, ShouldEqual, "new_token")
+		})
+
 		Convey("complains on empty device type", func() {
 			payload.Data = map[string]interface{}{
 				"device_token": "token",
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err.(skyerr.Error)
 			So(err, ShouldResemble, skyerr.NewInvalidArgument("empty device type", []string{"type"}))
@@ -215,7 +375,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err.(skyerr.Error)
 			So(err, ShouldResemble, skyerr.NewInvalidArgument("unknown device type = invalidtype", []string{"type"}))
@@ -228,7 +388,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			resultID := result.ID
@@ -254,7 +414,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err.(skyerr.Error)
 			So(err, ShouldResemble, skyerr.NewError(
@@ -271,7 +431,7 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			}
 
 			handler := &DeviceRegisterHandler{}
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err.(skyerr.Error)
 			So(err, ShouldResemble, skyerr.NewInvalidArgument("unknown device type = unknown-type", []string{"type"}))
@@ -322,7 +482,7 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 			resp := router.Response{}
 			handler := &DeviceUnregisterHandler{}
 
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			So(result.ID, ShouldEqual, "device_1")
@@ -351,7 +511,7 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 			resp := router.Response{}
 			handler := &DeviceUnregisterHandler{}
 
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			result := resp.Result.(DeviceReigsterResult)
 			So(result.ID, ShouldEqual, "device_2_1")
@@ -383,7 +543,7 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 			resp := router.Response{}
 			handler := &DeviceUnregisterHandler{}
 
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err
 			So(err, ShouldResemble, skyerr.NewError(
@@ -392,6 +552,27 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 			))
 		})
 
+		Convey("complains on device of another user", func() {
+			payload := router.Payload{
+				DBConn:     &conn,
+				UserInfoID: "user_id_3",
+				Data: map[string]interface{}{
+					"id": "device_1",
+				},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceUnregisterHandler{}
+
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldResemble, skyerr.NewError(
+				skyerr.PermissionDenied,
+				"cannot unregister device of another user",
+			))
+			So(conn.devices["device_1"].UserInfoID, ShouldEqual, "user_id_1")
+		})
+
 		Convey("complains on empty device id", func() {
 			payload := router.Payload{
 				DBConn:     &conn,
@@ -402,7 +583,7 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 			resp := router.Response{}
 			handler := &DeviceUnregisterHandler{}
 
-			handler.Handle(&payload, &resp)
+			handler.Handle(context.Background(), &payload, &resp)
 
 			err := resp.Err
 			So(err, ShouldResemble, skyerr.NewInvalidArgument(
@@ -412,3 +593,196 @@ func TestDeviceUnregisterHandler(t *testing.T) {
 		})
 	})
 }
+
+func TestDeviceListHandler(t *testing.T) {
+	Convey("DeviceListHandler", t, func() {
+		conn := naiveConn{
+			devices: map[string]skydb.Device{
+				"device_1": skydb.Device{
+					ID:               "device_1",
+					Type:             "ios",
+					Token:            "device_token_1",
+					Topic:            "device_topic_1",
+					UserInfoID:       "user_id_1",
+					LastRegisteredAt: time.Date(2016, 12, 16, 6, 54, 0, 0, time.UTC),
+				},
+				"device_2": skydb.Device{
+					ID:               "device_2",
+					Type:             "android",
+					Token:            "device_token_2",
+					UserInfoID:       "user_id_2",
+					LastRegisteredAt: time.Date(2016, 12, 16, 6, 55, 0, 0, time.UTC),
+				},
+			},
+		}
+
+		Convey("lists devices of current user", func() {
+			payload := router.Payload{
+				DBConn:     &conn,
+				UserInfoID: "user_id_1",
+				Data:       map[string]interface{}{},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceListHandler{}
+
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldBeNil)
+			So(resp.Result, ShouldResemble, []deviceListItem{
+				{
+					ID:               "device_1",
+					Type:             "ios",
+					Token:            "device_token_1",
+					Topic:            "device_topic_1",
+					LastRegisteredAt: time.Date(2016, 12, 16, 6, 54, 0, 0, time.UTC),
+				},
+			})
+		})
+
+		Convey("returns empty list if user has no device", func() {
+			payload := router.Payload{
+				DBConn:     &conn,
+				UserInfoID: "user_id_3",
+				Data:       map[string]interface{}{},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceListHandler{}
+
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldBeNil)
+			So(resp.Result, ShouldResemble, []deviceListItem{})
+		})
+	})
+}
+
+func TestDeviceInventoryHandler(t *testing.T) {
+	Convey("DeviceInventoryHandler", t, func() {
+		conn := memory.NewConn()
+		So(conn.SaveDevice(context.Background(), &skydb.Device{
+			ID:               "device_1",
+			Type:             "ios",
+			Token:            "device_token_1",
+			UserInfoID:       "user_id_1",
+			LastRegisteredAt: time.Date(2016, 12, 16, 6, 54, 0, 0, time.UTC),
+		}), ShouldBeNil)
+		So(conn.SaveDevice(context.Background(), &skydb.Device{
+			ID:               "device_2",
+			Type:             "android",
+			UserInfoID:       "user_id_2",
+			LastRegisteredAt: time.Date(2016, 12, 16, 6, 55, 0, 0, time.UTC),
+		}), ShouldBeNil)
+
+		privateSub := skydb.Subscription{
+			ID:       "sub_private",
+			Type:     "query",
+			DeviceID: "device_1",
+			Query:    skydb.Query{Type: "note"},
+		}
+		privateDB := conn.PrivateDB("user_id_1")
+		So(privateDB.SaveSubscription(context.Background(), &privateSub), ShouldBeNil)
+		So(privateDB.(skydb.NotificationRecorder).RecordNotification(context.Background(),
+			&privateSub,
+			time.Date(2016, 12, 17, 8, 0, 0, 0, time.UTC),
+		), ShouldBeNil)
+		So(conn.PublicDB().SaveSubscription(context.Background(), &skydb.Subscription{
+			ID:       "sub_public",
+			Type:     "query",
+			DeviceID: "device_1",
+			Query: skydb.Query{
+				Type: "comment",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "_owner_id"},
+						skydb.Expression{Type: skydb.Variable, Value: skydb.CurrentUserIDVariable},
+					},
+				},
+			},
+		}), ShouldBeNil)
+
+		Convey("lists devices and subscriptions of the user", func() {
+			payload := router.Payload{
+				DBConn:    conn,
+				AccessKey: router.MasterAccessKey,
+				Data: map[string]interface{}{
+					"user_id": "user_id_1",
+				},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceInventoryHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldBeNil)
+			result, err := json.Marshal(resp.Result)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqualJSON, `{
+				"user_id": "user_id_1",
+				"devices": [{
+					"id": "device_1",
+					"type": "ios",
+					"device_token": "device_token_1",
+					"last_registered_at": "2016-12-16T06:54:00Z",
+					"last_notified_at": "2016-12-17T08:00:00Z",
+					"channels": [
+						{"type": "pubsub", "name": "_sub_device_1"},
+						{"type": "push", "name": "ios"}
+					],
+					"subscriptions": [{
+						"id": "sub_public",
+						"type": "query",
+						"database_id": "_public",
+						"query": {
+							"record_type": "comment",
+							"predicate": [
+								"eq",
+								{"$type": "keypath", "$val": "_owner_id"},
+								{"$type": "var", "$val": "current_user_id"}
+							]
+						}
+					}, {
+						"id": "sub_private",
+						"type": "query",
+						"database_id": "_private",
+						"query": {"record_type": "note"},
+						"last_notified_at": "2016-12-17T08:00:00Z"
+					}]
+				}]
+			}`)
+		})
+
+		Convey("rejects request without master key", func() {
+			payload := router.Payload{
+				DBConn: conn,
+				Data: map[string]interface{}{
+					"user_id": "user_id_1",
+				},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceInventoryHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldNotBeNil)
+			So(resp.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+		})
+
+		Convey("rejects request without user_id", func() {
+			payload := router.Payload{
+				DBConn:    conn,
+				AccessKey: router.MasterAccessKey,
+				Data:      map[string]interface{}{},
+			}
+
+			resp := router.Response{}
+			handler := &DeviceInventoryHandler{}
+			handler.Handle(context.Background(), &payload, &resp)
+
+			So(resp.Err, ShouldNotBeNil)
+			So(resp.Err.Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// dryRunSampleSize is the maximum number of IDs reported by a dry run.
+const dryRunSampleSize = 10
+
+// dryRunResult reports what a destructive operation would affect if it
+// were not a dry run.
+type dryRunResult struct {
+	Count     uint64   `json:"count"`
+	SampleIDs []string `json:"sample_ids"`
+}
+
+// checkDryRun returns an error if a dry run is requested without the
+// master key.
+func checkDryRun(payload *router.Payload, dryRun bool) skyerr.Error {
+	if dryRun && !payload.HasMasterKey() {
+		return skyerr.NewError(skyerr.PermissionDenied, "dry run requires master key")
+	}
+	return nil
+}
+
+func newDryRunResult(recordIDs []skydb.RecordID) dryRunResult {
+	result := dryRunResult{
+		Count:     uint64(len(recordIDs)),
+		SampleIDs: []string{},
+	}
+	for i := 0; i < len(recordIDs) && i < dryRunSampleSize; i++ {
+		result.SampleIDs = append(result.SampleIDs, recordIDs[i].String())
+	}
+	return result
+}
+
+// queryDryRunResult returns the number of records matching the query and
+// the IDs of some of them.
+func queryDryRunResult(ctx context.Context, db skydb.Database, query skydb.Query) (dryRunResult, error) {
+	count, err := db.QueryCount(ctx, &query)
+	if err != nil {
+		return dryRunResult{}, err
+	}
+
+	limit := uint64(dryRunSampleSize)
+	query.Limit = &limit
+	results, err := db.Query(ctx, &query)
+	if err != nil {
+		return dryRunResult{}, err
+	}
+	defer results.Close()
+
+	recordIDs := []skydb.RecordID{}
+	for results.Scan() {
+		recordIDs = append(recordIDs, results.Record().ID)
+	}
+	if err := results.Err(); err != nil {
+		return dryRunResult{}, err
+	}
+
+	result := newDryRunResult(recordIDs)
+	result.Count = count
+	return result, nil
+}
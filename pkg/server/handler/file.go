@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -27,7 +28,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+
 	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
@@ -67,9 +71,14 @@ func validateAssetGetRequest(assetStore skyAsset.Store, fileName string, expired
 }
 
 // GetFileHandler models the handler for getting asset file
+//
+// Cache-Control, Content-Disposition and Access-Control-Allow-Origin
+// headers are set according to the content type of the asset as
+// configured in HeaderPolicy.
 type GetFileHandler struct {
-	AssetStore    skyAsset.Store   `inject:"AssetStore"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
+	AssetStore    skyAsset.Store         `inject:"AssetStore"`
+	HeaderPolicy  *skyAsset.HeaderPolicy `inject:"AssetHeaderPolicy"`
+	DBConn        router.Processor       `preprocessor:"dbconn"`
 	preprocessors []router.Processor
 }
 
@@ -86,7 +95,7 @@ func (h *GetFileHandler) GetPreprocessors() []router.Processor {
 }
 
 // Handle handles the get request for asset file
-func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *GetFileHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	payload.Req.ParseForm()
 
 	store := h.AssetStore
@@ -110,7 +119,7 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 
 	conn := payload.DBConn
 	asset := skydb.Asset{}
-	if err := conn.GetAsset(fileName, &asset); err != nil {
+	if err := conn.GetAsset(ctx, fileName, &asset); err != nil {
 		log.Errorf("Failed to get asset: %v", err)
 
 		response.Err = skyerr.NewResourceFetchFailureErr("asset", fileName)
@@ -134,6 +143,7 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 
 	writer.Header().Set("Content-Type", asset.ContentType)
 	writer.Header().Set("Content-Length", strconv.FormatInt(asset.Size, 10))
+	h.HeaderPolicy.SetHeaders(writer.Header(), asset.Name, asset.ContentType)
 
 	if _, err := io.Copy(writer, reader); err != nil {
 		// there is nothing we can do if error occurred after started
@@ -157,10 +167,21 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 //    -F 'file=@file.txt' \
 //    http://localhost:3000/files/filename
 //
+// The client may provide the checksum of the file in the Content-MD5 and
+// X-Skygear-Content-SHA256 headers, or in the content-md5 and
+// content-sha256 form fields of a POST request. The checksum can also be
+// provided when the asset is created with asset:put. The file is rejected
+// if it does not match the checksum, and the stored file is read back to
+// verify it was written correctly.
+//
+// AssetPrefixes are the prefixes of the names of assets by app name,
+// like those of AssetUploadHandler.
 type UploadFileHandler struct {
-	AssetStore    skyAsset.Store   `inject:"AssetStore"`
-	AccessKey     router.Processor `preprocessor:"accesskey"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
+	AssetStore    skyAsset.Store       `inject:"AssetStore"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	AccessKey     router.Processor     `preprocessor:"accesskey"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	AssetPrefixes map[string]string
 	preprocessors []router.Processor
 }
 
@@ -168,6 +189,7 @@ type uploadFileRequest struct {
 	filename    string
 	contentType string
 	fileReader  io.Reader
+	checksum    skyAsset.Checksum
 }
 
 // Setup sets preprocessors being used
@@ -185,6 +207,7 @@ func (h *UploadFileHandler) GetPreprocessors() []router.Processor {
 
 // Handle handles the upload asset request
 func (h *UploadFileHandler) Handle(
+	ctx context.Context,
 	payload *router.Payload,
 	response *router.Response,
 ) {
@@ -218,17 +241,54 @@ func (h *UploadFileHandler) Handle(
 		return
 	}
 
+	// Assets cannot be held for review, only approved ones are stored
+	if h.Moderation != nil {
+		verdict := h.Moderation.ModerateAsset(ctx, uploadRequest.contentType, tempFile)
+		if verdict != moderation.Approved {
+			response.Err = skyerr.NewErrorf(skyerr.InvalidArgument, "content is %s by moderation", verdict)
+			return
+		}
+		if _, err := tempFile.Seek(0, 0); err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+	}
+
 	asset := skydb.Asset{}
 	conn := payload.DBConn
-	if err := conn.GetAsset(uploadRequest.filename, &asset); err != nil {
+	if err := conn.GetAsset(ctx, uploadRequest.filename, &asset); err != nil {
 		// compatible with SDK <= v0.15
 		dir, file := filepath.Split(uploadRequest.filename)
 		file = strings.Join([]string{uuidNew(), file}, "-")
 
-		asset.Name = filepath.Join(dir, file)
+		asset.Name = prefixAssetName(h.AssetPrefixes, payload.AppName, filepath.Join(dir, file))
 		asset.ContentType = uploadRequest.contentType
 	}
 
+	// checksum provided in this request takes precedence over the one
+	// provided when the asset is created
+	expected := uploadRequest.checksum
+	if expected.IsEmpty() {
+		expected = skyAsset.Checksum{
+			MD5:    asset.MD5,
+			SHA256: asset.SHA256,
+		}
+	}
+
+	actual, err := skyAsset.ComputeChecksum(tempFile)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if _, err := tempFile.Seek(0, 0); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if err := expected.Verify(actual); err != nil {
+		response.Err = newChecksumMismatchError(err)
+		return
+	}
+
 	assetStore := h.AssetStore
 	if err := assetStore.PutFileReader(
 		asset.Name,
@@ -242,7 +302,29 @@ func (h *UploadFileHandler) Handle(
 	}
 
 	asset.Size = written
-	if err := conn.SaveAsset(&asset); err != nil {
+	asset.MD5 = actual.MD5
+	asset.SHA256 = actual.SHA256
+	asset.UploadStatus = skydb.AssetUploadCompleted
+
+	// verify the stored file only if the client cares about checksum,
+	// because it requires reading the whole file from the store
+	if !expected.IsEmpty() {
+		if _, err := skyAsset.VerifyStoredFile(assetStore, asset.Name, actual); err != nil {
+			log.WithFields(logrus.Fields{
+				"asset": asset.Name,
+				"err":   err,
+			}).Errorln("Stored asset does not match checksum")
+
+			asset.UploadStatus = skydb.AssetUploadCorrupted
+			if err := conn.SaveAsset(ctx, &asset); err != nil {
+				log.WithField("err", err).Errorln("Failed to save corrupted asset")
+			}
+			response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to verify the stored asset")
+			return
+		}
+	}
+
+	if err := conn.SaveAsset(ctx, &asset); err != nil {
 		response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
 		return
 	}
@@ -268,6 +350,9 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 		fileReader            io.ReadCloser
 	)
 
+	md5Checksum := httpRequest.Header.Get("Content-MD5")
+	sha256Checksum := httpRequest.Header.Get("X-Skygear-Content-SHA256")
+
 	if method == http.MethodPost {
 		// use 100 MB max memory to parse the multiparts Form
 		err := httpRequest.ParseMultipartForm(100 << 20)
@@ -295,6 +380,13 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 		if err != nil {
 			return nil, err
 		}
+
+		if md5Value := httpRequest.FormValue("content-md5"); md5Value != "" {
+			md5Checksum = md5Value
+		}
+		if sha256Value := httpRequest.FormValue("content-sha256"); sha256Value != "" {
+			sha256Checksum = sha256Value
+		}
 	} else if method == http.MethodPut {
 		filename = clean(payload.Params[0])
 		contentType = httpRequest.Header.Get("Content-Type")
@@ -305,13 +397,35 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 		)
 	}
 
+	checksum, err := skyAsset.ParseChecksum(md5Checksum, sha256Checksum)
+	if err != nil {
+		return nil, err
+	}
+
 	return &uploadFileRequest{
 		filename:    filename,
 		contentType: contentType,
 		fileReader:  fileReader,
+		checksum:    checksum,
 	}, nil
 }
 
+func newChecksumMismatchError(err error) skyerr.Error {
+	mismatch, ok := err.(*skyAsset.ChecksumMismatchError)
+	if !ok {
+		return skyerr.MakeError(err)
+	}
+	return skyerr.NewErrorWithInfo(
+		skyerr.InvalidArgument,
+		mismatch.Error(),
+		map[string]interface{}{
+			"algorithm": mismatch.Algorithm,
+			"expected":  mismatch.Expected,
+			"actual":    mismatch.Actual,
+		},
+	)
+}
+
 func copyToTempFile(src io.Reader) (written int64, tempFile *os.File, err error) {
 	tempFile, err = ioutil.TempFile("", "")
 	if err != nil {
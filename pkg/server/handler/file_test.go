@@ -16,6 +16,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -71,7 +72,7 @@ type mockProcessor struct {
 	Mockfunc func(*router.Payload)
 }
 
-func (p mockProcessor) Preprocess(payload *router.Payload, _ *router.Response) int {
+func (p mockProcessor) Preprocess(ctx context.Context, payload *router.Payload, _ *router.Response) int {
 	p.Mockfunc(payload)
 	return http.StatusOK
 }
@@ -81,7 +82,7 @@ type naiveAssetConn struct {
 	savedAsset map[string]*skydb.Asset
 }
 
-func (c *naiveAssetConn) GetAsset(name string, asset *skydb.Asset) error {
+func (c *naiveAssetConn) GetAsset(ctx context.Context, name string, asset *skydb.Asset) error {
 	saved := c.savedAsset[name]
 	if saved != nil {
 		*asset = *saved
@@ -89,7 +90,7 @@ func (c *naiveAssetConn) GetAsset(name string, asset *skydb.Asset) error {
 	return nil
 }
 
-func (c *naiveAssetConn) SaveAsset(asset *skydb.Asset) error {
+func (c *naiveAssetConn) SaveAsset(ctx context.Context, asset *skydb.Asset) error {
 	c.savedAsset[asset.Name] = asset
 	return nil
 }
@@ -147,6 +148,15 @@ func (store *bufferedAssetStore) IsSignatureRequired() bool {
 	return false
 }
 
+// an asset store that returns truncated content of the stored file
+type corruptingAssetStore struct {
+	*bufferedAssetStore
+}
+
+func (store *corruptingAssetStore) GetFileReader(name string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.LimitReader(store.buf, int64(store.buf.Len()-1))), nil
+}
+
 func TestUploadFileHandler(t *testing.T) {
 	Convey("UploadFileHandler", t, func() {
 		assetConn := &naiveAssetConn{}
@@ -237,6 +247,97 @@ func TestUploadFileHandler(t *testing.T) {
 			}`)
 		})
 
+		Convey("uploads a file with matching checksum", func() {
+			assetConn.savedAsset["asset"] = &skydb.Asset{
+				Name:         "asset",
+				ContentType:  "plain/text",
+				UploadStatus: skydb.AssetUploadPending,
+			}
+
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(`I am a boy`))
+			req.Header.Set("Content-Type", "plain/text")
+			req.Header.Set("Content-MD5", "mQHcTySNye4V+ZUSIddmpQ==")
+			resp := r.Do(req)
+
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(store.length, ShouldEqual, 10)
+			savedAsset := assetConn.savedAsset["asset"]
+			So(savedAsset.Size, ShouldEqual, 10)
+			So(savedAsset.MD5, ShouldEqual, "9901dc4f248dc9ee15f9951221d766a5")
+			So(savedAsset.SHA256, ShouldEqual, "0726f9f88bc3dc7fcbd94eae4d619416a110c298b355b9ccaabcb49851995799")
+			So(savedAsset.UploadStatus, ShouldEqual, skydb.AssetUploadCompleted)
+		})
+
+		Convey("errors uploading a file with mismatching checksum", func() {
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(`I am a girl`))
+			req.Header.Set("Content-Type", "plain/text")
+			req.Header.Set("Content-MD5", "9901dc4f248dc9ee15f9951221d766a5")
+			resp := r.Do(req)
+
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "md5 checksum mismatch: expected 9901dc4f248dc9ee15f9951221d766a5, got 9eab6068242f16beae2a5b24e30331b6",
+					"info": {
+						"algorithm": "md5",
+						"expected": "9901dc4f248dc9ee15f9951221d766a5",
+						"actual": "9eab6068242f16beae2a5b24e30331b6"
+					}
+				}
+			}`)
+			So(store.length, ShouldEqual, 0)
+		})
+
+		Convey("errors uploading a file not matching checksum of asset:put", func() {
+			assetConn.savedAsset["asset"] = &skydb.Asset{
+				Name:         "asset",
+				ContentType:  "plain/text",
+				SHA256:       "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+				UploadStatus: skydb.AssetUploadPending,
+			}
+
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(`I am a boy`))
+			req.Header.Set("Content-Type", "plain/text")
+			resp := r.Do(req)
+
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			So(store.length, ShouldEqual, 0)
+			So(assetConn.savedAsset["asset"].UploadStatus, ShouldEqual, skydb.AssetUploadPending)
+		})
+
+		Convey("marks corrupted asset if stored file does not match checksum", func() {
+			r := newmodGateway("(.+)")
+			r.Handle("PUT", &UploadFileHandler{
+				AssetStore: &corruptingAssetStore{store},
+			}, func(p *router.Payload) {
+				p.DBConn = assetConn
+			})
+			assetConn.savedAsset["asset"] = &skydb.Asset{
+				Name:         "asset",
+				ContentType:  "plain/text",
+				UploadStatus: skydb.AssetUploadPending,
+			}
+
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(`I am a boy`))
+			req.Header.Set("Content-Type", "plain/text")
+			req.Header.Set("Content-MD5", "9901dc4f248dc9ee15f9951221d766a5")
+			resp := r.Do(req)
+
+			So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+			So(assetConn.savedAsset["asset"].UploadStatus, ShouldEqual, skydb.AssetUploadCorrupted)
+		})
+
+		Convey("errors with malformed checksum", func() {
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(`I am a boy`))
+			req.Header.Set("Content-Type", "plain/text")
+			req.Header.Set("X-Skygear-Content-SHA256", "not-a-checksum")
+			resp := r.Do(req)
+
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
 		Convey("errors missing content-type", func() {
 			resp := r.PUT("asset", ``)
 			So(resp.Body.String(), ShouldEqualJSON, `{
@@ -305,6 +406,14 @@ func TestGetFileHandler(t *testing.T) {
 		r := newmodGateway("(.+)")
 		r.Handle("GET", &GetFileHandler{
 			AssetStore: signparser,
+			HeaderPolicy: &asset.HeaderPolicy{
+				ContentDisposition: map[string]string{
+					"image/*": "inline",
+				},
+				CacheControl: map[string]string{
+					"image/*": "public, max-age=86400",
+				},
+			},
 		}, func(p *router.Payload) {
 			p.DBConn = assetConn
 		})
@@ -334,6 +443,27 @@ func TestGetFileHandler(t *testing.T) {
 			So(signparser.expiredAt.Unix(), ShouldEqual, 1436431130)
 		})
 
+		Convey("GET with headers by content type", func() {
+			timeNow = func() time.Time {
+				return time.Unix(1436431129, 999)
+			}
+			defer func() {
+				timeNow = timeNowUTC
+			}()
+			signparser.valid = true
+			assetConn.savedAsset["photo.png"] = &skydb.Asset{
+				Name:        "photo.png",
+				ContentType: "image/png",
+				Size:        3,
+			}
+			io.WriteString(store.buf, "png")
+
+			resp := r.GET("photo.png?signature=signedSignature&expiredAt=1436431130")
+			So(resp.Header().Get("Content-Type"), ShouldEqual, "image/png")
+			So(resp.Header().Get("Content-Disposition"), ShouldEqual, "inline")
+			So(resp.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=86400")
+		})
+
 		Convey("errors if signature expired", func() {
 			timeNow = func() time.Time {
 				return time.Unix(1436431130, 1)
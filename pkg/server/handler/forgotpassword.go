@@ -0,0 +1,266 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/authtoken"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
+	"github.com/skygeario/skygear-server/pkg/server/mail"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// ForgotPasswordSettings configures the emails sent by
+// ForgotPasswordHandler.
+type ForgotPasswordSettings struct {
+	Mailer   *mail.Mailer
+	Template *mail.Template
+
+	// CodeExpiry is the duration for which a reset code can be used
+	// after it is sent.
+	CodeExpiry time.Duration
+}
+
+// DefaultForgotPasswordEmailBody is the template of the email body sent by
+// ForgotPasswordHandler if none is configured. Templates are executed
+// with AppName, UserID, Username, Email, Code and ExpireAt.
+const DefaultForgotPasswordEmailBody = `Hello {{if .Username}}{{.Username}}{{else}}{{.Email}}{{end}},
+
+We received a request to reset the password of your {{.AppName}} account.
+Use the following code to reset your password:
+
+{{.Code}}
+
+The code expires at {{.ExpireAt.Format "2006-01-02 15:04 MST"}}. If you did
+not request a password reset, you can ignore this email.
+`
+
+// forgotPasswordEmail is the data the email template is executed with.
+type forgotPasswordEmail struct {
+	AppName  string
+	UserID   string
+	Username string
+	Email    string
+	Code     string
+	ExpireAt time.Time
+}
+
+func hashResetCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func passwordResetCodeStore(conn skydb.Conn) (skydb.PasswordResetCodeStore, skyerr.Error) {
+	store, ok := conn.(skydb.PasswordResetCodeStore)
+	if !ok {
+		return nil, skyerr.NewError(skyerr.NotSupported, "resetting password is not supported by the database")
+	}
+	return store, nil
+}
+
+/*
+ForgotPasswordHandler emails a code to the user with the specified email
+for resetting the password with auth:reset_password. The code expires
+after the configured duration.
+
+The same result is returned whether or not a user has the email, so that
+the handler cannot be used to find out the emails of users.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "auth:forgot_password",
+    "email": "john.doe@example.com"
+}
+EOF
+*/
+type ForgotPasswordHandler struct {
+	Settings      *ForgotPasswordSettings `inject:"ForgotPasswordSettings"`
+	AccessKey     router.Processor        `preprocessor:"accesskey"`
+	Captcha       router.Processor        `preprocessor:"captcha"`
+	DBConn        router.Processor        `preprocessor:"dbconn"`
+	PluginReady   router.Processor        `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ForgotPasswordHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.Captcha,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *ForgotPasswordHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ForgotPasswordHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "email", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *ForgotPasswordHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	store, skyErr := passwordResetCodeStore(payload.DBConn)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	email := payload.Data["email"].(string)
+	info := skydb.UserInfo{}
+	if err := payload.DBConn.GetUserByUsernameEmail(ctx, "", email, &info); err == skydb.ErrUserNotFound {
+		log.WithField("email", email).Debugln("No user to send password reset code to")
+		response.Result = struct {
+			Status string `json:"status,omitempty"`
+		}{
+			"OK",
+		}
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	now := timeNow()
+	code := uuidNew()
+	resetCode := skydb.PasswordResetCode{
+		CodeHash:  hashResetCode(code),
+		UserID:    info.ID,
+		ExpireAt:  now.Add(h.Settings.CodeExpiry),
+		CreatedAt: now,
+	}
+	if err := store.SavePasswordResetCode(ctx, &resetCode); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	if err := h.Settings.Mailer.Send(h.Settings.Template, info.Email, forgotPasswordEmail{
+		AppName:  payload.AppName,
+		UserID:   info.ID,
+		Username: info.Username,
+		Email:    info.Email,
+		Code:     code,
+		ExpireAt: resetCode.ExpireAt,
+	}); err != nil {
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "failed to send password reset email")
+		return
+	}
+
+	response.Result = struct {
+		Status string `json:"status,omitempty"`
+	}{
+		"OK",
+	}
+}
+
+/*
+ResetPasswordHandler sets the password of a user with the code sent by
+auth:forgot_password. All codes of the user and all access tokens issued
+before are invalidated. A new access token is returned.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "auth:reset_password",
+    "code": "2d2f5c5c-8f5b-4a4b-9c53-3c8e3e5f2d4a",
+    "password": "new-password"
+}
+EOF
+*/
+type ResetPasswordHandler struct {
+	TokenStore    authtoken.Store     `inject:"TokenStore"`
+	FieldFilter   *fieldfilter.Filter `inject:"FieldFilter"`
+	AccessKey     router.Processor    `preprocessor:"accesskey"`
+	DBConn        router.Processor    `preprocessor:"dbconn"`
+	PluginReady   router.Processor    `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ResetPasswordHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *ResetPasswordHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ResetPasswordHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "code", Type: router.StringField, Required: true},
+		{Name: "password", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *ResetPasswordHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	store, skyErr := passwordResetCodeStore(payload.DBConn)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	resetCode := skydb.PasswordResetCode{}
+	err := store.GetPasswordResetCode(ctx, hashResetCode(payload.Data["code"].(string)), &resetCode)
+	if err == skydb.ErrPasswordResetCodeNotFound || (err == nil && resetCode.IsExpired(timeNow())) {
+		response.Err = skyerr.NewInvalidArgument("invalid or expired code", []string{"code"})
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	info := skydb.UserInfo{}
+	if err := payload.DBConn.GetUser(ctx, resetCode.UserID, &info); err != nil {
+		if err == skydb.ErrUserNotFound {
+			response.Err = skyerr.NewError(skyerr.ResourceNotFound, "user not found")
+		} else {
+			response.Err = skyerr.NewResourceFetchFailureErr("user", resetCode.UserID)
+		}
+		return
+	}
+
+	info.SetPassword(payload.Data["password"].(string))
+	if err := payload.DBConn.UpdateUser(ctx, &info); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if err := store.DeletePasswordResetCodes(ctx, info.ID); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	tokenStore := h.TokenStore
+	token, err := tokenStore.NewToken(payload.AppName, info.ID)
+	if err != nil {
+		panic(err)
+	}
+	if err = tokenStore.Put(&token); err != nil {
+		panic(err)
+	}
+
+	setUserResult(h.FieldFilter, payload, response, NewAuthResponse(info, token.AccessToken))
+}
@@ -0,0 +1,210 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/authtoken/authtokentest"
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/mail"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// passwordResetConn is a PasswordResetCodeStore keeping codes in memory.
+type passwordResetConn struct {
+	codes map[string]skydb.PasswordResetCode
+	*skydbtest.MapConn
+}
+
+func (conn *passwordResetConn) SavePasswordResetCode(code *skydb.PasswordResetCode) error {
+	conn.codes[code.CodeHash] = *code
+	return nil
+}
+
+func (conn *passwordResetConn) GetPasswordResetCode(codeHash string, code *skydb.PasswordResetCode) error {
+	resetCode, ok := conn.codes[codeHash]
+	if !ok {
+		return skydb.ErrPasswordResetCodeNotFound
+	}
+	*code = resetCode
+	return nil
+}
+
+func (conn *passwordResetConn) DeletePasswordResetCodes(userID string) error {
+	for codeHash, code := range conn.codes {
+		if code.UserID == userID {
+			delete(conn.codes, codeHash)
+		}
+	}
+	return nil
+}
+
+type fakeMailSender struct {
+	messages []mail.Message
+}
+
+func (s *fakeMailSender) Send(msg mail.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	Convey("ForgotPasswordHandler", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC) }
+		uuidNew = func() string { return "reset-code" }
+		defer func() {
+			timeNow = timeNowUTC
+			uuidNew = uuid.New
+		}()
+
+		conn := &passwordResetConn{
+			codes:   map[string]skydb.PasswordResetCode{},
+			MapConn: skydbtest.NewMapConn(),
+		}
+		userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
+		So(conn.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+		sender := &fakeMailSender{}
+		template, err := mail.NewTemplate(
+			"Reset password of {{.AppName}}",
+			"Hi {{.Username}}, your code is {{.Code}}.",
+		)
+		So(err, ShouldBeNil)
+
+		r := handlertest.NewSingleRouteRouter(&ForgotPasswordHandler{
+			Settings: &ForgotPasswordSettings{
+				Mailer:     &mail.Mailer{Sender: sender},
+				Template:   template,
+				CodeExpiry: time.Hour,
+			},
+		}, func(p *router.Payload) {
+			p.AppName = "myapp"
+			p.DBConn = conn
+		})
+
+		Convey("sends reset code", func() {
+			resp := r.POST(`{"email": "john.doe@example.com"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": {"status": "OK"}}`)
+			So(sender.messages, ShouldResemble, []mail.Message{
+				{
+					To:      "john.doe@example.com",
+					Subject: "Reset password of myapp",
+					Body:    "Hi john.doe, your code is reset-code.",
+				},
+			})
+			So(conn.codes, ShouldResemble, map[string]skydb.PasswordResetCode{
+				hashResetCode("reset-code"): {
+					CodeHash:  hashResetCode("reset-code"),
+					UserID:    userinfo.ID,
+					ExpireAt:  time.Date(2017, 2, 20, 9, 0, 0, 0, time.UTC),
+					CreatedAt: time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC),
+				},
+			})
+		})
+
+		Convey("does not reveal email without user", func() {
+			resp := r.POST(`{"email": "jane.doe@example.com"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": {"status": "OK"}}`)
+			So(sender.messages, ShouldBeEmpty)
+			So(conn.codes, ShouldBeEmpty)
+		})
+
+		Convey("rejects missing email", func() {
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	Convey("ResetPasswordHandler", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = timeNowUTC
+		}()
+
+		conn := &passwordResetConn{
+			codes:   map[string]skydb.PasswordResetCode{},
+			MapConn: skydbtest.NewMapConn(),
+		}
+		userinfo := skydb.NewUserInfo("john.doe", "john.doe@example.com", "secret")
+		So(conn.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+		conn.SavePasswordResetCode(&skydb.PasswordResetCode{
+			CodeHash: hashResetCode("valid-code"),
+			UserID:   userinfo.ID,
+			ExpireAt: time.Date(2017, 2, 20, 9, 0, 0, 0, time.UTC),
+		})
+		conn.SavePasswordResetCode(&skydb.PasswordResetCode{
+			CodeHash: hashResetCode("expired-code"),
+			UserID:   userinfo.ID,
+			ExpireAt: time.Date(2017, 2, 20, 7, 0, 0, 0, time.UTC),
+		})
+
+		tokenStore := authtokentest.SingleTokenStore{}
+		r := handlertest.NewSingleRouteRouter(&ResetPasswordHandler{
+			TokenStore: &tokenStore,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("resets password with code", func() {
+			resp := r.POST(`{"code": "valid-code", "password": "new-secret"}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(resp.Body.Bytes(), ShouldEqualJSON, fmt.Sprintf(`{
+				"result": {
+					"user_id": "%s",
+					"username": "john.doe",
+					"email": "john.doe@example.com",
+					"access_token": "%s"
+				}
+			}`, userinfo.ID, tokenStore.Token.AccessToken))
+
+			updated := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), userinfo.ID, &updated), ShouldBeNil)
+			So(updated.IsSamePassword("new-secret"), ShouldBeTrue)
+			So(conn.codes, ShouldBeEmpty)
+		})
+
+		Convey("rejects expired code", func() {
+			resp := r.POST(`{"code": "expired-code", "password": "new-secret"}`)
+			So(resp.Code, ShouldEqual, 400)
+
+			updated := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), userinfo.ID, &updated), ShouldBeNil)
+			So(updated.IsSamePassword("secret"), ShouldBeTrue)
+		})
+
+		Convey("rejects unknown code", func() {
+			resp := r.POST(`{"code": "unknown-code", "password": "new-secret"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"info": {"arguments": ["code"]},
+					"message": "invalid or expired code"
+				}
+			}`)
+		})
+	})
+}
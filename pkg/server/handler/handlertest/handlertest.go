@@ -40,7 +40,7 @@ type FuncProcessor struct {
 	Mockfunc func(*router.Payload)
 }
 
-func (p FuncProcessor) Preprocess(payload *router.Payload, _ *router.Response) int {
+func (p FuncProcessor) Preprocess(ctx context.Context, payload *router.Payload, _ *router.Response) int {
 	p.Mockfunc(payload)
 	return http.StatusOK
 }
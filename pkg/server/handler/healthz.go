@@ -15,6 +15,8 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/skygeario/skygear-server/pkg/server/router"
 )
 
@@ -37,7 +39,7 @@ func (h *HealthzHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *HealthzHandler) Handle(playload *router.Payload, response *router.Response) {
+func (h *HealthzHandler) Handle(ctx context.Context, playload *router.Payload, response *router.Response) {
 	var (
 		rep healthStatusResponse
 	)
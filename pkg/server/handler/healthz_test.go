@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -27,7 +28,7 @@ func TestHealthzHandler(t *testing.T) {
 		resp := router.Response{}
 
 		handler := &HealthzHandler{}
-		handler.Handle(&req, &resp)
+		handler.Handle(context.Background(), &req, &resp)
 		So(resp.Result, ShouldHaveSameTypeAs, healthStatusResponse{})
 		s := resp.Result.(healthStatusResponse)
 		So(s.Status, ShouldEqual, "OK")
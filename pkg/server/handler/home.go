@@ -15,6 +15,8 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/skygeario/skygear-server/pkg/server/router"
 )
 
@@ -34,7 +36,7 @@ func (h *HomeHandler) GetPreprocessors() []router.Processor {
 	return nil
 }
 
-func (h *HomeHandler) Handle(playload *router.Payload, response *router.Response) {
+func (h *HomeHandler) Handle(ctx context.Context, playload *router.Payload, response *router.Response) {
 	var (
 		rep statusResponse
 	)
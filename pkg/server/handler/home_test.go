@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -27,7 +28,7 @@ func TestHomeHandler(t *testing.T) {
 		resp := router.Response{}
 
 		handler := &HomeHandler{}
-		handler.Handle(&req, &resp)
+		handler.Handle(context.Background(), &req, &resp)
 		So(resp.Result, ShouldHaveSameTypeAs, statusResponse{})
 		s := resp.Result.(statusResponse)
 		So(s.Status, ShouldEqual, "OK")
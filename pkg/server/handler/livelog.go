@@ -0,0 +1,133 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/livelog"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type liveLogStatus struct {
+	LevelUntil *time.Time        `json:"level_until,omitempty"`
+	Captures   []livelog.Capture `json:"captures"`
+}
+
+func newLiveLogStatus(c *livelog.Controller) liveLogStatus {
+	levelUntil, captures := c.Status()
+	status := liveLogStatus{
+		Captures: captures,
+	}
+	if !levelUntil.IsZero() {
+		status.LevelUntil = &levelUntil
+	}
+	return status
+}
+
+/*
+LiveLogSetHandler changes the logging of the server for a number of
+minutes, after which the change is reverted. The log level of all
+loggers is changed if level is specified. The request and response
+bodies of requests are logged at info level if capture_action or
+capture_user_id is specified, for requests of the action and by the
+user respectively. Master key is required.
+
+The change is not shared with other server processes.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "log:set",
+    "api_key": "MASTER_KEY",
+    "level": "debug",
+    "capture_action": "record:save",
+    "capture_user_id": "5a9e5e8b-8f4d-4e8a-9a5b-1c2d3e4f5a6b",
+    "minutes": 15
+}
+EOF
+*/
+type LiveLogSetHandler struct {
+	LiveLog       *livelog.Controller `inject:"LiveLogController"`
+	AccessKey     router.Processor    `preprocessor:"accesskey"`
+	preprocessors []router.Processor
+}
+
+func (h *LiveLogSetHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+	}
+}
+
+func (h *LiveLogSetHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *LiveLogSetHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "level", Type: router.StringField},
+		{Name: "capture_action", Type: router.StringField},
+		{Name: "capture_user_id", Type: router.StringField},
+		{Name: "minutes", Type: router.NumberField, Required: true},
+	}
+}
+
+func (h *LiveLogSetHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "changing logging requires master key")
+		return
+	}
+
+	minutes := payload.Data["minutes"].(float64)
+	if minutes <= 0 {
+		response.Err = skyerr.NewInvalidArgument("minutes must be positive", []string{"minutes"})
+		return
+	}
+	duration := time.Duration(minutes * float64(time.Minute))
+
+	levelName, _ := payload.Data["level"].(string)
+	captureAction, _ := payload.Data["capture_action"].(string)
+	captureUserID, _ := payload.Data["capture_user_id"].(string)
+	if levelName == "" && captureAction == "" && captureUserID == "" {
+		response.Err = skyerr.NewInvalidArgument(
+			"level, capture_action or capture_user_id is required",
+			[]string{"level", "capture_action", "capture_user_id"},
+		)
+		return
+	}
+
+	var level logrus.Level
+	if levelName != "" {
+		var err error
+		if level, err = logrus.ParseLevel(levelName); err != nil {
+			response.Err = skyerr.NewInvalidArgument(err.Error(), []string{"level"})
+			return
+		}
+	}
+
+	if levelName != "" {
+		h.LiveLog.SetLevel(level, duration)
+	}
+	if captureAction != "" || captureUserID != "" {
+		h.LiveLog.AddCapture(captureAction, captureUserID, duration)
+		log.Infof("capturing request bodies of action %q and user %q for %v", captureAction, captureUserID, duration)
+	}
+
+	response.Result = newLiveLogStatus(h.LiveLog)
+}
@@ -0,0 +1,86 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/livelog"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLiveLogSetHandler(t *testing.T) {
+	Convey("LiveLogSetHandler", t, func() {
+		c := &livelog.Controller{}
+		r := handlertest.NewSingleRouteRouter(&LiveLogSetHandler{
+			LiveLog: c,
+		}, func(p *router.Payload) {
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		capturing := func(action string, userID string) bool {
+			return c.ShouldCapture(&router.Payload{
+				Data:       map[string]interface{}{"action": action},
+				UserInfoID: userID,
+			})
+		}
+
+		Convey("captures requests of action and user", func() {
+			resp := r.POST(`{
+				"capture_action": "record:save",
+				"capture_user_id": "user0",
+				"minutes": 15
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(capturing("record:save", "user0"), ShouldBeTrue)
+			So(capturing("record:save", "user1"), ShouldBeFalse)
+			So(capturing("record:query", "user0"), ShouldBeFalse)
+
+			_, captures := c.Status()
+			So(captures, ShouldHaveLength, 1)
+		})
+
+		Convey("rejects unknown level", func() {
+			resp := r.POST(`{"level": "verbose", "minutes": 15}`)
+			So(resp.Code, ShouldEqual, 400)
+
+			levelUntil, _ := c.Status()
+			So(levelUntil.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("rejects request without changes", func() {
+			resp := r.POST(`{"minutes": 15}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+
+		Convey("rejects non-positive duration", func() {
+			resp := r.POST(`{"capture_action": "record:save", "minutes": 0}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(capturing("record:save", ""), ShouldBeFalse)
+		})
+
+		Convey("rejects request without master key", func() {
+			r := handlertest.NewSingleRouteRouter(&LiveLogSetHandler{
+				LiveLog: c,
+			}, func(p *router.Payload) {})
+
+			resp := r.POST(`{"capture_action": "record:save", "minutes": 15}`)
+			So(resp.Code, ShouldEqual, 403)
+			So(capturing("record:save", ""), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/skygeario/skygear-server/pkg/server/maintenance"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type maintenanceStatus struct {
+	Mode    maintenance.Mode `json:"mode"`
+	Message string           `json:"message,omitempty"`
+}
+
+func newMaintenanceStatus(s *maintenance.Switch) maintenanceStatus {
+	mode, message := s.Status()
+	return maintenanceStatus{
+		Mode:    mode,
+		Message: message,
+	}
+}
+
+/*
+MaintenanceSetHandler changes the maintenance mode of the server at
+runtime. In read_only mode, only actions that do not modify data are
+served. In full mode, no actions are served. Requests with master key
+are always served. Master key is required.
+
+The mode is not shared with other server processes.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "maintenance:set",
+    "api_key": "MASTER_KEY",
+    "mode": "read_only",
+    "message": "Upgrading database, back at 10:00 UTC"
+}
+EOF
+*/
+type MaintenanceSetHandler struct {
+	Maintenance   *maintenance.Switch `inject:"MaintenanceSwitch"`
+	AccessKey     router.Processor    `preprocessor:"accesskey"`
+	preprocessors []router.Processor
+}
+
+func (h *MaintenanceSetHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+	}
+}
+
+func (h *MaintenanceSetHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *MaintenanceSetHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "mode", Type: router.StringField, Required: true},
+		{Name: "message", Type: router.StringField},
+	}
+}
+
+func (h *MaintenanceSetHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "setting maintenance mode requires master key")
+		return
+	}
+
+	mode, err := maintenance.ParseMode(payload.Data["mode"].(string))
+	if err != nil {
+		response.Err = skyerr.NewInvalidArgument(err.Error(), []string{"mode"})
+		return
+	}
+	message, _ := payload.Data["message"].(string)
+
+	h.Maintenance.Set(mode, message)
+	log.Infof("maintenance mode set to %s", mode)
+
+	response.Result = newMaintenanceStatus(h.Maintenance)
+}
+
+/*
+MaintenanceStatusHandler returns the maintenance mode of the server.
+Master key is required.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "maintenance:status",
+    "api_key": "MASTER_KEY"
+}
+EOF
+*/
+type MaintenanceStatusHandler struct {
+	Maintenance   *maintenance.Switch `inject:"MaintenanceSwitch"`
+	AccessKey     router.Processor    `preprocessor:"accesskey"`
+	preprocessors []router.Processor
+}
+
+func (h *MaintenanceStatusHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+	}
+}
+
+func (h *MaintenanceStatusHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *MaintenanceStatusHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "fetching maintenance mode requires master key")
+		return
+	}
+
+	response.Result = newMaintenanceStatus(h.Maintenance)
+}
@@ -0,0 +1,92 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/maintenance"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMaintenanceSetHandler(t *testing.T) {
+	Convey("MaintenanceSetHandler", t, func() {
+		s := &maintenance.Switch{}
+		r := handlertest.NewSingleRouteRouter(&MaintenanceSetHandler{
+			Maintenance: s,
+		}, func(p *router.Payload) {
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("sets mode and message", func() {
+			resp := r.POST(`{
+				"mode": "read_only",
+				"message": "upgrading"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"mode": "read_only",
+					"message": "upgrading"
+				}
+			}`)
+
+			mode, message := s.Status()
+			So(mode, ShouldEqual, maintenance.ReadOnly)
+			So(message, ShouldEqual, "upgrading")
+		})
+
+		Convey("rejects unknown mode", func() {
+			resp := r.POST(`{"mode": "partial"}`)
+			So(resp.Code, ShouldEqual, 400)
+
+			mode, _ := s.Status()
+			So(mode, ShouldEqual, maintenance.Off)
+		})
+
+		Convey("rejects request without master key", func() {
+			r := handlertest.NewSingleRouteRouter(&MaintenanceSetHandler{
+				Maintenance: s,
+			}, func(p *router.Payload) {})
+
+			resp := r.POST(`{"mode": "full"}`)
+			So(resp.Code, ShouldEqual, 403)
+
+			mode, _ := s.Status()
+			So(mode, ShouldEqual, maintenance.Off)
+		})
+	})
+}
+
+func TestMaintenanceStatusHandler(t *testing.T) {
+	Convey("MaintenanceStatusHandler", t, func() {
+		s := &maintenance.Switch{}
+		s.Set(maintenance.Full, "")
+		r := handlertest.NewSingleRouteRouter(&MaintenanceStatusHandler{
+			Maintenance: s,
+		}, func(p *router.Payload) {
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		resp := r.POST(`{}`)
+		So(resp.Body.Bytes(), ShouldEqualJSON, `{
+			"result": {
+				"mode": "full"
+			}
+		}`)
+	})
+}
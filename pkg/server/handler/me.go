@@ -15,18 +15,22 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 // MeHandler handles the me request
 type MeHandler struct {
-	TokenStore    authtoken.Store  `inject:"TokenStore"`
-	Authenticator router.Processor `preprocessor:"authenticator"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
-	InjectUser    router.Processor `preprocessor:"inject_user"`
-	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	TokenStore    authtoken.Store     `inject:"TokenStore"`
+	FieldFilter   *fieldfilter.Filter `inject:"FieldFilter"`
+	Authenticator router.Processor    `preprocessor:"authenticator"`
+	DBConn        router.Processor    `preprocessor:"dbconn"`
+	InjectUser    router.Processor    `preprocessor:"inject_user"`
+	PluginReady   router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -60,7 +64,7 @@ func (h *MeHandler) GetPreprocessors() []router.Processor {
 //   "last_seen_at": "2016-09-08T07:15:18.026567355Z",
 //   "roles": []
 // }
-func (h *MeHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *MeHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	info := payload.UserInfo
 	if info == nil {
 		response.Err = skyerr.NewError(skyerr.NotAuthenticated, "Authentication is needed to get current user")
@@ -87,10 +91,10 @@ func (h *MeHandler) Handle(payload *router.Payload, response *router.Response) {
 	// Populate the activity time to user
 	now := timeNow()
 	info.LastSeenAt = &now
-	if err := payload.DBConn.UpdateUser(info); err != nil {
+	if err := payload.DBConn.UpdateUser(ctx, info); err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
 
-	response.Result = authResponse
+	setUserResult(h.FieldFilter, payload, response, authResponse)
 }
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -46,7 +47,7 @@ func TestMeHandler(t *testing.T) {
 			LastLoginAt: &lastHour,
 			LastSeenAt:  &lastHour,
 		}
-		conn.CreateUser(&userinfo)
+		conn.CreateUser(context.Background(), &userinfo)
 
 		tokenStore := &authtokentest.SingleTokenStore{}
 		handler := &MeHandler{
@@ -78,7 +79,7 @@ func TestMeHandler(t *testing.T) {
 				lastHour.Format(time.RFC3339Nano),
 			))
 			updateInfo := skydb.UserInfo{}
-			conn.GetUser("tester-1", &updateInfo)
+			conn.GetUser(context.Background(), "tester-1", &updateInfo)
 			So(updateInfo.LastSeenAt, ShouldNotEqual, lastHour)
 		})
 
@@ -0,0 +1,38 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var recordOperationCounter = metrics.NewCounter(
+	"skygear_record_operations_total",
+	"Number of records created, updated, deleted and queried by record type.",
+	"record_type", "operation",
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(recordOperationCounter)
+}
+
+// observeRecordActivities counts the activities by record type and
+// operation.
+func observeRecordActivities(activities []skydb.RecordActivity) {
+	for _, activity := range activities {
+		recordOperationCounter.Inc(activity.RecordType, string(activity.Operation))
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
+)
+
+// isHiddenByModeration returns whether record is hidden from the user of
+// the request by moderation. Nothing is hidden with the master key.
+func isHiddenByModeration(pipeline *moderation.Pipeline, payload *router.Payload, record *skydb.Record) bool {
+	if pipeline == nil || payload.HasMasterKey() {
+		return false
+	}
+	return pipeline.IsHidden(record, payload.UserInfo)
+}
+
+/*
+ModerationReviewHandler sets the moderation status of records to Verdict.
+It is mapped to moderation:approve with moderation.Approved, and to
+moderation:reject with moderation.Rejected. Master key is required.
+
+The records are saved like record:save, so that the hooks of the record
+types are executed. The reviewing user, if any, is recorded as the
+updater; a review with master key only has no updater.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "moderation:approve",
+    "api_key": "MASTER_KEY",
+    "access_token": "validToken",
+    "database_id": "_public",
+    "ids": ["note/1004", "note/1005"]
+}
+EOF
+*/
+type ModerationReviewHandler struct {
+	Verdict       moderation.Verdict
+	HookRegistry  *hook.Registry       `inject:"HookRegistry"`
+	AssetStore    asset.Store          `inject:"AssetStore"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	RecordStats   *stats.Recorder      `inject:"RecordStats"`
+	Authenticator router.Processor     `preprocessor:"authenticator"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	InjectUser    router.Processor     `preprocessor:"inject_user"`
+	InjectDB      router.Processor     `preprocessor:"inject_db"`
+	PluginReady   router.Processor     `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *ModerationReviewHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.PluginReady,
+	}
+}
+
+func (h *ModerationReviewHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *ModerationReviewHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "no permission to moderate records")
+		return
+	}
+
+	p := &recordFetchPayload{}
+	skyErr := p.Decode(payload.Data)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	db := payload.Database
+	if db.IsReadOnly() {
+		response.Err = skyerr.NewError(skyerr.NotSupported, "modifying the selected database is not supported")
+		return
+	}
+
+	// A review does not create records, the records must exist already.
+	errMap := map[skydb.RecordID]skyerr.Error{}
+	recordsToSave := []*skydb.Record{}
+	for _, recordID := range p.RecordIDs {
+		var dbRecord skydb.Record
+		if err := db.Get(ctx, recordID, &dbRecord); err == skydb.ErrRecordNotFound {
+			errMap[recordID] = skyerr.NewError(skyerr.ResourceNotFound, "record not found")
+			continue
+		} else if err != nil {
+			errMap[recordID] = skyerr.MakeError(err)
+			continue
+		}
+
+		record := &skydb.Record{ID: recordID}
+		h.Moderation.SetStatus(record, h.Verdict)
+		recordsToSave = append(recordsToSave, record)
+	}
+
+	req := recordModifyRequest{
+		Db:            db,
+		Conn:          payload.DBConn,
+		AssetStore:    h.AssetStore,
+		HookRegistry:  h.HookRegistry,
+		UserInfo:      payload.UserInfo,
+		RecordsToSave: recordsToSave,
+		RecordStats:   h.RecordStats,
+		WithMasterKey: true,
+		Context:       moderation.WithReview(ctx, h.Verdict),
+	}
+	resp := recordModifyResponse{
+		ErrMap: errMap,
+	}
+	if err := recordSaveHandler(&req, &resp); err != nil {
+		response.Err = err
+		return
+	}
+
+	savedRecordMap := map[skydb.RecordID]*skydb.Record{}
+	for _, record := range resp.SavedRecords {
+		savedRecordMap[record.ID] = record
+	}
+
+	results := make([]interface{}, p.ItemLen())
+	for i, recordID := range p.RecordIDs {
+		if err, ok := resp.ErrMap[recordID]; ok {
+			results[i] = newSerializedError(recordID.String(), err)
+		} else {
+			results[i] = (*skyconv.JSONRecord)(savedRecordMap[recordID])
+		}
+	}
+
+	response.Result = results
+}
@@ -0,0 +1,195 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModerationReviewHandler(t *testing.T) {
+	timeNow = func() time.Time { return ZeroTime }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("ModerationReviewHandler", t, func() {
+		db := skydbtest.NewMapDB()
+		db.Save(context.Background(), &skydb.Record{
+			ID:   skydb.NewRecordID("note", "pending"),
+			Data: skydb.Data{"content": "hello", "moderation_status": "pending"},
+		})
+
+		pipeline := &moderation.Pipeline{
+			Fields: map[string][]string{"note": []string{"content"}},
+		}
+		registry := hook.NewRegistry()
+		registry.Register(hook.BeforeSave, "note", pipeline.BeforeSave)
+
+		accessKey := router.MasterAccessKey
+		userInfo := &skydb.UserInfo{ID: "moderator"}
+		r := handlertest.NewSingleRouteRouter(&ModerationReviewHandler{
+			Verdict:      moderation.Approved,
+			HookRegistry: registry,
+			Moderation:   pipeline,
+		}, func(p *router.Payload) {
+			p.Database = db
+			p.AccessKey = accessKey
+			p.UserInfo = userInfo
+		})
+
+		Convey("approves record", func() {
+			resp := r.POST(`{"ids": ["note/pending", "note/notexist"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/pending",
+					"_type": "record",
+					"_access": null,
+					"_updated_by": "moderator",
+					"moderation_status": "approved"
+				}, {
+					"_id": "note/notexist",
+					"_type": "error",
+					"code": 110,
+					"message": "record not found",
+					"name": "ResourceNotFound"
+				}]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "pending"), &record), ShouldBeNil)
+			So(pipeline.IsHidden(&record, nil), ShouldBeFalse)
+			So(record.UpdaterID, ShouldEqual, "moderator")
+		})
+
+		Convey("approves record with master key only", func() {
+			userInfo = nil
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/pending",
+					"_type": "record",
+					"_access": null,
+					"moderation_status": "approved"
+				}]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "pending"), &record), ShouldBeNil)
+			So(pipeline.IsHidden(&record, nil), ShouldBeFalse)
+			So(record.UpdaterID, ShouldEqual, "")
+		})
+
+		Convey("executes save hooks", func() {
+			var hooked *skydb.Record
+			registry.Register(hook.AfterSave, "note", func(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
+				hooked = record
+				return nil
+			})
+
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(hooked, ShouldNotBeNil)
+			So(hooked.Data["moderation_status"], ShouldEqual, "approved")
+		})
+
+		Convey("requires master key", func() {
+			accessKey = router.ClientAccessKey
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Code, ShouldEqual, 403)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "pending"), &record), ShouldBeNil)
+			So(pipeline.IsHidden(&record, nil), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRecordFetchHiddenByModeration(t *testing.T) {
+	Convey("RecordFetchHandler with moderation", t, func() {
+		db := skydbtest.NewMapDB()
+		db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "pending"),
+			OwnerID: "owner",
+			Data:    skydb.Data{"content": "hello", "moderation_status": "pending"},
+		})
+
+		accessKey := router.ClientAccessKey
+		userInfo := &skydb.UserInfo{ID: "user0"}
+		r := handlertest.NewSingleRouteRouter(&RecordFetchHandler{
+			Moderation: &moderation.Pipeline{
+				Fields: map[string][]string{"note": []string{"content"}},
+			},
+		}, func(p *router.Payload) {
+			p.Database = db
+			p.AccessKey = accessKey
+			p.UserInfo = userInfo
+		})
+
+		Convey("hides pending record from users", func() {
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/pending",
+					"_type": "error",
+					"code": 110,
+					"message": "record not found",
+					"name": "ResourceNotFound"
+				}]
+			}`)
+		})
+
+		Convey("shows pending record with master key", func() {
+			accessKey = router.MasterAccessKey
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/pending",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "owner",
+					"content": "hello",
+					"moderation_status": "pending"
+				}]
+			}`)
+		})
+
+		Convey("shows pending record to its owner", func() {
+			userInfo = &skydb.UserInfo{ID: "owner"}
+			resp := r.POST(`{"ids": ["note/pending"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/pending",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "owner",
+					"content": "hello",
+					"moderation_status": "pending"
+				}]
+			}`)
+		})
+	})
+}
@@ -15,19 +15,25 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
+// PubSubHandler upgrades the request to a websocket connection of the
+// pubsub endpoint. The API key or access token of the request decides
+// the channels the connection may subscribe and publish on.
 type PubSubHandler struct {
 	WebSocket     *pubsub.WsPubSub
-	AccessKey     router.Processor `preprocessor:"accesskey"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
 	preprocessors []router.Processor
 }
 
 func (h *PubSubHandler) Setup() {
 	h.preprocessors = []router.Processor{
-		h.AccessKey,
+		h.Authenticator,
 	}
 }
 
@@ -35,12 +41,128 @@ func (h *PubSubHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *PubSubHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *PubSubHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	writer := response.Writer()
 	if writer == nil {
 		// The response is already written.
 		return
 	}
 
-	h.WebSocket.Handle(writer, payload.Req)
+	h.WebSocket.Handle(writer, payload.Req, pubsub.Client{
+		UserID:    payload.UserInfoID,
+		MasterKey: payload.HasMasterKey(),
+	})
+}
+
+/*
+PubSubSetRulesHandler replaces the rules deciding who may subscribe and
+publish on channels of the pubsub endpoint. Rules are matched by channel
+pattern in order. Channels not matching any rules use the default
+configured by PUBSUB_SUBSCRIBE and PUBSUB_PUBLISH. Access is one of
+none, key, user or master. Master key is required.
+
+The rules are not shared with other server processes, and are replaced
+by PUBSUB_RULES on restart.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "pubsub:set_rules",
+    "api_key": "MASTER_KEY",
+    "rules": [
+        {"pattern": "chat/*", "subscribe": "user", "publish": "user"},
+        {"pattern": "announcement", "subscribe": "key", "publish": "master"}
+    ]
+}
+EOF
+*/
+type PubSubSetRulesHandler struct {
+	ACL           *pubsub.ACL      `inject:"PubSubACL"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	preprocessors []router.Processor
+}
+
+func (h *PubSubSetRulesHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+	}
+}
+
+func (h *PubSubSetRulesHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PubSubSetRulesHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "rules", Type: router.ArrayField, Required: true},
+	}
+}
+
+func (h *PubSubSetRulesHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "setting pubsub rules requires master key")
+		return
+	}
+
+	rules := []pubsub.Rule{}
+	for _, rawRule := range payload.Data["rules"].([]interface{}) {
+		m, ok := rawRule.(map[string]interface{})
+		if !ok {
+			response.Err = skyerr.NewInvalidArgument("rules must be objects", []string{"rules"})
+			return
+		}
+		pattern, _ := m["pattern"].(string)
+		subscribe, _ := m["subscribe"].(string)
+		publish, _ := m["publish"].(string)
+		rules = append(rules, pubsub.Rule{
+			Pattern:   pattern,
+			Subscribe: pubsub.Access(subscribe),
+			Publish:   pubsub.Access(publish),
+		})
+	}
+
+	if err := h.ACL.SetRules(rules); err != nil {
+		response.Err = skyerr.NewInvalidArgument(err.Error(), []string{"rules"})
+		return
+	}
+	log.Infof("pubsub rules set to %v", rules)
+
+	response.Result = h.ACL.Rules()
+}
+
+/*
+PubSubRulesHandler returns the rules deciding who may subscribe and
+publish on channels of the pubsub endpoint. Master key is required.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "pubsub:get_rules",
+    "api_key": "MASTER_KEY"
+}
+EOF
+*/
+type PubSubRulesHandler struct {
+	ACL           *pubsub.ACL      `inject:"PubSubACL"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	preprocessors []router.Processor
+}
+
+func (h *PubSubRulesHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+	}
+}
+
+func (h *PubSubRulesHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PubSubRulesHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "fetching pubsub rules requires master key")
+		return
+	}
+
+	response.Result = h.ACL.Rules()
 }
@@ -0,0 +1,93 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPubSubSetRulesHandler(t *testing.T) {
+	Convey("PubSubSetRulesHandler", t, func() {
+		acl := &pubsub.ACL{
+			Subscribe: pubsub.AccessKey,
+			Publish:   pubsub.AccessUser,
+		}
+		r := handlertest.NewSingleRouteRouter(&PubSubSetRulesHandler{
+			ACL: acl,
+		}, func(p *router.Payload) {
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("sets rules", func() {
+			resp := r.POST(`{
+				"rules": [
+					{"pattern": "announcement", "subscribe": "key", "publish": "master"}
+				]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [
+					{"pattern": "announcement", "subscribe": "key", "publish": "master"}
+				]
+			}`)
+			So(acl.CanPublish(pubsub.Client{UserID: "user0"}, "announcement"), ShouldBeFalse)
+		})
+
+		Convey("rejects malformed rules", func() {
+			resp := r.POST(`{
+				"rules": [
+					{"pattern": "announcement", "subscribe": "key", "publish": "anyone"}
+				]
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(acl.Rules(), ShouldBeEmpty)
+		})
+
+		Convey("rejects request without master key", func() {
+			r := handlertest.NewSingleRouteRouter(&PubSubSetRulesHandler{
+				ACL: acl,
+			}, func(p *router.Payload) {})
+
+			resp := r.POST(`{"rules": []}`)
+			So(resp.Code, ShouldEqual, 403)
+		})
+	})
+}
+
+func TestPubSubRulesHandler(t *testing.T) {
+	Convey("PubSubRulesHandler", t, func() {
+		acl := &pubsub.ACL{}
+		acl.SetRules([]pubsub.Rule{
+			{Pattern: "chat/*", Subscribe: pubsub.AccessUser, Publish: pubsub.AccessUser},
+		})
+		r := handlertest.NewSingleRouteRouter(&PubSubRulesHandler{
+			ACL: acl,
+		}, func(p *router.Payload) {
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		resp := r.POST(`{}`)
+		So(resp.Body.Bytes(), ShouldEqualJSON, `{
+			"result": [
+				{"pattern": "chat/*", "subscribe": "user", "publish": "user"}
+			]
+		}`)
+	})
+}
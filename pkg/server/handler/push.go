@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -23,11 +24,41 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
+// PushAccess is who can send notifications with push:user and
+// push:device.
+type PushAccess string
+
+// The accesses of the push handlers. An empty PushAccess is the same as
+// PushAccessKey.
+const (
+	// PushAccessKey allows any request with an API key.
+	PushAccessKey PushAccess = "key"
+	// PushAccessUser allows authenticated users and the master key.
+	PushAccessUser PushAccess = "user"
+	// PushAccessMaster allows only the master key.
+	PushAccessMaster PushAccess = "master"
+)
+
+func checkPushAccess(access PushAccess, payload *router.Payload) skyerr.Error {
+	switch access {
+	case PushAccessMaster:
+		if !payload.HasMasterKey() {
+			return skyerr.NewError(skyerr.PermissionDenied, "sending push notifications requires master key")
+		}
+	case PushAccessUser:
+		if !payload.HasMasterKey() && payload.UserInfo == nil {
+			return skyerr.NewError(skyerr.NotAuthenticated, "sending push notifications requires an authenticated user")
+		}
+	}
+	return nil
+}
+
 // Remarks: this variable is for mocking in test cases
-var sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
-	go func() {
+var sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
+	err := queue.Enqueue(priority, func() {
 		log.Infof("Sending notification to device token = %s", device.Token)
 		err := sender.Send(m, device)
 
@@ -36,7 +67,10 @@ var sendPushNotification = func(sender push.Sender, device skydb.Device, m push.
 		} else {
 			log.Infof("Sent notification to device token = %s", device.Token)
 		}
-	}()
+	})
+	if err != nil {
+		log.Warnf("Failed to queue notification to device token = %s: %v", device.Token, err)
+	}
 }
 
 type sendPushResponseItem struct {
@@ -72,6 +106,8 @@ type pushToUserPayload struct {
 	UserIDs      []string               `mapstructure:"user_ids"`
 	Topic        string                 `mapstructure:"topic"`
 	Notification map[string]interface{} `mapstructure:"notification"`
+	RawPriority  string                 `mapstructure:"priority"`
+	Priority     workqueue.Priority
 }
 
 func (payload *pushToUserPayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -88,13 +124,26 @@ func (payload *pushToUserPayload) Validate() skyerr.Error {
 	if payload.Notification == nil {
 		return skyerr.NewInvalidArgument("no notification specified", []string{"notification"})
 	}
+	priority, err := workqueue.ParsePriority(payload.RawPriority)
+	if err != nil {
+		return skyerr.NewInvalidArgument(err.Error(), []string{"priority"})
+	}
+	payload.Priority = priority
 	return nil
 }
 
+// PushToUserHandler sends the notification to the devices of the users.
+// The optional "priority" is the class of the notification in the push
+// queue, i.e. "critical" for notifications such as one-time passwords,
+// "normal" (the default) or "bulk". Access decides who can send
+// notifications.
 type PushToUserHandler struct {
+	Access             PushAccess
 	NotificationSender push.Sender      `inject:"PushSender"`
-	AccessKey          router.Processor `preprocessor:"accesskey"`
+	Queue              *workqueue.Queue `inject:"PushQueue"`
+	Authenticator      router.Processor `preprocessor:"authenticator"`
 	DBConn             router.Processor `preprocessor:"dbconn"`
+	InjectUser         router.Processor `preprocessor:"inject_user"`
 	InjectDB           router.Processor `preprocessor:"inject_db"`
 	Notification       router.Processor `preprocessor:"notification"`
 	PluginReady        router.Processor `preprocessor:"plugin_ready"`
@@ -103,8 +152,9 @@ type PushToUserHandler struct {
 
 func (h *PushToUserHandler) Setup() {
 	h.preprocessors = []router.Processor{
-		h.AccessKey,
+		h.Authenticator,
 		h.DBConn,
+		h.InjectUser,
 		h.InjectDB,
 		h.Notification,
 		h.PluginReady,
@@ -115,7 +165,12 @@ func (h *PushToUserHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *PushToUserHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *PushToUserHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	if err := checkPushAccess(h.Access, rpayload); err != nil {
+		response.Err = err
+		return
+	}
+
 	payload := pushToUserPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -131,9 +186,9 @@ func (h *PushToUserHandler) Handle(rpayload *router.Payload, response *router.Re
 		var err error
 
 		if payload.Topic != "" {
-			devices, err = conn.QueryDevicesByUserAndTopic(userID, payload.Topic)
+			devices, err = conn.QueryDevicesByUserAndTopic(ctx, userID, payload.Topic)
 		} else {
-			devices, err = conn.QueryDevicesByUser(userID)
+			devices, err = conn.QueryDevicesByUser(ctx, userID)
 		}
 
 		if err != nil {
@@ -146,7 +201,7 @@ func (h *PushToUserHandler) Handle(rpayload *router.Payload, response *router.Re
 				if _, ok := deviceIDs[device.Token]; !ok {
 					deviceIDs[device.Token] = true
 					pushMap := push.MapMapper(payload.Notification)
-					sendPushNotification(h.NotificationSender, device, pushMap)
+					sendPushNotification(h.Queue, payload.Priority, h.NotificationSender, device, pushMap)
 				}
 			}
 		}
@@ -158,6 +213,8 @@ type pushToDevicePayload struct {
 	DeviceIDs    []string               `mapstructure:"device_ids"`
 	Topic        string                 `mapstructure:"topic"`
 	Notification map[string]interface{} `mapstructure:"notification"`
+	RawPriority  string                 `mapstructure:"priority"`
+	Priority     workqueue.Priority
 }
 
 func (payload *pushToDevicePayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -174,13 +231,23 @@ func (payload *pushToDevicePayload) Validate() skyerr.Error {
 	if payload.Notification == nil {
 		return skyerr.NewInvalidArgument("no notification specified", []string{"notification"})
 	}
+	priority, err := workqueue.ParsePriority(payload.RawPriority)
+	if err != nil {
+		return skyerr.NewInvalidArgument(err.Error(), []string{"priority"})
+	}
+	payload.Priority = priority
 	return nil
 }
 
+// PushToDeviceHandler sends the notification to the devices, with the
+// same optional "priority" and Access as PushToUserHandler.
 type PushToDeviceHandler struct {
+	Access             PushAccess
 	NotificationSender push.Sender      `inject:"PushSender"`
-	AccessKey          router.Processor `preprocessor:"accesskey"`
+	Queue              *workqueue.Queue `inject:"PushQueue"`
+	Authenticator      router.Processor `preprocessor:"authenticator"`
 	DBConn             router.Processor `preprocessor:"dbconn"`
+	InjectUser         router.Processor `preprocessor:"inject_user"`
 	InjectDB           router.Processor `preprocessor:"inject_db"`
 	Notification       router.Processor `preprocessor:"notification"`
 	PluginReady        router.Processor `preprocessor:"plugin_ready"`
@@ -189,8 +256,9 @@ type PushToDeviceHandler struct {
 
 func (h *PushToDeviceHandler) Setup() {
 	h.preprocessors = []router.Processor{
-		h.AccessKey,
+		h.Authenticator,
 		h.DBConn,
+		h.InjectUser,
 		h.InjectDB,
 		h.Notification,
 		h.PluginReady,
@@ -201,7 +269,12 @@ func (h *PushToDeviceHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *PushToDeviceHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *PushToDeviceHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	if err := checkPushAccess(h.Access, rpayload); err != nil {
+		response.Err = err
+		return
+	}
+
 	payload := &pushToDevicePayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -213,14 +286,14 @@ func (h *PushToDeviceHandler) Handle(rpayload *router.Payload, response *router.
 	resultItems := []sendPushResponseItem{}
 	for _, deviceID := range payload.DeviceIDs {
 		device := skydb.Device{}
-		if err := conn.GetDevice(deviceID, &device); err != nil {
+		if err := conn.GetDevice(ctx, deviceID, &device); err != nil {
 			resultItems = append(resultItems, sendPushResponseItem{
 				id:  deviceID,
 				err: &err,
 			})
 		} else if payload.Topic == "" || payload.Topic == device.Topic {
 			pushMap := push.MapMapper(payload.Notification)
-			sendPushNotification(h.NotificationSender, device, pushMap)
+			sendPushNotification(h.Queue, payload.Priority, h.NotificationSender, device, pushMap)
 			resultItems = append(resultItems, sendPushResponseItem{
 				id: deviceID,
 			})
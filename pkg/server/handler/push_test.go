@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
@@ -24,6 +25,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/push"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
 func TestPushToDevice(t *testing.T) {
@@ -49,7 +51,7 @@ func TestPushToDevice(t *testing.T) {
 
 		Convey("push to single device", func(c C) {
 			called := false
-			sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
 				c.So(device, ShouldResemble, testdevice)
 				c.So(m.Map(), ShouldResemble, map[string]interface{}{
 					"aps": map[string]interface{}{
@@ -80,9 +82,39 @@ func TestPushToDevice(t *testing.T) {
 			So(called, ShouldBeTrue)
 		})
 
+		Convey("push to single device with priority", func() {
+			var sentPriority workqueue.Priority
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
+				sentPriority = priority
+			}
+
+			resp := r.POST(`{
+					"device_ids": ["device"],
+					"notification": {"aps": {"alert": "Your code is 1234."}},
+					"priority": "critical"
+				}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(sentPriority, ShouldEqual, workqueue.Critical)
+		})
+
+		Convey("rejects unknown priority", func() {
+			called := false
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
+				called = true
+			}
+
+			resp := r.POST(`{
+					"device_ids": ["device"],
+					"notification": {"aps": {"alert": "Your code is 1234."}},
+					"priority": "urgent"
+				}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(called, ShouldBeFalse)
+		})
+
 		Convey("push to non-existent device", func() {
 			called := false
-			sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
 				called = true
 			}
 			resp := r.POST(`{
@@ -147,7 +179,7 @@ func TestPushToUser(t *testing.T) {
 
 		Convey("push to single user", func(c C) {
 			sentDevices := []skydb.Device{}
-			sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
 				c.So(m.Map(), ShouldResemble, map[string]interface{}{
 					"aps": map[string]interface{}{
 						"alert": "This is a message.",
@@ -180,7 +212,7 @@ func TestPushToUser(t *testing.T) {
 
 		Convey("push to non-existent user", func() {
 			called := false
-			sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
 				called = true
 			}
 			resp := r.POST(`{
@@ -210,12 +242,95 @@ func TestPushToUser(t *testing.T) {
 
 }
 
+func TestPushAccess(t *testing.T) {
+	Convey("push access", t, func() {
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{{
+				ID:         "device",
+				Type:       "ios",
+				Token:      "token",
+				UserInfoID: "userid",
+			}},
+		}
+
+		originalSendFunc := sendPushNotification
+		defer func() {
+			sendPushNotification = originalSendFunc
+		}()
+		sent := 0
+		sendPushNotification = func(queue *workqueue.Queue, priority workqueue.Priority, sender push.Sender, device skydb.Device, m push.Mapper) {
+			sent++
+		}
+
+		body := `{
+			"device_ids": ["device"],
+			"notification": {"aps": {"alert": "Hello"}}
+		}`
+
+		Convey("master access rejects user", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToDeviceHandler{Access: PushAccessMaster}, func(p *router.Payload) {
+				p.DBConn = &conn
+				p.UserInfo = &skydb.UserInfo{ID: "userid"}
+			})
+
+			resp := r.POST(body)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+	"error": {
+		"code": 102,
+		"message": "sending push notifications requires master key",
+		"name": "PermissionDenied"
+	}
+}`)
+			So(sent, ShouldEqual, 0)
+		})
+
+		Convey("master access allows master key", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToDeviceHandler{Access: PushAccessMaster}, func(p *router.Payload) {
+				p.DBConn = &conn
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(body)
+			So(resp.Code, ShouldEqual, 200)
+			So(sent, ShouldEqual, 1)
+		})
+
+		Convey("user access rejects request without user", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToUserHandler{Access: PushAccessUser}, func(p *router.Payload) {
+				p.DBConn = &conn
+				p.AccessKey = router.ClientAccessKey
+			})
+
+			resp := r.POST(`{
+				"user_ids": ["userid"],
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Code, ShouldEqual, 401)
+			So(sent, ShouldEqual, 0)
+		})
+
+		Convey("user access allows user", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToUserHandler{Access: PushAccessUser}, func(p *router.Payload) {
+				p.DBConn = &conn
+				p.UserInfo = &skydb.UserInfo{ID: "sender"}
+			})
+
+			resp := r.POST(`{
+				"user_ids": ["userid"],
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(sent, ShouldEqual, 1)
+		})
+	})
+}
+
 type simpleDeviceConn struct {
 	devices []skydb.Device
 	skydb.Conn
 }
 
-func (conn *simpleDeviceConn) GetDevice(id string, device *skydb.Device) error {
+func (conn *simpleDeviceConn) GetDevice(ctx context.Context, id string, device *skydb.Device) error {
 	for _, prospectiveDevice := range conn.devices {
 		if prospectiveDevice.ID == id {
 			*device = prospectiveDevice
@@ -225,7 +340,7 @@ func (conn *simpleDeviceConn) GetDevice(id string, device *skydb.Device) error {
 	return skydb.ErrDeviceNotFound
 }
 
-func (conn *simpleDeviceConn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
+func (conn *simpleDeviceConn) QueryDevicesByUser(ctx context.Context, user string) ([]skydb.Device, error) {
 	var result []skydb.Device
 	for _, prospectiveDevice := range conn.devices {
 		if prospectiveDevice.UserInfoID == user {
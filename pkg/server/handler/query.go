@@ -112,6 +112,8 @@ func (parser *QueryParser) predicateOperatorFromString(operatorString string) sk
 		return skydb.ILike
 	case "in":
 		return skydb.In
+	case "matches":
+		return skydb.Matches
 	case "func":
 		return skydb.Functional
 	default:
@@ -164,6 +166,18 @@ func (parser *QueryParser) predicateFromRaw(rawPredicate []interface{}) skydb.Pr
 func (parser *QueryParser) parseExpression(i interface{}) skydb.Expression {
 	switch v := i.(type) {
 	case map[string]interface{}:
+		if kind, _ := v["$type"].(string); kind == "var" {
+			name, _ := v["$val"].(string)
+			if !skydb.IsPredicateVariable(name) {
+				panic(skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+					`unknown predicate variable "%s"`, name))
+			}
+			return skydb.Expression{
+				Type:  skydb.Variable,
+				Value: name,
+			}
+		}
+
 		var keyPath string
 		if err := skyconv.MapFrom(i, (*skyconv.MapKeyPath)(&keyPath)); err == nil {
 			if keyPath == "_owner" {
@@ -201,10 +215,19 @@ func (parser *QueryParser) parseFunc(s []interface{}) (f skydb.Func, err error)
 	switch funcName {
 	case "distance":
 		f, err = parser.parseDistanceFunc(s[2:])
+	case "withinBounds":
+		f, err = parser.parseWithinBoundsFunc(s[2:])
 	case "userRelation":
 		f, err = parser.parseUserRelationFunc(s[2:])
 	case "userDiscover":
 		f, err = parser.parseUserDiscoverFunc(s[2:])
+	case "sharedWithMe":
+		if len(s) != 2 {
+			return nil, fmt.Errorf("want 0 arguments for sharedWithMe func, got %d", len(s)-2)
+		}
+		f = skydb.SharedWithUserFunc{User: parser.UserID}
+	case "rank":
+		f, err = parser.parseRankFunc(s[2:])
 	case "":
 		return nil, errors.New("empty function name")
 	default:
@@ -236,6 +259,62 @@ func (parser *QueryParser) parseDistanceFunc(s []interface{}) (skydb.DistanceFun
 	}, nil
 }
 
+func (parser *QueryParser) parseWithinBoundsFunc(s []interface{}) (skydb.WithinBoundsFunc, error) {
+	emptyWithinBoundsFunc := skydb.WithinBoundsFunc{}
+	if len(s) != 3 {
+		return emptyWithinBoundsFunc, fmt.Errorf("want 3 arguments for withinBounds func, got %d", len(s))
+	}
+
+	var field string
+	if err := skyconv.MapFrom(s[0], (*skyconv.MapKeyPath)(&field)); err != nil {
+		return emptyWithinBoundsFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	var southWest, northEast skydb.Location
+	if err := skyconv.MapFrom(s[1], (*skyconv.MapLocation)(&southWest)); err != nil {
+		return emptyWithinBoundsFunc, fmt.Errorf("invalid south-west location: %v", err)
+	}
+	if err := skyconv.MapFrom(s[2], (*skyconv.MapLocation)(&northEast)); err != nil {
+		return emptyWithinBoundsFunc, fmt.Errorf("invalid north-east location: %v", err)
+	}
+
+	return skydb.WithinBoundsFunc{
+		Field:     field,
+		SouthWest: southWest,
+		NorthEast: northEast,
+	}, nil
+}
+
+func (parser *QueryParser) parseRankFunc(s []interface{}) (skydb.RankFunc, error) {
+	emptyRankFunc := skydb.RankFunc{}
+	if len(s) < 1 || len(s) > 2 {
+		return emptyRankFunc, fmt.Errorf("want 1 or 2 arguments for rank func, got %d", len(s))
+	}
+
+	var field string
+	if err := skyconv.MapFrom(s[0], (*skyconv.MapKeyPath)(&field)); err != nil {
+		return emptyRankFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	order := skydb.Desc
+	if len(s) == 2 {
+		orderStr, _ := s[1].(string)
+		switch orderStr {
+		case "asc":
+			order = skydb.Asc
+		case "desc":
+			order = skydb.Desc
+		default:
+			return emptyRankFunc, fmt.Errorf("unknown rank order = %v", s[1])
+		}
+	}
+
+	return skydb.RankFunc{
+		Field: field,
+		Order: order,
+	}, nil
+}
+
 func (parser *QueryParser) parseUserRelationFunc(s []interface{}) (skydb.UserRelationFunc, error) {
 	emptyUserRelationFunc := skydb.UserRelationFunc{}
 	if len(s) != 2 {
@@ -353,6 +432,29 @@ func (parser *QueryParser) queryFromRaw(rawQuery map[string]interface{}, query *
 	return nil
 }
 
+// predicateVariables returns the values of predicate variables for
+// a request made by the user.
+func predicateVariables(userinfo *skydb.UserInfo) skydb.PredicateVariables {
+	vars := skydb.PredicateVariables{Now: timeNow()}
+	if userinfo != nil {
+		vars.UserID = userinfo.ID
+		vars.Roles = userinfo.Roles
+	}
+	return vars
+}
+
+// ParseQuery parses a query in the format of record:query payload. It is
+// for queries not made on behalf of a user, such as those observed by
+// plugins.
+func ParseQuery(rawQuery map[string]interface{}) (skydb.Query, error) {
+	parser := QueryParser{}
+	query := skydb.Query{}
+	if err := parser.queryFromRaw(rawQuery, &query); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
 // execute do when if the value of key in m is []interface{}. If value exists
 // for key but its type is not []interface{} or do returns an error, it panics.
 func mustDoSlice(m map[string]interface{}, key string, do func(value []interface{}) skyerr.Error) {
@@ -126,6 +126,164 @@ func TestQueryFromRaw(t *testing.T) {
 				},
 			})
 		})
+
+		Convey("functional predicate with shared with me", func() {
+			parser := &QueryParser{
+				UserID: "USER_ID",
+			}
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"predicate":   []interface{}{"func", "sharedWithMe"},
+			}, &query)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					skydb.Functional,
+					[]interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.SharedWithUserFunc{"USER_ID"},
+						},
+					},
+				},
+			})
+		})
+
+		Convey("functional predicate with within bounds", func() {
+			parser := &QueryParser{}
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"func",
+					"withinBounds",
+					map[string]interface{}{"$type": "keypath", "$val": "location"},
+					map[string]interface{}{"$type": "geo", "$lng": float64(114.1), "$lat": float64(22.2)},
+					map[string]interface{}{"$type": "geo", "$lng": float64(114.3), "$lat": float64(22.4)},
+				},
+			}, &query)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					skydb.Functional,
+					[]interface{}{
+						skydb.Expression{
+							Type: skydb.Function,
+							Value: skydb.WithinBoundsFunc{
+								Field:     "location",
+								SouthWest: skydb.NewLocation(114.1, 22.2),
+								NorthEast: skydb.NewLocation(114.3, 22.4),
+							},
+						},
+					},
+				},
+			})
+		})
 	})
 
+	Convey("predicate variable", t, func() {
+		Convey("parses variable", func() {
+			parser := &QueryParser{}
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"in",
+					map[string]interface{}{"$type": "keypath", "$val": "category"},
+					map[string]interface{}{"$type": "var", "$val": "user_roles"},
+				},
+			}, &query)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					skydb.In,
+					[]interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+						skydb.Expression{Type: skydb.Variable, Value: "user_roles"},
+					},
+				},
+			})
+		})
+
+		Convey("rejects unknown variable", func() {
+			parser := &QueryParser{}
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"eq",
+					map[string]interface{}{"$type": "keypath", "$val": "_owner_id"},
+					map[string]interface{}{"$type": "var", "$val": "current_user"},
+				},
+			}, &query)
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, `unknown predicate variable "current_user"`)
+		})
+	})
+}
+
+func TestParseQuery(t *testing.T) {
+	Convey("ParseQuery", t, func() {
+		Convey("parses query", func() {
+			query, err := ParseQuery(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"eq",
+					map[string]interface{}{"$type": "keypath", "$val": "category"},
+					"recipe",
+				},
+			})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+						skydb.Expression{Type: skydb.Literal, Value: "recipe"},
+					},
+				},
+			})
+		})
+
+		Convey("parses full-text search predicate", func() {
+			query, err := ParseQuery(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"matches",
+					map[string]interface{}{"$type": "keypath", "$val": "content"},
+					"quick fox",
+				},
+			})
+			So(err, ShouldBeNil)
+			So(query.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.Matches,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "content"},
+					skydb.Expression{Type: skydb.Literal, Value: "quick fox"},
+				},
+			})
+		})
+
+		Convey("returns error on full-text search of non-string", func() {
+			_, err := ParseQuery(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"matches",
+					map[string]interface{}{"$type": "keypath", "$val": "content"},
+					float64(1),
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("returns error on invalid query", func() {
+			_, err := ParseQuery(map[string]interface{}{})
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
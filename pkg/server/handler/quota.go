@@ -0,0 +1,116 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type quotaStatusPayload struct {
+	UserID string `mapstructure:"user_id"`
+}
+
+func (payload *quotaStatusPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return nil
+}
+
+/*
+QuotaStatusHandler reports the usage of the private database of the
+current user against the configured quota. With master key, the usage of
+another user can be reported by specifying user_id.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "quota:status"
+}
+EOF
+
+{
+    "result": {
+        "user_id": "3df4b52b-bd58-4fa2-8aee-3d44fd7f974d",
+        "usage": {
+            "record_count": 42,
+            "storage_size": 16384
+        },
+        "limits": {
+            "record_count": 1000,
+            "storage_size": 0
+        },
+        "reached": false
+    }
+}
+*/
+type QuotaStatusHandler struct {
+	Quota         *quota.Enforcer  `inject:"QuotaEnforcer"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *QuotaStatusHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *QuotaStatusHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *QuotaStatusHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &quotaStatusPayload{}
+	if err := p.Decode(payload.Data); err != nil {
+		response.Err = err
+		return
+	}
+
+	userID := p.UserID
+	if userID == "" {
+		if payload.UserInfo == nil {
+			response.Err = skyerr.NewError(skyerr.NotAuthenticated, "Authentication is needed to get quota status")
+			return
+		}
+		userID = payload.UserInfo.ID
+	} else if !payload.HasMasterKey() && (payload.UserInfo == nil || payload.UserInfo.ID != userID) {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "no permission to view quota of other users")
+		return
+	}
+
+	status, err := h.Quota.Status(ctx, payload.DBConn.PrivateDB(userID))
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	response.Result = struct {
+		UserID string `json:"user_id"`
+		*quota.Status
+	}{userID, status}
+}
@@ -0,0 +1,246 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// quotaDatabase is a private database reporting a fixed usage.
+type quotaDatabase struct {
+	userID string
+	usage  skydb.DatabaseUsage
+	*skydbtest.MapDB
+}
+
+func (db *quotaDatabase) ID() string                       { return db.userID }
+func (db *quotaDatabase) DatabaseType() skydb.DatabaseType { return skydb.PrivateDatabase }
+
+func (db *quotaDatabase) Usage() (skydb.DatabaseUsage, error) {
+	return db.usage, nil
+}
+
+type quotaConn struct {
+	usage skydb.DatabaseUsage
+	*skydbtest.MapConn
+}
+
+func (conn *quotaConn) PrivateDB(userKey string) skydb.Database {
+	return &quotaDatabase{userKey, conn.usage, skydbtest.NewMapDB()}
+}
+
+func TestQuotaStatusHandler(t *testing.T) {
+	Convey("QuotaStatusHandler", t, func() {
+		conn := &quotaConn{
+			usage: skydb.DatabaseUsage{
+				RecordCount: 42,
+				StorageSize: 16384,
+			},
+			MapConn: skydbtest.NewMapConn(),
+		}
+		handler := &QuotaStatusHandler{
+			Quota: &quota.Enforcer{
+				Limits: quota.Limits{RecordCount: 1000},
+			},
+		}
+
+		Convey("reports status of current user", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.UserInfo = &skydb.UserInfo{ID: "user0"}
+			})
+
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"user_id": "user0",
+					"usage": {
+						"record_count": 42,
+						"storage_size": 16384
+					},
+					"limits": {
+						"record_count": 1000,
+						"storage_size": 0
+					},
+					"reached": false
+				}
+			}`)
+		})
+
+		Convey("reports status of other user with master key", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(`{"user_id": "user1"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"user_id": "user1",
+					"usage": {
+						"record_count": 42,
+						"storage_size": 16384
+					},
+					"limits": {
+						"record_count": 1000,
+						"storage_size": 0
+					},
+					"reached": false
+				}
+			}`)
+		})
+
+		Convey("rejects status of other user without master key", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.UserInfo = &skydb.UserInfo{ID: "user0"}
+			})
+
+			resp := r.POST(`{"user_id": "user1"}`)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "no permission to view quota of other users",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+
+		Convey("rejects unauthenticated request", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
+
+func TestRecordSaveQuota(t *testing.T) {
+	timeNow = func() time.Time { return ZeroTime }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("RecordSaveHandler with quota", t, func() {
+		conn := skydbtest.NewMapConn()
+		db := &quotaDatabase{
+			userID: "user0",
+			usage: skydb.DatabaseUsage{
+				RecordCount: 9,
+			},
+			MapDB: skydbtest.NewMapDB(),
+		}
+		db.MapDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "existing"),
+			OwnerID: "user0",
+		})
+
+		r := handlertest.NewSingleRouteRouter(&RecordSaveHandler{
+			Quota: &quota.Enforcer{
+				Limits: quota.Limits{RecordCount: 10},
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.UserInfo = &skydb.UserInfo{ID: "user0"}
+		})
+
+		Convey("saves new record within quota", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_id": "note/new1",
+					"content": "hello"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(db.RecordMap, ShouldContainKey, "note/new1")
+		})
+
+		Convey("rejects new records exceeding quota", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_id": "note/new1",
+					"content": "hello"
+				}, {
+					"_id": "note/new2",
+					"content": "world"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 124,
+					"message": "private database record quota exceeded: cannot add 2 records to 9 of 10 records",
+					"name": "QuotaExceeded",
+					"info": {
+						"quota": "record_count",
+						"usage": 9,
+						"limit": 10
+					}
+				}
+			}`)
+			So(db.RecordMap, ShouldNotContainKey, "note/new1")
+		})
+
+		Convey("updates existing record exceeding quota", func() {
+			db.usage.RecordCount = 10
+			resp := r.POST(`{
+				"records": [{
+					"_id": "note/existing",
+					"content": "updated"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("saves with master key exceeding quota", func() {
+			db.usage.RecordCount = 10
+			r := handlertest.NewSingleRouteRouter(&RecordSaveHandler{
+				Quota: &quota.Enforcer{
+					Limits: quota.Limits{RecordCount: 10},
+				},
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+				p.UserInfo = &skydb.UserInfo{ID: "user0"}
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(`{
+				"records": [{
+					"_id": "note/new1",
+					"content": "hello"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
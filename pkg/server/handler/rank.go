@@ -0,0 +1,259 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+const (
+	// recordRankDefaultLimit is the number of top records returned if
+	// neither record_id nor limit is specified.
+	recordRankDefaultLimit = 10
+
+	// recordRankDefaultAround is the number of records returned before
+	// and after the specified record if around is not specified.
+	recordRankDefaultAround = 5
+
+	recordRankMaxAround = 100
+)
+
+type recordRankPayload struct {
+	Query    skydb.Query
+	Rank     skydb.RankFunc
+	RecordID skydb.RecordID
+	Around   uint64
+}
+
+func (payload *recordRankPayload) Decode(data map[string]interface{}, parser *QueryParser) skyerr.Error {
+	if err := parser.queryFromRaw(data, &payload.Query); err != nil {
+		return err
+	}
+
+	payload.Rank.Field, _ = data["field"].(string)
+	payload.Rank.Order = skydb.Desc
+	if order, ok := data["order"].(string); ok && order == "asc" {
+		payload.Rank.Order = skydb.Asc
+	}
+
+	if rawID, ok := data["record_id"].(string); ok {
+		if err := payload.RecordID.UnmarshalText([]byte(rawID)); err != nil {
+			return skyerr.NewInvalidArgument("record_id must be in the form of type/id", []string{"record_id"})
+		}
+	}
+
+	payload.Around = recordRankDefaultAround
+	if around, ok := data["around"].(float64); ok {
+		payload.Around = uint64(around)
+	}
+
+	if payload.RecordID.IsEmpty() && payload.Query.Limit == nil {
+		payload.Query.Limit = new(uint64)
+		*payload.Query.Limit = recordRankDefaultLimit
+	}
+
+	return payload.Validate()
+}
+
+func (payload *recordRankPayload) Validate() skyerr.Error {
+	if payload.Rank.Field == "" {
+		return skyerr.NewInvalidArgument("field cannot be empty", []string{"field"})
+	}
+	if !payload.RecordID.IsEmpty() && payload.RecordID.Type != payload.Query.Type {
+		return skyerr.NewInvalidArgument("record_id must be of record_type", []string{"record_id"})
+	}
+	if payload.Around > recordRankMaxAround {
+		return skyerr.NewInvalidArgument("around must not be greater than 100", []string{"around"})
+	}
+	return nil
+}
+
+/*
+RecordRankHandler ranks records by a field for leaderboards. The rank of
+each record is returned in its transient field "_rank". Records of equal
+value share the same rank, and records without the field are not ranked.
+
+Without record_id, the top records are returned:
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:rank",
+    "access_token": "ACCESS_TOKEN",
+    "record_type": "score",
+    "field": "points",
+    "order": "desc",
+    "limit": 10
+}
+EOF
+
+With record_id, the record is returned together with at most "around"
+records ranked immediately before and after it:
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:rank",
+    "access_token": "ACCESS_TOKEN",
+    "record_type": "score",
+    "field": "points",
+    "record_id": "score/SCORE_ID",
+    "around": 5
+}
+EOF
+
+A predicate can be specified as in record:query to rank a subset of
+records, such as the scores of a week. The rank of records within the
+results of record:query is also available by including the rank function:
+
+    "include": {"rank": ["func", "rank", {"$type": "keypath", "$val": "points"}, "desc"]}
+*/
+type RecordRankHandler struct {
+	AssetStore    asset.Store          `inject:"AssetStore"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	Authenticator router.Processor     `preprocessor:"authenticator"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	InjectUser    router.Processor     `preprocessor:"inject_user"`
+	InjectDB      router.Processor     `preprocessor:"inject_db"`
+	PluginReady   router.Processor     `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordRankHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordRankHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordRankHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "record_type", Type: router.StringField, Required: true},
+		{Name: "field", Type: router.StringField, Required: true},
+		{Name: "order", Type: router.StringField, Enum: []string{"asc", "desc"}},
+		{Name: "record_id", Type: router.StringField},
+		{Name: "around", Type: router.NumberField},
+		{Name: "limit", Type: router.NumberField},
+	}
+}
+
+func (h *RecordRankHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &recordRankPayload{}
+	parser := QueryParser{UserID: payload.UserInfoID}
+	if skyErr := p.Decode(payload.Data, &parser); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	query := &p.Query
+	if payload.UserInfo != nil {
+		query.ViewAsUser = payload.UserInfo
+	}
+	query.Predicate = query.Predicate.ResolveVariables(predicateVariables(payload.UserInfo))
+	if payload.HasMasterKey() {
+		query.BypassAccessControl = true
+	}
+
+	// records without the field are not ranked
+	ranked := skydb.Predicate{
+		Operator: skydb.NotEqual,
+		Children: []interface{}{
+			skydb.Expression{Type: skydb.KeyPath, Value: p.Rank.Field},
+			skydb.Expression{Type: skydb.Literal, Value: nil},
+		},
+	}
+	if query.Predicate.IsEmpty() {
+		query.Predicate = ranked
+	} else {
+		query.Predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{query.Predicate, ranked},
+		}
+	}
+
+	db := payload.Database
+	if !payload.HasMasterKey() && h.Moderation != nil {
+		if err := h.Moderation.FilterQuery(ctx, db, query); err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+	}
+
+	var results *skydb.Rows
+	var err error
+	if p.RecordID.IsEmpty() {
+		query.Sorts = []skydb.Sort{
+			{KeyPath: p.Rank.Field, Order: p.Rank.Order},
+			{KeyPath: "_id", Order: skydb.Asc},
+		}
+		if query.ComputedKeys == nil {
+			query.ComputedKeys = map[string]skydb.Expression{}
+		}
+		query.ComputedKeys["_rank"] = skydb.Expression{
+			Type:  skydb.Function,
+			Value: p.Rank,
+		}
+		results, err = db.Query(ctx, query)
+	} else {
+		ranker, ok := db.(skydb.RecordRanker)
+		if !ok {
+			response.Err = skyerr.NewError(skyerr.NotSupported, "ranking around a record is not supported by the database")
+			return
+		}
+		results, err = ranker.QueryRankAround(ctx, query, p.Rank, p.RecordID.Key, p.Around)
+	}
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	defer results.Close()
+
+	records := []skydb.Record{}
+	for results.Scan() {
+		records = append(records, results.Record())
+	}
+	if results.Err() != nil {
+		response.Err = skyerr.MakeError(results.Err())
+		return
+	}
+
+	if !p.RecordID.IsEmpty() && len(records) == 0 {
+		response.Err = skyerr.NewError(skyerr.ResourceNotFound, "record not found or not ranked")
+		return
+	}
+
+	makeAssetsComplete(ctx, db, payload.DBConn, records)
+
+	output := make([]interface{}, len(records))
+	for i := range records {
+		injectSigner(&records[i], h.AssetStore)
+		output[i] = (*skyconv.JSONRecord)(&records[i])
+	}
+	response.Result = output
+}
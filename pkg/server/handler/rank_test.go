@@ -0,0 +1,177 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type rankDatabase struct {
+	records   []skydb.Record
+	lastquery *skydb.Query
+	rank      skydb.RankFunc
+	id        string
+	around    uint64
+	skydb.Database
+}
+
+func (db *rankDatabase) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
+	return skydb.RecordSchema{}, nil
+}
+
+func (db *rankDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	db.lastquery = query
+	return skydb.NewRows(skydb.NewMemoryRows(db.records)), nil
+}
+
+func (db *rankDatabase) QueryRankAround(ctx context.Context, query *skydb.Query, rank skydb.RankFunc, id string, around uint64) (*skydb.Rows, error) {
+	db.lastquery = query
+	db.rank = rank
+	db.id = id
+	db.around = around
+	return skydb.NewRows(skydb.NewMemoryRows(db.records)), nil
+}
+
+func TestRecordRankHandler(t *testing.T) {
+	Convey("RecordRankHandler", t, func() {
+		db := &rankDatabase{
+			records: []skydb.Record{
+				{
+					ID:        skydb.NewRecordID("score", "1"),
+					Data:      skydb.Data{"points": float64(100)},
+					Transient: skydb.Data{"_rank": float64(1)},
+				},
+				{
+					ID:        skydb.NewRecordID("score", "2"),
+					Data:      skydb.Data{"points": float64(90)},
+					Transient: skydb.Data{"_rank": float64(2)},
+				},
+			},
+		}
+		r := handlertest.NewSingleRouteRouter(&RecordRankHandler{}, func(p *router.Payload) {
+			p.Database = db
+		})
+
+		notNull := skydb.Predicate{
+			Operator: skydb.NotEqual,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "points"},
+				skydb.Expression{Type: skydb.Literal, Value: nil},
+			},
+		}
+
+		Convey("returns top records with ranks", func() {
+			resp := r.POST(`{
+				"record_type": "score",
+				"field": "points"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "score/1",
+					"_type": "record",
+					"_access": null,
+					"_transient": {"_rank": 1},
+					"points": 100
+				}, {
+					"_id": "score/2",
+					"_type": "record",
+					"_access": null,
+					"_transient": {"_rank": 2},
+					"points": 90
+				}]
+			}`)
+
+			So(db.lastquery.Predicate, ShouldResemble, notNull)
+			So(db.lastquery.Sorts, ShouldResemble, []skydb.Sort{
+				{KeyPath: "points", Order: skydb.Desc},
+				{KeyPath: "_id", Order: skydb.Asc},
+			})
+			So(*db.lastquery.Limit, ShouldEqual, 10)
+			So(db.lastquery.ComputedKeys["_rank"], ShouldResemble, skydb.Expression{
+				Type:  skydb.Function,
+				Value: skydb.RankFunc{Field: "points", Order: skydb.Desc},
+			})
+		})
+
+		Convey("returns records around a record", func() {
+			resp := r.POST(`{
+				"record_type": "score",
+				"field": "points",
+				"order": "asc",
+				"record_id": "score/2",
+				"around": 3,
+				"predicate": ["eq", {"$type": "keypath", "$val": "week"}, 12]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			So(db.rank, ShouldResemble, skydb.RankFunc{Field: "points", Order: skydb.Asc})
+			So(db.id, ShouldEqual, "2")
+			So(db.around, ShouldEqual, 3)
+			So(db.lastquery.Limit, ShouldBeNil)
+			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "week"},
+							skydb.Expression{Type: skydb.Literal, Value: float64(12)},
+						},
+					},
+					notNull,
+				},
+			})
+		})
+
+		Convey("complains when the record is not ranked", func() {
+			db.records = []skydb.Record{}
+			resp := r.POST(`{
+				"record_type": "score",
+				"field": "points",
+				"record_id": "score/3"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 110,
+					"message": "record not found or not ranked",
+					"name": "ResourceNotFound"
+				}
+			}`)
+		})
+
+		Convey("complains about record id of another type", func() {
+			resp := r.POST(`{
+				"record_type": "score",
+				"field": "points",
+				"record_id": "note/1"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"message": "record_id must be of record_type",
+					"name": "InvalidArgument",
+					"info": {"arguments": ["record_id"]}
+				}
+			}`)
+		})
+	})
+}
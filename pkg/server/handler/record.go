@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -23,12 +24,17 @@ import (
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
 	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
 )
 
 type jsonData map[string]interface{}
@@ -141,6 +147,27 @@ func (payload *recordSavePayload) Validate() skyerr.Error {
 	return nil
 }
 
+// assignRecordKeys generates the keys of records saved without one, and
+// returns the generated IDs.
+func (payload *recordSavePayload) assignRecordKeys(policy *recordid.Policy) map[skydb.RecordID]bool {
+	generated := map[skydb.RecordID]bool{}
+	recordIdx := 0
+	for i, item := range payload.IncomingItems {
+		if _, ok := item.(skydb.RecordID); !ok {
+			continue
+		}
+
+		record := payload.Records[recordIdx]
+		recordIdx++
+		if record.ID.Key == "" {
+			record.ID.Key = policy.NewKey(record.ID.Type)
+			payload.IncomingItems[i] = record.ID
+			generated[record.ID] = true
+		}
+	}
+	return generated
+}
+
 // InitRecord is duplicated of skyconv.record FromMap FIXME
 func (payload *recordSavePayload) InitRecord(m map[string]interface{}, r *skydb.Record) skyerr.Error {
 	rawID, ok := m["_id"].(string)
@@ -194,6 +221,11 @@ func (payload *recordSavePayload) InitRecord(m map[string]interface{}, r *skydb.
 
 /*
 RecordSaveHandler is dummy implementation on save/modify Records
+
+A new record can be saved without a key, e.g. "_id": "note/", in which
+case the server generates one. Keys supplied for new records are checked
+by the RecordIDPolicy, which may forbid them for some record types.
+
 curl -X POST -H "Content-Type: application/json" \
   -d @- http://localhost:3000/ <<EOF
 {
@@ -242,6 +274,10 @@ type RecordSaveHandler struct {
 	AssetStore    asset.Store        `inject:"AssetStore"`
 	AccessModel   skydb.AccessModel  `inject:"AccessModel"`
 	EventSender   pluginEvent.Sender `inject:"PluginEventSender"`
+	Quota         *quota.Enforcer    `inject:"QuotaEnforcer"`
+	Throttle      *throttle.Limiter  `inject:"RecordThrottle"`
+	IDPolicy      *recordid.Policy   `inject:"RecordIDPolicy"`
+	RecordStats   *stats.Recorder    `inject:"RecordStats"`
 	Authenticator router.Processor   `preprocessor:"authenticator"`
 	DBConn        router.Processor   `preprocessor:"dbconn"`
 	InjectUser    router.Processor   `preprocessor:"inject_user"`
@@ -266,7 +302,7 @@ func (h *RecordSaveHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RecordSaveHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *RecordSaveHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &recordSavePayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -281,16 +317,23 @@ func (h *RecordSaveHandler) Handle(payload *router.Payload, response *router.Res
 
 	log.Debugf("Working with accessModel %v", h.AccessModel)
 
+	generatedIDs := p.assignRecordKeys(h.IDPolicy)
+
 	req := recordModifyRequest{
-		Db:            payload.Database,
-		Conn:          payload.DBConn,
-		AssetStore:    h.AssetStore,
-		HookRegistry:  h.HookRegistry,
-		UserInfo:      payload.UserInfo,
-		RecordsToSave: p.Records,
-		Atomic:        p.Atomic,
-		WithMasterKey: payload.HasMasterKey(),
-		Context:       payload.Context,
+		Db:                 payload.Database,
+		Conn:               payload.DBConn,
+		AssetStore:         h.AssetStore,
+		HookRegistry:       h.HookRegistry,
+		UserInfo:           payload.UserInfo,
+		RecordsToSave:      p.Records,
+		Quota:              h.Quota,
+		Throttle:           h.Throttle,
+		RecordIDPolicy:     h.IDPolicy,
+		GeneratedRecordIDs: generatedIDs,
+		RecordStats:        h.RecordStats,
+		Atomic:             p.Atomic,
+		WithMasterKey:      payload.HasMasterKey(),
+		Context:            ctx,
 	}
 	resp := recordModifyResponse{
 		ErrMap: map[skydb.RecordID]skyerr.Error{},
@@ -349,7 +392,7 @@ func (h *RecordSaveHandler) Handle(payload *router.Payload, response *router.Res
 	response.Result = results
 
 	if resp.SchemaUpdated && h.EventSender != nil {
-		err := sendSchemaChangedEvent(h.EventSender, payload.Database)
+		err := sendSchemaChangedEvent(ctx, h.EventSender, payload.Database)
 		if err != nil {
 			log.WithField("err", err).Warn("Fail to send schema changed event")
 		}
@@ -404,13 +447,14 @@ curl -X POST -H "Content-Type: application/json" \
 EOF
 */
 type RecordFetchHandler struct {
-	AssetStore    asset.Store       `inject:"AssetStore"`
-	AccessModel   skydb.AccessModel `inject:"AccessModel"`
-	Authenticator router.Processor  `preprocessor:"authenticator"`
-	DBConn        router.Processor  `preprocessor:"dbconn"`
-	InjectUser    router.Processor  `preprocessor:"inject_user"`
-	InjectDB      router.Processor  `preprocessor:"inject_db"`
-	PluginReady   router.Processor  `preprocessor:"plugin_ready"`
+	AssetStore    asset.Store          `inject:"AssetStore"`
+	AccessModel   skydb.AccessModel    `inject:"AccessModel"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	Authenticator router.Processor     `preprocessor:"authenticator"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	InjectUser    router.Processor     `preprocessor:"inject_user"`
+	InjectDB      router.Processor     `preprocessor:"inject_db"`
+	PluginReady   router.Processor     `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -428,7 +472,7 @@ func (h *RecordFetchHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *RecordFetchHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &recordFetchPayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -441,7 +485,7 @@ func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Re
 	results := make([]interface{}, p.ItemLen(), p.ItemLen())
 	for i, recordID := range p.RecordIDs {
 		record := skydb.Record{}
-		if err := db.Get(recordID, &record); err != nil {
+		if err := db.Get(ctx, recordID, &record); err != nil {
 			if err == skydb.ErrRecordNotFound {
 				results[i] = newSerializedError(
 					recordID.String(),
@@ -457,6 +501,11 @@ func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Re
 					skyerr.NewResourceFetchFailureErr("record", recordID.String()),
 				)
 			}
+		} else if isHiddenByModeration(h.Moderation, payload, &record) {
+			results[i] = newSerializedError(
+				recordID.String(),
+				skyerr.NewError(skyerr.ResourceNotFound, "record not found"),
+			)
 		} else {
 			if payload.HasMasterKey() || record.Accessible(payload.UserInfo, skydb.ReadLevel) {
 				injectSigner(&record, h.AssetStore)
@@ -474,7 +523,8 @@ func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Re
 }
 
 type recordQueryPayload struct {
-	Query skydb.Query
+	Query   skydb.Query
+	Explain bool
 }
 
 func (payload *recordQueryPayload) Decode(data map[string]interface{}, parser *QueryParser) skyerr.Error {
@@ -487,13 +537,130 @@ func (payload *recordQueryPayload) Decode(data map[string]interface{}, parser *Q
 		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
 	}
 
+	if explain, ok := data["explain"]; ok {
+		if payload.Explain, ok = explain.(bool); !ok {
+			return skyerr.NewInvalidArgument("explain must be a boolean", []string{"explain"})
+		}
+	}
+
+	if rawCursor, ok := data["cursor"]; ok {
+		token, ok := rawCursor.(string)
+		if !ok {
+			return skyerr.NewInvalidArgument("cursor must be a string", []string{"cursor"})
+		}
+		cursor, err := decodeQueryCursor(token)
+		if err != nil {
+			return skyerr.NewInvalidArgument("cursor is malformed", []string{"cursor"})
+		}
+		payload.Query.Cursor = cursor
+	}
+
+	if rawHints, ok := data["hints"]; ok {
+		hints, err := decodeQueryHints(rawHints)
+		if err != nil {
+			return err
+		}
+		payload.Query.Hints = hints
+	}
+
 	return payload.Validate()
 }
 
+func decodeQueryHints(rawHints interface{}) (*skydb.QueryHints, skyerr.Error) {
+	hintsMap, ok := rawHints.(map[string]interface{})
+	if !ok {
+		return nil, skyerr.NewInvalidArgument("hints must be an object", []string{"hints"})
+	}
+
+	hints := &skydb.QueryHints{}
+	if index, ok := hintsMap["index"]; ok {
+		if hints.Index, ok = index.(string); !ok {
+			return nil, skyerr.NewInvalidArgument("hints.index must be a string", []string{"hints"})
+		}
+	}
+	if disableSeqScan, ok := hintsMap["disable_seq_scan"]; ok {
+		if hints.DisableSeqScan, ok = disableSeqScan.(bool); !ok {
+			return nil, skyerr.NewInvalidArgument("hints.disable_seq_scan must be a boolean", []string{"hints"})
+		}
+	}
+	if joinStrategy, ok := hintsMap["join_strategy"]; ok {
+		strategy, ok := joinStrategy.(string)
+		if !ok {
+			return nil, skyerr.NewInvalidArgument("hints.join_strategy must be a string", []string{"hints"})
+		}
+		switch hints.JoinStrategy = skydb.JoinStrategy(strategy); hints.JoinStrategy {
+		case skydb.NestedLoopJoin, skydb.HashJoin, skydb.MergeJoin:
+		default:
+			return nil, skyerr.NewInvalidArgument(
+				"hints.join_strategy must be one of nested_loop, hash and merge",
+				[]string{"hints"},
+			)
+		}
+	}
+	return hints, nil
+}
+
 func (payload *recordQueryPayload) Validate() skyerr.Error {
+	if cursor := payload.Query.Cursor; cursor != nil {
+		for _, sort := range payload.Query.Sorts {
+			if sort.KeyPath == "" {
+				return skyerr.NewInvalidArgument("cursor is not supported for sort by function", []string{"cursor"})
+			}
+		}
+		if len(cursor.Values) != len(payload.Query.Sorts) {
+			return skyerr.NewInvalidArgument("cursor does not match the sort of the query", []string{"cursor"})
+		}
+	}
 	return nil
 }
 
+// executeQueryHooks returns the query returned by the beforeQuery hooks of
+// the record type from the payload data. The hooks do not receive the
+// credentials of the request, and cannot change the record type.
+func (h *RecordQueryHandler) executeQueryHooks(payload *router.Payload) (map[string]interface{}, skyerr.Error) {
+	recordType, _ := payload.Data["record_type"].(string)
+	if h.HookRegistry == nil || !h.HookRegistry.HasHooks(hook.BeforeQuery, recordType) {
+		return payload.Data, nil
+	}
+
+	query := map[string]interface{}{}
+	for key, value := range payload.Data {
+		switch key {
+		case "action", "api_key", "access_token":
+			continue
+		}
+		query[key] = value
+	}
+
+	query, err := h.HookRegistry.ExecuteQueryHooks(payload.Context, recordType, query)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		query = map[string]interface{}{}
+	}
+	query["record_type"] = recordType
+	return query, nil
+}
+
+// DefaultMaxIncludeDepth is the maximum number of levels of references an
+// include key path of record:query can expand if none is configured.
+const DefaultMaxIncludeDepth = 3
+
+// QuerySettings configures the queries of RecordQueryHandler.
+type QuerySettings struct {
+	// MaxIncludeDepth is the maximum number of components of an include
+	// key path, such as 2 for author.organization.
+	MaxIncludeDepth int
+}
+
+func (s *QuerySettings) maxIncludeDepth() int {
+	if s == nil || s.MaxIncludeDepth <= 0 {
+		return DefaultMaxIncludeDepth
+	}
+	return s.MaxIncludeDepth
+}
+
 /*
 RecordQueryHandler is dummy implementation on fetching Records
 curl -X POST -H "Content-Type: application/json" \
@@ -508,15 +675,102 @@ curl -X POST -H "Content-Type: application/json" \
     ]
 }
 EOF
+
+With master key, specifying "explain": true returns the generated
+statement, the chosen indexes and a timing breakdown in milliseconds in
+info.explain alongside the results:
+
+{
+    "result": [...],
+    "info": {
+        "explain": {
+            "statement": "SELECT ... FROM \"app_myapp\".\"note\" AS \"note\" ...",
+            "args": [],
+            "indexes": ["note_pkey"],
+            "plan": {"Node Type": "Index Scan", ...},
+            "timing": {
+                "planning": 0.1,
+                "execution": 0.2,
+                "query": 1.2,
+                "assets": 0.1,
+                "eager_load": 0.5,
+                "total": 2.1
+            }
+        }
+    }
+}
+
+If a limit is specified and a full page of records is returned,
+info.cursor is an opaque string continuing the query after the last
+record. Specifying it as "cursor" with the same predicate and sort
+returns the next page, which is stable when records are added or removed
+before it. Cursors are not supported for sort by function.
+
+{
+    "action": "record:query",
+    "record_type": "note",
+    "sort": [[{"$val": "noteOrder", "$type": "keypath"}, "desc"]],
+    "limit": 20,
+    "cursor": "eyJpZCI6Im5vdGUxIiwidmFsdWVzIjpbM119"
+}
+
+An include key path can follow references across records, such as
+{"author": {"$type": "keypath", "$val": "author.organization"}}, which
+includes the author in _transient of each post, and the organization in
+_transient of the author. Key paths deeper than the configured maximum
+are rejected, and a record referencing a record it is included from is
+included as null instead of being expanded again.
+
+With master key, which plugins also use, "hints" overrides the choices
+of the query planner for a hot query the planner consistently plans
+badly:
+
+{
+    "action": "record:query",
+    "record_type": "note",
+    "predicate": [...],
+    "hints": {
+        "index": "note_category_idx",
+        "disable_seq_scan": true,
+        "join_strategy": "hash"
+    }
+}
+
+The index must be an index of the record type. PostgreSQL has no index
+hints, so it is only preferred if the pg_hint_plan extension is loaded.
+The join strategy is one of "nested_loop", "hash" and "merge".
+
+A predicate can compare with a variable resolved by the server, such as
+{"$type": "var", "$val": "current_user_id"}. The variables are
+"current_user_id", "user_roles" and "now"; "current_user_id" is null
+without a user, and "user_roles" can only be the right operand of "in":
+
+{
+    "action": "record:query",
+    "record_type": "note",
+    "predicate": [
+        "and",
+        ["eq", {"$type": "keypath", "$val": "_owner_id"}, {"$type": "var", "$val": "current_user_id"}],
+        ["lt", {"$type": "keypath", "$val": "publish_at"}, {"$type": "var", "$val": "now"}]
+    ]
+}
+
+The predicate ["func", "sharedWithMe"] selects the records shared with
+the current user, i.e. those whose ACL grants the user or a role of the
+user access, excluding the records owned by the user and those only
+granted to the public.
 */
 type RecordQueryHandler struct {
-	AssetStore    asset.Store       `inject:"AssetStore"`
-	AccessModel   skydb.AccessModel `inject:"AccessModel"`
-	Authenticator router.Processor  `preprocessor:"authenticator"`
-	DBConn        router.Processor  `preprocessor:"dbconn"`
-	InjectUser    router.Processor  `preprocessor:"inject_user"`
-	InjectDB      router.Processor  `preprocessor:"inject_db"`
-	PluginReady   router.Processor  `preprocessor:"plugin_ready"`
+	Settings      *QuerySettings       `inject:"QuerySettings"`
+	HookRegistry  *hook.Registry       `inject:"HookRegistry"`
+	AssetStore    asset.Store          `inject:"AssetStore"`
+	AccessModel   skydb.AccessModel    `inject:"AccessModel"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	Authenticator router.Processor     `preprocessor:"authenticator"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	InjectUser    router.Processor     `preprocessor:"inject_user"`
+	InjectDB      router.Processor     `preprocessor:"inject_db"`
+	PluginReady   router.Processor     `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -534,10 +788,16 @@ func (h *RecordQueryHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *RecordQueryHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	data, skyErr := h.executeQueryHooks(payload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
 	p := &recordQueryPayload{}
 	parser := QueryParser{UserID: payload.UserInfoID}
-	skyErr := p.Decode(payload.Data, &parser)
+	skyErr = p.Decode(data, &parser)
 	if skyErr != nil {
 		response.Err = skyErr
 		return
@@ -546,14 +806,38 @@ func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Re
 	if payload.UserInfo != nil {
 		p.Query.ViewAsUser = payload.UserInfo
 	}
+	p.Query.Predicate = p.Query.Predicate.ResolveVariables(predicateVariables(payload.UserInfo))
 
 	if payload.HasMasterKey() {
 		p.Query.BypassAccessControl = true
 	}
 
+	if p.Explain && !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "explain requires master key")
+		return
+	}
+
+	if p.Query.Hints != nil && !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "hints requires master key")
+		return
+	}
+
+	if err := validateIncludes(&p.Query, h.Settings.maxIncludeDepth()); err != nil {
+		response.Err = err
+		return
+	}
+
 	db := payload.Database
+	timing := newQueryTiming()
+
+	if !payload.HasMasterKey() && h.Moderation != nil {
+		if err := h.Moderation.FilterQuery(ctx, db, &p.Query); err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+	}
 
-	results, err := db.Query(&p.Query)
+	results, err := db.Query(ctx, &p.Query)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -570,53 +854,54 @@ func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Re
 		response.Err = skyerr.MakeError(results.Err())
 		return
 	}
+	timing.mark("query")
+	recordOperationCounter.Inc(p.Query.Type, "query")
 
 	// Scan does not query assets,
 	// it only replaces them with assets then only have name,
 	// so we replace them with some complete assets.
-	makeAssetsComplete(db, payload.DBConn, records)
+	makeAssetsComplete(ctx, db, payload.DBConn, records)
+	timing.mark("assets")
 
-	eagers := eagerIDs(db, records, p.Query)
-	eagerRecords := doQueryEager(db, eagers)
+	for transientKey, transientExpression := range p.Query.ComputedKeys {
+		if transientExpression.Type != skydb.KeyPath {
+			continue
+		}
+		includeRecords(ctx, db, h.AssetStore, records, transientKey, transientExpression.Value.(string), func(record *skydb.Record) bool {
+			return isHiddenByModeration(h.Moderation, payload, record)
+		})
+	}
+	timing.mark("eager_load")
 
 	output := make([]interface{}, len(records))
 	for i := range records {
 		record := records[i]
-
-		for transientKey, transientExpression := range p.Query.ComputedKeys {
-			if transientExpression.Type != skydb.KeyPath {
-				continue
-			}
-
-			keyPath := transientExpression.Value.(string)
-			val := record.Get(keyPath)
-			var transientValue interface{}
-			if val != nil {
-				id := eagers[keyPath][i]
-				eagerRecord := eagerRecords[keyPath][id.Key]
-				if eagerRecord != nil {
-					injectSigner(eagerRecord, h.AssetStore)
-					transientValue = (*skyconv.JSONRecord)(eagerRecord)
-				}
-			}
-
-			if record.Transient == nil {
-				record.Transient = map[string]interface{}{}
-			}
-			record.Transient[transientKey] = transientValue
-		}
-
 		injectSigner(&record, h.AssetStore)
 		output[i] = (*skyconv.JSONRecord)(&record)
 	}
 
 	response.Result = output
 
-	resultInfo, err := queryResultInfo(db, &p.Query, results)
+	resultInfo, err := queryResultInfo(ctx, db, &p.Query, results)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
+	timing.mark("count")
+
+	if p.Explain {
+		explanation, err := explainQuery(ctx, db, &p.Query, timing)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		resultInfo["explain"] = explanation
+	}
+
+	if cursor := nextQueryCursor(&p.Query, records); cursor != "" {
+		resultInfo["cursor"] = cursor
+	}
+
 	if len(resultInfo) > 0 {
 		response.Info = resultInfo
 	}
@@ -625,6 +910,7 @@ func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Re
 type recordDeletePayload struct {
 	RawIDs    []string `mapstructure:"ids"`
 	Atomic    bool     `mapstructure:"atomic"`
+	DryRun    bool     `mapstructure:"dry_run"`
 	RecordIDs []skydb.RecordID
 }
 
@@ -672,10 +958,30 @@ curl -X POST -H "Content-Type: application/json" \
     "ids": ["note/EA6A3E68-90F3-49B5-B470-5FFDB7A0D4E8"]
 }
 EOF
+
+Records referencing a deleted record with the cascade action are deleted,
+and references with the nullify action are set to null, as the user deleting
+the record with their hooks executed. The record is not deleted if the user
+cannot modify any of them.
+
+With master key, specifying "dry_run": true reports the records that would
+be deleted in info.dry_run without deleting them or executing hooks:
+
+{
+    "result": [...],
+    "info": {
+        "dry_run": {
+            "count": 1,
+            "sample_ids": ["note/EA6A3E68-90F3-49B5-B470-5FFDB7A0D4E8"]
+        }
+    }
+}
 */
 type RecordDeleteHandler struct {
 	HookRegistry  *hook.Registry    `inject:"HookRegistry"`
+	AssetStore    asset.Store       `inject:"AssetStore"`
 	AccessModel   skydb.AccessModel `inject:"AccessModel"`
+	RecordStats   *stats.Recorder   `inject:"RecordStats"`
 	Authenticator router.Processor  `preprocessor:"authenticator"`
 	DBConn        router.Processor  `preprocessor:"dbconn"`
 	InjectUser    router.Processor  `preprocessor:"inject_user"`
@@ -700,7 +1006,7 @@ func (h *RecordDeleteHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RecordDeleteHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *RecordDeleteHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &recordDeletePayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -708,6 +1014,10 @@ func (h *RecordDeleteHandler) Handle(payload *router.Payload, response *router.R
 		return
 	}
 
+	if response.Err = checkDryRun(payload, p.DryRun); response.Err != nil {
+		return
+	}
+
 	if payload.Database.IsReadOnly() {
 		response.Err = skyerr.NewError(skyerr.NotSupported, "modifying the selected database is not supported")
 		return
@@ -716,12 +1026,15 @@ func (h *RecordDeleteHandler) Handle(payload *router.Payload, response *router.R
 	req := recordModifyRequest{
 		Db:                payload.Database,
 		Conn:              payload.DBConn,
+		AssetStore:        h.AssetStore,
 		HookRegistry:      h.HookRegistry,
 		RecordIDsToDelete: p.RecordIDs,
+		RecordStats:       h.RecordStats,
 		Atomic:            p.Atomic,
 		WithMasterKey:     payload.HasMasterKey(),
-		Context:           payload.Context,
+		Context:           ctx,
 		UserInfo:          payload.UserInfo,
+		DryRun:            p.DryRun,
 	}
 	resp := recordModifyResponse{
 		ErrMap: map[skydb.RecordID]skyerr.Error{},
@@ -764,4 +1077,9 @@ func (h *RecordDeleteHandler) Handle(payload *router.Payload, response *router.R
 	}
 
 	response.Result = results
+	if p.DryRun {
+		response.Info = map[string]interface{}{
+			"dry_run": newDryRunResult(resp.DeletedRecordIDs),
+		}
+	}
 }
@@ -16,22 +16,30 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook/hooktest"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/memory"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -66,10 +74,10 @@ func TestRecordDeleteHandler(t *testing.T) {
 		}
 
 		db := skydbtest.NewMapDB()
-		So(db.Save(&note0), ShouldBeNil)
-		So(db.Save(&note1), ShouldBeNil)
-		So(db.Save(&noteReadonly), ShouldBeNil)
-		So(db.Save(&user), ShouldBeNil)
+		So(db.Save(context.Background(), &note0), ShouldBeNil)
+		So(db.Save(context.Background(), &note1), ShouldBeNil)
+		So(db.Save(context.Background(), &noteReadonly), ShouldBeNil)
+		So(db.Save(context.Background(), &user), ShouldBeNil)
 
 		router := handlertest.NewSingleRouteRouter(&RecordDeleteHandler{}, func(p *router.Payload) {
 			p.Database = db
@@ -166,11 +174,11 @@ func TestRecordSaveHandler(t *testing.T) {
 	Convey("RecordSaveHandler", t, func() {
 		db := skydbtest.NewMapDB()
 		conn := skydbtest.NewMapConn()
-		conn.SetRecordAccess("report", skydb.NewRecordACL([]skydb.RecordACLEntry{
+		conn.SetRecordAccess(context.Background(), "report", skydb.NewRecordACL([]skydb.RecordACLEntry{
 			skydb.NewRecordACLEntryRole("admin", skydb.CreateLevel),
 		}))
 
-		db.Save(&skydb.Record{
+		db.Save(context.Background(), &skydb.Record{
 			ID: skydb.NewRecordID("note", "readonly"),
 			ACL: skydb.RecordACL{
 				skydb.NewRecordACLEntryDirect("user0", skydb.ReadLevel),
@@ -367,6 +375,403 @@ func TestRecordSaveHandler(t *testing.T) {
 	})
 }
 
+func TestRecordDeleteHandlerDryRun(t *testing.T) {
+	Convey("RecordDeleteHandler dry run", t, func() {
+		note0 := skydb.Record{
+			ID:         skydb.NewRecordID("note", "0"),
+			DatabaseID: "",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("user0", skydb.WriteLevel),
+			},
+		}
+
+		db := skydbtest.NewMapDB()
+		So(db.Save(context.Background(), &note0), ShouldBeNil)
+
+		Convey("reports records without deleting", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordDeleteHandler{}, func(p *router.Payload) {
+				p.Database = db
+				p.AccessKey = router.MasterAccessKey
+			})
+			resp := r.POST(`{
+				"ids": ["note/0", "note/notexistid"],
+				"dry_run": true
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [
+					{"_id": "note/0", "_type": "record"},
+					{"_id": "note/notexistid", "_type": "error", "code": 110, "message": "record not found", "name": "ResourceNotFound"}
+				],
+				"info": {
+					"dry_run": {
+						"count": 1,
+						"sample_ids": ["note/0"]
+					}
+				}
+			}`)
+			So(db.RecordMap, ShouldContainKey, "note/0")
+		})
+
+		Convey("requires master key", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordDeleteHandler{}, func(p *router.Payload) {
+				p.Database = db
+				p.UserInfo = &skydb.UserInfo{
+					ID: "user0",
+				}
+			})
+			resp := r.POST(`{
+				"ids": ["note/0"],
+				"dry_run": true
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "dry run requires master key",
+					"name": "PermissionDenied"
+				}
+			}`)
+			So(db.RecordMap, ShouldContainKey, "note/0")
+		})
+	})
+}
+
+func TestRecordDeleteHandlerReferenceActions(t *testing.T) {
+	Convey("RecordDeleteHandler with reference actions", t, func() {
+		conn := memory.NewConn()
+		db := conn.PublicDB()
+
+		_, err := db.Extend(context.Background(), "collection", skydb.RecordSchema{
+			"name": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"collection": skydb.FieldType{
+				Type:          skydb.TypeReference,
+				ReferenceType: "collection",
+				OnDelete:      skydb.ReferenceCascade,
+			},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend(context.Background(), "tag", skydb.RecordSchema{
+			"collection": skydb.FieldType{
+				Type:          skydb.TypeReference,
+				ReferenceType: "collection",
+				OnDelete:      skydb.ReferenceNullify,
+			},
+		})
+		So(err, ShouldBeNil)
+
+		collectionRef := skydb.NewReference("collection", "collection0")
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("collection", "collection0"),
+			OwnerID: "user0",
+			Data:    skydb.Data{"name": "recipes"},
+		}), ShouldBeNil)
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "note0"),
+			OwnerID: "user0",
+			Data:    skydb.Data{"collection": collectionRef},
+		}), ShouldBeNil)
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("tag", "tag0"),
+			OwnerID: "user0",
+			Data:    skydb.Data{"collection": collectionRef},
+		}), ShouldBeNil)
+
+		r := handlertest.NewSingleRouteRouter(&RecordDeleteHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.UserInfo = &skydb.UserInfo{
+				ID: "user0",
+			}
+		})
+
+		Convey("deletes and nullifies referencing records", func() {
+			resp := r.POST(`{"ids": ["collection/collection0"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [
+					{"_id": "collection/collection0", "_type": "record"}
+				]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note0"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(db.Get(context.Background(), skydb.NewRecordID("tag", "tag0"), &record), ShouldBeNil)
+			So(record.Data["collection"], ShouldBeNil)
+		})
+
+		Convey("does not delete when a referencing record is not writable", func() {
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("note", "note1"),
+				OwnerID: "user1",
+				ACL: skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("user1", skydb.WriteLevel),
+				},
+				Data: skydb.Data{"collection": collectionRef},
+			}), ShouldBeNil)
+
+			resp := r.POST(`{"ids": ["collection/collection0"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "collection/collection0",
+					"_type": "error",
+					"code": 102,
+					"message": "no permission to modify records referencing the record",
+					"name": "PermissionDenied",
+					"info": {"referencing_id": "note/note1"}
+				}]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("collection", "collection0"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note0"), &record), ShouldBeNil)
+		})
+
+		Convey("does not nullify references when a cascaded deletion fails", func() {
+			_, err := db.Extend(context.Background(), "comment", skydb.RecordSchema{
+				"note": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "note",
+					OnDelete:      skydb.ReferenceCascade,
+				},
+			})
+			So(err, ShouldBeNil)
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("comment", "comment0"),
+				OwnerID: "user1",
+				ACL: skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("user1", skydb.WriteLevel),
+				},
+				Data: skydb.Data{"note": skydb.NewReference("note", "note0")},
+			}), ShouldBeNil)
+
+			resp := r.POST(`{"ids": ["collection/collection0"]}`)
+			So(resp.Body.String(), ShouldContainSubstring, `"referencing_id":"comment/comment0"`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("collection", "collection0"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note0"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("tag", "tag0"), &record), ShouldBeNil)
+			So(record.Data["collection"], ShouldResemble, collectionRef)
+		})
+
+		Convey("loads record schemas once", func() {
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("collection", "collection1"),
+				OwnerID: "user0",
+				Data:    skydb.Data{"name": "travel"},
+			}), ShouldBeNil)
+
+			countingDB := &schemaCountingDatabase{Database: db}
+			r := handlertest.NewSingleRouteRouter(&RecordDeleteHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = countingDB
+				p.UserInfo = &skydb.UserInfo{
+					ID: "user0",
+				}
+			})
+
+			r.POST(`{"ids": ["collection/collection0", "collection/collection1"]}`)
+			So(countingDB.count, ShouldEqual, 1)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("collection", "collection1"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note0"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+	})
+}
+
+type schemaCountingDatabase struct {
+	skydb.Database
+	count int
+}
+
+func (db *schemaCountingDatabase) GetRecordSchemas(ctx context.Context) (map[string]skydb.RecordSchema, error) {
+	db.count++
+	return db.Database.GetRecordSchemas(ctx)
+}
+
+func TestRecordSaveThrottle(t *testing.T) {
+	timeNow = func() time.Time { return ZeroTime }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("RecordSaveHandler with throttle", t, func() {
+		db := skydbtest.NewMapDB()
+		conn := skydbtest.NewMapConn()
+		handler := &RecordSaveHandler{
+			Throttle: &throttle.Limiter{
+				WritesPerMinute: map[string]int{"comment": 1},
+			},
+		}
+
+		r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.UserInfo = &skydb.UserInfo{ID: "user0"}
+		})
+
+		Convey("rejects records exceeding the limit of its type", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_id": "comment/1",
+					"content": "first"
+				}, {
+					"_id": "comment/2",
+					"content": "spam"
+				}, {
+					"_id": "note/1",
+					"content": "unlimited"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+
+			var body struct {
+				Result []map[string]interface{} `json:"result"`
+			}
+			So(json.Unmarshal(resp.Body.Bytes(), &body), ShouldBeNil)
+			So(body.Result, ShouldHaveLength, 3)
+			So(body.Result[0]["_type"], ShouldEqual, "record")
+			So(body.Result[1]["_id"], ShouldEqual, "comment/2")
+			So(body.Result[1]["name"], ShouldEqual, "TooManyRequests")
+			So(body.Result[1]["message"], ShouldEqual, "cannot write more than 1 comment records per minute")
+			So(body.Result[1]["info"], ShouldContainKey, "retry_after")
+			So(body.Result[2]["_type"], ShouldEqual, "record")
+
+			So(db.RecordMap, ShouldContainKey, "comment/1")
+			So(db.RecordMap, ShouldNotContainKey, "comment/2")
+		})
+
+		Convey("saves with master key exceeding the limit", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+				p.UserInfo = &skydb.UserInfo{ID: "user0"}
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(`{
+				"records": [{
+					"_id": "comment/1",
+					"content": "first"
+				}, {
+					"_id": "comment/2",
+					"content": "second"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(db.RecordMap, ShouldContainKey, "comment/2")
+		})
+	})
+}
+
+func TestRecordSaveIDPolicy(t *testing.T) {
+	timeNow = func() time.Time { return ZeroTime }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("RecordSaveHandler with record id policy", t, func() {
+		db := skydbtest.NewMapDB()
+		conn := skydbtest.NewMapConn()
+		db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("invoice", "legacy"),
+			OwnerID: "user0",
+		})
+		handler := &RecordSaveHandler{
+			IDPolicy: &recordid.Policy{
+				Format:          recordid.UUIDFormat,
+				Prefixes:        map[string]string{"note": "note-"},
+				ServerGenerated: map[string]bool{"invoice": true},
+			},
+		}
+
+		r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.UserInfo = &skydb.UserInfo{ID: "user0"}
+		})
+
+		resultOf := func(resp *httptest.ResponseRecorder) []map[string]interface{} {
+			var body struct {
+				Result []map[string]interface{} `json:"result"`
+			}
+			So(json.Unmarshal(resp.Body.Bytes(), &body), ShouldBeNil)
+			return body.Result
+		}
+
+		Convey("validates keys of new records", func() {
+			result := resultOf(r.POST(`{
+				"records": [{
+					"_id": "note/note-5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11"
+				}, {
+					"_id": "note/5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11"
+				}, {
+					"_id": "comment/1"
+				}]
+			}`))
+			So(result, ShouldHaveLength, 3)
+			So(result[0]["_type"], ShouldEqual, "record")
+			So(result[1]["_id"], ShouldEqual, "note/5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11")
+			So(result[1]["message"], ShouldEqual, `keys of note records must start with "note-"`)
+			So(result[2]["message"], ShouldEqual, "record key must be a UUID")
+			So(db.RecordMap, ShouldContainKey, "note/note-5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11")
+			So(db.RecordMap, ShouldNotContainKey, "comment/1")
+		})
+
+		Convey("generates keys of records saved without one", func() {
+			result := resultOf(r.POST(`{
+				"records": [{
+					"_id": "invoice/",
+					"amount": 1
+				}, {
+					"_id": "note/",
+					"content": "offline"
+				}]
+			}`))
+			So(result, ShouldHaveLength, 2)
+			So(result[0]["_type"], ShouldEqual, "record")
+			So(result[0]["amount"], ShouldEqual, 1)
+			So(result[1]["_type"], ShouldEqual, "record")
+			So(strings.HasPrefix(result[1]["_id"].(string), "note/note-"), ShouldBeTrue)
+			So(db.RecordMap, ShouldContainKey, result[0]["_id"].(string))
+			So(db.RecordMap, ShouldContainKey, result[1]["_id"].(string))
+		})
+
+		Convey("rejects keys of server generated types", func() {
+			result := resultOf(r.POST(`{
+				"records": [{
+					"_id": "invoice/5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11"
+				}, {
+					"_id": "invoice/legacy",
+					"amount": 2
+				}]
+			}`))
+			So(result[0]["name"], ShouldEqual, "InvalidArgument")
+			So(result[1]["_type"], ShouldEqual, "record")
+			So(db.RecordMap["invoice/legacy"].Data["amount"], ShouldEqual, 2)
+		})
+
+		Convey("saves any key with master key", func() {
+			r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+				p.UserInfo = &skydb.UserInfo{ID: "user0"}
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			result := resultOf(r.POST(`{
+				"records": [{
+					"_id": "invoice/imported"
+				}]
+			}`))
+			So(result[0]["_type"], ShouldEqual, "record")
+			So(db.RecordMap, ShouldContainKey, "invoice/imported")
+		})
+	})
+}
+
 func TestRecordSaveDataType(t *testing.T) {
 	timeNow = func() time.Time { return ZeroTime }
 	defer func() {
@@ -405,7 +810,7 @@ func TestRecordSaveDataType(t *testing.T) {
 }`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("type1", "id1"),
 				Data: map[string]interface{}{
@@ -438,7 +843,7 @@ func TestRecordSaveDataType(t *testing.T) {
 }`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("type1", "id1"),
 				Data: map[string]interface{}{
@@ -474,7 +879,7 @@ func TestRecordSaveDataType(t *testing.T) {
 }`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("type1", "id1"),
 				Data: map[string]interface{}{
@@ -507,7 +912,7 @@ func TestRecordSaveDataType(t *testing.T) {
 }`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("type1", "id1"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("type1", "id1"),
 				Data: map[string]interface{}{
@@ -525,7 +930,7 @@ type bogusFieldDatabaseConnection struct {
 	skydb.Conn
 }
 
-func (db bogusFieldDatabaseConnection) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
+func (db bogusFieldDatabaseConnection) GetRecordAccess(ctx context.Context, recordType string) (skydb.RecordACL, error) {
 	return skydb.NewRecordACL([]skydb.RecordACLEntry{}), nil
 }
 
@@ -537,15 +942,15 @@ type bogusFieldDatabase struct {
 
 func (db bogusFieldDatabase) IsReadOnly() bool { return false }
 
-func (db bogusFieldDatabase) Extend(recordType string, schema skydb.RecordSchema) (bool, error) {
+func (db bogusFieldDatabase) Extend(ctx context.Context, recordType string, schema skydb.RecordSchema) (bool, error) {
 	return false, nil
 }
 
-func (db bogusFieldDatabase) Get(id skydb.RecordID, record *skydb.Record) error {
+func (db bogusFieldDatabase) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
 	return db.GetFunc(id, record)
 }
 
-func (db bogusFieldDatabase) Save(record *skydb.Record) error {
+func (db bogusFieldDatabase) Save(ctx context.Context, record *skydb.Record) error {
 	return db.SaveFunc(record)
 }
 
@@ -656,7 +1061,7 @@ type noExtendDatabase struct {
 
 func (db *noExtendDatabase) IsReadOnly() bool { return false }
 
-func (db *noExtendDatabase) Extend(recordType string, schema skydb.RecordSchema) (bool, error) {
+func (db *noExtendDatabase) Extend(ctx context.Context, recordType string, schema skydb.RecordSchema) (bool, error) {
 	db.calledExtend = true
 	return false, errors.New("You shalt not call Extend")
 }
@@ -698,12 +1103,12 @@ func (db *queryDatabase) ID() string {
 	return db.databaseID
 }
 
-func (db *queryDatabase) QueryCount(query *skydb.Query) (uint64, error) {
+func (db *queryDatabase) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
 	db.lastquery = query
 	return 0, nil
 }
 
-func (db *queryDatabase) Query(query *skydb.Query) (*skydb.Rows, error) {
+func (db *queryDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
 	db.lastquery = query
 	return skydb.EmptyRows, nil
 }
@@ -724,15 +1129,15 @@ func (db *queryResultsDatabase) ID() string {
 	return db.databaseID
 }
 
-func (db *queryResultsDatabase) QueryCount(query *skydb.Query) (uint64, error) {
+func (db *queryResultsDatabase) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
 	return uint64(len(db.records)), nil
 }
 
-func (db *queryResultsDatabase) Query(query *skydb.Query) (*skydb.Rows, error) {
+func (db *queryResultsDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
 	return skydb.NewRows(skydb.NewMemoryRows(db.records)), nil
 }
 
-func (db *queryResultsDatabase) GetSchema(recordType string) (skydb.RecordSchema, error) {
+func (db *queryResultsDatabase) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
 	return db.typemap[recordType], nil
 }
 
@@ -796,7 +1201,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery, ShouldResemble, &skydb.Query{
@@ -818,7 +1223,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery, ShouldResemble, &skydb.Query{
@@ -842,7 +1247,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery, ShouldResemble, &skydb.Query{
@@ -871,7 +1276,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery, ShouldResemble, &skydb.Query{
@@ -913,7 +1318,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery, ShouldResemble, &skydb.Query{
@@ -930,6 +1335,41 @@ func TestRecordQuery(t *testing.T) {
 			})
 		})
 
+		Convey("Queries records including rank function", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "score",
+					"include": map[string]interface{}{
+						"rank": []interface{}{
+							"func",
+							"rank",
+							map[string]interface{}{
+								"$type": "keypath",
+								"$val":  "points",
+							},
+							"asc",
+						},
+					},
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(db.lastquery.ComputedKeys, ShouldResemble, map[string]skydb.Expression{
+				"rank": skydb.Expression{
+					Type: skydb.Function,
+					Value: skydb.RankFunc{
+						Field: "points",
+						Order: skydb.Asc,
+					},
+				},
+			})
+		})
+
 		Convey("Queries records with predicate", func() {
 			payload := router.Payload{
 				Data: map[string]interface{}{
@@ -948,7 +1388,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
@@ -997,7 +1437,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
@@ -1055,7 +1495,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
@@ -1098,7 +1538,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.ComputedKeys, ShouldResemble, map[string]skydb.Expression{
@@ -1123,7 +1563,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.DesiredKeys, ShouldResemble, []string{"location"})
@@ -1140,7 +1580,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.DesiredKeys, ShouldResemble, []string{})
@@ -1157,7 +1597,7 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
 			So(db.lastquery.DesiredKeys, ShouldBeNil)
@@ -1175,52 +1615,359 @@ func TestRecordQuery(t *testing.T) {
 			response := router.Response{}
 
 			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(db.lastquery.Limit, ShouldNotBeNil)
+			So(*db.lastquery.Limit, ShouldEqual, 200)
+			So(db.lastquery.Offset, ShouldEqual, 400)
+		})
+
+		Convey("Queries records with count", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"count":       true,
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(db.lastquery.GetCount, ShouldBeTrue)
+		})
+
+		Convey("Propagate invalid query error", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"predicate": []interface{}{
+						"eq",
+						map[string]interface{}{
+							"$type": "keypath",
+							"$val":  "content",
+						},
+						map[string]interface{}{},
+					},
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldNotBeNil)
+		})
+	})
+}
+
+type explainQueryDatabase struct {
+	queryDatabase
+}
+
+func (db *explainQueryDatabase) ExplainQuery(ctx context.Context, query *skydb.Query) (*skydb.QueryPlan, error) {
+	return &skydb.QueryPlan{
+		Statement:     `SELECT * FROM "note"`,
+		Indexes:       []string{"note_pkey"},
+		Plan:          map[string]interface{}{"Node Type": "Index Scan"},
+		PlanningTime:  time.Millisecond,
+		ExecutionTime: 2 * time.Millisecond,
+	}, nil
+}
+
+func TestRecordQueryExplain(t *testing.T) {
+	Convey("Given a Database supporting explain", t, func() {
+		db := &explainQueryDatabase{}
+
+		Convey("explains query with master key", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"explain":     true,
+				},
+				Database:  db,
+				AccessKey: router.MasterAccessKey,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			explanation := response.Info.(map[string]interface{})["explain"].(map[string]interface{})
+			So(explanation["statement"], ShouldEqual, `SELECT * FROM "note"`)
+			So(explanation["args"], ShouldResemble, []interface{}{})
+			So(explanation["indexes"], ShouldResemble, []string{"note_pkey"})
+			So(explanation["plan"], ShouldResemble, map[string]interface{}{"Node Type": "Index Scan"})
+
+			timing := explanation["timing"].(map[string]float64)
+			So(timing["planning"], ShouldEqual, 1)
+			So(timing["execution"], ShouldEqual, 2)
+			So(timing, ShouldContainKey, "query")
+			So(timing, ShouldContainKey, "eager_load")
+			So(timing, ShouldContainKey, "total")
+		})
+
+		Convey("rejects explain without master key", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"explain":     true,
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldNotBeNil)
+			So(response.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+			So(db.lastquery, ShouldBeNil)
+		})
+
+		Convey("does not explain by default", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+				},
+				Database:  db,
+				AccessKey: router.MasterAccessKey,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(response.Info, ShouldBeNil)
+		})
+	})
+}
+
+func TestRecordQueryHints(t *testing.T) {
+	Convey("Given a Database", t, func() {
+		db := &queryDatabase{}
+
+		Convey("passes hints with master key", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"hints": map[string]interface{}{
+						"index":            "note_content_idx",
+						"disable_seq_scan": true,
+						"join_strategy":    "merge",
+					},
+				},
+				Database:  db,
+				AccessKey: router.MasterAccessKey,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(db.lastquery.Hints, ShouldResemble, &skydb.QueryHints{
+				Index:          "note_content_idx",
+				DisableSeqScan: true,
+				JoinStrategy:   skydb.MergeJoin,
+			})
+		})
+
+		Convey("rejects hints without master key", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"hints": map[string]interface{}{
+						"disable_seq_scan": true,
+					},
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldNotBeNil)
+			So(response.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+			So(db.lastquery, ShouldBeNil)
+		})
+
+		Convey("rejects unknown join strategy", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"hints": map[string]interface{}{
+						"join_strategy": "sort",
+					},
+				},
+				Database:  db,
+				AccessKey: router.MasterAccessKey,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldNotBeNil)
+			So(response.Err.Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+	})
+}
+
+func TestRecordQueryPredicateVariables(t *testing.T) {
+	Convey("Given a Database", t, func() {
+		db := &queryDatabase{}
+		now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = timeNowUTC
+		}()
+
+		Convey("resolves variables for the user", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"predicate": []interface{}{
+						"and",
+						[]interface{}{
+							"eq",
+							map[string]interface{}{"$type": "keypath", "$val": "_owner_id"},
+							map[string]interface{}{"$type": "var", "$val": "current_user_id"},
+						},
+						[]interface{}{
+							"in",
+							map[string]interface{}{"$type": "keypath", "$val": "audience"},
+							map[string]interface{}{"$type": "var", "$val": "user_roles"},
+						},
+						[]interface{}{
+							"lt",
+							map[string]interface{}{"$type": "keypath", "$val": "publish_at"},
+							map[string]interface{}{"$type": "var", "$val": "now"},
+						},
+					},
+				},
+				Database: db,
+				UserInfo: &skydb.UserInfo{
+					ID:    "user0",
+					Roles: []string{"editor"},
+				},
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
+
+			So(response.Err, ShouldBeNil)
+			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "_owner_id"},
+							skydb.Expression{Type: skydb.Literal, Value: "user0"},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.In,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "audience"},
+							skydb.Expression{Type: skydb.Literal, Value: []interface{}{"editor"}},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.LessThan,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "publish_at"},
+							skydb.Expression{Type: skydb.Literal, Value: now},
+						},
+					},
+				},
+			})
+		})
+
+		Convey("rejects unknown variable", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"record_type": "note",
+					"predicate": []interface{}{
+						"eq",
+						map[string]interface{}{"$type": "keypath", "$val": "_owner_id"},
+						map[string]interface{}{"$type": "var", "$val": "owner"},
+					},
+				},
+				Database: db,
+			}
+			response := router.Response{}
+
+			handler := &RecordQueryHandler{}
+			handler.Handle(context.Background(), &payload, &response)
 
-			So(response.Err, ShouldBeNil)
-			So(db.lastquery.Limit, ShouldNotBeNil)
-			So(*db.lastquery.Limit, ShouldEqual, 200)
-			So(db.lastquery.Offset, ShouldEqual, 400)
+			So(response.Err, ShouldNotBeNil)
+			So(db.lastquery, ShouldBeNil)
 		})
+	})
+}
+
+func TestRecordQueryBeforeQueryHook(t *testing.T) {
+	Convey("Given a Database with beforeQuery hooks", t, func() {
+		db := &queryDatabase{}
+		registry := hook.NewRegistry()
+		handler := &RecordQueryHandler{HookRegistry: registry}
+
+		Convey("queries with the query modified by hook", func() {
+			var hookedQuery map[string]interface{}
+			registry.RegisterQueryHook("note", func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+				hookedQuery = query
+				return map[string]interface{}{
+					"record_type": "secret",
+					"limit":       float64(5),
+				}, nil
+			})
 
-		Convey("Queries records with count", func() {
 			payload := router.Payload{
 				Data: map[string]interface{}{
-					"record_type": "note",
-					"count":       true,
+					"action":       "record:query",
+					"access_token": "token",
+					"record_type":  "note",
 				},
 				Database: db,
 			}
 			response := router.Response{}
-
-			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldBeNil)
-			So(db.lastquery.GetCount, ShouldBeTrue)
+			So(hookedQuery, ShouldResemble, map[string]interface{}{
+				"record_type": "note",
+			})
+			So(db.lastquery.Type, ShouldEqual, "note")
+			So(*db.lastquery.Limit, ShouldEqual, 5)
 		})
 
-		Convey("Propagate invalid query error", func() {
+		Convey("rejects the query rejected by hook", func() {
+			registry.RegisterQueryHook("note", func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+				return nil, skyerr.NewError(skyerr.PermissionDenied, "cannot query note")
+			})
+
 			payload := router.Payload{
 				Data: map[string]interface{}{
 					"record_type": "note",
-					"predicate": []interface{}{
-						"eq",
-						map[string]interface{}{
-							"$type": "keypath",
-							"$val":  "content",
-						},
-						map[string]interface{}{},
-					},
 				},
 				Database: db,
 			}
 			response := router.Response{}
-
-			handler := &RecordQueryHandler{}
-			handler.Handle(&payload, &response)
+			handler.Handle(context.Background(), &payload, &response)
 
 			So(response.Err, ShouldNotBeNil)
+			So(response.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+			So(db.lastquery, ShouldBeNil)
 		})
 	})
 }
@@ -1242,29 +1989,29 @@ func (db *singleRecordDatabase) ID() string {
 	return db.databaseID
 }
 
-func (db *singleRecordDatabase) Get(id skydb.RecordID, record *skydb.Record) error {
+func (db *singleRecordDatabase) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
 	*record = db.record
 	return nil
 }
 
-func (db *singleRecordDatabase) Save(record *skydb.Record) error {
+func (db *singleRecordDatabase) Save(ctx context.Context, record *skydb.Record) error {
 	*record = db.record
 	return nil
 }
 
-func (db *singleRecordDatabase) QueryCount(query *skydb.Query) (uint64, error) {
+func (db *singleRecordDatabase) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
 	return uint64(1), nil
 }
 
-func (db *singleRecordDatabase) Query(query *skydb.Query) (*skydb.Rows, error) {
+func (db *singleRecordDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
 	return skydb.NewRows(skydb.NewMemoryRows([]skydb.Record{db.record})), nil
 }
 
-func (db *singleRecordDatabase) Extend(recordType string, schema skydb.RecordSchema) (bool, error) {
+func (db *singleRecordDatabase) Extend(ctx context.Context, recordType string, schema skydb.RecordSchema) (bool, error) {
 	return false, nil
 }
 
-func (db *singleRecordDatabase) GetSchema(recordType string) (skydb.RecordSchema, error) {
+func (db *singleRecordDatabase) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
 	return db.recordSchema, nil
 }
 
@@ -1378,7 +2125,7 @@ func TestRecordMetaData(t *testing.T) {
 			}`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("record", "id"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("record", "id"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID:        skydb.NewRecordID("record", "id"),
 				OwnerID:   "requestUserID",
@@ -1391,7 +2138,7 @@ func TestRecordMetaData(t *testing.T) {
 		})
 
 		Convey("on an existing record", func() {
-			db.Save(&skydb.Record{
+			db.Save(context.Background(), &skydb.Record{
 				ID:        skydb.NewRecordID("record", "id"),
 				CreatedAt: time.Date(2006, 1, 2, 15, 4, 4, 0, time.UTC),
 				CreatorID: "creatorID",
@@ -1417,7 +2164,7 @@ func TestRecordMetaData(t *testing.T) {
 			}`)
 
 			record := skydb.Record{}
-			So(db.Get(skydb.NewRecordID("record", "id"), &record), ShouldBeNil)
+			So(db.Get(context.Background(), skydb.NewRecordID("record", "id"), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID:        skydb.NewRecordID("record", "id"),
 				CreatedAt: time.Date(2006, 1, 2, 15, 4, 4, 0, time.UTC),
@@ -1456,7 +2203,7 @@ func (s *urlOnlyAssetStore) IsSignatureRequired() bool {
 func TestRecordAssetSerialization(t *testing.T) {
 	Convey("RecordAssetSerialization for fetch", t, func() {
 		db := skydbtest.NewMapDB()
-		db.Save(&skydb.Record{
+		db.Save(context.Background(), &skydb.Record{
 			ID: skydb.NewRecordID("record", "id"),
 			Data: map[string]interface{}{
 				"asset": &skydb.Asset{
@@ -1558,7 +2305,7 @@ func (db *referencedRecordDatabase) ID() string {
 
 func (db *referencedRecordDatabase) UserRecordType() string { return "user" }
 
-func (db *referencedRecordDatabase) Get(id skydb.RecordID, record *skydb.Record) error {
+func (db *referencedRecordDatabase) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
 	switch id.String() {
 	case "note/note1":
 		*record = db.note
@@ -1572,7 +2319,7 @@ func (db *referencedRecordDatabase) Get(id skydb.RecordID, record *skydb.Record)
 	return nil
 }
 
-func (db *referencedRecordDatabase) GetByIDs(ids []skydb.RecordID) (*skydb.Rows, error) {
+func (db *referencedRecordDatabase) GetByIDs(ctx context.Context, ids []skydb.RecordID) (*skydb.Rows, error) {
 	records := []skydb.Record{}
 	for _, id := range ids {
 		switch id.String() {
@@ -1589,23 +2336,23 @@ func (db *referencedRecordDatabase) GetByIDs(ids []skydb.RecordID) (*skydb.Rows,
 	return skydb.NewRows(skydb.NewMemoryRows(records)), nil
 }
 
-func (db *referencedRecordDatabase) Save(record *skydb.Record) error {
+func (db *referencedRecordDatabase) Save(ctx context.Context, record *skydb.Record) error {
 	return nil
 }
 
-func (db *referencedRecordDatabase) QueryCount(query *skydb.Query) (uint64, error) {
+func (db *referencedRecordDatabase) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
 	return uint64(1), nil
 }
 
-func (db *referencedRecordDatabase) Query(query *skydb.Query) (*skydb.Rows, error) {
+func (db *referencedRecordDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
 	return skydb.NewRows(skydb.NewMemoryRows([]skydb.Record{db.note})), nil
 }
 
-func (db *referencedRecordDatabase) Extend(recordType string, schema skydb.RecordSchema) (bool, error) {
+func (db *referencedRecordDatabase) Extend(ctx context.Context, recordType string, schema skydb.RecordSchema) (bool, error) {
 	return false, nil
 }
 
-func (db *referencedRecordDatabase) GetSchema(recordType string) (skydb.RecordSchema, error) {
+func (db *referencedRecordDatabase) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
 	typemap := map[string]skydb.RecordSchema{
 		"note": skydb.RecordSchema{
 			"category": skydb.FieldType{
@@ -1695,6 +2442,32 @@ func TestRecordQueryWithEagerLoad(t *testing.T) {
 			}`)
 		})
 
+		Convey("query record with eager load hidden by moderation", func() {
+			db.category.Data["moderation_status"] = "pending"
+			resp := handlertest.NewSingleRouteRouter(&RecordQueryHandler{
+				Moderation: &moderation.Pipeline{
+					Fields: map[string][]string{"category": []string{"title"}},
+				},
+			}, injectDBFunc).POST(`{
+				"record_type": "note",
+				"include": {"category": {"$type": "keypath", "$val": "category"}}
+			}`)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "note/note1",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "ownerID",
+					"category": {"$id":"category/important","$type":"ref"},
+					"city": {"$id":"city/beautiful","$type":"ref"},
+					"_transient": {
+						"category": null
+					}
+				}]
+			}`)
+		})
+
 		Convey("query record with multiple eager load", func() {
 			resp := handlertest.NewSingleRouteRouter(&RecordQueryHandler{}, injectDBFunc).POST(`{
 				"record_type": "note",
@@ -1796,6 +2569,213 @@ func TestRecordQueryWithEagerLoad(t *testing.T) {
 	})
 }
 
+// includeRecordDatabase returns the posts on query, and any of its records
+// by ID.
+type includeRecordDatabase struct {
+	posts         []skydb.Record
+	records       map[skydb.RecordID]skydb.Record
+	getByIDsCount int
+	skydb.Database
+}
+
+func (db *includeRecordDatabase) ID() string { return skydb.PublicDatabaseIdentifier }
+
+func (db *includeRecordDatabase) UserRecordType() string { return "user" }
+
+func (db *includeRecordDatabase) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
+	return skydb.RecordSchema{}, nil
+}
+
+func (db *includeRecordDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	return skydb.NewRows(skydb.NewMemoryRows(db.posts)), nil
+}
+
+func (db *includeRecordDatabase) GetByIDs(ctx context.Context, ids []skydb.RecordID) (*skydb.Rows, error) {
+	db.getByIDsCount++
+	records := []skydb.Record{}
+	for _, id := range ids {
+		if record, ok := db.records[id]; ok {
+			records = append(records, record)
+		}
+	}
+	return skydb.NewRows(skydb.NewMemoryRows(records)), nil
+}
+
+func TestRecordQueryWithNestedInclude(t *testing.T) {
+	Convey("Given posts referencing authors in organizations", t, func() {
+		organization := skydb.Record{
+			ID:      skydb.NewRecordID("organization", "oursky"),
+			OwnerID: "ownerID",
+			Data: map[string]interface{}{
+				"name": "Oursky",
+			},
+		}
+		author1 := skydb.Record{
+			ID:      skydb.NewRecordID("author", "author1"),
+			OwnerID: "ownerID",
+			Data: map[string]interface{}{
+				"organization": skydb.NewReference("organization", "oursky"),
+			},
+		}
+		author2 := skydb.Record{
+			ID:      skydb.NewRecordID("author", "author2"),
+			OwnerID: "ownerID",
+			Data: map[string]interface{}{
+				"organization": nil,
+				"favorite":     skydb.NewReference("post", "post2"),
+			},
+		}
+		post1 := skydb.Record{
+			ID:      skydb.NewRecordID("post", "post1"),
+			OwnerID: "ownerID",
+			Data: map[string]interface{}{
+				"author": skydb.NewReference("author", "author1"),
+			},
+		}
+		post2 := skydb.Record{
+			ID:      skydb.NewRecordID("post", "post2"),
+			OwnerID: "ownerID",
+			Data: map[string]interface{}{
+				"author": skydb.NewReference("author", "author2"),
+			},
+		}
+
+		db := &includeRecordDatabase{
+			posts: []skydb.Record{post1, post2},
+			records: map[skydb.RecordID]skydb.Record{
+				organization.ID: organization,
+				author1.ID:      author1,
+				author2.ID:      author2,
+				post1.ID:        post1,
+				post2.ID:        post2,
+			},
+		}
+
+		r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{}, func(p *router.Payload) {
+			p.Database = db
+		})
+
+		Convey("includes records across references", func() {
+			resp := r.POST(`{
+				"record_type": "post",
+				"include": {"author": {"$type": "keypath", "$val": "author.organization"}}
+			}`)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "post/post1",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "ownerID",
+					"author": {"$id":"author/author1","$type":"ref"},
+					"_transient": {
+						"author": {
+							"_id": "author/author1",
+							"_type": "record",
+							"_access": null,
+							"_ownerID": "ownerID",
+							"organization": {"$id":"organization/oursky","$type":"ref"},
+							"_transient": {
+								"organization": {"_id":"organization/oursky","_type":"record","_access":null,"_ownerID":"ownerID","name":"Oursky"}
+							}
+						}
+					}
+				}, {
+					"_id": "post/post2",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "ownerID",
+					"author": {"$id":"author/author2","$type":"ref"},
+					"_transient": {
+						"author": {
+							"_id": "author/author2",
+							"_type": "record",
+							"_access": null,
+							"_ownerID": "ownerID",
+							"organization": null,
+							"favorite": {"$id":"post/post2","$type":"ref"},
+							"_transient": {
+								"organization": null
+							}
+						}
+					}
+				}]
+			}`)
+			So(db.getByIDsCount, ShouldEqual, 2)
+		})
+
+		Convey("does not expand a record it is included from", func() {
+			resp := r.POST(`{
+				"record_type": "post",
+				"include": {"author": {"$type": "keypath", "$val": "author.favorite.author"}}
+			}`)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "post/post1",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "ownerID",
+					"author": {"$id":"author/author1","$type":"ref"},
+					"_transient": {
+						"author": {
+							"_id": "author/author1",
+							"_type": "record",
+							"_access": null,
+							"_ownerID": "ownerID",
+							"organization": {"$id":"organization/oursky","$type":"ref"},
+							"_transient": {
+								"favorite": null
+							}
+						}
+					}
+				}, {
+					"_id": "post/post2",
+					"_type": "record",
+					"_access": null,
+					"_ownerID": "ownerID",
+					"author": {"$id":"author/author2","$type":"ref"},
+					"_transient": {
+						"author": {
+							"_id": "author/author2",
+							"_type": "record",
+							"_access": null,
+							"_ownerID": "ownerID",
+							"organization": null,
+							"favorite": {"$id":"post/post2","$type":"ref"},
+							"_transient": {
+								"favorite": null
+							}
+						}
+					}
+				}]
+			}`)
+		})
+
+		Convey("rejects include key path exceeding the maximum depth", func() {
+			r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{
+				Settings: &QuerySettings{MaxIncludeDepth: 1},
+			}, func(p *router.Payload) {
+				p.Database = db
+			})
+			resp := r.POST(`{
+				"record_type": "post",
+				"include": {"author": {"$type": "keypath", "$val": "author.organization"}}
+			}`)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "include key path `+"`author.organization`"+` exceeds the maximum depth of 1",
+					"info": {"arguments": ["include"]}
+				}
+			}`)
+			So(db.getByIDsCount, ShouldEqual, 0)
+		})
+	})
+}
+
 func TestRecordQueryWithCount(t *testing.T) {
 	Convey("Given a Database with records", t, func() {
 		record0 := skydb.Record{
@@ -1850,21 +2830,121 @@ func TestRecordQueryWithCount(t *testing.T) {
 	})
 }
 
+func TestRecordQueryWithCursor(t *testing.T) {
+	Convey("Given a Database with records", t, func() {
+		conn := memory.NewConn()
+		db := conn.PublicDB()
+		for i, key := range []string{"note1", "note2", "note3"} {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", key),
+				OwnerID: "ownerID",
+				Data: map[string]interface{}{
+					"noteOrder": float64(3 - i),
+				},
+			}
+			So(db.Save(context.Background(), &record), ShouldBeNil)
+		}
+
+		r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+		})
+
+		type queryResponse struct {
+			Result []struct {
+				ID string `json:"_id"`
+			} `json:"result"`
+			Info struct {
+				Count  uint64 `json:"count"`
+				Cursor string `json:"cursor"`
+			} `json:"info"`
+		}
+		query := func(cursor string) queryResponse {
+			cursorJSON := ""
+			if cursor != "" {
+				cursorJSON = fmt.Sprintf(`, "cursor": "%s"`, cursor)
+			}
+			resp := r.POST(`{
+				"record_type": "note",
+				"sort": [[{"$type": "keypath", "$val": "noteOrder"}, "desc"]],
+				"limit": 2,
+				"count": true` + cursorJSON + `
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			result := queryResponse{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			return result
+		}
+
+		Convey("continues query with cursor", func() {
+			page := query("")
+			So(len(page.Result), ShouldEqual, 2)
+			So(page.Result[0].ID, ShouldEqual, "note/note1")
+			So(page.Result[1].ID, ShouldEqual, "note/note2")
+			So(page.Info.Count, ShouldEqual, 3)
+			So(page.Info.Cursor, ShouldNotBeEmpty)
+
+			page = query(page.Info.Cursor)
+			So(len(page.Result), ShouldEqual, 1)
+			So(page.Result[0].ID, ShouldEqual, "note/note3")
+			So(page.Info.Count, ShouldEqual, 3)
+			So(page.Info.Cursor, ShouldBeEmpty)
+		})
+
+		Convey("rejects malformed cursor", func() {
+			resp := r.POST(`{
+				"record_type": "note",
+				"cursor": "malformed"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "cursor is malformed",
+					"info": {"arguments": ["cursor"]}
+				}
+			}`)
+		})
+
+		Convey("rejects cursor not matching the sort", func() {
+			cursor, err := encodeQueryCursor(&skydb.QueryCursor{
+				Values: []interface{}{float64(2)},
+				ID:     "note2",
+			})
+			So(err, ShouldBeNil)
+
+			resp := r.POST(`{
+				"record_type": "note",
+				"cursor": "` + cursor + `"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "cursor does not match the sort of the query",
+					"info": {"arguments": ["cursor"]}
+				}
+			}`)
+		})
+	})
+}
+
 type erroneousDB struct {
 	skydb.Database
 }
 
 func (db erroneousDB) IsReadOnly() bool { return false }
 
-func (db erroneousDB) Extend(string, skydb.RecordSchema) (bool, error) {
+func (db erroneousDB) Extend(context.Context, string, skydb.RecordSchema) (bool, error) {
 	return false, nil
 }
 
-func (db erroneousDB) Get(skydb.RecordID, *skydb.Record) error {
+func (db erroneousDB) Get(context.Context, skydb.RecordID, *skydb.Record) error {
 	return errors.New("erroneous save")
 }
 
-func (db erroneousDB) Save(*skydb.Record) error {
+func (db erroneousDB) Save(context.Context, *skydb.Record) error {
 	return errors.New("erroneous save")
 }
 
@@ -1912,7 +2992,7 @@ func TestHookExecution(t *testing.T) {
 				registry.Register(test.afterActionKind, "record", afterHook.Func)
 
 				db := skydbtest.NewMapDB()
-				So(db.Save(record), ShouldBeNil)
+				So(db.Save(context.Background(), record), ShouldBeNil)
 
 				r := handlertest.NewSingleRouteRouter(test.handler, func(p *router.Payload) {
 					p.Database = db
@@ -1970,7 +3050,7 @@ func TestHookExecution(t *testing.T) {
 			}`)
 
 			var record skydb.Record
-			So(db.Get(skydb.NewRecordID("record", "id"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(db.Get(context.Background(), skydb.NewRecordID("record", "id"), &record), ShouldEqual, skydb.ErrRecordNotFound)
 		})
 
 		Convey("BeforeSave should be fed fully fetched record", func() {
@@ -1980,7 +3060,7 @@ func TestHookExecution(t *testing.T) {
 					"old": true,
 				},
 			}
-			So(db.Save(&existingRecord), ShouldBeNil)
+			So(db.Save(context.Background(), &existingRecord), ShouldBeNil)
 
 			called := false
 			registry.Register(hook.BeforeSave, "record", func(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
@@ -2060,32 +3140,32 @@ func (db *selectiveDatabase) SetFilter(filterFunc filterFuncDef) {
 	db.filterFunc = filterFunc
 }
 
-func (db *selectiveDatabase) Get(id skydb.RecordID, record *skydb.Record) error {
+func (db *selectiveDatabase) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
 	if err := db.filterFunc("GET", id, nil); err != nil {
 		return err
 	}
 
-	return db.Database.Get(id, record)
+	return db.Database.Get(context.Background(), id, record)
 }
 
-func (db *selectiveDatabase) Save(record *skydb.Record) error {
+func (db *selectiveDatabase) Save(ctx context.Context, record *skydb.Record) error {
 	if err := db.filterFunc("SAVE", record.ID, record); err != nil {
 		return err
 	}
 
-	return db.Database.Save(record)
+	return db.Database.Save(context.Background(), record)
 }
 
-func (db *selectiveDatabase) Delete(id skydb.RecordID) error {
+func (db *selectiveDatabase) Delete(ctx context.Context, id skydb.RecordID) error {
 	if err := db.filterFunc("DELETE", id, nil); err != nil {
 		return err
 	}
 
-	return db.Database.Delete(id)
+	return db.Database.Delete(context.Background(), id)
 }
 
-func (db *selectiveDatabase) Begin() error {
-	return db.Database.(skydb.TxDatabase).Begin()
+func (db *selectiveDatabase) Begin(ctx context.Context) error {
+	return db.Database.(skydb.TxDatabase).Begin(context.Background())
 }
 
 func (db *selectiveDatabase) Commit() error {
@@ -2197,7 +3277,7 @@ func TestAtomicOperation(t *testing.T) {
 				}`)
 
 				var record skydb.Record
-				So(backingDB.Get(skydb.NewRecordID("note", "0"), &record), ShouldBeNil)
+				So(backingDB.Get(context.Background(), skydb.NewRecordID("note", "0"), &record), ShouldBeNil)
 				So(record, ShouldResemble, skydb.Record{
 					ID:        skydb.NewRecordID("note", "0"),
 					Data:      map[string]interface{}{},
@@ -2205,7 +3285,7 @@ func TestAtomicOperation(t *testing.T) {
 					CreatorID: "user0",
 					UpdaterID: "user0",
 				})
-				So(backingDB.Get(skydb.NewRecordID("note", "1"), &record), ShouldBeNil)
+				So(backingDB.Get(context.Background(), skydb.NewRecordID("note", "1"), &record), ShouldBeNil)
 				So(record, ShouldResemble, skydb.Record{
 					ID:        skydb.NewRecordID("note", "1"),
 					Data:      map[string]interface{}{},
@@ -2219,6 +3299,60 @@ func TestAtomicOperation(t *testing.T) {
 				So(txDB.DidRollback, ShouldBeFalse)
 			})
 
+			Convey("rolls back saved records on after save hook error", func() {
+				db.SetFilter(func(op string, recordID skydb.RecordID, record *skydb.Record) skyerr.Error {
+					return nil
+				})
+
+				registry := hook.NewRegistry()
+				registry.Register(hook.AfterSave, "note", func(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
+					if record.ID.Key == "1" {
+						return skyerr.NewError(skyerr.UnexpectedError, "no hooks for you")
+					}
+					return nil
+				})
+				r := handlertest.NewSingleRouteRouter(&RecordSaveHandler{
+					HookRegistry: registry,
+				}, func(payload *router.Payload) {
+					payload.DBConn = conn
+					payload.Database = db
+					payload.UserInfo = &skydb.UserInfo{
+						ID: "user0",
+					}
+				})
+
+				resp := r.POST(`{
+					"records": [{
+						"_id": "note/0",
+						"_type": "record"
+					},
+					{
+						"_id": "note/1",
+						"_type": "record"
+					}],
+					"atomic": true
+				}`)
+
+				So(resp.Body.String(), ShouldEqualJSON, `{
+					"error": {
+						"code": 115,
+						"name": "AtomicOperationFailure",
+						"message": "Atomic Operation rolled back due to one or more errors",
+						"info": {
+							"note/1": {
+								"code": 10000,
+								"message": "no hooks for you",
+								"name": "UnexpectedError"
+							}
+						}
+					}
+				}`)
+
+				So(txDB.DidBegin, ShouldBeTrue)
+				So(txDB.DidCommit, ShouldBeFalse)
+				So(txDB.DidRollback, ShouldBeTrue)
+			})
+
 			Convey("fails whole request on any records mal-format", func() {
 				db.SetFilter(func(op string, recordID skydb.RecordID, record *skydb.Record) skyerr.Error {
 					return nil
@@ -2265,13 +3399,13 @@ func TestAtomicOperation(t *testing.T) {
 		})
 
 		Convey("for RecordDeleteHandler", func() {
-			So(backingDB.Save(&skydb.Record{
+			So(backingDB.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "0"),
 			}), ShouldBeNil)
-			So(backingDB.Save(&skydb.Record{
+			So(backingDB.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "1"),
 			}), ShouldBeNil)
-			So(backingDB.Save(&skydb.Record{
+			So(backingDB.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "2"),
 			}), ShouldBeNil)
 
@@ -2342,9 +3476,9 @@ func TestAtomicOperation(t *testing.T) {
 				}`)
 
 				var record skydb.Record
-				So(backingDB.Get(skydb.NewRecordID("record", "0"), &record), ShouldEqual, skydb.ErrRecordNotFound)
-				So(backingDB.Get(skydb.NewRecordID("record", "1"), &record), ShouldEqual, skydb.ErrRecordNotFound)
-				So(backingDB.Get(skydb.NewRecordID("record", "2"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+				So(backingDB.Get(context.Background(), skydb.NewRecordID("record", "0"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+				So(backingDB.Get(context.Background(), skydb.NewRecordID("record", "1"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+				So(backingDB.Get(context.Background(), skydb.NewRecordID("record", "2"), &record), ShouldEqual, skydb.ErrRecordNotFound)
 
 				So(txDB.DidBegin, ShouldBeTrue)
 				So(txDB.DidCommit, ShouldBeTrue)
@@ -2,16 +2,26 @@ package handler
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
+	"github.com/skygeario/skygear-server/pkg/server/utils"
 )
 
 func injectSigner(record *skydb.Record, store asset.Store) {
@@ -37,9 +47,20 @@ func atomicModifyFunc(req *recordModifyRequest, resp *recordModifyResponse, mFun
 			return
 		}
 
-		txErr := withTransaction(txDB, func() error {
+		// asynchronous hooks are queued only after the records are
+		// committed
+		ctx := req.Context
+		var pending *hook.Pending
+		req.Context, pending = hook.WithPending(ctx)
+		req.inTransaction = true
+		txErr := withTransaction(req.Context, txDB, func() error {
 			return mFunc(req, resp)
 		})
+		req.Context = ctx
+		req.inTransaction = false
+		if txErr == nil {
+			pending.Run()
+		}
 
 		if len(resp.ErrMap) > 0 {
 			info := map[string]interface{}{}
@@ -60,8 +81,8 @@ func atomicModifyFunc(req *recordModifyRequest, resp *recordModifyResponse, mFun
 	}
 }
 
-func withTransaction(txDB skydb.TxDatabase, do func() error) (err error) {
-	err = txDB.Begin()
+func withTransaction(ctx context.Context, txDB skydb.TxDatabase, do func() error) (err error) {
+	err = txDB.Begin(ctx)
 	if err != nil {
 		return
 	}
@@ -91,9 +112,34 @@ type recordModifyRequest struct {
 
 	// Save only
 	RecordsToSave []*skydb.Record
+	Quota         *quota.Enforcer
+	Throttle      *throttle.Limiter
+
+	// RecordIDPolicy validates the IDs of new records, except those in
+	// GeneratedRecordIDs which are generated by server
+	RecordIDPolicy     *recordid.Policy
+	GeneratedRecordIDs map[skydb.RecordID]bool
+
+	RecordStats *stats.Recorder
 
 	// Delete Only
 	RecordIDsToDelete []skydb.RecordID
+
+	// deletingRecordIDs are the records being deleted by the request,
+	// including those deleted by cascade, which are not cascaded again
+	deletingRecordIDs map[skydb.RecordID]bool
+
+	// recordSchemas are loaded once for the reference actions of all
+	// records deleted by the request
+	recordSchemas map[string]skydb.RecordSchema
+
+	// inTransaction is true when the request is executed in a
+	// transaction already
+	inTransaction bool
+
+	// DryRun checks which records would be modified without executing
+	// hooks or modifying them
+	DryRun bool
 }
 
 type recordModifyResponse struct {
@@ -119,11 +165,11 @@ func newRecordFetcher(db skydb.Database, conn skydb.Conn, withMasterKey bool) re
 	}
 }
 
-func (f recordFetcher) getCreationAccess(recordType string) skydb.RecordACL {
+func (f recordFetcher) getCreationAccess(ctx context.Context, recordType string) skydb.RecordACL {
 	creationAccess, creationAccessCached := f.creationAccessCacheMap[recordType]
 	if creationAccessCached == false {
 		var err error
-		creationAccess, err = f.conn.GetRecordAccess(recordType)
+		creationAccess, err = f.conn.GetRecordAccess(ctx, recordType)
 
 		if err == nil && creationAccess != nil {
 			f.creationAccessCacheMap[recordType] = creationAccess
@@ -133,16 +179,16 @@ func (f recordFetcher) getCreationAccess(recordType string) skydb.RecordACL {
 	return creationAccess
 }
 
-func (f recordFetcher) fetchOrCreateRecord(recordID skydb.RecordID, userInfo *skydb.UserInfo) (record *skydb.Record, err skyerr.Error) {
+func (f recordFetcher) fetchOrCreateRecord(ctx context.Context, recordID skydb.RecordID, userInfo *skydb.UserInfo) (record *skydb.Record, err skyerr.Error) {
 	dbRecord := skydb.Record{}
-	if dbErr := f.db.Get(recordID, &dbRecord); dbErr != nil {
+	if dbErr := f.db.Get(ctx, recordID, &dbRecord); dbErr != nil {
 		if dbErr == skydb.ErrRecordNotFound {
 			// new record
 			if f.withMasterKey {
 				return
 			}
 
-			creationAccess := f.getCreationAccess(recordID.Type)
+			creationAccess := f.getCreationAccess(ctx, recordID.Type)
 			if !creationAccess.Accessible(userInfo, skydb.CreateLevel) {
 				err = skyerr.NewError(
 					skyerr.PermissionDenied,
@@ -178,7 +224,7 @@ func removeRecordFieldTypeHints(r *skydb.Record) {
 }
 
 // recordSaveHandler iterate the record to perform the following:
-// 1. Query the db for original record
+// 1. Query the db for original record, or validate the ID of new record
 // 2. Execute before save hooks with original record and new record
 // 3. Clean up some transport only data (sequence for example) away from record
 // 4. Populate meta data and save the record (like updated_at/by)
@@ -187,14 +233,27 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 	db := req.Db
 	records := req.RecordsToSave
 
+	// userID is empty if the records are saved with master key without
+	// a user
+	userID := ""
+	if req.UserInfo != nil {
+		userID = req.UserInfo.ID
+	}
+
 	fetcher := newRecordFetcher(db, req.Conn, req.WithMasterKey)
 
 	// fetch records
 	originalRecordMap := map[skydb.RecordID]*skydb.Record{}
 	records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
-		dbRecord, err := fetcher.fetchOrCreateRecord(record.ID, req.UserInfo)
+		dbRecord, err := fetcher.fetchOrCreateRecord(req.Context, record.ID, req.UserInfo)
+		if err != nil {
+			return err
+		}
 
-		if dbRecord == nil || err != nil {
+		if dbRecord == nil {
+			if !req.WithMasterKey && !req.GeneratedRecordIDs[record.ID] {
+				err = req.RecordIDPolicy.Validate(record.ID)
+			}
 			return err
 		}
 
@@ -209,6 +268,26 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 		return
 	})
 
+	// enforce private database quota, new records are those not fetched
+	if !req.WithMasterKey && req.Quota.Applies(db) {
+		newRecordCount := 0
+		for _, record := range records {
+			if _, ok := originalRecordMap[record.ID]; !ok {
+				newRecordCount++
+			}
+		}
+		if err := req.Quota.CheckSave(req.Context, db, newRecordCount); err != nil {
+			return err
+		}
+	}
+
+	// throttle writes of each user per record type
+	if !req.WithMasterKey && req.Throttle.Enabled() {
+		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) skyerr.Error {
+			return req.Throttle.Allow(req.UserInfo.ID, record.ID.Type)
+		})
+	}
+
 	// execute before save hooks
 	if req.HookRegistry != nil {
 		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
@@ -217,7 +296,7 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 			// Defaults for record attributes should be provided
 			// before executing hooks
 			if !ok {
-				record.OwnerID = req.UserInfo.ID
+				record.OwnerID = userID
 			}
 
 			err = req.HookRegistry.ExecuteHooks(req.Context, hook.BeforeSave, record, originalRecord)
@@ -226,7 +305,7 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 	}
 
 	// derive and extend record schema
-	schemaExtended, err := extendRecordSchema(db, records)
+	schemaExtended, err := extendRecordSchema(req.Context, db, records)
 	if err != nil {
 		log.WithField("err", err).Errorln("failed to migrate record schema")
 		if myerr, ok := err.(skyerr.Error); ok {
@@ -249,17 +328,17 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 		if !ok {
 			originalRecord = &skydb.Record{}
 
-			record.OwnerID = req.UserInfo.ID
+			record.OwnerID = userID
 			record.CreatedAt = now
-			record.CreatorID = req.UserInfo.ID
+			record.CreatorID = userID
 		}
 
 		record.UpdatedAt = now
-		record.UpdaterID = req.UserInfo.ID
+		record.UpdaterID = userID
 
 		deriveDeltaRecord(&deltaRecord, originalRecord, record)
 
-		if dbErr := db.Save(&deltaRecord); dbErr != nil {
+		if dbErr := db.Save(req.Context, &deltaRecord); dbErr != nil {
 			err = skyerr.MakeError(dbErr)
 		}
 		injectSigner(&deltaRecord, req.AssetStore)
@@ -272,18 +351,32 @@ func recordSaveHandler(req *recordModifyRequest, resp *recordModifyResponse) sky
 		return skyerr.NewError(skyerr.UnexpectedError, "atomic operation failed")
 	}
 
+	activities := newRecordActivities(records, req.UserInfo, func(record *skydb.Record) skydb.RecordOperation {
+		if _, ok := originalRecordMap[record.ID]; ok {
+			return skydb.RecordUpdateOperation
+		}
+		return skydb.RecordCreateOperation
+	})
+	observeRecordActivities(activities)
+	req.RecordStats.Log(req.Context, req.Conn, activities)
+
 	// execute after save hooks
 	if req.HookRegistry != nil {
 		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
 			originalRecord, _ := originalRecordMap[record.ID]
 			err = req.HookRegistry.ExecuteHooks(req.Context, hook.AfterSave, record, originalRecord)
 			if err != nil {
-				log.Errorf("Error occurred while executing hooks: %s", err)
+				logging.WithContext(req.Context, log).Errorf("Error occurred while executing hooks: %s", err)
 			}
 			return
 		})
 	}
 
+	// roll back the saved records if any after save hook failed
+	if req.Atomic && len(resp.ErrMap) > 0 {
+		return skyerr.NewError(skyerr.UnexpectedError, "atomic operation failed")
+	}
+
 	resp.SavedRecords = records
 	resp.SchemaUpdated = schemaExtended
 
@@ -361,7 +454,7 @@ func deriveDeltaRecord(dst, base, delta *skydb.Record) {
 	}
 }
 
-func extendRecordSchema(db skydb.Database, records []*skydb.Record) (bool, error) {
+func extendRecordSchema(ctx context.Context, db skydb.Database, records []*skydb.Record) (bool, error) {
 	recordSchemaMergerMap := map[string]schemaMerger{}
 	for _, record := range records {
 		recordType := record.ID.Type
@@ -384,8 +477,9 @@ func extendRecordSchema(db skydb.Database, records []*skydb.Record) (bool, error
 		if err != nil {
 			return false, err
 		}
+		inheritReferenceActions(ctx, db, recordType, schema)
 
-		schemaExtended, err := db.Extend(recordType, schema)
+		schemaExtended, err := db.Extend(ctx, recordType, schema)
 		if err != nil {
 			return false, err
 		}
@@ -413,7 +507,7 @@ func recordDeleteHandler(req *recordModifyRequest, resp *recordModifyResponse) s
 		}
 
 		var record skydb.Record
-		if dbErr := db.Get(recordID, &record); dbErr != nil {
+		if dbErr := db.Get(req.Context, recordID, &record); dbErr != nil {
 			if dbErr == skydb.ErrRecordNotFound {
 				resp.ErrMap[recordID] = skyerr.NewError(skyerr.ResourceNotFound, "record not found")
 			} else {
@@ -431,6 +525,13 @@ func recordDeleteHandler(req *recordModifyRequest, resp *recordModifyResponse) s
 		}
 	}
 
+	if req.DryRun {
+		for _, record := range records {
+			resp.DeletedRecordIDs = append(resp.DeletedRecordIDs, record.ID)
+		}
+		return nil
+	}
+
 	if req.HookRegistry != nil {
 		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
 			err = req.HookRegistry.ExecuteHooks(req.Context, hook.BeforeDelete, record, nil)
@@ -438,34 +539,243 @@ func recordDeleteHandler(req *recordModifyRequest, resp *recordModifyResponse) s
 		})
 	}
 
-	records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
-
-		if dbErr := db.Delete(record.ID); dbErr != nil {
-			return skyerr.MakeError(dbErr)
+	if len(records) > 0 && req.recordSchemas == nil {
+		schemas, err := db.GetRecordSchemas(req.Context)
+		if err != nil {
+			return skyerr.MakeError(err)
 		}
-		return nil
+		req.recordSchemas = schemas
+	}
+
+	if req.deletingRecordIDs == nil {
+		req.deletingRecordIDs = map[skydb.RecordID]bool{}
+	}
+	for _, record := range records {
+		req.deletingRecordIDs[record.ID] = true
+	}
+
+	records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
+		return deleteRecordInTransaction(req, record)
 	})
 
 	if req.Atomic && len(resp.ErrMap) > 0 {
 		return skyerr.NewError(skyerr.UnexpectedError, "atomic operation failed")
 	}
 
+	activities := newRecordActivities(records, req.UserInfo, func(*skydb.Record) skydb.RecordOperation {
+		return skydb.RecordDeleteOperation
+	})
+	observeRecordActivities(activities)
+	req.RecordStats.Log(req.Context, req.Conn, activities)
+
 	if req.HookRegistry != nil {
 		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) (err skyerr.Error) {
 			err = req.HookRegistry.ExecuteHooks(req.Context, hook.AfterDelete, record, nil)
 			if err != nil {
-				log.Errorf("Error occurred while executing hooks: %s", err)
+				logging.WithContext(req.Context, log).Errorf("Error occurred while executing hooks: %s", err)
 			}
 			return
 		})
 	}
 
+	// roll back the deleted records if any after delete hook failed
+	if req.Atomic && len(resp.ErrMap) > 0 {
+		return skyerr.NewError(skyerr.UnexpectedError, "atomic operation failed")
+	}
+
 	for _, record := range records {
 		resp.DeletedRecordIDs = append(resp.DeletedRecordIDs, record.ID)
 	}
 	return nil
 }
 
+// deleteRecordInTransaction applies the reference actions of record and
+// deletes it in a transaction, so that the referencing records are not
+// modified unless record is deleted. The request's transaction is used if
+// it is executed in one already.
+func deleteRecordInTransaction(req *recordModifyRequest, record *skydb.Record) skyerr.Error {
+	txDB, ok := req.Db.(skydb.TxDatabase)
+	if !ok || req.inTransaction {
+		return deleteRecord(req, record)
+	}
+
+	// asynchronous hooks of the referencing records are queued only
+	// after the transaction is committed
+	txReq := *req
+	txReq.inTransaction = true
+	var pending *hook.Pending
+	txReq.Context, pending = hook.WithPending(req.Context)
+
+	var skyErr skyerr.Error
+	txErr := withTransaction(txReq.Context, txDB, func() error {
+		skyErr = deleteRecord(&txReq, record)
+		if skyErr != nil {
+			return skyErr
+		}
+		return nil
+	})
+	if skyErr != nil {
+		return skyErr
+	} else if txErr != nil {
+		return skyerr.MakeError(txErr)
+	}
+
+	pending.Run()
+	return nil
+}
+
+func deleteRecord(req *recordModifyRequest, record *skydb.Record) skyerr.Error {
+	if err := applyReferenceActions(req, record); err != nil {
+		return err
+	}
+
+	if dbErr := req.Db.Delete(req.Context, record.ID); dbErr != nil {
+		return skyerr.MakeError(dbErr)
+	}
+	return nil
+}
+
+// applyReferenceActions deletes the records referencing record with the
+// cascade action and nullifies the references with the nullify action,
+// before record is deleted. They are deleted and saved as the user of
+// req, the same way as record:delete and record:save, so that their
+// access control and hooks apply. Nothing is modified if the user cannot
+// write any of them.
+func applyReferenceActions(req *recordModifyRequest, record *skydb.Record) skyerr.Error {
+	db := req.Db
+	cascadeIDs := []skydb.RecordID{}
+	nullifiedRecords := map[skydb.RecordID]*skydb.Record{}
+	for recordType, schema := range req.recordSchemas {
+		for fieldName, fieldType := range schema {
+			if fieldType.Type != skydb.TypeReference ||
+				fieldType.ReferenceType != record.ID.Type ||
+				fieldType.OnDelete == skydb.ReferenceRestrict {
+				continue
+			}
+
+			referencingRecords, err := queryReferencingRecords(req.Context, db, recordType, fieldName, record.ID)
+			if err != nil {
+				return skyerr.MakeError(err)
+			}
+
+			for _, referencing := range referencingRecords {
+				if req.deletingRecordIDs[referencing.ID] {
+					continue
+				}
+
+				if !req.WithMasterKey && !referencing.Accessible(req.UserInfo, skydb.WriteLevel) {
+					return skyerr.NewErrorWithInfo(
+						skyerr.PermissionDenied,
+						"no permission to modify records referencing the record",
+						map[string]interface{}{"referencing_id": referencing.ID.String()},
+					)
+				}
+
+				switch fieldType.OnDelete {
+				case skydb.ReferenceCascade:
+					cascadeIDs = append(cascadeIDs, referencing.ID)
+				case skydb.ReferenceNullify:
+					nullified, ok := nullifiedRecords[referencing.ID]
+					if !ok {
+						nullified = &skydb.Record{
+							ID:   referencing.ID,
+							Data: skydb.Data{},
+						}
+						nullifiedRecords[referencing.ID] = nullified
+					}
+					nullified.Data[fieldName] = nil
+				}
+			}
+		}
+	}
+
+	if len(nullifiedRecords) > 0 {
+		saveReq := *req
+		saveReq.RecordsToSave = make([]*skydb.Record, 0, len(nullifiedRecords))
+		for _, nullified := range nullifiedRecords {
+			saveReq.RecordsToSave = append(saveReq.RecordsToSave, nullified)
+		}
+		if err := applyReferenceActionRequest(&saveReq, recordSaveHandler); err != nil {
+			return err
+		}
+	}
+
+	if len(cascadeIDs) > 0 {
+		deleteReq := *req
+		deleteReq.RecordIDsToDelete = cascadeIDs
+		if err := applyReferenceActionRequest(&deleteReq, recordDeleteHandler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyReferenceActionRequest executes the save or delete of referencing
+// records in req, returning the error of any record that fails.
+func applyReferenceActionRequest(req *recordModifyRequest, mFunc recordModifyFunc) skyerr.Error {
+	resp := recordModifyResponse{
+		ErrMap: map[skydb.RecordID]skyerr.Error{},
+	}
+	if err := mFunc(req, &resp); err != nil {
+		return err
+	}
+	for _, err := range resp.ErrMap {
+		return err
+	}
+	return nil
+}
+
+func queryReferencingRecords(ctx context.Context, db skydb.Database, recordType string, fieldName string, referentID skydb.RecordID) ([]skydb.Record, error) {
+	query := skydb.Query{
+		Type: recordType,
+		Predicate: skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: fieldName},
+				skydb.Expression{Type: skydb.Literal, Value: skydb.NewReference(referentID.Type, referentID.Key)},
+			},
+		},
+		BypassAccessControl: true,
+	}
+
+	results, err := db.Query(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	records := []skydb.Record{}
+	for results.Scan() {
+		records = append(records, results.Record())
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// newRecordActivities returns the activities of records modified by
+// userInfo, which is nil if modified with master key without a user.
+func newRecordActivities(records []*skydb.Record, userInfo *skydb.UserInfo, operationFunc func(*skydb.Record) skydb.RecordOperation) []skydb.RecordActivity {
+	userID := ""
+	if userInfo != nil {
+		userID = userInfo.ID
+	}
+
+	now := timeNow()
+	activities := make([]skydb.RecordActivity, len(records))
+	for i, record := range records {
+		activities[i] = skydb.RecordActivity{
+			RecordType: record.ID.Type,
+			Operation:  operationFunc(record),
+			UserID:     userID,
+			OccurredAt: now,
+		}
+	}
+	return activities
+}
+
 type schemaMerger struct {
 	finalSchema skydb.RecordSchema
 	err         error
@@ -496,6 +806,37 @@ func (m schemaMerger) Schema() (skydb.RecordSchema, error) {
 	return m.finalSchema, m.err
 }
 
+// inheritReferenceActions copies the delete actions of the existing
+// reference fields of recordType to schema, which is derived from record
+// data that does not carry the actions.
+func inheritReferenceActions(ctx context.Context, db skydb.Database, recordType string, schema skydb.RecordSchema) {
+	hasReference := false
+	for _, fieldType := range schema {
+		if fieldType.Type == skydb.TypeReference {
+			hasReference = true
+			break
+		}
+	}
+	if !hasReference {
+		return
+	}
+
+	// A record type that does not exist has no actions to inherit, and
+	// other errors are reported when the schema is extended.
+	existingSchema, err := db.GetSchema(ctx, recordType)
+	if err != nil {
+		return
+	}
+
+	for key, fieldType := range schema {
+		existing, ok := existingSchema[key]
+		if ok && fieldType.Type == skydb.TypeReference && existing.Type == skydb.TypeReference {
+			fieldType.OnDelete = existing.OnDelete
+			schema[key] = fieldType
+		}
+	}
+}
+
 func deriveRecordSchema(m skydb.Data) skydb.RecordSchema {
 	schema := skydb.RecordSchema{}
 	log.Debugf("%v", m)
@@ -561,26 +902,123 @@ func deriveRecordSchema(m skydb.Data) skydb.RecordSchema {
 	return schema
 }
 
-func eagerIDs(db skydb.Database, records []skydb.Record, query skydb.Query) map[string][]skydb.RecordID {
-	eagers := map[string][]skydb.RecordID{}
-	for _, transientExpression := range query.ComputedKeys {
-		if transientExpression.Type != skydb.KeyPath {
+// includeParent is a record onto which included records are set, together
+// with the IDs of the records it is included from.
+type includeParent struct {
+	record    *skydb.Record
+	ancestors map[skydb.RecordID]bool
+}
+
+// includeKeyPathComponents splits an include key path such as
+// author.organization into the key of each level of references.
+func includeKeyPathComponents(keyPath string) []string {
+	components := strings.Split(keyPath, ".")
+	for i, component := range components {
+		if component == "_owner" {
+			components[i] = "_owner_id"
+		}
+	}
+	return components
+}
+
+// validateIncludes checks that every include key path of the query has
+// no empty component and does not exceed maxDepth levels of references.
+func validateIncludes(query *skydb.Query, maxDepth int) skyerr.Error {
+	for _, expr := range query.ComputedKeys {
+		if expr.Type != skydb.KeyPath {
 			continue
 		}
-		keyPath := transientExpression.Value.(string)
-		eagers[keyPath] = make([]skydb.RecordID, len(records))
+
+		keyPath := expr.Value.(string)
+		components := includeKeyPathComponents(keyPath)
+		for _, component := range components {
+			if component == "" {
+				return skyerr.NewInvalidArgument(
+					fmt.Sprintf("include key path `%s` is malformed", keyPath),
+					[]string{"include"},
+				)
+			}
+		}
+		if len(components) > maxDepth {
+			return skyerr.NewInvalidArgument(
+				fmt.Sprintf("include key path `%s` exceeds the maximum depth of %d", keyPath, maxDepth),
+				[]string{"include"},
+			)
+		}
 	}
+	return nil
+}
 
-	for i, record := range records {
-		for keyPath := range eagers {
-			ref := getReferenceWithKeyPath(db, &record, keyPath)
-			if ref.IsEmpty() {
-				continue
+// includeRecords sets the records referenced at keyPath onto the
+// transient of records as transientKey. For a key path with multiple
+// components such as author.organization, each included record has the
+// record referenced at the next component set onto its transient,
+// keyed by that component.
+//
+// The referenced records of each level are fetched in one batch. A
+// record referencing one of the records it is included from is not
+// expanded again, and is included as null to break the cycle. A record
+// for which hidden returns true is included as null as well.
+func includeRecords(ctx context.Context, db skydb.Database, store asset.Store, records []skydb.Record, transientKey string, keyPath string, hidden func(*skydb.Record) bool) {
+	parents := make([]includeParent, len(records))
+	for i := range records {
+		parents[i] = includeParent{
+			record:    &records[i],
+			ancestors: map[skydb.RecordID]bool{records[i].ID: true},
+		}
+	}
+
+	key := transientKey
+	for _, component := range includeKeyPathComponents(keyPath) {
+		refs := make([]skydb.Reference, len(parents))
+		ids := []skydb.RecordID{}
+		for i, parent := range parents {
+			refs[i] = getReferenceWithKeyPath(db, parent.record, component)
+			if !refs[i].IsEmpty() {
+				ids = append(ids, refs[i].ID)
 			}
-			eagers[keyPath][i] = ref.ID
 		}
+		included := fetchIncludedRecords(ctx, db, ids)
+		for id, includedRecord := range included {
+			if hidden(&includedRecord) {
+				delete(included, id)
+			}
+		}
+
+		children := []includeParent{}
+		for i, parent := range parents {
+			var transientValue interface{}
+			if includedRecord, ok := included[refs[i].ID]; ok {
+				if parent.ancestors[includedRecord.ID] {
+					log.Debugf("Not including %s at key path %s again", includedRecord.ID, keyPath)
+				} else {
+					// Copy the record so that records included from
+					// different parents have their own transient.
+					child := includedRecord
+					child.Transient = nil
+					injectSigner(&child, store)
+					transientValue = (*skyconv.JSONRecord)(&child)
+
+					ancestors := map[skydb.RecordID]bool{child.ID: true}
+					for id := range parent.ancestors {
+						ancestors[id] = true
+					}
+					children = append(children, includeParent{
+						record:    &child,
+						ancestors: ancestors,
+					})
+				}
+			}
+
+			if parent.record.Transient == nil {
+				parent.record.Transient = map[string]interface{}{}
+			}
+			parent.record.Transient[key] = transientValue
+		}
+
+		parents = children
+		key = component
 	}
-	return eagers
 }
 
 // getReferenceWithKeyPath returns a reference for use in eager loading
@@ -610,39 +1048,37 @@ func getReferenceWithKeyPath(db skydb.Database, record *skydb.Record, keyPath st
 	}
 }
 
-func doQueryEager(db skydb.Database, eagersIDs map[string][]skydb.RecordID) map[string]map[string]*skydb.Record {
-	eagerRecords := map[string]map[string]*skydb.Record{}
+func fetchIncludedRecords(ctx context.Context, db skydb.Database, ids []skydb.RecordID) map[skydb.RecordID]skydb.Record {
+	records := map[skydb.RecordID]skydb.Record{}
+	if len(ids) == 0 {
+		return records
+	}
 
-	for keyPath, ids := range eagersIDs {
-		log.Debugf("Getting value for keypath %v", keyPath)
-		eagerScanner, err := db.GetByIDs(ids)
-		if err != nil {
-			log.Debugf("No Records found in the eager load key path: %s", keyPath)
-			eagerRecords[keyPath] = map[string]*skydb.Record{}
-			continue
-		}
-		for eagerScanner.Scan() {
-			er := eagerScanner.Record()
-			if eagerRecords[keyPath] == nil {
-				eagerRecords[keyPath] = map[string]*skydb.Record{}
-			}
-			eagerRecords[keyPath][er.ID.Key] = &er
-		}
-		eagerScanner.Close()
+	eagerScanner, err := db.GetByIDs(ctx, ids)
+	if err != nil {
+		log.Debugf("No Records found in the eager load: %v", err)
+		return records
 	}
+	defer eagerScanner.Close()
 
-	return eagerRecords
+	for eagerScanner.Scan() {
+		er := eagerScanner.Record()
+		records[er.ID] = er
+	}
+	return records
 }
 
-func getRecordCount(db skydb.Database, query *skydb.Query, results *skydb.Rows) (uint64, error) {
-	if results != nil {
+func getRecordCount(ctx context.Context, db skydb.Database, query *skydb.Query, results *skydb.Rows) (uint64, error) {
+	// The overall record count of the results excludes records before
+	// the cursor.
+	if results != nil && query.Cursor == nil {
 		recordCount := results.OverallRecordCount()
 		if recordCount != nil {
 			return *recordCount, nil
 		}
 	}
 
-	recordCount, err := db.QueryCount(query)
+	recordCount, err := db.QueryCount(ctx, query)
 	if err != nil {
 		return 0, err
 	}
@@ -650,10 +1086,10 @@ func getRecordCount(db skydb.Database, query *skydb.Query, results *skydb.Rows)
 	return recordCount, nil
 }
 
-func queryResultInfo(db skydb.Database, query *skydb.Query, results *skydb.Rows) (map[string]interface{}, error) {
+func queryResultInfo(ctx context.Context, db skydb.Database, query *skydb.Query, results *skydb.Rows) (map[string]interface{}, error) {
 	resultInfo := map[string]interface{}{}
 	if query.GetCount {
-		recordCount, err := getRecordCount(db, query, results)
+		recordCount, err := getRecordCount(ctx, db, query, results)
 		if err != nil {
 			return nil, err
 		}
@@ -662,13 +1098,146 @@ func queryResultInfo(db skydb.Database, query *skydb.Query, results *skydb.Rows)
 	return resultInfo, nil
 }
 
-func makeAssetsComplete(db skydb.Database, conn skydb.Conn, records []skydb.Record) error {
+// nextQueryCursor returns the cursor continuing the query after the
+// records, or an empty string if the records are not a full page or the
+// query cannot be continued with a cursor.
+func nextQueryCursor(query *skydb.Query, records []skydb.Record) string {
+	if query.Limit == nil || len(records) == 0 || uint64(len(records)) < *query.Limit {
+		return ""
+	}
+
+	// The values of sort key paths not selected by desired keys are
+	// not returned by the query.
+	if query.DesiredKeys != nil {
+		for _, sort := range query.Sorts {
+			if strings.HasPrefix(sort.KeyPath, "_") {
+				continue
+			}
+			if !utils.StringSliceContainAll(query.DesiredKeys, []string{sort.KeyPath}) {
+				return ""
+			}
+		}
+	}
+
+	cursor := skydb.NewQueryCursor(query, &records[len(records)-1])
+	if cursor == nil {
+		return ""
+	}
+
+	token, err := encodeQueryCursor(cursor)
+	if err != nil {
+		log.Warnf("Failed to encode query cursor: %v", err)
+		return ""
+	}
+	return token
+}
+
+func encodeQueryCursor(cursor *skydb.QueryCursor) (string, error) {
+	data, err := json.Marshal(skyconv.ToMap((*skyconv.MapQueryCursor)(cursor)))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeQueryCursor(token string) (*skydb.QueryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	cursor := skydb.QueryCursor{}
+	if err := (*skyconv.MapQueryCursor)(&cursor).FromMap(m); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// queryTiming records the duration of each step of handling a query.
+type queryTiming struct {
+	start time.Time
+	last  time.Time
+	steps map[string]time.Duration
+}
+
+func newQueryTiming() *queryTiming {
+	now := time.Now()
+	return &queryTiming{
+		start: now,
+		last:  now,
+		steps: map[string]time.Duration{},
+	}
+}
+
+// mark records the time elapsed since the last step as the duration of
+// the specified step.
+func (t *queryTiming) mark(step string) {
+	now := time.Now()
+	t.steps[step] += now.Sub(t.last)
+	t.last = now
+}
+
+// milliseconds returns the duration of each step and the total duration
+// in milliseconds.
+func (t *queryTiming) milliseconds() map[string]float64 {
+	result := map[string]float64{
+		"total": durationMilliseconds(t.last.Sub(t.start)),
+	}
+	for step, duration := range t.steps {
+		result[step] = durationMilliseconds(duration)
+	}
+	return result
+}
+
+func durationMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// explainQuery returns how the query is executed by the database
+// together with the timing of handling the query. The statement, indexes
+// and plan are only available if the database implements
+// skydb.QueryExplainer.
+func explainQuery(ctx context.Context, db skydb.Database, query *skydb.Query, timing *queryTiming) (map[string]interface{}, error) {
+	timings := timing.milliseconds()
+	explanation := map[string]interface{}{
+		"timing": timings,
+	}
+
+	explainer, ok := db.(skydb.QueryExplainer)
+	if !ok {
+		return explanation, nil
+	}
+
+	plan, err := explainer.ExplainQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	args := plan.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+	explanation["statement"] = plan.Statement
+	explanation["args"] = args
+	explanation["indexes"] = plan.Indexes
+	explanation["plan"] = plan.Plan
+	timings["planning"] = durationMilliseconds(plan.PlanningTime)
+	timings["execution"] = durationMilliseconds(plan.ExecutionTime)
+	return explanation, nil
+}
+
+func makeAssetsComplete(ctx context.Context, db skydb.Database, conn skydb.Conn, records []skydb.Record) error {
 	if len(records) == 0 {
 		return nil
 	}
 
 	recordType := records[0].ID.Type
-	typemap, _ := db.GetSchema(recordType)
+	typemap, _ := db.GetSchema(ctx, recordType)
 	assetColumns := []string{}
 	assetNames := []string{}
 
@@ -690,7 +1259,7 @@ func makeAssetsComplete(db skydb.Database, conn skydb.Conn, records []skydb.Reco
 		return nil
 	}
 
-	assets, err := conn.GetAssets(assetNames)
+	assets, err := conn.GetAssets(ctx, assetNames)
 	if err != nil {
 		return err
 	}
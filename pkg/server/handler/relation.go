@@ -15,6 +15,8 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/mitchellh/mapstructure"
 
@@ -127,7 +129,7 @@ func (h *RelationQueryHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RelationQueryHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *RelationQueryHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debug("RelationQueryHandler")
 	payload := &relationQueryPayload{}
 	skyErr := payload.Decode(rpayload.Data)
@@ -136,7 +138,7 @@ func (h *RelationQueryHandler) Handle(rpayload *router.Payload, response *router
 		return
 	}
 
-	result := rpayload.DBConn.QueryRelation(
+	result := rpayload.DBConn.QueryRelation(ctx,
 		rpayload.UserInfoID, payload.Name, payload.Direction, skydb.QueryConfig{
 			Limit:  payload.Limit,
 			Offset: payload.Offset,
@@ -150,7 +152,7 @@ func (h *RelationQueryHandler) Handle(rpayload *router.Payload, response *router
 		}{userinfo.ID, "user", userinfo})
 	}
 	response.Result = resultList
-	count, countErr := rpayload.DBConn.QueryRelationCount(
+	count, countErr := rpayload.DBConn.QueryRelationCount(ctx,
 		rpayload.UserInfoID, payload.Name, payload.Direction)
 	if countErr != nil {
 		log.WithFields(logrus.Fields{
@@ -247,7 +249,7 @@ func (h *RelationAddHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RelationAddHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *RelationAddHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debug("RelationAddHandler")
 	payload := relationChangePayload{}
 	skyErr := payload.Decode(rpayload.Data)
@@ -259,7 +261,7 @@ func (h *RelationAddHandler) Handle(rpayload *router.Payload, response *router.R
 	results := make([]interface{}, 0, len(payload.Target))
 	for s := range payload.Target {
 		target := payload.Target[s]
-		err := rpayload.DBConn.AddRelation(rpayload.UserInfoID, payload.Name, target)
+		err := rpayload.DBConn.AddRelation(ctx, rpayload.UserInfoID, payload.Name, target)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"target": target,
@@ -272,7 +274,7 @@ func (h *RelationAddHandler) Handle(rpayload *router.Payload, response *router.R
 			}{target, "error", skyerr.NewResourceFetchFailureErr("user", target)})
 		} else {
 			userinfo := skydb.UserInfo{}
-			rpayload.DBConn.GetUser(target, &userinfo)
+			rpayload.DBConn.GetUser(ctx, target, &userinfo)
 			userinfo.HashedPassword = []byte{}
 			results = append(results, struct {
 				ID   string      `json:"id"`
@@ -320,7 +322,7 @@ func (h *RelationRemoveHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RelationRemoveHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *RelationRemoveHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debug("RelationRemoveHandler")
 	payload := relationChangePayload{}
 	skyErr := payload.Decode(rpayload.Data)
@@ -332,7 +334,7 @@ func (h *RelationRemoveHandler) Handle(rpayload *router.Payload, response *route
 	results := make([]interface{}, 0, len(payload.Target))
 	for s := range payload.Target {
 		target := payload.Target[s]
-		err := rpayload.DBConn.RemoveRelation(rpayload.UserInfoID, payload.Name, target)
+		err := rpayload.DBConn.RemoveRelation(ctx, rpayload.UserInfoID, payload.Name, target)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"target": target,
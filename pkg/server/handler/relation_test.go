@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"sort"
 
 	"testing"
@@ -37,7 +38,7 @@ type testRelationConn struct {
 	skydb.Conn
 }
 
-func (conn *testRelationConn) GetUser(id string, userinfo *skydb.UserInfo) error {
+func (conn *testRelationConn) GetUser(ctx context.Context, id string, userinfo *skydb.UserInfo) error {
 	userinfo.ID = id
 	userinfo.Username = "testRelationConn"
 	return nil
@@ -49,7 +50,7 @@ func (a sortableUserInfo) Len() int           { return len(a) }
 func (a sortableUserInfo) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a sortableUserInfo) Less(i, j int) bool { return a[i].ID < a[j].ID }
 
-func (conn *testRelationConn) QueryRelation(user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
+func (conn *testRelationConn) QueryRelation(ctx context.Context, user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
 	conn.RelationName = name
 	if conn.UserInfo == nil {
 		return []skydb.UserInfo{}
@@ -66,19 +67,19 @@ func (conn *testRelationConn) QueryRelation(user string, name string, direction
 	return conn.UserInfo[config.Offset : config.Offset+config.Limit]
 }
 
-func (conn *testRelationConn) AddRelation(user string, name string, targetUser string) error {
+func (conn *testRelationConn) AddRelation(ctx context.Context, user string, name string, targetUser string) error {
 	conn.RelationName = name
 	conn.addedID = targetUser
 	return nil
 }
 
-func (conn *testRelationConn) RemoveRelation(user string, name string, targetUser string) error {
+func (conn *testRelationConn) RemoveRelation(ctx context.Context, user string, name string, targetUser string) error {
 	conn.RelationName = name
 	conn.removeID = targetUser
 	return nil
 }
 
-func (conn *testRelationConn) QueryRelationCount(user string, name string, direction string) (uint64, error) {
+func (conn *testRelationConn) QueryRelationCount(ctx context.Context, user string, name string, direction string) (uint64, error) {
 	conn.RelationName = name
 	if conn.UserInfo == nil {
 		return 0, nil
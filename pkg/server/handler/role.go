@@ -15,9 +15,12 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
@@ -80,7 +83,7 @@ func (h *RoleDefaultHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RoleDefaultHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *RoleDefaultHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debugf("RoleDefaultHandler %v", h)
 	payload := &rolePayload{}
 	skyErr := payload.Decode(rpayload.Data)
@@ -89,7 +92,7 @@ func (h *RoleDefaultHandler) Handle(rpayload *router.Payload, response *router.R
 		return
 	}
 
-	err := rpayload.DBConn.SetDefaultRoles(payload.Roles)
+	err := rpayload.DBConn.SetDefaultRoles(ctx, payload.Roles)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 	}
@@ -138,7 +141,7 @@ func (h *RoleAdminHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *RoleAdminHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *RoleAdminHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debugf("RoleAdminHandler %v", h)
 	payload := &rolePayload{}
 	skyErr := payload.Decode(rpayload.Data)
@@ -147,9 +150,190 @@ func (h *RoleAdminHandler) Handle(rpayload *router.Payload, response *router.Res
 		return
 	}
 
-	err := rpayload.DBConn.SetAdminRoles(payload.Roles)
+	err := rpayload.DBConn.SetAdminRoles(ctx, payload.Roles)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 	}
 	response.Result = payload.Roles
 }
+
+type roleAssignPayload struct {
+	Roles   []string `mapstructure:"roles"`
+	UserIDs []string `mapstructure:"user_ids"`
+}
+
+func (payload *roleAssignPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *roleAssignPayload) Validate() skyerr.Error {
+	if len(payload.Roles) == 0 {
+		return skyerr.NewInvalidArgument("unspecified roles in request", []string{"roles"})
+	}
+	if len(payload.UserIDs) == 0 {
+		return skyerr.NewInvalidArgument("empty user ids", []string{"user_ids"})
+	}
+	return nil
+}
+
+/*
+RoleAssignHandler enable system administrator or users of admin roles to
+assign roles to users. Roles not yet defined are created.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "role:assign",
+    "api_key": "MASTER_KEY",
+    "roles": ["writer", "editor"],
+    "user_ids": ["user0", "user1"]
+}
+EOF
+
+{
+    "result": [
+        {"_id": "user0", "roles": ["user", "writer", "editor"]},
+        {"_id": "user1", "roles": ["writer", "editor"]}
+    ]
+}
+*/
+type RoleAssignHandler struct {
+	AccessModel   skydb.AccessModel `inject:"AccessModel"`
+	Authenticator router.Processor  `preprocessor:"authenticator"`
+	DBConn        router.Processor  `preprocessor:"dbconn"`
+	InjectUser    router.Processor  `preprocessor:"inject_user"`
+	PluginReady   router.Processor  `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RoleAssignHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RoleAssignHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RoleAssignHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	updateUserRoles(h.AccessModel, rpayload, response, rpayload.DBConn.AssignUserRoles)
+}
+
+/*
+RoleRevokeHandler enable system administrator or users of admin roles to
+revoke roles from users. The role definitions are kept.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "role:revoke",
+    "api_key": "MASTER_KEY",
+    "roles": ["editor"],
+    "user_ids": ["user0", "user1"]
+}
+EOF
+
+{
+    "result": [
+        {"_id": "user0", "roles": ["user", "writer"]},
+        {"_id": "user1", "roles": ["writer"]}
+    ]
+}
+*/
+type RoleRevokeHandler struct {
+	AccessModel   skydb.AccessModel `inject:"AccessModel"`
+	Authenticator router.Processor  `preprocessor:"authenticator"`
+	DBConn        router.Processor  `preprocessor:"dbconn"`
+	InjectUser    router.Processor  `preprocessor:"inject_user"`
+	PluginReady   router.Processor  `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RoleRevokeHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RoleRevokeHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RoleRevokeHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	updateUserRoles(h.AccessModel, rpayload, response, rpayload.DBConn.RevokeUserRoles)
+}
+
+// updateUserRoles applies update to each user in the request after
+// checking that the requester may manage roles, and responds with the
+// resulting roles of each user.
+func updateUserRoles(
+	accessModel skydb.AccessModel,
+	rpayload *router.Payload,
+	response *router.Response,
+	update func(ctx context.Context, userID string, roles []string) error,
+) {
+	payload := &roleAssignPayload{}
+	skyErr := payload.Decode(rpayload.Data)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if accessModel != skydb.RoleBasedAccess {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Cannot manage user roles on AccessModel is not RoleBasedAccess",
+		)
+		return
+	}
+
+	if !rpayload.HasMasterKey() {
+		adminRoles, err := rpayload.DBConn.GetAdminRoles(rpayload.Context)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		if rpayload.UserInfo == nil || !rpayload.UserInfo.HasAnyRoles(adminRoles) {
+			response.Err = skyerr.NewError(skyerr.PermissionDenied, "no permission to manage user roles")
+			return
+		}
+	}
+
+	results := make([]interface{}, len(payload.UserIDs))
+	for i, userID := range payload.UserIDs {
+		userinfo := skydb.UserInfo{}
+		if err := rpayload.DBConn.GetUser(rpayload.Context, userID, &userinfo); err == skydb.ErrUserNotFound {
+			results[i] = newSerializedError(userID, skyerr.NewError(skyerr.ResourceNotFound, "user not found"))
+			continue
+		} else if err != nil {
+			results[i] = newSerializedError(userID, skyerr.MakeError(err))
+			continue
+		}
+
+		if err := update(rpayload.Context, userID, payload.Roles); err != nil {
+			results[i] = newSerializedError(userID, skyerr.MakeError(err))
+			continue
+		}
+
+		if err := rpayload.DBConn.GetUser(rpayload.Context, userID, &userinfo); err != nil {
+			results[i] = newSerializedError(userID, skyerr.MakeError(err))
+			continue
+		}
+
+		results[i] = struct {
+			ID    string   `json:"_id"`
+			Roles []string `json:"roles"`
+		}{userID, userinfo.Roles}
+	}
+	response.Result = results
+}
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
@@ -24,6 +25,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
 )
 
 func TestRolePayload(t *testing.T) {
@@ -60,12 +62,12 @@ type roleConn struct {
 	defaultRoles []string
 }
 
-func (conn *roleConn) SetAdminRoles(roles []string) error {
+func (conn *roleConn) SetAdminRoles(ctx context.Context, roles []string) error {
 	conn.adminRoles = roles
 	return nil
 }
 
-func (conn *roleConn) SetDefaultRoles(roles []string) error {
+func (conn *roleConn) SetDefaultRoles(ctx context.Context, roles []string) error {
 	conn.defaultRoles = roles
 	return nil
 }
@@ -175,3 +177,118 @@ func TestRoleAdminHandler(t *testing.T) {
 		})
 	})
 }
+
+func TestRoleAssignHandler(t *testing.T) {
+	Convey("RoleAssignHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.CreateUser(context.Background(), &skydb.UserInfo{
+			ID:       "admin0",
+			Username: "admin0",
+			Email:    "admin0@example.com",
+			Roles:    []string{"admin"},
+		})
+		conn.CreateUser(context.Background(), &skydb.UserInfo{
+			ID:       "user0",
+			Username: "user0",
+			Email:    "user0@example.com",
+			Roles:    []string{"user"},
+		})
+		conn.CreateUser(context.Background(), &skydb.UserInfo{
+			ID:       "user1",
+			Username: "user1",
+			Email:    "user1@example.com",
+		})
+
+		newRouter := func(userID string) *handlertest.SingleRouteRouter {
+			return handlertest.NewSingleRouteRouter(&RoleAssignHandler{
+				AccessModel: skydb.RoleBasedAccess,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				userinfo := conn.UserMap[userID]
+				p.UserInfo = &userinfo
+			})
+		}
+
+		Convey("assign roles to users", func() {
+			resp := newRouter("admin0").POST(`{
+    "roles": ["writer", "user"],
+    "user_ids": ["user0", "user1", "user2"]
+}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+    "result": [
+        {"_id": "user0", "roles": ["user", "writer"]},
+        {"_id": "user1", "roles": ["writer", "user"]},
+        {
+            "_id": "user2",
+            "_type": "error",
+            "code": 110,
+            "message": "user not found",
+            "name": "ResourceNotFound"
+        }
+    ]
+}`)
+			So(conn.UserMap["user1"].Roles, ShouldResemble, []string{"writer", "user"})
+		})
+
+		Convey("reject request of non-admin user", func() {
+			resp := newRouter("user0").POST(`{
+    "roles": ["admin"],
+    "user_ids": ["user0"]
+}`)
+			So(resp.Code, ShouldEqual, 403)
+			So(conn.UserMap["user0"].Roles, ShouldResemble, []string{"user"})
+		})
+
+		Convey("reject request without user ids", func() {
+			resp := newRouter("admin0").POST(`{
+    "roles": ["writer"]
+}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
+
+func TestRoleRevokeHandler(t *testing.T) {
+	Convey("RoleRevokeHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.CreateUser(context.Background(), &skydb.UserInfo{
+			ID:    "user0",
+			Roles: []string{"user", "writer"},
+		})
+
+		r := handlertest.NewSingleRouteRouter(&RoleRevokeHandler{
+			AccessModel: skydb.RoleBasedAccess,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("revoke roles from users", func() {
+			resp := r.POST(`{
+    "roles": ["writer", "editor"],
+    "user_ids": ["user0"]
+}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+    "result": [
+        {"_id": "user0", "roles": ["user"]}
+    ]
+}`)
+		})
+
+		Convey("reject request on non role-based access model", func() {
+			r := handlertest.NewSingleRouteRouter(&RoleRevokeHandler{
+				AccessModel: skydb.RelationBasedAccess,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.AccessKey = router.MasterAccessKey
+			})
+
+			resp := r.POST(`{
+    "roles": ["writer"],
+    "user_ids": ["user0"]
+}`)
+			So(resp.Code, ShouldEqual, 501)
+			So(conn.UserMap["user0"].Roles, ShouldResemble, []string{"user", "writer"})
+		})
+	})
+}
@@ -0,0 +1,402 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type recordSchedulePayload struct {
+	RecordID skydb.RecordID
+	RunAt    time.Time
+	Data     skydb.Data
+}
+
+func (payload *recordSchedulePayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := decodeScheduleRecordID(data, &payload.RecordID); err != nil {
+		return err
+	}
+
+	runAt, _ := data["run_at"].(string)
+	t, err := time.Parse(time.RFC3339Nano, runAt)
+	if err != nil {
+		return skyerr.NewInvalidArgument("run_at must be a time in RFC 3339 format", []string{"run_at"})
+	}
+	payload.RunAt = t.UTC()
+
+	rawData, _ := data["data"].(map[string]interface{})
+	mapData := skyconv.MapData{}
+	if err := mapData.FromMap(rawData); err != nil {
+		return skyerr.NewInvalidArgument("failed to parse data: "+err.Error(), []string{"data"})
+	}
+	payload.Data = skydb.Data(mapData)
+
+	return payload.Validate()
+}
+
+func (payload *recordSchedulePayload) Validate() skyerr.Error {
+	if len(payload.Data) == 0 {
+		return skyerr.NewInvalidArgument("data cannot be empty", []string{"data"})
+	}
+	for key := range payload.Data {
+		if key == "" || key[0] == '_' {
+			return skyerr.NewInvalidArgument("data cannot contain reserved field "+key, []string{"data"})
+		}
+	}
+	return nil
+}
+
+func decodeScheduleRecordID(data map[string]interface{}, recordID *skydb.RecordID) skyerr.Error {
+	rawID, _ := data["record_id"].(string)
+	if err := recordID.UnmarshalText([]byte(rawID)); err != nil {
+		return skyerr.NewInvalidArgument("record_id must be in the form of type/id", []string{"record_id"})
+	}
+	return nil
+}
+
+type scheduledMutationResponseItem struct {
+	ID        string                 `json:"id"`
+	RecordID  string                 `json:"record_id"`
+	RunAt     time.Time              `json:"run_at"`
+	Data      map[string]interface{} `json:"data"`
+	CreatedAt time.Time              `json:"created_at"`
+	CreatedBy string                 `json:"created_by,omitempty"`
+}
+
+func newScheduledMutationResponseItem(mutation skydb.ScheduledMutation) scheduledMutationResponseItem {
+	data := map[string]interface{}{}
+	skyconv.ToMapData(mutation.Data).ToMap(data)
+	return scheduledMutationResponseItem{
+		ID:        mutation.ID,
+		RecordID:  mutation.RecordID.String(),
+		RunAt:     mutation.RunAt,
+		Data:      data,
+		CreatedAt: mutation.CreatedAt,
+		CreatedBy: mutation.CreatorID,
+	}
+}
+
+// scheduledMutationStore returns the ScheduledMutationStore of the
+// connection after checking that the user can modify the record.
+func scheduledMutationStore(payload *router.Payload, recordID skydb.RecordID) (skydb.ScheduledMutationStore, skyerr.Error) {
+	store, ok := payload.DBConn.(skydb.ScheduledMutationStore)
+	if !ok {
+		return nil, skyerr.NewError(skyerr.NotSupported, "scheduled mutations are not supported by the database")
+	}
+
+	if payload.Database.IsReadOnly() {
+		return nil, skyerr.NewError(skyerr.NotSupported, "modifying the selected database is not supported")
+	}
+
+	var record skydb.Record
+	if err := payload.Database.Get(payload.Context, recordID, &record); err == skydb.ErrRecordNotFound {
+		return nil, skyerr.NewError(skyerr.ResourceNotFound, "record not found")
+	} else if err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+
+	if !payload.HasMasterKey() && !record.Accessible(payload.UserInfo, skydb.WriteLevel) {
+		return nil, skyerr.NewError(skyerr.PermissionDenied, "no permission to modify")
+	}
+
+	return store, nil
+}
+
+func scheduledMutationDatabaseID(db skydb.Database) string {
+	if db.DatabaseType() == skydb.PrivateDatabase {
+		return db.ID()
+	}
+	return ""
+}
+
+/*
+RecordScheduleHandler schedules fields of an existing record to be set at
+a future time, e.g. publishing an article. The change is saved when it is
+due as if the record is saved with record:save, so that beforeSave and
+afterSave hooks are executed on the transition.
+
+Only the specified fields are set when the mutation is run. A scheduled
+mutation can be removed with record:schedule:cancel before it is run.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:schedule",
+    "access_token": "ACCESS_TOKEN",
+    "database_id": "_public",
+    "record_id": "article/1",
+    "run_at": "2017-03-01T10:00:00Z",
+    "data": {
+        "status": "published"
+    }
+}
+EOF
+
+{
+    "result": {
+        "id": "5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11",
+        "record_id": "article/1",
+        "run_at": "2017-03-01T10:00:00Z",
+        "data": {
+            "status": "published"
+        },
+        "created_at": "2017-02-20T08:00:00Z",
+        "created_by": "USER_ID"
+    }
+}
+*/
+type RecordScheduleHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	InjectDB      router.Processor `preprocessor:"inject_db"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordScheduleHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordScheduleHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordScheduleHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "record_id", Type: router.StringField, Required: true},
+		{Name: "run_at", Type: router.StringField, Required: true},
+		{Name: "data", Type: router.MapField, Required: true},
+	}
+}
+
+func (h *RecordScheduleHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &recordSchedulePayload{}
+	if err := p.Decode(payload.Data); err != nil {
+		response.Err = err
+		return
+	}
+
+	store, err := scheduledMutationStore(payload, p.RecordID)
+	if err != nil {
+		response.Err = err
+		return
+	}
+
+	// fields are created now, so that the mutation does not fail
+	// when it is run
+	if _, err := extendRecordSchema(ctx, payload.Database, []*skydb.Record{
+		{ID: p.RecordID, Data: p.Data},
+	}); err != nil {
+		log.WithField("err", err).Errorln("failed to migrate record schema")
+		if skyErr, ok := err.(skyerr.Error); ok {
+			response.Err = skyErr
+		} else {
+			response.Err = skyerr.NewError(skyerr.IncompatibleSchema, "failed to migrate record schema")
+		}
+		return
+	}
+
+	mutation := skydb.ScheduledMutation{
+		ID:         uuidNew(),
+		RecordID:   p.RecordID,
+		DatabaseID: scheduledMutationDatabaseID(payload.Database),
+		Data:       p.Data,
+		RunAt:      p.RunAt,
+		CreatedAt:  timeNow(),
+	}
+	if payload.UserInfo != nil {
+		mutation.CreatorID = payload.UserInfo.ID
+	}
+
+	if err := store.SaveScheduledMutation(ctx, &mutation); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	response.Result = newScheduledMutationResponseItem(mutation)
+}
+
+/*
+RecordScheduleQueryHandler returns the pending scheduled mutations of a
+record, ordered by the time they are run.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:schedule:query",
+    "access_token": "ACCESS_TOKEN",
+    "record_id": "article/1"
+}
+EOF
+*/
+type RecordScheduleQueryHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	InjectDB      router.Processor `preprocessor:"inject_db"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordScheduleQueryHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordScheduleQueryHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordScheduleQueryHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "record_id", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *RecordScheduleQueryHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	var recordID skydb.RecordID
+	if err := decodeScheduleRecordID(payload.Data, &recordID); err != nil {
+		response.Err = err
+		return
+	}
+
+	store, err := scheduledMutationStore(payload, recordID)
+	if err != nil {
+		response.Err = err
+		return
+	}
+
+	mutations, dbErr := store.GetScheduledMutations(ctx, recordID)
+	if dbErr != nil {
+		response.Err = skyerr.MakeError(dbErr)
+		return
+	}
+
+	databaseID := scheduledMutationDatabaseID(payload.Database)
+	items := []scheduledMutationResponseItem{}
+	for _, mutation := range mutations {
+		if mutation.DatabaseID == databaseID {
+			items = append(items, newScheduledMutationResponseItem(mutation))
+		}
+	}
+	response.Result = items
+}
+
+/*
+RecordScheduleCancelHandler removes a pending scheduled mutation of a
+record.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:schedule:cancel",
+    "access_token": "ACCESS_TOKEN",
+    "record_id": "article/1",
+    "id": "5B4E7E4A-6A6C-4B4B-9A32-3B2D2F3C8E11"
+}
+EOF
+*/
+type RecordScheduleCancelHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	InjectDB      router.Processor `preprocessor:"inject_db"`
+	RequireUser   router.Processor `preprocessor:"require_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordScheduleCancelHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordScheduleCancelHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordScheduleCancelHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "record_id", Type: router.StringField, Required: true},
+		{Name: "id", Type: router.StringField, Required: true},
+	}
+}
+
+func (h *RecordScheduleCancelHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	var recordID skydb.RecordID
+	if err := decodeScheduleRecordID(payload.Data, &recordID); err != nil {
+		response.Err = err
+		return
+	}
+	id, _ := payload.Data["id"].(string)
+
+	store, err := scheduledMutationStore(payload, recordID)
+	if err != nil {
+		response.Err = err
+		return
+	}
+
+	// the mutation is looked up from those of the record, so that
+	// permission on the record applies to the mutation
+	mutations, dbErr := store.GetScheduledMutations(ctx, recordID)
+	if dbErr != nil {
+		response.Err = skyerr.MakeError(dbErr)
+		return
+	}
+
+	databaseID := scheduledMutationDatabaseID(payload.Database)
+	for _, mutation := range mutations {
+		if mutation.ID != id || mutation.DatabaseID != databaseID {
+			continue
+		}
+
+		if dbErr := store.DeleteScheduledMutation(ctx, id); dbErr != nil && dbErr != skydb.ErrScheduledMutationNotFound {
+			response.Err = skyerr.MakeError(dbErr)
+			return
+		}
+		response.Result = newScheduledMutationResponseItem(mutation)
+		return
+	}
+
+	response.Err = skyerr.NewError(skyerr.ResourceNotFound, "scheduled mutation not found")
+}
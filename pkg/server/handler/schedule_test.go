@@ -0,0 +1,203 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// scheduleConn is a ScheduledMutationStore keeping mutations in memory.
+type scheduleConn struct {
+	mutations []skydb.ScheduledMutation
+	*skydbtest.MapConn
+}
+
+func (conn *scheduleConn) SaveScheduledMutation(mutation *skydb.ScheduledMutation) error {
+	conn.mutations = append(conn.mutations, *mutation)
+	return nil
+}
+
+func (conn *scheduleConn) GetScheduledMutations(recordID skydb.RecordID) ([]skydb.ScheduledMutation, error) {
+	mutations := []skydb.ScheduledMutation{}
+	for _, mutation := range conn.mutations {
+		if mutation.RecordID == recordID {
+			mutations = append(mutations, mutation)
+		}
+	}
+	return mutations, nil
+}
+
+func (conn *scheduleConn) GetDueScheduledMutations(before time.Time, limit uint64) ([]skydb.ScheduledMutation, error) {
+	panic("not implemented")
+}
+
+func (conn *scheduleConn) DeleteScheduledMutation(id string) error {
+	for i, mutation := range conn.mutations {
+		if mutation.ID == id {
+			conn.mutations = append(conn.mutations[:i], conn.mutations[i+1:]...)
+			return nil
+		}
+	}
+	return skydb.ErrScheduledMutationNotFound
+}
+
+func TestRecordScheduleHandlers(t *testing.T) {
+	Convey("RecordScheduleHandlers", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC) }
+		uuidNew = func() string { return "mutation-1" }
+		defer func() {
+			timeNow = timeNowUTC
+			uuidNew = uuid.New
+		}()
+
+		conn := &scheduleConn{MapConn: skydbtest.NewMapConn()}
+		db := skydbtest.NewMapDB()
+		db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("article", "1"),
+			OwnerID: "editor",
+			ACL: skydb.NewRecordACL([]skydb.RecordACLEntry{
+				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+			}),
+			Data: skydb.Data{"status": "draft"},
+		})
+		userID := "editor"
+		newRouter := func(handler router.Handler) *handlertest.SingleRouteRouter {
+			return handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+				p.UserInfo = &skydb.UserInfo{ID: userID}
+			})
+		}
+
+		Convey("schedules a mutation", func() {
+			resp := newRouter(&RecordScheduleHandler{}).POST(`{
+				"record_id": "article/1",
+				"run_at": "2017-03-01T10:00:00Z",
+				"data": {"status": "published"}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "mutation-1",
+					"record_id": "article/1",
+					"run_at": "2017-03-01T10:00:00Z",
+					"data": {"status": "published"},
+					"created_at": "2017-02-20T08:00:00Z",
+					"created_by": "editor"
+				}
+			}`)
+			So(conn.mutations, ShouldResemble, []skydb.ScheduledMutation{
+				{
+					ID:        "mutation-1",
+					RecordID:  skydb.NewRecordID("article", "1"),
+					Data:      skydb.Data{"status": "published"},
+					RunAt:     time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC),
+					CreatedAt: time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC),
+					CreatorID: "editor",
+				},
+			})
+			So(db.RecordSchemaMap["article"], ShouldContainKey, "status")
+		})
+
+		Convey("rejects invalid payload", func() {
+			resp := newRouter(&RecordScheduleHandler{}).POST(`{
+				"record_id": "article/1",
+				"run_at": "tomorrow",
+				"data": {"status": "published"}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+
+			resp = newRouter(&RecordScheduleHandler{}).POST(`{
+				"record_id": "article/1",
+				"run_at": "2017-03-01T10:00:00Z",
+				"data": {"_owner_id": "someone"}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+
+		Convey("rejects user without write access", func() {
+			userID = "reader"
+			resp := newRouter(&RecordScheduleHandler{}).POST(`{
+				"record_id": "article/1",
+				"run_at": "2017-03-01T10:00:00Z",
+				"data": {"status": "published"}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "no permission to modify",
+					"name": "PermissionDenied"
+				}
+			}`)
+			So(conn.mutations, ShouldBeEmpty)
+		})
+
+		Convey("rejects non-existent record", func() {
+			resp := newRouter(&RecordScheduleHandler{}).POST(`{
+				"record_id": "article/2",
+				"run_at": "2017-03-01T10:00:00Z",
+				"data": {"status": "published"}
+			}`)
+			So(resp.Code, ShouldEqual, 404)
+		})
+
+		Convey("queries and cancels mutations", func() {
+			conn.mutations = []skydb.ScheduledMutation{
+				{
+					ID:        "publish",
+					RecordID:  skydb.NewRecordID("article", "1"),
+					Data:      skydb.Data{"status": "published"},
+					RunAt:     time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC),
+					CreatedAt: time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC),
+				},
+			}
+
+			resp := newRouter(&RecordScheduleQueryHandler{}).POST(`{
+				"record_id": "article/1"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"id": "publish",
+					"record_id": "article/1",
+					"run_at": "2017-03-01T10:00:00Z",
+					"data": {"status": "published"},
+					"created_at": "2017-02-20T08:00:00Z"
+				}]
+			}`)
+
+			resp = newRouter(&RecordScheduleCancelHandler{}).POST(`{
+				"record_id": "article/1",
+				"id": "unknown"
+			}`)
+			So(resp.Code, ShouldEqual, 404)
+
+			resp = newRouter(&RecordScheduleCancelHandler{}).POST(`{
+				"record_id": "article/1",
+				"id": "publish"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.mutations, ShouldBeEmpty)
+		})
+	})
+}
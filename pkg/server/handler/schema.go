@@ -15,6 +15,10 @@
 package handler
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
@@ -105,7 +109,7 @@ func (payload *schemaRenamePayload) Validate() skyerr.Error {
 	return nil
 }
 
-func (h *SchemaRenameHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SchemaRenameHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := &schemaRenamePayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -114,12 +118,12 @@ func (h *SchemaRenameHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	db := rpayload.Database
-	if err := db.RenameSchema(payload.RecordType, payload.OldName, payload.NewName); err != nil {
+	if err := db.RenameSchema(ctx, payload.RecordType, payload.OldName, payload.NewName); err != nil {
 		response.Err = skyerr.NewError(skyerr.ResourceNotFound, err.Error())
 		return
 	}
 
-	schemas, err := db.GetRecordSchemas()
+	schemas, err := db.GetRecordSchemas(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -129,7 +133,7 @@ func (h *SchemaRenameHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	if h.EventSender != nil {
-		err := sendSchemaChangedEvent(h.EventSender, db)
+		err := sendSchemaChangedEvent(ctx, h.EventSender, db)
 		if err != nil {
 			log.WithField("err", err).Warn("Fail to send schema changed event")
 		}
@@ -147,6 +151,10 @@ curl -X POST -H "Content-Type: application/json" \
 	"item_name": "score"
 }
 EOF
+
+Specifying "dry_run": true leaves the schema unchanged and reports the
+records having a value in the column in info.dry_run, with the number of
+such records and some of their IDs.
 */
 type SchemaDeleteHandler struct {
 	EventSender   pluginEvent.Sender `inject:"PluginEventSender"`
@@ -175,6 +183,7 @@ func (h *SchemaDeleteHandler) GetPreprocessors() []router.Processor {
 type schemaDeletePayload struct {
 	RecordType string `mapstructure:"record_type"`
 	ColumnName string `mapstructure:"item_name"`
+	DryRun     bool   `mapstructure:"dry_run"`
 }
 
 func (payload *schemaDeletePayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -205,7 +214,7 @@ func (payload *schemaDeletePayload) Validate() skyerr.Error {
 	return nil
 }
 
-func (h *SchemaDeleteHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SchemaDeleteHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := &schemaDeletePayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -214,12 +223,17 @@ func (h *SchemaDeleteHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	db := rpayload.Database
-	if err := db.DeleteSchema(payload.RecordType, payload.ColumnName); err != nil {
+	if payload.DryRun {
+		h.dryRun(rpayload, payload, response)
+		return
+	}
+
+	if err := db.DeleteSchema(ctx, payload.RecordType, payload.ColumnName); err != nil {
 		response.Err = skyerr.NewError(skyerr.ResourceNotFound, err.Error())
 		return
 	}
 
-	schemas, err := db.GetRecordSchemas()
+	schemas, err := db.GetRecordSchemas(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -229,13 +243,59 @@ func (h *SchemaDeleteHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	if h.EventSender != nil {
-		err := sendSchemaChangedEvent(h.EventSender, db)
+		err := sendSchemaChangedEvent(ctx, h.EventSender, db)
 		if err != nil {
 			log.WithField("err", err).Warn("Fail to send schema changed event")
 		}
 	}
 }
 
+// dryRun reports the records in all databases having a value in the
+// column to be deleted.
+func (h *SchemaDeleteHandler) dryRun(rpayload *router.Payload, payload *schemaDeletePayload, response *router.Response) {
+	if response.Err = checkDryRun(rpayload, true); response.Err != nil {
+		return
+	}
+
+	schema, err := rpayload.Database.GetSchema(rpayload.Context, payload.RecordType)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if _, ok := schema[payload.ColumnName]; !ok {
+		response.Err = skyerr.NewError(skyerr.ResourceNotFound, fmt.Sprintf("column %s does not exist", payload.ColumnName))
+		return
+	}
+
+	result, err := queryDryRunResult(rpayload.Context, rpayload.DBConn.UnionDB(), skydb.Query{
+		Type: payload.RecordType,
+		Predicate: skydb.Predicate{
+			Operator: skydb.NotEqual,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: payload.ColumnName},
+				skydb.Expression{Type: skydb.Literal, Value: nil},
+			},
+		},
+		BypassAccessControl: true,
+	})
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	schemas, err := rpayload.Database.GetRecordSchemas(rpayload.Context)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	response.Result = &schemaResponse{
+		Schemas: encodeRecordSchemas(schemas),
+	}
+	response.Info = map[string]interface{}{
+		"dry_run": result,
+	}
+}
+
 /*
 SchemaCreateHandler handles the action of creating new columns
 curl -X POST -H "Content-Type: application/json" \
@@ -318,7 +378,7 @@ func (payload *schemaCreatePayload) Validate() skyerr.Error {
 	return nil
 }
 
-func (h *SchemaCreateHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SchemaCreateHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	log.Debugf("%+v\n", rpayload)
 
 	payload := &schemaCreatePayload{}
@@ -330,14 +390,14 @@ func (h *SchemaCreateHandler) Handle(rpayload *router.Payload, response *router.
 
 	db := rpayload.Database
 	for recordType, recordSchema := range payload.Schemas {
-		_, err := db.Extend(recordType, recordSchema)
+		_, err := db.Extend(ctx, recordType, recordSchema)
 		if err != nil {
 			response.Err = skyerr.NewError(skyerr.IncompatibleSchema, err.Error())
 			return
 		}
 	}
 
-	schemas, err := db.GetRecordSchemas()
+	schemas, err := db.GetRecordSchemas(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -347,7 +407,7 @@ func (h *SchemaCreateHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	if h.EventSender != nil {
-		err := sendSchemaChangedEvent(h.EventSender, db)
+		err := sendSchemaChangedEvent(ctx, h.EventSender, db)
 		if err != nil {
 			log.WithField("err", err).Warn("Fail to send schema changed event")
 		}
@@ -387,9 +447,9 @@ func (h *SchemaFetchHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SchemaFetchHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SchemaFetchHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	db := rpayload.Database
-	schemas, err := db.GetRecordSchemas()
+	schemas, err := db.GetRecordSchemas(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -472,7 +532,7 @@ func (payload *schemaAccessPayload) Validate() skyerr.Error {
 	return nil
 }
 
-func (h *SchemaAccessHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SchemaAccessHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := schemaAccessPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -481,7 +541,7 @@ func (h *SchemaAccessHandler) Handle(rpayload *router.Payload, response *router.
 	}
 
 	c := rpayload.Database.Conn()
-	err := c.SetRecordAccess(payload.Type, payload.ACL)
+	err := c.SetRecordAccess(ctx, payload.Type, payload.ACL)
 
 	if err != nil {
 		if skyErr, isSkyErr := err.(skyerr.Error); isSkyErr {
@@ -497,3 +557,418 @@ func (h *SchemaAccessHandler) Handle(rpayload *router.Payload, response *router.
 		CreateRoles: payload.RawCreateRoles,
 	}
 }
+
+// schemaSnapshot is the full record schema of a database, which can be
+// exported from one database and applied to another.
+type schemaSnapshot struct {
+	RecordTypes map[string]schemaSnapshotRecordType `mapstructure:"record_types" json:"record_types"`
+}
+
+type schemaSnapshotRecordType struct {
+	Fields      []schemaField `mapstructure:"fields" json:"fields"`
+	CreateRoles []string      `mapstructure:"create_roles" json:"create_roles"`
+}
+
+func exportSchemaSnapshot(ctx context.Context, db skydb.Database, conn skydb.Conn) (*schemaSnapshot, error) {
+	schemas, err := db.GetRecordSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &schemaSnapshot{
+		RecordTypes: map[string]schemaSnapshotRecordType{},
+	}
+	for recordType, fieldList := range encodeRecordSchemas(schemas) {
+		createRoles, err := recordCreateRoles(ctx, conn, recordType)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.RecordTypes[recordType] = schemaSnapshotRecordType{
+			Fields:      fieldList.Fields,
+			CreateRoles: createRoles,
+		}
+	}
+	return snapshot, nil
+}
+
+// recordCreateRoles returns the sorted roles allowed to create records
+// of recordType.
+func recordCreateRoles(ctx context.Context, conn skydb.Conn, recordType string) ([]string, error) {
+	acl, err := conn.GetRecordAccess(ctx, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	for _, ace := range acl {
+		if ace.Role != "" {
+			roles = append(roles, ace.Role)
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+/*
+SchemaExportHandler returns the full record schema, including the fields
+and the creation access of each record type, as a document that can be
+applied to another database with schema:apply.
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/schema/export <<EOF
+{
+	"master_key": "MASTER_KEY",
+	"action": "schema:export"
+}
+EOF
+
+{
+	"result": {
+		"record_types": {
+			"note": {
+				"fields": [
+					{"name": "content", "type": "string"}
+				],
+				"create_roles": ["writer"]
+			}
+		}
+	}
+}
+*/
+type SchemaExportHandler struct {
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectDB      router.Processor `preprocessor:"inject_db"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *SchemaExportHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.InjectDB,
+		h.PluginReady,
+	}
+}
+
+func (h *SchemaExportHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *SchemaExportHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	if !rpayload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "exporting schema requires master key")
+		return
+	}
+
+	snapshot, err := exportSchemaSnapshot(ctx, rpayload.Database, rpayload.DBConn)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	response.Result = snapshot
+}
+
+type schemaApplyPayload struct {
+	RecordTypes map[string]schemaSnapshotRecordType `mapstructure:"record_types"`
+	DryRun      bool                                `mapstructure:"dry_run"`
+
+	Schemas map[string]skydb.RecordSchema
+}
+
+func (payload *schemaApplyPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+
+	payload.Schemas = make(map[string]skydb.RecordSchema)
+	for recordType, snapshot := range payload.RecordTypes {
+		payload.Schemas[recordType] = make(skydb.RecordSchema)
+		for _, field := range snapshot.Fields {
+			var err error
+			payload.Schemas[recordType][field.Name], err = skydb.SimpleNameToFieldType(field.TypeName)
+			if err != nil {
+				return skyerr.NewInvalidArgument("unexpected field type", []string{field.TypeName})
+			}
+		}
+	}
+
+	return payload.Validate()
+}
+
+func (payload *schemaApplyPayload) Validate() skyerr.Error {
+	if payload.RecordTypes == nil {
+		return skyerr.NewInvalidArgument("missing required fields", []string{"record_types"})
+	}
+	for recordType, schema := range payload.Schemas {
+		if strings.HasPrefix(recordType, "_") {
+			return skyerr.NewInvalidArgument("attempts to create reserved table", []string{recordType})
+		}
+		for fieldName := range schema {
+			if strings.HasPrefix(fieldName, "_") {
+				return skyerr.NewInvalidArgument("attempts to create reserved field", []string{fieldName})
+			}
+		}
+	}
+	return nil
+}
+
+// schemaRecordTypeDiff is the difference of a record type between the
+// applied snapshot and the database.
+type schemaRecordTypeDiff struct {
+	// NewRecordType is true if the record type does not exist in the
+	// database.
+	NewRecordType bool `json:"new_record_type,omitempty"`
+
+	// AddedFields are fields in the snapshot but not in the database.
+	AddedFields []schemaField `json:"added_fields,omitempty"`
+
+	// ExtraFields are fields in the database but not in the snapshot.
+	// They are left untouched.
+	ExtraFields []schemaField `json:"extra_fields,omitempty"`
+
+	// CreateRoles is set if the creation access is to be changed.
+	CreateRoles *schemaRolesChange `json:"create_roles,omitempty"`
+
+	conflicts []string
+	schema    skydb.RecordSchema
+}
+
+type schemaRolesChange struct {
+	From []string `json:"from"`
+	To   []string `json:"to"`
+}
+
+func (d *schemaRecordTypeDiff) empty() bool {
+	return !d.NewRecordType && len(d.AddedFields) == 0 && len(d.ExtraFields) == 0 && d.CreateRoles == nil
+}
+
+type schemaApplyResponse struct {
+	DryRun bool `json:"dry_run"`
+
+	// Changes are the record types that differ from the snapshot.
+	Changes map[string]*schemaRecordTypeDiff `json:"changes"`
+
+	// ExtraRecordTypes are record types in the database but not in the
+	// snapshot. They are left untouched.
+	ExtraRecordTypes []string `json:"extra_record_types"`
+}
+
+func diffSchemaSnapshot(current *schemaSnapshot, payload *schemaApplyPayload) (*schemaApplyResponse, skyerr.Error) {
+	resp := &schemaApplyResponse{
+		DryRun:           payload.DryRun,
+		Changes:          map[string]*schemaRecordTypeDiff{},
+		ExtraRecordTypes: []string{},
+	}
+
+	conflicts := []string{}
+	for recordType, snapshot := range payload.RecordTypes {
+		diff := &schemaRecordTypeDiff{
+			schema: skydb.RecordSchema{},
+		}
+
+		currentType, ok := current.RecordTypes[recordType]
+		diff.NewRecordType = !ok
+
+		currentFields := map[string]string{}
+		for _, field := range currentType.Fields {
+			currentFields[field.Name] = field.TypeName
+		}
+		wantedFields := map[string]bool{}
+		for _, field := range snapshot.Fields {
+			wantedFields[field.Name] = true
+			typeName, ok := currentFields[field.Name]
+			if !ok {
+				diff.AddedFields = append(diff.AddedFields, field)
+				diff.schema[field.Name] = payload.Schemas[recordType][field.Name]
+			} else if typeName != field.TypeName {
+				conflicts = append(conflicts, fmt.Sprintf("%s.%s", recordType, field.Name))
+			}
+		}
+		for _, field := range currentType.Fields {
+			if !wantedFields[field.Name] {
+				diff.ExtraFields = append(diff.ExtraFields, field)
+			}
+		}
+		sort.Sort(schemaFieldList{diff.AddedFields})
+
+		// The creation access is left unchanged if create_roles is
+		// not specified.
+		currentRoles := currentType.CreateRoles
+		if currentRoles == nil {
+			currentRoles = []string{}
+		}
+		wantedRoles := append([]string{}, snapshot.CreateRoles...)
+		sort.Strings(wantedRoles)
+		if snapshot.CreateRoles != nil && !reflect.DeepEqual(currentRoles, wantedRoles) {
+			diff.CreateRoles = &schemaRolesChange{
+				From: currentRoles,
+				To:   wantedRoles,
+			}
+		}
+
+		if !diff.empty() {
+			resp.Changes[recordType] = diff
+		}
+	}
+
+	for recordType := range current.RecordTypes {
+		if _, ok := payload.RecordTypes[recordType]; !ok {
+			resp.ExtraRecordTypes = append(resp.ExtraRecordTypes, recordType)
+		}
+	}
+	sort.Strings(resp.ExtraRecordTypes)
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, skyerr.NewErrorWithInfo(
+			skyerr.IncompatibleSchema,
+			fmt.Sprintf("fields have different types: %s", strings.Join(conflicts, ", ")),
+			map[string]interface{}{
+				"arguments": conflicts,
+			},
+		)
+	}
+	return resp, nil
+}
+
+/*
+SchemaApplyHandler applies a document exported with schema:export to
+the database. Missing record types and fields are created, and the
+creation access of each record type is set to create_roles in the
+document if specified.
+Fields and record types not in the document are reported but never
+deleted. Nothing is applied if any field has a different type.
+
+With dry_run, the difference is returned without applying.
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/schema/apply <<EOF
+{
+	"master_key": "MASTER_KEY",
+	"action": "schema:apply",
+	"dry_run": true,
+	"record_types": {
+		"note": {
+			"fields": [
+				{"name": "content", "type": "string"},
+				{"name": "tags", "type": "json"}
+			],
+			"create_roles": ["writer"]
+		}
+	}
+}
+EOF
+
+{
+	"result": {
+		"dry_run": true,
+		"changes": {
+			"note": {
+				"added_fields": [
+					{"name": "tags", "type": "json"}
+				]
+			}
+		},
+		"extra_record_types": []
+	}
+}
+*/
+type SchemaApplyHandler struct {
+	EventSender   pluginEvent.Sender `inject:"PluginEventSender"`
+	AccessKey     router.Processor   `preprocessor:"accesskey"`
+	DBConn        router.Processor   `preprocessor:"dbconn"`
+	InjectDB      router.Processor   `preprocessor:"inject_db"`
+	PluginReady   router.Processor   `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *SchemaApplyHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.InjectDB,
+		h.PluginReady,
+	}
+}
+
+func (h *SchemaApplyHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *SchemaApplyHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
+	if !rpayload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "applying schema requires master key")
+		return
+	}
+
+	payload := &schemaApplyPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	db := rpayload.Database
+	conn := rpayload.DBConn
+	current, err := exportSchemaSnapshot(ctx, db, conn)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	result, skyErr := diffSchemaSnapshot(current, payload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if payload.DryRun || len(result.Changes) == 0 {
+		response.Result = result
+		return
+	}
+
+	apply := func() error {
+		return applySchemaChanges(ctx, db, conn, result.Changes)
+	}
+	if txDB, ok := db.(skydb.TxDatabase); ok {
+		err = withTransaction(ctx, txDB, apply)
+	} else {
+		err = apply()
+	}
+	if err != nil {
+		if skyErr, ok := err.(skyerr.Error); ok {
+			response.Err = skyErr
+		} else {
+			response.Err = skyerr.NewError(skyerr.IncompatibleSchema, err.Error())
+		}
+		return
+	}
+	response.Result = result
+
+	if h.EventSender != nil {
+		err := sendSchemaChangedEvent(ctx, h.EventSender, db)
+		if err != nil {
+			log.WithField("err", err).Warn("Fail to send schema changed event")
+		}
+	}
+}
+
+func applySchemaChanges(ctx context.Context, db skydb.Database, conn skydb.Conn, changes map[string]*schemaRecordTypeDiff) error {
+	for recordType, diff := range changes {
+		if diff.NewRecordType || len(diff.AddedFields) > 0 {
+			if _, err := db.Extend(ctx, recordType, diff.schema); err != nil {
+				return err
+			}
+		}
+
+		if diff.CreateRoles != nil {
+			acl := skydb.RecordACL{}
+			for _, role := range diff.CreateRoles.To {
+				acl = append(acl, skydb.NewRecordACLEntryRole(role, skydb.CreateLevel))
+			}
+			if err := conn.SetRecordAccess(ctx, recordType, acl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -220,7 +221,7 @@ func TestSchemaCreateHandler(t *testing.T) {
 		}
 
 		db := skydbtest.NewMapDB()
-		_, err := db.Extend("note", note)
+		_, err := db.Extend(context.Background(), "note", note)
 		So(err, ShouldBeNil)
 
 		router := handlertest.NewSingleRouteRouter(&SchemaCreateHandler{}, func(p *router.Payload) {
@@ -421,7 +422,7 @@ func TestSchemaRenameHandler(t *testing.T) {
 		}
 
 		db := skydbtest.NewMapDB()
-		_, err := db.Extend("note", note)
+		_, err := db.Extend(context.Background(), "note", note)
 		So(err, ShouldBeNil)
 
 		router := handlertest.NewSingleRouteRouter(&SchemaRenameHandler{}, func(p *router.Payload) {
@@ -579,7 +580,7 @@ func TestSchemaDeleteHandler(t *testing.T) {
 		}
 
 		db := skydbtest.NewMapDB()
-		_, err := db.Extend("note", note)
+		_, err := db.Extend(context.Background(), "note", note)
 		So(err, ShouldBeNil)
 
 		router := handlertest.NewSingleRouteRouter(&SchemaDeleteHandler{}, func(p *router.Payload) {
@@ -642,6 +643,71 @@ func TestSchemaDeleteHandler(t *testing.T) {
 	})
 }
 
+func TestSchemaDeleteHandlerDryRun(t *testing.T) {
+	Convey("SchemaDeleteHandler dry run", t, func() {
+		note := skydb.RecordSchema{
+			"field1": skydb.FieldType{
+				Type: skydb.TypeString,
+			},
+			"field2": skydb.FieldType{
+				Type: skydb.TypeDateTime,
+			},
+		}
+
+		db := skydbtest.NewMapDB()
+		_, err := db.Extend(context.Background(), "note", note)
+		So(err, ShouldBeNil)
+
+		Convey("reports records with values in the field", func() {
+			unionDB := &queryResultsDatabase{
+				records: []skydb.Record{
+					{ID: skydb.NewRecordID("note", "0")},
+					{ID: skydb.NewRecordID("note", "1")},
+				},
+			}
+			r := handlertest.NewSingleRouteRouter(&SchemaDeleteHandler{}, func(p *router.Payload) {
+				p.Database = db
+				p.DBConn = &unionDBConn{skydbtest.NewMapConn(), unionDB}
+				p.AccessKey = router.MasterAccessKey
+			})
+			resp := r.POST(`{
+				"record_type": "note",
+				"item_name": "field1",
+				"dry_run": true
+			}`)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"record_types": {
+						"note": {
+							"fields": [
+								{"name": "field1", "type": "string"},
+								{"name": "field2", "type": "datetime"}
+							]
+						}
+					}
+				},
+				"info": {
+					"dry_run": {
+						"count": 2,
+						"sample_ids": ["note/0", "note/1"]
+					}
+				}
+			}`)
+			So(db.RecordSchemaMap["note"], ShouldContainKey, "field1")
+		})
+	})
+}
+
+type unionDBConn struct {
+	*skydbtest.MapConn
+	unionDB skydb.Database
+}
+
+func (conn *unionDBConn) UnionDB() skydb.Database {
+	return conn.unionDB
+}
+
 func TestSchemaFetchHandler(t *testing.T) {
 	Convey("SchemaFetchHandler", t, func() {
 		note := skydb.RecordSchema{
@@ -657,9 +723,9 @@ func TestSchemaFetchHandler(t *testing.T) {
 
 		db := skydbtest.NewMapDB()
 		var err error
-		_, err = db.Extend("note", note)
+		_, err = db.Extend(context.Background(), "note", note)
 		So(err, ShouldBeNil)
-		_, err = db.Extend("user", user)
+		_, err = db.Extend(context.Background(), "user", user)
 		So(err, ShouldBeNil)
 
 		router := handlertest.NewSingleRouteRouter(&SchemaFetchHandler{}, func(p *router.Payload) {
@@ -757,7 +823,7 @@ type mockSchemaAccessDatabaseConnection struct {
 	skydb.Conn
 }
 
-func (c *mockSchemaAccessDatabaseConnection) SetRecordAccess(recordType string, acl skydb.RecordACL) error {
+func (c *mockSchemaAccessDatabaseConnection) SetRecordAccess(ctx context.Context, recordType string, acl skydb.RecordACL) error {
 	c.recordType = recordType
 	c.acl = acl
 
@@ -799,3 +865,178 @@ func TestSchemaAccessHandler(t *testing.T) {
 		So(roleNames, ShouldContain, "Writer")
 	})
 }
+
+func TestSchemaExportHandler(t *testing.T) {
+	Convey("SchemaExportHandler", t, func() {
+		db := skydbtest.NewMapDB()
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		conn := skydbtest.NewMapConn()
+		So(conn.SetRecordAccess(context.Background(), "note", skydb.RecordACL{
+			skydb.NewRecordACLEntryRole("writer", skydb.CreateLevel),
+		}), ShouldBeNil)
+
+		r := handlertest.NewSingleRouteRouter(&SchemaExportHandler{}, func(p *router.Payload) {
+			p.Database = db
+			p.DBConn = conn
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("exports schema with creation access", func() {
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"record_types": {
+						"note": {
+							"fields": [
+								{"name": "content", "type": "string"}
+							],
+							"create_roles": ["writer"]
+						}
+					}
+				}
+			}`)
+		})
+
+		Convey("requires master key", func() {
+			r := handlertest.NewSingleRouteRouter(&SchemaExportHandler{}, func(p *router.Payload) {
+				p.Database = db
+				p.DBConn = conn
+			})
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "exporting schema requires master key",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+	})
+}
+
+func TestSchemaApplyHandler(t *testing.T) {
+	Convey("SchemaApplyHandler", t, func() {
+		db := skydbtest.NewMapDB()
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+			"legacy":  skydb.FieldType{Type: skydb.TypeNumber},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend(context.Background(), "archive", skydb.RecordSchema{})
+		So(err, ShouldBeNil)
+		conn := skydbtest.NewMapConn()
+
+		r := handlertest.NewSingleRouteRouter(&SchemaApplyHandler{}, func(p *router.Payload) {
+			p.Database = db
+			p.DBConn = conn
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		snapshot := `
+			"record_types": {
+				"note": {
+					"fields": [
+						{"name": "content", "type": "string"},
+						{"name": "tags", "type": "json"}
+					],
+					"create_roles": ["writer"]
+				},
+				"category": {
+					"fields": [
+						{"name": "name", "type": "string"}
+					]
+				}
+			}`
+
+		Convey("reports difference in dry run", func() {
+			resp := r.POST(`{"dry_run": true,` + snapshot + `}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"dry_run": true,
+					"changes": {
+						"note": {
+							"added_fields": [
+								{"name": "tags", "type": "json"}
+							],
+							"extra_fields": [
+								{"name": "legacy", "type": "number"}
+							],
+							"create_roles": {
+								"from": [],
+								"to": ["writer"]
+							}
+						},
+						"category": {
+							"new_record_type": true,
+							"added_fields": [
+								{"name": "name", "type": "string"}
+							]
+						}
+					},
+					"extra_record_types": ["archive"]
+				}
+			}`)
+			So(db.RecordSchemaMap, ShouldNotContainKey, "category")
+			So(db.RecordSchemaMap["note"], ShouldNotContainKey, "tags")
+		})
+
+		Convey("applies difference", func() {
+			resp := r.POST(`{` + snapshot + `}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			So(db.RecordSchemaMap["category"], ShouldResemble, skydb.RecordSchema{
+				"name": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(db.RecordSchemaMap["note"], ShouldResemble, skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+				"legacy":  skydb.FieldType{Type: skydb.TypeNumber},
+				"tags":    skydb.FieldType{Type: skydb.TypeJSON},
+			})
+			So(db.RecordSchemaMap, ShouldContainKey, "archive")
+
+			roles, err := recordCreateRoles(context.Background(), conn, "note")
+			So(err, ShouldBeNil)
+			So(roles, ShouldResemble, []string{"writer"})
+		})
+
+		Convey("applies nothing if a field has a different type", func() {
+			resp := r.POST(`{
+				"record_types": {
+					"note": {
+						"fields": [
+							{"name": "content", "type": "number"},
+							{"name": "tags", "type": "json"}
+						]
+					}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 114,
+					"message": "fields have different types: note.content",
+					"name": "IncompatibleSchema",
+					"info": {"arguments": ["note.content"]}
+				}
+			}`)
+			So(db.RecordSchemaMap["note"], ShouldNotContainKey, "tags")
+		})
+
+		Convey("requires master key", func() {
+			r := handlertest.NewSingleRouteRouter(&SchemaApplyHandler{}, func(p *router.Payload) {
+				p.Database = db
+				p.DBConn = conn
+			})
+			resp := r.POST(`{` + snapshot + `}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "applying schema requires master key",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"sort"
 	"strings"
@@ -69,8 +70,8 @@ func encodeRecordSchemas(data map[string]skydb.RecordSchema) map[string]schemaFi
 	return schemaMap
 }
 
-func sendSchemaChangedEvent(sender pluginEvent.Sender, db skydb.Database) error {
-	schemas, err := db.GetRecordSchemas()
+func sendSchemaChangedEvent(ctx context.Context, sender pluginEvent.Sender, db skydb.Database) error {
+	schemas, err := db.GetRecordSchemas(ctx)
 	if err != nil {
 		return err
 	}
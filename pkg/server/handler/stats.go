@@ -0,0 +1,264 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+const statsDateLayout = "2006-01-02"
+
+// statsDefaultDays is the number of days of stats fetched if the date
+// range is not specified.
+const statsDefaultDays = 30
+
+type statsFetchPayload struct {
+	From        time.Time
+	To          time.Time
+	RecordTypes []string
+}
+
+func (payload *statsFetchPayload) Decode(data map[string]interface{}) skyerr.Error {
+	// stats of today are not available until rolled up tomorrow
+	today := timeNow().Truncate(24 * time.Hour)
+	payload.To = today.AddDate(0, 0, -1)
+	if to, ok := data["to"].(string); ok {
+		date, err := time.Parse(statsDateLayout, to)
+		if err != nil {
+			return skyerr.NewInvalidArgument("to must be a date in YYYY-MM-DD", []string{"to"})
+		}
+		payload.To = date
+	}
+
+	payload.From = payload.To.AddDate(0, 0, 1-statsDefaultDays)
+	if from, ok := data["from"].(string); ok {
+		date, err := time.Parse(statsDateLayout, from)
+		if err != nil {
+			return skyerr.NewInvalidArgument("from must be a date in YYYY-MM-DD", []string{"from"})
+		}
+		payload.From = date
+	}
+
+	if recordTypes, ok := data["record_types"].([]interface{}); ok {
+		for _, recordType := range recordTypes {
+			payload.RecordTypes = append(payload.RecordTypes, recordType.(string))
+		}
+	}
+
+	return payload.Validate()
+}
+
+func (payload *statsFetchPayload) Validate() skyerr.Error {
+	if payload.From.After(payload.To) {
+		return skyerr.NewInvalidArgument("from must not be later than to", []string{"from", "to"})
+	}
+	return nil
+}
+
+type statsFetchResponseItem struct {
+	Date        string `json:"date"`
+	RecordType  string `json:"record_type"`
+	Creates     uint64 `json:"creates"`
+	Updates     uint64 `json:"updates"`
+	Deletes     uint64 `json:"deletes"`
+	ActiveUsers uint64 `json:"active_users"`
+}
+
+/*
+StatsFetchHandler returns the daily counters of record creates, updates,
+deletes and active users of each record type. Counters of a day are
+available after the day has ended and the stats are rolled up.
+
+Without from and to, counters of the last 30 days are returned.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "stats:fetch",
+    "master_key": "MASTER_KEY",
+    "from": "2017-03-01",
+    "to": "2017-03-31",
+    "record_types": ["note"]
+}
+EOF
+
+{
+    "result": [
+        {
+            "date": "2017-03-01",
+            "record_type": "note",
+            "creates": 12,
+            "updates": 30,
+            "deletes": 1,
+            "active_users": 5
+        }
+    ]
+}
+*/
+type StatsFetchHandler struct {
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *StatsFetchHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *StatsFetchHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *StatsFetchHandler) PayloadSchema() router.PayloadSchema {
+	return router.PayloadSchema{
+		{Name: "from", Type: router.StringField},
+		{Name: "to", Type: router.StringField},
+		{Name: "record_types", Type: router.ArrayField, Elem: router.StringField},
+	}
+}
+
+func (h *StatsFetchHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "fetching stats requires master key")
+		return
+	}
+
+	p := &statsFetchPayload{}
+	if err := p.Decode(payload.Data); err != nil {
+		response.Err = err
+		return
+	}
+
+	store, ok := payload.DBConn.(skydb.RecordStatsStore)
+	if !ok {
+		response.Err = skyerr.NewError(skyerr.NotSupported, "stats are not supported by the database")
+		return
+	}
+
+	results, err := store.GetRecordStats(ctx, p.From, p.To, p.RecordTypes)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	items := make([]statsFetchResponseItem, len(results))
+	for i, stats := range results {
+		items[i] = statsFetchResponseItem{
+			Date:        stats.Date.Format(statsDateLayout),
+			RecordType:  stats.RecordType,
+			Creates:     stats.Creates,
+			Updates:     stats.Updates,
+			Deletes:     stats.Deletes,
+			ActiveUsers: stats.ActiveUsers,
+		}
+	}
+	response.Result = items
+}
+
+type statsStorageResponseItem struct {
+	RecordType string `json:"record_type"`
+	RowCount   uint64 `json:"row_count"`
+	TableSize  uint64 `json:"table_size"`
+	IndexSize  uint64 `json:"index_size"`
+	AssetCount uint64 `json:"asset_count"`
+	AssetSize  uint64 `json:"asset_size"`
+}
+
+/*
+StatsStorageHandler returns the storage consumed by each record type: the
+number of rows, the sizes of the table and its indexes, and the number
+and total size of assets referenced by the records. Sizes are in bytes.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "stats:storage",
+    "master_key": "MASTER_KEY"
+}
+EOF
+
+{
+    "result": [
+        {
+            "record_type": "note",
+            "row_count": 1200,
+            "table_size": 1204224,
+            "index_size": 229376,
+            "asset_count": 35,
+            "asset_size": 5242880
+        }
+    ]
+}
+*/
+type StatsStorageHandler struct {
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *StatsStorageHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+func (h *StatsStorageHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *StatsStorageHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	if !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "fetching stats requires master key")
+		return
+	}
+
+	store, ok := payload.DBConn.(skydb.StorageStatsStore)
+	if !ok {
+		response.Err = skyerr.NewError(skyerr.NotSupported, "storage stats are not supported by the database")
+		return
+	}
+
+	results, err := store.GetRecordStorage(ctx)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	items := make([]statsStorageResponseItem, len(results))
+	for i, storage := range results {
+		items[i] = statsStorageResponseItem{
+			RecordType: storage.RecordType,
+			RowCount:   storage.RowCount,
+			TableSize:  storage.TableSize,
+			IndexSize:  storage.IndexSize,
+			AssetCount: storage.AssetCount,
+			AssetSize:  storage.AssetSize,
+		}
+	}
+	response.Result = items
+}
@@ -0,0 +1,225 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// statsConn is a RecordStatsStore returning fixed stats and remembering
+// the arguments it is queried with.
+type statsConn struct {
+	stats       []skydb.RecordStats
+	from        time.Time
+	to          time.Time
+	recordTypes []string
+	*skydbtest.MapConn
+}
+
+func (conn *statsConn) LogRecordActivities(activities []skydb.RecordActivity) error {
+	return nil
+}
+
+func (conn *statsConn) RollupRecordStats(before time.Time) error {
+	return nil
+}
+
+func (conn *statsConn) GetRecordStats(from, to time.Time, recordTypes []string) ([]skydb.RecordStats, error) {
+	conn.from = from
+	conn.to = to
+	conn.recordTypes = recordTypes
+	return conn.stats, nil
+}
+
+func TestStatsFetchHandler(t *testing.T) {
+	Convey("StatsFetchHandler", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 3, 15, 10, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = timeNowUTC
+		}()
+
+		conn := &statsConn{
+			stats: []skydb.RecordStats{
+				{
+					Date:        time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+					RecordType:  "note",
+					Creates:     12,
+					Updates:     30,
+					Deletes:     1,
+					ActiveUsers: 5,
+				},
+			},
+			MapConn: skydbtest.NewMapConn(),
+		}
+		r := handlertest.NewSingleRouteRouter(&StatsFetchHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("fetches stats in range", func() {
+			resp := r.POST(`{
+				"from": "2017-03-01",
+				"to": "2017-03-31",
+				"record_types": ["note"]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"date": "2017-03-01",
+					"record_type": "note",
+					"creates": 12,
+					"updates": 30,
+					"deletes": 1,
+					"active_users": 5
+				}]
+			}`)
+			So(conn.from.Format(statsDateLayout), ShouldEqual, "2017-03-01")
+			So(conn.to.Format(statsDateLayout), ShouldEqual, "2017-03-31")
+			So(conn.recordTypes, ShouldResemble, []string{"note"})
+		})
+
+		Convey("fetches last 30 days by default", func() {
+			r.POST(`{}`)
+			So(conn.from.Format(statsDateLayout), ShouldEqual, "2017-02-13")
+			So(conn.to.Format(statsDateLayout), ShouldEqual, "2017-03-14")
+			So(conn.recordTypes, ShouldBeNil)
+		})
+
+		Convey("rejects from later than to", func() {
+			resp := r.POST(`{
+				"from": "2017-03-31",
+				"to": "2017-03-01"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"message": "from must not be later than to",
+					"name": "InvalidArgument",
+					"info": {"arguments": ["from", "to"]}
+				}
+			}`)
+		})
+
+		Convey("rejects malformed date", func() {
+			resp := r.POST(`{
+				"from": "March 1"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"message": "from must be a date in YYYY-MM-DD",
+					"name": "InvalidArgument",
+					"info": {"arguments": ["from"]}
+				}
+			}`)
+		})
+
+		Convey("requires master key", func() {
+			r := handlertest.NewSingleRouteRouter(&StatsFetchHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "fetching stats requires master key",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+	})
+}
+
+// storageConn is a StorageStatsStore returning fixed storage stats.
+type storageConn struct {
+	storages []skydb.RecordStorage
+	*skydbtest.MapConn
+}
+
+func (conn *storageConn) GetRecordStorage() ([]skydb.RecordStorage, error) {
+	return conn.storages, nil
+}
+
+func TestStatsStorageHandler(t *testing.T) {
+	Convey("StatsStorageHandler", t, func() {
+		conn := &storageConn{
+			storages: []skydb.RecordStorage{
+				{
+					RecordType: "note",
+					RowCount:   1200,
+					TableSize:  1204224,
+					IndexSize:  229376,
+					AssetCount: 35,
+					AssetSize:  5242880,
+				},
+			},
+			MapConn: skydbtest.NewMapConn(),
+		}
+
+		Convey("reports storage of record types", func() {
+			r := handlertest.NewSingleRouteRouter(&StatsStorageHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.AccessKey = router.MasterAccessKey
+			})
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"record_type": "note",
+					"row_count": 1200,
+					"table_size": 1204224,
+					"index_size": 229376,
+					"asset_count": 35,
+					"asset_size": 5242880
+				}]
+			}`)
+		})
+
+		Convey("rejects database without storage stats", func() {
+			r := handlertest.NewSingleRouteRouter(&StatsStorageHandler{}, func(p *router.Payload) {
+				p.DBConn = skydbtest.NewMapConn()
+				p.AccessKey = router.MasterAccessKey
+			})
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"message": "storage stats are not supported by the database",
+					"name": "NotSupported"
+				}
+			}`)
+		})
+
+		Convey("requires master key", func() {
+			r := handlertest.NewSingleRouteRouter(&StatsStorageHandler{}, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "fetching stats requires master key",
+					"name": "PermissionDenied"
+				}
+			}`)
+		})
+	})
+}
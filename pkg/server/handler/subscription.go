@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -129,6 +130,11 @@ func (expr jsonExpression) MarshalJSON() ([]byte, error) {
 		i = skyconv.ToMap(skyconv.MapKeyPath(expr.Value.(string)))
 	case skydb.Function:
 		i = funcSlice(expr.Value)
+	case skydb.Variable:
+		i = map[string]interface{}{
+			"$type": "var",
+			"$val":  expr.Value,
+		}
 	default:
 		return nil, fmt.Errorf("unrecgonized ExpressionType = %v", expr.Type)
 	}
@@ -267,7 +273,7 @@ func (h *SubscriptionFetchHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SubscriptionFetchHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SubscriptionFetchHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := &subscriptionPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -293,7 +299,7 @@ func (h *SubscriptionFetchHandler) Handle(rpayload *router.Payload, response *ro
 		var item interface{}
 
 		subscription := skydb.Subscription{}
-		if err := db.GetSubscription(id, payload.DeviceID, &subscription); err != nil {
+		if err := db.GetSubscription(ctx, id, payload.DeviceID, &subscription); err != nil {
 			// handle err here
 			item = newErrorWithID(id, err)
 		} else {
@@ -342,7 +348,7 @@ func (h *SubscriptionFetchAllHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SubscriptionFetchAllHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SubscriptionFetchAllHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := &subscriptionPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -357,7 +363,7 @@ func (h *SubscriptionFetchAllHandler) Handle(rpayload *router.Payload, response
 		return
 	}
 
-	subscriptions := rpayload.Database.GetSubscriptionsByDeviceID(payload.DeviceID)
+	subscriptions := rpayload.Database.GetSubscriptionsByDeviceID(ctx, payload.DeviceID)
 
 	results := []jsonSubscription{}
 	for _, sub := range subscriptions {
@@ -470,7 +476,7 @@ func (h *SubscriptionSaveHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SubscriptionSaveHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SubscriptionSaveHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	parser := QueryParser{UserID: rpayload.UserInfoID}
 	payload := &subscriptionSavePayload{}
 	skyErr := payload.Decode(rpayload.Data, &parser)
@@ -494,7 +500,7 @@ func (h *SubscriptionSaveHandler) Handle(rpayload *router.Payload, response *rou
 	)
 	for i := range payload.Subscriptions {
 		subscription = &payload.Subscriptions[i]
-		if err := db.SaveSubscription(subscription); err != nil {
+		if err := db.SaveSubscription(ctx, subscription); err != nil {
 			item = newErrorWithID(subscription.ID, err)
 		} else {
 			item = (*jsonSubscription)(subscription)
@@ -542,7 +548,7 @@ func (h *SubscriptionDeleteHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *SubscriptionDeleteHandler) Handle(rpayload *router.Payload, response *router.Response) {
+func (h *SubscriptionDeleteHandler) Handle(ctx context.Context, rpayload *router.Payload, response *router.Response) {
 	payload := &subscriptionPayload{}
 	skyErr := payload.Decode(rpayload.Data)
 	if skyErr != nil {
@@ -567,7 +573,7 @@ func (h *SubscriptionDeleteHandler) Handle(rpayload *router.Payload, response *r
 	for _, id := range payload.SubscriptionIDs {
 		var item interface{}
 
-		if err := db.DeleteSubscription(id, payload.DeviceID); err != nil {
+		if err := db.DeleteSubscription(ctx, id, payload.DeviceID); err != nil {
 			item = newErrorWithID(id, err)
 		} else {
 			item = struct {
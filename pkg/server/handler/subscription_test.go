@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
@@ -42,8 +43,8 @@ func TestSubscriptionFetchHandler(t *testing.T) {
 		sub1 := newFetchSubscription("1")
 
 		db := skydbtest.NewMapDB()
-		db.SaveSubscription(&sub0)
-		db.SaveSubscription(&sub1)
+		db.SaveSubscription(context.Background(), &sub0)
+		db.SaveSubscription(context.Background(), &sub1)
 
 		r := handlertest.NewSingleRouteRouter(&SubscriptionFetchHandler{}, func(p *router.Payload) {
 			p.Database = db
@@ -113,7 +114,7 @@ func (db *fetchallDB) IsReadOnly() bool { return false }
 
 func (db *fetchallDB) DatabaseType() skydb.DatabaseType { return skydb.PublicDatabase }
 
-func (db *fetchallDB) GetSubscriptionsByDeviceID(deviceID string) []skydb.Subscription {
+func (db *fetchallDB) GetSubscriptionsByDeviceID(ctx context.Context, deviceID string) []skydb.Subscription {
 	db.lastDeviceID = deviceID
 	return db.subscriptions
 }
@@ -242,7 +243,7 @@ func TestSubscriptionSaveHandler(t *testing.T) {
 			So(resp.Code, ShouldEqual, 200)
 
 			actualSubscription := skydb.Subscription{}
-			So(db.GetSubscription("subscription_id", "somedeviceid", &actualSubscription), ShouldBeNil)
+			So(db.GetSubscription(context.Background(), "subscription_id", "somedeviceid", &actualSubscription), ShouldBeNil)
 			So(actualSubscription, ShouldResemble, skydb.Subscription{
 				ID:       "subscription_id",
 				DeviceID: "somedeviceid",
@@ -318,8 +319,8 @@ func TestSubscriptionSaveHandler(t *testing.T) {
 }`)
 
 			var sub0, sub1 skydb.Subscription
-			So(db.GetSubscription("sub0", "somedeviceid", &sub0), ShouldBeNil)
-			So(db.GetSubscription("sub1", "somedeviceid", &sub1), ShouldBeNil)
+			So(db.GetSubscription(context.Background(), "sub0", "somedeviceid", &sub0), ShouldBeNil)
+			So(db.GetSubscription(context.Background(), "sub1", "somedeviceid", &sub1), ShouldBeNil)
 
 			So(sub0, ShouldResemble, skydb.Subscription{
 				ID:       "sub0",
@@ -370,8 +371,8 @@ func TestSubscriptionDeleteHandler(t *testing.T) {
 		sub1 := newFetchSubscription("1")
 
 		db := skydbtest.NewMapDB()
-		db.SaveSubscription(&sub0)
-		db.SaveSubscription(&sub1)
+		db.SaveSubscription(context.Background(), &sub0)
+		db.SaveSubscription(context.Background(), &sub1)
 
 		r := handlertest.NewSingleRouteRouter(&SubscriptionDeleteHandler{}, func(p *router.Payload) {
 			p.Database = db
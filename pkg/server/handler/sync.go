@@ -0,0 +1,790 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
+	"github.com/skygeario/skygear-server/pkg/server/utils"
+)
+
+// encodeSyncToken returns an opaque token denoting the moment of a sync.
+func encodeSyncToken(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+// decodeSyncToken returns the moment of sync denoted by the token. An empty
+// token is decoded to the zero time, meaning the client has never synced.
+func decodeSyncToken(token string) (time.Time, error) {
+	if token == "" {
+		return time.Time{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	nsec, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, nsec).UTC(), nil
+}
+
+// defaultSyncChangesLimit is the number of server changes returned in a
+// response if the client does not specify a limit.
+const defaultSyncChangesLimit = 1000
+
+// syncPosition is the position of a client in the server changes. A sync
+// denoted by a plain sync token starts from Since. A sync continued by a
+// continuation token resumes after Cursor of RecordType, and returns
+// changes no later than Until, the moment the sync started.
+type syncPosition struct {
+	Since      time.Time
+	Until      time.Time
+	RecordType string
+	Cursor     *skydb.QueryCursor
+}
+
+type syncContinuation struct {
+	Since      int64  `json:"since,omitempty"`
+	Until      int64  `json:"until"`
+	RecordType string `json:"type"`
+	Cursor     string `json:"cursor"`
+}
+
+// encodeSyncContinuation returns an opaque token continuing the sync
+// at the position.
+func encodeSyncContinuation(position syncPosition) (string, error) {
+	cursor, err := encodeQueryCursor(position.Cursor)
+	if err != nil {
+		return "", err
+	}
+
+	continuation := syncContinuation{
+		Until:      position.Until.UnixNano(),
+		RecordType: position.RecordType,
+		Cursor:     cursor,
+	}
+	if !position.Since.IsZero() {
+		continuation.Since = position.Since.UnixNano()
+	}
+
+	data, err := json.Marshal(continuation)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeSyncPosition returns the position denoted by either a sync token
+// or a continuation token.
+func decodeSyncPosition(token string) (syncPosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return syncPosition{}, err
+	}
+
+	if len(b) == 0 || b[0] != '{' {
+		since, err := decodeSyncToken(token)
+		return syncPosition{Since: since}, err
+	}
+
+	continuation := syncContinuation{}
+	if err := json.Unmarshal(b, &continuation); err != nil {
+		return syncPosition{}, err
+	}
+
+	cursor, err := decodeQueryCursor(continuation.Cursor)
+	if err != nil {
+		return syncPosition{}, err
+	}
+
+	position := syncPosition{
+		Until:      time.Unix(0, continuation.Until).UTC(),
+		RecordType: continuation.RecordType,
+		Cursor:     cursor,
+	}
+	if continuation.Since != 0 {
+		position.Since = time.Unix(0, continuation.Since).UTC()
+	}
+	return position, nil
+}
+
+// syncConflict describes a client change conflicting with the server copy
+// of a record.
+//
+// BaseRecord is the record as last synced by the client, it is nil if the
+// client does not supply one.
+type syncConflict struct {
+	ClientRecord *skydb.Record
+	ServerRecord *skydb.Record
+	BaseRecord   *skydb.Record
+}
+
+// syncConflictResolver resolves a syncConflict. It returns the record to be
+// saved, or nil if the server copy should be kept as is, together with the
+// fields of the client change that are not applied.
+type syncConflictResolver func(ctx context.Context, registry *hook.Registry, conflict syncConflict) (*skydb.Record, []string, skyerr.Error)
+
+var syncConflictResolvers = map[string]syncConflictResolver{
+	"server_wins":     resolveSyncConflictServerWins,
+	"client_wins":     resolveSyncConflictClientWins,
+	"merge":           resolveSyncConflictMergeHook,
+	"three_way_merge": resolveSyncConflictThreeWayMerge,
+}
+
+func resolveSyncConflictServerWins(ctx context.Context, registry *hook.Registry, conflict syncConflict) (*skydb.Record, []string, skyerr.Error) {
+	return nil, nil, nil
+}
+
+func resolveSyncConflictClientWins(ctx context.Context, registry *hook.Registry, conflict syncConflict) (*skydb.Record, []string, skyerr.Error) {
+	return conflict.ClientRecord, nil, nil
+}
+
+// resolveSyncConflictMergeHook delegates the merge to the syncMerge hooks
+// registered for the record type. The server copy is kept if no hooks
+// are registered.
+func resolveSyncConflictMergeHook(ctx context.Context, registry *hook.Registry, conflict syncConflict) (*skydb.Record, []string, skyerr.Error) {
+	clientRecord := conflict.ClientRecord
+	if registry == nil || !registry.HasHooks(hook.SyncMerge, clientRecord.ID.Type) {
+		return nil, nil, nil
+	}
+
+	var merged skydb.Record
+	copyRecord(&merged, clientRecord)
+	if err := registry.ExecuteHooks(ctx, hook.SyncMerge, &merged, conflict.ServerRecord); err != nil {
+		return nil, nil, err
+	}
+	return &merged, nil, nil
+}
+
+// resolveSyncConflictThreeWayMerge compares both the client change and the
+// server copy against the base record last synced by the client. A field
+// changed by the client only is applied, while a field changed differently
+// by both sides keeps the server value and is reported. The server copy is
+// kept if the client does not supply the base record.
+func resolveSyncConflictThreeWayMerge(ctx context.Context, registry *hook.Registry, conflict syncConflict) (*skydb.Record, []string, skyerr.Error) {
+	if conflict.BaseRecord == nil {
+		return nil, nil, nil
+	}
+
+	clientRecord := conflict.ClientRecord
+	serverData := conflict.ServerRecord.Data
+	baseData := conflict.BaseRecord.Data
+
+	merged := skydb.Record{
+		ID:         clientRecord.ID,
+		ACL:        conflict.ServerRecord.ACL,
+		DatabaseID: clientRecord.DatabaseID,
+		Data:       skydb.Data{},
+	}
+	if !reflect.DeepEqual(clientRecord.ACL, conflict.BaseRecord.ACL) &&
+		reflect.DeepEqual(conflict.ServerRecord.ACL, conflict.BaseRecord.ACL) {
+		merged.ACL = clientRecord.ACL
+	}
+
+	conflictFields := []string{}
+	for key, clientValue := range clientRecord.Data {
+		baseValue := baseData[key]
+		if reflect.DeepEqual(clientValue, baseValue) {
+			continue
+		}
+
+		serverValue := serverData[key]
+		if reflect.DeepEqual(serverValue, baseValue) {
+			merged.Data[key] = clientValue
+		} else if !reflect.DeepEqual(serverValue, clientValue) {
+			conflictFields = append(conflictFields, key)
+		}
+	}
+	sort.Strings(conflictFields)
+
+	return &merged, conflictFields, nil
+}
+
+type syncConflictResult struct {
+	ID       string              `json:"_id"`
+	Client   *skyconv.JSONRecord `json:"client"`
+	Server   *skyconv.JSONRecord `json:"server"`
+	Resolved bool                `json:"resolved"`
+	Fields   []string            `json:"fields,omitempty"`
+}
+
+type recordSyncPayload struct {
+	SyncToken   string   `mapstructure:"sync_token"`
+	RecordTypes []string `mapstructure:"record_types"`
+	Strategy    string   `mapstructure:"conflict_resolution"`
+	Limit       uint64   `mapstructure:"limit"`
+
+	// RawChanges stores the original incoming `changes`.
+	RawChanges []map[string]interface{} `mapstructure:"changes"`
+
+	// RawBases stores the original incoming `bases`, the records as
+	// last synced by the client.
+	RawBases []map[string]interface{} `mapstructure:"bases"`
+
+	// RawDeletions stores the original incoming `deletions`, the IDs of
+	// the records deleted by the client.
+	RawDeletions []string `mapstructure:"deletions"`
+
+	// Position is the position in the server changes denoted by
+	// SyncToken.
+	Position syncPosition
+
+	// IncomingItems contains de-serialized recordID or de-serialization
+	// error, the item is one-one corresponding to RawChanges.
+	IncomingItems []interface{}
+
+	// Changes contains the successfully de-serialized records.
+	Changes []*skydb.Record
+
+	// Bases contains the de-serialized base records by ID.
+	Bases map[skydb.RecordID]*skydb.Record
+
+	// Deletions contains the IDs of the records deleted by the client.
+	Deletions []skydb.RecordID
+}
+
+func (payload *recordSyncPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *recordSyncPayload) Validate() skyerr.Error {
+	position, err := decodeSyncPosition(payload.SyncToken)
+	if err != nil {
+		return skyerr.NewInvalidArgument("malformed sync token", []string{"sync_token"})
+	}
+	payload.Position = position
+
+	if position.RecordType != "" && !utils.StringSliceContainAll(payload.RecordTypes, []string{position.RecordType}) {
+		return skyerr.NewInvalidArgument("sync token does not continue the record types", []string{"sync_token", "record_types"})
+	}
+
+	if payload.Limit == 0 {
+		payload.Limit = defaultSyncChangesLimit
+	}
+
+	if payload.Strategy == "" {
+		payload.Strategy = "server_wins"
+	}
+	if _, ok := syncConflictResolvers[payload.Strategy]; !ok {
+		return skyerr.NewInvalidArgument(
+			fmt.Sprintf("unknown conflict resolution %q", payload.Strategy),
+			[]string{"conflict_resolution"})
+	}
+
+	savePayload := recordSavePayload{}
+	payload.IncomingItems = []interface{}{}
+	payload.Changes = []*skydb.Record{}
+	for _, recordMap := range payload.RawChanges {
+		var record skydb.Record
+		if err := savePayload.InitRecord(recordMap, &record); err != nil {
+			payload.IncomingItems = append(payload.IncomingItems, err)
+		} else {
+			payload.IncomingItems = append(payload.IncomingItems, record.ID)
+			payload.Changes = append(payload.Changes, &record)
+		}
+	}
+
+	payload.Bases = map[skydb.RecordID]*skydb.Record{}
+	for _, recordMap := range payload.RawBases {
+		var record skydb.Record
+		if err := savePayload.InitRecord(recordMap, &record); err != nil {
+			return skyerr.NewInvalidArgument("malformed base record", []string{"bases"})
+		}
+		payload.Bases[record.ID] = &record
+	}
+
+	payload.Deletions = []skydb.RecordID{}
+	for _, rawID := range payload.RawDeletions {
+		var recordID skydb.RecordID
+		if err := recordID.UnmarshalText([]byte(rawID)); err != nil {
+			return skyerr.NewInvalidArgument(
+				`record: "_id" should be of format '{type}/{id}', got "`+rawID+`"`,
+				[]string{"deletions"},
+			)
+		}
+		payload.Deletions = append(payload.Deletions, recordID)
+	}
+
+	return nil
+}
+
+// isModifiedSince returns whether the server record is modified after
+// the client synced at since. A zero since means the client knows no
+// version of the record, so no change of the client conflicts with it.
+func isModifiedSince(record *skydb.Record, since time.Time) bool {
+	return !since.IsZero() && record.UpdatedAt.After(since)
+}
+
+/*
+RecordSyncHandler synchronizes records with an offline-first client.
+
+The client sends the sync token returned from its last sync, together with
+the changes it made locally since then, and the IDs of the records it
+deleted locally in `deletions`. A client change conflicts with the server
+if the record was modified on the server after the last sync. Without a
+sync token the client knows no version of the server records, so its
+changes do not conflict. Conflicts are resolved with the strategy specified in `conflict_resolution`:
+
+	server_wins: the client change is discarded (default)
+	client_wins: the client change is saved over the server copy
+	merge:       the syncMerge hooks of the record type produce the record
+	             to be saved; the server copy is kept if there is none
+	three_way_merge:
+	             fields changed by the client only are applied; fields
+	             changed by both sides keep the server value and are
+	             reported. Requires the client to send the records as
+	             last synced in `bases`, otherwise the server copy is kept
+
+A client deletion of a record modified on the server after the last sync
+is rejected as a conflict unless `conflict_resolution` is client_wins; the
+server copy is then returned as a server change.
+
+The response contains the result of saving each client change in `saved`,
+the result of each client deletion in `deleted`, the conflicts
+encountered, the records of `record_types` changed on the server since the
+last sync in `changes`, the IDs of the records of `record_types` deleted
+on the server since the last sync in `deletions`, and a new sync token.
+The client changes and deletions of the same sync are not returned as
+server changes or deletions. Server deletions are only returned if the
+database keeps deleted record IDs, and not without a sync token.
+
+At most `limit` server changes (1000 by default) are returned. If there
+are more, `has_more` is true and the sync token continues the changes
+from where the response stops; the client should sync again with the
+same `record_types` until `has_more` is false.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "record:sync",
+    "access_token": "validToken",
+    "database_id": "_private",
+    "sync_token": "MTQ3NTU2NjQwMDAwMDAwMDAwMA",
+    "record_types": ["note"],
+    "limit": 100,
+    "conflict_resolution": "server_wins",
+    "changes": [{
+        "_id": "note/EA6A3E68-90F3-49B5-B470-5FFDB7A0D4E8",
+        "content": "ewdsa"
+    }],
+    "deletions": ["note/0BE2C0D4-2B3D-4F5B-9D4C-2E6E0E4E5C1A"]
+}
+EOF
+*/
+type RecordSyncHandler struct {
+	HookRegistry  *hook.Registry       `inject:"HookRegistry"`
+	AssetStore    asset.Store          `inject:"AssetStore"`
+	EventSender   pluginEvent.Sender   `inject:"PluginEventSender"`
+	Moderation    *moderation.Pipeline `inject:"ModerationPipeline"`
+	Quota         *quota.Enforcer      `inject:"QuotaEnforcer"`
+	Throttle      *throttle.Limiter    `inject:"RecordThrottle"`
+	IDPolicy      *recordid.Policy     `inject:"RecordIDPolicy"`
+	RecordStats   *stats.Recorder      `inject:"RecordStats"`
+	Authenticator router.Processor     `preprocessor:"authenticator"`
+	DBConn        router.Processor     `preprocessor:"dbconn"`
+	InjectUser    router.Processor     `preprocessor:"inject_user"`
+	InjectDB      router.Processor     `preprocessor:"inject_db"`
+	RequireUser   router.Processor     `preprocessor:"require_user"`
+	PluginReady   router.Processor     `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *RecordSyncHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.InjectDB,
+		h.RequireUser,
+		h.PluginReady,
+	}
+}
+
+func (h *RecordSyncHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *RecordSyncHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &recordSyncPayload{}
+	skyErr := p.Decode(payload.Data)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	db := payload.Database
+	if (len(p.RawChanges) > 0 || len(p.RawDeletions) > 0) && db.IsReadOnly() {
+		response.Err = skyerr.NewError(skyerr.NotSupported, "modifying the selected database is not supported")
+		return
+	}
+
+	resolve := syncConflictResolvers[p.Strategy]
+
+	errMap := map[skydb.RecordID]skyerr.Error{}
+	conflicts := []syncConflictResult{}
+	recordsToSave := []*skydb.Record{}
+	for _, record := range p.Changes {
+		var serverRecord skydb.Record
+		if err := db.Get(ctx, record.ID, &serverRecord); err == skydb.ErrRecordNotFound {
+			recordsToSave = append(recordsToSave, record)
+			continue
+		} else if err != nil {
+			errMap[record.ID] = skyerr.MakeError(err)
+			continue
+		}
+
+		if !isModifiedSince(&serverRecord, p.Position.Since) {
+			recordsToSave = append(recordsToSave, record)
+			continue
+		}
+
+		// A record the user cannot read is saved as is, so that
+		// the save reports the permission error without leaking
+		// the server copy as a conflict.
+		if !payload.HasMasterKey() && !serverRecord.Accessible(payload.UserInfo, skydb.ReadLevel) {
+			recordsToSave = append(recordsToSave, record)
+			continue
+		}
+
+		// the client record is modified when saved
+		var clientRecord skydb.Record
+		copyRecord(&clientRecord, record)
+
+		resolved, conflictFields, err := resolve(ctx, h.HookRegistry, syncConflict{
+			ClientRecord: record,
+			ServerRecord: &serverRecord,
+			BaseRecord:   p.Bases[record.ID],
+		})
+		if err != nil {
+			errMap[record.ID] = err
+			continue
+		}
+
+		injectSigner(&serverRecord, h.AssetStore)
+		conflicts = append(conflicts, syncConflictResult{
+			ID:       record.ID.String(),
+			Client:   (*skyconv.JSONRecord)(&clientRecord),
+			Server:   (*skyconv.JSONRecord)(&serverRecord),
+			Resolved: resolved != nil,
+			Fields:   conflictFields,
+		})
+
+		if resolved == nil {
+			errMap[record.ID] = skyerr.NewError(skyerr.RecordConflict, "record has been modified on the server")
+			continue
+		}
+		recordsToSave = append(recordsToSave, resolved)
+	}
+
+	resp := recordModifyResponse{
+		ErrMap: errMap,
+	}
+	if len(recordsToSave) > 0 {
+		req := recordModifyRequest{
+			Db:             db,
+			Conn:           payload.DBConn,
+			AssetStore:     h.AssetStore,
+			HookRegistry:   h.HookRegistry,
+			UserInfo:       payload.UserInfo,
+			RecordsToSave:  recordsToSave,
+			Quota:          h.Quota,
+			Throttle:       h.Throttle,
+			RecordIDPolicy: h.IDPolicy,
+			RecordStats:    h.RecordStats,
+			WithMasterKey:  payload.HasMasterKey(),
+			Context:        ctx,
+		}
+		if err := recordSaveHandler(&req, &resp); err != nil {
+			response.Err = err
+			return
+		}
+	}
+
+	savedRecordMap := map[skydb.RecordID]*skydb.Record{}
+	for _, record := range resp.SavedRecords {
+		savedRecordMap[record.ID] = record
+	}
+
+	saved := make([]interface{}, 0, len(p.IncomingItems))
+	for _, itemi := range p.IncomingItems {
+		switch item := itemi.(type) {
+		case skyerr.Error:
+			saved = append(saved, newSerializedError("", item))
+		case skydb.RecordID:
+			if err, ok := resp.ErrMap[item]; ok {
+				saved = append(saved, newSerializedError(item.String(), err))
+			} else {
+				saved = append(saved, (*skyconv.JSONRecord)(savedRecordMap[item]))
+			}
+		default:
+			panic(fmt.Sprintf("unknown type of incoming item: %T", itemi))
+		}
+	}
+
+	deleted, skyErr := h.deleteClientDeletions(ctx, payload, p)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	// The sync token is taken after the client changes are saved, so
+	// that they are not returned to the client again in the next sync.
+	position := p.Position
+	if position.Until.IsZero() {
+		position.Until = timeNow()
+	}
+
+	deletions := []string{}
+	deletionLog, ok := db.(skydb.RecordDeletionLog)
+	// The deletions are returned in the first response of a sync only.
+	if ok && !position.Since.IsZero() && position.RecordType == "" {
+		clientDeletions := map[skydb.RecordID]bool{}
+		for _, recordID := range p.Deletions {
+			clientDeletions[recordID] = true
+		}
+
+		for _, recordType := range p.RecordTypes {
+			deletedRecords, err := deletionLog.QueryDeletedRecords(ctx, recordType, position.Since, position.Until)
+			if err != nil {
+				response.Err = skyerr.MakeError(err)
+				return
+			}
+			for _, deletedRecord := range deletedRecords {
+				if clientDeletions[deletedRecord.ID] {
+					continue
+				}
+				deletions = append(deletions, deletedRecord.ID.String())
+			}
+		}
+	}
+
+	changes := []interface{}{}
+	remaining := p.Limit
+	continuing := position.RecordType != ""
+	hasMore := false
+	for _, recordType := range p.RecordTypes {
+		var cursor *skydb.QueryCursor
+		if continuing {
+			if recordType != position.RecordType {
+				continue
+			}
+			continuing = false
+			cursor = position.Cursor
+		}
+
+		query, records, err := h.queryChanges(payload, recordType, position, cursor, remaining)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+
+		for i := range records {
+			// The saved client changes are returned in `saved` already.
+			if _, ok := savedRecordMap[records[i].ID]; ok {
+				continue
+			}
+			injectSigner(&records[i], h.AssetStore)
+			changes = append(changes, (*skyconv.JSONRecord)(&records[i]))
+		}
+
+		remaining -= uint64(len(records))
+		if remaining == 0 {
+			hasMore = true
+			position.RecordType = recordType
+			position.Cursor = skydb.NewQueryCursor(query, &records[len(records)-1])
+			break
+		}
+	}
+
+	syncToken := encodeSyncToken(position.Until)
+	if hasMore {
+		token, err := encodeSyncContinuation(position)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		syncToken = token
+	}
+
+	response.Result = map[string]interface{}{
+		"sync_token": syncToken,
+		"has_more":   hasMore,
+		"saved":      saved,
+		"deleted":    deleted,
+		"conflicts":  conflicts,
+		"changes":    changes,
+		"deletions":  deletions,
+	}
+
+	if resp.SchemaUpdated && h.EventSender != nil {
+		err := sendSchemaChangedEvent(ctx, h.EventSender, db)
+		if err != nil {
+			log.WithField("err", err).Warn("Fail to send schema changed event")
+		}
+	}
+}
+
+// deleteClientDeletions deletes the records deleted by the client and
+// returns the result of each deletion. A record not found is regarded as
+// deleted already.
+func (h *RecordSyncHandler) deleteClientDeletions(ctx context.Context, payload *router.Payload, p *recordSyncPayload) ([]interface{}, skyerr.Error) {
+	db := payload.Database
+	resp := recordModifyResponse{
+		ErrMap: map[skydb.RecordID]skyerr.Error{},
+	}
+
+	recordIDsToDelete := []skydb.RecordID{}
+	for _, recordID := range p.Deletions {
+		var serverRecord skydb.Record
+		if err := db.Get(ctx, recordID, &serverRecord); err == skydb.ErrRecordNotFound {
+			continue
+		} else if err != nil {
+			resp.ErrMap[recordID] = skyerr.MakeError(err)
+			continue
+		}
+
+		readable := payload.HasMasterKey() || serverRecord.Accessible(payload.UserInfo, skydb.ReadLevel)
+		if readable && p.Strategy != "client_wins" && isModifiedSince(&serverRecord, p.Position.Since) {
+			resp.ErrMap[recordID] = skyerr.NewError(skyerr.RecordConflict, "record has been modified on the server")
+			continue
+		}
+		recordIDsToDelete = append(recordIDsToDelete, recordID)
+	}
+
+	if len(recordIDsToDelete) > 0 {
+		req := recordModifyRequest{
+			Db:                db,
+			Conn:              payload.DBConn,
+			AssetStore:        h.AssetStore,
+			HookRegistry:      h.HookRegistry,
+			UserInfo:          payload.UserInfo,
+			RecordIDsToDelete: recordIDsToDelete,
+			RecordStats:       h.RecordStats,
+			WithMasterKey:     payload.HasMasterKey(),
+			Context:           ctx,
+		}
+		if err := recordDeleteHandler(&req, &resp); err != nil {
+			return nil, err
+		}
+	}
+
+	deleted := make([]interface{}, 0, len(p.Deletions))
+	for _, recordID := range p.Deletions {
+		if err, ok := resp.ErrMap[recordID]; ok {
+			deleted = append(deleted, newSerializedError(recordID.String(), err))
+			continue
+		}
+		deleted = append(deleted, struct {
+			ID   skydb.RecordID `json:"_id"`
+			Type string         `json:"_type"`
+		}{recordID, "record"})
+	}
+	return deleted, nil
+}
+
+// queryChanges returns at most limit records of recordType updated after
+// the position started and no later than it ends, ordered by the time of
+// update and continued after the cursor.
+func (h *RecordSyncHandler) queryChanges(payload *router.Payload, recordType string, position syncPosition, cursor *skydb.QueryCursor, limit uint64) (*skydb.Query, []skydb.Record, error) {
+	since := position.Since
+	until := position.Until
+	predicate := skydb.Predicate{
+		Operator: skydb.LessThanOrEqual,
+		Children: []interface{}{
+			skydb.Expression{Type: skydb.KeyPath, Value: "_updated_at"},
+			skydb.Expression{Type: skydb.Literal, Value: until},
+		},
+	}
+	if !since.IsZero() {
+		predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{
+				skydb.Predicate{
+					Operator: skydb.GreaterThan,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "_updated_at"},
+						skydb.Expression{Type: skydb.Literal, Value: since},
+					},
+				},
+				predicate,
+			},
+		}
+	}
+
+	query := skydb.Query{
+		Type:      recordType,
+		Predicate: predicate,
+		Sorts: []skydb.Sort{
+			{KeyPath: "_updated_at", Order: skydb.Ascending},
+		},
+		Limit:               &limit,
+		Cursor:              cursor,
+		ViewAsUser:          payload.UserInfo,
+		BypassAccessControl: payload.HasMasterKey(),
+	}
+
+	if !payload.HasMasterKey() && h.Moderation != nil {
+		if err := h.Moderation.FilterQuery(payload.Context, payload.Database, &query); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	results, err := payload.Database.Query(payload.Context, &query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer results.Close()
+
+	records := []skydb.Record{}
+	for results.Scan() {
+		records = append(records, results.Record())
+	}
+	if results.Err() != nil {
+		return nil, nil, results.Err()
+	}
+
+	makeAssetsComplete(payload.Context, payload.Database, payload.DBConn, records)
+	return &query, records, nil
+}
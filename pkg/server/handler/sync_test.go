@@ -0,0 +1,658 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type syncDatabase struct {
+	*skydbtest.MapDB
+	changes   []skydb.Record
+	lastquery *skydb.Query
+	deletions []skydb.DeletedRecord
+}
+
+func (db *syncDatabase) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	db.lastquery = query
+	return skydb.NewRows(skydb.NewMemoryRows(db.changes)), nil
+}
+
+func (db *syncDatabase) QueryDeletedRecords(ctx context.Context, recordType string, since time.Time, until time.Time) ([]skydb.DeletedRecord, error) {
+	deletions := []skydb.DeletedRecord{}
+	for _, deletion := range db.deletions {
+		if deletion.ID.Type == recordType && deletion.DeletedAt.After(since) && !deletion.DeletedAt.After(until) {
+			deletions = append(deletions, deletion)
+		}
+	}
+	return deletions, nil
+}
+
+func TestSyncToken(t *testing.T) {
+	Convey("sync token", t, func() {
+		Convey("encodes and decodes", func() {
+			now := time.Date(2016, 10, 4, 1, 2, 3, 4, time.UTC)
+			since, err := decodeSyncToken(encodeSyncToken(now))
+			So(err, ShouldBeNil)
+			So(since, ShouldResemble, now)
+		})
+
+		Convey("decodes empty token to zero time", func() {
+			since, err := decodeSyncToken("")
+			So(err, ShouldBeNil)
+			So(since.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("errors on malformed token", func() {
+			_, err := decodeSyncToken("not-a-token")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("decodes sync token to position", func() {
+			now := time.Date(2016, 10, 4, 1, 2, 3, 4, time.UTC)
+			position, err := decodeSyncPosition(encodeSyncToken(now))
+			So(err, ShouldBeNil)
+			So(position, ShouldResemble, syncPosition{Since: now})
+		})
+
+		Convey("encodes and decodes continuation", func() {
+			position := syncPosition{
+				Since:      time.Date(2016, 10, 3, 0, 0, 0, 0, time.UTC),
+				Until:      time.Date(2016, 10, 4, 0, 0, 0, 0, time.UTC),
+				RecordType: "note",
+				Cursor: &skydb.QueryCursor{
+					Values: []interface{}{time.Date(2016, 10, 3, 1, 0, 0, 0, time.UTC)},
+					ID:     "modified",
+				},
+			}
+			token, err := encodeSyncContinuation(position)
+			So(err, ShouldBeNil)
+
+			decoded, err := decodeSyncPosition(token)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, position)
+		})
+
+		Convey("decodes continuation without since", func() {
+			position := syncPosition{
+				Until:      time.Date(2016, 10, 4, 0, 0, 0, 0, time.UTC),
+				RecordType: "note",
+				Cursor: &skydb.QueryCursor{
+					Values: []interface{}{time.Date(2016, 10, 3, 1, 0, 0, 0, time.UTC)},
+					ID:     "modified",
+				},
+			}
+			token, err := encodeSyncContinuation(position)
+			So(err, ShouldBeNil)
+
+			decoded, err := decodeSyncPosition(token)
+			So(err, ShouldBeNil)
+			So(decoded.Since.IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestResolveSyncConflictThreeWayMerge(t *testing.T) {
+	Convey("three-way merge", t, func() {
+		id := skydb.NewRecordID("note", "id")
+		base := &skydb.Record{
+			ID:   id,
+			Data: skydb.Data{"title": "base", "content": "base", "tags": "base"},
+		}
+		server := &skydb.Record{
+			ID:   id,
+			Data: skydb.Data{"title": "server", "content": "server", "tags": "base"},
+		}
+
+		Convey("applies fields changed by client only", func() {
+			client := &skydb.Record{
+				ID:   id,
+				Data: skydb.Data{"tags": "client", "title": "base"},
+			}
+
+			merged, fields, err := resolveSyncConflictThreeWayMerge(nil, nil, syncConflict{client, server, base})
+			So(err, ShouldBeNil)
+			So(fields, ShouldBeEmpty)
+			So(merged.Data, ShouldResemble, skydb.Data{"tags": "client"})
+		})
+
+		Convey("reports fields changed differently by both sides", func() {
+			client := &skydb.Record{
+				ID:   id,
+				Data: skydb.Data{"title": "client", "content": "server", "tags": "client"},
+			}
+
+			merged, fields, err := resolveSyncConflictThreeWayMerge(nil, nil, syncConflict{client, server, base})
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, []string{"title"})
+			So(merged.Data, ShouldResemble, skydb.Data{"tags": "client"})
+		})
+
+		Convey("keeps server ACL unless changed by client only", func() {
+			acl := skydb.RecordACL{skydb.NewRecordACLEntryPublic(skydb.ReadLevel)}
+			client := &skydb.Record{ID: id, ACL: acl, Data: skydb.Data{}}
+
+			merged, _, _ := resolveSyncConflictThreeWayMerge(nil, nil, syncConflict{client, server, base})
+			So(merged.ACL, ShouldResemble, acl)
+
+			server.ACL = skydb.RecordACL{}
+			merged, _, _ = resolveSyncConflictThreeWayMerge(nil, nil, syncConflict{client, server, base})
+			So(merged.ACL, ShouldResemble, skydb.RecordACL{})
+		})
+
+		Convey("keeps server copy without base", func() {
+			client := &skydb.Record{ID: id, Data: skydb.Data{"title": "client"}}
+
+			merged, fields, err := resolveSyncConflictThreeWayMerge(nil, nil, syncConflict{client, server, nil})
+			So(err, ShouldBeNil)
+			So(fields, ShouldBeEmpty)
+			So(merged, ShouldBeNil)
+		})
+	})
+}
+
+func TestRecordSyncHandler(t *testing.T) {
+	now := time.Date(2016, 10, 4, 0, 0, 0, 0, time.UTC)
+	lastSync := time.Date(2016, 10, 3, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("RecordSyncHandler", t, func() {
+		db := &syncDatabase{MapDB: skydbtest.NewMapDB()}
+		conn := skydbtest.NewMapConn()
+		registry := hook.NewRegistry()
+
+		db.Save(context.Background(), &skydb.Record{
+			ID:        skydb.NewRecordID("note", "stale"),
+			OwnerID:   "user0",
+			UpdatedAt: lastSync.Add(-time.Hour),
+			Data:      skydb.Data{"content": "server"},
+		})
+		db.Save(context.Background(), &skydb.Record{
+			ID:        skydb.NewRecordID("note", "modified"),
+			OwnerID:   "user0",
+			UpdatedAt: lastSync.Add(time.Hour),
+			Data:      skydb.Data{"content": "server", "title": "server"},
+		})
+
+		r := handlertest.NewSingleRouteRouter(&RecordSyncHandler{
+			HookRegistry: registry,
+		}, func(payload *router.Payload) {
+			payload.DBConn = conn
+			payload.Database = db
+			payload.UserInfo = &skydb.UserInfo{
+				ID: "user0",
+			}
+		})
+
+		syncToken := encodeSyncToken(lastSync)
+
+		Convey("returns server changes since the sync token", func() {
+			db.changes = []skydb.Record{
+				{
+					ID:      skydb.NewRecordID("note", "modified"),
+					OwnerID: "user0",
+					Data:    skydb.Data{"content": "server"},
+				},
+			}
+
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"record_types": ["note"]
+			}`, syncToken))
+			So(resp.Body.Bytes(), ShouldEqualJSON, fmt.Sprintf(`{
+				"result": {
+					"sync_token": "%s",
+					"has_more": false,
+					"saved": [],
+					"deleted": [],
+					"conflicts": [],
+					"changes": [{
+						"_id": "note/modified",
+						"_type": "record",
+						"_access": null,
+						"_ownerID": "user0",
+						"content": "server"
+					}],
+					"deletions": []
+				}
+			}`, encodeSyncToken(now)))
+
+			So(db.lastquery.Type, ShouldEqual, "note")
+			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.GreaterThan,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "_updated_at"},
+							skydb.Expression{Type: skydb.Literal, Value: lastSync},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.LessThanOrEqual,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "_updated_at"},
+							skydb.Expression{Type: skydb.Literal, Value: now},
+						},
+					},
+				},
+			})
+			So(db.lastquery.ViewAsUser.ID, ShouldEqual, "user0")
+			So(*db.lastquery.Limit, ShouldEqual, defaultSyncChangesLimit)
+			So(db.lastquery.Cursor, ShouldBeNil)
+		})
+
+		Convey("returns a continuation token when reaching the limit", func() {
+			updatedAt := lastSync.Add(time.Hour)
+			db.changes = []skydb.Record{
+				{
+					ID:        skydb.NewRecordID("note", "modified"),
+					OwnerID:   "user0",
+					UpdatedAt: updatedAt,
+					Data:      skydb.Data{"content": "server"},
+				},
+			}
+
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"record_types": ["note", "task"],
+				"limit": 1
+			}`, syncToken))
+			So(resp.Code, ShouldEqual, 200)
+			So(*db.lastquery.Limit, ShouldEqual, 1)
+			So(db.lastquery.Type, ShouldEqual, "note")
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["has_more"], ShouldBeTrue)
+
+			position, err := decodeSyncPosition(result["sync_token"].(string))
+			So(err, ShouldBeNil)
+			So(position, ShouldResemble, syncPosition{
+				Since:      lastSync,
+				Until:      now,
+				RecordType: "note",
+				Cursor: &skydb.QueryCursor{
+					Values: []interface{}{updatedAt},
+					ID:     "modified",
+				},
+			})
+
+			Convey("continues after the cursor", func() {
+				db.changes = []skydb.Record{}
+				resp := r.POST(fmt.Sprintf(`{
+					"sync_token": "%s",
+					"record_types": ["note", "task"],
+					"limit": 1
+				}`, result["sync_token"]))
+				So(resp.Body.Bytes(), ShouldEqualJSON, fmt.Sprintf(`{
+					"result": {
+						"sync_token": "%s",
+						"has_more": false,
+						"saved": [],
+						"deleted": [],
+						"conflicts": [],
+						"changes": [],
+						"deletions": []
+					}
+				}`, encodeSyncToken(now)))
+				So(db.lastquery.Type, ShouldEqual, "task")
+				So(db.lastquery.Cursor, ShouldBeNil)
+			})
+
+			Convey("rejects continuation of other record types", func() {
+				resp := r.POST(fmt.Sprintf(`{
+					"sync_token": "%s",
+					"record_types": ["task"]
+				}`, result["sync_token"]))
+				So(resp.Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("does not return saved client changes", func() {
+			db.changes = []skydb.Record{
+				{
+					ID:      skydb.NewRecordID("note", "new"),
+					OwnerID: "user0",
+					Data:    skydb.Data{"content": "client"},
+				},
+			}
+
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"record_types": ["note"],
+				"changes": [{
+					"_id": "note/new",
+					"content": "client"
+				}]
+			}`, syncToken))
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["changes"], ShouldResemble, []interface{}{})
+			So(result["saved"], ShouldHaveLength, 1)
+		})
+
+		Convey("returns all records without a sync token", func() {
+			r.POST(`{"record_types": ["note"]}`)
+			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.LessThanOrEqual,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "_updated_at"},
+					skydb.Expression{Type: skydb.Literal, Value: now},
+				},
+			})
+		})
+
+		Convey("saves client changes without conflict", func() {
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"changes": [{
+					"_id": "note/stale",
+					"content": "client"
+				}, {
+					"_id": "note/new",
+					"content": "client"
+				}]
+			}`, syncToken))
+			So(resp.Code, ShouldEqual, 200)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "stale"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "client")
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "new"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "client")
+		})
+
+		Convey("keeps server copy on conflict by default", func() {
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client"
+				}]
+			}`, syncToken))
+			So(resp.Body.Bytes(), ShouldEqualJSON, fmt.Sprintf(`{
+				"result": {
+					"sync_token": "%s",
+					"has_more": false,
+					"saved": [{
+						"_id": "note/modified",
+						"_type": "error",
+						"code": 123,
+						"message": "record has been modified on the server",
+						"name": "RecordConflict"
+					}],
+					"deleted": [],
+					"conflicts": [{
+						"_id": "note/modified",
+						"client": {
+							"_id": "note/modified",
+							"_type": "record",
+							"_access": null,
+							"content": "client"
+						},
+						"server": {
+							"_id": "note/modified",
+							"_type": "record",
+							"_access": null,
+							"_ownerID": "user0",
+							"_updated_at": "2016-10-03T01:00:00Z",
+							"content": "server",
+							"title": "server"
+						},
+						"resolved": false
+					}],
+					"changes": [],
+					"deletions": []
+				}
+			}`, encodeSyncToken(now)))
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "server")
+		})
+
+		Convey("saves client changes without a sync token", func() {
+			r.POST(`{
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client"
+				}]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "client")
+		})
+
+		Convey("saves client change on conflict with client_wins", func() {
+			r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"conflict_resolution": "client_wins",
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client"
+				}]
+			}`, syncToken))
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "client")
+			So(record.Data["title"], ShouldEqual, "server")
+		})
+
+		Convey("saves merged record on conflict with merge", func() {
+			registry.Register(hook.SyncMerge, "note", func(ctx context.Context, record *skydb.Record, serverRecord *skydb.Record) skyerr.Error {
+				record.Data["content"] = fmt.Sprintf("%v+%v", serverRecord.Data["content"], record.Data["content"])
+				return nil
+			})
+
+			r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"conflict_resolution": "merge",
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client"
+				}]
+			}`, syncToken))
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "server+client")
+		})
+
+		Convey("keeps server copy with merge but no hooks", func() {
+			r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"conflict_resolution": "merge",
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client"
+				}]
+			}`, syncToken))
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "server")
+		})
+
+		Convey("applies non-conflicting fields with three_way_merge", func() {
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"conflict_resolution": "three_way_merge",
+				"changes": [{
+					"_id": "note/modified",
+					"content": "client",
+					"title": "client"
+				}],
+				"bases": [{
+					"_id": "note/modified",
+					"content": "base",
+					"title": "server"
+				}]
+			}`, syncToken))
+			So(resp.Code, ShouldEqual, 200)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "server")
+			So(record.Data["title"], ShouldEqual, "client")
+			So(resp.Body.String(), ShouldContainSubstring, `"fields":["content"]`)
+		})
+
+		Convey("returns server deletions since the sync token", func() {
+			db.deletions = []skydb.DeletedRecord{
+				{ID: skydb.NewRecordID("note", "old"), DeletedAt: lastSync.Add(-time.Hour)},
+				{ID: skydb.NewRecordID("note", "deleted"), DeletedAt: lastSync.Add(time.Hour)},
+				{ID: skydb.NewRecordID("task", "deleted"), DeletedAt: lastSync.Add(time.Hour)},
+			}
+
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"record_types": ["note"]
+			}`, syncToken))
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["deletions"], ShouldResemble, []interface{}{"note/deleted"})
+		})
+
+		Convey("does not return server deletions without a sync token", func() {
+			db.deletions = []skydb.DeletedRecord{
+				{ID: skydb.NewRecordID("note", "deleted"), DeletedAt: lastSync.Add(time.Hour)},
+			}
+
+			resp := r.POST(`{"record_types": ["note"]}`)
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["deletions"], ShouldResemble, []interface{}{})
+		})
+
+		Convey("deletes client deletions without conflict", func() {
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"deletions": ["note/stale", "note/notexist"]
+			}`, syncToken))
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["deleted"], ShouldResemble, []interface{}{
+				map[string]interface{}{"_id": "note/stale", "_type": "record"},
+				map[string]interface{}{"_id": "note/notexist", "_type": "record"},
+			})
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "stale"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("does not return client deletions as server deletions", func() {
+			db.deletions = []skydb.DeletedRecord{
+				{ID: skydb.NewRecordID("note", "stale"), DeletedAt: now},
+			}
+
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"record_types": ["note"],
+				"deletions": ["note/stale"]
+			}`, syncToken))
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["deletions"], ShouldResemble, []interface{}{})
+		})
+
+		Convey("keeps server copy on deletion conflict by default", func() {
+			resp := r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"deletions": ["note/modified"]
+			}`, syncToken))
+
+			result := map[string]interface{}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			result = result["result"].(map[string]interface{})
+			So(result["deleted"], ShouldResemble, []interface{}{
+				map[string]interface{}{
+					"_id":     "note/modified",
+					"_type":   "error",
+					"code":    float64(skyerr.RecordConflict),
+					"message": "record has been modified on the server",
+					"name":    "RecordConflict",
+				},
+			})
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldBeNil)
+		})
+
+		Convey("deletes record on deletion conflict with client_wins", func() {
+			r.POST(fmt.Sprintf(`{
+				"sync_token": "%s",
+				"conflict_resolution": "client_wins",
+				"deletions": ["note/modified"]
+			}`, syncToken))
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "modified"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("rejects malformed deletions", func() {
+			resp := r.POST(`{"deletions": ["note"]}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+
+		Convey("rejects malformed sync token", func() {
+			resp := r.POST(`{"sync_token": "%%%"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"message": "malformed sync token",
+					"name": "InvalidArgument",
+					"info": {
+						"arguments": ["sync_token"]
+					}
+				}
+			}`)
+		})
+
+		Convey("rejects unknown conflict resolution", func() {
+			resp := r.POST(`{"conflict_resolution": "random"}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
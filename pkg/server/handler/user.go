@@ -15,7 +15,10 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/mitchellh/mapstructure"
+	"github.com/skygeario/skygear-server/pkg/server/fieldfilter"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -39,11 +42,12 @@ func (payload *queryPayload) Validate() skyerr.Error {
 }
 
 type UserQueryHandler struct {
-	Authenticator router.Processor `preprocessor:"authenticator"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
-	InjectUser    router.Processor `preprocessor:"inject_user"`
-	InjectDB      router.Processor `preprocessor:"inject_db"`
-	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	Authenticator router.Processor    `preprocessor:"authenticator"`
+	FieldFilter   *fieldfilter.Filter `inject:"FieldFilter"`
+	DBConn        router.Processor    `preprocessor:"dbconn"`
+	InjectUser    router.Processor    `preprocessor:"inject_user"`
+	InjectDB      router.Processor    `preprocessor:"inject_db"`
+	PluginReady   router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -61,8 +65,8 @@ func (h *UserQueryHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *UserQueryHandler) Handle(payload *router.Payload, response *router.Response) {
-	adminRoles, err := payload.DBConn.GetAdminRoles()
+func (h *UserQueryHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	adminRoles, err := payload.DBConn.GetAdminRoles(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -86,7 +90,7 @@ func (h *UserQueryHandler) Handle(payload *router.Payload, response *router.Resp
 		return
 	}
 
-	userinfos, err := payload.DBConn.QueryUser(qp.Emails, qp.Usernames)
+	userinfos, err := payload.DBConn.QueryUser(ctx, qp.Emails, qp.Usernames)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -94,15 +98,21 @@ func (h *UserQueryHandler) Handle(payload *router.Payload, response *router.Resp
 
 	results := make([]interface{}, len(userinfos))
 	for i, userinfo := range userinfos {
+		data, err := h.FieldFilter.FilterUser(payload, struct {
+			ID       string   `json:"_id"`
+			Email    string   `json:"email"`
+			Username string   `json:"username"`
+			Roles    []string `json:"roles,omitempty"`
+		}{userinfo.ID, userinfo.Email, userinfo.Username, userinfo.Roles})
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+
 		results[i] = map[string]interface{}{
 			"id":   userinfo.ID,
 			"type": "user",
-			"data": struct {
-				ID       string   `json:"_id"`
-				Email    string   `json:"email"`
-				Username string   `json:"username"`
-				Roles    []string `json:"roles,omitempty"`
-			}{userinfo.ID, userinfo.Email, userinfo.Username, userinfo.Roles},
+			"data": data,
 		}
 	}
 	response.Result = results
@@ -140,13 +150,14 @@ func (payload *userUpdatePayload) Validate() skyerr.Error {
 }
 
 type UserUpdateHandler struct {
-	AccessModel   skydb.AccessModel `inject:"AccessModel"`
-	Authenticator router.Processor  `preprocessor:"authenticator"`
-	DBConn        router.Processor  `preprocessor:"dbconn"`
-	InjectUser    router.Processor  `preprocessor:"inject_user"`
-	InjectDB      router.Processor  `preprocessor:"inject_db"`
-	RequireUser   router.Processor  `preprocessor:"require_user"`
-	PluginReady   router.Processor  `preprocessor:"plugin_ready"`
+	AccessModel   skydb.AccessModel   `inject:"AccessModel"`
+	FieldFilter   *fieldfilter.Filter `inject:"FieldFilter"`
+	Authenticator router.Processor    `preprocessor:"authenticator"`
+	DBConn        router.Processor    `preprocessor:"dbconn"`
+	InjectUser    router.Processor    `preprocessor:"inject_user"`
+	InjectDB      router.Processor    `preprocessor:"inject_db"`
+	RequireUser   router.Processor    `preprocessor:"require_user"`
+	PluginReady   router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -165,7 +176,7 @@ func (h *UserUpdateHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *UserUpdateHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *UserUpdateHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &userUpdatePayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -182,8 +193,8 @@ func (h *UserUpdateHandler) Handle(payload *router.Payload, response *router.Res
 
 	userinfo := payload.UserInfo
 	targetUserinfo := &skydb.UserInfo{}
-	payload.DBConn.GetUser(p.ID, targetUserinfo)
-	adminRoles, err := payload.DBConn.GetAdminRoles()
+	payload.DBConn.GetUser(ctx, p.ID, targetUserinfo)
+	adminRoles, err := payload.DBConn.GetAdminRoles(ctx)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -202,7 +213,7 @@ func (h *UserUpdateHandler) Handle(payload *router.Payload, response *router.Res
 		return
 	}
 
-	if err := payload.DBConn.UpdateUser(targetUserinfo); err != nil {
+	if err := payload.DBConn.UpdateUser(ctx, targetUserinfo); err != nil {
 		if err == skydb.ErrUserDuplicated {
 			response.Err = errUserDuplicated
 			return
@@ -210,7 +221,7 @@ func (h *UserUpdateHandler) Handle(payload *router.Payload, response *router.Res
 		response.Err = skyerr.MakeError(err)
 		return
 	}
-	response.Result = struct {
+	setUserResult(h.FieldFilter, payload, response, struct {
 		ID       string   `json:"_id"`
 		Email    string   `json:"email"`
 		Username string   `json:"username"`
@@ -220,7 +231,7 @@ func (h *UserUpdateHandler) Handle(payload *router.Payload, response *router.Res
 		targetUserinfo.Email,
 		targetUserinfo.Username,
 		targetUserinfo.Roles,
-	}
+	})
 }
 
 func (h *UserUpdateHandler) updateUserInfo(userinfo *skydb.UserInfo, p userUpdatePayload) skyerr.Error {
@@ -287,7 +298,7 @@ func (h *UserLinkHandler) GetPreprocessors() []router.Processor {
 	return h.preprocessors
 }
 
-func (h *UserLinkHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *UserLinkHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	p := &userLinkPayload{}
 	skyErr := p.Decode(payload.Data)
 	if skyErr != nil {
@@ -304,14 +315,14 @@ func (h *UserLinkHandler) Handle(payload *router.Payload, response *router.Respo
 		response.Err = skyerr.NewInvalidArgument(err.Error(), []string{"provider"})
 		return
 	}
-	principalID, authData, err := authProvider.Login(payload.Context, p.AuthData)
+	principalID, authData, err := authProvider.Login(ctx, p.AuthData)
 	if err != nil {
 		response.Err = skyerr.NewError(skyerr.InvalidCredentials, "unable to login with the given credentials")
 		return
 	}
 	log.Infof(`Client authenticated as principal: "%v" (provider: "%v").`, principalID, p.Provider)
 
-	err = payload.DBConn.GetUserByPrincipalID(principalID, &info)
+	err = payload.DBConn.GetUserByPrincipalID(ctx, principalID, &info)
 
 	if err != nil && err != skydb.ErrUserNotFound {
 		// TODO: more error handling here if necessary
@@ -319,7 +330,7 @@ func (h *UserLinkHandler) Handle(payload *router.Payload, response *router.Respo
 		return
 	} else if err == nil && info.ID != payload.UserInfo.ID {
 		info.RemoveProvidedAuthData(principalID)
-		if err := payload.DBConn.UpdateUser(&info); err != nil {
+		if err := payload.DBConn.UpdateUser(ctx, &info); err != nil {
 			response.Err = skyerr.MakeError(err)
 			return
 		}
@@ -327,8 +338,109 @@ func (h *UserLinkHandler) Handle(payload *router.Payload, response *router.Respo
 
 	payload.UserInfo.SetProvidedAuthData(principalID, authData)
 
-	if err := payload.DBConn.UpdateUser(payload.UserInfo); err != nil {
+	if err := payload.DBConn.UpdateUser(ctx, payload.UserInfo); err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
 }
+
+type userRevokeTokensPayload struct {
+	UserIDs []string `mapstructure:"user_ids"`
+}
+
+func (payload *userRevokeTokensPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *userRevokeTokensPayload) Validate() skyerr.Error {
+	if len(payload.UserIDs) == 0 {
+		return skyerr.NewInvalidArgument("empty user ids", []string{"user_ids"})
+	}
+	return nil
+}
+
+/*
+UserRevokeTokensHandler revokes all access tokens issued to the specified
+users, signing them out from every device. This works for stateless
+tokens because tokens issued before UserInfo.TokenValidSince are rejected
+by the inject_user preprocessor.
+
+Master key or admin role is required.
+
+curl -X POST -H "Content-Type: application/json" \
+  -d @- http://localhost:3000/ <<EOF
+{
+    "action": "user:revoke_tokens",
+    "api_key": "MASTER_KEY",
+    "user_ids": ["user0", "user1"]
+}
+EOF
+*/
+type UserRevokeTokensHandler struct {
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectUser    router.Processor `preprocessor:"inject_user"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+func (h *UserRevokeTokensHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+		h.InjectUser,
+		h.PluginReady,
+	}
+}
+
+func (h *UserRevokeTokensHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *UserRevokeTokensHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	p := &userRevokeTokensPayload{}
+	skyErr := p.Decode(payload.Data)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if !payload.HasMasterKey() {
+		adminRoles, err := payload.DBConn.GetAdminRoles(ctx)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		if payload.UserInfo == nil || !payload.UserInfo.HasAnyRoles(adminRoles) {
+			response.Err = skyerr.NewError(skyerr.PermissionDenied, "no permission to revoke tokens of users")
+			return
+		}
+	}
+
+	results := make([]interface{}, len(p.UserIDs))
+	for i, userID := range p.UserIDs {
+		userinfo := skydb.UserInfo{}
+		if err := payload.DBConn.GetUser(ctx, userID, &userinfo); err == skydb.ErrUserNotFound {
+			results[i] = newSerializedError(userID, skyerr.NewError(skyerr.ResourceNotFound, "user not found"))
+			continue
+		} else if err != nil {
+			results[i] = newSerializedError(userID, skyerr.MakeError(err))
+			continue
+		}
+
+		now := timeNow()
+		userinfo.TokenValidSince = &now
+		if err := payload.DBConn.UpdateUser(ctx, &userinfo); err != nil {
+			results[i] = newSerializedError(userID, skyerr.MakeError(err))
+			continue
+		}
+
+		results[i] = struct {
+			ID string `json:"_id"`
+		}{userID}
+	}
+	response.Result = results
+}
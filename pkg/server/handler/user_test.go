@@ -15,8 +15,10 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -32,7 +34,7 @@ type queryUserConn struct {
 	skydb.Conn
 }
 
-func (userconn queryUserConn) QueryUser(emails []string, usernames []string) ([]skydb.UserInfo, error) {
+func (userconn queryUserConn) QueryUser(ctx context.Context, emails []string, usernames []string) ([]skydb.UserInfo, error) {
 	myUserInfos := []skydb.UserInfo{
 		skydb.UserInfo{
 			ID:             "user0",
@@ -71,7 +73,7 @@ func (userconn queryUserConn) QueryUser(emails []string, usernames []string) ([]
 	return results, nil
 }
 
-func (userconn queryUserConn) GetAdminRoles() ([]string, error) {
+func (userconn queryUserConn) GetAdminRoles(ctx context.Context) ([]string, error) {
 	return []string{
 		"Admin",
 	}, nil
@@ -218,7 +220,7 @@ func TestUserUpdateHandler(t *testing.T) {
 			Email:          "john.doe@example.com",
 			HashedPassword: []byte("password"),
 		}
-		conn.CreateUser(&userInfo)
+		conn.CreateUser(context.Background(), &userInfo)
 
 		r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 			AccessModel: skydb.RoleBasedAccess,
@@ -241,7 +243,7 @@ func TestUserUpdateHandler(t *testing.T) {
 }`)
 
 			newUserInfo := skydb.UserInfo{}
-			So(conn.GetUser("user0", &newUserInfo), ShouldBeNil)
+			So(conn.GetUser(context.Background(), "user0", &newUserInfo), ShouldBeNil)
 			So(newUserInfo.Email, ShouldEqual, "peter.doe@example.com")
 		})
 
@@ -252,7 +254,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				Username: "username0",
 				Roles:    []string{"admin"},
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -282,7 +284,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				Username: "username0",
 				Roles:    []string{},
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -313,7 +315,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				Username: "username0",
 				Roles:    []string{"admin"},
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -340,7 +342,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				ID:       "user0",
 				Username: "username0",
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -369,7 +371,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				Username: "username0",
 				Roles:    []string{"user", "human"},
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -398,7 +400,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				ID:       "user0",
 				Username: "username0",
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RelationBasedAccess,
@@ -430,7 +432,7 @@ func TestUserUpdateHandler(t *testing.T) {
 				Username: "username0",
 				Roles:    []string{"admin"},
 			}
-			conn.CreateUser(&userInfo)
+			conn.CreateUser(context.Background(), &userInfo)
 
 			r := handlertest.NewSingleRouteRouter(&UserUpdateHandler{
 				AccessModel: skydb.RoleBasedAccess,
@@ -466,7 +468,7 @@ func TestUserLinkHandler(t *testing.T) {
 			Email:          "john.doe@example.com",
 			HashedPassword: []byte("password"),
 		}
-		conn.CreateUser(&userInfo)
+		conn.CreateUser(context.Background(), &userInfo)
 		userInfo2 := skydb.UserInfo{
 			ID:             "user1",
 			Username:       "username1",
@@ -476,7 +478,7 @@ func TestUserLinkHandler(t *testing.T) {
 				"org.example:johndoe": map[string]interface{}{},
 			},
 		}
-		conn.CreateUser(&userInfo2)
+		conn.CreateUser(context.Background(), &userInfo2)
 
 		providerRegistry := provider.NewRegistry()
 		providerRegistry.RegisterAuthProvider("com.example", handlertest.NewSingleUserAuthProvider("com.example", "johndoe"))
@@ -506,7 +508,7 @@ func TestUserLinkHandler(t *testing.T) {
 			So(resp.Body.Bytes(), ShouldEqualJSON, `{}`)
 
 			newUserInfo := skydb.UserInfo{}
-			So(conn.GetUser("user0", &newUserInfo), ShouldBeNil)
+			So(conn.GetUser(context.Background(), "user0", &newUserInfo), ShouldBeNil)
 			So(newUserInfo.Auth["com.example:johndoe"], ShouldResemble, map[string]interface{}{
 				"name": "johndoe",
 			})
@@ -517,13 +519,80 @@ func TestUserLinkHandler(t *testing.T) {
 			So(resp.Body.Bytes(), ShouldEqualJSON, `{}`)
 
 			newUserInfo := skydb.UserInfo{}
-			So(conn.GetUser("user0", &newUserInfo), ShouldBeNil)
+			So(conn.GetUser(context.Background(), "user0", &newUserInfo), ShouldBeNil)
 			So(newUserInfo.Auth["org.example:johndoe"], ShouldResemble, map[string]interface{}{
 				"name": "johndoe",
 			})
-			So(conn.GetUser("user1", &newUserInfo), ShouldBeNil)
+			So(conn.GetUser(context.Background(), "user1", &newUserInfo), ShouldBeNil)
 			_, err := newUserInfo.Auth["org.example:johndoe"]
 			So(err, ShouldNotBeNil)
 		})
 	})
 }
+
+func TestUserRevokeTokensHandler(t *testing.T) {
+	timeNow = func() time.Time { return ZeroTime }
+	defer func() {
+		timeNow = timeNowUTC
+	}()
+
+	Convey("UserRevokeTokensHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.CreateUser(context.Background(), &skydb.UserInfo{
+			ID:       "user0",
+			Username: "john.doe",
+			Email:    "john.doe@example.com",
+		})
+		admin := skydb.UserInfo{
+			ID:       "admin0",
+			Username: "admin",
+			Email:    "admin@example.com",
+			Roles:    []string{"admin"},
+		}
+		conn.CreateUser(context.Background(), &admin)
+
+		userInfo := &admin
+		accessKey := router.ClientAccessKey
+		r := handlertest.NewSingleRouteRouter(&UserRevokeTokensHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.UserInfo = userInfo
+			p.AccessKey = accessKey
+		})
+
+		Convey("revokes tokens of users", func() {
+			resp := r.POST(`{"user_ids": ["user0", "notexist"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+	"result": [{
+		"_id": "user0"
+	}, {
+		"_id": "notexist",
+		"_type": "error",
+		"code": 110,
+		"message": "user not found",
+		"name": "ResourceNotFound"
+	}]
+}`)
+
+			revokedUserInfo := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), "user0", &revokedUserInfo), ShouldBeNil)
+			So(*revokedUserInfo.TokenValidSince, ShouldResemble, ZeroTime)
+		})
+
+		Convey("revokes tokens with master key", func() {
+			userInfo = nil
+			accessKey = router.MasterAccessKey
+			resp := r.POST(`{"user_ids": ["user0"]}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("requires admin role", func() {
+			userInfo = &skydb.UserInfo{ID: "user1"}
+			resp := r.POST(`{"user_ids": ["user0"]}`)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+
+			revokedUserInfo := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), "user0", &revokedUserInfo), ShouldBeNil)
+			So(revokedUserInfo.TokenValidSince, ShouldBeNil)
+		})
+	})
+}
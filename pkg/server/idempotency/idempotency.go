@@ -0,0 +1,145 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package idempotency stores the responses of requests carrying an
+// idempotency key in memory, so that clients can safely retry mutating
+// requests on unreliable networks.
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+)
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+type entry struct {
+	// done is closed when the request holding the key finishes.
+	done     chan struct{}
+	response *router.StoredResponse
+	expireAt time.Time
+}
+
+// Cache is a router.IdempotencyStore keeping responses in memory for
+// Retention. Responses are not shared between server processes.
+//
+// A nil Cache or one without any actions handles no requests.
+type Cache struct {
+	// Actions are the actions whose requests can carry an idempotency
+	// key.
+	Actions []string
+
+	// Retention is how long a response is replayed for.
+	Retention time.Duration
+
+	mutex     sync.Mutex
+	entries   map[string]*entry
+	nextSweep time.Time
+}
+
+// Enabled returns true if any action is handled.
+func (c *Cache) Enabled() bool {
+	return c != nil && len(c.Actions) > 0 && c.Retention > 0
+}
+
+// Handles returns true if action is one of the Actions.
+func (c *Cache) Handles(action string) bool {
+	if !c.Enabled() {
+		return false
+	}
+	for _, a := range c.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Begin reserves key, or returns the response stored under it. If
+// another request is holding key, Begin waits for it to finish.
+func (c *Cache) Begin(ctx context.Context, key string) (*router.StoredResponse, error) {
+	for {
+		c.mutex.Lock()
+		c.sweep()
+		e, ok := c.entries[key]
+		if ok && e.response != nil && !timeNow().Before(e.expireAt) {
+			delete(c.entries, key)
+			ok = false
+		}
+		if !ok {
+			c.entries[key] = &entry{
+				done: make(chan struct{}),
+			}
+			c.mutex.Unlock()
+			return nil, nil
+		}
+		c.mutex.Unlock()
+
+		select {
+		case <-e.done:
+			if e.response != nil {
+				return e.response, nil
+			}
+			// The request holding the key released it without a
+			// response, try to reserve it again.
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Finish stores response under key until Retention has passed, and
+// wakes up requests waiting for key. If response is nil, key is
+// released.
+func (c *Cache) Finish(key string, response *router.StoredResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	if response == nil {
+		delete(c.entries, key)
+	} else {
+		e.response = response
+		e.expireAt = timeNow().Add(c.Retention)
+	}
+	close(e.done)
+}
+
+// sweep removes expired responses at most once per Retention, so that
+// the cache does not grow indefinitely. The caller must hold the mutex.
+func (c *Cache) sweep() {
+	now := timeNow()
+	if c.entries == nil {
+		c.entries = map[string]*entry{}
+		c.nextSweep = now.Add(c.Retention)
+		return
+	}
+	if now.Before(c.nextSweep) {
+		return
+	}
+
+	for key, e := range c.entries {
+		if e.response != nil && !now.Before(e.expireAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.nextSweep = now.Add(c.Retention)
+}
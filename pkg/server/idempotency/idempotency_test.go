@@ -0,0 +1,108 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("Cache", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		cache := &Cache{
+			Actions:   []string{"record:save"},
+			Retention: time.Hour,
+		}
+		ctx := context.Background()
+		response := &router.StoredResponse{
+			Status: 200,
+			Result: "saved",
+		}
+
+		Convey("handles configured actions only", func() {
+			var nilCache *Cache
+			So(nilCache.Handles("record:save"), ShouldBeFalse)
+			So(cache.Handles("record:save"), ShouldBeTrue)
+			So(cache.Handles("record:query"), ShouldBeFalse)
+		})
+
+		Convey("replays stored response", func() {
+			stored, err := cache.Begin(ctx, "key")
+			So(err, ShouldBeNil)
+			So(stored, ShouldBeNil)
+			cache.Finish("key", response)
+
+			stored, err = cache.Begin(ctx, "key")
+			So(err, ShouldBeNil)
+			So(stored, ShouldEqual, response)
+
+			stored, err = cache.Begin(ctx, "other")
+			So(err, ShouldBeNil)
+			So(stored, ShouldBeNil)
+		})
+
+		Convey("expires stored response after retention", func() {
+			cache.Begin(ctx, "key")
+			cache.Finish("key", response)
+
+			now = now.Add(time.Hour)
+			stored, err := cache.Begin(ctx, "key")
+			So(err, ShouldBeNil)
+			So(stored, ShouldBeNil)
+		})
+
+		Convey("releases key without response", func() {
+			cache.Begin(ctx, "key")
+			cache.Finish("key", nil)
+
+			stored, err := cache.Begin(ctx, "key")
+			So(err, ShouldBeNil)
+			So(stored, ShouldBeNil)
+		})
+
+		Convey("waits for request holding the key", func() {
+			cache.Begin(ctx, "key")
+
+			result := make(chan *router.StoredResponse)
+			go func() {
+				stored, _ := cache.Begin(ctx, "key")
+				result <- stored
+			}()
+
+			cache.Finish("key", response)
+			So(<-result, ShouldEqual, response)
+		})
+
+		Convey("stops waiting when context is done", func() {
+			cache.Begin(ctx, "key")
+
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			stored, err := cache.Begin(cancelledCtx, "key")
+			So(err, ShouldEqual, context.Canceled)
+			So(stored, ShouldBeNil)
+		})
+	})
+}
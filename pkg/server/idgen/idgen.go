@@ -0,0 +1,66 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package idgen generates the IDs of users and records created by the
+// server with a configurable strategy.
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+// Generator returns a new unique ID.
+type Generator func() string
+
+var (
+	mutex      sync.RWMutex
+	current    Generator = uuid.New
+	generators           = map[string]Generator{
+		"uuid": uuid.New,
+		"ulid": NewULID,
+	}
+)
+
+// Register makes a Generator available to Use by name. It replaces the
+// Generator previously registered with the same name.
+func Register(name string, generator Generator) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	generators[name] = generator
+}
+
+// Use sets the Generator registered by name as the strategy of New.
+func Use(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	generator, ok := generators[name]
+	if !ok {
+		return fmt.Errorf("idgen: unknown id strategy %q", name)
+	}
+	current = generator
+	return nil
+}
+
+// New returns a new ID generated with the strategy set by Use, which
+// is uuid by default.
+func New() string {
+	mutex.RLock()
+	generator := current
+	mutex.RUnlock()
+	return generator()
+}
@@ -0,0 +1,81 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idgen
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNew(t *testing.T) {
+	Convey("New", t, func() {
+		defer Use("uuid")
+
+		Convey("generates uuid by default", func() {
+			So(New(), ShouldHaveLength, 36)
+		})
+
+		Convey("generates with the strategy in use", func() {
+			So(Use("ulid"), ShouldBeNil)
+			So(New(), ShouldHaveLength, 26)
+		})
+
+		Convey("generates with registered generator", func() {
+			Register("fixed", func() string { return "fixed-id" })
+			So(Use("fixed"), ShouldBeNil)
+			So(New(), ShouldEqual, "fixed-id")
+		})
+
+		Convey("errors on unknown strategy", func() {
+			So(Use("unknown"), ShouldNotBeNil)
+			So(New(), ShouldHaveLength, 36)
+		})
+	})
+}
+
+func TestNewULID(t *testing.T) {
+	Convey("NewULID", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		Convey("is 26 characters of crockford base32", func() {
+			matched, err := regexp.MatchString(`^[0-9A-HJKMNP-TV-Z]{26}$`, NewULID())
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeTrue)
+		})
+
+		Convey("sorts by time", func() {
+			earlier := NewULID()
+			now = now.Add(time.Millisecond)
+			later := NewULID()
+			So(earlier, ShouldBeLessThan, later)
+			So(earlier[:10], ShouldEqual, "01BA4MZT80")
+		})
+
+		Convey("encodes all bits", func() {
+			So(encodeULID([16]byte{}), ShouldEqual, "00000000000000000000000000")
+			So(encodeULID([16]byte{
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			}), ShouldEqual, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+		})
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// crockfordBase32 is the alphabet of ULID, which excludes I, L, O and U
+// and sorts in the same order as the values it encodes.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// NewULID returns a new ULID, a 26-character ID made of a millisecond
+// timestamp and 80 random bits. ULIDs generated in different
+// milliseconds sort in the order they are generated, which keeps
+// inserts to database indexes local.
+func NewULID() string {
+	var id [16]byte
+
+	ms := uint64(timeNow().UnixNano() / int64(time.Millisecond))
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], ms)
+	copy(id[:6], timestamp[2:])
+
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic("idgen: failed to read random bytes: " + err.Error())
+	}
+
+	return encodeULID(id)
+}
+
+// encodeULID encodes the 128 bits of id as 26 characters of 5 bits
+// each, with the 2 padding bits at the front.
+func encodeULID(id [16]byte) string {
+	var s [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
@@ -0,0 +1,170 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package livelog changes the logging of the server at runtime for a
+// limited time, so that production issues can be debugged without
+// restarting the server at debug level.
+package livelog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+)
+
+var log = logging.LoggerEntry("livelog")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// Capture logs the request and response bodies of requests of Action,
+// or made by the user of UserID, until the time Until. Empty Action or
+// UserID matches any request.
+type Capture struct {
+	Action string    `json:"action,omitempty"`
+	UserID string    `json:"user_id,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+func (c *Capture) matches(payload *router.Payload) bool {
+	return (c.Action == "" || c.Action == payload.RouteAction()) &&
+		(c.UserID == "" || c.UserID == payload.UserInfoID)
+}
+
+// Controller is a router.BodyCapturer whose captures and log level can
+// be changed at runtime. Changes are reverted after the duration they
+// are made for.
+//
+// Changes are not shared with other server processes.
+type Controller struct {
+	mutex      sync.RWMutex
+	captures   []Capture
+	levelUntil time.Time
+	levelTimer *time.Timer
+	// levelChanges counts calls of SetLevel, so that a timer of an
+	// earlier call does not restore the level
+	levelChanges int
+
+	// levels of loggers before the level is changed
+	savedLevels map[string]logrus.Level
+}
+
+// SetLevel changes the level of all loggers to level for d, after which
+// the level of each logger is restored.
+func (c *Controller) SetLevel(level logrus.Level, d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.savedLevels == nil {
+		c.savedLevels = map[string]logrus.Level{}
+		for name, logger := range logging.Loggers() {
+			c.savedLevels[name] = logger.Level
+		}
+	}
+	if c.levelTimer != nil {
+		c.levelTimer.Stop()
+	}
+
+	logging.SetLevel(level)
+	c.levelChanges++
+	levelChange := c.levelChanges
+	c.levelUntil = timeNow().Add(d)
+	c.levelTimer = time.AfterFunc(d, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if levelChange == c.levelChanges {
+			c.restoreLevel()
+		}
+	})
+	log.Warnf("Log level changed to %s until %s", level, c.levelUntil.Format(time.RFC3339))
+}
+
+// RestoreLevel restores the level of loggers changed by SetLevel.
+func (c *Controller) RestoreLevel() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.restoreLevel()
+}
+
+func (c *Controller) restoreLevel() {
+	if c.savedLevels == nil {
+		return
+	}
+	if c.levelTimer != nil {
+		c.levelTimer.Stop()
+		c.levelTimer = nil
+	}
+
+	loggers := logging.Loggers()
+	for name, level := range c.savedLevels {
+		if logger, ok := loggers[name]; ok {
+			logger.Level = level
+		}
+	}
+	c.savedLevels = nil
+	c.levelUntil = time.Time{}
+	log.Warnln("Log level restored")
+}
+
+// AddCapture logs the bodies of requests matching action and userID
+// for d.
+func (c *Controller) AddCapture(action string, userID string, d time.Duration) Capture {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	capture := Capture{
+		Action: action,
+		UserID: userID,
+		Until:  timeNow().Add(d),
+	}
+	c.captures = append(c.activeCaptures(), capture)
+	return capture
+}
+
+// Status returns the time until which the level changed by SetLevel
+// lasts, which is zero if the level is not changed, and the captures
+// not yet expired.
+func (c *Controller) Status() (levelUntil time.Time, captures []Capture) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.levelUntil, c.activeCaptures()
+}
+
+// ShouldCapture returns whether the request matches any capture not
+// yet expired.
+func (c *Controller) ShouldCapture(payload *router.Payload) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, capture := range c.activeCaptures() {
+		if capture.matches(payload) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) activeCaptures() []Capture {
+	now := timeNow()
+	captures := []Capture{}
+	for _, capture := range c.captures {
+		if capture.Until.After(now) {
+			captures = append(captures, capture)
+		}
+	}
+	return captures
+}
@@ -0,0 +1,101 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package livelog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newPayload(action string, userID string) *router.Payload {
+	return &router.Payload{
+		Data: map[string]interface{}{
+			"action": action,
+		},
+		UserInfoID: userID,
+	}
+}
+
+func TestController(t *testing.T) {
+	Convey("Controller", t, func() {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		c := &Controller{}
+
+		Convey("captures nothing by default", func() {
+			So(c.ShouldCapture(newPayload("record:save", "user0")), ShouldBeFalse)
+		})
+
+		Convey("captures requests of action", func() {
+			c.AddCapture("record:save", "", 10*time.Minute)
+			So(c.ShouldCapture(newPayload("record:save", "user0")), ShouldBeTrue)
+			So(c.ShouldCapture(newPayload("record:query", "user0")), ShouldBeFalse)
+		})
+
+		Convey("captures requests by user", func() {
+			c.AddCapture("", "user0", 10*time.Minute)
+			So(c.ShouldCapture(newPayload("record:save", "user0")), ShouldBeTrue)
+			So(c.ShouldCapture(newPayload("record:save", "user1")), ShouldBeFalse)
+		})
+
+		Convey("stops capturing after the duration", func() {
+			c.AddCapture("record:save", "", 10*time.Minute)
+			_, captures := c.Status()
+			So(captures, ShouldResemble, []Capture{
+				{Action: "record:save", Until: now.Add(10 * time.Minute)},
+			})
+
+			now = now.Add(10 * time.Minute)
+			So(c.ShouldCapture(newPayload("record:save", "user0")), ShouldBeFalse)
+			_, captures = c.Status()
+			So(captures, ShouldBeEmpty)
+		})
+
+		Convey("changes and restores log level", func() {
+			logger := logging.Logger("livelog_test")
+			logger.Level = logrus.WarnLevel
+
+			c.SetLevel(logrus.DebugLevel, 10*time.Minute)
+			So(logger.Level, ShouldEqual, logrus.DebugLevel)
+			levelUntil, _ := c.Status()
+			So(levelUntil, ShouldResemble, now.Add(10*time.Minute))
+
+			c.RestoreLevel()
+			So(logger.Level, ShouldEqual, logrus.WarnLevel)
+			levelUntil, _ = c.Status()
+			So(levelUntil.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("restores log level after the duration", func() {
+			logger := logging.Logger("livelog_test")
+			logger.Level = logrus.WarnLevel
+
+			c.SetLevel(logrus.DebugLevel, time.Millisecond)
+			So(logger.Level, ShouldEqual, logrus.DebugLevel)
+			time.Sleep(50 * time.Millisecond)
+			So(logger.Level, ShouldEqual, logrus.WarnLevel)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client calls actions of a Skygear Server.
+type Client struct {
+	// Endpoint is the URL of the server, e.g. http://localhost:3000.
+	Endpoint string
+
+	// APIKey is sent with requests made on behalf of users.
+	APIKey string
+
+	// MasterKey is sent with requests that are not made on behalf of
+	// users, such as fetching the record schema.
+	MasterKey string
+
+	HTTPClient *http.Client
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Call calls action with data and returns the raw result. The request
+// is made with the master key if accessToken is empty.
+func (c *Client) Call(action string, data map[string]interface{}, accessToken string) (json.RawMessage, error) {
+	body := map[string]interface{}{}
+	for key, value := range data {
+		body[key] = value
+	}
+	body["action"] = action
+	if accessToken == "" {
+		body["api_key"] = c.MasterKey
+	} else {
+		body["api_key"] = c.APIKey
+		body["access_token"] = accessToken
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	url := strings.TrimSuffix(c.Endpoint, "/") + "/" + strings.Replace(action, ":", "/", -1)
+	httpResp, err := httpClient.Post(url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := response{}
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%s: failed to decode response with status %d: %v", action, httpResp.StatusCode, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s: %s: %s", action, resp.Error.Name, resp.Error.Message)
+	}
+	return resp.Result, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+var uuidNew = uuid.New
+
+var (
+	firstNames = []string{"Alice", "Bob", "Carol", "David", "Emma", "Frank", "Grace", "Henry", "Ivy", "Jack"}
+	lastNames  = []string{"Chan", "Smith", "Wong", "Brown", "Lee", "Taylor", "Ng", "Wilson", "Cheung", "Davis"}
+	words      = []string{
+		"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit",
+		"sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et",
+		"dolore", "magna", "aliqua", "enim", "ad", "minim", "veniam", "quis",
+	}
+)
+
+// Field is a field of a record type in the record schema.
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Schema maps record types to their fields, as returned by schema:fetch.
+type Schema map[string][]Field
+
+// Generator generates records with random values following a Schema.
+//
+// Reference fields only refer to records reported as saved with Saved,
+// so that generated records never refer to records which do not exist.
+// Saved can be called concurrently with Record, but Record itself is not
+// safe for concurrent use.
+type Generator struct {
+	rand *rand.Rand
+
+	mutex sync.RWMutex
+	ids   map[string][]string
+}
+
+// NewGenerator returns a Generator whose random values are seeded
+// with seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		rand: rand.New(rand.NewSource(seed)),
+		ids:  map[string][]string{},
+	}
+}
+
+// Record generates a record of recordType with random values for
+// fields. Fields of types that cannot be generated, such as assets and
+// sequences, are left out.
+func (g *Generator) Record(recordType string, fields []Field) *skydb.Record {
+	record := &skydb.Record{
+		ID:   skydb.NewRecordID(recordType, uuidNew()),
+		Data: skydb.Data{},
+	}
+	for _, field := range fields {
+		if value, ok := g.value(field); ok {
+			record.Data[field.Name] = value
+		}
+	}
+	return record
+}
+
+// Saved makes the record of id available to reference fields.
+func (g *Generator) Saved(id skydb.RecordID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.ids[id.Type] = append(g.ids[id.Type], id.Key)
+}
+
+func (g *Generator) value(field Field) (interface{}, bool) {
+	switch field.Type {
+	case "string":
+		return g.stringValue(field.Name), true
+	case "number":
+		return float64(g.rand.Intn(100000)) / 100, true
+	case "integer":
+		return g.rand.Intn(1000), true
+	case "boolean":
+		return g.rand.Intn(2) == 1, true
+	case "datetime":
+		// within the past 30 days, truncated to match the precision
+		// of the database
+		ago := time.Duration(g.rand.Int63n(int64(30 * 24 * time.Hour)))
+		return timeNow().Add(-ago).Truncate(time.Second), true
+	case "location":
+		return skydb.NewLocation(g.rand.Float64()*360-180, g.rand.Float64()*180-90), true
+	case "json":
+		return map[string]interface{}{
+			"tags":  []interface{}{g.pick(words), g.pick(words)},
+			"score": g.rand.Intn(100),
+		}, true
+	}
+
+	if strings.HasPrefix(field.Type, "ref(") && strings.HasSuffix(field.Type, ")") {
+		recordType := field.Type[len("ref(") : len(field.Type)-1]
+		g.mutex.RLock()
+		defer g.mutex.RUnlock()
+		ids := g.ids[recordType]
+		if len(ids) == 0 {
+			return nil, false
+		}
+		return skydb.NewReference(recordType, ids[g.rand.Intn(len(ids))]), true
+	}
+
+	return nil, false
+}
+
+// stringValue guesses what kind of string the field holds by its name.
+func (g *Generator) stringValue(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "email"):
+		return fmt.Sprintf("%s%d@example.com", strings.ToLower(g.pick(firstNames)), g.rand.Intn(10000))
+	case strings.Contains(name, "name"):
+		return g.pick(firstNames) + " " + g.pick(lastNames)
+	case strings.Contains(name, "url"), strings.Contains(name, "link"):
+		return "https://example.com/" + g.words(2, "-")
+	case strings.Contains(name, "phone"):
+		return fmt.Sprintf("+1555%07d", g.rand.Intn(10000000))
+	case strings.Contains(name, "title"):
+		return strings.Title(g.words(3, " "))
+	}
+	return g.words(5+g.rand.Intn(15), " ")
+}
+
+func (g *Generator) words(n int, sep string) string {
+	ws := make([]string, n)
+	for i := range ws {
+		ws[i] = g.pick(words)
+	}
+	return strings.Join(ws, sep)
+}
+
+func (g *Generator) pick(choices []string) string {
+	return choices[g.rand.Intn(len(choices))]
+}
+
+// recordMap returns the map representation of record for record:save.
+func recordMap(record *skydb.Record) map[string]interface{} {
+	m := skyconv.ToMap(skyconv.ToMapData(record.Data))
+	m["_id"] = record.ID.String()
+	return m
+}
@@ -0,0 +1,230 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadgen generates synthetic users and records against a
+// running server following its record schema, for load testing and
+// capacity planning.
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+var log = logging.LoggerEntry("loadgen")
+
+// Options configures Run.
+type Options struct {
+	// Rate is the number of records saved per second.
+	Rate float64
+
+	// Count is the number of records to save. Records are saved until
+	// the context is done if it is zero.
+	Count int
+
+	// Users is the number of users signed up before saving records,
+	// which are then saved on behalf of random users. Records are saved
+	// with the master key if it is zero.
+	Users int
+
+	// RecordTypes are the record types to save. All record types in the
+	// schema are saved if it is empty.
+	RecordTypes []string
+
+	// Seed seeds the random values generated.
+	Seed int64
+}
+
+// Result counts what Run has generated.
+type Result struct {
+	Users   int
+	Records int
+	Errors  int
+}
+
+// FetchSchema fetches the record schema of the server with the master
+// key.
+func FetchSchema(client *Client) (Schema, error) {
+	result, err := client.Call("schema:fetch", nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp := struct {
+		RecordTypes map[string]struct {
+			Fields []Field `json:"fields"`
+		} `json:"record_types"`
+	}{}
+	if err := json.Unmarshal(result, &resp); err != nil {
+		return nil, err
+	}
+
+	schema := Schema{}
+	for recordType, fieldList := range resp.RecordTypes {
+		schema[recordType] = fieldList.Fields
+	}
+	return schema, nil
+}
+
+// Run signs up users and saves records generated from the schema of
+// the server at opts.Rate, until opts.Count records are saved or ctx
+// is done. Records are saved concurrently, so that a slow server does
+// not lower the rate.
+func Run(ctx context.Context, client *Client, opts Options) (Result, error) {
+	result := Result{}
+	if opts.Rate <= 0 {
+		return result, errors.New("rate must be positive")
+	}
+
+	schema, err := FetchSchema(client)
+	if err != nil {
+		return result, err
+	}
+
+	recordTypes := generatedRecordTypes(schema, opts.RecordTypes)
+	if len(recordTypes) == 0 {
+		return result, errors.New("no record types to generate")
+	}
+
+	generator := NewGenerator(opts.Seed)
+
+	accessTokens := []string{}
+	for i := 0; i < opts.Users; i++ {
+		accessToken, err := signup(client)
+		if err != nil {
+			return result, err
+		}
+		accessTokens = append(accessTokens, accessToken)
+		result.Users++
+	}
+	log.Infof("signed up %d users", result.Users)
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer ticker.Stop()
+
+	for sent := 0; opts.Count == 0 || sent < opts.Count; sent++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return result, nil
+		case <-ticker.C:
+		}
+
+		recordType := recordTypes[generator.rand.Intn(len(recordTypes))]
+		record := generator.Record(recordType, schema[recordType])
+		accessToken := ""
+		if len(accessTokens) > 0 {
+			accessToken = accessTokens[generator.rand.Intn(len(accessTokens))]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := saveRecord(client, recordMap(record), accessToken)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				log.WithField("err", err).Debugln("failed to save generated record")
+				result.Errors++
+				return
+			}
+			generator.Saved(record.ID)
+			result.Records++
+		}()
+	}
+
+	wg.Wait()
+	return result, nil
+}
+
+// generatedRecordTypes returns the record types in schema to generate,
+// sorted so that the random choices are reproducible with the same
+// seed. User records are not generated, as they are created by signup.
+func generatedRecordTypes(schema Schema, only []string) []string {
+	recordTypes := []string{}
+	for recordType := range schema {
+		if recordType == "user" || strings.HasPrefix(recordType, "_") {
+			continue
+		}
+		if len(only) > 0 && !containsString(only, recordType) {
+			continue
+		}
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	return recordTypes
+}
+
+func signup(client *Client) (string, error) {
+	result, err := client.Call("auth:signup", map[string]interface{}{
+		"username": "loadgen-" + uuidNew(),
+		"password": uuidNew(),
+	}, "")
+	if err != nil {
+		return "", err
+	}
+
+	resp := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(result, &resp); err != nil {
+		return "", err
+	}
+	return resp.AccessToken, nil
+}
+
+func saveRecord(client *Client, record map[string]interface{}, accessToken string) error {
+	result, err := client.Call("record:save", map[string]interface{}{
+		"database_id": "_public",
+		"records":     []interface{}{record},
+	}, accessToken)
+	if err != nil {
+		return err
+	}
+
+	items := []struct {
+		Type    string `json:"_type"`
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(result, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.Type == "error" {
+			return errors.New(item.Message)
+		}
+	}
+	return nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeServer struct {
+	mutex    sync.Mutex
+	requests []map[string]interface{}
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, body)
+	s.mutex.Unlock()
+
+	var result interface{}
+	switch body["action"] {
+	case "schema:fetch":
+		result = map[string]interface{}{
+			"record_types": map[string]interface{}{
+				"user": map[string]interface{}{"fields": []interface{}{}},
+				"note": map[string]interface{}{
+					"fields": []interface{}{
+						map[string]interface{}{"name": "title", "type": "string"},
+						map[string]interface{}{"name": "parent", "type": "ref(note)"},
+					},
+				},
+			},
+		}
+	case "auth:signup":
+		result = map[string]interface{}{"access_token": "token"}
+	case "record:save":
+		records := body["records"].([]interface{})
+		result = []interface{}{records[0]}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+}
+
+func TestRun(t *testing.T) {
+	Convey("Run", t, func() {
+		server := &fakeServer{}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		client := &Client{
+			Endpoint:  ts.URL,
+			APIKey:    "apikey",
+			MasterKey: "masterkey",
+		}
+
+		Convey("signs up users and saves records", func() {
+			result, err := Run(context.Background(), client, Options{
+				Rate:  1000,
+				Count: 3,
+				Users: 1,
+			})
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, Result{Users: 1, Records: 3})
+
+			So(server.requests, ShouldHaveLength, 5)
+			So(server.requests[0]["action"], ShouldEqual, "schema:fetch")
+			So(server.requests[0]["api_key"], ShouldEqual, "masterkey")
+			So(server.requests[1]["action"], ShouldEqual, "auth:signup")
+			So(server.requests[2]["action"], ShouldEqual, "record:save")
+			So(server.requests[2]["api_key"], ShouldEqual, "apikey")
+			So(server.requests[2]["access_token"], ShouldEqual, "token")
+		})
+
+		Convey("errors if no record types can be generated", func() {
+			_, err := Run(context.Background(), client, Options{
+				Rate:        1000,
+				RecordTypes: []string{"comment"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("stops when context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := Run(ctx, client, Options{Rate: 10})
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestGenerator(t *testing.T) {
+	Convey("Generator", t, func() {
+		generator := NewGenerator(0)
+
+		Convey("generates values by field type", func() {
+			record := generator.Record("note", []Field{
+				{"email", "string"},
+				{"count", "integer"},
+				{"done", "boolean"},
+				{"at", "datetime"},
+				{"location", "location"},
+				{"attachment", "asset"},
+				{"parent", "ref(note)"},
+			})
+			So(record.ID.Type, ShouldEqual, "note")
+			So(record.Data["email"], ShouldEndWith, "@example.com")
+			So(record.Data["count"], ShouldHaveSameTypeAs, 0)
+			So(record.Data["done"], ShouldHaveSameTypeAs, false)
+			So(record.Data["at"], ShouldHaveSameTypeAs, time.Time{})
+			So(record.Data["location"], ShouldHaveSameTypeAs, skydb.Location{})
+			So(record.Data, ShouldNotContainKey, "attachment")
+			So(record.Data, ShouldNotContainKey, "parent")
+		})
+
+		Convey("refers to saved records only", func() {
+			generator.Saved(skydb.NewRecordID("note", "saved"))
+			record := generator.Record("note", []Field{
+				{"parent", "ref(note)"},
+			})
+			So(record.Data["parent"], ShouldResemble, skydb.NewReference("note", "saved"))
+
+			m := recordMap(record)
+			So(m["_id"], ShouldEqual, record.ID.String())
+			So(m["parent"], ShouldResemble, map[string]interface{}{
+				"$type": "ref",
+				"$id":   skydb.NewRecordID("note", "saved"),
+			})
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package logging
 
 import (
+	"context"
 	"io"
 	"sync"
 
@@ -105,3 +106,36 @@ func LoggerEntry(name string) *logrus.Entry {
 		"logger": name,
 	})
 }
+
+type contextKey string
+
+var fieldsContextKey contextKey = "Fields"
+
+// ContextWithFields returns a copy of ctx carrying fields in addition to
+// those already carried by ctx. The fields are added to the entries
+// returned by WithContext, so that the logs made while serving a
+// request, such as its request ID, can be correlated.
+func ContextWithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := logrus.Fields{}
+	if parent, ok := ctx.Value(fieldsContextKey).(logrus.Fields); ok {
+		for key, value := range parent {
+			merged[key] = value
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, fieldsContextKey, merged)
+}
+
+// WithContext returns entry with the fields carried by ctx.
+func WithContext(ctx context.Context, entry *logrus.Entry) *logrus.Entry {
+	if ctx == nil {
+		return entry
+	}
+	fields, ok := ctx.Value(fieldsContextKey).(logrus.Fields)
+	if !ok {
+		return entry
+	}
+	return entry.WithFields(fields)
+}
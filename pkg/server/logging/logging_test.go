@@ -15,6 +15,7 @@
 package logging
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Sirupsen/logrus"
@@ -54,3 +55,25 @@ func TestLogger(t *testing.T) {
 		})
 	})
 }
+
+func TestContextFields(t *testing.T) {
+	Convey("context fields", t, func() {
+		entry := LoggerEntry("hello")
+
+		Convey("adds fields of context to entry", func() {
+			ctx := ContextWithFields(context.Background(), logrus.Fields{"request_id": "req1"})
+			ctx = ContextWithFields(ctx, logrus.Fields{"user_id": "user1"})
+
+			So(WithContext(ctx, entry).Data, ShouldResemble, logrus.Fields{
+				"logger":     "hello",
+				"request_id": "req1",
+				"user_id":    "user1",
+			})
+		})
+
+		Convey("keeps entry without context fields", func() {
+			So(WithContext(context.Background(), entry), ShouldPointTo, entry)
+			So(WithContext(nil, entry), ShouldPointTo, entry)
+		})
+	})
+}
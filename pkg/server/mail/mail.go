@@ -0,0 +1,155 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mail sends emails to users, such as the emails for resetting
+// forgotten passwords.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+var log = logging.LoggerEntry("mail")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a Message.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender sends messages through an SMTP server.
+type SMTPSender struct {
+	Host string
+	Port int
+
+	// Login and Password authenticate with the server if Login is not
+	// empty.
+	Login    string
+	Password string
+
+	// From is the address messages are sent from.
+	From string
+}
+
+// Send sends msg through the SMTP server.
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Login != "" {
+		auth = smtp.PlainAuth("", s.Login, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	return smtp.SendMail(addr, auth, s.From, []string{msg.To}, s.format(msg))
+}
+
+// format returns msg in the format of RFC 5322.
+func (s *SMTPSender) format(msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", timeNow().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.Write(bytes.Replace([]byte(msg.Body), []byte("\n"), []byte("\r\n"), -1))
+	return buf.Bytes()
+}
+
+var timeNow = time.Now
+
+// Template renders the subject and body of a Message.
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// NewTemplate parses the subject and body templates in the syntax of
+// text/template.
+func NewTemplate(subject string, body string) (*Template, error) {
+	subjectTemplate, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("mail: failed to parse subject template: %v", err)
+	}
+	bodyTemplate, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("mail: failed to parse body template: %v", err)
+	}
+	return &Template{
+		subject: subjectTemplate,
+		body:    bodyTemplate,
+	}, nil
+}
+
+// Render returns the message to the specified address, executing the
+// templates with data.
+func (t *Template) Render(to string, data interface{}) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
+
+// Mailer sends templated emails.
+//
+// A Mailer without Sender is disabled and sends no emails.
+type Mailer struct {
+	Sender Sender
+}
+
+// Enabled returns whether the Mailer sends emails.
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.Sender != nil
+}
+
+// Send renders t with data and sends the message to the specified
+// address.
+func (m *Mailer) Send(t *Template, to string, data interface{}) error {
+	if !m.Enabled() {
+		return fmt.Errorf("mail: no mail server is configured")
+	}
+
+	msg, err := t.Render(to, data)
+	if err != nil {
+		return fmt.Errorf("mail: failed to render message: %v", err)
+	}
+	if err := m.Sender.Send(msg); err != nil {
+		log.WithField("to", to).Errorf("Failed to send email: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeSender struct {
+	messages []Message
+	err      error
+}
+
+func (s *fakeSender) Send(msg Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestTemplate(t *testing.T) {
+	Convey("Template", t, func() {
+		Convey("renders subject and body", func() {
+			tmpl, err := NewTemplate("Hello {{.Name}}", "Your code is {{.Code}}.\n")
+			So(err, ShouldBeNil)
+
+			msg, err := tmpl.Render("john@example.com", map[string]string{
+				"Name": "John",
+				"Code": "1234",
+			})
+			So(err, ShouldBeNil)
+			So(msg, ShouldResemble, Message{
+				To:      "john@example.com",
+				Subject: "Hello John",
+				Body:    "Your code is 1234.\n",
+			})
+		})
+
+		Convey("rejects malformed template", func() {
+			_, err := NewTemplate("Hello {{.Name", "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMailer(t *testing.T) {
+	Convey("Mailer", t, func() {
+		tmpl, _ := NewTemplate("Hello", "{{.}}")
+
+		Convey("is disabled without sender", func() {
+			var nilMailer *Mailer
+			So(nilMailer.Enabled(), ShouldBeFalse)
+			So((&Mailer{}).Enabled(), ShouldBeFalse)
+			So((&Mailer{}).Send(tmpl, "john@example.com", "body"), ShouldNotBeNil)
+		})
+
+		Convey("sends rendered message", func() {
+			sender := &fakeSender{}
+			mailer := &Mailer{Sender: sender}
+			So(mailer.Enabled(), ShouldBeTrue)
+			So(mailer.Send(tmpl, "john@example.com", "body"), ShouldBeNil)
+			So(sender.messages, ShouldResemble, []Message{
+				{To: "john@example.com", Subject: "Hello", Body: "body"},
+			})
+		})
+
+		Convey("returns error of sender", func() {
+			mailer := &Mailer{Sender: &fakeSender{err: errors.New("connection refused")}}
+			So(mailer.Send(tmpl, "john@example.com", "body"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSMTPSenderFormat(t *testing.T) {
+	Convey("SMTPSender", t, func() {
+		timeNow = func() time.Time { return time.Date(2017, 2, 20, 8, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = time.Now
+		}()
+
+		sender := &SMTPSender{From: "noreply@example.com"}
+
+		Convey("formats message with headers", func() {
+			data := sender.format(Message{
+				To:      "john@example.com",
+				Subject: "Reset your password",
+				Body:    "Line 1\nLine 2\n",
+			})
+			So(string(data), ShouldEqual, "From: noreply@example.com\r\n"+
+				"To: john@example.com\r\n"+
+				"Subject: Reset your password\r\n"+
+				"Date: Mon, 20 Feb 2017 08:00:00 +0000\r\n"+
+				"MIME-Version: 1.0\r\n"+
+				"Content-Type: text/plain; charset=utf-8\r\n"+
+				"Content-Transfer-Encoding: 8bit\r\n"+
+				"\r\n"+
+				"Line 1\r\nLine 2\r\n")
+		})
+
+		Convey("encodes non-ASCII subject", func() {
+			data := sender.format(Message{
+				To:      "john@example.com",
+				Subject: "重設密碼",
+			})
+			So(string(data), ShouldContainSubstring, "Subject: =?utf-8?q?")
+		})
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maintenance puts the server into read-only or full
+// maintenance mode at runtime, for migrations and incident response.
+package maintenance
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Mode is the maintenance mode of the server.
+type Mode string
+
+const (
+	// Off serves all requests.
+	Off Mode = "off"
+
+	// ReadOnly serves only the ReadActions of Switch.
+	ReadOnly Mode = "read_only"
+
+	// Full serves no requests.
+	Full Mode = "full"
+)
+
+// ParseMode returns the Mode named s. An empty s is Off.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", Off:
+		return Off, nil
+	case ReadOnly, Full:
+		return Mode(s), nil
+	}
+	return Off, fmt.Errorf("unknown maintenance mode %q", s)
+}
+
+// DefaultReadActions are the actions which do not modify data, served
+// in ReadOnly mode.
+var DefaultReadActions = []string{
+	"auth:login",
+	"auth:refresh",
+	"me",
+	"record:fetch",
+	"record:query",
+	"record:rank",
+	"relation:query",
+	"user:query",
+	"device:list",
+	"subscription:fetch",
+	"subscription:fetch_all",
+	"quota:status",
+	"stats:fetch",
+	"stats:storage",
+	"schema:fetch",
+	"schema:export",
+	"chat:get_conversations",
+	"chat:get_messages",
+}
+
+// alwaysAdmitted are the actions served in any mode.
+var alwaysAdmitted = map[string]bool{
+	"_status:healthz": true,
+}
+
+// Switch is a router.Gatekeeper rejecting requests according to the
+// maintenance mode, which can be changed at runtime.
+type Switch struct {
+	// MasterKey identifies requests which are admitted in any mode, so
+	// that administrators can operate the server and turn maintenance
+	// mode off.
+	MasterKey string
+
+	// ReadActions are the actions served in ReadOnly mode.
+	ReadActions []string
+
+	mutex   sync.RWMutex
+	mode    Mode
+	message string
+}
+
+// Set changes the mode, with a message returned to rejected requests.
+// A default message is returned if message is empty.
+func (s *Switch) Set(mode Mode, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mode = mode
+	s.message = message
+}
+
+// Status returns the current mode and message.
+func (s *Switch) Status() (Mode, string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.mode == "" {
+		return Off, s.message
+	}
+	return s.mode, s.message
+}
+
+// Admit returns an UnderMaintenance error if the request is not served
+// in the current mode.
+func (s *Switch) Admit(payload *router.Payload) skyerr.Error {
+	mode, message := s.Status()
+	if mode == Off {
+		return nil
+	}
+
+	action := payload.RouteAction()
+	if alwaysAdmitted[action] || (s.MasterKey != "" && payload.APIKey() == s.MasterKey) {
+		return nil
+	}
+	if mode == ReadOnly && containsString(s.ReadActions, action) {
+		return nil
+	}
+
+	if message == "" {
+		if mode == ReadOnly {
+			message = "server is read-only for maintenance"
+		} else {
+			message = "server is under maintenance"
+		}
+	}
+	return skyerr.NewErrorWithInfo(skyerr.UnderMaintenance, message, map[string]interface{}{
+		"mode": string(mode),
+	})
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
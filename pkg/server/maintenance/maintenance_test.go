@@ -0,0 +1,84 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newPayload(action string, apiKey string) *router.Payload {
+	return &router.Payload{
+		Data: map[string]interface{}{
+			"action":  action,
+			"api_key": apiKey,
+		},
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	Convey("Switch", t, func() {
+		s := &Switch{
+			MasterKey:   "masterkey",
+			ReadActions: []string{"record:query"},
+		}
+
+		Convey("admits everything when off", func() {
+			mode, _ := s.Status()
+			So(mode, ShouldEqual, Off)
+			So(s.Admit(newPayload("record:save", "apikey")), ShouldBeNil)
+		})
+
+		Convey("admits read actions in read-only mode", func() {
+			s.Set(ReadOnly, "")
+			So(s.Admit(newPayload("record:query", "apikey")), ShouldBeNil)
+			So(s.Admit(newPayload("_status:healthz", "")), ShouldBeNil)
+
+			err := s.Admit(newPayload("record:save", "apikey"))
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.UnderMaintenance)
+			So(err.Message(), ShouldEqual, "server is read-only for maintenance")
+			So(err.Info(), ShouldResemble, map[string]interface{}{"mode": "read_only"})
+		})
+
+		Convey("admits nothing but master key in full mode", func() {
+			s.Set(Full, "back at 10:00 UTC")
+			So(s.Admit(newPayload("record:save", "masterkey")), ShouldBeNil)
+			So(s.Admit(newPayload("_status:healthz", "")), ShouldBeNil)
+
+			err := s.Admit(newPayload("record:query", "apikey"))
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, "back at 10:00 UTC")
+		})
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	Convey("ParseMode", t, func() {
+		mode, err := ParseMode("")
+		So(err, ShouldBeNil)
+		So(mode, ShouldEqual, Off)
+
+		mode, err = ParseMode("read_only")
+		So(err, ShouldBeNil)
+		So(mode, ShouldEqual, ReadOnly)
+
+		_, err = ParseMode("partial")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,451 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics collects counters, gauges and histograms of skygear server
+// and exports them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default upper bounds of Histogram buckets in
+// seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// OverflowLabelValue replaces the label values of series observed after
+// a metric reaches its maximum number of series.
+const OverflowLabelValue = "_other"
+
+// Collector is a metric that can be exported by a Registry.
+type Collector interface {
+	Name() string
+	WriteTo(w io.Writer) error
+}
+
+// configurable is implemented by the metrics of this package to receive
+// the options of the Registry they are registered with.
+type configurable interface {
+	configure(constLabels []string, maxSeries int)
+}
+
+// Registry exports a collection of Collectors.
+type Registry struct {
+	mutex       sync.RWMutex
+	collectors  map[string]Collector
+	constLabels []string
+	maxSeries   int
+}
+
+// DefaultRegistry is the Registry where metrics of skygear server are
+// registered.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a Registry ready for use.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]Collector{},
+	}
+}
+
+// Register adds the Collector to the registry. It panics if a Collector
+// of the same name is already registered.
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", c.Name()))
+	}
+	r.collectors[c.Name()] = c
+	if metric, ok := c.(configurable); ok {
+		metric.configure(r.constLabels, r.maxSeries)
+	}
+}
+
+// SetConstLabels sets labels exported with every series of the
+// registered metrics, such as the name of the app served, so that
+// metrics of servers sharing a Prometheus can be told apart.
+func (r *Registry) SetConstLabels(labels map[string]string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	constLabels := []string{}
+	for _, name := range names {
+		constLabels = append(constLabels, name, labels[name])
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.constLabels = constLabels
+	r.configureAll()
+}
+
+// SetMaxSeries limits the number of series of each registered metric,
+// so that labels with values supplied by clients, such as record types,
+// cannot grow the exported metrics without bound. Once a metric has n
+// series, new label values are counted in a series with all labels set
+// to OverflowLabelValue. Zero means no limit.
+func (r *Registry) SetMaxSeries(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxSeries = n
+	r.configureAll()
+}
+
+func (r *Registry) configureAll() {
+	for _, c := range r.collectors {
+		if metric, ok := c.(configurable); ok {
+			metric.configure(r.constLabels, r.maxSeries)
+		}
+	}
+}
+
+// WriteTo writes all registered metrics to w in the Prometheus text
+// exposition format.
+func (r *Registry) WriteTo(w io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+
+	for _, c := range collectors {
+		if err := c.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+	if err := r.WriteTo(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// metricVec holds the series of a metric keyed by label values.
+type metricVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	optionsMutex sync.RWMutex
+	constLabels  []string
+	maxSeries    int
+}
+
+func (v *metricVec) configure(constLabels []string, maxSeries int) {
+	v.optionsMutex.Lock()
+	defer v.optionsMutex.Unlock()
+	v.constLabels = constLabels
+	v.maxSeries = maxSeries
+}
+
+func (v *metricVec) Name() string {
+	return v.name
+}
+
+func (v *metricVec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			v.name, len(v.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// limit returns the key and label values of the series to be created
+// for labelValues when the metric already has count series, which is
+// the overflow series if the metric has reached its maximum.
+func (v *metricVec) limit(key string, labelValues []string, count int) (string, []string) {
+	v.optionsMutex.RLock()
+	maxSeries := v.maxSeries
+	v.optionsMutex.RUnlock()
+
+	if maxSeries <= 0 || count < maxSeries {
+		return key, labelValues
+	}
+
+	overflowValues := make([]string, len(labelValues))
+	for i := range overflowValues {
+		overflowValues[i] = OverflowLabelValue
+	}
+	return v.key(overflowValues), overflowValues
+}
+
+func (v *metricVec) writeHeader(w io.Writer, metricType string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, metricType)
+	return err
+}
+
+// labelString formats the label pairs after the constant labels, with
+// extra name-value pairs appended.
+func (v *metricVec) labelString(labelValues []string, extra ...string) string {
+	v.optionsMutex.RLock()
+	constLabels := v.constLabels
+	v.optionsMutex.RUnlock()
+
+	pairs := []string{}
+	for i := 0; i+1 < len(constLabels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", constLabels[i], strconv.Quote(constLabels[i+1])))
+	}
+	for i, name := range v.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extra[i], strconv.Quote(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value partitioned by labels.
+type Counter struct {
+	metricVec
+	mutex  sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter returns a Counter with the specified label names.
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{
+		metricVec: metricVec{name: name, help: help, labelNames: labelNames},
+		series:    map[string]*counterSeries{},
+	}
+}
+
+// Inc increments the counter of the label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter of the label values by delta.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		key, labelValues = c.limit(key, labelValues, len(c.series))
+		if s, ok = c.series[key]; !ok {
+			s = &counterSeries{labelValues: labelValues}
+			c.series[key] = s
+		}
+	}
+	s.value += delta
+}
+
+// Value returns the counter of the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if s, ok := c.series[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// WriteTo implements Collector.
+func (c *Counter) WriteTo(w io.Writer) error {
+	return c.writeTo(w, "counter")
+}
+
+func (c *Counter) writeTo(w io.Writer, metricType string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.writeHeader(w, metricType); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labelValues), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a value that can go up and down partitioned by labels.
+type Gauge struct {
+	Counter
+}
+
+// NewGauge returns a Gauge with the specified label names.
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{Counter{
+		metricVec: metricVec{name: name, help: help, labelNames: labelNames},
+		series:    map[string]*counterSeries{},
+	}}
+}
+
+// Set sets the gauge of the label values to value.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.series[key]; !ok {
+		key, labelValues = g.limit(key, labelValues, len(g.series))
+	}
+	g.series[key] = &counterSeries{labelValues: labelValues, value: value}
+}
+
+// WriteTo implements Collector.
+func (g *Gauge) WriteTo(w io.Writer) error {
+	return g.writeTo(w, "gauge")
+}
+
+// Histogram counts observations into buckets partitioned by labels.
+type Histogram struct {
+	metricVec
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues  []string
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// NewHistogram returns a Histogram with DefaultBuckets and the specified
+// label names.
+func NewHistogram(name string, help string, labelNames ...string) *Histogram {
+	return &Histogram{
+		metricVec: metricVec{name: name, help: help, labelNames: labelNames},
+		buckets:   DefaultBuckets,
+		series:    map[string]*histogramSeries{},
+	}
+}
+
+// Observe adds an observation of the label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		key, labelValues = h.limit(key, labelValues, len(h.series))
+		if s, ok = h.series[key]; !ok {
+			s = &histogramSeries{
+				labelValues:  labelValues,
+				bucketCounts: make([]uint64, len(h.buckets)),
+			}
+			h.series[key] = s
+		}
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns the number of observations of the label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// WriteTo implements Collector.
+func (h *Histogram) WriteTo(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upperBound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name,
+				h.labelString(s.labelValues, "le", formatFloat(upperBound)),
+				s.bucketCounts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labelString(s.labelValues, "le", "+Inf"), s.count,
+			h.name, h.labelString(s.labelValues), formatFloat(s.sum),
+			h.name, h.labelString(s.labelValues), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch series := m.(type) {
+	case map[string]*counterSeries:
+		for key := range series {
+			keys = append(keys, key)
+		}
+	case map[string]*histogramSeries:
+		for key := range series {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
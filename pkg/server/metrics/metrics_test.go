@@ -0,0 +1,176 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Registry", t, func() {
+		registry := NewRegistry()
+
+		Convey("exports counter", func() {
+			counter := NewCounter("requests_total", "Number of requests.", "action")
+			registry.Register(counter)
+			counter.Inc("record:save")
+			counter.Add(2, "record:save")
+			counter.Inc("record:fetch")
+			So(counter.Value("record:save"), ShouldEqual, 3)
+
+			buf := bytes.Buffer{}
+			So(registry.WriteTo(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{action="record:fetch"} 1
+requests_total{action="record:save"} 3
+`)
+		})
+
+		Convey("exports histogram", func() {
+			histogram := NewHistogram("duration_seconds", "Duration.", "plugin")
+			histogram.buckets = []float64{0.1, 1}
+			registry.Register(histogram)
+			histogram.Observe(0.05, "cat")
+			histogram.Observe(0.5, "cat")
+			histogram.Observe(5, "cat")
+			So(histogram.Count("cat"), ShouldEqual, 3)
+
+			buf := bytes.Buffer{}
+			So(registry.WriteTo(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{plugin="cat",le="0.1"} 1
+duration_seconds_bucket{plugin="cat",le="1"} 2
+duration_seconds_bucket{plugin="cat",le="+Inf"} 3
+duration_seconds_sum{plugin="cat"} 5.55
+duration_seconds_count{plugin="cat"} 3
+`)
+		})
+
+		Convey("exports gauge", func() {
+			gauge := NewGauge("connected", "Whether it is connected.")
+			registry.Register(gauge)
+			gauge.Set(1)
+			gauge.Set(0)
+			gauge.Add(2)
+			So(gauge.Value(), ShouldEqual, 2)
+
+			buf := bytes.Buffer{}
+			So(registry.WriteTo(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP connected Whether it is connected.
+# TYPE connected gauge
+connected 2
+`)
+		})
+
+		Convey("exports constant labels", func() {
+			counter := NewCounter("requests_total", "Number of requests.", "action")
+			registry.Register(counter)
+			registry.SetConstLabels(map[string]string{"app": "myapp", "zone": "a"})
+			gauge := NewGauge("connected", "Whether it is connected.")
+			registry.Register(gauge)
+			counter.Inc("record:save")
+			gauge.Set(1)
+
+			buf := bytes.Buffer{}
+			So(registry.WriteTo(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP connected Whether it is connected.
+# TYPE connected gauge
+connected{app="myapp",zone="a"} 1
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{app="myapp",zone="a",action="record:save"} 1
+`)
+		})
+
+		Convey("limits number of series", func() {
+			counter := NewCounter("records_total", "Number of records.", "record_type", "operation")
+			histogram := NewHistogram("duration_seconds", "Duration.", "action")
+			registry.Register(counter)
+			registry.Register(histogram)
+			registry.SetMaxSeries(2)
+
+			counter.Inc("note", "create")
+			counter.Inc("comment", "create")
+			counter.Inc("spam1", "create")
+			counter.Inc("spam2", "delete")
+			counter.Inc("note", "create")
+			So(counter.Value("note", "create"), ShouldEqual, 2)
+			So(counter.Value("comment", "create"), ShouldEqual, 1)
+			So(counter.Value("spam1", "create"), ShouldEqual, 0)
+			So(counter.Value(OverflowLabelValue, OverflowLabelValue), ShouldEqual, 2)
+
+			histogram.Observe(1, "record:save")
+			histogram.Observe(1, "record:fetch")
+			histogram.Observe(1, "record:query")
+			So(histogram.Count("record:query"), ShouldEqual, 0)
+			So(histogram.Count(OverflowLabelValue), ShouldEqual, 1)
+		})
+
+		Convey("serves metrics over HTTP", func() {
+			registry.Register(NewCounter("requests_total", "Number of requests."))
+
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metrics", nil)
+			registry.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+			So(resp.Body.String(), ShouldContainSubstring, "# TYPE requests_total counter")
+		})
+
+		Convey("panics on duplicated name", func() {
+			registry.Register(NewCounter("requests_total", ""))
+			So(func() {
+				registry.Register(NewCounter("requests_total", ""))
+			}, ShouldPanic)
+		})
+
+		Convey("panics on mismatched label values", func() {
+			counter := NewCounter("requests_total", "", "action")
+			So(func() {
+				counter.Inc()
+			}, ShouldPanic)
+		})
+	})
+}
+
+func TestTrace(t *testing.T) {
+	Convey("Trace", t, func() {
+		Convey("collects spans from context", func() {
+			ctx, trace := WithTrace(context.Background())
+			TraceFromContext(ctx).AddSpan(Span{Name: "plugin:hook", Duration: time.Second})
+			So(trace.Spans(), ShouldResemble, []Span{
+				{Name: "plugin:hook", Duration: time.Second},
+			})
+		})
+
+		Convey("ignores spans without trace", func() {
+			trace := TraceFromContext(context.Background())
+			So(trace, ShouldBeNil)
+			So(func() {
+				trace.AddSpan(Span{Name: "plugin:hook"})
+			}, ShouldNotPanic)
+			So(trace.Spans(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type traceContextKey struct{}
+
+// Span records a timed operation happened while serving a request.
+type Span struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Duration time.Duration     `json:"duration"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Trace collects Spans of a request. It is safe for concurrent use.
+type Trace struct {
+	mutex sync.Mutex
+	spans []Span
+}
+
+// WithTrace returns a copy of ctx carrying a new Trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	trace := &Trace{}
+	return context.WithValue(ctx, traceContextKey{}, trace), trace
+}
+
+// TraceFromContext returns the Trace carried by ctx, or nil if there is
+// none.
+func TraceFromContext(ctx context.Context) *Trace {
+	if ctx == nil {
+		return nil
+	}
+	trace, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return trace
+}
+
+// AddSpan appends a Span to the Trace. It is a no-op on a nil Trace.
+func (t *Trace) AddSpan(span Span) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = append(t.spans, span)
+}
+
+// Spans returns the Spans appended so far.
+func (t *Trace) Spans() []Span {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	spans := make([]Span, len(t.spans))
+	copy(spans, t.spans)
+	return spans
+}
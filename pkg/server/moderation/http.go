@@ -0,0 +1,90 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPModerator delegates moderation to an external moderation API.
+//
+// Text is POSTed to URL as {"content": "..."}, and assets are POSTed as is
+// with their content type. The API responds with {"verdict": "..."}, where
+// verdict is one of approved, pending and rejected.
+type HTTPModerator struct {
+	URL    string
+	Client *http.Client
+}
+
+type httpModeratorResponse struct {
+	Verdict Verdict `json:"verdict"`
+}
+
+// ModerateText implements Moderator.
+func (m *HTTPModerator) ModerateText(ctx context.Context, text string) (Verdict, error) {
+	body, err := json.Marshal(map[string]string{"content": text})
+	if err != nil {
+		return "", err
+	}
+	return m.post(ctx, "application/json", bytes.NewReader(body))
+}
+
+// ModerateAsset implements Moderator.
+func (m *HTTPModerator) ModerateAsset(ctx context.Context, contentType string, r io.Reader) (Verdict, error) {
+	return m.post(ctx, contentType, r)
+}
+
+func (m *HTTPModerator) post(ctx context.Context, contentType string, body io.Reader) (Verdict, error) {
+	req, err := http.NewRequest("POST", m.URL, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("moderation: unexpected status code %d", resp.StatusCode)
+	}
+
+	var moderatorResp httpModeratorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&moderatorResp); err != nil {
+		return "", err
+	}
+
+	switch moderatorResp.Verdict {
+	case Approved, Pending, Rejected:
+		return moderatorResp.Verdict, nil
+	default:
+		return "", fmt.Errorf("moderation: unknown verdict %q", moderatorResp.Verdict)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package moderation
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPModerator(t *testing.T) {
+	Convey("HTTPModerator", t, func() {
+		var contentType, body string
+		response := `{"verdict": "pending"}`
+		statusCode := http.StatusOK
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(statusCode)
+			w.Write([]byte(response))
+		}))
+		defer testServer.Close()
+
+		moderator := &HTTPModerator{URL: testServer.URL}
+
+		Convey("moderates text", func() {
+			verdict, err := moderator.ModerateText(nil, "hello")
+			So(err, ShouldBeNil)
+			So(verdict, ShouldEqual, Pending)
+			So(contentType, ShouldEqual, "application/json")
+			So(body, ShouldEqual, `{"content":"hello"}`)
+		})
+
+		Convey("moderates asset", func() {
+			response = `{"verdict": "rejected"}`
+			verdict, err := moderator.ModerateAsset(nil, "image/png", strings.NewReader("png"))
+			So(err, ShouldBeNil)
+			So(verdict, ShouldEqual, Rejected)
+			So(contentType, ShouldEqual, "image/png")
+			So(body, ShouldEqual, "png")
+		})
+
+		Convey("errors on unknown verdict", func() {
+			response = `{"verdict": "maybe"}`
+			_, err := moderator.ModerateText(nil, "hello")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("errors on unsuccessful response", func() {
+			statusCode = http.StatusInternalServerError
+			_, err := moderator.ModerateText(nil, "hello")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
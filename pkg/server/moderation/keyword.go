@@ -0,0 +1,50 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package moderation
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// KeywordModerator matches text against a list of keywords
+// case-insensitively.
+type KeywordModerator struct {
+	Keywords []string
+
+	// Verdict is returned for text containing any of the keywords,
+	// Pending if not specified.
+	Verdict Verdict
+}
+
+// ModerateText implements Moderator.
+func (m *KeywordModerator) ModerateText(ctx context.Context, text string) (Verdict, error) {
+	text = strings.ToLower(text)
+	for _, keyword := range m.Keywords {
+		if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+			if m.Verdict == "" {
+				return Pending, nil
+			}
+			return m.Verdict, nil
+		}
+	}
+	return Approved, nil
+}
+
+// ModerateAsset implements Moderator. Assets are always approved.
+func (m *KeywordModerator) ModerateAsset(ctx context.Context, contentType string, r io.Reader) (Verdict, error) {
+	return Approved, nil
+}
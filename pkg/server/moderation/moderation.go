@@ -0,0 +1,326 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package moderation screens user content on record saves and asset
+// uploads.
+//
+// Moderated records carry their moderation status in a record field.
+// Records pending review or rejected are hidden from users other than
+// their owners until approved with the master key.
+package moderation
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+var log = logging.LoggerEntry("moderation")
+
+// DefaultStatusKey is the record field storing the moderation status if
+// Pipeline.StatusKey is not specified.
+const DefaultStatusKey = "moderation_status"
+
+// Verdict is the result of moderating a piece of content.
+type Verdict string
+
+// A list of Verdict, ordered by severity.
+const (
+	Approved Verdict = "approved"
+	Pending  Verdict = "pending"
+	Rejected Verdict = "rejected"
+)
+
+func (v Verdict) severity() int {
+	switch v {
+	case Approved:
+		return 0
+	case Pending:
+		return 1
+	default:
+		return 2
+	}
+}
+
+type reviewContextKey struct{}
+
+// WithReview returns a copy of ctx denoting a save reviewing records with
+// verdict. The moderation status of the records saved with the context is
+// set to verdict instead of being moderated.
+func WithReview(ctx context.Context, verdict Verdict) context.Context {
+	return context.WithValue(ctx, reviewContextKey{}, verdict)
+}
+
+func reviewVerdict(ctx context.Context) (Verdict, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	verdict, ok := ctx.Value(reviewContextKey{}).(Verdict)
+	return verdict, ok
+}
+
+// Moderator decides whether a piece of content is acceptable.
+type Moderator interface {
+	ModerateText(ctx context.Context, text string) (Verdict, error)
+	ModerateAsset(ctx context.Context, contentType string, r io.Reader) (Verdict, error)
+}
+
+// Pipeline runs content through a list of Moderators. The most severe
+// verdict returned by the Moderators is taken.
+type Pipeline struct {
+	// Fields maps a record type to its fields to be moderated.
+	Fields map[string][]string
+
+	// StatusKey is the record field storing the moderation status.
+	StatusKey string
+
+	// AssetContentTypes are prefixes of content type of assets to be
+	// moderated, an empty list moderates no assets.
+	AssetContentTypes []string
+
+	Moderators []Moderator
+}
+
+func (p *Pipeline) statusKey() string {
+	if p.StatusKey == "" {
+		return DefaultStatusKey
+	}
+	return p.StatusKey
+}
+
+// RecordTypes returns the record types to be moderated.
+func (p *Pipeline) RecordTypes() []string {
+	recordTypes := []string{}
+	for recordType := range p.Fields {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	return recordTypes
+}
+
+// IsModerated returns whether records of recordType are moderated.
+func (p *Pipeline) IsModerated(recordType string) bool {
+	return len(p.Fields[recordType]) > 0
+}
+
+// ModerateText returns the verdict of text.
+//
+// A Moderator failing to moderate is logged and the text is held for
+// review.
+func (p *Pipeline) ModerateText(ctx context.Context, text string) Verdict {
+	verdict := Approved
+	for _, moderator := range p.Moderators {
+		v, err := moderator.ModerateText(ctx, text)
+		if err != nil {
+			log.WithField("err", err).Errorln("Failed to moderate text")
+			v = Pending
+		}
+		if v.severity() > verdict.severity() {
+			verdict = v
+		}
+	}
+	return verdict
+}
+
+// ModerateAsset returns the verdict of an asset. Assets not matching
+// AssetContentTypes are approved.
+//
+// A Moderator failing to moderate is logged and the asset is held for
+// review.
+func (p *Pipeline) ModerateAsset(ctx context.Context, contentType string, r io.ReadSeeker) Verdict {
+	if !p.isModeratedContentType(contentType) {
+		return Approved
+	}
+
+	verdict := Approved
+	for _, moderator := range p.Moderators {
+		if _, err := r.Seek(0, 0); err != nil {
+			log.WithField("err", err).Errorln("Failed to rewind asset")
+			return Pending
+		}
+
+		v, err := moderator.ModerateAsset(ctx, contentType, r)
+		if err != nil {
+			log.WithField("err", err).Errorln("Failed to moderate asset")
+			v = Pending
+		}
+		if v.severity() > verdict.severity() {
+			verdict = v
+		}
+	}
+	return verdict
+}
+
+func (p *Pipeline) isModeratedContentType(contentType string) bool {
+	for _, prefix := range p.AssetContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// BeforeSave implements hook.Func and is registered as a beforeSave hook
+// of the moderated record types.
+//
+// The moderated fields changed by the save are moderated, and the
+// moderation status of the record is updated with the verdict. The status
+// cannot be modified by the save itself. A rejected save fails with
+// an InvalidArgument error.
+//
+// A save with a context returned by WithReview sets the status to the
+// verdict of the review without moderating the record.
+func (p *Pipeline) BeforeSave(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
+	if verdict, ok := reviewVerdict(ctx); ok {
+		p.SetStatus(record, verdict)
+		return nil
+	}
+
+	key := p.statusKey()
+
+	var status interface{}
+	if originalRecord != nil {
+		status = originalRecord.Data[key]
+	}
+	if status == nil {
+		delete(record.Data, key)
+	} else {
+		record.Data[key] = status
+	}
+
+	changedFields := []string{}
+	texts := []string{}
+	for _, field := range p.Fields[record.ID.Type] {
+		text, ok := record.Data[field].(string)
+		if !ok {
+			continue
+		}
+		if originalRecord != nil && originalRecord.Data[field] == text {
+			continue
+		}
+		changedFields = append(changedFields, field)
+		texts = append(texts, text)
+	}
+
+	if len(texts) == 0 {
+		return nil
+	}
+
+	verdict := Approved
+	for _, text := range texts {
+		v := p.ModerateText(ctx, text)
+		if v.severity() > verdict.severity() {
+			verdict = v
+		}
+	}
+
+	if verdict == Rejected {
+		return skyerr.NewInvalidArgument("content is rejected by moderation", changedFields)
+	}
+
+	if record.Data == nil {
+		record.Data = skydb.Data{}
+	}
+	record.Data[key] = string(verdict)
+	return nil
+}
+
+// IsHidden returns whether record is hidden from user because it is
+// pending review or rejected. A record is never hidden from its owner.
+func (p *Pipeline) IsHidden(record *skydb.Record, user *skydb.UserInfo) bool {
+	if !p.IsModerated(record.ID.Type) {
+		return false
+	}
+	if user != nil && record.OwnerID == user.ID {
+		return false
+	}
+
+	status, _ := record.Data[p.statusKey()].(string)
+	return Verdict(status) == Pending || Verdict(status) == Rejected
+}
+
+// FilterQuery restricts query to records visible to query.ViewAsUser,
+// which includes the records owned by the user.
+//
+// The query is left untouched if the record type is not moderated, or if
+// no records of the type have been moderated yet.
+func (p *Pipeline) FilterQuery(ctx context.Context, db skydb.Database, query *skydb.Query) error {
+	if !p.IsModerated(query.Type) {
+		return nil
+	}
+
+	key := p.statusKey()
+	schema, err := db.GetSchema(ctx, query.Type)
+	if err != nil {
+		return err
+	}
+	if _, ok := schema[key]; !ok {
+		return nil
+	}
+
+	visible := skydb.Predicate{
+		Operator: skydb.Or,
+		Children: []interface{}{
+			skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: key},
+					skydb.Expression{Type: skydb.Literal, Value: nil},
+				},
+			},
+			skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: key},
+					skydb.Expression{Type: skydb.Literal, Value: string(Approved)},
+				},
+			},
+		},
+	}
+	if query.ViewAsUser != nil {
+		visible.Children = append(visible.Children, skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "_owner_id"},
+				skydb.Expression{
+					Type:  skydb.Literal,
+					Value: skydb.NewReference(db.UserRecordType(), query.ViewAsUser.ID),
+				},
+			},
+		})
+	}
+
+	if query.Predicate.IsEmpty() {
+		query.Predicate = visible
+	} else {
+		query.Predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{query.Predicate, visible},
+		}
+	}
+	return nil
+}
+
+// SetStatus sets the moderation status of record to verdict.
+func (p *Pipeline) SetStatus(record *skydb.Record, verdict Verdict) {
+	if record.Data == nil {
+		record.Data = skydb.Data{}
+	}
+	record.Data[p.statusKey()] = string(verdict)
+}
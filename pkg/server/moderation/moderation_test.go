@@ -0,0 +1,266 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package moderation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type stubModerator struct {
+	verdict Verdict
+	err     error
+	texts   []string
+	assets  []string
+}
+
+func (m *stubModerator) ModerateText(ctx context.Context, text string) (Verdict, error) {
+	m.texts = append(m.texts, text)
+	return m.verdict, m.err
+}
+
+func (m *stubModerator) ModerateAsset(ctx context.Context, contentType string, r io.Reader) (Verdict, error) {
+	b, _ := ioutil.ReadAll(r)
+	m.assets = append(m.assets, string(b))
+	return m.verdict, m.err
+}
+
+func TestKeywordModerator(t *testing.T) {
+	Convey("KeywordModerator", t, func() {
+		moderator := &KeywordModerator{Keywords: []string{"Spam"}}
+
+		Convey("holds text containing keyword for review", func() {
+			verdict, err := moderator.ModerateText(nil, "buy SPAM now")
+			So(err, ShouldBeNil)
+			So(verdict, ShouldEqual, Pending)
+		})
+
+		Convey("returns specified verdict", func() {
+			moderator.Verdict = Rejected
+			verdict, _ := moderator.ModerateText(nil, "spam")
+			So(verdict, ShouldEqual, Rejected)
+		})
+
+		Convey("approves other text", func() {
+			verdict, err := moderator.ModerateText(nil, "hello world")
+			So(err, ShouldBeNil)
+			So(verdict, ShouldEqual, Approved)
+		})
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	Convey("Pipeline", t, func() {
+		stub := &stubModerator{verdict: Approved}
+		pipeline := &Pipeline{
+			Fields: map[string][]string{
+				"note": []string{"title", "content"},
+			},
+			AssetContentTypes: []string{"image/"},
+			Moderators: []Moderator{
+				&KeywordModerator{Keywords: []string{"spam"}, Verdict: Rejected},
+				&KeywordModerator{Keywords: []string{"maybe"}},
+				stub,
+			},
+		}
+
+		Convey("takes the most severe verdict", func() {
+			So(pipeline.ModerateText(nil, "hello"), ShouldEqual, Approved)
+			So(pipeline.ModerateText(nil, "maybe"), ShouldEqual, Pending)
+			So(pipeline.ModerateText(nil, "maybe spam"), ShouldEqual, Rejected)
+		})
+
+		Convey("holds text for review on moderator error", func() {
+			stub.err = errors.New("timeout")
+			So(pipeline.ModerateText(nil, "hello"), ShouldEqual, Pending)
+		})
+
+		Convey("moderates assets of specified content types", func() {
+			So(pipeline.ModerateAsset(nil, "text/plain", strings.NewReader("cat")), ShouldEqual, Approved)
+			So(stub.assets, ShouldBeEmpty)
+
+			stub.verdict = Rejected
+			So(pipeline.ModerateAsset(nil, "image/png", strings.NewReader("cat")), ShouldEqual, Rejected)
+			So(stub.assets, ShouldResemble, []string{"cat"})
+		})
+
+		Convey("before save", func() {
+			record := &skydb.Record{
+				ID:   skydb.NewRecordID("note", "1"),
+				Data: skydb.Data{"title": "maybe", "content": "hello"},
+			}
+
+			Convey("sets status of new record", func() {
+				So(pipeline.BeforeSave(nil, record, nil), ShouldBeNil)
+				So(record.Data["moderation_status"], ShouldEqual, "pending")
+				So(stub.texts, ShouldResemble, []string{"maybe", "hello"})
+			})
+
+			Convey("moderates changed fields only", func() {
+				original := &skydb.Record{
+					ID: record.ID,
+					Data: skydb.Data{
+						"title":             "maybe",
+						"content":           "world",
+						"moderation_status": "approved",
+					},
+				}
+				So(pipeline.BeforeSave(nil, record, original), ShouldBeNil)
+				So(record.Data["moderation_status"], ShouldEqual, "approved")
+				So(stub.texts, ShouldResemble, []string{"hello"})
+			})
+
+			Convey("keeps status if moderated fields are unchanged", func() {
+				original := &skydb.Record{
+					ID: record.ID,
+					Data: skydb.Data{
+						"title":             "maybe",
+						"content":           "hello",
+						"moderation_status": "pending",
+					},
+				}
+				record.Data["moderation_status"] = "approved"
+				So(pipeline.BeforeSave(nil, record, original), ShouldBeNil)
+				So(record.Data["moderation_status"], ShouldEqual, "pending")
+				So(stub.texts, ShouldBeEmpty)
+			})
+
+			Convey("sets status of reviewed record", func() {
+				original := &skydb.Record{
+					ID: record.ID,
+					Data: skydb.Data{
+						"title":             "maybe",
+						"content":           "hello",
+						"moderation_status": "pending",
+					},
+				}
+				ctx := WithReview(context.Background(), Approved)
+				So(pipeline.BeforeSave(ctx, record, original), ShouldBeNil)
+				So(record.Data["moderation_status"], ShouldEqual, "approved")
+				So(stub.texts, ShouldBeEmpty)
+			})
+
+			Convey("rejects record", func() {
+				record.Data["content"] = "spam"
+				err := pipeline.BeforeSave(nil, record, nil)
+				So(err, ShouldNotBeNil)
+				So(err.Code(), ShouldEqual, skyerr.InvalidArgument)
+				So(err.Info(), ShouldResemble, map[string]interface{}{
+					"arguments": []string{"title", "content"},
+				})
+			})
+		})
+
+		Convey("hides pending and rejected records", func() {
+			record := &skydb.Record{
+				ID:      skydb.NewRecordID("note", "1"),
+				OwnerID: "owner",
+				Data:    skydb.Data{},
+			}
+			So(pipeline.IsHidden(record, nil), ShouldBeFalse)
+
+			pipeline.SetStatus(record, Pending)
+			So(pipeline.IsHidden(record, nil), ShouldBeTrue)
+			So(pipeline.IsHidden(record, &skydb.UserInfo{ID: "other"}), ShouldBeTrue)
+			So(pipeline.IsHidden(record, &skydb.UserInfo{ID: "owner"}), ShouldBeFalse)
+
+			pipeline.SetStatus(record, Rejected)
+			So(pipeline.IsHidden(record, nil), ShouldBeTrue)
+
+			pipeline.SetStatus(record, Approved)
+			So(pipeline.IsHidden(record, nil), ShouldBeFalse)
+
+			record.ID.Type = "comment"
+			pipeline.SetStatus(record, Pending)
+			So(pipeline.IsHidden(record, nil), ShouldBeFalse)
+		})
+
+		Convey("filters query", func() {
+			db := skydbtest.NewMapDB()
+			query := &skydb.Query{Type: "note"}
+
+			Convey("untouched if no records are moderated yet", func() {
+				db.Extend(context.Background(), "note", skydb.RecordSchema{
+					"title": skydb.FieldType{Type: skydb.TypeString},
+				})
+				So(pipeline.FilterQuery(context.Background(), db, query), ShouldBeNil)
+				So(query.Predicate.IsEmpty(), ShouldBeTrue)
+			})
+
+			Convey("to visible records", func() {
+				db.Extend(context.Background(), "note", skydb.RecordSchema{
+					"moderation_status": skydb.FieldType{Type: skydb.TypeString},
+				})
+				query.Predicate = skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "title"},
+						skydb.Expression{Type: skydb.Literal, Value: "hello"},
+					},
+				}
+				So(pipeline.FilterQuery(context.Background(), db, query), ShouldBeNil)
+				So(query.Predicate.Operator, ShouldEqual, skydb.And)
+				So(query.Predicate.Children[1], ShouldResemble, skydb.Predicate{
+					Operator: skydb.Or,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{
+								skydb.Expression{Type: skydb.KeyPath, Value: "moderation_status"},
+								skydb.Expression{Type: skydb.Literal, Value: nil},
+							},
+						},
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{
+								skydb.Expression{Type: skydb.KeyPath, Value: "moderation_status"},
+								skydb.Expression{Type: skydb.Literal, Value: "approved"},
+							},
+						},
+					},
+				})
+			})
+
+			Convey("to visible records and records owned by the user", func() {
+				db.Extend(context.Background(), "note", skydb.RecordSchema{
+					"moderation_status": skydb.FieldType{Type: skydb.TypeString},
+				})
+				query.ViewAsUser = &skydb.UserInfo{ID: "owner"}
+				So(pipeline.FilterQuery(context.Background(), db, query), ShouldBeNil)
+				So(query.Predicate.Operator, ShouldEqual, skydb.Or)
+				So(query.Predicate.Children, ShouldHaveLength, 3)
+				So(query.Predicate.Children[2], ShouldResemble, skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "_owner_id"},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: skydb.NewReference("user", "owner"),
+						},
+					},
+				})
+			})
+		})
+	})
+}
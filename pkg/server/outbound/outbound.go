@@ -0,0 +1,195 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbound configures the HTTP clients used to reach external
+// services, such as asset stores, push gateways and identity providers.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config configures the proxy, trusted certificate authorities and
+// timeout of outbound requests. The zero Config behaves like
+// http.DefaultTransport.
+type Config struct {
+	// ProxyURL is the proxy requests are sent through. If empty, the
+	// proxy is taken from the HTTP_PROXY and HTTPS_PROXY environment
+	// variables.
+	ProxyURL string
+
+	// NoProxy lists hosts connected to directly instead of through
+	// ProxyURL. A host starting with a dot also matches its subdomains.
+	// Loopback addresses are always connected to directly.
+	NoProxy []string
+
+	// CABundle is the path to a PEM file of certificate authorities
+	// trusted in addition to those of the system.
+	CABundle string
+
+	// Timeout limits the time to connect, to complete the TLS handshake
+	// and to wait for the response headers of each request.
+	Timeout time.Duration
+}
+
+// Enabled returns true if c differs from the zero Config.
+func (c Config) Enabled() bool {
+	return c.ProxyURL != "" || len(c.NoProxy) > 0 || c.CABundle != "" || c.Timeout > 0
+}
+
+// NewTransport returns a new http.Transport configured by c.
+func (c Config) NewTransport() (*http.Transport, error) {
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if err := c.Configure(transport); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// NewClient returns a new http.Client sending requests with a transport
+// configured by c.
+func (c Config) NewClient() (*http.Client, error) {
+	transport, err := c.NewTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.Timeout,
+	}, nil
+}
+
+// Configure applies c to an existing transport, keeping its TLS
+// client certificates and protocol settings.
+func (c Config) Configure(transport *http.Transport) error {
+	proxy, err := c.proxy()
+	if err != nil {
+		return err
+	}
+	transport.Proxy = proxy
+
+	if c.CABundle != "" {
+		rootCAs, err := c.rootCAs()
+		if err != nil {
+			return err
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+
+	if c.Timeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   c.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		transport.TLSHandshakeTimeout = c.Timeout
+		transport.ResponseHeaderTimeout = c.Timeout
+	}
+	return nil
+}
+
+func (c Config) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		if len(c.NoProxy) == 0 {
+			return http.ProxyFromEnvironment, nil
+		}
+		return func(req *http.Request) (*url.URL, error) {
+			if c.bypassProxy(req.URL.Host) {
+				return nil, nil
+			}
+			return http.ProxyFromEnvironment(req)
+		}, nil
+	}
+
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("outbound: proxy URL %q has no host", c.ProxyURL)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if c.bypassProxy(req.URL.Host) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+func (c Config) bypassProxy(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, noProxy := range c.NoProxy {
+		noProxy = strings.ToLower(strings.TrimSpace(noProxy))
+		if noProxy == "" {
+			continue
+		}
+		if strings.HasPrefix(noProxy, ".") {
+			if host == noProxy[1:] || strings.HasSuffix(host, noProxy) {
+				return true
+			}
+		} else if host == noProxy {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) rootCAs() (*x509.CertPool, error) {
+	pemCerts, err := ioutil.ReadFile(c.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(pemCerts) {
+		return nil, errors.New("outbound: no certificates found in CA bundle " + c.CABundle)
+	}
+	return rootCAs, nil
+}
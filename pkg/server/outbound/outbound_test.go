@@ -0,0 +1,113 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbound
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig(t *testing.T) {
+	Convey("Config", t, func() {
+		Convey("is not enabled by default", func() {
+			So(Config{}.Enabled(), ShouldBeFalse)
+			So(Config{Timeout: time.Second}.Enabled(), ShouldBeTrue)
+		})
+
+		Convey("bypasses proxy for loopback and no proxy hosts", func() {
+			c := Config{NoProxy: []string{"plugin", ".internal"}}
+			So(c.bypassProxy("localhost:3000"), ShouldBeTrue)
+			So(c.bypassProxy("127.0.0.1:3000"), ShouldBeTrue)
+			So(c.bypassProxy("[::1]:3000"), ShouldBeTrue)
+			So(c.bypassProxy("plugin:8000"), ShouldBeTrue)
+			So(c.bypassProxy("internal"), ShouldBeTrue)
+			So(c.bypassProxy("db.internal:5432"), ShouldBeTrue)
+			So(c.bypassProxy("PLUGIN"), ShouldBeTrue)
+			So(c.bypassProxy("s3.amazonaws.com"), ShouldBeFalse)
+			So(c.bypassProxy("notinternal:80"), ShouldBeFalse)
+		})
+
+		Convey("sends requests through proxy", func() {
+			var proxied string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied = r.URL.String()
+				w.Write([]byte("proxied"))
+			}))
+			defer proxy.Close()
+
+			client, err := Config{ProxyURL: proxy.URL}.NewClient()
+			So(err, ShouldBeNil)
+
+			resp, err := client.Get("http://gateway.example.com/send")
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			So(string(body), ShouldEqual, "proxied")
+			So(proxied, ShouldEqual, "http://gateway.example.com/send")
+		})
+
+		Convey("rejects proxy URL without host", func() {
+			_, err := Config{ProxyURL: "proxy:3128"}.NewTransport()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("trusts certificates in CA bundle", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("trusted"))
+			}))
+			defer server.Close()
+
+			bundle, err := ioutil.TempFile("", "outbound-ca")
+			So(err, ShouldBeNil)
+			defer os.Remove(bundle.Name())
+			pem.Encode(bundle, &pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.TLS.Certificates[0].Certificate[0],
+			})
+			bundle.Close()
+
+			untrusted, err := Config{Timeout: 5 * time.Second}.NewClient()
+			So(err, ShouldBeNil)
+			_, err = untrusted.Get(server.URL)
+			So(err, ShouldNotBeNil)
+
+			trusted, err := Config{CABundle: bundle.Name(), Timeout: 5 * time.Second}.NewClient()
+			So(err, ShouldBeNil)
+			resp, err := trusted.Get(server.URL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			So(string(body), ShouldEqual, "trusted")
+		})
+
+		Convey("rejects CA bundle without certificates", func() {
+			bundle, err := ioutil.TempFile("", "outbound-ca")
+			So(err, ShouldBeNil)
+			defer os.Remove(bundle.Name())
+			bundle.Write([]byte("not a certificate"))
+			bundle.Close()
+
+			_, err = Config{CABundle: bundle.Name()}.NewTransport()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
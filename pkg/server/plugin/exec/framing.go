@@ -0,0 +1,266 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Versions of the protocol spoken between skygear and an exec plugin.
+//
+// With protocol version 1, the request is written to stdin, which is then
+// closed, and the response is the JSON at the end of stdout.
+//
+// With protocol version 2, the request is written to stdin as
+// "<length>\n<payload>" and stdin is kept open. The plugin writes
+// "ping\n" to stdout at least once every heartbeat timeout while it is
+// working, to which skygear replies "pong\n" on stdin. The response is
+// written to stdout as "frame <length>\n<payload>". Any other output on
+// stdout is logged. A plugin that sends neither ping nor frame within the
+// heartbeat timeout is killed.
+//
+// Every plugin process is told the highest protocol version supported by
+// skygear in the SKYGEAR_PROTOCOL_VERSION environment variable. A plugin
+// opts in to version 2 by including `"protocol_version": 2` in its
+// response to the init event, which is always sent with version 1.
+const (
+	protocolVersion1   = 1
+	protocolVersion2   = 2
+	maxProtocolVersion = protocolVersion2
+)
+
+var errNoResponse = errors.New("plugin process exited without a response")
+
+var errFrameTooLarge = errors.New("plugin response is larger than the frame length limit")
+
+// maxFrameLength is the largest response accepted from a plugin, so that
+// a malformed frame header does not allocate arbitrary memory.
+var maxFrameLength = 100 << 20
+
+// negotiateProtocolVersion returns the protocol version to be used with
+// a plugin given its response to the init event.
+func negotiateProtocolVersion(initResult []byte) int {
+	var info struct {
+		ProtocolVersion int `json:"protocol_version"`
+	}
+	if err := json.Unmarshal(initResult, &info); err != nil || info.ProtocolVersion < protocolVersion1 {
+		return protocolVersion1
+	}
+	if info.ProtocolVersion > maxProtocolVersion {
+		return maxProtocolVersion
+	}
+	return info.ProtocolVersion
+}
+
+// framedStdin guards writes to stdin of a plugin process, which are made
+// by both the request and the pong replies. It can be closed while a
+// write is blocked by a plugin not reading stdin.
+type framedStdin struct {
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	w          io.WriteCloser
+	closed     bool
+}
+
+func (s *framedStdin) write(b []byte) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.mutex.Lock()
+	closed := s.closed
+	s.mutex.Unlock()
+	if closed {
+		return nil
+	}
+	_, err := s.w.Write(b)
+	return err
+}
+
+func (s *framedStdin) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.w.Close()
+	}
+}
+
+// readFrames reads stdout of a plugin process speaking protocol
+// version 2 until EOF. It replies pings, sends the first frame to frames,
+// and logs any other output.
+func readFrames(r io.Reader, stdin *framedStdin, output *outputLogger, frames chan<- []byte, pings chan<- struct{}) error {
+	reader := bufio.NewReader(r)
+	framed := false
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+		case line == "ping":
+			stdin.write([]byte("pong\n"))
+			select {
+			case pings <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "frame ") && !framed:
+			length, parseErr := strconv.Atoi(strings.TrimPrefix(line, "frame "))
+			if parseErr != nil || length < 0 {
+				output.log("stdout", line)
+				break
+			}
+			if length > maxFrameLength {
+				log.WithField("length", length).Errorln("Plugin response exceeds the frame length limit")
+				return errFrameTooLarge
+			}
+
+			frame := make([]byte, length)
+			if _, readErr := io.ReadFull(reader, frame); readErr != nil {
+				return fmt.Errorf("failed to read frame from plugin: %v", readErr)
+			}
+			framed = true
+			frames <- frame
+			continue
+		default:
+			output.log("stdout", line)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startFramedCommand runs cmd with protocol version 2. A heartbeat
+// timeout of zero disables the heartbeat check.
+var startFramedCommand = func(cmd *osexec.Cmd, in []byte, output *outputLogger, heartbeatTimeout time.Duration) (out []byte, err error) {
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return
+	}
+
+	stdinPipe, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+
+	stderrDone := make(chan struct{})
+	go func() {
+		output.logStderr(stderrPipe)
+		close(stderrDone)
+	}()
+
+	stdin := &framedStdin{w: stdinPipe}
+	frames := make(chan []byte, 1)
+	pings := make(chan struct{}, 1)
+	readDone := make(chan error, 1)
+	go func() {
+		readDone <- readFrames(stdoutPipe, stdin, output, frames, pings)
+	}()
+
+	var timeout <-chan time.Time
+	var timer *time.Timer
+	if heartbeatTimeout > 0 {
+		timer = time.NewTimer(heartbeatTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// The request is written concurrently, so that a plugin not reading
+	// stdin is still killed after the heartbeat timeout.
+	request := append([]byte(fmt.Sprintf("%d\n", len(in))), in...)
+	go func() {
+		if writeErr := stdin.write(request); writeErr != nil {
+			log.WithField("err", writeErr).Warnln("Fail to write request to plugin")
+		}
+	}()
+
+	readFinished := false
+	killed := false
+wait:
+	for {
+		select {
+		case out = <-frames:
+			break wait
+		case <-pings:
+			if timer != nil {
+				timer.Reset(heartbeatTimeout)
+			}
+		case err = <-readDone:
+			readFinished = true
+			select {
+			case out = <-frames:
+				// the plugin exited right after sending the frame
+				err = nil
+			default:
+				if err == errFrameTooLarge {
+					// the plugin may be blocked writing the rest of
+					// the frame
+					cmd.Process.Kill()
+					killed = true
+				} else if err == nil || err == io.EOF {
+					err = errNoResponse
+				}
+			}
+			break wait
+		case <-timeout:
+			err = fmt.Errorf("plugin process sent no heartbeat in %v", heartbeatTimeout)
+			cmd.Process.Kill()
+			killed = true
+			break wait
+		}
+	}
+
+	// The plugin is expected to exit once stdin is closed. Kill it if it
+	// keeps running, so that it cannot hold up the request.
+	stdin.close()
+	if !readFinished {
+		if timer != nil {
+			timer.Reset(heartbeatTimeout)
+		}
+		select {
+		case <-readDone:
+		case <-timeout:
+			cmd.Process.Kill()
+			killed = true
+			<-readDone
+		}
+	}
+	<-stderrDone
+
+	if waitErr := cmd.Wait(); err == nil && !killed {
+		err = waitErr
+	}
+	return
+}
@@ -0,0 +1,119 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	Convey("negotiateProtocolVersion", t, func() {
+		So(negotiateProtocolVersion([]byte(`{"op": []}`)), ShouldEqual, protocolVersion1)
+		So(negotiateProtocolVersion([]byte(`{"protocol_version": 2}`)), ShouldEqual, protocolVersion2)
+		So(negotiateProtocolVersion([]byte(`{"protocol_version": 99}`)), ShouldEqual, maxProtocolVersion)
+		So(negotiateProtocolVersion([]byte(`not json`)), ShouldEqual, protocolVersion1)
+	})
+}
+
+func TestStartFramedCommand(t *testing.T) {
+	Convey("startFramedCommand", t, func() {
+		output := newOutputLogger("cat", "info", "warning")
+
+		Convey("reads frame among stray output", func() {
+			restore := captureLog()
+			cmd := exec.Command("/bin/sh", "-c", `
+read length
+input=$(head -c $length)
+echo "stray"
+echo "ping"
+read pong
+printf 'frame %d\n%s' $(printf '%s' "$input$pong" | wc -c) "$input$pong"
+`)
+			out, err := startFramedCommand(cmd, []byte(`"hello"`), output, time.Second)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `"hello"pong`)
+			So(restore(), ShouldResemble, []logEntry{
+				{"info", "stray", "cat", "stdout"},
+			})
+		})
+
+		Convey("kills plugin without heartbeat", func() {
+			cmd := exec.Command("/bin/sh", "-c", `exec sleep 5`)
+			startTime := time.Now()
+			_, err := startFramedCommand(cmd, []byte(`{}`), output, 100*time.Millisecond)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "heartbeat")
+			So(time.Since(startTime), ShouldBeLessThan, 5*time.Second)
+		})
+
+		Convey("kills plugin without heartbeat while writing request", func() {
+			cmd := exec.Command("/bin/sh", "-c", `exec sleep 5`)
+			startTime := time.Now()
+			_, err := startFramedCommand(cmd, bytes.Repeat([]byte("a"), 1<<20), output, 100*time.Millisecond)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "heartbeat")
+			So(time.Since(startTime), ShouldBeLessThan, 5*time.Second)
+		})
+
+		Convey("kills plugin sending frame over the length limit", func() {
+			defaultMaxFrameLength := maxFrameLength
+			maxFrameLength = 10
+			defer func() {
+				maxFrameLength = defaultMaxFrameLength
+			}()
+
+			cmd := exec.Command("/bin/sh", "-c", `
+read length
+head -c $length > /dev/null
+echo "frame 100"
+exec sleep 5
+`)
+			startTime := time.Now()
+			_, err := startFramedCommand(cmd, []byte(`{}`), output, time.Second)
+			So(err, ShouldEqual, errFrameTooLarge)
+			So(time.Since(startTime), ShouldBeLessThan, 5*time.Second)
+		})
+
+		Convey("errors if plugin exits without frame", func() {
+			cmd := exec.Command("/bin/sh", "-c", `echo "Traceback"`)
+			_, err := startFramedCommand(cmd, []byte(`{}`), output, time.Second)
+			So(err, ShouldEqual, errNoResponse)
+		})
+	})
+}
+
+func TestExecTransportProtocolNegotiation(t *testing.T) {
+	Convey("execTransport", t, func() {
+		transport := &execTransport{
+			Path: "/bin/sh",
+			Args: []string{"-c", `echo '{"result": {"protocol_version": 2}}'`},
+		}
+
+		Convey("speaks protocol version 1 before init", func() {
+			So(transport.getProtocolVersion(), ShouldEqual, protocolVersion1)
+		})
+
+		Convey("negotiates protocol version on init", func() {
+			_, err := transport.SendEvent("init", []byte{})
+			So(err, ShouldBeNil)
+			So(transport.getProtocolVersion(), ShouldEqual, protocolVersion2)
+		})
+	})
+}
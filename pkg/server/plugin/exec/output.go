@@ -0,0 +1,124 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// outputLogger forwards the output of a plugin process that is not part
+// of the protocol, such as print statements and tracebacks, to the log.
+// A nil outputLogger discards the output.
+type outputLogger struct {
+	plugin      string
+	stdoutLevel logrus.Level
+	stderrLevel logrus.Level
+}
+
+func newOutputLogger(plugin string, stdoutLevel string, stderrLevel string) *outputLogger {
+	return &outputLogger{
+		plugin:      plugin,
+		stdoutLevel: parseLevel(stdoutLevel, logrus.InfoLevel),
+		stderrLevel: parseLevel(stderrLevel, logrus.WarnLevel),
+	}
+}
+
+func parseLevel(level string, defaultLevel logrus.Level) logrus.Level {
+	if level == "" {
+		return defaultLevel
+	}
+
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		log.Warnf("Unrecognized plugin output log level %q, using %v", level, defaultLevel)
+		return defaultLevel
+	}
+	return parsed
+}
+
+func (l *outputLogger) log(stream string, line string) {
+	if l == nil || strings.TrimSpace(line) == "" {
+		return
+	}
+
+	level := l.stdoutLevel
+	if stream == "stderr" {
+		level = l.stderrLevel
+	}
+
+	entry := log.WithFields(logrus.Fields{
+		"plugin": l.plugin,
+		"stream": stream,
+	})
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		// never panic or exit on behalf of a plugin
+		entry.Error(line)
+	case logrus.WarnLevel:
+		entry.Warn(line)
+	case logrus.InfoLevel:
+		entry.Info(line)
+	default:
+		entry.Debug(line)
+	}
+}
+
+// logStderr logs every line read from r until EOF.
+func (l *outputLogger) logStderr(r io.Reader) {
+	readLines(r, func(line string) {
+		l.log("stderr", line)
+	})
+}
+
+// readLines calls f with every line read from r until EOF. Unlike
+// bufio.Scanner, it does not stop at a line longer than its buffer, so
+// the plugin is never left blocked on a full pipe.
+func readLines(r io.Reader, f func(line string)) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			f(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// extractFrame returns the protocol frame at the end of the stdout lines
+// of a plugin process, and logs the lines preceding it. If no frame is
+// found, all lines are returned as is.
+func (l *outputLogger) extractFrame(lines []string) []byte {
+	for i := range lines {
+		frame := []byte(strings.Join(lines[i:], ""))
+		var raw json.RawMessage
+		if json.Unmarshal(frame, &raw) != nil {
+			continue
+		}
+
+		for _, line := range lines[:i] {
+			l.log("stdout", line)
+		}
+		return frame
+	}
+
+	return []byte(strings.Join(lines, ""))
+}
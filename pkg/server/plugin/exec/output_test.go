@@ -0,0 +1,126 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type logEntry struct {
+	Level  string `json:"level"`
+	Msg    string `json:"msg"`
+	Plugin string `json:"plugin"`
+	Stream string `json:"stream"`
+}
+
+// captureLog redirects the plugin logger into a buffer and returns
+// a function that restores it and returns the logged entries.
+func captureLog() func() []logEntry {
+	buf := bytes.Buffer{}
+	originalOut := log.Logger.Out
+	originalFormatter := log.Logger.Formatter
+	originalLevel := log.Logger.Level
+	log.Logger.Out = &buf
+	log.Logger.Formatter = &logrus.JSONFormatter{}
+	log.Logger.Level = logrus.DebugLevel
+
+	return func() []logEntry {
+		log.Logger.Out = originalOut
+		log.Logger.Formatter = originalFormatter
+		log.Logger.Level = originalLevel
+
+		entries := []logEntry{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			entry := logEntry{}
+			if json.Unmarshal([]byte(line), &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+}
+
+func TestOutputLogger(t *testing.T) {
+	Convey("outputLogger", t, func() {
+		output := newOutputLogger("cat", "info", "error")
+		restore := captureLog()
+
+		Convey("extracts frame after printed lines", func() {
+			frame := output.extractFrame([]string{
+				"hello",
+				"42",
+				`{"result":`,
+				`"ok"}`,
+			})
+			So(string(frame), ShouldEqual, `{"result":"ok"}`)
+			So(restore(), ShouldResemble, []logEntry{
+				{"info", "hello", "cat", "stdout"},
+				{"info", "42", "cat", "stdout"},
+			})
+		})
+
+		Convey("returns all lines without frame", func() {
+			frame := output.extractFrame([]string{"hello", "world"})
+			So(string(frame), ShouldEqual, "helloworld")
+			So(restore(), ShouldBeEmpty)
+		})
+
+		Convey("logs stderr", func() {
+			cmd := exec.Command("/bin/sh", "-c", `echo "Traceback" >&2; echo '{"result": 1}'`)
+			out, err := startCommand(cmd, []byte{}, output)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"result": 1}`)
+			So(restore(), ShouldResemble, []logEntry{
+				{"error", "Traceback", "cat", "stderr"},
+			})
+		})
+
+		Convey("logs stderr lines of any length", func() {
+			cmd := exec.Command("/bin/sh", "-c", `
+head -c 70000 /dev/zero | tr '\0' a >&2
+echo >&2
+echo "Traceback" >&2
+printf '{"result": "%s"}\n' $(head -c 70000 /dev/zero | tr '\0' b)
+`)
+			out, err := startCommand(cmd, []byte{}, output)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"result": "`+strings.Repeat("b", 70000)+`"}`)
+			So(restore(), ShouldResemble, []logEntry{
+				{"error", strings.Repeat("a", 70000), "cat", "stderr"},
+				{"error", "Traceback", "cat", "stderr"},
+			})
+		})
+
+		Convey("discards output if nil", func() {
+			output = nil
+			So(string(output.extractFrame([]string{"hello", "{}"})), ShouldEqual, "{}")
+			So(restore(), ShouldBeEmpty)
+		})
+
+		Convey("falls back to default levels", func() {
+			output = newOutputLogger("cat", "", "unknown")
+			restore()
+			So(output.stdoutLevel, ShouldEqual, logrus.InfoLevel)
+			So(output.stderrLevel, ShouldEqual, logrus.WarnLevel)
+		})
+	})
+}
@@ -15,11 +15,12 @@
 package exec
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	osexec "os/exec"
+	"sync/atomic"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 
@@ -30,7 +31,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
 )
 
-var startCommand = func(cmd *osexec.Cmd, in []byte) (out []byte, err error) {
+var startCommand = func(cmd *osexec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return
@@ -51,6 +52,14 @@ var startCommand = func(cmd *osexec.Cmd, in []byte) (out []byte, err error) {
 		return
 	}
 
+	// stderr is read concurrently so that a plugin writing a lot to
+	// stderr would not block on a full pipe
+	stderrDone := make(chan struct{})
+	go func() {
+		output.logStderr(stderr)
+		close(stderrDone)
+	}()
+
 	_, err = stdin.Write(in)
 	if err != nil {
 		return
@@ -61,23 +70,12 @@ var startCommand = func(cmd *osexec.Cmd, in []byte) (out []byte, err error) {
 		return
 	}
 
-	pluginLog := []byte{}
-	stdErr := bufio.NewScanner(stderr)
-	for stdErr.Scan() {
-		pluginLog = append(pluginLog, []byte("\n")...)
-		pluginLog = append(pluginLog, stdErr.Bytes()...)
-	}
-	log.Debug("exec stderr : ", string(pluginLog))
-
-	s := bufio.NewScanner(stdout)
-	for s.Scan() {
-		out = append(out, s.Bytes()...)
-	}
-
-	err = stdout.Close()
-	if err != nil {
-		return
-	}
+	lines := []string{}
+	readLines(stdout, func(line string) {
+		lines = append(lines, line)
+	})
+	out = output.extractFrame(lines)
+	<-stderrDone
 
 	err = cmd.Wait()
 	return
@@ -90,6 +88,20 @@ type execTransport struct {
 	Config      skyconfig.Configuration
 	initHandler skyplugin.TransportInitHandler
 	state       skyplugin.TransportState
+	output      *outputLogger
+
+	// protocolVersion is accessed atomically as it is negotiated during
+	// init while other calls may be in progress.
+	protocolVersion  int32
+	heartbeatTimeout time.Duration
+}
+
+func (p *execTransport) getProtocolVersion() int {
+	version := int(atomic.LoadInt32(&p.protocolVersion))
+	if version == 0 {
+		return protocolVersion1
+	}
+	return version
 }
 
 func (p *execTransport) run(args []string, env []string, in []byte) (out []byte, err error) {
@@ -110,13 +122,18 @@ func (p *execTransport) run(args []string, env []string, in []byte) (out []byte,
 	cmd.Env = []string{
 		"DATABASE_URL=" + p.DBConfig,
 		fmt.Sprintf("SKYGEAR_CONFIG=%s", encodedConfig),
+		fmt.Sprintf("SKYGEAR_PROTOCOL_VERSION=%d", maxProtocolVersion),
 	}
 	for _, envLine := range env {
 		cmd.Env = append(cmd.Env, envLine)
 	}
 	log.Debugf("Calling with Env %v", cmd.Env)
 	log.Debugf("Calling %s %s with     : %s", cmd.Path, cmd.Args, in)
-	out, err = startCommand(cmd, in)
+	if p.getProtocolVersion() >= protocolVersion2 {
+		out, err = startFramedCommand(cmd, in, p.output, p.heartbeatTimeout)
+	} else {
+		out, err = startCommand(cmd, in, p.output)
+	}
 	log.Debugf("Called  %s %s returning: %s", cmd.Path, cmd.Args, out)
 
 	return
@@ -168,8 +185,28 @@ func (p *execTransport) SetState(state skyplugin.TransportState) {
 	}
 }
 
+// SetName implements skyplugin.NamedTransport.
+func (p *execTransport) SetName(name string) {
+	if p.output != nil {
+		p.output.plugin = name
+	}
+}
+
 func (p *execTransport) SendEvent(name string, in []byte) ([]byte, error) {
-	return p.runProc([]string{"event", name}, []string{}, in)
+	if name != "init" {
+		return p.runProc([]string{"event", name}, []string{}, in)
+	}
+
+	// init is always sent with protocol version 1, as the plugin might
+	// have been restarted with a version not supporting the negotiated one.
+	atomic.StoreInt32(&p.protocolVersion, protocolVersion1)
+	out, err := p.runProc([]string{"event", name}, []string{}, in)
+	if err == nil {
+		version := negotiateProtocolVersion(out)
+		atomic.StoreInt32(&p.protocolVersion, int32(version))
+		log.Infof("Plugin %v speaks protocol version %d", p.Path, version)
+	}
+	return out, err
 }
 
 func (p *execTransport) RunLambda(ctx context.Context, name string, in []byte) (out []byte, err error) {
@@ -235,6 +272,36 @@ func (p *execTransport) RunHook(ctx context.Context, hookName string, record *sk
 	return &recordout, nil
 }
 
+func (p *execTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	in, err := json.Marshal(map[string]interface{}{
+		"query": query,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %v", err)
+	}
+
+	pluginCtx := skyplugin.ContextMap(ctx)
+	encodedCtx, err := common.EncodeBase64JSON(pluginCtx)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{
+		fmt.Sprintf("SKYGEAR_CONTEXT=%s", encodedCtx),
+	}
+	out, err := p.runProc([]string{"hook", hookName}, env, in)
+	if err != nil {
+		return nil, err
+	}
+
+	var queryout map[string]interface{}
+	if err := json.Unmarshal(out, &queryout); err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, fmt.Errorf("failed to unmarshal query: %v", err)
+	}
+
+	return queryout, nil
+}
+
 func (p *execTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	out, err = p.runProc([]string{"timer", name}, []string{}, in)
 	return
@@ -283,6 +350,12 @@ func (f execTransportFactory) Open(path string, args []string, config skyconfig.
 		DBConfig: config.DB.Option,
 		Config:   config,
 		state:    skyplugin.TransportStateUninitialized,
+		output: newOutputLogger(
+			path,
+			config.LOG.PluginStdoutLevel,
+			config.LOG.PluginStderrLevel,
+		),
+		heartbeatTimeout: time.Duration(config.Exec.HeartbeatTimeout) * time.Second,
 	}
 	return
 }
@@ -103,8 +103,8 @@ func TestRun(t *testing.T) {
 			startCommand = originalCommand
 		}()
 
-		startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
-			out, err = originalCommand(cmd, in)
+		startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
+			out, err = originalCommand(cmd, in, output)
 			out = append([]byte(`{"result":"`), out...)
 			out = append(out, []byte(`"}`)...)
 			return
@@ -172,7 +172,7 @@ func TestRun(t *testing.T) {
 
 		Convey("pass context as environment variable", func() {
 			executed := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				So(cmd, shouldRunWithContext, map[string]interface{}{
 					"user_id":         "user",
 					"access_key_type": "master",
@@ -243,7 +243,7 @@ func TestRun(t *testing.T) {
 
 		Convey("executes beforeSave correctly", func() {
 			called := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				called = true
 				So(cmd.Path, ShouldEqual, "/never/invoked")
 				So(cmd.Args, ShouldResemble, []string{"/never/invoked", "hook", "note_beforeSave"})
@@ -392,7 +392,7 @@ func TestRun(t *testing.T) {
 
 		Convey("executes beforeSave with original", func() {
 			called := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				called = true
 				So(cmd.Path, ShouldEqual, "/never/invoked")
 				So(cmd.Args, ShouldResemble, []string{"/never/invoked", "hook", "note_beforeSave"})
@@ -532,7 +532,7 @@ func TestRun(t *testing.T) {
 			}
 
 			called := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				called = true
 				So(string(in), ShouldEqualJSON, `{
 					"record": {
@@ -573,7 +573,7 @@ func TestRun(t *testing.T) {
 			}
 
 			called := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				called = true
 				So(string(in), ShouldEqualJSON, `{
 					"record": {
@@ -600,7 +600,7 @@ func TestRun(t *testing.T) {
 		})
 
 		Convey("returns err if command failed", func() {
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				return nil, errors.New("worrying error")
 			}
 
@@ -610,7 +610,7 @@ func TestRun(t *testing.T) {
 		})
 
 		Convey("returns err if command returns invalid response", func() {
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				return []byte("I am not a json"), nil
 			}
 
@@ -620,7 +620,7 @@ func TestRun(t *testing.T) {
 		})
 
 		Convey("returns err if commands returns with inner error", func() {
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				return []byte(`{
 					"result": {
 						"ignore": "me"
@@ -643,7 +643,7 @@ func TestRun(t *testing.T) {
 
 		Convey("pass context as environment variable", func() {
 			executed := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				So(cmd, shouldRunWithContext, map[string]interface{}{
 					"user_id":         "user",
 					"access_key_type": "master",
@@ -707,7 +707,7 @@ func TestRun(t *testing.T) {
 
 		Convey("executes provider passing auth data", func() {
 			called := false
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				called = true
 				So(cmd.Path, ShouldEqual, "/never/invoked")
 				So(cmd.Args, ShouldResemble, []string{"/never/invoked", "provider", "com.example", "login"})
@@ -739,7 +739,7 @@ func TestRun(t *testing.T) {
 		})
 
 		Convey("executes provider passing error", func() {
-			startCommand = func(cmd *exec.Cmd, in []byte) (out []byte, err error) {
+			startCommand = func(cmd *exec.Cmd, in []byte, output *outputLogger) (out []byte, err error) {
 				return nil, errors.New("worrying error")
 			}
 
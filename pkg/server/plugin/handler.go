@@ -1,11 +1,13 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 
+	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
@@ -39,6 +41,8 @@ type Handler struct {
 	AccessKeyRequired bool
 	UserRequired      bool
 	PreprocessorList  router.PreprocessorRegistry
+	Limits            RequestLimits
+	Inspectors        []RequestInspector
 	preprocessors     []router.Processor
 }
 
@@ -77,11 +81,17 @@ func (h *Handler) GetPreprocessors() []router.Processor {
 }
 
 // Handle executes lambda function implemented by the plugin.
-func (h *Handler) Handle(payload *router.Payload, response *router.Response) {
-	body, err := ioutil.ReadAll(payload.Req.Body)
-	if err != nil {
-		panic(err)
+func (h *Handler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
+	body, skyErr := h.Limits.ReadBody(payload.Req.Body)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
 	}
+	if skyErr = h.inspect(payload, body); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
 	wholeRequest := &pluginRequestPayload{
 		Method:      payload.Req.Method,
 		Path:        payload.Req.URL.Path,
@@ -94,8 +104,10 @@ func (h *Handler) Handle(payload *router.Payload, response *router.Response) {
 		panic(err)
 	}
 
-	outbytes, err := h.Plugin.transport.RunHandler(payload.Context, h.Name, inbytes)
-	log.WithFields(logrus.Fields{
+	startTime := time.Now()
+	outbytes, err := h.Plugin.transport.RunHandler(ctx, h.Name, inbytes)
+	observeCall(ctx, h.Plugin, "handler", h.Name, startTime, err)
+	logging.WithContext(ctx, log).WithFields(logrus.Fields{
 		"name": h.Name,
 		"err":  err,
 	}).Debugf("Executed a handler with result")
@@ -128,3 +140,21 @@ func (h *Handler) Handle(payload *router.Payload, response *router.Response) {
 	writer.WriteHeader(responsePayload.Status)
 	writer.Write(responsePayload.Body)
 }
+
+// inspect checks the request against the limits of the handler and the
+// inspectors, returning the first error.
+func (h *Handler) inspect(payload *router.Payload, body []byte) skyerr.Error {
+	if err := h.Limits.InspectRequest(payload.Context, h.Name, payload.Req, body); err != nil {
+		return err
+	}
+	for _, inspector := range h.Inspectors {
+		if err := inspector.InspectRequest(payload.Context, h.Name, payload.Req, body); err != nil {
+			logging.WithContext(payload.Context, log).WithFields(logrus.Fields{
+				"name": h.Name,
+				"err":  err,
+			}).Infof("Rejected a handler request by inspection")
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"testing"
 
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
 	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 func TestHandlerCreation(t *testing.T) {
@@ -84,5 +86,27 @@ func TestHandler(t *testing.T) {
 			So(transport.lastContext.Value(HelloContextKey), ShouldEqual, "world")
 		})
 
+		Convey("rejects body exceeding size limit", func() {
+			handler.Limits = RequestLimits{MaxBodySize: 4}
+			resp := g.Request("POST", `{"args": ["bob"]}`)
+
+			So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(transport.lastContext, ShouldBeNil)
+		})
+
+		Convey("rejects request rejected by inspector", func() {
+			var inspectedBody []byte
+			handler.Inspectors = []RequestInspector{
+				RequestInspectorFunc(func(ctx context.Context, name string, req *http.Request, body []byte) skyerr.Error {
+					inspectedBody = body
+					return skyerr.NewError(skyerr.BadRequest, "infected")
+				}),
+			}
+			resp := g.Request("POST", `{"args": ["bob"]}`)
+
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			So(string(inspectedBody), ShouldEqual, `{"args": ["bob"]}`)
+			So(transport.lastContext, ShouldBeNil)
+		})
 	})
 }
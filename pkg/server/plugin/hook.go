@@ -16,18 +16,52 @@ package plugin
 
 import (
 	"context"
+	"time"
 
+	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
+// detachedContext carries the values of a request context, such as the
+// ID of the user and the access key type, without its cancellation and
+// deadline, so that an asynchronous hook can run after the response.
+type detachedContext struct {
+	context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (ctx detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (ctx detachedContext) Err() error {
+	return nil
+}
+
 // CreateHookFunc returns a hook.HookFunc that run the hook registered by a
 // plugin
+//
+// An asynchronous hook, or an afterSave hook if the plugin executes them
+// asynchronously, is enqueued to the hook queue of the plugin and retried
+// if it fails. Each attempt is bounded by the hook timeout of the plugin.
+// A hook executed in a transaction is only enqueued after the
+// transaction is committed, see hook.WithPending.
+// The delivery is best-effort: the queue is kept in memory, so hooks
+// waiting to run or to be retried are lost if the server stops, and a
+// hook failing all attempts is only logged and counted as a dead letter.
 func CreateHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.Func {
 	hookFunc := func(ctx context.Context, record *skydb.Record, oldRecord *skydb.Record) skyerr.Error {
+		startTime := time.Now()
 		recordout, err := p.transport.RunHook(ctx, hookInfo.Name, record, oldRecord)
-		if err == nil && hookInfo.Trigger == string(hook.BeforeSave) && !hookInfo.Async {
+		observeCall(ctx, p, "hook", hookInfo.Name, startTime, err)
+		modifiesRecord := hookInfo.Trigger == string(hook.BeforeSave) || hookInfo.Trigger == string(hook.SyncMerge)
+		if err == nil && modifiesRecord && !hookInfo.Async {
 			*record = *recordout
 		}
 
@@ -41,13 +75,98 @@ func CreateHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.Func {
 
 		return skyerr.MakeError(err)
 	}
-	if hookInfo.Async {
+	if hookInfo.Async || (p.asyncAfterSave && hookInfo.Trigger == string(hook.AfterSave)) {
+		priority, err := workqueue.ParsePriority(hookInfo.Priority)
+		if err != nil {
+			log.Warnf("Executing hook %s with normal priority: %v", hookInfo.Name, err)
+			priority = workqueue.Normal
+		}
 		return func(ctx context.Context, record *skydb.Record, oldRecord *skydb.Record) skyerr.Error {
-			// TODO(limouren): think of a way to test this go routine
-			go hookFunc(ctx, record, oldRecord)
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = detachedContext{ctx}
+
+			// The records are copied as the caller keeps modifying them
+			// after the hook is queued.
+			record = copyHookRecord(record)
+			oldRecord = copyHookRecord(oldRecord)
+
+			hook.RunAfterCommit(ctx, func() {
+				err := p.hookQueue.EnqueueRetry(priority, hookInfo.Name, p.hookRetry, func() error {
+					attemptCtx, cancel := p.hookAttemptContext(ctx)
+					defer cancel()
+					if err := hookFunc(attemptCtx, record, oldRecord); err != nil {
+						return err
+					}
+					return nil
+				})
+				if err != nil {
+					logging.WithContext(ctx, log).Errorf("Failed to queue hook %s: %v", hookInfo.Name, err)
+				}
+			})
 			return nil
 		}
 	}
 
 	return hookFunc
 }
+
+// copyHookRecord returns a copy of record for a queued hook. Assets in
+// the record data are copied too, as their URL signer is set on the
+// record saved.
+func copyHookRecord(record *skydb.Record) *skydb.Record {
+	if record == nil {
+		return nil
+	}
+
+	recordCopy := *record
+	recordCopy.Data = copyHookRecordData(record.Data)
+	recordCopy.Transient = copyHookRecordData(record.Transient)
+	return &recordCopy
+}
+
+func copyHookRecordData(data skydb.Data) skydb.Data {
+	if data == nil {
+		return nil
+	}
+
+	dataCopy := skydb.Data{}
+	for key, value := range data {
+		if asset, ok := value.(*skydb.Asset); ok {
+			assetCopy := *asset
+			value = &assetCopy
+		}
+		dataCopy[key] = value
+	}
+	return dataCopy
+}
+
+// hookAttemptContext returns the context of an attempt to run a queued
+// hook, which is cancelled after the hook timeout of the plugin. The
+// context is not bounded if no timeout is set.
+func (p *Plugin) hookAttemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.hookTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.hookTimeout)
+}
+
+// CreateQueryHookFunc returns a hook.QueryFunc that run the beforeQuery
+// hook registered by a plugin
+func CreateQueryHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.QueryFunc {
+	return func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+		startTime := time.Now()
+		queryout, err := p.transport.RunQueryHook(ctx, hookInfo.Name, query)
+		observeCall(ctx, p, "hook", hookInfo.Name, startTime, err)
+		if err == nil {
+			return queryout, nil
+		}
+
+		if pluginError, ok := err.(skyerr.Error); ok {
+			return nil, pluginError
+		}
+
+		return nil, skyerr.MakeError(err)
+	}
+}
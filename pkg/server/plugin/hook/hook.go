@@ -26,12 +26,27 @@ import (
 // Kind defines when a hook should be executed on mutation of skydb.Record.
 type Kind string
 
-// The four kind of hooks provided by Skygear.
+// The kinds of hooks provided by Skygear.
+//
+// SyncMerge is executed by record:sync when a client change conflicts with
+// a server change. The hook receives the client record and the server record,
+// and modifies the client record in place to the merged result.
+//
+// Archive is executed by a retention rule on each expired record before it
+// is removed, so that the record can be copied elsewhere. The record is
+// kept if the hook returns an error.
+//
+// BeforeQuery is executed by record:query before the query is performed.
+// Unlike other kinds, it is registered as a QueryFunc with
+// RegisterQueryHook.
 const (
 	BeforeSave   Kind = "beforeSave"
 	AfterSave         = "afterSave"
 	BeforeDelete      = "beforeDelete"
 	AfterDelete       = "afterDelete"
+	SyncMerge         = "syncMerge"
+	Archive           = "archive"
+	BeforeQuery       = "beforeQuery"
 )
 
 // Func defines the interface of a function that can be hooked.
@@ -39,6 +54,14 @@ const (
 // The supplied record is fully fetched for all four kind of hooks.
 type Func func(context.Context, *skydb.Record, *skydb.Record) skyerr.Error
 
+// QueryFunc defines the interface of a function that can be hooked before
+// a query is performed.
+//
+// The supplied query is in the format of the record:query payload. The
+// function returns the query to be performed instead, or an error to
+// reject the query.
+type QueryFunc func(context.Context, map[string]interface{}) (map[string]interface{}, skyerr.Error)
+
 type recordTypeHookMap map[string][]Func
 
 // Registry is a registry of hooks by record type.
@@ -54,6 +77,9 @@ type Registry struct {
 	afterSaveHooks    recordTypeHookMap
 	beforeDeleteHooks recordTypeHookMap
 	afterDeleteHooks  recordTypeHookMap
+	syncMergeHooks    recordTypeHookMap
+	archiveHooks      recordTypeHookMap
+	beforeQueryHooks  map[string][]QueryFunc
 }
 
 // NewRegistry returns a Registry ready for use.
@@ -64,6 +90,9 @@ func NewRegistry() *Registry {
 		recordTypeHookMap{},
 		recordTypeHookMap{},
 		recordTypeHookMap{},
+		recordTypeHookMap{},
+		recordTypeHookMap{},
+		map[string][]QueryFunc{},
 	}
 }
 
@@ -81,6 +110,36 @@ func (r *Registry) Register(kind Kind, recordType string, hook Func) error {
 	return nil
 }
 
+// RegisterQueryHook adds the hook to be executed before a query of the
+// supplied recordType is performed.
+func (r *Registry) RegisterQueryHook(recordType string, hook QueryFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.beforeQueryHooks[recordType] = append(r.beforeQueryHooks[recordType], hook)
+}
+
+// ExecuteQueryHooks executes the hooks registered for the supplied
+// recordType on the query in turn, each receiving the query returned by
+// the previous one, and returns the resulting query.
+//
+// If one of the hooks returns an error, it halts execution of other hooks
+// and returns that error untouched.
+func (r *Registry) ExecuteQueryHooks(ctx context.Context, recordType string, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+	r.mutex.RLock()
+	hooks := make([]QueryFunc, len(r.beforeQueryHooks[recordType]))
+	copy(hooks, r.beforeQueryHooks[recordType])
+	r.mutex.RUnlock()
+
+	for _, hook := range hooks {
+		var err skyerr.Error
+		if query, err = hook(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
 // ExecuteHooks executes registered hooks for the type of supplied record to
 // be executed at the specific kind of moment.
 //
@@ -101,6 +160,19 @@ func (r *Registry) ExecuteHooks(ctx context.Context, kind Kind, record *skydb.Re
 	return nil
 }
 
+// HasHooks returns whether any hooks are registered for the supplied
+// recordType at the specific kind of moment.
+func (r *Registry) HasHooks(kind Kind, recordType string) bool {
+	if kind == BeforeQuery {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return len(r.beforeQueryHooks[recordType]) > 0
+	}
+
+	hooks, err := r.hooks(kind, recordType)
+	return err == nil && len(hooks) > 0
+}
+
 func (r *Registry) hooks(kind Kind, recordType string) (m []Func, err error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -130,7 +202,59 @@ func (r *Registry) recordTypeHookMap(kind Kind) (m recordTypeHookMap, err error)
 		m = r.beforeDeleteHooks
 	case AfterDelete:
 		m = r.afterDeleteHooks
+	case SyncMerge:
+		m = r.syncMergeHooks
+	case Archive:
+		m = r.archiveHooks
 	}
 
 	return
 }
+
+type pendingContextKey struct{}
+
+// Pending collects the work of asynchronous hooks executed in a
+// transaction, which must not start before the transaction is
+// committed. It is safe for concurrent use.
+type Pending struct {
+	mutex sync.Mutex
+	funcs []func()
+}
+
+// WithPending returns a copy of ctx carrying a new Pending. Work passed
+// to RunAfterCommit with the returned context is held until Run is
+// called; it is dropped if Run is never called, such as when the
+// transaction is rolled back.
+func WithPending(ctx context.Context) (context.Context, *Pending) {
+	pending := &Pending{}
+	return context.WithValue(ctx, pendingContextKey{}, pending), pending
+}
+
+// RunAfterCommit calls f after the transaction of ctx is committed. f is
+// called right away if ctx carries no Pending.
+func RunAfterCommit(ctx context.Context, f func()) {
+	var pending *Pending
+	if ctx != nil {
+		pending, _ = ctx.Value(pendingContextKey{}).(*Pending)
+	}
+	if pending == nil {
+		f()
+		return
+	}
+
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+	pending.funcs = append(pending.funcs, f)
+}
+
+// Run calls the work held so far in the order it was added.
+func (p *Pending) Run() {
+	p.mutex.Lock()
+	funcs := p.funcs
+	p.funcs = nil
+	p.mutex.Unlock()
+
+	for _, f := range funcs {
+		f()
+	}
+}
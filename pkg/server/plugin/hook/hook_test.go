@@ -20,6 +20,7 @@ import (
 
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook/hooktest"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -134,10 +135,85 @@ func TestHookRegistry(t *testing.T) {
 			}, ShouldNotPanic)
 		})
 
+		Convey("reports whether hooks are registered", func() {
+			registry.Register(SyncMerge, "note", beforeSave.Func)
+
+			So(registry.HasHooks(SyncMerge, "note"), ShouldBeTrue)
+			So(registry.HasHooks(SyncMerge, "record"), ShouldBeFalse)
+			So(registry.HasHooks(BeforeSave, "note"), ShouldBeFalse)
+			So(registry.HasHooks(Kind("unknown"), "note"), ShouldBeFalse)
+		})
+
 		Convey("panics executing nil record", func() {
 			So(func() {
 				registry.ExecuteHooks(ctx, AfterDelete, nil, nil)
 			}, ShouldPanic)
 		})
+
+		Convey("executes query hooks in turn", func() {
+			registry.RegisterQueryHook("note", func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+				query["limit"] = float64(10)
+				return query, nil
+			})
+			registry.RegisterQueryHook("note", func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+				return map[string]interface{}{
+					"record_type": query["record_type"],
+					"limit":       query["limit"].(float64) * 2,
+				}, nil
+			})
+
+			query, err := registry.ExecuteQueryHooks(ctx, "note", map[string]interface{}{
+				"record_type": "note",
+			})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, map[string]interface{}{
+				"record_type": "note",
+				"limit":       float64(20),
+			})
+			So(registry.HasHooks(BeforeQuery, "note"), ShouldBeTrue)
+			So(registry.HasHooks(BeforeQuery, "record"), ShouldBeFalse)
+		})
+
+		Convey("rejects query by query hook", func() {
+			registry.RegisterQueryHook("note", func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+				return nil, skyerr.NewError(skyerr.PermissionDenied, "no query")
+			})
+
+			query, err := registry.ExecuteQueryHooks(ctx, "note", map[string]interface{}{
+				"record_type": "note",
+			})
+			So(query, ShouldBeNil)
+			So(err.Code(), ShouldEqual, skyerr.PermissionDenied)
+		})
+	})
+}
+
+func TestRunAfterCommit(t *testing.T) {
+	Convey("RunAfterCommit", t, func() {
+		called := []string{}
+
+		Convey("runs right away without Pending", func() {
+			RunAfterCommit(context.Background(), func() {
+				called = append(called, "hook")
+			})
+			So(called, ShouldResemble, []string{"hook"})
+		})
+
+		Convey("holds work until Pending is run", func() {
+			ctx, pending := WithPending(context.Background())
+			RunAfterCommit(ctx, func() {
+				called = append(called, "hook1")
+			})
+			RunAfterCommit(ctx, func() {
+				called = append(called, "hook2")
+			})
+			So(called, ShouldBeEmpty)
+
+			pending.Run()
+			So(called, ShouldResemble, []string{"hook1", "hook2"})
+
+			pending.Run()
+			So(called, ShouldResemble, []string{"hook1", "hook2"})
+		})
 	})
 }
@@ -18,17 +18,26 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 type hookOnlyTransport struct {
-	RunHookFunc func(context.Context, string, *skydb.Record, *skydb.Record) (*skydb.Record, error)
+	RunHookFunc      func(context.Context, string, *skydb.Record, *skydb.Record) (*skydb.Record, error)
+	RunQueryHookFunc func(context.Context, string, map[string]interface{}) (map[string]interface{}, error)
 	Transport
 }
 
+func (t *hookOnlyTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	return t.RunQueryHookFunc(ctx, hookName, query)
+}
+
 func (t *hookOnlyTransport) RunHook(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
 	return t.RunHookFunc(ctx, hookName, record, originalRecord)
 }
@@ -91,6 +100,140 @@ func TestCreateHookFunc(t *testing.T) {
 			})
 		})
 
+		Convey("synced sync merge", func() {
+			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
+				Async:   false,
+				Trigger: string(hook.SyncMerge),
+				Type:    "note",
+				Name:    "note_syncMerge",
+			})
+
+			transport.RunHookFunc = func(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
+				So(hookName, ShouldEqual, "note_syncMerge")
+				return &skydb.Record{
+					ID:   skydb.NewRecordID("note", "id"),
+					Data: skydb.Data{"merged": true},
+				}, nil
+			}
+
+			err := hookFunc(nil, &recordin, &originalRecord)
+			So(err, ShouldBeNil)
+			So(recordin, ShouldResemble, skydb.Record{
+				ID:   skydb.NewRecordID("note", "id"),
+				Data: skydb.Data{"merged": true},
+			})
+		})
+
+		Convey("records duration and trace", func() {
+			plugin.name = "cat"
+			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
+				Async:   false,
+				Trigger: string(hook.AfterSave),
+				Type:    "note",
+				Name:    "note_traced",
+			})
+
+			transport.RunHookFunc = func(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
+				return nil, errors.New("exit status 1")
+			}
+
+			ctx, trace := metrics.WithTrace(context.Background())
+			hookFunc(ctx, &recordin, &originalRecord)
+			So(pluginCallDuration.Count("cat", "hook", "note_traced", "error"), ShouldEqual, 1)
+
+			spans := trace.Spans()
+			So(spans, ShouldHaveLength, 1)
+			So(spans[0].Name, ShouldEqual, "plugin:hook")
+			So(spans[0].Labels, ShouldResemble, map[string]string{
+				"plugin": "cat",
+				"name":   "note_traced",
+			})
+			So(spans[0].Error, ShouldEqual, "exit status 1")
+		})
+
+		Convey("queued after save with retry", func() {
+			plugin.asyncAfterSave = true
+			plugin.hookRetry = workqueue.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
+				Async:   false,
+				Trigger: string(hook.AfterSave),
+				Type:    "note",
+				Name:    "note_afterSave",
+			})
+
+			attempts := make(chan context.Context, 2)
+			transport.RunHookFunc = func(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
+				attempts <- ctx
+				return nil, errors.New("exit status 1")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ctx = context.WithValue(ctx, router.UserIDContextKey, "user0")
+			err := hookFunc(ctx, &recordin, &originalRecord)
+			cancel()
+			So(err, ShouldBeNil)
+
+			attemptCtx := <-attempts
+			So(attemptCtx.Value(router.UserIDContextKey), ShouldEqual, "user0")
+			So((<-attempts).Value(router.UserIDContextKey), ShouldEqual, "user0")
+		})
+
+		Convey("queued hook attempt is bounded by timeout", func() {
+			plugin.asyncAfterSave = true
+			plugin.hookTimeout = time.Millisecond
+			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
+				Async:   true,
+				Trigger: string(hook.AfterSave),
+				Type:    "note",
+				Name:    "note_afterSave",
+			})
+
+			attempts := make(chan context.Context, 1)
+			transport.RunHookFunc = func(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
+				<-ctx.Done()
+				attempts <- ctx
+				return nil, ctx.Err()
+			}
+
+			So(hookFunc(nil, &recordin, &originalRecord), ShouldBeNil)
+			attemptCtx := <-attempts
+			_, hasDeadline := attemptCtx.Deadline()
+			So(hasDeadline, ShouldBeTrue)
+			So(attemptCtx.Err(), ShouldEqual, context.DeadlineExceeded)
+		})
+
+		Convey("queued after commit with a copy of the record", func() {
+			plugin.asyncAfterSave = true
+			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
+				Async:   false,
+				Trigger: string(hook.AfterSave),
+				Type:    "note",
+				Name:    "note_afterSave",
+			})
+
+			records := make(chan *skydb.Record, 1)
+			transport.RunHookFunc = func(ctx context.Context, hookName string, record *skydb.Record, originalRecord *skydb.Record) (*skydb.Record, error) {
+				records <- record
+				return nil, nil
+			}
+
+			recordin.Data = skydb.Data{"content": "hello"}
+			ctx, pending := hook.WithPending(context.Background())
+			So(hookFunc(ctx, &recordin, &originalRecord), ShouldBeNil)
+			recordin.Data["content"] = "modified"
+
+			select {
+			case <-records:
+				So("hook queued before commit", ShouldBeEmpty)
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			pending.Run()
+			record := <-records
+			So(record, ShouldNotEqual, &recordin)
+			So(record.Data, ShouldResemble, skydb.Data{"content": "hello"})
+		})
+
 		Convey("synced after save", func() {
 			hookFunc := CreateHookFunc(&plugin, pluginHookInfo{
 				Async:   false,
@@ -119,3 +262,37 @@ func TestCreateHookFunc(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateQueryHookFunc(t *testing.T) {
+	Convey("CreateQueryHookFunc", t, func() {
+		transport := &hookOnlyTransport{}
+		plugin := Plugin{transport: transport}
+		hookFunc := CreateQueryHookFunc(&plugin, pluginHookInfo{
+			Trigger: string(hook.BeforeQuery),
+			Type:    "note",
+			Name:    "note_beforeQuery",
+		})
+
+		Convey("returns the query of plugin", func() {
+			transport.RunQueryHookFunc = func(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+				So(hookName, ShouldEqual, "note_beforeQuery")
+				So(query, ShouldResemble, map[string]interface{}{"record_type": "note"})
+				return map[string]interface{}{"record_type": "note", "limit": float64(1)}, nil
+			}
+
+			query, err := hookFunc(nil, map[string]interface{}{"record_type": "note"})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, map[string]interface{}{"record_type": "note", "limit": float64(1)})
+		})
+
+		Convey("returns the error of plugin", func() {
+			transport.RunQueryHookFunc = func(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+				return nil, errors.New("exit status 1")
+			}
+
+			query, err := hookFunc(nil, map[string]interface{}{"record_type": "note"})
+			So(query, ShouldBeNil)
+			So(err.Error(), ShouldEqual, "UnexpectedError: exit status 1")
+		})
+	})
+}
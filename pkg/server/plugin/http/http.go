@@ -151,6 +151,21 @@ func (p *httpTransport) RunHook(ctx context.Context, hookName string, record *sk
 	return &recordout, nil
 }
 
+func (p *httpTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	out, err := p.rpc(pluginrequest.NewQueryHookRequest(ctx, hookName, query))
+	if err != nil {
+		return nil, err
+	}
+
+	var queryout map[string]interface{}
+	if err := json.Unmarshal(out, &queryout); err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, fmt.Errorf("failed to unmarshal query: %v", err)
+	}
+
+	return queryout, nil
+}
+
 func (p *httpTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	req := pluginrequest.NewTimerRequest(name)
 	out, err = p.rpc(req)
@@ -175,12 +190,16 @@ type httpTransportFactory struct {
 }
 
 func (f httpTransportFactory) Open(path string, args []string, config skyconfig.Configuration) (transport skyplugin.Transport) {
+	// Plugins are not external services, so requests to them do not go
+	// through the outbound transport installed as the default.
 	transport = &httpTransport{
-		Path:       path,
-		Args:       args,
-		state:      skyplugin.TransportStateUninitialized,
-		httpClient: http.Client{},
-		config:     config,
+		Path:  path,
+		Args:  args,
+		state: skyplugin.TransportStateUninitialized,
+		httpClient: http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+		config: config,
 	}
 	return
 }
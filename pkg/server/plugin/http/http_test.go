@@ -313,6 +313,28 @@ func TestRun(t *testing.T) {
 			So(dateout == time.Date(2017, 7, 23, 19, 30, 24, 0, time.UTC), ShouldBeTrue)
 		})
 
+		Convey("run query hook", func() {
+			ctx := context.WithValue(context.Background(), router.UserIDContextKey, "user")
+			httpmock.RegisterResponder("POST", "http://localhost:8000",
+				func(req *http.Request) (*http.Response, error) {
+					out, _ := ioutil.ReadAll(req.Body)
+					So(out, ShouldEqualJSON, `{"context":{"user_id":"user"},"kind":"hook","name":"note_beforeQuery","param":{"query":{"record_type":"note"}}}`)
+					return httpmock.NewJsonResponse(200, map[string]interface{}{
+						"result": map[string]interface{}{"record_type": "note", "limit": 1},
+					})
+				},
+			)
+
+			query, err := transport.RunQueryHook(ctx, "note_beforeQuery", map[string]interface{}{
+				"record_type": "note",
+			})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, map[string]interface{}{
+				"record_type": "note",
+				"limit":       float64(1),
+			})
+		})
+
 		Convey("run timer", func() {
 			httpmock.RegisterResponder("POST", "http://localhost:8000",
 				func(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,235 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// RequestInspector inspects the request to a plugin handler before it
+// is forwarded to the plugin, so that a public handler cannot be used
+// to push unwanted payloads into the plugin process.
+type RequestInspector interface {
+	// InspectRequest returns an error to reject the request. body is
+	// the request body, which is within the size limit of the handler.
+	InspectRequest(ctx context.Context, handlerName string, req *http.Request, body []byte) skyerr.Error
+}
+
+// RequestInspectorFunc is an adapter to use an ordinary function as a
+// RequestInspector.
+type RequestInspectorFunc func(ctx context.Context, handlerName string, req *http.Request, body []byte) skyerr.Error
+
+// InspectRequest calls f(ctx, handlerName, req, body).
+func (f RequestInspectorFunc) InspectRequest(ctx context.Context, handlerName string, req *http.Request, body []byte) skyerr.Error {
+	return f(ctx, handlerName, req, body)
+}
+
+// RequestLimits are the checks applied to every request of a plugin
+// handler.
+type RequestLimits struct {
+	// MaxBodySize is the maximum number of bytes of the request body.
+	// Zero means unlimited.
+	MaxBodySize int64
+
+	// ContentTypes are the media types accepted for a request with a
+	// body, such as "application/json" or "image/*". Any media type is
+	// accepted if empty.
+	ContentTypes []string
+
+	// Schema, if not nil, requires the request body to be a JSON object
+	// conforming to the schema.
+	Schema router.PayloadSchema
+}
+
+// newRequestLimits returns the limits of a handler registered with info,
+// which can only tighten the limits configured for the server.
+func newRequestLimits(info pluginHandlerInfo, serverLimits RequestLimits) RequestLimits {
+	limits := serverLimits
+	if info.MaxBodySize > 0 && (limits.MaxBodySize == 0 || info.MaxBodySize < limits.MaxBodySize) {
+		limits.MaxBodySize = info.MaxBodySize
+	}
+	if len(info.ContentTypes) > 0 {
+		if len(limits.ContentTypes) == 0 {
+			limits.ContentTypes = info.ContentTypes
+		} else {
+			contentTypes := []string{}
+			for _, contentType := range info.ContentTypes {
+				if matchMediaType(contentType, limits.ContentTypes) {
+					contentTypes = append(contentTypes, contentType)
+				}
+			}
+			if len(contentTypes) > 0 {
+				limits.ContentTypes = contentTypes
+			} else {
+				log.Warnf(`Ignoring content types of handler "%s" not accepted by the server`, info.Name)
+			}
+		}
+	}
+	if len(info.Schema) > 0 {
+		limits.Schema = make(router.PayloadSchema, len(info.Schema))
+		for i, field := range info.Schema {
+			limits.Schema[i] = router.Field{
+				Name:     field.Name,
+				Type:     parseFieldType(field.Type),
+				Required: field.Required,
+			}
+		}
+	}
+	return limits
+}
+
+// ReadBody reads the request body up to MaxBodySize, returning a
+// RequestTooLarge error without reading the rest if it is larger.
+func (l RequestLimits) ReadBody(r io.Reader) ([]byte, skyerr.Error) {
+	if l.MaxBodySize > 0 {
+		r = io.LimitReader(r, l.MaxBodySize+1)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, skyerr.NewErrorf(skyerr.BadRequest, "unable to read request body: %v", err)
+	}
+	if l.MaxBodySize > 0 && int64(len(body)) > l.MaxBodySize {
+		return nil, skyerr.NewErrorWithInfo(
+			skyerr.RequestTooLarge,
+			fmt.Sprintf("request body must not exceed %d bytes", l.MaxBodySize),
+			map[string]interface{}{"limit": l.MaxBodySize},
+		)
+	}
+	return body, nil
+}
+
+// InspectRequest checks the content type of a request with a body, and
+// validates the body against the schema.
+func (l RequestLimits) InspectRequest(ctx context.Context, handlerName string, req *http.Request, body []byte) skyerr.Error {
+	if len(body) == 0 {
+		if l.Schema != nil {
+			return l.Schema.Validate(map[string]interface{}{})
+		}
+		return nil
+	}
+
+	if len(l.ContentTypes) > 0 {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !matchMediaType(mediaType, l.ContentTypes) {
+			return skyerr.NewErrorf(skyerr.BadRequest, "content type must be one of %s", strings.Join(l.ContentTypes, ", "))
+		}
+	}
+
+	if l.Schema != nil {
+		data := map[string]interface{}{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return skyerr.NewError(skyerr.BadRequest, "request body must be a JSON object")
+		}
+		return l.Schema.Validate(data)
+	}
+	return nil
+}
+
+// matchMediaType returns whether mediaType is one of the patterns, which
+// can be a media type or a type with a wildcard subtype such as image/*.
+func matchMediaType(mediaType string, patterns []string) bool {
+	mediaType = strings.ToLower(mediaType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFieldType(name string) router.FieldType {
+	switch name {
+	case "string":
+		return router.StringField
+	case "number":
+		return router.NumberField
+	case "boolean":
+		return router.BooleanField
+	case "object":
+		return router.MapField
+	case "array":
+		return router.ArrayField
+	default:
+		return router.AnyField
+	}
+}
+
+// LambdaRequestInspector delegates inspection to the plugin lambda of
+// Name, such as a virus or secret scanner. The lambda is called with
+// the handler name, method, path, header and body of the request, and
+// returns {"allowed": true} to forward the request, or
+// {"allowed": false, "reason": "..."} to reject it.
+type LambdaRequestInspector struct {
+	Name   string
+	Runner interface {
+		RunLambda(ctx context.Context, name string, in []byte) ([]byte, error)
+	}
+}
+
+// InspectRequest implements RequestInspector.
+func (i *LambdaRequestInspector) InspectRequest(ctx context.Context, handlerName string, req *http.Request, body []byte) skyerr.Error {
+	in, err := json.Marshal(struct {
+		Handler string              `json:"handler"`
+		Method  string              `json:"method"`
+		Path    string              `json:"path"`
+		Header  map[string][]string `json:"header"`
+		Body    []byte              `json:"body"`
+	}{
+		Handler: handlerName,
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Header:  req.Header,
+		Body:    body,
+	})
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+
+	out, err := i.Runner.RunLambda(ctx, i.Name, in)
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+
+	var result struct {
+		Allowed bool   `json:"allowed"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return skyerr.NewErrorf(skyerr.UnexpectedError, "malformed result of request inspector: %v", err)
+	}
+	if !result.Allowed {
+		message := "request is rejected by inspection"
+		if result.Reason != "" {
+			message += ": " + result.Reason
+		}
+		return skyerr.NewError(skyerr.BadRequest, message)
+	}
+	return nil
+}
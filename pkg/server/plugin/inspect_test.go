@@ -0,0 +1,211 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type lambdaRunnerFunc func(ctx context.Context, name string, in []byte) ([]byte, error)
+
+func (f lambdaRunnerFunc) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	return f(ctx, name, in)
+}
+
+func newInspectedRequest(contentType string, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://skygear.test/webhook/stripe", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req
+}
+
+func TestRequestLimits(t *testing.T) {
+	Convey("RequestLimits", t, func() {
+		ctx := context.Background()
+
+		Convey("reads body within size limit", func() {
+			limits := RequestLimits{MaxBodySize: 5}
+			body, err := limits.ReadBody(strings.NewReader("hello"))
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, "hello")
+		})
+
+		Convey("rejects body exceeding size limit", func() {
+			limits := RequestLimits{MaxBodySize: 5}
+			_, err := limits.ReadBody(strings.NewReader("hello world"))
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.RequestTooLarge)
+			So(err.Info(), ShouldResemble, map[string]interface{}{"limit": int64(5)})
+		})
+
+		Convey("reads body of any size without limit", func() {
+			limits := RequestLimits{}
+			body, err := limits.ReadBody(strings.NewReader(strings.Repeat("a", 4096)))
+			So(err, ShouldBeNil)
+			So(body, ShouldHaveLength, 4096)
+		})
+
+		Convey("checks content type", func() {
+			limits := RequestLimits{ContentTypes: []string{"application/json", "image/*"}}
+
+			req := newInspectedRequest("application/json; charset=utf-8", `{}`)
+			So(limits.InspectRequest(ctx, "webhook:stripe", req, []byte(`{}`)), ShouldBeNil)
+
+			req = newInspectedRequest("image/PNG", "png")
+			So(limits.InspectRequest(ctx, "webhook:stripe", req, []byte("png")), ShouldBeNil)
+
+			req = newInspectedRequest("text/plain", "hello")
+			err := limits.InspectRequest(ctx, "webhook:stripe", req, []byte("hello"))
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.BadRequest)
+			So(err.Message(), ShouldEqual, "content type must be one of application/json, image/*")
+
+			req = newInspectedRequest("", "hello")
+			So(limits.InspectRequest(ctx, "webhook:stripe", req, []byte("hello")), ShouldNotBeNil)
+		})
+
+		Convey("accepts request without body of any content type", func() {
+			limits := RequestLimits{ContentTypes: []string{"application/json"}}
+			req := newInspectedRequest("", "")
+			So(limits.InspectRequest(ctx, "webhook:stripe", req, []byte{}), ShouldBeNil)
+		})
+
+		Convey("validates body against schema", func() {
+			limits := RequestLimits{
+				Schema: router.PayloadSchema{
+					{Name: "type", Type: router.StringField, Required: true},
+				},
+			}
+
+			body := []byte(`{"type": "charge.succeeded"}`)
+			So(limits.InspectRequest(ctx, "webhook:stripe", newInspectedRequest("application/json", string(body)), body), ShouldBeNil)
+
+			body = []byte(`{"type": 1}`)
+			err := limits.InspectRequest(ctx, "webhook:stripe", newInspectedRequest("application/json", string(body)), body)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.InvalidArgument)
+
+			body = []byte(`not json`)
+			err = limits.InspectRequest(ctx, "webhook:stripe", newInspectedRequest("application/json", string(body)), body)
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, "request body must be a JSON object")
+
+			err = limits.InspectRequest(ctx, "webhook:stripe", newInspectedRequest("", ""), []byte{})
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+	})
+
+	Convey("newRequestLimits", t, func() {
+		serverLimits := RequestLimits{
+			MaxBodySize:  1024,
+			ContentTypes: []string{"application/json", "image/*"},
+		}
+
+		Convey("uses server limits by default", func() {
+			limits := newRequestLimits(pluginHandlerInfo{Name: "webhook:stripe"}, serverLimits)
+			So(limits, ShouldResemble, serverLimits)
+		})
+
+		Convey("lowers but does not raise max body size", func() {
+			limits := newRequestLimits(pluginHandlerInfo{MaxBodySize: 512}, serverLimits)
+			So(limits.MaxBodySize, ShouldEqual, 512)
+
+			limits = newRequestLimits(pluginHandlerInfo{MaxBodySize: 4096}, serverLimits)
+			So(limits.MaxBodySize, ShouldEqual, 1024)
+
+			limits = newRequestLimits(pluginHandlerInfo{MaxBodySize: 4096}, RequestLimits{})
+			So(limits.MaxBodySize, ShouldEqual, 4096)
+		})
+
+		Convey("narrows content types to those accepted by server", func() {
+			limits := newRequestLimits(pluginHandlerInfo{
+				ContentTypes: []string{"image/png", "text/plain"},
+			}, serverLimits)
+			So(limits.ContentTypes, ShouldResemble, []string{"image/png"})
+
+			limits = newRequestLimits(pluginHandlerInfo{
+				ContentTypes: []string{"text/plain"},
+			}, serverLimits)
+			So(limits.ContentTypes, ShouldResemble, serverLimits.ContentTypes)
+		})
+
+		Convey("parses schema", func() {
+			limits := newRequestLimits(pluginHandlerInfo{
+				Schema: []pluginFieldInfo{
+					{Name: "type", Type: "string", Required: true},
+					{Name: "data", Type: "object"},
+					{Name: "extra", Type: "unknown"},
+				},
+			}, serverLimits)
+			So(limits.Schema, ShouldResemble, router.PayloadSchema{
+				{Name: "type", Type: router.StringField, Required: true},
+				{Name: "data", Type: router.MapField},
+				{Name: "extra", Type: router.AnyField},
+			})
+		})
+	})
+}
+
+func TestLambdaRequestInspector(t *testing.T) {
+	Convey("LambdaRequestInspector", t, func() {
+		var lambdaName string
+		var lambdaIn map[string]interface{}
+		lambdaOut := `{"allowed": true}`
+		var lambdaErr error
+		inspector := &LambdaRequestInspector{
+			Name: "webhook:inspect",
+			Runner: lambdaRunnerFunc(func(ctx context.Context, name string, in []byte) ([]byte, error) {
+				lambdaName = name
+				json.Unmarshal(in, &lambdaIn)
+				return []byte(lambdaOut), lambdaErr
+			}),
+		}
+		req := newInspectedRequest("application/json", `{"secret": "AKIA"}`)
+		body := []byte(`{"secret": "AKIA"}`)
+
+		Convey("calls lambda with request", func() {
+			So(inspector.InspectRequest(context.Background(), "webhook:stripe", req, body), ShouldBeNil)
+			So(lambdaName, ShouldEqual, "webhook:inspect")
+			So(lambdaIn["handler"], ShouldEqual, "webhook:stripe")
+			So(lambdaIn["method"], ShouldEqual, "POST")
+			So(lambdaIn["path"], ShouldEqual, "/webhook/stripe")
+			So(lambdaIn["body"], ShouldEqual, "eyJzZWNyZXQiOiAiQUtJQSJ9")
+		})
+
+		Convey("rejects request not allowed by lambda", func() {
+			lambdaOut = `{"allowed": false, "reason": "contains secret"}`
+			err := inspector.InspectRequest(context.Background(), "webhook:stripe", req, body)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.BadRequest)
+			So(err.Message(), ShouldEqual, "request is rejected by inspection: contains secret")
+		})
+
+		Convey("rejects request if lambda fails", func() {
+			lambdaErr = errors.New("scanner unavailable")
+			So(inspector.InspectRequest(context.Background(), "webhook:stripe", req, body), ShouldNotBeNil)
+		})
+	})
+}
@@ -15,10 +15,13 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 
+	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
@@ -67,14 +70,16 @@ func (h *LambdaHandler) GetPreprocessors() []router.Processor {
 }
 
 // Handle executes lambda function implemented by the plugin.
-func (h *LambdaHandler) Handle(payload *router.Payload, response *router.Response) {
+func (h *LambdaHandler) Handle(ctx context.Context, payload *router.Payload, response *router.Response) {
 	inbytes, err := json.Marshal(payload.Data)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
 
-	outbytes, err := h.Plugin.transport.RunLambda(payload.Context, h.Name, inbytes)
+	startTime := time.Now()
+	outbytes, err := h.Plugin.transport.RunLambda(ctx, h.Name, inbytes)
+	observeCall(ctx, h.Plugin, "lambda", h.Name, startTime, err)
 	if err != nil {
 		switch e := err.(type) {
 		case skyerr.Error:
@@ -91,7 +96,7 @@ func (h *LambdaHandler) Handle(payload *router.Payload, response *router.Respons
 		response.Err = skyerr.MakeError(err)
 		return
 	}
-	log.WithFields(logrus.Fields{
+	logging.WithContext(ctx, log).WithFields(logrus.Fields{
 		"name":   h.Name,
 		"input":  payload.Data,
 		"result": result,
@@ -110,3 +110,22 @@ func TestLambdaHandler(t *testing.T) {
 
 	})
 }
+
+func TestContextRunLambda(t *testing.T) {
+	Convey("Context runs lambda registered by plugin", t, func() {
+		plugin := Plugin{
+			transport: &nullTransport{},
+			lambdas:   []string{"captcha:verify"},
+		}
+		pluginContext := Context{
+			plugins: []*Plugin{&plugin},
+		}
+
+		out, err := pluginContext.RunLambda(context.Background(), "captcha:verify", []byte(`{"token":"abc"}`))
+		So(err, ShouldBeNil)
+		So(out, ShouldEqualJSON, `{"token":"abc"}`)
+
+		_, err = pluginContext.RunLambda(context.Background(), "hello:world", []byte(`{}`))
+		So(err, ShouldNotBeNil)
+	})
+}
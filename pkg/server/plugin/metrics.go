@@ -0,0 +1,56 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+)
+
+var pluginCallDuration = metrics.NewHistogram(
+	"skygear_plugin_call_duration_seconds",
+	"Duration of hook and lambda invocations of plugins.",
+	"plugin", "kind", "name", "result",
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(pluginCallDuration)
+}
+
+// observeCall records the duration and result of a plugin invocation
+// started at startTime, and attaches it to the trace of ctx if any.
+func observeCall(ctx context.Context, p *Plugin, kind string, name string, startTime time.Time, err error) {
+	duration := time.Since(startTime)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	pluginCallDuration.Observe(duration.Seconds(), p.Name(), kind, name, result)
+
+	span := metrics.Span{
+		Name: "plugin:" + kind,
+		Labels: map[string]string{
+			"plugin": p.Name(),
+			"name":   name,
+		},
+		Duration: duration,
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+	metrics.TraceFromContext(ctx).AddSpan(span)
+}
@@ -0,0 +1,52 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/plugin/observer"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+var recordEventNames = map[skydb.RecordHookEvent]string{
+	skydb.RecordCreated: "create",
+	skydb.RecordUpdated: "update",
+	skydb.RecordDeleted: "delete",
+}
+
+// CreateObserverFunc returns an observer.Func that sends the observed
+// record event to a plugin as an "observer" event, with the name of the
+// observer registered by the plugin.
+func CreateObserverFunc(p *Plugin, info observerInfo) observer.Func {
+	return func(event skydb.RecordEvent) error {
+		data, err := json.Marshal(struct {
+			Name   string              `json:"name"`
+			Event  string              `json:"event"`
+			Record *skyconv.JSONRecord `json:"record"`
+		}{info.Name, recordEventNames[event.Event], (*skyconv.JSONRecord)(event.Record)})
+		if err != nil {
+			return err
+		}
+
+		startTime := time.Now()
+		_, err = p.transport.SendEvent("observer", data)
+		observeCall(context.Background(), p, "observer", info.Name, startTime, err)
+		return err
+	}
+}
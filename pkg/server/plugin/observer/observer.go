@@ -0,0 +1,120 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package observer notifies plugins of record changes matching queries
+// they observe, independent of any device subscription.
+package observer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("plugin")
+
+// Func is invoked with a record event matching the observed query.
+type Func func(event skydb.RecordEvent) error
+
+// QueryParseFunc parses a query in the format of record:query payload.
+type QueryParseFunc func(rawQuery map[string]interface{}) (skydb.Query, error)
+
+type observer struct {
+	name  string
+	query skydb.Query
+	f     Func
+}
+
+// Registry is a registry of observers by record type.
+type Registry struct {
+	mutex      sync.RWMutex
+	parseQuery QueryParseFunc
+	observers  map[string][]observer
+}
+
+// NewRegistry returns a Registry ready for use, which parses queries of
+// observers with parseQuery.
+func NewRegistry(parseQuery QueryParseFunc) *Registry {
+	return &Registry{
+		parseQuery: parseQuery,
+		observers:  map[string][]observer{},
+	}
+}
+
+// Register adds an observer to be invoked when a record matching the
+// query is created, updated or deleted.
+//
+// Records are matched without querying the database, so only predicates
+// with equality, inequality and in operators are supported.
+func (r *Registry) Register(name string, rawQuery map[string]interface{}, f Func) error {
+	query, err := r.parseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	if !query.Predicate.CanMatchRecord() {
+		return fmt.Errorf("observer %s: predicate is not supported", name)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.observers[query.Type] = append(r.observers[query.Type], observer{name, query, f})
+	return nil
+}
+
+// Observe invokes observers of the record type whose query matches the
+// record of the event. Observers are invoked one after another, and a
+// failure of one does not stop others from being invoked. The error of
+// the last failed observer is returned.
+//
+// An observer the event was delivered to before is not invoked again.
+//
+// A nil Registry observes nothing.
+func (r *Registry) Observe(event skydb.RecordEvent) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.RLock()
+	observers := make([]observer, len(r.observers[event.Record.ID.Type]))
+	copy(observers, r.observers[event.Record.ID.Type])
+	r.mutex.RUnlock()
+
+	var lastErr error
+	for _, o := range observers {
+		if !o.query.Predicate.MatchRecord(event.Record) {
+			continue
+		}
+
+		receiver := "observer:" + o.name
+		if event.IsDelivered(receiver) {
+			continue
+		}
+
+		if err := o.f(event); err != nil {
+			log.WithFields(logrus.Fields{
+				"observer": o.name,
+				"record":   event.Record.ID.String(),
+				"err":      err,
+			}).Errorln("failed to notify observer")
+			lastErr = err
+			continue
+		}
+		event.MarkDelivered(receiver)
+	}
+	return lastErr
+}
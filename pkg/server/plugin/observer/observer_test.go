@@ -0,0 +1,159 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// parseCategoryQuery parses a query of record type with an optional
+// equality predicate on category.
+func parseCategoryQuery(rawQuery map[string]interface{}) (skydb.Query, error) {
+	query := skydb.Query{}
+	query.Type, _ = rawQuery["record_type"].(string)
+	if query.Type == "" {
+		return query, errors.New("record_type is required")
+	}
+
+	switch category := rawQuery["category"].(type) {
+	case string:
+		query.Predicate = skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+				skydb.Expression{Type: skydb.Literal, Value: category},
+			},
+		}
+	case float64:
+		query.Predicate = skydb.Predicate{
+			Operator: skydb.GreaterThan,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+				skydb.Expression{Type: skydb.Literal, Value: category},
+			},
+		}
+	}
+	return query, nil
+}
+
+type deliveryLog map[string]bool
+
+func (d deliveryLog) IsDelivered(receiver string) bool { return d[receiver] }
+
+func (d deliveryLog) MarkDelivered(receiver string) { d[receiver] = true }
+
+func TestRegistry(t *testing.T) {
+	Convey("Registry", t, func() {
+		registry := NewRegistry(parseCategoryQuery)
+
+		observed := []string{}
+		observe := func(name string) Func {
+			return func(event skydb.RecordEvent) error {
+				observed = append(observed, name+":"+event.Record.ID.Key)
+				return nil
+			}
+		}
+
+		So(registry.Register("all_notes", map[string]interface{}{
+			"record_type": "note",
+		}, observe("all_notes")), ShouldBeNil)
+		So(registry.Register("recipes", map[string]interface{}{
+			"record_type": "note",
+			"category":    "recipe",
+		}, observe("recipes")), ShouldBeNil)
+
+		Convey("invokes observers matching the record", func() {
+			registry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{
+					ID:   skydb.NewRecordID("note", "1"),
+					Data: skydb.Data{"category": "recipe"},
+				},
+				Event: skydb.RecordCreated,
+			})
+			registry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{
+					ID:   skydb.NewRecordID("note", "2"),
+					Data: skydb.Data{"category": "fiction"},
+				},
+				Event: skydb.RecordUpdated,
+			})
+			registry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{
+					ID:   skydb.NewRecordID("book", "1"),
+					Data: skydb.Data{"category": "recipe"},
+				},
+				Event: skydb.RecordDeleted,
+			})
+
+			So(observed, ShouldResemble, []string{"all_notes:1", "recipes:1", "all_notes:2"})
+		})
+
+		Convey("continues after an observer fails", func() {
+			So(registry.Register("failing", map[string]interface{}{
+				"record_type": "book",
+			}, func(event skydb.RecordEvent) error {
+				return errors.New("plugin unavailable")
+			}), ShouldBeNil)
+			So(registry.Register("books", map[string]interface{}{
+				"record_type": "book",
+			}, observe("books")), ShouldBeNil)
+
+			err := registry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{ID: skydb.NewRecordID("book", "1")},
+				Event:  skydb.RecordCreated,
+			})
+			So(err, ShouldNotBeNil)
+			So(observed, ShouldResemble, []string{"books:1"})
+		})
+
+		Convey("skips observers the event was delivered to", func() {
+			deliveries := deliveryLog{"observer:all_notes": true}
+			err := registry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{
+					ID:   skydb.NewRecordID("note", "1"),
+					Data: skydb.Data{"category": "recipe"},
+				},
+				Event:      skydb.RecordCreated,
+				Deliveries: deliveries,
+			})
+			So(err, ShouldBeNil)
+			So(observed, ShouldResemble, []string{"recipes:1"})
+			So(deliveries, ShouldResemble, deliveryLog{
+				"observer:all_notes": true,
+				"observer:recipes":   true,
+			})
+		})
+
+		Convey("rejects invalid query", func() {
+			So(registry.Register("invalid", map[string]interface{}{}, observe("invalid")), ShouldNotBeNil)
+			So(registry.Register("unsupported", map[string]interface{}{
+				"record_type": "note",
+				"category":    float64(1),
+			}, observe("unsupported")), ShouldNotBeNil)
+		})
+
+		Convey("observes nothing if nil", func() {
+			var nilRegistry *Registry
+			nilRegistry.Observe(skydb.RecordEvent{
+				Record: &skydb.Record{ID: skydb.NewRecordID("note", "1")},
+				Event:  skydb.RecordCreated,
+			})
+		})
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type eventOnlyTransport struct {
+	SendEventFunc func(string, []byte) ([]byte, error)
+	Transport
+}
+
+func (t *eventOnlyTransport) SendEvent(name string, in []byte) ([]byte, error) {
+	return t.SendEventFunc(name, in)
+}
+
+func TestCreateObserverFunc(t *testing.T) {
+	Convey("CreateObserverFunc", t, func() {
+		transport := &eventOnlyTransport{}
+		plugin := Plugin{name: "observing", transport: transport}
+		observerFunc := CreateObserverFunc(&plugin, observerInfo{Name: "recipes"})
+
+		event := skydb.RecordEvent{
+			Record: &skydb.Record{
+				ID:   skydb.NewRecordID("note", "1"),
+				Data: skydb.Data{"category": "recipe"},
+			},
+			Event: skydb.RecordUpdated,
+		}
+
+		Convey("sends observer event", func() {
+			var eventName string
+			var eventData []byte
+			transport.SendEventFunc = func(name string, in []byte) ([]byte, error) {
+				eventName = name
+				eventData = in
+				return nil, nil
+			}
+
+			So(observerFunc(event), ShouldBeNil)
+			So(eventName, ShouldEqual, "observer")
+			So(eventData, ShouldEqualJSON, `{
+				"name": "recipes",
+				"event": "update",
+				"record": {
+					"_id": "note/1",
+					"_type": "record",
+					"_access": null,
+					"category": "recipe"
+				}
+			}`)
+		})
+
+		Convey("returns error of transport", func() {
+			transport.SendEventFunc = func(name string, in []byte) ([]byte, error) {
+				return nil, errors.New("plugin unavailable")
+			}
+
+			So(observerFunc(event), ShouldNotBeNil)
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -27,9 +28,11 @@ import (
 	"github.com/robfig/cron"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/observer"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
 var log = logging.LoggerEntry("plugin")
@@ -42,9 +45,16 @@ const (
 // Plugin represents a collection of handlers, hooks and lambda functions
 // that extends or modifies functionality provided by skygear.
 type Plugin struct {
+	name           string
 	initRetryCount int
 	transport      Transport
 	gatewayMap     map[string]*router.Gateway
+	lambdas        []string
+	registrations  *registrationSet
+	hookQueue      *workqueue.Queue
+	hookRetry      workqueue.RetryPolicy
+	hookTimeout    time.Duration
+	asyncAfterSave bool
 }
 
 type pluginHandlerInfo struct {
@@ -53,13 +63,25 @@ type pluginHandlerInfo struct {
 	Methods      []string `json:"methods"`
 	KeyRequired  bool     `json:"key_required"`
 	UserRequired bool     `json:"user_required"`
+
+	// limits tightening the RequestLimits of the server
+	MaxBodySize  int64             `json:"max_body_size"`
+	ContentTypes []string          `json:"content_types"`
+	Schema       []pluginFieldInfo `json:"schema"`
+}
+
+type pluginFieldInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // string, number, boolean, object, array or any
+	Required bool   `json:"required"`
 }
 
 type pluginHookInfo struct {
-	Async   bool   `json:"async"`   // execute hook asynchronously
-	Trigger string `json:"trigger"` // before_save etc.
-	Type    string `json:"type"`    // record type
-	Name    string `json:"name"`    // hook name
+	Async    bool   `json:"async"`    // execute hook asynchronously
+	Trigger  string `json:"trigger"`  // before_save etc.
+	Type     string `json:"type"`     // record type
+	Name     string `json:"name"`     // hook name
+	Priority string `json:"priority"` // priority class of async hook
 }
 
 type timerInfo struct {
@@ -67,6 +89,11 @@ type timerInfo struct {
 	Spec string `json:"spec"`
 }
 
+type observerInfo struct {
+	Name  string                 `json:"name"`
+	Query map[string]interface{} `json:"query"`
+}
+
 type providerInfo struct {
 	Type string `json:"type"`
 	Name string `json:"id"`
@@ -78,6 +105,7 @@ type registrationInfo struct {
 	Lambdas   []map[string]interface{} `json:"op"`
 	Timers    []timerInfo              `json:"timer"`
 	Providers []providerInfo           `json:"provider"`
+	Observers []observerInfo           `json:"observer"`
 }
 
 var transportFactories = map[string]TransportFactory{}
@@ -107,22 +135,49 @@ func NewPlugin(name string, path string, args []string, config skyconfig.Configu
 		panic(fmt.Errorf("unable to find plugin transport '%v'", name))
 	}
 	p := Plugin{
-		transport:  factory.Open(path, args, config),
-		gatewayMap: map[string]*router.Gateway{},
+		name:          path,
+		transport:     factory.Open(path, args, config),
+		gatewayMap:    map[string]*router.Gateway{},
+		registrations: newRegistrationSet(),
 	}
 	return p
 }
 
+// Name returns the name identifying the plugin in metrics, traces and
+// logs. It defaults to the path of the plugin.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// SetName sets the name of the plugin, and passes it to the transport
+// if the transport is a NamedTransport.
+func (p *Plugin) SetName(name string) {
+	p.name = name
+	if transport, ok := p.transport.(NamedTransport); ok {
+		transport.SetName(name)
+	}
+}
+
 // Context contains reference to structs that will be initialized by plugin.
 type Context struct {
+	// mutex guards the lambdas of plugins, which are replaced when
+	// a plugin is reloaded
+	mutex sync.RWMutex
+
 	plugins          []*Plugin
 	Router           *router.Router
 	Mux              *http.ServeMux
 	Preprocessors    router.PreprocessorRegistry
 	HookRegistry     *hook.Registry
+	HookQueue        *workqueue.Queue
+	ObserverRegistry *observer.Registry
 	ProviderRegistry *provider.Registry
 	Scheduler        *cron.Cron
 	Config           skyconfig.Configuration
+
+	// RequestInspectors inspect the requests to plugin handlers, after
+	// the RequestLimits configured in Config are checked.
+	RequestInspectors []RequestInspector
 }
 
 // AddPluginConfiguration creates and appends a plugin
@@ -144,6 +199,16 @@ func (c *Context) getInitPayload() ([]byte, error) {
 func (c *Context) InitPlugins() {
 	wg := sync.WaitGroup{}
 	for _, eachPlugin := range c.plugins {
+		if transport, ok := eachPlugin.transport.(RestartNotifyingTransport); ok {
+			plug := eachPlugin
+			transport.NotifyRestart(func() {
+				log.WithField("plugin", plug.Name()).Warn("Plugin restarted, reloading")
+				if err := plug.Reload(c); err != nil {
+					log.WithField("error", err).Error("Fail to reload plugin")
+				}
+			})
+		}
+
 		wg.Add(1)
 		go func(plug *Plugin) {
 			defer wg.Done()
@@ -174,6 +239,27 @@ func (c *Context) InitPlugins() {
 	}()
 }
 
+// ReloadPlugins reloads all plugins that are ready, so that changes to
+// their registration take effect without restarting the server.
+func (c *Context) ReloadPlugins() {
+	wg := sync.WaitGroup{}
+	for _, eachPlugin := range c.plugins {
+		wg.Add(1)
+		go func(plug *Plugin) {
+			defer wg.Done()
+			if err := plug.Reload(c); err != nil {
+				log.WithFields(logrus.Fields{
+					"plugin": plug.Name(),
+					"error":  err,
+				}).Error("Fail to reload plugin")
+				return
+			}
+			log.WithField("plugin", plug.Name()).Info("Reloaded plugin")
+		}(eachPlugin)
+	}
+	wg.Wait()
+}
+
 // IsInitialized returns true if all the plugins have been initialized
 func (c *Context) IsInitialized() bool {
 	for _, eachPlugin := range c.plugins {
@@ -212,6 +298,33 @@ func (c *Context) SendEvent(name string, data []byte, async bool) {
 	}
 }
 
+// RunLambda runs the lambda of name registered by any of the plugins,
+// so that server components can delegate decisions to plugins.
+func (c *Context) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	plugin := c.lambdaPlugin(name)
+	if plugin == nil {
+		return nil, fmt.Errorf("plugin: lambda %s is not registered", name)
+	}
+
+	startTime := time.Now()
+	out, err := plugin.transport.RunLambda(ctx, name, in)
+	observeCall(ctx, plugin, "lambda", name, startTime, err)
+	return out, err
+}
+
+func (c *Context) lambdaPlugin(name string) *Plugin {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, eachPlugin := range c.plugins {
+		for _, lambda := range eachPlugin.lambdas {
+			if lambda == name {
+				return eachPlugin
+			}
+		}
+	}
+	return nil
+}
+
 // Init instantiates a plugin. This sets up hooks and handlers.
 func (p *Plugin) Init(context *Context) {
 	data, err := context.getInitPayload()
@@ -238,7 +351,7 @@ func (p *Plugin) Init(context *Context) {
 			continue
 		}
 
-		p.processRegistrationInfo(context, regInfo)
+		p.register(context, regInfo)
 		p.transport.SetState(TransportStateInitialized)
 
 		break
@@ -284,8 +397,15 @@ func (p *Plugin) processRegistrationInfo(context *Context, regInfo registrationI
 		"regInfo":   regInfo,
 		"transport": p.transport,
 	}).Debugln("Got configuration from plugin, registering")
-	p.initHandler(context.Mux, context.Preprocessors, regInfo.Handlers, context.Config)
+	p.initHandler(context.Mux, context.Preprocessors, regInfo.Handlers, context.Config, context.RequestInspectors)
 	p.initLambda(context.Router, context.Preprocessors, regInfo.Lambdas)
+	p.hookQueue = context.HookQueue
+	p.hookRetry = workqueue.RetryPolicy{
+		MaxAttempts: context.Config.WorkQueue.HookMaxAttempts,
+		Backoff:     time.Duration(context.Config.WorkQueue.HookRetryBackoff) * time.Millisecond,
+	}
+	p.hookTimeout = time.Duration(context.Config.WorkQueue.HookTimeout) * time.Millisecond
+	p.asyncAfterSave = context.Config.WorkQueue.AsyncAfterSaveHooks
 	p.initHook(context.HookRegistry, regInfo.Hooks)
 	if context.Scheduler != nil {
 		p.initTimer(context.Scheduler, regInfo.Timers)
@@ -293,11 +413,20 @@ func (p *Plugin) processRegistrationInfo(context *Context, regInfo registrationI
 		log.Info("Ignoring scheduled cron jobs because server is in slave mode.")
 	}
 	p.initProvider(context.ProviderRegistry, regInfo.Providers)
+	if context.ObserverRegistry != nil {
+		p.initObserver(context.ObserverRegistry, regInfo.Observers)
+	}
 }
 
-func (p *Plugin) initHandler(mux *http.ServeMux, ppreg router.PreprocessorRegistry, handlers []pluginHandlerInfo, config skyconfig.Configuration) {
+func (p *Plugin) initHandler(mux *http.ServeMux, ppreg router.PreprocessorRegistry, handlers []pluginHandlerInfo, config skyconfig.Configuration, inspectors []RequestInspector) {
+	serverLimits := RequestLimits{
+		MaxBodySize:  config.PluginHandler.MaxBodySize,
+		ContentTypes: config.PluginHandler.ContentTypes,
+	}
 	for _, handler := range handlers {
 		h := NewPluginHandler(handler, ppreg, p)
+		h.Limits = newRequestLimits(handler, serverLimits)
+		h.Inspectors = inspectors
 		h.Setup()
 		name := h.Name
 		name = strings.Replace(name, ":", "/", -1)
@@ -323,26 +452,41 @@ func (p *Plugin) initLambda(r *router.Router, ppreg router.PreprocessorRegistry,
 		handler := NewLambdaHandler(lambda, ppreg, p)
 		handler.Setup()
 		r.Map(handler.Name, handler)
+		p.lambdas = append(p.lambdas, handler.Name)
 		log.Debugf(`Registered lambda "%s" with router.`, handler.Name)
 	}
 }
 
 func (p *Plugin) initHook(registry *hook.Registry, hookInfos []pluginHookInfo) {
 	for _, hookInfo := range hookInfos {
+		key := fmt.Sprintf("hook:%+v", hookInfo)
+		if !p.registrations.install(key) {
+			continue
+		}
+
 		kind := hook.Kind(hookInfo.Trigger)
 		recordType := hookInfo.Type
 
-		registry.Register(kind, recordType, CreateHookFunc(p, hookInfo))
+		if kind == hook.BeforeQuery {
+			registry.RegisterQueryHook(recordType, p.registrations.queryHookFunc(key, CreateQueryHookFunc(p, hookInfo)))
+			continue
+		}
+		registry.Register(kind, recordType, p.registrations.hookFunc(key, CreateHookFunc(p, hookInfo)))
 	}
 }
 
 func (p *Plugin) initTimer(c *cron.Cron, timerInfos []timerInfo) {
 	for _, timerInfo := range timerInfos {
+		key := fmt.Sprintf("timer:%+v", timerInfo)
+		if !p.registrations.install(key) {
+			continue
+		}
+
 		timerName := timerInfo.Name
-		err := c.AddFunc(timerInfo.Spec, func() {
+		err := c.AddFunc(timerInfo.Spec, p.registrations.timerFunc(key, func() {
 			output, _ := p.transport.RunTimer(timerName, []byte{})
 			log.Debugf("Executed a timer{%v} with result: %s", timerName, output)
-		})
+		}))
 
 		if err != nil {
 			panic(fmt.Errorf(`unable to add timer for "%s": %s`, timerName, err))
@@ -350,6 +494,24 @@ func (p *Plugin) initTimer(c *cron.Cron, timerInfos []timerInfo) {
 	}
 }
 
+func (p *Plugin) initObserver(registry *observer.Registry, observerInfos []observerInfo) {
+	for _, observerInfo := range observerInfos {
+		query, _ := json.Marshal(observerInfo.Query)
+		key := fmt.Sprintf("observer:%s:%s", observerInfo.Name, query)
+		if !p.registrations.install(key) {
+			continue
+		}
+
+		err := registry.Register(observerInfo.Name, observerInfo.Query, p.registrations.observerFunc(key, CreateObserverFunc(p, observerInfo)))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"name": observerInfo.Name,
+				"err":  err,
+			}).Errorln("Failed to register observer")
+		}
+	}
+}
+
 func (p *Plugin) initProvider(registry *provider.Registry, providerInfos []providerInfo) {
 	for _, providerInfo := range providerInfos {
 		provider := NewAuthProvider(providerInfo.Name, p)
@@ -15,6 +15,7 @@
 package plugin
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
@@ -32,13 +33,13 @@ var HelloContextKey ContextKey = "hello"
 
 type MockPluginReadyPreprocessor struct{}
 
-func (p MockPluginReadyPreprocessor) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p MockPluginReadyPreprocessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	return http.StatusOK
 }
 
 type MockAccessKeyPreprocessor struct{}
 
-func (p MockAccessKeyPreprocessor) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p MockAccessKeyPreprocessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	payload.AccessKey = router.ClientAccessKey
 	return http.StatusOK
 }
@@ -88,7 +89,7 @@ func TestPlugin(t *testing.T) {
 				pluginHandlerInfo{
 					Name: "chima:echo",
 				},
-			}, config)
+			}, config, nil)
 			So(len(plugin.gatewayMap), ShouldEqual, 1)
 			So(plugin.gatewayMap, ShouldContainKey, "/chima/echo")
 		})
@@ -109,7 +110,7 @@ func TestPlugin(t *testing.T) {
 					Name:    "faseng:location",
 					Methods: []string{"POST", "PUT"},
 				},
-			}, config)
+			}, config, nil)
 			So(len(plugin.gatewayMap), ShouldEqual, 2)
 			So(plugin.gatewayMap, ShouldContainKey, "/chima/echo")
 			So(plugin.gatewayMap, ShouldContainKey, "/faseng/location")
@@ -0,0 +1,273 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	appleIssuer  = "https://appleid.apple.com"
+	appleKeysURL = "https://appleid.apple.com/auth/keys"
+
+	googleIssuer  = "https://accounts.google.com"
+	googleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// keySetCacheDuration is how long fetched signing keys are trusted
+// before they are fetched again.
+const keySetCacheDuration = 24 * time.Hour
+
+// keySetMinRefreshInterval limits how often signing keys are fetched
+// when a token is signed with an unknown key, so that forged tokens
+// cannot make us flood the key set URL.
+const keySetMinRefreshInterval = time.Minute
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// IDTokenProvider is an AuthProvider verifying OpenID Connect ID tokens
+// signed by an identity provider, such as Sign in with Apple and
+// Google Sign-In.
+//
+// The client logs in with the ID token obtained from the identity
+// provider in auth data:
+//
+//	{"id_token": "eyJhbGciOiJSUzI1NiIs..."}
+//
+// The token is accepted if it is signed by a key published in the key
+// set of the identity provider, is issued by one of Issuers and for
+// one of Audiences, and has not expired.
+type IDTokenProvider struct {
+	// Name prefixes the principal ID of authenticated users.
+	Name      string
+	Issuers   []string
+	Audiences []string
+
+	keys *keySet
+}
+
+// NewIDTokenProvider creates an IDTokenProvider fetching signing keys
+// from the JSON Web Key Set at keysURL.
+func NewIDTokenProvider(name string, keysURL string, issuers []string, audiences []string) *IDTokenProvider {
+	return &IDTokenProvider{
+		Name:      name,
+		Issuers:   issuers,
+		Audiences: audiences,
+		keys: &keySet{
+			URL:    keysURL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		},
+	}
+}
+
+// NewAppleAuthProvider creates an IDTokenProvider for Sign in with Apple.
+// audiences are the bundle IDs and service IDs of the app.
+func NewAppleAuthProvider(audiences []string) *IDTokenProvider {
+	return NewIDTokenProvider("apple", appleKeysURL, []string{appleIssuer}, audiences)
+}
+
+type idTokenClaims struct {
+	jwt.StandardClaims
+	Email string `json:"email"`
+	// Apple encodes email_verified as a string, Google as a boolean.
+	EmailVerified interface{} `json:"email_verified"`
+}
+
+func (c *idTokenClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Login verifies the ID token in authData and returns the subject of
+// the token as principal ID.
+func (p *IDTokenProvider) Login(ctx context.Context, authData map[string]interface{}) (string, map[string]interface{}, error) {
+	tokenString, _ := authData["id_token"].(string)
+	if tokenString == "" {
+		return "", nil, errors.New("id_token is required")
+	}
+
+	claims, err := p.verify(ctx, tokenString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	newAuthData := map[string]interface{}{
+		"sub": claims.Subject,
+	}
+	if claims.Email != "" {
+		newAuthData["email"] = claims.Email
+		newAuthData["email_verified"] = claims.emailVerified()
+	}
+	return p.Name + ":" + claims.Subject, newAuthData, nil
+}
+
+// Logout does nothing because ID tokens are not revocable.
+func (p *IDTokenProvider) Logout(ctx context.Context, authData map[string]interface{}) (map[string]interface{}, error) {
+	return authData, nil
+}
+
+// Info returns authData as is, which is obtained from the ID token on
+// login.
+func (p *IDTokenProvider) Info(ctx context.Context, authData map[string]interface{}) (map[string]interface{}, error) {
+	return authData, nil
+}
+
+func (p *IDTokenProvider) verify(ctx context.Context, tokenString string) (*idTokenClaims, error) {
+	claims := idTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsString(p.Issuers, claims.Issuer) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !containsString(p.Audiences, claims.Audience) {
+		return nil, fmt.Errorf("unexpected audience %q", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return &claims, nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// keySet fetches and caches RSA public keys from a JSON Web Key Set.
+type keySet struct {
+	URL    string
+	Client *http.Client
+
+	mutex     sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// Key returns the key of ID kid, fetching the key set if the cached
+// one has expired or does not contain the key.
+func (s *keySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := timeNow()
+	key, ok := s.keys[kid]
+	expired := now.Sub(s.fetchedAt) > keySetCacheDuration
+	if ok && !expired {
+		return key, nil
+	}
+
+	if expired || now.Sub(s.fetchedAt) > keySetMinRefreshInterval {
+		keys, err := s.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = keys
+		s.fetchedAt = now
+	}
+
+	key, ok = s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+func (s *keySet) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d fetching key set from %s", resp.StatusCode, s.URL)
+	}
+
+	body := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range body.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		key, err := jwk.rsaPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("malformed modulus of key %q: %v", jwk.KeyID, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("malformed exponent of key %q: %v", jwk.KeyID, err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
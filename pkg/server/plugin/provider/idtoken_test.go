@@ -0,0 +1,153 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIDTokenProvider(t *testing.T) {
+	Convey("IDTokenProvider", t, func() {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+
+		fetchCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetchCount++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]interface{}{
+					{
+						"kty": "RSA",
+						"kid": "key1",
+						"alg": "RS256",
+						"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+						"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+					},
+				},
+			})
+		}))
+		defer server.Close()
+
+		provider := NewIDTokenProvider("apple", server.URL, []string{appleIssuer}, []string{"com.example.app"})
+
+		now := time.Now()
+		signToken := func(kid string, claims jwt.Claims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = kid
+			tokenString, err := token.SignedString(privateKey)
+			So(err, ShouldBeNil)
+			return tokenString
+		}
+		validClaims := func() *idTokenClaims {
+			return &idTokenClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    appleIssuer,
+					Audience:  "com.example.app",
+					Subject:   "001234.abcd",
+					IssuedAt:  now.Unix(),
+					ExpiresAt: now.Add(10 * time.Minute).Unix(),
+				},
+				Email:         "user@example.com",
+				EmailVerified: "true",
+			}
+		}
+
+		Convey("logs in with valid token", func() {
+			principalID, authData, err := provider.Login(context.Background(), map[string]interface{}{
+				"id_token": signToken("key1", validClaims()),
+			})
+			So(err, ShouldBeNil)
+			So(principalID, ShouldEqual, "apple:001234.abcd")
+			So(authData, ShouldResemble, map[string]interface{}{
+				"sub":            "001234.abcd",
+				"email":          "user@example.com",
+				"email_verified": true,
+			})
+		})
+
+		Convey("caches signing keys", func() {
+			for i := 0; i < 2; i++ {
+				_, _, err := provider.Login(context.Background(), map[string]interface{}{
+					"id_token": signToken("key1", validClaims()),
+				})
+				So(err, ShouldBeNil)
+			}
+			So(fetchCount, ShouldEqual, 1)
+		})
+
+		Convey("rejects missing token", func() {
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token of other audience", func() {
+			claims := validClaims()
+			claims.Audience = "com.example.other"
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"id_token": signToken("key1", claims),
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token of other issuer", func() {
+			claims := validClaims()
+			claims.Issuer = googleIssuer
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"id_token": signToken("key1", claims),
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects expired token", func() {
+			claims := validClaims()
+			claims.ExpiresAt = now.Add(-time.Minute).Unix()
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"id_token": signToken("key1", claims),
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token signed with unknown key", func() {
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"id_token": signToken("key2", validClaims()),
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token signed with HMAC", func() {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+			token.Header["kid"] = "key1"
+			tokenString, err := token.SignedString([]byte("secret"))
+			So(err, ShouldBeNil)
+
+			_, _, err = provider.Login(context.Background(), map[string]interface{}{
+				"id_token": tokenString,
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
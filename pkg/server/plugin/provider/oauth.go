@@ -0,0 +1,222 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	facebookGraphURL    = "https://graph.facebook.com"
+	googleTokenInfoURL  = "https://oauth2.googleapis.com/tokeninfo"
+	oauthRequestTimeout = 10 * time.Second
+)
+
+// FacebookAuthProvider is an AuthProvider verifying Facebook user access
+// tokens with the Graph API.
+//
+// The client logs in with the access token obtained from Facebook Login
+// in auth data:
+//
+//	{"access_token": "EAAB..."}
+//
+// The token is accepted if Facebook reports that it is valid and issued
+// for the app of AppID. The principal ID is the app-scoped user ID.
+type FacebookAuthProvider struct {
+	AppID     string
+	AppSecret string
+	GraphURL  string
+	Client    *http.Client
+}
+
+// NewFacebookAuthProvider creates a FacebookAuthProvider for the app of
+// appID and appSecret.
+func NewFacebookAuthProvider(appID string, appSecret string) *FacebookAuthProvider {
+	return &FacebookAuthProvider{
+		AppID:     appID,
+		AppSecret: appSecret,
+		GraphURL:  facebookGraphURL,
+		Client:    &http.Client{Timeout: oauthRequestTimeout},
+	}
+}
+
+// Login verifies the access token in authData and returns the user ID
+// of the token as principal ID.
+func (p *FacebookAuthProvider) Login(ctx context.Context, authData map[string]interface{}) (string, map[string]interface{}, error) {
+	accessToken, _ := authData["access_token"].(string)
+	if accessToken == "" {
+		return "", nil, errors.New("access_token is required")
+	}
+
+	debug := struct {
+		Data struct {
+			AppID   string `json:"app_id"`
+			IsValid bool   `json:"is_valid"`
+			UserID  string `json:"user_id"`
+		} `json:"data"`
+	}{}
+	if err := getJSON(ctx, p.Client, p.GraphURL+"/debug_token", url.Values{
+		"input_token":  {accessToken},
+		"access_token": {p.AppID + "|" + p.AppSecret},
+	}, &debug); err != nil {
+		return "", nil, err
+	}
+	if !debug.Data.IsValid {
+		return "", nil, errors.New("access token is invalid")
+	}
+	if debug.Data.AppID != p.AppID {
+		return "", nil, fmt.Errorf("unexpected app %q", debug.Data.AppID)
+	}
+	if debug.Data.UserID == "" {
+		return "", nil, errors.New("access token has no user")
+	}
+
+	me := struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}{}
+	if err := getJSON(ctx, p.Client, p.GraphURL+"/me", url.Values{
+		"fields":          {"id,name,email"},
+		"access_token":    {accessToken},
+		"appsecret_proof": {p.appSecretProof(accessToken)},
+	}, &me); err != nil {
+		return "", nil, err
+	}
+
+	newAuthData := map[string]interface{}{
+		"id": debug.Data.UserID,
+	}
+	if me.Name != "" {
+		newAuthData["name"] = me.Name
+	}
+	if me.Email != "" {
+		newAuthData["email"] = me.Email
+	}
+	return "facebook:" + debug.Data.UserID, newAuthData, nil
+}
+
+// appSecretProof signs the access token with the app secret, which
+// Facebook requires for Graph API calls if the app enables it.
+func (p *FacebookAuthProvider) appSecretProof(accessToken string) string {
+	mac := hmac.New(sha256.New, []byte(p.AppSecret))
+	mac.Write([]byte(accessToken))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Logout does nothing because the access token is kept by the client.
+func (p *FacebookAuthProvider) Logout(ctx context.Context, authData map[string]interface{}) (map[string]interface{}, error) {
+	return authData, nil
+}
+
+// Info returns authData as is, which is obtained from the Graph API on
+// login.
+func (p *FacebookAuthProvider) Info(ctx context.Context, authData map[string]interface{}) (map[string]interface{}, error) {
+	return authData, nil
+}
+
+// GoogleAuthProvider is an AuthProvider for Google Sign-In, accepting
+// either an ID token, verified as by IDTokenProvider, or an OAuth access
+// token, verified with the token info endpoint of Google:
+//
+//	{"access_token": "ya29.a0Af..."}
+//
+// An access token is accepted if it is issued to one of Audiences.
+type GoogleAuthProvider struct {
+	*IDTokenProvider
+	TokenInfoURL string
+	Client       *http.Client
+}
+
+// NewGoogleAuthProvider creates a GoogleAuthProvider. audiences are the
+// OAuth client IDs of the app.
+func NewGoogleAuthProvider(audiences []string) *GoogleAuthProvider {
+	return &GoogleAuthProvider{
+		IDTokenProvider: NewIDTokenProvider("google", googleKeysURL, []string{googleIssuer, "accounts.google.com"}, audiences),
+		TokenInfoURL:    googleTokenInfoURL,
+		Client:          &http.Client{Timeout: oauthRequestTimeout},
+	}
+}
+
+// Login verifies the ID token or access token in authData and returns
+// the Google user ID as principal ID.
+func (p *GoogleAuthProvider) Login(ctx context.Context, authData map[string]interface{}) (string, map[string]interface{}, error) {
+	accessToken, _ := authData["access_token"].(string)
+	if _, ok := authData["id_token"]; ok || accessToken == "" {
+		return p.IDTokenProvider.Login(ctx, authData)
+	}
+
+	info := struct {
+		Audience      string `json:"aud"`
+		AuthorizedBy  string `json:"azp"`
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified string `json:"email_verified"`
+		ExpiresIn     string `json:"expires_in"`
+	}{}
+	if err := getJSON(ctx, p.Client, p.TokenInfoURL, url.Values{
+		"access_token": {accessToken},
+	}, &info); err != nil {
+		return "", nil, err
+	}
+	if !containsString(p.Audiences, info.Audience) && !containsString(p.Audiences, info.AuthorizedBy) {
+		return "", nil, fmt.Errorf("unexpected audience %q", info.Audience)
+	}
+	if expiresIn, err := strconv.Atoi(info.ExpiresIn); err != nil || expiresIn <= 0 {
+		return "", nil, errors.New("access token has expired")
+	}
+	if info.Subject == "" {
+		return "", nil, errors.New("access token has no subject")
+	}
+
+	newAuthData := map[string]interface{}{
+		"sub": info.Subject,
+	}
+	if info.Email != "" {
+		newAuthData["email"] = info.Email
+		newAuthData["email_verified"] = info.EmailVerified == "true"
+	}
+	return p.Name + ":" + info.Subject, newAuthData, nil
+}
+
+// getJSON sends a GET request to rawURL with query, and decodes the JSON
+// response into v. A response other than 200 OK is an error.
+func getJSON(ctx context.Context, client *http.Client, rawURL string, query url.Values, v interface{}) error {
+	req, err := http.NewRequest("GET", rawURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, rawURL)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,170 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFacebookAuthProvider(t *testing.T) {
+	Convey("FacebookAuthProvider", t, func() {
+		debugToken := map[string]interface{}{
+			"app_id":   "5678",
+			"is_valid": true,
+			"user_id":  "10001",
+		}
+		var meQuery map[string][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/debug_token":
+				if r.URL.Query().Get("access_token") != "5678|fbsecret" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": debugToken})
+			case "/me":
+				meQuery = r.URL.Query()
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"id":    "10001",
+					"name":  "John Doe",
+					"email": "john@example.com",
+				})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		provider := NewFacebookAuthProvider("5678", "fbsecret")
+		provider.GraphURL = server.URL
+
+		Convey("logs in with valid token", func() {
+			principalID, authData, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "usertoken",
+			})
+			So(err, ShouldBeNil)
+			So(principalID, ShouldEqual, "facebook:10001")
+			So(authData, ShouldResemble, map[string]interface{}{
+				"id":    "10001",
+				"name":  "John Doe",
+				"email": "john@example.com",
+			})
+			So(meQuery["access_token"], ShouldResemble, []string{"usertoken"})
+			So(meQuery["appsecret_proof"], ShouldResemble, []string{provider.appSecretProof("usertoken")})
+		})
+
+		Convey("rejects missing token", func() {
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects invalid token", func() {
+			debugToken["is_valid"] = false
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "usertoken",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token of other app", func() {
+			debugToken["app_id"] = "9999"
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "usertoken",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects token if app secret is wrong", func() {
+			provider.AppSecret = "wrong"
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "usertoken",
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGoogleAuthProvider(t *testing.T) {
+	Convey("GoogleAuthProvider", t, func() {
+		tokenInfo := map[string]interface{}{
+			"aud":            "1234.apps.googleusercontent.com",
+			"azp":            "1234.apps.googleusercontent.com",
+			"sub":            "110001",
+			"email":          "john@example.com",
+			"email_verified": "true",
+			"expires_in":     "3599",
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("access_token") != "ya29.token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(tokenInfo)
+		}))
+		defer server.Close()
+
+		provider := NewGoogleAuthProvider([]string{"1234.apps.googleusercontent.com"})
+		provider.TokenInfoURL = server.URL
+
+		Convey("logs in with valid access token", func() {
+			principalID, authData, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "ya29.token",
+			})
+			So(err, ShouldBeNil)
+			So(principalID, ShouldEqual, "google:110001")
+			So(authData, ShouldResemble, map[string]interface{}{
+				"sub":            "110001",
+				"email":          "john@example.com",
+				"email_verified": true,
+			})
+		})
+
+		Convey("rejects unknown access token", func() {
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "ya29.unknown",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects access token of other audience", func() {
+			tokenInfo["aud"] = "9999.apps.googleusercontent.com"
+			tokenInfo["azp"] = "9999.apps.googleusercontent.com"
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "ya29.token",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects expired access token", func() {
+			tokenInfo["expires_in"] = "0"
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{
+				"access_token": "ya29.token",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("requires id token without access token", func() {
+			_, _, err := provider.Login(context.Background(), map[string]interface{}{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "id_token is required")
+		})
+	})
+}
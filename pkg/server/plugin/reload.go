@@ -0,0 +1,173 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/observer"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// registrationSet tracks the hooks, timers and observers registered by
+// a plugin across reloads.
+//
+// The hook registry, the observer registry and the scheduler do not
+// support removal. Each registration is therefore installed only once,
+// and is skipped when it is absent from the latest init response of
+// the plugin.
+type registrationSet struct {
+	// reloadMutex serializes reloads of the plugin
+	reloadMutex sync.Mutex
+
+	mutex     sync.RWMutex
+	active    map[string]bool
+	pending   map[string]bool
+	installed map[string]bool
+}
+
+func newRegistrationSet() *registrationSet {
+	return &registrationSet{
+		active:    map[string]bool{},
+		pending:   map[string]bool{},
+		installed: map[string]bool{},
+	}
+}
+
+// begin starts collecting the registrations of an init response.
+func (s *registrationSet) begin() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = map[string]bool{}
+}
+
+// install adds key to the registrations being collected, and returns
+// whether it has not been installed before.
+func (s *registrationSet) install(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[key] = true
+	if s.installed[key] {
+		return false
+	}
+	s.installed[key] = true
+	return true
+}
+
+// commit replaces the active registrations with the collected ones.
+func (s *registrationSet) commit() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.active = s.pending
+	s.pending = map[string]bool{}
+}
+
+func (s *registrationSet) isActive(key string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.active[key]
+}
+
+func (s *registrationSet) hookFunc(key string, f hook.Func) hook.Func {
+	return func(ctx context.Context, record *skydb.Record, oldRecord *skydb.Record) skyerr.Error {
+		if !s.isActive(key) {
+			return nil
+		}
+		return f(ctx, record, oldRecord)
+	}
+}
+
+func (s *registrationSet) queryHookFunc(key string, f hook.QueryFunc) hook.QueryFunc {
+	return func(ctx context.Context, query map[string]interface{}) (map[string]interface{}, skyerr.Error) {
+		if !s.isActive(key) {
+			return query, nil
+		}
+		return f(ctx, query)
+	}
+}
+
+func (s *registrationSet) observerFunc(key string, f observer.Func) observer.Func {
+	return func(event skydb.RecordEvent) error {
+		if !s.isActive(key) {
+			return nil
+		}
+		return f(event)
+	}
+}
+
+func (s *registrationSet) timerFunc(key string, f func()) func() {
+	return func() {
+		if s.isActive(key) {
+			f()
+		}
+	}
+}
+
+// register replaces the registration of the plugin with regInfo.
+func (p *Plugin) register(context *Context, regInfo registrationInfo) {
+	context.mutex.Lock()
+	defer context.mutex.Unlock()
+
+	if p.registrations == nil {
+		p.registrations = newRegistrationSet()
+	}
+	p.registrations.begin()
+	p.lambdas = nil
+	p.processRegistrationInfo(context, regInfo)
+	p.registrations.commit()
+}
+
+// Reload re-runs the init handshake of the plugin and replaces the
+// handlers, lambdas, hooks, timers and observers it registered.
+//
+// Unlike Init, the plugin keeps serving requests with its previous
+// registration during the handshake, and the previous registration is
+// kept if the handshake fails. Handlers and lambdas no longer
+// registered by the plugin remain routed to it.
+func (p *Plugin) Reload(context *Context) (err error) {
+	if !p.IsReady() {
+		return errors.New("plugin is not ready")
+	}
+	if p.registrations == nil {
+		p.registrations = newRegistrationSet()
+	}
+	p.registrations.reloadMutex.Lock()
+	defer p.registrations.reloadMutex.Unlock()
+
+	data, err := context.getInitPayload()
+	if err != nil {
+		return err
+	}
+
+	p.transport.SendEvent("before-config", data)
+	regInfo, err := p.requestInit(data)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to register plugin: %v", r)
+		}
+	}()
+	p.register(context, regInfo)
+	p.transport.SendEvent("after-config", data)
+	return nil
+}
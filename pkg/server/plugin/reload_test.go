@@ -0,0 +1,116 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type reloadTransport struct {
+	nullTransport
+	initOut      string
+	initErr      error
+	queryHookRun []string
+}
+
+func (t *reloadTransport) SendEvent(name string, in []byte) ([]byte, error) {
+	if name != "init" {
+		return nil, nil
+	}
+	return []byte(t.initOut), t.initErr
+}
+
+func (t *reloadTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	t.queryHookRun = append(t.queryHookRun, hookName)
+	return query, nil
+}
+
+func TestPluginReload(t *testing.T) {
+	Convey("Plugin.Reload", t, func() {
+		transport := &reloadTransport{
+			initOut: `{
+				"op": [{"name": "hello:world"}],
+				"hook": [{"trigger": "beforeQuery", "type": "note", "name": "note_beforeQuery"}]
+			}`,
+		}
+		plugin := Plugin{
+			transport:     transport,
+			gatewayMap:    map[string]*router.Gateway{},
+			registrations: newRegistrationSet(),
+		}
+		pluginContext := Context{
+			plugins: []*Plugin{&plugin},
+			Router:  router.NewRouter(),
+			Mux:     http.NewServeMux(),
+			Preprocessors: router.PreprocessorRegistry{
+				"plugin_ready": MockPluginReadyPreprocessor{},
+			},
+			HookRegistry:     hook.NewRegistry(),
+			ProviderRegistry: provider.NewRegistry(),
+		}
+
+		runQueryHooks := func() []string {
+			transport.queryHookRun = nil
+			_, err := pluginContext.HookRegistry.ExecuteQueryHooks(context.Background(), "note", map[string]interface{}{})
+			So(err, ShouldBeNil)
+			return transport.queryHookRun
+		}
+
+		Convey("is rejected before the plugin is ready", func() {
+			So(plugin.Reload(&pluginContext), ShouldNotBeNil)
+		})
+
+		plugin.Init(&pluginContext)
+		transport.SetState(TransportStateReady)
+		So(runQueryHooks(), ShouldResemble, []string{"note_beforeQuery"})
+
+		Convey("replaces the registration of the plugin", func() {
+			transport.initOut = `{
+				"op": [{"name": "hello:reloaded"}],
+				"hook": [{"trigger": "beforeQuery", "type": "note", "name": "note_reloaded"}]
+			}`
+			So(plugin.Reload(&pluginContext), ShouldBeNil)
+			So(plugin.IsReady(), ShouldBeTrue)
+			So(runQueryHooks(), ShouldResemble, []string{"note_reloaded"})
+
+			_, err := pluginContext.RunLambda(context.Background(), "hello:world", []byte(`{}`))
+			So(err, ShouldNotBeNil)
+			_, err = pluginContext.RunLambda(context.Background(), "hello:reloaded", []byte(`{}`))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("does not register a hook again", func() {
+			So(plugin.Reload(&pluginContext), ShouldBeNil)
+			So(runQueryHooks(), ShouldResemble, []string{"note_beforeQuery"})
+		})
+
+		Convey("keeps the registration if the plugin fails to init", func() {
+			transport.initErr = errors.New("plugin unavailable")
+			So(plugin.Reload(&pluginContext), ShouldNotBeNil)
+			So(runQueryHooks(), ShouldResemble, []string{"note_beforeQuery"})
+
+			_, err := pluginContext.RunLambda(context.Background(), "hello:world", []byte(`{}`))
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -37,6 +37,11 @@ type HookRequest struct {
 	Original interface{} `json:"original"`
 }
 
+// QueryHookRequest contains the query involved in a beforeQuery hook.
+type QueryHookRequest struct {
+	Query map[string]interface{} `json:"query"`
+}
+
 // NewLambdaRequest creates a new lambda request.
 func NewLambdaRequest(ctx context.Context, name string, args json.RawMessage) *Request {
 	return &Request{Kind: "op", Name: name, Param: args, Context: ctx}
@@ -61,6 +66,12 @@ func NewHookRequest(ctx context.Context, hookName string, record *skydb.Record,
 	return &Request{Kind: "hook", Name: hookName, Param: param, Context: ctx}
 }
 
+// NewQueryHookRequest creates a new beforeQuery hook request.
+func NewQueryHookRequest(ctx context.Context, hookName string, query map[string]interface{}) *Request {
+	param := QueryHookRequest{Query: query}
+	return &Request{Kind: "hook", Name: hookName, Param: param, Context: ctx}
+}
+
 // NewAuthRequest creates a new auth request.
 func NewAuthRequest(ctx context.Context, authReq *skyplugin.AuthRequest) *Request {
 	return &Request{
@@ -84,12 +84,30 @@ type Transport interface {
 	// in any of its memebers with the record being passed in.
 	RunHook(ctx context.Context, hookName string, record *skydb.Record, oldRecord *skydb.Record) (*skydb.Record, error)
 
+	// RunQueryHook runs the beforeQuery hook with a name recognized by
+	// plugin, passing in the query in the format of record:query payload.
+	// The query to be performed instead is returned.
+	RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error)
+
 	RunTimer(name string, in []byte) ([]byte, error)
 
 	// RunProvider runs the auth provider with the specified AuthRequest.
 	RunProvider(context context.Context, request *AuthRequest) (*AuthResponse, error)
 }
 
+// NamedTransport is implemented by a Transport that tags its output
+// with the name of the plugin.
+type NamedTransport interface {
+	SetName(name string)
+}
+
+// RestartNotifyingTransport is implemented by a Transport that detects
+// the plugin being restarted, such as after a crash. The plugin is
+// reloaded when f is called.
+type RestartNotifyingTransport interface {
+	NotifyRestart(f func())
+}
+
 // A TransportFactory is a generic interface to instantiates different
 // kinds of Plugin Transport.
 type TransportFactory interface {
@@ -113,5 +131,8 @@ func ContextMap(ctx context.Context) map[string]interface{} {
 			pluginCtx["access_key_type"] = "master"
 		}
 	}
+	if requestID := router.RequestIDFromContext(ctx); requestID != "" {
+		pluginCtx["request_id"] = requestID
+	}
 	return pluginCtx
 }
@@ -54,6 +54,10 @@ func (t *nullTransport) RunHook(ctx context.Context, hookName string, reocrd *sk
 	t.lastContext = ctx
 	return
 }
+func (t *nullTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	t.lastContext = ctx
+	return query, nil
+}
 func (t *nullTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	out = in
 	return
@@ -121,4 +125,12 @@ func TestContextMap(t *testing.T) {
 			"access_key_type": "master",
 		})
 	})
+
+	Convey("RequestID", t, func() {
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, router.RequestIDContextKey, "request-0")
+		So(ContextMap(ctx), ShouldResemble, map[string]interface{}{
+			"request_id": "request-0",
+		})
+	})
 }
@@ -99,6 +99,11 @@ type Broker struct {
 	// internal state for stopping the zmq Run when true.
 	// Should use the stop chan to stop. The stop chan will set this variable.
 	stopping bool
+	// onRestart is called when a worker is ready after all workers are
+	// disconnected, i.e. the plugin is restarted. Guarded by the lock of
+	// workers.
+	onRestart  func()
+	hadWorkers bool
 }
 
 // NewBroker returns a new *Broker.
@@ -286,10 +291,21 @@ func (lb *Broker) setTimeout(address string) {
 	lb.timeout <- address
 }
 
+// NotifyRestart sets f to be called when the plugin is restarted.
+func (lb *Broker) NotifyRestart(f func()) {
+	lb.workers.Lock()
+	defer lb.workers.Unlock()
+	lb.onRestart = f
+}
+
 func (lb *Broker) handleWorkerStatus(address string, status string) {
 	switch status {
 	case Ready:
 		log.Infof("zmq/broker: ready worker = %s", address)
+		if len(lb.workers.addresses) == 0 && lb.hadWorkers && lb.onRestart != nil {
+			go lb.onRestart()
+		}
+		lb.hadWorkers = true
 		lb.workers.Add(newWorker(address))
 	case Heartbeat:
 		// no-op
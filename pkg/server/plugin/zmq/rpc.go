@@ -55,6 +55,10 @@ func (p *zmqTransport) SetState(state skyplugin.TransportState) {
 	}
 }
 
+func (p *zmqTransport) NotifyRestart(f func()) {
+	p.broker.NotifyRestart(f)
+}
+
 func (p *zmqTransport) SendEvent(name string, in []byte) ([]byte, error) {
 	return p.rpc(pluginrequest.NewEventRequest(name, in))
 }
@@ -89,6 +93,21 @@ func (p *zmqTransport) RunHook(ctx context.Context, hookName string, record *sky
 	return &recordout, nil
 }
 
+func (p *zmqTransport) RunQueryHook(ctx context.Context, hookName string, query map[string]interface{}) (map[string]interface{}, error) {
+	out, err := p.rpc(pluginrequest.NewQueryHookRequest(ctx, hookName, query))
+	if err != nil {
+		return nil, err
+	}
+
+	var queryout map[string]interface{}
+	if err := json.Unmarshal(out, &queryout); err != nil {
+		p.logger.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, fmt.Errorf("failed to unmarshal query: %v", err)
+	}
+
+	return queryout, nil
+}
+
 func (p *zmqTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	req := pluginrequest.Request{Kind: "timer", Name: name}
 	out, err = p.rpc(&req)
@@ -0,0 +1,68 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preprocessor
+
+import (
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// App is an app served by the server. The database schema and tokens
+// of an app are separated from those of other apps by its name.
+type App struct {
+	Name      string
+	ClientKey string
+	MasterKey string
+
+	// DBOption, if set, is the connection string of the database of
+	// the app, used instead of that of the default app.
+	DBOption string
+}
+
+// AppRegistry holds the apps served in addition to the default app of
+// a preprocessor, by app name.
+type AppRegistry map[string]App
+
+func (r AppRegistry) app(name string, defaultApp App) (App, bool) {
+	if name == defaultApp.Name {
+		return defaultApp, true
+	}
+	app, ok := r[name]
+	return app, ok
+}
+
+// selectApp returns the app the request is made to, which is the app of
+// the API key of the request, or else defaultApp. The app named by the
+// request is never trusted to select the app. If the request has an API
+// key, the app it names must be the app of the key.
+func (r AppRegistry) selectApp(payload *router.Payload, defaultApp App) (App, skyerr.Error) {
+	apiKey := payload.APIKey()
+	if apiKey == "" {
+		return defaultApp, nil
+	}
+
+	app := defaultApp
+	for _, a := range r {
+		if apiKey == a.ClientKey || apiKey == a.MasterKey {
+			app = a
+			break
+		}
+	}
+
+	if name := payload.RequestAppName(); name != "" && name != app.Name {
+		return App{}, skyerr.NewErrorf(skyerr.AccessKeyNotAccepted, "Api key is not issued for app: `%v`", name)
+	}
+	return app, nil
+}
@@ -46,10 +46,18 @@ type AccessKeyValidationPreprocessor struct {
 	ClientKey string
 	MasterKey string
 	AppName   string
+	// Apps are the apps served in addition to the app of AppName.
+	Apps AppRegistry
 }
 
-func (p AccessKeyValidationPreprocessor) Preprocess(payload *router.Payload, response *router.Response) int {
-	if err := checkRequestAccessKey(payload, p.ClientKey, p.MasterKey); err != nil {
+func (p AccessKeyValidationPreprocessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
+	app, err := p.Apps.selectApp(payload, App{Name: p.AppName, ClientKey: p.ClientKey, MasterKey: p.MasterKey})
+	if err != nil {
+		response.Err = err
+		return http.StatusUnauthorized
+	}
+
+	if err := checkRequestAccessKey(payload, app.ClientKey, app.MasterKey); err != nil {
 		response.Err = err
 		return http.StatusUnauthorized
 	}
@@ -59,21 +67,33 @@ func (p AccessKeyValidationPreprocessor) Preprocess(payload *router.Payload, res
 		return http.StatusUnauthorized
 	}
 
-	payload.AppName = p.AppName
+	payload.AppName = app.Name
 	return http.StatusOK
 }
 
 // UserAuthenticator provides preprocess method to authenicate a user
 // with access token or non-login user without api key.
+//
+// If Apps is not empty, an access token is only accepted by the app
+// it is issued for. A request with an access token but no API key is
+// made to the app of the access token.
 type UserAuthenticator struct {
 	ClientKey  string
 	MasterKey  string
 	AppName    string
 	TokenStore authtoken.Store
+	Apps       AppRegistry
 }
 
-func (p *UserAuthenticator) Preprocess(payload *router.Payload, response *router.Response) int {
-	if err := checkRequestAccessKey(payload, p.ClientKey, p.MasterKey); err != nil {
+func (p *UserAuthenticator) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
+	defaultApp := App{Name: p.AppName, ClientKey: p.ClientKey, MasterKey: p.MasterKey}
+	app, err := p.Apps.selectApp(payload, defaultApp)
+	if err != nil {
+		response.Err = err
+		return http.StatusUnauthorized
+	}
+
+	if err := checkRequestAccessKey(payload, app.ClientKey, app.MasterKey); err != nil {
 		response.Err = err
 		return http.StatusUnauthorized
 	}
@@ -98,6 +118,20 @@ func (p *UserAuthenticator) Preprocess(payload *router.Payload, response *router
 			return http.StatusUnauthorized
 		}
 
+		if len(p.Apps) > 0 {
+			if payload.APIKey() == "" {
+				app, _ = p.Apps.app(token.AppName, defaultApp)
+			}
+			if name := payload.RequestAppName(); name != "" && name != token.AppName {
+				response.Err = skyerr.NewError(skyerr.AccessTokenNotAccepted, "token is not issued for the app")
+				return http.StatusUnauthorized
+			}
+			if token.AppName != app.Name {
+				response.Err = skyerr.NewError(skyerr.AccessTokenNotAccepted, "token is not issued for the app")
+				return http.StatusUnauthorized
+			}
+		}
+
 		payload.AppName = token.AppName
 		payload.UserInfoID = token.UserInfoID
 		payload.Context = context.WithValue(payload.Context, router.UserIDContextKey, token.UserInfoID)
@@ -119,6 +153,6 @@ func (p *UserAuthenticator) Preprocess(payload *router.Payload, response *router
 		}
 	}
 
-	payload.AppName = p.AppName
+	payload.AppName = app.Name
 	return http.StatusOK
 }
@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -43,7 +44,7 @@ func TestAccessKeyValidationPreprocessor(t *testing.T) {
 
 		Convey("test client key", func() {
 			payload.Data["api_key"] = "client-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AccessKey, ShouldEqual, router.ClientAccessKey)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(resp.Err, ShouldBeNil)
@@ -51,7 +52,7 @@ func TestAccessKeyValidationPreprocessor(t *testing.T) {
 
 		Convey("test master key", func() {
 			payload.Data["api_key"] = "master-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AccessKey, ShouldEqual, router.MasterAccessKey)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(resp.Err, ShouldBeNil)
@@ -59,14 +60,14 @@ func TestAccessKeyValidationPreprocessor(t *testing.T) {
 
 		Convey("test wrong key", func() {
 			payload.Data["api_key"] = "wrong-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
 			So(payload.AccessKey, ShouldEqual, router.NoAccessKey)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.AccessKeyNotAccepted)
 		})
 
 		Convey("test no key", func() {
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
 			So(payload.AccessKey, ShouldEqual, router.NoAccessKey)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.NotAuthenticated)
@@ -91,7 +92,7 @@ func TestUserAuthenticator(t *testing.T) {
 
 		Convey("test client key", func() {
 			payload.Data["api_key"] = "client-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AccessKey, ShouldEqual, router.ClientAccessKey)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(resp.Err, ShouldBeNil)
@@ -99,7 +100,7 @@ func TestUserAuthenticator(t *testing.T) {
 
 		Convey("test master key", func() {
 			payload.Data["api_key"] = "master-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AccessKey, ShouldEqual, router.MasterAccessKey)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(resp.Err, ShouldBeNil)
@@ -107,14 +108,14 @@ func TestUserAuthenticator(t *testing.T) {
 
 		Convey("test wrong key", func() {
 			payload.Data["api_key"] = "wrong-key"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
 			So(payload.AccessKey, ShouldEqual, router.NoAccessKey)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.AccessKeyNotAccepted)
 		})
 
 		Convey("test no key", func() {
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
 			So(payload.AccessKey, ShouldEqual, router.NoAccessKey)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.NotAuthenticated)
@@ -138,7 +139,7 @@ func TestUserAuthenticator(t *testing.T) {
 		Convey("impersonate a user", func() {
 			payload.Data["api_key"] = "master-key"
 			payload.Data["_user_id"] = "user-id"
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AccessKey, ShouldEqual, router.MasterAccessKey)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(payload.UserInfoID, ShouldEqual, "user-id")
@@ -170,7 +171,7 @@ func TestUserAuthenticator(t *testing.T) {
 			token := authtoken.New("app-name", "user-id", time.Time{})
 			pp.TokenStore.Put(&token)
 			payload.Data["access_token"] = token.AccessToken
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(payload.AppName, ShouldEqual, "app-name")
 			So(payload.UserInfoID, ShouldEqual, "user-id")
 			So(resp.Err, ShouldBeNil)
@@ -180,9 +181,99 @@ func TestUserAuthenticator(t *testing.T) {
 			token := authtoken.New("app-name", "user-id", time.Now())
 			// do not put it in the test token store to simulate expired token
 			payload.Data["access_token"] = token.AccessToken
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.AccessTokenNotAccepted)
 		})
 	})
 }
+
+func TestUserAuthenticatorWithApps(t *testing.T) {
+	Convey("test access user authenticator with apps", t, func() {
+		pp := UserAuthenticator{
+			ClientKey:  "client-key",
+			MasterKey:  "master-key",
+			AppName:    "app-name",
+			TokenStore: &authtokentest.SingleTokenStore{},
+			Apps: AppRegistry{
+				"shop": App{Name: "shop", ClientKey: "shop-client-key", MasterKey: "shop-master-key"},
+			},
+		}
+
+		payload := &router.Payload{
+			Data: map[string]interface{}{},
+			Meta: map[string]interface{}{},
+		}
+		resp := &router.Response{}
+
+		Convey("select app by api key", func() {
+			payload.Data["api_key"] = "shop-master-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(payload.AccessKey, ShouldEqual, router.MasterAccessKey)
+			So(payload.AppName, ShouldEqual, "shop")
+			So(resp.Err, ShouldBeNil)
+		})
+
+		Convey("select default app by api key", func() {
+			payload.Data["api_key"] = "client-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(payload.AppName, ShouldEqual, "app-name")
+		})
+
+		Convey("select app by name", func() {
+			payload.Data["app_name"] = "shop"
+			payload.Data["api_key"] = "shop-client-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(payload.AccessKey, ShouldEqual, router.ClientAccessKey)
+			So(payload.AppName, ShouldEqual, "shop")
+		})
+
+		Convey("reject api key of another app", func() {
+			payload.Data["app_name"] = "shop"
+			payload.Data["api_key"] = "client-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(resp.Err.Code(), ShouldEqual, skyerr.AccessKeyNotAccepted)
+		})
+
+		Convey("reject unknown app", func() {
+			payload.Data["app_name"] = "blog"
+			payload.Data["api_key"] = "client-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(resp.Err.Code(), ShouldEqual, skyerr.AccessKeyNotAccepted)
+		})
+
+		Convey("select app of token", func() {
+			token := authtoken.New("shop", "user-id", time.Time{})
+			pp.TokenStore.Put(&token)
+			payload.Data["access_token"] = token.AccessToken
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(payload.AppName, ShouldEqual, "shop")
+			So(payload.UserInfoID, ShouldEqual, "user-id")
+		})
+
+		Convey("ignore app name without api key", func() {
+			payload.Data["app_name"] = "shop"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(resp.Err.Code(), ShouldEqual, skyerr.NotAuthenticated)
+			So(payload.AppName, ShouldEqual, "")
+		})
+
+		Convey("reject app name not matching token", func() {
+			token := authtoken.New("app-name", "user-id", time.Time{})
+			pp.TokenStore.Put(&token)
+			payload.Data["access_token"] = token.AccessToken
+			payload.Data["app_name"] = "shop"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(resp.Err.Code(), ShouldEqual, skyerr.AccessTokenNotAccepted)
+		})
+
+		Convey("reject token of another app", func() {
+			token := authtoken.New("shop", "user-id", time.Time{})
+			pp.TokenStore.Put(&token)
+			payload.Data["access_token"] = token.AccessToken
+			payload.Data["api_key"] = "client-key"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusUnauthorized)
+			So(resp.Err.Code(), ShouldEqual, skyerr.AccessTokenNotAccepted)
+		})
+	})
+}
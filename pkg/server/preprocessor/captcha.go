@@ -0,0 +1,56 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preprocessor
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/skygeario/skygear-server/pkg/server/captcha"
+	"github.com/skygeario/skygear-server/pkg/server/geoip"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// RequireCaptcha requires requests made without master key to carry a
+// valid CAPTCHA token in captcha_token once the client has used up its
+// free attempts.
+type RequireCaptcha struct {
+	Guard *captcha.Guard
+
+	// GeoIP determines the client IP which attempts are counted by.
+	GeoIP *geoip.Resolver
+}
+
+func (p RequireCaptcha) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
+	if !p.Guard.Enabled() || payload.HasMasterKey() {
+		return http.StatusOK
+	}
+
+	clientIP := ""
+	if ip := p.GeoIP.ClientIP(payload.Req); ip != nil {
+		clientIP = ip.String()
+	}
+	token, _ := payload.Data["captcha_token"].(string)
+
+	if err := p.Guard.Check(ctx, clientIP, token); err != nil {
+		response.Err = err
+		if err.Code() == skyerr.CaptchaRequired {
+			return http.StatusForbidden
+		}
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
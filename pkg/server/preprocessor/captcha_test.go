@@ -0,0 +1,82 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preprocessor
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/captcha"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type validTokenVerifier struct {
+	remoteIP string
+}
+
+func (v *validTokenVerifier) Verify(ctx context.Context, token string, remoteIP string) (bool, error) {
+	v.remoteIP = remoteIP
+	return token == "valid", nil
+}
+
+func TestRequireCaptcha(t *testing.T) {
+	Convey("RequireCaptcha", t, func() {
+		verifier := &validTokenVerifier{}
+		pp := RequireCaptcha{
+			Guard: &captcha.Guard{
+				Verifier: verifier,
+				Provider: "hcaptcha",
+			},
+		}
+
+		req, _ := http.NewRequest("POST", "http://skygear.dev/", nil)
+		req.RemoteAddr = "10.0.0.1:54321"
+		payload := &router.Payload{
+			Req:     req,
+			Data:    map[string]interface{}{},
+			Meta:    map[string]interface{}{},
+			Context: context.Background(),
+		}
+		resp := &router.Response{}
+
+		Convey("rejects request without token", func() {
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusForbidden)
+			So(resp.Err.Code(), ShouldEqual, skyerr.CaptchaRequired)
+		})
+
+		Convey("accepts request with valid token", func() {
+			payload.Data["captcha_token"] = "valid"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+			So(verifier.remoteIP, ShouldEqual, "10.0.0.1")
+		})
+
+		Convey("accepts request with master key", func() {
+			payload.AccessKey = router.MasterAccessKey
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+		})
+
+		Convey("accepts request if disabled", func() {
+			pp.Guard = nil
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -25,17 +26,41 @@ import (
 type ConnPreprocessor struct {
 	AppName       string
 	AccessControl string
-	DBOpener      func(string, string, string, string, bool) (skydb.Conn, error)
+	DBOpener      func(context.Context, string, string, string, string, bool) (skydb.Conn, error)
 	DBImpl        string
 	Option        string
 	DevMode       bool
+
+	// DDLOption, if set, is used instead of Option to open connections
+	// allowed to migrate, so that only those connections are opened with
+	// credentials that can change the database schema.
+	DDLOption string
+
+	// Apps are the apps served in addition to the app of AppName. A
+	// request made to one of them, as decided by an earlier
+	// preprocessor, is served by a connection to the database schema of
+	// that app, in the database of the app if it has one.
+	Apps AppRegistry
 }
 
-func (p ConnPreprocessor) Preprocess(payload *router.Payload, response *router.Response) int {
-	log.Debugf("Opening DBConn: {%v %v %v}", p.DBImpl, p.AppName, p.Option)
+func (p ConnPreprocessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
+	appName := p.AppName
+	option := p.Option
+	ddlOption := p.DDLOption
+	if app, ok := p.Apps[payload.AppName]; ok {
+		appName = app.Name
+		if app.DBOption != "" {
+			option = app.DBOption
+			ddlOption = ""
+		}
+	}
+	log.Debugf("Opening DBConn: {%v %v}", p.DBImpl, appName)
 
 	canMigrate := payload.HasMasterKey() || p.DevMode
-	conn, err := p.DBOpener(p.DBImpl, p.AppName, p.AccessControl, p.Option, canMigrate)
+	if canMigrate && ddlOption != "" {
+		option = ddlOption
+	}
+	conn, err := p.DBOpener(ctx, p.DBImpl, appName, p.AccessControl, option, canMigrate)
 	if err != nil {
 		response.Err = skyerr.NewError(skyerr.UnexpectedUnableToOpenDatabase, err.Error())
 		return http.StatusServiceUnavailable
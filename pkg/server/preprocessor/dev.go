@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/skygeario/skygear-server/pkg/server/router"
@@ -25,7 +26,7 @@ type DevOnlyProcessor struct {
 	DevMode bool
 }
 
-func (p DevOnlyProcessor) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p DevOnlyProcessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	if payload.HasMasterKey() {
 		return http.StatusOK
 	}
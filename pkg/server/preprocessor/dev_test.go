@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
@@ -37,7 +38,7 @@ func TestDevOnlyProcessor(t *testing.T) {
 		resp := &router.Response{}
 
 		Convey("test should be okay", func() {
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 		})
 	})
 
@@ -54,14 +55,14 @@ func TestDevOnlyProcessor(t *testing.T) {
 
 		Convey("not okay when client key", func() {
 			payload.AccessKey = router.ClientAccessKey
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusForbidden)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusForbidden)
 			So(resp.Err, ShouldNotBeNil)
 			So(resp.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
 		})
 
 		Convey("okay when master key", func() {
 			payload.AccessKey = router.MasterAccessKey
-			So(pp.Preprocess(payload, resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 		})
 	})
@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/skygeario/skygear-server/pkg/server/plugin"
@@ -29,6 +30,7 @@ type EnsurePluginReadyPreprocessor struct {
 }
 
 func (p *EnsurePluginReadyPreprocessor) Preprocess(
+	ctx context.Context,
 	payload *router.Payload,
 	response *router.Response,
 ) int {
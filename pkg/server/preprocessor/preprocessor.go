@@ -15,10 +15,12 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/skygeario/skygear-server/pkg/server/anonymous"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -27,7 +29,16 @@ import (
 
 var log = logging.LoggerEntry("preprocessor")
 
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// lastSeenUpdateInterval is how often the last seen time of a user is
+// updated at most, so that not every request writes to the database.
+const lastSeenUpdateInterval = 10 * time.Minute
+
 type InjectUserIfPresent struct {
+	// AnonymousPolicy restricts the requests of anonymous users made
+	// without master key.
+	AnonymousPolicy *anonymous.Policy
 }
 
 func isTokenStillValid(token router.AccessToken, userInfo skydb.UserInfo) bool {
@@ -48,7 +59,7 @@ func isTokenStillValid(token router.AccessToken, userInfo skydb.UserInfo) bool {
 	return token.IssuedAt().After(tokenValidSince.Add(-1 * time.Second))
 }
 
-func (p InjectUserIfPresent) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p InjectUserIfPresent) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	if payload.UserInfoID == "" {
 		log.Debugln("injectUser: empty UserInfoID, skipping")
 		return http.StatusOK
@@ -56,7 +67,7 @@ func (p InjectUserIfPresent) Preprocess(payload *router.Payload, response *route
 
 	conn := payload.DBConn
 	userinfo := skydb.UserInfo{}
-	if err := conn.GetUser(payload.UserInfoID, &userinfo); err != nil {
+	if err := conn.GetUser(ctx, payload.UserInfoID, &userinfo); err != nil {
 		log.Errorf("Cannot find UserInfo.ID = %#v\n", payload.UserInfoID)
 		response.Err = skyerr.NewError(skyerr.UnexpectedUserInfoNotFound, err.Error())
 		return http.StatusInternalServerError
@@ -70,15 +81,35 @@ func (p InjectUserIfPresent) Preprocess(payload *router.Payload, response *route
 		return http.StatusUnauthorized
 	}
 
+	// The last seen time tells which anonymous users are inactive and
+	// can be purged.
+	now := timeNow()
+	if userinfo.LastSeenAt == nil || now.Sub(*userinfo.LastSeenAt) >= lastSeenUpdateInterval {
+		userinfo.LastSeenAt = &now
+		if err := conn.UpdateUser(ctx, &userinfo); err != nil {
+			log.WithField("err", err).Warnf("Failed to update last seen time of UserInfo.ID = %#v", userinfo.ID)
+		}
+	}
+
 	payload.UserInfo = &userinfo
 
+	if p.AnonymousPolicy.Enabled() && userinfo.IsAnonymous() && !payload.HasMasterKey() {
+		if err := p.AnonymousPolicy.Check(userinfo.ID, payload.RouteAction(), payload.Data); err != nil {
+			response.Err = err
+			if err.Code() == skyerr.TooManyRequests {
+				return http.StatusTooManyRequests
+			}
+			return http.StatusForbidden
+		}
+	}
+
 	return http.StatusOK
 }
 
 type InjectDatabase struct {
 }
 
-func (p InjectDatabase) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p InjectDatabase) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	conn := payload.DBConn
 
 	databaseID, ok := payload.Data["database_id"].(string)
@@ -97,11 +128,14 @@ func (p InjectDatabase) Preprocess(payload *router.Payload, response *router.Res
 	case "_public":
 		payload.Database = conn.PublicDB()
 	case "_union":
-		if !payload.HasMasterKey() {
-			response.Err = skyerr.NewError(skyerr.NotAuthenticated, "Master key is needed for union DB access")
+		if payload.HasMasterKey() {
+			payload.Database = conn.UnionDB()
+		} else if payload.UserInfo != nil {
+			payload.Database = conn.UserUnionDB(payload.UserInfo.ID)
+		} else {
+			response.Err = skyerr.NewError(skyerr.NotAuthenticated, "Authentication is needed for union DB access")
 			return http.StatusUnauthorized
 		}
-		payload.Database = conn.UnionDB()
 	default:
 		if strings.HasPrefix(databaseID, "_") {
 			response.Err = skyerr.NewInvalidArgument("invalid database ID", []string{"database_id"})
@@ -122,7 +156,7 @@ func (p InjectDatabase) Preprocess(payload *router.Payload, response *router.Res
 type InjectPublicDatabase struct {
 }
 
-func (p InjectPublicDatabase) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p InjectPublicDatabase) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	conn := payload.DBConn
 	payload.Database = conn.PublicDB()
 	return http.StatusOK
@@ -131,7 +165,7 @@ func (p InjectPublicDatabase) Preprocess(payload *router.Payload, response *rout
 type RequireUserForWrite struct {
 }
 
-func (p RequireUserForWrite) Preprocess(payload *router.Payload, response *router.Response) int {
+func (p RequireUserForWrite) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
 	if payload.UserInfo == nil {
 		response.Err = skyerr.NewError(skyerr.PermissionDenied, "write is not allowed")
 		return http.StatusUnauthorized
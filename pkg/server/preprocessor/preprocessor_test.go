@@ -15,12 +15,14 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/skygeario/skygear-server/pkg/server/anonymous"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
@@ -52,6 +54,13 @@ func (conn *injectDatabasePreprocessorConn) UnionDB() skydb.Database {
 	}
 }
 
+func (conn *injectDatabasePreprocessorConn) UserUnionDB(userID string) skydb.Database {
+	return &injectDatabasePreprocessorDB{
+		databaseType: skydb.UnionDatabase,
+		userID:       userID,
+	}
+}
+
 type injectDatabasePreprocessorDB struct {
 	databaseType skydb.DatabaseType
 	userID       string
@@ -66,6 +75,51 @@ func (db *injectDatabasePreprocessorDB) ID() string {
 	return db.userID
 }
 
+func TestConnPreprocessor(t *testing.T) {
+	Convey("ConnPreprocessor", t, func() {
+		var appName, option string
+		pp := ConnPreprocessor{
+			AppName:   "app-name",
+			Option:    "default-option",
+			DDLOption: "default-ddl-option",
+			DBOpener: func(ctx context.Context, impl, name, accessControl, opt string, migrate bool) (skydb.Conn, error) {
+				appName = name
+				option = opt
+				return &injectDatabasePreprocessorConn{}, nil
+			},
+			Apps: AppRegistry{
+				"shop": App{Name: "shop", DBOption: "shop-option"},
+				"blog": App{Name: "blog"},
+			},
+		}
+		payload := &router.Payload{
+			Data: map[string]interface{}{},
+		}
+		resp := &router.Response{}
+
+		Convey("opens connection of default app", func() {
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(appName, ShouldEqual, "app-name")
+			So(option, ShouldEqual, "default-option")
+		})
+
+		Convey("opens connection in database of app", func() {
+			payload.AppName = "shop"
+			payload.AccessKey = router.MasterAccessKey
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(appName, ShouldEqual, "shop")
+			So(option, ShouldEqual, "shop-option")
+		})
+
+		Convey("opens connection of app in default database", func() {
+			payload.AppName = "blog"
+			So(pp.Preprocess(context.Background(), payload, resp), ShouldEqual, http.StatusOK)
+			So(appName, ShouldEqual, "blog")
+			So(option, ShouldEqual, "default-option")
+		})
+	})
+}
+
 func TestInjectDatabaseProcessor(t *testing.T) {
 	Convey("InjectDatabase", t, func() {
 		pp := InjectDatabase{}
@@ -79,7 +133,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.PublicDatabase)
 		})
@@ -94,7 +148,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.PublicDatabase)
 		})
@@ -112,7 +166,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.PrivateDatabase)
 			So(payload.Database.ID(), ShouldEqual, "alice")
@@ -128,7 +182,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusUnauthorized)
 			So(resp.Err.Code(), ShouldEqual, skyerr.NotAuthenticated)
 		})
 
@@ -143,12 +197,32 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+			So(payload.Database.DatabaseType(), ShouldEqual, skydb.UnionDatabase)
+		})
+
+		Convey("should inject user union DB if no master key", func() {
+			payload := router.Payload{
+				Data: map[string]interface{}{
+					"database_id": "_union",
+				},
+				Meta: map[string]interface{}{},
+				UserInfo: &skydb.UserInfo{
+					ID: "alice",
+				},
+				AccessKey: router.ClientAccessKey,
+				DBConn:    &conn,
+			}
+			resp := router.Response{}
+
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.UnionDatabase)
+			So(payload.Database.ID(), ShouldEqual, "alice")
 		})
 
-		Convey("should not inject union DB if no master key", func() {
+		Convey("should not inject union DB if not logged in", func() {
 			payload := router.Payload{
 				Data: map[string]interface{}{
 					"database_id": "_union",
@@ -159,7 +233,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusUnauthorized)
 			So(resp.Err.Code(), ShouldEqual, skyerr.NotAuthenticated)
 		})
 
@@ -176,7 +250,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.PrivateDatabase)
 			So(payload.Database.ID(), ShouldEqual, "alice")
@@ -193,7 +267,7 @@ func TestInjectDatabaseProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.Database.DatabaseType(), ShouldEqual, skydb.PrivateDatabase)
 			So(payload.Database.ID(), ShouldEqual, "alice")
@@ -214,12 +288,21 @@ func TestInjectUserProcessor(t *testing.T) {
 		pp := InjectUserIfPresent{}
 		conn := skydbtest.NewMapConn()
 
+		now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		realTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = realTimeNow
+		}()
+
+		lastSeenAt := now.Add(-1 * time.Minute)
 		withoutTokenValidSince := skydb.UserInfo{
-			ID:       "userid1",
-			Username: "username1",
-			Email:    "username1@example.com",
+			ID:         "userid1",
+			Username:   "username1",
+			Email:      "username1@example.com",
+			LastSeenAt: &lastSeenAt,
 		}
-		So(conn.CreateUser(&withoutTokenValidSince), ShouldBeNil)
+		So(conn.CreateUser(context.Background(), &withoutTokenValidSince), ShouldBeNil)
 
 		pastTime := time.Now().Add(-1 * time.Hour)
 		withPastTokenValidSince := skydb.UserInfo{
@@ -227,8 +310,9 @@ func TestInjectUserProcessor(t *testing.T) {
 			Username:        "username2",
 			Email:           "username2@example.com",
 			TokenValidSince: &pastTime,
+			LastSeenAt:      &lastSeenAt,
 		}
-		So(conn.CreateUser(&withPastTokenValidSince), ShouldBeNil)
+		So(conn.CreateUser(context.Background(), &withPastTokenValidSince), ShouldBeNil)
 
 		futureTime := time.Now().Add(1 * time.Hour)
 		withFutureTokenValidSince := skydb.UserInfo{
@@ -237,7 +321,7 @@ func TestInjectUserProcessor(t *testing.T) {
 			Email:           "username3@example.com",
 			TokenValidSince: &futureTime,
 		}
-		So(conn.CreateUser(&withFutureTokenValidSince), ShouldBeNil)
+		So(conn.CreateUser(context.Background(), &withFutureTokenValidSince), ShouldBeNil)
 
 		Convey("should inject user with access token", func() {
 			payload := router.Payload{
@@ -249,7 +333,7 @@ func TestInjectUserProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.UserInfo, ShouldResemble, &withoutTokenValidSince)
 		})
@@ -266,7 +350,7 @@ func TestInjectUserProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.UserInfo, ShouldResemble, &withoutTokenValidSince)
 		})
@@ -283,11 +367,52 @@ func TestInjectUserProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusOK)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
 			So(resp.Err, ShouldBeNil)
 			So(payload.UserInfo, ShouldResemble, &withPastTokenValidSince)
 		})
 
+		Convey("should update last seen time of user not seen recently", func() {
+			staleLastSeenAt := now.Add(-1 * time.Hour)
+			staleUser := skydb.UserInfo{
+				ID:         "userid4",
+				Username:   "username4",
+				LastSeenAt: &staleLastSeenAt,
+			}
+			So(conn.CreateUser(context.Background(), &staleUser), ShouldBeNil)
+
+			payload := router.Payload{
+				Data:       map[string]interface{}{},
+				Meta:       map[string]interface{}{},
+				DBConn:     conn,
+				UserInfoID: "userid4",
+			}
+			resp := router.Response{}
+
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
+			So(*payload.UserInfo.LastSeenAt, ShouldResemble, now)
+
+			stored := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), "userid4", &stored), ShouldBeNil)
+			So(*stored.LastSeenAt, ShouldResemble, now)
+		})
+
+		Convey("should not update last seen time of user seen recently", func() {
+			payload := router.Payload{
+				Data:       map[string]interface{}{},
+				Meta:       map[string]interface{}{},
+				DBConn:     conn,
+				UserInfoID: "userid1",
+			}
+			resp := router.Response{}
+
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusOK)
+
+			stored := skydb.UserInfo{}
+			So(conn.GetUser(context.Background(), "userid1", &stored), ShouldBeNil)
+			So(*stored.LastSeenAt, ShouldResemble, lastSeenAt)
+		})
+
 		Convey("should not inject user with invalid issued time", func() {
 			payload := router.Payload{
 				Data:       map[string]interface{}{},
@@ -300,8 +425,45 @@ func TestInjectUserProcessor(t *testing.T) {
 			}
 			resp := router.Response{}
 
-			So(pp.Preprocess(&payload, &resp), ShouldEqual, http.StatusUnauthorized)
+			So(pp.Preprocess(context.Background(), &payload, &resp), ShouldEqual, http.StatusUnauthorized)
 			So(resp.Err.Code(), ShouldEqual, skyerr.AccessTokenNotAccepted)
 		})
+
+		Convey("should apply anonymous policy to anonymous user", func() {
+			anonymousUser := skydb.UserInfo{ID: "anonymous"}
+			So(conn.CreateUser(context.Background(), &anonymousUser), ShouldBeNil)
+
+			pp := InjectUserIfPresent{
+				AnonymousPolicy: &anonymous.Policy{
+					AllowedActions: []string{"record:query"},
+				},
+			}
+			newPayload := func(userID string, action string) *router.Payload {
+				return &router.Payload{
+					Data:       map[string]interface{}{"action": action},
+					Meta:       map[string]interface{}{},
+					DBConn:     conn,
+					UserInfoID: userID,
+				}
+			}
+
+			resp := router.Response{}
+			So(pp.Preprocess(context.Background(), newPayload("anonymous", "record:query"), &resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+
+			resp = router.Response{}
+			So(pp.Preprocess(context.Background(), newPayload("anonymous", "record:save"), &resp), ShouldEqual, http.StatusForbidden)
+			So(resp.Err.Code(), ShouldEqual, skyerr.PermissionDenied)
+
+			resp = router.Response{}
+			So(pp.Preprocess(context.Background(), newPayload("userid1", "record:save"), &resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+
+			resp = router.Response{}
+			masterKeyPayload := newPayload("anonymous", "record:save")
+			masterKeyPayload.AccessKey = router.MasterAccessKey
+			So(pp.Preprocess(context.Background(), masterKeyPayload, &resp), ShouldEqual, http.StatusOK)
+			So(resp.Err, ShouldBeNil)
+		})
 	})
 }
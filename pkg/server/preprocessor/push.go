@@ -15,6 +15,7 @@
 package preprocessor
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/skygeario/skygear-server/pkg/server/push"
@@ -26,8 +27,12 @@ type NotificationPreprocessor struct {
 	NotificationSender push.Sender
 }
 
-func (p NotificationPreprocessor) Preprocess(payload *router.Payload, response *router.Response) int {
-	routeSender, ok := p.NotificationSender.(push.RouteSender)
+func (p NotificationPreprocessor) Preprocess(ctx context.Context, payload *router.Payload, response *router.Response) int {
+	// The sender is a push.RouteSender, or a sender wrapping one such
+	// as push.PayloadFitter.
+	routeSender, ok := p.NotificationSender.(interface {
+		Len() int
+	})
 	if !ok {
 		response.Err = skyerr.NewError(skyerr.UnexpectedPushNotificationNotConfigured, "Unknown notification sender.")
 		return http.StatusInternalServerError
@@ -0,0 +1,180 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Access is the credential required of a client to subscribe or publish
+// on a channel.
+type Access string
+
+const (
+	// AccessNone permits no clients.
+	AccessNone Access = "none"
+
+	// AccessKey permits clients with an API key or an access token.
+	AccessKey Access = "key"
+
+	// AccessUser permits clients with an access token of a user.
+	AccessUser Access = "user"
+
+	// AccessMaster permits clients with the master key.
+	AccessMaster Access = "master"
+)
+
+// ParseAccess returns the Access named s.
+func ParseAccess(s string) (Access, error) {
+	switch Access(s) {
+	case AccessNone, AccessKey, AccessUser, AccessMaster:
+		return Access(s), nil
+	}
+	return AccessNone, fmt.Errorf("unknown pubsub access %q", s)
+}
+
+// Client is the credential of a connection to the pubsub endpoint.
+type Client struct {
+	UserID    string
+	MasterKey bool
+}
+
+func (a Access) permits(c Client) bool {
+	if c.MasterKey {
+		return a != AccessNone
+	}
+	switch a {
+	case AccessKey:
+		return true
+	case AccessUser:
+		return c.UserID != ""
+	}
+	return false
+}
+
+// Rule sets the access of channels matching Pattern, which is matched
+// with path.Match, so that "chat/*" matches "chat/room1" but not
+// "chat/room1/typing".
+type Rule struct {
+	Pattern   string `json:"pattern"`
+	Subscribe Access `json:"subscribe"`
+	Publish   Access `json:"publish"`
+}
+
+// Validate returns an error if the pattern or the accesses of the rule
+// is malformed.
+func (r Rule) Validate() error {
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("malformed pubsub channel pattern %q", r.Pattern)
+	}
+	if _, err := ParseAccess(string(r.Subscribe)); err != nil {
+		return err
+	}
+	if _, err := ParseAccess(string(r.Publish)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ACL decides whether a client may subscribe or publish on a channel.
+// The first rule matching the channel applies, or Subscribe and Publish
+// if no rules match. Rules can be changed at runtime.
+//
+// A nil ACL permits all clients.
+type ACL struct {
+	Subscribe Access
+	Publish   Access
+
+	// UserChannelPrefixes are the prefixes of channels private to a
+	// user, each followed by the ID of the user. Regardless of the rules,
+	// only the user and clients with the master key may subscribe on
+	// such a channel, and only clients with the master key may publish.
+	UserChannelPrefixes []string
+
+	mutex sync.RWMutex
+	rules []Rule
+}
+
+// SetRules replaces the rules of the ACL.
+func (acl *ACL) SetRules(rules []Rule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	acl.mutex.Lock()
+	defer acl.mutex.Unlock()
+	acl.rules = append([]Rule{}, rules...)
+	return nil
+}
+
+// Rules returns the rules of the ACL.
+func (acl *ACL) Rules() []Rule {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+	return append([]Rule{}, acl.rules...)
+}
+
+// CanSubscribe returns whether the client may subscribe on the channel.
+func (acl *ACL) CanSubscribe(c Client, channel string) bool {
+	if acl == nil {
+		return true
+	}
+	if owner, ok := acl.userChannelOwner(channel); ok {
+		return c.MasterKey || (c.UserID != "" && c.UserID == owner)
+	}
+	return acl.rule(channel).Subscribe.permits(c)
+}
+
+// CanPublish returns whether the client may publish on the channel.
+func (acl *ACL) CanPublish(c Client, channel string) bool {
+	if acl == nil {
+		return true
+	}
+	if _, ok := acl.userChannelOwner(channel); ok {
+		return c.MasterKey
+	}
+	return acl.rule(channel).Publish.permits(c)
+}
+
+// userChannelOwner returns the ID of the user whom channel is private to,
+// or false if it is not a user channel.
+func (acl *ACL) userChannelOwner(channel string) (string, bool) {
+	for _, prefix := range acl.UserChannelPrefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return strings.TrimPrefix(channel, prefix), true
+		}
+	}
+	return "", false
+}
+
+func (acl *ACL) rule(channel string) Rule {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+	for _, rule := range acl.rules {
+		if matched, _ := path.Match(rule.Pattern, channel); matched {
+			return rule
+		}
+	}
+	return Rule{
+		Pattern:   "*",
+		Subscribe: acl.Subscribe,
+		Publish:   acl.Publish,
+	}
+}
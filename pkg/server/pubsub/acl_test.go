@@ -0,0 +1,98 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestACL(t *testing.T) {
+	Convey("ACL", t, func() {
+		anonymous := Client{}
+		user := Client{UserID: "user0"}
+		master := Client{MasterKey: true}
+
+		acl := &ACL{
+			Subscribe: AccessKey,
+			Publish:   AccessUser,
+		}
+
+		Convey("permits all clients if nil", func() {
+			var acl *ACL
+			So(acl.CanSubscribe(anonymous, "chat/room1"), ShouldBeTrue)
+			So(acl.CanPublish(anonymous, "chat/room1"), ShouldBeTrue)
+		})
+
+		Convey("falls back to default access", func() {
+			So(acl.CanSubscribe(anonymous, "chat/room1"), ShouldBeTrue)
+			So(acl.CanPublish(anonymous, "chat/room1"), ShouldBeFalse)
+			So(acl.CanPublish(user, "chat/room1"), ShouldBeTrue)
+			So(acl.CanPublish(master, "chat/room1"), ShouldBeTrue)
+		})
+
+		Convey("applies the first rule matching the channel", func() {
+			err := acl.SetRules([]Rule{
+				{Pattern: "announcement", Subscribe: AccessKey, Publish: AccessMaster},
+				{Pattern: "chat/*", Subscribe: AccessUser, Publish: AccessUser},
+				{Pattern: "*", Subscribe: AccessNone, Publish: AccessNone},
+			})
+			So(err, ShouldBeNil)
+
+			So(acl.CanSubscribe(anonymous, "announcement"), ShouldBeTrue)
+			So(acl.CanPublish(user, "announcement"), ShouldBeFalse)
+			So(acl.CanPublish(master, "announcement"), ShouldBeTrue)
+
+			So(acl.CanSubscribe(anonymous, "chat/room1"), ShouldBeFalse)
+			So(acl.CanSubscribe(user, "chat/room1"), ShouldBeTrue)
+
+			So(acl.CanSubscribe(user, "lobby"), ShouldBeFalse)
+			So(acl.CanSubscribe(master, "lobby"), ShouldBeFalse)
+
+			// * does not match across /, so the default access applies
+			So(acl.CanSubscribe(anonymous, "chat/room1/typing"), ShouldBeTrue)
+			So(acl.CanPublish(anonymous, "chat/room1/typing"), ShouldBeFalse)
+		})
+
+		Convey("restricts user channels to the user", func() {
+			acl.UserChannelPrefixes = []string{"_chat_"}
+			err := acl.SetRules([]Rule{
+				{Pattern: "*", Subscribe: AccessKey, Publish: AccessKey},
+			})
+			So(err, ShouldBeNil)
+
+			So(acl.CanSubscribe(user, "_chat_user0"), ShouldBeTrue)
+			So(acl.CanSubscribe(user, "_chat_user1"), ShouldBeFalse)
+			So(acl.CanSubscribe(anonymous, "_chat_"), ShouldBeFalse)
+			So(acl.CanSubscribe(master, "_chat_user1"), ShouldBeTrue)
+
+			So(acl.CanPublish(user, "_chat_user0"), ShouldBeFalse)
+			So(acl.CanPublish(master, "_chat_user0"), ShouldBeTrue)
+
+			So(acl.CanSubscribe(user, "chat/room1"), ShouldBeTrue)
+		})
+
+		Convey("rejects malformed rules", func() {
+			So(acl.SetRules([]Rule{
+				{Pattern: "chat/[", Subscribe: AccessKey, Publish: AccessKey},
+			}), ShouldNotBeNil)
+			So(acl.SetRules([]Rule{
+				{Pattern: "chat/*", Subscribe: AccessKey, Publish: "anyone"},
+			}), ShouldNotBeNil)
+			So(acl.Rules(), ShouldBeEmpty)
+		})
+	})
+}
@@ -23,6 +23,7 @@ import (
 
 type connection struct {
 	ws       *websocket.Conn
+	client   Client
 	channels []string
 	Send     chan Parcel
 	done     chan bool
@@ -40,6 +41,10 @@ type wsPayload struct {
 type WsPubSub struct {
 	upgrader websocket.Upgrader
 	hub      *Hub
+
+	// ACL decides whether a client may subscribe or publish on a
+	// channel. All clients are permitted if it is nil.
+	ACL *ACL
 }
 
 // NewWsPubsub is factory for WsPubSub
@@ -56,29 +61,44 @@ func NewWsPubsub(hub *Hub) *WsPubSub {
 		},
 	}
 	ws := WsPubSub{
-		upgrader,
-		hub,
+		upgrader: upgrader,
+		hub:      hub,
 	}
 	go hub.run()
 	return &ws
 }
 
-// Handle will hijack the http responseWriter and req.
-func (w *WsPubSub) Handle(writer http.ResponseWriter, req *http.Request) {
+// Handle will hijack the http responseWriter and req. The client is
+// checked against the ACL on each subscribe and publish.
+func (w *WsPubSub) Handle(writer http.ResponseWriter, req *http.Request, client Client) {
 	conn, err := w.upgrader.Upgrade(writer, req, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	c := &connection{
-		ws:   conn,
-		Send: make(chan Parcel),
-		done: make(chan bool),
+		ws:     conn,
+		client: client,
+		Send:   make(chan Parcel),
+		done:   make(chan bool),
 	}
 	go w.writer(c)
 	go w.reader(c)
 }
 
+// deny tells the client that it is not permitted to subscribe or publish
+// on channel. The error is written by the writer goroutine, as a websocket
+// connection supports only one concurrent writer.
+func (c *connection) deny(action string, channel string) {
+	data, _ := json.Marshal(map[string]string{
+		"error": "permission denied to " + action + " channel " + channel,
+	})
+	c.Send <- Parcel{
+		Channel: channel,
+		Data:    data,
+	}
+}
+
 func (w *WsPubSub) writer(c *connection) {
 writer:
 	for {
@@ -139,6 +159,11 @@ func (w *WsPubSub) reader(c *connection) {
 		}
 		switch payload.Action {
 		case "sub":
+			if !w.ACL.CanSubscribe(c.client, payload.Channel) {
+				log.Debugf("Denied subscribing %v, %p", payload.Channel, c.ws)
+				c.deny("subscribe", payload.Channel)
+				break
+			}
 			w.hub.Subscribe <- Parcel{
 				Channel:    payload.Channel,
 				Connection: c,
@@ -160,6 +185,11 @@ func (w *WsPubSub) reader(c *connection) {
 				c.ws.WriteMessage(websocket.CloseMessage, nil)
 				return
 			}
+			if !w.ACL.CanPublish(c.client, payload.Channel) {
+				log.Debugf("Denied publishing %v, %p", payload.Channel, c.ws)
+				c.deny("publish", payload.Channel)
+				break
+			}
 			w.hub.Broadcast <- Parcel{
 				Channel: payload.Channel,
 				Data:    []byte(*payload.Data),
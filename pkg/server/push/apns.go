@@ -15,12 +15,14 @@
 package push
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/SkygearIO/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
@@ -57,7 +59,17 @@ type failedNotification struct {
 }
 
 // TODO: make something like APNSFeedbackHandler to handle the feedback from APNS so that the pusher will not have the reference to conn.
-func newPushService(client *http.Client, gatewayType GatewayType) (*push.Service, error) {
+func newPushService(client *http.Client, gatewayType GatewayType, outboundConfig outbound.Config) (*push.Service, error) {
+	if outboundConfig.Enabled() {
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("push/apns: unable to configure outbound connections of the APNS client")
+		}
+		if err := outboundConfig.Configure(transport); err != nil {
+			return nil, err
+		}
+	}
+
 	switch gatewayType {
 	case Sandbox:
 		return push.NewService(client, push.Development), nil
@@ -101,6 +113,14 @@ func unregisterDevice(pusher APNSPusher, deviceToken string, timestamp time.Time
 }
 
 func queueFailedNotification(pusher APNSPusher, deviceToken string, err push.Error) bool {
+	return queueFailedNotificationUntil(pusher, deviceToken, err, nil)
+}
+
+// queueFailedNotificationUntil queues the failed notification unless
+// stop is closed before it is received. The pusher must not close its
+// failed notification channel before stop is closed and the caller
+// returns.
+func queueFailedNotificationUntil(pusher APNSPusher, deviceToken string, err push.Error, stop <-chan struct{}) bool {
 	logger := log.WithFields(logrus.Fields{
 		"deviceToken": deviceToken,
 	})
@@ -110,9 +130,14 @@ func queueFailedNotification(pusher APNSPusher, deviceToken string, err push.Err
 		logger.Warn("Unable to queue failed notification for error handling because the pusher is not running")
 		return false
 	}
-	failed <- failedNotification{
+	select {
+	case failed <- failedNotification{
 		deviceToken: deviceToken,
 		err:         err,
+	}:
+	case <-stop:
+		logger.Warn("Unable to queue failed notification for error handling because the pusher is stopped")
+		return false
 	}
 	logger.Debug("Queued failed notification for error handling")
 	return true
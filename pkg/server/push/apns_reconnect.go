@@ -0,0 +1,283 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/SkygearIO/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+)
+
+const (
+	defaultReconnectInitialBackoff = 1 * time.Second
+	defaultReconnectMaxBackoff     = 5 * time.Minute
+	defaultReconnectQueueSize      = 10000
+
+	// flushPollInterval is how often Flush checks if the queue is empty.
+	flushPollInterval = 50 * time.Millisecond
+)
+
+var (
+	errNotificationQueued = errors.New("push/apns: notification is queued until the gateway is reconnected")
+	errReconnectQueueFull = errors.New("push/apns: notification queue is full while the gateway is reconnecting")
+	errReconnectStopped   = errors.New("push/apns: notification is dropped because the pusher is stopped")
+)
+
+var (
+	apnsConnectedGauge = metrics.NewGauge(
+		"skygear_apns_connected",
+		"Whether the APNS gateway is connected (1) or reconnecting (0).",
+	)
+	apnsQueuedGauge = metrics.NewGauge(
+		"skygear_apns_queued_notifications",
+		"Number of notifications queued while the APNS gateway is reconnecting.",
+	)
+	apnsReconnectCounter = metrics.NewCounter(
+		"skygear_apns_reconnect_attempts_total",
+		"Number of attempts to reconnect to the APNS gateway.",
+	)
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(apnsConnectedGauge)
+	metrics.DefaultRegistry.Register(apnsQueuedGauge)
+	metrics.DefaultRegistry.Register(apnsReconnectCounter)
+}
+
+type queuedNotification struct {
+	deviceToken string
+	headers     *push.Headers
+	payload     []byte
+}
+
+// reconnectingService wraps a pushService. When a push fails because
+// the connection to the gateway is dropped, notifications are queued
+// while it retries the oldest queued notification with exponential
+// backoff and jitter, until the gateway is reachable again.
+type reconnectingService struct {
+	service pushService
+
+	// failed is called with notifications rejected by APNS after
+	// being queued. It should give up when stop is closed.
+	failed func(deviceToken string, err push.Error, stop <-chan struct{})
+
+	// authorize, if set, updates the headers of a queued notification
+	// before it is sent, since the authorization token it was queued
+	// with may have expired
+	authorize func(headers *push.Headers)
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	queueSize      int
+
+	mutex     sync.Mutex
+	connected bool
+	queue     []queuedNotification
+	stop      chan struct{}
+	stopped   bool
+
+	// reconnecting is done when the reconnecting goroutine returns
+	reconnecting sync.WaitGroup
+}
+
+func newReconnectingService(service pushService, failed func(deviceToken string, err push.Error, stop <-chan struct{})) *reconnectingService {
+	apnsConnectedGauge.Set(1)
+	return &reconnectingService{
+		service:        service,
+		failed:         failed,
+		initialBackoff: defaultReconnectInitialBackoff,
+		maxBackoff:     defaultReconnectMaxBackoff,
+		queueSize:      defaultReconnectQueueSize,
+		connected:      true,
+		stop:           make(chan struct{}),
+	}
+}
+
+// isConnectionError returns whether the error is caused by failing to
+// reach the gateway, rather than APNS rejecting the notification.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := err.(*push.Error)
+	return !ok
+}
+
+// Push sends the notification, or queues it and returns
+// errNotificationQueued if the gateway is not reachable.
+func (s *reconnectingService) Push(deviceToken string, headers *push.Headers, payload []byte) (string, error) {
+	s.mutex.Lock()
+	connected := s.connected
+	s.mutex.Unlock()
+
+	if connected {
+		apnsid, err := s.service.Push(deviceToken, headers, payload)
+		if !isConnectionError(err) {
+			return apnsid, err
+		}
+		log.WithField("err", err).Warn("push/apns: connection to gateway is dropped, reconnecting")
+	}
+
+	return "", s.enqueue(queuedNotification{deviceToken, headers, payload})
+}
+
+func (s *reconnectingService) enqueue(notification queuedNotification) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return errReconnectStopped
+	}
+	if len(s.queue) >= s.queueSize {
+		return errReconnectQueueFull
+	}
+	s.queue = append(s.queue, notification)
+	apnsQueuedGauge.Set(float64(len(s.queue)))
+
+	if s.connected {
+		s.connected = false
+		apnsConnectedGauge.Set(0)
+		s.reconnecting.Add(1)
+		go s.reconnect()
+	}
+	return errNotificationQueued
+}
+
+// backoff returns the duration to wait before the specified attempt,
+// which doubles every attempt up to maxBackoff, with a random jitter of
+// up to half of the duration.
+func (s *reconnectingService) backoff(attempt int) time.Duration {
+	backoff := s.initialBackoff
+	for i := 0; i < attempt && backoff < s.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.maxBackoff {
+		backoff = s.maxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (s *reconnectingService) reconnect() {
+	defer s.reconnecting.Done()
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-time.After(s.backoff(attempt)):
+		case <-s.stop:
+			return
+		}
+
+		apnsReconnectCounter.Inc()
+		if s.flush() {
+			log.Info("push/apns: reconnected to gateway")
+			return
+		}
+	}
+}
+
+// flush sends the queued notifications in order. It returns true if
+// the queue is emptied, which marks the service as connected.
+func (s *reconnectingService) flush() bool {
+	for {
+		s.mutex.Lock()
+		if len(s.queue) == 0 {
+			s.connected = true
+			apnsConnectedGauge.Set(1)
+			s.mutex.Unlock()
+			return true
+		}
+		notification := s.queue[0]
+		s.mutex.Unlock()
+
+		headers := notification.headers
+		if s.authorize != nil && headers != nil {
+			authorized := *headers
+			s.authorize(&authorized)
+			headers = &authorized
+		}
+
+		apnsid, err := s.service.Push(notification.deviceToken, headers, notification.payload)
+		if isConnectionError(err) {
+			log.WithField("err", err).Debug("push/apns: gateway is still unreachable")
+			return false
+		}
+
+		s.mutex.Lock()
+		// the queue is discarded if the service is stopped meanwhile
+		if len(s.queue) > 0 {
+			s.queue = s.queue[1:]
+		}
+		apnsQueuedGauge.Set(float64(len(s.queue)))
+		s.mutex.Unlock()
+
+		logger := log.WithField("deviceToken", notification.deviceToken)
+		if pushError, ok := err.(*push.Error); ok && pushError != nil {
+			logger.WithField("apnsErrorReason", pushError.Reason).
+				Error("push/apns: failed to send queued push notification")
+			if s.failed != nil {
+				s.failed(notification.deviceToken, *pushError, s.stop)
+			}
+			continue
+		}
+		logger.WithField("apnsID", apnsid).Info("push/apns: queued push notification is sent")
+	}
+}
+
+// Flush waits until the queued notifications are sent, or ctx is done.
+func (s *reconnectingService) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mutex.Lock()
+		queued := len(s.queue)
+		s.mutex.Unlock()
+		if queued == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Stop stops reconnecting. Queued notifications are discarded. It
+// returns after the reconnecting goroutine returns, so that the failed
+// callback is not called afterwards.
+func (s *reconnectingService) Stop() {
+	s.mutex.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	if len(s.queue) > 0 {
+		log.Warnf("push/apns: discarding %d queued notifications", len(s.queue))
+	}
+	s.queue = nil
+	apnsQueuedGauge.Set(0)
+	s.mutex.Unlock()
+
+	s.reconnecting.Wait()
+}
@@ -0,0 +1,211 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkygearIO/buford/push"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyService fails with a connection error while down is true.
+type flakyService struct {
+	mutex          sync.Mutex
+	down           bool
+	sent           []string
+	authorizations []string
+	errs           map[string]*push.Error
+}
+
+func (s *flakyService) Push(deviceToken string, headers *push.Headers, payload []byte) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.down {
+		return "", errors.New("connection reset by peer")
+	}
+	if err, ok := s.errs[deviceToken]; ok {
+		return "", err
+	}
+	s.sent = append(s.sent, deviceToken)
+	s.authorizations = append(s.authorizations, headers.Authorization)
+	return "apnsid", nil
+}
+
+func (s *flakyService) setDown(down bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.down = down
+}
+
+func (s *flakyService) getSent() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.sent...)
+}
+
+func (s *flakyService) getAuthorizations() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.authorizations...)
+}
+
+func TestReconnectingService(t *testing.T) {
+	Convey("reconnectingService", t, func() {
+		flaky := &flakyService{
+			errs: map[string]*push.Error{
+				"badToken": &push.Error{Status: http.StatusGone},
+			},
+		}
+		failedTokens := make(chan string, 10)
+		service := newReconnectingService(flaky, func(deviceToken string, err push.Error, stop <-chan struct{}) {
+			failedTokens <- deviceToken
+		})
+		service.initialBackoff = 10 * time.Millisecond
+		service.maxBackoff = 20 * time.Millisecond
+		defer service.Stop()
+
+		Convey("pushes when connected", func() {
+			apnsid, err := service.Push("token1", &push.Headers{}, []byte("{}"))
+			So(err, ShouldBeNil)
+			So(apnsid, ShouldEqual, "apnsid")
+			So(apnsConnectedGauge.Value(), ShouldEqual, 1)
+		})
+
+		Convey("returns errors from APNS", func() {
+			_, err := service.Push("badToken", &push.Headers{}, []byte("{}"))
+			So(err, ShouldHaveSameTypeAs, &push.Error{})
+		})
+
+		Convey("queues notifications until reconnected", func() {
+			flaky.setDown(true)
+			_, err := service.Push("token1", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errNotificationQueued)
+			_, err = service.Push("badToken", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errNotificationQueued)
+			_, err = service.Push("token2", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errNotificationQueued)
+			So(apnsConnectedGauge.Value(), ShouldEqual, 0)
+			So(apnsQueuedGauge.Value(), ShouldEqual, 3)
+
+			time.Sleep(50 * time.Millisecond)
+			So(flaky.getSent(), ShouldBeEmpty)
+
+			flaky.setDown(false)
+			select {
+			case token := <-failedTokens:
+				So(token, ShouldEqual, "badToken")
+			case <-time.After(time.Second):
+				So("not reconnected", ShouldBeNil)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			So(flaky.getSent(), ShouldResemble, []string{"token1", "token2"})
+			So(apnsConnectedGauge.Value(), ShouldEqual, 1)
+			So(apnsQueuedGauge.Value(), ShouldEqual, 0)
+		})
+
+		Convey("flushes queued notifications", func() {
+			flaky.setDown(true)
+			service.Push("token1", &push.Headers{}, []byte("{}"))
+
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				flaky.setDown(false)
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			So(service.Flush(ctx), ShouldBeNil)
+			So(flaky.getSent(), ShouldResemble, []string{"token1"})
+		})
+
+		Convey("authorizes queued notifications when they are sent", func() {
+			service.authorize = func(headers *push.Headers) {
+				headers.Authorization = "newToken"
+			}
+			flaky.setDown(true)
+			service.Push("token1", &push.Headers{Authorization: "expiredToken"}, []byte("{}"))
+			flaky.setDown(false)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			So(service.Flush(ctx), ShouldBeNil)
+			So(flaky.getAuthorizations(), ShouldResemble, []string{"newToken"})
+		})
+
+		Convey("gives up queuing failed notifications when stopped", func() {
+			failed := make(chan failedNotification)
+			pusher := &mockPusher{failed: failed}
+			service.failed = func(deviceToken string, err push.Error, stop <-chan struct{}) {
+				queueFailedNotificationUntil(pusher, deviceToken, err, stop)
+			}
+			flaky.setDown(true)
+			service.Push("badToken", &push.Headers{}, []byte("{}"))
+			flaky.setDown(false)
+
+			// the failed notification is never received
+			time.Sleep(50 * time.Millisecond)
+			service.Stop()
+			close(failed)
+		})
+
+		Convey("drops notifications when stopped", func() {
+			flaky.setDown(true)
+			service.Stop()
+			_, err := service.Push("token1", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errReconnectStopped)
+		})
+
+		Convey("gives up flushing when context is done", func() {
+			flaky.setDown(true)
+			service.Push("token1", &push.Headers{}, []byte("{}"))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel()
+			So(service.Flush(ctx), ShouldEqual, context.DeadlineExceeded)
+			So(flaky.getSent(), ShouldBeEmpty)
+		})
+
+		Convey("rejects notifications when queue is full", func() {
+			service.queueSize = 1
+			flaky.setDown(true)
+			_, err := service.Push("token1", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errNotificationQueued)
+			_, err = service.Push("token2", &push.Headers{}, []byte("{}"))
+			So(err, ShouldEqual, errReconnectQueueFull)
+		})
+	})
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	Convey("backoff", t, func() {
+		service := &reconnectingService{
+			initialBackoff: time.Second,
+			maxBackoff:     10 * time.Second,
+		}
+
+		for i := 0; i < 10; i++ {
+			So(service.backoff(0), ShouldBeBetweenOrEqual, 500*time.Millisecond, time.Second)
+			So(service.backoff(2), ShouldBeBetweenOrEqual, 2*time.Second, 4*time.Second)
+			So(service.backoff(10), ShouldBeBetweenOrEqual, 5*time.Second, 10*time.Second)
+		}
+	})
+}
@@ -15,6 +15,7 @@
 package push
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"testing"
@@ -55,7 +56,7 @@ type mockConn struct {
 	skydb.Conn
 }
 
-func (c *mockConn) DeleteDevicesByToken(token string, t time.Time) error {
+func (c *mockConn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
 	c.calls = append(c.calls, deleteCall{token, t})
 	return c.err
 }
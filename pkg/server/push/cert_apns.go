@@ -15,6 +15,7 @@
 package push
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/asn1"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/SkygearIO/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
@@ -91,12 +93,14 @@ func findDefaultAPNSTopic(certificate tls.Certificate) (string, error) {
 }
 
 // NewCertBasedAPNSPusher returns a new APNSPusher from content of certificate
-// and private key as string
+// and private key as string. Connections to APNS are configured by
+// outboundConfig.
 func NewCertBasedAPNSPusher(
 	connOpener func() (skydb.Conn, error),
 	gatewayType GatewayType,
 	cert string,
 	key string,
+	outboundConfig outbound.Config,
 ) (APNSPusher, error) {
 	certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
 	if err != nil {
@@ -113,16 +117,19 @@ func NewCertBasedAPNSPusher(
 		return nil, err
 	}
 
-	service, err := newPushService(client, gatewayType)
+	service, err := newPushService(client, gatewayType, outboundConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return &certBasedAPNSPusher{
+	pusher := &certBasedAPNSPusher{
 		connOpener: connOpener,
-		service:    service,
 		topic:      topic,
-	}, nil
+	}
+	pusher.service = newReconnectingService(service, func(deviceToken string, err push.Error, stop <-chan struct{}) {
+		queueFailedNotificationUntil(pusher, deviceToken, err, stop)
+	})
+	return pusher, nil
 }
 
 // Start setups the pusher and starts it
@@ -141,10 +148,25 @@ func (pusher *certBasedAPNSPusher) Start() {
 	}()
 }
 
+// Flush waits until notifications queued while reconnecting to the
+// gateway are sent, or ctx is done.
+func (pusher *certBasedAPNSPusher) Flush(ctx context.Context) error {
+	if service, ok := pusher.service.(*reconnectingService); ok {
+		return service.Flush(ctx)
+	}
+	return nil
+}
+
 // Stop stops and cleans up the pusher
 func (pusher *certBasedAPNSPusher) Stop() {
-	close(pusher.failed)
-	pusher.failed = nil
+	if service, ok := pusher.service.(*reconnectingService); ok {
+		service.Stop()
+	}
+
+	if pusher.failed != nil {
+		close(pusher.failed)
+		pusher.failed = nil
+	}
 }
 
 // Send sends a notification to the device identified by the
@@ -176,6 +198,10 @@ func (pusher *certBasedAPNSPusher) Send(m Mapper, device skydb.Device) error {
 	}
 
 	apnsid, err := pusher.service.Push(device.Token, &headers, serializedPayload)
+	if err == errNotificationQueued {
+		logger.Info("push/apns: push notification is queued until the gateway is reconnected")
+		return nil
+	}
 	if err != nil {
 		if pushError, ok := err.(*push.Error); ok && pushError != nil {
 			// We recognize the error, and that error comes from APNS
@@ -204,5 +230,5 @@ func (pusher certBasedAPNSPusher) getFailedNotificationChannel() chan failedNoti
 }
 
 func (pusher certBasedAPNSPusher) deleteDeviceToken(token string, beforeTime time.Time) error {
-	return pusher.conn.DeleteDevicesByToken(token, beforeTime)
+	return pusher.conn.DeleteDevicesByToken(context.Background(), token, beforeTime)
 }
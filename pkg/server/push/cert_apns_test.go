@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/SkygearIO/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
@@ -73,7 +74,7 @@ g723fJntDb71I1IS31Vd2wqqpVB4kDp8OiPnPp8ats/cNUFk77Jhxw==
 -----END RSA PRIVATE KEY-----`
 
 	Convey("create cert based APNS from cert and key", t, func() {
-		pusher, err := NewCertBasedAPNSPusher(nil, Sandbox, APNSCert, APNSKey)
+		pusher, err := NewCertBasedAPNSPusher(nil, Sandbox, APNSCert, APNSKey, outbound.Config{})
 		So(err, ShouldBeNil)
 		So(pusher, ShouldNotBeNil)
 		So(pusher.(*certBasedAPNSPusher).topic, ShouldEqual, "com.example.App")
@@ -15,33 +15,151 @@
 package push
 
 import (
-	"github.com/google/go-gcm"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/mitchellh/mapstructure"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
-var gcmSendHTTP = gcm.SendHttp
+const (
+	fcmDefaultEndpoint = "https://fcm.googleapis.com"
+	fcmDefaultTokenURL = "https://oauth2.googleapis.com/token"
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+
+	// fcmAssertionExpiry is the lifetime of the signed assertion
+	// exchanged for an access token, which is the maximum allowed.
+	fcmAssertionExpiry = time.Hour
+
+	// fcmTokenRefreshMargin is how long before its expiry an access
+	// token is refreshed.
+	fcmTokenRefreshMargin = time.Minute
+)
 
-// GCMPusher sends push notifications via GCM.
+// GCMPusher sends push notifications to Android devices via the HTTP v1
+// API of Firebase Cloud Messaging, which replaces the legacy GCM API.
+//
+// Every request is authorized by an OAuth 2.0 access token, obtained by
+// signing an assertion with the service account key of the Firebase
+// project. The token is cached until shortly before it expires.
 type GCMPusher struct {
-	APIKey string
+	// ConnOpener is used to remove devices whose token is reported as
+	// unregistered by FCM. Invalid devices are not removed if it is nil.
+	ConnOpener func() (skydb.Conn, error)
+
+	projectID   string
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURL    string
+	endpoint    string
+	client      *http.Client
+
+	tokenMutex  sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewGCMPusher returns a GCMPusher. credentialsJSON is the content of a
+// service account key file of the Firebase project. Notifications are
+// sent to the project of the service account unless projectID is
+// specified.
+func NewGCMPusher(credentialsJSON []byte, projectID string, connOpener func() (skydb.Conn, error)) (*GCMPusher, error) {
+	account := fcmServiceAccount{}
+	if err := json.Unmarshal(credentialsJSON, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse fcm credentials: %v", err)
+	}
+	if account.ClientEmail == "" {
+		return nil, errors.New("fcm credentials do not contain client_email")
+	}
+
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	if projectID == "" {
+		return nil, errors.New("fcm project id is not set")
+	}
+
+	privateKey, err := parseFCMPrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = fcmDefaultTokenURL
+	}
+
+	return &GCMPusher{
+		ConnOpener:  connOpener,
+		projectID:   projectID,
+		clientEmail: account.ClientEmail,
+		privateKey:  privateKey,
+		tokenURL:    tokenURL,
+		endpoint:    fcmDefaultEndpoint,
+		client:      http.DefaultClient,
+	}, nil
+}
+
+func parseFCMPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("fcm credentials do not contain a PEM private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fcm private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("fcm private key is not an RSA key")
+	}
+	return key, nil
 }
 
 // Send sends the dictionary represented by m to device.
 func (p *GCMPusher) Send(m Mapper, device skydb.Device) error {
-	message := gcm.HttpMessage{}
-
-	if err := mapGCMMessage(m, &message); err != nil {
+	message, err := mapFCMMessage(m)
+	if err != nil {
 		log.Errorf("Failed to convert gcm message: %v", err)
 		return err
 	}
+	message.Token = device.Token
 
-	message.To = device.Token
-	message.RegistrationIds = nil
-
-	// NOTE(limouren): might need to check repsonse for deleted / invalid
-	// device here
-	if _, err := gcmSendHTTP(p.APIKey, message); err != nil {
+	err = p.send(message)
+	if fcmErr, ok := err.(*fcmError); ok && fcmErr.isTokenUnregistered() {
+		p.unregisterDevice(device.Token)
+		return nil
+	}
+	if err != nil {
 		log.Errorf("Failed to send GCM Notification: %v", err)
 		return err
 	}
@@ -49,12 +167,265 @@ func (p *GCMPusher) Send(m Mapper, device skydb.Device) error {
 	return nil
 }
 
-func mapGCMMessage(mapper Mapper, msg *gcm.HttpMessage) error {
-	m := mapper.Map()
-	if gcmMap, ok := m["gcm"].(map[string]interface{}); ok {
+func (p *GCMPusher) send(message fcmMessage) error {
+	accessToken, err := p.getAccessToken()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return err
+	}
+
+	projectPath := (&url.URL{Path: p.projectID}).EscapedPath()
+	sendURL := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.endpoint, projectPath)
+	req, err := http.NewRequest(http.MethodPost, sendURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// A rejected access token is obtained again on the next send.
+	if resp.StatusCode == http.StatusUnauthorized {
+		p.tokenMutex.Lock()
+		p.accessToken = ""
+		p.tokenMutex.Unlock()
+	}
+	return newFCMError(resp)
+}
+
+// getAccessToken returns the cached access token, or exchanges a newly
+// signed assertion for one if it is about to expire.
+func (p *GCMPusher) getAccessToken() (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	now := time.Now()
+	if p.accessToken != "" && now.Before(p.tokenExpiry.Add(-fcmTokenRefreshMargin)) {
+		return p.accessToken, nil
+	}
+
+	assertion, err := p.signAssertion(now)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.PostForm(p.tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("fcm token endpoint responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse fcm access token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("fcm token endpoint returned no access token")
+	}
+
+	p.accessToken = token.AccessToken
+	p.tokenExpiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return p.accessToken, nil
+}
+
+// signAssertion returns a JWT signed with RS256 by the service account,
+// to be exchanged for an access token of the FCM scope.
+//
+// See https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests
+func (p *GCMPusher) signAssertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   p.clientEmail,
+		"scope": fcmScope,
+		"aud":   p.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(fcmAssertionExpiry).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// fcmError is the error responded by FCM for a message not sent.
+type fcmError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	// ErrorCode is the FCM specific error code, such as UNREGISTERED.
+	ErrorCode string
+}
+
+func newFCMError(resp *http.Response) *fcmError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var errResp struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				Type      string `json:"@type"`
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	fcmErr := &fcmError{StatusCode: resp.StatusCode}
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		fcmErr.Message = strings.TrimSpace(string(body))
+		return fcmErr
+	}
+
+	fcmErr.Status = errResp.Error.Status
+	fcmErr.Message = errResp.Error.Message
+	for _, detail := range errResp.Error.Details {
+		if strings.HasSuffix(detail.Type, "google.firebase.fcm.v1.FcmError") {
+			fcmErr.ErrorCode = detail.ErrorCode
+		}
+	}
+	return fcmErr
+}
+
+func (e *fcmError) Error() string {
+	return fmt.Sprintf("fcm responded with status %d: %s %s", e.StatusCode, e.ErrorCode, e.Message)
+}
+
+// isTokenUnregistered returns true if FCM reports that the registration
+// token is no longer valid.
+func (e *fcmError) isTokenUnregistered() bool {
+	return e.ErrorCode == "UNREGISTERED"
+}
+
+func (p *GCMPusher) unregisterDevice(token string) {
+	if p.ConnOpener == nil {
+		return
+	}
+
+	conn, err := p.ConnOpener()
+	if err != nil {
+		log.Errorf("push/gcm: failed to open skydb.Conn: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.DeleteDevicesByToken(context.Background(), token, time.Now()); err != nil && err != skydb.ErrDeviceNotFound {
+		log.Errorf("push/gcm: failed to delete device token = %s: %v", token, err)
+		return
+	}
+
+	log.WithField("deviceToken", token).Info("push/gcm: unregistered device from skydb")
+}
+
+// gcmMessage is the message in the format of the legacy GCM API, which
+// the `gcm` dictionary of a notification is in.
+type gcmMessage struct {
+	CollapseKey           string                 `json:"collapse_key"`
+	Priority              string                 `json:"priority"`
+	TimeToLive            *int                   `json:"time_to_live"`
+	RestrictedPackageName string                 `json:"restricted_package_name"`
+	Data                  map[string]interface{} `json:"data"`
+	Notification          gcmNotification        `json:"notification"`
+}
+
+type gcmNotification struct {
+	Title        string   `json:"title"`
+	Body         string   `json:"body"`
+	Icon         string   `json:"icon"`
+	Sound        string   `json:"sound"`
+	Tag          string   `json:"tag"`
+	Color        string   `json:"color"`
+	ClickAction  string   `json:"click_action"`
+	BodyLocKey   string   `json:"body_loc_key"`
+	BodyLocArgs  []string `json:"body_loc_args"`
+	TitleLocKey  string   `json:"title_loc_key"`
+	TitleLocArgs []string `json:"title_loc_args"`
+}
+
+// fcmMessage is the message of the FCM HTTP v1 API.
+//
+// See https://firebase.google.com/docs/reference/fcm/rest/v1/projects.messages
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Data         map[string]string `json:"data,omitempty"`
+	Notification *fcmNotification  `json:"notification,omitempty"`
+	Android      *fcmAndroidConfig `json:"android,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmAndroidConfig struct {
+	CollapseKey           string                  `json:"collapse_key,omitempty"`
+	Priority              string                  `json:"priority,omitempty"`
+	TTL                   string                  `json:"ttl,omitempty"`
+	RestrictedPackageName string                  `json:"restricted_package_name,omitempty"`
+	Notification          *fcmAndroidNotification `json:"notification,omitempty"`
+}
+
+type fcmAndroidNotification struct {
+	Icon         string   `json:"icon,omitempty"`
+	Color        string   `json:"color,omitempty"`
+	Sound        string   `json:"sound,omitempty"`
+	Tag          string   `json:"tag,omitempty"`
+	ClickAction  string   `json:"click_action,omitempty"`
+	BodyLocKey   string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs  []string `json:"body_loc_args,omitempty"`
+	TitleLocKey  string   `json:"title_loc_key,omitempty"`
+	TitleLocArgs []string `json:"title_loc_args,omitempty"`
+}
+
+// mapFCMMessage converts the `gcm` dictionary of the notification, which
+// is in the format of the legacy GCM API, to a message of the FCM HTTP v1
+// API. Fields applicable to iOS only, such as badge and
+// content_available, are dropped. Values of data that are not strings
+// are encoded in JSON, as FCM only accepts string values.
+func mapFCMMessage(mapper Mapper) (fcmMessage, error) {
+	legacy := gcmMessage{}
+	if gcmMap, ok := mapper.Map()["gcm"].(map[string]interface{}); ok {
 		config := mapstructure.DecoderConfig{
 			TagName: "json",
-			Result:  msg,
+			Result:  &legacy,
 		}
 		// NewDecoder only returns error when DecoderConfig.Result
 		// is not a pointer.
@@ -64,9 +435,63 @@ func mapGCMMessage(mapper Mapper, msg *gcm.HttpMessage) error {
 		}
 
 		if err := decoder.Decode(gcmMap); err != nil {
-			return err
+			return fcmMessage{}, err
 		}
 	}
 
-	return nil
+	message := fcmMessage{}
+	if len(legacy.Data) > 0 {
+		message.Data = map[string]string{}
+		for key, value := range legacy.Data {
+			if s, ok := value.(string); ok {
+				message.Data[key] = s
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fcmMessage{}, fmt.Errorf("failed to encode data %s: %v", key, err)
+			}
+			message.Data[key] = string(encoded)
+		}
+	}
+
+	n := legacy.Notification
+	if n.Title != "" || n.Body != "" {
+		message.Notification = &fcmNotification{
+			Title: n.Title,
+			Body:  n.Body,
+		}
+	}
+
+	android := fcmAndroidConfig{
+		CollapseKey:           legacy.CollapseKey,
+		Priority:              strings.ToUpper(legacy.Priority),
+		RestrictedPackageName: legacy.RestrictedPackageName,
+	}
+	if legacy.TimeToLive != nil {
+		android.TTL = fmt.Sprintf("%ds", *legacy.TimeToLive)
+	}
+	androidNotification := fcmAndroidNotification{
+		Icon:         n.Icon,
+		Color:        n.Color,
+		Sound:        n.Sound,
+		Tag:          n.Tag,
+		ClickAction:  n.ClickAction,
+		BodyLocKey:   n.BodyLocKey,
+		BodyLocArgs:  n.BodyLocArgs,
+		TitleLocKey:  n.TitleLocKey,
+		TitleLocArgs: n.TitleLocArgs,
+	}
+	if androidNotification.Icon != "" || androidNotification.Color != "" ||
+		androidNotification.Sound != "" || androidNotification.Tag != "" ||
+		androidNotification.ClickAction != "" || androidNotification.BodyLocKey != "" ||
+		androidNotification.TitleLocKey != "" {
+		android.Notification = &androidNotification
+	}
+	if android.CollapseKey != "" || android.Priority != "" || android.TTL != "" ||
+		android.RestrictedPackageName != "" || android.Notification != nil {
+		message.Android = &android
+	}
+
+	return message, nil
 }
@@ -15,40 +15,149 @@
 package push
 
 import (
-	"errors"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/google/go-gcm"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// fakeFCMServer mimics the OAuth 2.0 token endpoint and the FCM HTTP v1
+// send endpoint.
+type fakeFCMServer struct {
+	clientEmail string
+	publicKey   *rsa.PublicKey
+
+	mutex        sync.Mutex
+	tokenIssued  int
+	messages     []string
+	sendStatus   int
+	sendResponse string
+}
+
+func (f *fakeFCMServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch r.URL.Path {
+	case "/token":
+		if !f.verifyAssertion(r.PostFormValue("assertion")) ||
+			r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		f.tokenIssued++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"accessToken","expires_in":3600,"token_type":"Bearer"}`))
+	case "/v1/projects/skygear-project/messages:send":
+		if r.Header.Get("Authorization") != "Bearer accessToken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":401,"status":"UNAUTHENTICATED"}}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		f.messages = append(f.messages, string(body))
+		if f.sendStatus != 0 {
+			w.WriteHeader(f.sendStatus)
+			w.Write([]byte(f.sendResponse))
+			return
+		}
+		w.Write([]byte(`{"name":"projects/skygear-project/messages/1"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeFCMServer) verifyAssertion(assertion string) bool {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if rsa.VerifyPKCS1v15(f.publicKey, crypto.SHA256, hashed[:], signature) != nil {
+		return false
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := struct {
+		Issuer string `json:"iss"`
+		Scope  string `json:"scope"`
+		Expiry int64  `json:"exp"`
+	}{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return false
+	}
+	return claims.Issuer == f.clientEmail &&
+		claims.Scope == fcmScope &&
+		time.Unix(claims.Expiry, 0).After(time.Now())
+}
+
+func newFCMTestCredentials(clientEmail string, tokenURI string) (*rsa.PrivateKey, []byte) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	credentials, _ := json.Marshal(fcmServiceAccount{
+		ProjectID:   "skygear-project",
+		ClientEmail: clientEmail,
+		PrivateKey:  string(keyPEM),
+		TokenURI:    tokenURI,
+	})
+	return privateKey, credentials
+}
+
 func TestGCMSend(t *testing.T) {
+	clientEmail := "skygear@skygear-project.iam.gserviceaccount.com"
+	fakeServer := &fakeFCMServer{clientEmail: clientEmail}
+	testServer := httptest.NewServer(fakeServer)
+	defer testServer.Close()
+
+	privateKey, credentials := newFCMTestCredentials(clientEmail, testServer.URL+"/token")
+	fakeServer.publicKey = &privateKey.PublicKey
+
 	Convey("GCMPusher", t, func() {
-		pusher := GCMPusher{
-			APIKey: "apiKey",
-		}
+		fakeServer.tokenIssued = 0
+		fakeServer.messages = nil
+		fakeServer.sendStatus = 0
+		fakeServer.sendResponse = ""
+
+		pusher, err := NewGCMPusher(credentials, "", nil)
+		So(err, ShouldBeNil)
+		pusher.endpoint = testServer.URL
+
 		device := skydb.Device{
 			Token: "deviceToken",
 		}
 
-		var (
-			apiKey     string
-			gcmMessage gcm.HttpMessage
-		)
-		gcmSendHTTP = func(k string, m gcm.HttpMessage) (*gcm.HttpResponse, error) {
-			apiKey = k
-			gcmMessage = m
-			return &gcm.HttpResponse{}, nil
-		}
-		defer func() {
-			gcmSendHTTP = gcm.SendHttp
-		}()
-
 		Convey("sends notification", func() {
 			err := pusher.Send(MapMapper{
 				"gcm": map[string]interface{}{
 					"content_available": true,
+					"priority":          "high",
+					"time_to_live":      60,
 					"notification": map[string]interface{}{
 						"title": "You have got a message",
 						"body":  "This is a message.",
@@ -67,35 +176,138 @@ func TestGCMSend(t *testing.T) {
 			}, device)
 
 			So(err, ShouldBeNil)
-			So(apiKey, ShouldEqual, "apiKey")
-			So(gcmMessage, ShouldResemble, gcm.HttpMessage{
-				To:               "deviceToken",
-				ContentAvailable: true,
-				Data: gcm.Data{
-					"string":  "value",
-					"integer": 1,
-					"nested": map[string]interface{}{
-						"should": "correct",
+			So(fakeServer.messages, ShouldHaveLength, 1)
+			So(fakeServer.messages[0], ShouldEqualJSON, `{
+				"message": {
+					"token": "deviceToken",
+					"notification": {
+						"title": "You have got a message",
+						"body": "This is a message."
 					},
-				},
-				Notification: gcm.Notification{
-					Title: "You have got a message",
-					Body:  "This is a message.",
-					Icon:  "myicon",
-					Sound: "default",
-					Badge: "5",
-				},
-			})
+					"android": {
+						"priority": "HIGH",
+						"ttl": "60s",
+						"notification": {
+							"icon": "myicon",
+							"sound": "default"
+						}
+					},
+					"data": {
+						"string": "value",
+						"integer": "1",
+						"nested": "{\"should\":\"correct\"}"
+					}
+				}
+			}`)
+		})
+
+		Convey("sends notification to the specified project", func() {
+			pusher, err := NewGCMPusher(credentials, "another-project", nil)
+			So(err, ShouldBeNil)
+			pusher.endpoint = testServer.URL
+
+			err = pusher.Send(EmptyMapper, device)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "404")
+		})
+
+		Convey("reuses access token", func() {
+			So(pusher.Send(EmptyMapper, device), ShouldBeNil)
+			So(pusher.Send(EmptyMapper, device), ShouldBeNil)
+			So(fakeServer.tokenIssued, ShouldEqual, 1)
+			So(fakeServer.messages, ShouldHaveLength, 2)
 		})
 
-		Convey("propagates error from gcm.SendHttp", func() {
-			gcmSendHTTP = func(string, gcm.HttpMessage) (*gcm.HttpResponse, error) {
-				return nil, errors.New("gcm_test: some error")
+		Convey("deletes device with unregistered token", func() {
+			conn := &gcmDeviceConn{}
+			pusher.ConnOpener = func() (skydb.Conn, error) {
+				return conn, nil
 			}
+			fakeServer.sendStatus = http.StatusNotFound
+			fakeServer.sendResponse = `{
+				"error": {
+					"code": 404,
+					"message": "Requested entity was not found.",
+					"status": "NOT_FOUND",
+					"details": [{
+						"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+						"errorCode": "UNREGISTERED"
+					}]
+				}
+			}`
 
 			err := pusher.Send(EmptyMapper, device)
-			So(err, ShouldResemble, errors.New("gcm_test: some error"))
+			So(err, ShouldBeNil)
+			So(conn.deletedTokens, ShouldResemble, []string{"deviceToken"})
+		})
+
+		Convey("propagates error from fcm", func() {
+			conn := &gcmDeviceConn{}
+			pusher.ConnOpener = func() (skydb.Conn, error) {
+				return conn, nil
+			}
+			fakeServer.sendStatus = http.StatusBadRequest
+			fakeServer.sendResponse = `{
+				"error": {
+					"code": 400,
+					"message": "The registration token is not a valid FCM registration token",
+					"status": "INVALID_ARGUMENT",
+					"details": [{
+						"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+						"errorCode": "INVALID_ARGUMENT"
+					}]
+				}
+			}`
+
+			err := pusher.Send(EmptyMapper, device)
+			So(err, ShouldResemble, &fcmError{
+				StatusCode: http.StatusBadRequest,
+				Status:     "INVALID_ARGUMENT",
+				Message:    "The registration token is not a valid FCM registration token",
+				ErrorCode:  "INVALID_ARGUMENT",
+			})
+			So(conn.deletedTokens, ShouldBeNil)
+		})
+
+		Convey("obtains a new access token after being rejected", func() {
+			pusher.accessToken = "expiredToken"
+			pusher.tokenExpiry = time.Now().Add(time.Hour)
+
+			So(pusher.Send(EmptyMapper, device), ShouldNotBeNil)
+			So(pusher.Send(EmptyMapper, device), ShouldBeNil)
+			So(fakeServer.tokenIssued, ShouldEqual, 1)
+		})
+	})
+
+	Convey("NewGCMPusher", t, func() {
+		Convey("rejects credentials without private key", func() {
+			_, err := NewGCMPusher([]byte(`{"project_id":"skygear-project","client_email":"skygear@example.com"}`), "", nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects credentials without project", func() {
+			_, credentials := newFCMTestCredentials(clientEmail, "")
+			account := map[string]interface{}{}
+			json.Unmarshal(credentials, &account)
+			delete(account, "project_id")
+			credentials, _ = json.Marshal(account)
+
+			_, err := NewGCMPusher(credentials, "", nil)
+			So(err, ShouldNotBeNil)
 		})
 	})
+}
+
+type gcmDeviceConn struct {
+	deletedTokens []string
+	skydb.Conn
+}
+
+func (c *gcmDeviceConn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
+	c.deletedTokens = append(c.deletedTokens, token)
+	return nil
+}
 
+func (c *gcmDeviceConn) Close() error {
+	return nil
 }
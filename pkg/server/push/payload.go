@@ -0,0 +1,240 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// ErrPayloadTooLarge is returned by PayloadFitter if a notification
+// cannot be fitted within the size limit of the gateway.
+var ErrPayloadTooLarge = errors.New("push: payload is too large")
+
+// ellipsis is appended to the truncated fields.
+const ellipsis = "…"
+
+// payloadLimit is the size limit of the payloads of a gateway.
+type payloadLimit struct {
+	// key is the key of the dictionary sent to the gateway in the
+	// notification.
+	key string
+
+	maxSize int
+
+	// minimal returns the payload without the custom data, which is
+	// marked so that the client fetches the content itself.
+	minimal func(payload map[string]interface{}) map[string]interface{}
+}
+
+var apnsPayloadLimit = payloadLimit{
+	key:     "apns",
+	maxSize: 4096,
+	minimal: func(payload map[string]interface{}) map[string]interface{} {
+		minimal := map[string]interface{}{"truncated": true}
+		if aps, ok := payload["aps"]; ok {
+			minimal["aps"] = aps
+		}
+		return minimal
+	},
+}
+
+var gcmPayloadLimit = payloadLimit{
+	key:     "gcm",
+	maxSize: 4096,
+	minimal: func(payload map[string]interface{}) map[string]interface{} {
+		minimal := map[string]interface{}{}
+		for key, value := range payload {
+			if key != "data" {
+				minimal[key] = value
+			}
+		}
+		// Values of the data of GCM must be strings.
+		minimal["data"] = map[string]interface{}{"truncated": "true"}
+		return minimal
+	},
+}
+
+// payloadLimits maps a device type to the size limit of its gateway.
+var payloadLimits = map[string]payloadLimit{
+	"aps":     apnsPayloadLimit,
+	"ios":     apnsPayloadLimit,
+	"gcm":     gcmPayloadLimit,
+	"android": gcmPayloadLimit,
+}
+
+// PayloadFitter is a Sender fitting notifications within the payload
+// size limits of APNS and GCM before passing them to Sender, instead of
+// having them rejected by the gateway.
+//
+// An oversized payload has its TrimFields truncated with an ellipsis
+// one by one. If it is still too large, the custom data is dropped and
+// the payload is marked as truncated, so that the client can fetch the
+// content itself. ErrPayloadTooLarge is returned if even that payload
+// is too large.
+type PayloadFitter struct {
+	Sender Sender
+
+	// TrimFields are the dot-separated key paths of the string fields
+	// in the payload which can be truncated, such as "aps.alert.body"
+	// and "notification.body". Fields not in a payload are ignored.
+	TrimFields []string
+}
+
+// Len returns the number of services registered with Sender if it is a
+// RouteSender, or 1 otherwise.
+func (f *PayloadFitter) Len() int {
+	if routeSender, ok := f.Sender.(interface {
+		Len() int
+	}); ok {
+		return routeSender.Len()
+	}
+	return 1
+}
+
+// Send fits the payload of m within the limit of the gateway of device
+// and sends it with Sender.
+func (f *PayloadFitter) Send(m Mapper, device skydb.Device) error {
+	limit, ok := payloadLimits[device.Type]
+	if !ok || m == nil {
+		return f.Sender.Send(m, device)
+	}
+
+	data := m.Map()
+	payload, ok := data[limit.key].(map[string]interface{})
+	if !ok {
+		return f.Sender.Send(m, device)
+	}
+
+	fitted, err := fitPayload(payload, limit, f.TrimFields)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"deviceID": device.ID,
+			"maxSize":  limit.maxSize,
+		}).Errorf("push: failed to fit notification payload: %v", err)
+		return err
+	}
+
+	fittedData := MapMapper{}
+	for key, value := range data {
+		fittedData[key] = value
+	}
+	fittedData[limit.key] = fitted
+	return f.Sender.Send(fittedData, device)
+}
+
+// fitPayload returns payload if it is within the limit, or a copy
+// trimmed to be within it.
+func fitPayload(payload map[string]interface{}, limit payloadLimit, trimFields []string) (map[string]interface{}, error) {
+	size, err := payloadSize(payload)
+	if err != nil || size <= limit.maxSize {
+		return payload, err
+	}
+
+	trimmed := copyPayload(payload)
+	if size, err = trimPayload(trimmed, trimFields, limit.maxSize); err != nil {
+		return nil, err
+	} else if size <= limit.maxSize {
+		return trimmed, nil
+	}
+
+	minimal := limit.minimal(copyPayload(payload))
+	if size, err = trimPayload(minimal, trimFields, limit.maxSize); err != nil {
+		return nil, err
+	} else if size <= limit.maxSize {
+		return minimal, nil
+	}
+	return nil, ErrPayloadTooLarge
+}
+
+// trimPayload truncates the trimFields of payload one by one until it is
+// within maxSize. It returns the size of the trimmed payload.
+func trimPayload(payload map[string]interface{}, trimFields []string, maxSize int) (int, error) {
+	size, err := payloadSize(payload)
+	for _, field := range trimFields {
+		if err != nil || size <= maxSize {
+			break
+		}
+		size, err = trimField(payload, strings.Split(field, "."), maxSize)
+	}
+	return size, err
+}
+
+// trimField truncates the string at the key path components of payload
+// to the longest prefix, followed by an ellipsis, that fits the payload
+// within maxSize. It returns the size of the trimmed payload.
+func trimField(payload map[string]interface{}, components []string, maxSize int) (int, error) {
+	parent := payload
+	for _, component := range components[:len(components)-1] {
+		child, ok := parent[component].(map[string]interface{})
+		if !ok {
+			return payloadSize(payload)
+		}
+		parent = child
+	}
+
+	key := components[len(components)-1]
+	value, ok := parent[key].(string)
+	if !ok || value == "" {
+		return payloadSize(payload)
+	}
+
+	// Find the longest prefix fitting the payload by binary search, or
+	// the empty prefix if none fits.
+	runes := []rune(value)
+	lo, hi := 0, len(runes)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		parent[key] = string(runes[:mid]) + ellipsis
+		size, err := payloadSize(payload)
+		if err != nil {
+			return 0, err
+		}
+		if size <= maxSize {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	parent[key] = string(runes[:lo]) + ellipsis
+	return payloadSize(payload)
+}
+
+func payloadSize(payload map[string]interface{}) (int, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	return len(encoded), nil
+}
+
+// copyPayload returns a copy of payload in which the nested maps are
+// copied too, so that trimming does not modify the notification of
+// other devices.
+func copyPayload(payload map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		if m, ok := value.(map[string]interface{}); ok {
+			value = copyPayload(m)
+		}
+		copied[key] = value
+	}
+	return copied
+}
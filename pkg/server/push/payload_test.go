@@ -0,0 +1,131 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPayloadFitter(t *testing.T) {
+	Convey("PayloadFitter", t, func() {
+		sender := mockSender{}
+		fitter := &PayloadFitter{
+			Sender:     &sender,
+			TrimFields: []string{"aps.alert.body", "notification.body"},
+		}
+		apnsDevice := skydb.Device{Type: "ios"}
+		gcmDevice := skydb.Device{Type: "android"}
+
+		encodedSize := func(i interface{}) int {
+			encoded, err := json.Marshal(i)
+			So(err, ShouldBeNil)
+			return len(encoded)
+		}
+
+		Convey("sends payload within limit as is", func() {
+			message := MapMapper{
+				"apns": map[string]interface{}{
+					"aps": map[string]interface{}{
+						"alert": map[string]interface{}{"body": "Hello"},
+					},
+				},
+			}
+			So(fitter.Send(message, apnsDevice), ShouldBeNil)
+			So(sender.note, ShouldResemble, message.Map())
+		})
+
+		Convey("truncates body of oversized APNS payload", func() {
+			body := strings.Repeat("好", 2000)
+			message := MapMapper{
+				"apns": map[string]interface{}{
+					"aps": map[string]interface{}{
+						"alert": map[string]interface{}{"body": body},
+					},
+					"message_id": "message1",
+				},
+			}
+			So(fitter.Send(message, apnsDevice), ShouldBeNil)
+
+			apns := sender.note["apns"].(map[string]interface{})
+			So(encodedSize(apns), ShouldBeLessThanOrEqualTo, 4096)
+			So(apns["message_id"], ShouldEqual, "message1")
+
+			trimmed := apns["aps"].(map[string]interface{})["alert"].(map[string]interface{})["body"].(string)
+			So(trimmed, ShouldEndWith, "…")
+			So(strings.TrimSuffix(trimmed, "…"), ShouldNotBeEmpty)
+			So(body, ShouldStartWith, strings.TrimSuffix(trimmed, "…"))
+
+			// The notification of other devices is not modified.
+			So(message["apns"].(map[string]interface{})["aps"].(map[string]interface{})["alert"].(map[string]interface{})["body"], ShouldEqual, body)
+		})
+
+		Convey("falls back to minimal APNS payload", func() {
+			message := MapMapper{
+				"apns": map[string]interface{}{
+					"aps": map[string]interface{}{
+						"alert": map[string]interface{}{"body": "Hello"},
+					},
+					"attachment": strings.Repeat("a", 5000),
+				},
+			}
+			So(fitter.Send(message, apnsDevice), ShouldBeNil)
+			So(sender.note["apns"], ShouldResemble, map[string]interface{}{
+				"aps": map[string]interface{}{
+					"alert": map[string]interface{}{"body": "Hello"},
+				},
+				"truncated": true,
+			})
+		})
+
+		Convey("falls back to minimal GCM payload", func() {
+			message := MapMapper{
+				"gcm": map[string]interface{}{
+					"priority":     "high",
+					"notification": map[string]interface{}{"body": "Hello"},
+					"data":         map[string]interface{}{"attachment": strings.Repeat("a", 5000)},
+				},
+			}
+			So(fitter.Send(message, gcmDevice), ShouldBeNil)
+			So(sender.note["gcm"], ShouldResemble, map[string]interface{}{
+				"priority":     "high",
+				"notification": map[string]interface{}{"body": "Hello"},
+				"data":         map[string]interface{}{"truncated": "true"},
+			})
+		})
+
+		Convey("returns error if payload cannot be fitted", func() {
+			message := MapMapper{
+				"apns": map[string]interface{}{
+					"aps": map[string]interface{}{
+						"alert": map[string]interface{}{"title": strings.Repeat("a", 5000)},
+					},
+				},
+			}
+			So(fitter.Send(message, apnsDevice), ShouldEqual, ErrPayloadTooLarge)
+			So(sender.note, ShouldBeNil)
+		})
+
+		Convey("reports the services of the route sender", func() {
+			routeSender := NewRouteSender()
+			routeSender.Route("aps", &sender)
+			So((&PayloadFitter{Sender: routeSender}).Len(), ShouldEqual, 1)
+		})
+	})
+}
@@ -15,6 +15,7 @@
 package push
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Sirupsen/logrus"
@@ -55,6 +56,14 @@ type Sender interface {
 	Send(m Mapper, device skydb.Device) error
 }
 
+// Flusher is implemented by a Sender that queues notifications to be
+// sent later, such as while the gateway is unreachable.
+type Flusher interface {
+	// Flush waits until the queued notifications are sent or ctx is
+	// done.
+	Flush(ctx context.Context) error
+}
+
 // RouteSender routes notifications to registered senders that is capable of
 // sending them. RouteSender itself doesn't send notifications.
 type RouteSender struct {
@@ -93,3 +102,34 @@ func (s RouteSender) Send(m Mapper, device skydb.Device) error {
 
 	return sender.Send(m, device)
 }
+
+// Shutdown flushes and stops the registered senders, such as on server
+// shutdown. Notifications not sent when ctx is done are discarded. It
+// returns the last error encountered.
+func (s RouteSender) Shutdown(ctx context.Context) error {
+	// A sender is registered for more than one service, such as APNS
+	// for both aps and ios.
+	shutdown := map[Sender]bool{}
+
+	var lastErr error
+	for _, sender := range s.senders {
+		flusher, canFlush := sender.(Flusher)
+		stopper, canStop := sender.(interface {
+			Stop()
+		})
+		if (!canFlush && !canStop) || shutdown[sender] {
+			continue
+		}
+		shutdown[sender] = true
+
+		if canFlush {
+			if err := flusher.Flush(ctx); err != nil {
+				lastErr = err
+			}
+		}
+		if canStop {
+			stopper.Stop()
+		}
+	}
+	return lastErr
+}
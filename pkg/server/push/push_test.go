@@ -15,6 +15,7 @@
 package push
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -92,6 +93,45 @@ func TestRouteSender(t *testing.T) {
 	})
 }
 
+type stoppingSender struct {
+	mockSender
+	flushed int
+	stopped int
+	err     error
+}
+
+func (s *stoppingSender) Flush(ctx context.Context) error {
+	s.flushed++
+	return s.err
+}
+
+func (s *stoppingSender) Stop() {
+	s.stopped++
+}
+
+func TestRouteSenderShutdown(t *testing.T) {
+	Convey("RouteSender Shutdown", t, func() {
+		routeSender := NewRouteSender()
+		apnsSender := &stoppingSender{}
+		gcmSender := &mockSender{}
+		routeSender.Route("aps", apnsSender)
+		routeSender.Route("ios", apnsSender)
+		routeSender.Route("gcm", gcmSender)
+
+		Convey("flushes and stops each sender once", func() {
+			So(routeSender.Shutdown(context.Background()), ShouldBeNil)
+			So(apnsSender.flushed, ShouldEqual, 1)
+			So(apnsSender.stopped, ShouldEqual, 1)
+		})
+
+		Convey("stops sender failed to flush", func() {
+			apnsSender.err = context.DeadlineExceeded
+			So(routeSender.Shutdown(context.Background()), ShouldEqual, context.DeadlineExceeded)
+			So(apnsSender.stopped, ShouldEqual, 1)
+		})
+	})
+}
+
 func jsonToMap(j string) map[string]interface{} {
 	m := map[string]interface{}{}
 	if err := json.Unmarshal([]byte(j), &m); err != nil {
@@ -15,6 +15,7 @@
 package push
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -27,6 +28,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/SkygearIO/buford/push"
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
@@ -57,13 +59,15 @@ type token struct {
 	expiredAt time.Time
 }
 
-// NewTokenBasedAPNSPusher creates a new APNSPusher from the content of auth key
+// NewTokenBasedAPNSPusher creates a new APNSPusher from the content of auth key.
+// Connections to APNS are configured by outboundConfig.
 func NewTokenBasedAPNSPusher(
 	connOpener func() (skydb.Conn, error),
 	gatewayType GatewayType,
 	teamID string,
 	keyID string,
 	key string,
+	outboundConfig outbound.Config,
 ) (APNSPusher, error) {
 	keyBlock, _ := pem.Decode([]byte(key))
 	if keyBlock == nil {
@@ -80,21 +84,28 @@ func NewTokenBasedAPNSPusher(
 		return nil, err
 	}
 
-	service, err := newPushService(client, gatewayType)
+	service, err := newPushService(client, gatewayType, outboundConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	switch typedKey := privateKey.(type) {
 	case *ecdsa.PrivateKey:
-		return &tokenBasedAPNSPusher{
+		pusher := &tokenBasedAPNSPusher{
 			connOpener: connOpener,
-			service:    service,
 			teamID:     teamID,
 			keyID:      keyID,
 			privateKey: typedKey,
 			tokenMutex: &sync.RWMutex{},
-		}, nil
+		}
+		reconnecting := newReconnectingService(service, func(deviceToken string, err push.Error, stop <-chan struct{}) {
+			queueFailedNotificationUntil(pusher, deviceToken, err, stop)
+		})
+		reconnecting.authorize = func(headers *push.Headers) {
+			headers.Authorization = pusher.getToken().value
+		}
+		pusher.service = reconnecting
+		return pusher, nil
 	default:
 		return nil, errors.New("Unknown APNS Auth Key type")
 	}
@@ -169,12 +180,29 @@ func (pusher *tokenBasedAPNSPusher) Start() {
 	}()
 }
 
+// Flush waits until notifications queued while reconnecting to the
+// gateway are sent, or ctx is done.
+func (pusher *tokenBasedAPNSPusher) Flush(ctx context.Context) error {
+	if service, ok := pusher.service.(*reconnectingService); ok {
+		return service.Flush(ctx)
+	}
+	return nil
+}
+
 // Stop stops and cleans up the pusher
 func (pusher *tokenBasedAPNSPusher) Stop() {
-	close(pusher.failed)
-	pusher.failed = nil
+	if service, ok := pusher.service.(*reconnectingService); ok {
+		service.Stop()
+	}
+
+	if pusher.failed != nil {
+		close(pusher.failed)
+		pusher.failed = nil
+	}
 
-	pusher.tokenRefreshTimer.Stop()
+	if pusher.tokenRefreshTimer != nil {
+		pusher.tokenRefreshTimer.Stop()
+	}
 }
 
 // Send sends a notification to the device identified by the
@@ -212,6 +240,10 @@ func (pusher *tokenBasedAPNSPusher) Send(m Mapper, device skydb.Device) error {
 	}
 
 	apnsid, err := pusher.service.Push(device.Token, &headers, serializedPayload)
+	if err == errNotificationQueued {
+		logger.Info("push/apns: push notification is queued until the gateway is reconnected")
+		return nil
+	}
 	if err != nil {
 		if pushError, ok := err.(*push.Error); ok && pushError != nil {
 			// We recognize the error, and that error comes from APNS
@@ -240,5 +272,5 @@ func (pusher tokenBasedAPNSPusher) getFailedNotificationChannel() chan failedNot
 }
 
 func (pusher tokenBasedAPNSPusher) deleteDeviceToken(token string, beforeTime time.Time) error {
-	return pusher.conn.DeleteDevicesByToken(token, beforeTime)
+	return pusher.conn.DeleteDevicesByToken(context.Background(), token, beforeTime)
 }
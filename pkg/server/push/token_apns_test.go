@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/SkygearIO/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/outbound"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
@@ -39,6 +40,7 @@ func TestTokenBaseAPNSPusherCreate(t *testing.T) {
 			"test-team-id",
 			"test-key-id",
 			testTokenKey,
+			outbound.Config{},
 		)
 		So(err, ShouldBeNil)
 		So(pusher, ShouldNotBeNil)
@@ -56,6 +58,7 @@ func TestTokenBaseAPNSPusherSend(t *testing.T) {
 			"test-team-id",
 			"test-key-id",
 			testTokenKey,
+			outbound.Config{},
 		)
 		So(err, ShouldBeNil)
 
@@ -207,6 +210,7 @@ func TestTokenBaseAPNSPusherFeedbackInterface(t *testing.T) {
 			"test-team-id",
 			"test-key-id",
 			testTokenKey,
+			outbound.Config{},
 		)
 		So(err, ShouldBeNil)
 
@@ -0,0 +1,133 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota limits the storage used by the private database of
+// each user.
+package quota
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Limits are the maximum usage of a private database. A zero limit
+// means unlimited.
+type Limits struct {
+	RecordCount uint64 `json:"record_count"`
+
+	// StorageSize is in bytes.
+	StorageSize uint64 `json:"storage_size"`
+}
+
+// Status reports the usage of a private database against the Limits.
+type Status struct {
+	Usage  skydb.DatabaseUsage `json:"usage"`
+	Limits Limits              `json:"limits"`
+
+	// Reached is true if no more records can be saved.
+	Reached bool `json:"reached"`
+}
+
+// Enforcer enforces Limits on private databases.
+//
+// An Enforcer without any limits is disabled and allows all saves.
+type Enforcer struct {
+	Limits Limits
+}
+
+// Enabled returns true if any of the limits is set.
+func (e *Enforcer) Enabled() bool {
+	return e != nil && (e.Limits.RecordCount > 0 || e.Limits.StorageSize > 0)
+}
+
+// Applies returns true if the Limits are enforced on db.
+func (e *Enforcer) Applies(db skydb.Database) bool {
+	return e.Enabled() && db.DatabaseType() == skydb.PrivateDatabase
+}
+
+// Status returns the usage of db against the Limits.
+func (e *Enforcer) Status(ctx context.Context, db skydb.Database) (*Status, error) {
+	counter, ok := db.(skydb.UsageCounter)
+	if !ok {
+		return nil, skyerr.NewError(skyerr.NotSupported, "database does not support usage reporting")
+	}
+
+	usage, err := counter.Usage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Usage: usage,
+	}
+	if e != nil {
+		status.Limits = e.Limits
+		status.Reached = e.storageExceeded(usage) || e.recordCountExceeded(usage, 1)
+	}
+	return status, nil
+}
+
+// CheckSave returns a QuotaExceeded error if saving records to db, of
+// which newRecordCount are new records, would exceed the Limits.
+//
+// Updating existing records is rejected only when the storage limit has
+// already been reached.
+func (e *Enforcer) CheckSave(ctx context.Context, db skydb.Database, newRecordCount int) skyerr.Error {
+	if !e.Applies(db) {
+		return nil
+	}
+
+	status, err := e.Status(ctx, db)
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+
+	usage := status.Usage
+	if e.storageExceeded(usage) {
+		return skyerr.NewErrorWithInfo(
+			skyerr.QuotaExceeded,
+			fmt.Sprintf("private database storage quota exceeded: %d of %d bytes used", usage.StorageSize, e.Limits.StorageSize),
+			map[string]interface{}{
+				"quota": "storage_size",
+				"usage": usage.StorageSize,
+				"limit": e.Limits.StorageSize,
+			},
+		)
+	}
+
+	if e.recordCountExceeded(usage, newRecordCount) {
+		return skyerr.NewErrorWithInfo(
+			skyerr.QuotaExceeded,
+			fmt.Sprintf("private database record quota exceeded: cannot add %d records to %d of %d records", newRecordCount, usage.RecordCount, e.Limits.RecordCount),
+			map[string]interface{}{
+				"quota": "record_count",
+				"usage": usage.RecordCount,
+				"limit": e.Limits.RecordCount,
+			},
+		)
+	}
+
+	return nil
+}
+
+func (e *Enforcer) storageExceeded(usage skydb.DatabaseUsage) bool {
+	return e.Limits.StorageSize > 0 && usage.StorageSize >= e.Limits.StorageSize
+}
+
+func (e *Enforcer) recordCountExceeded(usage skydb.DatabaseUsage, newRecordCount int) bool {
+	return e.Limits.RecordCount > 0 && usage.RecordCount+uint64(newRecordCount) > e.Limits.RecordCount
+}
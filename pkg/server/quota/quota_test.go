@@ -0,0 +1,114 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type usageDatabase struct {
+	databaseType skydb.DatabaseType
+	usage        skydb.DatabaseUsage
+	skydb.Database
+}
+
+func (db *usageDatabase) DatabaseType() skydb.DatabaseType {
+	return db.databaseType
+}
+
+func (db *usageDatabase) Usage() (skydb.DatabaseUsage, error) {
+	return db.usage, nil
+}
+
+func TestEnforcer(t *testing.T) {
+	Convey("Enforcer", t, func() {
+		db := &usageDatabase{
+			databaseType: skydb.PrivateDatabase,
+			usage: skydb.DatabaseUsage{
+				RecordCount: 8,
+				StorageSize: 2048,
+			},
+		}
+
+		Convey("is disabled without limits", func() {
+			var nilEnforcer *Enforcer
+			So(nilEnforcer.Enabled(), ShouldBeFalse)
+			So(nilEnforcer.CheckSave(context.Background(), db, 100), ShouldBeNil)
+
+			enforcer := &Enforcer{}
+			So(enforcer.Enabled(), ShouldBeFalse)
+			So(enforcer.CheckSave(context.Background(), db, 100), ShouldBeNil)
+		})
+
+		Convey("applies to private database only", func() {
+			enforcer := &Enforcer{Limits: Limits{RecordCount: 1}}
+			So(enforcer.Applies(db), ShouldBeTrue)
+
+			db.databaseType = skydb.PublicDatabase
+			So(enforcer.Applies(db), ShouldBeFalse)
+			So(enforcer.CheckSave(context.Background(), db, 100), ShouldBeNil)
+		})
+
+		Convey("allows new records within record count limit", func() {
+			enforcer := &Enforcer{Limits: Limits{RecordCount: 10}}
+			So(enforcer.CheckSave(context.Background(), db, 2), ShouldBeNil)
+		})
+
+		Convey("rejects new records exceeding record count limit", func() {
+			enforcer := &Enforcer{Limits: Limits{RecordCount: 10}}
+			err := enforcer.CheckSave(context.Background(), db, 3)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.QuotaExceeded)
+			So(err.Message(), ShouldEqual, "private database record quota exceeded: cannot add 3 records to 8 of 10 records")
+			So(err.Info(), ShouldResemble, map[string]interface{}{
+				"quota": "record_count",
+				"usage": uint64(8),
+				"limit": uint64(10),
+			})
+		})
+
+		Convey("allows updates at record count limit", func() {
+			enforcer := &Enforcer{Limits: Limits{RecordCount: 8}}
+			So(enforcer.CheckSave(context.Background(), db, 0), ShouldBeNil)
+		})
+
+		Convey("rejects saves when storage limit is reached", func() {
+			enforcer := &Enforcer{Limits: Limits{StorageSize: 2048}}
+			err := enforcer.CheckSave(context.Background(), db, 0)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.QuotaExceeded)
+			So(err.Message(), ShouldEqual, "private database storage quota exceeded: 2048 of 2048 bytes used")
+		})
+
+		Convey("reports status", func() {
+			enforcer := &Enforcer{Limits: Limits{RecordCount: 8}}
+			status, err := enforcer.Status(context.Background(), db)
+			So(err, ShouldBeNil)
+			So(status, ShouldResemble, &Status{
+				Usage: skydb.DatabaseUsage{
+					RecordCount: 8,
+					StorageSize: 2048,
+				},
+				Limits:  Limits{RecordCount: 8},
+				Reached: true,
+			})
+		})
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recordid validates the keys of records created by clients, and
+// generates keys for records created without one.
+package recordid
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+var uuidNew = uuid.New
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Format is the format of record keys supplied by clients, after the
+// prefix of the record type.
+type Format string
+
+// The formats supported by a Policy.
+const (
+	AnyFormat  Format = "any"
+	UUIDFormat Format = "uuid"
+)
+
+// ParseFormat returns the Format named s, which is AnyFormat if s is
+// empty.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", AnyFormat:
+		return AnyFormat, nil
+	case UUIDFormat:
+		return UUIDFormat, nil
+	}
+	return "", fmt.Errorf("unknown record id format %#v", s)
+}
+
+// Policy decides the keys clients can supply when creating records, so
+// that records created offline can be saved later without rewriting
+// their IDs.
+//
+// A nil Policy accepts any non-empty key. Keys of existing records are not
+// checked.
+type Policy struct {
+	// Format is the format of keys after the prefix.
+	Format Format
+
+	// Prefixes maps a record type to the prefix keys of that type must
+	// start with.
+	Prefixes map[string]string
+
+	// ServerGenerated are the record types whose keys cannot be
+	// supplied by clients. Records of these types are created without a
+	// key, and NewKey generates one.
+	ServerGenerated map[string]bool
+}
+
+// NewKey returns a unique key for a new record of recordType, which
+// satisfies the policy.
+func (p *Policy) NewKey(recordType string) string {
+	return p.prefix(recordType) + uuidNew()
+}
+
+// Validate returns an InvalidArgument error if a client cannot create a
+// record with the specified id.
+func (p *Policy) Validate(id skydb.RecordID) skyerr.Error {
+	if id.Key == "" {
+		return invalidKey("record key cannot be empty")
+	}
+	if p == nil {
+		return nil
+	}
+
+	if p.ServerGenerated[id.Type] {
+		return invalidKey(fmt.Sprintf("keys of %s records are generated by server and cannot be supplied", id.Type))
+	}
+
+	prefix := p.prefix(id.Type)
+	if !strings.HasPrefix(id.Key, prefix) {
+		return invalidKey(fmt.Sprintf("keys of %s records must start with %q", id.Type, prefix))
+	}
+
+	if p.Format == UUIDFormat && !uuidPattern.MatchString(id.Key[len(prefix):]) {
+		return invalidKey("record key must be a UUID")
+	}
+	return nil
+}
+
+func (p *Policy) prefix(recordType string) string {
+	if p == nil {
+		return ""
+	}
+	return p.Prefixes[recordType]
+}
+
+func invalidKey(message string) skyerr.Error {
+	return skyerr.NewInvalidArgument(message, []string{"_id"})
+}
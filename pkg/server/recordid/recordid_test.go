@@ -0,0 +1,87 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordid
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Policy", t, func() {
+		uuidNew = func() string { return "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10" }
+		defer func() {
+			uuidNew = uuid.New
+		}()
+
+		policy := &Policy{
+			Format:          UUIDFormat,
+			Prefixes:        map[string]string{"note": "note-"},
+			ServerGenerated: map[string]bool{"invoice": true},
+		}
+
+		Convey("accepts keys in format with prefix", func() {
+			So(policy.Validate(skydb.NewRecordID("note", "note-6f2e6d2a-8a0e-4d7b-9d55-3c1b2a7e9f10")), ShouldBeNil)
+			So(policy.Validate(skydb.NewRecordID("comment", "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10")), ShouldBeNil)
+		})
+
+		Convey("rejects keys without prefix", func() {
+			err := policy.Validate(skydb.NewRecordID("note", "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10"))
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, `keys of note records must start with "note-"`)
+		})
+
+		Convey("rejects keys not in format", func() {
+			So(policy.Validate(skydb.NewRecordID("note", "note-1")), ShouldNotBeNil)
+			So(policy.Validate(skydb.NewRecordID("comment", "")), ShouldNotBeNil)
+		})
+
+		Convey("rejects keys of server generated types", func() {
+			err := policy.Validate(skydb.NewRecordID("invoice", "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10"))
+			So(err, ShouldNotBeNil)
+			So(err.Message(), ShouldEqual, "keys of invoice records are generated by server and cannot be supplied")
+		})
+
+		Convey("generates keys with prefix", func() {
+			So(policy.NewKey("note"), ShouldEqual, "note-6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10")
+			So(policy.NewKey("invoice"), ShouldEqual, "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10")
+		})
+
+		Convey("accepts any non-empty key if nil", func() {
+			policy = nil
+			So(policy.Validate(skydb.NewRecordID("note", "1")), ShouldBeNil)
+			So(policy.Validate(skydb.NewRecordID("note", "")), ShouldNotBeNil)
+			So(policy.NewKey("note"), ShouldEqual, "6F2E6D2A-8A0E-4D7B-9D55-3C1B2A7E9F10")
+		})
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	Convey("ParseFormat", t, func() {
+		format, err := ParseFormat("")
+		So(err, ShouldBeNil)
+		So(format, ShouldEqual, AnyFormat)
+
+		format, err = ParseFormat("uuid")
+		So(err, ShouldBeNil)
+		So(format, ShouldEqual, UUIDFormat)
+
+		_, err = ParseFormat("serial")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package responsecache caches the responses of read actions in memory,
+// so that clients refreshing the same data repeatedly are answered
+// without querying the database again.
+package responsecache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+)
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+type entry struct {
+	response *router.CachedResponse
+	expireAt time.Time
+}
+
+// Cache is a router.ResponseCache keeping responses in memory for TTL.
+// A successful request to any of the InvalidatingActions drops all
+// cached responses. Writes not made through the router, e.g. by another
+// server process, are only picked up when the responses expire.
+//
+// A nil Cache or one without any actions caches nothing.
+type Cache struct {
+	// Actions are the actions whose responses are cached.
+	Actions []string
+
+	// InvalidatingActions are the actions that may change the
+	// responses of Actions.
+	InvalidatingActions []string
+
+	// TTL is how long a response is cached for.
+	TTL time.Duration
+
+	// MaxEntries limits the number of cached responses. Zero means
+	// unlimited.
+	MaxEntries int
+
+	mutex      sync.Mutex
+	generation uint64
+	entries    map[string]entry
+}
+
+// Enabled returns true if any action is cached.
+func (c *Cache) Enabled() bool {
+	return c != nil && len(c.Actions) > 0 && c.TTL > 0
+}
+
+// Handles returns true if action is one of the Actions.
+func (c *Cache) Handles(action string) bool {
+	return c.Enabled() && contains(c.Actions, action)
+}
+
+// Get returns the response cached under key if it has not expired.
+func (c *Cache) Get(key string) (*router.CachedResponse, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, c.generation
+	}
+	if !timeNow().Before(e.expireAt) {
+		delete(c.entries, key)
+		return nil, c.generation
+	}
+	return e.response, c.generation
+}
+
+// Put caches response under key until TTL has passed. Nothing is cached
+// if the cache is invalidated after generation, because the response
+// may have been generated before the invalidating write.
+func (c *Cache) Put(key string, generation uint64, response *router.CachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[string]entry{}
+	}
+	if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evict()
+	}
+	c.entries[key] = entry{
+		response: response,
+		expireAt: timeNow().Add(c.TTL),
+	}
+}
+
+// Invalidate drops all cached responses if action is one of the
+// InvalidatingActions.
+func (c *Cache) Invalidate(action string) {
+	if !c.Enabled() || !contains(c.InvalidatingActions, action) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.entries = nil
+}
+
+// evict removes expired responses, or an arbitrary one if none has
+// expired. The caller must hold the mutex.
+func (c *Cache) evict() {
+	now := timeNow()
+	for key, e := range c.entries {
+		if !now.Before(e.expireAt) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.MaxEntries {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package responsecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("Cache", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		cache := &Cache{
+			Actions:             []string{"record:fetch"},
+			InvalidatingActions: []string{"record:save"},
+			TTL:                 time.Minute,
+		}
+		response := &router.CachedResponse{
+			ETag: `"etag"`,
+			Body: []byte(`{"result":[]}`),
+		}
+
+		Convey("is disabled without actions", func() {
+			So((*Cache)(nil).Enabled(), ShouldBeFalse)
+			So((&Cache{TTL: time.Minute}).Enabled(), ShouldBeFalse)
+			So((&Cache{Actions: []string{"record:fetch"}}).Enabled(), ShouldBeFalse)
+			So(cache.Enabled(), ShouldBeTrue)
+		})
+
+		Convey("handles actions", func() {
+			So(cache.Handles("record:fetch"), ShouldBeTrue)
+			So(cache.Handles("record:save"), ShouldBeFalse)
+		})
+
+		Convey("returns cached response", func() {
+			cached, generation := cache.Get("key")
+			So(cached, ShouldBeNil)
+
+			cache.Put("key", generation, response)
+			cached, _ = cache.Get("key")
+			So(cached, ShouldEqual, response)
+		})
+
+		Convey("expires response after TTL", func() {
+			_, generation := cache.Get("key")
+			cache.Put("key", generation, response)
+
+			now = now.Add(time.Minute)
+			cached, _ := cache.Get("key")
+			So(cached, ShouldBeNil)
+		})
+
+		Convey("drops responses on invalidating action", func() {
+			_, generation := cache.Get("key")
+			cache.Put("key", generation, response)
+
+			cache.Invalidate("record:fetch")
+			cached, _ := cache.Get("key")
+			So(cached, ShouldEqual, response)
+
+			cache.Invalidate("record:save")
+			cached, _ = cache.Get("key")
+			So(cached, ShouldBeNil)
+		})
+
+		Convey("does not cache response generated before invalidation", func() {
+			_, generation := cache.Get("key")
+			cache.Invalidate("record:save")
+			cache.Put("key", generation, response)
+
+			cached, _ := cache.Get("key")
+			So(cached, ShouldBeNil)
+		})
+
+		Convey("limits number of entries", func() {
+			cache.MaxEntries = 2
+			_, generation := cache.Get("key1")
+			cache.Put("key1", generation, response)
+			cache.Put("key2", generation, response)
+			cache.Put("key3", generation, response)
+
+			So(len(cache.entries), ShouldEqual, 2)
+			cached, _ := cache.Get("key3")
+			So(cached, ShouldEqual, response)
+		})
+	})
+}
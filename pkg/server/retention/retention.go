@@ -0,0 +1,279 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retention removes records that are older than the retention
+// rules configured for their record type. Expired records are either
+// deleted, or passed to archive hooks so that they can be copied
+// elsewhere before being removed. Archived records can also be kept in
+// the archive table of the database, from which record:archive_fetch
+// reads them.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("retention")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// batchSize is the number of expired records fetched at a time.
+const batchSize uint64 = 100
+
+// Action is what to do with an expired record.
+type Action string
+
+// The actions supported by a retention rule.
+const (
+	Delete  Action = "delete"
+	Archive Action = "archive"
+)
+
+// Rule removes records of RecordType created more than MaxAge ago.
+// If Predicate is not empty, only records matching it are removed.
+//
+// If ArchiveInDB is true, archived records are copied to the archive
+// table of the connection, which must implement skydb.RecordArchive.
+type Rule struct {
+	RecordType  string
+	MaxAge      time.Duration
+	Action      Action
+	Predicate   skydb.Predicate
+	ArchiveInDB bool
+}
+
+// Validate returns an error if the rule cannot be run.
+func (rule Rule) Validate() error {
+	if rule.RecordType == "" {
+		return fmt.Errorf("retention rule record type is empty")
+	}
+	if rule.MaxAge <= 0 {
+		return fmt.Errorf("retention rule of %s has non-positive max age", rule.RecordType)
+	}
+	if rule.Action != Delete && rule.Action != Archive {
+		return fmt.Errorf("retention rule of %s has unknown action %#v", rule.RecordType, string(rule.Action))
+	}
+	if rule.ArchiveInDB && rule.Action != Archive {
+		return fmt.Errorf("retention rule of %s keeps archive in database but does not archive", rule.RecordType)
+	}
+	if !rule.Predicate.IsEmpty() {
+		if err := rule.Predicate.Validate(); err != nil {
+			return fmt.Errorf("retention rule of %s has invalid predicate: %v", rule.RecordType, err)
+		}
+	}
+	return nil
+}
+
+// Report is the outcome of running a Rule.
+//
+// In a dry run, Matched is the number of records that would be removed
+// and Removed is always zero. Rejected is the number of records kept
+// because a hook returned an error.
+type Report struct {
+	RecordType string
+	Action     Action
+	DryRun     bool
+	Matched    int
+	Removed    int
+	Rejected   int
+}
+
+// Run applies rules to records in the public database. The beforeDelete
+// and afterDelete hooks in registry are executed for each deleted record,
+// and the archive hooks are executed before an archived record is
+// removed and before it is copied to the archive table.
+//
+// If dryRun is true, no record is removed and no hook is executed; the
+// reports only count the expired records.
+func Run(ctx context.Context, conn skydb.Conn, registry *hook.Registry, rules []Rule, dryRun bool) ([]Report, error) {
+	now := timeNow()
+	reports := []Report{}
+	for _, rule := range rules {
+		report, err := runRule(ctx, conn, registry, rule, now, dryRun)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+func runRule(ctx context.Context, conn skydb.Conn, registry *hook.Registry, rule Rule, now time.Time, dryRun bool) (Report, error) {
+	report := Report{
+		RecordType: rule.RecordType,
+		Action:     rule.Action,
+		DryRun:     dryRun,
+	}
+
+	var archive skydb.RecordArchive
+	if rule.ArchiveInDB && !dryRun {
+		var ok bool
+		if archive, ok = conn.(skydb.RecordArchive); !ok {
+			return report, fmt.Errorf("retention rule of %s keeps archive in database, which is not supported", rule.RecordType)
+		}
+	}
+
+	db := conn.PublicDB()
+	query := expiredQuery(rule, now)
+	for {
+		records, err := queryRecords(ctx, db, &query)
+		if err != nil {
+			return report, err
+		}
+
+		for _, record := range records {
+			report.Matched++
+			if dryRun {
+				continue
+			}
+
+			removed, err := remove(ctx, db, archive, registry, rule, record, now)
+			if err != nil {
+				return report, err
+			}
+			if removed {
+				report.Removed++
+			} else {
+				report.Rejected++
+			}
+		}
+
+		if uint64(len(records)) < batchSize {
+			return report, nil
+		}
+
+		// Removed records no longer match the query, so only skip the
+		// records that are still there.
+		query.Offset = uint64(report.Matched - report.Removed)
+	}
+}
+
+func expiredQuery(rule Rule, now time.Time) skydb.Query {
+	limit := batchSize
+	predicate := skydb.Predicate{
+		Operator: skydb.LessThan,
+		Children: []interface{}{
+			skydb.Expression{Type: skydb.KeyPath, Value: "_created_at"},
+			skydb.Expression{Type: skydb.Literal, Value: now.Add(-rule.MaxAge)},
+		},
+	}
+	if !rule.Predicate.IsEmpty() {
+		predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{predicate, rule.Predicate},
+		}
+	}
+
+	return skydb.Query{
+		Type:      rule.RecordType,
+		Predicate: predicate,
+		Sorts: []skydb.Sort{
+			{
+				KeyPath: "_created_at",
+				Order:   skydb.Ascending,
+			},
+		},
+		Limit:               &limit,
+		BypassAccessControl: true,
+	}
+}
+
+func queryRecords(ctx context.Context, db skydb.Database, query *skydb.Query) ([]skydb.Record, error) {
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []skydb.Record{}
+	for rows.Scan() {
+		records = append(records, rows.Record())
+	}
+	return records, rows.Err()
+}
+
+func remove(ctx context.Context, db skydb.Database, archive skydb.RecordArchive, registry *hook.Registry, rule Rule, record skydb.Record, now time.Time) (bool, error) {
+	logger := log.WithField("record", record.ID.String()).WithField("action", rule.Action)
+
+	if registry != nil {
+		kind := hook.Kind(hook.BeforeDelete)
+		if rule.Action == Archive {
+			kind = hook.Archive
+		}
+		if err := registry.ExecuteHooks(ctx, kind, &record, nil); err != nil {
+			logger.WithField("err", err).Errorln("expired record is kept as hook returned error")
+			return false, nil
+		}
+	}
+
+	if archive != nil {
+		if err := archive.ArchiveRecord(ctx, &skydb.ArchivedRecord{
+			Record:     record,
+			ArchivedAt: now,
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	if err := db.Delete(ctx, record.ID); err == skydb.ErrRecordNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if registry != nil {
+		if err := registry.ExecuteHooks(ctx, hook.AfterDelete, &record, nil); err != nil {
+			logger.WithField("err", err).Errorln("error occurred while executing hooks")
+		}
+	}
+
+	return true, nil
+}
+
+// Schedule adds a job to c that applies rules on schedule spec, with a
+// connection opened by connOpener.
+func Schedule(c *cron.Cron, spec string, rules []Rule, dryRun bool, registry *hook.Registry, connOpener func() (skydb.Conn, error)) error {
+	return c.AddFunc(spec, func() {
+		conn, err := connOpener()
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to open connection to apply retention rules")
+			return
+		}
+		defer conn.Close()
+
+		reports, err := Run(context.Background(), conn, registry, rules, dryRun)
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to apply retention rules")
+		}
+		for _, report := range reports {
+			logger := log.
+				WithField("recordType", report.RecordType).
+				WithField("action", report.Action).
+				WithField("dryRun", report.DryRun)
+			if report.DryRun {
+				logger.Infof("%d records would be removed by retention rule", report.Matched)
+			} else if report.Matched > 0 {
+				logger.Infof("removed %d of %d expired records, %d rejected by hooks", report.Removed, report.Matched, report.Rejected)
+			}
+		}
+	})
+}
@@ -0,0 +1,293 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// queryDB evaluates the subset of predicates used by retention rules.
+type queryDB struct {
+	*skydbtest.MapDB
+}
+
+func (db *queryDB) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	records := []skydb.Record{}
+	for _, record := range db.RecordMap {
+		if record.ID.Type == query.Type && matches(query.Predicate, record) {
+			records = append(records, record)
+		}
+	}
+	sort.Sort(byCreatedAt(records))
+
+	if query.Offset >= uint64(len(records)) {
+		records = []skydb.Record{}
+	} else {
+		records = records[query.Offset:]
+	}
+	if query.Limit != nil && uint64(len(records)) > *query.Limit {
+		records = records[:*query.Limit]
+	}
+	return skydb.NewRows(skydb.NewMemoryRows(records)), nil
+}
+
+type byCreatedAt []skydb.Record
+
+func (s byCreatedAt) Len() int           { return len(s) }
+func (s byCreatedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCreatedAt) Less(i, j int) bool { return s[i].CreatedAt.Before(s[j].CreatedAt) }
+
+func matches(predicate skydb.Predicate, record skydb.Record) bool {
+	switch predicate.Operator {
+	case skydb.And:
+		for _, child := range predicate.Children {
+			if !matches(child.(skydb.Predicate), record) {
+				return false
+			}
+		}
+		return true
+	case skydb.LessThan:
+		key := predicate.Children[0].(skydb.Expression).Value.(string)
+		value := predicate.Children[1].(skydb.Expression).Value.(time.Time)
+		return record.Get(key).(time.Time).Before(value)
+	case skydb.Equal:
+		key := predicate.Children[0].(skydb.Expression).Value.(string)
+		value := predicate.Children[1].(skydb.Expression).Value
+		return record.Get(key) == value
+	}
+	panic(fmt.Sprintf("unsupported operator %v", predicate.Operator))
+}
+
+type retentionConn struct {
+	*skydbtest.MapConn
+	db *queryDB
+}
+
+func (c *retentionConn) PublicDB() skydb.Database {
+	return c.db
+}
+
+type archiveConn struct {
+	*retentionConn
+	archived map[string]skydb.ArchivedRecord
+}
+
+func (c *archiveConn) ArchiveRecord(record *skydb.ArchivedRecord) error {
+	c.archived[record.Record.ID.String()] = *record
+	return nil
+}
+
+func (c *archiveConn) GetArchivedRecord(id skydb.RecordID, record *skydb.ArchivedRecord) error {
+	archived, ok := c.archived[id.String()]
+	if !ok {
+		return skydb.ErrArchivedRecordNotFound
+	}
+	*record = archived
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	Convey("Run", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		conn := &retentionConn{
+			MapConn: skydbtest.NewMapConn(),
+			db:      &queryDB{skydbtest.NewMapDB()},
+		}
+		save := func(recordType string, id string, age time.Duration, data skydb.Data) {
+			conn.db.Save(context.Background(), &skydb.Record{
+				ID:        skydb.NewRecordID(recordType, id),
+				CreatedAt: now.Add(-age),
+				Data:      data,
+			})
+		}
+		day := 24 * time.Hour
+		save("log", "old", 31*day, skydb.Data{"level": "debug"})
+		save("log", "old-error", 40*day, skydb.Data{"level": "error"})
+		save("log", "new", 29*day, skydb.Data{"level": "debug"})
+		save("note", "old", 100*day, skydb.Data{})
+
+		deleteRule := Rule{
+			RecordType: "log",
+			MaxAge:     30 * day,
+			Action:     Delete,
+		}
+
+		Convey("deletes expired records", func() {
+			reports, err := Run(context.Background(), conn, nil, []Rule{deleteRule}, false)
+			So(err, ShouldBeNil)
+			So(reports, ShouldResemble, []Report{
+				{RecordType: "log", Action: Delete, Matched: 2, Removed: 2},
+			})
+			So(conn.db.RecordMap, ShouldContainKey, "log/new")
+			So(conn.db.RecordMap, ShouldNotContainKey, "log/old")
+			So(conn.db.RecordMap, ShouldNotContainKey, "log/old-error")
+			So(conn.db.RecordMap, ShouldContainKey, "note/old")
+		})
+
+		Convey("deletes expired records matching predicate", func() {
+			deleteRule.Predicate = skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "level"},
+					skydb.Expression{Type: skydb.Literal, Value: "debug"},
+				},
+			}
+			reports, err := Run(context.Background(), conn, nil, []Rule{deleteRule}, false)
+			So(err, ShouldBeNil)
+			So(reports[0].Removed, ShouldEqual, 1)
+			So(conn.db.RecordMap, ShouldNotContainKey, "log/old")
+			So(conn.db.RecordMap, ShouldContainKey, "log/old-error")
+		})
+
+		Convey("reports without removing in dry run", func() {
+			registry := hook.NewRegistry()
+			executed := 0
+			registry.Register(hook.BeforeDelete, "log", func(ctx context.Context, record *skydb.Record, _ *skydb.Record) skyerr.Error {
+				executed++
+				return nil
+			})
+
+			reports, err := Run(context.Background(), conn, registry, []Rule{deleteRule}, true)
+			So(err, ShouldBeNil)
+			So(reports, ShouldResemble, []Report{
+				{RecordType: "log", Action: Delete, DryRun: true, Matched: 2},
+			})
+			So(executed, ShouldEqual, 0)
+			So(conn.db.RecordMap, ShouldContainKey, "log/old")
+		})
+
+		Convey("executes archive hooks before removing", func() {
+			registry := hook.NewRegistry()
+			archived := []string{}
+			deleted := []string{}
+			registry.Register(hook.Archive, "log", func(ctx context.Context, record *skydb.Record, _ *skydb.Record) skyerr.Error {
+				if record.Data["level"] == "error" {
+					return skyerr.NewError(skyerr.UnexpectedError, "archive unavailable")
+				}
+				archived = append(archived, record.ID.Key)
+				return nil
+			})
+			registry.Register(hook.AfterDelete, "log", func(ctx context.Context, record *skydb.Record, _ *skydb.Record) skyerr.Error {
+				deleted = append(deleted, record.ID.Key)
+				return nil
+			})
+
+			deleteRule.Action = Archive
+			reports, err := Run(context.Background(), conn, registry, []Rule{deleteRule}, false)
+			So(err, ShouldBeNil)
+			So(reports, ShouldResemble, []Report{
+				{RecordType: "log", Action: Archive, Matched: 2, Removed: 1, Rejected: 1},
+			})
+			So(archived, ShouldResemble, []string{"old"})
+			So(deleted, ShouldResemble, []string{"old"})
+			So(conn.db.RecordMap, ShouldContainKey, "log/old-error")
+		})
+
+		Convey("keeps archived records in database", func() {
+			archive := &archiveConn{conn, map[string]skydb.ArchivedRecord{}}
+			deleteRule.Action = Archive
+			deleteRule.ArchiveInDB = true
+
+			reports, err := Run(context.Background(), archive, nil, []Rule{deleteRule}, false)
+			So(err, ShouldBeNil)
+			So(reports[0].Removed, ShouldEqual, 2)
+			So(archive.archived, ShouldContainKey, "log/old")
+			So(archive.archived, ShouldContainKey, "log/old-error")
+			So(archive.archived["log/old"].ArchivedAt, ShouldResemble, now)
+			So(archive.archived["log/old"].Record.Data, ShouldResemble, skydb.Data{"level": "debug"})
+			So(conn.db.RecordMap, ShouldNotContainKey, "log/old")
+		})
+
+		Convey("fails to keep archive in unsupported database", func() {
+			deleteRule.Action = Archive
+			deleteRule.ArchiveInDB = true
+
+			_, err := Run(context.Background(), conn, nil, []Rule{deleteRule}, false)
+			So(err, ShouldNotBeNil)
+			So(conn.db.RecordMap, ShouldContainKey, "log/old")
+		})
+
+		Convey("removes records in batches", func() {
+			registry := hook.NewRegistry()
+			registry.Register(hook.BeforeDelete, "event", func(ctx context.Context, record *skydb.Record, _ *skydb.Record) skyerr.Error {
+				if record.Data["keep"] == true {
+					return skyerr.NewError(skyerr.PermissionDenied, "kept")
+				}
+				return nil
+			})
+			for i := 0; i < 250; i++ {
+				save("event", fmt.Sprintf("%03d", i), time.Duration(300-i)*day, skydb.Data{"keep": i%10 == 0})
+			}
+
+			reports, err := Run(context.Background(), conn, registry, []Rule{{
+				RecordType: "event",
+				MaxAge:     60 * day,
+				Action:     Delete,
+			}}, false)
+			So(err, ShouldBeNil)
+			So(reports[0].Matched, ShouldEqual, 240)
+			So(reports[0].Removed, ShouldEqual, 216)
+			So(reports[0].Rejected, ShouldEqual, 24)
+		})
+	})
+}
+
+func TestRuleValidate(t *testing.T) {
+	Convey("Rule", t, func() {
+		rule := Rule{RecordType: "log", MaxAge: time.Hour, Action: Delete}
+
+		Convey("is valid", func() {
+			So(rule.Validate(), ShouldBeNil)
+		})
+
+		Convey("requires record type", func() {
+			rule.RecordType = ""
+			So(rule.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("requires positive max age", func() {
+			rule.MaxAge = 0
+			So(rule.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("requires known action", func() {
+			rule.Action = "purge"
+			So(rule.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("keeps archive in database only if archiving", func() {
+			rule.ArchiveInDB = true
+			So(rule.Validate(), ShouldNotBeNil)
+
+			rule.Action = Archive
+			So(rule.Validate(), ShouldBeNil)
+		})
+	})
+}
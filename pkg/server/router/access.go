@@ -0,0 +1,103 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+// accessLog is the logger of the access log. It is a logger of its own,
+// so that its level can be set independently with LOG_LEVEL_ACCESS.
+var accessLog = logging.LoggerEntry("access")
+
+// accessLogWriter records the status and the size of the response
+// written through it.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	size, err := w.ResponseWriter.Write(b)
+	w.size += size
+	return size, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// accessLogEntry describes a served request in the access log.
+type accessLogEntry struct {
+	Method    string
+	URL       *url.URL
+	RequestID string
+	Action    string
+	UserID    string
+	Status    int
+	Size      int
+	Latency   time.Duration
+}
+
+func logAccess(e accessLogEntry) {
+	fields := logrus.Fields{
+		"method":     e.Method,
+		"path":       e.URL.Path,
+		"request_id": e.RequestID,
+		"status":     e.Status,
+		"size":       e.Size,
+		"latency":    e.Latency.Seconds(),
+	}
+	if e.Action != "" {
+		fields["action"] = e.Action
+	}
+	if e.UserID != "" {
+		fields["user_id"] = e.UserID
+	}
+	accessLog.WithFields(fields).Infoln("served request")
+}
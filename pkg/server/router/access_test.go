@@ -0,0 +1,173 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+func TestAccessLog(t *testing.T) {
+	Convey("Router", t, func() {
+		logger := accessLog.Logger
+		out, formatter, level := logger.Out, logger.Formatter, logger.Level
+		defer func() {
+			logger.Out, logger.Formatter, logger.Level = out, formatter, level
+		}()
+
+		var buf bytes.Buffer
+		logger.Out = &buf
+		logger.Formatter = &logrus.JSONFormatter{}
+		logger.Level = logrus.InfoLevel
+
+		var requestFields logrus.Fields
+		callbackHandler := CallbackHandler{
+			callback: func(p *Payload, r *Response) {
+				p.UserInfoID = "user-0"
+				requestFields = logging.WithContext(p.Context, logrus.NewEntry(logrus.New())).Data
+				r.Result = "ok"
+			},
+		}
+
+		r := NewRouter()
+		r.Map("mock:callback", &callbackHandler)
+
+		Convey("logs served request", func() {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/mock/callback",
+				strings.NewReader(""),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "request-0")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			entry := map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["msg"], ShouldEqual, "served request")
+			So(entry["method"], ShouldEqual, "POST")
+			So(entry["path"], ShouldEqual, "/mock/callback")
+			So(entry["action"], ShouldEqual, "mock:callback")
+			So(entry["request_id"], ShouldEqual, "request-0")
+			So(entry["user_id"], ShouldEqual, "user-0")
+			So(entry["status"], ShouldEqual, float64(http.StatusOK))
+			So(entry["size"], ShouldEqual, float64(resp.Body.Len()))
+			So(entry["latency"], ShouldNotBeNil)
+
+			So(requestFields["request_id"], ShouldEqual, "request-0")
+		})
+
+		Convey("logs unmatched request", func() {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/mock/unmatched",
+				strings.NewReader(""),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			entry := map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["status"], ShouldEqual, float64(http.StatusNotFound))
+			So(entry["request_id"], ShouldEqual, resp.Header().Get("X-Request-ID"))
+			So(entry["request_id"], ShouldNotBeEmpty)
+		})
+	})
+}
+
+func TestRequestLogger(t *testing.T) {
+	Convey("Router", t, func() {
+		logger := log.Logger
+		out, formatter := logger.Out, logger.Formatter
+		defer func() {
+			logger.Out, logger.Formatter = out, formatter
+		}()
+
+		var buf bytes.Buffer
+		logger.Out = &buf
+		logger.Formatter = &logrus.JSONFormatter{}
+
+		r := NewRouter()
+		serve := func() {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/mock/callback",
+				strings.NewReader(`{"password": "secret"}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "request-0")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		Convey("logs panic with request", func() {
+			r.Map("mock:callback", &CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					p.UserInfoID = "user-0"
+					panic(errors.New("an error"))
+				},
+			})
+			serve()
+
+			entry := map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["level"], ShouldEqual, "error")
+			So(entry["msg"], ShouldEqual, "panic occurred while handling request")
+			So(entry["action"], ShouldEqual, "mock:callback")
+			So(entry["request_id"], ShouldEqual, "request-0")
+			So(entry["user_id"], ShouldEqual, "user-0")
+			So(entry["payload"], ShouldContainSubstring, `"password":"REDACTED"`)
+			So(entry["stack"], ShouldContainSubstring, "panic")
+		})
+
+		Convey("logs unexpected error with request", func() {
+			r.Map("mock:callback", &CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					r.Err = skyerr.NewError(skyerr.UnexpectedError, "an error")
+				},
+			})
+			serve()
+
+			entry := map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["level"], ShouldEqual, "error")
+			So(entry["msg"], ShouldEqual, "unexpected error occurred while handling request")
+			So(entry["request_id"], ShouldEqual, "request-0")
+		})
+
+		Convey("does not log expected error", func() {
+			r.Map("mock:callback", &CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					r.Err = skyerr.NewError(skyerr.InvalidArgument, "an error")
+				},
+			})
+			serve()
+
+			So(buf.String(), ShouldBeEmpty)
+		})
+	})
+}
@@ -15,16 +15,25 @@
 package router
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	"github.com/skygeario/skygear-server/pkg/server/skyversion"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
 // commonRouter implements the HandlerFunc interface that is common
@@ -33,6 +42,16 @@ type commonRouter struct {
 	payloadFunc      func(req *http.Request) (p *Payload, err error)
 	matchHandlerFunc func(req *http.Request, p *Payload) (h Handler, pp []Processor)
 	ResponseTimeout  time.Duration
+	ResponseFilter   ResponseFilter
+	IdempotencyStore IdempotencyStore
+	ResponseCache    ResponseCache
+	Gatekeeper       Gatekeeper
+	Concurrency      ConcurrencyLimiter
+	BodyCapturer     BodyCapturer
+
+	// APIKeyRateLimiter, if not nil, limits the requests of each API
+	// key. Requests on the internal listener are not limited.
+	APIKeyRateLimiter RateLimiter
 }
 
 func (r *commonRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -48,12 +67,39 @@ func (r *commonRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	version := strings.TrimPrefix(skyversion.Version(), "v")
 	w.Header().Set("Server", fmt.Sprintf("Skygear Server/%s", version))
 
-	resp.writer = w
+	requestID := req.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = uuid.New()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+
+	// Deferred first so that it runs after the response is written.
+	accessWriter := &accessLogWriter{ResponseWriter: w}
+	resp.writer = accessWriter
+	requestTime := time.Now()
+	defer func() {
+		entry := accessLogEntry{
+			Method:    req.Method,
+			URL:       req.URL,
+			RequestID: requestID,
+			Status:    accessWriter.status,
+			Size:      accessWriter.size,
+			Latency:   time.Since(requestTime),
+		}
+		if payload != nil {
+			entry.Action = payload.RouteAction()
+			if !timedOut {
+				// The handler may still be running after a timeout.
+				entry.UserID = payload.UserInfoID
+			}
+		}
+		logAccess(entry)
+	}()
 
 	defer func() {
 		if r := recover(); r != nil {
+			logPanic(payload, r)
 			resp.Err = errorFromRecoveringPanic(r)
-			log.WithField("recovered", r).Errorln("panic occurred while handling request")
 		}
 
 		writer := resp.Writer()
@@ -69,13 +115,27 @@ func (r *commonRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				skyerr.ResponseTimeout,
 				"Service taking too long to respond.",
 			)
-			log.Errorln("timed out serving request")
+			// Not requestLogger, as the handler may still be running.
+			logging.WithContext(payload.Context, log).
+				WithField("action", payload.RouteAction()).
+				Errorln("timed out serving request")
 		}
 
 		if resp.Err != nil && httpStatus >= 200 && httpStatus <= 299 {
 			httpStatus = defaultStatusCode(resp.Err)
 		}
 
+		if resp.cached != nil && resp.Err == nil {
+			writer.Header().Set("ETag", resp.cached.ETag)
+			if etagMatches(req.Header.Get("If-None-Match"), resp.cached.ETag) {
+				writer.WriteHeader(http.StatusNotModified)
+				return
+			}
+			writer.WriteHeader(httpStatus)
+			writer.Write(resp.cached.Body)
+			return
+		}
+
 		writer.WriteHeader(httpStatus)
 		if err := writeEntity(writer, resp); err != nil {
 			panic(err)
@@ -86,6 +146,11 @@ func (r *commonRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var err error
 	payload, err = r.payloadFunc(req)
 	if err != nil {
+		if m, ok := req.Context().Value(listenerContextKey).(*ListenerMiddleware); ok && err.Error() == errRequestBodyTooLarge {
+			resp.Err = errRequestTooLarge(m.MaxBodySize)
+			httpStatus = defaultStatusCode(resp.Err)
+			return
+		}
 		httpStatus = http.StatusBadRequest
 		resp.Err = skyerr.NewRequestJSONInvalidErr(err)
 		return
@@ -98,24 +163,57 @@ func (r *commonRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Call handler
+	payload.Context = context.WithValue(payload.Context, RequestIDContextKey, requestID)
+	payload.Context = logging.ContextWithFields(payload.Context, logrus.Fields{
+		"request_id": requestID,
+	})
+
+	if err := admitListener(payload); err != nil {
+		httpStatus = defaultStatusCode(err)
+		resp.Err = err
+		return
+	}
+
+	if r.Gatekeeper != nil {
+		if err := r.Gatekeeper.Admit(payload); err != nil {
+			httpStatus = defaultStatusCode(err)
+			resp.Err = err
+			return
+		}
+	}
+
+	startTime := time.Now()
+	defer func() {
+		observeRequest(payload.RouteAction(), &resp, startTime)
+	}()
+
+	var trace *metrics.Trace
+	payload.Context, trace = metrics.WithTrace(payload.Context)
+	defer logTrace(payload, trace)
+
+	// Call handler. The deadline of the context is set to the response
+	// timeout so that database and plugin calls made by the handler
+	// can give up once the response is no longer awaited.
 	var cancelFunc context.CancelFunc
-	payload.Context, cancelFunc = context.WithCancel(payload.Context)
+	if r.ResponseTimeout > 0 {
+		payload.Context, cancelFunc = context.WithTimeout(payload.Context, r.ResponseTimeout)
+	} else {
+		payload.Context, cancelFunc = context.WithCancel(payload.Context)
+	}
 	defer cancelFunc()
 
 	go func() {
 		httpStatus = r.callHandler(handler, preprocessors, payload, &resp)
+		if r.BodyCapturer != nil && r.BodyCapturer.ShouldCapture(payload) {
+			logBody(payload, &resp, httpStatus)
+		}
 		cancelFunc()
 	}()
 
-	// This function will return in one of the following conditions:
-	select {
-	case <-payload.Context.Done():
-		// request conext cancelled or response generated
-	case <-getTimeoutChan(r.ResponseTimeout):
-		// timeout exceeded
-		timedOut = true
-	}
+	// This function will return when the response is generated, the
+	// request context is cancelled or the response timeout is exceeded.
+	<-payload.Context.Done()
+	timedOut = payload.Context.Err() == context.DeadlineExceeded
 }
 
 func (r *commonRouter) callHandler(handler Handler, pp []Processor, payload *Payload, resp *Response) (httpStatus int) {
@@ -123,15 +221,39 @@ func (r *commonRouter) callHandler(handler Handler, pp []Processor, payload *Pay
 
 	defer func() {
 		if r := recover(); r != nil {
-			log.WithField("recovered", r).Errorln("panic occurred while handling request")
+			logPanic(payload, r)
 
 			resp.Err = errorFromRecoveringPanic(r)
 			httpStatus = defaultStatusCode(resp.Err)
+			return
+		}
+
+		if resp.Err != nil && resp.Err.Code() == skyerr.UnexpectedError {
+			requestLogger(payload).WithField("err", resp.Err).Errorln("unexpected error occurred while handling request")
 		}
 	}()
 
+	if apiKey := payload.APIKey(); apiKey != "" && r.APIKeyRateLimiter != nil && !IsInternalRequest(payload.Context) {
+		if err := r.APIKeyRateLimiter.Allow(apiKey); err != nil {
+			resp.Err = err
+			return defaultStatusCode(err)
+		}
+	}
+
+	if key := r.concurrencyKey(payload); key != "" {
+		release, err := r.Concurrency.Acquire(payload.Context, key)
+		if err != nil {
+			resp.Err = err
+			return defaultStatusCode(err)
+		}
+		// Released when the handler returns rather than when the
+		// response is written, so that a handler still running after
+		// the response timeout is counted.
+		defer release()
+	}
+
 	for _, p := range pp {
-		httpStatus = p.Preprocess(payload, resp)
+		httpStatus = p.Preprocess(payload.Context, payload, resp)
 		if resp.Err != nil {
 			if httpStatus == http.StatusOK {
 				httpStatus = defaultStatusCode(resp.Err)
@@ -140,20 +262,300 @@ func (r *commonRouter) callHandler(handler Handler, pp []Processor, payload *Pay
 		}
 	}
 
-	handler.Handle(payload, resp)
+	if validator, ok := handler.(PayloadValidator); ok {
+		if err := validator.PayloadSchema().Validate(payload.Data); err != nil {
+			resp.Err = err
+			return defaultStatusCode(err)
+		}
+	}
+
+	if key := r.idempotencyKey(payload); key != "" {
+		stored, err := r.IdempotencyStore.Begin(payload.Context, key)
+		if err != nil {
+			resp.Err = skyerr.MakeError(err)
+			return defaultStatusCode(resp.Err)
+		}
+		if stored != nil {
+			resp.Info = stored.Info
+			resp.Result = stored.Result
+			resp.Err = stored.Err
+			return stored.Status
+		}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				r.IdempotencyStore.Finish(key, nil)
+				panic(recovered)
+			}
+			r.IdempotencyStore.Finish(key, newStoredResponse(httpStatus, resp))
+		}()
+	}
+
+	cacheKey := r.cacheKey(payload)
+	var cacheGeneration uint64
+	if cacheKey != "" {
+		var cached *CachedResponse
+		cached, cacheGeneration = r.ResponseCache.Get(cacheKey)
+		if cached != nil {
+			resp.cached = cached
+			return http.StatusOK
+		}
+	}
+
+	handler.Handle(payload.Context, payload, resp)
+
+	if r.ResponseFilter != nil && resp.Err == nil {
+		if err := r.ResponseFilter.FilterResponse(payload, resp); err != nil {
+			// Never write the unfiltered result.
+			resp.Result = nil
+			resp.Err = skyerr.MakeError(err)
+			return defaultStatusCode(resp.Err)
+		}
+	}
+
+	if r.ResponseCache != nil && resp.Err == nil {
+		r.ResponseCache.Invalidate(payload.RouteAction())
+		if cacheKey != "" && httpStatus == http.StatusOK {
+			cached, err := newCachedResponse(resp)
+			if err != nil {
+				panic(err)
+			}
+			r.ResponseCache.Put(cacheKey, cacheGeneration, cached)
+			resp.cached = cached
+		}
+	}
 	return httpStatus
 }
 
+// cacheKey returns the key under which the response of the request is
+// cached, or an empty string if the response is not to be cached. The
+// key is scoped to the user and the access key, and covers the request
+// data except the credentials, so that only identical requests of the
+// same requester share a response.
+func (r *commonRouter) cacheKey(payload *Payload) string {
+	if r.ResponseCache == nil {
+		return ""
+	}
+
+	action := payload.RouteAction()
+	if !r.ResponseCache.Handles(action) || payload.IdempotencyKey() != "" {
+		return ""
+	}
+
+	data := map[string]interface{}{}
+	for key, value := range payload.Data {
+		switch key {
+		case "action", "api_key", "access_token":
+			continue
+		}
+		data[key] = value
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+
+	return strings.Join([]string{
+		action,
+		payload.AccessKey.String(),
+		payload.UserInfoID,
+		string(encoded),
+	}, "\x00")
+}
+
+// newCachedResponse encodes resp as it would be written, and tags it
+// with the SHA-1 digest of the encoded body.
+func newCachedResponse(resp *Response) (*CachedResponse, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(resp); err != nil {
+		return nil, err
+	}
+
+	digest := sha1.Sum(body.Bytes())
+	return &CachedResponse{
+		ETag: `"` + hex.EncodeToString(digest[:]) + `"`,
+		Body: body.Bytes(),
+	}, nil
+}
+
+// etagMatches returns true if the If-None-Match header ifNoneMatch
+// lists etag, ignoring the weak validator prefix.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// concurrencyKey returns the key identifying the client of the request
+// to the ConcurrencyLimiter, or an empty string if the request is not
+// limited. Clients are identified by the access token, or the API key
+// for requests without one.
+func (r *commonRouter) concurrencyKey(payload *Payload) string {
+	if r.Concurrency == nil {
+		return ""
+	}
+
+	if token := payload.AccessTokenString(); token != "" {
+		return "access_token\x00" + token
+	}
+	if apiKey := payload.APIKey(); apiKey != "" {
+		return "api_key\x00" + apiKey
+	}
+	return ""
+}
+
+// idempotencyKey returns the key under which the response of the
+// request is stored, or an empty string if the request is not to be
+// deduplicated. The key is scoped to the app, the API key, the action
+// and the user, so that clients cannot replay the responses of one
+// another.
+//
+// Requests made without a user or the master key are not deduplicated,
+// as anyone with the API key could replay them. Neither are auth
+// actions, whose responses carry access tokens.
+func (r *commonRouter) idempotencyKey(payload *Payload) string {
+	if r.IdempotencyStore == nil {
+		return ""
+	}
+
+	key := payload.IdempotencyKey()
+	action := payload.RouteAction()
+	if key == "" || !r.IdempotencyStore.Handles(action) {
+		return ""
+	}
+	if payload.UserInfoID == "" && !payload.HasMasterKey() {
+		return ""
+	}
+	if strings.HasPrefix(action, "auth:") {
+		return ""
+	}
+	return strings.Join([]string{
+		payload.AppName,
+		payload.APIKey(),
+		action,
+		payload.UserInfoID,
+		key,
+	}, "\x00")
+}
+
+// newStoredResponse returns the response to be stored for replays, or
+// nil if it is a server error which a retry may not encounter.
+func newStoredResponse(httpStatus int, resp *Response) *StoredResponse {
+	if resp.Err != nil && httpStatus >= 200 && httpStatus <= 299 {
+		httpStatus = defaultStatusCode(resp.Err)
+	}
+	if httpStatus >= 500 {
+		return nil
+	}
+	return &StoredResponse{
+		Status: httpStatus,
+		Info:   resp.Info,
+		Result: resp.Result,
+		Err:    resp.Err,
+	}
+}
+
+// logTrace logs the time spent on plugins and other traced operations
+// while serving the request, so that slow requests can be attributed.
+func logTrace(payload *Payload, trace *metrics.Trace) {
+	spans := trace.Spans()
+	if len(spans) == 0 {
+		return
+	}
+
+	var total time.Duration
+	for _, span := range spans {
+		total += span.Duration
+	}
+	log.WithFields(logrus.Fields{
+		"action":     payload.RouteAction(),
+		"request_id": RequestIDFromContext(payload.Context),
+		"duration":   total,
+		"spans":      spans,
+	}).Debugln("traced request")
+}
+
+// errorPayloadByteLimit is the maximum number of bytes of the request
+// payload logged with an error.
+const errorPayloadByteLimit = 1024
+
+// requestLogger returns the logger with fields describing the request
+// being served, so that errors reported by log hooks such as Sentry can
+// be traced to the request causing them. The payload is redacted and
+// truncated.
+func requestLogger(payload *Payload) *logrus.Entry {
+	if payload == nil {
+		return log
+	}
+
+	request, _ := json.Marshal(redactCapturedBody(payload.Data))
+	if len(request) > errorPayloadByteLimit {
+		request = append(request[:errorPayloadByteLimit], "..."...)
+	}
+	return logging.WithContext(payload.Context, log).WithFields(logrus.Fields{
+		"action":  payload.RouteAction(),
+		"user_id": payload.UserInfoID,
+		"payload": string(request),
+	})
+}
+
+// logPanic logs the value recovered from a panic with the stack trace.
+// It must be called by the deferred function recovering the panic.
+func logPanic(payload *Payload, recovered interface{}) {
+	requestLogger(payload).WithFields(logrus.Fields{
+		"recovered": recovered,
+		"stack":     string(debug.Stack()),
+	}).Errorln("panic occurred while handling request")
+}
+
+// capturedBodyRedactedKeys are the keys of request payload and response
+// result which are not logged when the bodies are captured.
+var capturedBodyRedactedKeys = []string{
+	"api_key",
+	"access_token",
+	"password",
+	"old_password",
+}
+
+func redactCapturedBody(m map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for key, value := range m {
+		redacted[key] = value
+	}
+	for _, key := range capturedBodyRedactedKeys {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+func logBody(payload *Payload, resp *Response, httpStatus int) {
+	request, _ := json.Marshal(redactCapturedBody(payload.Data))
+
+	var body map[string]interface{}
+	if b, err := json.Marshal(resp); err == nil && json.Unmarshal(b, &body) == nil {
+		if result, ok := body["result"].(map[string]interface{}); ok {
+			body["result"] = redactCapturedBody(result)
+		}
+	}
+	response, _ := json.Marshal(body)
+	log.WithFields(logrus.Fields{
+		"action":     payload.RouteAction(),
+		"request_id": RequestIDFromContext(payload.Context),
+		"user_id":    payload.UserInfoID,
+		"status":     httpStatus,
+		"request":    string(request),
+		"response":   string(response),
+	}).Infoln("captured request")
+}
+
 func writeEntity(w http.ResponseWriter, i interface{}) error {
 	if w == nil {
 		return errors.New("writer is nil")
 	}
 	return json.NewEncoder(w).Encode(i)
 }
-
-func getTimeoutChan(timeout time.Duration) <-chan time.Time {
-	if timeout.Seconds() > 0 {
-		return time.After(timeout)
-	}
-	return make(chan time.Time)
-}
@@ -16,11 +16,33 @@ package router
 
 import (
 	"net/http"
+	"strings"
 )
 
+// CORSMiddleware adds CORS headers to the responses of Next, and answers
+// preflight requests itself.
+//
+// Origin is the allowed origin, or a comma-separated list of allowed
+// origins. With a list, the origin of a request is allowed if it is in
+// the list, which may contain "*" to allow any origin.
+//
+// Methods and Headers, if not empty, are the methods and headers allowed
+// in a preflight request. Otherwise the requested ones are allowed.
 type CORSMiddleware struct {
-	Origin string
-	Next   http.Handler
+	Origin  string
+	Methods []string
+	Headers []string
+	Next    http.Handler
+}
+
+func (cors *CORSMiddleware) allowOrigin(origin string) string {
+	for _, allowed := range strings.Split(cors.Origin, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || allowed == origin {
+			return origin
+		}
+	}
+	return ""
 }
 
 func (cors *CORSMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -28,16 +50,29 @@ func (cors *CORSMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	corsMethod := r.Header.Get("Access-Control-Request-Method")
 	corsHeaders := r.Header.Get("Access-Control-Request-Headers")
 
-	w.Header().Set("Access-Control-Allow-Origin", cors.Origin)
+	if !strings.Contains(cors.Origin, ",") {
+		w.Header().Set("Access-Control-Allow-Origin", cors.Origin)
+	} else {
+		w.Header().Add("Vary", "Origin")
+		if origin := cors.allowOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+	}
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 	if corsMethod != "" {
 		log.Debugf("CORS Method: %s", corsMethod)
+		if len(cors.Methods) > 0 {
+			corsMethod = strings.Join(cors.Methods, ", ")
+		}
 		w.Header().Set("Access-Control-Allow-Methods", corsMethod)
 	}
 
 	if corsHeaders != "" {
 		log.Debugf("CORS Headers: %s", corsHeaders)
+		if len(cors.Headers) > 0 {
+			corsHeaders = strings.Join(cors.Headers, ", ")
+		}
 		w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
 	}
 
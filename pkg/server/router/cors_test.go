@@ -104,5 +104,54 @@ func TestCORSMiddleware(t *testing.T) {
 			})
 		})
 
+		Convey("Handle Request From Allowed Origins", func() {
+			routeWithMiddleware.Origin = "http://a.skygear.dev, http://b.skygear.dev"
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(mockJSON),
+			)
+			req.Header.Set("Origin", "http://b.skygear.dev")
+
+			resp := httptest.NewRecorder()
+			routeWithMiddleware.ServeHTTP(resp, req)
+
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://b.skygear.dev")
+			So(resp.Header().Get("Vary"), ShouldEqual, "Origin")
+		})
+
+		Convey("Handle Request From Disallowed Origin", func() {
+			routeWithMiddleware.Origin = "http://a.skygear.dev, http://b.skygear.dev"
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(mockJSON),
+			)
+			req.Header.Set("Origin", "http://c.skygear.dev")
+
+			resp := httptest.NewRecorder()
+			routeWithMiddleware.ServeHTTP(resp, req)
+
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+		})
+
+		Convey("Handle Preflight Request With Allowed Methods And Headers", func() {
+			routeWithMiddleware.Methods = []string{"GET", "POST"}
+			routeWithMiddleware.Headers = []string{"Content-Type", "X-Skygear-Api-Key"}
+
+			req, _ := http.NewRequest("OPTIONS", "http://skygear.dev/", nil)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "content-type")
+
+			resp := httptest.NewRecorder()
+			routeWithMiddleware.ServeHTTP(resp, req)
+
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, POST")
+			So(resp.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "Content-Type, X-Skygear-Api-Key")
+		})
+
 	})
 }
@@ -16,7 +16,6 @@ package router
 
 import (
 	"net/http"
-	"runtime/debug"
 
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
@@ -44,6 +43,12 @@ func defaultStatusCode(err skyerr.Error) int {
 		skyerr.PluginTimeout:           http.StatusGatewayTimeout,
 		skyerr.RecordQueryInvalid:      http.StatusBadRequest,
 		skyerr.ResponseTimeout:         http.StatusServiceUnavailable,
+		skyerr.RecordConflict:          http.StatusConflict,
+		skyerr.QuotaExceeded:           http.StatusForbidden,
+		skyerr.TooManyRequests:         http.StatusTooManyRequests,
+		skyerr.UnderMaintenance:        http.StatusServiceUnavailable,
+		skyerr.CaptchaRequired:         http.StatusForbidden,
+		skyerr.RequestTooLarge:         http.StatusRequestEntityTooLarge,
 	}[err.Code()]
 	if !ok {
 		if err.Code() < 10000 {
@@ -59,7 +64,6 @@ func errorFromRecoveringPanic(r interface{}) skyerr.Error {
 	case skyerr.Error:
 		return err
 	case error:
-		log.Errorf("%s", debug.Stack())
 		return skyerr.NewErrorf(skyerr.UnexpectedError, "panic occurred while handling request: %v", err.Error())
 	default:
 		log.Warnf("router: unexpected type when recovering from panic: %v", err)
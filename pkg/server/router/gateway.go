@@ -18,6 +18,7 @@ import (
 	"context"
 	"net/http"
 	"regexp"
+	"sync"
 )
 
 // pathRoute is the path matching version of pipeline. Instead of storing the action
@@ -32,6 +33,7 @@ type pathRoute struct {
 type Gateway struct {
 	commonRouter
 	ParamMatch  *regexp.Regexp
+	mutex       sync.RWMutex
 	methodPaths map[string]pathRoute
 }
 
@@ -70,6 +72,8 @@ func (g *Gateway) Handle(method string, handler Handler, preprocessors ...Proces
 	if len(preprocessors) == 0 {
 		preprocessors = handler.GetPreprocessors()
 	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 	g.methodPaths[method] = pathRoute{
 		Preprocessors: preprocessors,
 		Handler:       handler,
@@ -81,6 +85,8 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func (g *Gateway) matchHandler(req *http.Request, p *Payload) (h Handler, pp []Processor) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
 	if pathRoute, ok := g.methodPaths[req.Method]; ok {
 		h = pathRoute.Handler
 		pp = pathRoute.Preprocessors
@@ -115,6 +121,9 @@ func (g *Gateway) newPayload(req *http.Request) (p *Payload, err error) {
 	} else if accessToken := query.Get("access_token"); accessToken != "" {
 		p.Data["access_token"] = accessToken
 	}
+	if appName := req.Header.Get("X-Skygear-App"); appName != "" {
+		p.Data["app_name"] = appName
+	}
 
 	return
 }
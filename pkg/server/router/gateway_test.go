@@ -15,6 +15,7 @@
 package router
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -28,7 +29,7 @@ func TestRouterMatchByURL(t *testing.T) {
 
 		Convey("matches simple url action", func() {
 			g := NewGateway("endpoint", "/endpoint", nil)
-			g.POST(NewFuncHandler(func(payload *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, payload *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					Status string `json:"status"`
 				}{"ok"})
@@ -42,7 +43,7 @@ func TestRouterMatchByURL(t *testing.T) {
 
 		Convey("don't matches simple url action with wrong method", func() {
 			g := NewGateway("endpoint", "/endpoint", nil)
-			g.POST(NewFuncHandler(func(payload *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, payload *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					Status string `json:"status"`
 				}{"ok"})
@@ -57,7 +58,7 @@ func TestRouterMatchByURL(t *testing.T) {
 		Convey("matches simple url action with passin ServeMux", func() {
 			mux := http.NewServeMux()
 			g := NewGateway("endpoint", "/endpoint", mux)
-			g.POST(NewFuncHandler(func(payload *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, payload *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					Status string `json:"status"`
 				}{"ok"})
@@ -72,7 +73,7 @@ func TestRouterMatchByURL(t *testing.T) {
 		Convey("don't matches simple url action with passin ServeMux", func() {
 			mux := http.NewServeMux()
 			g := NewGateway("endpoint", "/endpoint", mux)
-			g.POST(NewFuncHandler(func(payload *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, payload *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					Status string `json:"status"`
 				}{"ok"})
@@ -86,7 +87,7 @@ func TestRouterMatchByURL(t *testing.T) {
 
 		Convey("matches url with parameters", func() {
 			g := NewGateway(`(?:entity|model)/([0-9a-zA-Z\-_]+)`, "/model", nil)
-			g.POST(NewFuncHandler(func(p *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, p *Payload, resp *Response) {
 				writeEntity(resp.Writer(), p.Params)
 			}))
 
@@ -99,7 +100,7 @@ func TestRouterMatchByURL(t *testing.T) {
 
 		Convey("help url handler fill in payload from Header", func() {
 			g := NewGateway("endpoint", "/endpoint", nil)
-			g.POST(NewFuncHandler(func(p *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, p *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					APIKey      string `json:"api-key"`
 					AccessToken string `json:"access-token"`
@@ -121,7 +122,7 @@ func TestRouterMatchByURL(t *testing.T) {
 
 		Convey("fill in api key from query string", func() {
 			g := NewGateway("endpoint", "/endpoint", nil)
-			g.POST(NewFuncHandler(func(p *Payload, resp *Response) {
+			g.POST(NewFuncHandler(func(ctx context.Context, p *Payload, resp *Response) {
 				writeEntity(resp.Writer(), struct {
 					APIKey      string `json:"api-key"`
 					AccessToken string `json:"access-token"`
@@ -139,5 +140,24 @@ func TestRouterMatchByURL(t *testing.T) {
             }`)
 		})
 
+		Convey("fill in app name from header", func() {
+			g := NewGateway("endpoint", "/endpoint", nil)
+			g.POST(NewFuncHandler(func(ctx context.Context, p *Payload, resp *Response) {
+				writeEntity(resp.Writer(), struct {
+					AppName string `json:"app-name"`
+				}{p.RequestAppName()})
+			}))
+
+			req, _ := http.NewRequest("POST", `http://skygear.test/endpoint`, nil)
+			req.Header.Set("X-Skygear-App", "shop")
+
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			So(w.Body.Bytes(), ShouldEqualJSON, `{
+                "app-name": "shop"
+            }`)
+		})
+
 	})
 }
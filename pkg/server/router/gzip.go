@@ -0,0 +1,173 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"bufio"
+	"compress/gzip"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// GzipMiddleware compresses the JSON responses of Next with gzip for
+// clients accepting it. Responses smaller than MinSize bytes are sent
+// uncompressed, as compressing them saves little.
+type GzipMiddleware struct {
+	MinSize int
+	Next    http.Handler
+}
+
+func (m *GzipMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+		m.Next.ServeHTTP(w, r)
+		return
+	}
+
+	gw := &gzipResponseWriter{w: w, minSize: m.MinSize}
+	defer gw.Close()
+	m.Next.ServeHTTP(gw, r)
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(encoding, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q := strings.Replace(param, " ", "", -1); q == "q=0" || q == "q=0.0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the response until minSize bytes are
+// written, and then decides whether to compress it by its size and
+// content type.
+type gzipResponseWriter struct {
+	w       http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) Header() http.Header {
+	return gw.w.Header()
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.w.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide writes the header and the buffered response, compressing it if
+// it is JSON and at least minSize bytes.
+func (gw *gzipResponseWriter) decide() error {
+	gw.decided = true
+
+	header := gw.w.Header()
+	compress := len(gw.buf) > 0 &&
+		len(gw.buf) >= gw.minSize &&
+		header.Get("Content-Encoding") == "" &&
+		isJSONContentType(header.Get("Content-Type"))
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		gw.gz = gzip.NewWriter(gw.w)
+	}
+
+	if gw.status != 0 {
+		gw.w.WriteHeader(gw.status)
+	}
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(buf)
+	} else {
+		_, err = gw.w.Write(buf)
+	}
+	return err
+}
+
+// Close writes the rest of the response.
+func (gw *gzipResponseWriter) Close() error {
+	if !gw.decided {
+		if err := gw.decide(); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+	return nil
+}
+
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide()
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (gw *gzipResponseWriter) Hijack() (c net.Conn, w *bufio.ReadWriter, e error) {
+	hijacker := gw.w.(http.Hijacker)
+	return hijacker.Hijack()
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
@@ -0,0 +1,93 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	Convey("GzipMiddleware", t, func() {
+		result := strings.Repeat("a", 100)
+		r := NewRouter()
+		r.Map("mock:map", &CallbackHandler{
+			callback: func(p *Payload, resp *Response) {
+				resp.Result = result
+			},
+		})
+
+		serve := func(m *GzipMiddleware, acceptEncoding string) *httptest.ResponseRecorder {
+			m.Next = r
+			req, _ := http.NewRequest("POST", "http://skygear.dev/", strings.NewReader(`{"action": "mock:map"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("compresses response for client accepting gzip", func() {
+			resp := serve(&GzipMiddleware{MinSize: 10}, "deflate, gzip")
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			So(resp.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+
+			reader, err := gzip.NewReader(resp.Body)
+			So(err, ShouldBeNil)
+			body, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(body, ShouldEqualJSON, `{"result": "`+result+`"}`)
+		})
+
+		Convey("does not compress response smaller than min size", func() {
+			resp := serve(&GzipMiddleware{MinSize: 1024}, "gzip")
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": "`+result+`"}`)
+		})
+
+		Convey("does not compress response for client not accepting gzip", func() {
+			resp := serve(&GzipMiddleware{MinSize: 10}, "gzip;q=0, deflate")
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": "`+result+`"}`)
+		})
+
+		Convey("does not compress response other than JSON", func() {
+			m := &GzipMiddleware{
+				MinSize: 10,
+				Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "image/png")
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(result))
+				}),
+			}
+			req, _ := http.NewRequest("GET", "http://skygear.dev/files/a.png", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+
+			So(resp.Code, ShouldEqual, http.StatusCreated)
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "")
+			So(resp.Body.String(), ShouldEqual, result)
+		})
+	})
+}
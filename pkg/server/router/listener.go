@@ -0,0 +1,100 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+var listenerContextKey ContextKey = "Listener"
+
+// errRequestBodyTooLarge is the message of the error returned by the
+// reader of http.MaxBytesReader when the limit is exceeded.
+const errRequestBodyTooLarge = "http: request body too large"
+
+// ListenerMiddleware serves the requests accepted by a listener.
+//
+// When the server has an internal listener, the public listener and the
+// internal listener are each served by a ListenerMiddleware with
+// MasterKey set. Requests with master key, which are those of plugins
+// and administrators, are then only served on the internal listener, and
+// the internal listener serves nothing else.
+type ListenerMiddleware struct {
+	// Internal is whether the listener is the internal listener.
+	Internal bool
+
+	// MasterKey, if not empty, restricts the requests served on the
+	// listener by whether the master key is specified.
+	MasterKey string
+
+	// MaxBodySize is the maximum number of bytes of a request body.
+	// Zero means unlimited.
+	MaxBodySize int64
+
+	Next http.Handler
+}
+
+func (m *ListenerMiddleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if m.MaxBodySize > 0 && req.Body != nil {
+		if req.ContentLength > m.MaxBodySize {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			writeEntity(w, &Response{Err: errRequestTooLarge(m.MaxBodySize)})
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, m.MaxBodySize)
+	}
+
+	ctx := context.WithValue(req.Context(), listenerContextKey, m)
+	m.Next.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// IsInternalRequest returns whether the request being served with the
+// specified context is served on the internal listener. Requests on the
+// internal listener are not subject to the limits of public requests.
+func IsInternalRequest(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	m, _ := ctx.Value(listenerContextKey).(*ListenerMiddleware)
+	return m != nil && m.Internal
+}
+
+// admitListener returns an error if the request of the payload is not
+// served on the listener it is received on.
+func admitListener(payload *Payload) skyerr.Error {
+	m, _ := payload.Context.Value(listenerContextKey).(*ListenerMiddleware)
+	if m == nil || m.MasterKey == "" {
+		return nil
+	}
+
+	hasMasterKey := payload.APIKey() == m.MasterKey
+	if m.Internal && !hasMasterKey {
+		return skyerr.NewError(skyerr.PermissionDenied,
+			"only requests with master key are served on the internal listener")
+	} else if !m.Internal && hasMasterKey {
+		return skyerr.NewError(skyerr.PermissionDenied,
+			"requests with master key are only served on the internal listener")
+	}
+	return nil
+}
+
+func errRequestTooLarge(maxBodySize int64) skyerr.Error {
+	return skyerr.NewErrorf(skyerr.RequestTooLarge,
+		"request body must not be larger than %d bytes", maxBodySize)
+}
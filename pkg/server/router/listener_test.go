@@ -0,0 +1,89 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestListenerMiddleware(t *testing.T) {
+	Convey("ListenerMiddleware", t, func() {
+		var internal bool
+		r := NewRouter()
+		r.Map("mock:map", &CallbackHandler{
+			callback: func(p *Payload, resp *Response) {
+				internal = IsInternalRequest(p.Context)
+				resp.Result = "ok"
+			},
+		})
+
+		serve := func(m *ListenerMiddleware, body string) *httptest.ResponseRecorder {
+			m.Next = r
+			req, _ := http.NewRequest("POST", "http://skygear.dev/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("serves any request without master key configured", func() {
+			resp := serve(&ListenerMiddleware{}, `{"action": "mock:map", "api_key": "master"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(internal, ShouldBeFalse)
+		})
+
+		Convey("public listener rejects request with master key", func() {
+			m := &ListenerMiddleware{MasterKey: "master"}
+			resp := serve(m, `{"action": "mock:map", "api_key": "master"}`)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+
+			resp = serve(m, `{"action": "mock:map", "api_key": "client"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(internal, ShouldBeFalse)
+		})
+
+		Convey("internal listener serves only request with master key", func() {
+			m := &ListenerMiddleware{Internal: true, MasterKey: "master"}
+			resp := serve(m, `{"action": "mock:map", "api_key": "client"}`)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"name": "PermissionDenied",
+					"code": 102,
+					"message": "only requests with master key are served on the internal listener"
+				}
+			}`)
+
+			resp = serve(m, `{"action": "mock:map", "api_key": "master"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(internal, ShouldBeTrue)
+		})
+
+		Convey("rejects request body larger than the limit", func() {
+			resp := serve(&ListenerMiddleware{MaxBodySize: 16}, `{"action": "mock:map"}`)
+			So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(resp.Body.String(), ShouldContainSubstring, "request body must not be larger than 16 bytes")
+
+			resp = serve(&ListenerMiddleware{MaxBodySize: 64}, `{"action": "mock:map"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+)
+
+var requestDuration = metrics.NewHistogram(
+	"skygear_request_duration_seconds",
+	"Duration of requests by action.",
+	"action", "result",
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(requestDuration)
+}
+
+// observeRequest records the duration and result of a request of a
+// matched action started at startTime.
+func observeRequest(action string, resp *Response, startTime time.Time) {
+	result := "success"
+	if resp.Err != nil {
+		result = "error"
+	}
+	requestDuration.Observe(time.Since(startTime).Seconds(), action, result)
+}
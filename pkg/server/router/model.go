@@ -28,20 +28,128 @@ type ContextKey string
 
 var UserIDContextKey ContextKey = "UserID"
 var AccessKeyTypeContextKey ContextKey = "AccessKeyType"
+var RequestIDContextKey ContextKey = "RequestID"
+
+// RequestIDFromContext returns the ID of the request being served with
+// the specified context, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(RequestIDContextKey).(string)
+	return requestID
+}
 
 // HandlerFunc specifies the function signature of a request handler function
-type HandlerFunc func(*Payload, *Response)
+type HandlerFunc func(context.Context, *Payload, *Response)
 
 // Handler specifies the interface of a request handler
+//
+// Handle is called with the context of the request served, which is the
+// Payload.Context after all preprocessors have run.
 type Handler interface {
 	Setup()
 	GetPreprocessors() []Processor
-	Handle(*Payload, *Response)
+	Handle(context.Context, *Payload, *Response)
+}
+
+// ResponseFilter shapes the result of a response before it is written,
+// e.g. to hide fields that should not be returned to the requester.
+type ResponseFilter interface {
+	FilterResponse(*Payload, *Response) error
+}
+
+// Gatekeeper decides whether a request is served at all before any
+// preprocessor runs, e.g. to reject requests during maintenance.
+type Gatekeeper interface {
+	Admit(*Payload) skyerr.Error
+}
+
+// ConcurrencyLimiter limits the number of requests of each client being
+// handled at the same time, so that a single client cannot occupy all the
+// database connections with parallel requests.
+type ConcurrencyLimiter interface {
+	// Acquire admits a request of the client identified by key, waiting
+	// until an earlier request of the client is handled if needed. The
+	// returned function must be called once the request is handled.
+	Acquire(ctx context.Context, key string) (release func(), err skyerr.Error)
+}
+
+// RateLimiter limits the number of requests of each client per unit of
+// time, so that a single misbehaving client cannot exhaust the server.
+type RateLimiter interface {
+	// Allow counts a request of the client identified by key, and
+	// returns an error if the client has made too many requests.
+	Allow(key string) skyerr.Error
+}
+
+// BodyCapturer decides whether the request and response bodies of a
+// request are logged, so that a specific action or user can be debugged
+// without logging every request.
+type BodyCapturer interface {
+	ShouldCapture(*Payload) bool
+}
+
+// IdempotencyStore stores the responses of requests carrying an
+// idempotency key, so that a replayed request gets the original
+// response instead of being handled again.
+type IdempotencyStore interface {
+	// Handles returns true if requests of action can carry an
+	// idempotency key.
+	Handles(action string) bool
+
+	// Begin reserves key for the request being handled. If a response
+	// is stored under key, it is returned and the request is not
+	// handled again.
+	Begin(ctx context.Context, key string) (*StoredResponse, error)
+
+	// Finish stores response under the key reserved by Begin. The key
+	// is released without storing anything if response is nil.
+	Finish(key string, response *StoredResponse)
+}
+
+// StoredResponse is a response stored by an IdempotencyStore.
+type StoredResponse struct {
+	Status int
+	Info   interface{}
+	Result interface{}
+	Err    skyerr.Error
+}
+
+// ResponseCache caches the responses of read actions, so that identical
+// requests are answered without calling the handler again. Cached
+// responses carry an ETag, which clients can send in If-None-Match to
+// get a 304 Not Modified instead of the response body.
+type ResponseCache interface {
+	// Handles returns true if the responses of action are cached.
+	Handles(action string) bool
+
+	// Get returns the response cached under key, or nil. The returned
+	// generation is to be passed to Put if nothing is cached.
+	Get(key string) (response *CachedResponse, generation uint64)
+
+	// Put caches response under key, unless the cache is invalidated
+	// since generation was returned by Get.
+	Put(key string, generation uint64, response *CachedResponse)
+
+	// Invalidate drops cached responses which a successful request to
+	// action may have made stale.
+	Invalidate(action string)
+}
+
+// CachedResponse is an encoded response cached by a ResponseCache.
+type CachedResponse struct {
+	ETag string
+	Body []byte
 }
 
 // Processor specifies the function signature for a Processor
+//
+// Preprocess is called with the context of the request served. A Processor
+// deriving a new context, e.g. with the authenticated user, sets it to
+// Payload.Context so that it is passed to the processors and handler after it.
 type Processor interface {
-	Preprocess(*Payload, *Response) int
+	Preprocess(context.Context, *Payload, *Response) int
 }
 
 type funcHandler struct {
@@ -56,8 +164,8 @@ func (h *funcHandler) GetPreprocessors() []Processor {
 	return []Processor{}
 }
 
-func (h *funcHandler) Handle(payload *Payload, response *Response) {
-	h.Func(payload, response)
+func (h *funcHandler) Handle(ctx context.Context, payload *Payload, response *Response) {
+	h.Func(ctx, payload, response)
 }
 
 // NewFuncHandler is intend for using in test, not actual code.
@@ -125,12 +233,27 @@ func (p *Payload) RouteAction() string {
 	return actionStr
 }
 
+// IdempotencyKey returns the idempotency key in the request.
+func (p *Payload) IdempotencyKey() string {
+	key, _ := p.Data["idempotency_key"].(string)
+	return key
+}
+
 // APIKey returns the api key in the request.
 func (p *Payload) APIKey() string {
 	key, _ := p.Data["api_key"].(string)
 	return key
 }
 
+// RequestAppName returns the name of the app the request claims to be
+// made to, or an empty string if the request does not name one. It is
+// supplied by the client, so the app is selected by the keys of the
+// request rather than by the name.
+func (p *Payload) RequestAppName() string {
+	name, _ := p.Data["app_name"].(string)
+	return name
+}
+
 // AccessTokenString return the user input string
 // TODO: accept all header, json payload, query string(in order)
 func (p *Payload) AccessTokenString() string {
@@ -159,6 +282,7 @@ type Response struct {
 	DatabaseID string              `json:"database_id,omitempty"`
 	writer     http.ResponseWriter
 	writerOnce sync.Once
+	cached     *CachedResponse
 }
 
 // Writer returns a http.ResponseWriter only once. If a writer is already
@@ -0,0 +1,63 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net"
+	"net/http"
+)
+
+// RateLimitMiddleware limits the requests of each client IP address
+// before they are parsed. Requests on the internal listener are not
+// limited.
+type RateLimitMiddleware struct {
+	Limiter RateLimiter
+
+	// ClientIP returns the IP address of the client of a request. The
+	// remote address of the request is used if it is nil.
+	ClientIP func(req *http.Request) net.IP
+
+	Next http.Handler
+}
+
+func (m *RateLimitMiddleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if IsInternalRequest(req.Context()) {
+		m.Next.ServeHTTP(w, req)
+		return
+	}
+
+	if err := m.Limiter.Allow(m.clientIP(req)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(defaultStatusCode(err))
+		writeEntity(w, &Response{Err: err})
+		return
+	}
+
+	m.Next.ServeHTTP(w, req)
+}
+
+func (m *RateLimitMiddleware) clientIP(req *http.Request) string {
+	if m.ClientIP != nil {
+		if ip := m.ClientIP(req); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,127 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingRateLimiter allows a single request of each key.
+type recordingRateLimiter struct {
+	keys []string
+}
+
+func (l *recordingRateLimiter) Allow(key string) skyerr.Error {
+	for _, k := range l.keys {
+		if k == key {
+			return skyerr.NewError(skyerr.TooManyRequests, "cannot make more than 1 requests per minute")
+		}
+	}
+	l.keys = append(l.keys, key)
+	return nil
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	Convey("RateLimitMiddleware", t, func() {
+		called := 0
+		limiter := &recordingRateLimiter{}
+		m := &RateLimitMiddleware{
+			Limiter: limiter,
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called++
+			}),
+		}
+
+		serve := func(remoteAddr string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "http://skygear.dev/", nil)
+			req.RemoteAddr = remoteAddr
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("limits requests by client IP", func() {
+			So(serve("10.0.0.1:52000").Code, ShouldEqual, http.StatusOK)
+			So(serve("10.0.0.2:52000").Code, ShouldEqual, http.StatusOK)
+			So(limiter.keys, ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+
+			resp := serve("10.0.0.1:52001")
+			So(resp.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 125,
+					"name": "TooManyRequests",
+					"message": "cannot make more than 1 requests per minute"
+				}
+			}`)
+			So(called, ShouldEqual, 2)
+		})
+
+		Convey("does not limit requests on internal listener", func() {
+			listener := &ListenerMiddleware{Internal: true, Next: m}
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest("POST", "http://skygear.dev/", nil)
+				req.RemoteAddr = "127.0.0.1:52000"
+				resp := httptest.NewRecorder()
+				listener.ServeHTTP(resp, req)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+			}
+			So(called, ShouldEqual, 2)
+			So(limiter.keys, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestAPIKeyRateLimiter(t *testing.T) {
+	Convey("Router with APIKeyRateLimiter", t, func() {
+		called := 0
+		limiter := &recordingRateLimiter{}
+		r := NewRouter()
+		r.APIKeyRateLimiter = limiter
+		r.Map("mock:handler", &CallbackHandler{
+			callback: func(p *Payload, resp *Response) {
+				called++
+			},
+		})
+
+		post := func(body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "http://skygear.dev/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("limits requests by API key", func() {
+			So(post(`{"action": "mock:handler", "api_key": "apikey"}`).Code, ShouldEqual, http.StatusOK)
+			So(post(`{"action": "mock:handler", "api_key": "apikey"}`).Code, ShouldEqual, http.StatusTooManyRequests)
+			So(post(`{"action": "mock:handler", "api_key": "otherkey"}`).Code, ShouldEqual, http.StatusOK)
+			So(called, ShouldEqual, 2)
+		})
+
+		Convey("does not limit requests without API key", func() {
+			So(post(`{"action": "mock:handler"}`).Code, ShouldEqual, http.StatusOK)
+			So(post(`{"action": "mock:handler"}`).Code, ShouldEqual, http.StatusOK)
+			So(limiter.keys, ShouldBeEmpty)
+		})
+	})
+}
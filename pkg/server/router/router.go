@@ -136,6 +136,12 @@ func (r *Router) newPayload(req *http.Request) (p *Payload, err error) {
 	if accessToken := req.Header.Get("X-Skygear-Access-Token"); accessToken != "" {
 		p.Data["access_token"] = accessToken
 	}
+	if appName := req.Header.Get("X-Skygear-App"); appName != "" {
+		p.Data["app_name"] = appName
+	}
+	if idempotencyKey := req.Header.Get("X-Skygear-Idempotency-Key"); idempotencyKey != "" {
+		p.Data["idempotency_key"] = idempotencyKey
+	}
 
 	return
 }
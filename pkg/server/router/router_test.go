@@ -15,6 +15,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -40,7 +41,7 @@ func (m *MockHandler) GetPreprocessors() []Processor {
 	return nil
 }
 
-func (m *MockHandler) Handle(p *Payload, r *Response) {
+func (m *MockHandler) Handle(ctx context.Context, p *Payload, r *Response) {
 	if m.delay.Seconds() > 0 {
 		<-time.After(m.delay)
 	}
@@ -60,7 +61,7 @@ func (h *CallbackHandler) GetPreprocessors() []Processor {
 	return nil
 }
 
-func (h *CallbackHandler) Handle(p *Payload, r *Response) {
+func (h *CallbackHandler) Handle(ctx context.Context, p *Payload, r *Response) {
 	if h.callback != nil {
 		h.callback(p, r)
 	}
@@ -78,7 +79,7 @@ func (h *ErrHandler) GetPreprocessors() []Processor {
 	return nil
 }
 
-func (h *ErrHandler) Handle(p *Payload, r *Response) {
+func (h *ErrHandler) Handle(ctx context.Context, p *Payload, r *Response) {
 	r.Err = h.Err
 }
 
@@ -161,7 +162,7 @@ type getPreprocessor struct {
 	Err    skyerr.Error
 }
 
-func (p getPreprocessor) Preprocess(payload *Payload, response *Response) int {
+func (p getPreprocessor) Preprocess(ctx context.Context, payload *Payload, response *Response) int {
 	response.Err = p.Err
 	return p.Status
 }
@@ -340,6 +341,27 @@ func TestTimeout(t *testing.T) {
 
 			So(resp.Code, ShouldEqual, http.StatusServiceUnavailable)
 		})
+
+		Convey("set deadline of request context", func(c C) {
+			callbackHandler := CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					_, ok := p.Context.Deadline()
+					c.So(ok, ShouldBeTrue)
+				},
+			}
+			r.Map("mock:callback", &callbackHandler)
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(`{"action": "mock:callback"}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
 	})
 }
 
@@ -365,5 +387,424 @@ func TestRouterRequest(t *testing.T) {
 			resp := httptest.NewRecorder()
 			r.ServeHTTP(resp, req)
 		})
+
+		Convey("generates request ID", func(c C) {
+			var requestID string
+			callbackHandler := CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					requestID = RequestIDFromContext(p.Context)
+				},
+			}
+
+			r := NewRouter()
+			r.Map("mock:callback", &callbackHandler)
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/mock/callback",
+				strings.NewReader(""),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			So(requestID, ShouldNotBeEmpty)
+			So(resp.Header().Get("X-Request-ID"), ShouldEqual, requestID)
+		})
+
+		Convey("propagates request ID from header", func(c C) {
+			var requestID string
+			callbackHandler := CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					requestID = RequestIDFromContext(p.Context)
+				},
+			}
+
+			r := NewRouter()
+			r.Map("mock:callback", &callbackHandler)
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/mock/callback",
+				strings.NewReader(""),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "request-0")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			So(requestID, ShouldEqual, "request-0")
+			So(resp.Header().Get("X-Request-ID"), ShouldEqual, "request-0")
+		})
+	})
+}
+
+type mapIdempotencyStore map[string]*StoredResponse
+
+func (s mapIdempotencyStore) Handles(action string) bool {
+	return action == "mock:callback" || action == "auth:signup"
+}
+
+func (s mapIdempotencyStore) Begin(ctx context.Context, key string) (*StoredResponse, error) {
+	return s[key], nil
+}
+
+func (s mapIdempotencyStore) Finish(key string, response *StoredResponse) {
+	if response != nil {
+		s[key] = response
+	}
+}
+
+// requesterPreprocessor takes the app and user of the request from its
+// payload, in place of the preprocessors checking the keys and token.
+type requesterPreprocessor struct{}
+
+func (p requesterPreprocessor) Preprocess(ctx context.Context, payload *Payload, response *Response) int {
+	payload.AppName, _ = payload.Data["app_name"].(string)
+	payload.UserInfoID, _ = payload.Data["user_id"].(string)
+	if payload.APIKey() == "master" {
+		payload.AccessKey = MasterAccessKey
+	} else {
+		payload.AccessKey = ClientAccessKey
+	}
+	return http.StatusOK
+}
+
+func TestIdempotency(t *testing.T) {
+	Convey("Router with IdempotencyStore", t, func() {
+		calls := 0
+		callbackHandler := CallbackHandler{
+			callback: func(p *Payload, r *Response) {
+				calls++
+				r.Result = calls
+			},
+		}
+
+		store := mapIdempotencyStore{}
+		r := NewRouter()
+		r.IdempotencyStore = store
+		r.Map("mock:callback", &callbackHandler, requesterPreprocessor{})
+		r.Map("mock:other", &callbackHandler, requesterPreprocessor{})
+		r.Map("auth:signup", &callbackHandler, requesterPreprocessor{})
+
+		post := func(body string, idempotencyKey string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			if idempotencyKey != "" {
+				req.Header.Set("X-Skygear-Idempotency-Key", idempotencyKey)
+			}
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("replays response of the same key", func() {
+			resp := post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+
+			resp = post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice", "idempotency_key": "key0"}`, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+			So(calls, ShouldEqual, 1)
+
+			resp = post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice"}`, "key1")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 2}`)
+		})
+
+		Convey("does not replay response to other users, API keys or apps", func() {
+			post(`{"action": "mock:callback", "api_key": "client", "app_name": "app", "user_id": "alice"}`, "key0")
+
+			resp := post(`{"action": "mock:callback", "api_key": "client", "app_name": "app", "user_id": "bob"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 2}`)
+			resp = post(`{"action": "mock:callback", "api_key": "other", "app_name": "app", "user_id": "alice"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 3}`)
+			resp = post(`{"action": "mock:callback", "api_key": "client", "app_name": "other", "user_id": "alice"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 4}`)
+		})
+
+		Convey("replays response of master key requests without user", func() {
+			post(`{"action": "mock:callback", "api_key": "master"}`, "key0")
+			resp := post(`{"action": "mock:callback", "api_key": "master"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("does not store response of requests without user", func() {
+			post(`{"action": "mock:callback", "api_key": "client"}`, "key0")
+			resp := post(`{"action": "mock:callback", "api_key": "client"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 2}`)
+			So(store, ShouldBeEmpty)
+		})
+
+		Convey("does not store response of auth actions", func() {
+			post(`{"action": "auth:signup", "api_key": "client", "user_id": "alice"}`, "key0")
+			resp := post(`{"action": "auth:signup", "api_key": "client", "user_id": "alice"}`, "key0")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 2}`)
+			So(store, ShouldBeEmpty)
+		})
+
+		Convey("handles requests without key or of other actions", func() {
+			post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice"}`, "")
+			post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice"}`, "")
+			post(`{"action": "mock:other", "api_key": "client", "user_id": "alice"}`, "key0")
+			post(`{"action": "mock:other", "api_key": "client", "user_id": "alice"}`, "key0")
+			So(calls, ShouldEqual, 4)
+			So(store, ShouldBeEmpty)
+		})
+
+		Convey("does not store server errors", func() {
+			callbackHandler.callback = func(p *Payload, r *Response) {
+				calls++
+				r.Err = skyerr.NewError(skyerr.UnexpectedError, "failed")
+			}
+
+			resp := post(`{"action": "mock:callback", "api_key": "client", "user_id": "alice"}`, "key0")
+			So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+			So(store, ShouldBeEmpty)
+		})
+	})
+}
+
+type mapResponseCache struct {
+	generation uint64
+	entries    map[string]*CachedResponse
+}
+
+func (c *mapResponseCache) Handles(action string) bool {
+	return action == "mock:read"
+}
+
+func (c *mapResponseCache) Get(key string) (*CachedResponse, uint64) {
+	return c.entries[key], c.generation
+}
+
+func (c *mapResponseCache) Put(key string, generation uint64, response *CachedResponse) {
+	if generation == c.generation {
+		c.entries[key] = response
+	}
+}
+
+func (c *mapResponseCache) Invalidate(action string) {
+	if action == "mock:write" {
+		c.generation++
+		c.entries = map[string]*CachedResponse{}
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	Convey("Router with ResponseCache", t, func() {
+		calls := 0
+		callbackHandler := CallbackHandler{
+			callback: func(p *Payload, r *Response) {
+				calls++
+				r.Result = calls
+			},
+		}
+
+		cache := &mapResponseCache{
+			entries: map[string]*CachedResponse{},
+		}
+		r := NewRouter()
+		r.ResponseCache = cache
+		r.Map("mock:read", &callbackHandler)
+		r.Map("mock:write", &callbackHandler)
+
+		post := func(body string, ifNoneMatch string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("caches response of identical request", func() {
+			resp := post(`{"action": "mock:read", "ids": ["note/1"]}`, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+			etag := resp.Header().Get("ETag")
+			So(etag, ShouldNotBeEmpty)
+
+			resp = post(`{"action": "mock:read", "ids": ["note/1"], "api_key": "key"}`, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+			So(resp.Header().Get("ETag"), ShouldEqual, etag)
+			So(calls, ShouldEqual, 1)
+
+			resp = post(`{"action": "mock:read", "ids": ["note/2"]}`, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 2}`)
+		})
+
+		Convey("responds not modified if ETag matches", func() {
+			resp := post(`{"action": "mock:read"}`, "")
+			etag := resp.Header().Get("ETag")
+
+			resp = post(`{"action": "mock:read"}`, `"other", `+etag)
+			So(resp.Code, ShouldEqual, http.StatusNotModified)
+			So(resp.Body.Len(), ShouldEqual, 0)
+			So(resp.Header().Get("ETag"), ShouldEqual, etag)
+
+			resp = post(`{"action": "mock:read"}`, `"other"`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 1}`)
+		})
+
+		Convey("invalidates cache on write", func() {
+			post(`{"action": "mock:read"}`, "")
+			resp := post(`{"action": "mock:write"}`, "")
+			So(resp.Header().Get("ETag"), ShouldBeEmpty)
+
+			resp = post(`{"action": "mock:read"}`, "")
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"result": 3}`)
+		})
+
+		Convey("does not cache errors", func() {
+			callbackHandler.callback = func(p *Payload, r *Response) {
+				calls++
+				r.Err = skyerr.NewError(skyerr.ResourceNotFound, "not found")
+			}
+
+			resp := post(`{"action": "mock:read"}`, "")
+			So(resp.Header().Get("ETag"), ShouldBeEmpty)
+			So(cache.entries, ShouldBeEmpty)
+		})
+	})
+}
+
+type rejectingGatekeeper struct{}
+
+func (g rejectingGatekeeper) Admit(p *Payload) skyerr.Error {
+	if p.RouteAction() == "mock:rejected" {
+		return skyerr.NewError(skyerr.UnderMaintenance, "server is under maintenance")
+	}
+	return nil
+}
+
+func TestGatekeeper(t *testing.T) {
+	Convey("Router with Gatekeeper", t, func() {
+		called := false
+		callbackHandler := CallbackHandler{
+			callback: func(p *Payload, r *Response) {
+				called = true
+			},
+		}
+
+		r := NewRouter()
+		r.Gatekeeper = rejectingGatekeeper{}
+		r.Map("mock:admitted", &callbackHandler)
+		r.Map("mock:rejected", &callbackHandler)
+
+		post := func(body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("serves admitted request", func() {
+			resp := post(`{"action": "mock:admitted"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(called, ShouldBeTrue)
+		})
+
+		Convey("rejects request without handling it", func() {
+			resp := post(`{"action": "mock:rejected"}`)
+			So(resp.Code, ShouldEqual, http.StatusServiceUnavailable)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 126,
+					"name": "UnderMaintenance",
+					"message": "server is under maintenance"
+				}
+			}`)
+			So(called, ShouldBeFalse)
+		})
+	})
+}
+
+type recordingConcurrencyLimiter struct {
+	keys     []string
+	released int
+}
+
+func (l *recordingConcurrencyLimiter) Acquire(ctx context.Context, key string) (func(), skyerr.Error) {
+	if key == "access_token\x00busytoken" {
+		return nil, skyerr.NewError(skyerr.TooManyRequests, "cannot make more than 1 requests at the same time")
+	}
+	l.keys = append(l.keys, key)
+	return func() { l.released++ }, nil
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	Convey("Router with ConcurrencyLimiter", t, func() {
+		called := false
+		callbackHandler := CallbackHandler{
+			callback: func(p *Payload, r *Response) {
+				called = true
+			},
+		}
+
+		limiter := &recordingConcurrencyLimiter{}
+		r := NewRouter()
+		r.Concurrency = limiter
+		r.Map("mock:handler", &callbackHandler)
+
+		post := func(body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("limits request by access token", func() {
+			resp := post(`{"action": "mock:handler", "api_key": "apikey", "access_token": "token"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(called, ShouldBeTrue)
+			So(limiter.keys, ShouldResemble, []string{"access_token\x00token"})
+			So(limiter.released, ShouldEqual, 1)
+		})
+
+		Convey("limits request without access token by API key", func() {
+			resp := post(`{"action": "mock:handler", "api_key": "apikey"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(limiter.keys, ShouldResemble, []string{"api_key\x00apikey"})
+		})
+
+		Convey("does not limit anonymous request", func() {
+			resp := post(`{"action": "mock:handler"}`)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(called, ShouldBeTrue)
+			So(limiter.keys, ShouldBeEmpty)
+		})
+
+		Convey("rejects excess request without handling it", func() {
+			resp := post(`{"action": "mock:handler", "access_token": "busytoken"}`)
+			So(resp.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 125,
+					"name": "TooManyRequests",
+					"message": "cannot make more than 1 requests at the same time"
+				}
+			}`)
+			So(called, ShouldBeFalse)
+		})
 	})
 }
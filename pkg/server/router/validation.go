@@ -0,0 +1,162 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// FieldType is the expected JSON type of a field in the request payload.
+type FieldType int
+
+// List of field types. AnyField accepts a value of any type.
+const (
+	AnyField FieldType = iota
+	StringField
+	NumberField
+	BooleanField
+	MapField
+	ArrayField
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case StringField:
+		return "string"
+	case NumberField:
+		return "number"
+	case BooleanField:
+		return "boolean"
+	case MapField:
+		return "object"
+	case ArrayField:
+		return "array"
+	default:
+		return "any"
+	}
+}
+
+func (t FieldType) accepts(value interface{}) bool {
+	switch t {
+	case StringField:
+		_, ok := value.(string)
+		return ok
+	case NumberField:
+		_, ok := value.(float64)
+		return ok
+	case BooleanField:
+		_, ok := value.(bool)
+		return ok
+	case MapField:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case ArrayField:
+		_, ok := value.([]interface{})
+		return ok
+	default:
+		return true
+	}
+}
+
+// Field describes a top-level key of the request payload.
+type Field struct {
+	Name string
+	Type FieldType
+
+	// Required fields must be present and not null. A required string
+	// field must also be non-empty.
+	Required bool
+
+	// Enum restricts the value of a string field to one of the
+	// specified values.
+	Enum []string
+
+	// Elem is the expected type of the elements of an array field.
+	Elem FieldType
+}
+
+// PayloadSchema describes the keys expected in the request payload of
+// an action. Keys not described in the schema are not validated.
+type PayloadSchema []Field
+
+// Validate checks data against the schema, returning an InvalidArgument
+// error naming the first field that does not conform.
+func (s PayloadSchema) Validate(data map[string]interface{}) skyerr.Error {
+	for _, field := range s {
+		if err := field.validate(data[field.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f Field) validate(value interface{}) skyerr.Error {
+	if value == nil {
+		if f.Required {
+			return f.newError(fmt.Sprintf(`missing required field "%s"`, f.Name))
+		}
+		return nil
+	}
+
+	if !f.Type.accepts(value) {
+		return f.newError(fmt.Sprintf(`field "%s" must be of type %s`, f.Name, f.Type))
+	}
+
+	switch value := value.(type) {
+	case string:
+		if f.Required && value == "" {
+			return f.newError(fmt.Sprintf(`field "%s" must not be empty`, f.Name))
+		}
+		if f.Enum != nil && !stringInSlice(value, f.Enum) {
+			return f.newError(fmt.Sprintf(
+				`field "%s" must be one of %s, got "%s"`,
+				f.Name,
+				strings.Join(f.Enum, ", "),
+				value,
+			))
+		}
+	case []interface{}:
+		for _, elem := range value {
+			if !f.Elem.accepts(elem) {
+				return f.newError(fmt.Sprintf(`field "%s" must be an array of %s`, f.Name, f.Elem))
+			}
+		}
+	}
+	return nil
+}
+
+func (f Field) newError(message string) skyerr.Error {
+	return skyerr.NewInvalidArgument(message, []string{f.Name})
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PayloadValidator is implemented by a Handler that declares the schema
+// of its request payload. The payload is validated against the schema
+// after the preprocessors run, and the handler is not called if the
+// payload does not conform.
+type PayloadValidator interface {
+	PayloadSchema() PayloadSchema
+}
@@ -0,0 +1,141 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type schemaHandler struct {
+	CallbackHandler
+	schema PayloadSchema
+}
+
+func (h *schemaHandler) PayloadSchema() PayloadSchema {
+	return h.schema
+}
+
+func TestPayloadSchema(t *testing.T) {
+	Convey("PayloadSchema", t, func() {
+		schema := PayloadSchema{
+			{Name: "type", Type: StringField, Required: true, Enum: []string{"ios", "android"}},
+			{Name: "count", Type: NumberField},
+			{Name: "roles", Type: ArrayField, Elem: StringField},
+			{Name: "extra"},
+		}
+
+		Convey("accepts conforming payload", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type":  "ios",
+				"count": float64(1),
+				"roles": []interface{}{"admin"},
+				"extra": map[string]interface{}{},
+			}), ShouldBeNil)
+		})
+
+		Convey("accepts payload without optional fields", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type":  "android",
+				"count": nil,
+			}), ShouldBeNil)
+		})
+
+		Convey("rejects missing required field", func() {
+			So(schema.Validate(map[string]interface{}{}), ShouldResemble,
+				skyerr.NewInvalidArgument(`missing required field "type"`, []string{"type"}))
+		})
+
+		Convey("rejects empty required string", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type": "",
+			}), ShouldResemble,
+				skyerr.NewInvalidArgument(`field "type" must not be empty`, []string{"type"}))
+		})
+
+		Convey("rejects value not in enum", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type": "windows",
+			}), ShouldResemble,
+				skyerr.NewInvalidArgument(`field "type" must be one of ios, android, got "windows"`, []string{"type"}))
+		})
+
+		Convey("rejects value of wrong type", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type":  "ios",
+				"count": "1",
+			}), ShouldResemble,
+				skyerr.NewInvalidArgument(`field "count" must be of type number`, []string{"count"}))
+		})
+
+		Convey("rejects array element of wrong type", func() {
+			So(schema.Validate(map[string]interface{}{
+				"type":  "ios",
+				"roles": []interface{}{"admin", float64(1)},
+			}), ShouldResemble,
+				skyerr.NewInvalidArgument(`field "roles" must be an array of string`, []string{"roles"}))
+		})
+	})
+
+	Convey("Router with PayloadValidator", t, func() {
+		called := false
+		r := NewRouter()
+		r.Map("mock:schema", &schemaHandler{
+			CallbackHandler: CallbackHandler{
+				callback: func(p *Payload, r *Response) {
+					called = true
+				},
+			},
+			schema: PayloadSchema{
+				{Name: "name", Type: StringField, Required: true},
+			},
+		})
+
+		Convey("calls handler with conforming payload", func() {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(`{"action": "mock:schema", "name": "skygear"}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(called, ShouldBeTrue)
+		})
+
+		Convey("rejects non-conforming payload without calling handler", func() {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(`{"action": "mock:schema", "name": 1}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			So(resp.Body.String(), ShouldContainSubstring, `field \"name\" must be of type string`)
+			So(called, ShouldBeFalse)
+		})
+	})
+}
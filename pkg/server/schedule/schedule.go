@@ -0,0 +1,146 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule runs skydb.ScheduledMutation when they are due, so
+// that records can be published or unpublished at a specified time
+// without external cron jobs.
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("schedule")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// batchSize is the number of due mutations fetched at a time.
+const batchSize = 100
+
+// Run applies all mutations that are due. The beforeSave and afterSave
+// hooks in registry are executed for each record as it is saved.
+//
+// A mutation is removed once it is run. It is also removed without
+// being run if the record no longer exists, a beforeSave hook rejects
+// the change or the record cannot be saved, so a mutation is never
+// retried indefinitely and does not block the mutations after it. It
+// returns the number of mutations applied.
+func Run(ctx context.Context, conn skydb.Conn, registry *hook.Registry) (int, error) {
+	store, ok := conn.(skydb.ScheduledMutationStore)
+	if !ok {
+		return 0, nil
+	}
+
+	now := timeNow()
+	count := 0
+	for {
+		mutations, err := store.GetDueScheduledMutations(ctx, now, batchSize)
+		if err != nil {
+			return count, err
+		}
+
+		for _, mutation := range mutations {
+			if apply(ctx, conn, registry, mutation, now) {
+				count++
+			}
+
+			if err := store.DeleteScheduledMutation(ctx, mutation.ID); err != nil && err != skydb.ErrScheduledMutationNotFound {
+				return count, err
+			}
+		}
+
+		if len(mutations) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+func apply(ctx context.Context, conn skydb.Conn, registry *hook.Registry, mutation skydb.ScheduledMutation, now time.Time) bool {
+	logger := log.WithField("mutation", mutation.ID).WithField("record", mutation.RecordID.String())
+
+	var db skydb.Database
+	if mutation.DatabaseID == "" {
+		db = conn.PublicDB()
+	} else {
+		db = conn.PrivateDB(mutation.DatabaseID)
+	}
+
+	var record skydb.Record
+	if err := db.Get(ctx, mutation.RecordID, &record); err == skydb.ErrRecordNotFound {
+		logger.Warnln("record of scheduled mutation no longer exists")
+		return false
+	} else if err != nil {
+		logger.WithField("err", err).Errorln("failed to get record of scheduled mutation")
+		return false
+	}
+
+	originalRecord := record
+	record.Data = skydb.Data{}
+	for key, value := range originalRecord.Data {
+		record.Data[key] = value
+	}
+	for key, value := range mutation.Data {
+		record.Data[key] = value
+	}
+	record.UpdatedAt = now
+	record.UpdaterID = mutation.CreatorID
+
+	if registry != nil {
+		if err := registry.ExecuteHooks(ctx, hook.BeforeSave, &record, &originalRecord); err != nil {
+			logger.WithField("err", err).Errorln("scheduled mutation is rejected by hook")
+			return false
+		}
+	}
+
+	if err := db.Save(ctx, &record); err != nil {
+		logger.WithField("err", err).Errorln("failed to save record of scheduled mutation")
+		return false
+	}
+
+	if registry != nil {
+		if err := registry.ExecuteHooks(ctx, hook.AfterSave, &record, &originalRecord); err != nil {
+			logger.WithField("err", err).Errorln("error occurred while executing hooks")
+		}
+	}
+
+	return true
+}
+
+// Schedule adds a job to c that runs due mutations on schedule spec,
+// with a connection opened by connOpener.
+func Schedule(c *cron.Cron, spec string, registry *hook.Registry, connOpener func() (skydb.Conn, error)) error {
+	return c.AddFunc(spec, func() {
+		conn, err := connOpener()
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to open connection to run scheduled mutations")
+			return
+		}
+		defer conn.Close()
+
+		count, err := Run(context.Background(), conn, registry)
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to run scheduled mutations")
+		}
+		if count > 0 {
+			log.Infof("ran %d scheduled mutations", count)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type scheduleConn struct {
+	*skydbtest.MapConn
+	publicDB   *skydbtest.MapDB
+	privateDBs map[string]*skydbtest.MapDB
+	saveErrs   map[string]error
+	mutations  []skydb.ScheduledMutation
+}
+
+type unsavableDB struct {
+	*skydbtest.MapDB
+	err error
+}
+
+func (db *unsavableDB) Save(ctx context.Context, record *skydb.Record) error {
+	return db.err
+}
+
+func (c *scheduleConn) PublicDB() skydb.Database {
+	return c.publicDB
+}
+
+func (c *scheduleConn) PrivateDB(userKey string) skydb.Database {
+	if err, ok := c.saveErrs[userKey]; ok {
+		return &unsavableDB{c.privateDBs[userKey], err}
+	}
+	return c.privateDBs[userKey]
+}
+
+func (c *scheduleConn) SaveScheduledMutation(ctx context.Context, mutation *skydb.ScheduledMutation) error {
+	c.mutations = append(c.mutations, *mutation)
+	return nil
+}
+
+func (c *scheduleConn) GetScheduledMutations(ctx context.Context, recordID skydb.RecordID) ([]skydb.ScheduledMutation, error) {
+	panic("not implemented")
+}
+
+func (c *scheduleConn) GetDueScheduledMutations(ctx context.Context, before time.Time, limit uint64) ([]skydb.ScheduledMutation, error) {
+	mutations := []skydb.ScheduledMutation{}
+	for _, mutation := range c.mutations {
+		if !mutation.RunAt.After(before) && uint64(len(mutations)) < limit {
+			mutations = append(mutations, mutation)
+		}
+	}
+	return mutations, nil
+}
+
+func (c *scheduleConn) DeleteScheduledMutation(ctx context.Context, id string) error {
+	for i, mutation := range c.mutations {
+		if mutation.ID == id {
+			c.mutations = append(c.mutations[:i], c.mutations[i+1:]...)
+			return nil
+		}
+	}
+	return skydb.ErrScheduledMutationNotFound
+}
+
+func TestRun(t *testing.T) {
+	Convey("Run", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		conn := &scheduleConn{
+			MapConn:  skydbtest.NewMapConn(),
+			publicDB: skydbtest.NewMapDB(),
+			privateDBs: map[string]*skydbtest.MapDB{
+				"editor": skydbtest.NewMapDB(),
+			},
+		}
+		conn.publicDB.Save(context.Background(), &skydb.Record{
+			ID:   skydb.NewRecordID("article", "1"),
+			Data: skydb.Data{"title": "Hello", "status": "draft"},
+		})
+		conn.privateDBs["editor"].Save(context.Background(), &skydb.Record{
+			ID:   skydb.NewRecordID("article", "2"),
+			Data: skydb.Data{"title": "Private", "status": "draft"},
+		})
+
+		conn.SaveScheduledMutation(context.Background(), &skydb.ScheduledMutation{
+			ID:        "publish",
+			RecordID:  skydb.NewRecordID("article", "1"),
+			Data:      skydb.Data{"status": "published"},
+			RunAt:     now.Add(-time.Minute),
+			CreatorID: "editor",
+		})
+		conn.SaveScheduledMutation(context.Background(), &skydb.ScheduledMutation{
+			ID:         "private",
+			RecordID:   skydb.NewRecordID("article", "2"),
+			DatabaseID: "editor",
+			Data:       skydb.Data{"status": "published"},
+			RunAt:      now,
+		})
+		conn.SaveScheduledMutation(context.Background(), &skydb.ScheduledMutation{
+			ID:       "unpublish",
+			RecordID: skydb.NewRecordID("article", "1"),
+			Data:     skydb.Data{"status": "draft"},
+			RunAt:    now.Add(time.Hour),
+		})
+
+		Convey("applies due mutations", func() {
+			count, err := Run(context.Background(), conn, nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			record := conn.publicDB.RecordMap["article/1"]
+			So(record.Data, ShouldResemble, skydb.Data{"title": "Hello", "status": "published"})
+			So(record.UpdatedAt, ShouldResemble, now)
+			So(record.UpdaterID, ShouldEqual, "editor")
+
+			record = conn.privateDBs["editor"].RecordMap["article/2"]
+			So(record.Data["status"], ShouldEqual, "published")
+
+			So(len(conn.mutations), ShouldEqual, 1)
+			So(conn.mutations[0].ID, ShouldEqual, "unpublish")
+		})
+
+		Convey("executes hooks on transition", func() {
+			registry := hook.NewRegistry()
+			transitions := []string{}
+			registry.Register(hook.BeforeSave, "article", func(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
+				if record.ID.Key == "2" {
+					return skyerr.NewError(skyerr.PermissionDenied, "rejected")
+				}
+				return nil
+			})
+			registry.Register(hook.AfterSave, "article", func(ctx context.Context, record *skydb.Record, originalRecord *skydb.Record) skyerr.Error {
+				transitions = append(transitions, originalRecord.Data["status"].(string)+"->"+record.Data["status"].(string))
+				return nil
+			})
+
+			count, err := Run(context.Background(), conn, registry)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(transitions, ShouldResemble, []string{"draft->published"})
+
+			record := conn.privateDBs["editor"].RecordMap["article/2"]
+			So(record.Data["status"], ShouldEqual, "draft")
+			So(len(conn.mutations), ShouldEqual, 1)
+		})
+
+		Convey("drops mutations failed to save and runs the rest", func() {
+			conn.saveErrs = map[string]error{
+				"editor": errors.New("database is down"),
+			}
+
+			count, err := Run(context.Background(), conn, nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			record := conn.publicDB.RecordMap["article/1"]
+			So(record.Data["status"], ShouldEqual, "published")
+			So(len(conn.mutations), ShouldEqual, 1)
+			So(conn.mutations[0].ID, ShouldEqual, "unpublish")
+		})
+
+		Convey("drops mutations of deleted records", func() {
+			conn.publicDB.Delete(context.Background(), skydb.NewRecordID("article", "1"))
+
+			count, err := Run(context.Background(), conn, nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(len(conn.mutations), ShouldEqual, 1)
+		})
+	})
+}
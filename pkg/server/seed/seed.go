@@ -0,0 +1,302 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seed loads fixtures of record types, users, relations and
+// records into an app, for setting up demo and test environments
+// reproducibly.
+//
+// Fixtures are read from a directory of JSON files, all of which are
+// optional:
+//
+//	schema.json     record types in the format of schema:create
+//	                {"record_types": {"note": {"fields": [{"name": "title", "type": "string"}]}}}
+//	users.json      [{"_id": "alice", "username": "alice", "email": "alice@example.com",
+//	                  "password": "secret", "roles": ["admin"]}]
+//	relations.json  [{"name": "friend", "from": "alice", "to": "bob"}]
+//	records/*.json  {"database_id": "_public", "owner_id": "alice", "records": [
+//	                  {"_id": "note/1", "title": "Hello"}]}
+//
+// Record files are loaded in the order of their file names. The
+// database_id of a record file is either "_public" (the default) or the
+// ID of a user for the private database of that user. owner_id defaults
+// to the owner of the private database, and is required for records in
+// the public database.
+//
+// Seeding is idempotent: users and records with the same IDs are
+// updated instead of duplicated.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+var log = logging.LoggerEntry("seed")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// Fixtures is the data to be loaded into an app.
+type Fixtures struct {
+	Schemas   map[string]skydb.RecordSchema
+	Users     []User
+	Relations []Relation
+	Records   []RecordSet
+}
+
+// User is a user to be created with the specified roles.
+type User struct {
+	ID       string   `json:"_id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// Relation is a relation from one user to another. Name is either
+// "friend" or "follow".
+type Relation struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RecordSet is a set of records to be saved into the same database.
+type RecordSet struct {
+	DatabaseID string
+	OwnerID    string
+	Records    []skydb.Record
+}
+
+type schemaFile struct {
+	RecordTypes map[string]struct {
+		Fields []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"fields"`
+	} `json:"record_types"`
+}
+
+type recordFile struct {
+	DatabaseID string                   `json:"database_id"`
+	OwnerID    string                   `json:"owner_id"`
+	Records    []map[string]interface{} `json:"records"`
+}
+
+// LoadDir loads the fixtures in the directory.
+func LoadDir(dir string) (*Fixtures, error) {
+	fixtures := &Fixtures{
+		Schemas: map[string]skydb.RecordSchema{},
+	}
+
+	schema := schemaFile{}
+	if err := readJSONFile(filepath.Join(dir, "schema.json"), &schema); err != nil {
+		return nil, err
+	}
+	for recordType, fields := range schema.RecordTypes {
+		if strings.HasPrefix(recordType, "_") {
+			return nil, fmt.Errorf("seed: record type %s is reserved", recordType)
+		}
+		recordSchema := skydb.RecordSchema{}
+		for _, field := range fields.Fields {
+			fieldType, err := skydb.SimpleNameToFieldType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("seed: field %s.%s: %v", recordType, field.Name, err)
+			}
+			recordSchema[field.Name] = fieldType
+		}
+		fixtures.Schemas[recordType] = recordSchema
+	}
+
+	if err := readJSONFile(filepath.Join(dir, "users.json"), &fixtures.Users); err != nil {
+		return nil, err
+	}
+	for _, user := range fixtures.Users {
+		if user.ID == "" {
+			return nil, fmt.Errorf("seed: user %s has no _id", user.Username)
+		}
+	}
+
+	if err := readJSONFile(filepath.Join(dir, "relations.json"), &fixtures.Relations); err != nil {
+		return nil, err
+	}
+	for _, relation := range fixtures.Relations {
+		if relation.Name != "friend" && relation.Name != "follow" {
+			return nil, fmt.Errorf("seed: unknown relation %s", relation.Name)
+		}
+	}
+
+	recordPaths, err := filepath.Glob(filepath.Join(dir, "records", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(recordPaths)
+	for _, path := range recordPaths {
+		recordSet, err := loadRecordFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fixtures.Records = append(fixtures.Records, recordSet)
+	}
+
+	return fixtures, nil
+}
+
+func loadRecordFile(path string) (RecordSet, error) {
+	file := recordFile{}
+	if err := readJSONFile(path, &file); err != nil {
+		return RecordSet{}, err
+	}
+
+	recordSet := RecordSet{
+		DatabaseID: file.DatabaseID,
+		OwnerID:    file.OwnerID,
+	}
+	if recordSet.DatabaseID == "" {
+		recordSet.DatabaseID = skydb.PublicDatabaseIdentifier
+	}
+	if recordSet.OwnerID == "" {
+		if recordSet.DatabaseID == skydb.PublicDatabaseIdentifier {
+			return RecordSet{}, fmt.Errorf("seed: %s: owner_id is required for records in public database", path)
+		}
+		recordSet.OwnerID = recordSet.DatabaseID
+	}
+
+	for i, m := range file.Records {
+		if _, ok := m["_access"]; !ok {
+			m["_access"] = nil
+		}
+		record := skydb.Record{}
+		if err := (*skyconv.JSONRecord)(&record).FromMap(m); err != nil {
+			return RecordSet{}, fmt.Errorf("seed: %s: record %d: %v", path, i, err)
+		}
+		recordSet.Records = append(recordSet.Records, record)
+	}
+	return recordSet, nil
+}
+
+// readJSONFile decodes the JSON file at path into v. A nonexistent file
+// is ignored.
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("seed: %s: %v", path, err)
+	}
+	return nil
+}
+
+// Apply loads the fixtures into the app through conn.
+func (f *Fixtures) Apply(ctx context.Context, conn skydb.Conn) error {
+	publicDB := conn.PublicDB()
+	for recordType, schema := range f.Schemas {
+		if _, err := publicDB.Extend(ctx, recordType, schema); err != nil {
+			return fmt.Errorf("seed: failed to create record type %s: %v", recordType, err)
+		}
+	}
+	log.Infof("Seeded %d record types", len(f.Schemas))
+
+	if len(f.Users) > 0 {
+		if _, err := publicDB.Extend(ctx, publicDB.UserRecordType(), skydb.RecordSchema{}); err != nil {
+			return fmt.Errorf("seed: failed to create user record type: %v", err)
+		}
+	}
+	for _, user := range f.Users {
+		if err := applyUser(ctx, conn, publicDB, user); err != nil {
+			return fmt.Errorf("seed: failed to save user %s: %v", user.ID, err)
+		}
+	}
+	log.Infof("Seeded %d users", len(f.Users))
+
+	for _, relation := range f.Relations {
+		if err := conn.AddRelation(ctx, relation.From, "_"+relation.Name, relation.To); err != nil {
+			return fmt.Errorf("seed: failed to add %s relation %s => %s: %v",
+				relation.Name, relation.From, relation.To, err)
+		}
+	}
+	log.Infof("Seeded %d relations", len(f.Relations))
+
+	count := 0
+	for _, recordSet := range f.Records {
+		db := publicDB
+		if recordSet.DatabaseID != skydb.PublicDatabaseIdentifier {
+			db = conn.PrivateDB(recordSet.DatabaseID)
+		}
+		for _, record := range recordSet.Records {
+			if err := saveRecord(ctx, db, recordSet.OwnerID, record); err != nil {
+				return fmt.Errorf("seed: failed to save record %s: %v", record.ID, err)
+			}
+			count++
+		}
+	}
+	log.Infof("Seeded %d records", count)
+
+	return nil
+}
+
+func applyUser(ctx context.Context, conn skydb.Conn, publicDB skydb.Database, user User) error {
+	info := skydb.UserInfo{}
+	err := conn.GetUser(ctx, user.ID, &info)
+	if err != nil && err != skydb.ErrUserNotFound {
+		return err
+	}
+
+	isNew := err == skydb.ErrUserNotFound
+	info.ID = user.ID
+	info.Username = user.Username
+	info.Email = user.Email
+	info.Roles = user.Roles
+	if user.Password != "" && !info.IsSamePassword(user.Password) {
+		info.SetPassword(user.Password)
+	}
+
+	if isNew {
+		if err := conn.CreateUser(ctx, &info); err != nil {
+			return err
+		}
+	} else if err := conn.UpdateUser(ctx, &info); err != nil {
+		return err
+	}
+
+	userRecord := skydb.Record{
+		ID:   skydb.NewRecordID(publicDB.UserRecordType(), user.ID),
+		Data: skydb.Data{},
+	}
+	return saveRecord(ctx, publicDB, user.ID, userRecord)
+}
+
+func saveRecord(ctx context.Context, db skydb.Database, ownerID string, record skydb.Record) error {
+	now := timeNow()
+	record.OwnerID = ownerID
+	record.CreatedAt = now
+	record.CreatorID = ownerID
+	record.UpdatedAt = now
+	record.UpdaterID = ownerID
+	return db.Save(ctx, &record)
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seed
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type seedConn struct {
+	*skydbtest.MapConn
+	publicDB   *skydbtest.MapDB
+	privateDBs map[string]*skydbtest.MapDB
+	relations  map[Relation]bool
+}
+
+func newSeedConn() *seedConn {
+	return &seedConn{
+		MapConn:    skydbtest.NewMapConn(),
+		publicDB:   skydbtest.NewMapDB(),
+		privateDBs: map[string]*skydbtest.MapDB{},
+		relations:  map[Relation]bool{},
+	}
+}
+
+func (conn *seedConn) PublicDB() skydb.Database {
+	return conn.publicDB
+}
+
+func (conn *seedConn) PrivateDB(userKey string) skydb.Database {
+	if _, ok := conn.privateDBs[userKey]; !ok {
+		conn.privateDBs[userKey] = skydbtest.NewMapDB()
+	}
+	return conn.privateDBs[userKey]
+}
+
+func (conn *seedConn) AddRelation(ctx context.Context, user string, name string, targetUser string) error {
+	conn.relations[Relation{name, user, targetUser}] = true
+	return nil
+}
+
+func writeFixture(dir string, name string, content string) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	timeNow = func() time.Time { return skydb.ZeroTime }
+	defer func() {
+		timeNow = func() time.Time { return time.Now().UTC() }
+	}()
+
+	Convey("Seed", t, func() {
+		dir, err := ioutil.TempDir("", "skygear.seed.test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		writeFixture(dir, "schema.json", `{
+			"record_types": {
+				"note": {"fields": [{"name": "title", "type": "string"}]}
+			}
+		}`)
+		writeFixture(dir, "users.json", `[
+			{"_id": "alice", "username": "alice", "email": "alice@example.com", "password": "secret", "roles": ["admin"]},
+			{"_id": "bob", "username": "bob", "email": "bob@example.com", "password": "secret"}
+		]`)
+		writeFixture(dir, "relations.json", `[
+			{"name": "friend", "from": "alice", "to": "bob"}
+		]`)
+		writeFixture(dir, "records/01-public.json", `{
+			"owner_id": "alice",
+			"records": [{"_id": "note/1", "title": "Hello"}]
+		}`)
+		writeFixture(dir, "records/02-bob.json", `{
+			"database_id": "bob",
+			"records": [{"_id": "note/2", "title": "Bye"}]
+		}`)
+
+		Convey("loads fixtures from directory", func() {
+			fixtures, err := LoadDir(dir)
+			So(err, ShouldBeNil)
+			So(fixtures.Schemas, ShouldResemble, map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"title": skydb.FieldType{Type: skydb.TypeString},
+				},
+			})
+			So(fixtures.Users, ShouldHaveLength, 2)
+			So(fixtures.Users[0].Roles, ShouldResemble, []string{"admin"})
+			So(fixtures.Relations, ShouldResemble, []Relation{{"friend", "alice", "bob"}})
+			So(fixtures.Records, ShouldHaveLength, 2)
+			So(fixtures.Records[0].DatabaseID, ShouldEqual, "_public")
+			So(fixtures.Records[0].Records[0].ID, ShouldResemble, skydb.NewRecordID("note", "1"))
+			So(fixtures.Records[1].OwnerID, ShouldEqual, "bob")
+		})
+
+		Convey("loads nothing from empty directory", func() {
+			fixtures, err := LoadDir(filepath.Join(dir, "records"))
+			So(err, ShouldBeNil)
+			So(fixtures.Users, ShouldBeEmpty)
+			So(fixtures.Records, ShouldBeEmpty)
+		})
+
+		Convey("rejects public records without owner", func() {
+			writeFixture(dir, "records/03-orphan.json", `{
+				"records": [{"_id": "note/3"}]
+			}`)
+			_, err := LoadDir(dir)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("applies fixtures idempotently", func() {
+			conn := newSeedConn()
+			fixtures, err := LoadDir(dir)
+			So(err, ShouldBeNil)
+			So(fixtures.Apply(context.Background(), conn), ShouldBeNil)
+
+			alice := conn.UserMap["alice"]
+			So(alice.Roles, ShouldResemble, []string{"admin"})
+			So(alice.IsSamePassword("secret"), ShouldBeTrue)
+			So(conn.relations, ShouldResemble, map[Relation]bool{
+				{"_friend", "alice", "bob"}: true,
+			})
+			So(conn.publicDB.RecordSchemaMap, ShouldContainKey, "note")
+			So(conn.publicDB.RecordMap, ShouldContainKey, "user/alice")
+
+			note := conn.publicDB.RecordMap["note/1"]
+			So(note.OwnerID, ShouldEqual, "alice")
+			So(note.Data, ShouldResemble, skydb.Data{"title": "Hello"})
+			So(conn.privateDBs["bob"].RecordMap["note/2"].OwnerID, ShouldEqual, "bob")
+
+			So(fixtures.Apply(context.Background(), conn), ShouldBeNil)
+			So(conn.UserMap, ShouldHaveLength, 2)
+			So(conn.UserMap["alice"].HashedPassword, ShouldResemble, alice.HashedPassword)
+			So(conn.publicDB.RecordMap, ShouldHaveLength, 3)
+		})
+	})
+}
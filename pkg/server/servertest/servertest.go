@@ -0,0 +1,451 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servertest runs the handlers of Skygear Server against the
+// memory skydb implementation, so that integration tests exercise real
+// handler behavior without PostgreSQL, token files or push services.
+//
+//	s := servertest.NewServer()
+//	defer s.Close()
+//
+//	_, accessToken := s.NewUser("john", "secret")
+//	resp := s.POST(`{"action": "me"}`, accessToken)
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/inject"
+
+	"github.com/skygeario/skygear-server/pkg/server/anonymous"
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/authtoken"
+	"github.com/skygeario/skygear-server/pkg/server/captcha"
+	"github.com/skygeario/skygear-server/pkg/server/chat"
+	"github.com/skygeario/skygear-server/pkg/server/geoip"
+	"github.com/skygeario/skygear-server/pkg/server/handler"
+	"github.com/skygeario/skygear-server/pkg/server/livelog"
+	"github.com/skygeario/skygear-server/pkg/server/maintenance"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/plugin"
+	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
+	pp "github.com/skygeario/skygear-server/pkg/server/preprocessor"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/quota"
+	"github.com/skygeario/skygear-server/pkg/server/recordid"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/memory"
+	"github.com/skygeario/skygear-server/pkg/server/stats"
+	"github.com/skygeario/skygear-server/pkg/server/throttle"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
+)
+
+// Keys and app name used by Server.
+const (
+	AppName   = "servertest"
+	APIKey    = "servertest-api-key"
+	MasterKey = "servertest-master-key"
+)
+
+// Server serves the actions of Skygear Server with a memory skydb and
+// the fake stores in this package.
+type Server struct {
+	Router       *router.Router
+	TokenStore   *TokenStore
+	AssetStore   *AssetStore
+	PushSender   *PushSender
+	HookRegistry *hook.Registry
+
+	// Conn is a connection to the data served by the Router, such
+	// that tests can set up and inspect the data directly.
+	Conn skydb.Conn
+
+	option string
+}
+
+// NewServer returns a Server with no data. Data of a Server are not
+// shared with other Servers.
+func NewServer() *Server {
+	s := &Server{
+		Router:       router.NewRouter(),
+		TokenStore:   NewTokenStore(),
+		AssetStore:   NewAssetStore(),
+		PushSender:   &PushSender{},
+		HookRegistry: hook.NewRegistry(),
+		option:       uuid.New(),
+	}
+
+	conn, err := memory.Open(context.Background(), AppName, skydb.RoleBasedAccess, s.option, true)
+	if err != nil {
+		panic(fmt.Sprintf("servertest: unable to open database: %v", err))
+	}
+	s.Conn = conn
+	s.mapHandlers()
+	return s
+}
+
+func (s *Server) mapHandlers() {
+	pluginContext := &plugin.Context{}
+	preprocessorRegistry := router.PreprocessorRegistry{
+		"notification": &pp.NotificationPreprocessor{
+			NotificationSender: s.PushSender,
+		},
+		"accesskey": &pp.AccessKeyValidationPreprocessor{
+			ClientKey: APIKey,
+			MasterKey: MasterKey,
+			AppName:   AppName,
+		},
+		"authenticator": &pp.UserAuthenticator{
+			ClientKey:  APIKey,
+			MasterKey:  MasterKey,
+			AppName:    AppName,
+			TokenStore: s.TokenStore,
+		},
+		"dbconn": &pp.ConnPreprocessor{
+			AppName:       AppName,
+			AccessControl: "role",
+			DBOpener:      skydb.Open,
+			DBImpl:        "memory",
+			Option:        s.option,
+			DevMode:       true,
+		},
+		"plugin_ready": &pp.EnsurePluginReadyPreprocessor{
+			PluginContext: pluginContext,
+			ClientKey:     APIKey,
+			MasterKey:     MasterKey,
+		},
+		"inject_user": &pp.InjectUserIfPresent{
+			AnonymousPolicy: &anonymous.Policy{},
+		},
+		"captcha": &pp.RequireCaptcha{
+			Guard: &captcha.Guard{},
+			GeoIP: &geoip.Resolver{},
+		},
+		"require_user":     &pp.RequireUserForWrite{},
+		"inject_db":        &pp.InjectDatabase{},
+		"inject_public_db": &pp.InjectPublicDatabase{},
+		"dev_only": &pp.DevOnlyProcessor{
+			DevMode: true,
+		},
+	}
+
+	g := &inject.Graph{}
+	injectErr := g.Provide(
+		&inject.Object{Value: provider.NewRegistry(), Complete: true, Name: "ProviderRegistry"},
+		&inject.Object{Value: s.HookRegistry, Complete: true, Name: "HookRegistry"},
+		&inject.Object{Value: s.TokenStore, Complete: true, Name: "TokenStore"},
+		&inject.Object{Value: s.AssetStore, Complete: true, Name: "AssetStore"},
+		&inject.Object{Value: &asset.HeaderPolicy{}, Complete: true, Name: "AssetHeaderPolicy"},
+		&inject.Object{Value: s.PushSender, Complete: true, Name: "PushSender"},
+		&inject.Object{Value: (*workqueue.Queue)(nil), Complete: true, Name: "PushQueue"},
+		&inject.Object{Value: pluginEvent.NewSender(pluginContext), Complete: true, Name: "PluginEventSender"},
+		&inject.Object{Value: skydb.RoleBasedAccess, Complete: true, Name: "AccessModel"},
+		&inject.Object{Value: &moderation.Pipeline{}, Complete: true, Name: "ModerationPipeline"},
+		&inject.Object{Value: &geoip.Resolver{}, Complete: true, Name: "GeoIPResolver"},
+		&inject.Object{Value: &quota.Enforcer{}, Complete: true, Name: "QuotaEnforcer"},
+		&inject.Object{Value: &maintenance.Switch{MasterKey: MasterKey}, Complete: true, Name: "MaintenanceSwitch"},
+		&inject.Object{Value: &livelog.Controller{}, Complete: true, Name: "LiveLogController"},
+		&inject.Object{Value: &pubsub.ACL{}, Complete: true, Name: "PubSubACL"},
+		&inject.Object{Value: &throttle.Limiter{}, Complete: true, Name: "RecordThrottle"},
+		&inject.Object{Value: &recordid.Policy{}, Complete: true, Name: "RecordIDPolicy"},
+		&inject.Object{Value: &stats.Recorder{}, Complete: true, Name: "RecordStats"},
+		&inject.Object{Value: &chat.Notifier{}, Complete: true, Name: "ChatNotifier"},
+		&inject.Object{Value: &handler.ForgotPasswordSettings{}, Complete: true, Name: "ForgotPasswordSettings"},
+		&inject.Object{Value: &handler.QuerySettings{}, Complete: true, Name: "QuerySettings"},
+	)
+	if injectErr != nil {
+		panic(fmt.Sprintf("Unable to set up handler: %v", injectErr))
+	}
+
+	injector := router.HandlerInjector{
+		ServiceGraph:    g,
+		PreprocessorMap: &preprocessorRegistry,
+	}
+
+	r := s.Router
+	r.Map("", &handler.HomeHandler{})
+	r.Map("auth:signup", injector.Inject(&handler.SignupHandler{}))
+	r.Map("auth:login", injector.Inject(&handler.LoginHandler{}))
+	r.Map("auth:logout", injector.Inject(&handler.LogoutHandler{}))
+	r.Map("auth:refresh", injector.Inject(&handler.RefreshHandler{}))
+	r.Map("auth:password", injector.Inject(&handler.PasswordHandler{}))
+
+	r.Map("asset:put", injector.Inject(&handler.AssetUploadHandler{}))
+	r.Map("asset:status", injector.Inject(&handler.AssetStatusHandler{}))
+
+	r.Map("record:fetch", injector.Inject(&handler.RecordFetchHandler{}))
+	r.Map("record:query", injector.Inject(&handler.RecordQueryHandler{}))
+	r.Map("record:save", injector.Inject(&handler.RecordSaveHandler{}))
+	r.Map("record:delete", injector.Inject(&handler.RecordDeleteHandler{}))
+
+	r.Map("device:register", injector.Inject(&handler.DeviceRegisterHandler{}))
+	r.Map("device:unregister", injector.Inject(&handler.DeviceUnregisterHandler{}))
+	r.Map("device:list", injector.Inject(&handler.DeviceListHandler{}))
+
+	r.Map("subscription:fetch_all", injector.Inject(&handler.SubscriptionFetchAllHandler{}))
+	r.Map("subscription:fetch", injector.Inject(&handler.SubscriptionFetchHandler{}))
+	r.Map("subscription:save", injector.Inject(&handler.SubscriptionSaveHandler{}))
+	r.Map("subscription:delete", injector.Inject(&handler.SubscriptionDeleteHandler{}))
+
+	r.Map("relation:query", injector.Inject(&handler.RelationQueryHandler{}))
+	r.Map("relation:add", injector.Inject(&handler.RelationAddHandler{}))
+	r.Map("relation:remove", injector.Inject(&handler.RelationRemoveHandler{}))
+
+	r.Map("me", injector.Inject(&handler.MeHandler{}))
+
+	r.Map("user:query", injector.Inject(&handler.UserQueryHandler{}))
+	r.Map("user:update", injector.Inject(&handler.UserUpdateHandler{}))
+	r.Map("user:link", injector.Inject(&handler.UserLinkHandler{}))
+
+	r.Map("role:default", injector.Inject(&handler.RoleDefaultHandler{}))
+	r.Map("role:admin", injector.Inject(&handler.RoleAdminHandler{}))
+	r.Map("role:assign", injector.Inject(&handler.RoleAssignHandler{}))
+	r.Map("role:revoke", injector.Inject(&handler.RoleRevokeHandler{}))
+
+	r.Map("push:user", injector.Inject(&handler.PushToUserHandler{}))
+	r.Map("push:device", injector.Inject(&handler.PushToDeviceHandler{}))
+
+	r.Map("schema:rename", injector.Inject(&handler.SchemaRenameHandler{}))
+	r.Map("schema:delete", injector.Inject(&handler.SchemaDeleteHandler{}))
+	r.Map("schema:create", injector.Inject(&handler.SchemaCreateHandler{}))
+	r.Map("schema:fetch", injector.Inject(&handler.SchemaFetchHandler{}))
+	r.Map("schema:access", injector.Inject(&handler.SchemaAccessHandler{}))
+}
+
+// Close removes the data of the Server.
+func (s *Server) Close() {
+	memory.Drop(AppName, s.option)
+}
+
+// POST sends body to the Router with the API key of the Server and the
+// optional access token. The action is specified in body.
+func (s *Server) POST(body string, accessToken ...string) *httptest.ResponseRecorder {
+	return s.post(APIKey, body, accessToken)
+}
+
+// MasterPOST is same as POST except that the master key is used.
+func (s *Server) MasterPOST(body string, accessToken ...string) *httptest.ResponseRecorder {
+	return s.post(MasterKey, body, accessToken)
+}
+
+func (s *Server) post(key string, body string, accessToken []string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Skygear-Api-Key", key)
+	if len(accessToken) > 0 {
+		req.Header.Set("X-Skygear-Access-Token", accessToken[0])
+	}
+	resp := httptest.NewRecorder()
+
+	s.Router.ServeHTTP(resp, req)
+	return resp
+}
+
+// NewUser signs up a user with username and password, and returns the
+// ID and the access token of the user.
+//
+// NewUser panics if the user cannot be signed up.
+func (s *Server) NewUser(username string, password string) (userID string, accessToken string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"action":   "auth:signup",
+		"username": username,
+		"password": password,
+	})
+	resp := s.POST(string(body))
+	if resp.Code != http.StatusOK {
+		panic(fmt.Sprintf("servertest: unable to sign up %s: %s", username, resp.Body.String()))
+	}
+
+	result := struct {
+		Result struct {
+			UserID      string `json:"user_id"`
+			AccessToken string `json:"access_token"`
+		} `json:"result"`
+	}{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		panic(fmt.Sprintf("servertest: unable to sign up %s: %v", username, err))
+	}
+	return result.Result.UserID, result.Result.AccessToken
+}
+
+// TokenStore is an authtoken.Store keeping tokens in memory. Tokens
+// never expire.
+type TokenStore struct {
+	mutex  sync.Mutex
+	tokens map[string]authtoken.Token
+}
+
+// NewTokenStore returns a TokenStore with no tokens.
+func NewTokenStore() *TokenStore {
+	return &TokenStore{
+		tokens: map[string]authtoken.Token{},
+	}
+}
+
+// NewToken creates a new token without storing it.
+func (s *TokenStore) NewToken(appName string, userInfoID string) (authtoken.Token, error) {
+	return authtoken.New(appName, userInfoID, time.Time{}), nil
+}
+
+// Get fetches the token of accessToken.
+func (s *TokenStore) Get(accessToken string, token *authtoken.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.tokens[accessToken]
+	if !ok {
+		return &authtoken.NotFoundError{AccessToken: accessToken, Err: fmt.Errorf("token not found")}
+	}
+	*token = t
+	return nil
+}
+
+// Put stores the token.
+func (s *TokenStore) Put(token *authtoken.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[token.AccessToken] = *token
+	return nil
+}
+
+// Delete removes the token of accessToken.
+func (s *TokenStore) Delete(accessToken string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tokens, accessToken)
+	return nil
+}
+
+// AssetStore is an asset.Store keeping files in memory.
+type AssetStore struct {
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+// NewAssetStore returns an AssetStore with no files.
+func NewAssetStore() *AssetStore {
+	return &AssetStore{
+		files: map[string][]byte{},
+	}
+}
+
+// GetFileReader returns a reader of the content of the named file.
+func (s *AssetStore) GetFileReader(name string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, ok := s.files[name]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// PutFileReader stores the content read from src as the named file.
+func (s *AssetStore) PutFileReader(name string, src io.Reader, length int64, contentType string) error {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.files[name] = data
+	return nil
+}
+
+// GeneratePostFileRequest returns a request to upload to the file
+// gateway.
+func (s *AssetStore) GeneratePostFileRequest(name string) (*asset.PostFileRequest, error) {
+	return &asset.PostFileRequest{
+		Action: "/files/" + name,
+	}, nil
+}
+
+// SignedURL returns an unsigned URL of the named file.
+func (s *AssetStore) SignedURL(name string) (string, error) {
+	return "http://skygear.test/files/" + name, nil
+}
+
+// IsSignatureRequired returns false.
+func (s *AssetStore) IsSignatureRequired() bool {
+	return false
+}
+
+// File returns the content of the named file, or nil if there is no
+// such file.
+func (s *AssetStore) File(name string) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.files[name]
+}
+
+// SentNotification is a notification sent with PushSender.
+type SentNotification struct {
+	Device  skydb.Device
+	Payload map[string]interface{}
+}
+
+// PushSender is a push.Sender recording the sent notifications instead
+// of sending them.
+type PushSender struct {
+	mutex         sync.Mutex
+	notifications []SentNotification
+}
+
+// Send records the notification.
+func (s *PushSender) Send(m push.Mapper, device skydb.Device) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.notifications = append(s.notifications, SentNotification{
+		Device:  device,
+		Payload: m.Map(),
+	})
+	return nil
+}
+
+// Notifications returns the notifications sent so far.
+func (s *PushSender) Notifications() []SentNotification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]SentNotification{}, s.notifications...)
+}
+
+var (
+	_ authtoken.Store = &TokenStore{}
+	_ asset.Store     = &AssetStore{}
+	_ asset.URLSigner = &AssetStore{}
+	_ push.Sender     = &PushSender{}
+)
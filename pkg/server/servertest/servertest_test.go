@@ -0,0 +1,83 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servertest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServer(t *testing.T) {
+	Convey("Server", t, func() {
+		s := NewServer()
+		defer s.Close()
+
+		userID, accessToken := s.NewUser("john", "secret")
+
+		Convey("signs up a user", func() {
+			So(userID, ShouldNotBeEmpty)
+			So(accessToken, ShouldNotBeEmpty)
+
+			userinfo := skydb.UserInfo{}
+			So(s.Conn.GetUser(context.Background(), userID, &userinfo), ShouldBeNil)
+			So(userinfo.Username, ShouldEqual, "john")
+		})
+
+		Convey("rejects request without access token", func() {
+			resp := s.POST(`{"action": "me"}`)
+			So(resp.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("saves and queries records", func() {
+			resp := s.POST(`{
+				"action": "record:save",
+				"records": [{"_id": "note/note1", "content": "hello"}]
+			}`, accessToken)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+
+			record := skydb.Record{}
+			So(s.Conn.PublicDB().Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldBeNil)
+			So(record.OwnerID, ShouldEqual, userID)
+			So(record.Data["content"], ShouldEqual, "hello")
+
+			resp = s.POST(`{
+				"action": "record:query",
+				"record_type": "note",
+				"predicate": ["eq", {"$type": "keypath", "$val": "content"}, "hello"]
+			}`, accessToken)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+
+			result := struct {
+				Result []map[string]interface{} `json:"result"`
+			}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &result), ShouldBeNil)
+			So(len(result.Result), ShouldEqual, 1)
+			So(result.Result[0]["_id"], ShouldEqual, "note/note1")
+		})
+
+		Convey("does not share data with other servers", func() {
+			other := NewServer()
+			defer other.Close()
+
+			userinfo := skydb.UserInfo{}
+			So(other.Conn.GetUser(context.Background(), userID, &userinfo), ShouldEqual, skydb.ErrUserNotFound)
+		})
+	})
+}
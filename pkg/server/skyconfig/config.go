@@ -15,10 +15,13 @@
 package skyconfig
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -47,6 +50,30 @@ type PluginConfig struct {
 	Args      []string
 }
 
+// AppConfig configures an app served in addition to the app of App.
+// Its database schema is derived from its name like the schema of the
+// default app. Its token store has the implementation and expiry of
+// the default token store.
+type AppConfig struct {
+	Name             string
+	APIKey           string
+	MasterKey        string
+	TokenStorePath   string
+	TokenStorePrefix string
+	TokenStoreSecret string
+	// AssetPrefix is prepended to the names of the assets uploaded to
+	// the app, so that apps sharing an asset store do not share assets.
+	AssetPrefix string
+	// DBOption, if set, is the connection string of the database of the
+	// app instead of DB.Option. It is also used for migrations.
+	DBOption string
+	// DBMaxOpenConns and DBMaxIdleConns, if not zero, limit the pool of
+	// connections of the app instead of DB.MaxOpenConns and
+	// DB.MaxIdleConns.
+	DBMaxOpenConns int
+	DBMaxIdleConns int
+}
+
 // Configuration is Skygear's configuration
 // The configuration will load in following order:
 // 1. The ENV
@@ -55,6 +82,24 @@ type PluginConfig struct {
 type Configuration struct {
 	HTTP struct {
 		Host string `json:"host"`
+		// ShutdownTimeout is the number of seconds to wait for requests
+		// in progress and queued push notifications on shutdown.
+		ShutdownTimeout int `json:"shutdown_timeout"`
+		// MaxBodySize is the maximum number of bytes of a request body
+		// on the public listener. Zero means unlimited.
+		MaxBodySize int64 `json:"max_body_size"`
+		// InternalHost, if not empty, is the address of the internal
+		// listener, which only serves requests with master key, such as
+		// those of plugins. The public listener then rejects them.
+		InternalHost string `json:"internal_host"`
+		// InternalMaxBodySize is the maximum number of bytes of a request
+		// body on the internal listener. Zero means unlimited.
+		InternalMaxBodySize int64 `json:"internal_max_body_size"`
+		// Gzip is whether JSON responses are compressed with gzip for
+		// clients accepting it. Responses smaller than GzipMinSize
+		// bytes are not compressed.
+		Gzip        bool `json:"gzip"`
+		GzipMinSize int  `json:"gzip_min_size"`
 	} `json:"http"`
 	App struct {
 		Name            string `json:"name"`
@@ -65,10 +110,32 @@ type Configuration struct {
 		CORSHost        string `json:"cors_host"`
 		Slave           bool   `json:"slave"`
 		ResponseTimeout int64  `json:"response_timeout"`
+		IDStrategy      string `json:"id_strategy"`
+		// CORSMethods and CORSHeaders are the methods and headers
+		// allowed in CORS preflight requests. If empty, the requested
+		// ones are allowed.
+		CORSMethods []string `json:"cors_methods"`
+		CORSHeaders []string `json:"cors_headers"`
 	} `json:"app"`
+	// Apps are the apps served in addition to the app of App, by the
+	// prefix of their environment variables. A request is served by
+	// the app of its API key, or else the app of its access token. Its
+	// X-Skygear-App header, if any, must name the same app.
+	Apps map[string]*AppConfig `json:"-"`
+	// DB configures the database. DDLOption, if set, holds the
+	// credentials used for migrations and schema changes, while Option
+	// is used for the rest and must not be allowed to change the schema.
+	// The connections are pooled across requests, with at most
+	// MaxOpenConns open and MaxIdleConns kept idle, each reused for at
+	// most ConnMaxLifetime seconds. Zero means unlimited, except for
+	// MaxIdleConns.
 	DB struct {
-		ImplName string `json:"implementation"`
-		Option   string `json:"option"`
+		ImplName        string `json:"implementation"`
+		Option          string `json:"option"`
+		DDLOption       string `json:"ddl_option"`
+		MaxOpenConns    int    `json:"max_open_conns"`
+		MaxIdleConns    int    `json:"max_idle_conns"`
+		ConnMaxLifetime int64  `json:"conn_max_lifetime"`
 	} `json:"database"`
 	TokenStore struct {
 		ImplName string `json:"implementation"`
@@ -76,6 +143,14 @@ type Configuration struct {
 		Prefix   string `json:"prefix"`
 		Expiry   int64  `json:"expiry"`
 		Secret   string `json:"secret"`
+		// PreviousSecrets are the secrets used before TOKEN_STORE_SECRET
+		// is rotated, whose tokens are accepted by the jwt token store
+		// until they expire.
+		PreviousSecrets []string `json:"previous_secrets"`
+		// RefreshWindow is the number of seconds before expiry within
+		// which auth:refresh exchanges a token for a new one. Zero
+		// allows a token to be exchanged any time.
+		RefreshWindow int64 `json:"refresh_window"`
 	} `json:"-"`
 	AssetStore struct {
 		ImplName string `json:"implementation"`
@@ -101,7 +176,23 @@ type Configuration struct {
 			PublicPrefix  string `json:"public_prefix"`
 			PrivatePrefix string `json:"private_prefix"`
 		} `json:"cloud"`
+
+		GCSStore struct {
+			Bucket string `json:"bucket"`
+			// CredentialsPath is the path of the service account key
+			// file used for signing requests to Google Cloud Storage.
+			CredentialsPath string `json:"credentials_path"`
+			URLPrefix       string `json:"url_prefix"`
+		} `json:"gcs"`
 	} `json:"asset_store"`
+	// AssetHeaders are headers of files served at /files/ by content
+	// type. Keys are a content type such as image/png, a wildcard such as
+	// image/* or * for any content type.
+	AssetHeaders struct {
+		CacheControl       map[string]string `json:"cache_control"`
+		ContentDisposition map[string]string `json:"content_disposition"`
+		AllowOrigin        map[string]string `json:"allow_origin"`
+	} `json:"asset_headers"`
 	APNS struct {
 		Enable bool   `json:"enable"`
 		Type   string `json:"type"`
@@ -121,14 +212,54 @@ type Configuration struct {
 			KeyPath string `json:"-"`
 		} `json:"token_config"`
 	} `json:"apns"`
+	// GCM configures sending notifications to Android devices via the
+	// FCM HTTP v1 API.
 	GCM struct {
-		Enable bool   `json:"enable"`
-		APIKey string `json:"api_key"`
+		Enable bool `json:"enable"`
+		// CredentialsPath is the path of the service account key file
+		// of the Firebase project.
+		CredentialsPath string `json:"credentials_path"`
+		// ProjectID overrides the project of the service account.
+		ProjectID string `json:"project_id"`
 	} `json:"gcm"`
+	// Push lists the dot-separated key paths of the string fields of APNS
+	// and GCM payloads truncated, in order, when a notification exceeds
+	// the payload size limit of the gateway. Access is who can send
+	// notifications with push:user and push:device, which is one of key,
+	// user or master.
+	Push struct {
+		TrimFields []string `json:"trim_fields"`
+		Access     string   `json:"access"`
+	} `json:"push"`
+	// WorkQueue configures the number of workers of each priority class,
+	// i.e. critical, normal and bulk, of the queues sending push
+	// notifications and executing asynchronous hooks. Classes not listed
+	// get the default number of workers.
+	//
+	// If AsyncAfterSaveHooks is true, afterSave hooks of plugins are
+	// executed in the hook queue after the response instead of before
+	// it. A failed asynchronous hook is run up to HookMaxAttempts times,
+	// waiting HookRetryBackoff milliseconds before the first retry and
+	// twice as long before each subsequent one. Each attempt is cancelled
+	// after HookTimeout milliseconds.
+	//
+	// Asynchronous hooks are delivered on a best-effort basis. The queues
+	// are kept in memory, so hooks not yet run are lost on restart.
+	WorkQueue struct {
+		PushConcurrency     map[string]int `json:"push_concurrency"`
+		HookConcurrency     map[string]int `json:"hook_concurrency"`
+		AsyncAfterSaveHooks bool           `json:"async_after_save_hooks"`
+		HookMaxAttempts     int            `json:"hook_max_attempts"`
+		HookRetryBackoff    int            `json:"hook_retry_backoff"`
+		HookTimeout         int            `json:"hook_timeout"`
+	} `json:"work_queue"`
 	LOG struct {
-		Level           string            `json:"-"`
-		LoggersLevel    map[string]string `json:"-"`
-		RouterByteLimit int64             `json:"-"`
+		Level             string            `json:"-"`
+		LoggersLevel      map[string]string `json:"-"`
+		RouterByteLimit   int64             `json:"-"`
+		PluginStdoutLevel string            `json:"-"`
+		PluginStderrLevel string            `json:"-"`
+		Format            string            `json:"-"`
 	} `json:"log"`
 	LogHook struct {
 		SentryDSN   string
@@ -137,20 +268,232 @@ type Configuration struct {
 	Zmq struct {
 		Timeout int `json:"timeout"`
 	} `json:"zmq"`
-	Plugin map[string]*PluginConfig `json:"-"`
+	Exec struct {
+		HeartbeatTimeout int `json:"heartbeat_timeout"`
+	} `json:"exec"`
+	// PluginHandler limits the requests to the HTTP handlers registered
+	// by plugins before they are forwarded to the plugin. A handler can
+	// lower MaxBodySize and narrow ContentTypes in its registration.
+	// InspectorLambda names a plugin lambda called to inspect each
+	// request within the limits.
+	PluginHandler struct {
+		MaxBodySize     int64    `json:"max_body_size"`
+		ContentTypes    []string `json:"content_types"`
+		InspectorLambda string   `json:"inspector_lambda"`
+	} `json:"plugin_handler"`
+	Plugin     map[string]*PluginConfig `json:"-"`
+	Moderation struct {
+		Enable            bool                `json:"enable"`
+		Fields            map[string][]string `json:"fields"`
+		StatusKey         string              `json:"status_key"`
+		Keywords          []string            `json:"keywords"`
+		KeywordVerdict    string              `json:"keyword_verdict"`
+		APIURL            string              `json:"api_url"`
+		AssetContentTypes []string            `json:"asset_content_types"`
+	} `json:"moderation"`
+	Metrics struct {
+		Enable bool   `json:"enable"`
+		Path   string `json:"path"`
+		// AppLabel adds the app name as a label of every series, so that
+		// servers of different apps can share a Prometheus.
+		AppLabel bool `json:"app_label"`
+		// MaxSeries limits the number of series of each metric, as
+		// labels such as record types are supplied by clients.
+		MaxSeries int `json:"max_series"`
+	} `json:"metrics"`
+	GeoIP struct {
+		DBPath     string `json:"db_path"`
+		TrustProxy bool   `json:"trust_proxy"`
+	} `json:"geoip"`
+	// Quota limits the private database of each user. Zero means unlimited.
+	Quota struct {
+		PrivateRecordCount uint64 `json:"private_record_count"`
+		PrivateStorageSize uint64 `json:"private_storage_size"`
+	} `json:"quota"`
+	// Idempotency replays the responses of requests to Actions carrying
+	// an idempotency key for Retention seconds.
+	Idempotency struct {
+		Actions   []string `json:"actions"`
+		Retention int64    `json:"retention"`
+	} `json:"idempotency"`
+	// ResponseCache caches the responses of Actions for TTL seconds, and
+	// drops them on successful requests to InvalidatingActions.
+	ResponseCache struct {
+		Actions             []string `json:"actions"`
+		InvalidatingActions []string `json:"invalidating_actions"`
+		TTL                 int64    `json:"ttl"`
+		MaxEntries          int      `json:"max_entries"`
+	} `json:"response_cache"`
+	// Maintenance sets the maintenance mode the server starts in, which
+	// can be changed at runtime with maintenance:set.
+	Maintenance struct {
+		Mode        string   `json:"mode"`
+		Message     string   `json:"message"`
+		ReadActions []string `json:"read_actions"`
+	} `json:"maintenance"`
+	// Outbound configures requests to external services, such as the S3
+	// asset store, push gateways, the moderation API and identity
+	// providers. Timeout is in seconds, zero means no timeout.
+	Outbound struct {
+		ProxyURL string   `json:"proxy_url"`
+		NoProxy  []string `json:"no_proxy"`
+		CABundle string   `json:"ca_bundle"`
+		Timeout  int      `json:"timeout"`
+	} `json:"outbound"`
+	// Throttle limits the records of each type a user can write per
+	// minute. Record types not listed are unlimited.
+	Throttle struct {
+		RecordWritesPerMinute map[string]int `json:"record_writes_per_minute"`
+	} `json:"throttle"`
+	// RecordID checks the keys clients supply for new records. Format is
+	// any or uuid, checked after the prefix of the record type in
+	// Prefixes. Keys of ServerGenerated record types cannot be supplied
+	// and are generated by the server.
+	RecordID struct {
+		Format          string            `json:"format"`
+		Prefixes        map[string]string `json:"prefixes"`
+		ServerGenerated []string          `json:"server_generated"`
+	} `json:"record_id"`
+	// Concurrency limits the requests of each access token, or API key for
+	// requests without one, handled at the same time. Excess requests wait
+	// up to QueueTimeout milliseconds for an earlier request to finish.
+	// Zero MaxInFlight means no limit.
+	Concurrency struct {
+		MaxInFlight  int `json:"max_in_flight"`
+		QueueTimeout int `json:"queue_timeout"`
+	} `json:"concurrency"`
+	// RateLimit limits the requests per minute of each client IP address
+	// and of each API key, except those on the internal listener. Zero
+	// means no limit.
+	RateLimit struct {
+		PerIP     int `json:"per_ip"`
+		PerAPIKey int `json:"per_api_key"`
+	} `json:"rate_limit"`
+	// Query limits the number of levels of references an include key path
+	// of record:query can expand.
+	Query struct {
+		MaxIncludeDepth int `json:"max_include_depth"`
+	} `json:"query"`
+	// ResponseFilter hides fields from responses to client key requests.
+	ResponseFilter struct {
+		RecordFields map[string][]string `json:"record_fields"`
+		UserFields   []string            `json:"user_fields"`
+		ExemptRoles  []string            `json:"exempt_roles"`
+	} `json:"response_filter"`
+	// AuthProvider configures the built-in auth providers verifying
+	// tokens of identity providers. Apple and Google are enabled if their
+	// audiences are set, and Facebook if its app ID is set.
+	AuthProvider struct {
+		AppleAudiences    []string `json:"apple_audiences"`
+		GoogleAudiences   []string `json:"google_audiences"`
+		FacebookAppID     string   `json:"facebook_app_id"`
+		FacebookAppSecret string   `json:"facebook_app_secret"`
+	} `json:"auth_provider"`
+	// Captcha requires a CAPTCHA on auth:signup and auth:forgot_password
+	// from clients making more
+	// than FreeAttemptsPerHour attempts. Provider is one of recaptcha,
+	// hcaptcha and plugin, or empty to disable CAPTCHA. The plugin
+	// provider verifies tokens with the plugin lambda PluginLambda.
+	Captcha struct {
+		Provider            string `json:"provider"`
+		Secret              string `json:"secret"`
+		PluginLambda        string `json:"plugin_lambda"`
+		FreeAttemptsPerHour int    `json:"free_attempts_per_hour"`
+	} `json:"captcha"`
+	// Anonymous restricts anonymous users, and purges those inactive
+	// for PurgeInactiveDays if it is not zero.
+	Anonymous struct {
+		AllowedActions    []string `json:"allowed_actions"`
+		RecordTypes       []string `json:"record_types"`
+		WritesPerMinute   int      `json:"writes_per_minute"`
+		PurgeInactiveDays int      `json:"purge_inactive_days"`
+		PurgeSchedule     string   `json:"purge_schedule"`
+	} `json:"anonymous"`
+	Stats struct {
+		Enable         bool   `json:"enable"`
+		RollupSchedule string `json:"rollup_schedule"`
+	} `json:"stats"`
+	Chat struct {
+		Enable bool `json:"enable"`
+	} `json:"chat"`
+	// ScheduledMutation runs record changes scheduled with
+	// record:schedule when they are due, checking on RunSchedule.
+	ScheduledMutation struct {
+		Enable      bool   `json:"enable"`
+		RunSchedule string `json:"run_schedule"`
+	} `json:"scheduled_mutation"`
+	// Retention removes records older than the rule of their record type,
+	// checking on RunSchedule. Predicates are raw query predicates by
+	// record type limiting which expired records are removed. If
+	// ArchiveInDB is true, archived records are kept in the archive table
+	// of the database.
+	Retention struct {
+		Enable      bool                     `json:"enable"`
+		RunSchedule string                   `json:"run_schedule"`
+		DryRun      bool                     `json:"dry_run"`
+		ArchiveInDB bool                     `json:"archive_in_db"`
+		Rules       []RetentionRule          `json:"rules"`
+		Predicates  map[string][]interface{} `json:"predicates"`
+	} `json:"retention"`
+	// SMTP is the mail server emails are sent through, which is
+	// disabled if Host is empty.
+	SMTP struct {
+		Host     string `json:"host"`
+		Port     int    `json:"port"`
+		Login    string `json:"login"`
+		Password string `json:"password"`
+		Sender   string `json:"sender"`
+	} `json:"smtp"`
+	// ForgotPassword configures the emails of auth:forgot_password, which
+	// requires SMTP. The email body is read from TemplatePath, or a
+	// built-in template if empty. CodeExpiry is in seconds.
+	ForgotPassword struct {
+		Subject      string `json:"subject"`
+		TemplatePath string `json:"template_path"`
+		CodeExpiry   int    `json:"code_expiry"`
+	} `json:"forgot_password"`
+	// PubSub decides who may subscribe and publish on channels of the
+	// public pubsub endpoint. Rules are matched by channel pattern in
+	// order, falling back to Subscribe and Publish. Access is one of
+	// none, key, user or master.
+	PubSub struct {
+		Subscribe string       `json:"subscribe"`
+		Publish   string       `json:"publish"`
+		Rules     []PubSubRule `json:"rules"`
+	} `json:"pubsub"`
+}
+
+// PubSubRule sets the access of pubsub channels matching Pattern.
+type PubSubRule struct {
+	Pattern   string `json:"pattern"`
+	Subscribe string `json:"subscribe"`
+	Publish   string `json:"publish"`
+}
+
+// RetentionRule removes records of RecordType created more than Days ago.
+// Action is either delete or archive.
+type RetentionRule struct {
+	RecordType string `json:"record_type"`
+	Days       int    `json:"days"`
+	Action     string `json:"action"`
 }
 
 func NewConfiguration() Configuration {
 	config := Configuration{}
 	config.HTTP.Host = ":3000"
+	config.HTTP.ShutdownTimeout = 30
+	config.HTTP.GzipMinSize = 1024
 	config.App.Name = "myapp"
 	config.App.AccessControl = "role"
 	config.App.DevMode = true
 	config.App.CORSHost = "*"
 	config.App.Slave = false
 	config.App.ResponseTimeout = 60
+	config.App.IDStrategy = "uuid"
 	config.DB.ImplName = "pq"
 	config.DB.Option = "postgres://postgres:@localhost/postgres?sslmode=disable"
+	config.DB.MaxOpenConns = 10
+	config.DB.MaxIdleConns = 2
 	config.TokenStore.ImplName = "fs"
 	config.TokenStore.Path = "data/token"
 	config.TokenStore.Expiry = 0
@@ -160,15 +503,83 @@ func NewConfiguration() Configuration {
 	config.APNS.Enable = false
 	config.APNS.Type = "cert"
 	config.APNS.Env = "sandbox"
+	config.Push.Access = "key"
 	config.GCM.Enable = false
+	config.Push.TrimFields = []string{"aps.alert.body", "aps.alert", "notification.body"}
+	config.WorkQueue.HookMaxAttempts = 3
+	config.WorkQueue.HookRetryBackoff = 1000
+	config.WorkQueue.HookTimeout = 30000
+	config.Stats.RollupSchedule = "@hourly"
+	config.Anonymous.PurgeSchedule = "@daily"
+	config.Captcha.PluginLambda = "captcha:verify"
+	config.Captcha.FreeAttemptsPerHour = 3
+	config.ScheduledMutation.RunSchedule = "@every 1m"
+	config.Retention.RunSchedule = "@daily"
+	config.SMTP.Port = 25
+	config.ForgotPassword.Subject = "Reset your password"
+	config.ForgotPassword.CodeExpiry = 3600
+	config.PubSub.Subscribe = "key"
+	config.PubSub.Publish = "user"
+	config.Query.MaxIncludeDepth = 3
+	config.Idempotency.Actions = []string{
+		"auth:signup",
+		"record:save",
+		"record:delete",
+		"push:user",
+		"push:device",
+	}
+	config.Idempotency.Retention = 86400
+	config.ResponseCache.InvalidatingActions = []string{
+		"auth:signup",
+		"asset:put",
+		"record:save",
+		"record:delete",
+		"record:sync",
+		"moderation:approve",
+		"moderation:reject",
+		"relation:add",
+		"relation:remove",
+		"chat:create_conversation",
+		"chat:add_participants",
+		"chat:remove_participants",
+		"chat:send_message",
+		"chat:mark_as_read",
+		"user:update",
+		"user:link",
+		"role:default",
+		"role:admin",
+		"role:assign",
+		"role:revoke",
+		"schema:rename",
+		"schema:delete",
+		"schema:create",
+		"schema:access",
+		"schema:apply",
+	}
+	config.ResponseCache.TTL = 60
+	config.ResponseCache.MaxEntries = 10000
 	config.LOG.Level = "debug"
 	config.LOG.LoggersLevel = map[string]string{
 		"plugin": "info",
 	}
 	config.LOG.RouterByteLimit = 100000
+	config.LOG.PluginStdoutLevel = "info"
+	config.LOG.PluginStderrLevel = "warning"
+	config.LOG.Format = "text"
 	config.LogHook.SentryLevel = "error"
 	config.Zmq.Timeout = 30
+	config.Exec.HeartbeatTimeout = 30
+	config.PluginHandler.MaxBodySize = 10 * 1024 * 1024
 	config.Plugin = map[string]*PluginConfig{}
+	config.Apps = map[string]*AppConfig{}
+	config.Moderation.Enable = false
+	config.Moderation.Fields = map[string][]string{}
+	config.Moderation.StatusKey = "moderation_status"
+	config.Moderation.KeywordVerdict = "pending"
+	config.Metrics.Enable = false
+	config.Metrics.Path = "/metrics"
+	config.Metrics.AppLabel = true
+	config.Metrics.MaxSeries = 1000
 	return config
 }
 
@@ -192,12 +603,141 @@ func (config *Configuration) Validate() error {
 	if !regexp.MustCompile("^[A-Za-z0-9_]+$").MatchString(config.App.Name) {
 		return fmt.Errorf("APP_NAME '%s' contains invalid characters other than alphanumerics or underscores", config.App.Name)
 	}
+	if err := config.validateApps(); err != nil {
+		return err
+	}
 	if config.APNS.Enable && !regexp.MustCompile("^(sandbox|production)$").MatchString(config.APNS.Env) {
 		return fmt.Errorf("APNS_ENV must be sandbox or production")
 	}
 	if config.APNS.Enable && !regexp.MustCompile("^(cert|token)$").MatchString(config.APNS.Type) {
 		return fmt.Errorf("APNS_TYPE must be cert or token")
 	}
+	if config.GCM.Enable && config.GCM.CredentialsPath == "" {
+		return fmt.Errorf("GCM_CREDENTIALS_PATH must be set when GCM is enabled")
+	}
+	if config.Moderation.Enable && !regexp.MustCompile("^(pending|rejected)$").MatchString(config.Moderation.KeywordVerdict) {
+		return fmt.Errorf("MODERATION_KEYWORD_VERDICT must be pending or rejected")
+	}
+	if config.Metrics.Enable && !strings.HasPrefix(config.Metrics.Path, "/") {
+		return fmt.Errorf("METRICS_PATH must start with /")
+	}
+	if config.DB.MaxOpenConns < 0 || config.DB.MaxIdleConns < 0 || config.DB.ConnMaxLifetime < 0 {
+		return fmt.Errorf("DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME must not be negative")
+	}
+	if config.HTTP.ShutdownTimeout < 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must not be negative")
+	}
+	if config.HTTP.MaxBodySize < 0 {
+		return fmt.Errorf("MAX_BODY_SIZE must not be negative")
+	}
+	if config.HTTP.InternalMaxBodySize < 0 {
+		return fmt.Errorf("INTERNAL_MAX_BODY_SIZE must not be negative")
+	}
+	if config.HTTP.GzipMinSize < 0 {
+		return fmt.Errorf("GZIP_MIN_SIZE must not be negative")
+	}
+	if config.HTTP.InternalHost != "" && config.HTTP.InternalHost == config.HTTP.Host {
+		return fmt.Errorf("INTERNAL_HOST must be different from HOST")
+	}
+	if !regexp.MustCompile("^(key|user|master)$").MatchString(config.Push.Access) {
+		return fmt.Errorf("PUSH_ACCESS must be key, user or master")
+	}
+	if !regexp.MustCompile("^(text|json)$").MatchString(config.LOG.Format) {
+		return fmt.Errorf("LOG_FORMAT must be text or json")
+	}
+	if !regexp.MustCompile("^(|any|uuid)$").MatchString(config.RecordID.Format) {
+		return fmt.Errorf("RECORD_ID_FORMAT must be any or uuid")
+	}
+	if config.Metrics.MaxSeries < 0 {
+		return fmt.Errorf("METRICS_MAX_SERIES must not be negative")
+	}
+	for _, rule := range config.Retention.Rules {
+		if rule.Days <= 0 {
+			return fmt.Errorf("RETENTION_RULES must have positive days for %s", rule.RecordType)
+		}
+		if !regexp.MustCompile("^(delete|archive)$").MatchString(rule.Action) {
+			return fmt.Errorf("RETENTION_RULES action must be delete or archive for %s", rule.RecordType)
+		}
+	}
+	if config.AssetStore.ImplName == "gcs" && (config.AssetStore.GCSStore.Bucket == "" || config.AssetStore.GCSStore.CredentialsPath == "") {
+		return fmt.Errorf("GCS_ASSET_BUCKET and GCS_ASSET_CREDENTIALS_PATH must be set for gcs asset store")
+	}
+	pubSubAccess := regexp.MustCompile("^(none|key|user|master)$")
+	if !pubSubAccess.MatchString(config.PubSub.Subscribe) || !pubSubAccess.MatchString(config.PubSub.Publish) {
+		return fmt.Errorf("PUBSUB_SUBSCRIBE and PUBSUB_PUBLISH must be none, key, user or master")
+	}
+	for _, rule := range config.PubSub.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("PUBSUB_RULES has malformed channel pattern %q", rule.Pattern)
+		}
+		if !pubSubAccess.MatchString(rule.Subscribe) || !pubSubAccess.MatchString(rule.Publish) {
+			return fmt.Errorf("PUBSUB_RULES access must be none, key, user or master for %s", rule.Pattern)
+		}
+	}
+	if !regexp.MustCompile("^(|off|read_only|full)$").MatchString(config.Maintenance.Mode) {
+		return fmt.Errorf("MAINTENANCE_MODE must be off, read_only or full")
+	}
+	if !regexp.MustCompile("^(|recaptcha|hcaptcha|plugin)$").MatchString(config.Captcha.Provider) {
+		return fmt.Errorf("CAPTCHA_PROVIDER must be recaptcha, hcaptcha or plugin")
+	}
+	if (config.Captcha.Provider == "recaptcha" || config.Captcha.Provider == "hcaptcha") && config.Captcha.Secret == "" {
+		return fmt.Errorf("CAPTCHA_SECRET is required for CAPTCHA_PROVIDER %s", config.Captcha.Provider)
+	}
+	if config.AuthProvider.FacebookAppID != "" && config.AuthProvider.FacebookAppSecret == "" {
+		return fmt.Errorf("AUTH_PROVIDER_FACEBOOK_APP_SECRET is required if AUTH_PROVIDER_FACEBOOK_APP_ID is set")
+	}
+	if config.SMTP.Host != "" && config.SMTP.Sender == "" {
+		return fmt.Errorf("SMTP_SENDER is required if SMTP_HOST is set")
+	}
+	if config.ForgotPassword.CodeExpiry <= 0 {
+		return fmt.Errorf("FORGOT_PASSWORD_CODE_EXPIRY must be positive")
+	}
+	if err := validateQueueConcurrency("PUSH_QUEUE_CONCURRENCY", config.WorkQueue.PushConcurrency); err != nil {
+		return err
+	}
+	if err := validateQueueConcurrency("HOOK_QUEUE_CONCURRENCY", config.WorkQueue.HookConcurrency); err != nil {
+		return err
+	}
+	if config.WorkQueue.HookMaxAttempts <= 0 {
+		return fmt.Errorf("HOOK_MAX_ATTEMPTS must be positive")
+	}
+	if config.WorkQueue.HookRetryBackoff < 0 {
+		return fmt.Errorf("HOOK_RETRY_BACKOFF must not be negative")
+	}
+	if config.WorkQueue.HookTimeout <= 0 {
+		return fmt.Errorf("HOOK_TIMEOUT must be positive")
+	}
+	if config.Concurrency.MaxInFlight < 0 {
+		return fmt.Errorf("CONCURRENCY_MAX_IN_FLIGHT must not be negative")
+	}
+	if config.Concurrency.QueueTimeout < 0 {
+		return fmt.Errorf("CONCURRENCY_QUEUE_TIMEOUT must not be negative")
+	}
+	if config.RateLimit.PerIP < 0 || config.RateLimit.PerAPIKey < 0 {
+		return fmt.Errorf("RATE_LIMIT_PER_IP and RATE_LIMIT_PER_API_KEY must not be negative")
+	}
+	if config.TokenStore.RefreshWindow < 0 {
+		return fmt.Errorf("TOKEN_STORE_REFRESH_WINDOW must not be negative")
+	}
+	if config.PluginHandler.MaxBodySize < 0 {
+		return fmt.Errorf("PLUGIN_HANDLER_MAX_BODY_SIZE must not be negative")
+	}
+	if config.Query.MaxIncludeDepth <= 0 {
+		return fmt.Errorf("QUERY_MAX_INCLUDE_DEPTH must be positive")
+	}
+	if config.Outbound.ProxyURL != "" {
+		if proxyURL, err := url.Parse(config.Outbound.ProxyURL); err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("OUTBOUND_PROXY must be a URL such as http://proxy.example.com:3128")
+		}
+	}
+	if config.Outbound.Timeout < 0 {
+		return fmt.Errorf("OUTBOUND_TIMEOUT must not be negative")
+	}
+	for _, disposition := range config.AssetHeaders.ContentDisposition {
+		if disposition != "inline" && disposition != "attachment" {
+			return fmt.Errorf("ASSET_CONTENT_DISPOSITION must be inline or attachment")
+		}
+	}
 	return nil
 }
 
@@ -224,10 +764,7 @@ func (config *Configuration) ReadFromEnv() {
 		config.App.Name = appName
 	}
 
-	corsHost := os.Getenv("CORS_HOST")
-	if corsHost != "" {
-		config.App.CORSHost = corsHost
-	}
+	config.readCORS()
 
 	accessControl := os.Getenv("ACCESS_CONRTOL")
 	if accessControl != "" {
@@ -247,6 +784,22 @@ func (config *Configuration) ReadFromEnv() {
 		config.DB.Option = os.Getenv("DATABASE_URL")
 	}
 
+	if config.DB.ImplName == "pq" && os.Getenv("DATABASE_DDL_URL") != "" {
+		config.DB.DDLOption = os.Getenv("DATABASE_DDL_URL")
+	}
+
+	if maxOpenConns, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil {
+		config.DB.MaxOpenConns = maxOpenConns
+	}
+
+	if maxIdleConns, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil {
+		config.DB.MaxIdleConns = maxIdleConns
+	}
+
+	if lifetime, err := strconv.ParseInt(os.Getenv("DB_CONN_MAX_LIFETIME"), 10, 64); err == nil {
+		config.DB.ConnMaxLifetime = lifetime
+	}
+
 	if slave, err := parseBool(os.Getenv("SLAVE")); err == nil {
 		config.App.Slave = slave
 	}
@@ -255,12 +808,46 @@ func (config *Configuration) ReadFromEnv() {
 		config.App.ResponseTimeout = timeout
 	}
 
+	idStrategy := os.Getenv("ID_STRATEGY")
+	if idStrategy != "" {
+		config.App.IDStrategy = idStrategy
+	}
+
 	config.readTokenStore()
 	config.readAssetStore()
+	config.readAssetHeaders()
 	config.readAPNS()
 	config.readGCM()
+	config.readPush()
+	config.readWorkQueue()
 	config.readLog()
 	config.readPlugins()
+	config.readApps()
+	config.readPluginHandler()
+	config.readModeration()
+	config.readMetrics()
+	config.readGeoIP()
+	config.readQuota()
+	config.readIdempotency()
+	config.readResponseCache()
+	config.readMaintenance()
+	config.readOutbound()
+	config.readThrottle()
+	config.readRecordID()
+	config.readConcurrency()
+	config.readRateLimit()
+	config.readQuery()
+	config.readResponseFilter()
+	config.readStats()
+	config.readAuthProvider()
+	config.readCaptcha()
+	config.readAnonymous()
+	config.readChat()
+	config.readScheduledMutation()
+	config.readRetention()
+	config.readSMTP()
+	config.readForgotPassword()
+	config.readPubSub()
 }
 
 func (config *Configuration) readHost() {
@@ -275,6 +862,42 @@ func (config *Configuration) readHost() {
 			config.HTTP.Host = ":" + port
 		}
 	}
+
+	if timeout, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+		config.HTTP.ShutdownTimeout = timeout
+	}
+
+	if size, err := strconv.ParseInt(os.Getenv("MAX_BODY_SIZE"), 10, 64); err == nil {
+		config.HTTP.MaxBodySize = size
+	}
+	if internalHost := os.Getenv("INTERNAL_HOST"); internalHost != "" {
+		config.HTTP.InternalHost = internalHost
+	}
+	if size, err := strconv.ParseInt(os.Getenv("INTERNAL_MAX_BODY_SIZE"), 10, 64); err == nil {
+		config.HTTP.InternalMaxBodySize = size
+	}
+
+	if gzip, err := parseBool(os.Getenv("GZIP")); err == nil {
+		config.HTTP.Gzip = gzip
+	}
+	if size, err := strconv.Atoi(os.Getenv("GZIP_MIN_SIZE")); err == nil {
+		config.HTTP.GzipMinSize = size
+	}
+}
+
+func (config *Configuration) readCORS() {
+	corsHost := os.Getenv("CORS_HOST")
+	if corsHost != "" {
+		config.App.CORSHost = corsHost
+	}
+
+	if corsMethods := os.Getenv("CORS_METHODS"); corsMethods != "" {
+		config.App.CORSMethods = strings.Split(corsMethods, ",")
+	}
+
+	if corsHeaders := os.Getenv("CORS_HEADERS"); corsHeaders != "" {
+		config.App.CORSHeaders = strings.Split(corsHeaders, ",")
+	}
 }
 
 func (config *Configuration) readTokenStore() {
@@ -302,6 +925,47 @@ func (config *Configuration) readTokenStore() {
 	} else {
 		config.TokenStore.Secret = config.App.MasterKey
 	}
+
+	if window, err := strconv.ParseInt(os.Getenv("TOKEN_STORE_REFRESH_WINDOW"), 10, 64); err == nil {
+		config.TokenStore.RefreshWindow = window
+	}
+
+	previousSecrets := os.Getenv("TOKEN_STORE_PREVIOUS_SECRETS")
+	if previousSecrets != "" {
+		config.TokenStore.PreviousSecrets = strings.Split(previousSecrets, ",")
+	}
+}
+
+func (config *Configuration) readAssetHeaders() {
+	// ASSET_CACHE_CONTROL is a list of contentType=value separated by
+	// semicolons, e.g. image/*=public, max-age=86400;*=no-cache
+	if cacheControl := os.Getenv("ASSET_CACHE_CONTROL"); cacheControl != "" {
+		config.AssetHeaders.CacheControl = parseContentTypeValues(cacheControl)
+	}
+
+	// ASSET_CONTENT_DISPOSITION, e.g. image/*=inline;*=attachment
+	if disposition := os.Getenv("ASSET_CONTENT_DISPOSITION"); disposition != "" {
+		config.AssetHeaders.ContentDisposition = parseContentTypeValues(disposition)
+	}
+
+	// ASSET_ALLOW_ORIGIN, e.g. font/*=*
+	if allowOrigin := os.Getenv("ASSET_ALLOW_ORIGIN"); allowOrigin != "" {
+		config.AssetHeaders.AllowOrigin = parseContentTypeValues(allowOrigin)
+	}
+}
+
+func parseContentTypeValues(s string) map[string]string {
+	m := map[string]string{}
+	for _, typeValue := range strings.Split(s, ";") {
+		components := strings.SplitN(typeValue, "=", 2)
+		if len(components) != 2 {
+			log.Printf("Ignoring malformed content type value %q", typeValue)
+			continue
+		}
+		contentType := strings.ToLower(strings.TrimSpace(components[0]))
+		m[contentType] = strings.TrimSpace(components[1])
+	}
+	return m
 }
 
 func (config *Configuration) readAssetStore() {
@@ -367,6 +1031,20 @@ func (config *Configuration) readAssetStore() {
 	if cloudAssetPrivatePrefix != "" {
 		config.AssetStore.CloudStore.PrivatePrefix = cloudAssetPrivatePrefix
 	}
+
+	// GCS related
+	gcsAssetBucket := os.Getenv("GCS_ASSET_BUCKET")
+	if gcsAssetBucket != "" {
+		config.AssetStore.GCSStore.Bucket = gcsAssetBucket
+	}
+	gcsAssetCredentialsPath := os.Getenv("GCS_ASSET_CREDENTIALS_PATH")
+	if gcsAssetCredentialsPath != "" {
+		config.AssetStore.GCSStore.CredentialsPath = gcsAssetCredentialsPath
+	}
+	gcsAssetURLPrefix := os.Getenv("GCS_ASSET_URL_PREFIX")
+	if gcsAssetURLPrefix != "" {
+		config.AssetStore.GCSStore.URLPrefix = gcsAssetURLPrefix
+	}
 }
 
 func (config *Configuration) readAPNS() {
@@ -441,10 +1119,82 @@ func (config *Configuration) readGCM() {
 		config.GCM.Enable = shouldEnableGCM
 	}
 
-	gcmAPIKey := os.Getenv("GCM_APIKEY")
-	if gcmAPIKey != "" {
-		config.GCM.APIKey = gcmAPIKey
+	gcmCredentialsPath := os.Getenv("GCM_CREDENTIALS_PATH")
+	if gcmCredentialsPath != "" {
+		config.GCM.CredentialsPath = gcmCredentialsPath
+	}
+
+	gcmProjectID := os.Getenv("GCM_PROJECT_ID")
+	if gcmProjectID != "" {
+		config.GCM.ProjectID = gcmProjectID
+	}
+}
+
+func (config *Configuration) readPush() {
+	trimFields := os.Getenv("PUSH_TRIM_FIELDS")
+	if trimFields != "" {
+		config.Push.TrimFields = strings.Split(trimFields, ",")
+	}
+
+	if access := os.Getenv("PUSH_ACCESS"); access != "" {
+		config.Push.Access = access
+	}
+}
+
+func (config *Configuration) readWorkQueue() {
+	// PUSH_QUEUE_CONCURRENCY and HOOK_QUEUE_CONCURRENCY are lists of
+	// priority:workers, e.g. critical:4,bulk:1.
+	if concurrency := os.Getenv("PUSH_QUEUE_CONCURRENCY"); concurrency != "" {
+		config.WorkQueue.PushConcurrency = parseQueueConcurrency(concurrency)
+	}
+	if concurrency := os.Getenv("HOOK_QUEUE_CONCURRENCY"); concurrency != "" {
+		config.WorkQueue.HookConcurrency = parseQueueConcurrency(concurrency)
+	}
+
+	if async, err := parseBool(os.Getenv("HOOK_ASYNC_AFTER_SAVE")); err == nil {
+		config.WorkQueue.AsyncAfterSaveHooks = async
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("HOOK_MAX_ATTEMPTS")); err == nil {
+		config.WorkQueue.HookMaxAttempts = attempts
+	}
+	if backoff, err := strconv.Atoi(os.Getenv("HOOK_RETRY_BACKOFF")); err == nil {
+		config.WorkQueue.HookRetryBackoff = backoff
+	}
+	if timeout, err := strconv.Atoi(os.Getenv("HOOK_TIMEOUT")); err == nil {
+		config.WorkQueue.HookTimeout = timeout
+	}
+}
+
+func parseQueueConcurrency(s string) map[string]int {
+	m := map[string]int{}
+	for _, priorityWorkers := range strings.Split(s, ",") {
+		components := strings.SplitN(priorityWorkers, ":", 2)
+		if len(components) != 2 {
+			log.Printf("Ignoring malformed queue concurrency %q", priorityWorkers)
+			continue
+		}
+		workers, err := strconv.Atoi(components[1])
+		if err != nil {
+			log.Printf("Ignoring malformed queue concurrency %q", priorityWorkers)
+			continue
+		}
+		m[components[0]] = workers
+	}
+	return m
+}
+
+func validateQueueConcurrency(name string, concurrency map[string]int) error {
+	for priority, workers := range concurrency {
+		switch priority {
+		case "critical", "normal", "bulk":
+		default:
+			return fmt.Errorf("%s has unknown priority %q", name, priority)
+		}
+		if workers <= 0 {
+			return fmt.Errorf("%s of priority %s must be positive", name, priority)
+		}
 	}
+	return nil
 }
 
 func (config *Configuration) readLog() {
@@ -468,6 +1218,20 @@ func (config *Configuration) readLog() {
 		config.LOG.RouterByteLimit = byteLimit
 	}
 
+	pluginStdoutLevel := os.Getenv("LOG_PLUGIN_STDOUT")
+	if pluginStdoutLevel != "" {
+		config.LOG.PluginStdoutLevel = pluginStdoutLevel
+	}
+
+	pluginStderrLevel := os.Getenv("LOG_PLUGIN_STDERR")
+	if pluginStderrLevel != "" {
+		config.LOG.PluginStderrLevel = pluginStderrLevel
+	}
+
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.LOG.Format = format
+	}
+
 	sentry := os.Getenv("SENTRY_DSN")
 	if sentry != "" {
 		config.LogHook.SentryDSN = sentry
@@ -486,6 +1250,10 @@ func (config *Configuration) readPlugins() {
 		config.Zmq.Timeout = timeout
 	}
 
+	if heartbeatTimeout, err := strconv.Atoi(os.Getenv("EXEC_HEARTBEAT_TIMEOUT")); err == nil {
+		config.Exec.HeartbeatTimeout = heartbeatTimeout
+	}
+
 	plugin := os.Getenv("PLUGINS")
 	if plugin == "" {
 		return
@@ -503,3 +1271,562 @@ func (config *Configuration) readPlugins() {
 		config.Plugin[p] = pluginConfig
 	}
 }
+
+func (config *Configuration) readApps() {
+	apps := os.Getenv("APPS")
+	if apps == "" {
+		return
+	}
+
+	for _, a := range strings.Split(apps, ",") {
+		appConfig := &AppConfig{
+			Name:             os.Getenv(a + "_APP_NAME"),
+			APIKey:           os.Getenv(a + "_API_KEY"),
+			MasterKey:        os.Getenv(a + "_MASTER_KEY"),
+			TokenStorePath:   os.Getenv(a + "_TOKEN_STORE_PATH"),
+			TokenStorePrefix: os.Getenv(a + "_TOKEN_STORE_PREFIX"),
+			TokenStoreSecret: os.Getenv(a + "_TOKEN_STORE_SECRET"),
+			AssetPrefix:      os.Getenv(a + "_ASSET_PREFIX"),
+			DBOption:         os.Getenv(a + "_DATABASE_URL"),
+		}
+		if maxOpenConns, err := strconv.Atoi(os.Getenv(a + "_DB_MAX_OPEN_CONNS")); err == nil {
+			appConfig.DBMaxOpenConns = maxOpenConns
+		}
+		if maxIdleConns, err := strconv.Atoi(os.Getenv(a + "_DB_MAX_IDLE_CONNS")); err == nil {
+			appConfig.DBMaxIdleConns = maxIdleConns
+		}
+		if appConfig.Name == "" {
+			appConfig.Name = strings.ToLower(a)
+		}
+		if appConfig.TokenStoreSecret == "" {
+			appConfig.TokenStoreSecret = appConfig.MasterKey
+		}
+		config.Apps[a] = appConfig
+	}
+}
+
+func (config *Configuration) validateApps() error {
+	names := map[string]bool{config.App.Name: true}
+	keys := map[string]bool{config.App.APIKey: true, config.App.MasterKey: true}
+	for a, app := range config.Apps {
+		if app.APIKey == "" || app.MasterKey == "" {
+			return fmt.Errorf("%s_API_KEY and %s_MASTER_KEY must be set", a, a)
+		}
+		if app.DBMaxOpenConns < 0 || app.DBMaxIdleConns < 0 {
+			return fmt.Errorf("%s_DB_MAX_OPEN_CONNS and %s_DB_MAX_IDLE_CONNS must not be negative", a, a)
+		}
+		if !regexp.MustCompile("^[A-Za-z0-9_]+$").MatchString(app.Name) {
+			return fmt.Errorf("%s_APP_NAME '%s' contains invalid characters other than alphanumerics or underscores", a, app.Name)
+		}
+		if names[app.Name] {
+			return fmt.Errorf("%s_APP_NAME '%s' is used by another app", a, app.Name)
+		}
+		if keys[app.APIKey] || keys[app.MasterKey] || app.APIKey == app.MasterKey {
+			return fmt.Errorf("%s_API_KEY and %s_MASTER_KEY must not be used by another app", a, a)
+		}
+		names[app.Name] = true
+		keys[app.APIKey] = true
+		keys[app.MasterKey] = true
+	}
+	return nil
+}
+
+func (config *Configuration) readPluginHandler() {
+	if size, err := strconv.ParseInt(os.Getenv("PLUGIN_HANDLER_MAX_BODY_SIZE"), 10, 64); err == nil {
+		config.PluginHandler.MaxBodySize = size
+	}
+
+	if contentTypes := os.Getenv("PLUGIN_HANDLER_CONTENT_TYPES"); contentTypes != "" {
+		config.PluginHandler.ContentTypes = strings.Split(contentTypes, ",")
+	}
+
+	if lambda := os.Getenv("PLUGIN_HANDLER_INSPECTOR_LAMBDA"); lambda != "" {
+		config.PluginHandler.InspectorLambda = lambda
+	}
+}
+
+func (config *Configuration) readModeration() {
+	if shouldEnableModeration, err := parseBool(os.Getenv("MODERATION_ENABLE")); err == nil {
+		config.Moderation.Enable = shouldEnableModeration
+	}
+
+	// MODERATION_FIELDS is a list of recordType:field, e.g. note:title,note:content
+	fields := os.Getenv("MODERATION_FIELDS")
+	if fields != "" {
+		config.Moderation.Fields = map[string][]string{}
+		for _, typeField := range strings.Split(fields, ",") {
+			components := strings.SplitN(typeField, ":", 2)
+			if len(components) != 2 {
+				log.Printf("Ignoring malformed moderation field %q", typeField)
+				continue
+			}
+			recordType, field := components[0], components[1]
+			config.Moderation.Fields[recordType] = append(config.Moderation.Fields[recordType], field)
+		}
+	}
+
+	statusKey := os.Getenv("MODERATION_STATUS_KEY")
+	if statusKey != "" {
+		config.Moderation.StatusKey = statusKey
+	}
+
+	keywords := os.Getenv("MODERATION_KEYWORDS")
+	if keywords != "" {
+		config.Moderation.Keywords = strings.Split(keywords, ",")
+	}
+
+	keywordVerdict := os.Getenv("MODERATION_KEYWORD_VERDICT")
+	if keywordVerdict != "" {
+		config.Moderation.KeywordVerdict = keywordVerdict
+	}
+
+	apiURL := os.Getenv("MODERATION_API_URL")
+	if apiURL != "" {
+		config.Moderation.APIURL = apiURL
+	}
+
+	assetContentTypes := os.Getenv("MODERATION_ASSET_CONTENT_TYPES")
+	if assetContentTypes != "" {
+		config.Moderation.AssetContentTypes = strings.Split(assetContentTypes, ",")
+	}
+}
+
+func (config *Configuration) readMetrics() {
+	if shouldEnableMetrics, err := parseBool(os.Getenv("METRICS_ENABLE")); err == nil {
+		config.Metrics.Enable = shouldEnableMetrics
+	}
+
+	path := os.Getenv("METRICS_PATH")
+	if path != "" {
+		config.Metrics.Path = path
+	}
+
+	if appLabel, err := parseBool(os.Getenv("METRICS_APP_LABEL")); err == nil {
+		config.Metrics.AppLabel = appLabel
+	}
+
+	if maxSeries, err := strconv.Atoi(os.Getenv("METRICS_MAX_SERIES")); err == nil {
+		config.Metrics.MaxSeries = maxSeries
+	}
+}
+
+func (config *Configuration) readGeoIP() {
+	dbPath := os.Getenv("GEOIP_DB_PATH")
+	if dbPath != "" {
+		config.GeoIP.DBPath = dbPath
+	}
+
+	if shouldTrustProxy, err := parseBool(os.Getenv("GEOIP_TRUST_PROXY")); err == nil {
+		config.GeoIP.TrustProxy = shouldTrustProxy
+	}
+}
+
+func (config *Configuration) readQuota() {
+	if recordCount, err := strconv.ParseUint(os.Getenv("QUOTA_PRIVATE_RECORD_COUNT"), 10, 64); err == nil {
+		config.Quota.PrivateRecordCount = recordCount
+	}
+
+	// QUOTA_PRIVATE_STORAGE_SIZE is in bytes
+	if storageSize, err := strconv.ParseUint(os.Getenv("QUOTA_PRIVATE_STORAGE_SIZE"), 10, 64); err == nil {
+		config.Quota.PrivateStorageSize = storageSize
+	}
+}
+
+func (config *Configuration) readIdempotency() {
+	actions := os.Getenv("IDEMPOTENCY_ACTIONS")
+	if actions != "" {
+		config.Idempotency.Actions = strings.Split(actions, ",")
+	}
+
+	// IDEMPOTENCY_RETENTION is in seconds, zero disables idempotency keys
+	if retention, err := strconv.ParseInt(os.Getenv("IDEMPOTENCY_RETENTION"), 10, 64); err == nil {
+		config.Idempotency.Retention = retention
+	}
+}
+
+func (config *Configuration) readResponseCache() {
+	actions := os.Getenv("RESPONSE_CACHE_ACTIONS")
+	if actions != "" {
+		config.ResponseCache.Actions = strings.Split(actions, ",")
+	}
+
+	invalidatingActions := os.Getenv("RESPONSE_CACHE_INVALIDATING_ACTIONS")
+	if invalidatingActions != "" {
+		config.ResponseCache.InvalidatingActions = strings.Split(invalidatingActions, ",")
+	}
+
+	// RESPONSE_CACHE_TTL is in seconds, zero disables the cache
+	if ttl, err := strconv.ParseInt(os.Getenv("RESPONSE_CACHE_TTL"), 10, 64); err == nil {
+		config.ResponseCache.TTL = ttl
+	}
+
+	if maxEntries, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_MAX_ENTRIES")); err == nil {
+		config.ResponseCache.MaxEntries = maxEntries
+	}
+}
+
+func (config *Configuration) readMaintenance() {
+	mode := os.Getenv("MAINTENANCE_MODE")
+	if mode != "" {
+		config.Maintenance.Mode = mode
+	}
+
+	message := os.Getenv("MAINTENANCE_MESSAGE")
+	if message != "" {
+		config.Maintenance.Message = message
+	}
+
+	readActions := os.Getenv("MAINTENANCE_READ_ACTIONS")
+	if readActions != "" {
+		config.Maintenance.ReadActions = strings.Split(readActions, ",")
+	}
+}
+
+func (config *Configuration) readCaptcha() {
+	provider := os.Getenv("CAPTCHA_PROVIDER")
+	if provider != "" {
+		config.Captcha.Provider = provider
+	}
+
+	secret := os.Getenv("CAPTCHA_SECRET")
+	if secret != "" {
+		config.Captcha.Secret = secret
+	}
+
+	pluginLambda := os.Getenv("CAPTCHA_PLUGIN_LAMBDA")
+	if pluginLambda != "" {
+		config.Captcha.PluginLambda = pluginLambda
+	}
+
+	if freeAttempts, err := strconv.Atoi(os.Getenv("CAPTCHA_FREE_ATTEMPTS_PER_HOUR")); err == nil {
+		config.Captcha.FreeAttemptsPerHour = freeAttempts
+	}
+}
+
+func (config *Configuration) readOutbound() {
+	proxyURL := os.Getenv("OUTBOUND_PROXY")
+	if proxyURL != "" {
+		config.Outbound.ProxyURL = proxyURL
+	}
+
+	noProxy := os.Getenv("OUTBOUND_NO_PROXY")
+	if noProxy != "" {
+		config.Outbound.NoProxy = strings.Split(noProxy, ",")
+	}
+
+	caBundle := os.Getenv("OUTBOUND_CA_BUNDLE")
+	if caBundle != "" {
+		config.Outbound.CABundle = caBundle
+	}
+
+	if timeout, err := strconv.Atoi(os.Getenv("OUTBOUND_TIMEOUT")); err == nil {
+		config.Outbound.Timeout = timeout
+	}
+}
+
+func (config *Configuration) readThrottle() {
+	// THROTTLE_RECORD_WRITES_PER_MINUTE is a list of recordType:limit,
+	// e.g. comment:5,message:30.
+	limits := os.Getenv("THROTTLE_RECORD_WRITES_PER_MINUTE")
+	if limits != "" {
+		config.Throttle.RecordWritesPerMinute = map[string]int{}
+		for _, typeLimit := range strings.Split(limits, ",") {
+			components := strings.SplitN(typeLimit, ":", 2)
+			if len(components) != 2 {
+				log.Printf("Ignoring malformed throttle limit %q", typeLimit)
+				continue
+			}
+			limit, err := strconv.Atoi(components[1])
+			if err != nil {
+				log.Printf("Ignoring malformed throttle limit %q", typeLimit)
+				continue
+			}
+			config.Throttle.RecordWritesPerMinute[components[0]] = limit
+		}
+	}
+}
+
+func (config *Configuration) readRecordID() {
+	if format := os.Getenv("RECORD_ID_FORMAT"); format != "" {
+		config.RecordID.Format = format
+	}
+
+	// RECORD_ID_PREFIXES is a list of recordType:prefix, e.g.
+	// note:note-,comment:c-.
+	prefixes := os.Getenv("RECORD_ID_PREFIXES")
+	if prefixes != "" {
+		config.RecordID.Prefixes = map[string]string{}
+		for _, typePrefix := range strings.Split(prefixes, ",") {
+			components := strings.SplitN(typePrefix, ":", 2)
+			if len(components) != 2 || components[1] == "" {
+				log.Printf("Ignoring malformed record id prefix %q", typePrefix)
+				continue
+			}
+			config.RecordID.Prefixes[components[0]] = components[1]
+		}
+	}
+
+	serverGenerated := os.Getenv("RECORD_ID_SERVER_GENERATED")
+	if serverGenerated != "" {
+		config.RecordID.ServerGenerated = strings.Split(serverGenerated, ",")
+	}
+}
+
+func (config *Configuration) readConcurrency() {
+	if maxInFlight, err := strconv.Atoi(os.Getenv("CONCURRENCY_MAX_IN_FLIGHT")); err == nil {
+		config.Concurrency.MaxInFlight = maxInFlight
+	}
+
+	if timeout, err := strconv.Atoi(os.Getenv("CONCURRENCY_QUEUE_TIMEOUT")); err == nil {
+		config.Concurrency.QueueTimeout = timeout
+	}
+}
+
+func (config *Configuration) readRateLimit() {
+	if limit, err := strconv.Atoi(os.Getenv("RATE_LIMIT_PER_IP")); err == nil {
+		config.RateLimit.PerIP = limit
+	}
+
+	if limit, err := strconv.Atoi(os.Getenv("RATE_LIMIT_PER_API_KEY")); err == nil {
+		config.RateLimit.PerAPIKey = limit
+	}
+}
+
+func (config *Configuration) readQuery() {
+	if depth, err := strconv.Atoi(os.Getenv("QUERY_MAX_INCLUDE_DEPTH")); err == nil {
+		config.Query.MaxIncludeDepth = depth
+	}
+}
+
+func (config *Configuration) readResponseFilter() {
+	// RESPONSE_FILTER_RECORD_FIELDS is a list of recordType:field, e.g.
+	// user:email,*:secret. Fields of type * are hidden from all records.
+	fields := os.Getenv("RESPONSE_FILTER_RECORD_FIELDS")
+	if fields != "" {
+		config.ResponseFilter.RecordFields = map[string][]string{}
+		for _, typeField := range strings.Split(fields, ",") {
+			components := strings.SplitN(typeField, ":", 2)
+			if len(components) != 2 {
+				log.Printf("Ignoring malformed response filter field %q", typeField)
+				continue
+			}
+			recordType, field := components[0], components[1]
+			config.ResponseFilter.RecordFields[recordType] = append(config.ResponseFilter.RecordFields[recordType], field)
+		}
+	}
+
+	userFields := os.Getenv("RESPONSE_FILTER_USER_FIELDS")
+	if userFields != "" {
+		config.ResponseFilter.UserFields = strings.Split(userFields, ",")
+	}
+
+	exemptRoles := os.Getenv("RESPONSE_FILTER_EXEMPT_ROLES")
+	if exemptRoles != "" {
+		config.ResponseFilter.ExemptRoles = strings.Split(exemptRoles, ",")
+	}
+}
+
+func (config *Configuration) readStats() {
+	if enable, err := parseBool(os.Getenv("STATS_ENABLE")); err == nil {
+		config.Stats.Enable = enable
+	}
+
+	// STATS_ROLLUP_SCHEDULE is a cron spec, e.g. "@hourly" or "0 0 * * * *"
+	rollupSchedule := os.Getenv("STATS_ROLLUP_SCHEDULE")
+	if rollupSchedule != "" {
+		config.Stats.RollupSchedule = rollupSchedule
+	}
+}
+
+func (config *Configuration) readAuthProvider() {
+	// AUTH_PROVIDER_APPLE_AUDIENCES are the bundle IDs and service IDs
+	appleAudiences := os.Getenv("AUTH_PROVIDER_APPLE_AUDIENCES")
+	if appleAudiences != "" {
+		config.AuthProvider.AppleAudiences = strings.Split(appleAudiences, ",")
+	}
+
+	// AUTH_PROVIDER_GOOGLE_AUDIENCES are the OAuth client IDs
+	googleAudiences := os.Getenv("AUTH_PROVIDER_GOOGLE_AUDIENCES")
+	if googleAudiences != "" {
+		config.AuthProvider.GoogleAudiences = strings.Split(googleAudiences, ",")
+	}
+
+	if appID := os.Getenv("AUTH_PROVIDER_FACEBOOK_APP_ID"); appID != "" {
+		config.AuthProvider.FacebookAppID = appID
+	}
+	if appSecret := os.Getenv("AUTH_PROVIDER_FACEBOOK_APP_SECRET"); appSecret != "" {
+		config.AuthProvider.FacebookAppSecret = appSecret
+	}
+}
+
+func (config *Configuration) readAnonymous() {
+	allowedActions := os.Getenv("ANONYMOUS_ALLOWED_ACTIONS")
+	if allowedActions != "" {
+		config.Anonymous.AllowedActions = strings.Split(allowedActions, ",")
+	}
+
+	recordTypes := os.Getenv("ANONYMOUS_RECORD_TYPES")
+	if recordTypes != "" {
+		config.Anonymous.RecordTypes = strings.Split(recordTypes, ",")
+	}
+
+	if writesPerMinute, err := strconv.Atoi(os.Getenv("ANONYMOUS_WRITES_PER_MINUTE")); err == nil {
+		config.Anonymous.WritesPerMinute = writesPerMinute
+	}
+
+	if inactiveDays, err := strconv.Atoi(os.Getenv("ANONYMOUS_PURGE_INACTIVE_DAYS")); err == nil {
+		config.Anonymous.PurgeInactiveDays = inactiveDays
+	}
+
+	purgeSchedule := os.Getenv("ANONYMOUS_PURGE_SCHEDULE")
+	if purgeSchedule != "" {
+		config.Anonymous.PurgeSchedule = purgeSchedule
+	}
+}
+
+func (config *Configuration) readChat() {
+	if enable, err := parseBool(os.Getenv("CHAT_ENABLE")); err == nil {
+		config.Chat.Enable = enable
+	}
+}
+
+func (config *Configuration) readScheduledMutation() {
+	if enable, err := parseBool(os.Getenv("SCHEDULED_MUTATION_ENABLE")); err == nil {
+		config.ScheduledMutation.Enable = enable
+	}
+
+	// SCHEDULED_MUTATION_RUN_SCHEDULE is a cron spec, e.g. "@every 1m"
+	runSchedule := os.Getenv("SCHEDULED_MUTATION_RUN_SCHEDULE")
+	if runSchedule != "" {
+		config.ScheduledMutation.RunSchedule = runSchedule
+	}
+}
+
+func (config *Configuration) readRetention() {
+	if enable, err := parseBool(os.Getenv("RETENTION_ENABLE")); err == nil {
+		config.Retention.Enable = enable
+	}
+
+	runSchedule := os.Getenv("RETENTION_RUN_SCHEDULE")
+	if runSchedule != "" {
+		config.Retention.RunSchedule = runSchedule
+	}
+
+	if dryRun, err := parseBool(os.Getenv("RETENTION_DRY_RUN")); err == nil {
+		config.Retention.DryRun = dryRun
+	}
+
+	if archiveInDB, err := parseBool(os.Getenv("RETENTION_ARCHIVE_IN_DB")); err == nil {
+		config.Retention.ArchiveInDB = archiveInDB
+	}
+
+	// RETENTION_RULES is a list of recordType:days:action, e.g.
+	// log:30:archive,session:7:delete.
+	rules := os.Getenv("RETENTION_RULES")
+	if rules != "" {
+		config.Retention.Rules = []RetentionRule{}
+		for _, typeRule := range strings.Split(rules, ",") {
+			components := strings.SplitN(typeRule, ":", 3)
+			if len(components) != 3 {
+				log.Printf("Ignoring malformed retention rule %q", typeRule)
+				continue
+			}
+			days, err := strconv.Atoi(components[1])
+			if err != nil {
+				log.Printf("Ignoring malformed retention rule %q", typeRule)
+				continue
+			}
+			config.Retention.Rules = append(config.Retention.Rules, RetentionRule{
+				RecordType: components[0],
+				Days:       days,
+				Action:     components[2],
+			})
+		}
+	}
+
+	// RETENTION_PREDICATES is a JSON object of predicates by record type,
+	// e.g. {"log": ["eq", {"$type": "keypath", "$val": "level"}, "debug"]}.
+	// Retention is disabled if it is malformed, so that records not
+	// matching the intended predicate are never removed.
+	predicates := os.Getenv("RETENTION_PREDICATES")
+	if predicates != "" {
+		config.Retention.Predicates = map[string][]interface{}{}
+		if err := json.Unmarshal([]byte(predicates), &config.Retention.Predicates); err != nil {
+			log.Printf("Disabling retention as RETENTION_PREDICATES is malformed: %v", err)
+			config.Retention.Enable = false
+		}
+	}
+}
+
+func (config *Configuration) readSMTP() {
+	host := os.Getenv("SMTP_HOST")
+	if host != "" {
+		config.SMTP.Host = host
+	}
+
+	if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+		config.SMTP.Port = port
+	}
+
+	login := os.Getenv("SMTP_LOGIN")
+	if login != "" {
+		config.SMTP.Login = login
+	}
+
+	password := os.Getenv("SMTP_PASSWORD")
+	if password != "" {
+		config.SMTP.Password = password
+	}
+
+	sender := os.Getenv("SMTP_SENDER")
+	if sender != "" {
+		config.SMTP.Sender = sender
+	}
+}
+
+func (config *Configuration) readForgotPassword() {
+	subject := os.Getenv("FORGOT_PASSWORD_SUBJECT")
+	if subject != "" {
+		config.ForgotPassword.Subject = subject
+	}
+
+	templatePath := os.Getenv("FORGOT_PASSWORD_TEMPLATE_PATH")
+	if templatePath != "" {
+		config.ForgotPassword.TemplatePath = templatePath
+	}
+
+	// FORGOT_PASSWORD_CODE_EXPIRY is in seconds
+	if codeExpiry, err := strconv.Atoi(os.Getenv("FORGOT_PASSWORD_CODE_EXPIRY")); err == nil {
+		config.ForgotPassword.CodeExpiry = codeExpiry
+	}
+}
+
+func (config *Configuration) readPubSub() {
+	if subscribe := os.Getenv("PUBSUB_SUBSCRIBE"); subscribe != "" {
+		config.PubSub.Subscribe = subscribe
+	}
+	if publish := os.Getenv("PUBSUB_PUBLISH"); publish != "" {
+		config.PubSub.Publish = publish
+	}
+
+	// PUBSUB_RULES is a list of pattern:subscribe:publish, e.g.
+	// chat/*:user:user,announcement:key:master. The pattern may contain
+	// colons as the accesses are split from the end.
+	rules := os.Getenv("PUBSUB_RULES")
+	if rules != "" {
+		config.PubSub.Rules = []PubSubRule{}
+		for _, channelRule := range strings.Split(rules, ",") {
+			components := strings.Split(channelRule, ":")
+			if len(components) < 3 {
+				log.Printf("Ignoring malformed pubsub rule %q", channelRule)
+				continue
+			}
+			n := len(components)
+			config.PubSub.Rules = append(config.PubSub.Rules, PubSubRule{
+				Pattern:   strings.Join(components[:n-2], ":"),
+				Subscribe: components[n-2],
+				Publish:   components[n-1],
+			})
+		}
+	}
+}
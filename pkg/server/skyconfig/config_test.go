@@ -35,6 +35,43 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("DATABASE_URL", "")
 		})
 
+		Convey("Read database DDL URL correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("DATABASE_URL", "postgres://skygear_dml:@localhost/postgres?sslmode=disable")
+			os.Setenv("DATABASE_DDL_URL", "postgres://skygear_ddl:@localhost/postgres?sslmode=disable")
+
+			config.ReadFromEnv()
+			So(config.DB.Option, ShouldEqual, "postgres://skygear_dml:@localhost/postgres?sslmode=disable")
+			So(config.DB.DDLOption, ShouldEqual, "postgres://skygear_ddl:@localhost/postgres?sslmode=disable")
+
+			os.Setenv("DATABASE_URL", "")
+			os.Setenv("DATABASE_DDL_URL", "")
+		})
+
+		Convey("Read database pool options correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.DB.MaxOpenConns, ShouldEqual, 10)
+			So(config.DB.MaxIdleConns, ShouldEqual, 2)
+			So(config.DB.ConnMaxLifetime, ShouldEqual, 0)
+
+			os.Setenv("DB_MAX_OPEN_CONNS", "50")
+			os.Setenv("DB_MAX_IDLE_CONNS", "10")
+			os.Setenv("DB_CONN_MAX_LIFETIME", "300")
+
+			config.ReadFromEnv()
+			So(config.DB.MaxOpenConns, ShouldEqual, 50)
+			So(config.DB.MaxIdleConns, ShouldEqual, 10)
+			So(config.DB.ConnMaxLifetime, ShouldEqual, 300)
+			So(config.Validate(), ShouldBeNil)
+
+			config.DB.MaxIdleConns = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("DB_MAX_OPEN_CONNS", "")
+			os.Setenv("DB_MAX_IDLE_CONNS", "")
+			os.Setenv("DB_CONN_MAX_LIFETIME", "")
+		})
+
 		Convey("NewConfigurationWithKeys is ready to use", func() {
 			config := NewConfigurationWithKeys()
 			So(config.Validate(), ShouldBeNil)
@@ -86,23 +123,799 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("APNS_ENABLE", "")
 		})
 
+		Convey("Read ID strategy correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.App.IDStrategy, ShouldEqual, "uuid")
+
+			os.Setenv("ID_STRATEGY", "ulid")
+			config.ReadFromEnv()
+			So(config.App.IDStrategy, ShouldEqual, "ulid")
+
+			os.Setenv("ID_STRATEGY", "")
+		})
+
 		Convey("Read token store config correctly", func() {
 			config := NewConfigurationWithKeys()
 			os.Setenv("TOKEN_STORE", "redis")
 			os.Setenv("TOKEN_STORE_PATH", "redis://redis:6379")
 			os.Setenv("TOKEN_STORE_PREFIX", "PREFIX")
 			os.Setenv("TOKEN_STORE_EXPIRY", "60")
+			os.Setenv("TOKEN_STORE_PREVIOUS_SECRETS", "secret1,secret2")
+			os.Setenv("TOKEN_STORE_REFRESH_WINDOW", "300")
 
 			config.readTokenStore()
 			So(config.TokenStore.ImplName, ShouldEqual, "redis")
 			So(config.TokenStore.Path, ShouldEqual, "redis://redis:6379")
 			So(config.TokenStore.Prefix, ShouldEqual, "PREFIX")
 			So(config.TokenStore.Expiry, ShouldEqual, 60)
+			So(config.TokenStore.PreviousSecrets, ShouldResemble, []string{"secret1", "secret2"})
+			So(config.TokenStore.RefreshWindow, ShouldEqual, 300)
+			So(config.Validate(), ShouldBeNil)
+
+			config.TokenStore.RefreshWindow = -1
+			So(config.Validate(), ShouldNotBeNil)
 
 			os.Setenv("TOKEN_STORE", "")
 			os.Setenv("TOKEN_STORE_PATH", "")
 			os.Setenv("TOKEN_STORE_PREFIX", "")
 			os.Setenv("TOKEN_STORE_EXPIRY", "")
+			os.Setenv("TOKEN_STORE_PREVIOUS_SECRETS", "")
+			os.Setenv("TOKEN_STORE_REFRESH_WINDOW", "")
+		})
+
+		Convey("Read gcs asset store config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("ASSET_STORE", "gcs")
+			os.Setenv("GCS_ASSET_BUCKET", "skygear-assets")
+			os.Setenv("GCS_ASSET_CREDENTIALS_PATH", "/etc/gcs.json")
+			os.Setenv("GCS_ASSET_URL_PREFIX", "https://cdn.example.com")
+
+			config.readAssetStore()
+			So(config.AssetStore.ImplName, ShouldEqual, "gcs")
+			So(config.AssetStore.GCSStore.Bucket, ShouldEqual, "skygear-assets")
+			So(config.AssetStore.GCSStore.CredentialsPath, ShouldEqual, "/etc/gcs.json")
+			So(config.AssetStore.GCSStore.URLPrefix, ShouldEqual, "https://cdn.example.com")
+
+			os.Setenv("ASSET_STORE", "")
+			os.Setenv("GCS_ASSET_BUCKET", "")
+			os.Setenv("GCS_ASSET_CREDENTIALS_PATH", "")
+			os.Setenv("GCS_ASSET_URL_PREFIX", "")
+		})
+
+		Convey("Read gcm config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("GCM_ENABLE", "YES")
+			config.readGCM()
+			So(config.GCM.Enable, ShouldBeTrue)
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("GCM_CREDENTIALS_PATH", "/etc/fcm.json")
+			os.Setenv("GCM_PROJECT_ID", "skygear-project")
+			config.readGCM()
+			So(config.GCM.CredentialsPath, ShouldEqual, "/etc/fcm.json")
+			So(config.GCM.ProjectID, ShouldEqual, "skygear-project")
+			So(config.Validate(), ShouldBeNil)
+
+			os.Setenv("GCM_ENABLE", "")
+			os.Setenv("GCM_CREDENTIALS_PATH", "")
+			os.Setenv("GCM_PROJECT_ID", "")
+		})
+
+		Convey("Read plugin output log levels correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.LOG.PluginStdoutLevel, ShouldEqual, "info")
+			So(config.LOG.PluginStderrLevel, ShouldEqual, "warning")
+
+			os.Setenv("LOG_PLUGIN_STDOUT", "debug")
+			os.Setenv("LOG_PLUGIN_STDERR", "error")
+
+			config.readLog()
+			So(config.LOG.PluginStdoutLevel, ShouldEqual, "debug")
+			So(config.LOG.PluginStderrLevel, ShouldEqual, "error")
+
+			os.Setenv("LOG_PLUGIN_STDOUT", "")
+			os.Setenv("LOG_PLUGIN_STDERR", "")
+		})
+
+		Convey("Read log format correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.LOG.Format, ShouldEqual, "text")
+
+			os.Setenv("LOG_FORMAT", "json")
+			config.readLog()
+			So(config.LOG.Format, ShouldEqual, "json")
+			So(config.Validate(), ShouldBeNil)
+
+			config.LOG.Format = "xml"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("LOG_FORMAT", "")
+		})
+
+		Convey("Read moderation config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("MODERATION_ENABLE", "YES")
+			os.Setenv("MODERATION_FIELDS", "note:title,note:content,comment:body")
+			os.Setenv("MODERATION_KEYWORDS", "spam,scam")
+			os.Setenv("MODERATION_KEYWORD_VERDICT", "rejected")
+			os.Setenv("MODERATION_ASSET_CONTENT_TYPES", "image/")
+
+			config.readModeration()
+			So(config.Moderation.Enable, ShouldBeTrue)
+			So(config.Moderation.Fields, ShouldResemble, map[string][]string{
+				"note":    []string{"title", "content"},
+				"comment": []string{"body"},
+			})
+			So(config.Moderation.Keywords, ShouldResemble, []string{"spam", "scam"})
+			So(config.Moderation.KeywordVerdict, ShouldEqual, "rejected")
+			So(config.Moderation.AssetContentTypes, ShouldResemble, []string{"image/"})
+			So(config.Validate(), ShouldBeNil)
+
+			os.Setenv("MODERATION_ENABLE", "")
+			os.Setenv("MODERATION_FIELDS", "")
+			os.Setenv("MODERATION_KEYWORDS", "")
+			os.Setenv("MODERATION_KEYWORD_VERDICT", "")
+			os.Setenv("MODERATION_ASSET_CONTENT_TYPES", "")
+		})
+
+		Convey("Read asset headers config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("ASSET_CACHE_CONTROL", "image/*=public, max-age=86400;*=no-cache")
+			os.Setenv("ASSET_CONTENT_DISPOSITION", "image/*=inline; *=attachment")
+			os.Setenv("ASSET_ALLOW_ORIGIN", "font/*=*")
+
+			config.readAssetHeaders()
+			So(config.AssetHeaders.CacheControl, ShouldResemble, map[string]string{
+				"image/*": "public, max-age=86400",
+				"*":       "no-cache",
+			})
+			So(config.AssetHeaders.ContentDisposition, ShouldResemble, map[string]string{
+				"image/*": "inline",
+				"*":       "attachment",
+			})
+			So(config.AssetHeaders.AllowOrigin, ShouldResemble, map[string]string{
+				"font/*": "*",
+			})
+			So(config.Validate(), ShouldBeNil)
+
+			config.AssetHeaders.ContentDisposition["*"] = "download"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("ASSET_CACHE_CONTROL", "")
+			os.Setenv("ASSET_CONTENT_DISPOSITION", "")
+			os.Setenv("ASSET_ALLOW_ORIGIN", "")
+		})
+
+		Convey("Read shutdown timeout correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.HTTP.ShutdownTimeout, ShouldEqual, 30)
+
+			os.Setenv("SHUTDOWN_TIMEOUT", "5")
+			config.readHost()
+			So(config.HTTP.ShutdownTimeout, ShouldEqual, 5)
+
+			config.HTTP.ShutdownTimeout = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("SHUTDOWN_TIMEOUT", "")
+		})
+
+		Convey("Read listener config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.HTTP.InternalHost, ShouldEqual, "")
+
+			os.Setenv("MAX_BODY_SIZE", "1048576")
+			os.Setenv("INTERNAL_HOST", "10.0.0.1:3001")
+			os.Setenv("INTERNAL_MAX_BODY_SIZE", "104857600")
+			config.readHost()
+			So(config.HTTP.MaxBodySize, ShouldEqual, 1048576)
+			So(config.HTTP.InternalHost, ShouldEqual, "10.0.0.1:3001")
+			So(config.HTTP.InternalMaxBodySize, ShouldEqual, 104857600)
+			So(config.Validate(), ShouldBeNil)
+
+			config.HTTP.InternalHost = config.HTTP.Host
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.HTTP.InternalHost = "10.0.0.1:3001"
+			config.HTTP.MaxBodySize = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("MAX_BODY_SIZE", "")
+			os.Setenv("INTERNAL_HOST", "")
+			os.Setenv("INTERNAL_MAX_BODY_SIZE", "")
+		})
+
+		Convey("Read gzip config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.HTTP.Gzip, ShouldBeFalse)
+			So(config.HTTP.GzipMinSize, ShouldEqual, 1024)
+
+			os.Setenv("GZIP", "true")
+			os.Setenv("GZIP_MIN_SIZE", "4096")
+			config.readHost()
+			So(config.HTTP.Gzip, ShouldBeTrue)
+			So(config.HTTP.GzipMinSize, ShouldEqual, 4096)
+			So(config.Validate(), ShouldBeNil)
+
+			config.HTTP.GzipMinSize = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("GZIP", "")
+			os.Setenv("GZIP_MIN_SIZE", "")
+		})
+
+		Convey("Read metrics config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Metrics.AppLabel, ShouldBeTrue)
+			So(config.Metrics.MaxSeries, ShouldEqual, 1000)
+
+			os.Setenv("METRICS_ENABLE", "YES")
+			os.Setenv("METRICS_PATH", "/_/metrics")
+			os.Setenv("METRICS_APP_LABEL", "NO")
+			os.Setenv("METRICS_MAX_SERIES", "50")
+
+			config.readMetrics()
+			So(config.Metrics.Enable, ShouldBeTrue)
+			So(config.Metrics.Path, ShouldEqual, "/_/metrics")
+			So(config.Metrics.AppLabel, ShouldBeFalse)
+			So(config.Metrics.MaxSeries, ShouldEqual, 50)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Metrics.Path = "metrics"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.Metrics.Path = "/metrics"
+			config.Metrics.MaxSeries = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("METRICS_ENABLE", "")
+			os.Setenv("METRICS_PATH", "")
+			os.Setenv("METRICS_APP_LABEL", "")
+			os.Setenv("METRICS_MAX_SERIES", "")
+		})
+
+		Convey("Read GeoIP config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("GEOIP_DB_PATH", "/usr/share/GeoLite2-City.mmdb")
+			os.Setenv("GEOIP_TRUST_PROXY", "YES")
+
+			config.readGeoIP()
+			So(config.GeoIP.DBPath, ShouldEqual, "/usr/share/GeoLite2-City.mmdb")
+			So(config.GeoIP.TrustProxy, ShouldBeTrue)
+
+			os.Setenv("GEOIP_DB_PATH", "")
+			os.Setenv("GEOIP_TRUST_PROXY", "")
+		})
+
+		Convey("Read quota config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("QUOTA_PRIVATE_RECORD_COUNT", "1000")
+			os.Setenv("QUOTA_PRIVATE_STORAGE_SIZE", "10485760")
+
+			config.readQuota()
+			So(config.Quota.PrivateRecordCount, ShouldEqual, 1000)
+			So(config.Quota.PrivateStorageSize, ShouldEqual, 10485760)
+
+			os.Setenv("QUOTA_PRIVATE_RECORD_COUNT", "")
+			os.Setenv("QUOTA_PRIVATE_STORAGE_SIZE", "")
+		})
+
+		Convey("Read idempotency config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Idempotency.Actions, ShouldContain, "record:save")
+			So(config.Idempotency.Retention, ShouldEqual, 86400)
+
+			os.Setenv("IDEMPOTENCY_ACTIONS", "record:save,push:user")
+			os.Setenv("IDEMPOTENCY_RETENTION", "3600")
+
+			config.readIdempotency()
+			So(config.Idempotency.Actions, ShouldResemble, []string{"record:save", "push:user"})
+			So(config.Idempotency.Retention, ShouldEqual, 3600)
+
+			os.Setenv("IDEMPOTENCY_ACTIONS", "")
+			os.Setenv("IDEMPOTENCY_RETENTION", "")
+		})
+
+		Convey("Read response cache config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.ResponseCache.Actions, ShouldBeEmpty)
+			So(config.ResponseCache.InvalidatingActions, ShouldContain, "record:save")
+
+			os.Setenv("RESPONSE_CACHE_ACTIONS", "record:fetch,user:query")
+			os.Setenv("RESPONSE_CACHE_INVALIDATING_ACTIONS", "record:save")
+			os.Setenv("RESPONSE_CACHE_TTL", "30")
+			os.Setenv("RESPONSE_CACHE_MAX_ENTRIES", "500")
+
+			config.readResponseCache()
+			So(config.ResponseCache.Actions, ShouldResemble, []string{"record:fetch", "user:query"})
+			So(config.ResponseCache.InvalidatingActions, ShouldResemble, []string{"record:save"})
+			So(config.ResponseCache.TTL, ShouldEqual, 30)
+			So(config.ResponseCache.MaxEntries, ShouldEqual, 500)
+
+			os.Setenv("RESPONSE_CACHE_ACTIONS", "")
+			os.Setenv("RESPONSE_CACHE_INVALIDATING_ACTIONS", "")
+			os.Setenv("RESPONSE_CACHE_TTL", "")
+			os.Setenv("RESPONSE_CACHE_MAX_ENTRIES", "")
+		})
+
+		Convey("Read maintenance config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("MAINTENANCE_MODE", "read_only")
+			os.Setenv("MAINTENANCE_MESSAGE", "upgrading")
+			os.Setenv("MAINTENANCE_READ_ACTIONS", "record:fetch,record:query")
+
+			config.readMaintenance()
+			So(config.Maintenance.Mode, ShouldEqual, "read_only")
+			So(config.Maintenance.Message, ShouldEqual, "upgrading")
+			So(config.Maintenance.ReadActions, ShouldResemble, []string{"record:fetch", "record:query"})
+			So(config.Validate(), ShouldBeNil)
+
+			config.Maintenance.Mode = "partial"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("MAINTENANCE_MODE", "")
+			os.Setenv("MAINTENANCE_MESSAGE", "")
+			os.Setenv("MAINTENANCE_READ_ACTIONS", "")
+		})
+
+		Convey("Read captcha config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("CAPTCHA_PROVIDER", "recaptcha")
+			os.Setenv("CAPTCHA_FREE_ATTEMPTS_PER_HOUR", "0")
+
+			config.readCaptcha()
+			So(config.Captcha.Provider, ShouldEqual, "recaptcha")
+			So(config.Captcha.FreeAttemptsPerHour, ShouldEqual, 0)
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("CAPTCHA_SECRET", "secret")
+			config.readCaptcha()
+			So(config.Captcha.Secret, ShouldEqual, "secret")
+			So(config.Validate(), ShouldBeNil)
+
+			config.Captcha.Provider = "turing"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("CAPTCHA_PROVIDER", "")
+			os.Setenv("CAPTCHA_SECRET", "")
+			os.Setenv("CAPTCHA_FREE_ATTEMPTS_PER_HOUR", "")
+		})
+
+		Convey("Read SMTP and forgot password config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("SMTP_HOST", "smtp.example.com")
+			os.Setenv("SMTP_PORT", "587")
+			os.Setenv("SMTP_LOGIN", "skygear")
+			os.Setenv("SMTP_PASSWORD", "secret")
+			os.Setenv("FORGOT_PASSWORD_SUBJECT", "Forgot your password?")
+			os.Setenv("FORGOT_PASSWORD_TEMPLATE_PATH", "templates/forgot_password.txt")
+			os.Setenv("FORGOT_PASSWORD_CODE_EXPIRY", "600")
+
+			config.readSMTP()
+			config.readForgotPassword()
+			So(config.SMTP.Host, ShouldEqual, "smtp.example.com")
+			So(config.SMTP.Port, ShouldEqual, 587)
+			So(config.SMTP.Login, ShouldEqual, "skygear")
+			So(config.SMTP.Password, ShouldEqual, "secret")
+			So(config.ForgotPassword.Subject, ShouldEqual, "Forgot your password?")
+			So(config.ForgotPassword.TemplatePath, ShouldEqual, "templates/forgot_password.txt")
+			So(config.ForgotPassword.CodeExpiry, ShouldEqual, 600)
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("SMTP_SENDER", "noreply@example.com")
+			config.readSMTP()
+			So(config.SMTP.Sender, ShouldEqual, "noreply@example.com")
+			So(config.Validate(), ShouldBeNil)
+
+			config.ForgotPassword.CodeExpiry = 0
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("SMTP_HOST", "")
+			os.Setenv("SMTP_PORT", "")
+			os.Setenv("SMTP_LOGIN", "")
+			os.Setenv("SMTP_PASSWORD", "")
+			os.Setenv("SMTP_SENDER", "")
+			os.Setenv("FORGOT_PASSWORD_SUBJECT", "")
+			os.Setenv("FORGOT_PASSWORD_TEMPLATE_PATH", "")
+			os.Setenv("FORGOT_PASSWORD_CODE_EXPIRY", "")
+		})
+
+		Convey("Read outbound config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("OUTBOUND_PROXY", "http://proxy.example.com:3128")
+			os.Setenv("OUTBOUND_NO_PROXY", "plugin,.internal")
+			os.Setenv("OUTBOUND_CA_BUNDLE", "/etc/ssl/corporate.pem")
+			os.Setenv("OUTBOUND_TIMEOUT", "15")
+
+			config.readOutbound()
+			So(config.Outbound.ProxyURL, ShouldEqual, "http://proxy.example.com:3128")
+			So(config.Outbound.NoProxy, ShouldResemble, []string{"plugin", ".internal"})
+			So(config.Outbound.CABundle, ShouldEqual, "/etc/ssl/corporate.pem")
+			So(config.Outbound.Timeout, ShouldEqual, 15)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Outbound.ProxyURL = "proxy.example.com:3128"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("OUTBOUND_PROXY", "")
+			os.Setenv("OUTBOUND_NO_PROXY", "")
+			os.Setenv("OUTBOUND_CA_BUNDLE", "")
+			os.Setenv("OUTBOUND_TIMEOUT", "")
+		})
+
+		Convey("Read throttle config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("THROTTLE_RECORD_WRITES_PER_MINUTE", "comment:5,message:30,malformed,note:many")
+
+			config.readThrottle()
+			So(config.Throttle.RecordWritesPerMinute, ShouldResemble, map[string]int{
+				"comment": 5,
+				"message": 30,
+			})
+
+			os.Setenv("THROTTLE_RECORD_WRITES_PER_MINUTE", "")
+		})
+
+		Convey("Read record id config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("RECORD_ID_FORMAT", "uuid")
+			os.Setenv("RECORD_ID_PREFIXES", "note:note-,malformed,comment:")
+			os.Setenv("RECORD_ID_SERVER_GENERATED", "invoice,payment")
+
+			config.readRecordID()
+			So(config.RecordID.Format, ShouldEqual, "uuid")
+			So(config.RecordID.Prefixes, ShouldResemble, map[string]string{
+				"note": "note-",
+			})
+			So(config.RecordID.ServerGenerated, ShouldResemble, []string{"invoice", "payment"})
+			So(config.Validate(), ShouldBeNil)
+
+			config.RecordID.Format = "serial"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("RECORD_ID_FORMAT", "")
+			os.Setenv("RECORD_ID_PREFIXES", "")
+			os.Setenv("RECORD_ID_SERVER_GENERATED", "")
+		})
+
+		Convey("Read push config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Push.TrimFields, ShouldResemble, []string{"aps.alert.body", "aps.alert", "notification.body"})
+			So(config.Push.Access, ShouldEqual, "key")
+
+			os.Setenv("PUSH_TRIM_FIELDS", "aps.alert.body,notification.body")
+			os.Setenv("PUSH_ACCESS", "master")
+			config.readPush()
+			So(config.Push.TrimFields, ShouldResemble, []string{"aps.alert.body", "notification.body"})
+			So(config.Push.Access, ShouldEqual, "master")
+
+			config.Push.Access = "anyone"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUSH_TRIM_FIELDS", "")
+			os.Setenv("PUSH_ACCESS", "")
+		})
+
+		Convey("Read work queue config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("PUSH_QUEUE_CONCURRENCY", "critical:4,bulk:1,malformed")
+			os.Setenv("HOOK_QUEUE_CONCURRENCY", "normal:3,bulk:many")
+
+			config.readWorkQueue()
+			So(config.WorkQueue.PushConcurrency, ShouldResemble, map[string]int{
+				"critical": 4,
+				"bulk":     1,
+			})
+			So(config.WorkQueue.HookConcurrency, ShouldResemble, map[string]int{
+				"normal": 3,
+			})
+			So(config.Validate(), ShouldBeNil)
+
+			config.WorkQueue.HookConcurrency["urgent"] = 1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUSH_QUEUE_CONCURRENCY", "")
+			os.Setenv("HOOK_QUEUE_CONCURRENCY", "")
+		})
+
+		Convey("Read async hook config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.WorkQueue.AsyncAfterSaveHooks, ShouldBeFalse)
+			So(config.WorkQueue.HookMaxAttempts, ShouldEqual, 3)
+			So(config.WorkQueue.HookRetryBackoff, ShouldEqual, 1000)
+			So(config.WorkQueue.HookTimeout, ShouldEqual, 30000)
+
+			os.Setenv("HOOK_ASYNC_AFTER_SAVE", "yes")
+			os.Setenv("HOOK_MAX_ATTEMPTS", "5")
+			os.Setenv("HOOK_RETRY_BACKOFF", "200")
+			os.Setenv("HOOK_TIMEOUT", "5000")
+			config.readWorkQueue()
+			So(config.WorkQueue.AsyncAfterSaveHooks, ShouldBeTrue)
+			So(config.WorkQueue.HookMaxAttempts, ShouldEqual, 5)
+			So(config.WorkQueue.HookRetryBackoff, ShouldEqual, 200)
+			So(config.WorkQueue.HookTimeout, ShouldEqual, 5000)
+			So(config.Validate(), ShouldBeNil)
+
+			config.WorkQueue.HookMaxAttempts = 0
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.WorkQueue.HookMaxAttempts = 5
+			config.WorkQueue.HookTimeout = 0
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("HOOK_ASYNC_AFTER_SAVE", "")
+			os.Setenv("HOOK_MAX_ATTEMPTS", "")
+			os.Setenv("HOOK_RETRY_BACKOFF", "")
+			os.Setenv("HOOK_TIMEOUT", "")
+		})
+
+		Convey("Read concurrency config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("CONCURRENCY_MAX_IN_FLIGHT", "10")
+			os.Setenv("CONCURRENCY_QUEUE_TIMEOUT", "500")
+
+			config.readConcurrency()
+			So(config.Concurrency.MaxInFlight, ShouldEqual, 10)
+			So(config.Concurrency.QueueTimeout, ShouldEqual, 500)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Concurrency.QueueTimeout = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("CONCURRENCY_MAX_IN_FLIGHT", "")
+			os.Setenv("CONCURRENCY_QUEUE_TIMEOUT", "")
+		})
+
+		Convey("Read rate limit config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.RateLimit.PerIP, ShouldEqual, 0)
+			So(config.RateLimit.PerAPIKey, ShouldEqual, 0)
+
+			os.Setenv("RATE_LIMIT_PER_IP", "600")
+			os.Setenv("RATE_LIMIT_PER_API_KEY", "6000")
+
+			config.readRateLimit()
+			So(config.RateLimit.PerIP, ShouldEqual, 600)
+			So(config.RateLimit.PerAPIKey, ShouldEqual, 6000)
+			So(config.Validate(), ShouldBeNil)
+
+			config.RateLimit.PerIP = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("RATE_LIMIT_PER_IP", "")
+			os.Setenv("RATE_LIMIT_PER_API_KEY", "")
+		})
+
+		Convey("Read CORS config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.App.CORSHost, ShouldEqual, "*")
+
+			os.Setenv("CORS_HOST", "https://a.example.com,https://b.example.com")
+			os.Setenv("CORS_METHODS", "GET,POST")
+			os.Setenv("CORS_HEADERS", "Content-Type,X-Skygear-Api-Key")
+
+			config.readCORS()
+			So(config.App.CORSHost, ShouldEqual, "https://a.example.com,https://b.example.com")
+			So(config.App.CORSMethods, ShouldResemble, []string{"GET", "POST"})
+			So(config.App.CORSHeaders, ShouldResemble, []string{"Content-Type", "X-Skygear-Api-Key"})
+
+			os.Setenv("CORS_HOST", "")
+			os.Setenv("CORS_METHODS", "")
+			os.Setenv("CORS_HEADERS", "")
+		})
+
+		Convey("Read plugin handler config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.PluginHandler.MaxBodySize, ShouldEqual, 10*1024*1024)
+
+			os.Setenv("PLUGIN_HANDLER_MAX_BODY_SIZE", "65536")
+			os.Setenv("PLUGIN_HANDLER_CONTENT_TYPES", "application/json,application/x-www-form-urlencoded")
+			os.Setenv("PLUGIN_HANDLER_INSPECTOR_LAMBDA", "webhook:inspect")
+
+			config.readPluginHandler()
+			So(config.PluginHandler.MaxBodySize, ShouldEqual, 65536)
+			So(config.PluginHandler.ContentTypes, ShouldResemble, []string{
+				"application/json",
+				"application/x-www-form-urlencoded",
+			})
+			So(config.PluginHandler.InspectorLambda, ShouldEqual, "webhook:inspect")
+			So(config.Validate(), ShouldBeNil)
+
+			config.PluginHandler.MaxBodySize = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PLUGIN_HANDLER_MAX_BODY_SIZE", "")
+			os.Setenv("PLUGIN_HANDLER_CONTENT_TYPES", "")
+			os.Setenv("PLUGIN_HANDLER_INSPECTOR_LAMBDA", "")
+		})
+
+		Convey("Read query config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Query.MaxIncludeDepth, ShouldEqual, 3)
+
+			os.Setenv("QUERY_MAX_INCLUDE_DEPTH", "5")
+			config.readQuery()
+			So(config.Query.MaxIncludeDepth, ShouldEqual, 5)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Query.MaxIncludeDepth = 0
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("QUERY_MAX_INCLUDE_DEPTH", "")
+		})
+
+		Convey("Read response filter config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("RESPONSE_FILTER_RECORD_FIELDS", "user:email,*:secret,note:draft,malformed")
+			os.Setenv("RESPONSE_FILTER_USER_FIELDS", "email,last_login_location")
+			os.Setenv("RESPONSE_FILTER_EXEMPT_ROLES", "admin")
+
+			config.readResponseFilter()
+			So(config.ResponseFilter.RecordFields, ShouldResemble, map[string][]string{
+				"user": []string{"email"},
+				"*":    []string{"secret"},
+				"note": []string{"draft"},
+			})
+			So(config.ResponseFilter.UserFields, ShouldResemble, []string{"email", "last_login_location"})
+			So(config.ResponseFilter.ExemptRoles, ShouldResemble, []string{"admin"})
+
+			os.Setenv("RESPONSE_FILTER_RECORD_FIELDS", "")
+			os.Setenv("RESPONSE_FILTER_USER_FIELDS", "")
+			os.Setenv("RESPONSE_FILTER_EXEMPT_ROLES", "")
+		})
+
+		Convey("Read stats config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Stats.RollupSchedule, ShouldEqual, "@hourly")
+
+			os.Setenv("STATS_ENABLE", "YES")
+			os.Setenv("STATS_ROLLUP_SCHEDULE", "@daily")
+
+			config.readStats()
+			So(config.Stats.Enable, ShouldBeTrue)
+			So(config.Stats.RollupSchedule, ShouldEqual, "@daily")
+
+			os.Setenv("STATS_ENABLE", "")
+			os.Setenv("STATS_ROLLUP_SCHEDULE", "")
+		})
+
+		Convey("Read auth provider config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("AUTH_PROVIDER_APPLE_AUDIENCES", "com.example.app,com.example.web")
+			os.Setenv("AUTH_PROVIDER_GOOGLE_AUDIENCES", "1234.apps.googleusercontent.com")
+			os.Setenv("AUTH_PROVIDER_FACEBOOK_APP_ID", "5678")
+			os.Setenv("AUTH_PROVIDER_FACEBOOK_APP_SECRET", "fbsecret")
+
+			config.readAuthProvider()
+			So(config.AuthProvider.AppleAudiences, ShouldResemble, []string{"com.example.app", "com.example.web"})
+			So(config.AuthProvider.GoogleAudiences, ShouldResemble, []string{"1234.apps.googleusercontent.com"})
+			So(config.AuthProvider.FacebookAppID, ShouldEqual, "5678")
+			So(config.AuthProvider.FacebookAppSecret, ShouldEqual, "fbsecret")
+			So(config.Validate(), ShouldBeNil)
+
+			config.AuthProvider.FacebookAppSecret = ""
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("AUTH_PROVIDER_APPLE_AUDIENCES", "")
+			os.Setenv("AUTH_PROVIDER_GOOGLE_AUDIENCES", "")
+			os.Setenv("AUTH_PROVIDER_FACEBOOK_APP_ID", "")
+			os.Setenv("AUTH_PROVIDER_FACEBOOK_APP_SECRET", "")
+		})
+
+		Convey("Read anonymous config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Anonymous.PurgeSchedule, ShouldEqual, "@daily")
+
+			os.Setenv("ANONYMOUS_ALLOWED_ACTIONS", "me,record:query")
+			os.Setenv("ANONYMOUS_RECORD_TYPES", "note")
+			os.Setenv("ANONYMOUS_WRITES_PER_MINUTE", "10")
+			os.Setenv("ANONYMOUS_PURGE_INACTIVE_DAYS", "30")
+			os.Setenv("ANONYMOUS_PURGE_SCHEDULE", "@weekly")
+
+			config.readAnonymous()
+			So(config.Anonymous.AllowedActions, ShouldResemble, []string{"me", "record:query"})
+			So(config.Anonymous.RecordTypes, ShouldResemble, []string{"note"})
+			So(config.Anonymous.WritesPerMinute, ShouldEqual, 10)
+			So(config.Anonymous.PurgeInactiveDays, ShouldEqual, 30)
+			So(config.Anonymous.PurgeSchedule, ShouldEqual, "@weekly")
+
+			os.Setenv("ANONYMOUS_ALLOWED_ACTIONS", "")
+			os.Setenv("ANONYMOUS_RECORD_TYPES", "")
+			os.Setenv("ANONYMOUS_WRITES_PER_MINUTE", "")
+			os.Setenv("ANONYMOUS_PURGE_INACTIVE_DAYS", "")
+			os.Setenv("ANONYMOUS_PURGE_SCHEDULE", "")
+		})
+
+		Convey("Read chat config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Chat.Enable, ShouldBeFalse)
+
+			os.Setenv("CHAT_ENABLE", "YES")
+
+			config.readChat()
+			So(config.Chat.Enable, ShouldBeTrue)
+
+			os.Setenv("CHAT_ENABLE", "")
+		})
+
+		Convey("Read scheduled mutation config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.ScheduledMutation.Enable, ShouldBeFalse)
+			So(config.ScheduledMutation.RunSchedule, ShouldEqual, "@every 1m")
+
+			os.Setenv("SCHEDULED_MUTATION_ENABLE", "YES")
+			os.Setenv("SCHEDULED_MUTATION_RUN_SCHEDULE", "@every 10s")
+
+			config.readScheduledMutation()
+			So(config.ScheduledMutation.Enable, ShouldBeTrue)
+			So(config.ScheduledMutation.RunSchedule, ShouldEqual, "@every 10s")
+
+			os.Setenv("SCHEDULED_MUTATION_ENABLE", "")
+			os.Setenv("SCHEDULED_MUTATION_RUN_SCHEDULE", "")
+		})
+
+		Convey("Read retention config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Retention.Enable, ShouldBeFalse)
+			So(config.Retention.RunSchedule, ShouldEqual, "@daily")
+
+			os.Setenv("RETENTION_ENABLE", "YES")
+			os.Setenv("RETENTION_DRY_RUN", "YES")
+			os.Setenv("RETENTION_ARCHIVE_IN_DB", "YES")
+			os.Setenv("RETENTION_RULES", "log:30:archive,session:7:delete,malformed")
+			os.Setenv("RETENTION_PREDICATES", `{"log": ["eq", {"$type": "keypath", "$val": "level"}, "debug"]}`)
+
+			config.readRetention()
+			So(config.Retention.Enable, ShouldBeTrue)
+			So(config.Retention.DryRun, ShouldBeTrue)
+			So(config.Retention.ArchiveInDB, ShouldBeTrue)
+			So(config.Retention.Rules, ShouldResemble, []RetentionRule{
+				{"log", 30, "archive"},
+				{"session", 7, "delete"},
+			})
+			So(config.Retention.Predicates["log"], ShouldResemble, []interface{}{
+				"eq",
+				map[string]interface{}{"$type": "keypath", "$val": "level"},
+				"debug",
+			})
+
+			Convey("disables retention with malformed predicates", func() {
+				os.Setenv("RETENTION_PREDICATES", `{"log": [`)
+				config.readRetention()
+				So(config.Retention.Enable, ShouldBeFalse)
+			})
+
+			os.Setenv("RETENTION_ENABLE", "")
+			os.Setenv("RETENTION_DRY_RUN", "")
+			os.Setenv("RETENTION_ARCHIVE_IN_DB", "")
+			os.Setenv("RETENTION_RULES", "")
+			os.Setenv("RETENTION_PREDICATES", "")
+		})
+
+		Convey("Read pubsub config correctly", func() {
+			config := NewConfigurationWithKeys()
+			So(config.PubSub.Subscribe, ShouldEqual, "key")
+			So(config.PubSub.Publish, ShouldEqual, "user")
+
+			os.Setenv("PUBSUB_PUBLISH", "master")
+			os.Setenv("PUBSUB_RULES", "chat/*:user:user,room:1:key:none,malformed")
+
+			config.readPubSub()
+			So(config.PubSub.Subscribe, ShouldEqual, "key")
+			So(config.PubSub.Publish, ShouldEqual, "master")
+			So(config.PubSub.Rules, ShouldResemble, []PubSubRule{
+				{"chat/*", "user", "user"},
+				{"room:1", "key", "none"},
+			})
+			So(config.Validate(), ShouldBeNil)
+
+			Convey("rejects unknown access", func() {
+				config.PubSub.Rules[0].Publish = "anyone"
+				So(config.Validate(), ShouldNotBeNil)
+			})
+
+			os.Setenv("PUBSUB_PUBLISH", "")
+			os.Setenv("PUBSUB_RULES", "")
 		})
 
 		Convey("Read plugin config correctly", func() {
@@ -154,5 +967,69 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("BUG_TRANSPORT", "")
 			os.Setenv("BUG_PATH", "")
 		})
+
+		Convey("Read apps config correctly", func() {
+			config := NewConfigurationWithKeys()
+			config.App.Name = "myapp"
+			os.Setenv("APPS", "SHOP,BLOG")
+			os.Setenv("SHOP_API_KEY", "shopkey")
+			os.Setenv("SHOP_MASTER_KEY", "shopsecret")
+			os.Setenv("SHOP_TOKEN_STORE_PREFIX", "shop:")
+			os.Setenv("SHOP_ASSET_PREFIX", "shop")
+			os.Setenv("SHOP_DATABASE_URL", "postgres://shop")
+			os.Setenv("SHOP_DB_MAX_OPEN_CONNS", "5")
+			os.Setenv("BLOG_APP_NAME", "blog_app")
+			os.Setenv("BLOG_API_KEY", "blogkey")
+			os.Setenv("BLOG_MASTER_KEY", "blogsecret")
+			os.Setenv("BLOG_TOKEN_STORE_SECRET", "blogtoken")
+
+			config.readApps()
+			So(config.Apps["SHOP"], ShouldResemble, &AppConfig{
+				Name:             "shop",
+				APIKey:           "shopkey",
+				MasterKey:        "shopsecret",
+				TokenStorePrefix: "shop:",
+				TokenStoreSecret: "shopsecret",
+				AssetPrefix:      "shop",
+				DBOption:         "postgres://shop",
+				DBMaxOpenConns:   5,
+			})
+			So(config.Apps["BLOG"], ShouldResemble, &AppConfig{
+				Name:             "blog_app",
+				APIKey:           "blogkey",
+				MasterKey:        "blogsecret",
+				TokenStoreSecret: "blogtoken",
+			})
+			So(config.Validate(), ShouldBeNil)
+
+			config.Apps["BLOG"].Name = "shop"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.Apps["BLOG"].Name = "blog_app"
+			config.Apps["BLOG"].APIKey = "shopkey"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.Apps["BLOG"].APIKey = config.App.APIKey
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.Apps["BLOG"].APIKey = ""
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.Apps["BLOG"].APIKey = "blogkey"
+			config.Apps["BLOG"].DBMaxOpenConns = -1
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("APPS", "")
+			os.Setenv("SHOP_API_KEY", "")
+			os.Setenv("SHOP_MASTER_KEY", "")
+			os.Setenv("SHOP_TOKEN_STORE_PREFIX", "")
+			os.Setenv("SHOP_ASSET_PREFIX", "")
+			os.Setenv("SHOP_DATABASE_URL", "")
+			os.Setenv("SHOP_DB_MAX_OPEN_CONNS", "")
+			os.Setenv("BLOG_APP_NAME", "")
+			os.Setenv("BLOG_API_KEY", "")
+			os.Setenv("BLOG_MASTER_KEY", "")
+			os.Setenv("BLOG_TOKEN_STORE_SECRET", "")
+		})
 	})
 }
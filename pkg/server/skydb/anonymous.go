@@ -0,0 +1,29 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"time"
+)
+
+// AnonymousUserPurger is implemented by Conn that can delete inactive
+// anonymous users together with their data.
+type AnonymousUserPurger interface {
+	// PurgeAnonymousUsers deletes anonymous users not seen since
+	// inactiveSince, along with the records they own, their devices and
+	// relations. It returns the number of users deleted.
+	PurgeAnonymousUsers(ctx context.Context, inactiveSince time.Time) (int, error)
+}
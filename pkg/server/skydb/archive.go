@@ -0,0 +1,45 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrArchivedRecordNotFound is returned by RecordArchive.GetArchivedRecord
+// if the record is not archived.
+var ErrArchivedRecordNotFound = errors.New("skydb: archived record not found")
+
+// ArchivedRecord is a record moved out of the record tables, e.g. by a
+// retention rule. Archived records are not returned by Database queries.
+type ArchivedRecord struct {
+	Record     Record
+	ArchivedAt time.Time
+}
+
+// RecordArchive defines the methods for a Conn that keeps archived
+// records of the public database.
+type RecordArchive interface {
+	// ArchiveRecord creates or replaces the archived copy of a record.
+	// The record itself is not removed from the record table.
+	ArchiveRecord(ctx context.Context, record *ArchivedRecord) error
+
+	// GetArchivedRecord returns the archived copy of a record.
+	// ErrArchivedRecordNotFound is returned if the record is not
+	// archived.
+	GetArchivedRecord(ctx context.Context, id RecordID, record *ArchivedRecord) error
+}
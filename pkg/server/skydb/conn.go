@@ -15,6 +15,7 @@
 package skydb
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -54,24 +55,28 @@ type QueryConfig struct {
 }
 
 // Conn encapsulates the interface of an Skygear Server connection to a container.
+//
+// Methods accessing the container take the context of the request
+// served as the first argument. Implementations should stop or cancel an
+// operation in progress once the context is done.
 type Conn interface {
 	// CRUD of UserInfo, smell like a bad design to attach these onto
 	// a Conn, but looks very convenient to user.
 
 	// CreateUser creates a new UserInfo in the container
 	// this Conn associated to.
-	CreateUser(userinfo *UserInfo) error
+	CreateUser(ctx context.Context, userinfo *UserInfo) error
 
 	// GetUser fetches the UserInfo with supplied ID in the container and
 	// fills in the supplied UserInfo with the result.
 	//
 	// GetUser returns ErrUserNotFound if no UserInfo exists
 	// for the supplied ID.
-	GetUser(id string, userinfo *UserInfo) error
+	GetUser(ctx context.Context, id string, userinfo *UserInfo) error
 
 	// GetUserByUsernameEmail fetch the UserInfo with supplied username or email,
 	//
-	GetUserByUsernameEmail(username string, email string, userinfo *UserInfo) error
+	GetUserByUsernameEmail(ctx context.Context, username string, email string, userinfo *UserInfo) error
 
 	// GetUserByPrincipalID fetches the UserInfo with supplied principal ID in the
 	// container and fills in the supplied UserInfo with the result.
@@ -81,81 +86,95 @@ type Conn interface {
 	//
 	// GetUserByPrincipalID returns ErrUserNotFound if no UserInfo exists
 	// for the supplied principal ID.
-	GetUserByPrincipalID(principalID string, userinfo *UserInfo) error
+	GetUserByPrincipalID(ctx context.Context, principalID string, userinfo *UserInfo) error
 
 	// UpdateUser updates an existing UserInfo matched by the ID field.
 	//
 	// UpdateUser returns ErrUserNotFound if such UserInfo does not
 	// exist in the container.
-	UpdateUser(userinfo *UserInfo) error
+	UpdateUser(ctx context.Context, userinfo *UserInfo) error
 
 	// QueryUser queries for UserInfo matching one of the specified emails.
-	QueryUser(emails []string, usernames []string) ([]UserInfo, error)
+	QueryUser(ctx context.Context, emails []string, usernames []string) ([]UserInfo, error)
 
 	// DeleteUser removes UserInfo with the supplied ID in the container.
 	//
 	// DeleteUser returns ErrUserNotFound if such UserInfo does not
 	// exist in the container.
-	DeleteUser(id string) error
+	DeleteUser(ctx context.Context, id string) error
 
 	// GetAdminRoles return the current admine roles
-	GetAdminRoles() ([]string, error)
+	GetAdminRoles(ctx context.Context) ([]string, error)
 
 	// SetAdminRoles accepts array of role, the order will be
-	SetAdminRoles(roles []string) error
+	SetAdminRoles(ctx context.Context, roles []string) error
 
 	// GetDefaultRoles return the current default roles
-	GetDefaultRoles() ([]string, error)
+	GetDefaultRoles(ctx context.Context) ([]string, error)
 
 	// SetDefaultRoles accepts array of roles, the supplied roles will assigned
 	// to newly created user CreateUser
-	SetDefaultRoles(roles []string) error
+	SetDefaultRoles(ctx context.Context, roles []string) error
+
+	// AssignUserRoles assigns the supplied roles to the user of the
+	// supplied ID in addition to the roles the user has. Roles not yet
+	// defined are created.
+	AssignUserRoles(ctx context.Context, userID string, roles []string) error
+
+	// RevokeUserRoles revokes the supplied roles from the user of the
+	// supplied ID. Roles the user does not have are ignored.
+	RevokeUserRoles(ctx context.Context, userID string, roles []string) error
 
 	// SetRecordAccess sets default record access of a specific type
-	SetRecordAccess(recordType string, acl RecordACL) error
+	SetRecordAccess(ctx context.Context, recordType string, acl RecordACL) error
 
 	// GetRecordAccess returns default record access of a specific type
-	GetRecordAccess(recordType string) (RecordACL, error)
+	GetRecordAccess(ctx context.Context, recordType string) (RecordACL, error)
 
 	// GetAsset retrieves Asset information by its name
-	GetAsset(name string, asset *Asset) error
+	GetAsset(ctx context.Context, name string, asset *Asset) error
 
-	GetAssets(names []string) ([]Asset, error)
+	GetAssets(ctx context.Context, names []string) ([]Asset, error)
 
 	// SaveAsset saves an Asset information into a container to
 	// be referenced by records.
-	SaveAsset(asset *Asset) error
+	SaveAsset(ctx context.Context, asset *Asset) error
 
-	QueryRelation(user string, name string, direction string, config QueryConfig) []UserInfo
-	QueryRelationCount(user string, name string, direction string) (uint64, error)
-	AddRelation(user string, name string, targetUser string) error
-	RemoveRelation(user string, name string, targetUser string) error
+	QueryRelation(ctx context.Context, user string, name string, direction string, config QueryConfig) []UserInfo
+	QueryRelationCount(ctx context.Context, user string, name string, direction string) (uint64, error)
+	AddRelation(ctx context.Context, user string, name string, targetUser string) error
+	RemoveRelation(ctx context.Context, user string, name string, targetUser string) error
 
-	GetDevice(id string, device *Device) error
+	GetDevice(ctx context.Context, id string, device *Device) error
 
 	// QueryDevicesByUser queries the Device database which are registered
 	// by the specified user.
-	QueryDevicesByUser(user string) ([]Device, error)
-	QueryDevicesByUserAndTopic(user, topic string) ([]Device, error)
-	SaveDevice(device *Device) error
-	DeleteDevice(id string) error
+	QueryDevicesByUser(ctx context.Context, user string) ([]Device, error)
+	QueryDevicesByUserAndTopic(ctx context.Context, user, topic string) ([]Device, error)
+	SaveDevice(ctx context.Context, device *Device) error
+	DeleteDevice(ctx context.Context, id string) error
 
 	// DeleteDevicesByToken deletes device where its Token == token and
 	// LastRegisteredAt < t. If t == ZeroTime, LastRegisteredAt is not considered.
 	//
 	// If such device does not exist, ErrDeviceNotFound is returned.
-	DeleteDevicesByToken(token string, t time.Time) error
+	DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error
 
 	// DeleteEmptyDevicesByTime deletes device where Token is empty and
 	// LastRegisteredAt < t. If t == ZeroTime, LastRegisteredAt is not considered.
 	//
 	// If such device does not exist, ErrDeviceNotFound is returned.
-	DeleteEmptyDevicesByTime(t time.Time) error
+	DeleteEmptyDevicesByTime(ctx context.Context, t time.Time) error
 
 	PublicDB() Database
 	PrivateDB(userKey string) Database
 	UnionDB() Database
 
+	// UserUnionDB returns a read-only UnionDatabase that contains the
+	// records in the PublicDatabase and the PrivateDatabase of the
+	// specified user. ACL settings apply to the public records.
+	UserUnionDB(userKey string) Database
+
 	// Subscribe registers the specified recordEventChan to receive
 	// RecordEvent from the Conn implementation
 	Subscribe(recordEventChan chan RecordEvent) error
@@ -163,6 +182,14 @@ type Conn interface {
 	Close() error
 }
 
+// SchemaPrivilegeChecker is implemented by Conn that can tell whether
+// its database credentials are allowed to change the database schema.
+type SchemaPrivilegeChecker interface {
+	// CanModifySchema returns whether the connection can create, alter
+	// or drop the tables of the app.
+	CanModifySchema(ctx context.Context) (bool, error)
+}
+
 // AccessModel indicates the type of access control model while db query.
 //go:generate stringer -type=AccessModel
 type AccessModel int
@@ -192,7 +219,42 @@ const (
 // For RecordCreated or RecordUpdated event, Record is the newly
 // created / updated Record. For RecordDeleted, Record is the Record
 // being deleted.
+//
+// Ack acknowledges that the event is handled. A Conn implementation
+// that delivers events at least once re-delivers an event that is not
+// acknowledged, so the receiver should only call Ack after the event is
+// handled successfully. Ack is nil if the Conn does not re-deliver
+// events.
+//
+// Deliveries records the receivers the event is delivered to, such as a
+// subscription or an observer, so that a re-delivered event is not
+// delivered to the same receiver twice. Deliveries is nil if the Conn
+// does not re-deliver events.
 type RecordEvent struct {
-	Record *Record
-	Event  RecordHookEvent
+	Record     *Record
+	Event      RecordHookEvent
+	Ack        func()
+	Deliveries DeliveryLog
+}
+
+// IsDelivered returns whether the event was delivered to the receiver
+// in an earlier delivery of the event.
+func (e RecordEvent) IsDelivered(receiver string) bool {
+	if e.Deliveries == nil {
+		return false
+	}
+	return e.Deliveries.IsDelivered(receiver)
+}
+
+// MarkDelivered records that the event is delivered to the receiver.
+func (e RecordEvent) MarkDelivered(receiver string) {
+	if e.Deliveries != nil {
+		e.Deliveries.MarkDelivered(receiver)
+	}
+}
+
+// DeliveryLog records the receivers a RecordEvent is delivered to.
+type DeliveryLog interface {
+	IsDelivered(receiver string) bool
+	MarkDelivered(receiver string)
 }
@@ -15,8 +15,10 @@
 package skydb
 
 import (
+	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 // ErrRecordNotFound is returned from Get and Delete when Database
@@ -63,11 +65,18 @@ const (
 	// UnionDatabase is a database containing all records in the PublicDatabase
 	// and all PrivateDatabase. This database is only intended for admin
 	// user and ACL settings do not apply.
+	//
+	// A UnionDatabase obtained from Conn.UserUnionDB contains only the
+	// records in the PublicDatabase and the PrivateDatabase of a single
+	// user, with ACL settings applied to the public records.
 	UnionDatabase
 )
 
 // Database represents a collection of record (either public or private)
 // in a container.
+//
+// Like Conn, methods accessing the records take the context of the
+// request served as the first argument.
 type Database interface {
 
 	// Conn returns the parent Conn of the Database
@@ -95,15 +104,15 @@ type Database interface {
 	// the supplied key does not exist in the Database.
 	// It also returns error if the underlying implementation
 	// failed to read the Record.
-	Get(id RecordID, record *Record) error
-	GetByIDs(ids []RecordID) (*Rows, error)
+	Get(ctx context.Context, id RecordID, record *Record) error
+	GetByIDs(ctx context.Context, ids []RecordID) (*Rows, error)
 
 	// Save updates the supplied Record in the Database if Record with
 	// the same key exists, else such Record is created.
 	//
 	// Save returns an error if the underlying implementation failed to
 	// create / modify the Record.
-	Save(record *Record) error
+	Save(ctx context.Context, record *Record) error
 
 	// Delete removes the Record identified by the key in the Database.
 	//
@@ -111,15 +120,15 @@ type Database interface {
 	// the supplied key does not exist in the Database.
 	// It also returns an error if the underlying implementation
 	// failed to remove the Record.
-	Delete(id RecordID) error
+	Delete(ctx context.Context, id RecordID) error
 
 	// Query executes the supplied query against the Database and returns
 	// an Rows to iterate the results.
-	Query(query *Query) (*Rows, error)
+	Query(ctx context.Context, query *Query) (*Rows, error)
 
 	// QueryCount executes the supplied query against the Database and returns
 	// the number of records matching the query's predicate.
-	QueryCount(query *Query) (uint64, error)
+	QueryCount(ctx context.Context, query *Query) (uint64, error)
 
 	// Extend extends the Database record schema such that a record
 	// arrived subsequently with that schema can be saved
@@ -127,25 +136,25 @@ type Database interface {
 	// Extend returns an bool indicating whether the schema is really extended.
 	// Extend also returns an error if the specified schema conflicts with
 	// existing schema in the Database
-	Extend(recordType string, schema RecordSchema) (extended bool, err error)
+	Extend(ctx context.Context, recordType string, schema RecordSchema) (extended bool, err error)
 
 	// RenameSchema renames a column of the Database record schema
-	RenameSchema(recordType, oldColumnName, newColumnName string) error
+	RenameSchema(ctx context.Context, recordType, oldColumnName, newColumnName string) error
 
 	// DeleteSchema removes a column of the Database record schema
-	DeleteSchema(recordType, columnName string) error
+	DeleteSchema(ctx context.Context, recordType, columnName string) error
 
 	// GetSchema returns the record schema of a record type
-	GetSchema(recordType string) (RecordSchema, error)
+	GetSchema(ctx context.Context, recordType string) (RecordSchema, error)
 
 	// FetchRecordTypes returns a list of all existing record type
-	GetRecordSchemas() (map[string]RecordSchema, error)
+	GetRecordSchemas(ctx context.Context) (map[string]RecordSchema, error)
 
-	GetSubscription(key string, deviceID string, subscription *Subscription) error
-	SaveSubscription(subscription *Subscription) error
-	DeleteSubscription(key string, deviceID string) error
-	GetSubscriptionsByDeviceID(deviceID string) []Subscription
-	GetMatchingSubscriptions(record *Record) []Subscription
+	GetSubscription(ctx context.Context, key string, deviceID string, subscription *Subscription) error
+	SaveSubscription(ctx context.Context, subscription *Subscription) error
+	DeleteSubscription(ctx context.Context, key string, deviceID string) error
+	GetSubscriptionsByDeviceID(ctx context.Context, deviceID string) []Subscription
+	GetMatchingSubscriptions(ctx context.Context, record *Record) []Subscription
 }
 
 // TxDatabase defines the methods for a Database that supports
@@ -160,7 +169,7 @@ type TxDatabase interface {
 	// Begin opens a transaction for the current Database.
 	//
 	// Calling Begin on an already Begin'ed Database returns ErrDatabaseTxDidBegin.
-	Begin() error
+	Begin(ctx context.Context) error
 
 	// Commit saves all the changes made to Database after Begin atomically.
 	Commit() error
@@ -169,6 +178,59 @@ type TxDatabase interface {
 	Rollback() error
 }
 
+// QueryPlan describes how a Database executes a Query.
+type QueryPlan struct {
+	// Statement is the statement generated for the query, with its
+	// arguments in Args.
+	Statement string        `json:"statement"`
+	Args      []interface{} `json:"args"`
+
+	// Indexes are the names of the indexes chosen to execute the query.
+	Indexes []string `json:"indexes"`
+
+	// Plan is the plan of the query as reported by the underlying
+	// implementation.
+	Plan interface{} `json:"plan"`
+
+	PlanningTime  time.Duration `json:"-"`
+	ExecutionTime time.Duration `json:"-"`
+}
+
+// QueryExplainer defines the methods for a Database that supports
+// explaining queries.
+type QueryExplainer interface {
+	// ExplainQuery executes the supplied query and returns its
+	// QueryPlan.
+	ExplainQuery(ctx context.Context, query *Query) (*QueryPlan, error)
+}
+
+// DatabaseUsage describes the storage used by the records in a Database.
+type DatabaseUsage struct {
+	RecordCount uint64 `json:"record_count"`
+
+	// StorageSize is the size of the records in bytes.
+	StorageSize uint64 `json:"storage_size"`
+}
+
+// UsageCounter defines the methods for a Database that supports
+// reporting the storage used by its records.
+type UsageCounter interface {
+	// Usage returns the DatabaseUsage of all record types.
+	Usage(ctx context.Context) (DatabaseUsage, error)
+}
+
+// RecordRanker defines the methods for a Database that supports finding
+// records ranked around a record.
+type RecordRanker interface {
+	// QueryRankAround ranks the records matching query with rank, and
+	// returns the record of id together with at most around records
+	// ranked immediately before and after it, in the order of rank. The
+	// rank of each record is put in its Transient under the key "_rank".
+	//
+	// No records are returned if the record of id does not match query.
+	QueryRankAround(ctx context.Context, query *Query, rank RankFunc, id string, around uint64) (*Rows, error)
+}
+
 // Rows implements a scanner-like interface for easy iteration on a
 // result set returned from a query
 type Rows struct {
@@ -15,7 +15,9 @@
 package skydb
 
 import (
+	"context"
 	"fmt"
+	"time"
 )
 
 var drivers = map[string]Driver{}
@@ -35,6 +37,66 @@ func Register(name string, driver Driver) {
 	drivers[name] = driver
 }
 
+// DriverCloser is implemented by a Driver that keeps connections to the
+// underlying database open across Conns.
+type DriverCloser interface {
+	Close() error
+}
+
+// CloseDrivers closes the connections kept open by registered drivers,
+// such as on server shutdown. It returns the last error encountered.
+func CloseDrivers() error {
+	var lastErr error
+	for _, driver := range drivers {
+		if closer, ok := driver.(DriverCloser); ok {
+			if err := closer.Close(); err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+// PoolOptions configures the pools of connections kept open by drivers
+// across Conns. Zero MaxOpenConns or ConnMaxLifetime means unlimited,
+// and zero MaxIdleConns means idle connections are not kept.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DriverPooler is implemented by a Driver that keeps a pool of
+// connections to the underlying database open across Conns.
+//
+// SetAppPoolOptions configures the pools of an app, overriding the
+// options set by SetPoolOptions for that app.
+type DriverPooler interface {
+	SetPoolOptions(options PoolOptions)
+	SetAppPoolOptions(appName string, options PoolOptions)
+}
+
+// SetPoolOptions configures the connection pools of registered drivers,
+// including the pools already open. Each database opened by a driver
+// has a pool of its own.
+func SetPoolOptions(options PoolOptions) {
+	for _, driver := range drivers {
+		if pooler, ok := driver.(DriverPooler); ok {
+			pooler.SetPoolOptions(options)
+		}
+	}
+}
+
+// SetAppPoolOptions configures the connection pools of registered
+// drivers opened for appName, including the pools already open.
+func SetAppPoolOptions(appName string, options PoolOptions) {
+	for _, driver := range drivers {
+		if pooler, ok := driver.(DriverPooler); ok {
+			pooler.SetAppPoolOptions(appName, options)
+		}
+	}
+}
+
 // unregisterAllDrivers unregisters all previously registered drivers.
 // Intended for testing.
 func unregisterAllDrivers() {
@@ -63,10 +125,10 @@ func GetAccessModel(accessString string) AccessModel {
 // optionString is passed to the driver and is implementation specific.
 // For example, in a SQL implementation it will be something
 // like "sql://localhost/db0"
-func Open(implName string, appName string, accessString string, optionString string, migrate bool) (Conn, error) {
+func Open(ctx context.Context, implName string, appName string, accessString string, optionString string, migrate bool) (Conn, error) {
 	accessModel := GetAccessModel(accessString)
 	if driver, ok := drivers[implName]; ok {
-		return driver.Open(appName, accessModel, optionString, migrate)
+		return driver.Open(ctx, appName, accessModel, optionString, migrate)
 	}
 
 	return nil, fmt.Errorf("Implementation not registered: %v", implName)
@@ -15,7 +15,9 @@
 package skydb
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 type fakeConn struct {
@@ -29,7 +31,7 @@ type fakeDriver struct {
 	Driver
 }
 
-func (driver fakeDriver) Open(appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error) {
+func (driver fakeDriver) Open(ctx context.Context, appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error) {
 	return fakeConn{
 		AppName:      appName,
 		AccessModel:  accessModel,
@@ -42,7 +44,7 @@ func TestOpen(t *testing.T) {
 
 	Register("fakeImpl", fakeDriver{})
 
-	if driver, err := Open("fakeImpl", "com.example.app.test", "role", "fakeOption", true); err != nil {
+	if driver, err := Open(context.Background(), "fakeImpl", "com.example.app.test", "role", "fakeOption", true); err != nil {
 		t.Fatalf("got err: %v, want a driver", err.Error())
 	} else {
 		if driver, ok := driver.(fakeConn); !ok {
@@ -60,3 +62,68 @@ func TestOpen(t *testing.T) {
 		}
 	}
 }
+
+type fakeClosingDriver struct {
+	fakeDriver
+	closed bool
+}
+
+func (driver *fakeClosingDriver) Close() error {
+	driver.closed = true
+	return nil
+}
+
+func TestCloseDrivers(t *testing.T) {
+	defer unregisterAllDrivers()
+
+	closingDriver := &fakeClosingDriver{}
+	Register("fakeImpl", fakeDriver{})
+	Register("closingImpl", closingDriver)
+
+	if err := CloseDrivers(); err != nil {
+		t.Fatalf("got err: %v, want nil", err)
+	}
+	if !closingDriver.closed {
+		t.Fatalf("got closingDriver.closed = false, want true")
+	}
+}
+
+type fakePoolingDriver struct {
+	fakeDriver
+	options     PoolOptions
+	appOptions  PoolOptions
+	appNameSeen string
+}
+
+func (driver *fakePoolingDriver) SetPoolOptions(options PoolOptions) {
+	driver.options = options
+}
+
+func (driver *fakePoolingDriver) SetAppPoolOptions(appName string, options PoolOptions) {
+	driver.appNameSeen = appName
+	driver.appOptions = options
+}
+
+func TestSetPoolOptions(t *testing.T) {
+	defer unregisterAllDrivers()
+
+	poolingDriver := &fakePoolingDriver{}
+	Register("fakeImpl", fakeDriver{})
+	Register("poolingImpl", poolingDriver)
+
+	options := PoolOptions{
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Minute,
+	}
+	SetPoolOptions(options)
+	if poolingDriver.options != options {
+		t.Fatalf("got poolingDriver.options = %v, want %v", poolingDriver.options, options)
+	}
+
+	appOptions := PoolOptions{MaxOpenConns: 5}
+	SetAppPoolOptions("shop", appOptions)
+	if poolingDriver.appNameSeen != "shop" || poolingDriver.appOptions != appOptions {
+		t.Fatalf("got poolingDriver app options = %v %v, want shop %v", poolingDriver.appNameSeen, poolingDriver.appOptions, appOptions)
+	}
+}
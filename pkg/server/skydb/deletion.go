@@ -0,0 +1,37 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"time"
+)
+
+// DeletedRecord is a record deleted from a Database.
+type DeletedRecord struct {
+	ID        RecordID
+	DeletedAt time.Time
+}
+
+// RecordDeletionLog defines the methods for a Database that keeps the
+// IDs of deleted records, so that clients holding copies of them can
+// remove the copies.
+type RecordDeletionLog interface {
+	// QueryDeletedRecords returns the records of recordType deleted
+	// after since and no later than until, ordered by the time of
+	// deletion. A record created again after its deletion is not
+	// returned.
+	QueryDeletedRecords(ctx context.Context, recordType string, since time.Time, until time.Time) ([]DeletedRecord, error)
+}
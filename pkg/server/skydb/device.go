@@ -14,7 +14,10 @@
 
 package skydb
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Device represents a device owned by a user and ready to receive notification.
 type Device struct {
@@ -25,3 +28,16 @@ type Device struct {
 	Topic            string
 	LastRegisteredAt time.Time
 }
+
+// DeviceMerger is implemented by Conn that can merge devices, so that a
+// device registering a rotated token keeps its subscriptions instead of
+// being duplicated.
+type DeviceMerger interface {
+	// QueryDevicesByToken returns all devices having the specified token.
+	QueryDevicesByToken(ctx context.Context, token string) ([]Device, error)
+
+	// MergeDevices moves subscriptions of the devices of mergedIDs to the
+	// device of id and deletes the merged devices. Subscriptions that
+	// already exist on the device of id are not moved.
+	MergeDevices(ctx context.Context, id string, mergedIDs []string) error
+}
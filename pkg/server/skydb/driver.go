@@ -14,16 +14,24 @@
 
 package skydb
 
+import (
+	"context"
+)
+
 // Driver opens an connection to the underlying database.
+//
+// Implementations should give up opening the Conn once ctx is done. ctx
+// does not apply to the Conn returned, whose methods take a context of
+// their own.
 type Driver interface {
-	Open(appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error)
+	Open(ctx context.Context, appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error)
 }
 
 // The DriverFunc type is an adapter such that an ordinary function
 // can be used as a Driver.
-type DriverFunc func(appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error)
+type DriverFunc func(ctx context.Context, appName string, accessModel AccessModel, optionString string, migrate bool) (Conn, error)
 
 // Open returns a Conn by calling the DriverFunc itself.
-func (f DriverFunc) Open(appName string, accessModel AccessModel, name string, migrate bool) (Conn, error) {
-	return f(appName, accessModel, name, migrate)
+func (f DriverFunc) Open(ctx context.Context, appName string, accessModel AccessModel, name string, migrate bool) (Conn, error) {
+	return f(ctx, appName, accessModel, name, migrate)
 }
@@ -0,0 +1,139 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// MatchRecord returns whether the record satisfies the predicate without
+// querying the database. An empty predicate matches every record.
+//
+// Only the operators And, Or, Not, Equal, NotEqual and In are supported,
+// and the method panics on others. Use CanMatchRecord to check for a
+// predicate beforehand.
+func (p Predicate) MatchRecord(record *Record) (b bool) {
+	if p.IsEmpty() {
+		return true
+	}
+
+	switch p.Operator {
+	case And:
+		b = true
+		for _, childPred := range p.GetSubPredicates() {
+			if !childPred.MatchRecord(record) {
+				b = false
+				break
+			}
+		}
+	case Or:
+		for _, childPred := range p.GetSubPredicates() {
+			if childPred.MatchRecord(record) {
+				b = true
+				break
+			}
+		}
+	case Not:
+		b = !p.GetSubPredicates()[0].MatchRecord(record)
+	case Equal:
+		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
+		return reflect.DeepEqual(lv, rv)
+	// case GreaterThan:
+	// case LessThan:
+	// case GreaterThanOrEqual:
+	// case LessThanOrEqual:
+	case NotEqual:
+		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
+		return !reflect.DeepEqual(lv, rv)
+	case In:
+		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
+		haystack, ok := rv.([]interface{})
+		if !ok {
+			log.Panicf("unknown value in right hand side of `In` operand = %v", rv)
+		}
+
+		return deepEqualIn(lv, haystack)
+	// case Like:
+	// case ILike:
+	default:
+		log.Panicf("unknown Predicate.Operator = %v", p.Operator)
+	}
+
+	return
+}
+
+// CanMatchRecord returns whether MatchRecord supports the predicate.
+func (p Predicate) CanMatchRecord() bool {
+	if p.IsEmpty() {
+		return true
+	}
+
+	switch p.Operator {
+	case And, Or, Not:
+		for _, childPred := range p.Children {
+			pred, ok := childPred.(Predicate)
+			if !ok || !pred.CanMatchRecord() {
+				return false
+			}
+		}
+		return true
+	case Equal, NotEqual, In:
+		for _, child := range p.Children {
+			expr, ok := child.(Expression)
+			if !ok || expr.Type == Function || expr.Type == Variable {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func extractBinaryOperands(exprs []Expression, record *Record) (lv interface{}, rv interface{}) {
+	lv = extractValue(exprs[0], record)
+	rv = extractValue(exprs[1], record)
+	return
+}
+
+func extractValue(expr Expression, record *Record) interface{} {
+	switch expr.Type {
+	case Literal:
+		switch expr.Value.(type) {
+		case bool, float64, string, time.Time, *Location, Reference, []interface{}:
+			return expr.Value
+		default:
+			panic(fmt.Sprintf("unknown type %[1]T of Expression.Value = %[1]v", expr.Value))
+		}
+	case KeyPath:
+		return record.Get(expr.Value.(string))
+	case Function:
+		panic("unsupported type of predicate expression = Function")
+	case Variable:
+		panic("predicate variable must be resolved before matching")
+	}
+
+	panic("unreachable code")
+}
+
+func deepEqualIn(needle interface{}, haystack []interface{}) bool {
+	for _, hay := range haystack {
+		if reflect.DeepEqual(needle, hay) {
+			return true
+		}
+	}
+	return false
+}
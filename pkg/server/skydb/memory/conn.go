@@ -0,0 +1,552 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+type conn struct {
+	store   *store
+	appName string
+
+	// backup is the records at the time the transaction began, nil
+	// when no transaction is in progress.
+	backup map[string]map[skydb.RecordID]skydb.Record
+}
+
+func (c *conn) CreateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if _, ok := c.store.users[userinfo.ID]; ok {
+		return skydb.ErrUserDuplicated
+	}
+	for _, u := range c.store.users {
+		if userinfo.Username != "" && strings.EqualFold(u.Username, userinfo.Username) {
+			return skydb.ErrUserDuplicated
+		}
+		if userinfo.Email != "" && strings.EqualFold(u.Email, userinfo.Email) {
+			return skydb.ErrUserDuplicated
+		}
+	}
+
+	if len(userinfo.Roles) == 0 {
+		userinfo.Roles = append([]string{}, c.store.defaultRoles...)
+	}
+	c.store.users[userinfo.ID] = copyUserInfo(*userinfo)
+	return nil
+}
+
+func (c *conn) GetUser(ctx context.Context, id string, userinfo *skydb.UserInfo) error {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	u, ok := c.store.users[id]
+	if !ok {
+		return skydb.ErrUserNotFound
+	}
+	*userinfo = copyUserInfo(u)
+	return nil
+}
+
+func (c *conn) GetUserByUsernameEmail(ctx context.Context, username string, email string, userinfo *skydb.UserInfo) error {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	if username == "" && email == "" {
+		return skydb.ErrUserNotFound
+	}
+	for _, u := range c.store.users {
+		if username != "" && !strings.EqualFold(u.Username, username) {
+			continue
+		}
+		if email != "" && !strings.EqualFold(u.Email, email) {
+			continue
+		}
+		*userinfo = copyUserInfo(u)
+		return nil
+	}
+	return skydb.ErrUserNotFound
+}
+
+func (c *conn) GetUserByPrincipalID(ctx context.Context, principalID string, userinfo *skydb.UserInfo) error {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	for _, u := range c.store.users {
+		if _, ok := u.Auth[principalID]; ok {
+			*userinfo = copyUserInfo(u)
+			return nil
+		}
+	}
+	return skydb.ErrUserNotFound
+}
+
+func (c *conn) UpdateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if _, ok := c.store.users[userinfo.ID]; !ok {
+		return skydb.ErrUserNotFound
+	}
+	for id, u := range c.store.users {
+		if id == userinfo.ID {
+			continue
+		}
+		if userinfo.Username != "" && strings.EqualFold(u.Username, userinfo.Username) {
+			return skydb.ErrUserDuplicated
+		}
+		if userinfo.Email != "" && strings.EqualFold(u.Email, userinfo.Email) {
+			return skydb.ErrUserDuplicated
+		}
+	}
+
+	c.store.users[userinfo.ID] = copyUserInfo(*userinfo)
+	return nil
+}
+
+func (c *conn) QueryUser(ctx context.Context, emails []string, usernames []string) ([]skydb.UserInfo, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	results := []skydb.UserInfo{}
+	for _, u := range c.sortedUsers() {
+		if (u.Email != "" && containsFold(emails, u.Email)) ||
+			(u.Username != "" && containsFold(usernames, u.Username)) {
+			results = append(results, copyUserInfo(u))
+		}
+	}
+	return results, nil
+}
+
+func (c *conn) DeleteUser(ctx context.Context, id string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if _, ok := c.store.users[id]; !ok {
+		return skydb.ErrUserNotFound
+	}
+	delete(c.store.users, id)
+	return nil
+}
+
+func (c *conn) GetAdminRoles(ctx context.Context) ([]string, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	return append([]string{}, c.store.adminRoles...), nil
+}
+
+func (c *conn) SetAdminRoles(ctx context.Context, roles []string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.adminRoles = append([]string{}, roles...)
+	return nil
+}
+
+func (c *conn) GetDefaultRoles(ctx context.Context) ([]string, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	return append([]string{}, c.store.defaultRoles...), nil
+}
+
+func (c *conn) SetDefaultRoles(ctx context.Context, roles []string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.defaultRoles = append([]string{}, roles...)
+	return nil
+}
+
+func (c *conn) AssignUserRoles(ctx context.Context, userID string, roles []string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	userinfo, ok := c.store.users[userID]
+	if !ok {
+		return skydb.ErrUserNotFound
+	}
+	userinfo = copyUserInfo(userinfo)
+	for _, role := range roles {
+		if !userinfo.HasAnyRoles([]string{role}) {
+			userinfo.Roles = append(userinfo.Roles, role)
+		}
+	}
+	c.store.users[userID] = userinfo
+	return nil
+}
+
+func (c *conn) RevokeUserRoles(ctx context.Context, userID string, roles []string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	userinfo, ok := c.store.users[userID]
+	if !ok {
+		return skydb.ErrUserNotFound
+	}
+	remaining := []string{}
+	for _, role := range userinfo.Roles {
+		if !contains(roles, role) {
+			remaining = append(remaining, role)
+		}
+	}
+	userinfo.Roles = remaining
+	c.store.users[userID] = userinfo
+	return nil
+}
+
+func (c *conn) SetRecordAccess(ctx context.Context, recordType string, acl skydb.RecordACL) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.recordAccess[recordType] = append(skydb.RecordACL{}, acl...)
+	return nil
+}
+
+func (c *conn) GetRecordAccess(ctx context.Context, recordType string) (skydb.RecordACL, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	acl, ok := c.store.recordAccess[recordType]
+	if !ok {
+		return skydb.NewRecordACL([]skydb.RecordACLEntry{}), nil
+	}
+	return append(skydb.RecordACL{}, acl...), nil
+}
+
+func (c *conn) GetAsset(ctx context.Context, name string, asset *skydb.Asset) error {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	a, ok := c.store.assets[name]
+	if !ok {
+		return errors.New("asset not found")
+	}
+	*asset = a
+	return nil
+}
+
+func (c *conn) GetAssets(ctx context.Context, names []string) ([]skydb.Asset, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	assets := []skydb.Asset{}
+	for _, name := range names {
+		if a, ok := c.store.assets[name]; ok {
+			assets = append(assets, a)
+		}
+	}
+	return assets, nil
+}
+
+func (c *conn) SaveAsset(ctx context.Context, asset *skydb.Asset) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.assets[asset.Name] = *asset
+	return nil
+}
+
+func (c *conn) QueryRelation(ctx context.Context, user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	results := []skydb.UserInfo{}
+	for _, u := range c.sortedUsers() {
+		if c.related(user, name, direction, u.ID) {
+			results = append(results, skydb.UserInfo{
+				ID:       u.ID,
+				Username: u.Username,
+				Email:    u.Email,
+			})
+		}
+	}
+
+	if config.Offset >= uint64(len(results)) {
+		return []skydb.UserInfo{}
+	}
+	results = results[config.Offset:]
+	if config.Limit != 0 && config.Limit < uint64(len(results)) {
+		results = results[:config.Limit]
+	}
+	return results
+}
+
+func (c *conn) QueryRelationCount(ctx context.Context, user string, name string, direction string) (uint64, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	var count uint64
+	for id := range c.store.users {
+		if c.related(user, name, direction, id) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// related returns whether other is related to user in the direction.
+// The caller must hold the lock of the store.
+func (c *conn) related(user string, name string, direction string, other string) bool {
+	relations := c.store.relations[name]
+	outward := relations[relation{user, other}]
+	inward := relations[relation{other, user}]
+	switch direction {
+	case "outward":
+		return outward
+	case "inward":
+		return inward
+	default:
+		return outward && inward
+	}
+}
+
+func (c *conn) AddRelation(ctx context.Context, user string, name string, targetUser string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if _, ok := c.store.users[targetUser]; !ok {
+		return skydb.ErrUserNotFound
+	}
+	if c.store.relations[name] == nil {
+		c.store.relations[name] = map[relation]bool{}
+	}
+	c.store.relations[name][relation{user, targetUser}] = true
+	return nil
+}
+
+func (c *conn) RemoveRelation(ctx context.Context, user string, name string, targetUser string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	key := relation{user, targetUser}
+	if !c.store.relations[name][key] {
+		return skydb.ErrUserNotFound
+	}
+	delete(c.store.relations[name], key)
+	return nil
+}
+
+func (c *conn) GetDevice(ctx context.Context, id string, device *skydb.Device) error {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	d, ok := c.store.devices[id]
+	if !ok {
+		return skydb.ErrDeviceNotFound
+	}
+	*device = d
+	return nil
+}
+
+func (c *conn) QueryDevicesByUser(ctx context.Context, user string) ([]skydb.Device, error) {
+	return c.queryDevices(func(d skydb.Device) bool {
+		return d.UserInfoID == user
+	})
+}
+
+func (c *conn) QueryDevicesByUserAndTopic(ctx context.Context, user, topic string) ([]skydb.Device, error) {
+	return c.queryDevices(func(d skydb.Device) bool {
+		return d.UserInfoID == user && d.Topic == topic
+	})
+}
+
+func (c *conn) queryDevices(match func(skydb.Device) bool) ([]skydb.Device, error) {
+	c.store.mutex.RLock()
+	defer c.store.mutex.RUnlock()
+
+	devices := []skydb.Device{}
+	for _, d := range c.store.devices {
+		if match(d) {
+			devices = append(devices, d)
+		}
+	}
+	sort.Sort(devicesByID(devices))
+	return devices, nil
+}
+
+type devicesByID []skydb.Device
+
+func (s devicesByID) Len() int           { return len(s) }
+func (s devicesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s devicesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+func (c *conn) SaveDevice(ctx context.Context, device *skydb.Device) error {
+	if device.ID == "" || device.Type == "" || device.LastRegisteredAt.IsZero() {
+		return skydb.ErrDeviceNotFound
+	}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.devices[device.ID] = *device
+	return nil
+}
+
+func (c *conn) DeleteDevice(ctx context.Context, id string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if _, ok := c.store.devices[id]; !ok {
+		return skydb.ErrDeviceNotFound
+	}
+	delete(c.store.devices, id)
+	return nil
+}
+
+func (c *conn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
+	return c.deleteDevices(token, t)
+}
+
+func (c *conn) DeleteEmptyDevicesByTime(ctx context.Context, t time.Time) error {
+	return c.deleteDevices("", t)
+}
+
+func (c *conn) deleteDevices(token string, t time.Time) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	deleted := false
+	for id, d := range c.store.devices {
+		if d.Token != token {
+			continue
+		}
+		if t != skydb.ZeroTime && !d.LastRegisteredAt.Before(t) {
+			continue
+		}
+		delete(c.store.devices, id)
+		deleted = true
+	}
+	if !deleted {
+		return skydb.ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (c *conn) PublicDB() skydb.Database {
+	return &database{
+		c:            c,
+		databaseType: skydb.PublicDatabase,
+	}
+}
+
+func (c *conn) PrivateDB(userKey string) skydb.Database {
+	return &database{
+		c:            c,
+		databaseType: skydb.PrivateDatabase,
+		userID:       userKey,
+	}
+}
+
+func (c *conn) UnionDB() skydb.Database {
+	return &database{
+		c:            c,
+		databaseType: skydb.UnionDatabase,
+	}
+}
+
+func (c *conn) UserUnionDB(userKey string) skydb.Database {
+	return &database{
+		c:            c,
+		databaseType: skydb.UnionDatabase,
+		userID:       userKey,
+	}
+}
+
+func (c *conn) Subscribe(recordEventChan chan skydb.RecordEvent) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.subscribers = append(c.store.subscribers, recordEventChan)
+	return nil
+}
+
+// publish sends the event to the subscribed channels without blocking
+// the caller.
+func (c *conn) publish(record *skydb.Record, event skydb.RecordHookEvent) {
+	c.store.mutex.RLock()
+	subscribers := append([]chan skydb.RecordEvent{}, c.store.subscribers...)
+	c.store.mutex.RUnlock()
+
+	for _, ch := range subscribers {
+		recordCopy := copyRecord(*record)
+		go func(ch chan skydb.RecordEvent) {
+			ch <- skydb.RecordEvent{
+				Record: &recordCopy,
+				Event:  event,
+			}
+		}(ch)
+	}
+}
+
+func (c *conn) Close() error { return nil }
+
+// sortedUsers returns the users ordered by ID. The caller must hold the
+// lock of the store.
+func (c *conn) sortedUsers() []skydb.UserInfo {
+	users := make([]skydb.UserInfo, 0, len(c.store.users))
+	for _, u := range c.store.users {
+		users = append(users, u)
+	}
+	sort.Sort(usersByID(users))
+	return users
+}
+
+type usersByID []skydb.UserInfo
+
+func (s usersByID) Len() int           { return len(s) }
+func (s usersByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s usersByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+func copyUserInfo(userinfo skydb.UserInfo) skydb.UserInfo {
+	if userinfo.Roles != nil {
+		userinfo.Roles = append([]string{}, userinfo.Roles...)
+	}
+	if userinfo.Auth != nil {
+		auth := skydb.AuthInfo{}
+		for principalID, authData := range userinfo.Auth {
+			auth[principalID] = authData
+		}
+		userinfo.Auth = auth
+	}
+	return userinfo
+}
+
+func contains(ss []string, s string) bool {
+	for _, each := range ss {
+		if each == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, each := range ss {
+		if strings.EqualFold(each, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,457 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+type database struct {
+	c            *conn
+	userID       string
+	databaseType skydb.DatabaseType
+}
+
+func (db *database) Conn() skydb.Conn       { return db.c }
+func (db *database) UserRecordType() string { return "user" }
+
+func (db *database) ID() string {
+	if db.DatabaseType() == skydb.PublicDatabase {
+		return skydb.PublicDatabaseIdentifier
+	} else if db.DatabaseType() == skydb.UnionDatabase {
+		return skydb.UnionDatabaseIdentifier
+	}
+
+	if db.userID == "" {
+		panic("Private database but userID is empty")
+	}
+	return db.userID
+}
+
+func (db *database) DatabaseType() skydb.DatabaseType { return db.databaseType }
+func (db *database) IsReadOnly() bool                 { return db.DatabaseType() == skydb.UnionDatabase }
+
+// databaseIDs returns the IDs of the databases whose records are
+// visible in this database.
+func (db *database) databaseIDs() []string {
+	if db.DatabaseType() != skydb.UnionDatabase {
+		return []string{db.userID}
+	}
+	if db.userID != "" {
+		return []string{"", db.userID}
+	}
+
+	ids := []string{}
+	for id := range db.c.store.records {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (db *database) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	for _, databaseID := range db.databaseIDs() {
+		if r, ok := db.c.store.records[databaseID][id]; ok {
+			*record = copyRecord(r)
+			return nil
+		}
+	}
+	return skydb.ErrRecordNotFound
+}
+
+func (db *database) GetByIDs(ctx context.Context, ids []skydb.RecordID) (*skydb.Rows, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("db.GetByIDs received empty array")
+	}
+
+	records := []skydb.Record{}
+	for _, id := range ids {
+		var record skydb.Record
+		if err := db.Get(ctx, id, &record); err == skydb.ErrRecordNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return skydb.NewRows(skydb.NewMemoryRows(records)), nil
+}
+
+func (db *database) Save(ctx context.Context, record *skydb.Record) error {
+	if record.ID.Key == "" {
+		return errors.New("db.save: got empty record id")
+	}
+	if record.ID.Type == "" {
+		return fmt.Errorf("db.save %s: got empty record type", record.ID.Key)
+	}
+	if record.OwnerID == "" {
+		return fmt.Errorf("db.save %s: got empty OwnerID", record.ID.Key)
+	}
+	if db.IsReadOnly() {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+
+	db.c.store.mutex.Lock()
+	records, ok := db.c.store.records[db.userID]
+	if !ok {
+		records = map[skydb.RecordID]skydb.Record{}
+		db.c.store.records[db.userID] = records
+	}
+
+	event := skydb.RecordCreated
+	if origin, ok := records[record.ID]; ok {
+		event = skydb.RecordUpdated
+		record.OwnerID = origin.OwnerID
+		record.CreatedAt = origin.CreatedAt
+		record.CreatorID = origin.CreatorID
+	}
+	record.DatabaseID = db.userID
+	records[record.ID] = copyRecord(*record)
+	db.c.store.mutex.Unlock()
+
+	db.c.publish(record, event)
+	return nil
+}
+
+func (db *database) Delete(ctx context.Context, id skydb.RecordID) error {
+	if db.IsReadOnly() {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+
+	db.c.store.mutex.Lock()
+	record, ok := db.c.store.records[db.userID][id]
+	if !ok {
+		db.c.store.mutex.Unlock()
+		return skydb.ErrRecordNotFound
+	}
+	delete(db.c.store.records[db.userID], id)
+	db.c.store.mutex.Unlock()
+
+	db.c.publish(&record, skydb.RecordDeleted)
+	return nil
+}
+
+func (db *database) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	records, count, err := db.query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &memoryRows{MemoryRows: skydb.NewMemoryRows(records)}
+	if query.GetCount {
+		rows.count = &count
+	}
+	return skydb.NewRows(rows), nil
+}
+
+func (db *database) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
+	countQuery := *query
+	countQuery.Limit = nil
+	countQuery.Offset = 0
+	_, count, err := db.query(&countQuery)
+	return count, err
+}
+
+func (db *database) Extend(ctx context.Context, recordType string, recordSchema skydb.RecordSchema) (extended bool, err error) {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	schema, ok := db.c.store.schemas[recordType]
+	if !ok {
+		schema = skydb.RecordSchema{}
+		db.c.store.schemas[recordType] = schema
+		extended = true
+	}
+
+	for key, fieldType := range recordSchema {
+		if existing, ok := schema[key]; ok {
+			if !existing.DefinitionEquals(fieldType) {
+				return false, fmt.Errorf("conflicting schema %v => %v", existing, fieldType)
+			}
+			continue
+		}
+		schema[key] = fieldType
+		extended = true
+	}
+	return extended, nil
+}
+
+func (db *database) RenameSchema(ctx context.Context, recordType, oldName, newName string) error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	schema, ok := db.c.store.schemas[recordType]
+	if !ok {
+		return fmt.Errorf("record type %s does not exist", recordType)
+	}
+	fieldType, ok := schema[oldName]
+	if !ok {
+		return fmt.Errorf("column %s does not exist", oldName)
+	}
+	if _, ok := schema[newName]; ok {
+		return fmt.Errorf("column %s already exists", newName)
+	}
+
+	schema[newName] = fieldType
+	delete(schema, oldName)
+	for _, records := range db.c.store.records {
+		for id, record := range records {
+			if id.Type != recordType {
+				continue
+			}
+			if value, ok := record.Data[oldName]; ok {
+				record.Data[newName] = value
+				delete(record.Data, oldName)
+			}
+		}
+	}
+	return nil
+}
+
+func (db *database) DeleteSchema(ctx context.Context, recordType, columnName string) error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	schema, ok := db.c.store.schemas[recordType]
+	if !ok {
+		return fmt.Errorf("record type %s does not exist", recordType)
+	}
+	if _, ok := schema[columnName]; !ok {
+		return fmt.Errorf("column %s does not exist", columnName)
+	}
+
+	delete(schema, columnName)
+	for _, records := range db.c.store.records {
+		for id, record := range records {
+			if id.Type == recordType {
+				delete(record.Data, columnName)
+			}
+		}
+	}
+	return nil
+}
+
+func (db *database) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	return copySchema(db.c.store.schemas[recordType]), nil
+}
+
+func (db *database) GetRecordSchemas(ctx context.Context) (map[string]skydb.RecordSchema, error) {
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	schemas := map[string]skydb.RecordSchema{}
+	for recordType, schema := range db.c.store.schemas {
+		schemas[recordType] = copySchema(schema)
+	}
+	return schemas, nil
+}
+
+func (db *database) GetSubscription(ctx context.Context, key string, deviceID string, subscription *skydb.Subscription) error {
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	s, ok := db.c.store.subscriptions[db.userID][deviceID+"/"+key]
+	if !ok {
+		return skydb.ErrSubscriptionNotFound
+	}
+	*subscription = s
+	return nil
+}
+
+func (db *database) SaveSubscription(ctx context.Context, subscription *skydb.Subscription) error {
+	if subscription.ID == "" {
+		return errors.New("empty id")
+	}
+	if subscription.Type == "" {
+		return errors.New("empty type")
+	}
+	if subscription.Query.Type == "" {
+		return errors.New("empty query type")
+	}
+	if subscription.DeviceID == "" {
+		return errors.New("empty device id")
+	}
+
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	if _, ok := db.c.store.devices[subscription.DeviceID]; !ok {
+		return skydb.ErrDeviceNotFound
+	}
+	subscriptions, ok := db.c.store.subscriptions[db.userID]
+	if !ok {
+		subscriptions = map[string]skydb.Subscription{}
+		db.c.store.subscriptions[db.userID] = subscriptions
+	}
+	subscriptionKey := subscription.DeviceID + "/" + subscription.ID
+	saved := *subscription
+	// saving a subscription does not reset when it was last notified
+	saved.LastNotifiedAt = subscriptions[subscriptionKey].LastNotifiedAt
+	subscriptions[subscriptionKey] = saved
+	return nil
+}
+
+func (db *database) RecordNotification(ctx context.Context, subscription *skydb.Subscription, t time.Time) error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	subscriptionKey := subscription.DeviceID + "/" + subscription.ID
+	s, ok := db.c.store.subscriptions[db.userID][subscriptionKey]
+	if !ok {
+		return skydb.ErrSubscriptionNotFound
+	}
+	t = t.UTC()
+	s.LastNotifiedAt = &t
+	db.c.store.subscriptions[db.userID][subscriptionKey] = s
+	return nil
+}
+
+func (db *database) DeleteSubscription(ctx context.Context, key string, deviceID string) error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	subscriptionKey := deviceID + "/" + key
+	if _, ok := db.c.store.subscriptions[db.userID][subscriptionKey]; !ok {
+		return skydb.ErrSubscriptionNotFound
+	}
+	delete(db.c.store.subscriptions[db.userID], subscriptionKey)
+	return nil
+}
+
+func (db *database) GetSubscriptionsByDeviceID(ctx context.Context, deviceID string) []skydb.Subscription {
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	subscriptions := []skydb.Subscription{}
+	for _, s := range db.c.store.subscriptions[db.userID] {
+		if s.DeviceID == deviceID {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions
+}
+
+// GetMatchingSubscriptions returns the subscriptions whose query matches
+// the record. Subscriptions with predicates not supported by
+// skydb.Predicate.MatchRecord are never matched. Predicate variables are
+// resolved for the owner of the subscriptions.
+func (db *database) GetMatchingSubscriptions(ctx context.Context, record *skydb.Record) []skydb.Subscription {
+	vars := skydb.UserPredicateVariables(ctx, db.c, db.userID, time.Now().UTC())
+
+	db.c.store.mutex.RLock()
+	defer db.c.store.mutex.RUnlock()
+
+	subscriptions := []skydb.Subscription{}
+	for _, s := range db.c.store.subscriptions[db.userID] {
+		predicate := s.Query.Predicate.ResolveVariables(vars)
+		if s.Query.Type != record.ID.Type || !predicate.CanMatchRecord() {
+			continue
+		}
+		if predicate.MatchRecord(record) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions
+}
+
+// Begin saves the records of all databases so that they are restored on
+// Rollback. Changes made by other Conns in the meantime are discarded on
+// Rollback too.
+func (db *database) Begin(ctx context.Context) error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	if db.c.backup != nil {
+		return skydb.ErrDatabaseTxDidBegin
+	}
+	db.c.backup = copyRecords(db.c.store.records)
+	return nil
+}
+
+func (db *database) Commit() error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	if db.c.backup == nil {
+		return skydb.ErrDatabaseTxDidNotBegin
+	}
+	db.c.backup = nil
+	return nil
+}
+
+func (db *database) Rollback() error {
+	db.c.store.mutex.Lock()
+	defer db.c.store.mutex.Unlock()
+
+	if db.c.backup == nil {
+		return skydb.ErrDatabaseTxDidNotBegin
+	}
+	db.c.store.records = db.c.backup
+	db.c.backup = nil
+	return nil
+}
+
+func copyRecord(record skydb.Record) skydb.Record {
+	if record.Data != nil {
+		data := skydb.Data{}
+		for key, value := range record.Data {
+			data[key] = value
+		}
+		record.Data = data
+	}
+	if record.ACL != nil {
+		record.ACL = append(skydb.RecordACL{}, record.ACL...)
+	}
+	record.Transient = nil
+	return record
+}
+
+func copyRecords(records map[string]map[skydb.RecordID]skydb.Record) map[string]map[skydb.RecordID]skydb.Record {
+	copied := map[string]map[skydb.RecordID]skydb.Record{}
+	for databaseID, databaseRecords := range records {
+		copiedRecords := map[skydb.RecordID]skydb.Record{}
+		for id, record := range databaseRecords {
+			copiedRecords[id] = copyRecord(record)
+		}
+		copied[databaseID] = copiedRecords
+	}
+	return copied
+}
+
+func copySchema(schema skydb.RecordSchema) skydb.RecordSchema {
+	copied := skydb.RecordSchema{}
+	for key, fieldType := range schema {
+		copied[key] = fieldType
+	}
+	return copied
+}
+
+var (
+	_ skydb.Conn       = &conn{}
+	_ skydb.Database   = &database{}
+	_ skydb.TxDatabase = &database{}
+
+	_ skydb.NotificationRecorder = &database{}
+)
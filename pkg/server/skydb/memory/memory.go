@@ -0,0 +1,136 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory implements skydb in memory. Nothing is written to disk,
+// so it is intended for tests that exercise handlers against a real
+// skydb implementation without a PostgreSQL server.
+//
+// The driver is registered as "memory". Conns opened with the same app
+// name and option string share the same data until Drop is called.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("skydb")
+
+// relation is a directed relation from the user of left to the user of
+// right.
+type relation struct {
+	left  string
+	right string
+}
+
+// store holds all data of an app. A store is shared by all Conns opened
+// with the same app name and option string.
+type store struct {
+	mutex sync.RWMutex
+
+	users        map[string]skydb.UserInfo
+	adminRoles   []string
+	defaultRoles []string
+	recordAccess map[string]skydb.RecordACL
+	assets       map[string]skydb.Asset
+	relations    map[string]map[relation]bool
+	devices      map[string]skydb.Device
+	schemas      map[string]skydb.RecordSchema
+
+	// records maps the database ID to the records in the database. The
+	// database ID of the public database is empty.
+	records map[string]map[skydb.RecordID]skydb.Record
+
+	// subscriptions maps the database ID to the subscriptions of the
+	// database, keyed by device ID and subscription ID.
+	subscriptions map[string]map[string]skydb.Subscription
+
+	subscribers []chan skydb.RecordEvent
+}
+
+func newStore() *store {
+	return &store{
+		users:         map[string]skydb.UserInfo{},
+		adminRoles:    []string{"admin"},
+		defaultRoles:  []string{},
+		recordAccess:  map[string]skydb.RecordACL{},
+		assets:        map[string]skydb.Asset{},
+		relations:     map[string]map[relation]bool{},
+		devices:       map[string]skydb.Device{},
+		schemas:       map[string]skydb.RecordSchema{},
+		records:       map[string]map[skydb.RecordID]skydb.Record{},
+		subscriptions: map[string]map[string]skydb.Subscription{},
+	}
+}
+
+var (
+	storesMutex sync.Mutex
+	stores      = map[string]*store{}
+)
+
+func storeKey(appName string, optionString string) string {
+	return appName + "\x00" + optionString
+}
+
+func getStore(appName string, optionString string) *store {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	key := storeKey(appName, optionString)
+	s, ok := stores[key]
+	if !ok {
+		s = newStore()
+		stores[key] = s
+	}
+	return s
+}
+
+// Open returns a Conn to the data of appName and optionString, creating
+// the data if they do not exist yet. migrate is ignored since record
+// schema is always extendable in memory.
+func Open(ctx context.Context, appName string, accessModel skydb.AccessModel, optionString string, migrate bool) (skydb.Conn, error) {
+	if accessModel == skydb.RelationBasedAccess {
+		return nil, fmt.Errorf("Unsupported AccessModel: RelationBasedAccess")
+	}
+
+	return &conn{
+		store:   getStore(appName, optionString),
+		appName: appName,
+	}, nil
+}
+
+// NewConn returns a Conn to data not shared with any other Conn. It is
+// convenient for tests that do not go through skydb.Open.
+func NewConn() skydb.Conn {
+	return &conn{
+		store: newStore(),
+	}
+}
+
+// Drop removes the data of appName and optionString. Conns opened
+// afterwards start with no data.
+func Drop(appName string, optionString string) {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	delete(stores, storeKey(appName, optionString))
+}
+
+func init() {
+	skydb.Register("memory", skydb.DriverFunc(Open))
+}
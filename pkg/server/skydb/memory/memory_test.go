@@ -0,0 +1,463 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newNote(id string, owner string, content string, order float64) skydb.Record {
+	return skydb.Record{
+		ID:        skydb.NewRecordID("note", id),
+		OwnerID:   owner,
+		CreatedAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Data: skydb.Data{
+			"content": content,
+			"order":   order,
+		},
+	}
+}
+
+func scanAll(rows *skydb.Rows) []skydb.Record {
+	records := []skydb.Record{}
+	for rows.Scan() {
+		records = append(records, rows.Record())
+	}
+	return records
+}
+
+func TestOpen(t *testing.T) {
+	Convey("Open", t, func() {
+		defer Drop("app", "shared")
+
+		Convey("shares data between Conns of the same app and option", func() {
+			c1, err := skydb.Open(context.Background(), "memory", "app", "role", "shared", true)
+			So(err, ShouldBeNil)
+			userinfo := skydb.UserInfo{ID: "userid", Username: "john"}
+			So(c1.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+			c2, err := skydb.Open(context.Background(), "memory", "app", "role", "shared", true)
+			So(err, ShouldBeNil)
+			So(c2.GetUser(context.Background(), "userid", &userinfo), ShouldBeNil)
+
+			c3, err := skydb.Open(context.Background(), "memory", "app", "role", "other", true)
+			So(err, ShouldBeNil)
+			So(c3.GetUser(context.Background(), "userid", &userinfo), ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("starts with no data after Drop", func() {
+			c, _ := Open(context.Background(), "app", skydb.RoleBasedAccess, "shared", true)
+			userinfo := skydb.UserInfo{ID: "userid"}
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+			Drop("app", "shared")
+			c, _ = Open(context.Background(), "app", skydb.RoleBasedAccess, "shared", true)
+			So(c.GetUser(context.Background(), "userid", &userinfo), ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("rejects relation based access", func() {
+			_, err := Open(context.Background(), "app", skydb.RelationBasedAccess, "shared", true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUser(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := NewConn()
+		So(c.SetDefaultRoles(context.Background(), []string{"user"}), ShouldBeNil)
+
+		userinfo := skydb.UserInfo{
+			ID:       "userid",
+			Username: "John",
+			Email:    "john@example.com",
+		}
+		So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+		Convey("assigns default roles to created user", func() {
+			fetched := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldResemble, []string{"user"})
+		})
+
+		Convey("rejects duplicated username case-insensitively", func() {
+			duplicated := skydb.UserInfo{ID: "userid2", Username: "john"}
+			So(c.CreateUser(context.Background(), &duplicated), ShouldEqual, skydb.ErrUserDuplicated)
+		})
+
+		Convey("gets user by username or email", func() {
+			fetched := skydb.UserInfo{}
+			So(c.GetUserByUsernameEmail(context.Background(), "john", "", &fetched), ShouldBeNil)
+			So(fetched.ID, ShouldEqual, "userid")
+			So(c.GetUserByUsernameEmail(context.Background(), "", "JOHN@example.com", &fetched), ShouldBeNil)
+			So(fetched.ID, ShouldEqual, "userid")
+			So(c.GetUserByUsernameEmail(context.Background(), "jane", "", &fetched), ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("does not share roles with the caller", func() {
+			userinfo.Roles[0] = "admin"
+			fetched := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldResemble, []string{"user"})
+		})
+
+		Convey("assigns and revokes roles", func() {
+			So(c.AssignUserRoles(context.Background(), "userid", []string{"admin", "user"}), ShouldBeNil)
+			fetched := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldResemble, []string{"user", "admin"})
+
+			So(c.RevokeUserRoles(context.Background(), "userid", []string{"user"}), ShouldBeNil)
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldResemble, []string{"admin"})
+		})
+
+		Convey("queries relation", func() {
+			other := skydb.UserInfo{ID: "otherid"}
+			So(c.CreateUser(context.Background(), &other), ShouldBeNil)
+			So(c.AddRelation(context.Background(), "userid", "_follow", "otherid"), ShouldBeNil)
+
+			So(c.QueryRelation(context.Background(), "userid", "_follow", "outward", skydb.QueryConfig{}), ShouldResemble, []skydb.UserInfo{
+				{ID: "otherid"},
+			})
+			So(c.QueryRelation(context.Background(), "otherid", "_follow", "inward", skydb.QueryConfig{}), ShouldResemble, []skydb.UserInfo{
+				{ID: "userid", Username: "John", Email: "john@example.com"},
+			})
+			count, err := c.QueryRelationCount(context.Background(), "userid", "_follow", "mutual")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			So(c.RemoveRelation(context.Background(), "userid", "_follow", "otherid"), ShouldBeNil)
+			So(c.QueryRelation(context.Background(), "userid", "_follow", "outward", skydb.QueryConfig{}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestDevice(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := NewConn()
+		registeredAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+		for _, device := range []skydb.Device{
+			{ID: "device1", Type: "ios", Token: "token", UserInfoID: "userid", LastRegisteredAt: registeredAt},
+			{ID: "device2", Type: "android", Token: "", UserInfoID: "userid", LastRegisteredAt: registeredAt},
+		} {
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
+		}
+
+		Convey("queries devices by user", func() {
+			devices, err := c.QueryDevicesByUser(context.Background(), "userid")
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 2)
+			So(devices[0].ID, ShouldEqual, "device1")
+		})
+
+		Convey("deletes devices by token", func() {
+			So(c.DeleteDevicesByToken(context.Background(), "token", registeredAt), ShouldEqual, skydb.ErrDeviceNotFound)
+			So(c.DeleteDevicesByToken(context.Background(), "token", skydb.ZeroTime), ShouldBeNil)
+
+			device := skydb.Device{}
+			So(c.GetDevice(context.Background(), "device1", &device), ShouldEqual, skydb.ErrDeviceNotFound)
+		})
+
+		Convey("deletes empty devices", func() {
+			So(c.DeleteEmptyDevicesByTime(context.Background(), registeredAt.Add(time.Second)), ShouldBeNil)
+
+			device := skydb.Device{}
+			So(c.GetDevice(context.Background(), "device2", &device), ShouldEqual, skydb.ErrDeviceNotFound)
+			So(c.GetDevice(context.Background(), "device1", &device), ShouldBeNil)
+		})
+	})
+}
+
+func TestRecord(t *testing.T) {
+	Convey("Database", t, func() {
+		c := NewConn()
+		db := c.PublicDB()
+
+		note1 := newNote("note1", "userid", "hello", 2)
+		note2 := newNote("note2", "userid", "world", 1)
+		So(db.Save(context.Background(), &note1), ShouldBeNil)
+		So(db.Save(context.Background(), &note2), ShouldBeNil)
+
+		Convey("gets a saved record", func() {
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "hello")
+		})
+
+		Convey("does not share data with the saved record", func() {
+			note1.Data["content"] = "modified"
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldBeNil)
+			So(record.Data["content"], ShouldEqual, "hello")
+		})
+
+		Convey("keeps owner and creation time on update", func() {
+			updated := newNote("note1", "otheruserid", "updated", 2)
+			updated.CreatedAt = time.Time{}
+			So(db.Save(context.Background(), &updated), ShouldBeNil)
+			So(updated.OwnerID, ShouldEqual, "userid")
+			So(updated.CreatedAt, ShouldResemble, note1.CreatedAt)
+		})
+
+		Convey("separates public and private records", func() {
+			record := skydb.Record{}
+			So(c.PrivateDB("userid").Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(c.UnionDB().Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldBeNil)
+		})
+
+		Convey("rejects saving to union database", func() {
+			So(c.UnionDB().Save(context.Background(), &note1), ShouldEqual, skydb.ErrDatabaseIsReadOnly)
+		})
+
+		Convey("deletes a record", func() {
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "note1")), ShouldBeNil)
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "note1")), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("queries with predicate, sorts and limit", func() {
+			note3 := newNote("note3", "userid", "hello", 3)
+			So(db.Save(context.Background(), &note3), ShouldBeNil)
+
+			limit := uint64(1)
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "content"},
+						skydb.Expression{Type: skydb.Literal, Value: "hello"},
+					},
+				},
+				Sorts: []skydb.Sort{
+					{KeyPath: "order", Order: skydb.Descending},
+				},
+				Limit:               &limit,
+				GetCount:            true,
+				BypassAccessControl: true,
+			}
+			rows, err := db.Query(context.Background(), &query)
+			So(err, ShouldBeNil)
+			So(*rows.OverallRecordCount(), ShouldEqual, 2)
+
+			records := scanAll(rows)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID.Key, ShouldEqual, "note3")
+
+			count, err := db.QueryCount(context.Background(), &query)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("queries after cursor", func() {
+			note3 := newNote("note3", "userid", "hello", 2)
+			So(db.Save(context.Background(), &note3), ShouldBeNil)
+
+			limit := uint64(2)
+			query := skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{
+					{KeyPath: "order", Order: skydb.Descending},
+				},
+				Limit:               &limit,
+				BypassAccessControl: true,
+			}
+			rows, err := db.Query(context.Background(), &query)
+			So(err, ShouldBeNil)
+			records := scanAll(rows)
+			So(len(records), ShouldEqual, 2)
+			So(records[0].ID.Key, ShouldEqual, "note1")
+			So(records[1].ID.Key, ShouldEqual, "note3")
+
+			query.Cursor = skydb.NewQueryCursor(&query, &records[1])
+			rows, err = db.Query(context.Background(), &query)
+			So(err, ShouldBeNil)
+			records = scanAll(rows)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID.Key, ShouldEqual, "note2")
+		})
+
+		Convey("applies ACL to public records", func() {
+			note1.ACL = skydb.NewRecordACL([]skydb.RecordACLEntry{
+				skydb.NewRecordACLEntryDirect("userid", skydb.ReadLevel),
+			})
+			So(db.Save(context.Background(), &note1), ShouldBeNil)
+
+			rows, err := db.Query(context.Background(), &skydb.Query{
+				Type:       "note",
+				ViewAsUser: &skydb.UserInfo{ID: "otheruserid"},
+			})
+			So(err, ShouldBeNil)
+			records := scanAll(rows)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID.Key, ShouldEqual, "note2")
+		})
+
+		Convey("rejects unsupported predicate", func() {
+			_, err := db.Query(context.Background(), &skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Like,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "content"},
+						skydb.Expression{Type: skydb.Literal, Value: "hel%"},
+					},
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rolls back changes made in transaction", func() {
+			txDB := db.(skydb.TxDatabase)
+			So(txDB.Begin(context.Background()), ShouldBeNil)
+			So(txDB.Begin(context.Background()), ShouldEqual, skydb.ErrDatabaseTxDidBegin)
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "note1")), ShouldBeNil)
+			So(txDB.Rollback(), ShouldBeNil)
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note1"), &record), ShouldBeNil)
+			So(txDB.Commit(), ShouldEqual, skydb.ErrDatabaseTxDidNotBegin)
+		})
+
+		Convey("publishes record events", func() {
+			ch := make(chan skydb.RecordEvent)
+			So(c.Subscribe(ch), ShouldBeNil)
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "note2")), ShouldBeNil)
+
+			event := <-ch
+			So(event.Event, ShouldEqual, skydb.RecordDeleted)
+			So(event.Record.ID.Key, ShouldEqual, "note2")
+		})
+	})
+}
+
+func TestSchema(t *testing.T) {
+	Convey("Database", t, func() {
+		db := NewConn().PublicDB()
+
+		extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		So(extended, ShouldBeTrue)
+
+		Convey("does not extend with existing schema", func() {
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeFalse)
+		})
+
+		Convey("rejects conflicting schema", func() {
+			_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeNumber},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("renames a column with its values", func() {
+			note := newNote("note1", "userid", "hello", 1)
+			So(db.Save(context.Background(), &note), ShouldBeNil)
+			So(db.RenameSchema(context.Background(), "note", "content", "body"), ShouldBeNil)
+
+			schema, err := db.GetSchema(context.Background(), "note")
+			So(err, ShouldBeNil)
+			So(schema, ShouldResemble, skydb.RecordSchema{
+				"body": skydb.FieldType{Type: skydb.TypeString},
+			})
+
+			record := skydb.Record{}
+			So(db.Get(context.Background(), note.ID, &record), ShouldBeNil)
+			So(record.Data["body"], ShouldEqual, "hello")
+		})
+
+		Convey("deletes a column", func() {
+			So(db.DeleteSchema(context.Background(), "note", "content"), ShouldBeNil)
+			So(db.DeleteSchema(context.Background(), "note", "content"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSubscription(t *testing.T) {
+	Convey("Database", t, func() {
+		c := NewConn()
+		db := c.PublicDB()
+		device := skydb.Device{ID: "deviceid", Type: "ios", LastRegisteredAt: time.Now()}
+		So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
+
+		subscription := skydb.Subscription{
+			ID:       "subscriptionid",
+			Type:     "query",
+			DeviceID: "deviceid",
+			Query: skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "content"},
+						skydb.Expression{Type: skydb.Literal, Value: "hello"},
+					},
+				},
+			},
+		}
+		So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
+
+		Convey("gets matching subscriptions", func() {
+			hello := newNote("note1", "userid", "hello", 1)
+			world := newNote("note2", "userid", "world", 1)
+			So(len(db.GetMatchingSubscriptions(context.Background(), &hello)), ShouldEqual, 1)
+			So(db.GetMatchingSubscriptions(context.Background(), &world), ShouldBeEmpty)
+		})
+
+		Convey("deletes a subscription", func() {
+			So(db.DeleteSubscription(context.Background(), "subscriptionid", "deviceid"), ShouldBeNil)
+			So(db.GetSubscriptionsByDeviceID(context.Background(), "deviceid"), ShouldBeEmpty)
+		})
+
+		Convey("resolves predicate variables for the subscriber", func() {
+			userinfo := skydb.UserInfo{ID: "userid", Roles: []string{"editor"}}
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+			privateDB := c.PrivateDB("userid")
+			So(privateDB.SaveSubscription(context.Background(), &skydb.Subscription{
+				ID:       "variablesubscription",
+				Type:     "query",
+				DeviceID: "deviceid",
+				Query: skydb.Query{
+					Type: "note",
+					Predicate: skydb.Predicate{
+						Operator: skydb.In,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "content"},
+							skydb.Expression{Type: skydb.Variable, Value: skydb.UserRolesVariable},
+						},
+					},
+				},
+			}), ShouldBeNil)
+
+			editor := newNote("note1", "userid", "editor", 1)
+			admin := newNote("note2", "userid", "admin", 1)
+			So(len(privateDB.GetMatchingSubscriptions(context.Background(), &editor)), ShouldEqual, 1)
+			So(privateDB.GetMatchingSubscriptions(context.Background(), &admin), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// memoryRows is a skydb.MemoryRows that reports the overall record count
+// only if it is requested by the query.
+type memoryRows struct {
+	*skydb.MemoryRows
+	count *uint64
+}
+
+func (rs *memoryRows) OverallRecordCount() *uint64 {
+	return rs.count
+}
+
+// query returns the records matching the query after applying offset and
+// limit, together with the number of matching records before that.
+//
+// Only predicates supported by skydb.Predicate.MatchRecord and sorts by
+// key path are supported. Records are ordered by ID after the sorts, which
+// is the order a cursor continues from.
+func (db *database) query(query *skydb.Query) ([]skydb.Record, uint64, error) {
+	if !query.Predicate.CanMatchRecord() {
+		return nil, 0, skyerr.NewError(skyerr.NotSupported, "memory: predicate is not supported")
+	}
+	for _, s := range query.Sorts {
+		if s.Func != nil || s.KeyPath == "" {
+			return nil, 0, skyerr.NewError(skyerr.NotSupported, "memory: sort by function is not supported")
+		}
+	}
+
+	db.c.store.mutex.RLock()
+	records := []skydb.Record{}
+	for _, databaseID := range db.databaseIDs() {
+		for id, record := range db.c.store.records[databaseID] {
+			if id.Type != query.Type {
+				continue
+			}
+			if !db.accessible(query, &record) {
+				continue
+			}
+			if query.Predicate.MatchRecord(&record) {
+				records = append(records, copyRecord(record))
+			}
+		}
+	}
+	db.c.store.mutex.RUnlock()
+
+	sortRecords(records, query.Sorts)
+
+	count := uint64(len(records))
+	if query.Cursor != nil {
+		if len(query.Cursor.Values) != len(query.Sorts) {
+			return nil, 0, skyerr.NewError(skyerr.InvalidArgument, "memory: cursor does not match the sorts of the query")
+		}
+		i := sort.Search(len(records), func(i int) bool {
+			return compareCursor(&records[i], query.Sorts, query.Cursor) > 0
+		})
+		records = records[i:]
+	}
+
+	if query.Offset >= uint64(len(records)) {
+		return []skydb.Record{}, count, nil
+	}
+	records = records[query.Offset:]
+	if query.Limit != nil && *query.Limit < uint64(len(records)) {
+		records = records[:*query.Limit]
+	}
+	return records, count, nil
+}
+
+// accessible returns whether the record can be read by the user of the
+// query, which is the same as the ACL applied by the pq implementation.
+func (db *database) accessible(query *skydb.Query, record *skydb.Record) bool {
+	if query.BypassAccessControl {
+		return true
+	}
+
+	switch db.DatabaseType() {
+	case skydb.PublicDatabase:
+		return record.Accessible(query.ViewAsUser, skydb.ReadLevel)
+	case skydb.UnionDatabase:
+		if db.userID == "" || record.DatabaseID != "" {
+			return true
+		}
+		return record.Accessible(query.ViewAsUser, skydb.ReadLevel)
+	}
+	return true
+}
+
+// sortRecords sorts records by the sorts, and then by ID for a stable
+// order.
+func sortRecords(records []skydb.Record, sorts []skydb.Sort) {
+	sort.Stable(recordsBySorts{records, sorts})
+}
+
+type recordsBySorts struct {
+	records []skydb.Record
+	sorts   []skydb.Sort
+}
+
+func (s recordsBySorts) Len() int      { return len(s.records) }
+func (s recordsBySorts) Swap(i, j int) { s.records[i], s.records[j] = s.records[j], s.records[i] }
+func (s recordsBySorts) Less(i, j int) bool {
+	cursor := skydb.NewQueryCursor(&skydb.Query{Sorts: s.sorts}, &s.records[j])
+	return compareCursor(&s.records[i], s.sorts, cursor) < 0
+}
+
+// compareCursor returns -1, 0 or 1 if the record is before, at or after
+// the cursor in the order of the sorts.
+func compareCursor(record *skydb.Record, sorts []skydb.Sort, cursor *skydb.QueryCursor) int {
+	for i, s := range sorts {
+		c := compareValues(record.Get(s.KeyPath), cursor.Values[i])
+		if c == 0 {
+			continue
+		}
+		if s.Order == skydb.Descending {
+			return -c
+		}
+		return c
+	}
+	return compareValues(record.ID.Key, cursor.ID)
+}
+
+// compareValues returns -1, 0 or 1 if lv is less than, equal to or
+// greater than rv. nil is less than any other value, and values of
+// different types are considered equal.
+func compareValues(lv interface{}, rv interface{}) int {
+	if lv == nil || rv == nil {
+		switch {
+		case lv == nil && rv == nil:
+			return 0
+		case lv == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch l := lv.(type) {
+	case float64:
+		if r, ok := rv.(float64); ok {
+			return compareFloats(l, r)
+		}
+	case int64:
+		if r, ok := rv.(int64); ok {
+			return compareFloats(float64(l), float64(r))
+		}
+	case string:
+		if r, ok := rv.(string); ok {
+			switch {
+			case l < r:
+				return -1
+			case l > r:
+				return 1
+			}
+		}
+	case bool:
+		if r, ok := rv.(bool); ok && l != r {
+			if r {
+				return -1
+			}
+			return 1
+		}
+	case time.Time:
+		if r, ok := rv.(time.Time); ok {
+			switch {
+			case l.Before(r):
+				return -1
+			case l.After(r):
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+func compareFloats(l float64, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
@@ -4,6 +4,7 @@
 package mock_skydb
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	skydb "github.com/skygeario/skygear-server/pkg/server/skydb"
 	time "time"
@@ -30,14 +31,14 @@ func (_m *MockConn) EXPECT() *_MockConnRecorder {
 	return _m.recorder
 }
 
-func (_m *MockConn) AddRelation(_param0 string, _param1 string, _param2 string) error {
-	ret := _m.ctrl.Call(_m, "AddRelation", _param0, _param1, _param2)
+func (_m *MockConn) AddRelation(_param0 context.Context, _param1 string, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "AddRelation", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) AddRelation(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddRelation", arg0, arg1, arg2)
+func (_mr *_MockConnRecorder) AddRelation(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddRelation", arg0, arg1, arg2, arg3)
 }
 
 func (_m *MockConn) Close() error {
@@ -50,148 +51,148 @@ func (_mr *_MockConnRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
 
-func (_m *MockConn) CreateUser(_param0 *skydb.UserInfo) error {
-	ret := _m.ctrl.Call(_m, "CreateUser", _param0)
+func (_m *MockConn) CreateUser(_param0 context.Context, _param1 *skydb.UserInfo) error {
+	ret := _m.ctrl.Call(_m, "CreateUser", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) CreateUser(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateUser", arg0)
+func (_mr *_MockConnRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateUser", arg0, arg1)
 }
 
-func (_m *MockConn) DeleteDevice(_param0 string) error {
-	ret := _m.ctrl.Call(_m, "DeleteDevice", _param0)
+func (_m *MockConn) DeleteDevice(_param0 context.Context, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteDevice", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) DeleteDevice(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteDevice", arg0)
+func (_mr *_MockConnRecorder) DeleteDevice(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteDevice", arg0, arg1)
 }
 
-func (_m *MockConn) DeleteDevicesByToken(_param0 string, _param1 time.Time) error {
-	ret := _m.ctrl.Call(_m, "DeleteDevicesByToken", _param0, _param1)
+func (_m *MockConn) DeleteDevicesByToken(_param0 context.Context, _param1 string, _param2 time.Time) error {
+	ret := _m.ctrl.Call(_m, "DeleteDevicesByToken", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) DeleteDevicesByToken(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteDevicesByToken", arg0, arg1)
+func (_mr *_MockConnRecorder) DeleteDevicesByToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteDevicesByToken", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) DeleteEmptyDevicesByTime(_param0 time.Time) error {
-	ret := _m.ctrl.Call(_m, "DeleteEmptyDevicesByTime", _param0)
+func (_m *MockConn) DeleteEmptyDevicesByTime(_param0 context.Context, _param1 time.Time) error {
+	ret := _m.ctrl.Call(_m, "DeleteEmptyDevicesByTime", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) DeleteEmptyDevicesByTime(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteEmptyDevicesByTime", arg0)
+func (_mr *_MockConnRecorder) DeleteEmptyDevicesByTime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteEmptyDevicesByTime", arg0, arg1)
 }
 
-func (_m *MockConn) DeleteUser(_param0 string) error {
-	ret := _m.ctrl.Call(_m, "DeleteUser", _param0)
+func (_m *MockConn) DeleteUser(_param0 context.Context, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteUser", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) DeleteUser(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteUser", arg0)
+func (_mr *_MockConnRecorder) DeleteUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteUser", arg0, arg1)
 }
 
-func (_m *MockConn) GetAdminRoles() ([]string, error) {
-	ret := _m.ctrl.Call(_m, "GetAdminRoles")
+func (_m *MockConn) GetAdminRoles(_param0 context.Context) ([]string, error) {
+	ret := _m.ctrl.Call(_m, "GetAdminRoles", _param0)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) GetAdminRoles() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAdminRoles")
+func (_mr *_MockConnRecorder) GetAdminRoles(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAdminRoles", arg0)
 }
 
-func (_m *MockConn) GetAsset(_param0 string, _param1 *skydb.Asset) error {
-	ret := _m.ctrl.Call(_m, "GetAsset", _param0, _param1)
+func (_m *MockConn) GetAsset(_param0 context.Context, _param1 string, _param2 *skydb.Asset) error {
+	ret := _m.ctrl.Call(_m, "GetAsset", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) GetAsset(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAsset", arg0, arg1)
+func (_mr *_MockConnRecorder) GetAsset(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAsset", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) GetAssets(_param0 []string) ([]skydb.Asset, error) {
-	ret := _m.ctrl.Call(_m, "GetAssets", _param0)
+func (_m *MockConn) GetAssets(_param0 context.Context, _param1 []string) ([]skydb.Asset, error) {
+	ret := _m.ctrl.Call(_m, "GetAssets", _param0, _param1)
 	ret0, _ := ret[0].([]skydb.Asset)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) GetAssets(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAssets", arg0, arg1)
+func (_mr *_MockConnRecorder) GetAssets(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAssets", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) GetDefaultRoles() ([]string, error) {
-	ret := _m.ctrl.Call(_m, "GetDefaultRoles")
+func (_m *MockConn) GetDefaultRoles(_param0 context.Context) ([]string, error) {
+	ret := _m.ctrl.Call(_m, "GetDefaultRoles", _param0)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) GetDefaultRoles() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDefaultRoles")
+func (_mr *_MockConnRecorder) GetDefaultRoles(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDefaultRoles", arg0)
 }
 
-func (_m *MockConn) GetDevice(_param0 string, _param1 *skydb.Device) error {
-	ret := _m.ctrl.Call(_m, "GetDevice", _param0, _param1)
+func (_m *MockConn) GetDevice(_param0 context.Context, _param1 string, _param2 *skydb.Device) error {
+	ret := _m.ctrl.Call(_m, "GetDevice", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) GetDevice(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDevice", arg0, arg1)
+func (_mr *_MockConnRecorder) GetDevice(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDevice", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) GetRecordAccess(_param0 string) (skydb.RecordACL, error) {
-	ret := _m.ctrl.Call(_m, "GetRecordAccess", _param0)
+func (_m *MockConn) GetRecordAccess(_param0 context.Context, _param1 string) (skydb.RecordACL, error) {
+	ret := _m.ctrl.Call(_m, "GetRecordAccess", _param0, _param1)
 	ret0, _ := ret[0].(skydb.RecordACL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) GetRecordAccess(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRecordAccess", arg0)
+func (_mr *_MockConnRecorder) GetRecordAccess(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRecordAccess", arg0, arg1)
 }
 
-func (_m *MockConn) GetUser(_param0 string, _param1 *skydb.UserInfo) error {
-	ret := _m.ctrl.Call(_m, "GetUser", _param0, _param1)
+func (_m *MockConn) GetUser(_param0 context.Context, _param1 string, _param2 *skydb.UserInfo) error {
+	ret := _m.ctrl.Call(_m, "GetUser", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUser", arg0, arg1)
+func (_mr *_MockConnRecorder) GetUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUser", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) GetUserByPrincipalID(_param0 string, _param1 *skydb.UserInfo) error {
-	ret := _m.ctrl.Call(_m, "GetUserByPrincipalID", _param0, _param1)
+func (_m *MockConn) GetUserByPrincipalID(_param0 context.Context, _param1 string, _param2 *skydb.UserInfo) error {
+	ret := _m.ctrl.Call(_m, "GetUserByPrincipalID", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) GetUserByPrincipalID(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserByPrincipalID", arg0, arg1)
+func (_mr *_MockConnRecorder) GetUserByPrincipalID(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserByPrincipalID", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) GetUserByUsernameEmail(_param0 string, _param1 string, _param2 *skydb.UserInfo) error {
-	ret := _m.ctrl.Call(_m, "GetUserByUsernameEmail", _param0, _param1, _param2)
+func (_m *MockConn) GetUserByUsernameEmail(_param0 context.Context, _param1 string, _param2 string, _param3 *skydb.UserInfo) error {
+	ret := _m.ctrl.Call(_m, "GetUserByUsernameEmail", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) GetUserByUsernameEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserByUsernameEmail", arg0, arg1, arg2)
+func (_mr *_MockConnRecorder) GetUserByUsernameEmail(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserByUsernameEmail", arg0, arg1, arg2, arg3)
 }
 
 func (_m *MockConn) PrivateDB(_param0 string) skydb.Database {
@@ -214,118 +215,138 @@ func (_mr *_MockConnRecorder) PublicDB() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "PublicDB")
 }
 
-func (_m *MockConn) QueryDevicesByUser(_param0 string) ([]skydb.Device, error) {
-	ret := _m.ctrl.Call(_m, "QueryDevicesByUser", _param0)
+func (_m *MockConn) QueryDevicesByUser(_param0 context.Context, _param1 string) ([]skydb.Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByUser", _param0, _param1)
 	ret0, _ := ret[0].([]skydb.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) QueryDevicesByUser(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryDevicesByUser", arg0)
+func (_mr *_MockConnRecorder) QueryDevicesByUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryDevicesByUser", arg0, arg1)
 }
 
-func (_m *MockConn) QueryDevicesByUserAndTopic(_param0 string, _param1 string) ([]skydb.Device, error) {
-	ret := _m.ctrl.Call(_m, "QueryDevicesByUserAndTopic", _param0, _param1)
+func (_m *MockConn) QueryDevicesByUserAndTopic(_param0 context.Context, _param1 string, _param2 string) ([]skydb.Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByUserAndTopic", _param0, _param1, _param2)
 	ret0, _ := ret[0].([]skydb.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) QueryDevicesByUserAndTopic(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryDevicesByUserAndTopic", arg0, arg1)
+func (_mr *_MockConnRecorder) QueryDevicesByUserAndTopic(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryDevicesByUserAndTopic", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) QueryRelation(_param0 string, _param1 string, _param2 string, _param3 skydb.QueryConfig) []skydb.UserInfo {
-	ret := _m.ctrl.Call(_m, "QueryRelation", _param0, _param1, _param2, _param3)
+func (_m *MockConn) QueryRelation(_param0 context.Context, _param1 string, _param2 string, _param3 string, _param4 skydb.QueryConfig) []skydb.UserInfo {
+	ret := _m.ctrl.Call(_m, "QueryRelation", _param0, _param1, _param2, _param3, _param4)
 	ret0, _ := ret[0].([]skydb.UserInfo)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) QueryRelation(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryRelation", arg0, arg1, arg2, arg3)
+func (_mr *_MockConnRecorder) QueryRelation(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryRelation", arg0, arg1, arg2, arg3, arg4)
 }
 
-func (_m *MockConn) QueryRelationCount(_param0 string, _param1 string, _param2 string) (uint64, error) {
-	ret := _m.ctrl.Call(_m, "QueryRelationCount", _param0, _param1, _param2)
+func (_m *MockConn) QueryRelationCount(_param0 context.Context, _param1 string, _param2 string, _param3 string) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "QueryRelationCount", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(uint64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) QueryRelationCount(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryRelationCount", arg0, arg1, arg2)
+func (_mr *_MockConnRecorder) QueryRelationCount(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryRelationCount", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockConn) QueryUser(_param0 []string, _param1 []string) ([]skydb.UserInfo, error) {
-	ret := _m.ctrl.Call(_m, "QueryUser", _param0, _param1)
+func (_m *MockConn) QueryUser(_param0 context.Context, _param1 []string, _param2 []string) ([]skydb.UserInfo, error) {
+	ret := _m.ctrl.Call(_m, "QueryUser", _param0, _param1, _param2)
 	ret0, _ := ret[0].([]skydb.UserInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConnRecorder) QueryUser(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryUser", arg0, arg1)
+func (_mr *_MockConnRecorder) QueryUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryUser", arg0, arg1, arg2)
 }
 
-func (_m *MockConn) RemoveRelation(_param0 string, _param1 string, _param2 string) error {
-	ret := _m.ctrl.Call(_m, "RemoveRelation", _param0, _param1, _param2)
+func (_m *MockConn) RemoveRelation(_param0 context.Context, _param1 string, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "RemoveRelation", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) RemoveRelation(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveRelation", arg0, arg1, arg2)
+func (_mr *_MockConnRecorder) RemoveRelation(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveRelation", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockConn) SaveAsset(_param0 *skydb.Asset) error {
-	ret := _m.ctrl.Call(_m, "SaveAsset", _param0)
+func (_m *MockConn) SaveAsset(_param0 context.Context, _param1 *skydb.Asset) error {
+	ret := _m.ctrl.Call(_m, "SaveAsset", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) SaveAsset(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveAsset", arg0)
+func (_mr *_MockConnRecorder) SaveAsset(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveAsset", arg0, arg1)
 }
 
-func (_m *MockConn) SaveDevice(_param0 *skydb.Device) error {
-	ret := _m.ctrl.Call(_m, "SaveDevice", _param0)
+func (_m *MockConn) SaveDevice(_param0 context.Context, _param1 *skydb.Device) error {
+	ret := _m.ctrl.Call(_m, "SaveDevice", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) SaveDevice(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveDevice", arg0)
+func (_mr *_MockConnRecorder) SaveDevice(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveDevice", arg0, arg1)
 }
 
-func (_m *MockConn) SetAdminRoles(_param0 []string) error {
-	ret := _m.ctrl.Call(_m, "SetAdminRoles", _param0)
+func (_m *MockConn) SetAdminRoles(_param0 context.Context, _param1 []string) error {
+	ret := _m.ctrl.Call(_m, "SetAdminRoles", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) SetAdminRoles(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAdminRoles", arg0)
+func (_mr *_MockConnRecorder) SetAdminRoles(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAdminRoles", arg0, arg1)
 }
 
-func (_m *MockConn) SetDefaultRoles(_param0 []string) error {
-	ret := _m.ctrl.Call(_m, "SetDefaultRoles", _param0)
+func (_m *MockConn) SetDefaultRoles(_param0 context.Context, _param1 []string) error {
+	ret := _m.ctrl.Call(_m, "SetDefaultRoles", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) SetDefaultRoles(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetDefaultRoles", arg0)
+func (_mr *_MockConnRecorder) SetDefaultRoles(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetDefaultRoles", arg0, arg1)
 }
 
-func (_m *MockConn) SetRecordAccess(_param0 string, _param1 skydb.RecordACL) error {
-	ret := _m.ctrl.Call(_m, "SetRecordAccess", _param0, _param1)
+func (_m *MockConn) AssignUserRoles(_param0 context.Context, _param1 string, _param2 []string) error {
+	ret := _m.ctrl.Call(_m, "AssignUserRoles", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) SetRecordAccess(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRecordAccess", arg0, arg1)
+func (_mr *_MockConnRecorder) AssignUserRoles(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AssignUserRoles", arg0, arg1, arg2)
+}
+
+func (_m *MockConn) RevokeUserRoles(_param0 context.Context, _param1 string, _param2 []string) error {
+	ret := _m.ctrl.Call(_m, "RevokeUserRoles", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnRecorder) RevokeUserRoles(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RevokeUserRoles", arg0, arg1, arg2)
+}
+
+func (_m *MockConn) SetRecordAccess(_param0 context.Context, _param1 string, _param2 skydb.RecordACL) error {
+	ret := _m.ctrl.Call(_m, "SetRecordAccess", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnRecorder) SetRecordAccess(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRecordAccess", arg0, arg1, arg2)
 }
 
 func (_m *MockConn) Subscribe(_param0 chan skydb.RecordEvent) error {
@@ -348,14 +369,14 @@ func (_mr *_MockConnRecorder) UnionDB() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnionDB")
 }
 
-func (_m *MockConn) UpdateUser(_param0 *skydb.UserInfo) error {
-	ret := _m.ctrl.Call(_m, "UpdateUser", _param0)
+func (_m *MockConn) UpdateUser(_param0 context.Context, _param1 *skydb.UserInfo) error {
+	ret := _m.ctrl.Call(_m, "UpdateUser", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConnRecorder) UpdateUser(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateUser", arg0)
+func (_mr *_MockConnRecorder) UpdateUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateUser", arg0, arg1)
 }
 
 // Mock of Database interface
@@ -369,6 +390,16 @@ type _MockDatabaseRecorder struct {
 	mock *MockDatabase
 }
 
+func (_m *MockConn) UserUnionDB(_param0 string) skydb.Database {
+	ret := _m.ctrl.Call(_m, "UserUnionDB", _param0)
+	ret0, _ := ret[0].(skydb.Database)
+	return ret0
+}
+
+func (_mr *_MockConnRecorder) UserUnionDB(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UserUnionDB", arg0)
+}
+
 func NewMockDatabase(ctrl *gomock.Controller) *MockDatabase {
 	mock := &MockDatabase{ctrl: ctrl}
 	mock.recorder = &_MockDatabaseRecorder{mock}
@@ -399,118 +430,118 @@ func (_mr *_MockDatabaseRecorder) DatabaseType() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DatabaseType")
 }
 
-func (_m *MockDatabase) Delete(_param0 skydb.RecordID) error {
-	ret := _m.ctrl.Call(_m, "Delete", _param0)
+func (_m *MockDatabase) Delete(_param0 context.Context, _param1 skydb.RecordID) error {
+	ret := _m.ctrl.Call(_m, "Delete", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) Delete(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Delete", arg0)
+func (_mr *_MockDatabaseRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Delete", arg0, arg1)
 }
 
-func (_m *MockDatabase) DeleteSchema(_param0 string, _param1 string) error {
-	ret := _m.ctrl.Call(_m, "DeleteSchema", _param0, _param1)
+func (_m *MockDatabase) DeleteSchema(_param0 context.Context, _param1 string, _param2 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteSchema", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) DeleteSchema(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteSchema", arg0, arg1)
+func (_mr *_MockDatabaseRecorder) DeleteSchema(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteSchema", arg0, arg1, arg2)
 }
 
-func (_m *MockDatabase) DeleteSubscription(_param0 string, _param1 string) error {
-	ret := _m.ctrl.Call(_m, "DeleteSubscription", _param0, _param1)
+func (_m *MockDatabase) DeleteSubscription(_param0 context.Context, _param1 string, _param2 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteSubscription", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) DeleteSubscription(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteSubscription", arg0, arg1)
+func (_mr *_MockDatabaseRecorder) DeleteSubscription(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteSubscription", arg0, arg1, arg2)
 }
 
-func (_m *MockDatabase) Extend(_param0 string, _param1 skydb.RecordSchema) (bool, error) {
-	ret := _m.ctrl.Call(_m, "Extend", _param0, _param1)
+func (_m *MockDatabase) Extend(_param0 context.Context, _param1 string, _param2 skydb.RecordSchema) (bool, error) {
+	ret := _m.ctrl.Call(_m, "Extend", _param0, _param1, _param2)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) Extend(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Extend", arg0, arg1)
+func (_mr *_MockDatabaseRecorder) Extend(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Extend", arg0, arg1, arg2)
 }
 
-func (_m *MockDatabase) Get(_param0 skydb.RecordID, _param1 *skydb.Record) error {
-	ret := _m.ctrl.Call(_m, "Get", _param0, _param1)
+func (_m *MockDatabase) Get(_param0 context.Context, _param1 skydb.RecordID, _param2 *skydb.Record) error {
+	ret := _m.ctrl.Call(_m, "Get", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Get", arg0, arg1)
+func (_mr *_MockDatabaseRecorder) Get(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Get", arg0, arg1, arg2)
 }
 
-func (_m *MockDatabase) GetByIDs(_param0 []skydb.RecordID) (*skydb.Rows, error) {
-	ret := _m.ctrl.Call(_m, "GetByIDs", _param0)
+func (_m *MockDatabase) GetByIDs(_param0 context.Context, _param1 []skydb.RecordID) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "GetByIDs", _param0, _param1)
 	ret0, _ := ret[0].(*skydb.Rows)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) GetByIDs(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetByIDs", arg0)
+func (_mr *_MockDatabaseRecorder) GetByIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetByIDs", arg0, arg1)
 }
 
-func (_m *MockDatabase) GetMatchingSubscriptions(_param0 *skydb.Record) []skydb.Subscription {
-	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptions", _param0)
+func (_m *MockDatabase) GetMatchingSubscriptions(_param0 context.Context, _param1 *skydb.Record) []skydb.Subscription {
+	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptions", _param0, _param1)
 	ret0, _ := ret[0].([]skydb.Subscription)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) GetMatchingSubscriptions(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMatchingSubscriptions", arg0)
+func (_mr *_MockDatabaseRecorder) GetMatchingSubscriptions(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMatchingSubscriptions", arg0, arg1)
 }
 
-func (_m *MockDatabase) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
-	ret := _m.ctrl.Call(_m, "GetRecordSchemas")
+func (_m *MockDatabase) GetRecordSchemas(_param0 context.Context) (map[string]skydb.RecordSchema, error) {
+	ret := _m.ctrl.Call(_m, "GetRecordSchemas", _param0)
 	ret0, _ := ret[0].(map[string]skydb.RecordSchema)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) GetRecordSchemas() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRecordSchemas")
+func (_mr *_MockDatabaseRecorder) GetRecordSchemas(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRecordSchemas", arg0)
 }
 
-func (_m *MockDatabase) GetSchema(_param0 string) (skydb.RecordSchema, error) {
-	ret := _m.ctrl.Call(_m, "GetSchema", _param0)
+func (_m *MockDatabase) GetSchema(_param0 context.Context, _param1 string) (skydb.RecordSchema, error) {
+	ret := _m.ctrl.Call(_m, "GetSchema", _param0, _param1)
 	ret0, _ := ret[0].(skydb.RecordSchema)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) GetSchema(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSchema", arg0)
+func (_mr *_MockDatabaseRecorder) GetSchema(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSchema", arg0, arg1)
 }
 
-func (_m *MockDatabase) GetSubscription(_param0 string, _param1 string, _param2 *skydb.Subscription) error {
-	ret := _m.ctrl.Call(_m, "GetSubscription", _param0, _param1, _param2)
+func (_m *MockDatabase) GetSubscription(_param0 context.Context, _param1 string, _param2 string, _param3 *skydb.Subscription) error {
+	ret := _m.ctrl.Call(_m, "GetSubscription", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) GetSubscription(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSubscription", arg0, arg1, arg2)
+func (_mr *_MockDatabaseRecorder) GetSubscription(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSubscription", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockDatabase) GetSubscriptionsByDeviceID(_param0 string) []skydb.Subscription {
-	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDeviceID", _param0)
+func (_m *MockDatabase) GetSubscriptionsByDeviceID(_param0 context.Context, _param1 string) []skydb.Subscription {
+	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDeviceID", _param0, _param1)
 	ret0, _ := ret[0].([]skydb.Subscription)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) GetSubscriptionsByDeviceID(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSubscriptionsByDeviceID", arg0)
+func (_mr *_MockDatabaseRecorder) GetSubscriptionsByDeviceID(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSubscriptionsByDeviceID", arg0, arg1)
 }
 
 func (_m *MockDatabase) ID() string {
@@ -533,56 +564,56 @@ func (_mr *_MockDatabaseRecorder) IsReadOnly() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsReadOnly")
 }
 
-func (_m *MockDatabase) Query(_param0 *skydb.Query) (*skydb.Rows, error) {
-	ret := _m.ctrl.Call(_m, "Query", _param0)
+func (_m *MockDatabase) Query(_param0 context.Context, _param1 *skydb.Query) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "Query", _param0, _param1)
 	ret0, _ := ret[0].(*skydb.Rows)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) Query(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Query", arg0)
+func (_mr *_MockDatabaseRecorder) Query(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Query", arg0, arg1)
 }
 
-func (_m *MockDatabase) QueryCount(_param0 *skydb.Query) (uint64, error) {
-	ret := _m.ctrl.Call(_m, "QueryCount", _param0)
+func (_m *MockDatabase) QueryCount(_param0 context.Context, _param1 *skydb.Query) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "QueryCount", _param0, _param1)
 	ret0, _ := ret[0].(uint64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockDatabaseRecorder) QueryCount(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryCount", arg0)
+func (_mr *_MockDatabaseRecorder) QueryCount(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryCount", arg0, arg1)
 }
 
-func (_m *MockDatabase) RenameSchema(_param0 string, _param1 string, _param2 string) error {
-	ret := _m.ctrl.Call(_m, "RenameSchema", _param0, _param1, _param2)
+func (_m *MockDatabase) RenameSchema(_param0 context.Context, _param1 string, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "RenameSchema", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) RenameSchema(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "RenameSchema", arg0, arg1, arg2)
+func (_mr *_MockDatabaseRecorder) RenameSchema(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RenameSchema", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockDatabase) Save(_param0 *skydb.Record) error {
-	ret := _m.ctrl.Call(_m, "Save", _param0)
+func (_m *MockDatabase) Save(_param0 context.Context, _param1 *skydb.Record) error {
+	ret := _m.ctrl.Call(_m, "Save", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) Save(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Save", arg0)
+func (_mr *_MockDatabaseRecorder) Save(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Save", arg0, arg1)
 }
 
-func (_m *MockDatabase) SaveSubscription(_param0 *skydb.Subscription) error {
-	ret := _m.ctrl.Call(_m, "SaveSubscription", _param0)
+func (_m *MockDatabase) SaveSubscription(_param0 context.Context, _param1 *skydb.Subscription) error {
+	ret := _m.ctrl.Call(_m, "SaveSubscription", _param0, _param1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockDatabaseRecorder) SaveSubscription(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveSubscription", arg0)
+func (_mr *_MockDatabaseRecorder) SaveSubscription(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SaveSubscription", arg0, arg1)
 }
 
 func (_m *MockDatabase) UserRecordType() string {
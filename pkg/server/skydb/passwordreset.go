@@ -0,0 +1,59 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPasswordResetCodeNotFound is returned by
+// PasswordResetCodeStore.GetPasswordResetCode if the code does not
+// exist.
+var ErrPasswordResetCodeNotFound = errors.New("skydb: password reset code not found")
+
+// PasswordResetCode authorizes resetting the password of a user who
+// has forgotten it.
+type PasswordResetCode struct {
+	// CodeHash is the hash of the code sent to the user. The code
+	// itself is not stored.
+	CodeHash  string
+	UserID    string
+	ExpireAt  time.Time
+	CreatedAt time.Time
+}
+
+// IsExpired returns whether the code can no longer be used at the
+// specified time.
+func (c *PasswordResetCode) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpireAt)
+}
+
+// PasswordResetCodeStore defines the methods for a Conn that persists
+// PasswordResetCode until they are used.
+type PasswordResetCodeStore interface {
+	// SavePasswordResetCode creates a PasswordResetCode.
+	SavePasswordResetCode(ctx context.Context, code *PasswordResetCode) error
+
+	// GetPasswordResetCode fetches the PasswordResetCode of the
+	// specified code hash. ErrPasswordResetCodeNotFound is returned if
+	// there is no such code.
+	GetPasswordResetCode(ctx context.Context, codeHash string, code *PasswordResetCode) error
+
+	// DeletePasswordResetCodes removes all codes of a user, such that
+	// the codes cannot be used again after the password is reset.
+	DeletePasswordResetCodes(ctx context.Context, userID string) error
+}
@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"context"
 	"fmt"
 
 	sq "github.com/lann/squirrel"
@@ -10,7 +11,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/utils"
 )
 
-func (c *conn) SetRecordAccess(recordType string, acl skydb.RecordACL) error {
+func (c *conn) SetRecordAccess(ctx context.Context, recordType string, acl skydb.RecordACL) error {
 	creationRoles := []string{}
 	for _, ace := range acl {
 		if ace.Role != "" {
@@ -18,12 +19,12 @@ func (c *conn) SetRecordAccess(recordType string, acl skydb.RecordACL) error {
 		}
 	}
 
-	_, err := c.ensureRole(creationRoles)
+	_, err := c.ensureRole(ctx, creationRoles)
 	if err != nil {
 		return err
 	}
 
-	currentCreationAccess, err := c.GetRecordAccess(recordType)
+	currentCreationAccess, err := c.GetRecordAccess(ctx, recordType)
 	if err != nil {
 		return err
 	}
@@ -38,17 +39,17 @@ func (c *conn) SetRecordAccess(recordType string, acl skydb.RecordACL) error {
 	rolesToDelete := utils.StringSliceExcept(currentCreationRoles, creationRoles)
 	rolesToAdd := utils.StringSliceExcept(creationRoles, currentCreationRoles)
 
-	err = c.deleteRecordCreationAccess(recordType, rolesToDelete)
+	err = c.deleteRecordCreationAccess(ctx, recordType, rolesToDelete)
 	if err != nil {
 		return err
 	}
 
-	err = c.insertRecordCreationAccess(recordType, rolesToAdd)
+	err = c.insertRecordCreationAccess(ctx, recordType, rolesToAdd)
 
 	return err
 }
 
-func (c *conn) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
+func (c *conn) GetRecordAccess(ctx context.Context, recordType string) (skydb.RecordACL, error) {
 	builder := psql.
 		Select("role_id").
 		From(c.tableName("_record_creation")).
@@ -57,7 +58,7 @@ func (c *conn) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
 		c.tableName("_role"),
 		c.tableName("_record_creation")))
 
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +78,7 @@ func (c *conn) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
 	return skydb.NewRecordACL(currentCreationRoles), nil
 }
 
-func (c *conn) deleteRecordCreationAccess(recordType string, roles []string) error {
+func (c *conn) deleteRecordCreationAccess(ctx context.Context, recordType string, roles []string) error {
 	if len(roles) == 0 {
 		return nil
 	}
@@ -90,11 +91,11 @@ func (c *conn) deleteRecordCreationAccess(recordType string, roles []string) err
 		Delete(c.tableName("_record_creation")).
 		Where("role_id IN ("+sq.Placeholders(len(roles))+")", roleArgs...)
 
-	_, err := c.ExecWith(builder)
+	_, err := c.ExecWith(ctx, builder)
 	return err
 }
 
-func (c *conn) insertRecordCreationAccess(recordType string, roles []string) error {
+func (c *conn) insertRecordCreationAccess(ctx context.Context, recordType string, roles []string) error {
 	if len(roles) == 0 {
 		return nil
 	}
@@ -105,7 +106,7 @@ func (c *conn) insertRecordCreationAccess(recordType string, roles []string) err
 			Columns("record_type", "role_id").
 			Values(recordType, perRole)
 
-		_, err := c.ExecWith(builder)
+		_, err := c.ExecWith(ctx, builder)
 		if isForeignKeyViolated(err) {
 			return skyerr.NewError(skyerr.ConstraintViolated,
 				fmt.Sprintf("Does not have role %s", perRole))
@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -15,12 +16,12 @@ func TestRecordCreationAccess(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		// prepare some initial data
-		c.ensureRole([]string{"Developer", "Tester", "ProjectManager"})
-		c.insertRecordCreationAccess("ProgressUpdate", []string{"ProjectManager"})
-		c.insertRecordCreationAccess("SourceCode", []string{"Developer"})
+		c.ensureRole(context.Background(), []string{"Developer", "Tester", "ProjectManager"})
+		c.insertRecordCreationAccess(context.Background(), "ProgressUpdate", []string{"ProjectManager"})
+		c.insertRecordCreationAccess(context.Background(), "SourceCode", []string{"Developer"})
 
 		Convey("get record creation access", func() {
-			access, err := c.GetRecordAccess("ProgressUpdate")
+			access, err := c.GetRecordAccess(context.Background(), "ProgressUpdate")
 
 			So(err, ShouldBeNil)
 			So(access, ShouldHaveLength, 1)
@@ -28,7 +29,7 @@ func TestRecordCreationAccess(t *testing.T) {
 		})
 
 		Convey("set creation access", func() {
-			err := c.SetRecordAccess("SourceCode", skydb.NewRecordACL(
+			err := c.SetRecordAccess(context.Background(), "SourceCode", skydb.NewRecordACL(
 				[]skydb.RecordACLEntry{
 					skydb.NewRecordACLEntryRole("Developer", skydb.CreateLevel),
 					skydb.NewRecordACLEntryRole("Tester", skydb.CreateLevel),
@@ -37,7 +38,7 @@ func TestRecordCreationAccess(t *testing.T) {
 
 			So(err, ShouldBeNil)
 
-			access, err := c.GetRecordAccess("SourceCode")
+			access, err := c.GetRecordAccess(context.Background(), "SourceCode")
 
 			So(err, ShouldBeNil)
 			So(access, ShouldHaveLength, 2)
@@ -54,7 +55,7 @@ func TestRecordCreationAccess(t *testing.T) {
 		})
 
 		Convey("remove not necessary creation access", func() {
-			err := c.SetRecordAccess("ProgressUpdate", skydb.NewRecordACL(
+			err := c.SetRecordAccess(context.Background(), "ProgressUpdate", skydb.NewRecordACL(
 				[]skydb.RecordACLEntry{
 					skydb.NewRecordACLEntryRole("Developer", skydb.CreateLevel),
 					skydb.NewRecordACLEntryRole("Tester", skydb.CreateLevel),
@@ -63,7 +64,7 @@ func TestRecordCreationAccess(t *testing.T) {
 
 			So(err, ShouldBeNil)
 
-			access, err := c.GetRecordAccess("ProgressUpdate")
+			access, err := c.GetRecordAccess(context.Background(), "ProgressUpdate")
 
 			So(err, ShouldBeNil)
 			So(access, ShouldHaveLength, 2)
@@ -0,0 +1,166 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	sq "github.com/lann/squirrel"
+)
+
+// anonymousPurgeBatchSize is the number of user IDs queried at a time
+// when purging anonymous users.
+const anonymousPurgeBatchSize = 100
+
+func (c *conn) PurgeAnonymousUsers(ctx context.Context, inactiveSince time.Time) (int, error) {
+	recordTypes, err := c.recordTypes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	lastID := ""
+	for {
+		ids, err := c.inactiveAnonymousUserIDs(ctx, inactiveSince, lastID)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, id := range ids {
+			// A user is purged in its own transaction, so that a user
+			// whose records cannot be deleted, such as those referenced
+			// by records of other users, does not hold back the others.
+			if err := c.purgeUser(ctx, id, recordTypes); err != nil {
+				log.WithFields(logrus.Fields{
+					"user_id": id,
+					"err":     err,
+				}).Warnln("Failed to purge anonymous user")
+				continue
+			}
+			purged++
+		}
+
+		if len(ids) < anonymousPurgeBatchSize {
+			return purged, nil
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+func (c *conn) inactiveAnonymousUserIDs(ctx context.Context, inactiveSince time.Time, afterID string) ([]string, error) {
+	builder := psql.Select("id").From(c.tableName("_user")).
+		Where("username IS NULL AND email IS NULL").
+		Where("(password IS NULL OR password = '')").
+		Where("(auth IS NULL OR auth = 'null'::jsonb OR auth = '{}'::jsonb)").
+		Where("COALESCE(last_seen_at, last_login_at) < ?", inactiveSince).
+		Where("id > ?", afterID).
+		OrderBy("id").
+		Limit(anonymousPurgeBatchSize)
+
+	rows, err := c.QueryWith(ctx, builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (c *conn) purgeUser(ctx context.Context, id string, recordTypes []string) (err error) {
+	if err = c.Begin(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			c.Rollback()
+			return
+		}
+		err = c.Commit()
+	}()
+
+	if err = c.deleteOwnedRecords(ctx, id, recordTypes); err != nil {
+		return
+	}
+
+	builders := []sq.Sqlizer{
+		psql.Delete(c.tableName("_subscription")).Where("user_id = ?", id),
+		psql.Delete(c.tableName("_device")).Where("user_id = ?", id),
+		psql.Delete(c.tableName("_user_role")).Where("user_id = ?", id),
+		psql.Delete(c.tableName("_friend")).Where("left_id = ? OR right_id = ?", id, id),
+		psql.Delete(c.tableName("_follow")).Where("left_id = ? OR right_id = ?", id, id),
+		psql.Delete(c.tableName("_user")).Where("id = ?", id),
+	}
+
+	for _, builder := range builders {
+		if _, err = c.ExecWith(ctx, builder); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// deleteOwnedRecords deletes the records owned by the user of every
+// record type. As records may reference records of another type, a
+// record type whose records are still referenced is deleted again after
+// the other record types, until no more record types can be deleted.
+//
+// It must be called inside a transaction.
+func (c *conn) deleteOwnedRecords(ctx context.Context, id string, recordTypes []string) error {
+	pending := recordTypes
+	for len(pending) > 0 {
+		referenced := []string{}
+		var referencedErr error
+		for _, recordType := range pending {
+			if _, err := c.Exec(ctx, "SAVEPOINT purge_record"); err != nil {
+				return err
+			}
+
+			builder := psql.Delete(c.tableName(recordType)).Where("_owner_id = ?", id)
+			if _, deleteErr := c.ExecWith(ctx, builder); deleteErr != nil {
+				if !isForeignKeyViolated(deleteErr) {
+					return deleteErr
+				}
+				if _, err := c.Exec(ctx, "ROLLBACK TO SAVEPOINT purge_record"); err != nil {
+					return err
+				}
+				referenced = append(referenced, recordType)
+				referencedErr = deleteErr
+				continue
+			}
+
+			if _, err := c.Exec(ctx, "RELEASE SAVEPOINT purge_record"); err != nil {
+				return err
+			}
+		}
+
+		if len(referenced) == len(pending) {
+			// The remaining records are referenced by records not owned
+			// by the user, or by each other in a cycle.
+			return referencedErr
+		}
+		pending = referenced
+	}
+	return nil
+}
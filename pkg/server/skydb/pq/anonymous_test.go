@@ -0,0 +1,137 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPurgeAnonymousUsers(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		longAgo := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		recently := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+		inactiveSince := time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+
+		inactive := skydb.UserInfo{ID: "inactive", LastSeenAt: &longAgo}
+		active := skydb.UserInfo{ID: "active", LastSeenAt: &recently}
+		registered := skydb.NewUserInfo("registered", "registered@example.com", "secret")
+		registered.LastSeenAt = &longAgo
+		So(c.CreateUser(context.Background(), &inactive), ShouldBeNil)
+		So(c.CreateUser(context.Background(), &active), ShouldBeNil)
+		So(c.CreateUser(context.Background(), &registered), ShouldBeNil)
+
+		publicDB := c.PublicDB()
+		_, err := publicDB.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		So(publicDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "inactive-note"),
+			OwnerID: "inactive",
+			Data:    map[string]interface{}{"content": "hello"},
+		}), ShouldBeNil)
+		So(c.PrivateDB("inactive").Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "inactive-private-note"),
+			OwnerID: "inactive",
+			Data:    map[string]interface{}{"content": "hello"},
+		}), ShouldBeNil)
+		So(publicDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "active-note"),
+			OwnerID: "active",
+			Data:    map[string]interface{}{"content": "hello"},
+		}), ShouldBeNil)
+
+		Convey("purges inactive anonymous users and their records", func() {
+			count, err := c.PurgeAnonymousUsers(context.Background(), inactiveSince)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			userinfo := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "inactive", &userinfo), ShouldEqual, skydb.ErrUserNotFound)
+			So(c.GetUser(context.Background(), "active", &userinfo), ShouldBeNil)
+			So(c.GetUser(context.Background(), registered.ID, &userinfo), ShouldBeNil)
+
+			record := skydb.Record{}
+			So(publicDB.Get(context.Background(), skydb.NewRecordID("note", "inactive-note"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(c.PrivateDB("inactive").Get(context.Background(), skydb.NewRecordID("note", "inactive-private-note"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(publicDB.Get(context.Background(), skydb.NewRecordID("note", "active-note"), &record), ShouldBeNil)
+		})
+
+		Convey("purges records referenced by other records of the user", func() {
+			_, err := publicDB.Extend(context.Background(), "comment", skydb.RecordSchema{
+				"note": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "note",
+				},
+			})
+			So(err, ShouldBeNil)
+			So(publicDB.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("comment", "inactive-comment"),
+				OwnerID: "inactive",
+				Data: map[string]interface{}{
+					"note": skydb.NewReference("note", "inactive-note"),
+				},
+			}), ShouldBeNil)
+
+			count, err := c.PurgeAnonymousUsers(context.Background(), inactiveSince)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			record := skydb.Record{}
+			So(publicDB.Get(context.Background(), skydb.NewRecordID("comment", "inactive-comment"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+			So(publicDB.Get(context.Background(), skydb.NewRecordID("note", "inactive-note"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("keeps users with records referenced by other users", func() {
+			_, err := publicDB.Extend(context.Background(), "comment", skydb.RecordSchema{
+				"note": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "note",
+				},
+			})
+			So(err, ShouldBeNil)
+			So(publicDB.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("comment", "active-comment"),
+				OwnerID: "active",
+				Data: map[string]interface{}{
+					"note": skydb.NewReference("note", "inactive-note"),
+				},
+			}), ShouldBeNil)
+
+			count, err := c.PurgeAnonymousUsers(context.Background(), inactiveSince)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			userinfo := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "inactive", &userinfo), ShouldBeNil)
+			record := skydb.Record{}
+			So(publicDB.Get(context.Background(), skydb.NewRecordID("note", "inactive-note"), &record), ShouldBeNil)
+		})
+
+		Convey("purges nothing if all anonymous users are active", func() {
+			count, err := c.PurgeAnonymousUsers(context.Background(), longAgo)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
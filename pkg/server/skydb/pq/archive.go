@@ -0,0 +1,92 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (c *conn) ArchiveRecord(ctx context.Context, archived *skydb.ArchivedRecord) error {
+	record := &archived.Record
+	if record.ID.Type == "" || record.ID.Key == "" || archived.ArchivedAt.IsZero() {
+		return errors.New("invalid archived record: empty record id or archived at")
+	}
+
+	pkData := map[string]interface{}{
+		"record_type": record.ID.Type,
+		"record_id":   record.ID.Key,
+	}
+	data := map[string]interface{}{
+		"owner_id":    record.OwnerID,
+		"access":      aclValue(record.ACL),
+		"data":        mutationDataValue(record.Data),
+		"created_at":  record.CreatedAt.UTC(),
+		"created_by":  record.CreatorID,
+		"updated_at":  record.UpdatedAt.UTC(),
+		"updated_by":  record.UpdaterID,
+		"archived_at": archived.ArchivedAt.UTC(),
+	}
+
+	upsert := upsertQuery(c.tableName("_archived_record"), pkData, data)
+	_, err := c.ExecWith(ctx, upsert)
+	return err
+}
+
+func (c *conn) GetArchivedRecord(ctx context.Context, id skydb.RecordID, archived *skydb.ArchivedRecord) error {
+	builder := psql.Select("owner_id", "access", "data", "created_at",
+		"created_by", "updated_at", "updated_by", "archived_at").
+		From(c.tableName("_archived_record")).
+		Where("record_type = ? AND record_id = ?", id.Type, id.Key)
+
+	var (
+		record skydb.Record
+		access sql.NullString
+		data   mutationDataValue
+	)
+	err := c.QueryRowWith(ctx, builder).Scan(
+		&record.OwnerID,
+		&access,
+		&data,
+		&record.CreatedAt,
+		&record.CreatorID,
+		&record.UpdatedAt,
+		&record.UpdaterID,
+		&archived.ArchivedAt,
+	)
+	if err == sql.ErrNoRows {
+		return skydb.ErrArchivedRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if access.Valid {
+		if err := json.Unmarshal([]byte(access.String), &record.ACL); err != nil {
+			return err
+		}
+	}
+	record.ID = id
+	record.Data = skydb.Data(data)
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.UpdatedAt = record.UpdatedAt.UTC()
+
+	archived.Record = record
+	archived.ArchivedAt = archived.ArchivedAt.UTC()
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordArchive(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		createdAt := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+		archivedAt := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+
+		archived := skydb.ArchivedRecord{
+			Record: skydb.Record{
+				ID:      skydb.NewRecordID("note", "1"),
+				OwnerID: "owner",
+				ACL: skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("reader", skydb.ReadLevel),
+				},
+				Data: skydb.Data{
+					"content":      "archived",
+					"published_at": createdAt,
+				},
+				CreatedAt: createdAt,
+				CreatorID: "owner",
+				UpdatedAt: createdAt,
+				UpdaterID: "owner",
+			},
+			ArchivedAt: archivedAt,
+		}
+		So(c.ArchiveRecord(context.Background(), &archived), ShouldBeNil)
+
+		Convey("gets an archived record", func() {
+			result := skydb.ArchivedRecord{}
+			So(c.GetArchivedRecord(context.Background(), skydb.NewRecordID("note", "1"), &result), ShouldBeNil)
+			So(result, ShouldResemble, archived)
+		})
+
+		Convey("replaces an archived record", func() {
+			archived.Record.Data["content"] = "archived again"
+			archived.ArchivedAt = archivedAt.Add(time.Hour)
+			So(c.ArchiveRecord(context.Background(), &archived), ShouldBeNil)
+
+			result := skydb.ArchivedRecord{}
+			So(c.GetArchivedRecord(context.Background(), skydb.NewRecordID("note", "1"), &result), ShouldBeNil)
+			So(result, ShouldResemble, archived)
+		})
+
+		Convey("returns ErrArchivedRecordNotFound", func() {
+			result := skydb.ArchivedRecord{}
+			err := c.GetArchivedRecord(context.Background(), skydb.NewRecordID("note", "2"), &result)
+			So(err, ShouldEqual, skydb.ErrArchivedRecordNotFound)
+		})
+	})
+}
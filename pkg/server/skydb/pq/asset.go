@@ -15,14 +15,16 @@
 package pq
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	sq "github.com/lann/squirrel"
 )
 
-func (c *conn) GetAsset(name string, asset *skydb.Asset) error {
-	assets, err := c.GetAssets([]string{name})
+func (c *conn) GetAsset(ctx context.Context, name string, asset *skydb.Asset) error {
+	assets, err := c.GetAssets(ctx, []string{name})
 
 	if len(assets) == 0 {
 		return errors.New("asset not found")
@@ -33,7 +35,7 @@ func (c *conn) GetAsset(name string, asset *skydb.Asset) error {
 	return err
 }
 
-func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
+func (c *conn) GetAssets(ctx context.Context, names []string) ([]skydb.Asset, error) {
 	if len(names) == 0 {
 		return []skydb.Asset{}, nil
 	}
@@ -43,11 +45,11 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 		nameArgs[idx] = interface{}(perName)
 	}
 
-	builder := psql.Select("id", "content_type", "size").
+	builder := psql.Select("id", "content_type", "size", "md5", "sha256", "upload_status").
 		From(c.tableName("_asset")).
 		Where("id IN ("+sq.Placeholders(len(names))+")", nameArgs...)
 
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		return nil, err
 	}
@@ -56,28 +58,52 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 	results := []skydb.Asset{}
 	for rows.Next() {
 		a := skydb.Asset{}
+		var md5, sha256 sql.NullString
+		var uploadStatus string
 		if err := rows.Scan(
 			&a.Name,
 			&a.ContentType,
-			&a.Size); err != nil {
+			&a.Size,
+			&md5,
+			&sha256,
+			&uploadStatus); err != nil {
 
 			panic(err)
 		}
+		a.MD5 = md5.String
+		a.SHA256 = sha256.String
+		a.UploadStatus = skydb.AssetUploadStatus(uploadStatus)
 		results = append(results, a)
 	}
 
 	return results, nil
 }
 
-func (c *conn) SaveAsset(asset *skydb.Asset) error {
+func (c *conn) SaveAsset(ctx context.Context, asset *skydb.Asset) error {
 	pkData := map[string]interface{}{
 		"id": asset.Name,
 	}
+	uploadStatus := asset.UploadStatus
+	if uploadStatus == "" {
+		uploadStatus = skydb.AssetUploadCompleted
+	}
 	data := map[string]interface{}{
-		"content_type": asset.ContentType,
-		"size":         asset.Size,
+		"content_type":  asset.ContentType,
+		"size":          asset.Size,
+		"md5":           nil,
+		"sha256":        nil,
+		"upload_status": string(uploadStatus),
+	}
+
+	if asset.MD5 != "" {
+		data["md5"] = asset.MD5
 	}
+
+	if asset.SHA256 != "" {
+		data["sha256"] = asset.SHA256
+	}
+
 	upsert := upsertQuery(c.tableName("_asset"), pkData, data)
-	_, err := c.ExecWith(upsert)
+	_, err := c.ExecWith(ctx, upsert)
 	return err
 }
@@ -16,9 +16,11 @@ package pq
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	sq "github.com/lann/squirrel"
 	"github.com/lib/pq"
@@ -28,10 +30,14 @@ import (
 
 // predicateSqlizerFactory is a factory for creating sqlizer for predicate
 type predicateSqlizerFactory struct {
-	db           *database
-	primaryTable string
-	joinedTables []joinedTable
-	extraColumns map[string]skydb.FieldType
+	// ctx is the context of the query built, for looking up the schema
+	// and users referenced by predicates.
+	ctx            context.Context
+	db             *database
+	primaryTable   string
+	joinedTables   []joinedTable
+	extraColumns   map[string]skydb.FieldType
+	fullTextFields []string
 }
 
 func (f *predicateSqlizerFactory) newPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
@@ -93,6 +99,15 @@ func (f *predicateSqlizerFactory) newFunctionalPredicateSqlizer(predicate skydb.
 		return f.newUserRelationFunctionalPredicateSqlizer(fn)
 	case skydb.UserDiscoverFunc:
 		return f.newUserDiscoverFunctionalPredicateSqlizer(fn)
+	case skydb.SharedWithUserFunc:
+		return f.newSharedWithUserFunctionalPredicateSqlizer(fn)
+	case skydb.WithinBoundsFunc:
+		return &boundsPredicateSqlizer{
+			f.primaryTable,
+			fn.Field,
+			fn.SouthWest,
+			fn.NorthEast,
+		}, nil
 	default:
 		panic("the specified function cannot be used as a functional predicate")
 	}
@@ -124,6 +139,19 @@ func (f *predicateSqlizerFactory) newUserRelationFunctionalPredicateSqlizer(fn s
 	}, nil
 }
 
+func (f *predicateSqlizerFactory) newSharedWithUserFunctionalPredicateSqlizer(fn skydb.SharedWithUserFunc) (sq.Sqlizer, error) {
+	userinfo := skydb.UserInfo{}
+	if err := f.db.c.GetUser(f.ctx, fn.User, &userinfo); err != nil && err != skydb.ErrUserNotFound {
+		return nil, err
+	}
+
+	return &sharedWithUserPredicateSqlizer{
+		alias: f.primaryTable,
+		user:  fn.User,
+		roles: userinfo.Roles,
+	}, nil
+}
+
 func (f *predicateSqlizerFactory) newUserDiscoverFunctionalPredicateSqlizer(fn skydb.UserDiscoverFunc) (sq.Sqlizer, error) {
 	if f.db.UserRecordType() != f.primaryTable {
 		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
@@ -194,6 +222,10 @@ func (f *predicateSqlizerFactory) newComparisonPredicateSqlizer(p skydb.Predicat
 		return sqlizer, nil
 	}
 
+	if p.Operator == skydb.Matches {
+		return f.newFullTextSearchPredicateSqlizer(p)
+	}
+
 	sqlizers := []expressionSqlizer{}
 	for _, child := range p.Children {
 		sqlizer, err := f.newExpressionSqlizer(child.(skydb.Expression))
@@ -209,6 +241,36 @@ func (f *predicateSqlizerFactory) newComparisonPredicateSqlizer(p skydb.Predicat
 	return &comparisonPredicateSqlizer{sqlizers, p.Operator}, nil
 }
 
+// newFullTextSearchPredicateSqlizer returns a sqlizer matching a string
+// field with a full-text search query. The field is remembered so that
+// a full-text index can be created for it.
+func (f *predicateSqlizerFactory) newFullTextSearchPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	exprs := p.GetExpressions()
+	column, err := f.newExpressionSqlizer(exprs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	keyPath := exprs[0].Value.(string)
+	if column.alias == f.primaryTable {
+		schema, err := f.db.remoteColumnTypes(f.ctx, f.primaryTable)
+		if err != nil {
+			return nil, err
+		}
+		if schema[keyPath].Type != skydb.TypeString {
+			return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`keypath "%s" of "MATCHES" must be a string`, keyPath)
+		}
+		f.fullTextFields = append(f.fullTextFields, keyPath)
+	}
+
+	return &fullTextSearchPredicateSqlizer{column, exprs[1].Value.(string)}, nil
+}
+
 // tryOptimizeDistancePredicate returns a sqlizer that is more efficient
 // at querying whether two points are within certain distance.
 //
@@ -275,7 +337,7 @@ func (f *predicateSqlizerFactory) newExpressionSqlizerForKeyPath(expr skydb.Expr
 	for i, component := range components {
 		isLast := (i == len(components)-1)
 
-		schema, err := f.db.remoteColumnTypes(recordType)
+		schema, err := f.db.remoteColumnTypes(f.ctx, recordType)
 		if err != nil {
 			return expressionSqlizer{}, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
 				`record type "%s" does not exist`, recordType)
@@ -360,8 +422,9 @@ func (f *predicateSqlizerFactory) updateTypemap(typemap skydb.RecordSchema) skyd
 	return typemap
 }
 
-func newPredicateSqlizerFactory(db *database, primaryTable string) *predicateSqlizerFactory {
+func newPredicateSqlizerFactory(ctx context.Context, db *database, primaryTable string) *predicateSqlizerFactory {
 	return &predicateSqlizerFactory{
+		ctx:          ctx,
 		db:           db,
 		primaryTable: primaryTable,
 		joinedTables: []joinedTable{},
@@ -423,6 +486,40 @@ func (p accessPredicateSqlizer) ToSql() (string, []interface{}, error) {
 	return b.String(), args, nil
 }
 
+// sharedWithUserPredicateSqlizer generates SQL condition that selects
+// the records not owned by the user and having an ACL entry granting the
+// user access by the ID or a role of the user.
+type sharedWithUserPredicateSqlizer struct {
+	alias string
+	user  string
+	roles []string
+}
+
+func (p sharedWithUserPredicateSqlizer) ToSql() (string, []interface{}, error) {
+	// The entries are matched regardless of the access level.
+	matchers := []map[string]string{{"user_id": p.user}}
+	for _, role := range p.roles {
+		matchers = append(matchers, map[string]string{"role": role})
+	}
+
+	accessColumn := fullQuoteIdentifier(p.alias, "_access")
+	conditions := make([]string, len(matchers))
+	args := []interface{}{p.user}
+	for i, matcher := range matchers {
+		encoded, err := json.Marshal([]map[string]string{matcher})
+		if err != nil {
+			return "", nil, err
+		}
+		conditions[i] = fmt.Sprintf("%s @> ?::jsonb", accessColumn)
+		args = append(args, string(encoded))
+	}
+
+	sql := fmt.Sprintf("(%s <> ? AND (%s))",
+		fullQuoteIdentifier(p.alias, "_owner_id"),
+		strings.Join(conditions, " OR "))
+	return sql, args, nil
+}
+
 type userRelationPredicateSqlizer struct {
 	outwardAlias string
 	inwardAlias  string
@@ -637,6 +734,14 @@ func funcToSQLOperand(alias string, fun skydb.Func) (string, []interface{}) {
 		}
 		args := []interface{}{}
 		return sql, args
+	case skydb.RankFunc:
+		order, err := sortOrderOrderBySQL(f.Order)
+		if err != nil {
+			panic(err)
+		}
+		sql := fmt.Sprintf("RANK() OVER (ORDER BY %s %s)",
+			fullQuoteIdentifier(alias, f.Field), order)
+		return sql, []interface{}{}
 	case skydb.UserDataFunc:
 		return fmt.Sprintf("_user.%s", f.DataName), []interface{}{}
 	default:
@@ -806,6 +911,128 @@ func (s distancePredicateSqlizer) ToSql() (sql string, args []interface{}, err e
 	return
 }
 
+// boundsPredicateSqlizer generates SQL condition that calculates if a
+// location is within a bounding box. A box crossing the antimeridian is
+// split into the parts on either side of it.
+type boundsPredicateSqlizer struct {
+	alias     string
+	field     string
+	southWest skydb.Location
+	northEast skydb.Location
+}
+
+// ToSql generates SQL for boundsPredicateSqlizer
+func (s boundsPredicateSqlizer) ToSql() (sql string, args []interface{}, err error) {
+	// && compares the bounding box of the point, which is the point
+	// itself, including points on the edges of the box.
+	column := fullQuoteIdentifier(s.alias, s.field)
+	envelope := func(west, east float64) (string, []interface{}) {
+		return fmt.Sprintf("%s && ST_MakeEnvelope(?, ?, ?, ?)", column),
+			[]interface{}{west, s.southWest.Lat(), east, s.northEast.Lat()}
+	}
+
+	if s.southWest.Lng() <= s.northEast.Lng() {
+		sql, args = envelope(s.southWest.Lng(), s.northEast.Lng())
+		return
+	}
+
+	westSQL, westArgs := envelope(s.southWest.Lng(), 180)
+	eastSQL, eastArgs := envelope(-180, s.northEast.Lng())
+	sql = fmt.Sprintf("(%s OR %s)", westSQL, eastSQL)
+	args = append(westArgs, eastArgs...)
+	return
+}
+
+// cursorSqlizer generates SQL condition that selects the records after
+// the cursor in the order of the sorts, followed by the `_id` column.
+//
+// PostgreSQL places NULL after other values in ascending order and
+// before them in descending order, which the condition follows.
+type cursorSqlizer struct {
+	alias  string
+	sorts  []skydb.Sort
+	cursor *skydb.QueryCursor
+}
+
+// ToSql generates SQL for cursorSqlizer
+func (s cursorSqlizer) ToSql() (sql string, args []interface{}, err error) {
+	if len(s.cursor.Values) != len(s.sorts) {
+		err = fmt.Errorf("got %d cursor values, want %d", len(s.cursor.Values), len(s.sorts))
+		return
+	}
+
+	// Records are after the cursor if the values of the preceding sort
+	// columns equal to those of the cursor, and the value of the current
+	// column is after that of the cursor.
+	after := sq.Or{}
+	equal := sq.And{}
+	for i, sort := range s.sorts {
+		if sort.KeyPath == "" {
+			err = errors.New("cursor is not supported for sort by function")
+			return
+		}
+
+		column := fullQuoteIdentifier(s.alias, sort.KeyPath)
+		value := literalToSQLValue(s.cursor.Values[i])
+		if columnAfter := cursorColumnAfterSqlizer(column, sort.Order, value); columnAfter != nil {
+			after = append(after, append(append(sq.And{}, equal...), columnAfter))
+		}
+
+		if value == nil {
+			equal = append(equal, sq.Expr(column+" IS NULL"))
+		} else {
+			equal = append(equal, sq.Expr(column+" = ?", value))
+		}
+	}
+
+	idColumn := fullQuoteIdentifier(s.alias, "_id")
+	after = append(after, append(append(sq.And{}, equal...), sq.Expr(idColumn+" > ?", s.cursor.ID)))
+	return after.ToSql()
+}
+
+// cursorColumnAfterSqlizer returns the condition of values of the column
+// after the value in the order, or nil if no value is after it.
+func cursorColumnAfterSqlizer(column string, order skydb.SortOrder, value interface{}) sq.Sqlizer {
+	if order == skydb.Desc {
+		if value == nil {
+			return sq.Expr(column + " IS NOT NULL")
+		}
+		return sq.Expr(column+" < ?", value)
+	}
+
+	if value == nil {
+		return nil
+	}
+	return sq.Or{
+		sq.Expr(column+" > ?", value),
+		sq.Expr(column + " IS NULL"),
+	}
+}
+
+// fullTextSearchPredicateSqlizer generates SQL condition that matches the
+// words of a column with the words of a query.
+type fullTextSearchPredicateSqlizer struct {
+	column expressionSqlizer
+	query  string
+}
+
+// ToSql generates SQL for fullTextSearchPredicateSqlizer
+func (p *fullTextSearchPredicateSqlizer) ToSql() (sql string, args []interface{}, err error) {
+	columnSQL, args, err := p.column.ToSql()
+	if err != nil {
+		return
+	}
+
+	sql = fmt.Sprintf(
+		"to_tsvector('%s', %s) @@ plainto_tsquery('%s', ?)",
+		fullTextSearchConfig,
+		columnSQL,
+		fullTextSearchConfig,
+	)
+	args = append(args, p.query)
+	return
+}
+
 // joinedTable represents a specification for table join
 type joinedTable struct {
 	secondaryTable  string
@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -33,6 +34,53 @@ func TestSqlizer(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 	})
+
+	Convey("Cursor Sqlizer", t, func() {
+		Convey("continues after values in order", func() {
+			sqlizer := cursorSqlizer{
+				alias: "note",
+				sorts: []skydb.Sort{
+					{KeyPath: "noteOrder", Order: skydb.Desc},
+					{KeyPath: "content", Order: skydb.Asc},
+				},
+				cursor: &skydb.QueryCursor{
+					Values: []interface{}{float64(2), "hello"},
+					ID:     "note2",
+				},
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `(("note"."noteOrder" < ?) OR ("note"."noteOrder" = ? AND ("note"."content" > ? OR "note"."content" IS NULL)) OR ("note"."noteOrder" = ? AND "note"."content" = ? AND "note"."_id" > ?))`)
+			So(args, ShouldResemble, []interface{}{float64(2), float64(2), "hello", float64(2), "hello", "note2"})
+		})
+
+		Convey("continues after null values", func() {
+			sqlizer := cursorSqlizer{
+				alias: "note",
+				sorts: []skydb.Sort{
+					{KeyPath: "noteOrder", Order: skydb.Asc},
+				},
+				cursor: &skydb.QueryCursor{
+					Values: []interface{}{nil},
+					ID:     "note2",
+				},
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `(("note"."noteOrder" IS NULL AND "note"."_id" > ?))`)
+			So(args, ShouldResemble, []interface{}{"note2"})
+		})
+
+		Convey("rejects cursor not matching the sorts", func() {
+			sqlizer := cursorSqlizer{
+				alias:  "note",
+				sorts:  []skydb.Sort{},
+				cursor: &skydb.QueryCursor{Values: []interface{}{"hello"}},
+			}
+			_, _, err := sqlizer.ToSql()
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
 
 func TestPredicateSqlizerFactory(t *testing.T) {
@@ -41,12 +89,12 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB().(*database)
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"title": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		f := newPredicateSqlizerFactory(db, "note")
+		f := newPredicateSqlizerFactory(context.Background(), db, "note")
 
 		Convey("existing keypath", func() {
 			sqlizer, err := f.newExpressionSqlizer(
@@ -74,13 +122,13 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB().(*database)
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"title":   skydb.FieldType{Type: skydb.TypeString},
 			"content": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		f := newPredicateSqlizerFactory(db, "note")
+		f := newPredicateSqlizerFactory(context.Background(), db, "note")
 
 		Convey("keypath equal null", func() {
 			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
@@ -142,6 +190,22 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("keypath matches full-text query", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Matches,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, "quick fox"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `to_tsvector('simple', "note"."content") @@ plainto_tsquery('simple', ?)`)
+			So(args, ShouldResemble, []interface{}{"quick fox"})
+			So(err, ShouldBeNil)
+			So(f.fullTextFields, ShouldResemble, []string{"content"})
+		})
+
 		Convey("non-existent keypath for equality", func() {
 			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
 				skydb.Equal,
@@ -174,15 +238,15 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB().(*database)
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"title": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		f := newPredicateSqlizerFactory(db, "user")
+		f := newPredicateSqlizerFactory(context.Background(), db, "user")
 
 		Convey("user discover must be used with user record", func() {
-			noteSqlizerFactory := newPredicateSqlizerFactory(db, "note")
+			noteSqlizerFactory := newPredicateSqlizerFactory(context.Background(), db, "note")
 			userDiscover := skydb.UserDiscoverFunc{
 				Emails: []string{},
 			}
@@ -233,12 +297,12 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB().(*database)
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"latlng": skydb.FieldType{Type: skydb.TypeLocation},
 		})
 		So(err, ShouldBeNil)
 
-		f := newPredicateSqlizerFactory(db, "note")
+		f := newPredicateSqlizerFactory(context.Background(), db, "note")
 
 		expr1 := skydb.Expression{
 			skydb.Function,
@@ -379,6 +443,62 @@ func TestAccessPredicateSqlizer(t *testing.T) {
 	})
 }
 
+func TestSharedWithUserPredicateSqlizer(t *testing.T) {
+	Convey("shared with user predicate", t, func() {
+		Convey("serialized", func() {
+			sqlizer := &sharedWithUserPredicateSqlizer{
+				alias: "note",
+				user:  "bob",
+				roles: []string{"marketing"},
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual,
+				`("note"."_owner_id" <> ? AND ("note"."_access" @> ?::jsonb OR "note"."_access" @> ?::jsonb))`)
+			So(args, ShouldResemble, []interface{}{
+				"bob",
+				`[{"user_id":"bob"}]`,
+				`[{"role":"marketing"}]`,
+			})
+		})
+	})
+}
+
+func TestBoundsPredicateSqlizer(t *testing.T) {
+	Convey("bounds predicate", t, func() {
+		Convey("serialized", func() {
+			sqlizer := &boundsPredicateSqlizer{
+				"note",
+				"latlng",
+				skydb.NewLocation(114.1, 22.2),
+				skydb.NewLocation(114.3, 22.4),
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual,
+				`"note"."latlng" && ST_MakeEnvelope(?, ?, ?, ?)`)
+			So(args, ShouldResemble, []interface{}{114.1, 22.2, 114.3, 22.4})
+		})
+
+		Convey("serialized across the antimeridian", func() {
+			sqlizer := &boundsPredicateSqlizer{
+				"note",
+				"latlng",
+				skydb.NewLocation(170.0, 10.0),
+				skydb.NewLocation(-170.0, 20.0),
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual,
+				`("note"."latlng" && ST_MakeEnvelope(?, ?, ?, ?) OR "note"."latlng" && ST_MakeEnvelope(?, ?, ?, ?))`)
+			So(args, ShouldResemble, []interface{}{
+				170.0, 10.0, 180.0, 20.0,
+				-180.0, 10.0, -170.0, 20.0,
+			})
+		})
+	})
+}
+
 func TestDistancePredicateSqlizer(t *testing.T) {
 	Convey("distance predicate", t, func() {
 		Convey("serialized", func() {
@@ -16,6 +16,7 @@ package pq
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
@@ -66,6 +67,35 @@ func (auth *authInfoValue) Scan(value interface{}) error {
 	return err
 }
 
+// loginLocationValue implements sql.Valuer and sql.Scanner s.t.
+// skydb.LoginLocation can be saved into and recovered from postgresql
+type loginLocationValue struct {
+	LoginLocation *skydb.LoginLocation
+}
+
+func (loc loginLocationValue) Value() (driver.Value, error) {
+	if loc.LoginLocation == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(loc.LoginLocation)
+}
+
+func (loc *loginLocationValue) Scan(value interface{}) error {
+	if value == nil {
+		loc.LoginLocation = nil
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("skydb: unsupported Scan pair: %T -> %T", value, loc.LoginLocation)
+	}
+
+	loc.LoginLocation = &skydb.LoginLocation{}
+	return json.Unmarshal(b, loc.LoginLocation)
+}
+
 // Ext is an interface for both sqlx.DB and sqlx.Tx
 type Ext interface {
 	sqlx.Ext
@@ -94,11 +124,14 @@ func (c *conn) Db() Ext {
 }
 
 // Begin begins a transaction.
-func (c *conn) Begin() error {
+func (c *conn) Begin(ctx context.Context) error {
 	log.Debugf("%p: Beginning transaction", c)
 	if c.tx != nil {
 		return skydb.ErrDatabaseTxDidBegin
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	tx, err := c.db.Beginx()
 	if err != nil {
@@ -162,6 +195,14 @@ func (c *conn) UnionDB() skydb.Database {
 	}
 }
 
+func (c *conn) UserUnionDB(userKey string) skydb.Database {
+	return &database{
+		c:            c,
+		databaseType: skydb.UnionDatabase,
+		userID:       userKey,
+	}
+}
+
 func (c *conn) Close() error { return nil }
 
 // return the raw unquoted schema name of this app
@@ -212,8 +253,18 @@ func (db *database) tableName(table string) string {
 
 // this ensures that our structure conform to certain interfaces.
 var (
-	_ skydb.Conn     = &conn{}
-	_ skydb.Database = &database{}
+	_ skydb.Conn                   = &conn{}
+	_ skydb.Database               = &database{}
+	_ skydb.RecordStatsStore       = &conn{}
+	_ skydb.StorageStatsStore      = &conn{}
+	_ skydb.SchemaPrivilegeChecker = &conn{}
+	_ skydb.AnonymousUserPurger    = &conn{}
+	_ skydb.DeviceMerger           = &conn{}
+	_ skydb.ScheduledMutationStore = &conn{}
+	_ skydb.RecordArchive          = &conn{}
+	_ skydb.RecordRanker           = &database{}
+	_ skydb.RecordDeletionLog      = &database{}
+	_ skydb.NotificationRecorder   = &database{}
 
 	_ driver.Valuer = authInfoValue{}
 )
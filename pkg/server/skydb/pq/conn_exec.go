@@ -15,16 +15,81 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/jmoiron/sqlx"
 	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
-func (c *conn) Get(dest interface{}, query string, args ...interface{}) (err error) {
+// watchStatement prefixes query with a comment tagging the statement
+// uniquely, and cancels the tagged statement in the database if ctx is
+// done before the returned function is called.
+//
+// The statement is looked up in pg_stat_activity by its tag, because
+// database/sql cannot cancel a statement in progress before Go 1.8.
+func (c *conn) watchStatement(ctx context.Context, query string) (string, func()) {
+	if ctx.Done() == nil {
+		return query, func() {}
+	}
+
+	tag := fmt.Sprintf("/* skygear:%s */ ", uuid.New())
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			select {
+			case <-finished:
+				return
+			default:
+			}
+			c.cancelStatement(tag)
+		}
+	}()
+	return tag + query, func() { close(finished) }
+}
+
+// cancelStatement cancels the statement tagged with tag if it is still
+// running. It uses a connection of the pool, as the connection running
+// the statement is busy.
+func (c *conn) cancelStatement(tag string) {
+	_, err := c.db.Exec(
+		`SELECT pg_cancel_backend(pid) FROM pg_stat_activity WHERE state = 'active' AND query LIKE $1`,
+		tag+"%",
+	)
+	if err != nil {
+		log.WithField("error", err).Warnln("Failed to cancel SQL statement")
+		return
+	}
+	log.Debugf("Cancelled SQL statement %s", tag)
+}
+
+// statementErr returns the error of ctx in place of err if the statement
+// failed because ctx is done.
+func statementErr(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code != "57014" {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (c *conn) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	c.statementCount++
-	err = c.Db().Get(dest, query, args...)
+	taggedQuery, finish := c.watchStatement(ctx, query)
+	err = c.Db().Get(dest, taggedQuery, args...)
+	finish()
+	err = statementErr(ctx, err)
 	logFields := logrus.Fields{
 		"sql":            query,
 		"args":           args,
@@ -39,17 +104,23 @@ func (c *conn) Get(dest interface{}, query string, args ...interface{}) (err err
 	return
 }
 
-func (c *conn) GetWith(dest interface{}, sqlizeri sq.Sqlizer) (err error) {
+func (c *conn) GetWith(ctx context.Context, dest interface{}, sqlizeri sq.Sqlizer) (err error) {
 	sql, args, err := sqlizeri.ToSql()
 	if err != nil {
 		panic(err)
 	}
-	return c.Get(dest, sql, args...)
+	return c.Get(ctx, dest, sql, args...)
 }
 
-func (c *conn) Exec(query string, args ...interface{}) (result sql.Result, err error) {
+func (c *conn) Exec(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	c.statementCount++
-	result, err = c.Db().Exec(query, args...)
+	taggedQuery, finish := c.watchStatement(ctx, query)
+	result, err = c.Db().Exec(taggedQuery, args...)
+	finish()
+	err = statementErr(ctx, err)
 
 	var rowsAffected int64
 	if result != nil {
@@ -77,17 +148,25 @@ func (c *conn) Exec(query string, args ...interface{}) (result sql.Result, err e
 	return
 }
 
-func (c *conn) ExecWith(sqlizeri sq.Sqlizer) (sql.Result, error) {
+func (c *conn) ExecWith(ctx context.Context, sqlizeri sq.Sqlizer) (sql.Result, error) {
 	sql, args, err := sqlizeri.ToSql()
 	if err != nil {
 		panic(err)
 	}
-	return c.Exec(sql, args...)
+	return c.Exec(ctx, sql, args...)
 }
 
-func (c *conn) Queryx(query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+// Queryx executes a query returning rows. The query is only cancelled
+// when ctx is done before its first row is returned.
+func (c *conn) Queryx(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	c.statementCount++
-	rows, err = c.Db().Queryx(query, args...)
+	taggedQuery, finish := c.watchStatement(ctx, query)
+	rows, err = c.Db().Queryx(taggedQuery, args...)
+	finish()
+	err = statementErr(ctx, err)
 	logFields := logrus.Fields{
 		"sql":            query,
 		"args":           args,
@@ -102,17 +181,19 @@ func (c *conn) Queryx(query string, args ...interface{}) (rows *sqlx.Rows, err e
 	return
 }
 
-func (c *conn) QueryWith(sqlizeri sq.Sqlizer) (*sqlx.Rows, error) {
+func (c *conn) QueryWith(ctx context.Context, sqlizeri sq.Sqlizer) (*sqlx.Rows, error) {
 	sql, args, err := sqlizeri.ToSql()
 	if err != nil {
 		panic(err)
 	}
-	return c.Queryx(sql, args...)
+	return c.Queryx(ctx, sql, args...)
 }
 
-func (c *conn) QueryRowx(query string, args ...interface{}) (row *sqlx.Row) {
+func (c *conn) QueryRowx(ctx context.Context, query string, args ...interface{}) (row *sqlx.Row) {
 	c.statementCount++
-	row = c.Db().QueryRowx(query, args...)
+	taggedQuery, finish := c.watchStatement(ctx, query)
+	row = c.Db().QueryRowx(taggedQuery, args...)
+	finish()
 	log.WithFields(logrus.Fields{
 		"sql":            query,
 		"args":           args,
@@ -121,10 +202,10 @@ func (c *conn) QueryRowx(query string, args ...interface{}) (row *sqlx.Row) {
 	return
 }
 
-func (c *conn) QueryRowWith(sqlizeri sq.Sqlizer) *sqlx.Row {
+func (c *conn) QueryRowWith(ctx context.Context, sqlizeri sq.Sqlizer) *sqlx.Row {
 	sql, args, err := sqlizeri.ToSql()
 	if err != nil {
 		panic(err)
 	}
-	return c.QueryRowx(sql, args...)
+	return c.QueryRowx(ctx, sql, args...)
 }
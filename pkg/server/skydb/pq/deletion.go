@@ -0,0 +1,63 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (db *database) QueryDeletedRecords(ctx context.Context, recordType string, since time.Time, until time.Time) ([]skydb.DeletedRecord, error) {
+	deletionTable := db.tableName("_record_deletion")
+	builder := psql.Select("record_id", "max(deleted_at)").
+		From(deletionTable).
+		Where("record_type = ? AND deleted_at > ? AND deleted_at <= ?", recordType, since.UTC(), until.UTC()).
+		Where("NOT EXISTS (SELECT 1 FROM " + db.tableName(recordType) + " r WHERE r._id = " +
+			deletionTable + ".record_id AND r._database_id = " + deletionTable + ".database_id)").
+		GroupBy("record_id").
+		OrderBy("max(deleted_at)")
+
+	switch db.DatabaseType() {
+	case skydb.UnionDatabase:
+		builder = builder.Where(sq.Eq{"database_id": []string{"", db.userID}})
+	default:
+		builder = builder.Where("database_id = ?", db.userID)
+	}
+
+	rows, err := db.c.QueryWith(ctx, builder)
+	if isUndefinedTable(err) {
+		return []skydb.DeletedRecord{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []skydb.DeletedRecord{}
+	for rows.Next() {
+		record := skydb.DeletedRecord{
+			ID: skydb.RecordID{Type: recordType},
+		}
+		if err := rows.Scan(&record.ID.Key, &record.DeletedAt); err != nil {
+			return nil, err
+		}
+		record.DeletedAt = record.DeletedAt.UTC()
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
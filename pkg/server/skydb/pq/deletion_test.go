@@ -0,0 +1,88 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordDeletionLog(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB().(*database)
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		for _, key := range []string{"1", "2"} {
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("note", key),
+				OwnerID: "owner",
+				Data:    skydb.Data{"content": "hello"},
+			}), ShouldBeNil)
+		}
+
+		since := time.Now().UTC().Add(-time.Minute)
+		until := time.Now().UTC().Add(time.Minute)
+
+		Convey("logs deleted records", func() {
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "1")), ShouldBeNil)
+
+			deleted, err := db.QueryDeletedRecords(context.Background(), "note", since, until)
+			So(err, ShouldBeNil)
+			So(deleted, ShouldHaveLength, 1)
+			So(deleted[0].ID, ShouldResemble, skydb.NewRecordID("note", "1"))
+			So(deleted[0].DeletedAt, ShouldHappenBetween, since, until)
+		})
+
+		Convey("does not log records deleted before since", func() {
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "1")), ShouldBeNil)
+
+			deleted, err := db.QueryDeletedRecords(context.Background(), "note", until, until.Add(time.Minute))
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeEmpty)
+		})
+
+		Convey("does not return records created again", func() {
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "1")), ShouldBeNil)
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("note", "1"),
+				OwnerID: "owner",
+				Data:    skydb.Data{"content": "again"},
+			}), ShouldBeNil)
+
+			deleted, err := db.QueryDeletedRecords(context.Background(), "note", since, until)
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeEmpty)
+		})
+
+		Convey("does not return records of other databases", func() {
+			So(db.Delete(context.Background(), skydb.NewRecordID("note", "1")), ShouldBeNil)
+
+			privateDB := c.PrivateDB("owner").(*database)
+			deleted, err := privateDB.QueryDeletedRecords(context.Background(), "note", since, until)
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeEmpty)
+		})
+	})
+}
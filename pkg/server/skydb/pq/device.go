@@ -15,15 +15,17 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
+	sq "github.com/lann/squirrel"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
-func (c *conn) GetDevice(id string, device *skydb.Device) error {
+func (c *conn) GetDevice(ctx context.Context, id string, device *skydb.Device) error {
 	builder := psql.Select("type", "token", "user_id", "topic", "last_registered_at").
 		From(c.tableName("_device")).
 		Where("id = ?", id)
@@ -31,7 +33,7 @@ func (c *conn) GetDevice(id string, device *skydb.Device) error {
 	nullableToken := sql.NullString{}
 	nullableTopic := sql.NullString{}
 	nullableUserID := sql.NullString{}
-	err := c.QueryRowWith(builder).Scan(
+	err := c.QueryRowWith(ctx, builder).Scan(
 		&device.Type,
 		&nullableToken,
 		&nullableUserID,
@@ -54,12 +56,12 @@ func (c *conn) GetDevice(id string, device *skydb.Device) error {
 	return nil
 }
 
-func (c *conn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
+func (c *conn) QueryDevicesByUser(ctx context.Context, user string) ([]skydb.Device, error) {
 	builder := psql.Select("id", "type", "token", "user_id", "topic", "last_registered_at").
 		From(c.tableName("_device")).
 		Where("user_id = ?", user)
 
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		panic(err)
 	}
@@ -88,12 +90,12 @@ func (c *conn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
 	return results, nil
 }
 
-func (c *conn) QueryDevicesByUserAndTopic(user, topic string) ([]skydb.Device, error) {
+func (c *conn) QueryDevicesByUserAndTopic(ctx context.Context, user, topic string) ([]skydb.Device, error) {
 	builder := psql.Select("id", "type", "token", "user_id", "topic", "last_registered_at").
 		From(c.tableName("_device")).
 		Where("user_id = ? AND topic = ?", user, topic)
 
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		panic(err)
 	}
@@ -120,7 +122,68 @@ func (c *conn) QueryDevicesByUserAndTopic(user, topic string) ([]skydb.Device, e
 	return results, nil
 }
 
-func (c *conn) SaveDevice(device *skydb.Device) error {
+func (c *conn) QueryDevicesByToken(ctx context.Context, token string) ([]skydb.Device, error) {
+	builder := psql.Select("id", "type", "token", "user_id", "topic", "last_registered_at").
+		From(c.tableName("_device")).
+		Where("token = ?", token).
+		OrderBy("last_registered_at DESC")
+
+	rows, err := c.QueryWith(ctx, builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []skydb.Device{}
+	for rows.Next() {
+		nullableUserID := sql.NullString{}
+		nullableTopic := sql.NullString{}
+		d := skydb.Device{}
+		if err := rows.Scan(
+			&d.ID,
+			&d.Type,
+			&d.Token,
+			&nullableUserID,
+			&nullableTopic,
+			&d.LastRegisteredAt); err != nil {
+
+			return nil, err
+		}
+		d.UserInfoID = nullableUserID.String
+		d.Topic = nullableTopic.String
+		d.LastRegisteredAt = d.LastRegisteredAt.UTC()
+		results = append(results, d)
+	}
+
+	return results, rows.Err()
+}
+
+func (c *conn) MergeDevices(ctx context.Context, id string, mergedIDs []string) error {
+	if len(mergedIDs) == 0 {
+		return nil
+	}
+
+	// subscriptions are moved one device at a time so that two merged
+	// devices holding the same subscription do not violate the primary key
+	for _, mergedID := range mergedIDs {
+		_, err := c.Exec(ctx, fmt.Sprintf(`
+UPDATE %[1]s AS s SET device_id = $1
+WHERE s.device_id = $2 AND NOT EXISTS (
+	SELECT 1 FROM %[1]s AS t
+	WHERE t.device_id = $1 AND t.user_id = s.user_id AND t.id = s.id
+)`, c.tableName("_subscription")), id, mergedID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// remaining subscriptions are deleted by cascade
+	builder := psql.Delete(c.tableName("_device")).
+		Where(sq.Eq{"id": mergedIDs})
+	_, err := c.ExecWith(ctx, builder)
+	return err
+}
+
+func (c *conn) SaveDevice(ctx context.Context, device *skydb.Device) error {
 	if device.ID == "" || device.Type == "" || device.LastRegisteredAt.IsZero() {
 		return errors.New("invalid device: empty id, type, or last registered at")
 	}
@@ -145,14 +208,14 @@ func (c *conn) SaveDevice(device *skydb.Device) error {
 	}
 
 	upsert := upsertQuery(c.tableName("_device"), pkData, data)
-	_, err := c.ExecWith(upsert)
+	_, err := c.ExecWith(ctx, upsert)
 	return err
 }
 
-func (c *conn) DeleteDevice(id string) error {
+func (c *conn) DeleteDevice(ctx context.Context, id string) error {
 	builder := psql.Delete(c.tableName("_device")).
 		Where("id = ?", id)
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 
 	if err != nil {
 		return err
@@ -171,13 +234,13 @@ func (c *conn) DeleteDevice(id string) error {
 	return nil
 }
 
-func (c *conn) DeleteDevicesByToken(token string, t time.Time) error {
+func (c *conn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
 	builder := psql.Delete(c.tableName("_device")).
 		Where("token = ?", token)
 	if t != skydb.ZeroTime {
 		builder = builder.Where("last_registered_at < ?", t)
 	}
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 
 	if err != nil {
 		return err
@@ -194,13 +257,13 @@ func (c *conn) DeleteDevicesByToken(token string, t time.Time) error {
 	return nil
 }
 
-func (c *conn) DeleteEmptyDevicesByTime(t time.Time) error {
+func (c *conn) DeleteEmptyDevicesByTime(ctx context.Context, t time.Time) error {
 	builder := psql.Delete(c.tableName("_device")).
 		Where("token IS NULL")
 	if t != skydb.ZeroTime {
 		builder = builder.Where("last_registered_at < ?", t)
 	}
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 
 	if err != nil {
 		return err
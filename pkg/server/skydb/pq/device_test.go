@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -38,10 +39,10 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
 			device = skydb.Device{}
-			err := c.GetDevice("deviceid", &device)
+			err := c.GetDevice(context.Background(), "deviceid", &device)
 			So(err, ShouldBeNil)
 			So(device, ShouldResemble, skydb.Device{
 				ID:               "deviceid",
@@ -63,14 +64,14 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldBeNil)
 
 			var (
 				deviceType, token, topic, userInfoID string
 				lastRegisteredAt                     time.Time
 			)
-			err = c.QueryRowx("SELECT type, token, topic, user_id, last_registered_at FROM _device WHERE id = 'deviceid'").Scan(&deviceType, &token, &topic, &userInfoID, &lastRegisteredAt)
+			err = c.QueryRowx(context.Background(), "SELECT type, token, topic, user_id, last_registered_at FROM _device WHERE id = 'deviceid'").Scan(&deviceType, &token, &topic, &userInfoID, &lastRegisteredAt)
 			So(err, ShouldBeNil)
 			So(deviceType, ShouldEqual, "ios")
 			So(token, ShouldEqual, "devicetoken")
@@ -89,17 +90,17 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldBeNil)
 
 			device.Token = "anotherdevicetoken"
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
 			var (
 				deviceType, token, topic, userInfoID string
 				lastRegisteredAt                     time.Time
 			)
-			err = c.QueryRowx("SELECT type, token, topic, user_id, last_registered_at FROM _device WHERE id = 'deviceid'").Scan(&deviceType, &token, &topic, &userInfoID, &lastRegisteredAt)
+			err = c.QueryRowx(context.Background(), "SELECT type, token, topic, user_id, last_registered_at FROM _device WHERE id = 'deviceid'").Scan(&deviceType, &token, &topic, &userInfoID, &lastRegisteredAt)
 			So(err, ShouldBeNil)
 			So(deviceType, ShouldEqual, "ios")
 			So(token, ShouldEqual, "anotherdevicetoken")
@@ -116,7 +117,7 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldNotBeNil)
 		})
 
@@ -128,7 +129,7 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldNotBeNil)
 		})
 
@@ -140,7 +141,7 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldBeNil)
 		})
 
@@ -152,7 +153,7 @@ func TestDevice(t *testing.T) {
 				UserInfoID: "userid",
 			}
 
-			err := c.SaveDevice(&device)
+			err := c.SaveDevice(context.Background(), &device)
 			So(err, ShouldNotBeNil)
 		})
 
@@ -164,13 +165,13 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			err := c.DeleteDevice("deviceid")
+			err := c.DeleteDevice(context.Background(), "deviceid")
 			So(err, ShouldBeNil)
 
 			var count int
-			err = c.QueryRowx("SELECT COUNT(*) FROM _device WHERE id = 'deviceid'").Scan(&count)
+			err = c.QueryRowx(context.Background(), "SELECT COUNT(*) FROM _device WHERE id = 'deviceid'").Scan(&count)
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 0)
 		})
@@ -183,13 +184,13 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			err := c.DeleteDevicesByToken("devicetoken", skydb.ZeroTime)
+			err := c.DeleteDevicesByToken(context.Background(), "devicetoken", skydb.ZeroTime)
 			So(err, ShouldBeNil)
 
 			var count int
-			err = c.QueryRowx("SELECT COUNT(*) FROM _device WHERE id = 'deviceid'").Scan(&count)
+			err = c.QueryRowx(context.Background(), "SELECT COUNT(*) FROM _device WHERE id = 'deviceid'").Scan(&count)
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 0)
 		})
@@ -202,9 +203,9 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			err := c.DeleteDevicesByToken("devicetoken", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+			err := c.DeleteDevicesByToken(context.Background(), "devicetoken", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
@@ -230,15 +231,15 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device0), ShouldBeNil)
-			So(c.SaveDevice(&device1), ShouldBeNil)
-			So(c.SaveDevice(&device2), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device0), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device1), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device2), ShouldBeNil)
 
-			err := c.DeleteEmptyDevicesByTime(skydb.ZeroTime)
+			err := c.DeleteEmptyDevicesByTime(context.Background(), skydb.ZeroTime)
 			So(err, ShouldBeNil)
 
 			var count int
-			err = c.QueryRowx("SELECT COUNT(*) FROM _device").Scan(&count)
+			err = c.QueryRowx(context.Background(), "SELECT COUNT(*) FROM _device").Scan(&count)
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 1)
 		})
@@ -260,15 +261,15 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device0), ShouldBeNil)
-			So(c.SaveDevice(&device1), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device0), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device1), ShouldBeNil)
 
-			err := c.DeleteEmptyDevicesByTime(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+			err := c.DeleteEmptyDevicesByTime(context.Background(), time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
 			So(err, ShouldBeNil)
 
 			device := skydb.Device{}
-			So(c.GetDevice("deviceid0", &device), ShouldEqual, skydb.ErrDeviceNotFound)
-			So(c.GetDevice("deviceid1", &device), ShouldBeNil)
+			So(c.GetDevice(context.Background(), "deviceid0", &device), ShouldEqual, skydb.ErrDeviceNotFound)
+			So(c.GetDevice(context.Background(), "deviceid1", &device), ShouldBeNil)
 			So(device, ShouldResemble, device1)
 		})
 
@@ -280,9 +281,9 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			err := c.DeleteEmptyDevicesByTime(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+			err := c.DeleteEmptyDevicesByTime(context.Background(), time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
@@ -295,7 +296,7 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
 			device = skydb.Device{
 				ID:               "device2",
@@ -305,9 +306,9 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			devices, err := c.QueryDevicesByUser("userid")
+			devices, err := c.QueryDevicesByUser(context.Background(), "userid")
 			So(err, ShouldBeNil)
 			So(len(devices), ShouldEqual, 2)
 			So(devices[0], ShouldResemble, skydb.Device{
@@ -327,7 +328,7 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			})
 
-			devices, err = c.QueryDevicesByUser("nonexistent")
+			devices, err = c.QueryDevicesByUser(context.Background(), "nonexistent")
 			So(err, ShouldBeNil)
 			So(len(devices), ShouldEqual, 0)
 		})
@@ -341,7 +342,7 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
 			device = skydb.Device{
 				ID:               "device2",
@@ -351,7 +352,7 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
 			device = skydb.Device{
 				ID:               "device3",
@@ -361,9 +362,9 @@ func TestDevice(t *testing.T) {
 				UserInfoID:       "userid",
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			}
-			So(c.SaveDevice(&device), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &device), ShouldBeNil)
 
-			devices, err := c.QueryDevicesByUserAndTopic("userid", "devicetopic1")
+			devices, err := c.QueryDevicesByUserAndTopic(context.Background(), "userid", "devicetopic1")
 			So(err, ShouldBeNil)
 			So(len(devices), ShouldEqual, 2)
 			So(devices[0], ShouldResemble, skydb.Device{
@@ -383,9 +384,82 @@ func TestDevice(t *testing.T) {
 				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
 			})
 
-			devices, err = c.QueryDevicesByUserAndTopic("nonexistent", "devicetopic1")
+			devices, err = c.QueryDevicesByUserAndTopic(context.Background(), "nonexistent", "devicetopic1")
 			So(err, ShouldBeNil)
 			So(len(devices), ShouldEqual, 0)
 		})
+
+		Convey("queries devices by token", func() {
+			So(c.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "device",
+				Type:             "ios",
+				Token:            "devicetoken",
+				Topic:            "devicetopic",
+				UserInfoID:       "userid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "device2",
+				Type:             "android",
+				Token:            "devicetoken",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 6, 0, time.UTC),
+			}), ShouldBeNil)
+			So(c.SaveDevice(context.Background(), &skydb.Device{
+				ID:               "device3",
+				Type:             "ios",
+				Token:            "othertoken",
+				UserInfoID:       "userid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), ShouldBeNil)
+
+			devices, err := c.QueryDevicesByToken(context.Background(), "devicetoken")
+			So(err, ShouldBeNil)
+			So(devices, ShouldResemble, []skydb.Device{
+				{
+					ID:               "device2",
+					Type:             "android",
+					Token:            "devicetoken",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 6, 0, time.UTC),
+				},
+				{
+					ID:               "device",
+					Type:             "ios",
+					Token:            "devicetoken",
+					Topic:            "devicetopic",
+					UserInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+				},
+			})
+		})
+
+		Convey("merges devices with their subscriptions", func() {
+			addDevice(t, c, "userid", "device")
+			addDevice(t, c, "userid", "device2")
+			addDevice(t, c, "userid", "device3")
+
+			db := c.PublicDB()
+			sub0 := subscriptionForTest("device", "sub0", "note")
+			sub1 := subscriptionForTest("device2", "sub1", "note")
+			sub0dup := subscriptionForTest("device2", "sub0", "note")
+			sub2 := subscriptionForTest("device3", "sub2", "note")
+			So(db.SaveSubscription(context.Background(), &sub0), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &sub1), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &sub0dup), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &sub2), ShouldBeNil)
+
+			err := c.MergeDevices(context.Background(), "device", []string{"device2", "device3"})
+			So(err, ShouldBeNil)
+
+			subscriptions := db.GetSubscriptionsByDeviceID(context.Background(), "device")
+			So(subscriptions, ShouldHaveLength, 3)
+			for _, subscription := range subscriptions {
+				So(subscription.DeviceID, ShouldEqual, "device")
+			}
+
+			device := skydb.Device{}
+			So(c.GetDevice(context.Background(), "device2", &device), ShouldEqual, skydb.ErrDeviceNotFound)
+			So(c.GetDevice(context.Background(), "device3", &device), ShouldEqual, skydb.ErrDeviceNotFound)
+			So(db.GetSubscriptionsByDeviceID(context.Background(), "device2"), ShouldBeEmpty)
+		})
 	})
 }
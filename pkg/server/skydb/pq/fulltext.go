@@ -0,0 +1,107 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// fullTextSearchConfig is the text search configuration of the MATCHES
+// operator. The simple configuration lowercases words without stemming,
+// which works with text of any language.
+const fullTextSearchConfig = "simple"
+
+// fullTextIndexes remembers the full-text indexes created by this process,
+// keyed by the quoted table name and column name.
+var fullTextIndexes = struct {
+	sync.Mutex
+	created map[string]bool
+}{
+	created: map[string]bool{},
+}
+
+// ensureFullTextIndexes creates a GIN index for full-text search on each
+// of the fields of the record type, unless it exists already.
+//
+// Indexes are not created if the connection does not allow migration.
+// Full-text search still works without them, only slower.
+func (db *database) ensureFullTextIndexes(ctx context.Context, recordType string, fields []string) error {
+	if !db.c.canMigrate || len(fields) == 0 {
+		return nil
+	}
+
+	tableName := db.tableName(recordType)
+
+	fullTextIndexes.Lock()
+	defer fullTextIndexes.Unlock()
+
+	for _, field := range fields {
+		key := tableName + "." + pq.QuoteIdentifier(field)
+		if fullTextIndexes.created[key] {
+			continue
+		}
+
+		stmt := fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (to_tsvector('%s', %s))`,
+			pq.QuoteIdentifier(fullTextIndexName(recordType, field)),
+			tableName,
+			fullTextSearchConfig,
+			pq.QuoteIdentifier(field),
+		)
+		log.WithField("stmt", stmt).Debugln("Creating full-text index")
+		if _, err := db.c.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create full-text index: %s", err)
+		}
+		fullTextIndexes.created[key] = true
+	}
+	return nil
+}
+
+// renameFullTextIndex renames the full-text index of a renamed field if
+// it exists, so that it is not created again under the new name.
+func (db *database) renameFullTextIndex(ctx context.Context, recordType string, oldName string, newName string) error {
+	stmt := fmt.Sprintf("ALTER INDEX IF EXISTS %s.%s RENAME TO %s",
+		pq.QuoteIdentifier(db.c.schemaName()),
+		pq.QuoteIdentifier(fullTextIndexName(recordType, oldName)),
+		pq.QuoteIdentifier(fullTextIndexName(recordType, newName)),
+	)
+	if _, err := db.c.Exec(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to rename full-text index: %s", err)
+	}
+	forgetFullTextIndexes(db.tableName(recordType))
+	return nil
+}
+
+func fullTextIndexName(recordType string, field string) string {
+	return recordType + "_" + field + "_fts"
+}
+
+// forgetFullTextIndexes forgets the full-text indexes created on the
+// table, which are dropped with the table or its columns.
+func forgetFullTextIndexes(tableName string) {
+	fullTextIndexes.Lock()
+	defer fullTextIndexes.Unlock()
+
+	for key := range fullTextIndexes.created {
+		if strings.HasPrefix(key, tableName+".") {
+			delete(fullTextIndexes.created, key)
+		}
+	}
+}
@@ -15,11 +15,13 @@
 package pq
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -46,13 +48,38 @@ func (c *conn) Subscribe(recordEventChan chan skydb.RecordEvent) error {
 	return nil
 }
 
-func emit(n *notification) {
+// emit sends n to the channels subscribed to its app. The notification
+// is marked delivered when all the channels have acknowledged it, or
+// right away if no channel is subscribed.
+//
+// Note: record hooks of plugins are not delivered through pending
+// notifications. A hook is run by the handler saving the record with
+// the user and the context of the request, which a notification emitted
+// later does not have; before-save hooks also have to run before the
+// record is written. Asynchronous after-save hooks are best-effort, see
+// plugin.CreateHookFunc.
+func (l *recordListener) emit(n *notification, deliveries skydb.DeliveryLog) {
 	channels := appEventChannelsMap[n.AppName]
+	if len(channels) == 0 {
+		l.markDelivered(n.ID)
+		return
+	}
+
+	remaining := int32(len(channels))
+	ack := func() {
+		if atomic.AddInt32(&remaining, -1) == 0 {
+			l.markDelivered(n.ID)
+		}
+	}
+
 	for _, channel := range channels {
 		go func(ch chan skydb.RecordEvent) {
+			var once sync.Once
 			ch <- skydb.RecordEvent{
-				Record: &n.Record,
-				Event:  n.ChangeEvent,
+				Record:     &n.Record,
+				Event:      n.ChangeEvent,
+				Ack:        func() { once.Do(ack) },
+				Deliveries: deliveries,
 			}
 		}(channel)
 	}
@@ -61,7 +88,27 @@ func emit(n *notification) {
 // the channel to listen for record changes
 const recordChangeChannel = "record_change"
 
+const (
+	// notificationLease is how long a claimed notification waits for
+	// acknowledgement before it is claimed and emitted again.
+	notificationLease = 5 * time.Minute
+
+	// notificationMaxAttempts is the number of times a notification is
+	// emitted before it is given up. The notification is kept in the
+	// table undelivered.
+	notificationMaxAttempts = 10
+
+	// notificationRetention is how long a delivered notification is
+	// kept before it is purged by the sweep.
+	notificationRetention = 24 * time.Hour
+
+	// sweepInterval is the interval between sweeps of the pending
+	// notifications.
+	sweepInterval = time.Minute
+)
+
 type notification struct {
+	ID          string
 	AppName     string
 	ChangeEvent skydb.RecordHookEvent
 	Record      skydb.Record
@@ -111,82 +158,197 @@ func (l *recordListener) Listen() {
 
 	log.Infof("pq/listener: Listening to %s...", recordChangeChannel)
 
+	// Notifications committed while no server was listening are only
+	// in the table, so they are swept after listening starts.
+	l.sweepNotifications()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case pqNotification := <-listener.Notify:
-			log.WithField("pqNotification", pqNotification).Infoln("Received a notify")
-
-			n := notification{}
-			if err := l.fetchNotification(pqNotification.Extra, &n); err != nil {
-				log.WithFields(logrus.Fields{
-					"pqNotification": pqNotification,
-					"err":            err,
-				}).Errorln("pq/listener: failed to fetch notification")
-
+			// A nil notification is sent after the connection is
+			// re-established, in which case the notifications
+			// committed in between are swept.
+			if pqNotification == nil {
+				l.sweepNotifications()
 				continue
 			}
 
-			emit(&n)
-
-			l.deleteNotification(pqNotification.Extra)
-		case <-time.After(60 * time.Second):
+			log.WithField("pqNotification", pqNotification).Infoln("Received a notify")
+			l.handleNotification(pqNotification.Extra)
+		case <-ticker.C:
 			go func() {
 				if err := listener.Ping(); err != nil {
 					log.WithField("err", err).Errorln("pq/listener: got an err while pinging connection")
 				}
 			}()
+			l.sweepNotifications()
 		}
 	}
 }
 
-// NOTE(limouren): pending_notification.id is integer in database.
-func (l *recordListener) fetchNotification(notificationID string, n *notification) error {
-	var rawNoti rawNotification
-	err := l.db.QueryRowx("SELECT op, appname, recordtype, record FROM public.pending_notification WHERE id = $1", notificationID).
-		StructScan(&rawNoti)
+// handleNotification claims and emits the pending notification of
+// notificationID. Nothing is emitted if it is claimed by another
+// listener, delivered or given up.
+func (l *recordListener) handleNotification(notificationID string) {
+	n := notification{}
+	claimed, err := l.claimNotification(notificationID, &n)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"notificationID": notificationID,
 			"err":            err,
-		}).Errorln("Failed to fetch pending notification")
-		return err
+		}).Errorln("pq/listener: failed to claim notification")
+		return
 	}
 
-	if err := parseNotification(&rawNoti, n); err != nil {
-		return err
+	if !claimed {
+		return
 	}
 
-	return nil
-}
-
-func (l *recordListener) deleteNotification(notificationID string) {
-	result, err := l.db.Exec("DELETE FROM public.pending_notification WHERE id = $1", notificationID)
+	// A notification emitted again is not delivered again to the
+	// receivers it was delivered to in the earlier attempts.
+	deliveries, err := l.loadDeliveryLog(n.ID)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"notificationID": notificationID,
 			"err":            err,
-		}).Errorln("Failed to delete notification")
+		}).Errorln("pq/listener: failed to load notification deliveries")
+		return
+	}
+
+	l.emit(&n, deliveries)
+}
+
+func (l *recordListener) loadDeliveryLog(notificationID string) (*notificationDeliveryLog, error) {
+	receivers := []string{}
+	err := l.db.Select(&receivers, "SELECT receiver FROM public.pending_notification_delivery WHERE notification_id = $1", notificationID)
+	if err != nil {
+		return nil, err
+	}
 
+	deliveries := &notificationDeliveryLog{
+		db:             l.db,
+		notificationID: notificationID,
+		receivers:      map[string]bool{},
+	}
+	for _, receiver := range receivers {
+		deliveries.receivers[receiver] = true
+	}
+	return deliveries, nil
+}
+
+// notificationDeliveryLog records the receivers a notification is
+// delivered to in public.pending_notification_delivery.
+type notificationDeliveryLog struct {
+	db             *sqlx.DB
+	notificationID string
+
+	mutex     sync.Mutex
+	receivers map[string]bool
+}
+
+func (d *notificationDeliveryLog) IsDelivered(receiver string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.receivers[receiver]
+}
+
+func (d *notificationDeliveryLog) MarkDelivered(receiver string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.receivers[receiver] {
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	_, err := d.db.Exec("INSERT INTO public.pending_notification_delivery (notification_id, receiver) VALUES ($1, $2)", d.notificationID, receiver)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"notificationID": notificationID,
+			"notificationID": d.notificationID,
+			"receiver":       receiver,
 			"err":            err,
-			"rowsAffected":   rowsAffected,
-		}).Errorln("More than one notification deleted")
-
+		}).Errorln("pq/listener: failed to record notification delivery")
 		return
 	}
+	d.receivers[receiver] = true
+}
 
-	if rowsAffected != 1 {
+// markDelivered records that the notification of notificationID is
+// acknowledged by all its subscribers, so that it is not emitted again.
+func (l *recordListener) markDelivered(notificationID string) {
+	_, err := l.db.Exec("UPDATE public.pending_notification SET delivered_at = (now() AT TIME ZONE 'UTC'), claimed_until = NULL WHERE id = $1", notificationID)
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"notificationID": notificationID,
-			"rowsAffected":   rowsAffected,
-		}).Errorln("Zero or more than one notification deleted")
+			"err":            err,
+		}).Errorln("pq/listener: failed to mark notification delivered")
+	}
+}
+
+// sweepNotifications emits the pending notifications left in the table,
+// such as those whose NOTIFY was missed while the listener was
+// disconnected and those not acknowledged before their lease expired.
+// Delivered notifications older than notificationRetention are purged.
+func (l *recordListener) sweepNotifications() {
+	_, err := l.db.Exec(
+		"DELETE FROM public.pending_notification WHERE delivered_at < (now() AT TIME ZONE 'UTC') - $1 * interval '1 second'",
+		int(notificationRetention/time.Second))
+	if err != nil {
+		log.WithField("err", err).Errorln("pq/listener: failed to purge delivered notifications")
 	}
+
+	notificationIDs := []string{}
+	err = l.db.Select(&notificationIDs, `
+SELECT id::text FROM public.pending_notification
+WHERE delivered_at IS NULL AND attempts < $1 AND
+	(claimed_until IS NULL OR claimed_until < (now() AT TIME ZONE 'UTC'))
+ORDER BY id`, notificationMaxAttempts)
+	if err != nil {
+		log.WithField("err", err).Errorln("pq/listener: failed to sweep pending notifications")
+		return
+	}
+
+	if len(notificationIDs) > 0 {
+		log.WithField("count", len(notificationIDs)).Infoln("pq/listener: sweeping pending notifications")
+	}
+	for _, notificationID := range notificationIDs {
+		l.handleNotification(notificationID)
+	}
+}
+
+// claimNotification leases the pending notification of notificationID
+// for notificationLease and parses it into n. The notification is
+// written by the trigger in the transaction of the record change and
+// kept until it is acknowledged, so it is delivered at least once. The
+// lease ensures that it is not emitted again by a sweep or by another
+// server while waiting for acknowledgement. The returned bool is false
+// if the notification is leased, delivered or given up.
+//
+// NOTE(limouren): pending_notification.id is integer in database.
+func (l *recordListener) claimNotification(notificationID string, n *notification) (bool, error) {
+	var rawNoti rawNotification
+	err := l.db.QueryRowx(`
+UPDATE public.pending_notification
+SET attempts = attempts + 1,
+	claimed_until = (now() AT TIME ZONE 'UTC') + $2 * interval '1 second'
+WHERE id = $1 AND delivered_at IS NULL AND attempts < $3 AND
+	(claimed_until IS NULL OR claimed_until < (now() AT TIME ZONE 'UTC'))
+RETURNING op, appname, recordtype, record`,
+		notificationID, int(notificationLease/time.Second), notificationMaxAttempts).
+		StructScan(&rawNoti)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := parseNotification(&rawNoti, n); err != nil {
+		return false, err
+	}
+	n.ID = notificationID
+
+	return true, nil
 }
 
 func parseNotification(raw *rawNotification, n *notification) error {
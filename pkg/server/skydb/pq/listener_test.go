@@ -0,0 +1,123 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordListener(t *testing.T) {
+	Convey("recordListener", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		appName := toLowerAndUnderscore(c.appName)
+		ch := make(chan skydb.RecordEvent, 1)
+		appEventChannelsMap[appName] = []chan skydb.RecordEvent{ch}
+		defer delete(appEventChannelsMap, appName)
+
+		l := &recordListener{db: c.Db().(*sqlx.DB)}
+		_, err := l.db.Exec("DELETE FROM public.pending_notification")
+		So(err, ShouldBeNil)
+
+		db := c.PublicDB()
+		_, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "user1",
+			Data:    map[string]interface{}{"content": "hello"},
+		}), ShouldBeNil)
+
+		Convey("sweeps pending notifications", func() {
+			l.sweepNotifications()
+
+			event := <-ch
+			So(event.Event, ShouldEqual, skydb.RecordCreated)
+			So(event.Record.ID, ShouldResemble, skydb.NewRecordID("note", "note1"))
+			So(event.Record.Data["content"], ShouldEqual, "hello")
+
+			var count int
+			So(l.db.Get(&count, "SELECT COUNT(*) FROM public.pending_notification WHERE delivered_at IS NULL"), ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			event.Ack()
+			So(l.db.Get(&count, "SELECT COUNT(*) FROM public.pending_notification WHERE delivered_at IS NULL"), ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			l.sweepNotifications()
+			select {
+			case <-ch:
+				So("delivered notification is emitted again", ShouldBeEmpty)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+
+		Convey("emits an unacknowledged notification again after its lease expires", func() {
+			l.sweepNotifications()
+			<-ch
+
+			_, err := l.db.Exec("UPDATE public.pending_notification SET claimed_until = (now() AT TIME ZONE 'UTC') - interval '1 second'")
+			So(err, ShouldBeNil)
+
+			l.sweepNotifications()
+			event := <-ch
+			So(event.Record.ID, ShouldResemble, skydb.NewRecordID("note", "note1"))
+
+			var attempts int
+			So(l.db.Get(&attempts, "SELECT attempts FROM public.pending_notification"), ShouldBeNil)
+			So(attempts, ShouldEqual, 2)
+		})
+
+		Convey("emits a notification again with its deliveries", func() {
+			l.sweepNotifications()
+			event := <-ch
+			So(event.IsDelivered("subscription:sub1"), ShouldBeFalse)
+			event.MarkDelivered("subscription:sub1")
+
+			_, err := l.db.Exec("UPDATE public.pending_notification SET claimed_until = (now() AT TIME ZONE 'UTC') - interval '1 second'")
+			So(err, ShouldBeNil)
+
+			l.sweepNotifications()
+			event = <-ch
+			So(event.IsDelivered("subscription:sub1"), ShouldBeTrue)
+			So(event.IsDelivered("observer:notes"), ShouldBeFalse)
+		})
+
+		Convey("claims a notification once", func() {
+			var notificationID string
+			So(l.db.Get(&notificationID, "SELECT id::text FROM public.pending_notification"), ShouldBeNil)
+
+			n := notification{}
+			claimed, err := l.claimNotification(notificationID, &n)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+			So(n.AppName, ShouldEqual, appName)
+
+			claimed, err = l.claimNotification(notificationID, &n)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeFalse)
+		})
+	})
+}
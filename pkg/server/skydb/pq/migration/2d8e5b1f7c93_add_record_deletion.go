@@ -0,0 +1,50 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_2d8e5b1f7c93 struct {
+}
+
+func (r *revision_2d8e5b1f7c93) Version() string {
+	return "2d8e5b1f7c93"
+}
+
+func (r *revision_2d8e5b1f7c93) Up(tx *sqlx.Tx) error {
+	const stmt = `
+CREATE TABLE _record_deletion (
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	database_id text NOT NULL,
+	deleted_at timestamp without time zone NOT NULL
+);
+CREATE INDEX _record_deletion_record_type_deleted_at ON _record_deletion (record_type, deleted_at);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_2d8e5b1f7c93) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE _record_deletion;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
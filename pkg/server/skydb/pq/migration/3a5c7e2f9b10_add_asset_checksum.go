@@ -0,0 +1,50 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_3a5c7e2f9b10 struct {
+}
+
+func (r *revision_3a5c7e2f9b10) Version() string {
+	return "3a5c7e2f9b10"
+}
+
+func (r *revision_3a5c7e2f9b10) Up(tx *sqlx.Tx) error {
+	const stmt = `
+ALTER TABLE _asset
+	ADD COLUMN md5 text,
+	ADD COLUMN sha256 text,
+	ADD COLUMN upload_status text NOT NULL DEFAULT 'completed';
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_3a5c7e2f9b10) Down(tx *sqlx.Tx) error {
+	const stmt = `
+ALTER TABLE _asset
+	DROP COLUMN md5,
+	DROP COLUMN sha256,
+	DROP COLUMN upload_status;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
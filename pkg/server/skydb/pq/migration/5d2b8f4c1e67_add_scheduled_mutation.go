@@ -0,0 +1,55 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_5d2b8f4c1e67 struct {
+}
+
+func (r *revision_5d2b8f4c1e67) Version() string {
+	return "5d2b8f4c1e67"
+}
+
+func (r *revision_5d2b8f4c1e67) Up(tx *sqlx.Tx) error {
+	const stmt = `
+CREATE TABLE _scheduled_mutation (
+	id text PRIMARY KEY,
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	database_id text NOT NULL DEFAULT '',
+	data jsonb NOT NULL,
+	run_at timestamp without time zone NOT NULL,
+	created_at timestamp without time zone NOT NULL,
+	created_by text
+);
+CREATE INDEX _scheduled_mutation_run_at ON _scheduled_mutation (run_at);
+CREATE INDEX _scheduled_mutation_record ON _scheduled_mutation (record_type, record_id);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_5d2b8f4c1e67) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE _scheduled_mutation;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_6f2a9d4e1b38 struct {
+}
+
+func (r *revision_6f2a9d4e1b38) Version() string {
+	return "6f2a9d4e1b38"
+}
+
+func (r *revision_6f2a9d4e1b38) Up(tx *sqlx.Tx) error {
+	const stmt = `
+ALTER TABLE public.pending_notification
+	ADD COLUMN attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN claimed_until timestamp without time zone,
+	ADD COLUMN delivered_at timestamp without time zone;
+CREATE TABLE public.pending_notification_delivery (
+	notification_id integer NOT NULL REFERENCES public.pending_notification (id) ON DELETE CASCADE,
+	receiver text NOT NULL,
+	PRIMARY KEY (notification_id, receiver)
+);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_6f2a9d4e1b38) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE IF EXISTS public.pending_notification_delivery;
+ALTER TABLE public.pending_notification
+	DROP COLUMN IF EXISTS attempts,
+	DROP COLUMN IF EXISTS claimed_until,
+	DROP COLUMN IF EXISTS delivered_at;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
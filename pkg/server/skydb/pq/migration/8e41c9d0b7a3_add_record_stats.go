@@ -0,0 +1,60 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_8e41c9d0b7a3 struct {
+}
+
+func (r *revision_8e41c9d0b7a3) Version() string {
+	return "8e41c9d0b7a3"
+}
+
+func (r *revision_8e41c9d0b7a3) Up(tx *sqlx.Tx) error {
+	const stmt = `
+CREATE TABLE _record_activity (
+	occurred_at timestamp without time zone NOT NULL,
+	record_type text NOT NULL,
+	operation text NOT NULL,
+	user_id text
+);
+CREATE INDEX _record_activity_occurred_at ON _record_activity (occurred_at);
+CREATE TABLE _record_stats (
+	date date NOT NULL,
+	record_type text NOT NULL,
+	creates bigint NOT NULL DEFAULT 0,
+	updates bigint NOT NULL DEFAULT 0,
+	deletes bigint NOT NULL DEFAULT 0,
+	active_users bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (date, record_type)
+);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_8e41c9d0b7a3) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE _record_stats;
+DROP TABLE _record_activity;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_9c4e1a7d3b85 struct {
+}
+
+func (r *revision_9c4e1a7d3b85) Version() string {
+	return "9c4e1a7d3b85"
+}
+
+func (r *revision_9c4e1a7d3b85) Up(tx *sqlx.Tx) error {
+	const stmt = `
+CREATE TABLE _archived_record (
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	owner_id text NOT NULL,
+	access jsonb,
+	data jsonb NOT NULL,
+	created_at timestamp without time zone NOT NULL,
+	created_by text NOT NULL,
+	updated_at timestamp without time zone NOT NULL,
+	updated_by text NOT NULL,
+	archived_at timestamp without time zone NOT NULL,
+	PRIMARY KEY (record_type, record_id)
+);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_9c4e1a7d3b85) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE _archived_record;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
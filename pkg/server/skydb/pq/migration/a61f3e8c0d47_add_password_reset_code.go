@@ -0,0 +1,50 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_a61f3e8c0d47 struct {
+}
+
+func (r *revision_a61f3e8c0d47) Version() string {
+	return "a61f3e8c0d47"
+}
+
+func (r *revision_a61f3e8c0d47) Up(tx *sqlx.Tx) error {
+	const stmt = `
+CREATE TABLE _password_reset_code (
+	code_hash text PRIMARY KEY,
+	user_id text NOT NULL REFERENCES _user (id) ON DELETE CASCADE,
+	expire_at timestamp without time zone NOT NULL,
+	created_at timestamp without time zone NOT NULL
+);
+CREATE INDEX _password_reset_code_user_id ON _password_reset_code (user_id);
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_a61f3e8c0d47) Down(tx *sqlx.Tx) error {
+	const stmt = `
+DROP TABLE _password_reset_code;
+`
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_e3b7d2c58f14 struct {
+}
+
+func (r *revision_e3b7d2c58f14) Version() string {
+	return "e3b7d2c58f14"
+}
+
+func (r *revision_e3b7d2c58f14) Up(tx *sqlx.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE _subscription ADD COLUMN last_notified_at timestamp without time zone;`); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revision_e3b7d2c58f14) Down(tx *sqlx.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE _subscription DROP COLUMN last_notified_at;`); err != nil {
+		return err
+	}
+	return nil
+}
@@ -25,7 +25,7 @@ import (
 type fullMigration struct {
 }
 
-func (r *fullMigration) Version() string { return "1981535c8aeb" }
+func (r *fullMigration) Version() string { return "2d8e5b1f7c93" }
 
 func (r *fullMigration) createTable(tx *sqlx.Tx) error {
 	const stmt = `
@@ -36,7 +36,15 @@ CREATE TABLE IF NOT EXISTS public.pending_notification (
 	op text NOT NULL,
 	appname text NOT NULL,
 	recordtype text NOT NULL,
-	record jsonb NOT NULL
+	record jsonb NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	claimed_until timestamp without time zone,
+	delivered_at timestamp without time zone
+);
+CREATE TABLE IF NOT EXISTS public.pending_notification_delivery (
+	notification_id integer NOT NULL REFERENCES public.pending_notification (id) ON DELETE CASCADE,
+	receiver text NOT NULL,
+	PRIMARY KEY (notification_id, receiver)
 );
 CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
 	DECLARE
@@ -65,6 +73,7 @@ CREATE TABLE _user (
 	token_valid_since timestamp without time zone,
 	last_login_at timestamp without time zone,
 	last_seen_at timestamp without time zone,
+	last_login_location jsonb,
 	UNIQUE (username),
 	UNIQUE (email)
 );
@@ -84,7 +93,10 @@ CREATE TABLE _user_role (
 CREATE TABLE _asset (
 	id text PRIMARY KEY,
 	content_type text NOT NULL,
-	size bigint NOT NULL
+	size bigint NOT NULL,
+	md5 text,
+	sha256 text,
+	upload_status text NOT NULL DEFAULT 'completed'
 );
 CREATE TABLE _device (
 	id text PRIMARY KEY,
@@ -103,6 +115,7 @@ CREATE TABLE _subscription (
 	type text NOT NULL,
 	notification_info jsonb,
 	query jsonb,
+	last_notified_at timestamp without time zone,
 	PRIMARY KEY(user_id, device_id, id)
 );
 CREATE TABLE _friend (
@@ -122,6 +135,61 @@ CREATE TABLE _record_creation (
     FOREIGN KEY (role_id) REFERENCES _role(id)
 );
 CREATE INDEX _record_creation_unique_record_type ON _record_creation (record_type);
+CREATE TABLE _record_activity (
+	occurred_at timestamp without time zone NOT NULL,
+	record_type text NOT NULL,
+	operation text NOT NULL,
+	user_id text
+);
+CREATE INDEX _record_activity_occurred_at ON _record_activity (occurred_at);
+CREATE TABLE _record_stats (
+	date date NOT NULL,
+	record_type text NOT NULL,
+	creates bigint NOT NULL DEFAULT 0,
+	updates bigint NOT NULL DEFAULT 0,
+	deletes bigint NOT NULL DEFAULT 0,
+	active_users bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (date, record_type)
+);
+CREATE TABLE _scheduled_mutation (
+	id text PRIMARY KEY,
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	database_id text NOT NULL DEFAULT '',
+	data jsonb NOT NULL,
+	run_at timestamp without time zone NOT NULL,
+	created_at timestamp without time zone NOT NULL,
+	created_by text
+);
+CREATE INDEX _scheduled_mutation_run_at ON _scheduled_mutation (run_at);
+CREATE INDEX _scheduled_mutation_record ON _scheduled_mutation (record_type, record_id);
+CREATE TABLE _password_reset_code (
+	code_hash text PRIMARY KEY,
+	user_id text NOT NULL REFERENCES _user (id) ON DELETE CASCADE,
+	expire_at timestamp without time zone NOT NULL,
+	created_at timestamp without time zone NOT NULL
+);
+CREATE INDEX _password_reset_code_user_id ON _password_reset_code (user_id);
+CREATE TABLE _archived_record (
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	owner_id text NOT NULL,
+	access jsonb,
+	data jsonb NOT NULL,
+	created_at timestamp without time zone NOT NULL,
+	created_by text NOT NULL,
+	updated_at timestamp without time zone NOT NULL,
+	updated_by text NOT NULL,
+	archived_at timestamp without time zone NOT NULL,
+	PRIMARY KEY (record_type, record_id)
+);
+CREATE TABLE _record_deletion (
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	database_id text NOT NULL,
+	deleted_at timestamp without time zone NOT NULL
+);
+CREATE INDEX _record_deletion_record_type_deleted_at ON _record_deletion (record_type, deleted_at);
 `
 	_, err := tx.Exec(stmt)
 	return err
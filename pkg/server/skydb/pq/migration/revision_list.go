@@ -28,4 +28,13 @@ var revisions = []Revision{
 	&revision_88a550bf579{},
 	&revision_db76e79e987{},
 	&revision_1981535c8aeb{},
+	&revision_7b1c1c9e4d2a{},
+	&revision_3a5c7e2f9b10{},
+	&revision_8e41c9d0b7a3{},
+	&revision_5d2b8f4c1e67{},
+	&revision_a61f3e8c0d47{},
+	&revision_e3b7d2c58f14{},
+	&revision_9c4e1a7d3b85{},
+	&revision_6f2a9d4e1b38{},
+	&revision_2d8e5b1f7c93{},
 }
@@ -0,0 +1,62 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (c *conn) SavePasswordResetCode(ctx context.Context, code *skydb.PasswordResetCode) error {
+	if code.CodeHash == "" || code.UserID == "" || code.ExpireAt.IsZero() {
+		return errors.New("invalid password reset code: empty code hash, user id or expire at")
+	}
+
+	builder := psql.Insert(c.tableName("_password_reset_code")).
+		Columns("code_hash", "user_id", "expire_at", "created_at").
+		Values(code.CodeHash, code.UserID, code.ExpireAt.UTC(), code.CreatedAt.UTC())
+	_, err := c.ExecWith(ctx, builder)
+	return err
+}
+
+func (c *conn) GetPasswordResetCode(ctx context.Context, codeHash string, code *skydb.PasswordResetCode) error {
+	builder := psql.Select("code_hash", "user_id", "expire_at", "created_at").
+		From(c.tableName("_password_reset_code")).
+		Where("code_hash = ?", codeHash)
+	err := c.QueryRowWith(ctx, builder).Scan(
+		&code.CodeHash,
+		&code.UserID,
+		&code.ExpireAt,
+		&code.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return skydb.ErrPasswordResetCodeNotFound
+	} else if err != nil {
+		return err
+	}
+	code.ExpireAt = code.ExpireAt.UTC()
+	code.CreatedAt = code.CreatedAt.UTC()
+	return nil
+}
+
+func (c *conn) DeletePasswordResetCodes(ctx context.Context, userID string) error {
+	builder := psql.Delete(c.tableName("_password_reset_code")).
+		Where("user_id = ?", userID)
+	_, err := c.ExecWith(ctx, builder)
+	return err
+}
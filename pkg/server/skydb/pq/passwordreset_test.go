@@ -0,0 +1,73 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPasswordResetCode(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		addUser(t, c, "user1")
+		addUser(t, c, "user2")
+
+		createdAt := time.Date(2017, 2, 1, 10, 0, 0, 0, time.UTC)
+		code1 := skydb.PasswordResetCode{
+			CodeHash:  "hash1",
+			UserID:    "user1",
+			ExpireAt:  createdAt.Add(time.Hour),
+			CreatedAt: createdAt,
+		}
+		code2 := skydb.PasswordResetCode{
+			CodeHash:  "hash2",
+			UserID:    "user2",
+			ExpireAt:  createdAt.Add(time.Hour),
+			CreatedAt: createdAt,
+		}
+		So(c.SavePasswordResetCode(context.Background(), &code1), ShouldBeNil)
+		So(c.SavePasswordResetCode(context.Background(), &code2), ShouldBeNil)
+
+		Convey("gets a code", func() {
+			code := skydb.PasswordResetCode{}
+			So(c.GetPasswordResetCode(context.Background(), "hash1", &code), ShouldBeNil)
+			So(code, ShouldResemble, code1)
+		})
+
+		Convey("returns ErrPasswordResetCodeNotFound", func() {
+			code := skydb.PasswordResetCode{}
+			So(c.GetPasswordResetCode(context.Background(), "nonexistent", &code), ShouldEqual, skydb.ErrPasswordResetCodeNotFound)
+		})
+
+		Convey("deletes codes of a user", func() {
+			So(c.DeletePasswordResetCodes(context.Background(), "user1"), ShouldBeNil)
+
+			code := skydb.PasswordResetCode{}
+			So(c.GetPasswordResetCode(context.Background(), "hash1", &code), ShouldEqual, skydb.ErrPasswordResetCodeNotFound)
+			So(c.GetPasswordResetCode(context.Background(), "hash2", &code), ShouldBeNil)
+		})
+
+		Convey("rejects code without user", func() {
+			So(c.SavePasswordResetCode(context.Background(), &skydb.PasswordResetCode{CodeHash: "hash3"}), ShouldNotBeNil)
+		})
+	})
+}
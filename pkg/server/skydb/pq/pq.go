@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net"
@@ -72,9 +73,10 @@ type queryxRunner interface {
 	QueryRowx(query string, args ...interface{}) *sqlx.Row
 }
 
-// Open returns a new connection to postgresql implementation
-func Open(appName string, accessModel skydb.AccessModel, connString string, migrate bool) (skydb.Conn, error) {
-	db, err := getDB(appName, connString, migrate)
+// Open returns a new connection to postgresql implementation. Open gives
+// up waiting for the database to be initialized once ctx is done.
+func Open(ctx context.Context, appName string, accessModel skydb.AccessModel, connString string, migrate bool) (skydb.Conn, error) {
+	db, err := getDB(ctx, appName, connString, migrate)
 	if err != nil {
 		return nil, err
 	}
@@ -104,44 +106,136 @@ type getDBResp struct {
 	err error
 }
 
-var dbs = map[string]*sqlx.DB{}
+// dbKey identifies a pool. Each app has pools of its own, so that the
+// database of each app is initialized and its pool options apply.
+type dbKey struct {
+	appName    string
+	connString string
+}
+
+type appPoolOptionsReq struct {
+	appName string
+	options skydb.PoolOptions
+}
+
+var dbs = map[dbKey]*sqlx.DB{}
 var getDBChan = make(chan getDBReq)
+var closeDBsChan = make(chan chan error)
+var poolOptionsChan = make(chan skydb.PoolOptions)
+var appPoolOptionsChan = make(chan appPoolOptionsReq)
 
-func getDB(appName, connString string, migrate bool) (*sqlx.DB, error) {
-	ch := make(chan getDBResp)
-	getDBChan <- getDBReq{appName, connString, migrate, ch}
-	resp := <-ch
-	return resp.db, resp.err
+// poolOptions and appPoolOptions are owned by dbInitializer.
+var poolOptions = skydb.PoolOptions{
+	MaxOpenConns: 10,
+	MaxIdleConns: 2,
+}
+var appPoolOptions = map[string]skydb.PoolOptions{}
+
+func poolOptionsOf(appName string) skydb.PoolOptions {
+	if options, ok := appPoolOptions[appName]; ok {
+		return options
+	}
+	return poolOptions
+}
+
+func getDB(ctx context.Context, appName, connString string, migrate bool) (*sqlx.DB, error) {
+	// The response is buffered so that dbInitializer is not blocked
+	// after the request is abandoned.
+	ch := make(chan getDBResp, 1)
+	select {
+	case getDBChan <- getDBReq{appName, connString, migrate, ch}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case resp := <-ch:
+		return resp.db, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 // goroutine that initialize the database for use
 func dbInitializer() {
 	for {
-		req := <-getDBChan
-		db, ok := dbs[req.connString]
-		if !ok {
-			var err error
-			db, err = sqlx.Open("postgres", req.connString)
-			if err != nil {
-				req.done <- getDBResp{nil, fmt.Errorf("failed to open connection: %s", err)}
-				continue
-			}
+		select {
+		case req := <-getDBChan:
+			key := dbKey{req.appName, req.connString}
+			db, ok := dbs[key]
+			if !ok {
+				var err error
+				db, err = sqlx.Open("postgres", req.connString)
+				if err != nil {
+					req.done <- getDBResp{nil, fmt.Errorf("failed to open connection: %s", err)}
+					continue
+				}
 
-			db.SetMaxOpenConns(10)
+				applyPoolOptions(db, poolOptionsOf(req.appName))
 
-			if err := mustInitDB(db, req.appName, req.migrate); err != nil {
-				db.Close()
-				req.done <- getDBResp{nil, fmt.Errorf("failed to open connection: %s", err)}
-				continue
+				if err := mustInitDB(db, req.appName, req.migrate); err != nil {
+					db.Close()
+					req.done <- getDBResp{nil, fmt.Errorf("failed to open connection: %s", err)}
+					continue
+				}
+
+				dbs[key] = db
 			}
 
-			dbs[req.connString] = db
+			req.done <- getDBResp{db, nil}
+		case done := <-closeDBsChan:
+			var lastErr error
+			for key, db := range dbs {
+				if err := db.Close(); err != nil {
+					lastErr = err
+				}
+				delete(dbs, key)
+			}
+			done <- lastErr
+		case options := <-poolOptionsChan:
+			poolOptions = options
+			for key, db := range dbs {
+				applyPoolOptions(db, poolOptionsOf(key.appName))
+			}
+		case req := <-appPoolOptionsChan:
+			appPoolOptions[req.appName] = req.options
+			for key, db := range dbs {
+				if key.appName == req.appName {
+					applyPoolOptions(db, req.options)
+				}
+			}
 		}
-
-		req.done <- getDBResp{db, nil}
 	}
 }
 
+func applyPoolOptions(db *sqlx.DB, options skydb.PoolOptions) {
+	db.SetMaxOpenConns(options.MaxOpenConns)
+	db.SetMaxIdleConns(options.MaxIdleConns)
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+}
+
+// SetPoolOptions configures the connection pools shared by Conns
+// returned by Open, including the pools already open.
+func SetPoolOptions(options skydb.PoolOptions) {
+	poolOptionsChan <- options
+}
+
+// SetAppPoolOptions configures the connection pools of appName shared
+// by Conns returned by Open, overriding the options set by
+// SetPoolOptions.
+func SetAppPoolOptions(appName string, options skydb.PoolOptions) {
+	appPoolOptionsChan <- appPoolOptionsReq{appName, options}
+}
+
+// Close closes the connection pools shared by Conns returned by Open,
+// waiting for queries in progress to finish. Conns opened afterwards
+// open new pools.
+func Close() error {
+	done := make(chan error)
+	closeDBsChan <- done
+	return <-done
+}
+
 // mustInitDB initialize database objects for an application.
 func mustInitDB(db *sqlx.DB, appName string, migrate bool) error {
 	schema := "app_" + toLowerAndUnderscore(appName)
@@ -161,7 +255,25 @@ func mustInitDB(db *sqlx.DB, appName string, migrate bool) error {
 	return nil
 }
 
+type pqDriver struct{}
+
+func (pqDriver) Open(ctx context.Context, appName string, accessModel skydb.AccessModel, connString string, migrate bool) (skydb.Conn, error) {
+	return Open(ctx, appName, accessModel, connString, migrate)
+}
+
+func (pqDriver) Close() error {
+	return Close()
+}
+
+func (pqDriver) SetPoolOptions(options skydb.PoolOptions) {
+	SetPoolOptions(options)
+}
+
+func (pqDriver) SetAppPoolOptions(appName string, options skydb.PoolOptions) {
+	SetAppPoolOptions(appName, options)
+}
+
 func init() {
-	skydb.Register("pq", skydb.DriverFunc(Open))
+	skydb.Register("pq", pqDriver{})
 	go dbInitializer()
 }
@@ -0,0 +1,141 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+const queryHintsSavepoint = "skygear_query_hints"
+
+// planner settings that leave only the join strategy enabled
+var joinStrategySettings = map[skydb.JoinStrategy][]string{
+	skydb.NestedLoopJoin: {"enable_hashjoin", "enable_mergejoin"},
+	skydb.HashJoin:       {"enable_nestloop", "enable_mergejoin"},
+	skydb.MergeJoin:      {"enable_nestloop", "enable_hashjoin"},
+}
+
+// queryHintSettings returns the planner settings to turn off for the
+// hints.
+func queryHintSettings(hints *skydb.QueryHints) ([]string, error) {
+	settings := []string{}
+	if hints.DisableSeqScan {
+		settings = append(settings, "enable_seqscan")
+	}
+	if hints.JoinStrategy != "" {
+		joinSettings, ok := joinStrategySettings[hints.JoinStrategy]
+		if !ok {
+			return nil, skyerr.NewInvalidArgument(
+				fmt.Sprintf("unknown join strategy %s", hints.JoinStrategy),
+				[]string{"hints"},
+			)
+		}
+		settings = append(settings, joinSettings...)
+	}
+	return settings, nil
+}
+
+// applyQueryHints applies the hints of the query to the select statement
+// and the planner settings of the connection.
+//
+// PostgreSQL has no index hints, so the preferred index is written as a
+// pg_hint_plan comment, which takes effect only if the extension is
+// loaded. The planner settings are set locally in a transaction, or a
+// savepoint if a transaction is in effect. The returned function reverts
+// the settings, and must be called after the rows are read.
+func (db *database) applyQueryHints(ctx context.Context, q sq.SelectBuilder, query *skydb.Query) (sq.SelectBuilder, func() error, error) {
+	noop := func() error { return nil }
+	hints := query.Hints
+	if hints == nil {
+		return q, noop, nil
+	}
+
+	settings, err := queryHintSettings(hints)
+	if err != nil {
+		return q, noop, err
+	}
+
+	if hints.Index != "" {
+		var exists bool
+		err := db.c.Get(ctx, &exists, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_indexes
+			WHERE schemaname = $1 AND tablename = $2 AND indexname = $3
+		)`, db.schemaName(), query.Type, hints.Index)
+		if err != nil {
+			return q, noop, err
+		}
+		if !exists {
+			return q, noop, skyerr.NewInvalidArgument(
+				fmt.Sprintf("index %s of record type %s does not exist", hints.Index, query.Type),
+				[]string{"hints"},
+			)
+		}
+		q = q.Prefix(fmt.Sprintf(
+			"/*+ IndexScan(%s %s) */",
+			pq.QuoteIdentifier(query.Type),
+			pq.QuoteIdentifier(hints.Index),
+		))
+	}
+
+	if len(settings) == 0 {
+		return q, noop, nil
+	}
+
+	var revert func() error
+	if db.c.tx != nil {
+		if _, err := db.c.Exec(ctx, "SAVEPOINT "+queryHintsSavepoint); err != nil {
+			return q, noop, err
+		}
+		revert = func() error {
+			_, err := db.c.Exec(ctx, "ROLLBACK TO SAVEPOINT "+queryHintsSavepoint)
+			return err
+		}
+	} else {
+		if err := db.c.Begin(ctx); err != nil {
+			return q, noop, err
+		}
+		revert = db.c.Rollback
+	}
+
+	for _, setting := range settings {
+		if _, err := db.c.Exec(ctx, fmt.Sprintf("SET LOCAL %s = off", setting)); err != nil {
+			revert()
+			return q, noop, err
+		}
+	}
+	return q, revert, nil
+}
+
+// hintedRowsIter reverts the planner settings of the query hints when
+// the rows are closed, which skydb.Rows does once the rows are read.
+type hintedRowsIter struct {
+	rowsIter
+	revert func() error
+}
+
+func (rowsi hintedRowsIter) Close() error {
+	err := rowsi.rowsIter.Close()
+	if revertErr := rowsi.revert(); err == nil {
+		err = revertErr
+	}
+	return err
+}
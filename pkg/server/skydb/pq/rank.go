@@ -0,0 +1,94 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// QueryRankAround implements skydb.RecordRanker. Records matching the
+// query are ranked with window functions in a single statement, so that
+// the records ranked before the target are not returned to the server.
+func (db *database) QueryRankAround(ctx context.Context, query *skydb.Query, rank skydb.RankFunc, id string, around uint64) (*skydb.Rows, error) {
+	order, err := sortOrderOrderBySQL(rank.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	rankQuery := *query
+	rankQuery.Sorts = nil
+	rankQuery.Limit = nil
+	rankQuery.Offset = 0
+	rankQuery.GetCount = false
+	rankQuery.ComputedKeys = map[string]skydb.Expression{}
+	for key, value := range query.ComputedKeys {
+		rankQuery.ComputedKeys[key] = value
+	}
+	rankQuery.ComputedKeys["_rank"] = skydb.Expression{
+		Type:  skydb.Function,
+		Value: rank,
+	}
+
+	q, typemap, err := db.queryBuilder(ctx, &rankQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if typemap == nil { // record type has not been created
+		return skydb.EmptyRows, nil
+	}
+
+	// records of the same rank are ordered by id, so that the records
+	// around the target are deterministic
+	q = q.Column(fmt.Sprintf(
+		`ROW_NUMBER() OVER (ORDER BY %s %s, %s) AS "_row_number"`,
+		fullQuoteIdentifier(query.Type, rank.Field),
+		order,
+		fullQuoteIdentifier(query.Type, "_id"),
+	))
+	rankedSQL, args, err := q.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, len(typemap))
+	for column := range typemap {
+		columns = append(columns, "ranked."+pq.QuoteIdentifier(column))
+	}
+
+	statement, err := sq.Dollar.ReplacePlaceholders(fmt.Sprintf(`
+WITH ranked AS (%s),
+target AS (SELECT "_row_number" FROM ranked WHERE "_id" = ?)
+SELECT %s FROM ranked, target
+WHERE ranked."_row_number" BETWEEN target."_row_number" - ? AND target."_row_number" + ?
+ORDER BY ranked."_row_number"`,
+		rankedSQL,
+		strings.Join(columns, ", "),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, id, around, around)
+	rows, err := db.c.Queryx(ctx, statement, args...)
+	return newRows(query.Type, typemap, rows, err)
+}
@@ -0,0 +1,150 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRank(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend(context.Background(), "score", skydb.RecordSchema{
+			"points": skydb.FieldType{Type: skydb.TypeNumber},
+		})
+		So(err, ShouldBeNil)
+
+		for id, points := range map[string]float64{
+			"a": 100,
+			"b": 90,
+			"c": 90,
+			"d": 80,
+			"e": 70,
+		} {
+			So(db.Save(context.Background(), &skydb.Record{
+				ID:      skydb.NewRecordID("score", id),
+				OwnerID: "user_id",
+				Data:    map[string]interface{}{"points": points},
+			}), ShouldBeNil)
+		}
+
+		rankOf := func(records []skydb.Record) map[string]interface{} {
+			ranks := map[string]interface{}{}
+			for _, record := range records {
+				ranks[record.ID.Key] = record.Transient["_rank"]
+			}
+			return ranks
+		}
+
+		scan := func(rows *skydb.Rows) []skydb.Record {
+			defer rows.Close()
+			records := []skydb.Record{}
+			for rows.Scan() {
+				records = append(records, rows.Record())
+			}
+			So(rows.Err(), ShouldBeNil)
+			return records
+		}
+
+		Convey("includes rank in query", func() {
+			limit := uint64(3)
+			rows, err := db.Query(context.Background(), &skydb.Query{
+				Type: "score",
+				Sorts: []skydb.Sort{
+					{KeyPath: "points", Order: skydb.Desc},
+				},
+				ComputedKeys: map[string]skydb.Expression{
+					"rank": skydb.Expression{
+						Type:  skydb.Function,
+						Value: skydb.RankFunc{Field: "points", Order: skydb.Desc},
+					},
+				},
+				Limit: &limit,
+			})
+			So(err, ShouldBeNil)
+
+			records := scan(rows)
+			So(records, ShouldHaveLength, 3)
+			So(records[0].Transient["rank"], ShouldEqual, 1)
+			So(records[1].Transient["rank"], ShouldEqual, 2)
+			So(records[2].Transient["rank"], ShouldEqual, 2)
+		})
+
+		Convey("queries records ranked around a record", func() {
+			rows, err := db.(skydb.RecordRanker).QueryRankAround(context.Background(),
+				&skydb.Query{Type: "score"},
+				skydb.RankFunc{Field: "points", Order: skydb.Desc},
+				"d",
+				1,
+			)
+			So(err, ShouldBeNil)
+
+			records := scan(rows)
+			So(records, ShouldHaveLength, 3)
+			So(records[0].ID.Key, ShouldEqual, "c")
+			So(records[1].ID.Key, ShouldEqual, "d")
+			So(records[2].ID.Key, ShouldEqual, "e")
+			So(records[1].Get("points"), ShouldEqual, 80)
+			So(rankOf(records), ShouldResemble, map[string]interface{}{
+				"c": float64(2),
+				"d": float64(4),
+				"e": float64(5),
+			})
+		})
+
+		Convey("ranks records matching the predicate", func() {
+			rows, err := db.(skydb.RecordRanker).QueryRankAround(context.Background(),
+				&skydb.Query{
+					Type: "score",
+					Predicate: skydb.Predicate{
+						Operator: skydb.LessThan,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "points"},
+							skydb.Expression{Type: skydb.Literal, Value: float64(95)},
+						},
+					},
+				},
+				skydb.RankFunc{Field: "points", Order: skydb.Asc},
+				"e",
+				2,
+			)
+			So(err, ShouldBeNil)
+
+			So(rankOf(scan(rows)), ShouldResemble, map[string]interface{}{
+				"e": float64(1),
+				"d": float64(2),
+				"b": float64(3),
+			})
+		})
+
+		Convey("returns nothing for record not matched", func() {
+			rows, err := db.(skydb.RecordRanker).QueryRankAround(context.Background(),
+				&skydb.Query{Type: "score"},
+				skydb.RankFunc{Field: "points", Order: skydb.Desc},
+				"notexist",
+				1,
+			)
+			So(err, ShouldBeNil)
+			So(scan(rows), ShouldBeEmpty)
+		})
+	})
+}
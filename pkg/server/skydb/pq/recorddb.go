@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -31,8 +32,8 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
-func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
-	typemap, err := db.remoteColumnTypes(id.Type)
+func (db *database) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
+	typemap, err := db.remoteColumnTypes(ctx, id.Type)
 	if err != nil {
 		return err
 	}
@@ -42,7 +43,7 @@ func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
 	}
 
 	builder := db.selectQuery(psql.Select(), id.Type, typemap).Where("_id = ?", id.Key)
-	row := db.c.QueryRowWith(builder)
+	row := db.c.QueryRowWith(ctx, builder)
 	if err := newRecordScanner(id.Type, typemap, row).Scan(record); err == sql.ErrNoRows {
 		return skydb.ErrRecordNotFound
 	} else if err != nil {
@@ -55,7 +56,7 @@ func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
 // GetByIDs only support one type of records at a time. If you want to query
 // array of ids belongs to different type, you need to call this method multiple
 // time.
-func (db *database) GetByIDs(ids []skydb.RecordID) (*skydb.Rows, error) {
+func (db *database) GetByIDs(ctx context.Context, ids []skydb.RecordID) (*skydb.Rows, error) {
 	if len(ids) == 0 {
 		return nil, errors.New("db.GetByIDs received empty array")
 	}
@@ -71,7 +72,7 @@ func (db *database) GetByIDs(ids []skydb.RecordID) (*skydb.Rows, error) {
 	}
 
 	log.Debugf("GetByIDs Type: %s", recordType)
-	typemap, err := db.remoteColumnTypes(recordType)
+	typemap, err := db.remoteColumnTypes(ctx, recordType)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +84,7 @@ func (db *database) GetByIDs(ids []skydb.RecordID) (*skydb.Rows, error) {
 	inCause, inArgs := literalToSQLOperand(idStrs)
 	query := db.selectQuery(psql.Select(), recordType, typemap).
 		Where(pq.QuoteIdentifier("_id")+" IN "+inCause, inArgs...)
-	rows, err := db.c.QueryWith(query)
+	rows, err := db.c.QueryWith(ctx, query)
 	if err != nil {
 		log.Debugf("Getting records by ID failed %v", err)
 		return nil, err
@@ -92,7 +93,7 @@ func (db *database) GetByIDs(ids []skydb.RecordID) (*skydb.Rows, error) {
 }
 
 // Save attempts to do a upsert
-func (db *database) Save(record *skydb.Record) error {
+func (db *database) Save(ctx context.Context, record *skydb.Record) error {
 	if record.ID.Key == "" {
 		return errors.New("db.save: got empty record id")
 	}
@@ -120,16 +121,16 @@ func (db *database) Save(record *skydb.Record) error {
 		IgnoreKeyOnUpdate("_created_at").
 		IgnoreKeyOnUpdate("_created_by")
 
-	typemap, err := db.remoteColumnTypes(record.ID.Type)
+	typemap, err := db.remoteColumnTypes(ctx, record.ID.Type)
 	if err != nil {
 		return err
 	}
 
-	if err := db.preSave(typemap, record); err != nil {
+	if err := db.preSave(ctx, typemap, record); err != nil {
 		return err
 	}
 
-	row := db.c.QueryRowWith(upsert)
+	row := db.c.QueryRowWith(ctx, upsert)
 	if err = newRecordScanner(record.ID.Type, typemap, row).Scan(record); err != nil {
 		return err
 	}
@@ -138,7 +139,7 @@ func (db *database) Save(record *skydb.Record) error {
 	return nil
 }
 
-func (db *database) preSave(schema skydb.RecordSchema, record *skydb.Record) error {
+func (db *database) preSave(ctx context.Context, schema skydb.RecordSchema, record *skydb.Record) error {
 	const SetSequenceMaxValue = `SELECT setval($1, GREATEST(max(%v), $2)) FROM %v;`
 
 	for key, value := range record.Data {
@@ -146,7 +147,7 @@ func (db *database) preSave(schema skydb.RecordSchema, record *skydb.Record) err
 		if schema[key].Type == skydb.TypeSequence {
 			selectSQL := fmt.Sprintf(SetSequenceMaxValue, pq.QuoteIdentifier(key), db.tableName(record.ID.Type))
 			seqName := db.tableName(fmt.Sprintf(`%v_%v_seq`, record.ID.Type, key))
-			if _, err := db.c.Exec(selectSQL, seqName, value); err != nil {
+			if _, err := db.c.Exec(ctx, selectSQL, seqName, value); err != nil {
 				return err
 			}
 		}
@@ -185,7 +186,7 @@ func convert(r *skydb.Record) map[string]interface{} {
 	return m
 }
 
-func (db *database) Delete(id skydb.RecordID) error {
+func (db *database) Delete(ctx context.Context, id skydb.RecordID) error {
 	builder := psql.Delete(db.tableName(id.Type)).
 		Where("_id = ?", id.Key)
 
@@ -198,13 +199,28 @@ func (db *database) Delete(id skydb.RecordID) error {
 		builder = builder.Where("_database_id = ?", db.userID)
 	}
 
-	result, err := db.c.ExecWith(builder)
+	// The deletion is logged in the same statement for
+	// RecordDeletionLog.
+	deleteSQL, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`WITH deleted AS (%s RETURNING _id, _database_id)
+INSERT INTO %s (record_type, record_id, database_id, deleted_at)
+SELECT $%d, _id, _database_id, (now() AT TIME ZONE 'UTC') FROM deleted`,
+		deleteSQL, db.tableName("_record_deletion"), len(args)+1)
+	args = append(args, id.Type)
+
+	result, err := db.c.Exec(ctx, query, args...)
 	if isUndefinedTable(err) {
 		return skydb.ErrRecordNotFound
 	} else if isForeignKeyViolated(err) {
-		return skyerr.NewError(
+		return skyerr.NewErrorWithInfo(
 			skyerr.ConstraintViolated,
 			fmt.Sprintf("delete %s: failed to delete record because other records have reference to it", id),
+			map[string]interface{}{
+				"referencing_type": err.(*pq.Error).Table,
+			},
 		)
 	} else if err != nil {
 		return fmt.Errorf("delete %s: failed to delete record", id)
@@ -229,7 +245,7 @@ func (db *database) Delete(id skydb.RecordID) error {
 	return err
 }
 
-func (db *database) applyQueryPredicate(q sq.SelectBuilder, factory *predicateSqlizerFactory, query *skydb.Query) (sq.SelectBuilder, error) {
+func (db *database) applyQueryPredicate(ctx context.Context, q sq.SelectBuilder, factory *predicateSqlizerFactory, query *skydb.Query) (sq.SelectBuilder, error) {
 	if p := query.Predicate; !p.IsEmpty() {
 		sqlizer, err := factory.newPredicateSqlizer(p)
 		if err != nil {
@@ -237,6 +253,10 @@ func (db *database) applyQueryPredicate(q sq.SelectBuilder, factory *predicateSq
 		}
 		q = q.Where(sqlizer)
 		q = factory.addJoinsToSelectBuilder(q)
+
+		if err := db.ensureFullTextIndexes(ctx, query.Type, factory.fullTextFields); err != nil {
+			return q, err
+		}
 	}
 
 	if db.DatabaseType() == skydb.PublicDatabase && !query.BypassAccessControl {
@@ -245,40 +265,91 @@ func (db *database) applyQueryPredicate(q sq.SelectBuilder, factory *predicateSq
 			return q, err
 		}
 		q = q.Where(aclSqlizer)
+	} else if db.DatabaseType() == skydb.UnionDatabase && db.userID != "" && !query.BypassAccessControl {
+		// ACL settings apply to public records only
+		aclSqlizer, err := factory.newAccessControlSqlizer(query.ViewAsUser, skydb.ReadLevel)
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(sq.Or{
+			sq.Expr(fmt.Sprintf(`%s."_database_id" = ?`, pq.QuoteIdentifier(query.Type)), db.userID),
+			aclSqlizer,
+		})
 	}
 
 	return q, nil
 }
 
-func (db *database) Query(query *skydb.Query) (*skydb.Rows, error) {
-	if query.Type == "" {
-		return nil, errors.New("got empty query type")
+func (db *database) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
+	q, typemap, err := db.queryBuilder(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if typemap == nil { // record type has not been created
+		return skydb.EmptyRows, nil
 	}
 
-	typemap, err := db.remoteColumnTypes(query.Type)
+	q, revert, err := db.applyQueryHints(ctx, q, query)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(typemap) == 0 { // record type has not been created
-		return skydb.EmptyRows, nil
+	rows, err := db.c.QueryWith(ctx, q)
+	if err != nil {
+		revert()
+		return nil, err
 	}
+	rs := newRecordScanner(query.Type, typemap, rows)
+	return skydb.NewRows(hintedRowsIter{rowsIter{rows, rs}, revert}), nil
+}
 
+// queryBuilder returns the select statement of the query and the
+// typemap of the selected columns. The returned typemap is nil if the
+// record type has not been created.
+func (db *database) queryBuilder(ctx context.Context, query *skydb.Query) (sq.SelectBuilder, skydb.RecordSchema, error) {
 	q := psql.Select()
-	factory := newPredicateSqlizerFactory(db, query.Type)
-	q, err = db.applyQueryPredicate(q, factory, query)
+	if query.Type == "" {
+		return q, nil, errors.New("got empty query type")
+	}
+
+	typemap, err := db.remoteColumnTypes(ctx, query.Type)
 	if err != nil {
-		return nil, err
+		return q, nil, err
+	}
+
+	if len(typemap) == 0 { // record type has not been created
+		return q, nil, nil
+	}
+
+	factory := newPredicateSqlizerFactory(ctx, db, query.Type)
+	q, err = db.applyQueryPredicate(ctx, q, factory, query)
+	if err != nil {
+		return q, nil, err
+	}
+
+	if query.Cursor != nil {
+		q = q.Where(cursorSqlizer{
+			alias:  query.Type,
+			sorts:  query.Sorts,
+			cursor: query.Cursor,
+		})
 	}
 
 	for _, sort := range query.Sorts {
 		orderBy, err := sortOrderBySQL(query.Type, sort)
 		if err != nil {
-			return nil, err
+			return q, nil, err
 		}
 		q = q.OrderBy(orderBy)
 	}
 
+	// Records of the same sort values are ordered by ID, so that pages
+	// are stable and can be continued with a cursor.
+	if query.Limit != nil || query.Cursor != nil {
+		q = q.OrderBy(fullQuoteIdentifier(query.Type, "_id") + " ASC")
+	}
+
 	if query.Limit != nil {
 		q = q.Limit(*query.Limit)
 	}
@@ -292,21 +363,146 @@ func (db *database) Query(query *skydb.Query) (*skydb.Rows, error) {
 	// depends on the alias name used in table joins.
 	typemap, err = updateTypemapForQuery(query, typemap)
 	if err != nil {
-		return nil, err
+		return q, nil, err
 	}
 	typemap = factory.updateTypemap(typemap)
 	q = db.selectQuery(q, query.Type, typemap)
+	return q, typemap, nil
+}
+
+// ExplainQuery implements skydb.QueryExplainer. The query is executed
+// with EXPLAIN ANALYZE, so that actual timing is reported.
+func (db *database) ExplainQuery(ctx context.Context, query *skydb.Query) (*skydb.QueryPlan, error) {
+	q, typemap, err := db.queryBuilder(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if typemap == nil { // record type has not been created
+		return &skydb.QueryPlan{Indexes: []string{}}, nil
+	}
+
+	q, revert, err := db.applyQueryHints(ctx, q, query)
+	if err != nil {
+		return nil, err
+	}
+	defer revert()
 
-	rows, err := db.c.QueryWith(q)
-	return newRows(query.Type, typemap, rows, err)
+	statement, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rawPlan []byte
+	if err := db.c.QueryRowx(ctx, "EXPLAIN (ANALYZE, FORMAT JSON) "+statement, args...).Scan(&rawPlan); err != nil {
+		return nil, err
+	}
+
+	explained := []struct {
+		Plan          map[string]interface{} `json:"Plan"`
+		PlanningTime  float64                `json:"Planning Time"`
+		ExecutionTime float64                `json:"Execution Time"`
+	}{}
+	if err := json.Unmarshal(rawPlan, &explained); err != nil {
+		return nil, err
+	}
+	if len(explained) != 1 {
+		return nil, fmt.Errorf("skydb/pq: expect 1 query plan, got %d", len(explained))
+	}
+
+	return &skydb.QueryPlan{
+		Statement:     statement,
+		Args:          args,
+		Indexes:       planIndexNames(explained[0].Plan, []string{}),
+		Plan:          explained[0].Plan,
+		PlanningTime:  time.Duration(explained[0].PlanningTime * float64(time.Millisecond)),
+		ExecutionTime: time.Duration(explained[0].ExecutionTime * float64(time.Millisecond)),
+	}, nil
 }
 
-func (db *database) QueryCount(query *skydb.Query) (uint64, error) {
+// planIndexNames appends the names of the indexes scanned by the plan
+// node and its sub-plans to names.
+func planIndexNames(plan map[string]interface{}, names []string) []string {
+	if name, ok := plan["Index Name"].(string); ok {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+
+	subplans, _ := plan["Plans"].([]interface{})
+	for _, subplan := range subplans {
+		if subplan, ok := subplan.(map[string]interface{}); ok {
+			names = planIndexNames(subplan, names)
+		}
+	}
+	return names
+}
+
+// recordTypes returns the record types of which tables are created.
+func (c *conn) recordTypes(ctx context.Context) ([]string, error) {
+	rows, err := c.Queryx(ctx, `
+	SELECT table_name
+	FROM information_schema.tables
+	WHERE (table_name NOT LIKE '\_%') AND (table_schema=$1)
+	`, c.schemaName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordTypes := []string{}
+	for rows.Next() {
+		var recordType string
+		if err := rows.Scan(&recordType); err != nil {
+			return nil, err
+		}
+		recordTypes = append(recordTypes, recordType)
+	}
+	return recordTypes, rows.Err()
+}
+
+// Usage returns the number and the total size of the records of all
+// record types in the database.
+func (db *database) Usage(ctx context.Context) (skydb.DatabaseUsage, error) {
+	usage := skydb.DatabaseUsage{}
+
+	recordTypes, err := db.c.recordTypes(ctx)
+	if err != nil {
+		return usage, err
+	}
+
+	for _, recordType := range recordTypes {
+		tableName := db.tableName(recordType)
+		builder := psql.Select("COUNT(*)", fmt.Sprintf("COALESCE(SUM(pg_column_size(%s.*)), 0)", tableName)).
+			From(tableName)
+		if sqlizer := db.databaseIDSqlizer(recordType); sqlizer != nil {
+			builder = builder.Where(sqlizer)
+		}
+
+		var count, size uint64
+		if err := db.c.QueryRowWith(ctx, builder).Scan(&count, &size); err != nil {
+			return usage, err
+		}
+		usage.RecordCount += count
+		usage.StorageSize += size
+	}
+
+	return usage, nil
+}
+
+func (db *database) QueryCount(ctx context.Context, query *skydb.Query) (uint64, error) {
 	if query.Type == "" {
 		return 0, errors.New("got empty query type")
 	}
 
-	typemap, err := db.remoteColumnTypes(query.Type)
+	typemap, err := db.remoteColumnTypes(ctx, query.Type)
 	if err != nil || len(typemap) == 0 { // error or record type has not been created
 		return 0, err
 	}
@@ -324,13 +520,13 @@ func (db *database) QueryCount(query *skydb.Query) (uint64, error) {
 	}
 
 	q := db.selectQuery(psql.Select(), query.Type, typemap)
-	factory := newPredicateSqlizerFactory(db, query.Type)
-	q, err = db.applyQueryPredicate(q, factory, query)
+	factory := newPredicateSqlizerFactory(ctx, db, query.Type)
+	q, err = db.applyQueryPredicate(ctx, q, factory, query)
 	if err != nil {
 		return 0, err
 	}
 
-	rows, err := db.c.QueryWith(q)
+	rows, err := db.c.QueryWith(ctx, q)
 	if err != nil {
 		return 0, err
 	}
@@ -551,15 +747,33 @@ func (db *database) selectQuery(q sq.SelectBuilder, recordType string, typemap s
 
 	q = q.From(db.tableName(recordType))
 
+	if sqlizer := db.databaseIDSqlizer(recordType); sqlizer != nil {
+		q = q.Where(sqlizer)
+	}
+	return q
+}
+
+// databaseIDSqlizer returns the condition on the `_database_id` column
+// of the specified record type that selects the records in this database.
+// It returns nil if no filter is needed.
+func (db *database) databaseIDSqlizer(recordType string) sq.Sqlizer {
 	switch db.DatabaseType() {
 	case skydb.UnionDatabase:
-		// no filter on `_database_id` column
+		if db.userID != "" {
+			// public records and private records of the user
+			return sq.Expr(
+				fmt.Sprintf(`%s."_database_id" IN ('', ?)`, pq.QuoteIdentifier(recordType)),
+				db.userID,
+			)
+		}
+		// otherwise no filter on `_database_id` column
+		return nil
 	case skydb.PublicDatabase:
 		fallthrough
 	case skydb.PrivateDatabase:
-		q = q.Where(fmt.Sprintf(`%s."_database_id" = ?`, pq.QuoteIdentifier(recordType)), db.userID)
+		return sq.Expr(fmt.Sprintf(`%s."_database_id" = ?`, pq.QuoteIdentifier(recordType)), db.userID)
 	}
-	return q
+	return nil
 }
 
 func updateTypemapForQuery(query *skydb.Query, typemap skydb.RecordSchema) (skydb.RecordSchema, error) {
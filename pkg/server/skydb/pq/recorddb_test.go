@@ -15,12 +15,14 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -31,7 +33,7 @@ func TestGet(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PrivateDB("getuser")
-		_, err := db.Extend("record", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "record", skydb.RecordSchema{
 			"string":   skydb.FieldType{Type: skydb.TypeString},
 			"number":   skydb.FieldType{Type: skydb.TypeNumber},
 			"datetime": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -48,7 +50,7 @@ func TestGet(t *testing.T) {
 
 		Convey("gets an existing record from database", func() {
 			record := skydb.Record{}
-			err := db.Get(skydb.NewRecordID("record", "id1"), &record)
+			err := db.Get(context.Background(), skydb.NewRecordID("record", "id1"), &record)
 			So(err, ShouldBeNil)
 
 			So(record.ID, ShouldResemble, skydb.NewRecordID("record", "id1"))
@@ -67,7 +69,7 @@ func TestGet(t *testing.T) {
 
 		Convey("errors if gets a non-existing record", func() {
 			record := skydb.Record{}
-			err := db.Get(skydb.NewRecordID("record", "notexistid"), &record)
+			err := db.Get(context.Background(), skydb.NewRecordID("record", "notexistid"), &record)
 			So(err, ShouldEqual, skydb.ErrRecordNotFound)
 		})
 	})
@@ -79,7 +81,7 @@ func TestGetByIDs(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PrivateDB("getuser")
-		_, err := db.Extend("record", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "record", skydb.RecordSchema{
 			"string": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
@@ -92,7 +94,7 @@ func TestGetByIDs(t *testing.T) {
 			`VALUES ('getuser', 'id1', 'getuser', '1988-02-06', 'getuser', '1988-02-06', 'getuser', 'string')`)
 
 		Convey("get one record", func() {
-			scanner, err := db.GetByIDs([]skydb.RecordID{skydb.NewRecordID("record", "id1")})
+			scanner, err := db.GetByIDs(context.Background(), []skydb.RecordID{skydb.NewRecordID("record", "id1")})
 			So(err, ShouldBeNil)
 
 			scanner.Scan()
@@ -112,7 +114,7 @@ func TestGetByIDs(t *testing.T) {
 		})
 
 		Convey("get one record with duplicated record ID", func() {
-			scanner, err := db.GetByIDs([]skydb.RecordID{
+			scanner, err := db.GetByIDs(context.Background(), []skydb.RecordID{
 				skydb.NewRecordID("record", "id1"),
 				skydb.NewRecordID("record", "id1"),
 			})
@@ -136,7 +138,7 @@ func TestGetByIDs(t *testing.T) {
 		})
 
 		Convey("get record with one of them is placeholder", func() {
-			scanner, err := db.GetByIDs([]skydb.RecordID{
+			scanner, err := db.GetByIDs(context.Background(), []skydb.RecordID{
 				skydb.RecordID{},
 				skydb.NewRecordID("record", "id1"),
 			})
@@ -160,7 +162,7 @@ func TestGetByIDs(t *testing.T) {
 		})
 
 		Convey("get multiple record", func() {
-			scanner, err := db.GetByIDs([]skydb.RecordID{
+			scanner, err := db.GetByIDs(context.Background(), []skydb.RecordID{
 				skydb.NewRecordID("record", "id0"),
 				skydb.NewRecordID("record", "id1"),
 			})
@@ -193,7 +195,7 @@ func TestSave(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"content":   skydb.FieldType{Type: skydb.TypeString},
 			"number":    skydb.FieldType{Type: skydb.TypeNumber},
 			"timestamp": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -215,7 +217,7 @@ func TestSave(t *testing.T) {
 		}
 
 		Convey("creates record if it doesn't exist", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record.DatabaseID, ShouldEqual, "")
 
@@ -225,7 +227,7 @@ func TestSave(t *testing.T) {
 				timestamp time.Time
 				ownerID   string
 			)
-			err = c.QueryRowx(
+			err = c.QueryRowx(context.Background(),
 				"SELECT content, number, timestamp, _owner_id "+
 					"FROM note WHERE _id = 'someid' and _database_id = ''").
 				Scan(&content, &number, &timestamp, &ownerID)
@@ -237,16 +239,16 @@ func TestSave(t *testing.T) {
 		})
 
 		Convey("updates record if it already exists", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record.DatabaseID, ShouldEqual, "")
 
 			record.Set("content", "more content")
-			err = db.Save(&record)
+			err = db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 
 			var content string
-			err = c.QueryRowx("SELECT content FROM note WHERE _id = 'someid' and _database_id = ''").
+			err = c.QueryRowx(context.Background(), "SELECT content FROM note WHERE _id = 'someid' and _database_id = ''").
 				Scan(&content)
 			So(err, ShouldBeNil)
 			So(content, ShouldEqual, "more content")
@@ -254,29 +256,29 @@ func TestSave(t *testing.T) {
 
 		Convey("error if saving with recordid already taken by other user", func() {
 			ownerDB := c.PrivateDB("ownerid")
-			err := ownerDB.Save(&record)
+			err := ownerDB.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			otherDB := c.PrivateDB("otheruserid")
-			err = otherDB.Save(&record)
+			err = otherDB.Save(context.Background(), &record)
 			// FIXME: Wrap me with skydb.ErrXXX
 			So(err, ShouldNotBeNil)
 		})
 
 		Convey("ignore Record.DatabaseID when saving", func() {
 			record.DatabaseID = "someuserid"
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record.DatabaseID, ShouldEqual, "")
 
 			var count int
-			err = c.QueryRowx("SELECT count(*) FROM note WHERE _id = 'someid' and _database_id = 'someuserid'").
+			err = c.QueryRowx(context.Background(), "SELECT count(*) FROM note WHERE _id = 'someid' and _database_id = 'someuserid'").
 				Scan(&count)
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 0)
 		})
 
 		Convey("REGRESSION: update record with attribute having capital letters", func() {
-			_, err := db.Extend("note", skydb.RecordSchema{
+			_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 			})
 			So(err, ShouldBeNil)
@@ -289,13 +291,13 @@ func TestSave(t *testing.T) {
 				},
 			}
 
-			ShouldBeNil(db.Save(&record))
+			ShouldBeNil(db.Save(context.Background(), &record))
 
 			record.Data["noteOrder"] = 2
-			ShouldBeNil(db.Save(&record))
+			ShouldBeNil(db.Save(context.Background(), &record))
 
 			var noteOrder int
-			err = c.QueryRowx(`SELECT "noteOrder" FROM note WHERE _id = '1' and _database_id = ''`).
+			err = c.QueryRowx(context.Background(), `SELECT "noteOrder" FROM note WHERE _id = '1' and _database_id = ''`).
 				Scan(&noteOrder)
 			So(err, ShouldBeNil)
 			So(noteOrder, ShouldEqual, 2)
@@ -303,19 +305,19 @@ func TestSave(t *testing.T) {
 
 		Convey("errors if OwnerID not set", func() {
 			record.OwnerID = ""
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err.Error(), ShouldEndWith, "got empty OwnerID")
 		})
 
 		Convey("ignore OwnerID when update", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 
 			record.OwnerID = "user_id2"
 			So(err, ShouldBeNil)
 
 			var ownerID string
-			err = c.QueryRowx(`SELECT "_owner_id" FROM note WHERE _id = 'someid' and _database_id = ''`).
+			err = c.QueryRowx(context.Background(), `SELECT "_owner_id" FROM note WHERE _id = 'someid' and _database_id = ''`).
 				Scan(&ownerID)
 			So(ownerID, ShouldEqual, "user_id")
 		})
@@ -330,7 +332,7 @@ func TestDelete(t *testing.T) {
 
 		db := c.PrivateDB("userid")
 
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"content": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
@@ -344,31 +346,98 @@ func TestDelete(t *testing.T) {
 		}
 
 		Convey("deletes existing record", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 
-			err = db.Delete(skydb.NewRecordID("note", "someid"))
+			err = db.Delete(context.Background(), skydb.NewRecordID("note", "someid"))
 			So(err, ShouldBeNil)
 
-			err = db.(*database).c.QueryRowx("SELECT * FROM note WHERE _id = 'someid' AND _database_id = 'userid'").Scan((*string)(nil))
+			err = db.(*database).c.QueryRowx(context.Background(), "SELECT * FROM note WHERE _id = 'someid' AND _database_id = 'userid'").Scan((*string)(nil))
 			So(err, ShouldEqual, sql.ErrNoRows)
 		})
 
 		Convey("returns ErrRecordNotFound when record to delete doesn't exist", func() {
-			err := db.Delete(skydb.NewRecordID("note", "notexistid"))
+			err := db.Delete(context.Background(), skydb.NewRecordID("note", "notexistid"))
 			So(err, ShouldEqual, skydb.ErrRecordNotFound)
 		})
 
 		Convey("return ErrRecordNotFound when deleting other user record", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			otherDB := c.PrivateDB("otheruserid")
-			err = otherDB.Delete(skydb.NewRecordID("note", "someid"))
+			err = otherDB.Delete(context.Background(), skydb.NewRecordID("note", "someid"))
 			So(err, ShouldEqual, skydb.ErrRecordNotFound)
 		})
 	})
 }
 
+func TestDeleteReferenced(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+
+		_, err := db.Extend(context.Background(), "collection", skydb.RecordSchema{
+			"name": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		collection := skydb.Record{
+			ID:      skydb.NewRecordID("collection", "collection0"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"name": "some collection",
+			},
+		}
+		So(db.Save(context.Background(), &collection), ShouldBeNil)
+
+		saveNote := func(onDelete skydb.ReferenceAction) {
+			_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+				"collection": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "collection",
+					OnDelete:      onDelete,
+				},
+			})
+			So(err, ShouldBeNil)
+
+			note := skydb.Record{
+				ID:      skydb.NewRecordID("note", "note0"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"collection": skydb.NewReference("collection", "collection0"),
+				},
+			}
+			So(db.Save(context.Background(), &note), ShouldBeNil)
+		}
+
+		Convey("fails to delete record referenced with restrict", func() {
+			saveNote(skydb.ReferenceRestrict)
+
+			err := db.Delete(context.Background(), skydb.NewRecordID("collection", "collection0"))
+			So(err, ShouldNotBeNil)
+			skyErr, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(skyErr.Code(), ShouldEqual, skyerr.ConstraintViolated)
+			So(skyErr.Info()["referencing_type"], ShouldEqual, "note")
+		})
+
+		Convey("fails to delete record referenced with cascade", func() {
+			saveNote(skydb.ReferenceCascade)
+
+			err := db.Delete(context.Background(), skydb.NewRecordID("collection", "collection0"))
+			So(err, ShouldNotBeNil)
+			skyErr, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(skyErr.Code(), ShouldEqual, skyerr.ConstraintViolated)
+
+			note := skydb.Record{}
+			So(db.Get(context.Background(), skydb.NewRecordID("note", "note0"), &note), ShouldBeNil)
+		})
+	})
+}
+
 func TestQuery(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
@@ -404,25 +473,25 @@ func TestQuery(t *testing.T) {
 		}
 
 		db := c.PrivateDB("userid")
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 			"content":   skydb.FieldType{Type: skydb.TypeString},
 			"emotion":   skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&record2)
+		err = db.Save(context.Background(), &record2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record1)
+		err = db.Save(context.Background(), &record1)
 		So(err, ShouldBeNil)
-		err = db.Save(&record3)
+		err = db.Save(context.Background(), &record3)
 		So(err, ShouldBeNil)
 
 		Convey("queries records", func() {
 			query := skydb.Query{
 				Type: "note",
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record2)
@@ -441,7 +510,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{
@@ -461,7 +530,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{
@@ -488,7 +557,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record1)
@@ -512,7 +581,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record1)
@@ -536,13 +605,50 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record1)
 			So(len(records), ShouldEqual, 1)
 		})
 
+		Convey("query records by full-text search", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Matches,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "HELLO",
+						},
+					},
+				},
+				Sorts: []skydb.Sort{
+					skydb.Sort{
+						KeyPath: "noteOrder",
+						Order:   skydb.Ascending,
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(context.Background(), &query))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{
+				record1,
+				record3,
+			})
+
+			var indexCount int
+			err = c.Get(context.Background(), &indexCount, `SELECT COUNT(*) FROM pg_indexes WHERE indexname = 'note_content_fts'`)
+			So(err, ShouldBeNil)
+			So(indexCount, ShouldEqual, 1)
+		})
+
 		Convey("query records by check array members", func() {
 			query := skydb.Query{
 				Type: "note",
@@ -566,7 +672,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record3)
@@ -591,7 +697,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 0)
@@ -626,7 +732,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record2)
@@ -647,7 +753,7 @@ func TestQuery(t *testing.T) {
 				},
 			}
 			*query.Limit = 2
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record2)
@@ -655,6 +761,36 @@ func TestQuery(t *testing.T) {
 			So(len(records), ShouldEqual, 2)
 		})
 
+		Convey("query records after cursor", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Limit: new(uint64),
+				Sorts: []skydb.Sort{
+					skydb.Sort{
+						KeyPath: "noteOrder",
+						Order:   skydb.Descending,
+					},
+				},
+			}
+			*query.Limit = 2
+			records, err := exhaustRows(db.Query(context.Background(), &query))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+			So(records[0], ShouldResemble, record3)
+			So(records[1], ShouldResemble, record2)
+
+			query.Cursor = skydb.NewQueryCursor(&query, &records[1])
+			records, err = exhaustRows(db.Query(context.Background(), &query))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0], ShouldResemble, record1)
+
+			query.Cursor = skydb.NewQueryCursor(&query, &records[0])
+			records, err = exhaustRows(db.Query(context.Background(), &query))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 0)
+		})
+
 		Convey("query records for nil item", func() {
 			query := skydb.Query{
 				Type: "note",
@@ -678,7 +814,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record1)
@@ -709,7 +845,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record3)
@@ -761,12 +897,12 @@ func TestQuery(t *testing.T) {
 		}
 
 		db := c.PrivateDB("userid")
-		_, err := db.Extend("category", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "category", skydb.RecordSchema{
 			"hidden": skydb.FieldType{Type: skydb.TypeBoolean},
 		})
 		So(err, ShouldBeNil)
 
-		_, err = db.Extend("note", skydb.RecordSchema{
+		_, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 			"category": skydb.FieldType{
 				Type:          skydb.TypeReference,
@@ -775,15 +911,15 @@ func TestQuery(t *testing.T) {
 		})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&category1)
+		err = db.Save(context.Background(), &category1)
 		So(err, ShouldBeNil)
-		err = db.Save(&category2)
+		err = db.Save(context.Background(), &category2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record2)
+		err = db.Save(context.Background(), &record2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record1)
+		err = db.Save(context.Background(), &record1)
 		So(err, ShouldBeNil)
-		err = db.Save(&record3)
+		err = db.Save(context.Background(), &record3)
 		So(err, ShouldBeNil)
 
 		Convey("query records by reference", func() {
@@ -803,7 +939,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 1)
@@ -827,7 +963,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 1)
@@ -864,13 +1000,13 @@ func TestQuery(t *testing.T) {
 		westminsterPalaceLocation := skydb.NewLocation(-0.124722, 51.499167)
 
 		db := c.PublicDB()
-		_, err := db.Extend("point_of_interest", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "point_of_interest", skydb.RecordSchema{
 			"location": skydb.FieldType{Type: skydb.TypeLocation},
 		})
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record2), ShouldBeNil)
 
 		Convey("query within distance", func() {
 			query := skydb.Query{
@@ -892,7 +1028,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
@@ -918,7 +1054,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
@@ -950,7 +1086,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 1)
@@ -971,7 +1107,7 @@ func TestQuery(t *testing.T) {
 				},
 			}
 
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0, record2, record1})
 		})
@@ -1009,21 +1145,21 @@ func TestQuery(t *testing.T) {
 		recordsInDB := []skydb.Record{record0, record1, record2}
 
 		db := c.PublicDB()
-		_, err := db.Extend("restaurant", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "restaurant", skydb.RecordSchema{
 			"title":   skydb.FieldType{Type: skydb.TypeString},
 			"cuisine": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record2), ShouldBeNil)
 
 		Convey("query with desired keys", func() {
 			query := skydb.Query{
 				Type:        "restaurant",
 				DesiredKeys: []string{"cuisine"},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 3)
@@ -1038,7 +1174,7 @@ func TestQuery(t *testing.T) {
 				Type:        "restaurant",
 				DesiredKeys: []string{},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 3)
@@ -1053,7 +1189,7 @@ func TestQuery(t *testing.T) {
 				Type:        "restaurant",
 				DesiredKeys: nil,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 3)
@@ -1068,7 +1204,7 @@ func TestQuery(t *testing.T) {
 				Type:        "restaurant",
 				DesiredKeys: []string{"pricing"},
 			}
-			_, err := exhaustRows(db.Query(&query))
+			_, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldNotBeNil)
 		})
@@ -1105,17 +1241,17 @@ func TestQuery(t *testing.T) {
 		}
 
 		db := c.PrivateDB("userid")
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"primaryTag": skydb.FieldType{Type: skydb.TypeString},
 			"tags":       skydb.FieldType{Type: skydb.TypeJSON},
 		})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&record2)
+		err = db.Save(context.Background(), &record2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record1)
+		err = db.Save(context.Background(), &record1)
 		So(err, ShouldBeNil)
-		err = db.Save(&record3)
+		err = db.Save(context.Background(), &record3)
 		So(err, ShouldBeNil)
 
 		Convey("query records by literal string in JSON", func() {
@@ -1135,7 +1271,7 @@ func TestQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record3})
@@ -1183,18 +1319,18 @@ func TestQuery(t *testing.T) {
 		}
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{})
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&record1)
+		err = db.Save(context.Background(), &record1)
 		So(err, ShouldBeNil)
-		err = db.Save(&record2)
+		err = db.Save(context.Background(), &record2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record3)
+		err = db.Save(context.Background(), &record3)
 		So(err, ShouldBeNil)
-		err = db.Save(&record4)
+		err = db.Save(context.Background(), &record4)
 		So(err, ShouldBeNil)
-		err = db.Save(&record5)
+		err = db.Save(context.Background(), &record5)
 		So(err, ShouldBeNil)
 
 		sortsByID := []skydb.Sort{
@@ -1210,7 +1346,7 @@ func TestQuery(t *testing.T) {
 				ViewAsUser: &skydb.UserInfo{ID: "alice"},
 				Sorts:      sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
@@ -1222,7 +1358,7 @@ func TestQuery(t *testing.T) {
 				ViewAsUser: nil,
 				Sorts:      sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record2})
@@ -1234,7 +1370,7 @@ func TestQuery(t *testing.T) {
 				ViewAsUser: &skydb.UserInfo{ID: "bob"},
 				Sorts:      sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record2, record3, record5})
@@ -1249,7 +1385,7 @@ func TestQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record2, record4, record5})
@@ -1264,12 +1400,48 @@ func TestQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record2, record3, record4, record5})
 		})
 
+		Convey("can be queried by records shared with user", func() {
+			So(c.CreateUser(context.Background(), &skydb.UserInfo{
+				ID:       "bob",
+				Username: "bob",
+				Roles:    []string{"marketing"},
+			}), ShouldBeNil)
+
+			sharedRecord := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id6"),
+				OwnerID: "bob",
+				ACL: skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("bob", skydb.WriteLevel),
+				},
+			}
+			So(db.Save(context.Background(), &sharedRecord), ShouldBeNil)
+
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Functional,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.SharedWithUserFunc{"bob"},
+						},
+					},
+				},
+				ViewAsUser: &skydb.UserInfo{ID: "bob", Roles: []string{"marketing"}},
+				Sorts:      sortsByID,
+			}
+			records, err := exhaustRows(db.Query(context.Background(), &query))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record3, record4, record5})
+		})
+
 		Convey("can be queried with bypass access control", func() {
 			query := skydb.Query{
 				Type: "note",
@@ -1279,32 +1451,129 @@ func TestQuery(t *testing.T) {
 				Sorts:               sortsByID,
 				BypassAccessControl: true,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
 		})
 	})
 
+	Convey("Database with union read", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		publicRecord := skydb.Record{
+			ID:      skydb.NewRecordID("note", "public"),
+			OwnerID: "alice",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+			},
+		}
+		restrictedRecord := skydb.Record{
+			ID:      skydb.NewRecordID("note", "restricted"),
+			OwnerID: "alice",
+			ACL:     skydb.RecordACL{},
+		}
+		alicePrivateRecord := skydb.Record{
+			ID:      skydb.NewRecordID("note", "alice-private"),
+			OwnerID: "alice",
+		}
+		bobPrivateRecord := skydb.Record{
+			ID:      skydb.NewRecordID("note", "bob-private"),
+			OwnerID: "bob",
+		}
+
+		publicDB := c.PublicDB()
+		_, err := publicDB.Extend(context.Background(), "note", skydb.RecordSchema{})
+		So(err, ShouldBeNil)
+		So(publicDB.Save(context.Background(), &publicRecord), ShouldBeNil)
+		So(publicDB.Save(context.Background(), &restrictedRecord), ShouldBeNil)
+		So(c.PrivateDB("alice").Save(context.Background(), &alicePrivateRecord), ShouldBeNil)
+		So(c.PrivateDB("bob").Save(context.Background(), &bobPrivateRecord), ShouldBeNil)
+
+		sortsByID := []skydb.Sort{
+			skydb.Sort{
+				KeyPath: "_id",
+				Order:   skydb.Ascending,
+			},
+		}
+
+		Convey("queries public and private records of the user", func() {
+			db := c.UserUnionDB("bob")
+			So(db.DatabaseType(), ShouldEqual, skydb.UnionDatabase)
+			So(db.IsReadOnly(), ShouldBeTrue)
+
+			query := skydb.Query{
+				Type:       "note",
+				ViewAsUser: &skydb.UserInfo{ID: "bob"},
+				Sorts:      sortsByID,
+			}
+			records, err := exhaustRows(db.Query(context.Background(), &query))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{bobPrivateRecord, publicRecord})
+			So(records[0].DatabaseID, ShouldEqual, "bob")
+			So(records[1].DatabaseID, ShouldEqual, "")
+		})
+
+		Convey("applies ACL to public records only", func() {
+			db := c.UserUnionDB("alice")
+			query := skydb.Query{
+				Type:       "note",
+				ViewAsUser: &skydb.UserInfo{ID: "carol"},
+				Sorts:      sortsByID,
+			}
+			records, err := exhaustRows(db.Query(context.Background(), &query))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{alicePrivateRecord, publicRecord})
+		})
+
+		Convey("queries all records in union database", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			records, err := exhaustRows(c.UnionDB().Query(context.Background(), &query))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{
+				alicePrivateRecord,
+				bobPrivateRecord,
+				publicRecord,
+				restrictedRecord,
+			})
+		})
+
+		Convey("rejects saving records", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "new"),
+				OwnerID: "bob",
+			}
+			err := c.UserUnionDB("bob").Save(context.Background(), &record)
+			So(err, ShouldEqual, skydb.ErrDatabaseIsReadOnly)
+		})
+	})
+
 	Convey("Empty Conn", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
 		Convey("gets no users", func() {
 			userinfo := skydb.UserInfo{}
-			err := c.GetUser("notexistuserid", &userinfo)
+			err := c.GetUser(context.Background(), "notexistuserid", &userinfo)
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("gets no users with principal", func() {
 			userinfo := skydb.UserInfo{}
-			err := c.GetUserByPrincipalID("com.example:johndoe", &userinfo)
+			err := c.GetUserByPrincipalID(context.Background(), "com.example:johndoe", &userinfo)
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("query no users", func() {
 			emails := []string{"user@example.com"}
-			result, err := c.QueryUser(emails, []string{})
+			result, err := c.QueryUser(context.Background(), emails, []string{})
 			So(err, ShouldBeNil)
 			So(len(result), ShouldEqual, 0)
 		})
@@ -1313,23 +1582,23 @@ func TestQuery(t *testing.T) {
 			userinfo := skydb.UserInfo{
 				ID: "notexistuserid",
 			}
-			err := c.UpdateUser(&userinfo)
+			err := c.UpdateUser(context.Background(), &userinfo)
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("deletes no users", func() {
-			err := c.DeleteUser("notexistuserid")
+			err := c.DeleteUser(context.Background(), "notexistuserid")
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("gets no devices", func() {
 			device := skydb.Device{}
-			err := c.GetDevice("notexistdeviceid", &device)
+			err := c.GetDevice(context.Background(), "notexistdeviceid", &device)
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
 		Convey("deletes no devices", func() {
-			err := c.DeleteDevice("notexistdeviceid")
+			err := c.DeleteDevice(context.Background(), "notexistdeviceid")
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
@@ -1339,13 +1608,13 @@ func TestQuery(t *testing.T) {
 			Convey("gets nothing", func() {
 				record := skydb.Record{}
 
-				err := db.Get(skydb.NewRecordID("type", "notexistid"), &record)
+				err := db.Get(context.Background(), skydb.NewRecordID("type", "notexistid"), &record)
 
 				So(err, ShouldEqual, skydb.ErrRecordNotFound)
 			})
 
 			Convey("deletes nothing", func() {
-				err := db.Delete(skydb.NewRecordID("type", "notexistid"))
+				err := db.Delete(context.Background(), skydb.NewRecordID("type", "notexistid"))
 				So(err, ShouldEqual, skydb.ErrRecordNotFound)
 			})
 
@@ -1354,7 +1623,7 @@ func TestQuery(t *testing.T) {
 					Type: "notexisttype",
 				}
 
-				records, err := exhaustRows(db.Query(&query))
+				records, err := exhaustRows(db.Query(context.Background(), &query))
 
 				So(err, ShouldBeNil)
 				So(records, ShouldBeEmpty)
@@ -1363,6 +1632,200 @@ func TestQuery(t *testing.T) {
 	})
 }
 
+func TestExplainQuery(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"content": "Hello World",
+			},
+		}), ShouldBeNil)
+
+		Convey("explains query by primary key", func() {
+			plan, err := db.(skydb.QueryExplainer).ExplainQuery(context.Background(), &skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "_id"},
+						skydb.Expression{Type: skydb.Literal, Value: "id1"},
+					},
+				},
+			})
+			So(err, ShouldBeNil)
+			So(plan.Statement, ShouldStartWith, "SELECT ")
+			So(plan.Args, ShouldResemble, []interface{}{"id1"})
+			So(plan.Plan, ShouldNotBeNil)
+			So(plan.ExecutionTime, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("explains query of nonexistent record type", func() {
+			plan, err := db.(skydb.QueryExplainer).ExplainQuery(context.Background(), &skydb.Query{
+				Type: "notexist",
+			})
+			So(err, ShouldBeNil)
+			So(plan.Statement, ShouldEqual, "")
+			So(plan.Indexes, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestQueryHints(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"content": "Hello World",
+			},
+		}), ShouldBeNil)
+
+		enableSeqScan := func() string {
+			var setting string
+			So(c.Get(context.Background(), &setting, "SHOW enable_seqscan"), ShouldBeNil)
+			return setting
+		}
+
+		query := &skydb.Query{
+			Type: "note",
+			Hints: &skydb.QueryHints{
+				Index:          "note_pkey",
+				DisableSeqScan: true,
+				JoinStrategy:   skydb.HashJoin,
+			},
+		}
+
+		Convey("queries with hints and reverts the settings", func() {
+			records, err := exhaustRows(db.Query(context.Background(), query))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(c.tx, ShouldBeNil)
+			So(enableSeqScan(), ShouldEqual, "on")
+		})
+
+		Convey("queries with hints in a transaction", func() {
+			So(c.Begin(context.Background()), ShouldBeNil)
+			defer c.Rollback()
+
+			records, err := exhaustRows(db.Query(context.Background(), query))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(c.tx, ShouldNotBeNil)
+			So(enableSeqScan(), ShouldEqual, "on")
+		})
+
+		Convey("explains query with hints", func() {
+			plan, err := db.(skydb.QueryExplainer).ExplainQuery(context.Background(), query)
+			So(err, ShouldBeNil)
+			So(plan.Statement, ShouldStartWith, `/*+ IndexScan("note" "note_pkey") */ SELECT `)
+			So(enableSeqScan(), ShouldEqual, "on")
+		})
+
+		Convey("rejects nonexistent index", func() {
+			query.Hints.Index = "note_content_idx"
+			_, err := db.Query(context.Background(), query)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+	})
+}
+
+func TestUsage(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		publicDB := c.PublicDB()
+		_, err := publicDB.Extend(context.Background(), "note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		_, err = publicDB.Extend(context.Background(), "category", skydb.RecordSchema{})
+		So(err, ShouldBeNil)
+
+		So(publicDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "public"),
+			OwnerID: "alice",
+			Data:    map[string]interface{}{"content": "public"},
+		}), ShouldBeNil)
+
+		privateDB := c.PrivateDB("alice")
+		So(privateDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "alice",
+			Data:    map[string]interface{}{"content": "hello"},
+		}), ShouldBeNil)
+		So(privateDB.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("category", "category1"),
+			OwnerID: "alice",
+		}), ShouldBeNil)
+
+		Convey("counts records of all types in private database", func() {
+			usage, err := privateDB.(skydb.UsageCounter).Usage(context.Background())
+			So(err, ShouldBeNil)
+			So(usage.RecordCount, ShouldEqual, 2)
+			So(usage.StorageSize, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("counts nothing in empty private database", func() {
+			usage, err := c.PrivateDB("bob").(skydb.UsageCounter).Usage(context.Background())
+			So(err, ShouldBeNil)
+			So(usage, ShouldResemble, skydb.DatabaseUsage{})
+		})
+
+		Convey("counts records in public database", func() {
+			usage, err := publicDB.(skydb.UsageCounter).Usage(context.Background())
+			So(err, ShouldBeNil)
+			So(usage.RecordCount, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestPlanIndexNames(t *testing.T) {
+	Convey("planIndexNames", t, func() {
+		plan := map[string]interface{}{
+			"Node Type": "Nested Loop",
+			"Plans": []interface{}{
+				map[string]interface{}{
+					"Node Type":  "Index Scan",
+					"Index Name": "note_pkey",
+				},
+				map[string]interface{}{
+					"Node Type": "Seq Scan",
+					"Plans": []interface{}{
+						map[string]interface{}{
+							"Node Type":  "Index Only Scan",
+							"Index Name": "_user_pkey",
+						},
+						map[string]interface{}{
+							"Node Type":  "Index Scan",
+							"Index Name": "note_pkey",
+						},
+					},
+				},
+			},
+		}
+		So(planIndexNames(plan, []string{}), ShouldResemble, []string{"note_pkey", "_user_pkey"})
+	})
+}
+
 func TestQueryCount(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
@@ -1395,24 +1858,24 @@ func TestQueryCount(t *testing.T) {
 		}
 
 		db := c.PrivateDB("userid")
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 			"content":   skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&record2)
+		err = db.Save(context.Background(), &record2)
 		So(err, ShouldBeNil)
-		err = db.Save(&record1)
+		err = db.Save(context.Background(), &record1)
 		So(err, ShouldBeNil)
-		err = db.Save(&record3)
+		err = db.Save(context.Background(), &record3)
 		So(err, ShouldBeNil)
 
 		Convey("count records", func() {
 			query := skydb.Query{
 				Type: "note",
 			}
-			count, err := db.QueryCount(&query)
+			count, err := db.QueryCount(context.Background(), &query)
 
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 3)
@@ -1435,7 +1898,7 @@ func TestQueryCount(t *testing.T) {
 					},
 				},
 			}
-			count, err := db.QueryCount(&query)
+			count, err := db.QueryCount(context.Background(), &query)
 
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 1)
@@ -1458,7 +1921,7 @@ func TestQueryCount(t *testing.T) {
 					},
 				},
 			}
-			count, err := db.QueryCount(&query)
+			count, err := db.QueryCount(context.Background(), &query)
 
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 0)
@@ -1473,7 +1936,7 @@ func TestAggregateQuery(t *testing.T) {
 
 		// fixture
 		db := c.PrivateDB("userid")
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"category": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
@@ -1489,7 +1952,7 @@ func TestAggregateQuery(t *testing.T) {
 					"category": category,
 				},
 			}
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			dbRecords = append(dbRecords, record)
 			So(err, ShouldBeNil)
 		}
@@ -1516,7 +1979,7 @@ func TestAggregateQuery(t *testing.T) {
 				Predicate: equalCategoryPredicate("funny"),
 				GetCount:  true,
 			}
-			rows, err := db.Query(&query)
+			rows, err := db.Query(context.Background(), &query)
 			records, err := exhaustRows(rows, err)
 
 			So(err, ShouldBeNil)
@@ -1535,7 +1998,7 @@ func TestAggregateQuery(t *testing.T) {
 				Predicate: equalCategoryPredicate("interesting"),
 				GetCount:  true,
 			}
-			rows, err := db.Query(&query)
+			rows, err := db.Query(context.Background(), &query)
 			records, err := exhaustRows(rows, err)
 
 			So(err, ShouldBeNil)
@@ -1553,7 +2016,7 @@ func TestAggregateQuery(t *testing.T) {
 				Limit:     new(uint64),
 			}
 			*query.Limit = 1
-			rows, err := db.Query(&query)
+			rows, err := db.Query(context.Background(), &query)
 			records, err := exhaustRows(rows, err)
 
 			So(err, ShouldBeNil)
@@ -1592,10 +2055,10 @@ func TestMetaDataQuery(t *testing.T) {
 		}
 
 		db := c.PublicDB()
-		_, err := db.Extend("record", nil)
+		_, err := db.Extend(context.Background(), "record", nil)
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
 
 		Convey("queries by record id", func() {
 			query := skydb.Query{
@@ -1614,7 +2077,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0})
@@ -1637,7 +2100,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
@@ -1660,7 +2123,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0})
@@ -1683,7 +2146,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0})
@@ -1706,7 +2169,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
@@ -1729,7 +2192,7 @@ func TestMetaDataQuery(t *testing.T) {
 					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
@@ -1747,14 +2210,14 @@ func TestUserRelationQuery(t *testing.T) {
 		addUser(t, c, "user3") // mutual follower of user1
 		addUser(t, c, "user4") // friend of user1
 		addUser(t, c, "user5") // friend of user4 and followed by user4
-		c.AddRelation("user1", "_follow", "user2")
-		c.AddRelation("user1", "_follow", "user3")
-		c.AddRelation("user3", "_follow", "user1")
-		c.AddRelation("user1", "_friend", "user4")
-		c.AddRelation("user4", "_friend", "user1")
-		c.AddRelation("user4", "_friend", "user5")
-		c.AddRelation("user5", "_friend", "user4")
-		c.AddRelation("user4", "_follow", "user5")
+		c.AddRelation(context.Background(), "user1", "_follow", "user2")
+		c.AddRelation(context.Background(), "user1", "_follow", "user3")
+		c.AddRelation(context.Background(), "user3", "_follow", "user1")
+		c.AddRelation(context.Background(), "user1", "_friend", "user4")
+		c.AddRelation(context.Background(), "user4", "_friend", "user1")
+		c.AddRelation(context.Background(), "user4", "_friend", "user5")
+		c.AddRelation(context.Background(), "user5", "_friend", "user4")
+		c.AddRelation(context.Background(), "user4", "_follow", "user5")
 
 		record0 := skydb.Record{
 			ID:      skydb.NewRecordID("record", "0"),
@@ -1783,13 +2246,13 @@ func TestUserRelationQuery(t *testing.T) {
 		}
 
 		db := c.PublicDB()
-		_, err := db.Extend("record", nil)
+		_, err := db.Extend(context.Background(), "record", nil)
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
-		So(db.Save(&record3), ShouldBeNil)
-		So(db.Save(&record4), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record2), ShouldBeNil)
+		So(db.Save(context.Background(), &record3), ShouldBeNil)
+		So(db.Save(context.Background(), &record4), ShouldBeNil)
 
 		sortsByID := []skydb.Sort{
 			skydb.Sort{
@@ -1812,7 +2275,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1, record2})
@@ -1832,7 +2295,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0})
@@ -1866,7 +2329,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0, record1, record2})
@@ -1886,7 +2349,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record2})
@@ -1906,7 +2369,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 0)
@@ -1926,7 +2389,7 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record3})
@@ -1960,11 +2423,11 @@ func TestUserRelationQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record0, record4})
 
-			count, err := db.QueryCount(&query)
+			count, err := db.QueryCount(context.Background(), &query)
 			So(err, ShouldBeNil)
 			So(count, ShouldEqual, 2)
 		})
@@ -1997,11 +2460,11 @@ func TestUserDiscoverQuery(t *testing.T) {
 		}
 
 		db := c.PublicDB()
-		_, err := db.Extend("user", nil)
+		_, err := db.Extend(context.Background(), "user", nil)
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record2), ShouldBeNil)
 
 		sortsByID := []skydb.Sort{
 			skydb.Sort{
@@ -2024,7 +2487,7 @@ func TestUserDiscoverQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 1)
@@ -2048,7 +2511,7 @@ func TestUserDiscoverQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 2)
@@ -2078,7 +2541,7 @@ func TestUserDiscoverQuery(t *testing.T) {
 				},
 				Sorts: sortsByID,
 			}
-			records, err := exhaustRows(db.Query(&query))
+			records, err := exhaustRows(db.Query(context.Background(), &query))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 2)
@@ -2109,13 +2572,13 @@ func TestUnsupportedQuery(t *testing.T) {
 		}
 
 		db := c.PublicDB()
-		_, err := db.Extend("record", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "record", skydb.RecordSchema{
 			"categories":       skydb.FieldType{Type: skydb.TypeString},
 			"favoriteCategory": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(context.Background(), &record0), ShouldBeNil)
+		So(db.Save(context.Background(), &record1), ShouldBeNil)
 
 		Convey("both side of IN is keypath", func() {
 			query := skydb.Query{
@@ -2134,7 +2597,7 @@ func TestUnsupportedQuery(t *testing.T) {
 					},
 				},
 			}
-			So(func() { db.Query(&query) }, ShouldPanicWith, "malformed query")
+			So(func() { db.Query(context.Background(), &query) }, ShouldPanicWith, "malformed query")
 		})
 	})
 }
@@ -2145,7 +2608,7 @@ func TestRecordACL(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", nil)
+		_, err := db.Extend(context.Background(), "note", nil)
 		So(err, ShouldBeNil)
 
 		record := skydb.Record{
@@ -2155,12 +2618,12 @@ func TestRecordACL(t *testing.T) {
 		}
 
 		Convey("saves public access correctly", func() {
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 
 			So(err, ShouldBeNil)
 
 			var b []byte
-			err = c.QueryRowx(`SELECT _access FROM note WHERE _id = '1'`).
+			err = c.QueryRowx(context.Background(), `SELECT _access FROM note WHERE _id = '1'`).
 				Scan(&b)
 			So(err, ShouldBeNil)
 			So(b, ShouldResemble, []byte(nil))
@@ -2174,13 +2637,13 @@ func TestRecordJSON(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"jsonfield": skydb.FieldType{Type: skydb.TypeJSON},
 		})
 		So(err, ShouldBeNil)
 
 		Convey("fetch record with json field", func() {
-			_, err := db.Extend("record", skydb.RecordSchema{
+			_, err := db.Extend(context.Background(), "record", skydb.RecordSchema{
 				"array":      skydb.FieldType{Type: skydb.TypeJSON},
 				"dictionary": skydb.FieldType{Type: skydb.TypeJSON},
 			})
@@ -2191,7 +2654,7 @@ func TestRecordJSON(t *testing.T) {
 				`VALUES ('', 'id', '', '0001-01-01 00:00:00', '', '0001-01-01 00:00:00', '', '[1, "string", true]', '{"number": 0, "string": "value", "bool": false}')`)
 
 			var record skydb.Record
-			err = db.Get(skydb.NewRecordID("record", "id"), &record)
+			err = db.Get(context.Background(), skydb.NewRecordID("record", "id"), &record)
 			So(err, ShouldBeNil)
 
 			So(record, ShouldResemble, skydb.Record{
@@ -2216,10 +2679,10 @@ func TestRecordJSON(t *testing.T) {
 				},
 			}
 
-			So(db.Save(&record), ShouldBeNil)
+			So(db.Save(context.Background(), &record), ShouldBeNil)
 
 			var jsonBytes []byte
-			err := c.QueryRowx(`SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
+			err := c.QueryRowx(context.Background(), `SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
 				Scan(&jsonBytes)
 			So(err, ShouldBeNil)
 			So(jsonBytes, ShouldEqualJSON, `[0, "string", true]`)
@@ -2238,10 +2701,10 @@ func TestRecordJSON(t *testing.T) {
 				},
 			}
 
-			So(db.Save(&record), ShouldBeNil)
+			So(db.Save(context.Background(), &record), ShouldBeNil)
 
 			var jsonBytes []byte
-			err := c.QueryRowx(`SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
+			err := c.QueryRowx(context.Background(), `SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
 				Scan(&jsonBytes)
 			So(err, ShouldBeNil)
 			So(jsonBytes, ShouldEqualJSON, `{"number": 1, "string": "", "bool": false}`)
@@ -2254,20 +2717,20 @@ func TestRecordAssetField(t *testing.T) {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
-		So(c.SaveAsset(&skydb.Asset{
+		So(c.SaveAsset(context.Background(), &skydb.Asset{
 			Name:        "picture.png",
 			ContentType: "image/png",
 			Size:        1,
 		}), ShouldBeNil)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"image": skydb.FieldType{Type: skydb.TypeAsset},
 		})
 		So(err, ShouldBeNil)
 
 		Convey("can be associated", func() {
-			err := db.Save(&skydb.Record{
+			err := db.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "id"),
 				Data: map[string]interface{}{
 					"image": &skydb.Asset{Name: "picture.png"},
@@ -2278,7 +2741,7 @@ func TestRecordAssetField(t *testing.T) {
 		})
 
 		Convey("errors when associated with non-existing asset", func() {
-			err := db.Save(&skydb.Record{
+			err := db.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "id"),
 				Data: map[string]interface{}{
 					"image": &skydb.Asset{Name: "notexist.png"},
@@ -2288,8 +2751,36 @@ func TestRecordAssetField(t *testing.T) {
 			So(err, ShouldNotBeNil)
 		})
 
+		Convey("saves checksum and upload status", func() {
+			So(c.SaveAsset(context.Background(), &skydb.Asset{
+				Name:         "document.pdf",
+				ContentType:  "application/pdf",
+				Size:         2,
+				MD5:          "d41d8cd98f00b204e9800998ecf8427e",
+				UploadStatus: skydb.AssetUploadPending,
+			}), ShouldBeNil)
+
+			asset := skydb.Asset{}
+			So(c.GetAsset(context.Background(), "document.pdf", &asset), ShouldBeNil)
+			So(asset, ShouldResemble, skydb.Asset{
+				Name:         "document.pdf",
+				ContentType:  "application/pdf",
+				Size:         2,
+				MD5:          "d41d8cd98f00b204e9800998ecf8427e",
+				UploadStatus: skydb.AssetUploadPending,
+			})
+
+			So(c.GetAsset(context.Background(), "picture.png", &asset), ShouldBeNil)
+			So(asset, ShouldResemble, skydb.Asset{
+				Name:         "picture.png",
+				ContentType:  "image/png",
+				Size:         1,
+				UploadStatus: skydb.AssetUploadCompleted,
+			})
+		})
+
 		Convey("REGRESSION #229: can be fetched", func() {
-			So(db.Save(&skydb.Record{
+			So(db.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("note", "id"),
 				Data: map[string]interface{}{
 					"image": &skydb.Asset{Name: "picture.png"},
@@ -2298,7 +2789,7 @@ func TestRecordAssetField(t *testing.T) {
 			}), ShouldBeNil)
 
 			var record skydb.Record
-			err := db.Get(skydb.NewRecordID("note", "id"), &record)
+			err := db.Get(context.Background(), skydb.NewRecordID("note", "id"), &record)
 			So(err, ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("note", "id"),
@@ -2317,13 +2808,13 @@ func TestRecordLocationField(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("photo", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "photo", skydb.RecordSchema{
 			"location": skydb.FieldType{Type: skydb.TypeLocation},
 		})
 		So(err, ShouldBeNil)
 
 		Convey("saves & load location field", func() {
-			err := db.Save(&skydb.Record{
+			err := db.Save(context.Background(), &skydb.Record{
 				ID: skydb.NewRecordID("photo", "1"),
 				Data: map[string]interface{}{
 					"location": skydb.NewLocation(1, 2),
@@ -2334,7 +2825,7 @@ func TestRecordLocationField(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			record := skydb.Record{}
-			err = db.Get(skydb.NewRecordID("photo", "1"), &record)
+			err = db.Get(context.Background(), skydb.NewRecordID("photo", "1"), &record)
 			So(err, ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("photo", "1"),
@@ -2344,6 +2835,48 @@ func TestRecordLocationField(t *testing.T) {
 				OwnerID: "userid",
 			})
 		})
+
+		Convey("queries records within bounds", func() {
+			for key, location := range map[string]skydb.Location{
+				"hongkong": skydb.NewLocation(114.1667, 22.25),
+				"tokyo":    skydb.NewLocation(139.6917, 35.6895),
+				"fiji":     skydb.NewLocation(179.4144, -16.5782),
+			} {
+				err := db.Save(context.Background(), &skydb.Record{
+					ID:      skydb.NewRecordID("photo", key),
+					Data:    map[string]interface{}{"location": location},
+					OwnerID: "userid",
+				})
+				So(err, ShouldBeNil)
+			}
+
+			queryKeys := func(southWest skydb.Location, northEast skydb.Location) []string {
+				query := skydb.Query{
+					Type: "photo",
+					Predicate: skydb.Predicate{
+						Operator: skydb.Functional,
+						Children: []interface{}{
+							skydb.Expression{
+								Type:  skydb.Function,
+								Value: skydb.WithinBoundsFunc{"location", southWest, northEast},
+							},
+						},
+					},
+					Sorts: []skydb.Sort{{KeyPath: "_id", Order: skydb.Ascending}},
+				}
+				records, err := exhaustRows(db.Query(context.Background(), &query))
+				So(err, ShouldBeNil)
+
+				keys := []string{}
+				for _, record := range records {
+					keys = append(keys, record.ID.Key)
+				}
+				return keys
+			}
+
+			So(queryKeys(skydb.NewLocation(100, 0), skydb.NewLocation(150, 40)), ShouldResemble, []string{"hongkong", "tokyo"})
+			So(queryKeys(skydb.NewLocation(170, -20), skydb.NewLocation(-170, 0)), ShouldResemble, []string{"fiji"})
+		})
 	})
 }
 
@@ -2353,7 +2886,7 @@ func TestRecordSequenceField(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 			"seq": skydb.FieldType{Type: skydb.TypeSequence},
 		})
 		So(err, ShouldBeNil)
@@ -2364,7 +2897,7 @@ func TestRecordSequenceField(t *testing.T) {
 				OwnerID: "userid",
 			}
 
-			err := db.Save(&record)
+			err := db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("note", "1"),
@@ -2379,7 +2912,7 @@ func TestRecordSequenceField(t *testing.T) {
 				OwnerID: "userid",
 			}
 
-			err = db.Save(&record)
+			err = db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("note", "2"),
@@ -2396,11 +2929,11 @@ func TestRecordSequenceField(t *testing.T) {
 				OwnerID: "userid",
 			}
 
-			So(db.Save(&record), ShouldBeNil)
+			So(db.Save(context.Background(), &record), ShouldBeNil)
 			So(record.Data["seq"], ShouldEqual, 1)
 
 			record.Data["seq"] = 10
-			So(db.Save(&record), ShouldBeNil)
+			So(db.Save(context.Background(), &record), ShouldBeNil)
 
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("note", "1"),
@@ -2415,7 +2948,7 @@ func TestRecordSequenceField(t *testing.T) {
 				ID:      skydb.NewRecordID("note", "2"),
 				OwnerID: "userid",
 			}
-			So(db.Save(&record), ShouldBeNil)
+			So(db.Save(context.Background(), &record), ShouldBeNil)
 			So(record, ShouldResemble, skydb.Record{
 				ID: skydb.NewRecordID("note", "2"),
 				Data: map[string]interface{}{
@@ -2433,9 +2966,9 @@ func TestRecordUnknownField(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{})
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{})
 		So(err, ShouldBeNil)
-		_, err = c.Exec(`ALTER TABLE "note" ADD "money" money;`)
+		_, err = c.Exec(context.Background(), `ALTER TABLE "note" ADD "money" money;`)
 		So(err, ShouldBeNil)
 		insertRow(t, c.Db(), `INSERT INTO "note" `+
 			`(_database_id, _id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "money") `+
@@ -2446,7 +2979,7 @@ func TestRecordUnknownField(t *testing.T) {
 
 		Convey("fetch returns unknown type", func() {
 			record := skydb.Record{}
-			err = db.Get(skydb.NewRecordID("note", "id0"), &record)
+			err = db.Get(context.Background(), skydb.NewRecordID("note", "id0"), &record)
 			So(err, ShouldBeNil)
 			So(record.Data, ShouldResemble, skydb.Data{
 				"money": skydb.Unknown{
@@ -2457,7 +2990,7 @@ func TestRecordUnknownField(t *testing.T) {
 
 		Convey("fetch null row returns null (no unknown type)", func() {
 			record := skydb.Record{}
-			err = db.Get(skydb.NewRecordID("note", "id1"), &record)
+			err = db.Get(context.Background(), skydb.NewRecordID("note", "id1"), &record)
 			So(err, ShouldBeNil)
 			So(record.Data, ShouldResemble, skydb.Data{})
 		})
@@ -2467,7 +3000,7 @@ func TestRecordUnknownField(t *testing.T) {
 				ID:      skydb.NewRecordID("note", "id0"),
 				OwnerID: "user0",
 			}
-			err = db.Save(&record)
+			err = db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record.Data, ShouldResemble, skydb.Data{
 				"money": skydb.Unknown{
@@ -2486,7 +3019,7 @@ func TestRecordUnknownField(t *testing.T) {
 					},
 				},
 			}
-			err = db.Save(&record)
+			err = db.Save(context.Background(), &record)
 			So(err, ShouldBeNil)
 			So(record.Data, ShouldResemble, skydb.Data{})
 		})
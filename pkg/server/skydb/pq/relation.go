@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -22,7 +23,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
-func (c *conn) QueryRelation(user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
+func (c *conn) QueryRelation(ctx context.Context, user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
 	log.Debugf("Query Relation: %v, %v", user, name)
 	var selectBuilder sq.SelectBuilder
 
@@ -51,7 +52,7 @@ func (c *conn) QueryRelation(user string, name string, direction string, config
 		selectBuilder = selectBuilder.Limit(config.Limit)
 	}
 
-	rows, err := c.QueryWith(selectBuilder)
+	rows, err := c.QueryWith(ctx, selectBuilder)
 	if err != nil {
 		panic(err)
 	}
@@ -76,7 +77,7 @@ func (c *conn) QueryRelation(user string, name string, direction string, config
 	return results
 }
 
-func (c *conn) QueryRelationCount(user string, name string, direction string) (uint64, error) {
+func (c *conn) QueryRelationCount(ctx context.Context, user string, name string, direction string) (uint64, error) {
 	log.Debugf("Query Relation Count: %v, %v, %v", user, name, direction)
 	query := psql.Select("COUNT(*)").From(c.tableName(name) + "AS _primary")
 	if direction == "outward" {
@@ -90,21 +91,21 @@ func (c *conn) QueryRelationCount(user string, name string, direction string) (u
 			Where("_secondary.right_id = ?", user)
 	}
 	var count uint64
-	err := c.GetWith(&count, query)
+	err := c.GetWith(ctx, &count, query)
 	if err != nil {
 		panic(err)
 	}
 	return count, err
 }
 
-func (c *conn) AddRelation(user string, name string, targetUser string) error {
+func (c *conn) AddRelation(ctx context.Context, user string, name string, targetUser string) error {
 	ralationPair := map[string]interface{}{
 		"left_id":  user,
 		"right_id": targetUser,
 	}
 
 	upsert := upsertQuery(c.tableName(name), ralationPair, nil)
-	_, err := c.ExecWith(upsert)
+	_, err := c.ExecWith(ctx, upsert)
 	if err != nil {
 		if isForeignKeyViolated(err) {
 			return fmt.Errorf("userID not exist")
@@ -114,10 +115,10 @@ func (c *conn) AddRelation(user string, name string, targetUser string) error {
 	return err
 }
 
-func (c *conn) RemoveRelation(user string, name string, targetUser string) error {
+func (c *conn) RemoveRelation(ctx context.Context, user string, name string, targetUser string) error {
 	builder := psql.Delete(c.tableName(name)).
 		Where("left_id = ? AND right_id = ?", user, targetUser)
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 
 	if err != nil {
 		return err
@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -30,27 +31,27 @@ func TestRelation(t *testing.T) {
 		addUser(t, c, "friendid")
 
 		Convey("add relation", func() {
-			err := c.AddRelation("userid", "_friend", "friendid")
+			err := c.AddRelation(context.Background(), "userid", "_friend", "friendid")
 			So(err, ShouldBeNil)
 		})
 
 		Convey("add a user not exist relation", func() {
-			err := c.AddRelation("userid", "_friend", "non-exist")
+			err := c.AddRelation(context.Background(), "userid", "_friend", "non-exist")
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "userID not exist")
 		})
 
 		Convey("remove non-exist relation", func() {
-			err := c.RemoveRelation("userid", "_friend", "friendid")
+			err := c.RemoveRelation(context.Background(), "userid", "_friend", "friendid")
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual,
 				"_friend relation not exist {userid} => {friendid}")
 		})
 
 		Convey("remove relation", func() {
-			err := c.AddRelation("userid", "_friend", "friendid")
+			err := c.AddRelation(context.Background(), "userid", "_friend", "friendid")
 			So(err, ShouldBeNil)
-			err = c.RemoveRelation("userid", "_friend", "friendid")
+			err = c.RemoveRelation(context.Background(), "userid", "_friend", "friendid")
 			So(err, ShouldBeNil)
 		})
 	})
@@ -64,36 +65,36 @@ func TestRelation(t *testing.T) {
 		addUser(t, c, "friend1")
 		addUser(t, c, "friend2")
 		addUser(t, c, "friend3")
-		c.AddRelation("friend1", "_friend", "friend2")
-		c.AddRelation("friend1", "_friend", "friend3")
-		c.AddRelation("friend2", "_friend", "friend1")
-		c.AddRelation("friend3", "_friend", "friend1")
-		c.AddRelation("friend1", "_friend", "followee")
-		c.AddRelation("follower", "_follow", "followee")
+		c.AddRelation(context.Background(), "friend1", "_friend", "friend2")
+		c.AddRelation(context.Background(), "friend1", "_friend", "friend3")
+		c.AddRelation(context.Background(), "friend2", "_friend", "friend1")
+		c.AddRelation(context.Background(), "friend3", "_friend", "friend1")
+		c.AddRelation(context.Background(), "friend1", "_friend", "followee")
+		c.AddRelation(context.Background(), "follower", "_follow", "followee")
 
 		Convey("query friend relation", func() {
-			users := c.QueryRelation("friend1", "_friend", "mutual", skydb.QueryConfig{})
+			users := c.QueryRelation(context.Background(), "friend1", "_friend", "mutual", skydb.QueryConfig{})
 			So(len(users), ShouldEqual, 2)
 		})
 
 		Convey("query outward follow relation", func() {
-			users := c.QueryRelation("follower", "_follow", "outward", skydb.QueryConfig{})
+			users := c.QueryRelation(context.Background(), "follower", "_follow", "outward", skydb.QueryConfig{})
 			So(len(users), ShouldEqual, 1)
 		})
 
 		Convey("query inward follow relation", func() {
-			users := c.QueryRelation("followee", "_follow", "inward", skydb.QueryConfig{})
+			users := c.QueryRelation(context.Background(), "followee", "_follow", "inward", skydb.QueryConfig{})
 			So(len(users), ShouldEqual, 1)
 		})
 
 		Convey("query friend relation with pagination", func() {
-			users := c.QueryRelation("friend1", "_friend", "mutual", skydb.QueryConfig{
+			users := c.QueryRelation(context.Background(), "friend1", "_friend", "mutual", skydb.QueryConfig{
 				Limit: 1,
 			})
 			So(len(users), ShouldEqual, 1)
 			So(users[0].ID, ShouldEqual, "friend2")
 
-			users = c.QueryRelation("friend1", "_friend", "mutual", skydb.QueryConfig{
+			users = c.QueryRelation(context.Background(), "friend1", "_friend", "mutual", skydb.QueryConfig{
 				Limit:  1,
 				Offset: 1,
 			})
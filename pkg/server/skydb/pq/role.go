@@ -16,6 +16,7 @@ package pq
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"text/template"
@@ -67,7 +68,7 @@ func (c *conn) batchUserRoleSQL(id string, roles []string) (string, []interface{
 
 }
 
-func (c *conn) getRolesByType(roleType string) ([]string, error) {
+func (c *conn) getRolesByType(ctx context.Context, roleType string) ([]string, error) {
 	var col string
 	switch roleType {
 	case "admin":
@@ -80,7 +81,7 @@ func (c *conn) getRolesByType(roleType string) ([]string, error) {
 	builder := psql.Select("id").
 		From(c.tableName("_role")).
 		Where(col + " = true")
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		return nil, err
 	}
@@ -96,30 +97,30 @@ func (c *conn) getRolesByType(roleType string) ([]string, error) {
 	return roles, nil
 }
 
-func (c *conn) GetAdminRoles() ([]string, error) {
-	return c.getRolesByType("admin")
+func (c *conn) GetAdminRoles(ctx context.Context) ([]string, error) {
+	return c.getRolesByType(ctx, "admin")
 }
 
-func (c *conn) SetAdminRoles(roles []string) error {
+func (c *conn) SetAdminRoles(ctx context.Context, roles []string) error {
 	log.Debugf("SetAdminRoles %v", roles)
-	c.ensureRole(roles)
-	return c.setRoleType(roles, "is_admin")
+	c.ensureRole(ctx, roles)
+	return c.setRoleType(ctx, roles, "is_admin")
 }
 
-func (c *conn) GetDefaultRoles() ([]string, error) {
-	return c.getRolesByType("default")
+func (c *conn) GetDefaultRoles(ctx context.Context) ([]string, error) {
+	return c.getRolesByType(ctx, "default")
 }
 
-func (c *conn) SetDefaultRoles(roles []string) error {
+func (c *conn) SetDefaultRoles(ctx context.Context, roles []string) error {
 	log.Debugf("SetDefaultRoles %v", roles)
-	c.ensureRole(roles)
-	return c.setRoleType(roles, "by_default")
+	c.ensureRole(ctx, roles)
+	return c.setRoleType(ctx, roles, "by_default")
 }
 
-func (c *conn) setRoleType(roles []string, col string) error {
+func (c *conn) setRoleType(ctx context.Context, roles []string, col string) error {
 	resetSQL := psql.Update(c.tableName("_role")).
 		Where(col+" = ?", true).Set(col, false)
-	_, err := c.ExecWith(resetSQL)
+	_, err := c.ExecWith(ctx, resetSQL)
 	if err != nil {
 		return err
 	}
@@ -134,17 +135,17 @@ func (c *conn) setRoleType(roles []string, col string) error {
 	updateSQL := psql.Update(c.tableName("_role")).
 		Where("id IN ("+sq.Placeholders(len(roles))+")", roleArgs...).
 		Set(col, true)
-	_, err = c.ExecWith(updateSQL)
+	_, err = c.ExecWith(ctx, updateSQL)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *conn) UpdateUserRoles(userinfo *skydb.UserInfo) error {
+func (c *conn) UpdateUserRoles(ctx context.Context, userinfo *skydb.UserInfo) error {
 	log.Debugf("UpdateRoles %v", userinfo)
 	builder := psql.Delete(c.tableName("_user_role")).Where("user_id = ?", userinfo.ID)
-	_, err := c.ExecWith(builder)
+	_, err := c.ExecWith(ctx, builder)
 	if err != nil {
 		return skyerr.NewError(skyerr.ConstraintViolated,
 			fmt.Sprintf("Fails to reset user roles %v", userinfo.ID))
@@ -153,18 +154,18 @@ func (c *conn) UpdateUserRoles(userinfo *skydb.UserInfo) error {
 		return nil
 	}
 	sql, args := c.batchUserRoleSQL(userinfo.ID, userinfo.Roles)
-	result, err := c.Exec(sql, args...)
+	result, err := c.Exec(ctx, sql, args...)
 	if err != nil {
 		return err
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected != int64(len(userinfo.Roles)) {
-		absenceRoles, err := c.ensureRole(userinfo.Roles)
+		absenceRoles, err := c.ensureRole(ctx, userinfo.Roles)
 		if err != nil {
 			return err
 		}
 		sql, args := c.batchUserRoleSQL(userinfo.ID, absenceRoles)
-		_, err = c.Exec(sql, args...)
+		_, err = c.Exec(ctx, sql, args...)
 		if err != nil {
 			return err
 		}
@@ -173,7 +174,43 @@ func (c *conn) UpdateUserRoles(userinfo *skydb.UserInfo) error {
 	return nil
 }
 
-func (c *conn) createRoles(roles []string) error {
+func (c *conn) AssignUserRoles(ctx context.Context, userID string, roles []string) error {
+	log.Debugf("AssignUserRoles %v %v", userID, roles)
+	if len(roles) == 0 {
+		return nil
+	}
+	if _, err := c.ensureRole(ctx, roles); err != nil {
+		return err
+	}
+
+	// Revoke first so that roles the user already has are not
+	// inserted twice.
+	if err := c.RevokeUserRoles(ctx, userID, roles); err != nil {
+		return err
+	}
+	sql, args := c.batchUserRoleSQL(userID, roles)
+	_, err := c.Exec(ctx, sql, args...)
+	return err
+}
+
+func (c *conn) RevokeUserRoles(ctx context.Context, userID string, roles []string) error {
+	log.Debugf("RevokeUserRoles %v %v", userID, roles)
+	if len(roles) == 0 {
+		return nil
+	}
+
+	roleArgs := make([]interface{}, len(roles))
+	for i, v := range roles {
+		roleArgs[i] = interface{}(v)
+	}
+	builder := psql.Delete(c.tableName("_user_role")).
+		Where("user_id = ?", userID).
+		Where("role_id IN ("+sq.Placeholders(len(roles))+")", roleArgs...)
+	_, err := c.ExecWith(ctx, builder)
+	return err
+}
+
+func (c *conn) createRoles(ctx context.Context, roles []string) error {
 	log.Debugf("createRole %v", roles)
 	for _, role := range roles {
 		builder := psql.Insert(c.tableName("_role")).Columns(
@@ -181,7 +218,7 @@ func (c *conn) createRoles(roles []string) error {
 		).Values(
 			role,
 		)
-		_, err := c.ExecWith(builder)
+		_, err := c.ExecWith(ctx, builder)
 		if isUniqueViolated(err) {
 			return skyerr.NewError(skyerr.Duplicated,
 				fmt.Sprintf("Duplicated roles %v", role))
@@ -190,7 +227,7 @@ func (c *conn) createRoles(roles []string) error {
 	return nil
 }
 
-func (c *conn) queryRoles(roles []string) ([]string, error) {
+func (c *conn) queryRoles(ctx context.Context, roles []string) ([]string, error) {
 	if roles == nil {
 		return nil, nil
 	}
@@ -202,7 +239,7 @@ func (c *conn) queryRoles(roles []string) ([]string, error) {
 	builder := psql.Select("id").
 		From(c.tableName("_role")).
 		Where("id IN ("+sq.Placeholders(len(roles))+")", roleArgs...)
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		return nil, err
 	}
@@ -218,11 +255,11 @@ func (c *conn) queryRoles(roles []string) ([]string, error) {
 	return existedRoles, nil
 }
 
-func (c *conn) ensureRole(roles []string) ([]string, error) {
+func (c *conn) ensureRole(ctx context.Context, roles []string) ([]string, error) {
 	if roles == nil || len(roles) == 0 {
 		return nil, nil
 	}
-	existedRole, err := c.queryRoles(roles)
+	existedRole, err := c.queryRoles(ctx, roles)
 	if err != nil {
 		return nil, err
 	}
@@ -231,5 +268,5 @@ func (c *conn) ensureRole(roles []string) ([]string, error) {
 	}
 	log.Debugf("Diffing the roles not exist in DB")
 	absenceRoles := utils.StringSliceExcept(roles, existedRole)
-	return absenceRoles, c.createRoles(absenceRoles)
+	return absenceRoles, c.createRoles(ctx, absenceRoles)
 }
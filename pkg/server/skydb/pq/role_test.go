@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -34,27 +35,27 @@ func TestRoleCRUD(t *testing.T) {
 				Username: "john.doe",
 				Email:    "john.doe@example.com",
 			}
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 			userinfo.Roles = []string{
 				"admin",
 				"writer",
 			}
-			err = c.UpdateUserRoles(&userinfo)
+			err = c.UpdateUserRoles(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			var role string
-			err = c.QueryRowx("SELECT id FROM _role WHERE id = 'admin'").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE id = 'admin'").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "admin")
 
-			err = c.QueryRowx("SELECT id FROM _role WHERE id = 'writer'").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE id = 'writer'").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "writer")
 
-			rows, err := c.Queryx("SELECT role_id FROM _user_role WHERE user_id = 'userid'")
+			rows, err := c.Queryx(context.Background(), "SELECT role_id FROM _user_role WHERE user_id = 'userid'")
 			So(err, ShouldBeNil)
 			c := 0
 			roles := []string{}
@@ -75,24 +76,24 @@ func TestRoleCRUD(t *testing.T) {
 					"writer",
 				},
 			}
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 			userinfo.Roles = nil
-			err = c.UpdateUserRoles(&userinfo)
+			err = c.UpdateUserRoles(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			var role string
-			err = c.QueryRowx("SELECT id FROM _role WHERE id = 'admin'").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE id = 'admin'").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "admin")
 
-			err = c.QueryRowx("SELECT id FROM _role WHERE id = 'writer'").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE id = 'writer'").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "writer")
 
-			rows, err := c.Queryx("SELECT role_id FROM _user_role WHERE user_id = 'userid'")
+			rows, err := c.Queryx(context.Background(), "SELECT role_id FROM _user_role WHERE user_id = 'userid'")
 			So(err, ShouldBeNil)
 			c := 0
 			for rows.Next() {
@@ -101,6 +102,44 @@ func TestRoleCRUD(t *testing.T) {
 			So(c, ShouldEqual, 0)
 		})
 
+		Convey("assign roles to a user", func() {
+			userinfo := skydb.UserInfo{
+				ID:    "userid",
+				Roles: []string{"writer"},
+			}
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+			err := c.AssignUserRoles(context.Background(), "userid", []string{"writer", "editor"})
+			So(err, ShouldBeNil)
+
+			var role string
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE id = 'editor'").
+				Scan(&role)
+			So(err, ShouldBeNil)
+			So(role, ShouldEqual, "editor")
+
+			fetched := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldHaveLength, 2)
+			So(fetched.Roles, ShouldContain, "writer")
+			So(fetched.Roles, ShouldContain, "editor")
+		})
+
+		Convey("revoke roles from a user", func() {
+			userinfo := skydb.UserInfo{
+				ID:    "userid",
+				Roles: []string{"writer", "editor"},
+			}
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
+
+			err := c.RevokeUserRoles(context.Background(), "userid", []string{"editor", "admin"})
+			So(err, ShouldBeNil)
+
+			fetched := skydb.UserInfo{}
+			So(c.GetUser(context.Background(), "userid", &fetched), ShouldBeNil)
+			So(fetched.Roles, ShouldResemble, []string{"writer"})
+		})
+
 	})
 }
 
@@ -112,12 +151,12 @@ func TestRoleType(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		Convey("set role is_admin to true", func() {
-			err := c.SetAdminRoles([]string{
+			err := c.SetAdminRoles(context.Background(), []string{
 				"god",
 				"buddha",
 			})
 			So(err, ShouldBeNil)
-			rows, err := c.Queryx("SELECT id FROM _role WHERE is_admin = TRUE")
+			rows, err := c.Queryx(context.Background(), "SELECT id FROM _role WHERE is_admin = TRUE")
 			So(err, ShouldBeNil)
 			c := 0
 			var role string
@@ -135,8 +174,8 @@ func TestRoleType(t *testing.T) {
 		})
 
 		Convey("get all admin roles", func() {
-			So(c.SetAdminRoles([]string{"god", "buddha"}), ShouldBeNil)
-			adminRoles, err := c.GetAdminRoles()
+			So(c.SetAdminRoles(context.Background(), []string{"god", "buddha"}), ShouldBeNil)
+			adminRoles, err := c.GetAdminRoles(context.Background())
 			So(err, ShouldBeNil)
 			So(adminRoles, ShouldResemble, []string{
 				"god",
@@ -145,18 +184,18 @@ func TestRoleType(t *testing.T) {
 		})
 
 		Convey("reset role is_admin to false on new admin role set", func() {
-			err := c.SetAdminRoles([]string{
+			err := c.SetAdminRoles(context.Background(), []string{
 				"god",
 				"buddha",
 			})
 			So(err, ShouldBeNil)
-			err = c.SetAdminRoles([]string{
+			err = c.SetAdminRoles(context.Background(), []string{
 				"man",
 			})
 			So(err, ShouldBeNil)
 
 			var role string
-			err = c.QueryRowx("SELECT id FROM _role WHERE is_admin = TRUE").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE is_admin = TRUE").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "man")
@@ -168,12 +207,12 @@ func TestRoleType(t *testing.T) {
 		defer cleanupConn(t, c)
 
 		Convey("set role by_default to true", func() {
-			err := c.SetDefaultRoles([]string{
+			err := c.SetDefaultRoles(context.Background(), []string{
 				"human",
 				"chinese",
 			})
 			So(err, ShouldBeNil)
-			rows, err := c.Queryx("SELECT id FROM _role WHERE by_default = TRUE")
+			rows, err := c.Queryx(context.Background(), "SELECT id FROM _role WHERE by_default = TRUE")
 			So(err, ShouldBeNil)
 			c := 0
 			var role string
@@ -191,8 +230,8 @@ func TestRoleType(t *testing.T) {
 		})
 
 		Convey("get all admin roles", func() {
-			So(c.SetDefaultRoles([]string{"human", "chinese"}), ShouldBeNil)
-			defaultRoles, err := c.GetDefaultRoles()
+			So(c.SetDefaultRoles(context.Background(), []string{"human", "chinese"}), ShouldBeNil)
+			defaultRoles, err := c.GetDefaultRoles(context.Background())
 			So(err, ShouldBeNil)
 			So(defaultRoles, ShouldResemble, []string{
 				"human",
@@ -201,18 +240,18 @@ func TestRoleType(t *testing.T) {
 		})
 
 		Convey("reset role by_default to false on new default role set", func() {
-			err := c.SetDefaultRoles([]string{
+			err := c.SetDefaultRoles(context.Background(), []string{
 				"human",
 				"chinese",
 			})
 			So(err, ShouldBeNil)
-			err = c.SetDefaultRoles([]string{
+			err = c.SetDefaultRoles(context.Background(), []string{
 				"free man",
 			})
 			So(err, ShouldBeNil)
 
 			var role string
-			err = c.QueryRowx("SELECT id FROM _role WHERE by_default = TRUE").
+			err = c.QueryRowx(context.Background(), "SELECT id FROM _role WHERE by_default = TRUE").
 				Scan(&role)
 			So(err, ShouldBeNil)
 			So(role, ShouldEqual, "free man")
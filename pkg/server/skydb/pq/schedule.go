@@ -0,0 +1,161 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+// mutationDataValue stores skydb.Data in the same representation as
+// record payload, so that values like dates and references survive.
+type mutationDataValue skydb.Data
+
+func (data mutationDataValue) Value() (driver.Value, error) {
+	m := map[string]interface{}{}
+	skyconv.ToMapData(skydb.Data(data)).ToMap(m)
+	return json.Marshal(m)
+}
+
+func (data *mutationDataValue) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("skydb: unsupported Scan pair: %T -> %T", value, data)
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	mapData := skyconv.MapData{}
+	if err := mapData.FromMap(m); err != nil {
+		return err
+	}
+	*data = mutationDataValue(mapData)
+	return nil
+}
+
+func (c *conn) SaveScheduledMutation(ctx context.Context, mutation *skydb.ScheduledMutation) error {
+	if mutation.ID == "" || mutation.RecordID.Type == "" || mutation.RecordID.Key == "" || mutation.RunAt.IsZero() {
+		return errors.New("invalid scheduled mutation: empty id, record id or run at")
+	}
+
+	pkData := map[string]interface{}{"id": mutation.ID}
+	data := map[string]interface{}{
+		"record_type": mutation.RecordID.Type,
+		"record_id":   mutation.RecordID.Key,
+		"database_id": mutation.DatabaseID,
+		"data":        mutationDataValue(mutation.Data),
+		"run_at":      mutation.RunAt.UTC(),
+		"created_at":  mutation.CreatedAt.UTC(),
+		"created_by":  nil,
+	}
+
+	if mutation.CreatorID != "" {
+		data["created_by"] = mutation.CreatorID
+	}
+
+	upsert := upsertQuery(c.tableName("_scheduled_mutation"), pkData, data)
+	_, err := c.ExecWith(ctx, upsert)
+	return err
+}
+
+func (c *conn) GetScheduledMutations(ctx context.Context, recordID skydb.RecordID) ([]skydb.ScheduledMutation, error) {
+	builder := c.selectScheduledMutations().
+		Where("record_type = ? AND record_id = ?", recordID.Type, recordID.Key).
+		OrderBy("run_at", "id")
+	return c.queryScheduledMutations(ctx, builder)
+}
+
+func (c *conn) GetDueScheduledMutations(ctx context.Context, before time.Time, limit uint64) ([]skydb.ScheduledMutation, error) {
+	builder := c.selectScheduledMutations().
+		Where("run_at <= ?", before.UTC()).
+		OrderBy("run_at", "id").
+		Limit(limit)
+	return c.queryScheduledMutations(ctx, builder)
+}
+
+func (c *conn) DeleteScheduledMutation(ctx context.Context, id string) error {
+	builder := psql.Delete(c.tableName("_scheduled_mutation")).
+		Where("id = ?", id)
+	result, err := c.ExecWith(ctx, builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrScheduledMutationNotFound
+	} else if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
+	}
+
+	return nil
+}
+
+func (c *conn) selectScheduledMutations() sq.SelectBuilder {
+	return psql.Select("id", "record_type", "record_id", "database_id",
+		"data", "run_at", "created_at", "created_by").
+		From(c.tableName("_scheduled_mutation"))
+}
+
+func (c *conn) queryScheduledMutations(ctx context.Context, builder sq.SelectBuilder) ([]skydb.ScheduledMutation, error) {
+	rows, err := c.QueryWith(ctx, builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []skydb.ScheduledMutation{}
+	for rows.Next() {
+		var (
+			mutation  skydb.ScheduledMutation
+			data      mutationDataValue
+			createdBy sql.NullString
+		)
+		if err := rows.Scan(
+			&mutation.ID,
+			&mutation.RecordID.Type,
+			&mutation.RecordID.Key,
+			&mutation.DatabaseID,
+			&data,
+			&mutation.RunAt,
+			&mutation.CreatedAt,
+			&createdBy,
+		); err != nil {
+			return nil, err
+		}
+		mutation.Data = skydb.Data(data)
+		mutation.RunAt = mutation.RunAt.UTC()
+		mutation.CreatedAt = mutation.CreatedAt.UTC()
+		mutation.CreatorID = createdBy.String
+		results = append(results, mutation)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,98 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduledMutation(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		publishAt := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		unpublishAt := time.Date(2017, 3, 8, 10, 0, 0, 0, time.UTC)
+		createdAt := time.Date(2017, 2, 1, 10, 0, 0, 0, time.UTC)
+
+		publish := skydb.ScheduledMutation{
+			ID:       "publish",
+			RecordID: skydb.NewRecordID("article", "1"),
+			Data: skydb.Data{
+				"status":       "published",
+				"published_at": publishAt,
+			},
+			RunAt:     publishAt,
+			CreatedAt: createdAt,
+			CreatorID: "editor",
+		}
+		unpublish := skydb.ScheduledMutation{
+			ID:         "unpublish",
+			RecordID:   skydb.NewRecordID("article", "1"),
+			DatabaseID: "editor",
+			Data: skydb.Data{
+				"status": "draft",
+			},
+			RunAt:     unpublishAt,
+			CreatedAt: createdAt,
+		}
+		So(c.SaveScheduledMutation(context.Background(), &unpublish), ShouldBeNil)
+		So(c.SaveScheduledMutation(context.Background(), &publish), ShouldBeNil)
+
+		Convey("gets mutations of a record", func() {
+			mutations, err := c.GetScheduledMutations(context.Background(), skydb.NewRecordID("article", "1"))
+			So(err, ShouldBeNil)
+			So(mutations, ShouldResemble, []skydb.ScheduledMutation{publish, unpublish})
+
+			mutations, err = c.GetScheduledMutations(context.Background(), skydb.NewRecordID("article", "2"))
+			So(err, ShouldBeNil)
+			So(mutations, ShouldBeEmpty)
+		})
+
+		Convey("gets due mutations", func() {
+			mutations, err := c.GetDueScheduledMutations(context.Background(), publishAt.Add(time.Hour), 10)
+			So(err, ShouldBeNil)
+			So(mutations, ShouldResemble, []skydb.ScheduledMutation{publish})
+
+			mutations, err = c.GetDueScheduledMutations(context.Background(), unpublishAt, 1)
+			So(err, ShouldBeNil)
+			So(mutations, ShouldResemble, []skydb.ScheduledMutation{publish})
+		})
+
+		Convey("updates a mutation", func() {
+			publish.RunAt = unpublishAt.Add(time.Hour)
+			So(c.SaveScheduledMutation(context.Background(), &publish), ShouldBeNil)
+
+			mutations, err := c.GetScheduledMutations(context.Background(), skydb.NewRecordID("article", "1"))
+			So(err, ShouldBeNil)
+			So(mutations, ShouldResemble, []skydb.ScheduledMutation{unpublish, publish})
+		})
+
+		Convey("deletes a mutation", func() {
+			So(c.DeleteScheduledMutation(context.Background(), "publish"), ShouldBeNil)
+
+			mutations, err := c.GetScheduledMutations(context.Background(), skydb.NewRecordID("article", "1"))
+			So(err, ShouldBeNil)
+			So(mutations, ShouldResemble, []skydb.ScheduledMutation{unpublish})
+
+			So(c.DeleteScheduledMutation(context.Background(), "publish"), ShouldEqual, skydb.ErrScheduledMutationNotFound)
+		})
+	})
+}
@@ -16,6 +16,7 @@ package pq
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -28,8 +29,8 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
-func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (extended bool, err error) {
-	remoteRecordSchema, err := db.remoteColumnTypes(recordType)
+func (db *database) Extend(ctx context.Context, recordType string, recordSchema skydb.RecordSchema) (extended bool, err error) {
+	remoteRecordSchema, err := db.remoteColumnTypes(ctx, recordType)
 	if err != nil {
 		return
 	}
@@ -84,6 +85,17 @@ func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (
 			return false, fmt.Errorf("failed to alter table: %s", err)
 		}
 
+		for column, schema := range updatingSchema {
+			if schema.Type != skydb.TypeReference || schema.OnDelete == skydb.ReferenceRestrict {
+				continue
+			}
+
+			stmt := db.commentReferenceActionStmt(recordType, column, schema.ReferenceType, schema.OnDelete)
+			if _, err := tx.Exec(stmt); err != nil {
+				return false, fmt.Errorf("failed to set reference action: %s", err)
+			}
+		}
+
 		extended = true
 	}
 
@@ -96,7 +108,7 @@ func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (
 	return
 }
 
-func (db *database) RenameSchema(recordType, oldName, newName string) error {
+func (db *database) RenameSchema(ctx context.Context, recordType, oldName, newName string) error {
 	if !db.c.canMigrate {
 		// The record schemas are different, but the database connection
 		// does not allow migration.
@@ -104,17 +116,19 @@ func (db *database) RenameSchema(recordType, oldName, newName string) error {
 	}
 
 	tableName := db.tableName(recordType)
-	oldName = pq.QuoteIdentifier(oldName)
-	newName = pq.QuoteIdentifier(newName)
-
-	stmt := fmt.Sprintf("ALTER TABLE %s RENAME %s TO %s", tableName, oldName, newName)
-	if _, err := db.c.Exec(stmt); err != nil {
+	stmt := fmt.Sprintf("ALTER TABLE %s RENAME %s TO %s",
+		tableName, pq.QuoteIdentifier(oldName), pq.QuoteIdentifier(newName))
+	if _, err := db.c.Exec(ctx, stmt); err != nil {
 		return fmt.Errorf("failed to alter table: %s", err)
 	}
+
+	if err := db.renameFullTextIndex(ctx, recordType, oldName, newName); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (db *database) DeleteSchema(recordType, columnName string) error {
+func (db *database) DeleteSchema(ctx context.Context, recordType, columnName string) error {
 	if !db.c.canMigrate {
 		// The record schemas are different, but the database connection
 		// does not allow migration.
@@ -125,24 +139,25 @@ func (db *database) DeleteSchema(recordType, columnName string) error {
 	columnName = pq.QuoteIdentifier(columnName)
 
 	stmt := fmt.Sprintf("ALTER TABLE %s DROP %s", tableName, columnName)
-	if _, err := db.c.Exec(stmt); err != nil {
+	if _, err := db.c.Exec(ctx, stmt); err != nil {
 		return fmt.Errorf("failed to alter table: %s", err)
 	}
+	forgetFullTextIndexes(tableName)
 	return nil
 }
 
-func (db *database) GetSchema(recordType string) (skydb.RecordSchema, error) {
-	remoteRecordSchema, err := db.remoteColumnTypes(recordType)
+func (db *database) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
+	remoteRecordSchema, err := db.remoteColumnTypes(ctx, recordType)
 	if err != nil {
 		return nil, err
 	}
 	return remoteRecordSchema, nil
 }
 
-func (db *database) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
+func (db *database) GetRecordSchemas(ctx context.Context) (map[string]skydb.RecordSchema, error) {
 	schemaName := db.schemaName()
 
-	rows, err := db.c.Queryx(`
+	rows, err := db.c.Queryx(ctx, `
 	SELECT table_name
 	FROM information_schema.tables
 	WHERE (table_name NOT LIKE '\_%') AND (table_schema=$1)
@@ -159,7 +174,7 @@ func (db *database) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
 		}
 
 		log.Debugf("%s\n", recordType)
-		schema, err := db.GetSchema(recordType)
+		schema, err := db.GetSchema(ctx, recordType)
 		if err != nil {
 			return nil, err
 		}
@@ -210,6 +225,7 @@ func dropTable(tx *sqlx.Tx, tableName string) error {
 	if _, err := tx.Exec(stmt); err != nil {
 		return err
 	}
+	forgetFullTextIndexes(tableName)
 
 	return nil
 }
@@ -231,7 +247,7 @@ CREATE TABLE %s (
 `, tableName)
 }
 
-func (db *database) getSequences(recordType string) ([]string, error) {
+func (db *database) getSequences(ctx context.Context, recordType string) ([]string, error) {
 	const queryString = `
 		SELECT c.relname
 		FROM pg_catalog.pg_class c
@@ -239,7 +255,7 @@ func (db *database) getSequences(recordType string) ([]string, error) {
 		WHERE c.relname LIKE $1 AND n.nspname = $2;
 	`
 
-	rows, err := db.c.Queryx(
+	rows, err := db.c.Queryx(ctx,
 		queryString,
 		fmt.Sprintf("%s\\_%%\\_seq", recordType),
 		db.schemaName(),
@@ -281,7 +297,7 @@ func (db *database) getSequences(recordType string) ([]string, error) {
 // WHERE constraint_type = 'FOREIGN KEY'
 // AND tc.table_schema = 'app__'
 // AND tc.table_name = 'note';
-func (db *database) remoteColumnTypes(recordType string) (skydb.RecordSchema, error) {
+func (db *database) remoteColumnTypes(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
 	typemap := skydb.RecordSchema{}
 	var err error
 	// STEP 0: Return the cached ColumnType
@@ -292,7 +308,7 @@ func (db *database) remoteColumnTypes(recordType string) (skydb.RecordSchema, er
 	log.Debugf("Querying remoteColumnTypes %s", recordType)
 	// STEP 1: Get the oid of the current table
 	var oid int
-	err = db.c.QueryRowx(`
+	err = db.c.QueryRowx(ctx, `
 SELECT c.oid
 FROM pg_catalog.pg_class c
      LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
@@ -315,7 +331,7 @@ WHERE c.relname = $1
 	}
 
 	// STEP 2: Get column name and data type
-	rows, err := db.c.Queryx(`
+	rows, err := db.c.Queryx(ctx, `
 SELECT a.attname,
   pg_catalog.format_type(a.atttypid, a.atttypmod)
 FROM pg_catalog.pg_attribute a
@@ -373,7 +389,7 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 
 	// STEP 2.1: Convert integer column to sequence column if applicable
 	if len(integerColumns) > 0 {
-		sequenceList, err := db.getSequences(recordType)
+		sequenceList, err := db.getSequences(ctx, recordType)
 		if err != nil {
 			return nil, err
 		}
@@ -394,13 +410,15 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 	}
 
 	// STEP 3: FOREIGN KEY, assumeing we can only reference _id i.e. "ccu.column_name" = _id
-	builder := psql.Select("kcu.column_name", "ccu.table_name").
+	builder := psql.Select("kcu.column_name", "ccu.table_name", "COALESCE(obj_description(pgc.oid, 'pg_constraint'), '')").
 		From("information_schema.table_constraints AS tc").
 		Join("information_schema.key_column_usage AS kcu ON tc.constraint_name = kcu.constraint_name").
 		Join("information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name").
+		Join("pg_namespace AS pgn ON pgn.nspname = tc.table_schema").
+		Join("pg_constraint AS pgc ON pgc.conname = tc.constraint_name AND pgc.connamespace = pgn.oid").
 		Where("constraint_type = 'FOREIGN KEY' AND tc.table_schema = ? AND tc.table_name = ?", db.schemaName(), recordType)
 
-	refs, err := db.c.QueryWith(builder)
+	refs, err := db.c.QueryWith(ctx, builder)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"schemaName": db.schemaName(),
@@ -413,8 +431,8 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 
 	for refs.Next() {
 		s := skydb.FieldType{}
-		var primaryColumn, referencedTable string
-		if err := refs.Scan(&primaryColumn, &referencedTable); err != nil {
+		var primaryColumn, referencedTable, comment string
+		if err := refs.Scan(&primaryColumn, &referencedTable, &comment); err != nil {
 			log.Debugf("err %v", err)
 			return nil, err
 		}
@@ -424,6 +442,7 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 		default:
 			s.Type = skydb.TypeReference
 			s.ReferenceType = referencedTable
+			s.OnDelete = referenceActionFromComment(comment)
 		}
 		typemap[primaryColumn] = s
 	}
@@ -434,6 +453,11 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 }
 
 func isConflict(from, to skydb.FieldType) bool {
+	if from.Type == skydb.TypeReference && to.Type == skydb.TypeReference {
+		// changing the reference action is not supported
+		return from.OnDelete != to.OnDelete
+	}
+
 	if from.Type == to.Type {
 		return false
 	}
@@ -475,14 +499,62 @@ func (db *database) addColumnStmt(recordType string, recordSchema skydb.RecordSc
 	return buf.String()
 }
 
+func foreignKeyConstraintName(localCol, referent, remoteCol string) string {
+	return fmt.Sprintf(`fk_%s_%s_%s`, localCol, referent, remoteCol)
+}
+
 func (db *database) writeForeignKeyConstraint(buf *bytes.Buffer, localCol, referent, remoteCol string) {
 	buf.Write([]byte(`ADD CONSTRAINT `))
-	buf.WriteString(pq.QuoteIdentifier(fmt.Sprintf(`fk_%s_%s_%s`, localCol, referent, remoteCol)))
+	buf.WriteString(pq.QuoteIdentifier(foreignKeyConstraintName(localCol, referent, remoteCol)))
 	buf.Write([]byte(` FOREIGN KEY (`))
 	buf.WriteString(pq.QuoteIdentifier(localCol))
 	buf.Write([]byte(`) REFERENCES `))
 	buf.WriteString(db.tableName(referent))
 	buf.Write([]byte(` (`))
 	buf.WriteString(pq.QuoteIdentifier(remoteCol))
-	buf.Write([]byte(`),`))
+	buf.Write([]byte(`)`))
+	buf.WriteByte(',')
+}
+
+// commentReferenceActionStmt returns the statement recording onDelete in
+// the comment of the foreign key constraint of a reference column. The
+// constraint itself always restricts deleting the referenced record, as
+// the action is taken by the server.
+func (db *database) commentReferenceActionStmt(recordType, column, referent string, onDelete skydb.ReferenceAction) string {
+	return fmt.Sprintf("COMMENT ON CONSTRAINT %s ON %s IS '%s'",
+		pq.QuoteIdentifier(foreignKeyConstraintName(column, referent, "_id")),
+		db.tableName(recordType),
+		onDelete)
+}
+
+// referenceActionFromComment returns the action recorded in the comment
+// of a foreign key constraint.
+func referenceActionFromComment(comment string) skydb.ReferenceAction {
+	switch action := skydb.ReferenceAction(comment); action {
+	case skydb.ReferenceCascade, skydb.ReferenceNullify:
+		return action
+	default:
+		return skydb.ReferenceRestrict
+	}
+}
+
+// CanModifySchema returns whether the role of the connection can create
+// tables in the app schema or create schemas in the database, or owns
+// any table of the app, which allows it to alter or drop the table.
+// Superusers pass all privilege checks.
+func (c *conn) CanModifySchema(ctx context.Context) (bool, error) {
+	var canModify bool
+	err := c.QueryRowx(ctx, `
+	SELECT
+		has_database_privilege(current_database(), 'CREATE')
+		OR (
+			EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)
+			AND has_schema_privilege($1, 'CREATE')
+		)
+		OR EXISTS (
+			SELECT 1 FROM pg_tables
+			WHERE schemaname = $1 AND pg_has_role(tableowner, 'USAGE')
+		)
+	`, c.schemaName()).Scan(&canModify)
+	return canModify, err
 }
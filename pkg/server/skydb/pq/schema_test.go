@@ -15,8 +15,10 @@
 package pq
 
 import (
+	"context"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -28,14 +30,14 @@ func TestExtend(t *testing.T) {
 		db := c.PublicDB().(*database)
 
 		Convey("return Resemble RecordSchema on second call", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			schema, _ := db.remoteColumnTypes("note")
-			schema2, _ := db.remoteColumnTypes("note")
+			schema, _ := db.remoteColumnTypes(context.Background(), "note")
+			schema2, _ := db.remoteColumnTypes(context.Background(), "note")
 			So(schema, ShouldResemble, schema2)
 		})
 
@@ -44,25 +46,25 @@ func TestExtend(t *testing.T) {
 				"cached": skydb.FieldType{Type: skydb.TypeString},
 			}
 			c.RecordSchema["note"] = cachedSchema
-			schema, _ := db.remoteColumnTypes("note")
+			schema, _ := db.remoteColumnTypes(context.Background(), "note")
 			So(schema, ShouldResemble, cachedSchema)
 		})
 
 		Convey("clean the cache of RecordSchema on extend recordType", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			schema, _ := db.remoteColumnTypes("note")
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			schema, _ := db.remoteColumnTypes(context.Background(), "note")
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"description": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			schema2, _ := db.remoteColumnTypes("note")
+			schema2, _ := db.remoteColumnTypes(context.Background(), "note")
 			So(schema, ShouldNotResemble, schema2)
 		})
 	})
@@ -74,7 +76,7 @@ func TestExtend(t *testing.T) {
 		db := c.PublicDB()
 
 		Convey("creates table if not exist", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -83,9 +85,9 @@ func TestExtend(t *testing.T) {
 			So(extended, ShouldBeTrue)
 
 			// verify with an insert
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -96,7 +98,7 @@ func TestExtend(t *testing.T) {
 
 		Convey("should not create table if schema locked", func() {
 			c.canMigrate = false
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldNotBeNil)
@@ -104,21 +106,21 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("REGRESSION #277: creates table with `:`", func() {
-			extended, err := db.Extend("table:name", nil)
+			extended, err := db.Extend(context.Background(), "table:name", nil)
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 		})
 
 		Convey("creates table with JSON field", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"tags": skydb.FieldType{Type: skydb.TypeJSON},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "tags") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "tags") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', '["tag0", "tag1"]')`)
 			So(err, ShouldBeNil)
 
@@ -128,7 +130,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates table with asset", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"image": skydb.FieldType{Type: skydb.TypeAsset},
 			})
 			So(err, ShouldBeNil)
@@ -136,13 +138,13 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates table with multiple assets", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"image0": skydb.FieldType{Type: skydb.TypeAsset},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"image1": skydb.FieldType{Type: skydb.TypeAsset},
 			})
 			So(err, ShouldBeNil)
@@ -150,13 +152,13 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates table with reference", func() {
-			extended, err := db.Extend("collection", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "collection", skydb.RecordSchema{
 				"name": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 				"collection": skydb.FieldType{
 					Type:          skydb.TypeReference,
@@ -167,14 +169,51 @@ func TestExtend(t *testing.T) {
 			So(extended, ShouldBeTrue)
 		})
 
+		Convey("creates table with reference with delete action", func() {
+			extended, err := db.Extend(context.Background(), "collection", skydb.RecordSchema{
+				"name": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeTrue)
+
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
+				"collection": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "collection",
+					OnDelete:      skydb.ReferenceCascade,
+				},
+				"category": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "collection",
+					OnDelete:      skydb.ReferenceNullify,
+				},
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeTrue)
+
+			schema, err := db.(*database).remoteColumnTypes(context.Background(), "note")
+			So(err, ShouldBeNil)
+			So(schema["collection"].OnDelete, ShouldEqual, skydb.ReferenceCascade)
+			So(schema["category"].OnDelete, ShouldEqual, skydb.ReferenceNullify)
+
+			_, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
+				"collection": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "collection",
+					OnDelete:      skydb.ReferenceNullify,
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
 		Convey("REGRESSION #318: creates table with `:` with reference", func() {
-			extended, err := db.Extend("colon:fever", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "colon:fever", skydb.RecordSchema{
 				"name": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 				"colon:fever": skydb.FieldType{
 					Type:          skydb.TypeReference,
@@ -186,7 +225,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates table with location", func() {
-			extended, err := db.Extend("photo", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "photo", skydb.RecordSchema{
 				"location": skydb.FieldType{Type: skydb.TypeLocation},
 			})
 			So(err, ShouldBeNil)
@@ -194,7 +233,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates table with sequence", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"order": skydb.FieldType{Type: skydb.TypeSequence},
 			})
 			So(err, ShouldBeNil)
@@ -202,13 +241,13 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("extend sequence twice", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"order": skydb.FieldType{Type: skydb.TypeSequence},
 			})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"order": skydb.FieldType{Type: skydb.TypeSequence},
 			})
 			So(err, ShouldBeNil)
@@ -217,7 +256,7 @@ func TestExtend(t *testing.T) {
 
 		Convey("cannot creates table with unknown type", func() {
 			So(func() {
-				db.Extend("note", skydb.RecordSchema{
+				db.Extend(context.Background(), "note", skydb.RecordSchema{
 					"order": skydb.FieldType{
 						Type:           skydb.TypeUnknown,
 						UnderlyingType: "money",
@@ -227,7 +266,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("error if creates table with reference not exist", func() {
-			_, err := db.Extend("note", skydb.RecordSchema{
+			_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 				"tag": skydb.FieldType{
 					Type:          skydb.TypeReference,
@@ -238,7 +277,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("adds new column if table already exist", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -246,7 +285,7 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
 				"dirty":     skydb.FieldType{Type: skydb.TypeBoolean},
 			})
@@ -254,9 +293,9 @@ func TestExtend(t *testing.T) {
 			So(extended, ShouldBeTrue)
 
 			// verify with an insert
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt", "dirty") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt", "dirty") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06', TRUE)`)
 			So(err, ShouldBeNil)
 
@@ -266,7 +305,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("errors if conflict with existing column type", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -274,7 +313,7 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			_, err = db.Extend("note", skydb.RecordSchema{
+			_, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
 				"dirty":     skydb.FieldType{Type: skydb.TypeNumber},
@@ -284,14 +323,14 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("creates empty table", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{})
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
 			// verify with an insert
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by) ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by) `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater')`)
 			So(err, ShouldBeNil)
 
@@ -301,19 +340,19 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("do not extend for empty schema table", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{})
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
 			c.canMigrate = false
 
-			extended, err = db.Extend("note", skydb.RecordSchema{})
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{})
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeFalse)
 		})
 
 		Convey("do not extend for table with superset columns", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -323,7 +362,7 @@ func TestExtend(t *testing.T) {
 
 			c.canMigrate = false
 
-			extended, err = db.Extend("note", skydb.RecordSchema{
+			extended, err = db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
@@ -338,7 +377,7 @@ func TestExtend(t *testing.T) {
 		db := c.PublicDB()
 
 		Convey("rename column normally", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -346,19 +385,19 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			err = db.RenameSchema("note", "content", "content2")
+			err = db.RenameSchema(context.Background(), "note", "content", "content2")
 			So(err, ShouldBeNil)
 
 			// verify with an insert
-			_, err = c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			_, err = c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldNotBeNil)
 
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content2", "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content2", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -368,7 +407,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("should not rename column if schema is locked", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
@@ -376,12 +415,12 @@ func TestExtend(t *testing.T) {
 
 			c.canMigrate = false
 
-			err = db.RenameSchema("note", "content", "content2")
+			err = db.RenameSchema(context.Background(), "note", "content", "content2")
 			So(err, ShouldNotBeNil)
 		})
 
 		Convey("rename column with reserved name", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"some":      skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -390,12 +429,12 @@ func TestExtend(t *testing.T) {
 			So(extended, ShouldBeTrue)
 
 			// "some" is reserved by psql
-			err = db.RenameSchema("note", "some", "content")
+			err = db.RenameSchema(context.Background(), "note", "some", "content")
 			So(err, ShouldBeNil)
 		})
 
 		Convey("rename unexisting column", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -403,13 +442,13 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			err = db.RenameSchema("note", "notExist", "content2")
+			err = db.RenameSchema(context.Background(), "note", "notExist", "content2")
 			So(err, ShouldNotBeNil)
 
 			// schema should remain unchanged
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -419,7 +458,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("rename to an existing column", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"content2":  skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
@@ -428,13 +467,13 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			err = db.RenameSchema("note", "content", "content2")
+			err = db.RenameSchema(context.Background(), "note", "content", "content2")
 			So(err, ShouldNotBeNil)
 
 			// schema should remain unchanged
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -444,7 +483,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("rename unexisting table", func() {
-			err := db.RenameSchema("notExist", "content", "content2")
+			err := db.RenameSchema(context.Background(), "notExist", "content", "content2")
 			So(err, ShouldNotBeNil)
 		})
 	})
@@ -456,7 +495,7 @@ func TestExtend(t *testing.T) {
 		db := c.PublicDB()
 
 		Convey("delete column normally", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -464,19 +503,19 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			err = db.DeleteSchema("note", "content")
+			err = db.DeleteSchema(context.Background(), "note", "content")
 			So(err, ShouldBeNil)
 
 			// verify with an insert
-			_, err = c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			_, err = c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldNotBeNil)
 
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -486,7 +525,7 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("should not delete column if schema is locked", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content": skydb.FieldType{Type: skydb.TypeString},
 			})
 			So(err, ShouldBeNil)
@@ -494,12 +533,12 @@ func TestExtend(t *testing.T) {
 
 			c.canMigrate = false
 
-			err = db.DeleteSchema("note", "content")
+			err = db.DeleteSchema(context.Background(), "note", "content")
 			So(err, ShouldNotBeNil)
 		})
 
 		Convey("delete column with reserved name", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"some":      skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -508,12 +547,12 @@ func TestExtend(t *testing.T) {
 			So(extended, ShouldBeTrue)
 
 			// "some" is reserved by psql
-			err = db.DeleteSchema("note", "some")
+			err = db.DeleteSchema(context.Background(), "note", "some")
 			So(err, ShouldBeNil)
 		})
 
 		Convey("delete unexisting column", func() {
-			extended, err := db.Extend("note", skydb.RecordSchema{
+			extended, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
 				"content":   skydb.FieldType{Type: skydb.TypeString},
 				"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
 				"createdAt": skydb.FieldType{Type: skydb.TypeDateTime},
@@ -521,13 +560,13 @@ func TestExtend(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(extended, ShouldBeTrue)
 
-			err = db.DeleteSchema("note", "notExist")
+			err = db.DeleteSchema(context.Background(), "note", "notExist")
 			So(err, ShouldNotBeNil)
 
 			// schema should remain unchanged
-			result, err := c.Exec(
-				`INSERT INTO "note" ` +
-					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") ` +
+			result, err := c.Exec(context.Background(),
+				`INSERT INTO "note" `+
+					`(_id, _database_id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "content", "noteOrder", "createdAt") `+
 					`VALUES (1, 1, 1, '1988-02-06', 'creator', '1988-02-06', 'updater', 'some content', 2, '1988-02-06')`)
 			So(err, ShouldBeNil)
 
@@ -537,8 +576,41 @@ func TestExtend(t *testing.T) {
 		})
 
 		Convey("delete unexisting table", func() {
-			err := db.DeleteSchema("notExist", "content")
+			err := db.DeleteSchema(context.Background(), "notExist", "content")
 			So(err, ShouldNotBeNil)
 		})
 	})
 }
+
+func TestCanModifySchema(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("can modify schema as owner of the app schema", func() {
+			canModify, err := c.CanModifySchema(context.Background())
+			So(err, ShouldBeNil)
+			So(canModify, ShouldBeTrue)
+		})
+
+		Convey("cannot modify schema as role with only DML privileges", func() {
+			So(c.Begin(context.Background()), ShouldBeNil)
+			defer c.Rollback()
+
+			schema := pq.QuoteIdentifier(c.schemaName())
+			for _, stmt := range []string{
+				"CREATE ROLE skygear_test_dml NOLOGIN",
+				"GRANT USAGE ON SCHEMA " + schema + " TO skygear_test_dml",
+				"GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA " + schema + " TO skygear_test_dml",
+				"SET LOCAL ROLE skygear_test_dml",
+			} {
+				_, err := c.Exec(context.Background(), stmt)
+				So(err, ShouldBeNil)
+			}
+
+			canModify, err := c.CanModifySchema(context.Background())
+			So(err, ShouldBeNil)
+			So(canModify, ShouldBeFalse)
+		})
+	})
+}
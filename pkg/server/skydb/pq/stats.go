@@ -0,0 +1,204 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (c *conn) LogRecordActivities(ctx context.Context, activities []skydb.RecordActivity) error {
+	if len(activities) == 0 {
+		return nil
+	}
+
+	builder := psql.Insert(c.tableName("_record_activity")).Columns(
+		"occurred_at",
+		"record_type",
+		"operation",
+		"user_id",
+	)
+	for _, activity := range activities {
+		var userID interface{}
+		if activity.UserID != "" {
+			userID = activity.UserID
+		}
+		builder = builder.Values(
+			activity.OccurredAt.UTC(),
+			activity.RecordType,
+			string(activity.Operation),
+			userID,
+		)
+	}
+
+	_, err := c.ExecWith(ctx, builder)
+	return err
+}
+
+func (c *conn) RollupRecordStats(ctx context.Context, before time.Time) error {
+	before = before.UTC()
+	day := time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Activities are aggregated and removed in a single statement so
+	// that no activity is counted twice. Stats of a day are usually
+	// inserted once. Should activities of a day be rolled up again, the
+	// counters are added while active users can only be estimated as
+	// the larger of the two.
+	stmt := fmt.Sprintf(`
+WITH rolled AS (
+	DELETE FROM %[1]s WHERE occurred_at < $1
+	RETURNING occurred_at, record_type, operation, user_id
+), aggregated AS (
+	SELECT
+		occurred_at::date AS date,
+		record_type,
+		SUM(CASE WHEN operation = 'create' THEN 1 ELSE 0 END) AS creates,
+		SUM(CASE WHEN operation = 'update' THEN 1 ELSE 0 END) AS updates,
+		SUM(CASE WHEN operation = 'delete' THEN 1 ELSE 0 END) AS deletes,
+		COUNT(DISTINCT user_id) AS active_users
+	FROM rolled
+	GROUP BY occurred_at::date, record_type
+), updated AS (
+	UPDATE %[2]s AS s SET
+		creates = s.creates + a.creates,
+		updates = s.updates + a.updates,
+		deletes = s.deletes + a.deletes,
+		active_users = GREATEST(s.active_users, a.active_users)
+	FROM aggregated AS a
+	WHERE s.date = a.date AND s.record_type = a.record_type
+	RETURNING s.date, s.record_type
+)
+INSERT INTO %[2]s (date, record_type, creates, updates, deletes, active_users)
+	SELECT a.date, a.record_type, a.creates, a.updates, a.deletes, a.active_users
+	FROM aggregated AS a
+	WHERE NOT EXISTS (
+		SELECT 1 FROM updated AS u
+		WHERE u.date = a.date AND u.record_type = a.record_type
+	);
+`, c.tableName("_record_activity"), c.tableName("_record_stats"))
+
+	_, err := c.Exec(ctx, stmt, day)
+	return err
+}
+
+func (c *conn) GetRecordStats(ctx context.Context, from time.Time, to time.Time, recordTypes []string) ([]skydb.RecordStats, error) {
+	builder := psql.Select("date", "record_type", "creates", "updates", "deletes", "active_users").
+		From(c.tableName("_record_stats")).
+		Where("date >= ?::date", from.UTC().Format("2006-01-02")).
+		Where("date <= ?::date", to.UTC().Format("2006-01-02")).
+		OrderBy("date", "record_type")
+	if len(recordTypes) > 0 {
+		builder = builder.Where(sq.Eq{"record_type": recordTypes})
+	}
+
+	rows, err := c.QueryWith(ctx, builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []skydb.RecordStats{}
+	for rows.Next() {
+		var stats skydb.RecordStats
+		if err := rows.Scan(
+			&stats.Date,
+			&stats.RecordType,
+			&stats.Creates,
+			&stats.Updates,
+			&stats.Deletes,
+			&stats.ActiveUsers,
+		); err != nil {
+			return nil, err
+		}
+		stats.Date = stats.Date.UTC()
+		results = append(results, stats)
+	}
+	return results, rows.Err()
+}
+
+func (c *conn) GetRecordStorage(ctx context.Context) ([]skydb.RecordStorage, error) {
+	recordTypes, err := c.recordTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(recordTypes)
+
+	db := c.PublicDB().(*database)
+	results := []skydb.RecordStorage{}
+	for _, recordType := range recordTypes {
+		storage := skydb.RecordStorage{RecordType: recordType}
+		tableName := c.tableName(recordType)
+
+		// pg_table_size includes TOAST and the free space map but not
+		// indexes, which are reported separately
+		if err := c.QueryRowx(ctx, fmt.Sprintf(
+			"SELECT COUNT(*), pg_table_size($1::regclass), pg_indexes_size($1::regclass) FROM %s",
+			tableName,
+		), tableName).Scan(
+			&storage.RowCount,
+			&storage.TableSize,
+			&storage.IndexSize,
+		); err != nil {
+			return nil, err
+		}
+
+		schema, err := db.remoteColumnTypes(ctx, recordType)
+		if err != nil {
+			return nil, err
+		}
+		if query := assetStorageQuery(c.tableName("_asset"), tableName, schema); query != "" {
+			if err := c.QueryRowx(ctx, query).Scan(&storage.AssetCount, &storage.AssetSize); err != nil {
+				return nil, err
+			}
+		}
+
+		results = append(results, storage)
+	}
+	return results, nil
+}
+
+// assetStorageQuery returns a query counting the number and the total
+// size of distinct assets referenced by the asset columns of the table.
+// It returns an empty string if the table has no asset columns.
+func assetStorageQuery(assetTable string, table string, schema skydb.RecordSchema) string {
+	columns := []string{}
+	for column, fieldType := range schema {
+		if fieldType.Type == skydb.TypeAsset {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return ""
+	}
+	sort.Strings(columns)
+
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		selects[i] = fmt.Sprintf("SELECT %s FROM %s", pq.QuoteIdentifier(column), table)
+	}
+	return fmt.Sprintf(
+		"SELECT COUNT(*), COALESCE(SUM(size), 0) FROM %s WHERE id IN (%s)",
+		assetTable,
+		strings.Join(selects, " UNION "),
+	)
+}
@@ -0,0 +1,188 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordStats(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		day1 := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		day2 := time.Date(2017, 3, 2, 10, 0, 0, 0, time.UTC)
+		day3 := time.Date(2017, 3, 3, 10, 0, 0, 0, time.UTC)
+
+		So(c.LogRecordActivities(context.Background(), []skydb.RecordActivity{
+			{RecordType: "note", Operation: skydb.RecordCreateOperation, UserID: "alice", OccurredAt: day1},
+			{RecordType: "note", Operation: skydb.RecordCreateOperation, UserID: "bob", OccurredAt: day1},
+			{RecordType: "note", Operation: skydb.RecordUpdateOperation, UserID: "alice", OccurredAt: day1},
+			{RecordType: "note", Operation: skydb.RecordDeleteOperation, UserID: "", OccurredAt: day1},
+			{RecordType: "category", Operation: skydb.RecordCreateOperation, UserID: "alice", OccurredAt: day1},
+			{RecordType: "note", Operation: skydb.RecordUpdateOperation, UserID: "bob", OccurredAt: day2},
+			{RecordType: "note", Operation: skydb.RecordCreateOperation, UserID: "carol", OccurredAt: day3},
+		}), ShouldBeNil)
+
+		Convey("rolls up activities of past days", func() {
+			So(c.RollupRecordStats(context.Background(), day3), ShouldBeNil)
+
+			stats, err := c.GetRecordStats(context.Background(), day1, day3, nil)
+			So(err, ShouldBeNil)
+			So(stats, ShouldResemble, []skydb.RecordStats{
+				{
+					Date:        time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+					RecordType:  "category",
+					Creates:     1,
+					ActiveUsers: 1,
+				},
+				{
+					Date:        time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+					RecordType:  "note",
+					Creates:     2,
+					Updates:     1,
+					Deletes:     1,
+					ActiveUsers: 2,
+				},
+				{
+					Date:        time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC),
+					RecordType:  "note",
+					Updates:     1,
+					ActiveUsers: 1,
+				},
+			})
+
+			var count int
+			So(c.Get(context.Background(), &count, fmt.Sprintf("SELECT COUNT(*) FROM %s", c.tableName("_record_activity"))), ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("adds to existing stats when rolled up again", func() {
+			So(c.RollupRecordStats(context.Background(), day3), ShouldBeNil)
+			So(c.LogRecordActivities(context.Background(), []skydb.RecordActivity{
+				{RecordType: "note", Operation: skydb.RecordCreateOperation, UserID: "alice", OccurredAt: day2},
+			}), ShouldBeNil)
+			So(c.RollupRecordStats(context.Background(), day3), ShouldBeNil)
+
+			stats, err := c.GetRecordStats(context.Background(), day2, day2, []string{"note"})
+			So(err, ShouldBeNil)
+			So(stats, ShouldResemble, []skydb.RecordStats{
+				{
+					Date:        time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC),
+					RecordType:  "note",
+					Creates:     1,
+					Updates:     1,
+					ActiveUsers: 1,
+				},
+			})
+		})
+
+		Convey("filters stats by record type", func() {
+			So(c.RollupRecordStats(context.Background(), day3), ShouldBeNil)
+
+			stats, err := c.GetRecordStats(context.Background(), day1, day3, []string{"category"})
+			So(err, ShouldBeNil)
+			So(stats, ShouldHaveLength, 1)
+			So(stats[0].RecordType, ShouldEqual, "category")
+		})
+	})
+}
+
+func TestRecordStorage(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		for _, asset := range []skydb.Asset{
+			{Name: "a.png", ContentType: "image/png", Size: 100},
+			{Name: "b.png", ContentType: "image/png", Size: 20},
+			{Name: "unused.png", ContentType: "image/png", Size: 3},
+		} {
+			asset := asset
+			So(c.SaveAsset(context.Background(), &asset), ShouldBeNil)
+		}
+
+		db := c.PublicDB()
+		_, err := db.Extend(context.Background(), "note", skydb.RecordSchema{
+			"image":     skydb.FieldType{Type: skydb.TypeAsset},
+			"thumbnail": skydb.FieldType{Type: skydb.TypeAsset},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend(context.Background(), "category", skydb.RecordSchema{
+			"name": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "alice",
+			Data: map[string]interface{}{
+				"image":     &skydb.Asset{Name: "a.png"},
+				"thumbnail": &skydb.Asset{Name: "b.png"},
+			},
+		}), ShouldBeNil)
+		So(db.Save(context.Background(), &skydb.Record{
+			ID:      skydb.NewRecordID("note", "note2"),
+			OwnerID: "alice",
+			Data: map[string]interface{}{
+				"image": &skydb.Asset{Name: "a.png"},
+			},
+		}), ShouldBeNil)
+
+		storages, err := c.GetRecordStorage(context.Background())
+		So(err, ShouldBeNil)
+
+		byType := map[string]skydb.RecordStorage{}
+		recordTypes := []string{}
+		for _, storage := range storages {
+			byType[storage.RecordType] = storage
+			recordTypes = append(recordTypes, storage.RecordType)
+		}
+
+		Convey("reports storage of each record type in order", func() {
+			So(recordTypes, ShouldContain, "note")
+			So(recordTypes, ShouldContain, "category")
+			So(sort.StringsAreSorted(recordTypes), ShouldBeTrue)
+		})
+
+		Convey("reports row count and table sizes", func() {
+			note := byType["note"]
+			So(note.RowCount, ShouldEqual, 2)
+			So(note.TableSize, ShouldBeGreaterThan, 0)
+			So(note.IndexSize, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("reports distinct assets referenced", func() {
+			note := byType["note"]
+			So(note.AssetCount, ShouldEqual, 2)
+			So(note.AssetSize, ShouldEqual, 120)
+		})
+
+		Convey("reports no assets for record type without asset columns", func() {
+			category := byType["category"]
+			So(category.RowCount, ShouldEqual, 0)
+			So(category.AssetCount, ShouldEqual, 0)
+			So(category.AssetSize, ShouldEqual, 0)
+		})
+	})
+}
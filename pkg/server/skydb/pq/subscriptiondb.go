@@ -15,12 +15,12 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -144,17 +144,18 @@ func (p *jsonPredicate) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (db *database) GetSubscription(key string, deviceID string, subscription *skydb.Subscription) error {
+func (db *database) GetSubscription(ctx context.Context, key string, deviceID string, subscription *skydb.Subscription) error {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		return errors.New("union database does not implement subscription")
 	}
 	nullinfo := nullNotificationInfo{}
 
-	builder := psql.Select("type", "notification_info", "query").
+	var lastNotifiedAt pq.NullTime
+	builder := psql.Select("type", "notification_info", "query", "last_notified_at").
 		From(db.tableName("_subscription")).
 		Where("user_id = ? AND device_id = ? AND id = ?", db.userID, deviceID, key)
-	err := db.c.QueryRowWith(builder).
-		Scan(&subscription.Type, &nullinfo, (*queryValue)(&subscription.Query))
+	err := db.c.QueryRowWith(ctx, builder).
+		Scan(&subscription.Type, &nullinfo, (*queryValue)(&subscription.Query), &lastNotifiedAt)
 
 	if err == sql.ErrNoRows {
 		return skydb.ErrSubscriptionNotFound
@@ -169,11 +170,16 @@ func (db *database) GetSubscription(key string, deviceID string, subscription *s
 	}
 	subscription.DeviceID = deviceID
 	subscription.ID = key
+	if lastNotifiedAt.Valid {
+		subscription.LastNotifiedAt = &lastNotifiedAt.Time
+	} else {
+		subscription.LastNotifiedAt = nil
+	}
 
 	return nil
 }
 
-func (db *database) SaveSubscription(subscription *skydb.Subscription) error {
+func (db *database) SaveSubscription(ctx context.Context, subscription *skydb.Subscription) error {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		return errors.New("union database does not implement subscription")
 	}
@@ -209,7 +215,7 @@ func (db *database) SaveSubscription(subscription *skydb.Subscription) error {
 
 	builder := upsertQuery(db.tableName("_subscription"), pkData, data)
 
-	_, err := db.c.ExecWith(builder)
+	_, err := db.c.ExecWith(ctx, builder)
 	if isDeviceNotFound(err) {
 		return skydb.ErrDeviceNotFound
 	}
@@ -217,11 +223,36 @@ func (db *database) SaveSubscription(subscription *skydb.Subscription) error {
 	return err
 }
 
-func (db *database) DeleteSubscription(key string, deviceID string) error {
+// RecordNotification sets the time the device of the subscription was last
+// notified.
+func (db *database) RecordNotification(ctx context.Context, subscription *skydb.Subscription, t time.Time) error {
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return errors.New("union database does not implement subscription")
+	}
+	builder := psql.Update(db.tableName("_subscription")).
+		Set("last_notified_at", t.UTC()).
+		Where("user_id = ? AND device_id = ? AND id = ?", db.userID, subscription.DeviceID, subscription.ID)
+
+	result, err := db.c.ExecWith(ctx, builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func (db *database) DeleteSubscription(ctx context.Context, key string, deviceID string) error {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		return errors.New("union database does not implement subscription")
 	}
-	result, err := db.c.ExecWith(
+	result, err := db.c.ExecWith(ctx,
 		psql.Delete(db.tableName("_subscription")).
 			Where("user_id = ? AND device_id = ? AND id = ?", db.userID, deviceID, key),
 	)
@@ -243,7 +274,7 @@ func (db *database) DeleteSubscription(key string, deviceID string) error {
 	return nil
 }
 
-func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions []skydb.Subscription) {
+func (db *database) GetSubscriptionsByDeviceID(ctx context.Context, deviceID string) (subscriptions []skydb.Subscription) {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		log.WithFields(logrus.Fields{
 			"user_id":  db.userID,
@@ -251,8 +282,8 @@ func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions [
 		}).Errorln("GetSubscriptionsByDeviceID on union database is not implemented")
 		return nil
 	}
-	rows, err := db.c.QueryWith(
-		psql.Select("id", "type", "notification_info", "query").
+	rows, err := db.c.QueryWith(ctx,
+		psql.Select("id", "type", "notification_info", "query", "last_notified_at").
 			From(db.tableName("_subscription")).
 			Where(`user_id = ? AND device_id = ?`, db.userID, deviceID),
 	)
@@ -271,7 +302,8 @@ func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions [
 	var s skydb.Subscription
 	for rows.Next() {
 		var nullinfo nullNotificationInfo
-		err := rows.Scan(&s.ID, &s.Type, &nullinfo, (*queryValue)(&s.Query))
+		var lastNotifiedAt pq.NullTime
+		err := rows.Scan(&s.ID, &s.Type, &nullinfo, (*queryValue)(&s.Query), &lastNotifiedAt)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"userID":   db.userID,
@@ -288,6 +320,11 @@ func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions [
 			s.NotificationInfo = nil
 		}
 		s.DeviceID = deviceID
+		if lastNotifiedAt.Valid {
+			s.LastNotifiedAt = &lastNotifiedAt.Time
+		} else {
+			s.LastNotifiedAt = nil
+		}
 
 		subscriptions = append(subscriptions, s)
 	}
@@ -306,7 +343,7 @@ func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions [
 	return subscriptions
 }
 
-func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscriptions []skydb.Subscription) {
+func (db *database) GetMatchingSubscriptions(ctx context.Context, record *skydb.Record) (subscriptions []skydb.Subscription) {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		log.WithFields(logrus.Fields{
 			"user_id": db.userID,
@@ -317,7 +354,7 @@ func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscription
 		From(db.tableName("_subscription")).
 		Where(`user_id = ? AND query @> ?::jsonb`, db.userID, fmt.Sprintf(`{"Type":"%s"}`, record.ID.Type))
 
-	rows, err := db.c.QueryWith(builder)
+	rows, err := db.c.QueryWith(ctx, builder)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"record": record,
@@ -346,10 +383,24 @@ func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscription
 		subscriptions = append(subscriptions, s)
 	}
 
+	// predicate variables are resolved for the owner of the subscriptions,
+	// whose roles are only fetched if a predicate has variables
+	var vars *skydb.PredicateVariables
+	resolve := func(predicate skydb.Predicate) skydb.Predicate {
+		if !predicate.HasVariables() {
+			return predicate
+		}
+		if vars == nil {
+			v := skydb.UserPredicateVariables(ctx, db.c, db.userID, time.Now().UTC())
+			vars = &v
+		}
+		return predicate.ResolveVariables(*vars)
+	}
+
 	// filter without allocation
 	matchingSubs := subscriptions[:0]
 	for _, subscription := range subscriptions {
-		if predMatchRecord(&(subscription.Query.Predicate), record) {
+		if resolve(subscription.Query.Predicate).MatchRecord(record) {
 			matchingSubs = append(matchingSubs, subscription)
 		}
 	}
@@ -366,86 +417,3 @@ func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscription
 
 	return matchingSubs
 }
-
-func predMatchRecord(p *skydb.Predicate, record *skydb.Record) (b bool) {
-	if p == nil || p.IsEmpty() {
-		return true
-	}
-
-	switch p.Operator {
-	case skydb.And:
-		b = true
-		for _, childPred := range p.GetSubPredicates() {
-			if !predMatchRecord(&childPred, record) {
-				b = false
-				break
-			}
-		}
-	case skydb.Or:
-		for _, childPred := range p.GetSubPredicates() {
-			if predMatchRecord(&childPred, record) {
-				b = true
-				break
-			}
-		}
-	case skydb.Not:
-		b = !predMatchRecord(&p.GetSubPredicates()[0], record)
-	case skydb.Equal:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
-		return reflect.DeepEqual(lv, rv)
-	// case skydb.GreaterThan:
-	// case skydb.LessThan:
-	// case skydb.GreaterThanOrEqual:
-	// case skydb.LessThanOrEqual:
-	case skydb.NotEqual:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
-		return !reflect.DeepEqual(lv, rv)
-	case skydb.In:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
-		haystack, ok := rv.([]interface{})
-		if !ok {
-			log.Panicf("unknown value in right hand side of `In` operand = %v", rv)
-		}
-
-		return deepEqualIn(lv, haystack)
-	// case skydb.Like:
-	// case skydb.ILike:
-	default:
-		log.Panicf("unknown Predicate.Operator = %v", p.Operator)
-	}
-
-	return
-}
-
-func extractBinaryOperands(exprs []skydb.Expression, record *skydb.Record) (lv interface{}, rv interface{}) {
-	lv = extractValue(exprs[0], record)
-	rv = extractValue(exprs[1], record)
-	return
-}
-
-func extractValue(expr skydb.Expression, record *skydb.Record) interface{} {
-	switch expr.Type {
-	case skydb.Literal:
-		switch expr.Value.(type) {
-		case bool, float64, string, time.Time, *skydb.Location, skydb.Reference, []interface{}:
-			return expr.Value
-		default:
-			panic(fmt.Sprintf("unknown type %[1]T of Expression.Value = %[1]v", expr.Value))
-		}
-	case skydb.KeyPath:
-		return record.Get(expr.Value.(string))
-	case skydb.Function:
-		panic("unsupported type of predicate expression = Function")
-	}
-
-	panic("unreachable code")
-}
-
-func deepEqualIn(needle interface{}, haystack []interface{}) bool {
-	for _, hay := range haystack {
-		if reflect.DeepEqual(needle, hay) {
-			return true
-		}
-	}
-	return false
-}
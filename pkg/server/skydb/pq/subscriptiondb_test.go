@@ -16,6 +16,7 @@ package pq
 
 import (
 	"bytes"
+	"context"
 	"math/rand"
 	"testing"
 	"time"
@@ -25,7 +26,7 @@ import (
 )
 
 func addDevice(t *testing.T, c *conn, userID string, deviceID string) {
-	_, err := c.Exec("INSERT INTO _device (id, user_id, type, token, last_registered_at) VALUES ($1, $2, '', $3, $4)", deviceID, userID, randHex(64), time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+	_, err := c.Exec(context.Background(), "INSERT INTO _device (id, user_id, type, token, last_registered_at) VALUES ($1, $2, '', $3, $4)", deviceID, userID, randHex(64), time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -93,22 +94,45 @@ func TestSubscriptionCRUD(t *testing.T) {
 		}
 
 		Convey("get an existing subscription", func() {
-			So(db.SaveSubscription(&subscription), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
 
 			resultSubscription := skydb.Subscription{}
-			err := db.GetSubscription("subscriptionid", "deviceid", &resultSubscription)
+			err := db.GetSubscription(context.Background(), "subscriptionid", "deviceid", &resultSubscription)
 			So(err, ShouldBeNil)
 			So(subscription, ShouldResemble, resultSubscription)
 		})
 
+		Convey("records notification of a subscription", func() {
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
+
+			notifiedAt := time.Date(2017, 3, 2, 9, 30, 0, 0, time.UTC)
+			recorder := db.(skydb.NotificationRecorder)
+			So(recorder.RecordNotification(context.Background(), &subscription, notifiedAt), ShouldBeNil)
+
+			// saving again does not reset the time
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
+
+			resultSubscription := skydb.Subscription{}
+			So(db.GetSubscription(context.Background(), "subscriptionid", "deviceid", &resultSubscription), ShouldBeNil)
+			So(resultSubscription.LastNotifiedAt, ShouldNotBeNil)
+			So(resultSubscription.LastNotifiedAt.Equal(notifiedAt), ShouldBeTrue)
+
+			subscriptions := db.GetSubscriptionsByDeviceID(context.Background(), "deviceid")
+			So(len(subscriptions), ShouldEqual, 1)
+			So(subscriptions[0].LastNotifiedAt.Equal(notifiedAt), ShouldBeTrue)
+
+			notExist := skydb.Subscription{ID: "notexistsubscriptionid", DeviceID: "deviceid"}
+			So(recorder.RecordNotification(context.Background(), &notExist, notifiedAt), ShouldEqual, skydb.ErrSubscriptionNotFound)
+		})
+
 		Convey("returns ErrSubscriptionNotFound while trying to get a non-existing subscription ", func() {
 			resultSubscription := skydb.Subscription{}
-			err := db.GetSubscription("notexistsubscriptionid", "deviceid", &resultSubscription)
+			err := db.GetSubscription(context.Background(), "notexistsubscriptionid", "deviceid", &resultSubscription)
 			So(err, ShouldEqual, skydb.ErrSubscriptionNotFound)
 		})
 
 		Convey("create new subscription", func() {
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err, ShouldBeNil)
 
 			var (
@@ -116,7 +140,7 @@ func TestSubscriptionCRUD(t *testing.T) {
 				resultNotificationInfo nullNotificationInfo
 				resultQuery            skydb.Query
 			)
-			err = c.QueryRowx(`
+			err = c.QueryRowx(context.Background(), `
 				SELECT device_id, type, notification_info, query FROM _subscription
 				WHERE id = $1 AND user_id = $2`, "subscriptionid", "userid").
 				Scan(&deviceID, &queryType, &resultNotificationInfo, (*queryValue)(&resultQuery))
@@ -129,10 +153,10 @@ func TestSubscriptionCRUD(t *testing.T) {
 		})
 
 		Convey("modify existing subscription", func() {
-			So(db.SaveSubscription(&subscription), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
 
 			subscription.Query.Type = "otherrecordtype"
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err, ShouldBeNil)
 
 			var (
@@ -140,7 +164,7 @@ func TestSubscriptionCRUD(t *testing.T) {
 				resultNotificationInfo nullNotificationInfo
 				resultQuery            skydb.Query
 			)
-			err = c.QueryRowx(`
+			err = c.QueryRowx(context.Background(), `
 				SELECT device_id, type, notification_info, query FROM _subscription
 				WHERE id = $1 AND user_id = $2`, "subscriptionid", "userid").
 				Scan(&deviceID, &queryType, &resultNotificationInfo, (*queryValue)(&resultQuery))
@@ -159,50 +183,50 @@ func TestSubscriptionCRUD(t *testing.T) {
 			addDevice(t, c, "userid", "device1")
 
 			subscription.DeviceID = "device0"
-			So(db.SaveSubscription(&subscription), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
 
 			subscription.DeviceID = "device1"
-			So(db.SaveSubscription(&subscription), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
 		})
 
 		Convey("cannot save subscription with empty id", func() {
 			subscription.ID = ""
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err.Error(), ShouldEqual, "empty id")
 		})
 
 		Convey("cannot save subscription with empty type", func() {
 			subscription.Type = ""
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err.Error(), ShouldEqual, "empty type")
 		})
 
 		Convey("cannot save subscription with empty query type", func() {
 			subscription.Query.Type = ""
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err.Error(), ShouldEqual, "empty query type")
 		})
 
 		Convey("cannot save subscription with empty device id", func() {
 			subscription.DeviceID = ""
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err.Error(), ShouldEqual, "empty device id")
 		})
 
 		Convey("returns ErrDeviceNotFound if a subscription with non-exist device is saved", func() {
 			subscription.DeviceID = "notexistdeviceid"
-			err := db.SaveSubscription(&subscription)
+			err := db.SaveSubscription(context.Background(), &subscription)
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
 		Convey("delets an existing subscription", func() {
-			So(db.SaveSubscription(&subscription), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subscription), ShouldBeNil)
 
-			err := db.DeleteSubscription("subscriptionid", "deviceid")
+			err := db.DeleteSubscription(context.Background(), "subscriptionid", "deviceid")
 			So(err, ShouldBeNil)
 
 			var count int
-			err = c.QueryRowx(
+			err = c.QueryRowx(context.Background(),
 				`SELECT COUNT(*) FROM _subscription
 				WHERE id = $1 AND user_id = $2`,
 				"subscriptionid", "userid").
@@ -212,7 +236,7 @@ func TestSubscriptionCRUD(t *testing.T) {
 		})
 
 		Convey("returns ErrSubscriptionNotFound while deleting a non-exist subscription", func() {
-			err := db.DeleteSubscription("notexistsubscriptionid", "deviceid")
+			err := db.DeleteSubscription(context.Background(), "notexistsubscriptionid", "deviceid")
 			So(err, ShouldEqual, skydb.ErrSubscriptionNotFound)
 		})
 	})
@@ -235,20 +259,20 @@ func TestMatchingSubscriptions(t *testing.T) {
 		sub10 := subscriptionForTest("device1", "10", "type0")
 		sub11 := subscriptionForTest("device1", "11", "type1")
 
-		So(db.SaveSubscription(&sub00), ShouldBeNil)
-		So(db.SaveSubscription(&sub01), ShouldBeNil)
-		So(db.SaveSubscription(&sub10), ShouldBeNil)
-		So(db.SaveSubscription(&sub11), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub00), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub01), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub10), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub11), ShouldBeNil)
 
 		Convey("fetch matching subscription for a record", func() {
 			record := skydb.Record{ID: skydb.NewRecordID("type0", "recordid")}
-			subscriptions := db.GetMatchingSubscriptions(&record)
+			subscriptions := db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{sub00, sub01, sub10})
 		})
 
 		Convey("fetch no subscription for a not matching record", func() {
 			record := skydb.Record{ID: skydb.NewRecordID("notexisttype", "recordid")}
-			subscriptions := db.GetMatchingSubscriptions(&record)
+			subscriptions := db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldBeEmpty)
 		})
 
@@ -268,9 +292,9 @@ func TestMatchingSubscriptions(t *testing.T) {
 					},
 				},
 			}
-			So(db.SaveSubscription(&subeq), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subeq), ShouldBeNil)
 
-			subscriptions := db.GetMatchingSubscriptions(&record)
+			subscriptions := db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subeq})
 		})
 
@@ -301,7 +325,7 @@ func TestMatchingSubscriptions(t *testing.T) {
 					binaryPred(skydb.Equal, "truthy", true),
 				},
 			}
-			So(db.SaveSubscription(&suband), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &suband), ShouldBeNil)
 
 			subor := subscriptionForTest("device0", "or", "record")
 			subor.Query.Predicate = skydb.Predicate{
@@ -311,7 +335,7 @@ func TestMatchingSubscriptions(t *testing.T) {
 					binaryPred(skydb.Equal, "falsy", false),
 				},
 			}
-			So(db.SaveSubscription(&subor), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subor), ShouldBeNil)
 
 			subnot := subscriptionForTest("device0", "not", "record")
 			subnot.Query.Predicate = skydb.Predicate{
@@ -320,36 +344,66 @@ func TestMatchingSubscriptions(t *testing.T) {
 					binaryPred(skydb.Equal, "truthy", false),
 				},
 			}
-			So(db.SaveSubscription(&subnot), ShouldBeNil)
+			So(db.SaveSubscription(context.Background(), &subnot), ShouldBeNil)
 
 			record.Data = map[string]interface{}{
 				"truthy": true,
 				"falsy":  false,
 			}
-			subscriptions := db.GetMatchingSubscriptions(&record)
+			subscriptions := db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{suband, subor, subnot})
 
 			record.Data = map[string]interface{}{
 				"truthy": false,
 				"falsy":  true,
 			}
-			subscriptions = db.GetMatchingSubscriptions(&record)
+			subscriptions = db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subor})
 
 			record.Data = map[string]interface{}{
 				"truthy": true,
 				"falsy":  true,
 			}
-			subscriptions = db.GetMatchingSubscriptions(&record)
+			subscriptions = db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subnot})
 
 			record.Data = map[string]interface{}{
 				"truthy": false,
 				"falsy":  false,
 			}
-			subscriptions = db.GetMatchingSubscriptions(&record)
+			subscriptions = db.GetMatchingSubscriptions(context.Background(), &record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subor})
 		})
+
+		Convey("match subscription with predicate variable of the subscriber", func() {
+			privateDB := c.PrivateDB("userid")
+			subvar := subscriptionForTest("device0", "var", "record")
+			subvar.Query.Predicate = skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{
+						Type:  skydb.KeyPath,
+						Value: "_owner_id",
+					},
+					skydb.Expression{
+						Type:  skydb.Variable,
+						Value: skydb.CurrentUserIDVariable,
+					},
+				},
+			}
+			So(privateDB.SaveSubscription(context.Background(), &subvar), ShouldBeNil)
+
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("record", "id"),
+				OwnerID: "userid",
+			}
+			subscriptions := privateDB.GetMatchingSubscriptions(context.Background(), &record)
+			So(subscriptions, ShouldResemble, []skydb.Subscription{subvar})
+
+			record.OwnerID = "otheruserid"
+			subscriptions = privateDB.GetMatchingSubscriptions(context.Background(), &record)
+			So(subscriptions, ShouldBeEmpty)
+		})
 	})
 }
 
@@ -370,12 +424,12 @@ func TestGetSubscriptionsByDeviceID(t *testing.T) {
 		sub01 := subscriptionForTest("device0", "01", "type1")
 		sub10 := subscriptionForTest("device1", "10", "type0")
 
-		So(db.SaveSubscription(&sub00), ShouldBeNil)
-		So(db.SaveSubscription(&sub01), ShouldBeNil)
-		So(db.SaveSubscription(&sub10), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub00), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub01), ShouldBeNil)
+		So(db.SaveSubscription(context.Background(), &sub10), ShouldBeNil)
 
 		Convey("fetches subscriptions by device_id", func() {
-			subscriptions := db.GetSubscriptionsByDeviceID("device0")
+			subscriptions := db.GetSubscriptionsByDeviceID(context.Background(), "device0")
 			So(subscriptions, ShouldResemble, []skydb.Subscription{
 				sub00,
 				sub01,
@@ -383,12 +437,12 @@ func TestGetSubscriptionsByDeviceID(t *testing.T) {
 		})
 
 		Convey("fetches no subscriptions by device_id", func() {
-			subscriptions := db.GetSubscriptionsByDeviceID("device2")
+			subscriptions := db.GetSubscriptionsByDeviceID(context.Background(), "device2")
 			So(subscriptions, ShouldBeEmpty)
 		})
 
 		Convey("fetches no subscriptions by non-exist device_id", func() {
-			subscriptions := db.GetSubscriptionsByDeviceID("notexistdeviceid")
+			subscriptions := db.GetSubscriptionsByDeviceID(context.Background(), "notexistdeviceid")
 			So(subscriptions, ShouldBeEmpty)
 		})
 	})
@@ -404,48 +458,3 @@ func subscriptionForTest(deviceID, id, queryRecordType string) skydb.Subscriptio
 		},
 	}
 }
-
-func TestPredicateMatchRecord(t *testing.T) {
-	Convey("Records", t, func() {
-		record1 := skydb.Record{ID: skydb.NewRecordID("record", "id")}
-		record1.Data = map[string]interface{}{
-			"category": "recipe",
-		}
-		Convey("Match record with predicate in", func() {
-
-			predicate := skydb.Predicate{
-				Operator: skydb.In,
-				Children: []interface{}{
-					skydb.Expression{
-						Type:  skydb.KeyPath,
-						Value: "category",
-					},
-					skydb.Expression{
-						Type:  skydb.Literal,
-						Value: []interface{}{"recipe", "fiction"},
-					},
-				},
-			}
-
-			So(predMatchRecord(&predicate, &record1), ShouldBeTrue)
-		})
-
-		Convey("Not match record with predicate in", func() {
-			predicate := skydb.Predicate{
-				Operator: skydb.In,
-				Children: []interface{}{
-					skydb.Expression{
-						Type:  skydb.KeyPath,
-						Value: "category",
-					},
-					skydb.Expression{
-						Type:  skydb.Literal,
-						Value: []interface{}{"utility", "fiction"},
-					},
-				},
-			}
-
-			So(predMatchRecord(&predicate, &record1), ShouldBeFalse)
-		})
-	})
-}
@@ -15,11 +15,13 @@
 package pq
 
 import (
+	"context"
+
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
-func (db *database) Begin() (err error) {
-	return db.c.Begin()
+func (db *database) Begin(ctx context.Context) (err error) {
+	return db.c.Begin(ctx)
 }
 
 func (db *database) Commit() (err error) {
@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
@@ -29,7 +30,7 @@ func TestTxDB(t *testing.T) {
 
 		dbx := c.Db()
 		db := c.PublicDB().(*database)
-		_, err := db.Extend("record", skydb.RecordSchema{
+		_, err := db.Extend(context.Background(), "record", skydb.RecordSchema{
 			"content": skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
@@ -45,25 +46,25 @@ func TestTxDB(t *testing.T) {
 			`VALUES ('', '3', '', '0001-01-01 00:00:00', '', '0001-01-01 00:00:00', '', 'original3')`)
 
 		Convey("with modification after Begin", func() {
-			err := db.Begin()
+			err := db.Begin(context.Background())
 			So(err, ShouldBeNil)
 
 			// create
-			So(db.Save(&skydb.Record{
+			So(db.Save(context.Background(), &skydb.Record{
 				ID:      skydb.NewRecordID("record", "0"),
 				Data:    map[string]interface{}{"content": "new0"},
 				OwnerID: "ownerID",
 			}), ShouldBeNil)
 
 			// update
-			So(db.Save(&skydb.Record{
+			So(db.Save(context.Background(), &skydb.Record{
 				ID:      skydb.NewRecordID("record", "1"),
 				Data:    map[string]interface{}{"content": "new1"},
 				OwnerID: "ownerID",
 			}), ShouldBeNil)
 
 			// delete
-			So(db.Delete(skydb.NewRecordID("record", "2")), ShouldBeNil)
+			So(db.Delete(context.Background(), skydb.NewRecordID("record", "2")), ShouldBeNil)
 
 			Convey("Commit saves all the changes", func() {
 				err = db.Commit()
@@ -107,8 +108,8 @@ func TestTxDB(t *testing.T) {
 		})
 
 		Convey("Begin on a Begin'ed db returns ErrDatabaseTxDidBegin", func() {
-			So(db.Begin(), ShouldBeNil)
-			err := db.Begin()
+			So(db.Begin(context.Background()), ShouldBeNil)
+			err := db.Begin(context.Background())
 			So(err, ShouldEqual, skydb.ErrDatabaseTxDidBegin)
 		})
 
@@ -118,17 +119,17 @@ func TestTxDB(t *testing.T) {
 		})
 
 		Convey("New transaction can begin after commit", func() {
-			So(db.Begin(), ShouldBeNil)
+			So(db.Begin(context.Background()), ShouldBeNil)
 			So(db.Commit(), ShouldBeNil)
 
-			So(db.Begin(), ShouldEqual, nil)
+			So(db.Begin(context.Background()), ShouldEqual, nil)
 		})
 
 		Convey("New transaction can begin after rollback", func() {
-			So(db.Begin(), ShouldBeNil)
+			So(db.Begin(context.Background()), ShouldBeNil)
 			So(db.Rollback(), ShouldBeNil)
 
-			So(db.Begin(), ShouldEqual, nil)
+			So(db.Begin(context.Background()), ShouldEqual, nil)
 		})
 	})
 }
@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -25,7 +26,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
-func (c *conn) CreateUser(userinfo *skydb.UserInfo) (err error) {
+func (c *conn) CreateUser(ctx context.Context, userinfo *skydb.UserInfo) (err error) {
 	var (
 		username        *string
 		email           *string
@@ -65,6 +66,7 @@ func (c *conn) CreateUser(userinfo *skydb.UserInfo) (err error) {
 		"token_valid_since",
 		"last_login_at",
 		"last_seen_at",
+		"last_login_location",
 	).Values(
 		userinfo.ID,
 		username,
@@ -74,20 +76,21 @@ func (c *conn) CreateUser(userinfo *skydb.UserInfo) (err error) {
 		tokenValidSince,
 		lastLoginAt,
 		lastSeenAt,
+		loginLocationValue{userinfo.LastLoginLocation},
 	)
 
-	_, err = c.ExecWith(builder)
+	_, err = c.ExecWith(ctx, builder)
 	if isUniqueViolated(err) {
 		return skydb.ErrUserDuplicated
 	}
 
-	if err := c.UpdateUserRoles(userinfo); err != nil {
+	if err := c.UpdateUserRoles(ctx, userinfo); err != nil {
 		return skydb.ErrRoleUpdatesFailed
 	}
 	return err
 }
 
-func (c *conn) UpdateUser(userinfo *skydb.UserInfo) (err error) {
+func (c *conn) UpdateUser(ctx context.Context, userinfo *skydb.UserInfo) (err error) {
 	var (
 		username        *string
 		email           *string
@@ -126,9 +129,10 @@ func (c *conn) UpdateUser(userinfo *skydb.UserInfo) (err error) {
 		Set("token_valid_since", tokenValidSince).
 		Set("last_login_at", lastLoginAt).
 		Set("last_seen_at", lastSeenAt).
+		Set("last_login_location", loginLocationValue{userinfo.LastLoginLocation}).
 		Where("id = ?", userinfo.ID)
 
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 	if err != nil {
 		if isUniqueViolated(err) {
 			return skydb.ErrUserDuplicated
@@ -145,7 +149,7 @@ func (c *conn) UpdateUser(userinfo *skydb.UserInfo) (err error) {
 		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
 	}
 
-	if err := c.UpdateUserRoles(userinfo); err != nil {
+	if err := c.UpdateUserRoles(ctx, userinfo); err != nil {
 		return skydb.ErrRoleUpdatesFailed
 	}
 	return nil
@@ -153,7 +157,7 @@ func (c *conn) UpdateUser(userinfo *skydb.UserInfo) (err error) {
 
 func (c *conn) baseUserBuilder() sq.SelectBuilder {
 	return psql.Select("id", "username", "email", "password", "auth",
-		"token_valid_since", "last_login_at", "last_seen_at",
+		"token_valid_since", "last_login_at", "last_seen_at", "last_login_location",
 		"array_to_json(array_agg(role_id)) AS roles").
 		From(c.tableName("_user")).
 		LeftJoin(c.tableName("_user_role") + " ON id = user_id").
@@ -168,6 +172,7 @@ func (c *conn) doScanUser(userinfo *skydb.UserInfo, scanner sq.RowScanner) error
 		tokenValidSince pq.NullTime
 		lastLoginAt     pq.NullTime
 		lastSeenAt      pq.NullTime
+		lastLoginLoc    loginLocationValue
 		roles           nullJSONStringSlice
 	)
 	password, auth := []byte{}, authInfoValue{}
@@ -181,6 +186,7 @@ func (c *conn) doScanUser(userinfo *skydb.UserInfo, scanner sq.RowScanner) error
 		&tokenValidSince,
 		&lastLoginAt,
 		&lastSeenAt,
+		&lastLoginLoc,
 		&roles,
 	)
 	if err != nil {
@@ -210,19 +216,20 @@ func (c *conn) doScanUser(userinfo *skydb.UserInfo, scanner sq.RowScanner) error
 	} else {
 		userinfo.LastSeenAt = nil
 	}
+	userinfo.LastLoginLocation = lastLoginLoc.LoginLocation
 	userinfo.Roles = roles.slice
 
 	return err
 }
 
-func (c *conn) GetUser(id string, userinfo *skydb.UserInfo) error {
+func (c *conn) GetUser(ctx context.Context, id string, userinfo *skydb.UserInfo) error {
 	log.Warnf(id)
 	builder := c.baseUserBuilder().Where("id = ?", id)
-	scanner := c.QueryRowWith(builder)
+	scanner := c.QueryRowWith(ctx, builder)
 	return c.doScanUser(userinfo, scanner)
 }
 
-func (c *conn) GetUserByUsernameEmail(username string, email string, userinfo *skydb.UserInfo) error {
+func (c *conn) GetUserByUsernameEmail(ctx context.Context, username string, email string, userinfo *skydb.UserInfo) error {
 	var builder sq.SelectBuilder
 	if email == "" {
 		builder = c.baseUserBuilder().Where("username = ?", username)
@@ -231,17 +238,17 @@ func (c *conn) GetUserByUsernameEmail(username string, email string, userinfo *s
 	} else {
 		builder = c.baseUserBuilder().Where("username = ? AND email = ?", username, email)
 	}
-	scanner := c.QueryRowWith(builder)
+	scanner := c.QueryRowWith(ctx, builder)
 	return c.doScanUser(userinfo, scanner)
 }
 
-func (c *conn) GetUserByPrincipalID(principalID string, userinfo *skydb.UserInfo) error {
+func (c *conn) GetUserByPrincipalID(ctx context.Context, principalID string, userinfo *skydb.UserInfo) error {
 	builder := c.baseUserBuilder().Where("jsonb_exists(auth, ?)", principalID)
-	scanner := c.QueryRowWith(builder)
+	scanner := c.QueryRowWith(ctx, builder)
 	return c.doScanUser(userinfo, scanner)
 }
 
-func (c *conn) QueryUser(emails []string, usernames []string) ([]skydb.UserInfo, error) {
+func (c *conn) QueryUser(ctx context.Context, emails []string, usernames []string) ([]skydb.UserInfo, error) {
 	emailargs := make([]interface{}, len(emails))
 	for i, v := range emails {
 		if v == "" {
@@ -276,7 +283,7 @@ func (c *conn) QueryUser(emails []string, usernames []string) ([]skydb.UserInfo,
 	builder := c.baseUserBuilder().
 		Where(strings.Join(sqls, " OR "), args...)
 
-	rows, err := c.QueryWith(builder)
+	rows, err := c.QueryWith(ctx, builder)
 	if err != nil {
 		panic(err)
 	}
@@ -296,11 +303,11 @@ func (c *conn) QueryUser(emails []string, usernames []string) ([]skydb.UserInfo,
 	return results, nil
 }
 
-func (c *conn) DeleteUser(id string) error {
+func (c *conn) DeleteUser(ctx context.Context, id string) error {
 	builder := psql.Delete(c.tableName("_user")).
 		Where("id = ?", id)
 
-	result, err := c.ExecWith(builder)
+	result, err := c.ExecWith(ctx, builder)
 	if err != nil {
 		return err
 	}
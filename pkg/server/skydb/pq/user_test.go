@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 	"time"
@@ -48,7 +49,7 @@ func TestUserCRUD(t *testing.T) {
 
 		Convey("default admin role", func() {
 			var exists bool
-			c.QueryRowx(`
+			c.QueryRowx(context.Background(), `
 				SELECT EXISTS (
 					SELECT 1
 					FROM _role
@@ -61,7 +62,7 @@ func TestUserCRUD(t *testing.T) {
 			var username string
 			var actualHashedPassword string
 
-			c.QueryRowx(`
+			c.QueryRowx(context.Background(), `
 				SELECT u.username, u.password
 				FROM _user as u
 					JOIN _user_role as ur ON ur.user_id = u.id
@@ -80,13 +81,13 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("creates user", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			email := ""
 			password := []byte{}
 			auth := authInfoValue{}
-			err = c.QueryRowx("SELECT email, password, auth FROM _user WHERE id = 'userid'").
+			err = c.QueryRowx(context.Background(), "SELECT email, password, auth FROM _user WHERE id = 'userid'").
 				Scan(&email, &password, &auth)
 			So(err, ShouldBeNil)
 
@@ -102,18 +103,18 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("returns ErrUserDuplicated when user to create already exists", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
-			err = c.CreateUser(&userinfo)
+			err = c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldEqual, skydb.ErrUserDuplicated)
 		})
 
 		Convey("returns ErrUserDuplicated when user with same username", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
-			err = c.CreateUser(&skydb.UserInfo{
+			err = c.CreateUser(context.Background(), &skydb.UserInfo{
 				Username:       "john.doe",
 				HashedPassword: []byte("$2a$10$RbmNb3Rw.PONA2QTcpjBg.1E00zdSI6dWTUwZi.XC0wZm9OhOEvKO"),
 			})
@@ -121,10 +122,10 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("returns ErrUserDuplicated when user with same email", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
-			err = c.CreateUser(&skydb.UserInfo{
+			err = c.CreateUser(context.Background(), &skydb.UserInfo{
 				Email:          "john.doe@example.com",
 				HashedPassword: []byte("$2a$10$RbmNb3Rw.PONA2QTcpjBg.1E00zdSI6dWTUwZi.XC0wZm9OhOEvKO"),
 			})
@@ -132,11 +133,11 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("gets an existing User", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUser("userid", &fetcheduserinfo)
+			err = c.GetUser(context.Background(), "userid", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(fetcheduserinfo, ShouldResemble, userinfo)
@@ -147,10 +148,10 @@ func TestUserCRUD(t *testing.T) {
 			userinfo.Username = "Capital.ONE"
 			userinfo.Email = "capital.ONE@EXAMPLE.com"
 			userinfo.ID = "userid-capital"
-			So(c.CreateUser(&userinfo), ShouldBeNil)
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err := c.GetUser("userid-capital", &fetcheduserinfo)
+			err := c.GetUser(context.Background(), "userid-capital", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(fetcheduserinfo.Username, ShouldEqual, "Capital.ONE")
@@ -161,11 +162,11 @@ func TestUserCRUD(t *testing.T) {
 			tokenValidSince := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
 			userinfo.TokenValidSince = &tokenValidSince
 
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUser("userid", &fetcheduserinfo)
+			err = c.GetUser(context.Background(), "userid", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(tokenValidSince.Equal(fetcheduserinfo.TokenValidSince.UTC()), ShouldBeTrue)
@@ -175,25 +176,42 @@ func TestUserCRUD(t *testing.T) {
 			lastLoginAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
 			userinfo.LastLoginAt = &lastLoginAt
 
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUser("userid", &fetcheduserinfo)
+			err = c.GetUser(context.Background(), "userid", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(lastLoginAt.Equal(fetcheduserinfo.LastLoginAt.UTC()), ShouldBeTrue)
 		})
 
+		Convey("gets an existing User last login location", func() {
+			userinfo.LastLoginLocation = &skydb.LoginLocation{
+				IP:          "203.0.113.1",
+				CountryCode: "HK",
+				Country:     "Hong Kong",
+			}
+
+			err := c.CreateUser(context.Background(), &userinfo)
+			So(err, ShouldBeNil)
+
+			fetcheduserinfo := skydb.UserInfo{}
+			err = c.GetUser(context.Background(), "userid", &fetcheduserinfo)
+			So(err, ShouldBeNil)
+
+			So(fetcheduserinfo.LastLoginLocation, ShouldResemble, userinfo.LastLoginLocation)
+		})
+
 		Convey("gets an existing User last seen at", func() {
 			lastSeenAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
 			userinfo.LastSeenAt = &lastSeenAt
 
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUser("userid", &fetcheduserinfo)
+			err = c.GetUser(context.Background(), "userid", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(
@@ -203,59 +221,59 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("gets an existing User by username case insensitive", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUserByUsernameEmail("john.Doe", "", &fetcheduserinfo)
+			err = c.GetUserByUsernameEmail(context.Background(), "john.Doe", "", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(fetcheduserinfo, ShouldResemble, userinfo)
 		})
 
 		Convey("gets an existing User by email case insensitive", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUserByUsernameEmail("", "john.DOE@example.com", &fetcheduserinfo)
+			err = c.GetUserByUsernameEmail(context.Background(), "", "john.DOE@example.com", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(fetcheduserinfo, ShouldResemble, userinfo)
 		})
 
 		Convey("gets an existing User by principal", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			fetcheduserinfo := skydb.UserInfo{}
-			err = c.GetUserByPrincipalID("com.example:johndoe", &fetcheduserinfo)
+			err = c.GetUserByPrincipalID(context.Background(), "com.example:johndoe", &fetcheduserinfo)
 			So(err, ShouldBeNil)
 
 			So(fetcheduserinfo, ShouldResemble, userinfo)
 		})
 
 		Convey("returns ErrUserNotFound when the user does not exist", func() {
-			err := c.GetUser("userid", (*skydb.UserInfo)(nil))
+			err := c.GetUser(context.Background(), "userid", (*skydb.UserInfo)(nil))
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("returns ErrUserNotFound when the user does not exist by principal", func() {
-			err := c.GetUserByPrincipalID("com.example:janedoe", (*skydb.UserInfo)(nil))
+			err := c.GetUserByPrincipalID(context.Background(), "com.example:janedoe", (*skydb.UserInfo)(nil))
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("updates a user", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			userinfo.Email = "jane.doe@example.com"
 
-			err = c.UpdateUser(&userinfo)
+			err = c.UpdateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			email := ""
-			err = c.QueryRowx("SELECT email FROM _user WHERE id = 'userid'").
+			err = c.QueryRowx(context.Background(), "SELECT email FROM _user WHERE id = 'userid'").
 				Scan(&email)
 			So(err, ShouldBeNil)
 			So(email, ShouldEqual, "jane.doe@example.com")
@@ -263,26 +281,26 @@ func TestUserCRUD(t *testing.T) {
 
 		Convey("query for empty", func() {
 			userinfo.Email = ""
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			emails := []string{""}
-			results, err := c.QueryUser(emails, []string{})
+			results, err := c.QueryUser(context.Background(), emails, []string{})
 			So(err, ShouldBeNil)
 			So(len(results), ShouldEqual, 0)
 		})
 
 		Convey("query for users with email", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			userinfo.Username = "jane.doe"
 			userinfo.Email = "jane.doe@example.com"
 			userinfo.ID = "userid2"
-			So(c.CreateUser(&userinfo), ShouldBeNil)
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
 
 			emails := []string{"john.doe@example.com", "jane.doe@example.com"}
-			results, err := c.QueryUser(emails, []string{})
+			results, err := c.QueryUser(context.Background(), emails, []string{})
 			So(err, ShouldBeNil)
 
 			userids := []string{}
@@ -294,17 +312,17 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("query for users with email and username", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			userinfo.Username = "jane.doe"
 			userinfo.Email = "jane.doe@example.com"
 			userinfo.ID = "userid2"
-			So(c.CreateUser(&userinfo), ShouldBeNil)
+			So(c.CreateUser(context.Background(), &userinfo), ShouldBeNil)
 
 			emails := []string{"john.doe@example.com"}
 			usernames := []string{"jane.doe"}
-			results, err := c.QueryUser(emails, usernames)
+			results, err := c.QueryUser(context.Background(), emails, usernames)
 			So(err, ShouldBeNil)
 
 			userids := []string{}
@@ -316,25 +334,25 @@ func TestUserCRUD(t *testing.T) {
 		})
 
 		Convey("returns ErrUserNotFound when the user to update does not exist", func() {
-			err := c.UpdateUser(&userinfo)
+			err := c.UpdateUser(context.Background(), &userinfo)
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
 		Convey("deletes an existing user", func() {
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
-			err = c.DeleteUser("userid")
+			err = c.DeleteUser(context.Background(), "userid")
 			So(err, ShouldBeNil)
 
 			placeholder := []byte{}
-			err = c.QueryRowx("SELECT false FROM _user WHERE id = $1", "userid").Scan(&placeholder)
+			err = c.QueryRowx(context.Background(), "SELECT false FROM _user WHERE id = $1", "userid").Scan(&placeholder)
 			So(err, ShouldEqual, sql.ErrNoRows)
 			So(placeholder, ShouldBeEmpty)
 		})
 
 		Convey("returns ErrUserNotFound when the user to delete does not exist", func() {
-			err := c.DeleteUser("notexistid")
+			err := c.DeleteUser(context.Background(), "notexistid")
 			So(err, ShouldEqual, skydb.ErrUserNotFound)
 		})
 
@@ -342,23 +360,23 @@ func TestUserCRUD(t *testing.T) {
 			userinfo.ID = "1"
 			userinfo.Username = "user1"
 			userinfo.Email = "user1@skygear.com"
-			err := c.CreateUser(&userinfo)
+			err := c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			userinfo.ID = "2"
 			userinfo.Username = "user2"
 			userinfo.Email = "user2@skygear.com"
-			err = c.CreateUser(&userinfo)
+			err = c.CreateUser(context.Background(), &userinfo)
 			So(err, ShouldBeNil)
 
 			count := 0
-			c.QueryRowx("SELECT COUNT(*) FROM _user").Scan(&count)
+			c.QueryRowx(context.Background(), "SELECT COUNT(*) FROM _user").Scan(&count)
 			So(count, ShouldEqual, 3) // including default admin user
 
-			err = c.DeleteUser("2")
+			err = c.DeleteUser(context.Background(), "2")
 			So(err, ShouldBeNil)
 
-			c.QueryRowx("SELECT COUNT(*) FROM _user").Scan(&count)
+			c.QueryRowx(context.Background(), "SELECT COUNT(*) FROM _user").Scan(&count)
 			So(count, ShouldEqual, 2) // including default admin user
 		})
 	})
@@ -378,16 +396,16 @@ func TestUserEagerLoadRole(t *testing.T) {
 			Roles:          []string{"user"},
 			HashedPassword: []byte(""),
 		}
-		c.CreateUser(&userinfo)
+		c.CreateUser(context.Background(), &userinfo)
 
 		Convey("with GetUser", func() {
 			fetchedUserinfo := skydb.UserInfo{}
-			So(c.GetUser("userid", &fetchedUserinfo), ShouldBeNil)
+			So(c.GetUser(context.Background(), "userid", &fetchedUserinfo), ShouldBeNil)
 			So(fetchedUserinfo, ShouldResemble, userinfo)
 		})
 
 		Convey("with UserQuery", func() {
-			results, err := c.QueryUser([]string{
+			results, err := c.QueryUser(context.Background(), []string{
 				"john.doe@example.com",
 			}, []string{})
 			So(err, ShouldBeNil)
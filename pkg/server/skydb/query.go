@@ -62,6 +62,7 @@ const (
 	ILike
 	In
 	Functional
+	Matches
 )
 
 // IsCompound checks whether the Operator is a compound operator, meaning the
@@ -81,7 +82,7 @@ func (op Operator) IsBinary() bool {
 	switch op {
 	default:
 		return false
-	case Equal, GreaterThan, LessThan, GreaterThanOrEqual, LessThanOrEqual, NotEqual, Like, ILike, In:
+	case Equal, GreaterThan, LessThan, GreaterThanOrEqual, LessThanOrEqual, NotEqual, Like, ILike, In, Matches:
 		return true
 	}
 }
@@ -105,6 +106,7 @@ const (
 	Literal ExpressionType = iota + 1
 	KeyPath
 	Function
+	Variable
 )
 
 // An Expression represents value to be compared against.
@@ -148,6 +150,16 @@ func (expr Expression) IsLiteralMap() bool {
 	return ok
 }
 
+// IsVariable returns whether the expression is a predicate variable
+// that is yet to be resolved.
+func (expr Expression) IsVariable() bool {
+	return expr.Type == Variable
+}
+
+func (expr Expression) isVariable(name string) bool {
+	return expr.Type == Variable && expr.Value == name
+}
+
 func (expr Expression) IsLiteralNull() bool {
 	if expr.Type != Literal {
 		return false
@@ -224,6 +236,8 @@ func (p Predicate) validate(parentPredicate *Predicate) skyerr.Error {
 		return p.validateFunctionalPredicate(parentPredicate)
 	case Equal:
 		return p.validateEqualPredicate(parentPredicate)
+	case Matches:
+		return p.validateMatchesPredicate(parentPredicate)
 	}
 	return nil
 }
@@ -237,10 +251,10 @@ func (p Predicate) validateInPredicate(parentPredicate *Predicate) skyerr.Error
 			`either one of the operands of "IN" must be key path`)
 	}
 
-	if rhs.IsKeyPath() && !lhs.IsLiteralString() {
+	if rhs.IsKeyPath() && !lhs.IsLiteralString() && !lhs.isVariable(CurrentUserIDVariable) {
 		return skyerr.NewError(skyerr.RecordQueryInvalid,
 			`left operand of "IN" must be a string if comparing with a keypath`)
-	} else if lhs.IsKeyPath() && !rhs.IsLiteralArray() {
+	} else if lhs.IsKeyPath() && !rhs.IsLiteralArray() && !rhs.isVariable(UserRolesVariable) {
 		return skyerr.NewError(skyerr.RecordQueryInvalid,
 			`right operand of "IN" must be an array if comparing with a keypath`)
 	}
@@ -266,6 +280,16 @@ func (p Predicate) validateFunctionalPredicate(parentPredicate *Predicate) skyer
 			return skyerr.NewError(skyerr.NotSupported,
 				`user discover predicate cannot be combined with other predicates`)
 		}
+	case SharedWithUserFunc:
+		if f.User == "" {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				`shared with user predicate requires a user`)
+		}
+	case WithinBoundsFunc:
+		if f.SouthWest.Lat() > f.NorthEast.Lat() {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				`south-west corner of bounds must not be north of the north-east corner`)
+		}
 	default:
 		return skyerr.NewError(skyerr.NotSupported,
 			`unsupported function for functional predicate`)
@@ -273,6 +297,21 @@ func (p Predicate) validateFunctionalPredicate(parentPredicate *Predicate) skyer
 	return nil
 }
 
+func (p Predicate) validateMatchesPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if !lhs.IsKeyPath() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`left operand of "MATCHES" must be a key path`)
+	}
+	if !rhs.IsLiteralString() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`right operand of "MATCHES" must be a string`)
+	}
+	return nil
+}
+
 func (p Predicate) validateEqualPredicate(parentPredicate *Predicate) skyerr.Error {
 	lhs := p.Children[0].(Expression)
 	rhs := p.Children[1].(Expression)
@@ -333,12 +372,74 @@ type Query struct {
 	Limit        *uint64
 	Offset       uint64
 
+	// Cursor continues the query after the record it is created from,
+	// which is the last record of the previous page.
+	Cursor *QueryCursor
+
+	// Hints overrides the choices of the query planner for the query.
+	// It is nil for most queries.
+	Hints *QueryHints
+
 	// The following fields are generated from the server side, rather
 	// than supplied from the client side.
 	ViewAsUser          *UserInfo
 	BypassAccessControl bool
 }
 
+// JoinStrategy is the strategy the query planner uses to join the tables
+// of a query.
+type JoinStrategy string
+
+// List of join strategies.
+const (
+	NestedLoopJoin JoinStrategy = "nested_loop"
+	HashJoin       JoinStrategy = "hash"
+	MergeJoin      JoinStrategy = "merge"
+)
+
+// QueryHints overrides the choices of the query planner for a query that
+// the planner consistently plans badly. Hints are only accepted from
+// trusted callers, and a Database may ignore hints it does not support.
+type QueryHints struct {
+	// Index is the name of the index of the queried record type the
+	// query prefers to scan.
+	Index string
+	// DisableSeqScan discourages sequential scans of the tables.
+	DisableSeqScan bool
+	// JoinStrategy is the only strategy used to join the tables, or
+	// empty to let the planner choose.
+	JoinStrategy JoinStrategy
+}
+
+// QueryCursor is the position of a record in the results of a query
+// sorted by key paths. Records of the same values of the sort key paths
+// are ordered by their IDs, so that a query can be continued after the
+// record by keyset pagination.
+type QueryCursor struct {
+	// Values are the values of the sort key paths of the record, in the
+	// order of the sorts of the query.
+	Values []interface{}
+	// ID is the key of the record ID.
+	ID string
+}
+
+// NewQueryCursor returns the cursor of the query at the record. It
+// returns nil if the query is sorted by function, which cannot be
+// continued with a cursor.
+func NewQueryCursor(query *Query, record *Record) *QueryCursor {
+	cursor := &QueryCursor{
+		Values: make([]interface{}, len(query.Sorts)),
+		ID:     record.ID.Key,
+	}
+	for i, sort := range query.Sorts {
+		if sort.KeyPath == "" {
+			return nil
+		}
+		cursor.Values[i] = record.Get(sort.KeyPath)
+	}
+	return cursor
+}
+
 // Func is a marker interface to denote a type being a function in skydb.
 //
 // skydb's function receives zero or more arguments and returns a DataType
@@ -361,6 +462,21 @@ func (f DistanceFunc) Args() []interface{} {
 	return []interface{}{f.Field, f.Location}
 }
 
+// WithinBoundsFunc represents a functional predicate that evaluates
+// whether a Record's location field is within the bounding box from the
+// south-west corner SouthWest to the north-east corner NorthEast. The
+// box crosses the antimeridian if SouthWest is east of NorthEast.
+type WithinBoundsFunc struct {
+	Field     string
+	SouthWest Location
+	NorthEast Location
+}
+
+// Args implements the Func interface
+func (f WithinBoundsFunc) Args() []interface{} {
+	return []interface{}{f.Field, f.SouthWest, f.NorthEast}
+}
+
 // CountFunc represents a function that count number of rows matching
 // a query
 type CountFunc struct {
@@ -372,6 +488,19 @@ func (f CountFunc) Args() []interface{} {
 	return []interface{}{}
 }
 
+// RankFunc represents a function that ranks records by the value of
+// Field in Order. Records having the same value share the same rank, and
+// the rank of a record is one plus the number of records ranked before it.
+type RankFunc struct {
+	Field string
+	Order SortOrder
+}
+
+// Args implements the Func interface
+func (f RankFunc) Args() []interface{} {
+	return []interface{}{f.Field, f.Order}
+}
+
 // UserRelationFunc represents a function that is used to evaulate
 // whether a record satisfy certain user-based relation
 type UserRelationFunc struct {
@@ -386,6 +515,19 @@ func (f UserRelationFunc) Args() []interface{} {
 	return []interface{}{}
 }
 
+// SharedWithUserFunc represents a functional predicate that evaluates
+// whether the ACL of a record explicitly grants User access, either by
+// the ID or by a role of the user. Records owned by User are not shared
+// with the user, and neither are records only granted to the public.
+type SharedWithUserFunc struct {
+	User string
+}
+
+// Args implements the Func interface
+func (f SharedWithUserFunc) Args() []interface{} {
+	return []interface{}{}
+}
+
 // UserDiscoverFunc searches for user record having the specified user data, such
 // as email addresses. Can only be used with user record.
 type UserDiscoverFunc struct {
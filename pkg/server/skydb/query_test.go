@@ -95,6 +95,59 @@ func TestMalformedPredicate(t *testing.T) {
 		})
 	})
 
+	Convey("Predicate with MATCHES", t, func() {
+		Convey("keypath and string operands", func() {
+			predicate := Predicate{
+				Operator: Matches,
+				Children: []interface{}{
+					Expression{
+						Type:  KeyPath,
+						Value: "content",
+					},
+					Expression{
+						Type:  Literal,
+						Value: "quick fox",
+					},
+				},
+			}
+			So(predicate.Validate(), ShouldBeNil)
+		})
+
+		Convey("non-string right operand", func() {
+			predicate := Predicate{
+				Operator: Matches,
+				Children: []interface{}{
+					Expression{
+						Type:  KeyPath,
+						Value: "content",
+					},
+					Expression{
+						Type:  Literal,
+						Value: float64(1),
+					},
+				},
+			}
+			So(predicate.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("non-keypath left operand", func() {
+			predicate := Predicate{
+				Operator: Matches,
+				Children: []interface{}{
+					Expression{
+						Type:  Literal,
+						Value: "content",
+					},
+					Expression{
+						Type:  Literal,
+						Value: "quick fox",
+					},
+				},
+			}
+			So(predicate.Validate(), ShouldNotBeNil)
+		})
+	})
+
 	Convey("Predicate with IN", t, func() {
 		Convey("keypath operand types", func() {
 			predicate := Predicate{
@@ -198,4 +251,117 @@ func TestMalformedPredicate(t *testing.T) {
 			So(err, ShouldNotBeNil)
 		})
 	})
+
+	Convey("Predicate with Shared With User", t, func() {
+		newPredicate := func(user string) Predicate {
+			return Predicate{
+				Functional,
+				[]interface{}{
+					Expression{Type: Function, Value: SharedWithUserFunc{user}},
+				},
+			}
+		}
+
+		So(newPredicate("bob").Validate(), ShouldBeNil)
+		So(newPredicate("").Validate(), ShouldNotBeNil)
+	})
+
+	Convey("Predicate with Within Bounds", t, func() {
+		newPredicate := func(southWest Location, northEast Location) Predicate {
+			return Predicate{
+				Functional,
+				[]interface{}{
+					Expression{
+						Type:  Function,
+						Value: WithinBoundsFunc{"location", southWest, northEast},
+					},
+				},
+			}
+		}
+
+		Convey("valid bounds", func() {
+			predicate := newPredicate(NewLocation(170, 10), NewLocation(-170, 20))
+			So(predicate.Validate(), ShouldBeNil)
+		})
+
+		Convey("south-west corner north of north-east corner", func() {
+			predicate := newPredicate(NewLocation(10, 20), NewLocation(20, 10))
+			So(predicate.Validate(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPredicateMatchRecord(t *testing.T) {
+	Convey("Records", t, func() {
+		record1 := Record{ID: NewRecordID("record", "id")}
+		record1.Data = map[string]interface{}{
+			"category": "recipe",
+		}
+		Convey("Match record with predicate in", func() {
+
+			predicate := Predicate{
+				Operator: In,
+				Children: []interface{}{
+					Expression{
+						Type:  KeyPath,
+						Value: "category",
+					},
+					Expression{
+						Type:  Literal,
+						Value: []interface{}{"recipe", "fiction"},
+					},
+				},
+			}
+
+			So(predicate.MatchRecord(&record1), ShouldBeTrue)
+		})
+
+		Convey("Not match record with predicate in", func() {
+			predicate := Predicate{
+				Operator: In,
+				Children: []interface{}{
+					Expression{
+						Type:  KeyPath,
+						Value: "category",
+					},
+					Expression{
+						Type:  Literal,
+						Value: []interface{}{"utility", "fiction"},
+					},
+				},
+			}
+
+			So(predicate.MatchRecord(&record1), ShouldBeFalse)
+		})
+
+		Convey("Check predicate can be matched", func() {
+			So(Predicate{}.CanMatchRecord(), ShouldBeTrue)
+			So(Predicate{
+				Operator: Equal,
+				Children: []interface{}{
+					Expression{Type: KeyPath, Value: "category"},
+					Expression{Type: Literal, Value: "recipe"},
+				},
+			}.CanMatchRecord(), ShouldBeTrue)
+			So(Predicate{
+				Operator: GreaterThan,
+				Children: []interface{}{
+					Expression{Type: KeyPath, Value: "price"},
+					Expression{Type: Literal, Value: float64(10)},
+				},
+			}.CanMatchRecord(), ShouldBeFalse)
+			So(Predicate{
+				Operator: Not,
+				Children: []interface{}{
+					Predicate{
+						Operator: Equal,
+						Children: []interface{}{
+							Expression{Type: Function, Value: DistanceFunc{}},
+							Expression{Type: Literal, Value: float64(10)},
+						},
+					},
+				},
+			}.CanMatchRecord(), ShouldBeFalse)
+		})
+	})
 }
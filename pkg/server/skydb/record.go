@@ -182,12 +182,35 @@ func (acl RecordACL) Accessible(userinfo *UserInfo, level ACLLevel) bool {
 	return accessible
 }
 
+// AssetUploadStatus is the status of the upload of the content of an
+// Asset.
+type AssetUploadStatus string
+
+const (
+	// AssetUploadPending means the asset is created but its content is
+	// not yet received.
+	AssetUploadPending AssetUploadStatus = "pending"
+
+	// AssetUploadCompleted means the content of the asset is stored.
+	AssetUploadCompleted AssetUploadStatus = "completed"
+
+	// AssetUploadCorrupted means the stored content of the asset does not
+	// match its checksum.
+	AssetUploadCorrupted AssetUploadStatus = "corrupted"
+)
+
 type Asset struct {
 	Name        string
 	ContentType string
 	Size        int64
 	Public      bool
 	Signer      asset.URLSigner
+
+	// MD5 and SHA256 are the hex-encoded checksums of the content.
+	MD5    string
+	SHA256 string
+
+	UploadStatus AssetUploadStatus
 }
 
 // SignedURL will try to return a signedURL with the injected Signer.
@@ -406,13 +429,34 @@ func (schema RecordSchema) DefinitionSupersetOf(other RecordSchema) bool {
 // FieldType represents the kind of data living within a field of a RecordSchema.
 type FieldType struct {
 	Type           DataType
-	ReferenceType  string     // used only by TypeReference
-	Expression     Expression // used by Computed Keys
-	UnderlyingType string     // indicates the underlying (pq) type
+	ReferenceType  string          // used only by TypeReference
+	OnDelete       ReferenceAction // used only by TypeReference
+	Expression     Expression      // used by Computed Keys
+	UnderlyingType string          // indicates the underlying (pq) type
 }
 
+// ReferenceAction is the action taken on the records referencing a
+// record when the referenced record is deleted.
+//
+// The action is taken by the server when a record is deleted through
+// record:delete, as the user deleting the record, so that the access
+// control and hooks of the referencing records apply. The database
+// itself only restricts deleting a referenced record.
+type ReferenceAction string
+
+// The actions which can be taken on referencing records. Deleting a
+// referenced record fails with ReferenceRestrict, the default.
+// ReferenceCascade deletes the referencing records, while
+// ReferenceNullify sets their references to null.
+const (
+	ReferenceRestrict ReferenceAction = ""
+	ReferenceCascade  ReferenceAction = "cascade"
+	ReferenceNullify  ReferenceAction = "nullify"
+)
+
 func (f FieldType) DefinitionEquals(other FieldType) bool {
-	return f.Type == other.Type && f.ReferenceType == other.ReferenceType
+	return f.Type == other.Type && f.ReferenceType == other.ReferenceType &&
+		f.OnDelete == other.OnDelete
 }
 
 func (f FieldType) ToSimpleName() string {
@@ -426,6 +470,9 @@ func (f FieldType) ToSimpleName() string {
 	case TypeJSON:
 		return "json"
 	case TypeReference:
+		if f.OnDelete != ReferenceRestrict {
+			return fmt.Sprintf("ref(%s,%s)", f.ReferenceType, f.OnDelete)
+		}
 		return fmt.Sprintf("ref(%s)", f.ReferenceType)
 	case TypeLocation:
 		return "location"
@@ -503,6 +550,18 @@ func SimpleNameToFieldType(s string) (result FieldType, err error) {
 		if regexp.MustCompile(`^ref\(.+\)$`).MatchString(s) {
 			result.Type = TypeReference
 			result.ReferenceType = s[4 : len(s)-1]
+			if i := strings.LastIndex(result.ReferenceType, ","); i >= 0 {
+				switch action := ReferenceAction(strings.TrimSpace(result.ReferenceType[i+1:])); action {
+				case "restrict":
+					result.OnDelete = ReferenceRestrict
+				case ReferenceCascade, ReferenceNullify:
+					result.OnDelete = action
+				default:
+					err = fmt.Errorf("Unexpected reference action: %s", action)
+					return
+				}
+				result.ReferenceType = strings.TrimSpace(result.ReferenceType[:i])
+			}
 		} else {
 			err = fmt.Errorf("Unexpected type name: %s", s)
 			return
@@ -224,3 +224,49 @@ func TestRecordSchema(t *testing.T) {
 		})
 	})
 }
+
+func TestFieldTypeSimpleName(t *testing.T) {
+	Convey("FieldType simple name", t, func() {
+		Convey("parses reference", func() {
+			fieldType, err := SimpleNameToFieldType("ref(note)")
+			So(err, ShouldBeNil)
+			So(fieldType, ShouldResemble, FieldType{
+				Type:          TypeReference,
+				ReferenceType: "note",
+			})
+			So(fieldType.ToSimpleName(), ShouldEqual, "ref(note)")
+		})
+
+		Convey("parses reference with delete action", func() {
+			fieldType, err := SimpleNameToFieldType("ref(note,cascade)")
+			So(err, ShouldBeNil)
+			So(fieldType, ShouldResemble, FieldType{
+				Type:          TypeReference,
+				ReferenceType: "note",
+				OnDelete:      ReferenceCascade,
+			})
+			So(fieldType.ToSimpleName(), ShouldEqual, "ref(note,cascade)")
+
+			fieldType, err = SimpleNameToFieldType("ref(note, nullify)")
+			So(err, ShouldBeNil)
+			So(fieldType.OnDelete, ShouldEqual, ReferenceNullify)
+
+			fieldType, err = SimpleNameToFieldType("ref(note,restrict)")
+			So(err, ShouldBeNil)
+			So(fieldType.OnDelete, ShouldEqual, ReferenceRestrict)
+			So(fieldType.ToSimpleName(), ShouldEqual, "ref(note)")
+		})
+
+		Convey("rejects unknown delete action", func() {
+			_, err := SimpleNameToFieldType("ref(note,ignore)")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("compares delete action of reference", func() {
+			restrict := FieldType{Type: TypeReference, ReferenceType: "note"}
+			cascade := FieldType{Type: TypeReference, ReferenceType: "note", OnDelete: ReferenceCascade}
+			So(restrict.DefinitionEquals(restrict), ShouldBeTrue)
+			So(restrict.DefinitionEquals(cascade), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrScheduledMutationNotFound is returned by
+// ScheduledMutationStore.DeleteScheduledMutation if the mutation does
+// not exist.
+var ErrScheduledMutationNotFound = errors.New("skydb: scheduled mutation not found")
+
+// ScheduledMutation is a change of record fields to be applied at a
+// future time, e.g. setting status to "published" at publish time.
+type ScheduledMutation struct {
+	ID       string
+	RecordID RecordID
+
+	// DatabaseID is empty for a record in the public database, and
+	// is the ID of the owner for a record in a private database.
+	DatabaseID string
+
+	// Data are the fields set on the record when the mutation is run.
+	Data Data
+
+	RunAt     time.Time
+	CreatedAt time.Time
+	CreatorID string
+}
+
+// ScheduledMutationStore defines the methods for a Conn that persists
+// ScheduledMutation until they are run.
+type ScheduledMutationStore interface {
+	// SaveScheduledMutation creates or updates a ScheduledMutation.
+	SaveScheduledMutation(ctx context.Context, mutation *ScheduledMutation) error
+
+	// GetScheduledMutations returns the pending mutations of a record
+	// ordered by the time they are run.
+	GetScheduledMutations(ctx context.Context, recordID RecordID) ([]ScheduledMutation, error)
+
+	// GetDueScheduledMutations returns at most limit mutations that
+	// should be run at or before the specified time, earliest first.
+	GetDueScheduledMutations(ctx context.Context, before time.Time, limit uint64) ([]ScheduledMutation, error)
+
+	// DeleteScheduledMutation removes a mutation.
+	// ErrScheduledMutationNotFound is returned if there is no such
+	// mutation.
+	DeleteScheduledMutation(ctx context.Context, id string) error
+}
@@ -254,6 +254,44 @@ func (p MapKeyPath) ToMap(m map[string]interface{}) {
 	m["$val"] = string(p)
 }
 
+// MapQueryCursor is skydb.QueryCursor that can be converted from and to
+// map, with its values in their map representation.
+type MapQueryCursor skydb.QueryCursor
+
+// FromMap implements FromMapper
+func (cursor *MapQueryCursor) FromMap(m map[string]interface{}) error {
+	id, _ := m["id"].(string)
+	if id == "" {
+		return errors.New("empty record ID in cursor")
+	}
+
+	rawValues, ok := m["values"].([]interface{})
+	if !ok {
+		return errors.New("missing values in cursor")
+	}
+
+	values, err := walkData(map[string]interface{}{"values": rawValues})
+	if err != nil {
+		return err
+	}
+
+	cursor.Values = values["values"].([]interface{})
+	cursor.ID = id
+	return nil
+}
+
+// ToMap implements ToMapper
+func (cursor MapQueryCursor) ToMap(m map[string]interface{}) {
+	values := make([]interface{}, len(cursor.Values))
+	for i, value := range cursor.Values {
+		mm := map[string]interface{}{}
+		ToMapData(skydb.Data{"value": value}).ToMap(mm)
+		values[i] = mm["value"]
+	}
+	m["values"] = values
+	m["id"] = cursor.ID
+}
+
 // MapRelation is a type specifying a relation between two users, but do not conform to any actual struct in skydb.
 type MapRelation struct {
 	Name      string
@@ -27,30 +27,8 @@ type JSONRecord skydb.Record
 
 // MarshalJSON implements json.Marshaler
 func (record *JSONRecord) MarshalJSON() ([]byte, error) {
-	data := map[string]interface{}{}
-	for key, value := range record.Data {
-		switch v := value.(type) {
-		case time.Time:
-			data[key] = (MapTime)(v)
-		case skydb.Reference:
-			data[key] = (MapReference)(v)
-		case skydb.Location:
-			data[key] = (MapLocation)(v)
-		case *skydb.Location:
-			data[key] = (*MapLocation)(v)
-		case *skydb.Asset:
-			data[key] = (*MapAsset)(v)
-		case skydb.Sequence:
-			data[key] = (MapSequence)(v)
-		case skydb.Unknown:
-			data[key] = (MapUnknown)(v)
-		default:
-			data[key] = value
-		}
-	}
-
 	m := map[string]interface{}{}
-	MapData(data).ToMap(m)
+	ToMapData(record.Data).ToMap(m)
 
 	m["_id"] = record.ID.String()
 	m["_type"] = "record"
@@ -80,6 +58,33 @@ func (record *JSONRecord) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// ToMapData wraps values of record data in their map representation,
+// so that they can be converted by MapData.ToMap.
+func ToMapData(recordData skydb.Data) MapData {
+	data := MapData{}
+	for key, value := range recordData {
+		switch v := value.(type) {
+		case time.Time:
+			data[key] = (MapTime)(v)
+		case skydb.Reference:
+			data[key] = (MapReference)(v)
+		case skydb.Location:
+			data[key] = (MapLocation)(v)
+		case *skydb.Location:
+			data[key] = (*MapLocation)(v)
+		case *skydb.Asset:
+			data[key] = (*MapAsset)(v)
+		case skydb.Sequence:
+			data[key] = (MapSequence)(v)
+		case skydb.Unknown:
+			data[key] = (MapUnknown)(v)
+		default:
+			data[key] = value
+		}
+	}
+	return data
+}
+
 func (record *JSONRecord) marshalTransient(transient map[string]interface{}) map[string]interface{} {
 	m := map[string]interface{}{}
 	for key, value := range transient {
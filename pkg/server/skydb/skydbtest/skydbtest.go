@@ -15,6 +15,7 @@
 package skydbtest
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -43,7 +44,7 @@ func NewMapConn() *MapConn {
 }
 
 // CreateUser creates a UserInfo in UserMap.
-func (conn *MapConn) CreateUser(userinfo *skydb.UserInfo) error {
+func (conn *MapConn) CreateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
 	if _, existed := conn.UserMap[userinfo.ID]; existed {
 		return skydb.ErrUserDuplicated
 	}
@@ -61,7 +62,7 @@ func (conn *MapConn) CreateUser(userinfo *skydb.UserInfo) error {
 }
 
 // GetUser returns a UserInfo in UserMap.
-func (conn *MapConn) GetUser(id string, userinfo *skydb.UserInfo) error {
+func (conn *MapConn) GetUser(ctx context.Context, id string, userinfo *skydb.UserInfo) error {
 	u, ok := conn.UserMap[id]
 	if !ok {
 		return skydb.ErrUserNotFound
@@ -72,7 +73,7 @@ func (conn *MapConn) GetUser(id string, userinfo *skydb.UserInfo) error {
 }
 
 // GetUserByUsernameEmail returns a UserInfo in UserMap by email address.
-func (conn *MapConn) GetUserByUsernameEmail(username string, email string, userinfo *skydb.UserInfo) error {
+func (conn *MapConn) GetUserByUsernameEmail(ctx context.Context, username string, email string, userinfo *skydb.UserInfo) error {
 	var (
 		u  skydb.UserInfo
 		ok bool
@@ -97,7 +98,7 @@ func (conn *MapConn) GetUserByUsernameEmail(username string, email string, useri
 }
 
 // GetUserByPrincipalID returns a UserInfo by its principalID.
-func (conn *MapConn) GetUserByPrincipalID(principalID string, userinfo *skydb.UserInfo) error {
+func (conn *MapConn) GetUserByPrincipalID(ctx context.Context, principalID string, userinfo *skydb.UserInfo) error {
 	for _, u := range conn.UserMap {
 		if _, ok := u.Auth[principalID]; ok {
 			*userinfo = u
@@ -109,12 +110,12 @@ func (conn *MapConn) GetUserByPrincipalID(principalID string, userinfo *skydb.Us
 }
 
 // QueryUser is not implemented.
-func (conn *MapConn) QueryUser(emails []string, usernames []string) ([]skydb.UserInfo, error) {
+func (conn *MapConn) QueryUser(ctx context.Context, emails []string, usernames []string) ([]skydb.UserInfo, error) {
 	panic("not implemented")
 }
 
 // UpdateUser updates an existing UserInfo in UserMap.
-func (conn *MapConn) UpdateUser(userinfo *skydb.UserInfo) error {
+func (conn *MapConn) UpdateUser(ctx context.Context, userinfo *skydb.UserInfo) error {
 	if _, ok := conn.UserMap[userinfo.ID]; !ok {
 		return skydb.ErrUserNotFound
 	}
@@ -124,7 +125,7 @@ func (conn *MapConn) UpdateUser(userinfo *skydb.UserInfo) error {
 }
 
 // DeleteUser remove an existing in UserMap.
-func (conn *MapConn) DeleteUser(id string) error {
+func (conn *MapConn) DeleteUser(ctx context.Context, id string) error {
 	if _, ok := conn.UserMap[id]; !ok {
 		return skydb.ErrUserNotFound
 	}
@@ -134,37 +135,78 @@ func (conn *MapConn) DeleteUser(id string) error {
 }
 
 // GetAdminRoles is not implemented.
-func (conn *MapConn) GetAdminRoles() ([]string, error) {
+func (conn *MapConn) GetAdminRoles(ctx context.Context) ([]string, error) {
 	return []string{
 		"admin",
 	}, nil
 }
 
 // SetAdminRoles is not implemented.
-func (conn *MapConn) SetAdminRoles(roles []string) error {
+func (conn *MapConn) SetAdminRoles(ctx context.Context, roles []string) error {
 	panic("not implemented")
 }
 
 // GetDefaultRoles always return user for testing
-func (conn *MapConn) GetDefaultRoles() ([]string, error) {
+func (conn *MapConn) GetDefaultRoles(ctx context.Context) ([]string, error) {
 	return []string{
 		"user",
 	}, nil
 }
 
 // SetDefaultRoles is not implemented.
-func (conn *MapConn) SetDefaultRoles(roles []string) error {
+func (conn *MapConn) SetDefaultRoles(ctx context.Context, roles []string) error {
 	panic("not implemented")
 }
 
+// AssignUserRoles adds roles to the user in UserMap.
+func (conn *MapConn) AssignUserRoles(ctx context.Context, userID string, roles []string) error {
+	userinfo, ok := conn.UserMap[userID]
+	if !ok {
+		return skydb.ErrUserNotFound
+	}
+
+	for _, role := range roles {
+		if !userinfo.HasAnyRoles([]string{role}) {
+			userinfo.Roles = append(userinfo.Roles, role)
+		}
+	}
+	conn.UserMap[userID] = userinfo
+	return nil
+}
+
+// RevokeUserRoles removes roles from the user in UserMap.
+func (conn *MapConn) RevokeUserRoles(ctx context.Context, userID string, roles []string) error {
+	userinfo, ok := conn.UserMap[userID]
+	if !ok {
+		return skydb.ErrUserNotFound
+	}
+
+	remaining := []string{}
+	for _, role := range userinfo.Roles {
+		revoked := false
+		for _, revokedRole := range roles {
+			if role == revokedRole {
+				revoked = true
+				break
+			}
+		}
+		if !revoked {
+			remaining = append(remaining, role)
+		}
+	}
+	userinfo.Roles = remaining
+	conn.UserMap[userID] = userinfo
+	return nil
+}
+
 // SetRecordAccess sets record creation access
-func (conn *MapConn) SetRecordAccess(recordType string, acl skydb.RecordACL) error {
+func (conn *MapConn) SetRecordAccess(ctx context.Context, recordType string, acl skydb.RecordACL) error {
 	conn.recordAccessMap[recordType] = acl
 	return nil
 }
 
 // GetRecordAccess returns record creation access of a specific type
-func (conn *MapConn) GetRecordAccess(recordType string) (skydb.RecordACL, error) {
+func (conn *MapConn) GetRecordAccess(ctx context.Context, recordType string) (skydb.RecordACL, error) {
 	acl, gotIt := conn.recordAccessMap[recordType]
 	if !gotIt {
 		acl = skydb.NewRecordACL([]skydb.RecordACLEntry{})
@@ -174,62 +216,62 @@ func (conn *MapConn) GetRecordAccess(recordType string) (skydb.RecordACL, error)
 }
 
 // GetAsset is not implemented.
-func (conn *MapConn) GetAsset(name string, asset *skydb.Asset) error {
+func (conn *MapConn) GetAsset(ctx context.Context, name string, asset *skydb.Asset) error {
 	panic("not implemented")
 }
 
 // SaveAsset is not implemented.
-func (conn *MapConn) SaveAsset(asset *skydb.Asset) error {
+func (conn *MapConn) SaveAsset(ctx context.Context, asset *skydb.Asset) error {
 	panic("not implemented")
 }
 
 // QueryRelation is not implemented.
-func (conn *MapConn) QueryRelation(user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
+func (conn *MapConn) QueryRelation(ctx context.Context, user string, name string, direction string, config skydb.QueryConfig) []skydb.UserInfo {
 	panic("not implemented")
 }
 
 // QueryRelationCount is not implemented.
-func (conn *MapConn) QueryRelationCount(user string, name string, direction string) (uint64, error) {
+func (conn *MapConn) QueryRelationCount(ctx context.Context, user string, name string, direction string) (uint64, error) {
 	panic("not implemented")
 }
 
 // AddRelation is not implemented.
-func (conn *MapConn) AddRelation(user string, name string, targetUser string) error {
+func (conn *MapConn) AddRelation(ctx context.Context, user string, name string, targetUser string) error {
 	panic("not implemented")
 }
 
 // RemoveRelation is not implemented.
-func (conn *MapConn) RemoveRelation(user string, name string, targetUser string) error {
+func (conn *MapConn) RemoveRelation(ctx context.Context, user string, name string, targetUser string) error {
 	panic("not implemented")
 }
 
 // GetDevice is not implemented.
-func (conn *MapConn) GetDevice(id string, device *skydb.Device) error {
+func (conn *MapConn) GetDevice(ctx context.Context, id string, device *skydb.Device) error {
 	panic("not implemented")
 }
 
 // QueryDevicesByUser is not implemented.
-func (conn *MapConn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
+func (conn *MapConn) QueryDevicesByUser(ctx context.Context, user string) ([]skydb.Device, error) {
 	panic("not implemented")
 }
 
 // SaveDevice is not implemented.
-func (conn *MapConn) SaveDevice(device *skydb.Device) error {
+func (conn *MapConn) SaveDevice(ctx context.Context, device *skydb.Device) error {
 	panic("not implemented")
 }
 
 // DeleteDevice is not implemented.
-func (conn *MapConn) DeleteDevice(id string) error {
+func (conn *MapConn) DeleteDevice(ctx context.Context, id string) error {
 	panic("not implemented")
 }
 
 // DeleteDevicesByToken is not implemented.
-func (conn *MapConn) DeleteDevicesByToken(token string, t time.Time) error {
+func (conn *MapConn) DeleteDevicesByToken(ctx context.Context, token string, t time.Time) error {
 	panic("not implemented")
 }
 
 // DeleteEmptyDevicesByTime is not implemented.
-func (conn *MapConn) DeleteEmptyDevicesByTime(t time.Time) error {
+func (conn *MapConn) DeleteEmptyDevicesByTime(ctx context.Context, t time.Time) error {
 	panic("not implemented")
 }
 
@@ -298,7 +340,7 @@ func (db *MapDB) UserRecordType() string {
 }
 
 // Get returns a Record from RecordMap.
-func (db *MapDB) Get(id skydb.RecordID, record *skydb.Record) error {
+func (db *MapDB) Get(ctx context.Context, id skydb.RecordID, record *skydb.Record) error {
 	r, ok := db.RecordMap[id.String()]
 	if !ok {
 		return skydb.ErrRecordNotFound
@@ -309,13 +351,13 @@ func (db *MapDB) Get(id skydb.RecordID, record *skydb.Record) error {
 }
 
 // Save assigns Record to RecordMap.
-func (db *MapDB) Save(record *skydb.Record) error {
+func (db *MapDB) Save(ctx context.Context, record *skydb.Record) error {
 	db.RecordMap[record.ID.String()] = *record
 	return nil
 }
 
 // Delete remove the specified key from RecordMap.
-func (db *MapDB) Delete(id skydb.RecordID) error {
+func (db *MapDB) Delete(ctx context.Context, id skydb.RecordID) error {
 	_, ok := db.RecordMap[id.String()]
 	if !ok {
 		return skydb.ErrRecordNotFound
@@ -325,12 +367,12 @@ func (db *MapDB) Delete(id skydb.RecordID) error {
 }
 
 // Query is not implemented.
-func (db *MapDB) Query(query *skydb.Query) (*skydb.Rows, error) {
+func (db *MapDB) Query(ctx context.Context, query *skydb.Query) (*skydb.Rows, error) {
 	panic("skydbtest: MapDB.Query not supported")
 }
 
 // Extend store the type of the field.
-func (db *MapDB) Extend(recordType string, schema skydb.RecordSchema) (bool, error) {
+func (db *MapDB) Extend(ctx context.Context, recordType string, schema skydb.RecordSchema) (bool, error) {
 	if _, ok := db.RecordSchemaMap[recordType]; ok {
 		for fieldName, fieldType := range schema {
 			if _, ok := db.RecordSchemaMap[recordType][fieldName]; ok {
@@ -347,7 +389,7 @@ func (db *MapDB) Extend(recordType string, schema skydb.RecordSchema) (bool, err
 	return true, nil
 }
 
-func (db *MapDB) RenameSchema(recordType, oldColumnName, newColumnName string) error {
+func (db *MapDB) RenameSchema(ctx context.Context, recordType, oldColumnName, newColumnName string) error {
 	if _, ok := db.RecordSchemaMap[recordType]; !ok {
 		return fmt.Errorf("record type %s does not exist", recordType)
 	}
@@ -368,7 +410,7 @@ func (db *MapDB) RenameSchema(recordType, oldColumnName, newColumnName string) e
 	return nil
 }
 
-func (db *MapDB) DeleteSchema(recordType, columnName string) error {
+func (db *MapDB) DeleteSchema(ctx context.Context, recordType, columnName string) error {
 	if _, ok := db.RecordSchemaMap[recordType]; !ok {
 		return fmt.Errorf("record type %s does not exist", recordType)
 	}
@@ -380,7 +422,7 @@ func (db *MapDB) DeleteSchema(recordType, columnName string) error {
 }
 
 // GetSchema returns the record schema of a record type
-func (db *MapDB) GetSchema(recordType string) (skydb.RecordSchema, error) {
+func (db *MapDB) GetSchema(ctx context.Context, recordType string) (skydb.RecordSchema, error) {
 	if _, ok := db.RecordSchemaMap[recordType]; !ok {
 		return nil, fmt.Errorf("record type %s does not exist", recordType)
 	}
@@ -388,12 +430,12 @@ func (db *MapDB) GetSchema(recordType string) (skydb.RecordSchema, error) {
 }
 
 // GetRecordSchemas returns a list of all existing record type
-func (db *MapDB) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
+func (db *MapDB) GetRecordSchemas(ctx context.Context) (map[string]skydb.RecordSchema, error) {
 	return db.RecordSchemaMap, nil
 }
 
 // GetSubscription return a Subscription from SubscriptionMap.
-func (db *MapDB) GetSubscription(name string, deviceID string, subscription *skydb.Subscription) error {
+func (db *MapDB) GetSubscription(ctx context.Context, name string, deviceID string, subscription *skydb.Subscription) error {
 	s, ok := db.SubscriptionMap[deviceID+"/"+name]
 	if !ok {
 		return skydb.ErrSubscriptionNotFound
@@ -403,13 +445,13 @@ func (db *MapDB) GetSubscription(name string, deviceID string, subscription *sky
 }
 
 // SaveSubscription assigns to SubscriptionMap.
-func (db *MapDB) SaveSubscription(subscription *skydb.Subscription) error {
+func (db *MapDB) SaveSubscription(ctx context.Context, subscription *skydb.Subscription) error {
 	db.SubscriptionMap[subscription.DeviceID+"/"+subscription.ID] = *subscription
 	return nil
 }
 
 // DeleteSubscription deletes the specified key from SubscriptionMap.
-func (db *MapDB) DeleteSubscription(name string, deviceID string) error {
+func (db *MapDB) DeleteSubscription(ctx context.Context, name string, deviceID string) error {
 	key := deviceID + "/" + name
 	_, ok := db.SubscriptionMap[key]
 	if !ok {
@@ -430,7 +472,7 @@ func NewMockTxDatabase(backingDB skydb.Database) *MockTxDatabase {
 	return &MockTxDatabase{Database: backingDB}
 }
 
-func (db *MockTxDatabase) Begin() error {
+func (db *MockTxDatabase) Begin(ctx context.Context) error {
 	db.DidBegin = true
 	return nil
 }
@@ -0,0 +1,97 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"time"
+)
+
+// RecordOperation is the kind of modification made to a record.
+type RecordOperation string
+
+// List of record operations counted in RecordStats.
+const (
+	RecordCreateOperation RecordOperation = "create"
+	RecordUpdateOperation RecordOperation = "update"
+	RecordDeleteOperation RecordOperation = "delete"
+)
+
+// RecordActivity is a modification made to a record by a user.
+type RecordActivity struct {
+	RecordType string
+	Operation  RecordOperation
+
+	// UserID is empty if the record is modified with master key
+	// without a user.
+	UserID     string
+	OccurredAt time.Time
+}
+
+// RecordStats are the counters of activities on records of a type
+// during a day.
+type RecordStats struct {
+	Date        time.Time
+	RecordType  string
+	Creates     uint64
+	Updates     uint64
+	Deletes     uint64
+	ActiveUsers uint64
+}
+
+// RecordStatsStore defines the methods for a Conn that maintains daily
+// RecordStats.
+//
+// Activities are logged as they happen and aggregated into RecordStats
+// when rolled up, so RecordStats of a day are available only after the
+// day has ended and a rollup is done.
+type RecordStatsStore interface {
+	// LogRecordActivities logs activities to be rolled up.
+	LogRecordActivities(ctx context.Context, activities []RecordActivity) error
+
+	// RollupRecordStats aggregates activities logged on days before the
+	// day of the specified time into RecordStats, and removes the
+	// aggregated activities.
+	RollupRecordStats(ctx context.Context, before time.Time) error
+
+	// GetRecordStats returns RecordStats of days from the date of from
+	// to the date of to inclusively, ordered by date and record type.
+	// RecordStats of all record types are returned if recordTypes is
+	// empty.
+	GetRecordStats(ctx context.Context, from time.Time, to time.Time, recordTypes []string) ([]RecordStats, error)
+}
+
+// RecordStorage is the storage consumed by records of a type.
+type RecordStorage struct {
+	RecordType string
+	RowCount   uint64
+
+	// TableSize and IndexSize are in bytes.
+	TableSize uint64
+	IndexSize uint64
+
+	// AssetCount is the number of distinct assets referenced by the
+	// records, and AssetSize is their total size in bytes.
+	AssetCount uint64
+	AssetSize  uint64
+}
+
+// StorageStatsStore defines the methods for a Conn that reports the
+// storage consumed by each record type.
+type StorageStatsStore interface {
+	// GetRecordStorage returns RecordStorage of all record types,
+	// ordered by record type.
+	GetRecordStorage(ctx context.Context) ([]RecordStorage, error)
+}
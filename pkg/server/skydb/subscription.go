@@ -14,7 +14,11 @@
 
 package skydb
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 // ErrSubscriptionNotFound is returned from GetSubscription or
 // DeleteSubscription when the specific subscription cannot be found.
@@ -28,6 +32,17 @@ type Subscription struct {
 	DeviceID         string            `json:"device_id"`
 	NotificationInfo *NotificationInfo `json:"notification_info,omitempty"`
 	Query            Query             `json:"query"`
+
+	// LastNotifiedAt is when the device was last notified of a change
+	// of the query, nil if it has never been notified.
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+}
+
+// NotificationRecorder is implemented by Database that can record when
+// the device of a subscription is notified, so that LastNotifiedAt of
+// the subscription is returned afterwards.
+type NotificationRecorder interface {
+	RecordNotification(ctx context.Context, subscription *Subscription, t time.Time) error
 }
 
 // NotificationInfo describes how server should send a notification
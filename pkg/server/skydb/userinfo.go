@@ -19,8 +19,8 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/skygeario/skygear-server/pkg/server/idgen"
 	"github.com/skygeario/skygear-server/pkg/server/utils"
-	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
 // AuthInfo represents the dictionary of authenticated principal ID => authData.
@@ -51,12 +51,36 @@ type UserInfo struct {
 	TokenValidSince *time.Time `json:"token_valid_since,omitempty"`
 	LastLoginAt     *time.Time `json:"last_login_at,omitempty"`
 	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+
+	// LastLoginLocation is nil unless geolocation of client IP is enabled
+	LastLoginLocation *LoginLocation `json:"last_login_location,omitempty"`
+}
+
+// LoginLocation is the coarse location of the client a user logged in
+// from, resolved from the IP address of the client.
+type LoginLocation struct {
+	IP          string `json:"ip,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Region      string `json:"region,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// SameArea returns whether both locations are in the same country and
+// region. Locations from different IPs of the same area are considered
+// the same, since geolocation of IP address is not precise.
+func (l *LoginLocation) SameArea(other *LoginLocation) bool {
+	if l == nil || other == nil {
+		return l == other
+	}
+	return l.CountryCode == other.CountryCode && l.Region == other.Region
 }
 
 // NewUserInfo returns a new UserInfo with specified username, email and
-// password. An UUID4 ID will be generated by the system as unique identifier
+// password. An ID will be generated by the system as unique identifier
+// with the strategy of idgen.
 func NewUserInfo(username string, email string, password string) UserInfo {
-	id := uuid.New()
+	id := idgen.New()
 
 	info := UserInfo{
 		ID:       id,
@@ -72,7 +96,7 @@ func NewUserInfo(username string, email string, password string) UserInfo {
 // no Email and Password.
 func NewAnonymousUserInfo() UserInfo {
 	return UserInfo{
-		ID: uuid.New(),
+		ID: idgen.New(),
 	}
 }
 
@@ -80,7 +104,7 @@ func NewAnonymousUserInfo() UserInfo {
 // which has no Email and Password.
 func NewProvidedAuthUserInfo(principalID string, authData map[string]interface{}) UserInfo {
 	return UserInfo{
-		ID: uuid.New(),
+		ID: idgen.New(),
 		Auth: AuthInfo(map[string]map[string]interface{}{
 			principalID: authData,
 		}),
@@ -108,6 +132,13 @@ func (info UserInfo) IsSamePassword(password string) bool {
 	return bcrypt.CompareHashAndPassword(info.HashedPassword, []byte(password)) == nil
 }
 
+// IsAnonymous returns true if the user signed up without username,
+// email, password or auth provider, and thus cannot log in again once
+// the access token is lost.
+func (info *UserInfo) IsAnonymous() bool {
+	return info.Username == "" && info.Email == "" && len(info.HashedPassword) == 0 && len(info.Auth) == 0
+}
+
 // SetProvidedAuthData sets the auth data to the specified principal.
 func (info *UserInfo) SetProvidedAuthData(principalID string, authData map[string]interface{}) {
 	if info.Auth == nil {
@@ -150,3 +150,15 @@ func TestGetSetProvidedAuthData(t *testing.T) {
 		})
 	})
 }
+
+func TestLoginLocationSameArea(t *testing.T) {
+	Convey("LoginLocation.SameArea", t, func() {
+		hongKong := &LoginLocation{IP: "203.0.113.1", CountryCode: "HK", Region: "Central and Western"}
+
+		So(hongKong.SameArea(&LoginLocation{IP: "203.0.113.2", CountryCode: "HK", Region: "Central and Western"}), ShouldBeTrue)
+		So(hongKong.SameArea(&LoginLocation{CountryCode: "HK", Region: "Sha Tin"}), ShouldBeFalse)
+		So(hongKong.SameArea(&LoginLocation{CountryCode: "TW"}), ShouldBeFalse)
+		So(hongKong.SameArea(nil), ShouldBeFalse)
+		So((*LoginLocation)(nil).SameArea(nil), ShouldBeTrue)
+	})
+}
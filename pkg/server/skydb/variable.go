@@ -0,0 +1,132 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"context"
+	"time"
+)
+
+// A list of names of predicate variables.
+//
+// A predicate variable is an Expression of type Variable whose value is
+// one of these names. Variables are resolved by the server into literals
+// before a query is executed or a subscription is matched against a record,
+// so that a client cannot supply the resolved value itself.
+const (
+	CurrentUserIDVariable = "current_user_id"
+	NowVariable           = "now"
+	UserRolesVariable     = "user_roles"
+)
+
+// IsPredicateVariable returns whether name is a known predicate variable.
+func IsPredicateVariable(name string) bool {
+	switch name {
+	case CurrentUserIDVariable, NowVariable, UserRolesVariable:
+		return true
+	}
+	return false
+}
+
+// PredicateVariables contains the values that predicate variables are
+// resolved into.
+type PredicateVariables struct {
+	UserID string
+	Roles  []string
+	Now    time.Time
+}
+
+// UserPredicateVariables returns the values of predicate variables for
+// the user of the specified ID, such as the owner of a subscription.
+// Roles are left empty if the user cannot be fetched.
+func UserPredicateVariables(ctx context.Context, conn Conn, userID string, now time.Time) PredicateVariables {
+	vars := PredicateVariables{UserID: userID, Now: now}
+	userinfo := UserInfo{}
+	if err := conn.GetUser(ctx, userID, &userinfo); err == nil {
+		vars.Roles = userinfo.Roles
+	}
+	return vars
+}
+
+// Value returns the literal value of the named predicate variable.
+//
+// current_user_id is resolved to nil if there is no user, so that it
+// never equals to any stored value.
+func (vars PredicateVariables) Value(name string) interface{} {
+	switch name {
+	case CurrentUserIDVariable:
+		if vars.UserID == "" {
+			return nil
+		}
+		return vars.UserID
+	case NowVariable:
+		return vars.Now
+	case UserRolesVariable:
+		roles := make([]interface{}, len(vars.Roles))
+		for i, role := range vars.Roles {
+			roles[i] = role
+		}
+		return roles
+	}
+	panic("unknown predicate variable: " + name)
+}
+
+// HasVariables returns whether the predicate or any of its subpredicates
+// contains an Expression of type Variable.
+func (p Predicate) HasVariables() bool {
+	for _, child := range p.Children {
+		switch c := child.(type) {
+		case Predicate:
+			if c.HasVariables() {
+				return true
+			}
+		case Expression:
+			if c.Type == Variable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResolveVariables returns a copy of the predicate with every Expression
+// of type Variable replaced by a literal of the value in vars.
+func (p Predicate) ResolveVariables(vars PredicateVariables) Predicate {
+	if !p.HasVariables() {
+		return p
+	}
+
+	resolved := Predicate{
+		Operator: p.Operator,
+		Children: make([]interface{}, len(p.Children)),
+	}
+	for i, child := range p.Children {
+		switch c := child.(type) {
+		case Predicate:
+			resolved.Children[i] = c.ResolveVariables(vars)
+		case Expression:
+			if c.Type == Variable {
+				c = Expression{
+					Type:  Literal,
+					Value: vars.Value(c.Value.(string)),
+				}
+			}
+			resolved.Children[i] = c
+		default:
+			resolved.Children[i] = child
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,135 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPredicateResolveVariables(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	vars := PredicateVariables{
+		UserID: "user0",
+		Roles:  []string{"admin", "editor"},
+		Now:    now,
+	}
+
+	Convey("ResolveVariables", t, func() {
+		Convey("resolves nested variables into literals", func() {
+			predicate := Predicate{
+				Operator: And,
+				Children: []interface{}{
+					Predicate{
+						Operator: Equal,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "_owner_id"},
+							Expression{Type: Variable, Value: CurrentUserIDVariable},
+						},
+					},
+					Predicate{
+						Operator: In,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "role"},
+							Expression{Type: Variable, Value: UserRolesVariable},
+						},
+					},
+					Predicate{
+						Operator: LessThan,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "publish_at"},
+							Expression{Type: Variable, Value: NowVariable},
+						},
+					},
+				},
+			}
+			So(predicate.Validate(), ShouldBeNil)
+			So(predicate.HasVariables(), ShouldBeTrue)
+
+			resolved := predicate.ResolveVariables(vars)
+			So(resolved.HasVariables(), ShouldBeFalse)
+			So(resolved, ShouldResemble, Predicate{
+				Operator: And,
+				Children: []interface{}{
+					Predicate{
+						Operator: Equal,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "_owner_id"},
+							Expression{Type: Literal, Value: "user0"},
+						},
+					},
+					Predicate{
+						Operator: In,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "role"},
+							Expression{Type: Literal, Value: []interface{}{"admin", "editor"}},
+						},
+					},
+					Predicate{
+						Operator: LessThan,
+						Children: []interface{}{
+							Expression{Type: KeyPath, Value: "publish_at"},
+							Expression{Type: Literal, Value: now},
+						},
+					},
+				},
+			})
+
+			// the original predicate is left untouched
+			So(predicate.HasVariables(), ShouldBeTrue)
+		})
+
+		Convey("resolves current user to null without a user", func() {
+			predicate := Predicate{
+				Operator: Equal,
+				Children: []interface{}{
+					Expression{Type: KeyPath, Value: "_owner_id"},
+					Expression{Type: Variable, Value: CurrentUserIDVariable},
+				},
+			}
+			resolved := predicate.ResolveVariables(PredicateVariables{})
+			So(resolved.Children[1], ShouldResemble, Expression{Type: Literal, Value: nil})
+		})
+
+		Convey("matches record after resolving", func() {
+			record := Record{
+				ID:   NewRecordID("note", "id"),
+				Data: map[string]interface{}{"role": "editor"},
+			}
+			predicate := Predicate{
+				Operator: In,
+				Children: []interface{}{
+					Expression{Type: KeyPath, Value: "role"},
+					Expression{Type: Variable, Value: UserRolesVariable},
+				},
+			}
+			So(predicate.ResolveVariables(vars).MatchRecord(&record), ShouldBeTrue)
+			So(predicate.ResolveVariables(PredicateVariables{}).MatchRecord(&record), ShouldBeFalse)
+		})
+	})
+
+	Convey("Validate rejects variable of wrong kind in IN", t, func() {
+		predicate := Predicate{
+			Operator: In,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "role"},
+				Expression{Type: Variable, Value: CurrentUserIDVariable},
+			},
+		}
+		So(predicate.Validate(), ShouldNotBeNil)
+	})
+}
@@ -131,6 +131,30 @@ const (
 	// a response
 	ResponseTimeout
 
+	// RecordConflict occurs when a client change to a record conflicts
+	// with a change made on the server since the client last synced
+	RecordConflict
+
+	// QuotaExceeded occurs when an operation is rejected because it would
+	// exceed a configured usage quota
+	QuotaExceeded
+
+	// TooManyRequests occurs when a client is making requests faster
+	// than it is allowed to
+	TooManyRequests
+
+	// UnderMaintenance occurs when a request is rejected because the
+	// server is in maintenance mode
+	UnderMaintenance
+
+	// CaptchaRequired occurs when a request is rejected because it
+	// requires a CAPTCHA token that is missing or fails verification
+	CaptchaRequired
+
+	// RequestTooLarge occurs when the request body exceeds the size
+	// accepted by the server
+	RequestTooLarge
+
 	// Error codes for expected error condition should be placed
 	// above this line.
 )
@@ -0,0 +1,89 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats maintains daily counters of record activities, so that
+// basic product analytics do not require exporting the whole database.
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var log = logging.LoggerEntry("stats")
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+// Recorder logs record activities to be rolled up into daily
+// skydb.RecordStats.
+//
+// A nil Recorder or one not enabled logs nothing.
+type Recorder struct {
+	Enabled bool
+}
+
+// IsEnabled returns true if activities are to be logged.
+func (r *Recorder) IsEnabled() bool {
+	return r != nil && r.Enabled
+}
+
+// Log logs activities if conn supports skydb.RecordStatsStore. A failure
+// to log activities should not fail the request, so it is only logged.
+func (r *Recorder) Log(ctx context.Context, conn skydb.Conn, activities []skydb.RecordActivity) {
+	if !r.IsEnabled() || len(activities) == 0 {
+		return
+	}
+
+	store, ok := conn.(skydb.RecordStatsStore)
+	if !ok {
+		return
+	}
+
+	if err := store.LogRecordActivities(ctx, activities); err != nil {
+		log.WithField("err", err).Errorln("failed to log record activities")
+	}
+}
+
+// Rollup aggregates activities logged before today into daily stats.
+func Rollup(ctx context.Context, conn skydb.Conn) error {
+	store, ok := conn.(skydb.RecordStatsStore)
+	if !ok {
+		return nil
+	}
+	return store.RollupRecordStats(ctx, timeNow())
+}
+
+// Schedule adds a job to c that rolls up stats on schedule spec, with a
+// connection opened by connOpener.
+func Schedule(c *cron.Cron, spec string, connOpener func() (skydb.Conn, error)) error {
+	return c.AddFunc(spec, func() {
+		conn, err := connOpener()
+		if err != nil {
+			log.WithField("err", err).Errorln("failed to open connection to roll up stats")
+			return
+		}
+		defer conn.Close()
+
+		if err := Rollup(context.Background(), conn); err != nil {
+			log.WithField("err", err).Errorln("failed to roll up stats")
+			return
+		}
+		log.Debugln("rolled up stats")
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/push"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/workqueue"
 )
 
 // Notice encapsulates the information sent to subscribers when the content of
@@ -33,6 +34,11 @@ type Notice struct {
 	SubscriptionID string
 	Event          skydb.RecordHookEvent
 	Record         *skydb.Record
+
+	// NotificationInfo is the notification info of the subscription with
+	// its templates rendered with Record. It is nil if the subscription
+	// has no notification info.
+	NotificationInfo *skydb.NotificationInfo
 }
 
 // Notifier is the interface implemented by an object that knows how to deliver
@@ -47,12 +53,15 @@ type Notifier interface {
 
 type pushNotifier struct {
 	sender push.Sender
+	queue  *workqueue.Queue
 }
 
 // NewPushNotifier returns an Notifier which sends Notice
-// using the given push.Sender.
-func NewPushNotifier(sender push.Sender) Notifier {
-	return &pushNotifier{sender}
+// using the given push.Sender. If queue is not nil, notices are sent by
+// the bulk workers of the queue, so that they do not delay critical
+// notifications.
+func NewPushNotifier(sender push.Sender, queue *workqueue.Queue) Notifier {
+	return &pushNotifier{sender, queue}
 }
 
 func (notifier *pushNotifier) CanNotify(device skydb.Device) bool {
@@ -60,17 +69,48 @@ func (notifier *pushNotifier) CanNotify(device skydb.Device) bool {
 }
 
 func (notifier *pushNotifier) Notify(device skydb.Device, notice Notice) error {
+	aps := map[string]interface{}{
+		"content_available": 1,
+	}
+	if notice.NotificationInfo != nil {
+		aps = apsMap(notice.NotificationInfo.APS)
+	}
+
 	customMap := map[string]interface{}{
-		"aps": map[string]interface{}{
-			"content_available": 1,
-		},
+		"aps": aps,
 		"_skygear": map[string]interface{}{
 			"seq-num":         notice.SeqNum,
 			"subscription-id": notice.SubscriptionID,
 		},
 	}
 
-	return notifier.sender.Send(push.MapMapper(customMap), device)
+	if notifier.queue == nil {
+		return notifier.sender.Send(push.MapMapper(customMap), device)
+	}
+
+	return notifier.queue.Enqueue(workqueue.Bulk, func() {
+		if err := notifier.sender.Send(push.MapMapper(customMap), device); err != nil {
+			log.WithFields(logrus.Fields{
+				"device": device,
+				"notice": notice,
+				"err":    err,
+			}).Errorf("push-notifier: failed to send notice")
+		}
+	})
+}
+
+func apsMap(setting skydb.APSSetting) map[string]interface{} {
+	aps := map[string]interface{}{}
+	if setting.Alert != nil {
+		aps["alert"] = setting.Alert
+	}
+	if setting.SoundName != "" {
+		aps["sound"] = setting.SoundName
+	}
+	if setting.ShouldSendContentAvailable {
+		aps["content_available"] = 1
+	}
+	return aps
 }
 
 type hubNotifier pubsub.Hub
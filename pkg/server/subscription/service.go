@@ -15,24 +15,48 @@
 package subscription
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/observer"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
 var timeNow = time.Now
 
 // Service is responsible to send push notification to device whenever
-// a record has been modified in db.
+// a record has been modified in db. Observers registered by plugins are
+// notified of the modification as well.
+//
+// A device is not notified of a record hidden from its user by Moderation.
 type Service struct {
 	ConnOpener func() (skydb.Conn, error)
 	Notifier   Notifier
-	stop       chan struct{}
+	Observers  *observer.Registry
+	Moderation *moderation.Pipeline
+
+	mutex   sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
-// Run listens for Conn record event
+// Run listens for Conn record event until Stop is called.
+//
+// An event is acknowledged after push notifications are sent and all
+// observers are notified successfully. An event not acknowledged may be
+// delivered again, in which case push notifications and observers are
+// skipped if the event was delivered to them before.
 func (s *Service) Run() {
+	s.mutex.Lock()
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	stop, stopped := s.stop, s.stopped
+	s.mutex.Unlock()
+	defer close(stopped)
+
 	// maximum number of events per second
 	const EventCountBits = 28
 	const EventCountMask = 1<<EventCountBits - 1
@@ -43,8 +67,6 @@ func (s *Service) Run() {
 		prevUnix      = timeNow().Unix()
 		recordEventCh = s.subscribe()
 	)
-	s.stop = make(chan struct{})
-	defer func() { s.stop = nil }()
 
 	for {
 		select {
@@ -69,20 +91,37 @@ func (s *Service) Run() {
 				eventCount++
 
 				db := getDB(conn, event.Record)
-				s.handleRecordHook(db, event, seqNum)
+				s.handleRecordHook(context.Background(), db, event, seqNum)
+				if err := s.Observers.Observe(event); err != nil {
+					continue
+				}
+				if event.Ack != nil {
+					event.Ack()
+				}
 			default:
 				log.Panicf("subscription: unrecgonized event: %v", event)
 			}
-		case <-s.stop:
+		case <-stop:
 			log.Infoln("subscription: stopping the service")
-			break
+			return
 		}
 	}
 }
 
-// Stop stops the running subscription service
+// Stop stops the running subscription service, waiting for the record
+// event being handled to finish. It does nothing if the service is not
+// running.
 func (s *Service) Stop() {
-	s.stop <- struct{}{}
+	s.mutex.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop = nil
+	s.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
 }
 
 func (s *Service) subscribe() chan skydb.RecordEvent {
@@ -97,20 +136,50 @@ func (s *Service) subscribe() chan skydb.RecordEvent {
 	return ch
 }
 
-func (s *Service) handleRecordHook(db skydb.Database, e skydb.RecordEvent, seqNum uint64) {
-	subscriptions := db.GetMatchingSubscriptions(e.Record)
+func (s *Service) handleRecordHook(ctx context.Context, db skydb.Database, e skydb.RecordEvent, seqNum uint64) {
+	subscriptions := db.GetMatchingSubscriptions(ctx, e.Record)
 	device := skydb.Device{}
 	for _, subscription := range subscriptions {
 		log.Printf("subscription: got a matching sub id = %s", subscription.ID)
 
 		conn := db.Conn()
-		if err := conn.GetDevice(subscription.DeviceID, &device); err != nil {
+		if err := conn.GetDevice(ctx, subscription.DeviceID, &device); err != nil {
 			log.Panicf("subscription: failed to get device with id = %v: %v", subscription.DeviceID, err)
 		}
 
-		notice := Notice{seqNum, subscription.ID, e.Event, e.Record}
+		if s.Moderation != nil && s.Moderation.IsHidden(e.Record, &skydb.UserInfo{ID: device.UserInfoID}) {
+			continue
+		}
+
+		receiver := "subscription:" + subscription.ID
+		if e.IsDelivered(receiver) {
+			continue
+		}
+
+		notice := Notice{
+			SeqNum:         seqNum,
+			SubscriptionID: subscription.ID,
+			Event:          e.Event,
+			Record:         e.Record,
+		}
+		if subscription.NotificationInfo != nil {
+			info := renderNotificationInfo(*subscription.NotificationInfo, e.Record)
+			notice.NotificationInfo = &info
+		}
 		if err := s.Notifier.Notify(device, notice); err != nil {
 			log.Errorf("subscription: failed to send notice to device id = %s", device.ID)
+			continue
+		}
+		e.MarkDelivered(receiver)
+
+		if recorder, ok := db.(skydb.NotificationRecorder); ok {
+			if err := recorder.RecordNotification(ctx, &subscription, timeNow()); err != nil {
+				log.WithFields(logrus.Fields{
+					"subscription": subscription.ID,
+					"deviceID":     device.ID,
+					"err":          err,
+				}).Warnln("subscription: failed to record notification")
+			}
 		}
 	}
 }
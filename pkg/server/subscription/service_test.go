@@ -15,10 +15,12 @@
 package subscription
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/skygeario/skygear-server/pkg/server/moderation"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/mock_skydb"
 	. "github.com/smartystreets/goconvey/convey"
@@ -34,6 +36,12 @@ func (f notifyFunc) Notify(device skydb.Device, notice Notice) error {
 	return f(device, notice)
 }
 
+type deliveryLog map[string]bool
+
+func (d deliveryLog) IsDelivered(receiver string) bool { return d[receiver] }
+
+func (d deliveryLog) MarkDelivered(receiver string) { d[receiver] = true }
+
 func TestService(t *testing.T) {
 	Convey("Subscription Service", t, func() {
 		ctrl := gomock.NewController(t)
@@ -71,11 +79,11 @@ func TestService(t *testing.T) {
 		}
 
 		conn.EXPECT().PublicDB().Return(db).AnyTimes()
-		db.EXPECT().GetMatchingSubscriptions(&record).Return([]skydb.Subscription{
+		db.EXPECT().GetMatchingSubscriptions(context.Background(), &record).Return([]skydb.Subscription{
 			subscription,
 		}).AnyTimes()
 		db.EXPECT().Conn().Return(conn).AnyTimes()
-		conn.EXPECT().GetDevice("deviceid", gomock.Any()).
+		conn.EXPECT().GetDevice(context.Background(), "deviceid", gomock.Any()).
 			SetArg(1, device).
 			Return(nil).
 			AnyTimes()
@@ -149,5 +157,95 @@ func TestService(t *testing.T) {
 			<-done
 			So(n.SeqNum, ShouldEqual, 0x43b940e60000000)
 		})
+
+		Convey("acknowledges handled event", func() {
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				return nil
+			})
+
+			acked := make(chan bool)
+			ch <- skydb.RecordEvent{
+				Record: &record,
+				Event:  skydb.RecordCreated,
+				Ack:    func() { acked <- true },
+			}
+
+			select {
+			case <-acked:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Event not acknowledged after 100 ms")
+			}
+		})
+
+		Convey("records delivered subscription", func() {
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				return nil
+			})
+
+			deliveries := deliveryLog{}
+			acked := make(chan bool)
+			ch <- skydb.RecordEvent{
+				Record:     &record,
+				Event:      skydb.RecordCreated,
+				Ack:        func() { acked <- true },
+				Deliveries: deliveries,
+			}
+
+			select {
+			case <-acked:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Event not acknowledged after 100 ms")
+			}
+			So(deliveries, ShouldResemble, deliveryLog{"subscription:subscriptionid": true})
+		})
+
+		Convey("does not send notice delivered before", func() {
+			notified := false
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				notified = true
+				return nil
+			})
+
+			acked := make(chan bool)
+			ch <- skydb.RecordEvent{
+				Record:     &record,
+				Event:      skydb.RecordCreated,
+				Ack:        func() { acked <- true },
+				Deliveries: deliveryLog{"subscription:subscriptionid": true},
+			}
+
+			select {
+			case <-acked:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Event not acknowledged after 100 ms")
+			}
+			So(notified, ShouldBeFalse)
+		})
+
+		Convey("does not notify of records hidden by moderation", func() {
+			notified := false
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				notified = true
+				return nil
+			})
+			service.Moderation = &moderation.Pipeline{
+				Fields: map[string][]string{"record": []string{"content"}},
+			}
+			record.Data = skydb.Data{"moderation_status": "pending"}
+
+			acked := make(chan bool)
+			ch <- skydb.RecordEvent{
+				Record: &record,
+				Event:  skydb.RecordCreated,
+				Ack:    func() { acked <- true },
+			}
+
+			select {
+			case <-acked:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Event not acknowledged after 100 ms")
+			}
+			So(notified, ShouldBeFalse)
+		})
 	})
 }
@@ -0,0 +1,79 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// templatePattern matches a reference to a record field in a notification
+// template, such as "{{record.author}}".
+var templatePattern = regexp.MustCompile(`\{\{\s*record\.([A-Za-z0-9_]+)\s*\}\}`)
+
+// renderTemplate replaces the references to record fields in tmpl with
+// the values of record. A field that the record does not have is rendered
+// as an empty string.
+func renderTemplate(tmpl string, record *skydb.Record) string {
+	return templatePattern.ReplaceAllStringFunc(tmpl, func(match string) string {
+		if record == nil {
+			return ""
+		}
+		key := templatePattern.FindStringSubmatch(match)[1]
+		return formatTemplateValue(record.Get(key))
+	})
+}
+
+func formatTemplateValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case skydb.Reference:
+		return v.ID.Key
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// renderNotificationInfo returns a copy of info with the templates in
+// the alert body and localization arguments rendered with record.
+func renderNotificationInfo(info skydb.NotificationInfo, record *skydb.Record) skydb.NotificationInfo {
+	if info.APS.Alert == nil {
+		return info
+	}
+
+	alert := *info.APS.Alert
+	alert.Body = renderTemplate(alert.Body, record)
+	if alert.LocalizationArgs != nil {
+		args := make([]string, len(alert.LocalizationArgs))
+		for i, arg := range alert.LocalizationArgs {
+			args[i] = renderTemplate(arg, record)
+		}
+		alert.LocalizationArgs = args
+	}
+
+	info.APS.Alert = &alert
+	return info
+}
@@ -0,0 +1,83 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderNotificationInfo(t *testing.T) {
+	Convey("renderNotificationInfo", t, func() {
+		record := skydb.Record{
+			ID:        skydb.NewRecordID("comment", "0"),
+			CreatorID: "userid",
+			Data: skydb.Data{
+				"author":   "Alice",
+				"likes":    float64(3),
+				"post":     skydb.NewReference("post", "1"),
+				"postedAt": time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		}
+
+		Convey("renders record fields in alert", func() {
+			info := skydb.NotificationInfo{
+				APS: skydb.APSSetting{
+					Alert: &skydb.AppleAlert{
+						Body:             "New comment by {{record.author}} on {{ record.post }}",
+						LocalizationKey:  "NEW_COMMENT",
+						LocalizationArgs: []string{"{{record._created_by}}", "{{record.likes}}", "{{record.postedAt}}"},
+					},
+					SoundName: "default",
+				},
+			}
+
+			rendered := renderNotificationInfo(info, &record)
+			So(rendered, ShouldResemble, skydb.NotificationInfo{
+				APS: skydb.APSSetting{
+					Alert: &skydb.AppleAlert{
+						Body:             "New comment by Alice on 1",
+						LocalizationKey:  "NEW_COMMENT",
+						LocalizationArgs: []string{"userid", "3", "2017-01-02T03:04:05Z"},
+					},
+					SoundName: "default",
+				},
+			})
+			So(info.APS.Alert.Body, ShouldEqual, "New comment by {{record.author}} on {{ record.post }}")
+		})
+
+		Convey("renders missing field as empty string", func() {
+			info := skydb.NotificationInfo{
+				APS: skydb.APSSetting{
+					Alert: &skydb.AppleAlert{Body: "By {{record.editor}}."},
+				},
+			}
+
+			rendered := renderNotificationInfo(info, &record)
+			So(rendered.APS.Alert.Body, ShouldEqual, "By .")
+		})
+
+		Convey("keeps info without alert", func() {
+			info := skydb.NotificationInfo{
+				APS: skydb.APSSetting{ShouldSendContentAvailable: true},
+			}
+
+			So(renderNotificationInfo(info, &record), ShouldResemble, info)
+		})
+	})
+}
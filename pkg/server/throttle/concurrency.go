@@ -0,0 +1,127 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// clientSlots holds a token for each in-flight request of a client.
+type clientSlots struct {
+	tokens chan struct{}
+
+	// users is the number of requests holding or waiting for a token,
+	// so that the slots are discarded once the client is idle.
+	users int
+}
+
+// ConcurrencyLimiter is a router.ConcurrencyLimiter capping the number
+// of in-flight requests of each client. It is separate from Limiter,
+// which limits the rate of writes rather than the number of requests
+// being handled at once.
+//
+// A nil ConcurrencyLimiter or one without a limit admits all requests.
+type ConcurrencyLimiter struct {
+	// MaxInFlight is the maximum number of requests of each client
+	// handled at the same time.
+	MaxInFlight int
+
+	// QueueTimeout is how long an excess request waits for an earlier
+	// request of the client to finish. Excess requests are rejected
+	// immediately if it is zero.
+	QueueTimeout time.Duration
+
+	mutex   sync.Mutex
+	clients map[string]*clientSlots
+}
+
+// Enabled returns true if the number of in-flight requests is limited.
+func (l *ConcurrencyLimiter) Enabled() bool {
+	return l != nil && l.MaxInFlight > 0
+}
+
+// Acquire admits a request of the client identified by key. If the
+// client already has MaxInFlight requests in flight, it waits up to
+// QueueTimeout, or until ctx is done, for one of them to finish. It
+// returns a TooManyRequests error if the request is not admitted.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, key string) (func(), skyerr.Error) {
+	if !l.Enabled() {
+		return func() {}, nil
+	}
+
+	slots := l.join(key)
+	release := func() {
+		<-slots.tokens
+		l.leave(key, slots)
+	}
+
+	select {
+	case slots.tokens <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if l.QueueTimeout > 0 {
+		timer := time.NewTimer(l.QueueTimeout)
+		defer timer.Stop()
+
+		select {
+		case slots.tokens <- struct{}{}:
+			return release, nil
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	l.leave(key, slots)
+	return nil, skyerr.NewErrorWithInfo(
+		skyerr.TooManyRequests,
+		fmt.Sprintf("cannot make more than %d requests at the same time", l.MaxInFlight),
+		map[string]interface{}{
+			"limit": l.MaxInFlight,
+		},
+	)
+}
+
+func (l *ConcurrencyLimiter) join(key string) *clientSlots {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.clients == nil {
+		l.clients = map[string]*clientSlots{}
+	}
+	slots, ok := l.clients[key]
+	if !ok {
+		slots = &clientSlots{tokens: make(chan struct{}, l.MaxInFlight)}
+		l.clients[key] = slots
+	}
+	slots.users++
+	return slots
+}
+
+func (l *ConcurrencyLimiter) leave(key string, slots *clientSlots) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	slots.users--
+	if slots.users == 0 {
+		delete(l.clients, key)
+	}
+}
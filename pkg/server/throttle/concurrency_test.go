@@ -0,0 +1,93 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	Convey("ConcurrencyLimiter", t, func() {
+		ctx := context.Background()
+
+		Convey("admits everything if nil or not limited", func() {
+			var nilLimiter *ConcurrencyLimiter
+			So(nilLimiter.Enabled(), ShouldBeFalse)
+			release, err := nilLimiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+			release()
+		})
+
+		Convey("rejects excess requests of each client", func() {
+			limiter := &ConcurrencyLimiter{MaxInFlight: 2}
+			release0, err := limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+			_, err = limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+
+			_, err = limiter.Acquire(ctx, "client0")
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.TooManyRequests)
+			So(err.Message(), ShouldEqual, "cannot make more than 2 requests at the same time")
+			So(err.Info(), ShouldResemble, map[string]interface{}{"limit": 2})
+
+			_, err = limiter.Acquire(ctx, "client1")
+			So(err, ShouldBeNil)
+
+			release0()
+			_, err = limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("queues excess requests until one is released", func() {
+			limiter := &ConcurrencyLimiter{MaxInFlight: 1, QueueTimeout: time.Second}
+			release, err := limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				release()
+			}()
+			release, err = limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+			release()
+		})
+
+		Convey("rejects queued requests after the queue timeout", func() {
+			limiter := &ConcurrencyLimiter{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond}
+			_, err := limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+
+			_, err = limiter.Acquire(ctx, "client0")
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.TooManyRequests)
+		})
+
+		Convey("discards idle clients", func() {
+			limiter := &ConcurrencyLimiter{MaxInFlight: 1}
+			release, err := limiter.Acquire(ctx, "client0")
+			So(err, ShouldBeNil)
+			So(limiter.clients, ShouldContainKey, "client0")
+
+			release()
+			So(limiter.clients, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// RateLimiter is a router.RateLimiter limiting the number of requests of
+// each client per minute, where a client is identified by a key such as
+// its IP address or API key.
+//
+// A nil RateLimiter or one without a limit allows all requests.
+type RateLimiter struct {
+	// RequestsPerMinute is the maximum number of requests of each
+	// client per minute.
+	RequestsPerMinute int
+
+	// Name describes the key of the limiter in errors, such as "IP
+	// address".
+	Name string
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	requests    map[string]int
+}
+
+// Enabled returns true if the number of requests is limited.
+func (l *RateLimiter) Enabled() bool {
+	return l != nil && l.RequestsPerMinute > 0
+}
+
+// Allow counts a request of the client identified by key. It returns a
+// TooManyRequests error if the request exceeds the limit of the current
+// minute, in which case it is not counted. The error info reports the
+// seconds until requests are allowed again in retry_after.
+func (l *RateLimiter) Allow(key string) skyerr.Error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// All clients share the same window, like Limiter.
+	now := timeNow()
+	window := now.Truncate(time.Minute)
+	if !window.Equal(l.windowStart) || l.requests == nil {
+		l.windowStart = window
+		l.requests = map[string]int{}
+	}
+
+	if l.requests[key] >= l.RequestsPerMinute {
+		return skyerr.NewErrorWithInfo(
+			skyerr.TooManyRequests,
+			fmt.Sprintf("cannot make more than %d requests per minute from the same %s", l.RequestsPerMinute, l.Name),
+			map[string]interface{}{
+				"limit":       l.RequestsPerMinute,
+				"retry_after": int(math.Ceil(window.Add(time.Minute).Sub(now).Seconds())),
+			},
+		)
+	}
+	l.requests[key]++
+	return nil
+}
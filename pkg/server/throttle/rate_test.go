@@ -0,0 +1,60 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiter(t *testing.T) {
+	Convey("RateLimiter", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 20, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		Convey("allows everything if nil or not limited", func() {
+			var nilLimiter *RateLimiter
+			So(nilLimiter.Enabled(), ShouldBeFalse)
+			So(nilLimiter.Allow("10.0.0.1"), ShouldBeNil)
+			So((&RateLimiter{}).Allow("10.0.0.1"), ShouldBeNil)
+		})
+
+		Convey("limits requests of each client per minute", func() {
+			limiter := &RateLimiter{RequestsPerMinute: 2, Name: "IP address"}
+			So(limiter.Allow("10.0.0.1"), ShouldBeNil)
+			So(limiter.Allow("10.0.0.1"), ShouldBeNil)
+
+			err := limiter.Allow("10.0.0.1")
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.TooManyRequests)
+			So(err.Message(), ShouldEqual, "cannot make more than 2 requests per minute from the same IP address")
+			So(err.Info(), ShouldResemble, map[string]interface{}{
+				"limit":       2,
+				"retry_after": 40,
+			})
+
+			So(limiter.Allow("10.0.0.2"), ShouldBeNil)
+
+			now = now.Add(time.Minute)
+			So(limiter.Allow("10.0.0.1"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttle limits how often each user can write records of a
+// record type.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+var timeNow = func() time.Time { return time.Now().UTC() }
+
+type writeKey struct {
+	userID     string
+	recordType string
+}
+
+// Limiter limits the record writes of each user per record type.
+//
+// A nil Limiter or one without any limit allows all writes.
+type Limiter struct {
+	// WritesPerMinute maps a record type to the maximum number of
+	// records of that type each user can create or update per minute.
+	// Record types not in the map are not limited.
+	WritesPerMinute map[string]int
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	writes      map[writeKey]int
+}
+
+// Enabled returns true if any record type is limited.
+func (l *Limiter) Enabled() bool {
+	return l != nil && len(l.WritesPerMinute) > 0
+}
+
+// Allow counts a write of a record of recordType by the user of ID
+// userID. It returns a TooManyRequests error if the write exceeds the
+// limit of the current minute, in which case it is not counted. The
+// error info reports the seconds until writes are allowed again in
+// retry_after.
+func (l *Limiter) Allow(userID string, recordType string) skyerr.Error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	limit := l.WritesPerMinute[recordType]
+	if limit <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// All users share the same window, so that the counts of past
+	// windows are discarded at once instead of growing indefinitely.
+	now := timeNow()
+	window := now.Truncate(time.Minute)
+	if !window.Equal(l.windowStart) || l.writes == nil {
+		l.windowStart = window
+		l.writes = map[writeKey]int{}
+	}
+
+	key := writeKey{userID, recordType}
+	if l.writes[key] >= limit {
+		return skyerr.NewErrorWithInfo(
+			skyerr.TooManyRequests,
+			fmt.Sprintf("cannot write more than %d %s records per minute", limit, recordType),
+			map[string]interface{}{
+				"record_type": recordType,
+				"limit":       limit,
+				"retry_after": int(math.Ceil(window.Add(time.Minute).Sub(now).Seconds())),
+			},
+		)
+	}
+	l.writes[key]++
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimiter(t *testing.T) {
+	Convey("Limiter", t, func() {
+		now := time.Date(2017, 3, 1, 10, 0, 15, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = func() time.Time { return time.Now().UTC() }
+		}()
+
+		Convey("allows everything if nil or not limited", func() {
+			var nilLimiter *Limiter
+			So(nilLimiter.Enabled(), ShouldBeFalse)
+			So(nilLimiter.Allow("user0", "comment"), ShouldBeNil)
+			So((&Limiter{}).Allow("user0", "comment"), ShouldBeNil)
+		})
+
+		Convey("limits writes of each user per record type", func() {
+			limiter := &Limiter{WritesPerMinute: map[string]int{"comment": 2}}
+			So(limiter.Allow("user0", "comment"), ShouldBeNil)
+			So(limiter.Allow("user0", "comment"), ShouldBeNil)
+			So(limiter.Allow("user0", "note"), ShouldBeNil)
+
+			err := limiter.Allow("user0", "comment")
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.TooManyRequests)
+			So(err.Message(), ShouldEqual, "cannot write more than 2 comment records per minute")
+			So(err.Info(), ShouldResemble, map[string]interface{}{
+				"record_type": "comment",
+				"limit":       2,
+				"retry_after": 45,
+			})
+
+			So(limiter.Allow("user1", "comment"), ShouldBeNil)
+
+			now = now.Add(time.Minute)
+			So(limiter.Allow("user0", "comment"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,294 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workqueue runs background tasks, such as sending push
+// notifications and executing asynchronous hooks, on in-process workers.
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/metrics"
+)
+
+var log = logging.LoggerEntry("workqueue")
+
+// Priority is the class of a task. Each class of a Queue has its own
+// lane and workers, so that tasks of a class never wait behind tasks of
+// another class.
+type Priority string
+
+// The priority classes of tasks.
+//
+// Critical is for tasks a user is waiting for, such as a push
+// notification of a one-time password. Bulk is for tasks that can be
+// delayed, such as notifications of subscriptions and analytics hooks.
+const (
+	Critical Priority = "critical"
+	Normal   Priority = "normal"
+	Bulk     Priority = "bulk"
+)
+
+// Priorities lists the priority classes from the highest to the lowest.
+var Priorities = []Priority{Critical, Normal, Bulk}
+
+// ParsePriority returns the Priority of the name. An empty name is
+// Normal.
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return Normal, nil
+	}
+	for _, priority := range Priorities {
+		if string(priority) == name {
+			return priority, nil
+		}
+	}
+	return "", fmt.Errorf("unknown priority %q", name)
+}
+
+// DefaultConcurrency is the number of workers of each class of a Queue
+// if none is configured.
+var DefaultConcurrency = map[Priority]int{
+	Critical: 4,
+	Normal:   2,
+	Bulk:     1,
+}
+
+// defaultLaneSize is the number of tasks a lane holds before Enqueue
+// rejects tasks of its class.
+const defaultLaneSize = 1000
+
+// ErrQueueFull is returned by Enqueue if the lane of the priority class
+// is full.
+var ErrQueueFull = errors.New("workqueue: queue is full")
+
+// ErrQueueShutdown is returned by Enqueue after the queue is shut down.
+var ErrQueueShutdown = errors.New("workqueue: queue is shut down")
+
+var (
+	queuedGauge = metrics.NewGauge(
+		"skygear_work_queue_tasks",
+		"Number of tasks waiting in a work queue.",
+		"queue",
+		"priority",
+	)
+	deadLetterCounter = metrics.NewCounter(
+		"skygear_work_queue_dead_letters_total",
+		"Number of tasks of a work queue given up after all attempts failed.",
+		"queue",
+		"priority",
+	)
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(queuedGauge)
+	metrics.DefaultRegistry.Register(deadLetterCounter)
+}
+
+// RetryPolicy specifies how a failed task is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a task is run before it is
+	// given up. A task is run once if it is not positive.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles on
+	// each subsequent retry.
+	Backoff time.Duration
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	return p.Backoff * time.Duration(1<<uint(attempt-1))
+}
+
+type lane struct {
+	priority Priority
+	tasks    chan func()
+}
+
+// Queue runs tasks on workers of their priority class.
+//
+// A nil Queue runs each task in a new goroutine.
+type Queue struct {
+	name  string
+	lanes map[Priority]*lane
+	wg    sync.WaitGroup
+
+	// mutex guards shutdown, so that no task is sent to a closed lane
+	mutex    sync.RWMutex
+	shutdown bool
+}
+
+// NewQueue returns a Queue with the number of workers of each priority
+// class specified by concurrency. A class not in concurrency gets its
+// DefaultConcurrency.
+func NewQueue(name string, concurrency map[Priority]int) *Queue {
+	return newQueue(name, concurrency, defaultLaneSize)
+}
+
+func newQueue(name string, concurrency map[Priority]int, laneSize int) *Queue {
+	q := &Queue{
+		name:  name,
+		lanes: map[Priority]*lane{},
+	}
+	for _, priority := range Priorities {
+		workers, ok := concurrency[priority]
+		if !ok || workers <= 0 {
+			workers = DefaultConcurrency[priority]
+		}
+
+		l := &lane{
+			priority: priority,
+			tasks:    make(chan func(), laneSize),
+		}
+		q.lanes[priority] = l
+		for i := 0; i < workers; i++ {
+			q.wg.Add(1)
+			go q.work(l)
+		}
+	}
+	return q
+}
+
+func (q *Queue) work(l *lane) {
+	defer q.wg.Done()
+	for task := range l.tasks {
+		queuedGauge.Set(float64(len(l.tasks)), q.name, string(l.priority))
+		q.run(l, task)
+	}
+}
+
+func (q *Queue) run(l *lane, task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("queue", q.name).
+				WithField("priority", l.priority).
+				Errorf("Recovered from panic of task: %v", r)
+		}
+	}()
+	task()
+}
+
+// Enqueue adds the task to the lane of the priority class. An unknown
+// priority is treated as Normal. It returns ErrQueueFull without running
+// the task if the lane is full.
+func (q *Queue) Enqueue(priority Priority, task func()) error {
+	if q == nil {
+		go task()
+		return nil
+	}
+
+	l, ok := q.lanes[priority]
+	if !ok {
+		l = q.lanes[Normal]
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.shutdown {
+		return ErrQueueShutdown
+	}
+
+	select {
+	case l.tasks <- task:
+		queuedGauge.Set(float64(len(l.tasks)), q.name, string(l.priority))
+		return nil
+	default:
+		log.WithField("queue", q.name).
+			WithField("priority", l.priority).
+			Warn("Dropping task because the queue is full")
+		return ErrQueueFull
+	}
+}
+
+// EnqueueRetry adds the task named name to the lane of the priority
+// class like Enqueue. If the task returns an error, it is enqueued again
+// after the backoff of the policy, until it has been run MaxAttempts
+// times. A task that is given up is logged as a dead letter with its
+// last error.
+//
+// Retries are kept in memory only. Tasks waiting for a retry are lost
+// when the process exits, so callers needing guaranteed delivery must
+// persist their tasks themselves.
+func (q *Queue) EnqueueRetry(priority Priority, name string, policy RetryPolicy, task func() error) error {
+	return q.enqueueAttempt(priority, name, policy, task, 1)
+}
+
+func (q *Queue) enqueueAttempt(priority Priority, name string, policy RetryPolicy, task func() error, attempt int) error {
+	return q.Enqueue(priority, func() {
+		err := task()
+		if err == nil {
+			return
+		}
+
+		logger := log.WithField("queue", q.queueName()).
+			WithField("priority", priority).
+			WithField("task", name).
+			WithField("attempt", attempt).
+			WithField("error", err)
+		if attempt >= policy.MaxAttempts {
+			deadLetterCounter.Inc(q.queueName(), string(priority))
+			logger.Error("Giving up task after all attempts failed")
+			return
+		}
+
+		logger.Warn("Retrying failed task")
+		time.AfterFunc(policy.delay(attempt), func() {
+			if err := q.enqueueAttempt(priority, name, policy, task, attempt+1); err != nil {
+				deadLetterCounter.Inc(q.queueName(), string(priority))
+				logger.WithField("error", err).Error("Giving up task that cannot be queued for retry")
+			}
+		})
+	})
+}
+
+func (q *Queue) queueName() string {
+	if q == nil {
+		return ""
+	}
+	return q.name
+}
+
+// Shutdown stops accepting tasks and waits for the enqueued tasks to
+// finish, or until ctx is done. Tasks enqueued after Shutdown, such as
+// retries of failed tasks, are rejected with ErrQueueShutdown.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mutex.Lock()
+	if !q.shutdown {
+		q.shutdown = true
+		for _, l := range q.lanes {
+			close(l.tasks)
+		}
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParsePriority(t *testing.T) {
+	Convey("ParsePriority", t, func() {
+		priority, err := ParsePriority("critical")
+		So(err, ShouldBeNil)
+		So(priority, ShouldEqual, Critical)
+
+		priority, err = ParsePriority("")
+		So(err, ShouldBeNil)
+		So(priority, ShouldEqual, Normal)
+
+		_, err = ParsePriority("urgent")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestQueue(t *testing.T) {
+	Convey("Queue", t, func() {
+		q := newQueue("test", map[Priority]int{
+			Critical: 1,
+			Normal:   1,
+			Bulk:     1,
+		}, 1)
+		defer q.Shutdown(context.Background())
+
+		Convey("runs critical task while bulk tasks are running", func() {
+			blocked := make(chan struct{})
+			defer close(blocked)
+			So(q.Enqueue(Bulk, func() { <-blocked }), ShouldBeNil)
+
+			done := make(chan struct{})
+			So(q.Enqueue(Critical, func() { close(done) }), ShouldBeNil)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				So("critical task is not run", ShouldBeEmpty)
+			}
+		})
+
+		Convey("rejects task if the lane is full", func() {
+			blocked := make(chan struct{})
+			defer close(blocked)
+			started := make(chan struct{})
+			So(q.Enqueue(Bulk, func() {
+				close(started)
+				<-blocked
+			}), ShouldBeNil)
+			<-started
+
+			So(q.Enqueue(Bulk, func() {}), ShouldBeNil)
+			So(q.Enqueue(Bulk, func() {}), ShouldEqual, ErrQueueFull)
+			So(q.Enqueue(Normal, func() {}), ShouldBeNil)
+		})
+
+		Convey("retries failed task", func() {
+			attempts := make(chan int, 3)
+			count := 0
+			So(q.EnqueueRetry(Normal, "flaky", RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, func() error {
+				count++
+				attempts <- count
+				if count < 2 {
+					return errors.New("flaky")
+				}
+				return nil
+			}), ShouldBeNil)
+
+			So(<-attempts, ShouldEqual, 1)
+			So(<-attempts, ShouldEqual, 2)
+			select {
+			case <-attempts:
+				So("succeeded task is retried", ShouldBeEmpty)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+
+		Convey("gives up task after max attempts", func() {
+			attempts := make(chan struct{}, 3)
+			So(q.EnqueueRetry(Normal, "failing", RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, func() error {
+				attempts <- struct{}{}
+				return errors.New("failing")
+			}), ShouldBeNil)
+
+			<-attempts
+			<-attempts
+			select {
+			case <-attempts:
+				So("task is retried after max attempts", ShouldBeEmpty)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+
+		Convey("rejects task after shutdown", func() {
+			So(q.Shutdown(context.Background()), ShouldBeNil)
+			So(q.Enqueue(Normal, func() {}), ShouldEqual, ErrQueueShutdown)
+		})
+
+		Convey("recovers from panic of task", func() {
+			So(q.Enqueue(Normal, func() { panic("oops") }), ShouldBeNil)
+
+			done := make(chan struct{})
+			So(q.Enqueue(Normal, func() { close(done) }), ShouldBeNil)
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				So("task after panic is not run", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("nil Queue", t, func() {
+		var q *Queue
+		done := make(chan struct{})
+		So(q.Enqueue(Critical, func() { close(done) }), ShouldBeNil)
+		<-done
+	})
+}